@@ -360,7 +360,7 @@ export const testUpstream = (
         const upstreamResponse = await apiClient.testUpstream(config);
         const testMessages = Object.keys(upstreamResponse)
             .map((key) => {
-                const message = upstreamResponse[key];
+                const { status: message } = upstreamResponse[key];
                 if (message.startsWith('WARNING:')) {
                     dispatch(addErrorToast({ error: i18next.t('dns_test_warning_toast', { key }) }));
                 } else if (message !== 'OK') {
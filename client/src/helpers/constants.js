@@ -403,6 +403,7 @@ export const SPECIAL_FILTER_ID = {
     PARENTAL: -3,
     SAFE_BROWSING: -4,
     SAFE_SEARCH: -5,
+    QUERY_HOOK: -6,
 };
 
 export const BLOCK_ACTIONS = {
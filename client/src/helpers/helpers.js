@@ -814,6 +814,8 @@ export const getSpecialFilterName = (filterId) => {
             return i18n.t('safe_browsing');
         case SPECIAL_FILTER_ID.SAFE_SEARCH:
             return i18n.t('safe_search');
+        case SPECIAL_FILTER_ID.QUERY_HOOK:
+            return i18n.t('query_hook');
         default:
             return i18n.t('unknown_filter', { filterId });
     }
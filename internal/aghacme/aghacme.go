@@ -0,0 +1,296 @@
+// Package aghacme contains a minimal ACME client that obtains TLS certificates
+// using the HTTP-01 and DNS-01 challenges.
+//
+// See RFC 8555.
+package aghacme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/crypto/acme"
+)
+
+// LetsEncryptURL is the directory URL of the production CA of Let's Encrypt.
+const LetsEncryptURL = acme.LetsEncryptURL
+
+// Challenge is the type of an ACME challenge.
+type Challenge string
+
+// Challenge values.
+const (
+	ChallengeHTTP01 Challenge = "http-01"
+	ChallengeDNS01  Challenge = "dns-01"
+)
+
+// Config is the configuration of a [Client].
+type Config struct {
+	// HTTPClient is used to send requests to the CA.  It must not be nil.
+	HTTPClient *http.Client
+
+	// AccountKey is the private key of the ACME account.  It must not be
+	// nil.
+	AccountKey crypto.Signer
+
+	// HTTP01 serves the HTTP-01 challenges.  It must not be nil if
+	// DNSProvider is nil.
+	HTTP01 *HTTP01Solver
+
+	// DNSProvider is the provider of the DNS-01 challenge records.  If it's
+	// not nil, the DNS-01 challenges are used instead of the HTTP-01 ones.
+	DNSProvider DNSProvider
+
+	// DirectoryURL is the directory URL of the CA.  If it's empty,
+	// [LetsEncryptURL] is used.
+	DirectoryURL string
+
+	// Email is the contact email of the account.  It may be empty.
+	Email string
+
+	// DNSPropagationWait is the time to wait after presenting the DNS-01
+	// challenge records and before asking the CA to validate them.
+	DNSPropagationWait time.Duration
+}
+
+// Client obtains the certificates from an ACME CA.
+type Client struct {
+	conf *Config
+	acme *acme.Client
+}
+
+// New returns a new properly initialized *Client.
+func New(conf *Config) (c *Client) {
+	dirURL := conf.DirectoryURL
+	if dirURL == "" {
+		dirURL = LetsEncryptURL
+	}
+
+	return &Client{
+		conf: conf,
+		acme: &acme.Client{
+			Key:          conf.AccountKey,
+			HTTPClient:   conf.HTTPClient,
+			DirectoryURL: dirURL,
+			UserAgent:    "AdGuardHome",
+		},
+	}
+}
+
+// Obtain registers the account, if necessary, and obtains a new certificate
+// for domains, which must not be empty.  chain and key are PEM-encoded.
+func (c *Client) Obtain(ctx context.Context, domains []string) (chain, key []byte, err error) {
+	defer func() { err = errors.Annotate(err, "obtaining certificate: %w") }()
+
+	err = c.register(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, err := c.acme.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating order: %w", err)
+	}
+
+	for _, u := range order.AuthzURLs {
+		err = c.authorize(ctx, u)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	order, err = c.acme.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("waiting for order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating csr: %w", err)
+	}
+
+	ders, _, err := c.acme.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finalizing order: %w", err)
+	}
+
+	for _, der := range ders {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	key, err = MarshalKey(certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chain, key, nil
+}
+
+// register registers the account with the CA unless it already exists.
+func (c *Client) register(ctx context.Context) (err error) {
+	acct := &acme.Account{}
+	if c.conf.Email != "" {
+		acct.Contact = []string{"mailto:" + c.conf.Email}
+	}
+
+	_, err = c.acme.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("registering account: %w", err)
+	}
+
+	return nil
+}
+
+// authorize fulfills the authorization at u, unless it's already valid.
+func (c *Client) authorize(ctx context.Context, u string) (err error) {
+	authz, err := c.acme.GetAuthorization(ctx, u)
+	if err != nil {
+		return fmt.Errorf("getting authorization: %w", err)
+	} else if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+	defer func() { err = errors.Annotate(err, "authorizing %q: %w", domain) }()
+
+	typ := ChallengeHTTP01
+	if c.conf.DNSProvider != nil {
+		typ = ChallengeDNS01
+	}
+
+	var chal *acme.Challenge
+	for _, ch := range authz.Challenges {
+		if ch.Type == string(typ) {
+			chal = ch
+
+			break
+		}
+	}
+
+	if chal == nil {
+		return fmt.Errorf("no %s challenge offered", typ)
+	}
+
+	cleanup, err := c.present(ctx, domain, chal)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	_, err = c.acme.Accept(ctx, chal)
+	if err != nil {
+		return fmt.Errorf("accepting challenge: %w", err)
+	}
+
+	_, err = c.acme.WaitAuthorization(ctx, authz.URI)
+	if err != nil {
+		return fmt.Errorf("waiting for authorization: %w", err)
+	}
+
+	return nil
+}
+
+// present makes the response to chal for domain available to the CA.  cleanup
+// removes it.
+func (c *Client) present(
+	ctx context.Context,
+	domain string,
+	chal *acme.Challenge,
+) (cleanup func(), err error) {
+	if c.conf.DNSProvider == nil {
+		var keyAuth string
+		keyAuth, err = c.acme.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return nil, fmt.Errorf("computing http-01 response: %w", err)
+		}
+
+		c.conf.HTTP01.set(chal.Token, keyAuth)
+
+		return func() { c.conf.HTTP01.remove(chal.Token) }, nil
+	}
+
+	val, err := c.acme.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return nil, fmt.Errorf("computing dns-01 record: %w", err)
+	}
+
+	fqdn := "_acme-challenge." + strings.TrimPrefix(domain, "*.") + "."
+	err = c.conf.DNSProvider.Present(ctx, fqdn, val)
+	if err != nil {
+		return nil, fmt.Errorf("presenting dns-01 record: %w", err)
+	}
+
+	cleanup = func() {
+		cerr := c.conf.DNSProvider.CleanUp(context.Background(), fqdn, val)
+		if cerr != nil {
+			log.Error("acme: cleaning up dns-01 record for %q: %s", domain, cerr)
+		}
+	}
+
+	if wait := c.conf.DNSPropagationWait; wait > 0 {
+		log.Debug("acme: waiting %s for dns-01 record propagation", wait)
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			cleanup()
+
+			return nil, ctx.Err()
+		case <-timer.C:
+			// Go on.
+		}
+	}
+
+	return cleanup, nil
+}
+
+// NewKey generates a new private key suitable for an ACME account.
+func NewKey() (key crypto.Signer, err error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// MarshalKey returns the PEM encoding of an ECDSA private key.
+func MarshalKey(key crypto.Signer) (data []byte, err error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey parses the PEM-encoded ECDSA private key written by [MarshalKey].
+func ParseKey(data []byte) (key crypto.Signer, err error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, errors.Error("no pem block")
+	}
+
+	return x509.ParseECPrivateKey(b.Bytes)
+}
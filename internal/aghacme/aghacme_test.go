@@ -0,0 +1,158 @@
+package aghacme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	testutil.DiscardLogOutput(m)
+}
+
+func TestHTTP01Solver(t *testing.T) {
+	s := NewHTTP01Solver()
+	s.set("token", "token.thumbprint")
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantBody string
+		wantCode int
+	}{{
+		name:     "known",
+		path:     HTTP01PathPrefix + "token",
+		wantBody: "token.thumbprint",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "unknown",
+		path:     HTTP01PathPrefix + "other",
+		wantBody: "404 page not found\n",
+		wantCode: http.StatusNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+
+	s.remove("token")
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, HTTP01PathPrefix+"token", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNewDNSProvider(t *testing.T) {
+	testCases := []struct {
+		conf       map[string]string
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       map[string]string{"command": "/usr/local/bin/dns-hook"},
+		name:       "exec",
+		wantErrMsg: "",
+	}, {
+		conf:       nil,
+		name:       "exec",
+		wantErrMsg: `dns provider "exec": no command`,
+	}, {
+		conf:       nil,
+		name:       "httpreq",
+		wantErrMsg: `dns provider "httpreq": no endpoint`,
+	}, {
+		conf:       nil,
+		name:       "unknown",
+		wantErrMsg: `unsupported dns provider "unknown", supported: ["exec" "httpreq"]`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDNSProvider(tc.name, tc.conf, http.DefaultClient)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestHTTPReqProvider(t *testing.T) {
+	type record struct {
+		FQDN  string `json:"fqdn"`
+		Value string `json:"value"`
+	}
+
+	var paths []string
+	var records []record
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		rec := record{}
+		err = json.Unmarshal(body, &rec)
+		require.NoError(t, err)
+
+		paths = append(paths, r.URL.Path)
+		records = append(records, rec)
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewDNSProvider("httpreq", map[string]string{
+		"endpoint": srv.URL + "/",
+		"username": "user",
+		"password": "pass",
+	}, srv.Client())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	const fqdn, val = "_acme-challenge.example.org.", "value"
+
+	err = p.Present(ctx, fqdn, val)
+	require.NoError(t, err)
+
+	err = p.CleanUp(ctx, fqdn, val)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/present", "/cleanup"}, paths)
+	assert.Equal(t, []record{{FQDN: fqdn, Value: val}, {FQDN: fqdn, Value: val}}, records)
+
+	p, err = NewDNSProvider("httpreq", map[string]string{"endpoint": srv.URL}, srv.Client())
+	require.NoError(t, err)
+
+	err = p.Present(ctx, fqdn, val)
+	assert.Error(t, err)
+}
+
+func TestMarshalKey(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	data, err := MarshalKey(key)
+	require.NoError(t, err)
+
+	parsed, err := ParseKey(data)
+	require.NoError(t, err)
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	require.True(t, ok)
+
+	assert.True(t, ecKey.Equal(parsed))
+}
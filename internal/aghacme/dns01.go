@@ -0,0 +1,177 @@
+package aghacme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// DNSProvider manages the TXT records for the DNS-01 challenges.
+type DNSProvider interface {
+	// Present creates the TXT record for fqdn with value.
+	Present(ctx context.Context, fqdn, value string) (err error)
+
+	// CleanUp removes the TXT record for fqdn with value.
+	CleanUp(ctx context.Context, fqdn, value string) (err error)
+}
+
+// newDNSProviderFunc returns a new DNSProvider configured with conf.
+type newDNSProviderFunc func(conf map[string]string, cli *http.Client) (p DNSProvider, err error)
+
+// dnsProviders are the constructors of the supported DNS providers by their
+// names.
+var dnsProviders = map[string]newDNSProviderFunc{
+	"exec":    newExecProvider,
+	"httpreq": newHTTPReqProvider,
+}
+
+// DNSProviders returns the sorted names of the supported DNS providers.
+func DNSProviders() (names []string) {
+	names = maps.Keys(dnsProviders)
+	slices.Sort(names)
+
+	return names
+}
+
+// NewDNSProvider returns the DNS provider with the given name configured with
+// conf.  cli is used by the providers which send HTTP requests.
+func NewDNSProvider(name string, conf map[string]string, cli *http.Client) (p DNSProvider, err error) {
+	newProvider, ok := dnsProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dns provider %q, supported: %q", name, DNSProviders())
+	}
+
+	p, err = newProvider(conf, cli)
+	if err != nil {
+		return nil, fmt.Errorf("dns provider %q: %w", name, err)
+	}
+
+	return p, nil
+}
+
+// execProvider is a DNSProvider that runs an external command as
+// "<command> present|cleanup <fqdn> <value>", which is compatible with the exec
+// provider of lego.
+type execProvider struct {
+	command string
+}
+
+// newExecProvider returns a new *execProvider.  conf must contain "command".
+func newExecProvider(conf map[string]string, _ *http.Client) (p DNSProvider, err error) {
+	cmd := conf["command"]
+	if cmd == "" {
+		return nil, errors.Error("no command")
+	}
+
+	return &execProvider{command: cmd}, nil
+}
+
+// type check
+var _ DNSProvider = (*execProvider)(nil)
+
+// Present implements the [DNSProvider] interface for *execProvider.
+func (p *execProvider) Present(ctx context.Context, fqdn, value string) (err error) {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+// CleanUp implements the [DNSProvider] interface for *execProvider.
+func (p *execProvider) CleanUp(ctx context.Context, fqdn, value string) (err error) {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+// run runs the command with args.
+func (p *execProvider) run(ctx context.Context, args ...string) (err error) {
+	out, err := exec.CommandContext(ctx, p.command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("running %q: %w: %s", p.command, err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// httpReqProvider is a DNSProvider that sends the records to an HTTP endpoint
+// as JSON objects with the "fqdn" and "value" properties.  The records are sent
+// to the "/present" and "/cleanup" paths, which is compatible with the httpreq
+// provider of lego.
+type httpReqProvider struct {
+	cli      *http.Client
+	endpoint string
+	username string
+	password string
+}
+
+// newHTTPReqProvider returns a new *httpReqProvider.  conf must contain
+// "endpoint" and may contain "username" and "password" for the basic
+// authentication.
+func newHTTPReqProvider(conf map[string]string, cli *http.Client) (p DNSProvider, err error) {
+	endpoint := conf["endpoint"]
+	if endpoint == "" {
+		return nil, errors.Error("no endpoint")
+	}
+
+	return &httpReqProvider{
+		cli:      cli,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		username: conf["username"],
+		password: conf["password"],
+	}, nil
+}
+
+// type check
+var _ DNSProvider = (*httpReqProvider)(nil)
+
+// Present implements the [DNSProvider] interface for *httpReqProvider.
+func (p *httpReqProvider) Present(ctx context.Context, fqdn, value string) (err error) {
+	return p.send(ctx, "/present", fqdn, value)
+}
+
+// CleanUp implements the [DNSProvider] interface for *httpReqProvider.
+func (p *httpReqProvider) CleanUp(ctx context.Context, fqdn, value string) (err error) {
+	return p.send(ctx, "/cleanup", fqdn, value)
+}
+
+// send sends the record to the endpoint at path.
+func (p *httpReqProvider) send(ctx context.Context, path, fqdn, value string) (err error) {
+	body, err := json.Marshal(map[string]string{
+		"fqdn":  fqdn,
+		"value": value,
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	u := p.endpoint + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: unexpected status code %d", u, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package aghacme
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// HTTP01PathPrefix is the path prefix of the HTTP-01 challenge responses.
+const HTTP01PathPrefix = "/.well-known/acme-challenge/"
+
+// HTTP01Solver serves the responses to the HTTP-01 challenges, which must be
+// available on port 80 of the domains.
+type HTTP01Solver struct {
+	// mu protects keyAuths.
+	mu *sync.Mutex
+
+	// keyAuths are the key authorizations by their tokens.
+	keyAuths map[string]string
+}
+
+// NewHTTP01Solver returns a new properly initialized *HTTP01Solver.
+func NewHTTP01Solver() (s *HTTP01Solver) {
+	return &HTTP01Solver{
+		mu:       &sync.Mutex{},
+		keyAuths: map[string]string{},
+	}
+}
+
+// type check
+var _ http.Handler = (*HTTP01Solver)(nil)
+
+// ServeHTTP implements the [http.Handler] interface for *HTTP01Solver.
+func (s *HTTP01Solver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, HTTP01PathPrefix)
+
+	s.mu.Lock()
+	keyAuth, ok := s.keyAuths[token]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	log.Debug("acme: serving http-01 response for token %q", token)
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(keyAuth))
+}
+
+// set makes keyAuth available for token.
+func (s *HTTP01Solver) set(token, keyAuth string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keyAuths[token] = keyAuth
+}
+
+// remove removes the key authorization for token.
+func (s *HTTP01Solver) remove(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keyAuths, token)
+}
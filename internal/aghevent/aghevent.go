@@ -0,0 +1,238 @@
+// Package aghevent contains the events of AdGuard Home, such as a blocked query
+// or a failed filter list update, which are sent to the external systems.
+package aghevent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// Type is the type of an event.
+type Type string
+
+// Supported event types.
+const (
+	// TypeQueryBlocked is the type of the event of a DNS query blocked by the
+	// filtering.  Its data are:
+	//
+	//   - "domain", the queried domain name;
+	//   - "client_ip", the possibly anonymized IP address of the client;
+	//   - "client_id", the ClientID, if any;
+	//   - "reason", the filtering reason;
+	//   - "rule", the matched rule, if any.
+	TypeQueryBlocked Type = "query_blocked"
+
+	// TypeFilterUpdateFailed is the type of the event of a failed filter list
+	// update.  Its data are "name", "url", and "error".
+	TypeFilterUpdateFailed Type = "filter_update_failed"
+
+	// TypeDHCPLeaseAdded is the type of the event of a new dynamic DHCP lease
+	// granted to a client.  Its data are "hostname", "ip", and "mac".
+	TypeDHCPLeaseAdded Type = "dhcp_lease_added"
+
+	// TypeDHCPLeaseRenewed is the type of the event of a dynamic DHCP lease
+	// renewed by the client.  Its data are the same as for
+	// [TypeDHCPLeaseAdded].
+	TypeDHCPLeaseRenewed Type = "dhcp_lease_renewed"
+
+	// TypeDHCPLeaseReleased is the type of the event of a dynamic DHCP lease
+	// released by the client.  Its data are the same as for
+	// [TypeDHCPLeaseAdded].
+	TypeDHCPLeaseReleased Type = "dhcp_lease_released"
+
+	// TypeDHCPLeaseDeclined is the type of the event of a dynamic DHCP lease
+	// declined by the client.  Its data are the same as for
+	// [TypeDHCPLeaseAdded].
+	TypeDHCPLeaseDeclined Type = "dhcp_lease_declined"
+
+	// TypeDHCPLeaseExpired is the type of the event of an expired dynamic DHCP
+	// lease.  Its data are the same as for [TypeDHCPLeaseAdded].
+	TypeDHCPLeaseExpired Type = "dhcp_lease_expired"
+
+	// TypeUpdateAvailable is the type of the event of a new AdGuard Home
+	// version becoming available.  Its data are "version" and
+	// "announcement_url".
+	TypeUpdateAvailable Type = "update_available"
+
+	// TypeDiskSpaceLow is the type of the event of the free space of a data
+	// directory falling below the threshold.  Its data are "name", "path",
+	// "free", and "min_free", the latter two in bytes.
+	TypeDiskSpaceLow Type = "disk_space_low"
+
+	// TypeParentalBypassStarted is the type of the event of the parental
+	// control and the safe search temporarily disabled for a client with the
+	// bypass PIN.  Its data are "client", the IP address or the ClientID of
+	// the client, "method", either "dns" or "api", and "expires", the time
+	// the bypass ends in RFC 3339 format.
+	TypeParentalBypassStarted Type = "parental_bypass_started"
+
+	// TypeParentalBypassFailed is the type of the event of a failed attempt to
+	// start the parental control bypass, for example because of a wrong PIN.
+	// Its data are "client" and "method", the same as for
+	// [TypeParentalBypassStarted].
+	TypeParentalBypassFailed Type = "parental_bypass_failed"
+
+	// TypeRuleRequestCreated is the type of the event of a new request to
+	// block or unblock a domain, which waits for the approval of an admin.
+	// Its data are "id", "domain", "action", either "block" or "unblock",
+	// "client", the IP address of the requesting client, and "comment".
+	TypeRuleRequestCreated Type = "rule_request_created"
+
+	// TypeDNSTunnelSuspected is the type of the event of a client suspected
+	// of DNS tunneling.  Its data are "client", the IP address or the
+	// ClientID of the client, "domain", the domain it has queried the most,
+	// and "score", the score of the client from 0 to 100.
+	TypeDNSTunnelSuspected Type = "dns_tunnel_suspected"
+)
+
+// Validate returns an error if t is not a known event type.
+func (t Type) Validate() (err error) {
+	switch t {
+	case
+		TypeQueryBlocked,
+		TypeFilterUpdateFailed,
+		TypeDHCPLeaseAdded,
+		TypeDHCPLeaseRenewed,
+		TypeDHCPLeaseReleased,
+		TypeDHCPLeaseDeclined,
+		TypeDHCPLeaseExpired,
+		TypeUpdateAvailable,
+		TypeDiskSpaceLow,
+		TypeParentalBypassStarted,
+		TypeParentalBypassFailed,
+		TypeRuleRequestCreated,
+		TypeDNSTunnelSuspected:
+		return nil
+	default:
+		return fmt.Errorf("bad event type %q", t)
+	}
+}
+
+// Event is a single event.
+type Event struct {
+	// Time is the time when the event has happened.
+	Time time.Time `json:"time"`
+
+	// Data are the properties of the event, which depend on its type.
+	Data map[string]string `json:"data"`
+
+	// Type is the type of the event.
+	Type Type `json:"type"`
+}
+
+// Handler handles the events.
+type Handler interface {
+	// Handle handles e.  It must not block, since it may be called on the
+	// query path, and it must not modify e.
+	Handle(e *Event)
+}
+
+// Bus sends the published events to the subscribed handlers.
+type Bus struct {
+	// mu protects handlers.
+	mu *sync.RWMutex
+
+	// handlers are the subscribed handlers.
+	handlers []Handler
+}
+
+// NewBus returns a new properly initialized *Bus.
+func NewBus() (b *Bus) {
+	return &Bus{
+		mu: &sync.RWMutex{},
+	}
+}
+
+// Subscribe makes h receive the events published after the call.
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// HasHandlers returns true if there are any subscribed handlers.  It allows the
+// publishers to avoid collecting the event data when there is no one to send it
+// to.
+func (b *Bus) HasHandlers() (ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.handlers) > 0
+}
+
+// Publish sends an event of type t with data to the subscribed handlers.
+func (b *Bus) Publish(t Type, data map[string]string) {
+	e := &Event{
+		Time: time.Now(),
+		Data: data,
+		Type: t,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, h := range b.handlers {
+		h.Handle(e)
+	}
+}
+
+// Filter selects the events by their types and the domains of the
+// [TypeQueryBlocked] events.
+type Filter struct {
+	// types are the types of the selected events.
+	types map[Type]struct{}
+
+	// domains are the lowercased watched domains.
+	domains *stringutil.Set
+}
+
+// NewFilter returns a new *Filter selecting the events of types.  If domains
+// are not empty, the [TypeQueryBlocked] events are only selected if the queried
+// domain is one of domains or their subdomain.
+func NewFilter(types []Type, domains []string) (f *Filter) {
+	f = &Filter{
+		types:   make(map[Type]struct{}, len(types)),
+		domains: stringutil.NewSet(),
+	}
+
+	for _, t := range types {
+		f.types[t] = struct{}{}
+	}
+
+	for _, d := range domains {
+		f.domains.Add(strings.ToLower(strings.TrimSuffix(d, ".")))
+	}
+
+	return f
+}
+
+// Match returns true if e is selected by f.
+func (f *Filter) Match(e *Event) (ok bool) {
+	if _, ok = f.types[e.Type]; !ok {
+		return false
+	}
+
+	if e.Type != TypeQueryBlocked || f.domains.Len() == 0 {
+		return true
+	}
+
+	for d := strings.ToLower(e.Data["domain"]); d != ""; {
+		if f.domains.Has(d) {
+			return true
+		}
+
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+
+		d = d[i+1:]
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package aghevent_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handlerFunc is a function that implements [aghevent.Handler].
+type handlerFunc func(e *aghevent.Event)
+
+// Handle implements the [aghevent.Handler] interface for handlerFunc.
+func (f handlerFunc) Handle(e *aghevent.Event) { f(e) }
+
+func TestBus(t *testing.T) {
+	b := aghevent.NewBus()
+	assert.False(t, b.HasHandlers())
+
+	var got []*aghevent.Event
+	b.Subscribe(handlerFunc(func(e *aghevent.Event) { got = append(got, e) }))
+	require.True(t, b.HasHandlers())
+
+	data := map[string]string{"version": "v0.107.27"}
+	b.Publish(aghevent.TypeUpdateAvailable, data)
+
+	require.Len(t, got, 1)
+
+	assert.Equal(t, aghevent.TypeUpdateAvailable, got[0].Type)
+	assert.Equal(t, data, got[0].Data)
+	assert.False(t, got[0].Time.IsZero())
+}
+
+func TestType_Validate(t *testing.T) {
+	testutil.AssertErrorMsg(t, "", aghevent.TypeQueryBlocked.Validate())
+	testutil.AssertErrorMsg(t, `bad event type "query"`, aghevent.Type("query").Validate())
+}
+
+func TestFilter_Match(t *testing.T) {
+	f := aghevent.NewFilter(
+		[]aghevent.Type{aghevent.TypeQueryBlocked, aghevent.TypeUpdateAvailable},
+		[]string{"Example.org."},
+	)
+
+	testCases := []struct {
+		event *aghevent.Event
+		name  string
+		want  bool
+	}{{
+		event: &aghevent.Event{Type: aghevent.TypeUpdateAvailable},
+		name:  "other_type",
+		want:  true,
+	}, {
+		event: &aghevent.Event{Type: aghevent.TypeDHCPLeaseAdded},
+		name:  "not_selected_type",
+		want:  false,
+	}, {
+		event: &aghevent.Event{
+			Type: aghevent.TypeQueryBlocked,
+			Data: map[string]string{"domain": "example.org"},
+		},
+		name: "watched",
+		want: true,
+	}, {
+		event: &aghevent.Event{
+			Type: aghevent.TypeQueryBlocked,
+			Data: map[string]string{"domain": "ads.example.org"},
+		},
+		name: "watched_subdomain",
+		want: true,
+	}, {
+		event: &aghevent.Event{
+			Type: aghevent.TypeQueryBlocked,
+			Data: map[string]string{"domain": "badexample.org"},
+		},
+		name: "not_watched",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, f.Match(tc.event))
+		})
+	}
+}
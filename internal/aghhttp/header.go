@@ -6,20 +6,35 @@ package aghhttp
 //
 // TODO(a.garipov): Remove unused.
 const (
-	HdrNameAcceptEncoding           = "Accept-Encoding"
-	HdrNameAccessControlAllowOrigin = "Access-Control-Allow-Origin"
-	HdrNameAltSvc                   = "Alt-Svc"
-	HdrNameContentEncoding          = "Content-Encoding"
-	HdrNameContentType              = "Content-Type"
-	HdrNameOrigin                   = "Origin"
-	HdrNameServer                   = "Server"
-	HdrNameTrailer                  = "Trailer"
-	HdrNameUserAgent                = "User-Agent"
-	HdrNameVary                     = "Vary"
+	HdrNameAccept                        = "Accept"
+	HdrNameAcceptEncoding                = "Accept-Encoding"
+	HdrNameAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HdrNameAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HdrNameAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HdrNameAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HdrNameAccessControlMaxAge           = "Access-Control-Max-Age"
+	HdrNameAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HdrNameAltSvc                        = "Alt-Svc"
+	HdrNameCacheControl                  = "Cache-Control"
+	HdrNameConnection                    = "Connection"
+	HdrNameContentEncoding               = "Content-Encoding"
+	HdrNameContentType                   = "Content-Type"
+	HdrNameLastEventID                   = "Last-Event-ID"
+	HdrNameOrigin                        = "Origin"
+	HdrNameRetryAfter                    = "Retry-After"
+	HdrNameServer                        = "Server"
+	HdrNameTrailer                       = "Trailer"
+	HdrNameUserAgent                     = "User-Agent"
+	HdrNameVary                          = "Vary"
+	HdrNameXCSRFToken                    = "X-CSRF-Token"
 )
 
 // HTTP header value constants.
 const (
 	HdrValApplicationJSON = "application/json"
+	HdrValApplicationYAML = "application/yaml"
+	HdrValClose           = "close"
+	HdrValNoCache         = "no-cache"
+	HdrValTextEventStream = "text/event-stream"
 	HdrValTextPlain       = "text/plain"
 )
@@ -0,0 +1,162 @@
+package aghhttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// JSON Stream
+
+// jsonStreamFlushEvery is the number of array elements after which the
+// response is flushed to the client.
+const jsonStreamFlushEvery = 100
+
+// JSONStream writes a JSON object into an HTTP response field by field.  The
+// elements of array fields are encoded one by one and the response is flushed
+// periodically, so that large responses are never kept in memory entirely.  The
+// first error is kept and returned by [JSONStream.Close], all the writes after
+// it are no-op.  A JSONStream is not safe for concurrent use.
+type JSONStream struct {
+	// err is the first error occurred, if any.
+	err error
+
+	// w is the HTTP response.
+	w http.ResponseWriter
+
+	// buf is the buffer over w.
+	buf *bufio.Writer
+
+	// enc encodes the values into buf.
+	enc *json.Encoder
+
+	// unflushed is the number of array elements written since the last flush.
+	unflushed int
+
+	// hasField is true if a field has been written to the object already.
+	hasField bool
+
+	// hasElem is true if an element has been written to the current array
+	// already.
+	hasElem bool
+}
+
+// NewJSONStream sets the content-type header in w.Header() to
+// "application/json", writes a header with a "200 OK" status, and returns a
+// new *JSONStream writing an object into w.
+func NewJSONStream(w http.ResponseWriter) (s *JSONStream) {
+	w.Header().Set(HdrNameContentType, HdrValApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+
+	buf := bufio.NewWriter(w)
+	s = &JSONStream{
+		w:   w,
+		buf: buf,
+		enc: json.NewEncoder(buf),
+	}
+
+	s.writeString("{")
+
+	return s
+}
+
+// Field writes the field with the given name and v encoded as its value.
+func (s *JSONStream) Field(name string, v any) {
+	s.writeName(name)
+	s.encode(v)
+}
+
+// BeginArray writes the name of the array field and opens the array.  The
+// elements are written with [JSONStream.Elem] until [JSONStream.EndArray] is
+// called.
+func (s *JSONStream) BeginArray(name string) {
+	s.writeName(name)
+	s.writeString("[")
+	s.hasElem = false
+}
+
+// Elem writes v encoded as the next element of the current array.
+func (s *JSONStream) Elem(v any) {
+	if s.hasElem {
+		s.writeString(",")
+	}
+
+	s.hasElem = true
+	s.encode(v)
+
+	s.unflushed++
+	if s.unflushed >= jsonStreamFlushEvery {
+		s.flush()
+	}
+}
+
+// EndArray closes the current array.
+func (s *JSONStream) EndArray() {
+	s.writeString("]")
+}
+
+// Close closes the object, flushes the response, and returns the first error
+// occurred while writing, if any.
+func (s *JSONStream) Close() (err error) {
+	s.writeString("}\n")
+	s.flush()
+
+	return s.err
+}
+
+// writeName writes the name of the next field along with the separator, if
+// needed.
+func (s *JSONStream) writeName(name string) {
+	if s.hasField {
+		s.writeString(",")
+	}
+
+	s.hasField = true
+	s.encode(name)
+	s.writeString(":")
+}
+
+// writeString writes str as is.
+func (s *JSONStream) writeString(str string) {
+	if s.err != nil {
+		return
+	}
+
+	_, err := s.buf.WriteString(str)
+	if err != nil {
+		s.err = fmt.Errorf("writing: %w", err)
+	}
+}
+
+// encode writes v encoded as JSON.
+func (s *JSONStream) encode(v any) {
+	if s.err != nil {
+		return
+	}
+
+	err := s.enc.Encode(v)
+	if err != nil {
+		s.err = fmt.Errorf("encoding: %w", err)
+	}
+}
+
+// flush writes the buffered data into the response and flushes it to the
+// client, if possible.
+func (s *JSONStream) flush() {
+	s.unflushed = 0
+	if s.err != nil {
+		return
+	}
+
+	err := s.buf.Flush()
+	if err != nil {
+		s.err = fmt.Errorf("flushing: %w", err)
+
+		return
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
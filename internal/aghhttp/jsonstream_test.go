@@ -0,0 +1,80 @@
+package aghhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStream(t *testing.T) {
+	type elem struct {
+		Name string `json:"name"`
+		Num  int    `json:"num"`
+	}
+
+	type object struct {
+		Elems []elem   `json:"elems"`
+		Empty []elem   `json:"empty"`
+		Tags  []string `json:"tags"`
+		Total int      `json:"total"`
+	}
+
+	const elemsNum = 250
+
+	want := object{
+		Elems: make([]elem, 0, elemsNum),
+		Empty: []elem{},
+		Tags:  []string{"a", "b"},
+		Total: elemsNum,
+	}
+
+	for i := 0; i < elemsNum; i++ {
+		want.Elems = append(want.Elems, elem{Name: "elem", Num: i})
+	}
+
+	rw := httptest.NewRecorder()
+	s := aghhttp.NewJSONStream(rw)
+
+	s.BeginArray("elems")
+	for _, e := range want.Elems {
+		s.Elem(e)
+	}
+	s.EndArray()
+
+	s.BeginArray("empty")
+	s.EndArray()
+
+	s.Field("tags", want.Tags)
+	s.Field("total", want.Total)
+
+	err := s.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, aghhttp.HdrValApplicationJSON, rw.Header().Get(aghhttp.HdrNameContentType))
+	assert.True(t, rw.Flushed)
+
+	var got object
+	err = json.Unmarshal(rw.Body.Bytes(), &got)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, got)
+}
+
+func TestJSONStream_error(t *testing.T) {
+	rw := httptest.NewRecorder()
+	s := aghhttp.NewJSONStream(rw)
+
+	s.BeginArray("elems")
+	s.Elem(make(chan int))
+	s.Elem(1)
+	s.EndArray()
+
+	err := s.Close()
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package aghhttp
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+)
+
+// Rate Limiting
+
+// RateLimiterConfig is the configuration structure for a [RateLimiter].
+type RateLimiterConfig struct {
+	// Allowlist are the subnets requests from which are never limited.
+	Allowlist []netip.Prefix
+
+	// BlockDuration is the duration for which a client is blocked after
+	// exceeding the limit.
+	BlockDuration time.Duration
+
+	// RPS is the maximum number of requests per second from a single IP
+	// address.  It must be positive.
+	RPS uint
+}
+
+// BlockedAddr is an IP address blocked by a [RateLimiter].
+type BlockedAddr struct {
+	// Until is the time when the block expires.
+	Until time.Time
+
+	// Addr is the blocked address.
+	Addr netip.Addr
+}
+
+// RateLimiter limits the number of HTTP requests per second from a single IP
+// address and blocks the addresses that exceed the limit.  It is safe for
+// concurrent use.
+type RateLimiter struct {
+	// mu protects clients and lastCleanup.
+	mu *sync.Mutex
+
+	// clients are the current states of the clients.
+	clients map[netip.Addr]*rateLimitedClient
+
+	// lastCleanup is the time of the last removal of the stale clients.
+	lastCleanup time.Time
+
+	allowlist []netip.Prefix
+	blockDur  time.Duration
+	rps       uint
+}
+
+// rateLimitedClient is the state of a single client of a [RateLimiter].
+type rateLimitedClient struct {
+	// windowStart is the start of the current one-second window.
+	windowStart time.Time
+
+	// blockedUntil is the time when the block of the client expires.  It is
+	// zero if the client is not blocked.
+	blockedUntil time.Time
+
+	// num is the number of requests within the current window.
+	num uint
+}
+
+// NewRateLimiter returns a new properly initialized *RateLimiter.  c must not
+// be nil.
+func NewRateLimiter(c *RateLimiterConfig) (l *RateLimiter) {
+	return &RateLimiter{
+		mu:        &sync.Mutex{},
+		clients:   map[netip.Addr]*rateLimitedClient{},
+		allowlist: slices.Clone(c.Allowlist),
+		blockDur:  c.BlockDuration,
+		rps:       c.RPS,
+	}
+}
+
+// IsAllowlisted returns true if ip is within one of the trusted subnets.
+func (l *RateLimiter) IsAllowlisted(ip netip.Addr) (ok bool) {
+	ip = ip.Unmap()
+	for _, p := range l.allowlist {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Wrap returns a handler that responds with 429 Too Many Requests to the
+// requests from clients that have exceeded the limit and passes all other
+// requests to h.  Requests with addresses that cannot be parsed, for example
+// the ones from Unix domain sockets, are never limited.
+func (l *RateLimiter) Wrap(h http.Handler) (wrapped http.Handler) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		left := l.check(addrPort.Addr().Unmap(), time.Now())
+		if left <= 0 {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		log.Debug("ratelimit: %s %s: %s is blocked for %s", r.Method, r.URL.Path, r.RemoteAddr, left)
+
+		// Round the duration up so that the clients don't retry too early.
+		retryAfter := (left + time.Second - 1) / time.Second
+		w.Header().Set(HdrNameRetryAfter, strconv.FormatInt(int64(retryAfter), 10))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+}
+
+// check registers a request from ip and returns the time left until the
+// client is unblocked.  The nonpositive result means that the request is
+// allowed.
+func (l *RateLimiter) check(ip netip.Addr, now time.Time) (left time.Duration) {
+	if l.IsAllowlisted(ip) {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanupLocked(now)
+
+	c, ok := l.clients[ip]
+	if !ok {
+		l.clients[ip] = &rateLimitedClient{
+			windowStart: now,
+			num:         1,
+		}
+
+		return 0
+	}
+
+	if now.Before(c.blockedUntil) {
+		return c.blockedUntil.Sub(now)
+	}
+
+	if now.Sub(c.windowStart) >= time.Second {
+		c.windowStart, c.num = now, 0
+	}
+
+	c.num++
+	if c.num <= l.rps {
+		return 0
+	}
+
+	c.blockedUntil = now.Add(l.blockDur)
+	log.Info("ratelimit: blocking %s for %s", ip, l.blockDur)
+
+	return l.blockDur
+}
+
+// cleanupLocked removes the clients that are neither blocked nor have made any
+// requests within the current window.  It only does that once per second.
+// l.mu is expected to be locked.
+func (l *RateLimiter) cleanupLocked(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Second {
+		return
+	}
+
+	l.lastCleanup = now
+	for ip, c := range l.clients {
+		if now.Sub(c.windowStart) >= time.Second && !now.Before(c.blockedUntil) {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// Blocked returns the addresses that are currently blocked sorted by address.
+func (l *RateLimiter) Blocked() (blocked []*BlockedAddr) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ip, c := range l.clients {
+		if now.Before(c.blockedUntil) {
+			blocked = append(blocked, &BlockedAddr{
+				Until: c.blockedUntil,
+				Addr:  ip,
+			})
+		}
+	}
+
+	slices.SortFunc(blocked, func(a, b *BlockedAddr) (less bool) {
+		return a.Addr.Less(b.Addr)
+	})
+
+	return blocked
+}
+
+// Unblock removes the block and resets the request counter for ip.  If ip is
+// not valid, all clients are unblocked.
+func (l *RateLimiter) Unblock(ip netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !ip.IsValid() {
+		l.clients = map[netip.Addr]*rateLimitedClient{}
+
+		return
+	}
+
+	delete(l.clients, ip.Unmap())
+}
@@ -0,0 +1,81 @@
+package aghhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_check(t *testing.T) {
+	const blockDur = 1 * time.Minute
+
+	trustedIP := netip.MustParseAddr("192.168.1.2")
+	ip := netip.MustParseAddr("192.168.2.2")
+
+	l := NewRateLimiter(&RateLimiterConfig{
+		Allowlist:     []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		BlockDuration: blockDur,
+		RPS:           2,
+	})
+
+	now := time.Now()
+
+	assert.Zero(t, l.check(ip, now))
+	assert.Zero(t, l.check(ip, now))
+	assert.Equal(t, blockDur, l.check(ip, now))
+
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, l.check(trustedIP, now))
+	}
+
+	// The block must outlive the window.
+	later := now.Add(2 * time.Second)
+	assert.Equal(t, blockDur-2*time.Second, l.check(ip, later))
+
+	// The block must expire.
+	later = now.Add(blockDur)
+	assert.Zero(t, l.check(ip, later))
+}
+
+func TestRateLimiter_Wrap(t *testing.T) {
+	l := NewRateLimiter(&RateLimiterConfig{
+		BlockDuration: 1 * time.Minute,
+		RPS:           1,
+	})
+
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	const remoteAddr = "192.168.2.2:12345"
+
+	do := func() (rw *httptest.ResponseRecorder) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+
+		return rw
+	}
+
+	assert.Equal(t, http.StatusOK, do().Code)
+
+	rw := do()
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "60", rw.Header().Get("Retry-After"))
+
+	blocked := l.Blocked()
+	require.Len(t, blocked, 1)
+
+	assert.Equal(t, netip.MustParseAddr("192.168.2.2"), blocked[0].Addr)
+
+	l.Unblock(netip.Addr{})
+
+	assert.Empty(t, l.Blocked())
+	assert.Equal(t, http.StatusOK, do().Code)
+}
@@ -0,0 +1,271 @@
+// Package aghlog contains the structured output of the log with the per-module
+// log levels.
+//
+// The modules of AdGuard Home log using the prefixes of the messages, for
+// example "dnsforward: ", which are parsed into the module names.
+package aghlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/maps"
+)
+
+// Level is the log level of a module.
+type Level string
+
+// Level values.
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelError Level = "error"
+)
+
+// severity returns the severity of the messages with level l.  The fatal and
+// panic messages have the highest severity, and the messages of unknown levels
+// are considered info ones.
+func (l Level) severity() (sev int) {
+	switch l {
+	case LevelDebug:
+		return 0
+	case LevelError, "fatal", "panic":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Validate returns an error if l isn't a valid level.
+func (l Level) Validate() (err error) {
+	switch l {
+	case LevelDebug, LevelInfo, LevelError:
+		return nil
+	default:
+		return fmt.Errorf("bad log level %q", l)
+	}
+}
+
+// Format is the format of the log output.
+type Format string
+
+// Format values.
+const (
+	// FormatText is the default format of the golibs log.
+	FormatText Format = "text"
+
+	// FormatJSON is the format with a JSON object on each line.
+	FormatJSON Format = "json"
+)
+
+// Validate returns an error if f isn't a valid format.  The empty format is
+// considered [FormatText].
+func (f Format) Validate() (err error) {
+	switch f {
+	case "", FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("bad log format %q", f)
+	}
+}
+
+// entryRe matches the level of the log lines written by the golibs log.  The
+// optional process and goroutine IDs are written in the verbose mode.
+var entryRe = regexp.MustCompile(`(?:\d+#\d+ )?\[([a-z]+)\] `)
+
+// moduleRe matches the names of the modules, which are the prefixes of the log
+// messages.
+var moduleRe = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,31}$`)
+
+// Entry is a parsed log entry.
+type Entry struct {
+	// Time is the time of the entry.
+	Time time.Time `json:"time"`
+
+	// Level is the level of the entry.
+	Level Level `json:"level"`
+
+	// Module is the name of the module that has logged the entry, if any.
+	Module string `json:"module,omitempty"`
+
+	// Message is the message without the module prefix.
+	Message string `json:"msg"`
+}
+
+// ParseEntry parses line, which is a log line written by the golibs log, into
+// an entry.  The lines without a level are considered info ones.  The time of
+// e isn't set.
+func ParseEntry(line string) (e *Entry) {
+	e = &Entry{
+		Level: LevelInfo,
+	}
+
+	msg := line
+	if m := entryRe.FindStringSubmatchIndex(line); m != nil {
+		e.Level, msg = Level(line[m[2]:m[3]]), line[m[1]:]
+	}
+
+	e.Module, e.Message = SplitModule(msg)
+
+	return e
+}
+
+// SplitModule splits msg into the name of the module and the rest of the
+// message.  module is empty if msg doesn't start with a module name.
+func SplitModule(msg string) (module, rest string) {
+	module, rest, ok := strings.Cut(msg, ": ")
+	if !ok || !moduleRe.MatchString(module) {
+		return "", msg
+	}
+
+	return module, rest
+}
+
+// Writer is an [io.Writer] that filters the log output using the per-module
+// levels and formats it.  It's safe for concurrent use.
+type Writer struct {
+	// w is the underlying writer.
+	w io.Writer
+
+	// mu protects defaultLevel and levels.
+	mu *sync.RWMutex
+
+	// levels are the log levels by the module names.
+	levels map[string]Level
+
+	// defaultLevel is the log level of the modules not within levels.
+	defaultLevel Level
+
+	// format is the format of the output.
+	format Format
+}
+
+// NewWriter returns a new *Writer that writes to w in format and sets the
+// levels.  For [FormatJSON], the flags of the log must be set to zero, since
+// the time is added by the writer.  All arguments must be valid.
+func NewWriter(w io.Writer, format Format, defaultLevel Level, levels map[string]Level) (lw *Writer) {
+	lw = &Writer{
+		w:      w,
+		mu:     &sync.RWMutex{},
+		format: format,
+	}
+
+	lw.SetLevels(defaultLevel, levels)
+
+	return lw
+}
+
+// type check
+var _ io.Writer = (*Writer)(nil)
+
+// Write implements the [io.Writer] interface for *Writer.  p must be a single
+// log line.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.format != FormatJSON && w.isDefaultOnly() {
+		return w.w.Write(p)
+	}
+
+	e := ParseEntry(strings.TrimRight(string(p), "\r\n"))
+	if e.Level.severity() < w.level(e.Module).severity() {
+		return len(p), nil
+	}
+
+	if w.format != FormatJSON {
+		return w.w.Write(p)
+	}
+
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return 0, err
+	}
+
+	_, err = w.w.Write(append(data, '\n'))
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// isDefaultOnly returns true if there are no per-module levels, so the golibs
+// log filters the messages by itself.
+func (w *Writer) isDefaultOnly() (ok bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return len(w.levels) == 0
+}
+
+// level returns the log level of the module.
+func (w *Writer) level(module string) (l Level) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if l, ok := w.levels[module]; ok {
+		return l
+	}
+
+	return w.defaultLevel
+}
+
+// Levels returns the default log level and a copy of the per-module ones.
+func (w *Writer) Levels() (defaultLevel Level, levels map[string]Level) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.defaultLevel, maps.Clone(w.levels)
+}
+
+// SetLevels sets the default log level and the per-module ones.  It also sets
+// the level of the golibs log to the lowest of them, so that the messages of
+// the modules with the debug level are written.  All levels must be valid.
+func (w *Writer) SetLevels(defaultLevel Level, levels map[string]Level) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.defaultLevel, w.levels = defaultLevel, maps.Clone(levels)
+
+	lowest := defaultLevel
+	for _, l := range levels {
+		if l.severity() < lowest.severity() {
+			lowest = l
+		}
+	}
+
+	switch lowest {
+	case LevelDebug:
+		log.SetLevel(log.DEBUG)
+	case LevelError:
+		log.SetLevel(log.ERROR)
+	default:
+		log.SetLevel(log.INFO)
+	}
+}
+
+// ValidateLevels returns an error if any of levels isn't valid.
+func ValidateLevels(levels map[string]Level) (err error) {
+	var errs []error
+	for mod, l := range levels {
+		if !moduleRe.MatchString(mod) {
+			errs = append(errs, fmt.Errorf("bad module name %q", mod))
+		} else if err = l.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("module %q: %w", mod, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.List("validating levels", errs...)
+	}
+
+	return nil
+}
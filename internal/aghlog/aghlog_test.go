@@ -0,0 +1,139 @@
+package aghlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEntry(t *testing.T) {
+	testCases := []struct {
+		want *aghlog.Entry
+		name string
+		line string
+	}{{
+		want: &aghlog.Entry{
+			Level:   aghlog.LevelInfo,
+			Module:  "",
+			Message: "plain message",
+		},
+		name: "no_level",
+		line: "plain message",
+	}, {
+		want: &aghlog.Entry{
+			Level:   aghlog.LevelError,
+			Module:  "filtering",
+			Message: "updating filter 1: timeout",
+		},
+		name: "flags",
+		line: "2023/03/01 12:00:00.000000 [error] filtering: updating filter 1: timeout",
+	}, {
+		want: &aghlog.Entry{
+			Level:   aghlog.LevelDebug,
+			Module:  "dnsforward",
+			Message: "handling request",
+		},
+		name: "ids",
+		line: "2023/03/01 12:00:00.000000 123#45 [debug] dnsforward: handling request",
+	}, {
+		want: &aghlog.Entry{
+			Level:   aghlog.LevelInfo,
+			Module:  "",
+			Message: "AdGuard Home is running as a service",
+		},
+		name: "no_flags_no_module",
+		line: "[info] AdGuard Home is running as a service",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, aghlog.ParseEntry(tc.line))
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	prev := log.GetLevel()
+	t.Cleanup(func() { log.SetLevel(prev) })
+
+	lines := []string{
+		"[debug] querylog: debug message",
+		"[info] querylog: info message",
+		"[debug] dnsforward: debug message",
+		"[info] dnsforward: info message",
+		"[error] dnsforward: error message",
+	}
+
+	buf := &bytes.Buffer{}
+	w := aghlog.NewWriter(buf, aghlog.FormatJSON, aghlog.LevelInfo, map[string]aghlog.Level{
+		"querylog":   aghlog.LevelDebug,
+		"dnsforward": aghlog.LevelError,
+	})
+
+	assert.Equal(t, log.DEBUG, log.GetLevel())
+
+	for _, l := range lines {
+		n, err := fmt.Fprintln(w, l)
+		require.NoError(t, err)
+
+		assert.Equal(t, len(l)+1, n)
+	}
+
+	var got []*aghlog.Entry
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		e := &aghlog.Entry{}
+		err := json.Unmarshal([]byte(l), e)
+		require.NoError(t, err)
+
+		assert.False(t, e.Time.IsZero())
+
+		got = append(got, e)
+	}
+
+	require.Len(t, got, 3)
+
+	assert.Equal(t, "querylog", got[0].Module)
+	assert.Equal(t, aghlog.LevelDebug, got[0].Level)
+	assert.Equal(t, "debug message", got[0].Message)
+
+	assert.Equal(t, "querylog", got[1].Module)
+	assert.Equal(t, aghlog.LevelInfo, got[1].Level)
+
+	assert.Equal(t, "dnsforward", got[2].Module)
+	assert.Equal(t, aghlog.LevelError, got[2].Level)
+
+	t.Run("set_levels", func(t *testing.T) {
+		buf.Reset()
+		w.SetLevels(aghlog.LevelError, nil)
+
+		assert.Equal(t, log.ERROR, log.GetLevel())
+
+		def, levels := w.Levels()
+		assert.Equal(t, aghlog.LevelError, def)
+		assert.Empty(t, levels)
+	})
+}
+
+func TestValidateLevels(t *testing.T) {
+	err := aghlog.ValidateLevels(map[string]aghlog.Level{
+		"dnsforward": aghlog.LevelDebug,
+	})
+	assert.NoError(t, err)
+
+	err = aghlog.ValidateLevels(map[string]aghlog.Level{
+		"dnsforward": "trace",
+	})
+	assert.Error(t, err)
+
+	err = aghlog.ValidateLevels(map[string]aghlog.Level{
+		"Bad Module": aghlog.LevelDebug,
+	})
+	assert.Error(t, err)
+}
@@ -118,8 +118,9 @@ type HostsContainer struct {
 	// watcher tracks the changes in specified files and directories.
 	watcher aghos.FSWatcher
 
-	// patterns stores specified paths in the fs.Glob-compatible form.
-	patterns []string
+	// sources stores specified paths in the fs.Glob-compatible form along
+	// with their labels.
+	sources []*hostsPatterns
 
 	// listID is the identifier for the list of generated rules.
 	listID int
@@ -132,6 +133,10 @@ type HostsRecords map[netip.Addr]*HostsRecord
 type HostsRecord struct {
 	Aliases   *stringutil.Set
 	Canonical string
+
+	// Source is the label of the [HostsSource] the record has first been read
+	// from.  It's empty for the system hosts database.
+	Source string
 }
 
 // equal returns true if all fields of rec are equal to field in other or they
@@ -143,7 +148,31 @@ func (rec *HostsRecord) equal(other *HostsRecord) (ok bool) {
 		return false
 	}
 
-	return rec.Canonical == other.Canonical && rec.Aliases.Equal(other.Aliases)
+	return rec.Canonical == other.Canonical &&
+		rec.Source == other.Source &&
+		rec.Aliases.Equal(other.Aliases)
+}
+
+// HostsSource is a set of files and directories with the hosts database tagged
+// with a label, for example the hosts files of a container runtime.
+type HostsSource struct {
+	// Label is the label of the records read from Paths.  It's empty for the
+	// system hosts database.
+	Label string
+
+	// Paths are the paths to the files and directories within the file system
+	// of the container.
+	Paths []string
+}
+
+// hostsPatterns are the paths of a [HostsSource] in the fs.Glob-compatible
+// form.
+type hostsPatterns struct {
+	// label is the label of the source.
+	label string
+
+	// patterns are the fs.Glob-compatible patterns.
+	patterns []string
 }
 
 // ErrNoHostsPaths is returned when there are no valid paths to watch passed to
@@ -159,18 +188,40 @@ func NewHostsContainer(
 	fsys fs.FS,
 	w aghos.FSWatcher,
 	paths ...string,
+) (hc *HostsContainer, err error) {
+	return NewLabeledHostsContainer(listID, fsys, w, &HostsSource{Paths: paths})
+}
+
+// NewLabeledHostsContainer is like [NewHostsContainer] but watches the paths of
+// several sources and sets their labels in the records.  The sources are read
+// in the given order, so the records of the former ones take precedence.
+func NewLabeledHostsContainer(
+	listID int,
+	fsys fs.FS,
+	w aghos.FSWatcher,
+	sources ...*HostsSource,
 ) (hc *HostsContainer, err error) {
 	defer func() { err = errors.Annotate(err, "%s: %w", hostsContainerPrefix) }()
 
-	if len(paths) == 0 {
-		return nil, ErrNoHostsPaths
+	var srcPatterns []*hostsPatterns
+	var paths []string
+	for _, src := range sources {
+		var patterns []string
+		patterns, err = pathsToPatterns(fsys, src.Paths)
+		if err != nil {
+			return nil, fmt.Errorf("source %q: %w", src.Label, err)
+		}
+
+		paths = append(paths, src.Paths...)
+		if len(patterns) > 0 {
+			srcPatterns = append(srcPatterns, &hostsPatterns{
+				label:    src.Label,
+				patterns: patterns,
+			})
+		}
 	}
 
-	var patterns []string
-	patterns, err = pathsToPatterns(fsys, paths)
-	if err != nil {
-		return nil, err
-	} else if len(patterns) == 0 {
+	if len(srcPatterns) == 0 {
 		return nil, ErrNoHostsPaths
 	}
 
@@ -178,12 +229,12 @@ func NewHostsContainer(
 		requestMatcher: requestMatcher{
 			stateLock: &sync.RWMutex{},
 		},
-		listID:   listID,
-		done:     make(chan struct{}, 1),
-		updates:  make(chan HostsRecords, 1),
-		fsys:     fsys,
-		watcher:  w,
-		patterns: patterns,
+		listID:  listID,
+		done:    make(chan struct{}, 1),
+		updates: make(chan HostsRecords, 1),
+		fsys:    fsys,
+		watcher: w,
+		sources: srcPatterns,
 	}
 
 	log.Debug("%s: starting", hostsContainerPrefix)
@@ -293,6 +344,9 @@ type hostsParser struct {
 	// table stores only the unique IP-hostname pairs.  It's also sent to the
 	// updates channel afterwards.
 	table HostsRecords
+
+	// label is the label of the source being parsed.
+	label string
 }
 
 // newHostsParser creates a new *hostsParser with buffers of size taken from the
@@ -373,6 +427,7 @@ func (hp *hostsParser) addRecord(ip netip.Addr, hosts []string) {
 	if !ok {
 		rec = &HostsRecord{
 			Aliases: stringutil.NewSet(),
+			Source:  hp.label,
 		}
 
 		rec.Canonical, hosts = hosts[0], hosts[1:]
@@ -483,8 +538,11 @@ func (hc *HostsContainer) refresh() (err error) {
 	log.Debug("%s: refreshing", hostsContainerPrefix)
 
 	hp := hc.newHostsParser()
-	if _, err = aghos.FileWalker(hp.parseFile).Walk(hc.fsys, hc.patterns...); err != nil {
-		return fmt.Errorf("refreshing : %w", err)
+	for _, src := range hc.sources {
+		hp.label = src.label
+		if _, err = aghos.FileWalker(hp.parseFile).Walk(hc.fsys, src.patterns...); err != nil {
+			return fmt.Errorf("refreshing : %w", err)
+		}
 	}
 
 	// hc.last is nil on the first refresh, so let that one through.
@@ -228,6 +228,63 @@ func TestHostsContainer_refresh(t *testing.T) {
 	})
 }
 
+func TestNewLabeledHostsContainer(t *testing.T) {
+	ip1, ip2 := netip.MustParseAddr("192.168.1.1"), netip.MustParseAddr("172.17.0.2")
+
+	testFS := fstest.MapFS{
+		"etc/hosts": &fstest.MapFile{
+			Data: []byte(ip1.String() + " router" + nl),
+		},
+		"var/lib/containers/web/hosts": &fstest.MapFile{
+			Data: []byte(ip1.String() + " gateway" + nl + ip2.String() + " web" + nl),
+		},
+	}
+
+	var added []string
+	w := &aghtest.FSWatcher{
+		OnEvents: func() (e <-chan struct{}) { return nil },
+		OnAdd: func(name string) (err error) {
+			added = append(added, name)
+
+			return nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+
+	hc, err := NewLabeledHostsContainer(0, testFS, w, &HostsSource{
+		Paths: []string{"etc/hosts"},
+	}, &HostsSource{
+		Label: "containers",
+		Paths: []string{"var/lib/containers/web", "var/lib/containers/db"},
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, hc.Close)
+
+	assert.Equal(t, []string{"etc/hosts", "var/lib/containers/web", "var/lib/containers/db"}, added)
+
+	upd, ok := aghchan.MustReceive(hc.Upd(), 1*time.Second)
+	require.True(t, ok)
+
+	want := HostsRecords{
+		ip1: {
+			Aliases:   stringutil.NewSet("gateway"),
+			Canonical: "router",
+			Source:    "",
+		},
+		ip2: {
+			Aliases:   stringutil.NewSet(),
+			Canonical: "web",
+			Source:    "containers",
+		},
+	}
+
+	require.Len(t, upd, len(want))
+
+	for ip, rec := range want {
+		assert.Truef(t, rec.equal(upd[ip]), "%+v != %+v", rec, upd[ip])
+	}
+}
+
 func TestHostsContainer_PathsToPatterns(t *testing.T) {
 	gsfs := fstest.MapFS{
 		"dir_0/file_1":       &fstest.MapFile{Data: []byte{1}},
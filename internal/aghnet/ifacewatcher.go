@@ -0,0 +1,251 @@
+package aghnet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+)
+
+// DefaultIfaceWatcherPollIvl is the default interval between the checks of the
+// addresses of the watched network interfaces, which is used when the OS
+// doesn't notify about the changes or as a fallback.
+const DefaultIfaceWatcherPollIvl = 1 * time.Minute
+
+// ifaceEventsDelay is the delay between an OS notification about a change and
+// the check of the addresses, since the changes of a single interface usually
+// come in bursts.
+const ifaceEventsDelay = 1 * time.Second
+
+// IfaceWatcherConfig is the configuration structure for an *IfaceWatcher.
+type IfaceWatcherConfig struct {
+	// OnChange is called with the new addresses of the interface with the
+	// given name each time they change.  It is called from a single goroutine
+	// and must not be nil.
+	OnChange func(name string, addrs []netip.Addr)
+
+	// Names are the names of the network interfaces to watch.
+	Names []string
+
+	// PollInterval is the interval between the checks of the addresses.  If
+	// it's zero, [DefaultIfaceWatcherPollIvl] is used.
+	PollInterval time.Duration
+}
+
+// IfaceWatcher watches the IP addresses of network interfaces, for example the
+// ones assigned by DHCP or added with a new VLAN.  On Linux, it uses the
+// netlink notifications and falls back to polling on other OSes.
+type IfaceWatcher struct {
+	// onChange is called when the addresses of an interface change.
+	onChange func(name string, addrs []netip.Addr)
+
+	// ifaceAddrs returns the addresses of the interface with the given name.
+	// It's here for testing purposes.
+	ifaceAddrs func(name string) (addrs []netip.Addr, err error)
+
+	// mu protects addrs.
+	mu *sync.Mutex
+
+	// addrs are the current addresses of the interfaces by their names.
+	addrs map[string][]netip.Addr
+
+	// done is closed after the watcher is shut down.
+	done chan struct{}
+
+	// events is the connection the OS notifications are received from, if
+	// any.
+	events io.Closer
+
+	// names are the names of the watched interfaces.
+	names []string
+
+	// pollIvl is the interval between the checks of the addresses.
+	pollIvl time.Duration
+}
+
+// NewIfaceWatcher returns a new properly initialized *IfaceWatcher with the
+// current addresses of the interfaces.  c must not be nil.
+func NewIfaceWatcher(c *IfaceWatcherConfig) (w *IfaceWatcher) {
+	pollIvl := c.PollInterval
+	if pollIvl == 0 {
+		pollIvl = DefaultIfaceWatcherPollIvl
+	}
+
+	w = &IfaceWatcher{
+		onChange:   c.OnChange,
+		ifaceAddrs: ifaceAddrsByName,
+		mu:         &sync.Mutex{},
+		addrs:      map[string][]netip.Addr{},
+		done:       make(chan struct{}),
+		names:      c.Names,
+		pollIvl:    pollIvl,
+	}
+
+	for _, name := range w.names {
+		w.addrs[name] = w.read(name)
+	}
+
+	return w
+}
+
+// Addrs returns the current addresses of the interface with the given name.
+// addrs must not be modified.
+func (w *IfaceWatcher) Addrs(name string) (addrs []netip.Addr) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.addrs[name]
+}
+
+// Start starts watching the interfaces in a separate goroutine.  It doesn't
+// return an error if the OS notifications are unavailable, since the watcher
+// falls back to polling then.
+func (w *IfaceWatcher) Start() (err error) {
+	conn, events, err := subscribeIfaceEvents()
+	if err != nil {
+		log.Info("iface watcher: os notifications unavailable, polling: %s", err)
+	}
+
+	w.events = conn
+
+	go w.watch(events)
+
+	return nil
+}
+
+// Shutdown stops watching the interfaces.
+func (w *IfaceWatcher) Shutdown(_ context.Context) (err error) {
+	close(w.done)
+
+	if w.events != nil {
+		err = w.events.Close()
+		if err != nil {
+			return fmt.Errorf("closing os notifications: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// watch checks the addresses of the interfaces after each event from events
+// and each poll interval.  events may be nil.
+func (w *IfaceWatcher) watch(events <-chan struct{}) {
+	defer log.OnPanic("iface watcher")
+
+	ticker := time.NewTicker(w.pollIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case _, ok := <-events:
+			if !ok {
+				log.Debug("iface watcher: os notifications closed, polling")
+				events = nil
+
+				continue
+			}
+
+			time.Sleep(ifaceEventsDelay)
+			drain(events)
+		case <-ticker.C:
+			// Go on.
+		}
+
+		w.check()
+	}
+}
+
+// drain receives all pending values from events without blocking.
+func drain(events <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// check rereads the addresses of the interfaces and calls w.onChange for the
+// ones that changed.
+func (w *IfaceWatcher) check() {
+	for _, name := range w.names {
+		addrs := w.read(name)
+
+		w.mu.Lock()
+		prev := w.addrs[name]
+		w.addrs[name] = addrs
+		w.mu.Unlock()
+
+		if slices.Equal(prev, addrs) {
+			continue
+		}
+
+		log.Info("iface watcher: addresses of %q changed from %s to %s", name, prev, addrs)
+
+		w.onChange(name, addrs)
+	}
+}
+
+// read returns the sorted addresses of the interface with the given name.  The
+// errors are logged, since a missing interface may appear later.
+func (w *IfaceWatcher) read(name string) (addrs []netip.Addr) {
+	addrs, err := w.ifaceAddrs(name)
+	if err != nil {
+		log.Debug("iface watcher: reading addresses of %q: %s", name, err)
+
+		return nil
+	}
+
+	slices.SortFunc(addrs, netip.Addr.Less)
+
+	return addrs
+}
+
+// ifaceAddrsByName returns the IP addresses of the interface with the given
+// name, which can be bound to.  The link-local addresses are skipped, since
+// they require a zone.
+func ifaceAddrsByName(name string) (addrs []netip.Addr, err error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("getting addresses: %w", err)
+	}
+
+	for _, a := range ifaceAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			return nil, fmt.Errorf("bad address %s", ipNet.IP)
+		}
+
+		addr = addr.Unmap()
+		if addr.IsLinkLocalUnicast() {
+			continue
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package aghnet
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// subscribeIfaceEvents subscribes to the rtnetlink notifications about the
+// changes of the links and their addresses.  A value is sent to events for each
+// notification, and events is closed when conn is closed.
+func subscribeIfaceEvents() (conn io.Closer, events <-chan struct{}, err error) {
+	c, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("dialing rtnetlink: %w", err)
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer log.OnPanic("iface watcher: rtnetlink")
+		defer close(ch)
+
+		for {
+			_, recvErr := c.Receive()
+			if recvErr != nil {
+				log.Debug("iface watcher: receiving from rtnetlink: %s", recvErr)
+
+				return
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+				// Go on, a check is already pending.
+			}
+		}
+	}()
+
+	return c, ch, nil
+}
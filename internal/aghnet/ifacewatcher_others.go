@@ -0,0 +1,19 @@
+//go:build !linux
+
+package aghnet
+
+import (
+	"io"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// errNoIfaceEvents is returned by subscribeIfaceEvents on the OSes that don't
+// support the notifications about the changes of the interfaces.
+const errNoIfaceEvents errors.Error = "not supported on this os"
+
+// subscribeIfaceEvents returns an error, since the notifications about the
+// changes of the interfaces aren't supported on this OS yet.
+func subscribeIfaceEvents() (conn io.Closer, events <-chan struct{}, err error) {
+	return nil, nil, errNoIfaceEvents
+}
@@ -0,0 +1,46 @@
+package aghnet
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfaceWatcher_check(t *testing.T) {
+	const ifaceName = "aghtest0"
+
+	var changes [][]netip.Addr
+	w := NewIfaceWatcher(&IfaceWatcherConfig{
+		OnChange: func(name string, addrs []netip.Addr) {
+			assert.Equal(t, ifaceName, name)
+
+			changes = append(changes, addrs)
+		},
+		Names: []string{ifaceName},
+	})
+
+	addr4 := netip.MustParseAddr("192.0.2.1")
+	addr6 := netip.MustParseAddr("2001:db8::1")
+
+	var addrs []netip.Addr
+	var err error
+	w.ifaceAddrs = func(_ string) (_ []netip.Addr, _ error) {
+		return addrs, err
+	}
+
+	addrs = []netip.Addr{addr6, addr4}
+	w.check()
+	assert.Equal(t, []netip.Addr{addr4, addr6}, w.Addrs(ifaceName))
+
+	// No changes.
+	addrs = []netip.Addr{addr4, addr6}
+	w.check()
+
+	addrs, err = nil, errors.Error("no such interface")
+	w.check()
+	assert.Empty(t, w.Addrs(ifaceName))
+
+	assert.Equal(t, [][]netip.Addr{{addr4, addr6}, nil}, changes)
+}
@@ -0,0 +1,99 @@
+package aghnet
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// MACVendors is the database of the vendors of network devices by the
+// organizationally unique identifiers (OUI) of their MAC addresses.  A nil
+// *MACVendors is a valid empty database.
+type MACVendors struct {
+	// vendors are the names of the vendors by their OUIs.
+	vendors map[[3]byte]string
+}
+
+// ParseMACVendors parses the OUI database from r.  The supported formats are
+// the IEEE oui.txt one, the Wireshark manuf one, and the Nmap mac-prefixes one.
+// The entries for the prefixes other than 24-bit ones are skipped.
+func ParseMACVendors(r io.Reader) (v *MACVendors, err error) {
+	v = &MACVendors{
+		vendors: map[[3]byte]string{},
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		oui, vendor, ok := parseOUILine(sc.Text())
+		if ok {
+			v.vendors[oui] = vendor
+		}
+	}
+
+	err = sc.Err()
+	if err != nil {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+
+	return v, nil
+}
+
+// ouiReplacer removes the separators from the OUIs.
+var ouiReplacer = strings.NewReplacer("-", "", ":", "", ".", "")
+
+// parseOUILine parses a single line of an OUI database.  ok is false if the
+// line doesn't contain a 24-bit prefix.
+func parseOUILine(line string) (oui [3]byte, vendor string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return oui, "", false
+	}
+
+	prefix, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		prefix, rest = line[:i], line[i+1:]
+	}
+
+	prefix = ouiReplacer.Replace(prefix)
+	if hex.DecodedLen(len(prefix)) != len(oui) {
+		return oui, "", false
+	}
+
+	_, err := hex.Decode(oui[:], []byte(prefix))
+	if err != nil {
+		return oui, "", false
+	}
+
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "(hex)"))
+
+	// The Wireshark format contains both a short and a long name separated by
+	// a tab, so use the long one.
+	if i := strings.LastIndexByte(rest, '\t'); i >= 0 {
+		rest = strings.TrimSpace(rest[i+1:])
+	}
+
+	return oui, rest, rest != ""
+}
+
+// Lookup returns the name of the vendor of the device with the given MAC
+// address or an empty string if it's unknown.
+func (v *MACVendors) Lookup(mac net.HardwareAddr) (vendor string) {
+	if v == nil || len(mac) < 3 {
+		return ""
+	}
+
+	return v.vendors[[3]byte{mac[0], mac[1], mac[2]}]
+}
+
+// Len returns the number of the vendors in the database.
+func (v *MACVendors) Len() (n int) {
+	if v == nil {
+		return 0
+	}
+
+	return len(v.vendors)
+}
@@ -0,0 +1,61 @@
+package aghnet
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMACVendors(t *testing.T) {
+	const db = `# Comment.
+00-00-0C   (hex)		Cisco Systems, Inc
+00000C     (base 16)		Cisco Systems, Inc
+B8:27:EB	Raspberr	Raspberry Pi Foundation
+00:1B:C5:00:00/36	Convergi	Converging Systems Inc.
+DCA632 Raspberry Pi Trading
+ZZZZZZ Bad
+`
+
+	v, err := ParseMACVendors(strings.NewReader(db))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, v.Len())
+
+	testCases := []struct {
+		name string
+		want string
+		mac  net.HardwareAddr
+	}{{
+		name: "ieee",
+		want: "Cisco Systems, Inc",
+		mac:  net.HardwareAddr{0x00, 0x00, 0x0C, 0x01, 0x02, 0x03},
+	}, {
+		name: "wireshark",
+		want: "Raspberry Pi Foundation",
+		mac:  net.HardwareAddr{0xB8, 0x27, 0xEB, 0x01, 0x02, 0x03},
+	}, {
+		name: "nmap",
+		want: "Raspberry Pi Trading",
+		mac:  net.HardwareAddr{0xDC, 0xA6, 0x32, 0x01, 0x02, 0x03},
+	}, {
+		name: "unknown",
+		want: "",
+		mac:  net.HardwareAddr{0x00, 0x1B, 0xC5, 0x00, 0x00, 0x01},
+	}, {
+		name: "short",
+		want: "",
+		mac:  net.HardwareAddr{0x00, 0x00},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, v.Lookup(tc.mac))
+		})
+	}
+
+	var nilVendors *MACVendors
+	assert.Empty(t, nilVendors.Lookup(net.HardwareAddr{0x00, 0x00, 0x0C}))
+}
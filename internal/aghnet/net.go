@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"strings"
 	"syscall"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
@@ -299,3 +300,36 @@ func BroadcastFromPref(p netip.Prefix) (bc netip.Addr) {
 
 	return bc
 }
+
+// ParseSubnet parses s as either a CIDR or a single IP address, in which case
+// p is the subnet containing only that address.  p is always masked.
+func ParseSubnet(s string) (p netip.Prefix, err error) {
+	if strings.Contains(s, "/") {
+		p, err = netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		return p.Masked(), nil
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	ip = ip.Unmap()
+
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// SubnetString returns the string representation of p as accepted by
+// [ParseSubnet].  That is, single-address subnets are formatted as IP
+// addresses.
+func SubnetString(p netip.Prefix) (s string) {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+
+	return p.String()
+}
@@ -187,6 +187,62 @@ func TestBroadcastFromIPNet(t *testing.T) {
 	}
 }
 
+func TestParseSubnet(t *testing.T) {
+	testCases := []struct {
+		want       netip.Prefix
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		want:       netip.MustParsePrefix("1.2.3.4/32"),
+		name:       "ipv4",
+		in:         "1.2.3.4",
+		wantErrMsg: "",
+	}, {
+		want:       netip.MustParsePrefix("1.2.3.4/32"),
+		name:       "ipv4_mapped",
+		in:         "::ffff:1.2.3.4",
+		wantErrMsg: "",
+	}, {
+		want:       netip.MustParsePrefix("1234::cdef/128"),
+		name:       "ipv6",
+		in:         "1234::cdef",
+		wantErrMsg: "",
+	}, {
+		want:       netip.MustParsePrefix("1.2.0.0/16"),
+		name:       "cidr_masked",
+		in:         "1.2.3.4/16",
+		wantErrMsg: "",
+	}, {
+		want:       netip.Prefix{},
+		name:       "bad_ip",
+		in:         "1.2.3.256",
+		wantErrMsg: `ParseAddr("1.2.3.256"): IPv4 field has value >255`,
+	}, {
+		want:       netip.Prefix{},
+		name:       "bad_cidr",
+		in:         "1.2.3.4/33",
+		wantErrMsg: `netip.ParsePrefix("1.2.3.4/33"): prefix length out of range`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParseSubnet(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, p)
+			if err != nil {
+				return
+			}
+
+			p, err = ParseSubnet(SubnetString(p))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, p)
+		})
+	}
+}
+
 func TestCheckPort(t *testing.T) {
 	laddr := netip.AddrPortFrom(netutil.IPv4Localhost(), 0)
 
@@ -0,0 +1,120 @@
+package aghnet
+
+import (
+	"net/netip"
+)
+
+// Prefix Tree
+
+// PrefixTree is a binary radix tree of IP networks, which looks up the longest
+// network containing an address in time proportional to the length of the
+// address.  IPv4 and IPv6 networks are stored separately, so, like with
+// [netip.Prefix.Contains], an IPv4-mapped IPv6 address is not contained in any
+// IPv4 network.  A nil *PrefixTree is an empty tree.  It is not safe for
+// concurrent use.
+type PrefixTree[T any] struct {
+	v4  *prefixNode[T]
+	v6  *prefixNode[T]
+	num int
+}
+
+// prefixNode is a node of a [PrefixTree].
+type prefixNode[T any] struct {
+	// children are the nodes for the next bit being 0 and 1 correspondingly.
+	children [2]*prefixNode[T]
+
+	// val is the value of the network ending at this node.  It's only
+	// meaningful if hasVal is true.
+	val T
+
+	// pref is the network ending at this node.  It's only meaningful if
+	// hasVal is true.
+	pref netip.Prefix
+
+	// hasVal is true if there is a network ending at this node.
+	hasVal bool
+}
+
+// NewPrefixTree returns a new empty *PrefixTree.
+func NewPrefixTree[T any]() (t *PrefixTree[T]) {
+	return &PrefixTree[T]{
+		v4: &prefixNode[T]{},
+		v6: &prefixNode[T]{},
+	}
+}
+
+// Insert adds the network p with the value v to t, replacing the value of the
+// same network, if any.  p must be valid, its host bits are ignored.
+func (t *PrefixTree[T]) Insert(p netip.Prefix, v T) {
+	p = p.Masked()
+
+	n := t.root(p.Addr())
+	for i := 0; i < p.Bits(); i++ {
+		b := addrBit(p.Addr(), i)
+		if n.children[b] == nil {
+			n.children[b] = &prefixNode[T]{}
+		}
+
+		n = n.children[b]
+	}
+
+	if !n.hasVal {
+		t.num++
+	}
+
+	n.val, n.pref, n.hasVal = v, p, true
+}
+
+// Lookup returns the longest network in t containing ip along with its value.
+// ok is false if there is no such network.
+func (t *PrefixTree[T]) Lookup(ip netip.Addr) (p netip.Prefix, v T, ok bool) {
+	if t == nil || !ip.IsValid() {
+		return netip.Prefix{}, v, false
+	}
+
+	n := t.root(ip)
+	for i := 0; n != nil; i++ {
+		if n.hasVal {
+			p, v, ok = n.pref, n.val, true
+		}
+
+		if i == ip.BitLen() {
+			break
+		}
+
+		n = n.children[addrBit(ip, i)]
+	}
+
+	return p, v, ok
+}
+
+// Len returns the number of networks in t.
+func (t *PrefixTree[T]) Len() (n int) {
+	if t == nil {
+		return 0
+	}
+
+	return t.num
+}
+
+// root returns the root node for the family of ip.
+func (t *PrefixTree[T]) root(ip netip.Addr) (n *prefixNode[T]) {
+	if ip.Is4() {
+		return t.v4
+	}
+
+	return t.v6
+}
+
+// addrBit returns the i-th bit of ip counting from the most significant one.
+func addrBit(ip netip.Addr, i int) (b byte) {
+	if ip.Is4() {
+		a := ip.As4()
+
+		return a[i/8] >> (7 - i%8) & 1
+	}
+
+	a := ip.As16()
+
+	return a[i/8] >> (7 - i%8) & 1
+}
@@ -0,0 +1,118 @@
+package aghnet
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixTree_Lookup(t *testing.T) {
+	tree := NewPrefixTree[string]()
+	tree.Insert(netip.MustParsePrefix("0.0.0.0/0"), "any4")
+	tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), "ten")
+	tree.Insert(netip.MustParsePrefix("10.1.2.3/16"), "ten-one")
+	tree.Insert(netip.MustParsePrefix("10.1.2.3/32"), "host")
+	tree.Insert(netip.MustParsePrefix("2001:db8::/32"), "doc")
+
+	// Replace the value of the existing network.
+	tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), "ten-new")
+
+	require.Equal(t, 5, tree.Len())
+
+	testCases := []struct {
+		ip       netip.Addr
+		wantPref netip.Prefix
+		name     string
+		wantVal  string
+		wantOK   bool
+	}{{
+		ip:       netip.MustParseAddr("10.1.2.3"),
+		wantPref: netip.MustParsePrefix("10.1.2.3/32"),
+		name:     "host",
+		wantVal:  "host",
+		wantOK:   true,
+	}, {
+		ip:       netip.MustParseAddr("10.1.2.4"),
+		wantPref: netip.MustParsePrefix("10.1.0.0/16"),
+		name:     "longest",
+		wantVal:  "ten-one",
+		wantOK:   true,
+	}, {
+		ip:       netip.MustParseAddr("10.2.0.1"),
+		wantPref: netip.MustParsePrefix("10.0.0.0/8"),
+		name:     "replaced",
+		wantVal:  "ten-new",
+		wantOK:   true,
+	}, {
+		ip:       netip.MustParseAddr("192.168.0.1"),
+		wantPref: netip.MustParsePrefix("0.0.0.0/0"),
+		name:     "default",
+		wantVal:  "any4",
+		wantOK:   true,
+	}, {
+		ip:       netip.MustParseAddr("2001:db8::1"),
+		wantPref: netip.MustParsePrefix("2001:db8::/32"),
+		name:     "ipv6",
+		wantVal:  "doc",
+		wantOK:   true,
+	}, {
+		ip:       netip.MustParseAddr("2001:db9::1"),
+		wantPref: netip.Prefix{},
+		name:     "ipv6_not_found",
+		wantVal:  "",
+		wantOK:   false,
+	}, {
+		ip:       netip.MustParseAddr("::ffff:10.1.2.3"),
+		wantPref: netip.Prefix{},
+		name:     "ipv4_mapped",
+		wantVal:  "",
+		wantOK:   false,
+	}, {
+		ip:       netip.Addr{},
+		wantPref: netip.Prefix{},
+		name:     "invalid",
+		wantVal:  "",
+		wantOK:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, v, ok := tree.Lookup(tc.ip)
+			require.Equal(t, tc.wantOK, ok)
+
+			assert.Equal(t, tc.wantPref, p)
+			assert.Equal(t, tc.wantVal, v)
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var nilTree *PrefixTree[string]
+
+		_, _, ok := nilTree.Lookup(netip.MustParseAddr("10.1.2.3"))
+		assert.False(t, ok)
+		assert.Zero(t, nilTree.Len())
+	})
+}
+
+var prefixTreeSink bool
+
+func BenchmarkPrefixTree_Lookup(b *testing.B) {
+	tree := NewPrefixTree[int]()
+	for i := 0; i < 10_000; i++ {
+		p := netip.MustParsePrefix(fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+		tree.Insert(p, i)
+	}
+
+	ip := netip.MustParseAddr("10.39.15.1")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, prefixTreeSink = tree.Lookup(ip)
+	}
+
+	assert.True(b, prefixTreeSink)
+}
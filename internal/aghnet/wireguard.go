@@ -0,0 +1,98 @@
+package aghnet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// WireGuard Peers
+
+// wgKeyLen is the length of a WireGuard key in bytes.
+const wgKeyLen = 32
+
+// WireGuardPeer is a peer of a WireGuard interface.
+type WireGuardPeer struct {
+	// PublicKey is the base64-encoded public key of the peer.
+	PublicKey string
+
+	// AllowedIPs are the subnets the peer is allowed to send the traffic
+	// from.
+	AllowedIPs []netip.Prefix
+}
+
+// ValidateWireGuardKey returns an error if key isn't a base64-encoded
+// WireGuard key.
+func ValidateWireGuardKey(key string) (err error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("bad wireguard key %q: %w", key, err)
+	} else if len(b) != wgKeyLen {
+		return fmt.Errorf("bad wireguard key %q: bad length %d", key, len(b))
+	}
+
+	return nil
+}
+
+// WireGuardPeers returns the peers of the WireGuard interface with the given
+// name using the wg utility, which usually requires the root privileges.
+func WireGuardPeers(iface string) (peers []WireGuardPeer, err error) {
+	defer func() { err = errors.Annotate(err, "wireguard interface %q: %w", iface) }()
+
+	code, out, err := aghosRunCommand("wg", "show", iface, "allowed-ips")
+	if err != nil {
+		return nil, fmt.Errorf("running command: %w", err)
+	} else if code != 0 {
+		return nil, fmt.Errorf("running command: unexpected exit code %d", code)
+	}
+
+	return ParseWireGuardPeers(bytes.NewReader(out))
+}
+
+// ParseWireGuardPeers parses the output of the wg show <interface> allowed-ips
+// command, which contains a public key and the space-separated allowed IPs of
+// a peer on each line, separated by a tab.
+func ParseWireGuardPeers(r io.Reader) (peers []WireGuardPeer, err error) {
+	sc := bufio.NewScanner(r)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		key := fields[0]
+		err = ValidateWireGuardKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		p := WireGuardPeer{
+			PublicKey: key,
+		}
+
+		for _, f := range fields[1:] {
+			if f == "(none)" {
+				continue
+			}
+
+			var subnet netip.Prefix
+			subnet, err = netip.ParsePrefix(f)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+			p.AllowedIPs = append(p.AllowedIPs, subnet.Masked())
+		}
+
+		peers = append(peers, p)
+	}
+
+	return peers, sc.Err()
+}
@@ -0,0 +1,77 @@
+package aghnet
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWGKey is a valid WireGuard public key for tests.
+const testWGKey = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+
+func TestParseWireGuardPeers(t *testing.T) {
+	const otherKey = "HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw="
+
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+		want       []WireGuardPeer
+	}{{
+		name:       "empty",
+		in:         "",
+		wantErrMsg: "",
+		want:       nil,
+	}, {
+		name: "peers",
+		in: testWGKey + "\t10.0.0.2/32 fd00::2/128\n" +
+			otherKey + "\t(none)\n",
+		wantErrMsg: "",
+		want: []WireGuardPeer{{
+			PublicKey: testWGKey,
+			AllowedIPs: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.2/32"),
+				netip.MustParsePrefix("fd00::2/128"),
+			},
+		}, {
+			PublicKey:  otherKey,
+			AllowedIPs: nil,
+		}},
+	}, {
+		name:       "bad_key",
+		in:         "key\t10.0.0.2/32\n",
+		wantErrMsg: `line 1: bad wireguard key "key": illegal base64 data at input byte 0`,
+		want:       nil,
+	}, {
+		name:       "bad_prefix",
+		in:         testWGKey + "\t10.0.0.2\n",
+		wantErrMsg: `line 1: netip.ParsePrefix("10.0.0.2"): no '/'`,
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			peers, err := ParseWireGuardPeers(strings.NewReader(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, peers)
+		})
+	}
+}
+
+func TestWireGuardPeers(t *testing.T) {
+	substShell(t, theOnlyCmd("wg show wg0 allowed-ips", 0, testWGKey+"\t10.0.0.2/32\n", nil).RunCmd)
+
+	peers, err := WireGuardPeers("wg0")
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+
+	assert.Equal(t, testWGKey, peers[0].PublicKey)
+
+	_, err = WireGuardPeers("wg1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+// Package aghoidc contains a minimal OpenID Connect relying party that uses the
+// authorization code flow with PKCE.
+package aghoidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Config is the configuration of a [Provider].
+type Config struct {
+	// Client is used to send requests to the provider.  It must not be nil.
+	Client *http.Client
+
+	// Issuer is the issuer URL of the provider, for example
+	// "https://keycloak.example.com/realms/home".  The configuration is
+	// discovered from the ".well-known/openid-configuration" document under
+	// it.
+	Issuer string
+
+	// ClientID is the client identifier registered with the provider.
+	ClientID string
+
+	// ClientSecret is the secret of a confidential client.  It is empty for
+	// public clients.
+	ClientSecret string
+
+	// RedirectURL is the URL the provider redirects the user agent to after
+	// the authentication.
+	RedirectURL string
+
+	// Scopes are the requested scopes.  The "openid" scope is always added.
+	Scopes []string
+}
+
+// metadata is the part of the OpenID provider metadata used by [Provider].
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider.
+type Provider struct {
+	conf *Config
+	meta *metadata
+
+	// keysMu protects keys.
+	keysMu *sync.Mutex
+
+	// keys are the signing keys of the provider by their IDs.
+	keys map[string]any
+}
+
+// maxRespSize is the maximum size of a response from the provider.
+const maxRespSize = 1 << 20
+
+// Discover fetches the metadata of the provider and returns a new *Provider.
+func Discover(ctx context.Context, conf *Config) (p *Provider, err error) {
+	defer func() { err = errors.Annotate(err, "discovering %q: %w", conf.Issuer) }()
+
+	u := strings.TrimSuffix(conf.Issuer, "/") + "/.well-known/openid-configuration"
+	meta := &metadata{}
+	err = getJSON(ctx, conf.Client, u, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// See OpenID Connect Discovery 1.0, section 4.3.
+	if meta.Issuer != conf.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: got %q", meta.Issuer)
+	} else if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+		return nil, errors.Error("no authorization or token endpoint")
+	} else if meta.JWKSURI == "" {
+		return nil, errors.Error("no jwks_uri")
+	}
+
+	return &Provider{
+		conf:   conf,
+		meta:   meta,
+		keysMu: &sync.Mutex{},
+		keys:   map[string]any{},
+	}, nil
+}
+
+// NewRandom returns a new random URL-safe string suitable for the state, the
+// nonce, and the PKCE code verifier.
+func NewRandom() (s string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating random string: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL of the authorization endpoint to redirect the
+// user agent to.  verifier is the PKCE code verifier, which must be passed to
+// [Provider.Exchange] later.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (u string) {
+	sum := sha256.Sum256([]byte(verifier))
+
+	q := url.Values{
+		"client_id":             []string{p.conf.ClientID},
+		"code_challenge":        []string{base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": []string{"S256"},
+		"nonce":                 []string{nonce},
+		"redirect_uri":          []string{p.conf.RedirectURL},
+		"response_type":         []string{"code"},
+		"scope":                 []string{p.scope()},
+		"state":                 []string{state},
+	}
+
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.meta.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// scope returns the value of the scope parameter.
+func (p *Provider) scope() (s string) {
+	scopes := []string{"openid"}
+	for _, sc := range p.conf.Scopes {
+		if sc != "openid" {
+			scopes = append(scopes, sc)
+		}
+	}
+
+	return strings.Join(scopes, " ")
+}
+
+// tokenResponse is the part of the token endpoint response used by
+// [Provider].
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+	Desc    string `json:"error_description"`
+}
+
+// Exchange exchanges the authorization code for the tokens and returns the
+// verified claims of the ID token.  nonce must be the one passed to
+// [Provider.AuthCodeURL].
+func (p *Provider) Exchange(
+	ctx context.Context,
+	code string,
+	verifier string,
+	nonce string,
+) (c Claims, err error) {
+	form := url.Values{
+		"client_id":     []string{p.conf.ClientID},
+		"code":          []string{code},
+		"code_verifier": []string{verifier},
+		"grant_type":    []string{"authorization_code"},
+		"redirect_uri":  []string{p.conf.RedirectURL},
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		p.meta.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	}
+
+	resp := &tokenResponse{}
+	err = doJSON(p.conf.Client, req, resp)
+	if err != nil && resp.Error == "" {
+		return nil, fmt.Errorf("requesting token: %w", err)
+	} else if resp.Error != "" {
+		return nil, fmt.Errorf("requesting token: %s: %s", resp.Error, resp.Desc)
+	} else if resp.IDToken == "" {
+		return nil, errors.Error("requesting token: no id_token in response")
+	}
+
+	return p.verify(ctx, resp.IDToken, nonce, time.Now())
+}
+
+// getJSON sends a GET request to u and decodes the JSON response into v.
+func getJSON(ctx context.Context, cli *http.Client, u string, v any) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	return doJSON(cli, req, v)
+}
+
+// doJSON sends req and decodes the JSON response into v.  The body of an
+// unsuccessful response is still decoded, if possible.
+func doJSON(cli *http.Client, req *http.Request, v any) (err error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	decErr := json.NewDecoder(io.LimitReader(resp.Body, maxRespSize)).Decode(v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	} else if decErr != nil {
+		return fmt.Errorf("decoding response: %w", decErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package aghoidc_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghoidc"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common test values.
+const (
+	testClientID = "agh"
+	testCode     = "code"
+	testKID      = "key-1"
+	testNonce    = "nonce"
+	testRedirect = "https://agh.example/control/oidc/callback"
+)
+
+// testProvider is a fake OpenID provider.
+type testProvider struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	// claims are the claims of the issued ID token.
+	claims map[string]any
+
+	// verifier is the code verifier received by the token endpoint.
+	verifier string
+}
+
+// newTestProvider starts a new fake OpenID provider.
+func newTestProvider(t *testing.T) (p *testProvider) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p = &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, map[string]any{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/auth",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, map[string]any{
+			"keys": []any{map[string]any{
+				"kty": "RSA",
+				"kid": testKID,
+				"use": "sig",
+				"n":   b64(key.N.Bytes()),
+				"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != testCode {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(t, w, map[string]any{"error": "invalid_grant"})
+
+			return
+		}
+
+		p.verifier = r.PostFormValue("code_verifier")
+		writeJSON(t, w, map[string]any{"id_token": p.sign(t, p.claims)})
+	})
+
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+
+	return p
+}
+
+// sign returns an RS256-signed JWT with claims.
+func (p *testProvider) sign(t *testing.T, claims map[string]any) (tok string) {
+	t.Helper()
+
+	hdr, err := json.Marshal(map[string]any{"alg": "RS256", "kid": testKID})
+	require.NoError(t, err)
+
+	body, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	data := b64(hdr) + "." + b64(body)
+	sum := sha256.Sum256([]byte(data))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	require.NoError(t, err)
+
+	return data + "." + b64(sig)
+}
+
+// b64 encodes b with the unpadded base64url encoding.
+func b64(b []byte) (s string) {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJSON writes v to w as JSON.
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	require.NoError(t, err)
+}
+
+func TestProvider(t *testing.T) {
+	tp := newTestProvider(t)
+	ctx := context.Background()
+
+	p, err := aghoidc.Discover(ctx, &aghoidc.Config{
+		Client:      tp.srv.Client(),
+		Issuer:      tp.srv.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirect,
+		Scopes:      []string{"groups"},
+	})
+	require.NoError(t, err)
+
+	verifier, err := aghoidc.NewRandom()
+	require.NoError(t, err)
+
+	u, err := url.Parse(p.AuthCodeURL("state", testNonce, verifier))
+	require.NoError(t, err)
+
+	q := u.Query()
+	assert.Equal(t, "/auth", u.Path)
+	assert.Equal(t, "openid groups", q.Get("scope"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, testRedirect, q.Get("redirect_uri"))
+
+	sum := sha256.Sum256([]byte(verifier))
+	assert.Equal(t, b64(sum[:]), q.Get("code_challenge"))
+
+	validClaims := func() (c map[string]any) {
+		return map[string]any{
+			"iss":    tp.srv.URL,
+			"aud":    []string{testClientID, "other"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"nonce":  testNonce,
+			"sub":    "1234",
+			"groups": []string{"admins", "users"},
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		tp.claims = validClaims()
+
+		c, exErr := p.Exchange(ctx, testCode, verifier, testNonce)
+		require.NoError(t, exErr)
+
+		assert.Equal(t, verifier, tp.verifier)
+		assert.Equal(t, "1234", c.String("sub"))
+		assert.Equal(t, []string{"admins", "users"}, c.Strings("groups"))
+	})
+
+	testCases := []struct {
+		modify     func(c map[string]any)
+		name       string
+		code       string
+		wantErrMsg string
+	}{{
+		modify:     func(_ map[string]any) {},
+		name:       "bad_code",
+		code:       "bad",
+		wantErrMsg: "requesting token: invalid_grant: ",
+	}, {
+		modify:     func(c map[string]any) { c["nonce"] = "other" },
+		name:       "bad_nonce",
+		code:       testCode,
+		wantErrMsg: "verifying id token: nonce mismatch",
+	}, {
+		modify:     func(c map[string]any) { c["aud"] = "other" },
+		name:       "bad_audience",
+		code:       testCode,
+		wantErrMsg: `verifying id token: audience ["other"] does not contain client id`,
+	}, {
+		modify:     func(c map[string]any) { c["iss"] = "https://evil.example" },
+		name:       "bad_issuer",
+		code:       testCode,
+		wantErrMsg: `verifying id token: bad issuer "https://evil.example"`,
+	}, {
+		modify:     func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		name:       "expired",
+		code:       testCode,
+		wantErrMsg: "verifying id token: token expired",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tp.claims = validClaims()
+			tc.modify(tp.claims)
+
+			_, exErr := p.Exchange(ctx, tc.code, verifier, testNonce)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, exErr)
+		})
+	}
+}
+
+func TestDiscover_issuerMismatch(t *testing.T) {
+	tp := newTestProvider(t)
+
+	_, err := aghoidc.Discover(context.Background(), &aghoidc.Config{
+		Client: tp.srv.Client(),
+		Issuer: tp.srv.URL + "/",
+	})
+	assert.ErrorContains(t, err, "issuer mismatch")
+}
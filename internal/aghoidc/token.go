@@ -0,0 +1,325 @@
+package aghoidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// Register the hash functions used by the supported algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]any
+
+// String returns the string claim with name or an empty string if there is no
+// such string claim.
+func (c Claims) String(name string) (s string) {
+	s, _ = c[name].(string)
+
+	return s
+}
+
+// Strings returns the claim with name as a list of strings.  A single string
+// is returned as a list of one element.  Non-string elements are skipped.
+func (c Claims) Strings(name string) (ss []string) {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+
+		return ss
+	default:
+		return nil
+	}
+}
+
+// clockSkew is the allowed difference between the clocks of the provider and
+// this server.
+const clockSkew = 1 * time.Minute
+
+// jwtHeader is the header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+}
+
+// algorithm is a supported JWS signature algorithm.
+type algorithm struct {
+	hash crypto.Hash
+	// ecSize is the size of the ECDSA key in bytes or zero for RSA.
+	ecSize int
+}
+
+// algorithms are the supported JWS signature algorithms.  The "none"
+// algorithm and the symmetric ones are deliberately not supported.
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, ecSize: 32},
+	"ES384": {hash: crypto.SHA384, ecSize: 48},
+}
+
+// verify verifies the signature and the claims of the ID token raw and returns
+// its claims.
+func (p *Provider) verify(ctx context.Context, raw, nonce string, now time.Time) (c Claims, err error) {
+	defer func() { err = errors.Annotate(err, "verifying id token: %w") }()
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.Error("not a jws compact serialization")
+	}
+
+	hdr := &jwtHeader{}
+	err = decodeSegment(parts[0], hdr)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	alg, ok := algorithms[hdr.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", hdr.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	key, err := p.key(ctx, hdr.KID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = alg.verify(key, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	c = Claims{}
+	err = decodeSegment(parts[1], &c)
+	if err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+
+	return c, p.validateClaims(c, nonce, now)
+}
+
+// validateClaims returns an error if the claims of an ID token are invalid.
+// See OpenID Connect Core 1.0, section 3.1.3.7.
+func (p *Provider) validateClaims(c Claims, nonce string, now time.Time) (err error) {
+	if iss := c.String("iss"); iss != p.meta.Issuer {
+		return fmt.Errorf("bad issuer %q", iss)
+	}
+
+	aud := c.Strings("aud")
+	found := false
+	for _, a := range aud {
+		if a == p.conf.ClientID {
+			found = true
+
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("audience %q does not contain client id", aud)
+	}
+
+	exp, ok := c["exp"].(float64)
+	if !ok {
+		return errors.Error("no exp")
+	} else if time.Unix(int64(exp), 0).Add(clockSkew).Before(now) {
+		return errors.Error("token expired")
+	}
+
+	if got := c.String("nonce"); got != nonce {
+		return errors.Error("nonce mismatch")
+	}
+
+	return nil
+}
+
+// verify verifies the signature sig of data with key.
+func (alg algorithm) verify(key any, data, sig []byte) (err error) {
+	h := alg.hash.New()
+	_, _ = h.Write(data)
+	sum := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg.ecSize != 0 {
+			return errors.Error("key type does not match algorithm")
+		}
+
+		err = rsa.VerifyPKCS1v15(k, alg.hash, sum, sig)
+		if err != nil {
+			return fmt.Errorf("bad signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if alg.ecSize == 0 || len(sig) != 2*alg.ecSize {
+			return errors.Error("key type or signature size does not match algorithm")
+		}
+
+		r := new(big.Int).SetBytes(sig[:alg.ecSize])
+		s := new(big.Int).SetBytes(sig[alg.ecSize:])
+		if !ecdsa.Verify(k, sum, r, s) {
+			return errors.Error("bad signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT into v.
+func decodeSegment(seg string, v any) (err error) {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// key returns the signing key of the provider with the key ID.  The key set is
+// fetched again if there is no such key, since the provider may have rotated
+// the keys.
+func (p *Provider) key(ctx context.Context, kid string) (key any, err error) {
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	key, ok := p.keys[kid]
+	if ok {
+		return key, nil
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	p.keys = keys
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key with id %q", kid)
+	}
+
+	return key, nil
+}
+
+// jwk is a JSON Web Key.  Only the public RSA and EC signing keys are
+// supported.
+type jwk struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	CRV string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// fetchKeys fetches and parses the key set of the provider.  Unsupported keys
+// are skipped.
+func (p *Provider) fetchKeys(ctx context.Context) (keys map[string]any, err error) {
+	set := &jwks{}
+	err = getJSON(ctx, p.conf.Client, p.meta.JWKSURI, set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys = make(map[string]any, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, keyErr := k.publicKey()
+		if keyErr != nil {
+			log.Debug("oidc: skipping key at index %d: %s", i, keyErr)
+
+			continue
+		}
+
+		keys[k.KID] = pub
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the public key described by k.
+func (k *jwk) publicKey() (pub any, err error) {
+	switch k.KTY {
+	case "RSA":
+		n, e, decErr := decodeInts(k.N, k.E)
+		if decErr != nil {
+			return nil, decErr
+		} else if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.Error("bad exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.CRV {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.CRV)
+		}
+
+		x, y, decErr := decodeInts(k.X, k.Y)
+		if decErr != nil {
+			return nil, decErr
+		} else if !curve.IsOnCurve(x, y) {
+			return nil, errors.Error("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KTY)
+	}
+}
+
+// decodeInts decodes two base64url-encoded big-endian integers.
+func decodeInts(a, b string) (x, y *big.Int, err error) {
+	ab, err := base64.RawURLEncoding.DecodeString(a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bb, err := base64.RawURLEncoding.DecodeString(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return new(big.Int).SetBytes(ab), new(big.Int).SetBytes(bb), nil
+}
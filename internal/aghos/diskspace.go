@@ -0,0 +1,15 @@
+package aghos
+
+// DiskSpace is the space of a file system.
+type DiskSpace struct {
+	// Free is the number of bytes available to the unprivileged users.
+	Free uint64
+
+	// Total is the size of the file system in bytes.
+	Total uint64
+}
+
+// FreeSpace returns the space of the file system containing path.
+func FreeSpace(path string) (ds *DiskSpace, err error) {
+	return freeSpace(path)
+}
@@ -0,0 +1,25 @@
+//go:build openbsd
+
+package aghos
+
+import "golang.org/x/sys/unix"
+
+func freeSpace(path string) (ds *DiskSpace, err error) {
+	st := &unix.Statfs_t{}
+	err = unix.Statfs(path, st)
+	if err != nil {
+		return nil, err
+	}
+
+	// The number of the available blocks is negative when the reserved
+	// blocks are used.
+	bsize, avail := uint64(st.F_bsize), st.F_bavail
+	if avail < 0 {
+		avail = 0
+	}
+
+	return &DiskSpace{
+		Free:  uint64(avail) * bsize,
+		Total: st.F_blocks * bsize,
+	}, nil
+}
@@ -0,0 +1,26 @@
+//go:build darwin || freebsd || linux
+
+package aghos
+
+import "golang.org/x/sys/unix"
+
+func freeSpace(path string) (ds *DiskSpace, err error) {
+	st := &unix.Statfs_t{}
+	err = unix.Statfs(path, st)
+	if err != nil {
+		return nil, err
+	}
+
+	// The types of the fields differ between the operating systems.  The
+	// number of the available blocks is negative on BSDs when the reserved
+	// blocks are used.
+	bsize, avail := uint64(st.Bsize), int64(st.Bavail)
+	if avail < 0 {
+		avail = 0
+	}
+
+	return &DiskSpace{
+		Free:  uint64(avail) * bsize,
+		Total: uint64(st.Blocks) * bsize,
+	}, nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package aghos
+
+import "golang.org/x/sys/windows"
+
+func freeSpace(path string) (ds *DiskSpace, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ds = &DiskSpace{}
+	err = windows.GetDiskFreeSpaceEx(p, &ds.Free, &ds.Total, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
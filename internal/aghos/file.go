@@ -0,0 +1,110 @@
+package aghos
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// CheckDir returns an error if dir isn't an absolute path of an existing
+// directory.
+func CheckDir(dir string) (err error) {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("path %q is not absolute", dir)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("path %q is not a directory", dir)
+	}
+
+	return nil
+}
+
+// MoveFile moves the file from src to dst.  If the file can't be renamed, for
+// example because dst is on another file system, the file is copied into a
+// temporary file next to dst, which is synced and then renamed to dst, and only
+// after that src is removed.  So an error never leaves a partially written dst.
+// If src doesn't exist, err is [os.ErrNotExist].  If dst already exists, err is
+// [os.ErrExist] and nothing is moved.
+func MoveFile(src, dst string) (err error) {
+	_, err = os.Lstat(dst)
+	if err == nil {
+		return fmt.Errorf("target %q: %w", dst, os.ErrExist)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking target: %w", err)
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = copyFileSynced(src, dst)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(src)
+	if err != nil {
+		return fmt.Errorf("removing source: %w", err)
+	}
+
+	return nil
+}
+
+// copyFileSynced copies src into the temporary file, syncs it, and renames it
+// to dst.  The temporary file is removed on error.
+func copyFileSynced(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening source: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, in.Close()) }()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("getting source info: %w", err)
+	}
+
+	tmpName := dst + ".tmp"
+	out, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return fmt.Errorf("copying: %w", err)
+	}
+
+	err = out.Sync()
+	if err != nil {
+		return fmt.Errorf("syncing: %w", err)
+	}
+
+	err = out.Close()
+	if err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+
+	err = os.Rename(tmpName, dst)
+	if err != nil {
+		return fmt.Errorf("renaming temporary file: %w", err)
+	}
+
+	return nil
+}
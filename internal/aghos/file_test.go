@@ -0,0 +1,82 @@
+package aghos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+
+	err := os.WriteFile(file, nil, 0o600)
+	require.NoError(t, err)
+
+	assert.NoError(t, CheckDir(dir))
+	assert.Error(t, CheckDir("relative"))
+	assert.Error(t, CheckDir(file))
+	assert.ErrorIs(t, CheckDir(filepath.Join(dir, "nonexistent")), os.ErrNotExist)
+}
+
+func TestMoveFile(t *testing.T) {
+	const data = "data"
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	err := os.WriteFile(src, []byte(data), 0o600)
+	require.NoError(t, err)
+
+	err = MoveFile(src, dst)
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, string(got))
+	assert.NoFileExists(t, src)
+
+	err = MoveFile(src, filepath.Join(dir, "other"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = os.WriteFile(src, []byte("new data"), 0o600)
+	require.NoError(t, err)
+
+	err = MoveFile(src, dst)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	got, err = os.ReadFile(dst)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, string(got))
+	assert.FileExists(t, src)
+}
+
+func TestCopyFileSynced(t *testing.T) {
+	const data = "data"
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	err := os.WriteFile(src, []byte(data), 0o600)
+	require.NoError(t, err)
+
+	err = copyFileSynced(src, dst)
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, string(got))
+	assert.FileExists(t, src)
+	assert.NoFileExists(t, dst+".tmp")
+
+	err = copyFileSynced(src, filepath.Join(dir, "nonexistent", "dst"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+// Package aghsecret contains the encryption of the sensitive values, such as
+// private keys and tokens, stored in the configuration files.
+package aghsecret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Prefix is the prefix of the encrypted values.  The version allows changing
+// the format later.
+const Prefix = "enc:v1:"
+
+// Encryption parameters.
+const (
+	saltLen = 16
+	keyLen  = 32
+
+	// scryptN, scryptR, and scryptP are the scrypt parameters recommended for
+	// the interactive logins, since the key is derived on every start.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrNoMaterial is returned by [New] when the key material is empty.
+const ErrNoMaterial errors.Error = "empty key material"
+
+// IsEncrypted returns true if s is an encrypted value.
+func IsEncrypted(s string) (ok bool) {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Box encrypts and decrypts values using the key derived from a passphrase or
+// the contents of a key file.  Each value contains the salt used to derive its
+// key, so the values encrypted by different boxes with the same material can
+// be decrypted.
+type Box struct {
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	// keys are the derived keys by their salts.
+	keys map[string][]byte
+
+	// sealed are the known encrypted values by their plaintexts, which
+	// prevents the unchanged values from being encrypted again and thus
+	// changing every time they are saved.
+	sealed map[string]string
+
+	// material is the passphrase or the key file contents.
+	material []byte
+
+	// salt is the salt used for new values.
+	salt []byte
+}
+
+// New returns a new *Box with the key material.
+func New(material []byte) (b *Box, err error) {
+	if len(material) == 0 {
+		return nil, ErrNoMaterial
+	}
+
+	return &Box{
+		mu:       &sync.Mutex{},
+		keys:     map[string][]byte{},
+		sealed:   map[string]string{},
+		material: material,
+	}, nil
+}
+
+// Seal encrypts plaintext.  The result has the [Prefix].
+func (b *Box) Seal(plaintext string) (s string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sealed, ok := b.sealed[plaintext]; ok {
+		return sealed, nil
+	}
+
+	if b.salt == nil {
+		salt := make([]byte, saltLen)
+		_, err = rand.Read(salt)
+		if err != nil {
+			return "", fmt.Errorf("generating salt: %w", err)
+		}
+
+		b.salt = salt
+	}
+
+	aead, err := b.aead(b.salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	data := make([]byte, 0, saltLen+len(nonce)+len(plaintext)+aead.Overhead())
+	data = append(data, b.salt...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, []byte(plaintext), nil)
+
+	s = Prefix + base64.RawStdEncoding.EncodeToString(data)
+	b.sealed[plaintext] = s
+
+	return s, nil
+}
+
+// Open decrypts s, which must have the [Prefix].
+func (b *Box) Open(s string) (plaintext string, err error) {
+	if !IsEncrypted(s) {
+		return "", errors.Error("not an encrypted value")
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(s[len(Prefix):])
+	if err != nil {
+		return "", fmt.Errorf("decoding: %w", err)
+	} else if len(data) < saltLen {
+		return "", errors.Error("value is too short")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	salt := data[:saltLen]
+	aead, err := b.aead(salt)
+	if err != nil {
+		return "", err
+	}
+
+	data = data[saltLen:]
+	n := aead.NonceSize()
+	if len(data) < n {
+		return "", errors.Error("value is too short")
+	}
+
+	p, err := aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", errors.Error("decrypting: wrong key or corrupted value")
+	}
+
+	plaintext = string(p)
+	b.sealed[plaintext] = s
+	if b.salt == nil {
+		// Reuse the salt to avoid deriving another key for the new values.
+		b.salt = append([]byte(nil), salt...)
+	}
+
+	return plaintext, nil
+}
+
+// aead returns the cipher for the key derived with salt.  b.mu is expected to
+// be locked.
+func (b *Box) aead(salt []byte) (aead cipher.AEAD, err error) {
+	key, ok := b.keys[string(salt)]
+	if !ok {
+		key, err = scrypt.Key(b.material, salt, scryptN, scryptR, scryptP, keyLen)
+		if err != nil {
+			return nil, fmt.Errorf("deriving key: %w", err)
+		}
+
+		b.keys[string(salt)] = key
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,238 @@
+package aghtls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// PKCS #7 Signing
+
+// Object identifiers used in the signed data.
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// contentInfo is the ContentInfo structure from RFC 5652.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// signedData is the SignedData structure from RFC 5652.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      encapContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+// encapContentInfo is the EncapsulatedContentInfo structure from RFC 5652.
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+// signerInfo is the SignerInfo structure from RFC 5652.
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// issuerAndSerialNumber identifies the certificate of the signer.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// attribute is the Attribute structure from RFC 5652.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// SignPKCS7 returns content signed with the key of cert and wrapped into the
+// DER-encoded PKCS #7 SignedData structure, which includes content itself and
+// the certificate chain of cert.  Only RSA and ECDSA keys are supported.
+func SignPKCS7(content []byte, cert *tls.Certificate, now time.Time) (signed []byte, err error) {
+	defer func() { err = errors.Annotate(err, "signing pkcs7: %w") }()
+
+	if len(cert.Certificate) == 0 {
+		return nil, errors.Error("no certificates")
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing leaf certificate: %w", err)
+		}
+	}
+
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("bad private key type %T", cert.PrivateKey)
+	}
+
+	var sigAlg asn1.ObjectIdentifier
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = oidSHA256WithRSA
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", signer.Public())
+	}
+
+	attrs, err := signedAttrs(content, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is calculated over the DER encoding of the attributes as
+	// a SET, while they are included into the structure with an implicit tag.
+	// See RFC 5652, Section 5.4.
+	attrsDER, err := asn1.Marshal(attrs)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling attributes: %w", err)
+	}
+
+	digest := sha256.Sum256(attrsDER)
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("signing: %w", err)
+	}
+
+	var certs []byte
+	for _, c := range cert.Certificate {
+		certs = append(certs, c...)
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd := &signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		ContentInfo: encapContentInfo{
+			ContentType: oidData,
+			Content:     content,
+		},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      certs,
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: leaf.RawIssuer},
+				SerialNumber: leaf.SerialNumber,
+			},
+			DigestAlgorithm: digestAlg,
+			SignedAttrs: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      attrs.Bytes,
+			},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+			Signature:          sig,
+		}},
+	}
+
+	sdDER, err := asn1.Marshal(*sd)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling signed data: %w", err)
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      sdDER,
+		},
+	})
+}
+
+// signedAttrs returns the signed attributes for content as a DER SET: the
+// content type, the message digest, and the signing time.
+func signedAttrs(content []byte, now time.Time) (attrs asn1.RawValue, err error) {
+	digest := sha256.Sum256(content)
+	values := []struct {
+		oid asn1.ObjectIdentifier
+		val any
+	}{{
+		oid: oidContentType,
+		val: oidData,
+	}, {
+		oid: oidMessageDigest,
+		val: digest[:],
+	}, {
+		oid: oidSigningTime,
+		val: now.UTC(),
+	}}
+
+	encoded := make([][]byte, 0, len(values))
+	for _, v := range values {
+		var valDER []byte
+		valDER, err = asn1.Marshal(v.val)
+		if err != nil {
+			return attrs, fmt.Errorf("marshaling attribute %s: %w", v.oid, err)
+		}
+
+		var attrDER []byte
+		attrDER, err = asn1.Marshal(attribute{
+			Type: v.oid,
+			Values: asn1.RawValue{
+				Class:      asn1.ClassUniversal,
+				Tag:        asn1.TagSet,
+				IsCompound: true,
+				Bytes:      valDER,
+			},
+		})
+		if err != nil {
+			return attrs, fmt.Errorf("marshaling attribute %s: %w", v.oid, err)
+		}
+
+		encoded = append(encoded, attrDER)
+	}
+
+	// DER requires the elements of a SET OF to be sorted by their encodings.
+	sort.Slice(encoded, func(i, j int) (less bool) {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(encoded, nil),
+	}, nil
+}
@@ -0,0 +1,79 @@
+package aghtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignPKCS7(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "dns.example"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+
+	content := []byte("<plist></plist>")
+	signed, err := SignPKCS7(content, cert, now)
+	require.NoError(t, err)
+
+	ci := &contentInfo{}
+	_, err = asn1.Unmarshal(signed, ci)
+	require.NoError(t, err)
+
+	assert.True(t, ci.ContentType.Equal(oidSignedData))
+
+	sd := &signedData{}
+	_, err = asn1.Unmarshal(ci.Content.Bytes, sd)
+	require.NoError(t, err)
+
+	assert.Equal(t, content, sd.ContentInfo.Content)
+	assert.Equal(t, der, sd.Certificates.Bytes)
+	require.Len(t, sd.SignerInfos, 1)
+
+	si := sd.SignerInfos[0]
+	assert.Equal(t, leaf.SerialNumber, si.SID.SerialNumber)
+	assert.True(t, si.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA))
+
+	attrsDER, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      si.SignedAttrs.Bytes,
+	})
+	require.NoError(t, err)
+
+	err = leaf.CheckSignature(x509.ECDSAWithSHA256, attrsDER, si.Signature)
+	assert.NoError(t, err)
+
+	t.Run("no_certificates", func(t *testing.T) {
+		_, err = SignPKCS7(content, &tls.Certificate{}, now)
+		assert.EqualError(t, err, "signing pkcs7: no certificates")
+	})
+}
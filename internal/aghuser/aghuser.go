@@ -0,0 +1,91 @@
+// Package aghuser contains the types and utilities for the users of the web
+// interface and the HTTP API.
+package aghuser
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is the role of a user, which defines the HTTP APIs available to them.
+type Role string
+
+// Role constants.  Each role is allowed everything that the previous one is.
+const (
+	// RoleViewer can only view the settings and statistics.
+	RoleViewer Role = "viewer"
+
+	// RoleOperator can also perform the everyday operations, such as pausing
+	// the protection, refreshing the filters, or managing the clients.
+	RoleOperator Role = "operator"
+
+	// RoleAdmin can also change the server settings and manage the users.
+	RoleAdmin Role = "admin"
+)
+
+// level returns the privilege level of r.  Unknown roles have the level of
+// zero.
+func (r Role) level() (l int) {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Validate returns an error if r is not one of the known roles.
+func (r Role) Validate() (err error) {
+	if r.level() == 0 {
+		return fmt.Errorf("bad role %q", r)
+	}
+
+	return nil
+}
+
+// Allows returns true if a user with role r may access the APIs that require
+// the role required.  Unknown roles are not allowed anything.
+func (r Role) Allows(required Role) (ok bool) {
+	l := r.level()
+
+	return l != 0 && l >= required.level()
+}
+
+// ErrBadCost is returned by [HashPassword] when the cost is outside of the
+// supported range.
+const ErrBadCost errors.Error = "bad bcrypt cost"
+
+// HashPassword returns the bcrypt hash of password computed with cost.  The
+// cost is stored within the hash, so the users can have different ones.  If
+// cost is zero, the default cost is used.
+func HashPassword(password string, cost int) (hash string, err error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	} else if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf(
+			"%w: must be between %d and %d, got %d",
+			ErrBadCost,
+			bcrypt.MinCost,
+			bcrypt.MaxCost,
+			cost,
+		)
+	}
+
+	b, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// PasswordMatches returns true if password matches the bcrypt hash.
+func PasswordMatches(hash, password string) (ok bool) {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,88 @@
+package aghuser_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRole_Allows(t *testing.T) {
+	testCases := []struct {
+		role     aghuser.Role
+		required aghuser.Role
+		want     assert.BoolAssertionFunc
+	}{{
+		role:     aghuser.RoleViewer,
+		required: aghuser.RoleViewer,
+		want:     assert.True,
+	}, {
+		role:     aghuser.RoleViewer,
+		required: aghuser.RoleOperator,
+		want:     assert.False,
+	}, {
+		role:     aghuser.RoleOperator,
+		required: aghuser.RoleViewer,
+		want:     assert.True,
+	}, {
+		role:     aghuser.RoleOperator,
+		required: aghuser.RoleAdmin,
+		want:     assert.False,
+	}, {
+		role:     aghuser.RoleAdmin,
+		required: aghuser.RoleAdmin,
+		want:     assert.True,
+	}, {
+		role:     "unknown",
+		required: aghuser.RoleViewer,
+		want:     assert.False,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.role)+"_"+string(tc.required), func(t *testing.T) {
+			tc.want(t, tc.role.Allows(tc.required))
+		})
+	}
+}
+
+func TestRole_Validate(t *testing.T) {
+	assert.NoError(t, aghuser.RoleOperator.Validate())
+
+	testutil.AssertErrorMsg(t, `bad role "root"`, aghuser.Role("root").Validate())
+	testutil.AssertErrorMsg(t, `bad role ""`, aghuser.Role("").Validate())
+}
+
+func TestHashPassword(t *testing.T) {
+	const password = "password"
+
+	t.Run("default", func(t *testing.T) {
+		hash, err := aghuser.HashPassword(password, 0)
+		require.NoError(t, err)
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		require.NoError(t, err)
+
+		assert.Equal(t, bcrypt.DefaultCost, cost)
+		assert.True(t, aghuser.PasswordMatches(hash, password))
+		assert.False(t, aghuser.PasswordMatches(hash, "wrong"))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		hash, err := aghuser.HashPassword(password, bcrypt.MinCost)
+		require.NoError(t, err)
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		require.NoError(t, err)
+
+		assert.Equal(t, bcrypt.MinCost, cost)
+		assert.True(t, aghuser.PasswordMatches(hash, password))
+	})
+
+	t.Run("bad_cost", func(t *testing.T) {
+		_, err := aghuser.HashPassword(password, bcrypt.MaxCost+1)
+		testutil.AssertErrorMsg(t, "bad bcrypt cost: must be between 4 and 31, got 32", err)
+	})
+}
@@ -0,0 +1,154 @@
+package aghuser
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters as recommended by RFC 6238 and supported by most of the
+// authenticator applications.
+const (
+	// TOTPPeriod is the duration of a single time step.
+	TOTPPeriod = 30 * time.Second
+
+	// TOTPDigits is the number of digits in a code.
+	TOTPDigits = 6
+
+	// TOTPSecretLen is the length of a generated secret in bytes, which is
+	// the length of the SHA-1 output as recommended by RFC 4226.
+	TOTPSecretLen = 20
+
+	// totpSkew is the number of time steps before and after the current one
+	// that are also accepted to allow for clock drift.
+	totpSkew = 1
+
+	// totpMod is 10 to the power of TOTPDigits.
+	totpMod = 1_000_000
+)
+
+// totpEncoding is the encoding of secrets used by the authenticator
+// applications.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a new random TOTP secret.
+func NewTOTPSecret() (secret []byte, err error) {
+	secret = make([]byte, TOTPSecretLen)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("generating totp secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// EncodeTOTPSecret returns the secret in the base32 form that can be entered
+// into the authenticator applications manually.
+func EncodeTOTPSecret(secret []byte) (s string) {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI returns the provisioning URI for secret, which is usually shown as
+// a QR code.  See https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+func TOTPURI(issuer, account string, secret []byte) (uri string) {
+	q := url.Values{
+		"algorithm": []string{"SHA1"},
+		"digits":    []string{fmt.Sprint(TOTPDigits)},
+		"issuer":    []string{issuer},
+		"period":    []string{fmt.Sprint(int(TOTPPeriod.Seconds()))},
+		"secret":    []string{EncodeTOTPSecret(secret)},
+	}
+
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
+
+// TOTPStep returns the time step that t belongs to.
+func TOTPStep(t time.Time) (step int64) {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode returns the code for secret at the time step.
+func TOTPCode(secret []byte, step int64) (code string) {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, see RFC 4226, section 5.3.
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fff_ffff
+
+	return fmt.Sprintf("%0*d", TOTPDigits, bin%totpMod)
+}
+
+// MatchTOTP checks code against the codes for secret around the time step of
+// now.  If ok is true, step is the step of the matching code, which the caller
+// should use to prevent the code from being used again.  Codes for steps not
+// after notAfter are never accepted.
+func MatchTOTP(secret []byte, code string, now time.Time, notAfter int64) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	cur := TOTPStep(now)
+	for s := cur - totpSkew; s <= cur+totpSkew; s++ {
+		if s <= notAfter {
+			continue
+		}
+
+		want := TOTPCode(secret, s)
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// recoveryCodeLen is the length of a recovery code in bytes before encoding.
+const recoveryCodeLen = 5
+
+// NewRecoveryCodes returns n new random single-use recovery codes.
+func NewRecoveryCodes(n int) (codes []string, err error) {
+	codes = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeLen)
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+
+		h := hex.EncodeToString(b)
+		codes = append(codes, h[:5]+"-"+h[5:])
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hash of the recovery code to store instead of
+// the code itself.  The codes are random enough for a fast hash to be secure.
+func HashRecoveryCode(code string) (hash string) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,92 @@
+package aghuser_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTOTPSecret is the secret from the test vectors of RFC 6238, Appendix B.
+var testTOTPSecret = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// The codes are the last six digits of the SHA-1 codes from RFC 6238,
+	// Appendix B.
+	testCases := []struct {
+		want string
+		unix int64
+	}{{
+		want: "287082",
+		unix: 59,
+	}, {
+		want: "081804",
+		unix: 1_111_111_109,
+	}, {
+		want: "050471",
+		unix: 1_111_111_111,
+	}, {
+		want: "005924",
+		unix: 1_234_567_890,
+	}, {
+		want: "279037",
+		unix: 2_000_000_000,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			step := aghuser.TOTPStep(time.Unix(tc.unix, 0))
+			assert.Equal(t, tc.want, aghuser.TOTPCode(testTOTPSecret, step))
+		})
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1_234_567_890, 0)
+	cur := aghuser.TOTPStep(now)
+
+	step, ok := aghuser.MatchTOTP(testTOTPSecret, "005924", now, 0)
+	require.True(t, ok)
+
+	assert.Equal(t, cur, step)
+
+	// The code from the previous step is accepted to allow for clock drift.
+	prev := aghuser.TOTPCode(testTOTPSecret, cur-1)
+	step, ok = aghuser.MatchTOTP(testTOTPSecret, prev, now, 0)
+	require.True(t, ok)
+
+	assert.Equal(t, cur-1, step)
+
+	// A used code is rejected.
+	_, ok = aghuser.MatchTOTP(testTOTPSecret, "005924", now, cur)
+	assert.False(t, ok)
+
+	old := aghuser.TOTPCode(testTOTPSecret, cur-2)
+	_, ok = aghuser.MatchTOTP(testTOTPSecret, old, now, 0)
+	assert.False(t, ok)
+
+	_, ok = aghuser.MatchTOTP(testTOTPSecret, "5924", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	const want = "otpauth://totp/AdGuard%20Home:admin?algorithm=SHA1&digits=6" +
+		"&issuer=AdGuard+Home&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	assert.Equal(t, want, aghuser.TOTPURI("AdGuard Home", "admin", testTOTPSecret))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := aghuser.NewRecoveryCodes(3)
+	require.NoError(t, err)
+	require.Len(t, codes, 3)
+
+	for _, c := range codes {
+		assert.Len(t, c, 11)
+		assert.Equal(t, aghuser.HashRecoveryCode(c), aghuser.HashRecoveryCode(" "+c+" "))
+	}
+
+	assert.NotEqual(t, codes[0], codes[1])
+}
@@ -0,0 +1,124 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/packet"
+)
+
+// ARP Conflict Detection
+
+// arpProbe sends an ARP probe for target from iface and waits for the
+// conflicting ARP packets until timeout passes.  conflict is true if another
+// device uses or probes target.  See RFC 5227.
+func arpProbe(
+	iface *net.Interface,
+	target netip.Addr,
+	timeout time.Duration,
+) (conflict bool, err error) {
+	conn, err := packet.Listen(iface, packet.Raw, int(ethernet.EtherTypeARP), nil)
+	if err != nil {
+		return false, fmt.Errorf("listening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	pkt, err := buildARPProbe(iface.HardwareAddr, target)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = conn.WriteTo(pkt, &packet.Addr{HardwareAddr: layers.EthernetBroadcast})
+	if err != nil {
+		return false, fmt.Errorf("sending probe: %w", err)
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return false, fmt.Errorf("setting deadline: %w", err)
+	}
+
+	buf := make([]byte, iface.MTU)
+	for {
+		var n int
+		n, _, err = conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("reading: %w", err)
+		}
+
+		if isARPConflict(buf[:n], iface.HardwareAddr, target) {
+			return true, nil
+		}
+	}
+}
+
+// buildARPProbe returns the Ethernet frame with the ARP probe for target sent
+// from the hardware address src.  The sender protocol address of the probe is
+// unspecified to avoid polluting the ARP caches of the other devices.
+func buildARPProbe(src net.HardwareAddr, target netip.Addr) (pkt []byte, err error) {
+	ethLayer := &layers.Ethernet{
+		SrcMAC:       src,
+		DstMAC:       layers.EthernetBroadcast,
+		EthernetType: layers.EthernetTypeARP,
+	}
+
+	arpLayer := &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     uint8(len(src)),
+		ProtAddressSize:   net.IPv4len,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   src,
+		SourceProtAddress: net.IPv4zero.To4(),
+		DstHwAddress:      make(net.HardwareAddr, len(src)),
+		DstProtAddress:    target.AsSlice(),
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	setts := gopacket.SerializeOptions{
+		FixLengths: true,
+	}
+
+	err = gopacket.SerializeLayers(buf, setts, ethLayer, arpLayer)
+	if err != nil {
+		return nil, fmt.Errorf("serializing layers: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// isARPConflict returns true if the Ethernet frame pkt is an ARP packet sent by
+// another device, which either uses target or probes it as well.
+func isARPConflict(pkt []byte, own net.HardwareAddr, target netip.Addr) (ok bool) {
+	p := gopacket.NewPacket(pkt, layers.LayerTypeEthernet, gopacket.NoCopy)
+	arpLayer, ok := p.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || bytes.Equal(arpLayer.SourceHwAddress, own) {
+		return false
+	}
+
+	srcIP, ok := netip.AddrFromSlice(arpLayer.SourceProtAddress)
+	if !ok {
+		return false
+	} else if srcIP == target {
+		return true
+	}
+
+	dstIP, ok := netip.AddrFromSlice(arpLayer.DstProtAddress)
+
+	return ok &&
+		arpLayer.Operation == layers.ARPRequest &&
+		srcIP.IsUnspecified() &&
+		dstIP == target
+}
@@ -0,0 +1,98 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsARPConflict(t *testing.T) {
+	own := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	other := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+	target := netip.MustParseAddr("192.168.10.150")
+
+	newPkt := func(t *testing.T, a *layers.ARP) (pkt []byte) {
+		t.Helper()
+
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr(a.SourceHwAddress),
+			DstMAC:       layers.EthernetBroadcast,
+			EthernetType: layers.EthernetTypeARP,
+		}
+
+		a.AddrType = layers.LinkTypeEthernet
+		a.Protocol = layers.EthernetTypeIPv4
+		a.HwAddressSize = 6
+		a.ProtAddressSize = 4
+		a.DstHwAddress = make([]byte, 6)
+
+		buf := gopacket.NewSerializeBuffer()
+		err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, a)
+		require.NoError(t, err)
+
+		return buf.Bytes()
+	}
+
+	probe, err := buildARPProbe(own, target)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		arp  *layers.ARP
+		name string
+		want bool
+	}{{
+		arp: &layers.ARP{
+			Operation:         layers.ARPReply,
+			SourceHwAddress:   other,
+			SourceProtAddress: target.AsSlice(),
+			DstProtAddress:    net.IPv4zero.To4(),
+		},
+		name: "reply",
+		want: true,
+	}, {
+		arp: &layers.ARP{
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   other,
+			SourceProtAddress: net.IPv4zero.To4(),
+			DstProtAddress:    target.AsSlice(),
+		},
+		name: "probe",
+		want: true,
+	}, {
+		arp: &layers.ARP{
+			Operation:         layers.ARPReply,
+			SourceHwAddress:   own,
+			SourceProtAddress: target.AsSlice(),
+			DstProtAddress:    net.IPv4zero.To4(),
+		},
+		name: "own",
+		want: false,
+	}, {
+		arp: &layers.ARP{
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   other,
+			SourceProtAddress: []byte{192, 168, 10, 1},
+			DstProtAddress:    target.AsSlice(),
+		},
+		name: "request",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isARPConflict(newPkt(t, tc.arp), own, target))
+		})
+	}
+
+	t.Run("own_probe", func(t *testing.T) {
+		assert.False(t, isARPConflict(probe, own, target))
+		assert.True(t, isARPConflict(probe, other, target))
+	})
+}
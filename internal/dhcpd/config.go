@@ -43,6 +43,8 @@ type DHCPServer interface {
 	GetLeases(flags GetLeasesFlags) (leases []*Lease)
 	// AddStaticLease - add a static lease
 	AddStaticLease(l *Lease) (err error)
+	// AddDynamicLease adds an imported dynamic lease.
+	AddDynamicLease(l *Lease) (err error)
 	// RemoveStaticLease - remove a static lease
 	RemoveStaticLease(l *Lease) (err error)
 
@@ -84,6 +86,12 @@ type V4ServerConf struct {
 	// 0: disable
 	ICMPTimeout uint32 `yaml:"icmp_timeout_msec" json:"-"`
 
+	// ARPTimeout is the time in milliseconds to wait for a reply to the ARP
+	// probe of an address before offering it.  The ARP probe detects the
+	// conflicts with the devices which don't reply to ICMP echo requests.  0
+	// disables it.
+	ARPTimeout uint32 `yaml:"arp_timeout_msec" json:"-"`
+
 	// Custom Options.
 	//
 	// Option with arbitrary hexadecimal data:
@@ -94,6 +102,10 @@ type V4ServerConf struct {
 	//     DEC_CODE ip IP_ADDR
 	Options []string `yaml:"options" json:"-"`
 
+	// VendorClasses are the option sets for the clients with the specific
+	// vendor class identifiers.
+	VendorClasses []*VendorClass `yaml:"vendor_classes" json:"-"`
+
 	ipRange *ipRange
 
 	leaseTime  time.Duration // the time during which a dynamic lease is considered valid
@@ -112,6 +124,20 @@ type V4ServerConf struct {
 	notify func(uint32)
 }
 
+// VendorClass is a set of DHCPv4 options sent only to the clients with the
+// vendor class identifier, option 60, starting with ID.  For example, IP phones
+// may receive their TFTP and VLAN options while the other clients don't.
+type VendorClass struct {
+	// ID is the prefix of the vendor class identifiers of the clients.  It
+	// must not be empty.
+	ID string `yaml:"id"`
+
+	// Options are the options in the same format as [V4ServerConf.Options].
+	// They override the ones from the configuration but are overridden by
+	// the options of the static leases.
+	Options []string `yaml:"options"`
+}
+
 // errNilConfig is an error returned by validation method if the config is nil.
 const errNilConfig errors.Error = "nil config"
 
@@ -18,10 +18,28 @@ import (
 const dbFilename = "leases.db"
 
 type leaseJSON struct {
-	HWAddr   []byte `json:"mac"`
-	IP       []byte `json:"ip"`
-	Hostname string `json:"host"`
-	Expiry   int64  `json:"exp"`
+	HWAddr     []byte            `json:"mac"`
+	IP         []byte            `json:"ip"`
+	Hostname   string            `json:"host"`
+	Expiry     int64             `json:"exp"`
+	BootFile   string            `json:"boot_file,omitempty"`
+	TFTPServer string            `json:"tftp_server,omitempty"`
+	Options    []string          `json:"options,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// newLeaseJSON returns the database representation of l.
+func newLeaseJSON(l *Lease) (lj leaseJSON) {
+	return leaseJSON{
+		HWAddr:     l.HWAddr,
+		IP:         l.IP.AsSlice(),
+		Hostname:   l.Hostname,
+		Expiry:     l.Expiry.Unix(),
+		BootFile:   l.BootFile,
+		TFTPServer: l.TFTPServer,
+		Options:    l.Options,
+		Metadata:   l.Metadata,
+	}
 }
 
 func normalizeIP(ip net.IP) net.IP {
@@ -67,10 +85,14 @@ func (s *server) dbLoad() (err error) {
 		}
 
 		lease := Lease{
-			HWAddr:   obj[i].HWAddr,
-			IP:       ip,
-			Hostname: obj[i].Hostname,
-			Expiry:   time.Unix(obj[i].Expiry, 0),
+			HWAddr:     obj[i].HWAddr,
+			IP:         ip,
+			Hostname:   obj[i].Hostname,
+			Expiry:     time.Unix(obj[i].Expiry, 0),
+			BootFile:   obj[i].BootFile,
+			TFTPServer: obj[i].TFTPServer,
+			Options:    obj[i].Options,
+			Metadata:   obj[i].Metadata,
 		}
 
 		if len(obj[i].IP) == 16 {
@@ -147,14 +169,7 @@ func (s *server) dbStore() (err error) {
 			continue
 		}
 
-		lease := leaseJSON{
-			HWAddr:   l.HWAddr,
-			IP:       l.IP.AsSlice(),
-			Hostname: l.Hostname,
-			Expiry:   l.Expiry.Unix(),
-		}
-
-		leases = append(leases, lease)
+		leases = append(leases, newLeaseJSON(l))
 	}
 
 	if s.srv6 != nil {
@@ -164,14 +179,7 @@ func (s *server) dbStore() (err error) {
 				continue
 			}
 
-			lease := leaseJSON{
-				HWAddr:   l.HWAddr,
-				IP:       l.IP.AsSlice(),
-				Hostname: l.Hostname,
-				Expiry:   l.Expiry.Unix(),
-			}
-
-			leases = append(leases, lease)
+			leases = append(leases, newLeaseJSON(l))
 		}
 	}
 
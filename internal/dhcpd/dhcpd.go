@@ -9,8 +9,10 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
@@ -51,6 +53,49 @@ type Lease struct {
 	//
 	// TODO(a.garipov): Migrate leases.db.
 	IP netip.Addr `json:"ip"`
+
+	// BootFile is the boot file name sent to the client of a static DHCPv4
+	// lease, for example for PXE booting.
+	BootFile string `json:"boot_file,omitempty"`
+
+	// TFTPServer is the name or the IPv4 address of the TFTP server sent to
+	// the client of a static DHCPv4 lease.
+	TFTPServer string `json:"tftp_server,omitempty"`
+
+	// Options are the DHCPv4 options sent to the client of a static lease in
+	// addition to the ones from the configuration.  Those have the same format
+	// as [V4ServerConf.Options] and override them.
+	Options []string `json:"options,omitempty"`
+
+	// Metadata is the free-form metadata of a static lease, for example its
+	// location or owner.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Limits of the static lease metadata.
+const (
+	maxLeaseMetadataLen    = 32
+	maxLeaseMetadataKeyLen = 64
+	maxLeaseMetadataValLen = 256
+)
+
+// validateLeaseMetadata returns an error if md exceeds the limits.
+func validateLeaseMetadata(md map[string]string) (err error) {
+	if len(md) > maxLeaseMetadataLen {
+		return fmt.Errorf("metadata: too many entries: %d, max %d", len(md), maxLeaseMetadataLen)
+	}
+
+	for k, v := range md {
+		if k == "" {
+			return errors.Error("metadata: empty key")
+		} else if len(k) > maxLeaseMetadataKeyLen {
+			return fmt.Errorf("metadata: key %q is too long, max %d", k, maxLeaseMetadataKeyLen)
+		} else if len(v) > maxLeaseMetadataValLen {
+			return fmt.Errorf("metadata: value of %q is too long, max %d", k, maxLeaseMetadataValLen)
+		}
+	}
+
+	return nil
 }
 
 // Clone returns a deep copy of l.
@@ -60,10 +105,14 @@ func (l *Lease) Clone() (clone *Lease) {
 	}
 
 	return &Lease{
-		Expiry:   l.Expiry,
-		Hostname: l.Hostname,
-		HWAddr:   slices.Clone(l.HWAddr),
-		IP:       l.IP,
+		Expiry:     l.Expiry,
+		Hostname:   l.Hostname,
+		HWAddr:     slices.Clone(l.HWAddr),
+		IP:         l.IP,
+		BootFile:   l.BootFile,
+		TFTPServer: l.TFTPServer,
+		Options:    slices.Clone(l.Options),
+		Metadata:   maps.Clone(l.Metadata),
 	}
 }
 
@@ -146,6 +195,14 @@ const (
 	LeaseChangedRemovedStatic
 	LeaseChangedRemovedAll
 
+	// LeaseChangedRemovedDynamic means that a dynamic lease has been released
+	// by the client.
+	LeaseChangedRemovedDynamic
+
+	// LeaseChangedDeclined means that a dynamic lease has been declined by the
+	// client and possibly replaced with a new one.
+	LeaseChangedDeclined
+
 	LeaseChangedDBStore
 )
 
@@ -170,7 +227,26 @@ type Interface interface {
 	SetOnLeaseChanged(onLeaseChanged OnLeaseChangedT)
 	FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr)
 
+	// AddStaticLease adds a static lease for the address family of l.IP.
+	AddStaticLease(l *Lease) (err error)
+
+	// AddDynamicLease adds an imported dynamic lease for the address family of
+	// l.IP.
+	AddDynamicLease(l *Lease) (err error)
+
+	// RemoveStaticLease removes a static lease for the address family of
+	// l.IP.
+	RemoveStaticLease(l *Lease) (err error)
+
+	// ResetLeases removes all leases and stores the empty lease database.
+	ResetLeases() (err error)
+
 	WriteDiskConfig(c *ServerConfig)
+
+	// ConfigureV4 enables the DHCPv4 server with conf on the network interface
+	// named ifaceName and restarts it.  The fields of conf not configurable
+	// via the HTTP API are ignored.
+	ConfigureV4(ifaceName string, conf *V4ServerConf) (err error)
 }
 
 // MockInterface is a mock Interface implementation.
@@ -183,7 +259,12 @@ type MockInterface struct {
 	OnLeases            func(flags GetLeasesFlags) (leases []*Lease)
 	OnSetOnLeaseChanged func(f OnLeaseChangedT)
 	OnFindMACbyIP       func(ip netip.Addr) (mac net.HardwareAddr)
+	OnAddStaticLease    func(l *Lease) (err error)
+	OnAddDynamicLease   func(l *Lease) (err error)
+	OnRemoveStaticLease func(l *Lease) (err error)
+	OnResetLeases       func() (err error)
 	OnWriteDiskConfig   func(c *ServerConfig)
+	OnConfigureV4       func(ifaceName string, conf *V4ServerConf) (err error)
 }
 
 var _ Interface = (*MockInterface)(nil)
@@ -208,9 +289,28 @@ func (s *MockInterface) FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr) {
 	return s.OnFindMACbyIP(ip)
 }
 
+// AddStaticLease implements the [Interface] for *MockInterface.
+func (s *MockInterface) AddStaticLease(l *Lease) (err error) { return s.OnAddStaticLease(l) }
+
+// AddDynamicLease implements the [Interface] for *MockInterface.
+func (s *MockInterface) AddDynamicLease(l *Lease) (err error) { return s.OnAddDynamicLease(l) }
+
+// RemoveStaticLease implements the [Interface] for *MockInterface.
+func (s *MockInterface) RemoveStaticLease(l *Lease) (err error) {
+	return s.OnRemoveStaticLease(l)
+}
+
+// ResetLeases implements the [Interface] for *MockInterface.
+func (s *MockInterface) ResetLeases() (err error) { return s.OnResetLeases() }
+
 // WriteDiskConfig implements the Interface for *MockInterface.
 func (s *MockInterface) WriteDiskConfig(c *ServerConfig) { s.OnWriteDiskConfig(c) }
 
+// ConfigureV4 implements the [Interface] for *MockInterface.
+func (s *MockInterface) ConfigureV4(ifaceName string, conf *V4ServerConf) (err error) {
+	return s.OnConfigureV4(ifaceName, conf)
+}
+
 // server is the DHCP service that handles DHCPv4, DHCPv6, and HTTP API.
 type server struct {
 	srv4 DHCPServer
@@ -297,8 +397,8 @@ func (s *server) Enabled() (ok bool) {
 	return s.conf.Enabled
 }
 
-// resetLeases resets all leases in the lease database.
-func (s *server) resetLeases() (err error) {
+// ResetLeases implements the [Interface] for *server.
+func (s *server) ResetLeases() (err error) {
 	err = s.srv4.ResetLeases(nil)
 	if err != nil {
 		return err
@@ -395,7 +495,26 @@ func (s *server) FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr) {
 	return s.srv6.FindMACbyIP(ip)
 }
 
-// AddStaticLease - add static v4 lease
-func (s *server) AddStaticLease(l *Lease) error {
-	return s.srv4.AddStaticLease(l)
+// AddStaticLease implements the [Interface] for *server.
+func (s *server) AddStaticLease(l *Lease) (err error) {
+	return s.srvFor(l.IP).AddStaticLease(l)
+}
+
+// AddDynamicLease implements the [Interface] for *server.
+func (s *server) AddDynamicLease(l *Lease) (err error) {
+	return s.srvFor(l.IP).AddDynamicLease(l)
+}
+
+// RemoveStaticLease implements the [Interface] for *server.
+func (s *server) RemoveStaticLease(l *Lease) (err error) {
+	return s.srvFor(l.IP).RemoveStaticLease(l)
+}
+
+// srvFor returns the server for the address family of ip.
+func (s *server) srvFor(ip netip.Addr) (srv DHCPServer) {
+	if ip.Unmap().Is4() {
+		return s.srv4
+	}
+
+	return s.srv6
 }
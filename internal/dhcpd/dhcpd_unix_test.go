@@ -53,6 +53,9 @@ func TestDB(t *testing.T) {
 		Hostname: "static-2.local",
 		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xBB},
 		IP:       netip.MustParseAddr("192.168.10.101"),
+		BootFile: "pxelinux.0",
+		Options:  []string{"252 text http://192.168.10.1/wpad.dat"},
+		Metadata: map[string]string{"owner": "alice"},
 	}}
 
 	srv4, ok := s.srv4.(*v4Server)
@@ -80,6 +83,9 @@ func TestDB(t *testing.T) {
 
 	assert.Equal(t, leases[1].HWAddr, ll[0].HWAddr)
 	assert.Equal(t, leases[1].IP, ll[0].IP)
+	assert.Equal(t, leases[1].BootFile, ll[0].BootFile)
+	assert.Equal(t, leases[1].Options, ll[0].Options)
+	assert.Equal(t, leases[1].Metadata, ll[0].Metadata)
 	assert.True(t, ll[0].IsStatic())
 
 	assert.Equal(t, leases[0].HWAddr, ll[1].HWAddr)
@@ -3,6 +3,7 @@
 package dhcpd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -155,13 +156,18 @@ func (s *server) handleDHCPSetConfigV4(
 	c4 := &V4ServerConf{
 		notify:      s.onNotify,
 		ICMPTimeout: s.conf.Conf4.ICMPTimeout,
+		ARPTimeout:  s.conf.Conf4.ARPTimeout,
 		Options:     s.conf.Conf4.Options,
+
+		VendorClasses: s.conf.Conf4.VendorClasses,
 	}
 
 	s.srv4.WriteDiskConfig4(c4)
 	v4Conf.notify = c4.notify
 	v4Conf.ICMPTimeout = c4.ICMPTimeout
+	v4Conf.ARPTimeout = c4.ARPTimeout
 	v4Conf.Options = c4.Options
+	v4Conf.VendorClasses = c4.VendorClasses
 
 	srv4, err := v4Create(v4Conf)
 
@@ -209,31 +215,32 @@ func (s *server) handleDHCPSetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	srv4, v4Enabled, err := s.handleDHCPSetConfigV4(conf)
+	code, err := s.setConfig(conf)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "bad dhcpv4 configuration: %s", err)
+		aghhttp.Error(r, w, code, "%s", err)
+	}
+}
 
-		return
+// setConfig validates conf, applies it, and restarts the server if it's
+// enabled.  code is the HTTP status code corresponding to err.
+func (s *server) setConfig(conf *dhcpServerConfigJSON) (code int, err error) {
+	srv4, v4Enabled, err := s.handleDHCPSetConfigV4(conf)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("bad dhcpv4 configuration: %w", err)
 	}
 
 	srv6, v6Enabled, err := s.handleDHCPSetConfigV6(conf)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "bad dhcpv6 configuration: %s", err)
-
-		return
+		return http.StatusBadRequest, fmt.Errorf("bad dhcpv6 configuration: %w", err)
 	}
 
 	if conf.Enabled == aghalg.NBTrue && !v4Enabled && !v6Enabled {
-		aghhttp.Error(r, w, http.StatusBadRequest, "dhcpv4 or dhcpv6 configuration must be complete")
-
-		return
+		return http.StatusBadRequest, errors.Error("dhcpv4 or dhcpv6 configuration must be complete")
 	}
 
 	err = s.Stop()
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "stopping dhcp: %s", err)
-
-		return
+		return http.StatusInternalServerError, fmt.Errorf("stopping dhcp: %w", err)
 	}
 
 	s.setConfFromJSON(conf, srv4, srv6)
@@ -241,18 +248,34 @@ func (s *server) handleDHCPSetConfig(w http.ResponseWriter, r *http.Request) {
 
 	err = s.dbLoad()
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "loading leases db: %s", err)
-
-		return
+		return http.StatusInternalServerError, fmt.Errorf("loading leases db: %w", err)
 	}
 
 	if s.conf.Enabled {
-		var code int
 		code, err = s.enableDHCP(conf.InterfaceName)
 		if err != nil {
-			aghhttp.Error(r, w, code, "enabling dhcp: %s", err)
+			return code, fmt.Errorf("enabling dhcp: %w", err)
 		}
 	}
+
+	return http.StatusOK, nil
+}
+
+// ConfigureV4 implements the [Interface] for *server.
+func (s *server) ConfigureV4(ifaceName string, conf *V4ServerConf) (err error) {
+	_, err = s.setConfig(&dhcpServerConfigJSON{
+		V4: &v4ServerConfJSON{
+			GatewayIP:     conf.GatewayIP,
+			SubnetMask:    conf.SubnetMask,
+			RangeStart:    conf.RangeStart,
+			RangeEnd:      conf.RangeEnd,
+			LeaseDuration: conf.LeaseDuration,
+		},
+		InterfaceName: ifaceName,
+		Enabled:       aghalg.NBTrue,
+	})
+
+	return err
 }
 
 // setConfFromJSON sets configuration parameters in s from the new configuration
@@ -504,14 +527,7 @@ func (s *server) handleDHCPAddStaticLease(w http.ResponseWriter, r *http.Request
 
 	l.IP = l.IP.Unmap()
 
-	var srv DHCPServer
-	if l.IP.Is4() {
-		srv = s.srv4
-	} else {
-		srv = s.srv6
-	}
-
-	err = srv.AddStaticLease(l)
+	err = s.AddStaticLease(l)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
@@ -536,14 +552,7 @@ func (s *server) handleDHCPRemoveStaticLease(w http.ResponseWriter, r *http.Requ
 
 	l.IP = l.IP.Unmap()
 
-	var srv DHCPServer
-	if l.IP.Is4() {
-		srv = s.srv4
-	} else {
-		srv = s.srv6
-	}
-
-	err = srv.RemoveStaticLease(l)
+	err = s.RemoveStaticLease(l)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
@@ -592,7 +601,7 @@ func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleResetLeases(w http.ResponseWriter, r *http.Request) {
-	err := s.resetLeases()
+	err := s.ResetLeases()
 	if err != nil {
 		msg := "resetting leases: %s"
 		aghhttp.Error(r, w, http.StatusInternalServerError, msg, err)
@@ -601,6 +610,85 @@ func (s *server) handleResetLeases(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// leasesImportResp is the response to the POST /control/dhcp/leases/import
+// HTTP API.
+type leasesImportResp struct {
+	Skipped []string `json:"skipped"`
+	Added   int      `json:"added"`
+}
+
+// handleLeasesExport is the handler for the GET /control/dhcp/leases/export
+// HTTP API.  It writes the dynamic and static leases in the format from the
+// "format" query parameter, JSON by default.
+func (s *server) handleLeasesExport(w http.ResponseWriter, r *http.Request) {
+	f, err := ParseLeasesFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	contType := aghhttp.HdrValApplicationJSON
+	switch f {
+	case LeasesFormatJSON:
+		// Go on.
+	case LeasesFormatCSV:
+		contType = "text/csv"
+	default:
+		aghhttp.Error(r, w, http.StatusBadRequest, "exporting leases: unsupported format %q", f)
+
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err = WriteLeases(buf, s.Leases(LeasesAll), f)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(aghhttp.HdrNameContentType, contType)
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="leases.%s"`, f))
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("dhcp: writing leases: %s", err)
+	}
+}
+
+// handleLeasesImport is the handler for the POST /control/dhcp/leases/import
+// HTTP API.  The request body is the lease database in the format from the
+// "format" query parameter, JSON by default.
+func (s *server) handleLeasesImport(w http.ResponseWriter, r *http.Request) {
+	f, err := ParseLeasesFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	leases, err := ReadLeases(r.Body, f)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "importing leases: %s", err)
+
+		return
+	}
+
+	added, skipped := ImportLeases(s, leases)
+	for _, sk := range skipped {
+		log.Debug("dhcp: importing leases: skipped %s", sk)
+	}
+
+	log.Info("dhcp: imported %d leases, skipped %d", added, len(skipped))
+
+	_ = aghhttp.WriteJSONResponse(w, r, &leasesImportResp{
+		Skipped: skipped,
+		Added:   added,
+	})
+}
+
 func (s *server) registerHandlers() {
 	if s.conf.HTTPRegister == nil {
 		return
@@ -614,4 +702,6 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.handleDHCPRemoveStaticLease)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.handleReset)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.handleResetLeases)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/leases/export", s.handleLeasesExport)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/leases/import", s.handleLeasesImport)
 }
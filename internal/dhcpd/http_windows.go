@@ -29,6 +29,12 @@ func (s *server) notImplemented(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ConfigureV4 implements the [Interface] for *server.  It always returns an
+// error, since DHCP server doesn't work on Windows yet.
+func (s *server) ConfigureV4(_ string, _ *V4ServerConf) (err error) {
+	return aghos.Unsupported("dhcp")
+}
+
 // registerHandlers sets the handlers for DHCP HTTP API that always respond with
 // an HTTP 501, since DHCP server doesn't work on Windows yet.
 //
@@ -37,6 +43,10 @@ func (s *server) notImplemented(w http.ResponseWriter, r *http.Request) {
 // interconnected parts--such as HTTP handlers and frontend--to make that work
 // properly.
 func (s *server) registerHandlers() {
+	if s.conf.HTTPRegister == nil {
+		return
+	}
+
 	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/status", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/interfaces", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/set_config", s.notImplemented)
@@ -45,4 +55,6 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/leases/export", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/leases/import", s.notImplemented)
 }
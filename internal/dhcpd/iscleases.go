@@ -0,0 +1,328 @@
+package dhcpd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ISC DHCP Server Lease Import
+
+// iscToken is a token of the ISC DHCP server configuration or lease file.
+type iscToken struct {
+	// val is the value of the token.  The quotes are removed from the quoted
+	// strings.
+	val string
+
+	// quoted is true if the token is a quoted string, which is never
+	// punctuation.
+	quoted bool
+}
+
+// iscStatement is a statement of the ISC DHCP server configuration or lease
+// file.
+type iscStatement struct {
+	// args are the words of the statement, including its name.
+	args []string
+
+	// block are the statements within the braces following args, if any.
+	block []*iscStatement
+}
+
+// iscArg returns the argument of st at index i or an empty string if there is
+// no such argument.
+func (st *iscStatement) arg(i int) (arg string) {
+	if i < len(st.args) {
+		return st.args[i]
+	}
+
+	return ""
+}
+
+// iscTokenize splits data into words, quoted strings, and the ";", "{", and
+// "}" punctuation tokens.  The comments are removed.
+func iscTokenize(data string) (tokens []iscToken, err error) {
+	for i := 0; i < len(data); {
+		switch c := data[i]; c {
+		case ' ', '\t', '\r', '\n':
+			i++
+		case '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case ';', '{', '}':
+			tokens = append(tokens, iscToken{val: string(c)})
+			i++
+		case '"':
+			end := strings.IndexByte(data[i+1:], '"')
+			if end < 0 {
+				return nil, errors.Error("unterminated quoted string")
+			}
+
+			tokens = append(tokens, iscToken{val: data[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		default:
+			start := i
+			for i < len(data) && !strings.ContainsRune(" \t\r\n#;{}\"", rune(data[i])) {
+				i++
+			}
+
+			tokens = append(tokens, iscToken{val: data[start:i]})
+		}
+	}
+
+	return tokens, nil
+}
+
+// iscParse parses tokens into statements until the end of the block at depth,
+// which is zero for the whole file.  rest are the tokens following the block.
+func iscParse(tokens []iscToken, depth int) (stmts []*iscStatement, rest []iscToken, err error) {
+	cur := &iscStatement{}
+	for len(tokens) > 0 {
+		t := tokens[0]
+		tokens = tokens[1:]
+
+		switch {
+		case t.quoted:
+			cur.args = append(cur.args, t.val)
+		case t.val == ";":
+			if len(cur.args) > 0 {
+				stmts = append(stmts, cur)
+				cur = &iscStatement{}
+			}
+		case t.val == "{":
+			cur.block, tokens, err = iscParse(tokens, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			stmts = append(stmts, cur)
+			cur = &iscStatement{}
+		case t.val == "}":
+			if depth == 0 {
+				return nil, nil, errors.Error("unexpected closing brace")
+			} else if len(cur.args) > 0 {
+				return nil, nil, fmt.Errorf("statement %q: no semicolon", cur.args[0])
+			}
+
+			return stmts, tokens, nil
+		default:
+			cur.args = append(cur.args, t.val)
+		}
+	}
+
+	if depth > 0 {
+		return nil, nil, errors.Error("unexpected end of file")
+	} else if len(cur.args) > 0 {
+		return nil, nil, fmt.Errorf("statement %q: no semicolon", cur.args[0])
+	}
+
+	return stmts, nil, nil
+}
+
+// readISCLeases reads the DHCPv4 leases from the dhcpd.leases file and the
+// fixed addresses of the host declarations from the dhcpd.conf file of the ISC
+// DHCP server.  The former are imported as dynamic leases, unless they never
+// end, and the latter as static ones.  Since the dhcpd.leases file is a log,
+// the last lease declaration for an IP address wins, and only the active
+// leases are imported.
+func readISCLeases(r io.Reader) (leases []*Lease, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	tokens, err := iscTokenize(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	stmts, _, err := iscParse(tokens, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	c := &iscCollector{
+		indices: map[netip.Addr]int{},
+	}
+
+	err = c.collect(stmts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range c.leases {
+		if l != nil {
+			leases = append(leases, l)
+		}
+	}
+
+	return leases, nil
+}
+
+// iscCollector collects the leases from the parsed ISC DHCP server files.
+type iscCollector struct {
+	// indices are the indices of the leases within leases by their IP
+	// addresses.
+	indices map[netip.Addr]int
+
+	// leases are the collected leases.  The superseded and inactive ones are
+	// nil.
+	leases []*Lease
+}
+
+// set sets the lease for ip to l, which may be nil.
+func (c *iscCollector) set(ip netip.Addr, l *Lease) {
+	if i, ok := c.indices[ip]; ok {
+		c.leases[i] = nil
+	}
+
+	if l != nil {
+		c.indices[ip] = len(c.leases)
+		c.leases = append(c.leases, l)
+	}
+}
+
+// collect collects the leases from stmts and the blocks within them.
+func (c *iscCollector) collect(stmts []*iscStatement) (err error) {
+	for _, st := range stmts {
+		if st.block == nil {
+			continue
+		}
+
+		switch st.arg(0) {
+		case "lease":
+			err = c.collectLease(st)
+		case "host":
+			err = c.collectHost(st)
+		default:
+			err = c.collect(st.block)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectLease collects the lease from the lease declaration st.
+func (c *iscCollector) collectLease(st *iscStatement) (err error) {
+	defer func() { err = errors.Annotate(err, "lease %s: %w", st.arg(1)) }()
+
+	ip, err := netip.ParseAddr(st.arg(1))
+	if err != nil {
+		return err
+	}
+
+	l := &Lease{
+		IP: ip.Unmap(),
+	}
+
+	active := true
+	for _, s := range st.block {
+		switch s.arg(0) {
+		case "hardware":
+			l.HWAddr, err = parseISCHardware(s)
+		case "client-hostname":
+			l.Hostname = s.arg(1)
+		case "binding":
+			active = s.arg(1) == "state" && s.arg(2) == "active"
+		case "ends":
+			l.Expiry, err = parseISCTime(s.args[1:])
+		default:
+			// Go on.
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.args[0], err)
+		}
+	}
+
+	if !active || l.HWAddr == nil {
+		c.set(l.IP, nil)
+
+		return nil
+	}
+
+	c.set(l.IP, l)
+
+	return nil
+}
+
+// collectHost collects the static lease from the host declaration st, if it
+// has a fixed address.
+func (c *iscCollector) collectHost(st *iscStatement) (err error) {
+	defer func() { err = errors.Annotate(err, "host %s: %w", st.arg(1)) }()
+
+	l := &Lease{
+		Expiry:   time.Unix(leaseExpireStatic, 0),
+		Hostname: st.arg(1),
+	}
+
+	for _, s := range st.block {
+		switch s.arg(0) {
+		case "hardware":
+			l.HWAddr, err = parseISCHardware(s)
+		case "fixed-address":
+			// Only the first one of the comma-separated addresses is used.
+			addr, _, _ := strings.Cut(s.arg(1), ",")
+			l.IP, err = netip.ParseAddr(addr)
+			l.IP = l.IP.Unmap()
+		case "option":
+			if s.arg(1) == "host-name" {
+				l.Hostname = s.arg(2)
+			}
+		default:
+			// Go on.
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.args[0], err)
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.IsValid() {
+		return nil
+	}
+
+	c.set(l.IP, l)
+
+	return nil
+}
+
+// parseISCHardware parses the hardware address from the "hardware ethernet"
+// statement st.
+func parseISCHardware(st *iscStatement) (mac net.HardwareAddr, err error) {
+	if typ := st.arg(1); typ != "ethernet" {
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+
+	return net.ParseMAC(st.arg(2))
+}
+
+// parseISCTime parses the lease time from args, which are either "never",
+// "epoch" followed by the seconds since epoch, or the weekday followed by the
+// date and the time in UTC.
+func parseISCTime(args []string) (t time.Time, err error) {
+	switch {
+	case len(args) == 1 && args[0] == "never":
+		return time.Unix(leaseExpireStatic, 0), nil
+	case len(args) == 2 && args[0] == "epoch":
+		var sec int64
+		sec, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.Unix(sec, 0), nil
+	case len(args) == 3:
+		return time.Parse("2006/01/02 15:04:05", args[1]+" "+args[2])
+	default:
+		return time.Time{}, fmt.Errorf("bad time %q", strings.Join(args, " "))
+	}
+}
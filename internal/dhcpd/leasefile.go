@@ -0,0 +1,255 @@
+package dhcpd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// LeasesFormat is the format of an exported or imported lease database.
+type LeasesFormat string
+
+// LeasesFormat values.
+const (
+	// LeasesFormatJSON is a JSON array of leases in the format of the HTTP
+	// API.
+	LeasesFormatJSON LeasesFormat = "json"
+
+	// LeasesFormatCSV is a CSV table with the header "mac,ip,hostname,expires",
+	// where expires is empty for static leases.
+	LeasesFormatCSV LeasesFormat = "csv"
+
+	// LeasesFormatDnsmasq is the format of the dnsmasq.leases file.  Only
+	// importing is supported.
+	LeasesFormatDnsmasq LeasesFormat = "dnsmasq"
+
+	// LeasesFormatISC is the format of the dhcpd.leases and dhcpd.conf files
+	// of the ISC DHCP server.  Only importing is supported.
+	LeasesFormatISC LeasesFormat = "isc"
+)
+
+// ParseLeasesFormat returns the lease database format named s.  An empty s
+// means [LeasesFormatJSON].
+func ParseLeasesFormat(s string) (f LeasesFormat, err error) {
+	switch f = LeasesFormat(s); f {
+	case "":
+		return LeasesFormatJSON, nil
+	case LeasesFormatJSON, LeasesFormatCSV, LeasesFormatDnsmasq, LeasesFormatISC:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported leases format %q", s)
+	}
+}
+
+// csvHeader is the header of the CSV lease database.
+var csvHeader = []string{"mac", "ip", "hostname", "expires"}
+
+// WriteLeases writes leases to w in format f, which must be either
+// [LeasesFormatJSON] or [LeasesFormatCSV].
+func WriteLeases(w io.Writer, leases []*Lease, f LeasesFormat) (err error) {
+	switch f {
+	case LeasesFormatJSON:
+		return json.NewEncoder(w).Encode(leases)
+	case LeasesFormatCSV:
+		// Go on.
+	default:
+		return fmt.Errorf("exporting leases: unsupported format %q", f)
+	}
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(csvHeader)
+	if err != nil {
+		return fmt.Errorf("writing csv header: %w", err)
+	}
+
+	for _, l := range leases {
+		var expires string
+		if !l.IsStatic() {
+			expires = l.Expiry.Format(time.RFC3339)
+		}
+
+		err = cw.Write([]string{l.HWAddr.String(), l.IP.String(), l.Hostname, expires})
+		if err != nil {
+			return fmt.Errorf("writing csv: %w", err)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReadLeases reads the lease database in format f from r.  The leases without
+// the expiration time are static.
+func ReadLeases(r io.Reader, f LeasesFormat) (leases []*Lease, err error) {
+	switch f {
+	case LeasesFormatJSON:
+		return readJSONLeases(r)
+	case LeasesFormatCSV:
+		return readCSVLeases(r)
+	case LeasesFormatDnsmasq:
+		return readDnsmasqLeases(r)
+	case LeasesFormatISC:
+		return readISCLeases(r)
+	default:
+		return nil, fmt.Errorf("importing leases: unsupported format %q", f)
+	}
+}
+
+// readJSONLeases reads the leases written by [WriteLeases] in the JSON format.
+func readJSONLeases(r io.Reader) (leases []*Lease, err error) {
+	err = json.NewDecoder(r).Decode(&leases)
+	if err != nil {
+		return nil, fmt.Errorf("decoding json: %w", err)
+	}
+
+	for i, l := range leases {
+		if l == nil {
+			return nil, fmt.Errorf("lease at index %d: %w", i, errors.Error("no value"))
+		}
+
+		if l.Expiry.IsZero() {
+			l.Expiry = time.Unix(leaseExpireStatic, 0)
+		}
+	}
+
+	return leases, nil
+}
+
+// readCSVLeases reads the leases written by [WriteLeases] in the CSV format.
+func readCSVLeases(r io.Reader) (leases []*Lease, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+
+	if len(records) > 0 && records[0][0] == csvHeader[0] {
+		records = records[1:]
+	}
+
+	for i, rec := range records {
+		var l *Lease
+		l, err = newImportedLease(rec[0], rec[1], rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("record at index %d: %w", i, err)
+		}
+
+		if rec[3] != "" {
+			l.Expiry, err = time.Parse(time.RFC3339, rec[3])
+			if err != nil {
+				return nil, fmt.Errorf("record at index %d: expires: %w", i, err)
+			}
+		}
+
+		leases = append(leases, l)
+	}
+
+	return leases, nil
+}
+
+// newImportedLease returns a static lease with the hardware address, IP
+// address, and hostname parsed from the strings.
+func newImportedLease(mac, ip, hostname string) (l *Lease, err error) {
+	l = &Lease{
+		Expiry:   time.Unix(leaseExpireStatic, 0),
+		Hostname: hostname,
+	}
+
+	l.HWAddr, err = net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+
+	l.IP, err = netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	l.IP = l.IP.Unmap()
+
+	return l, nil
+}
+
+// readDnsmasqLeases reads the dnsmasq.leases file.  Each DHCPv4 lease there is
+// a line with the expiration time in seconds since epoch, the hardware
+// address, the IP address, the hostname, and the client identifier.  The
+// expiration time of zero means an infinite lease, which is imported as a
+// static one.  The DHCPv6 leases following the "duid" line are skipped.
+func readDnsmasqLeases(r io.Reader) (leases []*Lease, err error) {
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		} else if fields[0] == "duid" {
+			break
+		} else if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 fields, got %d", lineNum, len(fields))
+		}
+
+		hostname := fields[3]
+		if hostname == "*" {
+			hostname = ""
+		}
+
+		var l *Lease
+		l, err = newImportedLease(fields[1], fields[2], hostname)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		var exp int64
+		exp, err = strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expiry: %w", lineNum, err)
+		} else if exp != 0 {
+			l.Expiry = time.Unix(exp, 0)
+		}
+
+		leases = append(leases, l)
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return leases, nil
+}
+
+// ImportLeases adds leases to srv.  The static leases replace the dynamic ones
+// with the same hardware or IP address, and the dynamic ones must not be
+// expired.  skipped are the descriptions of the leases which weren't added.
+func ImportLeases(srv Interface, leases []*Lease) (added int, skipped []string) {
+	skipped = []string{}
+	for _, l := range leases {
+		var err error
+		if l.IsStatic() {
+			err = srv.AddStaticLease(l)
+		} else {
+			err = srv.AddDynamicLease(l)
+		}
+
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s (%s): %s", l.IP, l.HWAddr, err))
+
+			continue
+		}
+
+		added++
+	}
+
+	return added, skipped
+}
@@ -0,0 +1,179 @@
+package dhcpd
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLeases(t *testing.T) {
+	static := time.Unix(leaseExpireStatic, 0)
+	exp := time.Date(2023, 3, 2, 22, 0, 0, 0, time.UTC)
+
+	mac1 := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	mac2 := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}
+	ip1 := netip.MustParseAddr("192.168.1.10")
+	ip2 := netip.MustParseAddr("192.168.1.20")
+
+	testCases := []struct {
+		name       string
+		format     LeasesFormat
+		in         string
+		want       []*Lease
+		wantErrMsg string
+	}{{
+		name:   "dnsmasq",
+		format: LeasesFormatDnsmasq,
+		in: "1677794400 00:11:22:33:44:55 192.168.1.10 host1 01:00:11:22:33:44:55\n" +
+			"0 00:11:22:33:44:66 192.168.1.20 * *\n" +
+			"duid 00:01:00:01:2b:3c:4d:5e:00:11:22:33:44:55\n" +
+			"1677794400 1234 fd00::10 host3 00:01:00:01\n",
+		want: []*Lease{{
+			Expiry:   exp,
+			Hostname: "host1",
+			HWAddr:   mac1,
+			IP:       ip1,
+		}, {
+			Expiry: static,
+			HWAddr: mac2,
+			IP:     ip2,
+		}},
+		wantErrMsg: "",
+	}, {
+		name:       "dnsmasq_bad",
+		format:     LeasesFormatDnsmasq,
+		in:         "1677794400 00:11:22:33:44:55\n",
+		want:       nil,
+		wantErrMsg: "line 1: expected at least 4 fields, got 2",
+	}, {
+		name:   "isc",
+		format: LeasesFormatISC,
+		in: `# The format of this file is documented in the dhcpd.leases(5) manual page.
+authoring-byte-order little-endian;
+
+lease 192.168.1.10 {
+  starts 4 2023/03/02 10:00:00;
+  ends 4 2023/03/02 22:00:00;
+  binding state active;
+  next binding state free;
+  hardware ethernet 00:11:22:33:44:55;
+  client-hostname "host1";
+}
+lease 192.168.1.30 {
+  ends epoch 1677794400; # 2023/03/02 22:00:00
+  binding state active;
+  hardware ethernet 00:11:22:33:44:77;
+}
+lease 192.168.1.30 {
+  binding state free;
+  hardware ethernet 00:11:22:33:44:77;
+}
+subnet 192.168.1.0 netmask 255.255.255.0 {
+  host printer {
+    hardware ethernet 00:11:22:33:44:66;
+    fixed-address 192.168.1.20;
+  }
+}
+`,
+		want: []*Lease{{
+			Expiry:   exp,
+			Hostname: "host1",
+			HWAddr:   mac1,
+			IP:       ip1,
+		}, {
+			Expiry:   static,
+			Hostname: "printer",
+			HWAddr:   mac2,
+			IP:       ip2,
+		}},
+		wantErrMsg: "",
+	}, {
+		name:       "isc_bad",
+		format:     LeasesFormatISC,
+		in:         "lease 192.168.1.10 {\n  ends 4 2023/03/02 22:00:00;\n",
+		want:       nil,
+		wantErrMsg: "parsing: unexpected end of file",
+	}, {
+		name:   "csv",
+		format: LeasesFormatCSV,
+		in: "mac,ip,hostname,expires\n" +
+			"00:11:22:33:44:55,192.168.1.10,host1,2023-03-02T22:00:00Z\n" +
+			"00:11:22:33:44:66,192.168.1.20,,\n",
+		want: []*Lease{{
+			Expiry:   exp,
+			Hostname: "host1",
+			HWAddr:   mac1,
+			IP:       ip1,
+		}, {
+			Expiry: static,
+			HWAddr: mac2,
+			IP:     ip2,
+		}},
+		wantErrMsg: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			leases, err := ReadLeases(strings.NewReader(tc.in), tc.format)
+			if tc.wantErrMsg != "" {
+				require.Error(t, err)
+
+				assert.Equal(t, tc.wantErrMsg, err.Error())
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, leases, len(tc.want))
+
+			for i, l := range leases {
+				w := tc.want[i]
+				assert.True(t, w.Expiry.Equal(l.Expiry), "lease at index %d: %s", i, l.Expiry)
+				assert.Equal(t, w.Hostname, l.Hostname)
+				assert.Equal(t, w.HWAddr, l.HWAddr)
+				assert.Equal(t, w.IP, l.IP)
+			}
+		})
+	}
+}
+
+func TestWriteLeases(t *testing.T) {
+	leases := []*Lease{{
+		Expiry:   time.Date(2023, 3, 2, 22, 0, 0, 0, time.UTC),
+		Hostname: "host1",
+		HWAddr:   net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		IP:       netip.MustParseAddr("192.168.1.10"),
+	}, {
+		Expiry: time.Unix(leaseExpireStatic, 0),
+		HWAddr: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66},
+		IP:     netip.MustParseAddr("192.168.1.20"),
+	}}
+
+	for _, f := range []LeasesFormat{LeasesFormatJSON, LeasesFormatCSV} {
+		t.Run(string(f), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := WriteLeases(buf, leases, f)
+			require.NoError(t, err)
+
+			got, err := ReadLeases(buf, f)
+			require.NoError(t, err)
+			require.Len(t, got, len(leases))
+
+			for i, l := range got {
+				assert.True(t, leases[i].Expiry.Equal(l.Expiry))
+				assert.Equal(t, leases[i].Hostname, l.Hostname)
+				assert.Equal(t, leases[i].HWAddr, l.HWAddr)
+				assert.Equal(t, leases[i].IP, l.IP)
+			}
+		})
+	}
+
+	err := WriteLeases(&bytes.Buffer{}, leases, LeasesFormatISC)
+	assert.Error(t, err)
+}
@@ -0,0 +1,201 @@
+package dhcpd
+
+import (
+	"sync"
+	"time"
+)
+
+// LeaseEvent is an event of a dynamic lease.
+type LeaseEvent uint8
+
+// LeaseEvent values.
+const (
+	// LeaseEventGranted means that a new dynamic lease has been granted to a
+	// client.
+	LeaseEventGranted LeaseEvent = iota + 1
+
+	// LeaseEventRenewed means that a client has renewed its dynamic lease.
+	LeaseEventRenewed
+
+	// LeaseEventReleased means that a client has released its dynamic lease.
+	LeaseEventReleased
+
+	// LeaseEventDeclined means that a client has declined its dynamic lease.
+	LeaseEventDeclined
+
+	// LeaseEventExpired means that a dynamic lease has expired.
+	LeaseEventExpired
+)
+
+// String implements the [fmt.Stringer] interface for LeaseEvent.
+func (e LeaseEvent) String() (s string) {
+	switch e {
+	case LeaseEventGranted:
+		return "granted"
+	case LeaseEventRenewed:
+		return "renewed"
+	case LeaseEventReleased:
+		return "released"
+	case LeaseEventDeclined:
+		return "declined"
+	case LeaseEventExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// OnLeaseEventT is a callback for the events of the dynamic leases.  l is a
+// clone of the lease.
+type OnLeaseEventT func(e LeaseEvent, l *Lease)
+
+// LeaseWatcher detects the events of the dynamic leases of a DHCP server by
+// comparing its leases on every change.  Since the DHCP server doesn't notify
+// about the expired leases, LeaseWatcher checks them when the earliest one
+// expires.
+type LeaseWatcher struct {
+	// srv is the DHCP server to get the leases from.
+	srv Interface
+
+	// onEvent is called for every detected event.
+	onEvent OnLeaseEventT
+
+	// mu protects known and expiry.
+	mu *sync.Mutex
+
+	// known are the known dynamic leases by their keys.  See [leaseKey].
+	known map[string]*Lease
+
+	// expiry checks the leases when the earliest of them expires.
+	expiry *time.Timer
+}
+
+// NewLeaseWatcher returns a new *LeaseWatcher which knows the current leases of
+// srv and calls onEvent for the detected events.  w.OnLeaseChanged must be
+// subscribed to the changes of the leases of srv.
+func NewLeaseWatcher(srv Interface, onEvent OnLeaseEventT) (w *LeaseWatcher) {
+	w = &LeaseWatcher{
+		srv:     srv,
+		onEvent: onEvent,
+		mu:      &sync.Mutex{},
+		known:   map[string]*Lease{},
+	}
+
+	leases := srv.Leases(LeasesDynamic)
+	for _, l := range leases {
+		w.known[leaseKey(l)] = l
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.scheduleExpiry(leases)
+
+	return w
+}
+
+// leaseKey returns the key identifying l.
+func leaseKey(l *Lease) (key string) {
+	return l.HWAddr.String() + "|" + l.IP.String()
+}
+
+// OnLeaseChanged implements the [OnLeaseChangedT] for *LeaseWatcher.
+func (w *LeaseWatcher) OnLeaseChanged(flags int) {
+	switch flags {
+	case LeaseChangedAdded:
+		w.update(0)
+	case LeaseChangedRemovedDynamic:
+		w.update(LeaseEventReleased)
+	case LeaseChangedDeclined:
+		w.update(LeaseEventDeclined)
+	case LeaseChangedRemovedAll:
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		w.known = map[string]*Lease{}
+		w.scheduleExpiry(nil)
+	default:
+		// Go on.
+	}
+}
+
+// Close stops the expiration checks of w.
+func (w *LeaseWatcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.scheduleExpiry(nil)
+}
+
+// update compares the current dynamic leases with the known ones and calls
+// onEvent for the differences.  removed is the event for the leases which have
+// disappeared before their expiration, if any.
+func (w *LeaseWatcher) update(removed LeaseEvent) {
+	type event struct {
+		lease *Lease
+		e     LeaseEvent
+	}
+
+	var events []event
+	leases := w.srv.Leases(LeasesDynamic)
+	now := time.Now()
+
+	func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		known := make(map[string]*Lease, len(leases))
+		for _, l := range leases {
+			key := leaseKey(l)
+			known[key] = l
+
+			prev, ok := w.known[key]
+			if !ok {
+				events = append(events, event{lease: l, e: LeaseEventGranted})
+			} else if l.Expiry.After(prev.Expiry) {
+				events = append(events, event{lease: l, e: LeaseEventRenewed})
+			}
+		}
+
+		for key, l := range w.known {
+			if _, ok := known[key]; ok {
+				continue
+			}
+
+			if !l.Expiry.After(now) {
+				events = append(events, event{lease: l, e: LeaseEventExpired})
+			} else if removed != 0 {
+				events = append(events, event{lease: l, e: removed})
+			}
+		}
+
+		w.known = known
+		w.scheduleExpiry(leases)
+	}()
+
+	for _, ev := range events {
+		w.onEvent(ev.e, ev.lease)
+	}
+}
+
+// scheduleExpiry schedules the check of leases when the earliest of them
+// expires.  w.mu must be locked.
+func (w *LeaseWatcher) scheduleExpiry(leases []*Lease) {
+	if w.expiry != nil {
+		w.expiry.Stop()
+		w.expiry = nil
+	}
+
+	var next time.Time
+	for _, l := range leases {
+		if next.IsZero() || l.Expiry.Before(next) {
+			next = l.Expiry
+		}
+	}
+
+	if next.IsZero() {
+		return
+	}
+
+	w.expiry = time.AfterFunc(time.Until(next), func() { w.update(0) })
+}
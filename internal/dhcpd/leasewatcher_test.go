@@ -0,0 +1,105 @@
+package dhcpd
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// leaseEventRecorder records the lease events.
+type leaseEventRecorder struct {
+	mu     *sync.Mutex
+	events []LeaseEvent
+}
+
+// onEvent implements the [OnLeaseEventT] for *leaseEventRecorder.
+func (r *leaseEventRecorder) onEvent(e LeaseEvent, _ *Lease) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+// take returns the recorded events and forgets them.
+func (r *leaseEventRecorder) take() (events []LeaseEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events, r.events = r.events, nil
+
+	return events
+}
+
+func TestLeaseWatcher(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	newLease := func(b byte, exp time.Time) (l *Lease) {
+		return &Lease{
+			Expiry: exp,
+			HWAddr: net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, b},
+			IP:     netip.AddrFrom4([4]byte{192, 168, 1, b}),
+		}
+	}
+
+	mu := &sync.Mutex{}
+	leases := []*Lease{newLease(1, exp)}
+	setLeases := func(ls ...*Lease) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		leases = ls
+	}
+
+	srv := &MockInterface{
+		OnLeases: func(_ GetLeasesFlags) (ls []*Lease) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			now := time.Now()
+			for _, l := range leases {
+				if l.Expiry.After(now) {
+					ls = append(ls, l.Clone())
+				}
+			}
+
+			return ls
+		},
+	}
+
+	rec := &leaseEventRecorder{mu: &sync.Mutex{}}
+	w := NewLeaseWatcher(srv, rec.onEvent)
+	t.Cleanup(w.Close)
+
+	setLeases(newLease(1, exp), newLease(2, exp))
+	w.OnLeaseChanged(LeaseChangedAdded)
+	assert.Equal(t, []LeaseEvent{LeaseEventGranted}, rec.take())
+
+	setLeases(newLease(1, exp.Add(time.Hour)), newLease(2, exp))
+	w.OnLeaseChanged(LeaseChangedAdded)
+	assert.Equal(t, []LeaseEvent{LeaseEventRenewed}, rec.take())
+
+	setLeases(newLease(2, exp))
+	w.OnLeaseChanged(LeaseChangedRemovedDynamic)
+	assert.Equal(t, []LeaseEvent{LeaseEventReleased}, rec.take())
+
+	setLeases(newLease(3, exp))
+	w.OnLeaseChanged(LeaseChangedDeclined)
+	assert.ElementsMatch(t, []LeaseEvent{LeaseEventGranted, LeaseEventDeclined}, rec.take())
+
+	setLeases(newLease(3, exp), newLease(4, time.Now().Add(100*time.Millisecond)))
+	w.OnLeaseChanged(LeaseChangedAdded)
+	assert.Equal(t, []LeaseEvent{LeaseEventGranted}, rec.take())
+
+	var events []LeaseEvent
+	require.Eventually(t, func() (ok bool) {
+		events = append(events, rec.take()...)
+
+		return len(events) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []LeaseEvent{LeaseEventExpired}, events)
+}
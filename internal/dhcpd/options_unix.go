@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -395,4 +396,136 @@ func (s *v4Server) prepareOptions() {
 	if len(s.explicitOpts) == 0 {
 		s.explicitOpts = nil
 	}
+
+	s.prepareVendorOptions()
+}
+
+// vendorOptions are the parsed options of a [VendorClass].
+type vendorOptions struct {
+	// opts are the options to set.  The nil values mean the options to
+	// remove.
+	opts dhcpv4.Options
+
+	// id is the prefix of the vendor class identifiers.
+	id string
+}
+
+// prepareVendorOptions parses the options of the configured vendor classes.
+func (s *v4Server) prepareVendorOptions() {
+	s.vendorOpts = nil
+	for i, vc := range s.conf.VendorClasses {
+		if vc == nil || vc.ID == "" {
+			log.Error("dhcpv4: vendor class at index %d: empty id", i)
+
+			continue
+		}
+
+		vo := &vendorOptions{
+			opts: dhcpv4.Options{},
+			id:   vc.ID,
+		}
+
+		for j, o := range vc.Options {
+			code, val, err := parseDHCPOption(o)
+			if err != nil {
+				log.Error("dhcpv4: vendor class %q: bad option string at index %d: %s", vc.ID, j, err)
+
+				continue
+			}
+
+			vo.opts.Update(dhcpv4.Option{Code: code, Value: val})
+		}
+
+		log.Debug("dhcpv4: vendor class %q options:\n%s", vc.ID, vo.opts.Summary(nil))
+
+		s.vendorOpts = append(s.vendorOpts, vo)
+	}
+}
+
+// updateVendorOptions sets the options of the first vendor class matching the
+// vendor class identifier of req in resp.
+func (s *v4Server) updateVendorOptions(req, resp *dhcpv4.DHCPv4) {
+	id := req.ClassIdentifier()
+	if id == "" {
+		return
+	}
+
+	for _, vo := range s.vendorOpts {
+		if !strings.HasPrefix(id, vo.id) {
+			continue
+		}
+
+		for code, val := range vo.opts {
+			if val != nil {
+				resp.Options[code] = val
+			} else {
+				delete(resp.Options, code)
+			}
+		}
+
+		return
+	}
+}
+
+// Limits of the boot parameters of the static leases, which are the sizes of
+// the corresponding fields of the DHCPv4 message, see RFC 2131.
+const (
+	maxBootFileLen   = 128
+	maxTFTPServerLen = 64
+)
+
+// validateLeaseOptions returns an error if the boot parameters or the options
+// of the static lease l aren't valid.
+func validateLeaseOptions(l *Lease) (err error) {
+	if len(l.BootFile) > maxBootFileLen {
+		return fmt.Errorf("boot file: too long, max %d", maxBootFileLen)
+	} else if len(l.TFTPServer) > maxTFTPServerLen {
+		return fmt.Errorf("tftp server: too long, max %d", maxTFTPServerLen)
+	}
+
+	for i, o := range l.Options {
+		_, _, err = parseDHCPOption(o)
+		if err != nil {
+			return fmt.Errorf("option at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// updateLeaseOptions sets the boot parameters and the options of the static
+// lease l in resp.  Those override the options from the configuration.
+func updateLeaseOptions(l *Lease, resp *dhcpv4.DHCPv4) {
+	if !l.IsStatic() {
+		return
+	}
+
+	if bootFile := l.BootFile; bootFile != "" {
+		resp.BootFileName = bootFile
+		resp.UpdateOption(dhcpv4.OptBootFileName(bootFile))
+	}
+
+	if srv := l.TFTPServer; srv != "" {
+		resp.UpdateOption(dhcpv4.OptTFTPServerName(srv))
+
+		// PXE clients use the next server address from the message header.
+		if ip, err := netip.ParseAddr(srv); err == nil && ip.Is4() {
+			resp.ServerIPAddr = ip.AsSlice()
+		}
+	}
+
+	for i, o := range l.Options {
+		code, val, err := parseDHCPOption(o)
+		if err != nil {
+			log.Debug("dhcpv4: lease %s: bad option string at index %d: %s", l.HWAddr, i, err)
+
+			continue
+		}
+
+		if data := val.ToBytes(); data != nil {
+			resp.Options[code.Code()] = data
+		} else {
+			delete(resp.Options, code.Code())
+		}
+	}
 }
@@ -18,6 +18,7 @@ func (winServer) ResetLeases(_ []*Lease) (err error)              { return nil }
 func (winServer) GetLeases(_ GetLeasesFlags) (leases []*Lease)    { return nil }
 func (winServer) getLeasesRef() []*Lease                          { return nil }
 func (winServer) AddStaticLease(_ *Lease) (err error)             { return nil }
+func (winServer) AddDynamicLease(_ *Lease) (err error)            { return nil }
 func (winServer) RemoveStaticLease(_ *Lease) (err error)          { return nil }
 func (winServer) FindMACbyIP(_ netip.Addr) (mac net.HardwareAddr) { return nil }
 func (winServer) WriteDiskConfig4(_ *V4ServerConf)                {}
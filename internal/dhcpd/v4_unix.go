@@ -40,6 +40,11 @@ type v4Server struct {
 	// have intersections with [implicitOpts].
 	explicitOpts dhcpv4.Options
 
+	// vendorOpts are the options parsed from the vendor classes of the
+	// configuration.  The first one matching the client's vendor class
+	// identifier is used.
+	vendorOpts []*vendorOptions
+
 	// leasesLock protects leases, leaseHosts, and leasedOffsets.
 	leasesLock sync.Mutex
 
@@ -341,6 +346,63 @@ func (s *v4Server) rmLease(lease *Lease) (err error) {
 // server to be configured and it's not.
 const ErrUnconfigured errors.Error = "server is unconfigured"
 
+// AddDynamicLease implements the [DHCPServer] interface for *v4Server.  It's
+// used to import the leases of other DHCP servers, so l must be within the
+// range of the dynamic leases and not expired.  It is safe for concurrent use.
+func (s *v4Server) AddDynamicLease(l *Lease) (err error) {
+	defer func() { err = errors.Annotate(err, "dhcpv4: adding dynamic lease: %w") }()
+
+	if s.conf == nil {
+		return ErrUnconfigured
+	}
+
+	l.IP = l.IP.Unmap()
+
+	if !l.IP.Is4() {
+		return fmt.Errorf("invalid ip %q, only ipv4 is supported", l.IP)
+	} else if gwIP := s.conf.GatewayIP; gwIP == l.IP {
+		return fmt.Errorf("can't assign the gateway IP %s to the lease", gwIP)
+	} else if l.IsStatic() || !l.Expiry.After(time.Now()) {
+		return errors.Error("lease expired")
+	} else if !s.conf.ipRange.contains(net.IP(l.IP.AsSlice())) {
+		return fmt.Errorf("lease %s (%s) out of range, not adding", l.IP, l.HWAddr)
+	}
+
+	err = netutil.ValidateMAC(l.HWAddr)
+	if err != nil {
+		return err
+	}
+
+	// Perform the following actions in an anonymous function to make sure
+	// that the lock gets unlocked before the notification step.
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		err = s.rmDynamicLease(l)
+		if err != nil {
+			return
+		}
+
+		// Unlike the static leases, the dynamic ones lose the duplicated
+		// hostnames instead of being rejected.
+		l.Hostname = s.validHostnameForClient(l.Hostname, l.IP)
+		if s.leaseHosts.Has(l.Hostname) {
+			l.Hostname = ""
+		}
+
+		err = s.addLease(l)
+	}()
+	if err != nil {
+		return err
+	}
+
+	s.conf.notify(LeaseChangedDBStore)
+	s.conf.notify(LeaseChangedAdded)
+
+	return nil
+}
+
 // AddStaticLease implements the DHCPServer interface for *v4Server.  It is safe
 // for concurrent use.
 func (s *v4Server) AddStaticLease(l *Lease) (err error) {
@@ -385,6 +447,16 @@ func (s *v4Server) AddStaticLease(l *Lease) (err error) {
 		l.Hostname = hostname
 	}
 
+	err = validateLeaseOptions(l)
+	if err != nil {
+		return err
+	}
+
+	err = validateLeaseMetadata(l.Metadata)
+	if err != nil {
+		return err
+	}
+
 	// Perform the following actions in an anonymous function to make sure
 	// that the lock gets unlocked before the notification step.
 	func() {
@@ -452,12 +524,18 @@ func (s *v4Server) RemoveStaticLease(l *Lease) (err error) {
 	return s.rmLease(l)
 }
 
-// addrAvailable sends an ICP request to the specified IP address.  It returns
-// true if the remote host doesn't reply, which probably means that the IP
-// address is available.
+// addrAvailable sends an ARP probe and an ICMP request to the specified IP
+// address, if enabled.  It returns true if the remote host doesn't reply, which
+// probably means that the IP address is available.
 //
 // TODO(a.garipov): I'm not sure that this is the best way to do this.
 func (s *v4Server) addrAvailable(target net.IP) (avail bool) {
+	if s.conf.ARPTimeout != 0 && !s.arpAvailable(target) {
+		log.Info("dhcpv4: ip conflict: %s is already used by another device", target)
+
+		return false
+	}
+
 	if s.conf.ICMPTimeout == 0 {
 		return true
 	}
@@ -497,6 +575,34 @@ func (s *v4Server) addrAvailable(target net.IP) (avail bool) {
 	return true
 }
 
+// arpAvailable sends an ARP probe for the specified IP address.  It returns
+// true if no other device replies or if the probe fails.
+func (s *v4Server) arpAvailable(target net.IP) (avail bool) {
+	ip, ok := netip.AddrFromSlice(target)
+	if !ok {
+		return true
+	}
+
+	iface, err := net.InterfaceByName(s.conf.InterfaceName)
+	if err != nil {
+		log.Error("dhcpv4: arp probe: %s", err)
+
+		return true
+	}
+
+	log.Debug("dhcpv4: sending arp probe for %s", target)
+
+	timeout := time.Duration(s.conf.ARPTimeout) * time.Millisecond
+	conflict, err := arpProbe(iface, ip.Unmap(), timeout)
+	if err != nil {
+		log.Error("dhcpv4: arp probe: %s", err)
+
+		return true
+	}
+
+	return !conflict
+}
+
 // findLease finds a lease by its MAC-address.
 func (s *v4Server) findLease(mac net.HardwareAddr) (l *Lease) {
 	for _, l = range s.leases {
@@ -883,6 +989,7 @@ func (s *v4Server) handleRequest(req, resp *dhcpv4.DHCPv4) (lease *Lease, needsR
 // handleDecline is the handler for the DHCP Decline request.
 func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 	s.conf.notify(LeaseChangedDBStore)
+	defer s.conf.notify(LeaseChangedDeclined)
 
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
@@ -957,8 +1064,7 @@ func (s *v4Server) handleRelease(req, resp *dhcpv4.DHCPv4) (err error) {
 		reqIP = req.ClientIPAddr
 	}
 
-	// TODO(a.garipov): Add a separate notification type for dynamic lease
-	// removal?
+	defer s.conf.notify(LeaseChangedRemovedDynamic)
 	defer s.conf.notify(LeaseChangedDBStore)
 
 	n := 0
@@ -1050,6 +1156,10 @@ func (s *v4Server) handle(req, resp *dhcpv4.DHCPv4) int {
 	}
 
 	s.updateOptions(req, resp)
+	s.updateVendorOptions(req, resp)
+	if l != nil {
+		updateLeaseOptions(l, resp)
+	}
 
 	return 1
 }
@@ -1011,3 +1011,204 @@ func TestV4Server_handleRelease(t *testing.T) {
 
 	require.Equal(t, wantResp, resp)
 }
+
+func TestV4Server_handle_leaseOptions(t *testing.T) {
+	s, ok := defaultSrv(t).(*v4Server)
+	require.True(t, ok)
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	l := &Lease{
+		HWAddr:     mac,
+		IP:         netip.MustParseAddr("192.168.10.150"),
+		BootFile:   "pxelinux.0",
+		TFTPServer: "192.168.10.3",
+		Options: []string{
+			"252 text http://192.168.10.1/wpad.dat",
+			"3 del",
+		},
+		Metadata: map[string]string{
+			"location": "rack 1",
+		},
+	}
+
+	err := s.AddStaticLease(l)
+	require.NoError(t, err)
+
+	req, err := dhcpv4.NewDiscovery(mac)
+	require.NoError(t, err)
+
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, s.handle(req, resp))
+
+	assert.Equal(t, "pxelinux.0", resp.BootFileName)
+	assert.Equal(t, "pxelinux.0", resp.BootFileNameOption())
+	assert.Equal(t, "192.168.10.3", resp.TFTPServerName())
+	assert.True(t, resp.ServerIPAddr.Equal(net.IP{192, 168, 10, 3}))
+	assert.Equal(t, []byte("http://192.168.10.1/wpad.dat"), resp.Options.Get(dhcpv4.GenericOptionCode(252)))
+	assert.False(t, resp.Options.Has(dhcpv4.OptionRouter))
+
+	ls := s.GetLeases(LeasesStatic)
+	require.Len(t, ls, 1)
+
+	assert.Equal(t, l.Metadata, ls[0].Metadata)
+}
+
+func TestV4Server_handle_vendorOptions(t *testing.T) {
+	s, ok := defaultSrv(t).(*v4Server)
+	require.True(t, ok)
+
+	s.conf.VendorClasses = []*VendorClass{{
+		ID:      "Cisco Systems, Inc. IP Phone",
+		Options: []string{"150 ip 192.168.10.3", "3 del"},
+	}, {
+		ID:      "Cisco",
+		Options: []string{"66 text tftp.example.org"},
+	}}
+	s.prepareOptions()
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+
+	testCases := []struct {
+		name     string
+		vendorID string
+		want150  []byte
+		want66   []byte
+		wantGW   bool
+	}{{
+		name:     "phone",
+		vendorID: "Cisco Systems, Inc. IP Phone CP-7940",
+		want150:  []byte{192, 168, 10, 3},
+		want66:   nil,
+		wantGW:   false,
+	}, {
+		name:     "other_cisco",
+		vendorID: "Cisco AP c2700",
+		want150:  nil,
+		want66:   []byte("tftp.example.org"),
+		wantGW:   true,
+	}, {
+		name:     "other",
+		vendorID: "MSFT 5.0",
+		want150:  nil,
+		want66:   nil,
+		wantGW:   true,
+	}, {
+		name:     "none",
+		vendorID: "",
+		want150:  nil,
+		want66:   nil,
+		wantGW:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mods []dhcpv4.Modifier
+			if tc.vendorID != "" {
+				mods = append(mods, dhcpv4.WithOption(dhcpv4.OptClassIdentifier(tc.vendorID)))
+			}
+
+			req, err := dhcpv4.NewDiscovery(mac, mods...)
+			require.NoError(t, err)
+
+			resp, err := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, err)
+
+			require.Equal(t, 1, s.handle(req, resp))
+
+			assert.Equal(t, tc.want150, resp.Options.Get(dhcpv4.GenericOptionCode(150)))
+			assert.Equal(t, tc.want66, resp.Options.Get(dhcpv4.OptionTFTPServerName))
+			assert.Equal(t, tc.wantGW, resp.Options.Has(dhcpv4.OptionRouter))
+		})
+	}
+}
+
+func TestV4Server_AddStaticLease_leaseOptions(t *testing.T) {
+	s := defaultSrv(t)
+
+	testCases := []struct {
+		lease      *Lease
+		name       string
+		wantErrMsg string
+	}{{
+		lease: &Lease{
+			BootFile: strings.Repeat("a", maxBootFileLen+1),
+		},
+		name:       "long_boot_file",
+		wantErrMsg: "dhcpv4: adding static lease: boot file: too long, max 128",
+	}, {
+		lease: &Lease{
+			Options: []string{"bad"},
+		},
+		name: "bad_option",
+		wantErrMsg: `dhcpv4: adding static lease: option at index 0: ` +
+			`invalid option string "bad": bad option format`,
+	}, {
+		lease: &Lease{
+			Metadata: map[string]string{"": "value"},
+		},
+		name:       "empty_metadata_key",
+		wantErrMsg: "dhcpv4: adding static lease: metadata: empty key",
+	}}
+
+	for i, tc := range testCases {
+		tc.lease.HWAddr = net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, byte(i)}
+		tc.lease.IP = netip.MustParseAddr("192.168.10.150")
+
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, s.AddStaticLease(tc.lease))
+		})
+	}
+}
+
+func TestV4Server_AddDynamicLease(t *testing.T) {
+	s := defaultSrv(t)
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	testCases := []struct {
+		lease      *Lease
+		name       string
+		wantErrMsg string
+	}{{
+		lease: &Lease{
+			Expiry:   exp,
+			Hostname: "host",
+			HWAddr:   mac,
+			IP:       netip.MustParseAddr("192.168.10.150"),
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		lease: &Lease{
+			Expiry: time.Now().Add(-time.Hour),
+			HWAddr: mac,
+			IP:     netip.MustParseAddr("192.168.10.151"),
+		},
+		name:       "expired",
+		wantErrMsg: "dhcpv4: adding dynamic lease: lease expired",
+	}, {
+		lease: &Lease{
+			Expiry: exp,
+			HWAddr: mac,
+			IP:     netip.MustParseAddr("192.168.10.50"),
+		},
+		name: "out_of_range",
+		wantErrMsg: "dhcpv4: adding dynamic lease: " +
+			"lease 192.168.10.50 (aa:aa:aa:aa:aa:aa) out of range, not adding",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, s.AddDynamicLease(tc.lease))
+		})
+	}
+
+	leases := s.GetLeases(LeasesDynamic)
+	require.Len(t, leases, 1)
+
+	assert.Equal(t, "host", leases[0].Hostname)
+	assert.Equal(t, exp, leases[0].Expiry)
+}
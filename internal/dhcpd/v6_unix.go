@@ -187,6 +187,15 @@ func (s *v6Server) AddStaticLease(l *Lease) (err error) {
 		return fmt.Errorf("validating lease: %w", err)
 	}
 
+	if l.BootFile != "" || l.TFTPServer != "" || len(l.Options) > 0 {
+		return errors.Error("boot file, tftp server, and options are only supported for dhcpv4")
+	}
+
+	err = validateLeaseMetadata(l.Metadata)
+	if err != nil {
+		return fmt.Errorf("validating lease: %w", err)
+	}
+
 	l.Expiry = time.Unix(leaseExpireStatic, 0)
 
 	s.leasesLock.Lock()
@@ -206,6 +215,12 @@ func (s *v6Server) AddStaticLease(l *Lease) (err error) {
 	return nil
 }
 
+// AddDynamicLease implements the [DHCPServer] interface for *v6Server.  It
+// always returns an error, since importing DHCPv6 leases isn't supported.
+func (s *v6Server) AddDynamicLease(_ *Lease) (err error) {
+	return errors.Error("dhcpv6: importing dynamic leases is not supported")
+}
+
 // RemoveStaticLease removes a static lease.  It is safe for concurrent use.
 func (s *v6Server) RemoveStaticLease(l *Lease) (err error) {
 	defer func() { err = errors.Annotate(err, "dhcpv6: %w") }()
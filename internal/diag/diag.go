@@ -0,0 +1,191 @@
+// Package diag contains the diagnostic bundles, which are archives with the
+// information about a running AdGuard Home instance that users attach to their
+// bug reports.  The bundles contain no client data.
+package diag
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Bundle file names.
+const (
+	// ReportName is the name of the report file within a bundle.
+	ReportName = "report.json"
+
+	// ConfigName is the name of the redacted configuration file within a
+	// bundle.
+	ConfigName = "AdGuardHome.yaml"
+
+	// ErrorsName is the name of the file with the recent errors within a
+	// bundle.
+	ErrorsName = "errors.log"
+)
+
+// started is the approximate time when the process has started.
+var started = time.Now()
+
+// Report contains the version information and the performance counters of
+// AdGuard Home.
+type Report struct {
+	// Created is the time when the report was created.
+	Created time.Time `json:"created"`
+
+	// Counters are the cumulative counters of the DNS server.  It's nil if the
+	// DNS server isn't running.
+	Counters *Counters `json:"counters,omitempty"`
+
+	// Version is the version of AdGuard Home.
+	Version string `json:"version"`
+
+	// Channel is the release channel of AdGuard Home.
+	Channel string `json:"channel"`
+
+	// GoVersion is the version of Go used to build AdGuard Home.
+	GoVersion string `json:"go_version"`
+
+	// GOOS is the operating system AdGuard Home runs on.
+	GOOS string `json:"goos"`
+
+	// GOARCH is the architecture AdGuard Home runs on.
+	GOARCH string `json:"goarch"`
+
+	// Uptime is the number of seconds since AdGuard Home has started.
+	Uptime float64 `json:"uptime"`
+
+	// Goroutines is the number of the running goroutines.
+	Goroutines int `json:"goroutines"`
+
+	// HeapAlloc is the number of bytes of the allocated heap objects.
+	HeapAlloc uint64 `json:"heap_alloc"`
+
+	// Sys is the total number of bytes obtained from the OS.
+	Sys uint64 `json:"sys"`
+
+	// NumGC is the number of the completed GC cycles.
+	NumGC uint32 `json:"num_gc"`
+}
+
+// Counters are the cumulative counters of the DNS server.
+type Counters struct {
+	// Upstreams are the counters of the upstream servers.
+	Upstreams []*UpstreamCounters `json:"upstreams"`
+
+	// Queries is the number of the processed requests.
+	Queries uint64 `json:"queries"`
+
+	// Blocked is the number of the filtered requests.
+	Blocked uint64 `json:"blocked"`
+
+	// CacheHits is the number of the requests answered from the cache.
+	CacheHits uint64 `json:"cache_hits"`
+
+	// UpstreamQueries is the number of the requests resolved by the upstream
+	// servers.
+	UpstreamQueries uint64 `json:"upstream_queries"`
+}
+
+// UpstreamCounters are the cumulative counters of a single upstream server.
+type UpstreamCounters struct {
+	// Address is the address of the upstream server.
+	Address string `json:"address"`
+
+	// Queries is the number of the requests resolved by the upstream server.
+	Queries uint64 `json:"queries"`
+
+	// AvgTime is the average processing time of those requests in
+	// milliseconds.
+	AvgTime float64 `json:"avg_time"`
+}
+
+// NewReport returns a new report with the current version information and
+// runtime statistics.  now is the time of the creation.
+func NewReport(now time.Time) (r *Report) {
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+
+	return &Report{
+		Created:    now.UTC(),
+		Version:    version.Version(),
+		Channel:    version.Channel(),
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		Uptime:     now.Sub(started).Seconds(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  ms.HeapAlloc,
+		Sys:        ms.Sys,
+		NumGC:      ms.NumGC,
+	}
+}
+
+// Bundle is a diagnostic bundle.
+type Bundle struct {
+	// Report is the report with the version information and the counters.  It
+	// must not be nil.
+	Report *Report
+
+	// Config is the redacted configuration file.
+	Config []byte
+
+	// Errors are the recent warning and error records.  The IP addresses and
+	// the domain names are removed from their messages when writing.
+	Errors []*Record
+}
+
+// Write writes b as a ZIP archive into w.
+func (b *Bundle) Write(w io.Writer) (err error) {
+	report, err := json.MarshalIndent(b.Report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding report: %w", err)
+	}
+
+	errs := &strings.Builder{}
+	for _, r := range b.Errors {
+		scrubbed := *r
+		scrubbed.Message = scrubMessage(r.Message)
+		_, _ = fmt.Fprintln(errs, &scrubbed)
+	}
+
+	zw := zip.NewWriter(w)
+	defer func() { err = errors.WithDeferred(err, zw.Close()) }()
+
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{
+		name: ReportName,
+		data: report,
+	}, {
+		name: ConfigName,
+		data: b.Config,
+	}, {
+		name: ErrorsName,
+		data: []byte(errs.String()),
+	}} {
+		var fw io.Writer
+		fw, err = zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: b.Report.Created,
+		})
+		if err != nil {
+			return fmt.Errorf("creating %q in archive: %w", f.name, err)
+		}
+
+		_, err = fw.Write(f.data)
+		if err != nil {
+			return fmt.Errorf("writing %q to archive: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package diag_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/diag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle_Write(t *testing.T) {
+	const conf = "dns:\n  port: 53\n"
+
+	b := &diag.Bundle{
+		Report: diag.NewReport(time.Now()),
+		Config: []byte(conf),
+		Errors: []*diag.Record{{
+			FirstSeen: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+			LastSeen:  time.Date(2023, 3, 1, 13, 0, 0, 0, time.UTC),
+			Level:     diag.LevelError,
+			Subsystem: "filtering",
+			Message:   "updating filter 1 from lists.example: timeout",
+			Count:     3,
+		}},
+	}
+
+	buf := &bytes.Buffer{}
+	err := b.Write(buf)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		var rc io.ReadCloser
+		rc, err = f.Open()
+		require.NoError(t, err)
+
+		files[f.Name], err = io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	require.Len(t, files, 3)
+
+	assert.Equal(t, conf, string(files[diag.ConfigName]))
+	assert.Equal(t, "2023-03-01T13:00:00Z [error] filtering: updating filter 1 from <domain>: timeout "+
+		"(3 times since 2023-03-01T12:00:00Z)\n", string(files[diag.ErrorsName]))
+
+	report := &diag.Report{}
+	err = json.Unmarshal(files[diag.ReportName], report)
+	require.NoError(t, err)
+
+	assert.Equal(t, b.Report.Version, report.Version)
+	assert.Positive(t, report.Goroutines)
+	assert.Nil(t, report.Counters)
+}
@@ -0,0 +1,238 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
+)
+
+// Error Log
+
+// Levels of the records.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// OtherSubsystem is the subsystem of the records, the messages of which don't
+// start with the name of a subsystem, as well as of the ones from the
+// subsystems above the limit.
+const OtherSubsystem = "other"
+
+// maxSubsystems is the maximum number of the subsystems the records are kept
+// for separately.
+const maxSubsystems = 64
+
+// maskedAddr is the replacement of the IP addresses within the error messages.
+const maskedAddr = "<ip>"
+
+// warningPrefix is the prefix of the warning messages, which are logged with
+// the info level.
+const warningPrefix = "warning: "
+
+// Record is a warning or an error message logged by a subsystem.
+type Record struct {
+	// FirstSeen is the time when the message has been logged for the first
+	// time.
+	FirstSeen time.Time `json:"first_seen"`
+
+	// LastSeen is the time when the message has been logged for the last
+	// time.
+	LastSeen time.Time `json:"last_seen"`
+
+	// Level is either [LevelError] or [LevelWarning].
+	Level string `json:"level"`
+
+	// Subsystem is the name of the subsystem that has logged the message or
+	// [OtherSubsystem].
+	Subsystem string `json:"subsystem"`
+
+	// Message is the message with the IP addresses masked and without the
+	// subsystem prefix.
+	Message string `json:"message"`
+
+	// Count is the number of times the message has been logged.
+	Count uint64 `json:"count"`
+}
+
+// String implements the [fmt.Stringer] interface for *Record.
+func (r *Record) String() (s string) {
+	return fmt.Sprintf(
+		"%s [%s] %s: %s (%d times since %s)",
+		r.LastSeen.UTC().Format(time.RFC3339),
+		r.Level,
+		r.Subsystem,
+		r.Message,
+		r.Count,
+		r.FirstSeen.UTC().Format(time.RFC3339),
+	)
+}
+
+// ErrorLog is an [io.Writer] that passes the log output to the underlying
+// writer and keeps the latest warning and error messages of each subsystem.
+// The repeated messages are counted instead.  It's safe for concurrent use.
+type ErrorLog struct {
+	// w is the underlying writer.
+	w io.Writer
+
+	// mu protects subsystems.
+	mu *sync.Mutex
+
+	// subsystems are the kept records by the subsystem names, oldest first.
+	subsystems map[string][]*Record
+
+	// size is the maximum number of records kept for a subsystem.
+	size int
+}
+
+// NewErrorLog returns a new *ErrorLog that writes to w and keeps at most size
+// latest distinct messages of each subsystem.  size must be positive.
+func NewErrorLog(w io.Writer, size int) (l *ErrorLog) {
+	return &ErrorLog{
+		w:          w,
+		mu:         &sync.Mutex{},
+		subsystems: map[string][]*Record{},
+		size:       size,
+	}
+}
+
+// type check
+var _ io.Writer = (*ErrorLog)(nil)
+
+// Write implements the [io.Writer] interface for *ErrorLog.
+func (l *ErrorLog) Write(p []byte) (n int, err error) {
+	rec, ok := parseRecord(strings.TrimRight(string(p), "\r\n"))
+	if ok {
+		l.add(rec, time.Now())
+	}
+
+	return l.w.Write(p)
+}
+
+// add adds rec logged at now to the kept records or increments the count of
+// the same kept record.
+func (l *ErrorLog) add(rec *Record, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recs, ok := l.subsystems[rec.Subsystem]
+	if !ok && rec.Subsystem != OtherSubsystem && len(l.subsystems) >= maxSubsystems {
+		rec.Message = rec.Subsystem + ": " + rec.Message
+		rec.Subsystem = OtherSubsystem
+		recs = l.subsystems[OtherSubsystem]
+	}
+
+	for _, r := range recs {
+		if r.Level == rec.Level && r.Message == rec.Message {
+			r.Count++
+			r.LastSeen = now
+
+			return
+		}
+	}
+
+	if len(recs) >= l.size {
+		recs = append(recs[:0], recs[len(recs)-l.size+1:]...)
+	}
+
+	rec.FirstSeen, rec.LastSeen, rec.Count = now, now, 1
+	l.subsystems[rec.Subsystem] = append(recs, rec)
+}
+
+// Records returns the copies of the kept records of the subsystem, or of all
+// subsystems if subsystem is empty, the most recently seen first.
+func (l *ErrorLog) Records(subsystem string) (recs []*Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for sub, subRecs := range l.subsystems {
+		if subsystem != "" && sub != subsystem {
+			continue
+		}
+
+		for _, r := range subRecs {
+			rCopy := *r
+			recs = append(recs, &rCopy)
+		}
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].LastSeen.After(recs[j].LastSeen)
+	})
+
+	return recs
+}
+
+// parseRecord parses a log line into a record.  ok is false if line isn't a
+// warning or an error message.  The time fields and the count of rec aren't
+// set.
+func parseRecord(line string) (rec *Record, ok bool) {
+	e := aghlog.ParseEntry(line)
+	switch {
+	case e.Level == aghlog.LevelError:
+		// Go on.
+	case e.Level == aghlog.LevelInfo && e.Module == "warning":
+		// The prefix of the warnings without a module is parsed as one.
+		e.Module, e.Message = aghlog.SplitModule(e.Message)
+	case e.Level == aghlog.LevelInfo && strings.HasPrefix(e.Message, warningPrefix):
+		e.Message = e.Message[len(warningPrefix):]
+	default:
+		return nil, false
+	}
+
+	rec = &Record{
+		Level:     LevelWarning,
+		Subsystem: aghalg.Coalesce(e.Module, OtherSubsystem),
+		Message:   maskAddrs(e.Message),
+	}
+
+	if e.Level == aghlog.LevelError {
+		rec.Level = LevelError
+	}
+
+	return rec, true
+}
+
+// maskAddrs replaces the IP addresses and the IP address and port pairs within
+// msg with maskedAddr.
+func maskAddrs(msg string) (masked string) {
+	for _, f := range strings.Fields(msg) {
+		f = strings.Trim(f, `"'(),;`)
+		for _, addr := range []string{
+			f,
+			strings.TrimSuffix(f, ":"),
+			strings.Trim(f, "[]"),
+			strings.Trim(strings.TrimSuffix(f, ":"), "[]"),
+		} {
+			if isAddr(addr) {
+				msg = strings.Replace(msg, addr, maskedAddr, 1)
+
+				break
+			}
+		}
+	}
+
+	return msg
+}
+
+// isAddr returns true if s is an IP address or an IP address and port pair.
+func isAddr(s string) (ok bool) {
+	if s == "" {
+		return false
+	}
+
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+
+	_, err := netip.ParseAddrPort(s)
+
+	return err == nil
+}
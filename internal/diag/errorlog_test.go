@@ -0,0 +1,170 @@
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewErrorLog(buf, 2)
+
+	assert.Empty(t, l.Records(""))
+
+	for i := 0; i < 3; i++ {
+		_, err := fmt.Fprintf(l, "[error] filtering: updating filter %d: timeout\n", i)
+		require.NoError(t, err)
+
+		_, err = fmt.Fprint(l, "[info] querylog: rotating\n")
+		require.NoError(t, err)
+
+		_, err = fmt.Fprint(l, "[info] dnsforward: warning: no upstreams\n")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 9, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	recs := l.Records("filtering")
+	require.Len(t, recs, 2)
+
+	assert.Equal(t, "updating filter 2: timeout", recs[0].Message)
+	assert.Equal(t, "updating filter 1: timeout", recs[1].Message)
+
+	recs = l.Records("dnsforward")
+	require.Len(t, recs, 1)
+
+	assert.Equal(t, LevelWarning, recs[0].Level)
+	assert.Equal(t, "no upstreams", recs[0].Message)
+	assert.Equal(t, uint64(3), recs[0].Count)
+
+	assert.Len(t, l.Records(""), 3)
+	assert.Empty(t, l.Records("querylog"))
+}
+
+func TestParseRecord(t *testing.T) {
+	testCases := []struct {
+		want *Record
+		name string
+		line string
+	}{{
+		want: nil,
+		name: "info",
+		line: "2023/03/01 12:00:00.000000 [info] querylog: rotating",
+	}, {
+		want: &Record{
+			Level:     LevelError,
+			Subsystem: "filtering",
+			Message:   "updating filter 1: timeout",
+		},
+		name: "error",
+		line: "2023/03/01 12:00:00.000000 [error] filtering: updating filter 1: timeout",
+	}, {
+		want: &Record{
+			Level:     LevelError,
+			Subsystem: OtherSubsystem,
+			Message:   "Couldn't load filter 1: <ip>",
+		},
+		name: "error_no_subsystem",
+		line: "2023/03/01 12:00:00.000000 1#2 [error] Couldn't load filter 1: 1.2.3.4",
+	}, {
+		want: &Record{
+			Level:     LevelWarning,
+			Subsystem: "ipset",
+			Message:   "cannot initialize",
+		},
+		name: "warning",
+		line: "2023/03/01 12:00:00.000000 [info] ipset: warning: cannot initialize",
+	}, {
+		want: &Record{
+			Level:     LevelWarning,
+			Subsystem: OtherSubsystem,
+			Message:   "using local frontend files",
+		},
+		name: "warning_no_subsystem",
+		line: "2023/03/01 12:00:00.000000 [info] warning: using local frontend files",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, ok := parseRecord(tc.line)
+			assert.Equal(t, tc.want != nil, ok)
+			assert.Equal(t, tc.want, rec)
+		})
+	}
+}
+
+func TestMaskAddrs(t *testing.T) {
+	testCases := []struct {
+		name string
+		msg  string
+		want string
+	}{{
+		name: "no_addrs",
+		msg:  "[error] 12:34:56 something failed",
+		want: "[error] 12:34:56 something failed",
+	}, {
+		name: "ipv4",
+		msg:  "[error] client 192.168.1.2: bad request",
+		want: "[error] client <ip>: bad request",
+	}, {
+		name: "ipv4_port",
+		msg:  `[error] dialing "192.168.1.2:53"`,
+		want: `[error] dialing "<ip>"`,
+	}, {
+		name: "ipv6_port",
+		msg:  "[error] read udp [2001:db8::1]:53: timeout",
+		want: "[error] read udp <ip>: timeout",
+	}, {
+		name: "ipv6",
+		msg:  "[error] client 2001:db8::1 (bad)",
+		want: "[error] client <ip> (bad)",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, maskAddrs(tc.msg))
+		})
+	}
+}
+
+func TestScrubMessage(t *testing.T) {
+	testCases := []struct {
+		name string
+		msg  string
+		want string
+	}{{
+		name: "nothing",
+		msg:  "updating filter 1: timeout after 1.5s in v0.107.27",
+		want: "updating filter 1: timeout after 1.5s in v0.107.27",
+	}, {
+		name: "domain",
+		msg:  "lookup host.example.org: no such host",
+		want: "lookup <domain>: no such host",
+	}, {
+		name: "fqdn",
+		msg:  `resolving "host.example.org." failed`,
+		want: `resolving "<domain>" failed`,
+	}, {
+		name: "url",
+		msg:  "exchanging with tls://dns.example:853 and https://192.168.1.2/dns-query",
+		want: "exchanging with tls://<domain> and https://<ip>/dns-query",
+	}, {
+		name: "ipv6_url",
+		msg:  "exchanging with udp://[2001:db8::1]:53",
+		want: "exchanging with udp://[<ip>]:53",
+	}, {
+		name: "masked",
+		msg:  "client <ip>: bad request for sub.example.com",
+		want: "client <ip>: bad request for <domain>",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, scrubMessage(tc.msg))
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package diag
+
+import (
+	"net"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/exp/slices"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Redaction
+
+// Redacted is the replacement of the redacted configuration values.
+const Redacted = "<redacted>"
+
+// Redact replaces the non-empty values at paths within the YAML document doc
+// with [Redacted].  The "*" key means every item of a sequence.
+func Redact(doc *yaml.Node, paths [][]string) {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+		doc = doc.Content[0]
+	}
+
+	for _, p := range paths {
+		redact(doc, p)
+	}
+}
+
+// redact replaces the non-empty value at path within n with [Redacted].
+func redact(n *yaml.Node, path []string) {
+	for i, key := range path {
+		if key == "*" {
+			if n.Kind != yaml.SequenceNode {
+				return
+			}
+
+			for _, item := range n.Content {
+				redact(item, path[i+1:])
+			}
+
+			return
+		}
+
+		n = mappingValue(n, key)
+		if n == nil {
+			return
+		}
+	}
+
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Value == "" || n.Tag == "!!null" {
+			return
+		}
+	case yaml.MappingNode, yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			return
+		}
+	default:
+		// Go on.
+	}
+
+	*n = yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: Redacted,
+	}
+}
+
+// mappingValue returns the value of key within the mapping node n or nil if
+// there is none.
+func mappingValue(n *yaml.Node, key string) (v *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// maskedDomain is the replacement of the domain names within the error messages
+// written into the bundles.
+const maskedDomain = "<domain>"
+
+// scrubMessage replaces the IP addresses, including the ones within URLs and
+// with ports, with maskedAddr and the domain names with maskedDomain within
+// msg.
+func scrubMessage(msg string) (scrubbed string) {
+	tokens := strings.FieldsFunc(msg, isScrubDelimiter)
+
+	// Replace the longest tokens first, so that the ones contained in those
+	// don't break them.
+	slices.SortStableFunc(tokens, func(a, b string) (sortsBefore bool) {
+		return len(a) > len(b)
+	})
+
+	for _, t := range tokens {
+		t = strings.TrimSuffix(t, ":")
+		host := t
+		if h, _, err := net.SplitHostPort(t); err == nil {
+			host = h
+		}
+
+		switch {
+		case isAddr(t), isAddr(host):
+			msg = strings.ReplaceAll(msg, t, maskedAddr)
+		case isDomain(strings.TrimSuffix(host, ".")):
+			msg = strings.ReplaceAll(msg, t, maskedDomain)
+		default:
+			// Go on.
+		}
+	}
+
+	return msg
+}
+
+// isScrubDelimiter returns true if r separates the addresses and the domain
+// names within the error messages.
+func isScrubDelimiter(r rune) (ok bool) {
+	return strings.ContainsRune(" \t\n\"'`(),;[]{}<>/\\=@#?&|*", r)
+}
+
+// isDomain returns true if s is a domain name with at least two labels and an
+// alphabetic top-level one, so that the numbers and the durations aren't
+// considered domain names.
+func isDomain(s string) (ok bool) {
+	i := strings.LastIndexByte(s, '.')
+	if i <= 0 || len(s)-i-1 < 2 || netutil.ValidateHostname(s) != nil {
+		return false
+	}
+
+	for _, c := range s[i+1:] {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
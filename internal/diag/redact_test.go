@@ -0,0 +1,65 @@
+package diag_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/diag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestRedact(t *testing.T) {
+	const data = `
+users:
+  - name: admin
+    password: hash
+dns:
+  allowed_clients: []
+  upstream_dns:
+    - 1.1.1.1
+sync:
+  password: ""
+webhooks:
+  - url: https://hook.example
+    secret: secret
+  - url: https://other.example
+`
+
+	const want = `users: <redacted>
+dns:
+  allowed_clients: []
+  upstream_dns:
+    - 1.1.1.1
+sync:
+  password: ""
+webhooks:
+  - url: <redacted>
+    secret: <redacted>
+  - url: <redacted>
+`
+
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal([]byte(data), doc)
+	require.NoError(t, err)
+
+	diag.Redact(doc, [][]string{
+		{"users"},
+		{"dns", "allowed_clients"},
+		{"dns", "disallowed_clients"},
+		{"sync", "password"},
+		{"webhooks", "*", "url"},
+		{"webhooks", "*", "secret"},
+		{"nonexistent", "*", "key"},
+	})
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(doc)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, buf.String())
+}
@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/AdguardTeam/urlfilter"
@@ -30,9 +32,19 @@ type accessManager struct {
 
 	blockedHostsEng *urlfilter.DNSEngine
 
-	// TODO(a.garipov): Create a type for a set of IP networks.
-	allowedNets []netip.Prefix
-	blockedNets []netip.Prefix
+	// allowedNets and blockedNets contain the networks from the access lists.
+	// The values are the networks as they're written in the access lists.
+	allowedNets *aghnet.PrefixTree[netip.Prefix]
+	blockedNets *aghnet.PrefixTree[netip.Prefix]
+
+	// schedule are the clients blocked within the time windows.
+	schedule []*scheduledBlock
+
+	// refusedQueryTypes are the query types refused for all clients.
+	refusedQueryTypes map[uint16]unit
+
+	// clientQueryTypes are the query types refused for particular clients.
+	clientQueryTypes []*clientQueryTypes
 }
 
 // processAccessClients is a helper for processing a list of client strings,
@@ -40,7 +52,7 @@ type accessManager struct {
 func processAccessClients(
 	clientStrs []string,
 	ips map[netip.Addr]unit,
-	nets *[]netip.Prefix,
+	nets *aghnet.PrefixTree[netip.Prefix],
 	clientIDs *stringutil.Set,
 ) (err error) {
 	for i, s := range clientStrs {
@@ -49,7 +61,7 @@ func processAccessClients(
 		if ip, err = netip.ParseAddr(s); err == nil {
 			ips[ip] = unit{}
 		} else if ipnet, err = netip.ParsePrefix(s); err == nil {
-			*nets = append(*nets, ipnet)
+			nets.Insert(ipnet, ipnet)
 		} else {
 			err = ValidateClientID(s)
 			if err != nil {
@@ -64,25 +76,50 @@ func processAccessClients(
 }
 
 // newAccessCtx creates a new accessCtx.
-func newAccessCtx(allowed, blocked, blockedHosts []string) (a *accessManager, err error) {
+func newAccessCtx(
+	allowed []string,
+	blocked []string,
+	blockedHosts []string,
+	schedule []*AccessSchedule,
+	refusedQueryTypes []string,
+	clientQueryTypes []*AccessQueryTypes,
+) (a *accessManager, err error) {
 	a = &accessManager{
 		allowedIPs: map[netip.Addr]unit{},
 		blockedIPs: map[netip.Addr]unit{},
 
 		allowedClientIDs: stringutil.NewSet(),
 		blockedClientIDs: stringutil.NewSet(),
+
+		allowedNets: aghnet.NewPrefixTree[netip.Prefix](),
+		blockedNets: aghnet.NewPrefixTree[netip.Prefix](),
 	}
 
-	err = processAccessClients(allowed, a.allowedIPs, &a.allowedNets, a.allowedClientIDs)
+	err = processAccessClients(allowed, a.allowedIPs, a.allowedNets, a.allowedClientIDs)
 	if err != nil {
 		return nil, fmt.Errorf("adding allowed: %w", err)
 	}
 
-	err = processAccessClients(blocked, a.blockedIPs, &a.blockedNets, a.blockedClientIDs)
+	err = processAccessClients(blocked, a.blockedIPs, a.blockedNets, a.blockedClientIDs)
 	if err != nil {
 		return nil, fmt.Errorf("adding blocked: %w", err)
 	}
 
+	a.schedule, err = newAccessSchedule(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("adding schedule: %w", err)
+	}
+
+	a.refusedQueryTypes, err = parseQueryTypes(refusedQueryTypes)
+	if err != nil {
+		return nil, fmt.Errorf("adding refused query types: %w", err)
+	}
+
+	a.clientQueryTypes, err = newClientQueryTypes(clientQueryTypes)
+	if err != nil {
+		return nil, fmt.Errorf("adding refused query types of clients: %w", err)
+	}
+
 	b := &strings.Builder{}
 	for _, h := range blockedHosts {
 		stringutil.WriteToBuilder(b, strings.ToLower(h), "\n")
@@ -108,7 +145,7 @@ func newAccessCtx(allowed, blocked, blockedHosts []string) (a *accessManager, er
 
 // allowlistMode returns true if this *accessCtx is in the allowlist mode.
 func (a *accessManager) allowlistMode() (ok bool) {
-	return len(a.allowedIPs) != 0 || a.allowedClientIDs.Len() != 0 || len(a.allowedNets) != 0
+	return len(a.allowedIPs) != 0 || a.allowedClientIDs.Len() != 0 || a.allowedNets.Len() != 0
 }
 
 // isBlockedClientID returns true if the ClientID should be blocked.
@@ -138,6 +175,22 @@ func (a *accessManager) isBlockedHost(host string, qt rules.RRType) (ok bool) {
 	return ok
 }
 
+// isScheduledBlocked returns true if the client with ip and clientID is blocked
+// by the schedule at now as well as the rule that blocked it.
+func (a *accessManager) isScheduledBlocked(
+	ip netip.Addr,
+	clientID string,
+	now time.Time,
+) (blocked bool, rule string) {
+	for _, b := range a.schedule {
+		if b.matchesClient(ip, clientID) && b.isActive(now) {
+			return true, b.rule
+		}
+	}
+
+	return false, ""
+}
+
 // isBlockedIP returns the status of the IP address blocking as well as the rule
 // that blocked it.
 func (a *accessManager) isBlockedIP(ip netip.Addr) (blocked bool, rule string) {
@@ -156,10 +209,8 @@ func (a *accessManager) isBlockedIP(ip netip.Addr) (blocked bool, rule string) {
 		return blocked, ip.String()
 	}
 
-	for _, ipnet := range ipnets {
-		if ipnet.Contains(ip) {
-			return blocked, ipnet.String()
-		}
+	if _, ipnet, ok := ipnets.Lookup(ip); ok {
+		return blocked, ipnet.String()
 	}
 
 	return !blocked, ""
@@ -169,6 +220,17 @@ type accessListJSON struct {
 	AllowedClients    []string `json:"allowed_clients"`
 	DisallowedClients []string `json:"disallowed_clients"`
 	BlockedHosts      []string `json:"blocked_hosts"`
+
+	// DisallowedClientsSchedule are the clients blocked within the time
+	// windows.
+	DisallowedClientsSchedule []*AccessSchedule `json:"disallowed_clients_schedule"`
+
+	// RefusedQueryTypes are the query types refused for all clients.
+	RefusedQueryTypes []string `json:"refused_query_types"`
+
+	// RefusedQueryTypesClients are the query types refused for particular
+	// clients.
+	RefusedQueryTypesClients []*AccessQueryTypes `json:"refused_query_types_clients"`
 }
 
 func (s *Server) accessListJSON() (j accessListJSON) {
@@ -179,6 +241,11 @@ func (s *Server) accessListJSON() (j accessListJSON) {
 		AllowedClients:    stringutil.CloneSlice(s.conf.AllowedClients),
 		DisallowedClients: stringutil.CloneSlice(s.conf.DisallowedClients),
 		BlockedHosts:      stringutil.CloneSlice(s.conf.BlockedHosts),
+
+		DisallowedClientsSchedule: cloneAccessSchedule(s.conf.DisallowedClientsSchedule),
+
+		RefusedQueryTypes:        stringutil.CloneSlice(s.conf.RefusedQueryTypes),
+		RefusedQueryTypesClients: cloneAccessQueryTypes(s.conf.RefusedQueryTypesClients),
 	}
 }
 
@@ -241,7 +308,14 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var a *accessManager
-	a, err = newAccessCtx(list.AllowedClients, list.DisallowedClients, list.BlockedHosts)
+	a, err = newAccessCtx(
+		list.AllowedClients,
+		list.DisallowedClients,
+		list.BlockedHosts,
+		list.DisallowedClientsSchedule,
+		list.RefusedQueryTypes,
+		list.RefusedQueryTypesClients,
+	)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "creating access ctx: %s", err)
 
@@ -249,10 +323,13 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	defer log.Debug(
-		"access: updated lists: %d, %d, %d",
+		"access: updated lists: %d, %d, %d, %d, %d, %d",
 		len(list.AllowedClients),
 		len(list.DisallowedClients),
 		len(list.BlockedHosts),
+		len(list.DisallowedClientsSchedule),
+		len(list.RefusedQueryTypes),
+		len(list.RefusedQueryTypesClients),
 	)
 
 	defer s.conf.ConfigModified()
@@ -263,5 +340,8 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 	s.conf.AllowedClients = list.AllowedClients
 	s.conf.DisallowedClients = list.DisallowedClients
 	s.conf.BlockedHosts = list.BlockedHosts
+	s.conf.DisallowedClientsSchedule = list.DisallowedClientsSchedule
+	s.conf.RefusedQueryTypes = list.RefusedQueryTypes
+	s.conf.RefusedQueryTypesClients = list.RefusedQueryTypesClients
 	s.access = a
 }
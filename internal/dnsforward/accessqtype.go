@@ -0,0 +1,185 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// Access by Query Type
+
+// AccessQueryTypes is an entry of the list of the query types refused for
+// particular clients.
+type AccessQueryTypes struct {
+	// Client is the IP address, the CIDR network, or the ClientID of the
+	// client.
+	Client string `yaml:"client" json:"client"`
+
+	// QueryTypes are the names of the refused query types, for example "ANY"
+	// or "HTTPS".  The types without names are written as "TYPE" followed by
+	// the number, for example "TYPE65535".
+	QueryTypes []string `yaml:"query_types" json:"query_types"`
+}
+
+// clientQueryTypes is the parsed [AccessQueryTypes].
+type clientQueryTypes struct {
+	// qtypes is the set of the refused query types.
+	qtypes map[uint16]unit
+
+	// rule is the original client string used as the refusing rule.
+	rule string
+
+	// clientID is the ClientID of the client, if any.
+	clientID string
+
+	// prefix is the network of the client.  A single IP address is stored as
+	// a full-length prefix.
+	prefix netip.Prefix
+}
+
+// parseAccessClient parses the IP address, the CIDR network, or the ClientID of
+// a client from an access rule.  A single IP address is returned as a
+// full-length prefix.  clientID is empty if s is an IP address or a network.
+func parseAccessClient(s string) (prefix netip.Prefix, clientID string, err error) {
+	if ip, perr := netip.ParseAddr(s); perr == nil {
+		return netip.PrefixFrom(ip, ip.BitLen()), "", nil
+	} else if prefix, perr = netip.ParsePrefix(s); perr == nil {
+		return prefix, "", nil
+	}
+
+	err = ValidateClientID(s)
+	if err != nil {
+		return netip.Prefix{}, "", fmt.Errorf("client %q: bad ip, cidr, or clientid", s)
+	}
+
+	return netip.Prefix{}, s, nil
+}
+
+// parseQueryTypes parses the names of the query types into a set.
+func parseQueryTypes(names []string) (qtypes map[uint16]unit, err error) {
+	qtypes = make(map[uint16]unit, len(names))
+	for i, name := range names {
+		var qt uint16
+		qt, err = parseQueryType(name)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		qtypes[qt] = unit{}
+	}
+
+	return qtypes, nil
+}
+
+// parseQueryType parses the name of the query type, which is either its
+// mnemonic or "TYPE" followed by its number.  The name is case-insensitive.
+func parseQueryType(name string) (qt uint16, err error) {
+	name = strings.ToUpper(name)
+	if t, ok := dns.StringToType[name]; ok {
+		return t, nil
+	}
+
+	if strings.HasPrefix(name, "TYPE") {
+		var num uint64
+		num, err = strconv.ParseUint(name[len("TYPE"):], 10, 16)
+		if err == nil {
+			return uint16(num), nil
+		}
+	}
+
+	return 0, fmt.Errorf("bad query type %q", name)
+}
+
+// newClientQueryTypes parses the list of the query types refused for
+// particular clients.
+func newClientQueryTypes(entries []*AccessQueryTypes) (cqts []*clientQueryTypes, err error) {
+	cqts = make([]*clientQueryTypes, 0, len(entries))
+	for i, e := range entries {
+		if e == nil {
+			return nil, fmt.Errorf("entry at index %d: no value", i)
+		}
+
+		c := &clientQueryTypes{
+			rule: e.Client,
+		}
+
+		c.prefix, c.clientID, err = parseAccessClient(e.Client)
+		if err != nil {
+			return nil, fmt.Errorf("entry at index %d: %w", i, err)
+		}
+
+		c.qtypes, err = parseQueryTypes(e.QueryTypes)
+		if err != nil {
+			return nil, fmt.Errorf("entry at index %d: query types: %w", i, err)
+		}
+
+		cqts = append(cqts, c)
+	}
+
+	return cqts, nil
+}
+
+// matchesClient returns true if the client with ip and clientID is matched by
+// c.
+func (c *clientQueryTypes) matchesClient(ip netip.Addr, clientID string) (ok bool) {
+	if c.clientID != "" {
+		return c.clientID == clientID
+	}
+
+	return ip.IsValid() && c.prefix.Contains(ip)
+}
+
+// isRefusedQueryType returns true if the queries of type qt from the client
+// with ip and clientID must be refused as well as the rule that refused it.
+// The rule is empty, if the type is refused globally.
+func (a *accessManager) isRefusedQueryType(
+	ip netip.Addr,
+	clientID string,
+	qt uint16,
+) (refused bool, rule string) {
+	if _, ok := a.refusedQueryTypes[qt]; ok {
+		return true, ""
+	}
+
+	for _, c := range a.clientQueryTypes {
+		if _, ok := c.qtypes[qt]; ok && c.matchesClient(ip, clientID) {
+			return true, c.rule
+		}
+	}
+
+	return false, ""
+}
+
+// isRefusedQueryType returns true if the queries of type qt from the client
+// with ip and clientID must be refused by the current access settings.
+func (s *Server) isRefusedQueryType(
+	ip netip.Addr,
+	clientID string,
+	qt uint16,
+) (refused bool, rule string) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	return s.access.isRefusedQueryType(ip.Unmap(), clientID, qt)
+}
+
+// cloneAccessQueryTypes returns a deep copy of entries.
+func cloneAccessQueryTypes(entries []*AccessQueryTypes) (clone []*AccessQueryTypes) {
+	if entries == nil {
+		return nil
+	}
+
+	clone = make([]*AccessQueryTypes, 0, len(entries))
+	for _, e := range entries {
+		clone = append(clone, &AccessQueryTypes{
+			Client:     e.Client,
+			QueryTypes: stringutil.CloneSlice(e.QueryTypes),
+		})
+	}
+
+	return clone
+}
@@ -0,0 +1,117 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessManager_isRefusedQueryType(t *testing.T) {
+	a, err := newAccessCtx(nil, nil, nil, nil, []string{"any"}, []*AccessQueryTypes{{
+		Client:     "192.168.10.0/24",
+		QueryTypes: []string{"HTTPS", "SVCB"},
+	}, {
+		Client:     "iot-hub",
+		QueryTypes: []string{"TYPE65"},
+	}})
+	require.NoError(t, err)
+
+	iotIP := netip.MustParseAddr("192.168.10.5")
+	otherIP := netip.MustParseAddr("192.168.1.5")
+
+	testCases := []struct {
+		name        string
+		ip          netip.Addr
+		clientID    string
+		wantRule    string
+		qt          uint16
+		wantRefused bool
+	}{{
+		name:        "global",
+		ip:          otherIP,
+		clientID:    "",
+		wantRule:    "",
+		qt:          dns.TypeANY,
+		wantRefused: true,
+	}, {
+		name:        "network",
+		ip:          iotIP,
+		clientID:    "",
+		wantRule:    "192.168.10.0/24",
+		qt:          dns.TypeHTTPS,
+		wantRefused: true,
+	}, {
+		name:        "network_other_type",
+		ip:          iotIP,
+		clientID:    "",
+		wantRule:    "",
+		qt:          dns.TypeA,
+		wantRefused: false,
+	}, {
+		name:        "other_client",
+		ip:          otherIP,
+		clientID:    "",
+		wantRule:    "",
+		qt:          dns.TypeHTTPS,
+		wantRefused: false,
+	}, {
+		name:        "clientid",
+		ip:          otherIP,
+		clientID:    "iot-hub",
+		wantRule:    "iot-hub",
+		qt:          dns.TypeHTTPS,
+		wantRefused: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			refused, rule := a.isRefusedQueryType(tc.ip, tc.clientID, tc.qt)
+			assert.Equal(t, tc.wantRefused, refused)
+			assert.Equal(t, tc.wantRule, rule)
+		})
+	}
+}
+
+func TestNewClientQueryTypes(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		entries    []*AccessQueryTypes
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		entries: []*AccessQueryTypes{{
+			Client:     "192.168.10.0/24",
+			QueryTypes: []string{"any", "HTTPS", "TYPE65535"},
+		}},
+	}, {
+		name:       "bad_client",
+		wantErrMsg: `entry at index 0: client "bad client": bad ip, cidr, or clientid`,
+		entries: []*AccessQueryTypes{{
+			Client:     "bad client",
+			QueryTypes: []string{"ANY"},
+		}},
+	}, {
+		name:       "bad_type",
+		wantErrMsg: `entry at index 0: query types: at index 1: bad query type "TYPE65536"`,
+		entries: []*AccessQueryTypes{{
+			Client:     "192.168.10.0/24",
+			QueryTypes: []string{"ANY", "TYPE65536"},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "entry at index 0: no value",
+		entries:    []*AccessQueryTypes{nil},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newClientQueryTypes(tc.entries)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// Access Schedule
+
+// AccessSchedule is an entry of the scheduled access list.  The client is
+// blocked within the daily time window on the specified days of week.
+type AccessSchedule struct {
+	// Client is the IP address, the CIDR network, or the ClientID of the
+	// blocked client.
+	Client string `yaml:"client" json:"client"`
+
+	// TimeZone is the IANA time zone name, in which Start and End are
+	// specified, for example "Europe/Berlin".  If empty, the local time zone
+	// of the system is used.
+	TimeZone string `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+
+	// Start is the time of the day, when the blocking starts, in the "HH:MM"
+	// format.
+	Start string `yaml:"start" json:"start"`
+
+	// End is the time of the day, when the blocking ends, in the "HH:MM"
+	// format.  It may be "24:00" or earlier than Start, in which case the
+	// window ends on the next day.
+	End string `yaml:"end" json:"end"`
+
+	// Days are the three-letter lowercase names of the days of week, when the
+	// window starts, for example "mon".  If empty, the window starts every
+	// day.
+	Days []string `yaml:"days,omitempty" json:"days,omitempty"`
+}
+
+// scheduledBlock is the parsed [AccessSchedule].
+type scheduledBlock struct {
+	// loc is the time zone of the window.
+	loc *time.Location
+
+	// rule is the original client string used as the blocking rule.
+	rule string
+
+	// clientID is the ClientID of the blocked client, if any.
+	clientID string
+
+	// prefix is the network of the blocked client.  A single IP address is
+	// stored as a full-length prefix.
+	prefix netip.Prefix
+
+	// start and end are the offsets of the window from the midnight.
+	start time.Duration
+	end   time.Duration
+
+	// days is the set of days of week, when the window starts.  If all are
+	// false, the window starts every day.
+	days [7]bool
+}
+
+// dayNames maps the names of the days of week as used in the configuration to
+// their values.
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// newScheduledBlock parses s into a *scheduledBlock.
+func newScheduledBlock(s *AccessSchedule) (b *scheduledBlock, err error) {
+	b = &scheduledBlock{
+		rule: s.Client,
+		loc:  time.Local,
+	}
+
+	b.prefix, b.clientID, err = parseAccessClient(s.Client)
+	if err != nil {
+		// Don't wrap the error, since it already contains the client.
+		return nil, err
+	}
+
+	if s.TimeZone != "" {
+		b.loc, err = time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("time zone: %w", err)
+		}
+	}
+
+	b.start, err = parseDayTime(s.Start, false)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+
+	b.end, err = parseDayTime(s.End, true)
+	if err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+
+	if b.start == b.end {
+		return nil, fmt.Errorf("start and end are equal: %q", s.Start)
+	}
+
+	for _, d := range s.Days {
+		wd, ok := dayNames[d]
+		if !ok {
+			return nil, fmt.Errorf("bad day of week %q", d)
+		}
+
+		b.days[wd] = true
+	}
+
+	return b, nil
+}
+
+// parseDayTime parses the time of the day in the "HH:MM" format and returns its
+// offset from the midnight.  If isEnd is true, "24:00" is also allowed.
+func parseDayTime(s string, isEnd bool) (off time.Duration, err error) {
+	hStr, mStr, ok := strings.Cut(s, ":")
+	if !ok || len(hStr) != 2 || len(mStr) != 2 {
+		return 0, fmt.Errorf("bad time %q: want HH:MM", s)
+	}
+
+	h, err := strconv.Atoi(hStr)
+	if err != nil {
+		return 0, fmt.Errorf("bad hours in %q: %w", s, err)
+	}
+
+	m, err := strconv.Atoi(mStr)
+	if err != nil {
+		return 0, fmt.Errorf("bad minutes in %q: %w", s, err)
+	}
+
+	off = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	if h < 0 || m < 0 || m > 59 || off > 24*time.Hour || (off == 24*time.Hour && !isEnd) {
+		return 0, fmt.Errorf("time %q out of range", s)
+	}
+
+	return off, nil
+}
+
+// matchesClient returns true if the client with ip and clientID is blocked by
+// b.
+func (b *scheduledBlock) matchesClient(ip netip.Addr, clientID string) (ok bool) {
+	if b.clientID != "" {
+		return b.clientID == clientID
+	}
+
+	return ip.IsValid() && b.prefix.Contains(ip)
+}
+
+// isActive returns true if now is within the window of b.
+func (b *scheduledBlock) isActive(now time.Time) (ok bool) {
+	now = now.In(b.loc)
+	h, m, sec := now.Clock()
+	off := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+
+	day := now.Weekday()
+	if b.start < b.end {
+		if off < b.start || off >= b.end {
+			return false
+		}
+	} else if off < b.end {
+		// The window has started on the previous day.
+		day = (day + 6) % 7
+	} else if off < b.start {
+		return false
+	}
+
+	return b.days == [7]bool{} || b.days[day]
+}
+
+// cloneAccessSchedule returns a deep copy of entries.
+func cloneAccessSchedule(entries []*AccessSchedule) (clone []*AccessSchedule) {
+	if entries == nil {
+		return nil
+	}
+
+	clone = make([]*AccessSchedule, 0, len(entries))
+	for _, e := range entries {
+		c := *e
+		c.Days = stringutil.CloneSlice(e.Days)
+		clone = append(clone, &c)
+	}
+
+	return clone
+}
+
+// newAccessSchedule parses the scheduled access list.
+func newAccessSchedule(entries []*AccessSchedule) (blocks []*scheduledBlock, err error) {
+	blocks = make([]*scheduledBlock, 0, len(entries))
+	for i, e := range entries {
+		if e == nil {
+			return nil, fmt.Errorf("entry at index %d: no value", i)
+		}
+
+		var b *scheduledBlock
+		b, err = newScheduledBlock(e)
+		if err != nil {
+			return nil, fmt.Errorf("entry at index %d: %w", i, err)
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,237 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScheduledBlock(t *testing.T) {
+	testCases := []struct {
+		sched      *AccessSchedule
+		name       string
+		wantErrMsg string
+	}{{
+		sched: &AccessSchedule{
+			Client: "192.168.1.10",
+			Start:  "21:00",
+			End:    "07:00",
+			Days:   []string{"mon", "sun"},
+		},
+		name:       "ip",
+		wantErrMsg: "",
+	}, {
+		sched: &AccessSchedule{
+			Client:   "kids-tablet",
+			TimeZone: "UTC",
+			Start:    "00:00",
+			End:      "24:00",
+		},
+		name:       "clientid",
+		wantErrMsg: "",
+	}, {
+		sched: &AccessSchedule{
+			Client: "!!!",
+			Start:  "21:00",
+			End:    "07:00",
+		},
+		name:       "bad_client",
+		wantErrMsg: `client "!!!": bad ip, cidr, or clientid`,
+	}, {
+		sched: &AccessSchedule{
+			Client: "192.168.1.0/24",
+			Start:  "24:00",
+			End:    "07:00",
+		},
+		name:       "bad_start",
+		wantErrMsg: `start: time "24:00" out of range`,
+	}, {
+		sched: &AccessSchedule{
+			Client: "192.168.1.0/24",
+			Start:  "21:00",
+			End:    "7:00",
+		},
+		name:       "bad_end_format",
+		wantErrMsg: `end: bad time "7:00": want HH:MM`,
+	}, {
+		sched: &AccessSchedule{
+			Client: "192.168.1.0/24",
+			Start:  "21:00",
+			End:    "21:00",
+		},
+		name:       "empty_window",
+		wantErrMsg: `start and end are equal: "21:00"`,
+	}, {
+		sched: &AccessSchedule{
+			Client: "192.168.1.0/24",
+			Start:  "21:00",
+			End:    "07:00",
+			Days:   []string{"monday"},
+		},
+		name:       "bad_day",
+		wantErrMsg: `bad day of week "monday"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newScheduledBlock(tc.sched)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestScheduledBlock_isActive(t *testing.T) {
+	// zone is three hours ahead of UTC.
+	zone := time.FixedZone("UTC+3", 3*60*60)
+
+	// night is a window from 21:00 till 07:00 in zone starting on Mondays.
+	night := &scheduledBlock{
+		loc:   zone,
+		start: 21 * time.Hour,
+		end:   7 * time.Hour,
+		days:  [7]bool{time.Monday: true},
+	}
+
+	// day is a window from 09:00 till 17:30 in zone every day.
+	day := &scheduledBlock{
+		loc:   zone,
+		start: 9 * time.Hour,
+		end:   17*time.Hour + 30*time.Minute,
+	}
+
+	// Monday, March 20, 2023.
+	monday := time.Date(2023, time.March, 20, 0, 0, 0, 0, zone)
+
+	testCases := []struct {
+		now   time.Time
+		block *scheduledBlock
+		name  string
+		want  bool
+	}{{
+		now:   monday.Add(22 * time.Hour),
+		block: night,
+		name:  "night_started",
+		want:  true,
+	}, {
+		now:   monday.Add(24*time.Hour + 6*time.Hour),
+		block: night,
+		name:  "night_next_day",
+		want:  true,
+	}, {
+		now:   monday.Add(6 * time.Hour),
+		block: night,
+		name:  "night_started_on_sunday",
+		want:  false,
+	}, {
+		now:   monday.Add(24*time.Hour + 22*time.Hour),
+		block: night,
+		name:  "night_on_tuesday",
+		want:  false,
+	}, {
+		now:   monday.Add(12 * time.Hour),
+		block: night,
+		name:  "night_noon",
+		want:  false,
+	}, {
+		// 19:00 UTC is 22:00 in zone.
+		now:   time.Date(2023, time.March, 20, 19, 0, 0, 0, time.UTC),
+		block: night,
+		name:  "night_other_zone",
+		want:  true,
+	}, {
+		now:   monday.Add(9 * time.Hour),
+		block: day,
+		name:  "day_start",
+		want:  true,
+	}, {
+		now:   monday.Add(17*time.Hour + 30*time.Minute),
+		block: day,
+		name:  "day_end",
+		want:  false,
+	}, {
+		now:   monday.Add(8 * time.Hour),
+		block: day,
+		name:  "day_before",
+		want:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.block.isActive(tc.now))
+		})
+	}
+}
+
+func TestAccessManager_isScheduledBlocked(t *testing.T) {
+	a, err := newAccessCtx(nil, nil, nil, []*AccessSchedule{{
+		Client:   "192.168.1.0/24",
+		TimeZone: "UTC",
+		Start:    "21:00",
+		End:      "24:00",
+	}, {
+		Client:   "kids-tablet",
+		TimeZone: "UTC",
+		Start:    "20:00",
+		End:      "24:00",
+	}}, nil, nil)
+	require.NoError(t, err)
+
+	evening := time.Date(2023, time.March, 20, 22, 0, 0, 0, time.UTC)
+	noon := time.Date(2023, time.March, 20, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		now         time.Time
+		ip          netip.Addr
+		name        string
+		clientID    string
+		wantRule    string
+		wantBlocked bool
+	}{{
+		now:         evening,
+		ip:          netip.MustParseAddr("192.168.1.10"),
+		name:        "ip_active",
+		clientID:    "",
+		wantRule:    "192.168.1.0/24",
+		wantBlocked: true,
+	}, {
+		now:         noon,
+		ip:          netip.MustParseAddr("192.168.1.10"),
+		name:        "ip_inactive",
+		clientID:    "",
+		wantRule:    "",
+		wantBlocked: false,
+	}, {
+		now:         evening,
+		ip:          netip.MustParseAddr("192.168.2.10"),
+		name:        "ip_other",
+		clientID:    "",
+		wantRule:    "",
+		wantBlocked: false,
+	}, {
+		now:         evening,
+		ip:          netip.MustParseAddr("10.0.0.1"),
+		name:        "clientid_active",
+		clientID:    "kids-tablet",
+		wantRule:    "kids-tablet",
+		wantBlocked: true,
+	}, {
+		now:         noon,
+		ip:          netip.Addr{},
+		name:        "clientid_inactive",
+		clientID:    "kids-tablet",
+		wantRule:    "",
+		wantBlocked: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			blocked, rule := a.isScheduledBlocked(tc.ip, tc.clientID, tc.now)
+			assert.Equal(t, tc.wantBlocked, blocked)
+			assert.Equal(t, tc.wantRule, rule)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+
+	"golang.org/x/exp/slices"
+)
+
+// Address Families
+
+// AddrFamily is the preferred address family of the upstreams.
+type AddrFamily string
+
+// Allowed address families.
+const (
+	// AddrFamilyAny means that the addresses of the upstreams are used in the
+	// order they are resolved in.
+	AddrFamilyAny AddrFamily = ""
+
+	// AddrFamilyIPv4 means that the IPv4 addresses of the upstreams are tried
+	// first.
+	AddrFamilyIPv4 AddrFamily = "ipv4"
+
+	// AddrFamilyIPv6 means that the IPv6 addresses of the upstreams are tried
+	// first.
+	AddrFamilyIPv6 AddrFamily = "ipv6"
+)
+
+// validateAddrFamily returns an error if fam isn't a valid address family.
+func validateAddrFamily(fam AddrFamily) (err error) {
+	switch fam {
+	case AddrFamilyAny, AddrFamilyIPv4, AddrFamilyIPv6:
+		return nil
+	default:
+		return fmt.Errorf("bad address family %q", fam)
+	}
+}
+
+// defaultBootstrapIPv6 are the IPv6 addresses of the default bootstrap DNS
+// servers, which are used in the IPv6-only mode.
+var defaultBootstrapIPv6 = []string{"2620:fe::10", "2620:fe::fe:10"}
+
+// orderAddrs returns the addresses in the order of preference according to
+// prefer.  If ipv6Only is true, the IPv4 addresses are removed.  The relative
+// order of the addresses of the same family is kept.
+func orderAddrs(addrs []netip.Addr, prefer AddrFamily, ipv6Only bool) (ordered []netip.Addr) {
+	ordered = make([]netip.Addr, 0, len(addrs))
+	for _, a := range addrs {
+		if !ipv6Only || a.Is6() {
+			ordered = append(ordered, a)
+		}
+	}
+
+	switch prefer {
+	case AddrFamilyIPv4:
+		slices.SortStableFunc(ordered, func(a, b netip.Addr) (sortsBefore bool) {
+			return a.Is4() && !b.Is4()
+		})
+	case AddrFamilyIPv6:
+		slices.SortStableFunc(ordered, func(a, b netip.Addr) (sortsBefore bool) {
+			return a.Is6() && !b.Is6()
+		})
+	default:
+		// Keep the resolved order.
+	}
+
+	return ordered
+}
@@ -0,0 +1,55 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderAddrs(t *testing.T) {
+	ip4a := netip.MustParseAddr("192.0.2.1")
+	ip4b := netip.MustParseAddr("192.0.2.2")
+	ip6a := netip.MustParseAddr("2001:db8::1")
+	ip6b := netip.MustParseAddr("2001:db8::2")
+
+	addrs := []netip.Addr{ip4a, ip6a, ip4b, ip6b}
+
+	testCases := []struct {
+		name     string
+		prefer   AddrFamily
+		want     []netip.Addr
+		ipv6Only bool
+	}{{
+		name:     "any",
+		prefer:   AddrFamilyAny,
+		want:     addrs,
+		ipv6Only: false,
+	}, {
+		name:     "ipv4",
+		prefer:   AddrFamilyIPv4,
+		want:     []netip.Addr{ip4a, ip4b, ip6a, ip6b},
+		ipv6Only: false,
+	}, {
+		name:     "ipv6",
+		prefer:   AddrFamilyIPv6,
+		want:     []netip.Addr{ip6a, ip6b, ip4a, ip4b},
+		ipv6Only: false,
+	}, {
+		name:     "ipv6_only",
+		prefer:   AddrFamilyAny,
+		want:     []netip.Addr{ip6a, ip6b},
+		ipv6Only: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, orderAddrs(addrs, tc.prefer, tc.ipv6Only))
+		})
+	}
+}
+
+func TestValidateAddrFamily(t *testing.T) {
+	assert.NoError(t, validateAddrFamily(AddrFamilyIPv6))
+	assert.Error(t, validateAddrFamily("ipv5"))
+}
@@ -0,0 +1,183 @@
+package dnsforward
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/miekg/dns"
+)
+
+// Blocking Preview
+
+// blockPreviewResp is the response of the GET /control/tools/block_preview
+// HTTP API.
+type blockPreviewResp struct {
+	// BlockingMode is the current blocking mode.
+	BlockingMode BlockingMode `json:"blocking_mode"`
+
+	// Reason is the reason of the filtering result.
+	Reason string `json:"reason"`
+
+	// Rcode is the response code of the response.  It's empty if no response
+	// is sent, see Dropped, or the response can't be predicted, for example
+	// for a parental control bypass query, the response to which depends on
+	// the PIN.
+	Rcode string `json:"rcode,omitempty"`
+
+	// AccessRule is the rule of the access settings, which has blocked the
+	// request, if any.
+	AccessRule string `json:"access_rule,omitempty"`
+
+	// BlockPageURL is the URL of the server the blocked response points the
+	// client to, which may show a block page.  It's empty if the response
+	// doesn't point the client anywhere, for example in the NXDOMAIN or the
+	// null IP blocking modes.
+	BlockPageURL string `json:"block_page_url,omitempty"`
+
+	// Rules are the texts of the matched filtering rules.
+	Rules []string `json:"rules"`
+
+	// Answer are the records of the answer section in the presentation
+	// format.
+	Answer []string `json:"answer"`
+
+	// Authority are the records of the authority section in the presentation
+	// format.
+	Authority []string `json:"authority"`
+
+	// IsFiltered is true if the request has been blocked by the filtering.
+	IsFiltered bool `json:"is_filtered"`
+
+	// AccessBlocked is true if the request has been blocked by the access
+	// settings.
+	AccessBlocked bool `json:"access_blocked"`
+
+	// Dropped is true if no response is sent at all.  The preview is made for
+	// plain DNS over UDP, over which the requests blocked by the access
+	// settings are dropped.  Over TCP and the encrypted protocols, except
+	// DNSCrypt, those are answered with REFUSED instead.
+	Dropped bool `json:"dropped"`
+}
+
+// blockPreview returns the response, which would be sent to the request from
+// client over plain DNS over UDP under the current configuration.  Unlike the
+// real processing, it doesn't affect the query log and the statistics.
+func (s *Server) blockPreview(req *dns.Msg, client netip.Addr) (resp *blockPreviewResp) {
+	s.serverLock.RLock()
+	mode := s.conf.BlockingMode
+	s.serverLock.RUnlock()
+
+	resp = &blockPreviewResp{
+		BlockingMode: mode,
+		Reason:       filtering.NotFilteredNotFound.String(),
+		Rules:        []string{},
+		Answer:       []string{},
+		Authority:    []string{},
+	}
+
+	q := req.Question[0]
+	host := strings.TrimSuffix(q.Name, ".")
+	if blocked, rule := s.IsBlockedClient(client, ""); blocked {
+		resp.AccessBlocked, resp.AccessRule = true, rule
+	} else if s.access.isBlockedHost(host, q.Qtype) {
+		resp.AccessBlocked, resp.AccessRule = true, host
+	}
+
+	if resp.AccessBlocked {
+		// See [Server.preBlockedResponse].
+		resp.Dropped = true
+
+		return resp
+	}
+
+	if refused, rule := s.isRefusedQueryType(client, "", q.Qtype); refused {
+		resp.Rcode, resp.AccessRule = dns.RcodeToString[dns.RcodeRefused], rule
+
+		return resp
+	}
+
+	dctx, stages := s.dryRun(req, client)
+	res := dctx.result
+	resp.Reason = res.Reason.String()
+	resp.IsFiltered = res.IsFiltered
+	for _, r := range res.Rules {
+		resp.Rules = append(resp.Rules, r.Text)
+	}
+
+	msg := dctx.proxyCtx.Res
+	if msg == nil {
+		if l := len(stages); l > 0 && stages[l-1].Result == lookupResultError {
+			// The processing has failed, so the server responds with
+			// SERVFAIL.
+			resp.Rcode = dns.RcodeToString[dns.RcodeServerFailure]
+		}
+
+		return resp
+	}
+
+	resp.Rcode = dns.RcodeToString[msg.Rcode]
+	for _, rr := range msg.Answer {
+		resp.Answer = append(resp.Answer, rr.String())
+	}
+
+	for _, rr := range msg.Ns {
+		resp.Authority = append(resp.Authority, rr.String())
+	}
+
+	if res.IsFiltered && res.Reason != filtering.FilteredSafeSearch {
+		resp.BlockPageURL = blockPageURL(msg.Answer)
+	}
+
+	return resp
+}
+
+// blockPageURL returns the URL of the server the first address record among
+// answer points to.  It returns an empty string if there is no such record or
+// the address is unspecified or loopback, so that the client can't reach any
+// block page.
+func blockPageURL(answer []dns.RR) (u string) {
+	for _, rr := range answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok || addr.IsUnspecified() || addr.IsLoopback() {
+			return ""
+		}
+
+		addr = addr.Unmap()
+		h := addr.String()
+		if addr.Is6() {
+			h = "[" + h + "]"
+		}
+
+		return (&url.URL{Scheme: "http", Host: h, Path: "/"}).String()
+	}
+
+	return ""
+}
+
+// handleBlockPreview is the handler for the GET /control/tools/block_preview
+// HTTP API.
+func (s *Server) handleBlockPreview(w http.ResponseWriter, r *http.Request) {
+	req, client, err := parseLookupQuery(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, s.blockPreview(req, client))
+}
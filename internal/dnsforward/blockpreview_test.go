@@ -0,0 +1,182 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_blockPreview(t *testing.T) {
+	f, err := filtering.New(&filtering.Config{}, []filtering.Filter{{
+		ID: 0, Data: []byte("||blocked.example^\n"),
+	}})
+	require.NoError(t, err)
+
+	f.SetEnabled(true)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  testDHCP,
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Prepare(&ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		FilteringConfig: FilteringConfig{
+			ProtectionEnabled: true,
+			BlockingMode:      BlockingModeDefault,
+			BlockingIPv4:      net.IP{192, 0, 2, 10},
+			BlockingIPv6:      net.ParseIP("2001:db8::10"),
+			DisallowedClients: []string{"192.0.2.200"},
+			ParentalBypassPIN: newTestPINHash(t, "1234"),
+			EDNSClientSubnet: &EDNSClientSubnet{
+				Enabled: false,
+			},
+		},
+	}))
+
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		return aghalg.Coalesce(
+			aghtest.MatchedResponse(req, dns.TypeA, "allowed.example", "192.0.2.2"),
+			new(dns.Msg).SetRcode(req, dns.RcodeNameError),
+		), nil
+	})
+	s.conf.UpstreamConfig.Upstreams = []upstream.Upstream{ups}
+	startDeferStop(t, s)
+
+	client := netip.MustParseAddr("192.0.2.100")
+
+	testCases := []struct {
+		client        netip.Addr
+		name          string
+		host          string
+		mode          BlockingMode
+		wantRcode     string
+		wantURL       string
+		wantAnswerLen int
+		qtype         uint16
+		wantFiltered  bool
+		wantAccess    bool
+		wantDropped   bool
+	}{{
+		client:        client,
+		name:          "allowed",
+		host:          "allowed.example.",
+		mode:          BlockingModeDefault,
+		wantRcode:     "NOERROR",
+		wantURL:       "",
+		wantAnswerLen: 1,
+		qtype:         dns.TypeA,
+		wantFiltered:  false,
+		wantAccess:    false,
+	}, {
+		client:        client,
+		name:          "default",
+		host:          "blocked.example.",
+		mode:          BlockingModeDefault,
+		wantRcode:     "NOERROR",
+		wantURL:       "",
+		wantAnswerLen: 1,
+		qtype:         dns.TypeA,
+		wantFiltered:  true,
+		wantAccess:    false,
+	}, {
+		client:        client,
+		name:          "custom_ip_a",
+		host:          "blocked.example.",
+		mode:          BlockingModeCustomIP,
+		wantRcode:     "NOERROR",
+		wantURL:       "http://192.0.2.10/",
+		wantAnswerLen: 1,
+		qtype:         dns.TypeA,
+		wantFiltered:  true,
+		wantAccess:    false,
+	}, {
+		client:        client,
+		name:          "custom_ip_aaaa",
+		host:          "blocked.example.",
+		mode:          BlockingModeCustomIP,
+		wantRcode:     "NOERROR",
+		wantURL:       "http://[2001:db8::10]/",
+		wantAnswerLen: 1,
+		qtype:         dns.TypeAAAA,
+		wantFiltered:  true,
+		wantAccess:    false,
+	}, {
+		client:        client,
+		name:          "custom_ip_txt",
+		host:          "blocked.example.",
+		mode:          BlockingModeCustomIP,
+		wantRcode:     "NXDOMAIN",
+		wantURL:       "",
+		wantAnswerLen: 0,
+		qtype:         dns.TypeTXT,
+		wantFiltered:  true,
+		wantAccess:    false,
+	}, {
+		client:        client,
+		name:          "refused",
+		host:          "blocked.example.",
+		mode:          BlockingModeREFUSED,
+		wantRcode:     "REFUSED",
+		wantURL:       "",
+		wantAnswerLen: 0,
+		qtype:         dns.TypeA,
+		wantFiltered:  true,
+		wantAccess:    false,
+	}, {
+		client:        netip.MustParseAddr("192.0.2.200"),
+		name:          "disallowed_client",
+		host:          "allowed.example.",
+		mode:          BlockingModeDefault,
+		wantRcode:     "",
+		wantURL:       "",
+		wantAnswerLen: 0,
+		qtype:         dns.TypeA,
+		wantFiltered:  false,
+		wantAccess:    true,
+		wantDropped:   true,
+	}, {
+		client:        client,
+		name:          "parental_bypass",
+		host:          "1234." + parentalBypassDomain,
+		mode:          BlockingModeDefault,
+		wantRcode:     "",
+		wantURL:       "",
+		wantAnswerLen: 0,
+		qtype:         dns.TypeA,
+		wantFiltered:  false,
+		wantAccess:    false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s.conf.BlockingMode = tc.mode
+
+			req := (&dns.Msg{}).SetQuestion(tc.host, tc.qtype)
+			resp := s.blockPreview(req, tc.client)
+
+			assert.Equal(t, tc.mode, resp.BlockingMode)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			assert.Equal(t, tc.wantURL, resp.BlockPageURL)
+			assert.Len(t, resp.Answer, tc.wantAnswerLen)
+			assert.Equal(t, tc.wantFiltered, resp.IsFiltered)
+			assert.Equal(t, tc.wantAccess, resp.AccessBlocked)
+			assert.Equal(t, tc.wantDropped, resp.Dropped)
+		})
+	}
+
+	assert.Empty(t, s.parentalBypass.entries)
+	assert.Empty(t, s.parentalBypass.failures)
+}
@@ -0,0 +1,722 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+	"golang.org/x/exp/slices"
+)
+
+// Bootstrap Resolvers
+
+// Names of the upstream groups having their own bootstrap servers.
+const (
+	bootstrapGroupUpstream = "upstream"
+	bootstrapGroupPrivate  = "private"
+)
+
+// bootstrapServer is a single bootstrap DNS server of a group.
+type bootstrapServer struct {
+	// ups is used to resolve the host names and to check the health.
+	ups upstream.Upstream
+
+	// lastCheck is the time of the latest health check or lookup.
+	lastCheck time.Time
+
+	// lastErr is the error of the latest health check or lookup, if any.
+	lastErr error
+
+	// addr is the address of the server as configured.
+	addr string
+
+	// healthy is false if the latest health check or lookup has failed.
+	healthy bool
+}
+
+// bootstrapResolution is the latest resolution of the host name of an
+// encrypted upstream.
+type bootstrapResolution struct {
+	// time is the time of the resolution.
+	time time.Time
+
+	// err is the error of the resolution, if all the servers have failed.
+	err error
+
+	// bootstrap is the address of the server that has answered, if any.
+	bootstrap string
+
+	// addrs are the resolved addresses.
+	addrs []netip.Addr
+}
+
+// bootstrapGroup resolves the host names of the encrypted upstreams of a single
+// upstream group.  It's safe for concurrent use.
+type bootstrapGroup struct {
+	// mu protects servers and resolutions.
+	mu *sync.Mutex
+
+	// resolutions are the latest resolutions by the host names.
+	resolutions map[string]*bootstrapResolution
+
+	// name is the name of the upstream group.
+	name string
+
+	// servers are the bootstrap servers in the configured order.
+	servers []*bootstrapServer
+
+	// timeout is the timeout for a single lookup or health check.
+	timeout time.Duration
+
+	// prefer is the address family of the resolved addresses to try first.
+	prefer AddrFamily
+
+	// fallback, if true, makes the group query the servers one by one in
+	// the configured order instead of querying all of them in parallel.
+	fallback bool
+
+	// ipv6Only, if true, makes the group only use the resolved IPv6
+	// addresses.
+	ipv6Only bool
+}
+
+// newBootstrapGroup returns a new properly initialized *bootstrapGroup.  All
+// the servers are considered healthy initially.
+func newBootstrapGroup(
+	name string,
+	addrs []string,
+	timeout time.Duration,
+	fallback bool,
+) (g *bootstrapGroup, err error) {
+	g = &bootstrapGroup{
+		mu:          &sync.Mutex{},
+		resolutions: map[string]*bootstrapResolution{},
+		name:        name,
+		servers:     make([]*bootstrapServer, 0, len(addrs)),
+		timeout:     timeout,
+		fallback:    fallback,
+	}
+
+	for _, addr := range addrs {
+		var u upstream.Upstream
+		u, err = upstream.AddressToUpstream(addr, &upstream.Options{Timeout: timeout})
+		if err != nil {
+			return nil, fmt.Errorf("bootstrap %q: %w", addr, err)
+		}
+
+		g.servers = append(g.servers, &bootstrapServer{
+			ups:     u,
+			addr:    addr,
+			healthy: true,
+		})
+	}
+
+	return g, nil
+}
+
+// close closes the upstreams of all the servers of g.
+func (g *bootstrapGroup) close() (err error) {
+	var errs []error
+	for _, srv := range g.servers {
+		closeErr := srv.ups.Close()
+		if closeErr != nil {
+			errs = append(errs, fmt.Errorf("bootstrap %q: %w", srv.addr, closeErr))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.List("closing bootstraps", errs...)
+	}
+
+	return nil
+}
+
+// ordered returns the servers of g, the healthy ones first, keeping the
+// configured order otherwise.
+func (g *bootstrapGroup) ordered() (servers []*bootstrapServer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	servers = slices.Clone(g.servers)
+	slices.SortStableFunc(servers, func(a, b *bootstrapServer) (sortsBefore bool) {
+		return a.healthy && !b.healthy
+	})
+
+	return servers
+}
+
+// report updates the health of srv according to the result of the latest
+// health check or lookup.
+func (g *bootstrapGroup) report(srv *bootstrapServer, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if srv.healthy && err != nil {
+		log.Info("dnsforward: %s bootstrap %q is unhealthy: %s", g.name, srv.addr, err)
+	} else if !srv.healthy && err == nil {
+		log.Info("dnsforward: %s bootstrap %q is healthy again", g.name, srv.addr)
+	}
+
+	srv.lastCheck = time.Now()
+	srv.lastErr = err
+	srv.healthy = err == nil
+}
+
+// lookupResult is the result of a lookup with a single bootstrap server.
+type lookupResult struct {
+	err   error
+	srv   *bootstrapServer
+	addrs []netip.Addr
+}
+
+// lookup resolves host using the bootstrap servers of g and records the
+// result.
+func (g *bootstrapGroup) lookup(host string) (addrs []netip.Addr, err error) {
+	servers := g.ordered()
+	if len(servers) == 0 {
+		return nil, errors.Error("no bootstrap servers")
+	}
+
+	var res *lookupResult
+	if g.fallback {
+		res = g.lookupInOrder(servers, host)
+	} else {
+		res = g.lookupParallel(servers, host)
+	}
+
+	r := &bootstrapResolution{
+		time:  time.Now(),
+		err:   res.err,
+		addrs: res.addrs,
+	}
+	if res.srv != nil {
+		r.bootstrap = res.srv.addr
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.resolutions[host] = r
+
+	return res.addrs, res.err
+}
+
+// lookupInOrder resolves host using servers one by one until one of them
+// succeeds.
+func (g *bootstrapGroup) lookupInOrder(servers []*bootstrapServer, host string) (res *lookupResult) {
+	var errs []error
+	for _, srv := range servers {
+		addrs, err := lookupHost(srv.ups, host)
+		g.report(srv, err)
+		if err == nil {
+			return &lookupResult{srv: srv, addrs: addrs}
+		}
+
+		errs = append(errs, fmt.Errorf("bootstrap %q: %w", srv.addr, err))
+	}
+
+	return &lookupResult{err: errors.List("all bootstraps failed", errs...)}
+}
+
+// lookupParallel resolves host using all servers at once and returns the first
+// successful result.
+func (g *bootstrapGroup) lookupParallel(servers []*bootstrapServer, host string) (res *lookupResult) {
+	resCh := make(chan *lookupResult, len(servers))
+	for _, srv := range servers {
+		go func(srv *bootstrapServer) {
+			defer log.OnPanic("dnsforward: bootstrap lookup")
+
+			addrs, err := lookupHost(srv.ups, host)
+			g.report(srv, err)
+			resCh <- &lookupResult{err: err, srv: srv, addrs: addrs}
+		}(srv)
+	}
+
+	var errs []error
+	for range servers {
+		res = <-resCh
+		if res.err == nil {
+			return res
+		}
+
+		errs = append(errs, fmt.Errorf("bootstrap %q: %w", res.srv.addr, res.err))
+	}
+
+	return &lookupResult{err: errors.List("all bootstraps failed", errs...)}
+}
+
+// lookupHost resolves the IPv4 and IPv6 addresses of host using u.
+func lookupHost(u upstream.Upstream, host string) (addrs []netip.Addr, err error) {
+	fqdn := dns.Fqdn(host)
+	for _, qt := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		req := &dns.Msg{
+			MsgHdr: dns.MsgHdr{
+				Id:               dns.Id(),
+				RecursionDesired: true,
+			},
+			Question: []dns.Question{{
+				Name:   fqdn,
+				Qtype:  qt,
+				Qclass: dns.ClassINET,
+			}},
+		}
+
+		var resp *dns.Msg
+		resp, err = u.Exchange(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rr := range resp.Answer {
+			var ip net.IP
+			switch rr := rr.(type) {
+			case *dns.A:
+				ip = rr.A
+			case *dns.AAAA:
+				ip = rr.AAAA
+			default:
+				continue
+			}
+
+			if addr, ok := netip.AddrFromSlice(ip); ok {
+				addrs = append(addrs, addr.Unmap())
+			}
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %q", host)
+	}
+
+	return addrs, nil
+}
+
+// checkHealth checks all the servers of g by resolving the root name servers.
+func (g *bootstrapGroup) checkHealth() {
+	for _, srv := range g.servers {
+		req := &dns.Msg{
+			MsgHdr: dns.MsgHdr{
+				Id:               dns.Id(),
+				RecursionDesired: true,
+			},
+			Question: []dns.Question{{
+				Name:   ".",
+				Qtype:  dns.TypeNS,
+				Qclass: dns.ClassINET,
+			}},
+		}
+
+		_, err := srv.ups.Exchange(req)
+		g.report(srv, err)
+	}
+}
+
+// encryptedUpstreamHost returns the host name of the encrypted upstream with
+// the address addr.  ok is false if addr isn't an address of an encrypted
+// upstream or its host is an IP address.
+func encryptedUpstreamHost(addr string) (host string, ok bool) {
+	if !strings.Contains(addr, "://") {
+		return "", false
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", false
+	}
+
+	switch u.Scheme {
+	case "tls", "https", "h3", "quic":
+		host = u.Hostname()
+		_, err = netip.ParseAddr(host)
+
+		return host, host != "" && err != nil
+	default:
+		return "", false
+	}
+}
+
+// bootstrapUpstreams wraps the encrypted upstreams of conf, which addresses
+// contain host names, so that those are resolved using g on the first
+// exchange.  lines are the upstream lines conf has been parsed from with opts.
+func (g *bootstrapGroup) bootstrapUpstreams(
+	conf *proxy.UpstreamConfig,
+	lines []string,
+	opts *upstream.Options,
+) {
+	// Match the upstreams of conf with their lines by the addresses, since
+	// the upstreams may normalize those.
+	linesByAddr := map[string]string{}
+	for _, l := range lines {
+		addr := l
+		if strings.HasPrefix(l, "[/") {
+			_, addr, _ = strings.Cut(l, "/]")
+		}
+
+		if _, ok := encryptedUpstreamHost(addr); !ok {
+			continue
+		}
+
+		u, err := upstream.AddressToUpstream(addr, opts.Clone())
+		if err != nil {
+			// Shouldn't happen, since conf has been parsed from lines.
+			continue
+		}
+
+		linesByAddr[u.Address()] = addr
+		_ = u.Close()
+	}
+
+	if len(linesByAddr) == 0 {
+		return
+	}
+
+	wrapped := map[upstream.Upstream]*bootstrappedUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			addr, ok := linesByAddr[u.Address()]
+			if !ok {
+				continue
+			}
+
+			w, ok := wrapped[u]
+			if !ok {
+				w = newBootstrappedUpstream(g, u, addr, opts)
+				wrapped[u] = w
+			}
+
+			ups[i] = w
+		}
+	}
+
+	wrap(conf.Upstreams)
+	for _, ups := range conf.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range conf.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+}
+
+// bootstrappedUpstream is an encrypted upstream, which host name is resolved
+// by a bootstrap group.  It falls back to the upstream resolving its host name
+// itself if the group fails.
+type bootstrappedUpstream struct {
+	// group resolves the host name of the upstream.
+	group *bootstrapGroup
+
+	// orig is the upstream resolving its host name itself.
+	orig upstream.Upstream
+
+	// opts are the options to create the resolved upstream with.
+	opts *upstream.Options
+
+	// once makes sure the host name is resolved only once.
+	once *sync.Once
+
+	// resolved is the upstream using the resolved addresses.  It's nil if the
+	// group has failed.
+	resolved upstream.Upstream
+
+	// addr is the address of the upstream as configured.
+	addr string
+
+	// host is the host name of the upstream.
+	host string
+}
+
+// newBootstrappedUpstream returns a new properly initialized
+// *bootstrappedUpstream.  addr must be an address of an encrypted upstream with
+// a host name.
+func newBootstrappedUpstream(
+	g *bootstrapGroup,
+	orig upstream.Upstream,
+	addr string,
+	opts *upstream.Options,
+) (u *bootstrappedUpstream) {
+	host, _ := encryptedUpstreamHost(addr)
+
+	return &bootstrappedUpstream{
+		group: g,
+		orig:  orig,
+		opts:  opts,
+		once:  &sync.Once{},
+		addr:  addr,
+		host:  host,
+	}
+}
+
+// type check
+var _ upstream.Upstream = (*bootstrappedUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *bootstrappedUpstream.
+func (u *bootstrappedUpstream) Exchange(m *dns.Msg) (resp *dns.Msg, err error) {
+	u.once.Do(u.resolve)
+	if u.resolved != nil {
+		return u.resolved.Exchange(m)
+	}
+
+	return u.orig.Exchange(m)
+}
+
+// resolve resolves the host name of u and creates the resolved upstream.
+func (u *bootstrappedUpstream) resolve() {
+	addrs, err := u.group.lookup(u.host)
+	if err != nil {
+		log.Info("dnsforward: %s upstream %q: resolving %q: %s", u.group.name, u.addr, u.host, err)
+
+		return
+	}
+
+	addrs = orderAddrs(addrs, u.group.prefer, u.group.ipv6Only)
+	if len(addrs) == 0 {
+		log.Info("dnsforward: %s upstream %q: no ipv6 addresses for %q", u.group.name, u.addr, u.host)
+
+		return
+	}
+
+	opts := u.opts.Clone()
+	opts.ServerIPAddrs = make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		opts.ServerIPAddrs = append(opts.ServerIPAddrs, a.AsSlice())
+	}
+
+	u.resolved, err = upstream.AddressToUpstream(u.addr, opts)
+	if err != nil {
+		log.Info("dnsforward: %s upstream %q: %s", u.group.name, u.addr, err)
+	}
+}
+
+// Address implements the [upstream.Upstream] interface for
+// *bootstrappedUpstream.
+func (u *bootstrappedUpstream) Address() (addr string) {
+	return u.orig.Address()
+}
+
+// Close implements the [upstream.Upstream] interface for
+// *bootstrappedUpstream.
+func (u *bootstrappedUpstream) Close() (err error) {
+	// Prevent the resolution after closing.
+	u.once.Do(func() {})
+
+	err = u.orig.Close()
+	if u.resolved != nil {
+		err = errors.WithDeferred(err, u.resolved.Close())
+	}
+
+	return err
+}
+
+// bootstrapServerJSON is the status of a single bootstrap server in the
+// response to the GET /control/bootstrap/status HTTP API.
+type bootstrapServerJSON struct {
+	// LastCheck is the time of the latest health check or lookup, if any.
+	LastCheck *time.Time `json:"last_check,omitempty"`
+
+	// Address is the address of the server as configured.
+	Address string `json:"address"`
+
+	// Error is the error of the latest health check or lookup, if any.
+	Error string `json:"error,omitempty"`
+
+	// Healthy is false if the latest health check or lookup has failed.
+	Healthy bool `json:"healthy"`
+}
+
+// bootstrapResolutionJSON is the latest resolution of an upstream host name in
+// the response to the GET /control/bootstrap/status HTTP API.
+type bootstrapResolutionJSON struct {
+	// Time is the time of the resolution.
+	Time time.Time `json:"time"`
+
+	// Host is the resolved host name.
+	Host string `json:"host"`
+
+	// Bootstrap is the address of the server that has answered.  It's empty
+	// if all the servers have failed.
+	Bootstrap string `json:"bootstrap,omitempty"`
+
+	// Error is the error of the resolution, if any.
+	Error string `json:"error,omitempty"`
+
+	// Addresses are the resolved addresses.
+	Addresses []netip.Addr `json:"addresses"`
+}
+
+// bootstrapGroupJSON is the status of a bootstrap group in the response to the
+// GET /control/bootstrap/status HTTP API.
+type bootstrapGroupJSON struct {
+	// Name is the name of the upstream group.
+	Name string `json:"name"`
+
+	// Servers are the bootstrap servers in the configured order.
+	Servers []*bootstrapServerJSON `json:"servers"`
+
+	// Resolutions are the latest resolutions sorted by the host names.
+	Resolutions []*bootstrapResolutionJSON `json:"resolutions"`
+
+	// Fallback is true if the servers are queried one by one.
+	Fallback bool `json:"fallback"`
+}
+
+// toJSON returns the status of g.
+func (g *bootstrapGroup) toJSON() (j *bootstrapGroupJSON) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	j = &bootstrapGroupJSON{
+		Name:        g.name,
+		Servers:     make([]*bootstrapServerJSON, 0, len(g.servers)),
+		Resolutions: make([]*bootstrapResolutionJSON, 0, len(g.resolutions)),
+		Fallback:    g.fallback,
+	}
+
+	for _, srv := range g.servers {
+		sj := &bootstrapServerJSON{
+			Address: srv.addr,
+			Healthy: srv.healthy,
+		}
+
+		if !srv.lastCheck.IsZero() {
+			lastCheck := srv.lastCheck
+			sj.LastCheck = &lastCheck
+		}
+
+		if srv.lastErr != nil {
+			sj.Error = srv.lastErr.Error()
+		}
+
+		j.Servers = append(j.Servers, sj)
+	}
+
+	for host, r := range g.resolutions {
+		rj := &bootstrapResolutionJSON{
+			Time:      r.time,
+			Host:      host,
+			Bootstrap: r.bootstrap,
+			Addresses: slices.Clone(r.addrs),
+		}
+
+		if r.err != nil {
+			rj.Error = r.err.Error()
+		}
+
+		j.Resolutions = append(j.Resolutions, rj)
+	}
+
+	slices.SortFunc(j.Resolutions, func(a, b *bootstrapResolutionJSON) (sortsBefore bool) {
+		return a.Host < b.Host
+	})
+
+	return j
+}
+
+// bootstrapStatusJSON is the response to the GET /control/bootstrap/status
+// HTTP API.
+type bootstrapStatusJSON struct {
+	Groups []*bootstrapGroupJSON `json:"groups"`
+}
+
+// handleBootstrapStatus is the handler for the GET /control/bootstrap/status
+// HTTP API.
+func (s *Server) handleBootstrapStatus(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	groups := slices.Clone(s.bootstraps)
+	s.serverLock.RUnlock()
+
+	resp := &bootstrapStatusJSON{
+		Groups: make([]*bootstrapGroupJSON, 0, len(groups)),
+	}
+
+	for _, g := range groups {
+		resp.Groups = append(resp.Groups, g.toJSON())
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// newBootstrapGroup creates a new bootstrap group from the configuration of s
+// and adds it to the groups of s.
+func (s *Server) newBootstrapGroup(
+	name string,
+	addrs []string,
+	timeout time.Duration,
+) (g *bootstrapGroup, err error) {
+	g, err = newBootstrapGroup(name, addrs, timeout, s.conf.BootstrapFallback)
+	if err != nil {
+		return nil, fmt.Errorf("preparing %s bootstraps: %w", name, err)
+	}
+
+	g.prefer, g.ipv6Only = s.conf.UpstreamPreferFamily, s.conf.IPv6Only
+
+	s.bootstraps = append(s.bootstraps, g)
+
+	return g, nil
+}
+
+// closeBootstraps closes and removes the bootstrap groups of s.
+func (s *Server) closeBootstraps() {
+	for _, g := range s.bootstraps {
+		err := g.close()
+		if err != nil {
+			log.Debug("dnsforward: closing %s bootstraps: %s", g.name, err)
+		}
+	}
+
+	s.bootstraps = nil
+}
+
+// startBootstrapChecks starts the periodic health checks of the bootstrap
+// groups of s, if enabled.  s.serverLock is expected to be locked.
+func (s *Server) startBootstrapChecks() {
+	ivl := s.conf.BootstrapHealthCheckInterval.Duration
+	if ivl <= 0 || len(s.bootstraps) == 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	s.bootstrapCheckDone = done
+
+	go runBootstrapChecks(slices.Clone(s.bootstraps), ivl, done)
+}
+
+// stopBootstrapChecks stops the periodic health checks of the bootstrap groups
+// of s, if running.  s.serverLock is expected to be locked.
+func (s *Server) stopBootstrapChecks() {
+	if s.bootstrapCheckDone != nil {
+		close(s.bootstrapCheckDone)
+		s.bootstrapCheckDone = nil
+	}
+}
+
+// runBootstrapChecks checks the health of groups every ivl until done is closed.
+// It's intended to be used as a goroutine.
+func runBootstrapChecks(groups []*bootstrapGroup, ivl time.Duration, done <-chan struct{}) {
+	defer log.OnPanic("dnsforward: checking bootstraps")
+
+	ticker := time.NewTicker(ivl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for _, g := range groups {
+				g.checkHealth()
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBootstrapGroup returns a new *bootstrapGroup with the servers using
+// ups in the given order.
+func newTestBootstrapGroup(fallback bool, ups ...upstream.Upstream) (g *bootstrapGroup) {
+	g = &bootstrapGroup{
+		mu:          &sync.Mutex{},
+		resolutions: map[string]*bootstrapResolution{},
+		name:        bootstrapGroupUpstream,
+		fallback:    fallback,
+	}
+
+	for _, u := range ups {
+		g.servers = append(g.servers, &bootstrapServer{
+			ups:     u,
+			addr:    u.Address(),
+			healthy: true,
+		})
+	}
+
+	return g
+}
+
+func TestBootstrapGroup_lookup(t *testing.T) {
+	const host = "dns.example"
+
+	wantAddr := netip.MustParseAddr("1.2.3.4")
+
+	good := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		resp = (&dns.Msg{}).SetReply(req)
+		if req.Question[0].Qtype == dns.TypeA {
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: wantAddr.AsSlice(),
+			}}
+		}
+
+		return resp, nil
+	})
+	bad := aghtest.NewErrorUpstream()
+
+	testCases := []struct {
+		name     string
+		fallback bool
+	}{{
+		name:     "fallback",
+		fallback: true,
+	}, {
+		name:     "parallel",
+		fallback: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestBootstrapGroup(tc.fallback, bad, good)
+
+			addrs, err := g.lookup(host)
+			require.NoError(t, err)
+
+			assert.Equal(t, []netip.Addr{wantAddr}, addrs)
+
+			status := g.toJSON()
+			require.Len(t, status.Resolutions, 1)
+			require.Len(t, status.Servers, 2)
+
+			res := status.Resolutions[0]
+			assert.Equal(t, host, res.Host)
+			assert.Equal(t, good.Address(), res.Bootstrap)
+			assert.Empty(t, res.Error)
+
+			assert.True(t, status.Servers[1].Healthy)
+			if tc.fallback {
+				// The bad server is queried first.
+				assert.False(t, status.Servers[0].Healthy)
+				assert.NotEmpty(t, status.Servers[0].Error)
+			}
+		})
+	}
+
+	t.Run("all_bad", func(t *testing.T) {
+		g := newTestBootstrapGroup(true, bad)
+
+		_, err := g.lookup(host)
+		assert.ErrorIs(t, err, aghtest.ErrUpstream)
+
+		status := g.toJSON()
+		require.Len(t, status.Resolutions, 1)
+
+		assert.Empty(t, status.Resolutions[0].Bootstrap)
+		assert.NotEmpty(t, status.Resolutions[0].Error)
+	})
+}
+
+func TestBootstrapGroup_ordered(t *testing.T) {
+	first := aghtest.NewUpstreamMock(nil)
+	first.OnAddress = func() (addr string) { return "first.example" }
+
+	second := aghtest.NewUpstreamMock(nil)
+	second.OnAddress = func() (addr string) { return "second.example" }
+
+	g := newTestBootstrapGroup(true, first, second)
+
+	servers := g.ordered()
+	require.Len(t, servers, 2)
+
+	assert.Equal(t, "first.example", servers[0].addr)
+	assert.Equal(t, "second.example", servers[1].addr)
+
+	g.report(g.servers[0], aghtest.ErrUpstream)
+
+	servers = g.ordered()
+	require.Len(t, servers, 2)
+
+	assert.Equal(t, "second.example", servers[0].addr)
+	assert.Equal(t, "first.example", servers[1].addr)
+}
+
+func TestEncryptedUpstreamHost(t *testing.T) {
+	testCases := []struct {
+		name     string
+		addr     string
+		wantHost string
+		wantOK   bool
+	}{{
+		name:     "plain",
+		addr:     "8.8.8.8",
+		wantHost: "",
+		wantOK:   false,
+	}, {
+		name:     "plain_hostname",
+		addr:     "tcp://dns.example",
+		wantHost: "",
+		wantOK:   false,
+	}, {
+		name:     "dot_ip",
+		addr:     "tls://1.1.1.1",
+		wantHost: "",
+		wantOK:   false,
+	}, {
+		name:     "dot",
+		addr:     "tls://dns.example",
+		wantHost: "dns.example",
+		wantOK:   true,
+	}, {
+		name:     "doh",
+		addr:     "https://dns.example/dns-query",
+		wantHost: "dns.example",
+		wantOK:   true,
+	}, {
+		name:     "doh3",
+		addr:     "h3://dns.example/dns-query",
+		wantHost: "dns.example",
+		wantOK:   true,
+	}, {
+		name:     "doq",
+		addr:     "quic://dns.example:853",
+		wantHost: "dns.example",
+		wantOK:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			host, ok := encryptedUpstreamHost(tc.addr)
+			assert.Equal(t, tc.wantOK, ok)
+			if ok {
+				assert.Equal(t, tc.wantHost, host)
+			}
+		})
+	}
+}
+
+func TestBootstrapGroup_bootstrapUpstreams(t *testing.T) {
+	lines := []string{
+		"8.8.8.8",
+		"tls://dns.example",
+		"[/example.org/]https://dns.example/dns-query",
+	}
+	opts := &upstream.Options{}
+
+	conf, err := proxy.ParseUpstreamsConfig(lines, opts)
+	require.NoError(t, err)
+
+	g := newTestBootstrapGroup(false)
+	g.bootstrapUpstreams(conf, lines, opts)
+
+	require.Len(t, conf.Upstreams, 2)
+
+	_, ok := conf.Upstreams[0].(*bootstrappedUpstream)
+	assert.False(t, ok)
+
+	assert.IsType(t, (*bootstrappedUpstream)(nil), conf.Upstreams[1])
+	assert.Equal(t, "tls://dns.example:853", conf.Upstreams[1].Address())
+
+	domainUps := conf.DomainReservedUpstreams["example.org."]
+	require.Len(t, domainUps, 1)
+
+	assert.IsType(t, (*bootstrappedUpstream)(nil), domainUps[0])
+}
@@ -114,10 +114,46 @@ type FilteringConfig struct {
 	// DNS servers.
 	UpstreamDNSFileName string `yaml:"upstream_dns_file"`
 
+	// FallbackDNS is the list of fallback DNS servers.  Those are only used
+	// if the upstream DNS servers fail to respond or respond with SERVFAIL.
+	FallbackDNS []string `yaml:"fallback_dns"`
+
 	// BootstrapDNS is the list of bootstrap DNS servers for DoH and DoT
 	// resolvers (plain DNS only).
 	BootstrapDNS []string `yaml:"bootstrap_dns"`
 
+	// PrivateBootstrapDNS is the list of bootstrap DNS servers for the DoH
+	// and DoT resolvers of the private reverse DNS.  If empty, BootstrapDNS is
+	// used.
+	PrivateBootstrapDNS []string `yaml:"private_bootstrap_dns"`
+
+	// BootstrapFallback, if true, makes the bootstrap DNS servers queried one
+	// by one in the configured order instead of all at once.
+	BootstrapFallback bool `yaml:"bootstrap_fallback"`
+
+	// UpstreamPreferFamily is the address family of the upstreams, which host
+	// names are resolved by the bootstrap DNS servers, to try first.
+	UpstreamPreferFamily AddrFamily `yaml:"upstream_prefer_family"`
+
+	// IPv6Only, if true, makes the server operate without IPv4: the IPv4
+	// addresses of the upstreams aren't used, and the defaults of the listen
+	// addresses and the bootstrap DNS servers are the IPv6 ones.
+	IPv6Only bool `yaml:"ipv6_only"`
+
+	// QNAMEMinimization, if true, makes the server not send the full question
+	// names to the general upstreams.  Those are only asked for the
+	// nameservers of the registrable domains, and the rest of the names are
+	// resolved following the delegations, see RFC 9156.  The authoritative
+	// nameservers are queried over plain DNS, so it can only be used with the
+	// plain DNS general upstreams.  The requests with the DO, AD, or CD bits
+	// aren't minimized, since the responses aren't validated.
+	QNAMEMinimization bool `yaml:"qname_minimization"`
+
+	// BootstrapHealthCheckInterval is the interval between the health checks
+	// of the bootstrap DNS servers.  If zero, the servers are only checked by
+	// the resolutions.
+	BootstrapHealthCheckInterval timeutil.Duration `yaml:"bootstrap_health_check_interval"`
+
 	// AllServers, if true, parallel queries to all configured upstream servers
 	// are enabled.
 	AllServers bool `yaml:"all_servers"`
@@ -143,6 +179,50 @@ type FilteringConfig struct {
 	// BlockedHosts is the list of hosts that should be blocked.
 	BlockedHosts []string `yaml:"blocked_hosts"`
 
+	// DisallowedClientsSchedule are the clients, which are blocked only within
+	// the time windows.  Those are applied in both allowlist and blocklist
+	// modes.
+	DisallowedClientsSchedule []*AccessSchedule `yaml:"disallowed_clients_schedule"`
+
+	// RefusedQueryTypes are the names of the query types refused for all
+	// clients, for example "ANY".
+	RefusedQueryTypes []string `yaml:"refused_query_types"`
+
+	// RefusedQueryTypesClients are the query types refused for particular
+	// clients.
+	RefusedQueryTypesClients []*AccessQueryTypes `yaml:"refused_query_types_clients"`
+
+	// QuarantineIP is the default IP address the queries of the quarantined
+	// clients are resolved to, for example the address of a notice page.
+	QuarantineIP netip.Addr `yaml:"quarantine_ip"`
+
+	// ParentalBypassPIN is the bcrypt hash of the PIN, which temporarily
+	// disables the parental control and the safe search for the client, which
+	// has sent it.  If empty, the bypass is disabled.
+	ParentalBypassPIN string `yaml:"parental_bypass_pin"`
+
+	// ParentalBypassDuration is the default duration of the parental control
+	// bypass.  If zero, [defaultParentalBypassDuration] is used.
+	ParentalBypassDuration timeutil.Duration `yaml:"parental_bypass_duration"`
+
+	// TunnelDetection is the configuration of the DNS tunneling detection.
+	TunnelDetection TunnelDetectionConfig `yaml:"tunnel_detection"`
+
+	// RebindingProtectionEnabled defines if the upstream responses resolving
+	// non-local domain names to the addresses from the locally-served networks
+	// should be refused.
+	RebindingProtectionEnabled bool `yaml:"rebinding_protection_enabled"`
+
+	// RebindingAllowedDomains are the domain names, which, along with their
+	// subdomains, are allowed to resolve to the addresses from the
+	// locally-served networks when the rebinding protection is enabled.
+	RebindingAllowedDomains []string `yaml:"rebinding_allowed_domains"`
+
+	// SingleLabelPolicy defines how the queries for the single-label
+	// hostnames are handled.  An empty value is the same as
+	// [SingleLabelPolicyForward].
+	SingleLabelPolicy SingleLabelPolicy `yaml:"single_label_policy"`
+
 	// TrustedProxies is the list of IP addresses and CIDR networks to detect
 	// proxy servers addresses the DoH requests from which should be handled.
 	// The value of nil or an empty slice for this field makes Proxy not trust
@@ -165,6 +245,26 @@ type FilteringConfig struct {
 	// CacheOptimistic defines if optimistic cache mechanism should be used.
 	CacheOptimistic bool `yaml:"cache_optimistic"`
 
+	// CacheShards is the number of the independently locked shards the DNS
+	// cache is split into, which reduces the lock contention under multi-core
+	// load.  Zero and one mean that the cache isn't sharded.  The sharded
+	// cache can't be used with the optimistic cache and the EDNS Client
+	// Subnet.
+	CacheShards uint32 `yaml:"cache_shards"`
+
+	// CacheNegativeTTLMin is the minimum TTL of the cached negative responses,
+	// that is NXDOMAIN and NODATA ones, in seconds.
+	CacheNegativeTTLMin uint32 `yaml:"cache_negative_ttl_min"`
+
+	// CacheNegativeTTLMax is the maximum TTL of the cached negative responses
+	// in seconds.  Zero means that the TTL from the SOA record is used.
+	CacheNegativeTTLMax uint32 `yaml:"cache_negative_ttl_max"`
+
+	// CacheServFailTTL is the time in seconds for which a failure to resolve
+	// a question is cached, so that the upstreams aren't queried for it
+	// again.  Zero disables caching of the failures.
+	CacheServFailTTL uint32 `yaml:"cache_servfail_ttl"`
+
 	// Other settings
 
 	// BogusNXDomain is the list of IP addresses, responses with them will be
@@ -269,6 +369,27 @@ type ServerConfig struct {
 	UpstreamConfig *proxy.UpstreamConfig // Upstream DNS servers config
 	OnDNSRequest   func(d *proxy.DNSContext)
 
+	// FallbackUpstreamConfig is the configuration of the fallback upstream DNS
+	// servers.  It's nil if there are none.
+	FallbackUpstreamConfig *proxy.UpstreamConfig
+
+	// OnBlocked, if not nil, is called for each request blocked by the
+	// filtering with the possibly anonymized client's IP address.  It must not
+	// block.
+	OnBlocked func(host string, ip net.IP, clientID string, res *filtering.Result)
+
+	// OnParentalBypass, if not nil, is called for each attempt to start the
+	// parental control bypass.  It must not block.
+	OnParentalBypass func(e *ParentalBypassEvent)
+
+	// OnTunnelSuspected, if not nil, is called for each client newly
+	// suspected of DNS tunneling.  It must not block.
+	OnTunnelSuspected func(e *TunnelSuspectEvent)
+
+	// QueryHook, if not nil, is called for each request after the filtering
+	// to let it override the decision.
+	QueryHook QueryHook
+
 	FilteringConfig
 	TLSConfig
 	DNSCryptConfig
@@ -343,12 +464,19 @@ func (s *Server) createProxyConfig() (conf proxy.Config, err error) {
 		DNS64Prefs:             srvConf.DNS64Prefixes,
 	}
 
+	if len(s.socketFiles) > 0 {
+		// The plain DNS requests are received from the sockets passed by
+		// the service manager.
+		conf.UDPListenAddr, conf.TCPListenAddr = nil, nil
+	}
+
 	if srvConf.EDNSClientSubnet.UseCustom {
 		// TODO(s.chzhen):  Use netip.Addr instead of net.IP inside dnsproxy.
 		conf.EDNSAddr = net.IP(srvConf.EDNSClientSubnet.CustomIP.AsSlice())
 	}
 
-	if srvConf.CacheSize != 0 {
+	// The sharded cache replaces the one of dnsproxy, see [Server.resolve].
+	if srvConf.CacheSize != 0 && srvConf.CacheShards < 2 {
 		conf.CacheEnabled = true
 		conf.CacheSizeBytes = int(srvConf.CacheSize)
 	}
@@ -405,6 +533,9 @@ func (s *Server) initDefaultSettings() {
 
 	if len(s.conf.BootstrapDNS) == 0 {
 		s.conf.BootstrapDNS = defaultBootstrap
+		if s.conf.IPv6Only {
+			s.conf.BootstrapDNS = defaultBootstrapIPv6
+		}
 	}
 
 	if s.conf.ParentalBlockHost == "" {
@@ -471,40 +602,63 @@ func (s *Server) prepareUpstreamSettings() error {
 		upstreams = s.conf.UpstreamDNS
 	}
 
-	httpVersions := UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams)
+	bootstrap, err := s.newBootstrapGroup(bootstrapGroupUpstream, s.conf.BootstrapDNS, s.conf.UpstreamTimeout)
+	if err != nil {
+		return err
+	}
+
+	opts := &upstream.Options{
+		Bootstrap:    s.conf.BootstrapDNS,
+		Timeout:      s.conf.UpstreamTimeout,
+		HTTPVersions: UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams),
+	}
+
 	upstreams = stringutil.FilterOut(upstreams, IsCommentOrEmpty)
-	upstreamConfig, err := proxy.ParseUpstreamsConfig(
-		upstreams,
-		&upstream.Options{
-			Bootstrap:    s.conf.BootstrapDNS,
-			Timeout:      s.conf.UpstreamTimeout,
-			HTTPVersions: httpVersions,
-		},
-	)
+	upstreamConfig, err := proxy.ParseUpstreamsConfig(upstreams, opts)
 	if err != nil {
 		return fmt.Errorf("parsing upstream config: %w", err)
 	}
 
+	bootstrap.bootstrapUpstreams(upstreamConfig, upstreams, opts)
+
 	if len(upstreamConfig.Upstreams) == 0 {
 		log.Info("warning: no default upstream servers specified, using %v", defaultDNS)
 		var uc *proxy.UpstreamConfig
-		uc, err = proxy.ParseUpstreamsConfig(
-			defaultDNS,
-			&upstream.Options{
-				Bootstrap:    s.conf.BootstrapDNS,
-				Timeout:      s.conf.UpstreamTimeout,
-				HTTPVersions: httpVersions,
-			},
-		)
+		uc, err = proxy.ParseUpstreamsConfig(defaultDNS, opts)
 		if err != nil {
 			return fmt.Errorf("parsing default upstreams: %w", err)
 		}
 
+		bootstrap.bootstrapUpstreams(uc, defaultDNS, opts)
 		upstreamConfig.Upstreams = uc.Upstreams
 	}
 
+	if s.conf.QNAMEMinimization {
+		err = wrapQNAMEMin(upstreamConfig, s.conf.UpstreamTimeout, s.conf.IPv6Only)
+		if err != nil {
+			return err
+		}
+	}
+
+	wrapNegativeTTL(upstreamConfig, s.conf.CacheNegativeTTLMin, s.conf.CacheNegativeTTLMax)
+
 	s.conf.UpstreamConfig = upstreamConfig
 
+	fallbacks := stringutil.FilterOut(s.conf.FallbackDNS, IsCommentOrEmpty)
+	if len(fallbacks) == 0 {
+		s.conf.FallbackUpstreamConfig = nil
+
+		return nil
+	}
+
+	fallbackConfig, err := proxy.ParseUpstreamsConfig(fallbacks, opts)
+	if err != nil {
+		return fmt.Errorf("parsing fallback upstream config: %w", err)
+	}
+
+	bootstrap.bootstrapUpstreams(fallbackConfig, fallbacks, opts)
+	s.conf.FallbackUpstreamConfig = fallbackConfig
+
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package dnsforward
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+)
+
+// Counters are the cumulative counters of the requests processed by the DNS
+// server since AdGuard Home has started.  Unlike the statistics, those are
+// never reset.
+type Counters struct {
+	// Upstreams are the counters of the upstream servers sorted by their
+	// addresses.
+	Upstreams []*UpstreamCounters
+
+	// Queries is the number of the processed requests.
+	Queries uint64
+
+	// Blocked is the number of the filtered requests.
+	Blocked uint64
+
+	// CacheHits is the number of the requests answered from the cache.
+	CacheHits uint64
+
+	// UpstreamQueries is the number of the requests resolved by the upstream
+	// servers.
+	UpstreamQueries uint64
+}
+
+// UpstreamCounters are the cumulative counters of a single upstream server.
+type UpstreamCounters struct {
+	// Address is the address of the upstream server.
+	Address string
+
+	// Queries is the number of the requests resolved by the upstream server.
+	Queries uint64
+
+	// TotalTime is the total processing time of those requests.
+	TotalTime time.Duration
+}
+
+// counters are the counters of the requests processed by the DNS server.
+type counters struct {
+	// upstreamsMu protects upstreams.
+	upstreamsMu sync.Mutex
+
+	// upstreams are the counters of the upstream servers by their addresses.
+	upstreams map[string]*UpstreamCounters
+
+	queries         atomic.Uint64
+	blocked         atomic.Uint64
+	cacheHits       atomic.Uint64
+	upstreamQueries atomic.Uint64
+}
+
+// update updates the counters with the request processed within elapsed.
+func (c *counters) update(pctx *proxy.DNSContext, blocked bool, elapsed time.Duration) {
+	c.queries.Add(1)
+	if blocked {
+		c.blocked.Add(1)
+	}
+
+	if pctx.Upstream == nil {
+		if pctx.CachedUpstreamAddr != "" {
+			c.cacheHits.Add(1)
+		}
+
+		return
+	}
+
+	c.upstreamQueries.Add(1)
+
+	addr := pctx.Upstream.Address()
+
+	c.upstreamsMu.Lock()
+	defer c.upstreamsMu.Unlock()
+
+	if c.upstreams == nil {
+		c.upstreams = map[string]*UpstreamCounters{}
+	}
+
+	uc, ok := c.upstreams[addr]
+	if !ok {
+		uc = &UpstreamCounters{
+			Address: addr,
+		}
+		c.upstreams[addr] = uc
+	}
+
+	uc.Queries++
+	uc.TotalTime += elapsed
+}
+
+// Counters returns the current values of the cumulative counters.
+func (s *Server) Counters() (c *Counters) {
+	sc := &s.counters
+	c = &Counters{
+		Queries:         sc.queries.Load(),
+		Blocked:         sc.blocked.Load(),
+		CacheHits:       sc.cacheHits.Load(),
+		UpstreamQueries: sc.upstreamQueries.Load(),
+	}
+
+	sc.upstreamsMu.Lock()
+	defer sc.upstreamsMu.Unlock()
+
+	c.Upstreams = make([]*UpstreamCounters, 0, len(sc.upstreams))
+	for _, uc := range sc.upstreams {
+		ucCopy := *uc
+		c.Upstreams = append(c.Upstreams, &ucCopy)
+	}
+
+	sort.Slice(c.Upstreams, func(i, j int) bool {
+		return c.Upstreams[i].Address < c.Upstreams[j].Address
+	})
+
+	return c
+}
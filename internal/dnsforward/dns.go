@@ -11,6 +11,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/proxyutil"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
@@ -66,6 +67,10 @@ type dnsContext struct {
 	// responseAD shows if the response had the AD bit set.
 	responseAD bool
 
+	// responseFromFallback shows if the response is received from the
+	// fallback upstream servers.
+	responseFromFallback bool
+
 	// isLocalClient shows if client's IP address is from locally served
 	// network.
 	isLocalClient bool
@@ -98,30 +103,13 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 		startTime: time.Now(),
 	}
 
-	type modProcessFunc func(ctx *dnsContext) (rc resultCode)
-
 	// Since (*dnsforward.Server).handleDNSRequest(...) is used as
 	// proxy.(Config).RequestHandler, there is no need for additional index
 	// out of range checking in any of the following functions, because the
 	// (*proxy.Proxy).handleDNSRequest method performs it before calling the
 	// appropriate handler.
-	mods := []modProcessFunc{
-		s.processRecursion,
-		s.processInitial,
-		s.processDDRQuery,
-		s.processDetermineLocal,
-		s.processDHCPHosts,
-		s.processRestrictLocal,
-		s.processDHCPAddrs,
-		s.processFilteringBeforeRequest,
-		s.processLocalPTR,
-		s.processUpstream,
-		s.processFilteringAfterResponse,
-		s.ipset.process,
-		s.processQueryLogsAndStats,
-	}
-	for _, process := range mods {
-		r := process(dctx)
+	for _, stage := range s.processStages() {
+		r := stage.process(dctx)
 		switch r {
 		case resultCodeSuccess:
 			// continue: call the next filter
@@ -142,6 +130,55 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 	return nil
 }
 
+// modProcessFunc is a function processing the request within dctx.
+type modProcessFunc func(dctx *dnsContext) (rc resultCode)
+
+// processStage is a named stage of the processing of a request.
+type processStage struct {
+	// process processes the request.
+	process modProcessFunc
+
+	// preview, if not nil, is used by the lookup tool instead of process.
+	// It must not change the state outside of the request.
+	preview modProcessFunc
+
+	// name is the name of the stage reported by the lookup tool.
+	name string
+
+	// sideEffects is true if the stage changes the state outside of the
+	// request, like the query log, so the lookup tool skips it.
+	sideEffects bool
+}
+
+// processStages returns the stages of the processing of a request in the order
+// of their execution.
+func (s *Server) processStages() (stages []processStage) {
+	return []processStage{
+		{process: s.processRecursion, name: "recursion"},
+		{process: s.processInitial, name: "initial"},
+		{process: s.processDDRQuery, name: "ddr"},
+		{
+			process: s.processParentalBypass,
+			preview: s.previewParentalBypass,
+			name:    "parental_bypass",
+		},
+		{process: s.processTunnelDetection, name: "tunnel_detection", sideEffects: true},
+		{process: s.processDetermineLocal, name: "determine_local"},
+		{process: s.processDHCPHosts, name: "dhcp_hosts"},
+		{process: s.processRestrictLocal, name: "restrict_local"},
+		{process: s.processDHCPAddrs, name: "dhcp_addrs"},
+		{process: s.processQuarantine, name: "quarantine"},
+		{process: s.processFilteringBeforeRequest, name: "filtering_before_request"},
+		{process: s.processLocalPTR, name: "local_ptr"},
+		{process: s.processSingleLabel, name: "single_label"},
+		{process: s.processUpstream, name: "upstream"},
+		{process: s.processRebindingProtection, name: "rebinding_protection"},
+		{process: s.processFilteringAfterResponse, name: "filtering_after_response"},
+		{process: s.ipset.process, name: "ipset", sideEffects: true},
+		{process: s.processQueryLogsAndStats, name: "query_log_and_stats", sideEffects: true},
+	}
+}
+
 // processRecursion checks the incoming request and halts its handling by
 // answering NXDOMAIN if s has tried to resolve it recently.
 func (s *Server) processRecursion(dctx *dnsContext) (rc resultCode) {
@@ -230,22 +267,31 @@ func (s *Server) onDHCPLeaseChanged(flags int) {
 	switch flags {
 	case dhcpd.LeaseChangedAdded,
 		dhcpd.LeaseChangedAddedStatic,
-		dhcpd.LeaseChangedRemovedStatic:
+		dhcpd.LeaseChangedRemovedStatic,
+		dhcpd.LeaseChangedRemovedDynamic,
+		dhcpd.LeaseChangedDeclined:
 		// Go on.
 	case dhcpd.LeaseChangedRemovedAll:
 		s.setTableHostToIP(nil)
 		s.setTableIPToHost(nil)
+		s.scheduleDHCPCleanup(time.Time{})
 
 		return
 	default:
 		return
 	}
 
+	// The expired leases aren't returned, so their records are removed.
 	ll := s.dhcpServer.Leases(dhcpd.LeasesAll)
 	hostToIP := make(hostToIPTable, len(ll))
 	ipToHost := make(ipToHostTable, len(ll))
 
+	var nextExpiry time.Time
 	for _, l := range ll {
+		if !l.IsStatic() && (nextExpiry.IsZero() || l.Expiry.Before(nextExpiry)) {
+			nextExpiry = l.Expiry
+		}
+
 		// TODO(a.garipov): Remove this after we're finished with the client
 		// hostname validations in the DHCP server code.
 		err := netutil.ValidateHostname(l.Hostname)
@@ -272,10 +318,34 @@ func (s *Server) onDHCPLeaseChanged(flags int) {
 
 	s.setTableHostToIP(hostToIP)
 	s.setTableIPToHost(ipToHost)
+	s.scheduleDHCPCleanup(nextExpiry)
 
 	log.Debug("dnsforward: added %d a and ptr entries from dhcp", len(ipToHost))
 }
 
+// scheduleDHCPCleanup makes s rebuild the tables of the DHCP hosts at exp, when
+// the earliest of the dynamic leases expires, since the DHCP server doesn't
+// notify about the expired leases.  A zero exp cancels the scheduled rebuild.
+func (s *Server) scheduleDHCPCleanup(exp time.Time) {
+	s.dhcpCleanupLock.Lock()
+	defer s.dhcpCleanupLock.Unlock()
+
+	if s.dhcpCleanup != nil {
+		s.dhcpCleanup.Stop()
+		s.dhcpCleanup = nil
+	}
+
+	if exp.IsZero() {
+		return
+	}
+
+	s.dhcpCleanup = time.AfterFunc(time.Until(exp), func() {
+		log.Debug("dnsforward: removing expired dhcp entries")
+
+		s.onDHCPLeaseChanged(dhcpd.LeaseChangedRemovedDynamic)
+	})
+}
+
 // processDDRQuery responds to Discovery of Designated Resolvers (DDR) SVCB
 // queries.  The response contains different types of encryption supported by
 // current user configuration.
@@ -714,6 +784,38 @@ func (s *Server) processFilteringBeforeRequest(ctx *dnsContext) (rc resultCode)
 	return resultCodeSuccess
 }
 
+// isUnroutedMDNSQ returns true if the request is a Multicast DNS name query,
+// which should be resolved locally according to the client's settings, and
+// there are no upstreams specified for the Multicast DNS domain.
+func (s *Server) isUnroutedMDNSQ(dctx *dnsContext) (ok bool) {
+	if dctx.setts == nil || !dctx.setts.LocalDiscoveryPassthrough {
+		return false
+	}
+
+	pctx := dctx.proxyCtx
+	host := strings.ToLower(strings.TrimSuffix(pctx.Req.Question[0].Name, "."))
+	if !filtering.IsMDNSName(host) {
+		return false
+	}
+
+	uc := pctx.CustomUpstreamConfig
+	if uc == nil {
+		uc = s.conf.UpstreamConfig
+	}
+
+	if uc == nil {
+		return true
+	}
+
+	for domain, ups := range uc.DomainReservedUpstreams {
+		if len(ups) > 0 && filtering.IsMDNSName(strings.TrimSuffix(domain, ".")) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ipStringFromAddr extracts an IP address string from net.Addr.
 func ipStringFromAddr(addr net.Addr) (ipStr string) {
 	if ip, _ := netutil.IPAndPortFromAddr(addr); ip != nil {
@@ -745,6 +847,30 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 
 	s.setCustomUpstream(pctx, dctx.clientID)
 
+	if s.isUnroutedMDNSQ(dctx) {
+		// Multicast DNS names must not be resolved by the general-purpose
+		// upstreams.  Respond with an NXDOMAIN immediately, see RFC 6761,
+		// section 6.3.
+		log.Debug("dnsforward: mdns name %q was not resolved locally", q.Name)
+		pctx.Res = s.genNXDomain(req)
+
+		return resultCodeSuccess
+	}
+
+	// Don't cache the failures of the custom upstreams, since those are
+	// specific to the client.
+	var servFails *servFailCache
+	if pctx.CustomUpstreamConfig == nil {
+		servFails = s.servFailCache()
+	}
+
+	if servFails.has(q, time.Now()) {
+		log.Debug("dnsforward: failure to resolve %q is cached", q.Name)
+		pctx.Res = s.genServerFailure(req)
+
+		return resultCodeSuccess
+	}
+
 	reqWantsDNSSEC := s.setReqAD(req)
 
 	// Process the request further since it wasn't filtered.
@@ -755,22 +881,27 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 		return resultCodeError
 	}
 
-	if err := prx.Resolve(pctx); err != nil {
-		if errors.Is(err, upstream.ErrNoUpstreams) {
-			// Do not even put into querylog.  Currently this happens either
-			// when the private resolvers enabled and the request is DNS64 PTR,
-			// or when the client isn't considered local by prx.
-			//
-			// TODO(e.burkov):  Make proxy detect local client the same way as
-			// AGH does.
-			pctx.Res = s.genNXDomain(req)
+	err := s.resolve(prx, pctx)
+	if errors.Is(err, upstream.ErrNoUpstreams) {
+		// Do not even put into querylog.  Currently this happens either when
+		// the private resolvers enabled and the request is DNS64 PTR, or when
+		// the client isn't considered local by prx.
+		//
+		// TODO(e.burkov):  Make proxy detect local client the same way as AGH
+		// does.
+		pctx.Res = s.genNXDomain(req)
 
-			return resultCodeFinish
-		}
+		return resultCodeFinish
+	}
 
+	err = s.resolveFallback(dctx, err)
+	if err != nil {
+		servFails.set(q, time.Now())
 		dctx.err = err
 
 		return resultCodeError
+	} else if pctx.Res.Rcode == dns.RcodeServerFailure {
+		servFails.set(q, time.Now())
 	}
 
 	dctx.responseFromUpstream = true
@@ -781,6 +912,78 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 	return resultCodeSuccess
 }
 
+// resolve resolves the request of pctx using prx.  If the DNS cache is sharded,
+// the response is looked up in and stored to it instead of the cache of prx.
+// The requests using the custom upstreams aren't cached, since their responses
+// are specific to the client.
+func (s *Server) resolve(prx *proxy.Proxy, pctx *proxy.DNSContext) (err error) {
+	c := s.responseCache()
+	if pctx.CustomUpstreamConfig != nil || !c.works(pctx.Req) {
+		return prx.Resolve(pctx)
+	}
+
+	if resp, upsAddr := c.get(pctx.Req, time.Now()); resp != nil {
+		log.Debug("dnsforward: cache: serving cached response to %q", pctx.Req.Question[0].Name)
+
+		resp.Truncate(proxyutil.DNSSize(pctx.Proto == proxy.ProtoUDP, pctx.Req))
+		resp.Compress = true
+
+		pctx.Res = resp
+		pctx.CachedUpstreamAddr = upsAddr
+
+		return nil
+	}
+
+	// Copy the request only when it's sent to the upstream, since prx may
+	// change it.
+	req := pctx.Req.Copy()
+	err = prx.Resolve(pctx)
+	if err == nil && pctx.Res != nil && !pctx.Res.CheckingDisabled {
+		var upsAddr string
+		if pctx.Upstream != nil {
+			upsAddr = pctx.Upstream.Address()
+		}
+
+		c.set(req, pctx.Res, upsAddr, time.Now())
+	}
+
+	return err
+}
+
+// resolveFallback resolves the request of dctx using the fallback upstreams if
+// the primary ones have failed with resolveErr or responded with SERVFAIL.  err
+// is resolveErr if the fallback upstreams haven't been used or have failed
+// too.
+func (s *Server) resolveFallback(dctx *dnsContext, resolveErr error) (err error) {
+	pctx := dctx.proxyCtx
+	failed := resolveErr != nil || (pctx.Res != nil && pctx.Res.Rcode == dns.RcodeServerFailure)
+	if !failed || dctx.unreversedReqIP != nil {
+		// Don't send the requests for the locally served addresses to the
+		// fallback upstreams, since those are usually public ones.
+		return resolveErr
+	}
+
+	fallbacks := s.fallbacks()
+	if len(fallbacks) == 0 {
+		return resolveErr
+	}
+
+	resp, u, err := upstream.ExchangeParallel(fallbacks, pctx.Req)
+	if err != nil {
+		log.Debug("dnsforward: fallback upstreams: %s", err)
+
+		return resolveErr
+	}
+
+	log.Debug("dnsforward: resolved %q using fallback upstream %q", pctx.Req.Question[0].Name, u.Address())
+
+	pctx.Res = resp
+	pctx.Upstream = u
+	dctx.responseFromFallback = true
+
+	return nil
+}
+
 // setReqAD changes the request based on the server settings.  wantsDNSSEC is
 // false if the response should be cleared of the AD bit.
 //
@@ -4,9 +4,11 @@ import (
 	"net"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
@@ -448,6 +450,50 @@ func TestServer_ProcessDHCPHosts(t *testing.T) {
 	}
 }
 
+func TestServer_onDHCPLeaseChanged_expiry(t *testing.T) {
+	const host = "example." + defaultLocalDomainSuffix
+
+	ip := netip.MustParseAddr("192.168.12.34")
+	exp := time.Now().Add(100 * time.Millisecond)
+
+	dhcp := &dhcpd.MockInterface{
+		OnLeases: func(_ dhcpd.GetLeasesFlags) (leases []*dhcpd.Lease) {
+			if time.Now().After(exp) {
+				return nil
+			}
+
+			return []*dhcpd.Lease{{
+				Expiry:   exp,
+				Hostname: "example",
+				HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+				IP:       ip,
+			}}
+		},
+	}
+
+	s := &Server{
+		dhcpServer:        dhcp,
+		localDomainSuffix: defaultLocalDomainSuffix,
+	}
+	t.Cleanup(s.Close)
+
+	s.onDHCPLeaseChanged(dhcpd.LeaseChangedAdded)
+
+	got, ok := s.dhcpHostToIP(host)
+	require.True(t, ok)
+
+	assert.Equal(t, ip, got)
+
+	require.Eventually(t, func() (ok bool) {
+		_, ok = s.dhcpHostToIP(host)
+
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	_, ok = s.ipToDHCPHost(ip)
+	assert.False(t, ok)
+}
+
 func TestServer_ProcessRestrictLocal(t *testing.T) {
 	const (
 		extPTRQuestion = "251.252.253.254.in-addr.arpa."
@@ -731,3 +777,202 @@ func TestExtractARPASubnet(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_isUnroutedMDNSQ(t *testing.T) {
+	newUpsConf := func(t *testing.T, upstreams ...string) (uc *proxy.UpstreamConfig) {
+		t.Helper()
+
+		uc, err := proxy.ParseUpstreamsConfig(upstreams, &upstream.Options{})
+		require.NoError(t, err)
+
+		return uc
+	}
+
+	generalConf := newUpsConf(t, "192.0.2.1")
+	mdnsConf := newUpsConf(t, "192.0.2.1", "[/local/]192.0.2.2")
+
+	testCases := []struct {
+		upsConf     *proxy.UpstreamConfig
+		customConf  *proxy.UpstreamConfig
+		name        string
+		host        string
+		passthrough bool
+		want        bool
+	}{{
+		upsConf:     generalConf,
+		customConf:  nil,
+		name:        "mdns",
+		host:        "printer.local.",
+		passthrough: true,
+		want:        true,
+	}, {
+		upsConf:     generalConf,
+		customConf:  nil,
+		name:        "mdns_uppercase",
+		host:        "Printer.LOCAL.",
+		passthrough: true,
+		want:        true,
+	}, {
+		upsConf:     generalConf,
+		customConf:  nil,
+		name:        "no_passthrough",
+		host:        "printer.local.",
+		passthrough: false,
+		want:        false,
+	}, {
+		upsConf:     generalConf,
+		customConf:  nil,
+		name:        "not_mdns",
+		host:        "_ipp._tcp.example.org.",
+		passthrough: true,
+		want:        false,
+	}, {
+		upsConf:     mdnsConf,
+		customConf:  nil,
+		name:        "routed",
+		host:        "printer.local.",
+		passthrough: true,
+		want:        false,
+	}, {
+		upsConf:     generalConf,
+		customConf:  mdnsConf,
+		name:        "routed_custom",
+		host:        "printer.local.",
+		passthrough: true,
+		want:        false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				conf: ServerConfig{
+					UpstreamConfig: tc.upsConf,
+				},
+			}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:                  (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA),
+					CustomUpstreamConfig: tc.customConf,
+				},
+				setts: &filtering.Settings{
+					LocalDiscoveryPassthrough: tc.passthrough,
+				},
+			}
+
+			assert.Equal(t, tc.want, s.isUnroutedMDNSQ(dctx))
+		})
+	}
+}
+
+func TestServer_resolveFallback(t *testing.T) {
+	const host = "example.org."
+
+	fallbackIP := net.IP{192, 0, 2, 1}
+
+	goodFallback := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		return aghtest.MatchedResponse(req, dns.TypeA, host, fallbackIP.String()), nil
+	})
+	goodFallback.OnAddress = func() (addr string) { return "fallback.example" }
+
+	badFallback := aghtest.NewErrorUpstream()
+
+	primaryResp := func(rcode int) (resp *dns.Msg) {
+		return (&dns.Msg{}).SetRcode((&dns.Msg{}).SetQuestion(host, dns.TypeA), rcode)
+	}
+
+	testCases := []struct {
+		resp         *dns.Msg
+		resolveErr   error
+		fallback     upstream.Upstream
+		wantErr      error
+		name         string
+		localPTR     bool
+		wantFallback bool
+	}{{
+		resp:         primaryResp(dns.RcodeSuccess),
+		resolveErr:   nil,
+		fallback:     goodFallback,
+		wantErr:      nil,
+		name:         "success",
+		localPTR:     false,
+		wantFallback: false,
+	}, {
+		resp:         primaryResp(dns.RcodeServerFailure),
+		resolveErr:   nil,
+		fallback:     goodFallback,
+		wantErr:      nil,
+		name:         "servfail",
+		localPTR:     false,
+		wantFallback: true,
+	}, {
+		resp:         primaryResp(dns.RcodeServerFailure),
+		resolveErr:   aghtest.ErrUpstream,
+		fallback:     goodFallback,
+		wantErr:      nil,
+		name:         "error",
+		localPTR:     false,
+		wantFallback: true,
+	}, {
+		resp:         primaryResp(dns.RcodeServerFailure),
+		resolveErr:   aghtest.ErrUpstream,
+		fallback:     badFallback,
+		wantErr:      aghtest.ErrUpstream,
+		name:         "fallback_error",
+		localPTR:     false,
+		wantFallback: false,
+	}, {
+		resp:         primaryResp(dns.RcodeServerFailure),
+		resolveErr:   nil,
+		fallback:     nil,
+		wantErr:      nil,
+		name:         "no_fallback",
+		localPTR:     false,
+		wantFallback: false,
+	}, {
+		resp:         primaryResp(dns.RcodeServerFailure),
+		resolveErr:   nil,
+		fallback:     goodFallback,
+		wantErr:      nil,
+		name:         "local_ptr",
+		localPTR:     true,
+		wantFallback: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{}
+			if tc.fallback != nil {
+				s.conf.FallbackUpstreamConfig = &proxy.UpstreamConfig{
+					Upstreams: []upstream.Upstream{tc.fallback},
+				}
+			}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: (&dns.Msg{}).SetQuestion(host, dns.TypeA),
+					Res: tc.resp,
+				},
+			}
+			if tc.localPTR {
+				dctx.unreversedReqIP = net.IP{192, 168, 1, 1}
+			}
+
+			err := s.resolveFallback(dctx, tc.resolveErr)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantFallback, dctx.responseFromFallback)
+
+			if !tc.wantFallback {
+				assert.Same(t, tc.resp, dctx.proxyCtx.Res)
+
+				return
+			}
+
+			require.NotNil(t, dctx.proxyCtx.Res)
+			require.Len(t, dctx.proxyCtx.Res.Answer, 1)
+
+			assert.Equal(t, fallbackIP, dctx.proxyCtx.Res.Answer[0].(*dns.A).A.To4())
+			assert.Equal(t, "fallback.example", dctx.proxyCtx.Upstream.Address())
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"os"
 	"runtime"
 	"strings"
 	"sync"
@@ -101,6 +102,11 @@ type Server struct {
 	tableIPToHost     ipToHostTable
 	tableIPToHostLock sync.Mutex
 
+	// dhcpCleanup rebuilds the tables of the DHCP hosts when the earliest of
+	// the dynamic leases expires.  It's protected by dhcpCleanupLock.
+	dhcpCleanup     *time.Timer
+	dhcpCleanupLock sync.Mutex
+
 	// clientIDCache is a temporary storage for ClientIDs that were extracted
 	// during the BeforeRequestHandler stage.
 	clientIDCache cache.Cache
@@ -109,6 +115,45 @@ type Server struct {
 	// We don't Start() it and so no listen port is required.
 	internalProxy *proxy.Proxy
 
+	// socketFiles are the plain DNS sockets passed by the service manager.
+	// They're kept open across the reconfigurations.
+	socketFiles []*os.File
+
+	// socketServers are the servers handling the requests from socketFiles.
+	socketServers []*dns.Server
+
+	// proxyListens is true if dnsProxy has been started with its own
+	// listeners as opposed to only being initialized.
+	proxyListens bool
+
+	// counters are the cumulative counters of the processed requests.
+	counters counters
+
+	// quarantine are the quarantined clients.
+	quarantine quarantine
+
+	// parentalBypass are the clients, for which the parental control and the
+	// safe search are temporarily disabled.
+	parentalBypass parentalBypass
+
+	// tunnels are the clients scored on DNS tunneling.
+	tunnels tunnelDetector
+
+	// servFails are the recently failed questions.  It's nil if the failures
+	// aren't cached.
+	servFails *servFailCache
+
+	// cache is the sharded cache of the upstream responses.  It's nil if the
+	// cache isn't sharded, in which case the cache of dnsproxy is used.
+	cache *shardedCache
+
+	// bootstraps are the bootstrap groups of the upstream groups.
+	bootstraps []*bootstrapGroup
+
+	// bootstrapCheckDone stops the health checks of bootstraps, if those are
+	// running.
+	bootstrapCheckDone chan struct{}
+
 	isRunning bool
 
 	conf ServerConfig
@@ -131,6 +176,11 @@ type DNSCreateParams struct {
 	PrivateNets netutil.SubnetSet
 	Anonymizer  *aghnet.IPMut
 	LocalDomain string
+
+	// SocketFiles are the plain DNS sockets passed by the service manager.
+	// If not empty, they're served instead of the UDP and TCP listen
+	// addresses.
+	SocketFiles []*os.File
 }
 
 const (
@@ -170,7 +220,8 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 			EnableLRU: true,
 			MaxCount:  defaultClientIDCacheCount,
 		}),
-		anonymizer: p.Anonymizer,
+		anonymizer:  p.Anonymizer,
+		socketFiles: p.SocketFiles,
 	}
 
 	// TODO(e.burkov): Enable the refresher after the actual implementation
@@ -209,6 +260,10 @@ func (s *Server) Close() {
 	s.queryLog = nil
 	s.dnsProxy = nil
 
+	s.scheduleDHCPCleanup(time.Time{})
+	s.stopBootstrapChecks()
+	s.closeBootstraps()
+
 	if err := s.ipset.close(); err != nil {
 		log.Error("closing ipset: %s", err)
 	}
@@ -223,10 +278,16 @@ func (s *Server) WriteDiskConfig(c *FilteringConfig) {
 	*c = sc
 	c.RatelimitWhitelist = stringutil.CloneSlice(sc.RatelimitWhitelist)
 	c.BootstrapDNS = stringutil.CloneSlice(sc.BootstrapDNS)
+	c.FallbackDNS = stringutil.CloneSlice(sc.FallbackDNS)
+	c.PrivateBootstrapDNS = stringutil.CloneSlice(sc.PrivateBootstrapDNS)
 	c.AllowedClients = stringutil.CloneSlice(sc.AllowedClients)
 	c.DisallowedClients = stringutil.CloneSlice(sc.DisallowedClients)
 	c.BlockedHosts = stringutil.CloneSlice(sc.BlockedHosts)
+	c.DisallowedClientsSchedule = cloneAccessSchedule(sc.DisallowedClientsSchedule)
+	c.RefusedQueryTypes = stringutil.CloneSlice(sc.RefusedQueryTypes)
+	c.RefusedQueryTypesClients = cloneAccessQueryTypes(sc.RefusedQueryTypesClients)
 	c.TrustedProxies = stringutil.CloneSlice(sc.TrustedProxies)
+	c.RebindingAllowedDomains = stringutil.CloneSlice(sc.RebindingAllowedDomains)
 	c.UpstreamDNS = stringutil.CloneSlice(sc.UpstreamDNS)
 }
 
@@ -361,12 +422,43 @@ func (s *Server) Start() error {
 }
 
 // startLocked starts the DNS server without locking. For internal use only.
-func (s *Server) startLocked() error {
-	err := s.dnsProxy.Start()
-	if err == nil {
-		s.isRunning = true
+func (s *Server) startLocked() (err error) {
+	// The DNS proxy has no listeners if all plain DNS requests come from the
+	// sockets passed by the service manager and the encrypted protocols are
+	// disabled, so only initialize it in that case.
+	s.proxyListens = len(s.socketFiles) == 0 || s.hasEncryptedListeners()
+	if s.proxyListens {
+		err = s.dnsProxy.Start()
+	} else {
+		err = s.dnsProxy.Init()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = s.startSockets()
+	if err != nil {
+		return err
 	}
-	return err
+
+	s.startBootstrapChecks()
+
+	s.isRunning = true
+
+	return nil
+}
+
+// hasEncryptedListeners returns true if s listens for any encrypted DNS
+// protocol.
+func (s *Server) hasEncryptedListeners() (ok bool) {
+	c := s.dnsProxy.Config
+
+	return c.TLSListenAddr != nil ||
+		c.HTTPSListenAddr != nil ||
+		c.QUICListenAddr != nil ||
+		c.DNSCryptUDPListenAddr != nil ||
+		c.DNSCryptTCPListenAddr != nil
 }
 
 // defaultLocalTimeout is the default timeout for resolving addresses from
@@ -428,6 +520,10 @@ func (s *Server) filterOurDNSAddrs(addrs []string) (filtered []string, err error
 // use only.
 func (s *Server) setupResolvers(localAddrs []string) (err error) {
 	bootstraps := s.conf.BootstrapDNS
+	if len(s.conf.PrivateBootstrapDNS) > 0 {
+		bootstraps = s.conf.PrivateBootstrapDNS
+	}
+
 	if len(localAddrs) == 0 {
 		localAddrs = s.sysResolvers.Get()
 		bootstraps = nil
@@ -440,19 +536,29 @@ func (s *Server) setupResolvers(localAddrs []string) (err error) {
 
 	log.Debug("upstreams to resolve PTR for local addresses: %v", localAddrs)
 
+	opts := &upstream.Options{
+		Bootstrap: bootstraps,
+		Timeout:   defaultLocalTimeout,
+		// TODO(e.burkov): Should we verify server's certificates?
+	}
+
 	var upsConfig *proxy.UpstreamConfig
-	upsConfig, err = proxy.ParseUpstreamsConfig(
-		localAddrs,
-		&upstream.Options{
-			Bootstrap: bootstraps,
-			Timeout:   defaultLocalTimeout,
-			// TODO(e.burkov): Should we verify server's certificates?
-		},
-	)
+	upsConfig, err = proxy.ParseUpstreamsConfig(localAddrs, opts)
 	if err != nil {
 		return fmt.Errorf("parsing upstreams: %w", err)
 	}
 
+	// The system resolvers are plain DNS ones, so don't bootstrap them.
+	if bootstraps != nil {
+		var bootstrap *bootstrapGroup
+		bootstrap, err = s.newBootstrapGroup(bootstrapGroupPrivate, bootstraps, defaultLocalTimeout)
+		if err != nil {
+			return err
+		}
+
+		bootstrap.bootstrapUpstreams(upsConfig, localAddrs, opts)
+	}
+
 	s.localResolvers = &proxy.Proxy{
 		Config: proxy.Config{
 			UpstreamConfig: upsConfig,
@@ -472,7 +578,45 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		return fmt.Errorf("checking blocking mode: %w", err)
 	}
 
+	err = validateAddrFamily(s.conf.UpstreamPreferFamily)
+	if err != nil {
+		return fmt.Errorf("checking upstream_prefer_family: %w", err)
+	}
+
+	err = validateNegativeCache(
+		s.conf.CacheNegativeTTLMin,
+		s.conf.CacheNegativeTTLMax,
+		s.conf.CacheServFailTTL,
+	)
+	if err != nil {
+		return fmt.Errorf("checking negative cache: %w", err)
+	}
+
+	err = validateRebindingAllowedDomains(s.conf.RebindingAllowedDomains)
+	if err != nil {
+		return fmt.Errorf("checking rebinding protection: %w", err)
+	}
+
+	err = validateSingleLabelPolicy(s.conf.SingleLabelPolicy)
+	if err != nil {
+		return fmt.Errorf("checking single-label queries: %w", err)
+	}
+
+	err = validateTunnelDetection(&s.conf.TunnelDetection)
+	if err != nil {
+		return fmt.Errorf("checking tunnel detection: %w", err)
+	}
+
+	err = validateCacheShards(&s.conf)
+	if err != nil {
+		return fmt.Errorf("checking cache: %w", err)
+	}
+
+	s.servFails = newServFailCache(s.conf.CacheServFailTTL)
+	s.cache = newShardedCache(s.conf.CacheSize, s.conf.CacheShards)
+
 	s.initDefaultSettings()
+	s.closeBootstraps()
 
 	err = s.prepareIpsetListSettings()
 	if err != nil {
@@ -502,6 +646,9 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		s.conf.AllowedClients,
 		s.conf.DisallowedClients,
 		s.conf.BlockedHosts,
+		s.conf.DisallowedClientsSchedule,
+		s.conf.RefusedQueryTypes,
+		s.conf.RefusedQueryTypesClients,
 	)
 	if err != nil {
 		return fmt.Errorf("preparing access: %w", err)
@@ -595,13 +742,34 @@ func (s *Server) stopLocked() (err error) {
 	// This will require filtering all the non-critical errors in
 	// [upstream.Upstream] implementations.
 
+	err = s.stopSockets()
+	if err != nil {
+		log.Error("dnsforward: %s", err)
+	}
+
+	s.stopBootstrapChecks()
+
 	if s.dnsProxy != nil {
-		err = s.dnsProxy.Stop()
+		if s.proxyListens {
+			err = s.dnsProxy.Stop()
+		} else if upsConf := s.dnsProxy.UpstreamConfig; upsConf != nil {
+			// The proxy hasn't been started, so close its upstreams
+			// manually.
+			err = upsConf.Close()
+		}
+
 		if err != nil {
 			log.Error("dnsforward: closing primary resolvers: %s", err)
 		}
 	}
 
+	if upsConf := s.conf.FallbackUpstreamConfig; upsConf != nil {
+		err = upsConf.Close()
+		if err != nil {
+			log.Error("dnsforward: closing fallback resolvers: %s", err)
+		}
+	}
+
 	if upsConf := s.internalProxy.UpstreamConfig; upsConf != nil {
 		err = upsConf.Close()
 		if err != nil {
@@ -644,6 +812,34 @@ func (s *Server) proxy() (p *proxy.Proxy) {
 	return s.dnsProxy
 }
 
+// servFailCache returns the SERVFAIL cache of s, if any.
+func (s *Server) servFailCache() (c *servFailCache) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	return s.servFails
+}
+
+// responseCache returns the sharded DNS cache of s, if any.
+func (s *Server) responseCache() (c *shardedCache) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	return s.cache
+}
+
+// fallbacks returns the fallback upstreams of s, if any.
+func (s *Server) fallbacks() (ups []upstream.Upstream) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	if s.conf.FallbackUpstreamConfig == nil {
+		return nil
+	}
+
+	return s.conf.FallbackUpstreamConfig.Upstreams
+}
+
 // Reconfigure applies the new configuration to the DNS server.
 func (s *Server) Reconfigure(conf *ServerConfig) error {
 	s.serverLock.Lock()
@@ -712,5 +908,15 @@ func (s *Server) IsBlockedClient(ip netip.Addr, clientID string) (blocked bool,
 		blocked = true
 	}
 
+	if !blocked {
+		var schedRule string
+		blocked, schedRule = s.access.isScheduledBlocked(ip, clientID, time.Now())
+		if blocked {
+			log.Debug("client %v (id %q) is blocked by schedule", ip, clientID)
+
+			return true, schedRule
+		}
+	}
+
 	return blocked, aghalg.Coalesce(rule, clientID)
 }
@@ -1081,6 +1081,9 @@ var testDHCP = &dhcpd.MockInterface{
 	OnSetOnLeaseChanged: func(olct dhcpd.OnLeaseChangedT) {},
 	OnFindMACbyIP:       func(ip netip.Addr) (mac net.HardwareAddr) { panic("not implemented") },
 	OnWriteDiskConfig:   func(c *dhcpd.ServerConfig) { panic("not implemented") },
+	OnConfigureV4: func(_ string, _ *dhcpd.V4ServerConf) (err error) {
+		panic("not implemented")
+	},
 }
 
 func TestPTRResponseFromDHCPLeases(t *testing.T) {
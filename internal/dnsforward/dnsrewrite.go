@@ -162,6 +162,10 @@ func (s *Server) filterDNSRewrite(
 
 	rr := req.Question[0].Qtype
 	values := dnsrr.Response[rr]
+	if len(values) > 0 {
+		resp.Answer = make([]dns.RR, 0, len(values))
+	}
+
 	for i, v := range values {
 		var ans dns.RR
 		ans, err = s.filterDNSRewriteResponse(req, rr, v)
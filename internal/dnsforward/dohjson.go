@@ -0,0 +1,233 @@
+package dnsforward
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// DNS-over-HTTPS JSON API
+
+// dohJSONContentType is the content type of the responses of the DNS JSON API.
+const dohJSONContentType = "application/dns-json"
+
+// dohJSONQuestion is a question within a response of the DNS JSON API.
+type dohJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// dohJSONRR is a resource record within a response of the DNS JSON API.
+type dohJSONRR struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  uint32 `json:"TTL"`
+	Type uint16 `json:"type"`
+}
+
+// dohJSONResp is a response of the DNS JSON API in the format used by Google
+// and Cloudflare.
+type dohJSONResp struct {
+	Question   []*dohJSONQuestion `json:"Question"`
+	Answer     []*dohJSONRR       `json:"Answer,omitempty"`
+	Authority  []*dohJSONRR       `json:"Authority,omitempty"`
+	Additional []*dohJSONRR       `json:"Additional,omitempty"`
+	Status     int                `json:"Status"`
+	TC         bool               `json:"TC"`
+	RD         bool               `json:"RD"`
+	RA         bool               `json:"RA"`
+	AD         bool               `json:"AD"`
+	CD         bool               `json:"CD"`
+}
+
+// isDoHJSONRequest returns true if r is a request to the DNS JSON API, that
+// is a GET request with the name parameter instead of the dns one.
+func isDoHJSONRequest(r *http.Request) (ok bool) {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	q := r.URL.Query()
+
+	return q.Has("name") && !q.Has("dns")
+}
+
+// newDoHJSONReq returns a DNS request from the parameters of the DNS JSON API
+// request: name, type, cd, and do.
+func newDoHJSONReq(r *http.Request) (req *dns.Msg, err error) {
+	q := r.URL.Query()
+
+	name := strings.TrimSuffix(q.Get("name"), ".")
+	err = netutil.ValidateDomainName(name)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	qtype := dns.TypeA
+	if t := q.Get("type"); t != "" {
+		qtype, err = parseDoHJSONType(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req = (&dns.Msg{}).SetQuestion(dns.Fqdn(name), qtype)
+	req.CheckingDisabled = isDoHJSONTrue(q.Get("cd"))
+	if isDoHJSONTrue(q.Get("do")) {
+		req.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	return req, nil
+}
+
+// parseDoHJSONType parses the type parameter of the DNS JSON API, which is
+// either a number or a mnemonic, for example "AAAA".
+func parseDoHJSONType(t string) (qtype uint16, err error) {
+	if n, parseErr := strconv.ParseUint(t, 10, 16); parseErr == nil {
+		return uint16(n), nil
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(t)]
+	if !ok {
+		return 0, fmt.Errorf("bad type %q", t)
+	}
+
+	return qtype, nil
+}
+
+// isDoHJSONTrue returns true if the boolean parameter of the DNS JSON API is
+// set.
+func isDoHJSONTrue(v string) (ok bool) {
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+// newDoHJSONResp converts a DNS response into the one of the DNS JSON API.
+func newDoHJSONResp(resp *dns.Msg) (jr *dohJSONResp) {
+	jr = &dohJSONResp{
+		Question:   make([]*dohJSONQuestion, 0, len(resp.Question)),
+		Answer:     newDoHJSONRRs(resp.Answer),
+		Authority:  newDoHJSONRRs(resp.Ns),
+		Additional: newDoHJSONRRs(resp.Extra),
+		Status:     resp.Rcode,
+		TC:         resp.Truncated,
+		RD:         resp.RecursionDesired,
+		RA:         resp.RecursionAvailable,
+		AD:         resp.AuthenticatedData,
+		CD:         resp.CheckingDisabled,
+	}
+
+	for _, q := range resp.Question {
+		jr.Question = append(jr.Question, &dohJSONQuestion{
+			Name: q.Name,
+			Type: q.Qtype,
+		})
+	}
+
+	return jr
+}
+
+// newDoHJSONRRs converts rrs into the resource records of the DNS JSON API.
+// The OPT pseudo-records are skipped.
+func newDoHJSONRRs(rrs []dns.RR) (jrrs []*dohJSONRR) {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+
+		jrrs = append(jrrs, &dohJSONRR{
+			Name: hdr.Name,
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+			TTL:  hdr.Ttl,
+			Type: hdr.Rrtype,
+		})
+	}
+
+	return jrrs
+}
+
+// dohRespWriter is an [http.ResponseWriter] that keeps the wireformat DNS
+// response to convert it into the one of the DNS JSON API.  The headers are
+// written into the underlying writer.
+type dohRespWriter struct {
+	http.ResponseWriter
+
+	// body is the response body.
+	body *bytes.Buffer
+
+	// status is the status code of the response, if it has been written.
+	status int
+}
+
+// type check
+var _ http.ResponseWriter = (*dohRespWriter)(nil)
+
+// Write implements the [http.ResponseWriter] interface for *dohRespWriter.
+func (w *dohRespWriter) Write(b []byte) (n int, err error) {
+	return w.body.Write(b)
+}
+
+// WriteHeader implements the [http.ResponseWriter] interface for
+// *dohRespWriter.
+func (w *dohRespWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// handleDoHJSON handles a request to the DNS JSON API.  It converts the request
+// into the wireformat one and passes it to the proxy, so that it's processed
+// the same way, including the filtering and the query log.
+func (s *Server) handleDoHJSON(w http.ResponseWriter, r *http.Request) {
+	req, err := newDoHJSONReq(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "bad request: %s", err)
+
+		return
+	}
+
+	data, err := req.Pack()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "packing request: %s", err)
+
+		return
+	}
+
+	wireReq := r.Clone(r.Context())
+	wireReq.URL.RawQuery = "dns=" + base64.RawURLEncoding.EncodeToString(data)
+
+	rw := &dohRespWriter{
+		ResponseWriter: w,
+		body:           &bytes.Buffer{},
+	}
+	s.ServeHTTP(rw, wireReq)
+
+	if rw.status != 0 && rw.status != http.StatusOK {
+		aghhttp.Error(r, w, rw.status, "%s", http.StatusText(rw.status))
+
+		return
+	}
+
+	resp := &dns.Msg{}
+	err = resp.Unpack(rw.body.Bytes())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "unpacking response: %s", err)
+
+		return
+	}
+
+	w.Header().Set(aghhttp.HdrNameContentType, dohJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(newDoHJSONResp(resp))
+	if err != nil {
+		log.Debug("dnsforward: writing dns json response: %s", err)
+	}
+}
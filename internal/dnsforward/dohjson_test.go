@@ -0,0 +1,144 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_handleDoHJSON(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		FilteringConfig: FilteringConfig{
+			ProtectionEnabled: true,
+			EDNSClientSubnet:  &EDNSClientSubnet{Enabled: false},
+		},
+	}, nil)
+	s.conf.UpstreamConfig.Upstreams = []upstream.Upstream{newGoogleUpstream()}
+	s.conf.TLSAllowUnencryptedDoH = true
+	startDeferStop(t, s)
+
+	testCases := []struct {
+		wantResp   *dohJSONResp
+		name       string
+		query      string
+		wantStatus int
+	}{{
+		wantResp: &dohJSONResp{
+			Question: []*dohJSONQuestion{{
+				Name: googleDomainName,
+				Type: dns.TypeA,
+			}},
+			Answer: []*dohJSONRR{{
+				Name: googleDomainName,
+				Data: "8.8.8.8",
+				TTL:  60,
+				Type: dns.TypeA,
+			}},
+			Status: dns.RcodeSuccess,
+			RD:     true,
+			RA:     false,
+		},
+		name:       "success",
+		query:      "name=" + googleDomainName + "&type=A",
+		wantStatus: http.StatusOK,
+	}, {
+		wantResp: &dohJSONResp{
+			Question: []*dohJSONQuestion{{
+				Name: "nxdomain.example.org.",
+				Type: dns.TypeA,
+			}},
+			Answer: []*dohJSONRR{{
+				Name: "nxdomain.example.org.",
+				Data: "0.0.0.0",
+				TTL:  s.conf.BlockedResponseTTL,
+				Type: dns.TypeA,
+			}},
+			Status: dns.RcodeSuccess,
+			RD:     true,
+			RA:     true,
+		},
+		name:       "blocked",
+		query:      "name=nxdomain.example.org&type=1",
+		wantStatus: http.StatusOK,
+	}, {
+		wantResp:   nil,
+		name:       "bad_name",
+		query:      "name=bad..name",
+		wantStatus: http.StatusBadRequest,
+	}, {
+		wantResp:   nil,
+		name:       "bad_type",
+		query:      "name=example.org&type=BAD",
+		wantStatus: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/dns-query?"+tc.query, nil)
+			w := httptest.NewRecorder()
+
+			s.handleDoH(w, r)
+
+			require.Equal(t, tc.wantStatus, w.Code)
+			if tc.wantResp == nil {
+				return
+			}
+
+			assert.Equal(t, dohJSONContentType, w.Header().Get(aghhttp.HdrNameContentType))
+
+			resp := &dohJSONResp{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantResp, resp)
+		})
+	}
+}
+
+func TestParseDoHJSONType(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+		want       uint16
+	}{{
+		name:       "number",
+		in:         "28",
+		wantErrMsg: "",
+		want:       dns.TypeAAAA,
+	}, {
+		name:       "mnemonic",
+		in:         "aaaa",
+		wantErrMsg: "",
+		want:       dns.TypeAAAA,
+	}, {
+		name:       "bad",
+		in:         "bad",
+		wantErrMsg: `bad type "bad"`,
+		want:       0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			qtype, err := parseDoHJSONType(tc.in)
+			if tc.wantErrMsg != "" {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.want, qtype)
+		})
+	}
+}
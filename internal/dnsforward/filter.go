@@ -4,8 +4,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -39,6 +41,16 @@ func (s *Server) beforeRequestHandler(
 
 			return s.preBlockedResponse(pctx)
 		}
+
+		refused, rule := s.isRefusedQueryType(addrPort.Addr(), clientID, qt)
+		if refused {
+			log.Debug("request %s %s is refused by query type, rule %q", dns.Type(qt), host, rule)
+
+			s.updateRefusedStats(pctx, clientID, qt)
+			pctx.Res = s.makeResponseREFUSED(pctx.Req)
+
+			return true, nil
+		}
 	}
 
 	if clientID != "" {
@@ -60,6 +72,13 @@ func (s *Server) getClientRequestFilteringSettings(dctx *dnsContext) *filtering.
 		s.conf.FilterHandler(ip, dctx.clientID, &setts)
 	}
 
+	ip := netutil.NetAddrToAddrPort(dctx.proxyCtx.Addr).Addr().Unmap()
+	if s.parentalBypass.active(ip, dctx.clientID, time.Now()) {
+		setts.ParentalEnabled = false
+		setts.SafeSearchEnabled = false
+		setts.ClientSafeSearch = nil
+	}
+
 	return &setts
 }
 
@@ -76,7 +95,7 @@ func (s *Server) filterDNSRequest(dctx *dnsContext) (res *filtering.Result, err
 	}
 
 	// TODO(a.garipov): Make CheckHost return a pointer.
-	res = &resVal
+	res = s.applyQueryHook(dctx, host, q.Qtype, &resVal)
 	switch {
 	case res.IsFiltered:
 		log.Tracef("host %q is filtered, reason %q, rule: %q", host, res.Reason, res.Rules[0].Text)
@@ -99,6 +118,68 @@ func (s *Server) filterDNSRequest(dctx *dnsContext) (res *filtering.Result, err
 	return res, err
 }
 
+// QueryHook overrides the filtering decisions.  See [queryhook.Hook].
+type QueryHook interface {
+	// Decide returns the verdict for q.  If err is not nil, the decision is
+	// kept.  It must be safe for concurrent use.
+	Decide(q *queryhook.Query) (v *queryhook.Verdict, err error)
+}
+
+// applyQueryHook lets the query hook, if any, override the filtering result res
+// of the request for host.  It returns res if the decision is kept.
+func (s *Server) applyQueryHook(
+	dctx *dnsContext,
+	host string,
+	qt uint16,
+	res *filtering.Result,
+) (hooked *filtering.Result) {
+	hook := s.conf.QueryHook
+	if hook == nil || !dctx.protectionEnabled {
+		return res
+	}
+
+	q := &queryhook.Query{
+		ClientIP: ipStringFromAddr(dctx.proxyCtx.Addr),
+		ClientID: dctx.clientID,
+		Domain:   host,
+		QType:    dns.Type(qt).String(),
+		Reason:   res.Reason.String(),
+		Filtered: res.IsFiltered,
+	}
+
+	if len(res.Rules) > 0 {
+		q.Rule = res.Rules[0].Text
+	}
+
+	v, err := hook.Decide(q)
+	if err != nil {
+		log.Debug("dnsforward: query hook for %q: %s", host, err)
+
+		return res
+	}
+
+	rules := []*filtering.ResultRule{{
+		Text:         v.Rule,
+		FilterListID: filtering.QueryHookListID,
+	}}
+
+	switch v.Action {
+	case queryhook.ActionBlock:
+		return &filtering.Result{
+			Rules:      rules,
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		}
+	case queryhook.ActionAllow:
+		return &filtering.Result{
+			Rules:  rules,
+			Reason: filtering.NotFilteredAllowList,
+		}
+	default:
+		return res
+	}
+}
+
 // filterRewritten handles DNS rewrite filters.  It returns a DNS response with
 // the data from the filtering result.  All parameters must not be nil.
 func (s *Server) filterRewritten(
@@ -108,21 +189,26 @@ func (s *Server) filterRewritten(
 	qt uint16,
 ) (resp *dns.Msg) {
 	resp = s.makeResponse(req)
+	if len(res.IPList) > 0 {
+		resp.Answer = make([]dns.RR, 0, len(res.IPList)+1)
+	}
+
 	name := host
 	if len(res.CanonName) != 0 {
 		resp.Answer = append(resp.Answer, s.genAnswerCNAME(req, res.CanonName))
 		name = res.CanonName
 	}
 
+	fqdn := dns.Fqdn(name)
 	for _, ip := range res.IPList {
 		switch qt {
 		case dns.TypeA:
 			a := s.genAnswerA(req, ip.To4())
-			a.Hdr.Name = dns.Fqdn(name)
+			a.Hdr.Name = fqdn
 			resp.Answer = append(resp.Answer, a)
 		case dns.TypeAAAA:
 			a := s.genAnswerAAAA(req, ip)
-			a.Hdr.Name = dns.Fqdn(name)
+			a.Hdr.Name = fqdn
 			resp.Answer = append(resp.Answer, a)
 		}
 	}
@@ -6,9 +6,12 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -155,3 +158,199 @@ func TestHandleDNSRequest_filterDNSResponse(t *testing.T) {
 		})
 	}
 }
+
+// fakeQueryHook is a fake [QueryHook] implementation for tests.
+type fakeQueryHook func(q *queryhook.Query) (v *queryhook.Verdict, err error)
+
+// type check
+var _ QueryHook = fakeQueryHook(nil)
+
+// Decide implements the [QueryHook] interface for fakeQueryHook.
+func (f fakeQueryHook) Decide(q *queryhook.Query) (v *queryhook.Verdict, err error) {
+	return f(q)
+}
+
+func TestServer_applyQueryHook(t *testing.T) {
+	blocked := &filtering.Result{
+		Rules: []*filtering.ResultRule{{
+			Text:         "||blocked.example^",
+			FilterListID: filtering.CustomListID,
+		}},
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	}
+
+	var gotQuery *queryhook.Query
+	s := &Server{
+		conf: ServerConfig{
+			QueryHook: fakeQueryHook(func(q *queryhook.Query) (v *queryhook.Verdict, err error) {
+				gotQuery = q
+				switch q.Domain {
+				case "allow.example":
+					return &queryhook.Verdict{Action: queryhook.ActionAllow, Rule: "vip"}, nil
+				case "block.example":
+					return &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: "night"}, nil
+				case "error.example":
+					return nil, errors.Error("timeout")
+				default:
+					return &queryhook.Verdict{Action: queryhook.ActionPass}, nil
+				}
+			}),
+		},
+	}
+
+	dctx := &dnsContext{
+		proxyCtx: &proxy.DNSContext{
+			Addr: &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 53},
+		},
+		clientID:          "cli",
+		protectionEnabled: true,
+	}
+
+	testCases := []struct {
+		res    *filtering.Result
+		want   *filtering.Result
+		domain string
+		name   string
+	}{{
+		res:    &filtering.Result{},
+		want:   &filtering.Result{},
+		domain: "pass.example",
+		name:   "pass",
+	}, {
+		res:    blocked,
+		want:   blocked,
+		domain: "error.example",
+		name:   "error",
+	}, {
+		res: blocked,
+		want: &filtering.Result{
+			Rules: []*filtering.ResultRule{{
+				Text:         "vip",
+				FilterListID: filtering.QueryHookListID,
+			}},
+			Reason: filtering.NotFilteredAllowList,
+		},
+		domain: "allow.example",
+		name:   "allow",
+	}, {
+		res: &filtering.Result{},
+		want: &filtering.Result{
+			Rules: []*filtering.ResultRule{{
+				Text:         "night",
+				FilterListID: filtering.QueryHookListID,
+			}},
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+		domain: "block.example",
+		name:   "block",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := s.applyQueryHook(dctx, tc.domain, dns.TypeA, tc.res)
+			assert.Equal(t, tc.want, got)
+
+			require.NotNil(t, gotQuery)
+
+			assert.Equal(t, tc.domain, gotQuery.Domain)
+			assert.Equal(t, "192.0.2.1", gotQuery.ClientIP)
+			assert.Equal(t, "cli", gotQuery.ClientID)
+			assert.Equal(t, "A", gotQuery.QType)
+			assert.Equal(t, tc.res.IsFiltered, gotQuery.Filtered)
+		})
+	}
+
+	t.Run("protection_disabled", func(t *testing.T) {
+		gotQuery = nil
+		noProtCtx := &dnsContext{proxyCtx: dctx.proxyCtx}
+
+		got := s.applyQueryHook(noProtCtx, "block.example", dns.TypeA, blocked)
+		assert.Same(t, blocked, got)
+		assert.Nil(t, gotQuery)
+	})
+}
+
+func BenchmarkServer_handleDNSRequest(b *testing.B) {
+	const rules = "||blocked.example^\n@@||allowed.example^\n127.0.0.1 host.example\n"
+
+	f, err := filtering.New(&filtering.Config{}, []filtering.Filter{{
+		ID: 0, Data: []byte(rules),
+	}})
+	require.NoError(b, err)
+
+	f.SetEnabled(true)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  testDHCP,
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+	})
+	require.NoError(b, err)
+
+	err = s.Prepare(&ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		FilteringConfig: FilteringConfig{
+			ProtectionEnabled: true,
+			BlockingMode:      BlockingModeDefault,
+			EDNSClientSubnet: &EDNSClientSubnet{
+				Enabled: false,
+			},
+		},
+	})
+	require.NoError(b, err)
+
+	s.conf.UpstreamConfig.Upstreams = []upstream.Upstream{&aghtest.Upstream{
+		IPv4: map[string][]net.IP{
+			"allowed.example.": {{1, 2, 3, 4}},
+			"passed.example.":  {{1, 2, 3, 4}},
+		},
+	}}
+
+	err = s.Start()
+	require.NoError(b, err)
+
+	testutil.CleanupAndRequireSuccess(b, s.Stop)
+
+	testCases := []struct {
+		name string
+		host string
+	}{{
+		name: "blocked",
+		host: "blocked.example.",
+	}, {
+		name: "host_rule",
+		host: "host.example.",
+	}, {
+		name: "allowed",
+		host: "allowed.example.",
+	}, {
+		name: "passed",
+		host: "passed.example.",
+	}}
+
+	addr := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 1}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			var pctx *proxy.DNSContext
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pctx = &proxy.DNSContext{
+					Proto: proxy.ProtoUDP,
+					Req:   createTestMessage(tc.host),
+					Addr:  addr,
+				}
+
+				err = s.handleDNSRequest(nil, pctx)
+			}
+
+			require.NoError(b, err)
+
+			assert.NotNil(b, pctx.Res)
+		})
+	}
+}
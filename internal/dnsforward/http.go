@@ -33,10 +33,22 @@ type jsonDNSConfig struct {
 	// UpstreamsFile is the file containing upstream DNS servers.
 	UpstreamsFile *string `json:"upstream_dns_file"`
 
+	// Fallbacks is the list of DNS servers used when the upstream DNS servers
+	// fail.
+	Fallbacks *[]string `json:"fallback_dns"`
+
 	// Bootstraps is the list of DNS servers resolving IP addresses of the
 	// upstream DoH/DoT resolvers.
 	Bootstraps *[]string `json:"bootstrap_dns"`
 
+	// PrivateBootstraps is the list of DNS servers resolving IP addresses of
+	// the private DoH/DoT resolvers.  If empty, Bootstraps are used.
+	PrivateBootstraps *[]string `json:"private_bootstrap_dns"`
+
+	// BootstrapFallback defines if the bootstrap DNS servers should be
+	// queried one by one in the configured order.
+	BootstrapFallback *bool `json:"bootstrap_fallback"`
+
 	// ProtectionEnabled defines if protection is enabled.
 	ProtectionEnabled *bool `json:"protection_enabled"`
 
@@ -73,6 +85,29 @@ type jsonDNSConfig struct {
 	// CacheOptimistic defines if expired entries should be served.
 	CacheOptimistic *bool `json:"cache_optimistic"`
 
+	// CacheNegativeTTLMin is the minimum TTL of the cached negative
+	// responses.
+	CacheNegativeTTLMin *uint32 `json:"cache_negative_ttl_min"`
+
+	// CacheNegativeTTLMax is the maximum TTL of the cached negative
+	// responses.
+	CacheNegativeTTLMax *uint32 `json:"cache_negative_ttl_max"`
+
+	// CacheServFailTTL is the time for which the failures are cached.
+	CacheServFailTTL *uint32 `json:"cache_servfail_ttl"`
+
+	// RebindingProtectionEnabled defines if the DNS rebinding protection is
+	// enabled.
+	RebindingProtectionEnabled *bool `json:"rebinding_protection_enabled"`
+
+	// RebindingAllowedDomains are the domains allowed to resolve to the
+	// addresses from the locally-served networks.
+	RebindingAllowedDomains *[]string `json:"rebinding_allowed_domains"`
+
+	// SingleLabelPolicy defines how the queries for the single-label hostnames
+	// are handled.
+	SingleLabelPolicy *SingleLabelPolicy `json:"single_label_policy"`
+
 	// ResolveClients defines if clients IPs should be resolved into hostnames.
 	ResolveClients *bool `json:"resolve_clients"`
 
@@ -108,7 +143,10 @@ func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
 
 	upstreams := stringutil.CloneSliceOrEmpty(s.conf.UpstreamDNS)
 	upstreamFile := s.conf.UpstreamDNSFileName
+	fallbacks := stringutil.CloneSliceOrEmpty(s.conf.FallbackDNS)
 	bootstraps := stringutil.CloneSliceOrEmpty(s.conf.BootstrapDNS)
+	privateBootstraps := stringutil.CloneSliceOrEmpty(s.conf.PrivateBootstrapDNS)
+	bootstrapFallback := s.conf.BootstrapFallback
 	blockingMode := s.conf.BlockingMode
 	blockingIPv4 := s.conf.BlockingIPv4
 	blockingIPv6 := s.conf.BlockingIPv6
@@ -124,6 +162,16 @@ func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
 	cacheMinTTL := s.conf.CacheMinTTL
 	cacheMaxTTL := s.conf.CacheMaxTTL
 	cacheOptimistic := s.conf.CacheOptimistic
+	cacheNegativeTTLMin := s.conf.CacheNegativeTTLMin
+	cacheNegativeTTLMax := s.conf.CacheNegativeTTLMax
+	cacheServFailTTL := s.conf.CacheServFailTTL
+	rebindingEnabled := s.conf.RebindingProtectionEnabled
+	rebindingAllowed := stringutil.CloneSliceOrEmpty(s.conf.RebindingAllowedDomains)
+	singleLabelPolicy := s.conf.SingleLabelPolicy
+	if singleLabelPolicy == "" {
+		singleLabelPolicy = SingleLabelPolicyForward
+	}
+
 	resolveClients := s.conf.ResolveClients
 	usePrivateRDNS := s.conf.UsePrivateRDNS
 	localPTRUpstreams := stringutil.CloneSliceOrEmpty(s.conf.LocalPTRResolvers)
@@ -147,29 +195,38 @@ func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
 	}
 
 	return &jsonDNSConfig{
-		Upstreams:                &upstreams,
-		UpstreamsFile:            &upstreamFile,
-		Bootstraps:               &bootstraps,
-		ProtectionEnabled:        &protectionEnabled,
-		BlockingMode:             &blockingMode,
-		BlockingIPv4:             blockingIPv4,
-		BlockingIPv6:             blockingIPv6,
-		RateLimit:                &ratelimit,
-		EDNSCSCustomIP:           customIP,
-		EDNSCSEnabled:            &enableEDNSClientSubnet,
-		EDNSCSUseCustom:          &useCustom,
-		DNSSECEnabled:            &enableDNSSEC,
-		DisableIPv6:              &aaaaDisabled,
-		CacheSize:                &cacheSize,
-		CacheMinTTL:              &cacheMinTTL,
-		CacheMaxTTL:              &cacheMaxTTL,
-		CacheOptimistic:          &cacheOptimistic,
-		UpstreamMode:             &upstreamMode,
-		ResolveClients:           &resolveClients,
-		UsePrivateRDNS:           &usePrivateRDNS,
-		LocalPTRUpstreams:        &localPTRUpstreams,
-		DefaultLocalPTRUpstreams: defLocalPTRUps,
-		DisabledUntil:            disabledUntil,
+		Upstreams:                  &upstreams,
+		UpstreamsFile:              &upstreamFile,
+		Fallbacks:                  &fallbacks,
+		Bootstraps:                 &bootstraps,
+		PrivateBootstraps:          &privateBootstraps,
+		BootstrapFallback:          &bootstrapFallback,
+		ProtectionEnabled:          &protectionEnabled,
+		BlockingMode:               &blockingMode,
+		BlockingIPv4:               blockingIPv4,
+		BlockingIPv6:               blockingIPv6,
+		RateLimit:                  &ratelimit,
+		EDNSCSCustomIP:             customIP,
+		EDNSCSEnabled:              &enableEDNSClientSubnet,
+		EDNSCSUseCustom:            &useCustom,
+		DNSSECEnabled:              &enableDNSSEC,
+		DisableIPv6:                &aaaaDisabled,
+		CacheSize:                  &cacheSize,
+		CacheMinTTL:                &cacheMinTTL,
+		CacheMaxTTL:                &cacheMaxTTL,
+		CacheOptimistic:            &cacheOptimistic,
+		CacheNegativeTTLMin:        &cacheNegativeTTLMin,
+		CacheNegativeTTLMax:        &cacheNegativeTTLMax,
+		CacheServFailTTL:           &cacheServFailTTL,
+		RebindingProtectionEnabled: &rebindingEnabled,
+		RebindingAllowedDomains:    &rebindingAllowed,
+		SingleLabelPolicy:          &singleLabelPolicy,
+		UpstreamMode:               &upstreamMode,
+		ResolveClients:             &resolveClients,
+		UsePrivateRDNS:             &usePrivateRDNS,
+		LocalPTRUpstreams:          &localPTRUpstreams,
+		DefaultLocalPTRUpstreams:   defLocalPTRUps,
+		DisabledUntil:              disabledUntil,
 	}
 }
 
@@ -194,14 +251,30 @@ func (req *jsonDNSConfig) checkUpstreamsMode() bool {
 }
 
 func (req *jsonDNSConfig) checkBootstrap() (err error) {
-	if req.Bootstraps == nil {
+	err = checkBootstraps(req.Bootstraps)
+	if err != nil {
+		return err
+	}
+
+	err = checkBootstraps(req.PrivateBootstraps)
+	if err != nil {
+		return fmt.Errorf("private: %w", err)
+	}
+
+	return nil
+}
+
+// checkBootstraps returns an error if any of the bootstrap addresses is
+// invalid.
+func checkBootstraps(bootstraps *[]string) (err error) {
+	if bootstraps == nil {
 		return nil
 	}
 
 	var b string
 	defer func() { err = errors.Annotate(err, "checking bootstrap %s: invalid address: %w", b) }()
 
-	for _, b = range *req.Bootstraps {
+	for _, b = range *bootstraps {
 		if b == "" {
 			return errors.Error("empty")
 		}
@@ -223,6 +296,13 @@ func (req *jsonDNSConfig) validate(privateNets netutil.SubnetSet) (err error) {
 		}
 	}
 
+	if req.Fallbacks != nil {
+		err = validateFallbacks(*req.Fallbacks)
+		if err != nil {
+			return fmt.Errorf("validating fallback servers: %w", err)
+		}
+	}
+
 	if req.LocalPTRUpstreams != nil {
 		err = ValidateUpstreamsPrivate(*req.LocalPTRUpstreams, privateNets)
 		if err != nil {
@@ -240,6 +320,25 @@ func (req *jsonDNSConfig) validate(privateNets netutil.SubnetSet) (err error) {
 		return err
 	}
 
+	err = req.checkNegativeCache()
+	if err != nil {
+		return err
+	}
+
+	if req.RebindingAllowedDomains != nil {
+		err = validateRebindingAllowedDomains(*req.RebindingAllowedDomains)
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.SingleLabelPolicy != nil {
+		err = validateSingleLabelPolicy(*req.SingleLabelPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
 	switch {
 	case !req.checkUpstreamsMode():
 		return errors.Error("upstream_mode: incorrect value")
@@ -266,6 +365,17 @@ func (req *jsonDNSConfig) checkCacheTTL() bool {
 	return min <= max
 }
 
+// checkNegativeCache returns an error if the negative caching settings of req
+// aren't valid.  The absent settings are considered zero.
+func (req *jsonDNSConfig) checkNegativeCache() (err error) {
+	var min, max, servFailTTL uint32
+	setIfNotNil(&min, req.CacheNegativeTTLMin)
+	setIfNotNil(&max, req.CacheNegativeTTLMax)
+	setIfNotNil(&servFailTTL, req.CacheServFailTTL)
+
+	return validateNegativeCache(min, max, servFailTTL)
+}
+
 // handleSetConfig handles requests to the POST /control/dns_config endpoint.
 func (s *Server) handleSetConfig(w http.ResponseWriter, r *http.Request) {
 	req := &jsonDNSConfig{}
@@ -322,6 +432,9 @@ func (s *Server) setConfig(dc *jsonDNSConfig) (shouldRestart bool) {
 	setIfNotNil(&s.conf.AAAADisabled, dc.DisableIPv6)
 	setIfNotNil(&s.conf.ResolveClients, dc.ResolveClients)
 	setIfNotNil(&s.conf.UsePrivateRDNS, dc.UsePrivateRDNS)
+	setIfNotNil(&s.conf.RebindingProtectionEnabled, dc.RebindingProtectionEnabled)
+	setIfNotNil(&s.conf.RebindingAllowedDomains, dc.RebindingAllowedDomains)
+	setIfNotNil(&s.conf.SingleLabelPolicy, dc.SingleLabelPolicy)
 
 	return s.setConfigRestartable(dc)
 }
@@ -346,13 +459,19 @@ func (s *Server) setConfigRestartable(dc *jsonDNSConfig) (shouldRestart bool) {
 		setIfNotNil(&s.conf.UpstreamDNS, dc.Upstreams),
 		setIfNotNil(&s.conf.LocalPTRResolvers, dc.LocalPTRUpstreams),
 		setIfNotNil(&s.conf.UpstreamDNSFileName, dc.UpstreamsFile),
+		setIfNotNil(&s.conf.FallbackDNS, dc.Fallbacks),
 		setIfNotNil(&s.conf.BootstrapDNS, dc.Bootstraps),
+		setIfNotNil(&s.conf.PrivateBootstrapDNS, dc.PrivateBootstraps),
+		setIfNotNil(&s.conf.BootstrapFallback, dc.BootstrapFallback),
 		setIfNotNil(&s.conf.EDNSClientSubnet.Enabled, dc.EDNSCSEnabled),
 		setIfNotNil(&s.conf.EDNSClientSubnet.UseCustom, dc.EDNSCSUseCustom),
 		setIfNotNil(&s.conf.CacheSize, dc.CacheSize),
 		setIfNotNil(&s.conf.CacheMinTTL, dc.CacheMinTTL),
 		setIfNotNil(&s.conf.CacheMaxTTL, dc.CacheMaxTTL),
 		setIfNotNil(&s.conf.CacheOptimistic, dc.CacheOptimistic),
+		setIfNotNil(&s.conf.CacheNegativeTTLMin, dc.CacheNegativeTTLMin),
+		setIfNotNil(&s.conf.CacheNegativeTTLMax, dc.CacheNegativeTTLMax),
+		setIfNotNil(&s.conf.CacheServFailTTL, dc.CacheServFailTTL),
 	} {
 		shouldRestart = shouldRestart || hasSet
 		if shouldRestart {
@@ -437,6 +556,29 @@ func ValidateUpstreams(upstreams []string) (err error) {
 	return err
 }
 
+// validateFallbacks validates each fallback upstream and returns an error if
+// any of them is invalid or domain-specific.
+func validateFallbacks(fallbacks []string) (err error) {
+	for _, f := range stringutil.FilterOut(fallbacks, IsCommentOrEmpty) {
+		var ups string
+		var domains []string
+		ups, domains, err = separateUpstream(f)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		} else if domains != nil {
+			return fmt.Errorf("validating fallback %q: domain-specific fallbacks are not supported", f)
+		}
+
+		_, err = validateUpstream(ups, nil)
+		if err != nil {
+			return fmt.Errorf("validating fallback %q: %w", f, err)
+		}
+	}
+
+	return nil
+}
+
 // ValidateUpstreamsPrivate validates each upstream and returns an error if any
 // upstream is invalid or if there are no default upstreams specified.  It also
 // checks each domain of domain-specific upstreams for being ARPA pointing to
@@ -588,7 +730,7 @@ func checkDNSUpstreamExc(u upstream.Upstream) (err error) {
 	if err != nil {
 		return fmt.Errorf("couldn't communicate with upstream: %w", err)
 	} else if len(reply.Answer) != 0 {
-		return errors.Error("wrong response")
+		return errWrongResponse
 	}
 
 	return nil
@@ -648,52 +790,20 @@ func checkDNS(
 	timeout time.Duration,
 	healthCheck healthCheckFunc,
 ) (err error) {
-	if IsCommentOrEmpty(upstreamConfigStr) {
-		return nil
-	}
-
-	// Separate upstream from domains list.
-	upstreamAddr, domains, err := separateUpstream(upstreamConfigStr)
-	if err != nil {
-		return fmt.Errorf("wrong upstream format: %w", err)
-	}
-
-	useDefault, err := validateUpstream(upstreamAddr, domains)
-	if err != nil {
-		return fmt.Errorf("wrong upstream format: %w", err)
-	} else if useDefault {
-		return nil
-	}
-
-	if len(bootstrap) == 0 {
-		bootstrap = defaultBootstrap
-	}
-
-	log.Debug("dnsforward: checking if upstream %q works", upstreamAddr)
-
-	u, err := upstream.AddressToUpstream(upstreamAddr, &upstream.Options{
-		Bootstrap: bootstrap,
-		Timeout:   timeout,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to choose upstream for %q: %w", upstreamAddr, err)
-	}
-	defer func() { err = errors.WithDeferred(err, u.Close()) }()
-
-	if err = healthCheck(u); err != nil {
-		err = fmt.Errorf("upstream %q fails to exchange: %w", upstreamAddr, err)
-		if domains != nil {
-			return domainSpecificTestError{error: err}
-		}
-
-		return err
-	}
+	_, err = testUpstream(upstreamConfigStr, bootstrap, timeout, healthCheck)
 
-	log.Debug("dnsforward: upstream %q is ok", upstreamAddr)
+	return err
+}
 
-	return nil
+// CheckUpstream checks if the upstream server defined by ups resolves queries.
+// It uses bootstrap to resolve the upstream's address.  If bootstrap is empty,
+// the default bootstrap servers are used.
+func CheckUpstream(ups string, bootstrap []string, timeout time.Duration) (err error) {
+	return checkDNS(ups, bootstrap, timeout, checkDNSUpstreamExc)
 }
 
+// handleTestUpstreamDNS is the handler for the POST /control/test_upstream_dns
+// HTTP API.
 func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 	req := &upstreamJSON{}
 	err := json.NewDecoder(r.Body).Decode(req)
@@ -703,12 +813,12 @@ func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := map[string]string{}
+	result := map[string]*upstreamTestJSON{}
 	bootstraps := req.BootstrapDNS
 	timeout := s.conf.UpstreamTimeout
 
 	type upsCheckResult = struct {
-		res  string
+		res  *upstreamTestJSON
 		host string
 	}
 
@@ -721,11 +831,12 @@ func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 		}
 		defer func() { resCh <- res }()
 
-		checkErr := checkDNS(ups, bootstraps, timeout, healthCheck)
+		var checkErr error
+		res.res, checkErr = testUpstream(ups, bootstraps, timeout, healthCheck)
 		if checkErr != nil {
-			res.res = checkErr.Error()
+			res.res.Status = checkErr.Error()
 		} else {
-			res.res = "OK"
+			res.res.Status = "OK"
 		}
 	}
 
@@ -750,9 +861,24 @@ func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 // handleCacheClear is the handler for the POST /control/cache_clear HTTP API.
 func (s *Server) handleCacheClear(w http.ResponseWriter, _ *http.Request) {
 	s.dnsProxy.ClearCache()
+	s.responseCache().clear()
 	_, _ = io.WriteString(w, "OK")
 }
 
+// cacheStatsJSON is the response of the GET /control/cache_stats HTTP API.
+type cacheStatsJSON struct {
+	// Shards are the statistics of the shards of the DNS cache.  It's empty if
+	// the cache isn't sharded.
+	Shards []*CacheShardStats `json:"shards"`
+}
+
+// handleCacheStats is the handler for the GET /control/cache_stats HTTP API.
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	_ = aghhttp.WriteJSONResponse(w, r, &cacheStatsJSON{
+		Shards: s.responseCache().stats(),
+	})
+}
+
 // protectionJSON is an object for /control/protection endpoint.
 type protectionJSON struct {
 	Enabled  bool `json:"enabled"`
@@ -805,6 +931,7 @@ func (s *Server) handleSetProtection(w http.ResponseWriter, r *http.Request) {
 //
 //	HTTP server
 //	-> dnsforward.handleDoH
+//	-> dnsforward.handleDoHJSON, if it's a DNS JSON API request
 //	-> dnsforward.ServeHTTP
 //	-> proxy.ServeHTTP
 //	-> proxy.handleDNSRequest
@@ -822,6 +949,12 @@ func (s *Server) handleDoH(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isDoHJSONRequest(r) {
+		s.handleDoHJSON(w, r)
+
+		return
+	}
+
 	s.ServeHTTP(w, r)
 }
 
@@ -833,12 +966,30 @@ func (s *Server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodGet, "/control/dns_info", s.handleGetConfig)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dns_config", s.handleSetConfig)
 	s.conf.HTTPRegister(http.MethodPost, "/control/test_upstream_dns", s.handleTestUpstreamDNS)
+	s.conf.HTTPRegister(http.MethodPost, "/control/upstream/trace", s.handleUpstreamTrace)
+	s.conf.HTTPRegister(http.MethodGet, "/control/bootstrap/status", s.handleBootstrapStatus)
 	s.conf.HTTPRegister(http.MethodPost, "/control/protection", s.handleSetProtection)
 
 	s.conf.HTTPRegister(http.MethodGet, "/control/access/list", s.handleAccessList)
 	s.conf.HTTPRegister(http.MethodPost, "/control/access/set", s.handleAccessSet)
 
 	s.conf.HTTPRegister(http.MethodPost, "/control/cache_clear", s.handleCacheClear)
+	s.conf.HTTPRegister(http.MethodGet, "/control/cache_stats", s.handleCacheStats)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/tools/lookup", s.handleLookup)
+	s.conf.HTTPRegister(http.MethodGet, "/control/tools/block_preview", s.handleBlockPreview)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/quarantine/list", s.handleQuarantineList)
+	s.conf.HTTPRegister(http.MethodPost, "/control/quarantine/add", s.handleQuarantineAdd)
+	s.conf.HTTPRegister(http.MethodPost, "/control/quarantine/remove", s.handleQuarantineRemove)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/security/tunnels", s.handleTunnels)
+	s.conf.HTTPRegister(http.MethodPost, "/control/security/tunnels/forget", s.handleTunnelForget)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/parental/bypass/status", s.handleParentalBypassStatus)
+	s.conf.HTTPRegister(http.MethodPost, "/control/parental/bypass/start", s.handleParentalBypassStart)
+	s.conf.HTTPRegister(http.MethodPost, "/control/parental/bypass/stop", s.handleParentalBypassStop)
+	s.conf.HTTPRegister(http.MethodPut, "/control/parental/bypass/pin", s.handleParentalBypassPIN)
 
 	// Register both versions, with and without the trailing slash, to
 	// prevent a 301 Moved Permanently redirect when clients request the
@@ -169,6 +169,12 @@ func TestDNSForwardHTTP_handleSetConfig(t *testing.T) {
 	}, {
 		name:    "bootstraps",
 		wantSet: "",
+	}, {
+		name:    "private_bootstraps",
+		wantSet: "",
+	}, {
+		name:    "fallbacks",
+		wantSet: "",
 	}, {
 		name:    "blocking_mode_good",
 		wantSet: "",
@@ -206,9 +212,37 @@ func TestDNSForwardHTTP_handleSetConfig(t *testing.T) {
 		name: "bootstraps_bad",
 		wantSet: `checking bootstrap a: invalid address: ` +
 			`Resolver a is not eligible to be a bootstrap DNS server`,
+	}, {
+		name: "fallbacks_bad",
+		wantSet: `validating fallback servers: validating fallback "[/example.org/]1.1.1.1": ` +
+			`domain-specific fallbacks are not supported`,
+	}, {
+		name: "private_bootstraps_bad",
+		wantSet: `private: checking bootstrap a: invalid address: ` +
+			`Resolver a is not eligible to be a bootstrap DNS server`,
 	}, {
 		name:    "cache_bad_ttl",
 		wantSet: `cache_ttl_min must be less or equal than cache_ttl_max`,
+	}, {
+		name:    "cache_negative",
+		wantSet: "",
+	}, {
+		name:    "cache_negative_bad_ttl",
+		wantSet: `cache_servfail_ttl must be less or equal than 300, got 600`,
+	}, {
+		name:    "rebinding",
+		wantSet: "",
+	}, {
+		name: "rebinding_bad_domain",
+		wantSet: `rebinding_allowed_domains: at index 0: bad domain name "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
+	}, {
+		name:    "single_label",
+		wantSet: "",
+	}, {
+		name:    "single_label_bad",
+		wantSet: `single_label_policy: bad value "drop"`,
 	}, {
 		name:    "upstream_mode_bad",
 		wantSet: `upstream_mode: incorrect value`,
@@ -468,35 +502,46 @@ func TestServer_handleTestUpstreaDNS(t *testing.T) {
 	}, nil)
 	startDeferStop(t, srv)
 
+	goodRes := &upstreamTestJSON{
+		Status:    "OK",
+		Protocol:  "tcp",
+		Addresses: []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+	}
+	badRes := &upstreamTestJSON{
+		Status: `upstream "` + badUps + `" fails to exchange: ` +
+			`couldn't communicate with upstream: dns: id mismatch`,
+		ErrorClass: upsErrClassBadResponse,
+		Protocol:   "tcp",
+		Addresses:  []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+	}
+
 	testCases := []struct {
 		body     map[string]any
-		wantResp map[string]any
+		wantResp map[string]*upstreamTestJSON
 		name     string
 	}{{
 		body: map[string]any{
 			"upstream_dns": []string{goodUps},
 		},
-		wantResp: map[string]any{
-			goodUps: "OK",
+		wantResp: map[string]*upstreamTestJSON{
+			goodUps: goodRes,
 		},
 		name: "success",
 	}, {
 		body: map[string]any{
 			"upstream_dns": []string{badUps},
 		},
-		wantResp: map[string]any{
-			badUps: `upstream "` + badUps + `" fails to exchange: ` +
-				`couldn't communicate with upstream: dns: id mismatch`,
+		wantResp: map[string]*upstreamTestJSON{
+			badUps: badRes,
 		},
 		name: "broken",
 	}, {
 		body: map[string]any{
 			"upstream_dns": []string{goodUps, badUps},
 		},
-		wantResp: map[string]any{
-			goodUps: "OK",
-			badUps: `upstream "` + badUps + `" fails to exchange: ` +
-				`couldn't communicate with upstream: dns: id mismatch`,
+		wantResp: map[string]*upstreamTestJSON{
+			goodUps: goodRes,
+			badUps:  badRes,
 		},
 		name: "both",
 	}}
@@ -513,10 +558,16 @@ func TestServer_handleTestUpstreaDNS(t *testing.T) {
 			srv.handleTestUpstreamDNS(w, r)
 			require.Equal(t, http.StatusOK, w.Code)
 
-			resp := map[string]any{}
+			resp := map[string]*upstreamTestJSON{}
 			err = json.NewDecoder(w.Body).Decode(&resp)
 			require.NoError(t, err)
 
+			for _, res := range resp {
+				// RTT can't be predicted.
+				assert.Positive(t, res.RTT)
+				res.RTT = 0
+			}
+
 			assert.Equal(t, tc.wantResp, resp)
 		})
 	}
@@ -545,15 +596,16 @@ func TestServer_handleTestUpstreaDNS(t *testing.T) {
 		srv.handleTestUpstreamDNS(w, r)
 		require.Equal(t, http.StatusOK, w.Code)
 
-		resp := map[string]any{}
+		resp := map[string]*upstreamTestJSON{}
 		err = json.NewDecoder(w.Body).Decode(&resp)
 		require.NoError(t, err)
 
 		require.Contains(t, resp, sleepyUps)
-		require.IsType(t, "", resp[sleepyUps])
-		sleepyRes, _ := resp[sleepyUps].(string)
+		sleepyRes := resp[sleepyUps]
+		require.NotNil(t, sleepyRes)
 
 		// TODO(e.burkov):  Improve the format of an error in dnsproxy.
-		assert.True(t, strings.HasSuffix(sleepyRes, "i/o timeout"))
+		assert.True(t, strings.HasSuffix(sleepyRes.Status, "i/o timeout"))
+		assert.Equal(t, upsErrClassTimeout, sleepyRes.ErrorClass)
 	})
 }
@@ -0,0 +1,291 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// Lookup Tool
+
+// Results of the stages of the processing of a request reported by the lookup
+// tool.
+const (
+	lookupResultContinue = "continue"
+	lookupResultFinish   = "finish"
+	lookupResultError    = "error"
+)
+
+// lookupStageJSON is the outcome of a single stage of the processing of a
+// request.
+type lookupStageJSON struct {
+	// Name is the name of the stage.
+	Name string `json:"name"`
+
+	// Result is either "continue", "finish", or "error".
+	Result string `json:"result"`
+
+	// Error is the error returned from the stage, if any.
+	Error string `json:"error,omitempty"`
+
+	// Answered is true if the response has been set by the stage.
+	Answered bool `json:"answered"`
+}
+
+// lookupFilteringJSON is the result of the filtering of a request.
+type lookupFilteringJSON struct {
+	// Reason is the reason of the filtering result.
+	Reason string `json:"reason"`
+
+	// ServiceName is the name of the blocked service, if any.
+	ServiceName string `json:"service_name,omitempty"`
+
+	// Rules are the texts of the matched rules.
+	Rules []string `json:"rules"`
+
+	// IsFiltered is true if the request has been blocked.
+	IsFiltered bool `json:"is_filtered"`
+}
+
+// lookupRewriteJSON is the rewrite applied to a request.
+type lookupRewriteJSON struct {
+	// CanonName is the rewritten host name, if any.
+	CanonName string `json:"canon_name,omitempty"`
+
+	// IPs are the rewritten IP addresses, if any.
+	IPs []net.IP `json:"ip_addrs,omitempty"`
+}
+
+// lookupUpstreamJSON is the upstream which has resolved a request.
+type lookupUpstreamJSON struct {
+	// Group is "custom" if the client has its own upstreams, and "default"
+	// otherwise.
+	Group string `json:"group"`
+
+	// Address is the address of the upstream.
+	Address string `json:"address,omitempty"`
+
+	// Cached is true if the response has been taken from the cache.
+	Cached bool `json:"cached"`
+
+	// Fallback is true if the request has been resolved by the fallback
+	// upstreams.
+	Fallback bool `json:"fallback"`
+}
+
+// lookupResp is the response of the GET /control/tools/lookup HTTP API.
+type lookupResp struct {
+	// Rewrite is the rewrite applied to the request, if any.
+	Rewrite *lookupRewriteJSON `json:"rewrite,omitempty"`
+
+	// Filtering is the result of the filtering of the request.
+	Filtering *lookupFilteringJSON `json:"filtering"`
+
+	// Upstream is the upstream which has resolved the request, if any.
+	Upstream *lookupUpstreamJSON `json:"upstream,omitempty"`
+
+	// Rcode is the response code of the answer, if any.
+	Rcode string `json:"rcode,omitempty"`
+
+	// Answer is the answer in the presentation format, if any.
+	Answer string `json:"answer,omitempty"`
+
+	// Stages are the outcomes of the stages of the processing in the order
+	// of their execution.
+	Stages []*lookupStageJSON `json:"stages"`
+
+	// Elapsed is the duration of the processing in milliseconds.
+	Elapsed float64 `json:"elapsed_ms"`
+}
+
+// lookup resolves the request from client through all the stages of the
+// processing except the ones with side effects, like the query log, and
+// reports their outcomes.
+func (s *Server) lookup(req *dns.Msg, client netip.Addr) (resp *lookupResp) {
+	dctx, stages := s.dryRun(req, client)
+	pctx := dctx.proxyCtx
+
+	resp = &lookupResp{
+		Filtering: newLookupFilteringJSON(dctx.result),
+		Stages:    stages,
+		Elapsed:   float64(time.Since(dctx.startTime)) / float64(time.Millisecond),
+	}
+
+	switch dctx.result.Reason {
+	case filtering.Rewritten, filtering.RewrittenAutoHosts, filtering.RewrittenRule:
+		resp.Rewrite = &lookupRewriteJSON{
+			CanonName: dctx.result.CanonName,
+			IPs:       dctx.result.IPList,
+		}
+	default:
+		// Go on.
+	}
+
+	if dctx.responseFromUpstream {
+		resp.Upstream = newLookupUpstreamJSON(dctx)
+	}
+
+	if pctx.Res != nil {
+		resp.Rcode = dns.RcodeToString[pctx.Res.Rcode]
+		resp.Answer = pctx.Res.String()
+	}
+
+	return resp
+}
+
+// dryRun processes the request from client through all the stages except the
+// ones with side effects and returns the resulting context along with the
+// outcomes of the executed stages.  The stages with a preview are executed in
+// their side-effect-free form.
+func (s *Server) dryRun(req *dns.Msg, client netip.Addr) (dctx *dnsContext, stages []*lookupStageJSON) {
+	pctx := &proxy.DNSContext{
+		Proto:     proxy.ProtoUDP,
+		Req:       req,
+		Addr:      net.UDPAddrFromAddrPort(netip.AddrPortFrom(client, 0)),
+		StartTime: time.Now(),
+	}
+	dctx = &dnsContext{
+		proxyCtx:  pctx,
+		result:    &filtering.Result{},
+		startTime: pctx.StartTime,
+	}
+
+	for _, stage := range s.processStages() {
+		if stage.sideEffects {
+			continue
+		}
+
+		hadRes := pctx.Res != nil
+		st := &lookupStageJSON{
+			Name:   stage.name,
+			Result: lookupResultContinue,
+		}
+
+		process := stage.process
+		if stage.preview != nil {
+			process = stage.preview
+		}
+
+		rc := process(dctx)
+		st.Answered = !hadRes && pctx.Res != nil
+		stages = append(stages, st)
+
+		if rc == resultCodeFinish {
+			st.Result = lookupResultFinish
+
+			break
+		} else if rc == resultCodeError {
+			st.Result = lookupResultError
+			if dctx.err != nil {
+				st.Error = dctx.err.Error()
+			}
+
+			break
+		}
+	}
+
+	return dctx, stages
+}
+
+// newLookupFilteringJSON returns the filtering result for the lookup tool.
+func newLookupFilteringJSON(res *filtering.Result) (f *lookupFilteringJSON) {
+	f = &lookupFilteringJSON{
+		Reason:      res.Reason.String(),
+		ServiceName: res.ServiceName,
+		Rules:       make([]string, 0, len(res.Rules)),
+		IsFiltered:  res.IsFiltered,
+	}
+
+	for _, r := range res.Rules {
+		f.Rules = append(f.Rules, r.Text)
+	}
+
+	return f
+}
+
+// newLookupUpstreamJSON returns the description of the upstream which has
+// resolved the request of dctx for the lookup tool.
+func newLookupUpstreamJSON(dctx *dnsContext) (u *lookupUpstreamJSON) {
+	pctx := dctx.proxyCtx
+	u = &lookupUpstreamJSON{
+		Group:    "default",
+		Cached:   pctx.CachedUpstreamAddr != "",
+		Fallback: dctx.responseFromFallback,
+	}
+
+	if pctx.CustomUpstreamConfig != nil {
+		u.Group = "custom"
+	}
+
+	if pctx.Upstream != nil {
+		u.Address = pctx.Upstream.Address()
+	} else {
+		u.Address = pctx.CachedUpstreamAddr
+	}
+
+	return u
+}
+
+// handleLookup is the handler for the GET /control/tools/lookup HTTP API.
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	req, client, err := parseLookupQuery(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, s.lookup(req, client))
+}
+
+// parseLookupQuery returns the DNS request and the client's IP address from the
+// "name", "type", and "client" URL query parameters of r.
+func parseLookupQuery(r *http.Request) (req *dns.Msg, client netip.Addr, err error) {
+	q := r.URL.Query()
+
+	host := strings.TrimSuffix(q.Get("name"), ".")
+	err = netutil.ValidateDomainName(host)
+	if err != nil {
+		return nil, netip.Addr{}, fmt.Errorf("name: %w", err)
+	}
+
+	qtype := dns.TypeA
+	if typStr := q.Get("type"); typStr != "" {
+		var ok bool
+		qtype, ok = dns.StringToType[strings.ToUpper(typStr)]
+		if !ok {
+			return nil, netip.Addr{}, fmt.Errorf("type: bad value %q", typStr)
+		}
+	}
+
+	client, err = lookupClient(q.Get("client"), r.RemoteAddr)
+	if err != nil {
+		return nil, netip.Addr{}, fmt.Errorf("client: %w", err)
+	}
+
+	return (&dns.Msg{}).SetQuestion(dns.Fqdn(host), qtype), client, nil
+}
+
+// lookupClient returns the IP address of the client on behalf of which the
+// lookup is made.  If clientStr is empty, the address from remoteAddr is used.
+func lookupClient(clientStr, remoteAddr string) (client netip.Addr, err error) {
+	if clientStr != "" {
+		return netip.ParseAddr(clientStr)
+	}
+
+	ap, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("parsing remote address: %w", err)
+	}
+
+	return ap.Addr().Unmap(), nil
+}
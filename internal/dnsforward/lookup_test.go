@@ -0,0 +1,146 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_lookup(t *testing.T) {
+	c := &filtering.Config{
+		Rewrites: []*filtering.LegacyRewrite{{
+			Domain: "rewritten.example",
+			Answer: "192.0.2.1",
+			Type:   dns.TypeA,
+		}},
+	}
+	f, err := filtering.New(c, []filtering.Filter{{
+		ID: 0, Data: []byte("||blocked.example^\n"),
+	}})
+	require.NoError(t, err)
+
+	f.SetEnabled(true)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  testDHCP,
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+	})
+	require.NoError(t, err)
+
+	const pin = "1234"
+
+	var bypassEvents []*ParentalBypassEvent
+	require.NoError(t, s.Prepare(&ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		OnParentalBypass: func(e *ParentalBypassEvent) {
+			bypassEvents = append(bypassEvents, e)
+		},
+		FilteringConfig: FilteringConfig{
+			ProtectionEnabled: true,
+			BlockingMode:      BlockingModeDefault,
+			ParentalBypassPIN: newTestPINHash(t, pin),
+			EDNSClientSubnet: &EDNSClientSubnet{
+				Enabled: false,
+			},
+		},
+	}))
+
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		return aghalg.Coalesce(
+			aghtest.MatchedResponse(req, dns.TypeA, "upstream.example", "192.0.2.2"),
+			new(dns.Msg).SetRcode(req, dns.RcodeNameError),
+		), nil
+	})
+	s.conf.UpstreamConfig.Upstreams = []upstream.Upstream{ups}
+	startDeferStop(t, s)
+
+	client := netip.MustParseAddr("192.0.2.100")
+
+	testCases := []struct {
+		wantRewrite  *lookupRewriteJSON
+		wantUpstream *lookupUpstreamJSON
+		name         string
+		host         string
+		wantReason   string
+		wantRcode    string
+		wantRules    []string
+	}{{
+		wantRewrite:  nil,
+		wantUpstream: &lookupUpstreamJSON{Group: "default", Address: "upstream.example"},
+		name:         "upstream",
+		host:         "upstream.example.",
+		wantReason:   "NotFilteredNotFound",
+		wantRcode:    "NOERROR",
+		wantRules:    []string{},
+	}, {
+		wantRewrite: &lookupRewriteJSON{
+			IPs: []net.IP{{192, 0, 2, 1}},
+		},
+		wantUpstream: nil,
+		name:         "rewrite",
+		host:         "rewritten.example.",
+		wantReason:   "Rewrite",
+		wantRcode:    "NOERROR",
+		wantRules:    []string{},
+	}, {
+		wantRewrite:  nil,
+		wantUpstream: nil,
+		name:         "blocked",
+		host:         "blocked.example.",
+		wantReason:   "FilteredBlackList",
+		wantRcode:    "NOERROR",
+		wantRules:    []string{"||blocked.example^"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA)
+			resp := s.lookup(req, client)
+
+			assert.Equal(t, tc.wantRewrite, resp.Rewrite)
+			assert.Equal(t, tc.wantUpstream, resp.Upstream)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			assert.NotEmpty(t, resp.Answer)
+
+			require.NotNil(t, resp.Filtering)
+
+			assert.Equal(t, tc.wantReason, resp.Filtering.Reason)
+			assert.Equal(t, tc.wantRules, resp.Filtering.Rules)
+
+			require.NotEmpty(t, resp.Stages)
+
+			for _, st := range resp.Stages {
+				assert.NotEqual(t, "query_log_and_stats", st.Name)
+			}
+		})
+	}
+
+	t.Run("parental_bypass", func(t *testing.T) {
+		for _, p := range []string{"0000", pin} {
+			req := (&dns.Msg{}).SetQuestion(p+"."+parentalBypassDomain, dns.TypeA)
+			resp := s.lookup(req, client)
+
+			require.NotEmpty(t, resp.Stages)
+
+			st := resp.Stages[len(resp.Stages)-1]
+			assert.Equal(t, "parental_bypass", st.Name)
+			assert.Equal(t, lookupResultFinish, st.Result)
+			assert.False(t, st.Answered)
+		}
+
+		assert.Empty(t, s.parentalBypass.entries)
+		assert.Empty(t, s.parentalBypass.failures)
+		assert.Empty(t, bypassEvents)
+	})
+}
@@ -13,6 +13,9 @@ import (
 
 // makeResponse creates a DNS response by req and sets necessary flags.  It also
 // guarantees that req.Question will be not empty.
+//
+// NOTE:  The responses aren't taken from a pool, since dnsproxy keeps using
+// them after the handlers return, for example, for caching and writing.
 func (s *Server) makeResponse(req *dns.Msg) (resp *dns.Msg) {
 	resp = &dns.Msg{
 		MsgHdr: dns.MsgHdr{
@@ -38,10 +41,38 @@ func ipsFromRules(resRules []*filtering.ResultRule) (ips []net.IP) {
 }
 
 // genDNSFilterMessage generates a filtered response to req for the filtering
-// result res.
+// result res.  The TTLs of the response records are overridden if the TTL of
+// the blocked responses is set for the matched rule or its filter list.
 func (s *Server) genDNSFilterMessage(
 	dctx *proxy.DNSContext,
 	res *filtering.Result,
+) (resp *dns.Msg) {
+	resp = s.genFilteredMessage(dctx, res)
+	if s.dnsFilter == nil {
+		return resp
+	}
+
+	ttl, ok := s.dnsFilter.BlockedResponseTTL(res)
+	if !ok {
+		return resp
+	}
+
+	for _, rr := range resp.Answer {
+		rr.Header().Ttl = ttl
+	}
+
+	for _, rr := range resp.Ns {
+		rr.Header().Ttl = ttl
+	}
+
+	return resp
+}
+
+// genFilteredMessage generates a filtered response to req for the filtering
+// result res with the TTLs set according to the server's configuration.
+func (s *Server) genFilteredMessage(
+	dctx *proxy.DNSContext,
+	res *filtering.Result,
 ) (resp *dns.Msg) {
 	req := dctx.Req
 	if qt := req.Question[0].Qtype; qt != dns.TypeA && qt != dns.TypeAAAA {
@@ -196,6 +227,7 @@ func (s *Server) genResponseWithIPs(req *dns.Msg, ips []net.IP) (resp *dns.Msg)
 	var ans []dns.RR
 	switch req.Question[0].Qtype {
 	case dns.TypeA:
+		ans = make([]dns.RR, 0, len(ips))
 		for _, ip := range ips {
 			if ip4 := ip.To4(); ip4 == nil {
 				ans = nil
@@ -206,6 +238,7 @@ func (s *Server) genResponseWithIPs(req *dns.Msg, ips []net.IP) (resp *dns.Msg)
 			ans = append(ans, s.genAnswerA(req, ip))
 		}
 	case dns.TypeAAAA:
+		ans = make([]dns.RR, 0, len(ips))
 		for _, ip := range ips {
 			ans = append(ans, s.genAnswerAAAA(req, ip.To16()))
 		}
@@ -230,7 +263,7 @@ func (s *Server) makeResponseNullIP(req *dns.Msg) (resp *dns.Msg) {
 	case dns.TypeA:
 		resp = s.genResponseWithIPs(req, []net.IP{{0, 0, 0, 0}})
 	case dns.TypeAAAA:
-		resp = s.genResponseWithIPs(req, []net.IP{net.IPv6zero})
+		resp = s.genResponseWithIPs(req, []net.IP{make(net.IP, net.IPv6len)})
 	default:
 		resp = s.makeResponse(req)
 	}
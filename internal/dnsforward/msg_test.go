@@ -0,0 +1,200 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var msgSink *dns.Msg
+
+func BenchmarkServer_genDNSFilterMessage(b *testing.B) {
+	req := (&dns.Msg{}).SetQuestion("blocked.example.", dns.TypeA)
+	pctx := &proxy.DNSContext{
+		Req: req,
+	}
+
+	res := &filtering.Result{
+		Rules: []*filtering.ResultRule{{
+			Text: "||blocked.example^",
+		}, {
+			Text: "1.2.3.4 blocked.example",
+			IP:   net.IP{1, 2, 3, 4},
+		}},
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	}
+
+	testCases := []struct {
+		name string
+		mode BlockingMode
+	}{{
+		name: "default",
+		mode: BlockingModeDefault,
+	}, {
+		name: "null_ip",
+		mode: BlockingModeNullIP,
+	}, {
+		name: "nxdomain",
+		mode: BlockingModeNXDOMAIN,
+	}}
+
+	for _, tc := range testCases {
+		s := &Server{
+			conf: ServerConfig{
+				FilteringConfig: FilteringConfig{
+					BlockingMode:       tc.mode,
+					BlockedResponseTTL: 10,
+				},
+			},
+		}
+
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msgSink = s.genDNSFilterMessage(pctx, res)
+			}
+
+			assert.NotNil(b, msgSink)
+		})
+	}
+}
+
+func TestServer_genDNSFilterMessage_blockedTTL(t *testing.T) {
+	const globalTTL uint32 = 10
+
+	f, err := filtering.New(&filtering.Config{
+		UserRules: []string{
+			"||rule-ttl.example^$ttl=1",
+			"||no-ttl.example^",
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	f.EnableFilters(false)
+
+	testCases := []struct {
+		name string
+		host string
+		mode BlockingMode
+		want uint32
+	}{{
+		name: "rule_null_ip",
+		host: "rule-ttl.example",
+		mode: BlockingModeNullIP,
+		want: 1,
+	}, {
+		name: "rule_nxdomain",
+		host: "rule-ttl.example",
+		mode: BlockingModeNXDOMAIN,
+		want: 1,
+	}, {
+		name: "global_null_ip",
+		host: "no-ttl.example",
+		mode: BlockingModeNullIP,
+		want: globalTTL,
+	}, {
+		name: "global_nxdomain",
+		host: "no-ttl.example",
+		mode: BlockingModeNXDOMAIN,
+		want: globalTTL,
+	}}
+
+	setts := &filtering.Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	for _, tc := range testCases {
+		s := &Server{
+			dnsFilter: f,
+			conf: ServerConfig{
+				FilteringConfig: FilteringConfig{
+					BlockingMode:       tc.mode,
+					BlockedResponseTTL: globalTTL,
+				},
+			},
+		}
+
+		t.Run(tc.name, func(t *testing.T) {
+			res, cErr := f.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, cErr)
+			require.True(t, res.IsFiltered)
+
+			pctx := &proxy.DNSContext{
+				Req: (&dns.Msg{}).SetQuestion(dns.Fqdn(tc.host), dns.TypeA),
+			}
+
+			resp := s.genDNSFilterMessage(pctx, &res)
+			rrs := append(resp.Answer, resp.Ns...)
+			require.NotEmpty(t, rrs)
+
+			for _, rr := range rrs {
+				assert.Equal(t, tc.want, rr.Header().Ttl)
+			}
+		})
+	}
+}
+
+func TestServer_makeResponseNullIP_notShared(t *testing.T) {
+	s := &Server{
+		conf: ServerConfig{
+			FilteringConfig: FilteringConfig{
+				BlockedResponseTTL: 10,
+			},
+		},
+	}
+
+	testCases := []struct {
+		want  net.IP
+		name  string
+		qtype uint16
+	}{{
+		want:  net.IP{0, 0, 0, 0},
+		name:  "a",
+		qtype: dns.TypeA,
+	}, {
+		want:  net.IPv6zero,
+		name:  "aaaa",
+		qtype: dns.TypeAAAA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := (&dns.Msg{}).SetQuestion("blocked.example.", tc.qtype)
+
+			resp := s.makeResponseNullIP(req)
+			require.Len(t, resp.Answer, 1)
+
+			var ip net.IP
+			switch ans := resp.Answer[0].(type) {
+			case *dns.A:
+				ip = ans.A
+			case *dns.AAAA:
+				ip = ans.AAAA
+			default:
+				t.Fatalf("unexpected answer type %T", ans)
+			}
+
+			// Modify the address of the first response, which must not affect
+			// the next one.
+			ip[0] = 1
+
+			resp = s.makeResponseNullIP(req)
+			require.Len(t, resp.Answer, 1)
+
+			switch ans := resp.Answer[0].(type) {
+			case *dns.A:
+				assert.Equal(t, tc.want, ans.A)
+			case *dns.AAAA:
+				assert.Equal(t, tc.want, ans.AAAA)
+			}
+		})
+	}
+}
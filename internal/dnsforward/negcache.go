@@ -0,0 +1,241 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// Negative Caching
+
+// maxServFailCacheTTL is the maximum time-to-live of a cached SERVFAIL in
+// seconds, which is the upper limit given by RFC 2308.
+//
+// See https://datatracker.ietf.org/doc/html/rfc2308#section-7.1.
+const maxServFailCacheTTL = 5 * 60
+
+// maxServFailCacheSize is the maximum number of the questions in the SERVFAIL
+// cache.
+const maxServFailCacheSize = 10_000
+
+// validateNegativeCache returns an error if the negative caching settings
+// aren't valid.  max of zero means that there is no upper limit.
+func validateNegativeCache(min, max, servFailTTL uint32) (err error) {
+	if max != 0 && min > max {
+		return fmt.Errorf(
+			"cache_negative_ttl_min %d must be less or equal than cache_negative_ttl_max %d",
+			min,
+			max,
+		)
+	}
+
+	if servFailTTL > maxServFailCacheTTL {
+		return fmt.Errorf(
+			"cache_servfail_ttl must be less or equal than %d, got %d",
+			maxServFailCacheTTL,
+			servFailTTL,
+		)
+	}
+
+	return nil
+}
+
+// isNegative returns true if resp is an NXDOMAIN or a NODATA response.
+func isNegative(resp *dns.Msg) (ok bool) {
+	return resp.Rcode == dns.RcodeNameError ||
+		(resp.Rcode == dns.RcodeSuccess && len(resp.Answer) == 0)
+}
+
+// clampNegativeTTL sets the TTL and the minimum TTL of the SOA records within
+// the authority section of the negative response resp to be within min and
+// max, which are used by the cache to calculate the time-to-live of the
+// response.  max of zero means that there is no upper limit.
+//
+// See https://datatracker.ietf.org/doc/html/rfc2308#section-5.
+func clampNegativeTTL(resp *dns.Msg, min, max uint32) {
+	if !isNegative(resp) {
+		return
+	}
+
+	clamp := func(ttl uint32) (clamped uint32) {
+		if max != 0 && ttl > max {
+			ttl = max
+		}
+
+		if ttl < min {
+			ttl = min
+		}
+
+		return ttl
+	}
+
+	for _, rr := range resp.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+
+		soa.Hdr.Ttl = clamp(soa.Hdr.Ttl)
+		soa.Minttl = clamp(soa.Minttl)
+	}
+}
+
+// negativeTTLUpstream is an upstream, which clamps the TTLs of its negative
+// responses before those are cached.
+type negativeTTLUpstream struct {
+	upstream.Upstream
+
+	// min is the minimum TTL of the negative responses.
+	min uint32
+
+	// max is the maximum TTL of the negative responses.  Zero means that
+	// there is no upper limit.
+	max uint32
+}
+
+// type check
+var _ upstream.Upstream = (*negativeTTLUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for
+// *negativeTTLUpstream.
+func (u *negativeTTLUpstream) Exchange(m *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(m)
+	if err == nil && resp != nil {
+		clampNegativeTTL(resp, u.min, u.max)
+	}
+
+	return resp, err
+}
+
+// wrapNegativeTTL wraps the upstreams of conf, so that the TTLs of their
+// negative responses are within min and max.  It does nothing if both are
+// zero.
+func wrapNegativeTTL(conf *proxy.UpstreamConfig, min, max uint32) {
+	if min == 0 && max == 0 {
+		return
+	}
+
+	// The same upstream may be used for several domains.
+	wrapped := map[upstream.Upstream]*negativeTTLUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			w, ok := wrapped[u]
+			if !ok {
+				w = &negativeTTLUpstream{Upstream: u, min: min, max: max}
+				wrapped[u] = w
+			}
+
+			ups[i] = w
+		}
+	}
+
+	wrap(conf.Upstreams)
+	for _, ups := range conf.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range conf.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+}
+
+// servFailKey is the key of the SERVFAIL cache.
+type servFailKey struct {
+	// name is the lowercased question name.
+	name string
+
+	// qtype is the question type.
+	qtype uint16
+
+	// qclass is the question class.
+	qclass uint16
+}
+
+// newServFailKey returns the SERVFAIL cache key for q.
+func newServFailKey(q dns.Question) (k servFailKey) {
+	return servFailKey{
+		name:   strings.ToLower(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+	}
+}
+
+// servFailCache contains the questions, resolving which has recently failed, so
+// that those are answered with SERVFAIL without querying the upstreams until
+// the entries expire.  A nil *servFailCache caches nothing.  It's safe for
+// concurrent use.
+type servFailCache struct {
+	// mu protects entries.
+	mu *sync.Mutex
+
+	// entries are the expiration times of the cached failures.
+	entries map[servFailKey]time.Time
+
+	// ttl is the time-to-live of the cached failures.
+	ttl time.Duration
+}
+
+// newServFailCache returns a new SERVFAIL cache with ttl in seconds.  If ttl
+// is zero, it returns nil.
+func newServFailCache(ttl uint32) (c *servFailCache) {
+	if ttl == 0 {
+		return nil
+	}
+
+	return &servFailCache{
+		mu:      &sync.Mutex{},
+		entries: map[servFailKey]time.Time{},
+		ttl:     time.Duration(ttl) * time.Second,
+	}
+}
+
+// set caches the failure of resolving q at now.  If the cache is full, the
+// expired entries are removed, and if there are none, q isn't cached.
+func (c *servFailCache) set(q dns.Question, now time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxServFailCacheSize {
+		for k, exp := range c.entries {
+			if !now.Before(exp) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= maxServFailCacheSize {
+			return
+		}
+	}
+
+	c.entries[newServFailKey(q)] = now.Add(c.ttl)
+}
+
+// has returns true if the failure of resolving q is cached at now.  The
+// expired entry for q is removed.
+func (c *servFailCache) has(q dns.Question, now time.Time) (ok bool) {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := newServFailKey(q)
+	exp, ok := c.entries[k]
+	if ok && !now.Before(exp) {
+		delete(c.entries, k)
+
+		return false
+	}
+
+	return ok
+}
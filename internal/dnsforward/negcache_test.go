@@ -0,0 +1,116 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClampNegativeTTL(t *testing.T) {
+	newResp := func(rcode int, ttl uint32, ans ...dns.RR) (resp *dns.Msg) {
+		return &dns.Msg{
+			MsgHdr: dns.MsgHdr{
+				Rcode: rcode,
+			},
+			Answer: ans,
+			Ns: []dns.RR{&dns.SOA{
+				Hdr: dns.RR_Header{
+					Name:   "example.org.",
+					Rrtype: dns.TypeSOA,
+					Class:  dns.ClassINET,
+					Ttl:    ttl,
+				},
+				Minttl: ttl,
+			}},
+		}
+	}
+
+	ans := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.org.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+	}
+
+	testCases := []struct {
+		resp *dns.Msg
+		name string
+		want uint32
+	}{{
+		resp: newResp(dns.RcodeNameError, 3600),
+		name: "nxdomain_max",
+		want: 600,
+	}, {
+		resp: newResp(dns.RcodeSuccess, 1),
+		name: "nodata_min",
+		want: 10,
+	}, {
+		resp: newResp(dns.RcodeNameError, 300),
+		name: "within",
+		want: 300,
+	}, {
+		resp: newResp(dns.RcodeSuccess, 3600, ans),
+		name: "positive",
+		want: 3600,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clampNegativeTTL(tc.resp, 10, 600)
+
+			require.Len(t, tc.resp.Ns, 1)
+
+			soa := testutil.RequireTypeAssert[*dns.SOA](t, tc.resp.Ns[0])
+			assert.Equal(t, tc.want, soa.Hdr.Ttl)
+			assert.Equal(t, tc.want, soa.Minttl)
+		})
+	}
+}
+
+func TestServFailCache(t *testing.T) {
+	q := dns.Question{
+		Name:   "Example.ORG.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+	lowerQ := q
+	lowerQ.Name = "example.org."
+
+	now := time.Now()
+
+	var nilCache *servFailCache
+	nilCache.set(q, now)
+	assert.False(t, nilCache.has(q, now))
+	assert.Nil(t, newServFailCache(0))
+
+	c := newServFailCache(30)
+	assert.False(t, c.has(q, now))
+
+	c.set(q, now)
+	assert.True(t, c.has(lowerQ, now.Add(29*time.Second)))
+	assert.False(t, c.has(dns.Question{Name: q.Name, Qtype: dns.TypeAAAA, Qclass: dns.ClassINET}, now))
+	assert.False(t, c.has(q, now.Add(30*time.Second)))
+	assert.Empty(t, c.entries)
+}
+
+func TestValidateNegativeCache(t *testing.T) {
+	assert.NoError(t, validateNegativeCache(10, 0, 0))
+	assert.NoError(t, validateNegativeCache(10, 600, maxServFailCacheTTL))
+
+	testutil.AssertErrorMsg(
+		t,
+		"cache_negative_ttl_min 600 must be less or equal than cache_negative_ttl_max 10",
+		validateNegativeCache(600, 10, 0),
+	)
+	testutil.AssertErrorMsg(
+		t,
+		"cache_servfail_ttl must be less or equal than 300, got 301",
+		validateNegativeCache(0, 0, 301),
+	)
+}
@@ -0,0 +1,668 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Parental Control Bypass
+
+// parentalBypassDomain is the reserved domain, a query for the <PIN> subdomain
+// of which starts the parental control bypass for the client.  See the comment
+// on healthcheck.adguardhome.test in [Server.processInitial].
+const parentalBypassDomain = "bypass.adguardhome.test."
+
+// defaultParentalBypassDuration is the default duration of the parental
+// control bypass.
+const defaultParentalBypassDuration = 30 * time.Minute
+
+// Parental control bypass brute-force protection.
+const (
+	// maxParentalBypassFailures is the number of failed attempts, after which
+	// the client is locked out.
+	maxParentalBypassFailures = 5
+
+	// parentalBypassLockout is the duration of the lockout.  It's also the
+	// period, within which the attempts are counted against
+	// [maxParentalBypassAttempts], and after which the failures of a client
+	// are forgotten.
+	parentalBypassLockout = 15 * time.Minute
+
+	// maxParentalBypassAttempts is the number of attempts of a client or from
+	// a source address within [parentalBypassLockout], successful or not,
+	// after which its further attempts are rejected until the period ends.  It
+	// limits the CPU time a single client spends on comparing the PINs.
+	maxParentalBypassAttempts = 30
+
+	// maxParentalBypassFailureKeys is the maximum number of the clients and
+	// the source addresses, the attempts of which are tracked.  The attempts
+	// are rejected when there is no room for their keys, which limits the
+	// guessing with spoofed source addresses or rotating ClientIDs.
+	maxParentalBypassFailureKeys = 1_000
+)
+
+// Parental control bypass PIN constraints.
+const (
+	minParentalBypassPINLen = 4
+	maxParentalBypassPINLen = 16
+)
+
+// Methods of starting the parental control bypass.
+const (
+	ParentalBypassMethodDNS = "dns"
+	ParentalBypassMethodAPI = "api"
+)
+
+// ParentalBypassEvent is an attempt to start the parental control bypass.
+type ParentalBypassEvent struct {
+	// Expires is the time the bypass ends.  It's zero if the attempt has
+	// failed.
+	Expires time.Time
+
+	// Client is the IP address or the ClientID of the client.
+	Client string
+
+	// Method is the method the attempt has been made with, either
+	// [ParentalBypassMethodDNS] or [ParentalBypassMethodAPI].
+	Method string
+}
+
+// parentalBypassEntry is a single client with the bypassed parental control.
+type parentalBypassEntry struct {
+	// Expires is the time when the bypass ends.
+	Expires time.Time `json:"expires"`
+
+	// Client is the IP address or the ClientID of the client.
+	Client string `json:"client"`
+}
+
+// parentalBypassFailures are the attempts of a client.
+type parentalBypassFailures struct {
+	// lockedUntil is the time until which all attempts of the client are
+	// rejected.
+	lockedUntil time.Time
+
+	// last is the time of the last failed attempt.
+	last time.Time
+
+	// attemptsStart is the start of the current period of counting the
+	// attempts of the client.
+	attemptsStart time.Time
+
+	// count is the number of consecutive failed attempts.
+	count int
+
+	// attempts is the number of the attempts of the client within the current
+	// period.
+	attempts int
+}
+
+// expired returns true if f doesn't affect the attempts at now anymore.
+func (f *parentalBypassFailures) expired(now time.Time) (ok bool) {
+	return !now.Before(f.lockedUntil) &&
+		now.Sub(f.last) >= parentalBypassLockout &&
+		now.Sub(f.attemptsStart) >= parentalBypassLockout
+}
+
+// parentalBypass is the set of the clients, for which the parental control and
+// the safe search are temporarily disabled.  The zero value is ready to use.  A
+// parentalBypass is safe for concurrent use.
+type parentalBypass struct {
+	// mu protects all the fields.
+	mu sync.Mutex
+
+	// entries are the bypass expiration times by the clients' IP addresses
+	// and ClientIDs.
+	entries map[string]time.Time
+
+	// failures are the attempts by the clients' IP addresses and ClientIDs as
+	// well as by the source IP addresses of the attempts.
+	failures map[string]*parentalBypassFailures
+}
+
+// clientKeys returns the keys of the client with ip and clientID, ClientID
+// first.
+func clientKeys(ip netip.Addr, clientID string) (keys []string) {
+	if clientID != "" {
+		keys = append(keys, clientID)
+	}
+
+	if ip.IsValid() {
+		keys = append(keys, ip.String())
+	}
+
+	return keys
+}
+
+// active returns true if the bypass is active for the client with ip and
+// clientID at now.  The expired entries are removed.
+func (b *parentalBypass) active(ip netip.Addr, clientID string, now time.Time) (ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.entries) == 0 {
+		return false
+	}
+
+	for _, key := range clientKeys(ip, clientID) {
+		exp, has := b.entries[key]
+		if !has {
+			continue
+		} else if !now.Before(exp) {
+			log.Debug("dnsforward: parental bypass of %q expired", key)
+			delete(b.entries, key)
+
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// errParentalBypassLocked is returned by [parentalBypass.start] when the client
+// has made too many failed attempts.
+const errParentalBypassLocked errors.Error = "too many failed attempts"
+
+// errParentalBypassLimit is returned by [parentalBypass.start] when the client
+// has made too many attempts or too many clients are making attempts.
+const errParentalBypassLimit errors.Error = "too many attempts, try again later"
+
+// errParentalBypassPIN is returned by [parentalBypass.start] when the PIN
+// doesn't match.
+const errParentalBypassPIN errors.Error = "wrong pin"
+
+// start checks pin against pinHash and starts the bypass for client until
+// now + dur.  src is the source address of the attempt, if it may differ from
+// the client, for example when the client is identified by its ClientID.  It
+// returns an error if the client or src is locked out, the attempts are limited
+// at the moment, or the PIN is wrong.
+func (b *parentalBypass) start(
+	client string,
+	src netip.Addr,
+	pin string,
+	pinHash string,
+	dur time.Duration,
+	now time.Time,
+) (expires time.Time, err error) {
+	keys := attemptKeys(client, src)
+	err = b.reserve(keys, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Don't hold the lock while comparing, since it's slow by design.  The
+	// attempt is already counted as a failure by reserve.
+	err = validateParentalBypassPIN(pin)
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin))
+	}
+
+	if err != nil {
+		return time.Time{}, errParentalBypassPIN
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, k := range keys {
+		if f := b.failures[k]; f != nil {
+			f.count, f.lockedUntil = 0, time.Time{}
+		}
+	}
+
+	if b.entries == nil {
+		b.entries = map[string]time.Time{}
+	}
+
+	expires = now.Add(dur)
+	b.entries[client] = expires
+
+	return expires, nil
+}
+
+// attemptKeys returns the keys of the failures of the attempt of client from
+// src.
+func attemptKeys(client string, src netip.Addr) (keys []string) {
+	keys = []string{client}
+	if src.IsValid() {
+		if s := src.String(); s != client {
+			keys = append(keys, s)
+		}
+	}
+
+	return keys
+}
+
+// reserve checks if an attempt with the failure keys is allowed at now and
+// records it as a failure in advance, so that the concurrent attempts can't
+// exceed the limits while their PINs are being compared.  The successful
+// attempt resets the consecutive failures, but is still counted against
+// [maxParentalBypassAttempts].
+func (b *parentalBypass) reserve(keys []string, now time.Time) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	newKeys := 0
+	for _, k := range keys {
+		f, ok := b.failures[k]
+		switch {
+		case !ok:
+			newKeys++
+		case now.Before(f.lockedUntil):
+			return errParentalBypassLocked
+		case f.attempts >= maxParentalBypassAttempts &&
+			now.Sub(f.attemptsStart) < parentalBypassLockout:
+			return errParentalBypassLimit
+		}
+	}
+
+	if len(b.failures)+newKeys > maxParentalBypassFailureKeys {
+		maps.DeleteFunc(b.failures, func(_ string, f *parentalBypassFailures) (del bool) {
+			return f.expired(now)
+		})
+
+		if len(b.failures)+newKeys > maxParentalBypassFailureKeys {
+			return errParentalBypassLimit
+		}
+	}
+
+	for _, k := range keys {
+		b.addFailure(k, now)
+	}
+
+	return nil
+}
+
+// addFailure records a failed attempt with the key at now and locks the key
+// out after too many of those.  b.mu is expected to be locked.
+func (b *parentalBypass) addFailure(key string, now time.Time) {
+	if b.failures == nil {
+		b.failures = map[string]*parentalBypassFailures{}
+	}
+
+	f := b.failures[key]
+	if f == nil || f.expired(now) {
+		f = &parentalBypassFailures{}
+		b.failures[key] = f
+	}
+
+	if now.Sub(f.attemptsStart) >= parentalBypassLockout {
+		f.attemptsStart, f.attempts = now, 0
+	}
+
+	f.attempts++
+	f.last = now
+	f.count++
+	if f.count >= maxParentalBypassFailures {
+		f.count = 0
+		f.lockedUntil = now.Add(parentalBypassLockout)
+	}
+}
+
+// stop ends the bypass of client.  ok is false if there was no bypass for
+// client.
+func (b *parentalBypass) stop(client string) (ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok = b.entries[client]
+	delete(b.entries, client)
+
+	return ok
+}
+
+// list returns the clients with the active bypass at now sorted by the client.
+// The expired entries are removed.
+func (b *parentalBypass) list(now time.Time) (entries []*parentalBypassEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	maps.DeleteFunc(b.entries, func(_ string, exp time.Time) (del bool) {
+		return !now.Before(exp)
+	})
+
+	entries = make([]*parentalBypassEntry, 0, len(b.entries))
+	for c, exp := range b.entries {
+		entries = append(entries, &parentalBypassEntry{
+			Expires: exp,
+			Client:  c,
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b *parentalBypassEntry) (sortsBefore bool) {
+		return a.Client < b.Client
+	})
+
+	return entries
+}
+
+// validateParentalBypassPIN returns an error if pin isn't a valid bypass PIN.
+// The PIN must only consist of digits, since it's sent as a DNS label, which
+// is case-insensitive.
+func validateParentalBypassPIN(pin string) (err error) {
+	if l := len(pin); l < minParentalBypassPINLen || l > maxParentalBypassPINLen {
+		return fmt.Errorf(
+			"pin must be from %d to %d digits long, got %d",
+			minParentalBypassPINLen,
+			maxParentalBypassPINLen,
+			l,
+		)
+	}
+
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("pin must only contain digits, got %q", c)
+		}
+	}
+
+	return nil
+}
+
+// startParentalBypass starts the parental control bypass for client with pin
+// using method and reports the attempt.  src is the source address of the
+// attempt, if it's not trusted to be the client.  If dur is zero, the
+// configured duration is used.
+func (s *Server) startParentalBypass(
+	client string,
+	src netip.Addr,
+	pin string,
+	dur time.Duration,
+	method string,
+) (expires time.Time, err error) {
+	s.serverLock.RLock()
+	pinHash := s.conf.ParentalBypassPIN
+	if dur == 0 {
+		dur = s.conf.ParentalBypassDuration.Duration
+	}
+	onBypass := s.conf.OnParentalBypass
+	s.serverLock.RUnlock()
+
+	if pinHash == "" {
+		return time.Time{}, errors.Error("parental bypass is disabled")
+	}
+
+	if dur == 0 {
+		dur = defaultParentalBypassDuration
+	}
+
+	expires, err = s.parentalBypass.start(client, src, pin, pinHash, dur, time.Now())
+	if err != nil {
+		log.Info("dnsforward: parental bypass for %q via %s: %s", client, method, err)
+	} else {
+		log.Info("dnsforward: parental bypass for %q via %s until %s", client, method, expires)
+	}
+
+	if onBypass != nil {
+		onBypass(&ParentalBypassEvent{
+			Expires: expires,
+			Client:  client,
+			Method:  method,
+		})
+	}
+
+	return expires, err
+}
+
+// processParentalBypass handles the queries for the subdomains of
+// [parentalBypassDomain].  The subdomain is the PIN, and the query starts the
+// bypass for the querying client.  The successful attempts are answered with
+// NODATA and the failed ones with REFUSED.  The processing is finished here,
+// so that the PIN doesn't get into the query log.
+func (s *Server) processParentalBypass(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	pin, ok := parentalBypassQuery(pctx.Req)
+	if !ok {
+		return resultCodeSuccess
+	}
+
+	src := netutil.NetAddrToAddrPort(pctx.Addr).Addr().Unmap()
+	client := dctx.clientID
+	if client == "" {
+		client = src.String()
+	}
+
+	pctx.Res = s.makeResponse(pctx.Req)
+
+	_, err := s.startParentalBypass(client, src, pin, 0, ParentalBypassMethodDNS)
+	if err != nil {
+		pctx.Res.Rcode = dns.RcodeRefused
+	}
+
+	return resultCodeFinish
+}
+
+// previewParentalBypass is the side-effect-free version of
+// [Server.processParentalBypass] for the lookup tool.  It finishes the
+// processing of the queries for the subdomains of [parentalBypassDomain]
+// without answering them, since the answer depends on the PIN, which must
+// neither start the bypass nor count as a failed attempt, and mustn't be
+// checked at all, so that the tool can't be used to guess it.
+func (s *Server) previewParentalBypass(dctx *dnsContext) (rc resultCode) {
+	if _, ok := parentalBypassQuery(dctx.proxyCtx.Req); !ok {
+		return resultCodeSuccess
+	}
+
+	return resultCodeFinish
+}
+
+// parentalBypassQuery returns the PIN from req.  ok is false if req isn't a
+// query for a subdomain of [parentalBypassDomain].
+func parentalBypassQuery(req *dns.Msg) (pin string, ok bool) {
+	name := strings.ToLower(req.Question[0].Name)
+	pin = strings.TrimSuffix(name, "."+parentalBypassDomain)
+
+	return pin, pin != name
+}
+
+// parentalBypassStatusJSON is the response to the GET
+// /control/parental/bypass/status HTTP API.
+type parentalBypassStatusJSON struct {
+	// Clients are the clients with the active bypass.
+	Clients []*parentalBypassEntry `json:"clients"`
+
+	// Domain is the domain, a query for the <PIN> subdomain of which starts
+	// the bypass.
+	Domain string `json:"domain"`
+
+	// Duration is the default duration of the bypass.
+	Duration timeutil.Duration `json:"duration"`
+
+	// Enabled is true if the bypass PIN is set.
+	Enabled bool `json:"enabled"`
+}
+
+// handleParentalBypassStatus is the handler for the GET
+// /control/parental/bypass/status HTTP API.
+func (s *Server) handleParentalBypassStatus(w http.ResponseWriter, r *http.Request) {
+	resp := &parentalBypassStatusJSON{
+		Clients: s.parentalBypass.list(time.Now()),
+		Domain:  strings.TrimSuffix(parentalBypassDomain, "."),
+	}
+
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		resp.Enabled = s.conf.ParentalBypassPIN != ""
+		resp.Duration = s.conf.ParentalBypassDuration
+	}()
+
+	if resp.Duration.Duration == 0 {
+		resp.Duration.Duration = defaultParentalBypassDuration
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// parentalBypassStartJSON is the request to the POST
+// /control/parental/bypass/start HTTP API.
+type parentalBypassStartJSON struct {
+	// Client is the IP address or the ClientID of the client.
+	Client string `json:"client"`
+
+	// PIN is the bypass PIN.
+	PIN string `json:"pin"`
+
+	// Duration is the duration of the bypass.  If zero, the configured one is
+	// used.
+	Duration timeutil.Duration `json:"duration"`
+}
+
+// parentalBypassStartRespJSON is the response to the POST
+// /control/parental/bypass/start HTTP API.
+type parentalBypassStartRespJSON struct {
+	// Expires is the time when the bypass ends.
+	Expires time.Time `json:"expires"`
+}
+
+// handleParentalBypassStart is the handler for the POST
+// /control/parental/bypass/start HTTP API.
+func (s *Server) handleParentalBypassStart(w http.ResponseWriter, r *http.Request) {
+	req := &parentalBypassStartJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	client, err := normalizeQuarantineClient(req.Client)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client: %s", err)
+
+		return
+	}
+
+	if req.Duration.Duration < 0 {
+		aghhttp.Error(r, w, http.StatusBadRequest, "duration: negative value %s", req.Duration)
+
+		return
+	}
+
+	dur := req.Duration.Duration
+	// The API is only available to the authenticated users, so don't count the
+	// attempts against the address of the user.
+	expires, err := s.startParentalBypass(client, netip.Addr{}, req.PIN, dur, ParentalBypassMethodAPI)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusForbidden, "starting bypass: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, &parentalBypassStartRespJSON{
+		Expires: expires,
+	})
+}
+
+// parentalBypassStopJSON is the request to the POST
+// /control/parental/bypass/stop HTTP API.
+type parentalBypassStopJSON struct {
+	Client string `json:"client"`
+}
+
+// handleParentalBypassStop is the handler for the POST
+// /control/parental/bypass/stop HTTP API.
+func (s *Server) handleParentalBypassStop(w http.ResponseWriter, r *http.Request) {
+	req := &parentalBypassStopJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	client, err := normalizeQuarantineClient(req.Client)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client: %s", err)
+
+		return
+	}
+
+	if !s.parentalBypass.stop(client) {
+		aghhttp.Error(r, w, http.StatusNotFound, "no parental bypass for client %q", client)
+
+		return
+	}
+
+	log.Info("dnsforward: stopped parental bypass for %q", client)
+}
+
+// parentalBypassPINJSON is the request to the PUT /control/parental/bypass/pin
+// HTTP API.
+type parentalBypassPINJSON struct {
+	// PIN is the new bypass PIN.  If empty, the bypass is disabled.
+	PIN string `json:"pin"`
+
+	// Duration is the new default duration of the bypass.  If zero, the
+	// current one is kept.
+	Duration timeutil.Duration `json:"duration"`
+}
+
+// handleParentalBypassPIN is the handler for the PUT
+// /control/parental/bypass/pin HTTP API.
+func (s *Server) handleParentalBypassPIN(w http.ResponseWriter, r *http.Request) {
+	req := &parentalBypassPINJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if req.Duration.Duration < 0 {
+		aghhttp.Error(r, w, http.StatusBadRequest, "duration: negative value %s", req.Duration)
+
+		return
+	}
+
+	var pinHash string
+	if req.PIN != "" {
+		err = validateParentalBypassPIN(req.PIN)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+			return
+		}
+
+		var hash []byte
+		hash, err = bcrypt.GenerateFromPassword([]byte(req.PIN), bcrypt.DefaultCost)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusInternalServerError, "hashing pin: %s", err)
+
+			return
+		}
+
+		pinHash = string(hash)
+	}
+
+	func() {
+		s.serverLock.Lock()
+		defer s.serverLock.Unlock()
+
+		s.conf.ParentalBypassPIN = pinHash
+		if req.Duration.Duration != 0 {
+			s.conf.ParentalBypassDuration = req.Duration
+		}
+	}()
+
+	s.conf.ConfigModified()
+
+	log.Info("dnsforward: parental bypass pin updated, enabled: %t", pinHash != "")
+}
@@ -0,0 +1,252 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestPINHash returns the bcrypt hash of pin with the minimum cost.
+func newTestPINHash(t *testing.T, pin string) (hash string) {
+	t.Helper()
+
+	data, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestParentalBypass(t *testing.T) {
+	const (
+		pin    = "1234"
+		client = "192.168.1.10"
+	)
+
+	hash := newTestPINHash(t, pin)
+	now := time.Now()
+	ip := netip.MustParseAddr(client)
+
+	b := &parentalBypass{}
+	assert.False(t, b.active(ip, "", now))
+
+	_, err := b.start(client, netip.Addr{}, "0000", hash, time.Minute, now)
+	assert.ErrorIs(t, err, errParentalBypassPIN)
+	assert.False(t, b.active(ip, "", now))
+
+	expires, err := b.start(client, netip.Addr{}, pin, hash, time.Minute, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, now.Add(time.Minute), expires)
+	assert.True(t, b.active(ip, "", now))
+	assert.True(t, b.active(ip, "laptop", now))
+	assert.False(t, b.active(netip.MustParseAddr("192.168.1.11"), "", now))
+
+	assert.Equal(t, []*parentalBypassEntry{{
+		Expires: expires,
+		Client:  client,
+	}}, b.list(now))
+
+	assert.False(t, b.active(ip, "", expires))
+	assert.Empty(t, b.list(expires))
+
+	_, err = b.start(client, netip.Addr{}, pin, hash, time.Minute, now)
+	require.NoError(t, err)
+
+	assert.True(t, b.stop(client))
+	assert.False(t, b.stop(client))
+	assert.False(t, b.active(ip, "", now))
+}
+
+func TestParentalBypass_lockout(t *testing.T) {
+	const (
+		pin    = "1234"
+		client = "laptop"
+	)
+
+	hash := newTestPINHash(t, pin)
+	now := time.Now()
+
+	b := &parentalBypass{}
+	for i := 0; i < maxParentalBypassFailures; i++ {
+		_, err := b.start(client, netip.Addr{}, "0000", hash, time.Minute, now)
+		require.ErrorIs(t, err, errParentalBypassPIN)
+	}
+
+	_, err := b.start(client, netip.Addr{}, pin, hash, time.Minute, now)
+	assert.ErrorIs(t, err, errParentalBypassLocked)
+
+	_, err = b.start("phone", netip.Addr{}, pin, hash, time.Minute, now)
+	assert.NoError(t, err)
+
+	_, err = b.start(client, netip.Addr{}, pin, hash, time.Minute, now.Add(parentalBypassLockout))
+	assert.NoError(t, err)
+}
+
+func TestParentalBypass_limits(t *testing.T) {
+	const pin = "1234"
+
+	hash := newTestPINHash(t, pin)
+	now := time.Now()
+	src := netip.MustParseAddr("192.168.1.10")
+
+	t.Run("rotating_clientids", func(t *testing.T) {
+		b := &parentalBypass{}
+		for i := 0; i < maxParentalBypassFailures; i++ {
+			_, err := b.start(fmt.Sprintf("client%d", i), src, "0000", hash, time.Minute, now)
+			require.ErrorIs(t, err, errParentalBypassPIN)
+		}
+
+		_, err := b.start("another", src, pin, hash, time.Minute, now)
+		assert.ErrorIs(t, err, errParentalBypassLocked)
+	})
+
+	t.Run("per_client", func(t *testing.T) {
+		b := &parentalBypass{}
+		for i := 0; i < maxParentalBypassAttempts; i++ {
+			_, err := b.start("laptop", netip.Addr{}, pin, hash, time.Minute, now)
+			require.NoError(t, err)
+		}
+
+		_, err := b.start("laptop", netip.Addr{}, pin, hash, time.Minute, now)
+		assert.ErrorIs(t, err, errParentalBypassLimit)
+
+		_, err = b.start("phone", netip.Addr{}, pin, hash, time.Minute, now)
+		assert.NoError(t, err)
+
+		_, err = b.start("laptop", netip.Addr{}, pin, hash, time.Minute, now.Add(parentalBypassLockout))
+		assert.NoError(t, err)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		b := &parentalBypass{}
+
+		const n = maxParentalBypassFailures * 2
+
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				_, err := b.start("laptop", netip.Addr{}, "0000", hash, time.Minute, now)
+				errs <- err
+			}()
+		}
+
+		locked := 0
+		for i := 0; i < n; i++ {
+			if errors.Is(<-errs, errParentalBypassLocked) {
+				locked++
+			}
+		}
+
+		assert.Equal(t, n-maxParentalBypassFailures, locked)
+	})
+
+	t.Run("failure_keys", func(t *testing.T) {
+		b := &parentalBypass{
+			failures: map[string]*parentalBypassFailures{},
+		}
+		for i := 0; i < maxParentalBypassFailureKeys; i++ {
+			b.failures[fmt.Sprintf("client%d", i)] = &parentalBypassFailures{last: now, count: 1}
+		}
+
+		_, err := b.start("another", netip.Addr{}, pin, hash, time.Minute, now)
+		assert.ErrorIs(t, err, errParentalBypassLimit)
+
+		_, err = b.start("another", netip.Addr{}, pin, hash, time.Minute, now.Add(parentalBypassLockout))
+		require.NoError(t, err)
+
+		assert.Len(t, b.failures, 1)
+		assert.Contains(t, b.failures, "another")
+	})
+}
+
+func TestValidateParentalBypassPIN(t *testing.T) {
+	testCases := []struct {
+		name       string
+		pin        string
+		wantErrMsg string
+	}{{
+		name:       "valid",
+		pin:        "1234",
+		wantErrMsg: "",
+	}, {
+		name:       "short",
+		pin:        "123",
+		wantErrMsg: "pin must be from 4 to 16 digits long, got 3",
+	}, {
+		name:       "long",
+		pin:        "12345678901234567",
+		wantErrMsg: "pin must be from 4 to 16 digits long, got 17",
+	}, {
+		name:       "letters",
+		pin:        "12ab",
+		wantErrMsg: `pin must only contain digits, got 'a'`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateParentalBypassPIN(tc.pin))
+		})
+	}
+}
+
+func TestServer_processParentalBypass(t *testing.T) {
+	const pin = "1234"
+
+	var events []*ParentalBypassEvent
+	s := &Server{
+		conf: ServerConfig{
+			FilteringConfig: FilteringConfig{
+				ParentalBypassPIN: newTestPINHash(t, pin),
+			},
+			OnParentalBypass: func(e *ParentalBypassEvent) {
+				events = append(events, e)
+			},
+		},
+	}
+
+	clientAddr := &net.UDPAddr{IP: net.IP{192, 168, 1, 10}, Port: 12345}
+	newCtx := func(name string) (dctx *dnsContext) {
+		return &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req:  (&dns.Msg{}).SetQuestion(name, dns.TypeA),
+				Addr: clientAddr,
+			},
+			result: &filtering.Result{},
+		}
+	}
+
+	dctx := newCtx("www.example.com.")
+	assert.Equal(t, resultCodeSuccess, s.processParentalBypass(dctx))
+	assert.Nil(t, dctx.proxyCtx.Res)
+
+	dctx = newCtx("0000." + parentalBypassDomain)
+	require.Equal(t, resultCodeFinish, s.processParentalBypass(dctx))
+	require.NotNil(t, dctx.proxyCtx.Res)
+
+	assert.Equal(t, dns.RcodeRefused, dctx.proxyCtx.Res.Rcode)
+
+	dctx = newCtx(pin + "." + parentalBypassDomain)
+	require.Equal(t, resultCodeFinish, s.processParentalBypass(dctx))
+	require.NotNil(t, dctx.proxyCtx.Res)
+
+	assert.Equal(t, dns.RcodeSuccess, dctx.proxyCtx.Res.Rcode)
+	assert.True(t, s.parentalBypass.active(netip.MustParseAddr("192.168.1.10"), "", time.Now()))
+
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "192.168.1.10", events[0].Client)
+	assert.Equal(t, ParentalBypassMethodDNS, events[0].Method)
+	assert.True(t, events[0].Expires.IsZero())
+	assert.False(t, events[1].Expires.IsZero())
+}
@@ -0,0 +1,638 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// QNAME Minimization
+
+const (
+	// maxQNAMEMinQueries is the maximum number of the queries sent to the
+	// authoritative nameservers to resolve a single name, see the
+	// MAX_MINIMISE_COUNT in RFC 9156, section 2.3.
+	maxQNAMEMinQueries = 10
+
+	// maxQNAMEMinCNAMEs is the maximum number of the CNAME targets followed
+	// to resolve a single question.
+	maxQNAMEMinCNAMEs = 8
+
+	// maxQNAMEMinNameservers is the maximum number of the nameservers of a
+	// zone, the addresses of which are used.
+	maxQNAMEMinNameservers = 3
+
+	// maxQNAMEMinZones is the maximum number of the cached zones.
+	maxQNAMEMinZones = 10_000
+
+	// maxQNAMEMinZoneTTL is the maximum time the nameservers of a zone are
+	// cached for.
+	maxQNAMEMinZoneTTL = 1 * time.Hour
+
+	// qnameMinUDPSize is the UDP payload size advertised in the queries to the
+	// authoritative nameservers.
+	qnameMinUDPSize = 1232
+)
+
+// qnameMinZone is a zone along with the addresses of its authoritative
+// nameservers.
+type qnameMinZone struct {
+	// expire is the time until which the zone may be used from the cache.
+	expire time.Time
+
+	// name is the lowercased FQDN of the zone.
+	name string
+
+	// addrs are the addresses of the authoritative nameservers of the zone.
+	addrs []netip.AddrPort
+}
+
+// qnameMinUpstream is an upstream, which doesn't send the full question names
+// to the wrapped upstream.  It only asks the wrapped upstream for the
+// nameservers of the registrable domain of the name and follows the
+// delegations below it by itself, sending each authoritative nameserver only
+// the labels needed to find the next zone cut.  See RFC 9156.
+//
+// The queries to the authoritative nameservers are sent over plain DNS, so the
+// wrapped upstream must be a plain DNS one as well, see [wrapQNAMEMin].  If the
+// resolution fails, the full question is sent to the wrapped upstream.  Since
+// the responses of the authoritative nameservers aren't validated, the
+// requests related to DNSSEC are sent to the wrapped upstream as is.
+type qnameMinUpstream struct {
+	upstream.Upstream
+
+	// mu protects zones.
+	mu *sync.Mutex
+
+	// zones are the cached registrable domains by their names.
+	zones map[string]*qnameMinZone
+
+	// exchangeAuth sends m to the authoritative nameserver at addr.
+	exchangeAuth func(m *dns.Msg, addr netip.AddrPort) (resp *dns.Msg, err error)
+
+	// ipv6Only, if true, makes only the IPv6 addresses of the nameservers
+	// used.
+	ipv6Only bool
+}
+
+// type check
+var _ upstream.Upstream = (*qnameMinUpstream)(nil)
+
+// newQNAMEMinUpstream returns a new upstream, which minimizes the question
+// names sent to u.  timeout is the timeout of a single query to an
+// authoritative nameserver.
+func newQNAMEMinUpstream(
+	u upstream.Upstream,
+	timeout time.Duration,
+	ipv6Only bool,
+) (qu *qnameMinUpstream) {
+	return &qnameMinUpstream{
+		Upstream: u,
+		mu:       &sync.Mutex{},
+		zones:    map[string]*qnameMinZone{},
+		exchangeAuth: func(m *dns.Msg, addr netip.AddrPort) (resp *dns.Msg, err error) {
+			return exchangeAuth(m, addr, timeout)
+		},
+		ipv6Only: ipv6Only,
+	}
+}
+
+// wrapQNAMEMin wraps the general upstreams of conf, so that the question names
+// sent to them are minimized.  The upstreams for the specific domains are left
+// as is, since those are usually the private ones.  It returns an error if any
+// of the general upstreams is an encrypted one, since the minimization would
+// send the names in plain text to the authoritative nameservers instead.
+func wrapQNAMEMin(conf *proxy.UpstreamConfig, timeout time.Duration, ipv6Only bool) (err error) {
+	for _, u := range conf.Upstreams {
+		if !isPlainUpstream(u.Address()) {
+			return fmt.Errorf("qname_minimization requires plain dns upstreams, got %q", u.Address())
+		}
+	}
+
+	for i, u := range conf.Upstreams {
+		conf.Upstreams[i] = newQNAMEMinUpstream(u, timeout, ipv6Only)
+	}
+
+	return nil
+}
+
+// isPlainUpstream returns true if addr is the address of a plain DNS upstream.
+func isPlainUpstream(addr string) (ok bool) {
+	scheme, _, found := strings.Cut(addr, "://")
+
+	return !found || scheme == "udp" || scheme == "tcp"
+}
+
+// exchangeAuth sends m to the authoritative nameserver at addr over UDP and
+// retries over TCP if the response is truncated.
+func exchangeAuth(m *dns.Msg, addr netip.AddrPort, timeout time.Duration) (resp *dns.Msg, err error) {
+	c := &dns.Client{
+		Net:     "udp",
+		Timeout: timeout,
+	}
+
+	resp, _, err = c.Exchange(m, addr.String())
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.Exchange(m, addr.String())
+	}
+
+	return resp, err
+}
+
+// Exchange implements the [upstream.Upstream] interface for *qnameMinUpstream.
+func (u *qnameMinUpstream) Exchange(m *dns.Msg) (resp *dns.Msg, err error) {
+	return u.exchange(m, 0)
+}
+
+// exchange resolves m, which is the cnames-th CNAME target of the original
+// question.
+func (u *qnameMinUpstream) exchange(m *dns.Msg, cnames int) (resp *dns.Msg, err error) {
+	zone, ok := qnameMinZoneName(m)
+	if !ok {
+		return u.Upstream.Exchange(m)
+	}
+
+	resp, err = u.resolve(m, zone, cnames)
+	if err != nil {
+		log.Debug(
+			"dnsforward: qname minimization: resolving %q: %s; sending full name",
+			m.Question[0].Name,
+			err,
+		)
+
+		return u.Upstream.Exchange(m)
+	}
+
+	return resp, nil
+}
+
+// qnameMinZoneName returns the registrable domain of the question name of m,
+// from which the resolution with the minimized names starts.  ok is false if
+// the name can't be minimized, for example if it's a registrable domain
+// itself, or if m requests the DNSSEC data or validation.
+func qnameMinZoneName(m *dns.Msg) (zone string, ok bool) {
+	if len(m.Question) != 1 || m.AuthenticatedData || m.CheckingDisabled {
+		return "", false
+	} else if opt := m.IsEdns0(); opt != nil && opt.Do() {
+		return "", false
+	}
+
+	q := m.Question[0]
+	if q.Qclass != dns.ClassINET || q.Qtype == dns.TypeDS {
+		// The DS records are served by the parent zone, so don't try to find
+		// the zone cut.
+		return "", false
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	zone, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil || zone == host {
+		return "", false
+	}
+
+	return dns.Fqdn(zone), true
+}
+
+// resolve resolves req starting with the nameservers of zone.  cnames is the
+// number of the CNAME targets already followed.
+func (u *qnameMinUpstream) resolve(req *dns.Msg, zoneName string, cnames int) (resp *dns.Msg, err error) {
+	zone, err := u.zone(zoneName)
+	if err != nil {
+		return nil, fmt.Errorf("getting nameservers of %q: %w", zoneName, err)
+	}
+
+	name := strings.ToLower(req.Question[0].Name)
+	labelsNum := dns.CountLabel(name)
+	known := dns.CountLabel(zone.name)
+
+	for queries := 0; queries < maxQNAMEMinQueries; queries++ {
+		// Send the full question once the name is one label away from the
+		// zone or the queries are about to run out.
+		if known+1 >= labelsNum || queries == maxQNAMEMinQueries-1 {
+			full := req.Copy()
+			full.Id = dns.Id()
+			full.RecursionDesired = false
+
+			resp, err = u.exchangeZone(zone, full)
+			if err != nil {
+				return nil, err
+			}
+
+			var cut *qnameMinZone
+			cut, err = u.referral(resp, zone, name)
+			if err != nil {
+				return nil, err
+			} else if cut == nil {
+				return u.finish(req, resp, zone.name, cnames), nil
+			}
+
+			zone, known = cut, dns.CountLabel(cut.name)
+
+			continue
+		}
+
+		known++
+		child := lastLabels(name, known)
+
+		// Use the A type for the minimized queries, since some nameservers
+		// respond to the NS queries incorrectly, see RFC 9156, section 2.1.
+		minReq := (&dns.Msg{}).SetQuestion(child, dns.TypeA)
+		minReq.RecursionDesired = false
+		minReq.SetEdns0(qnameMinUDPSize, false)
+
+		resp, err = u.exchangeZone(zone, minReq)
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+			var cut *qnameMinZone
+			cut, err = u.referral(resp, zone, child)
+			if err != nil {
+				return nil, err
+			} else if cut != nil {
+				zone, known = cut, dns.CountLabel(cut.name)
+			}
+		case dns.RcodeNameError:
+			// Some nameservers respond with NXDOMAIN to the empty
+			// non-terminals, so ask them the full question instead of
+			// relying on RFC 8020.
+			known = labelsNum - 1
+		default:
+			return nil, fmt.Errorf("minimized query for %q: rcode %s", child, dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	return nil, fmt.Errorf("no answer after %d queries", maxQNAMEMinQueries)
+}
+
+// lastLabels returns the last n labels of the FQDN name.
+func lastLabels(name string, n int) (sub string) {
+	idx := dns.Split(name)
+
+	return name[idx[len(idx)-n]:]
+}
+
+// exchangeZone sends m to the nameservers of zone one by one until one of them
+// responds.
+func (u *qnameMinUpstream) exchangeZone(zone *qnameMinZone, m *dns.Msg) (resp *dns.Msg, err error) {
+	q := m.Question[0]
+	for _, addr := range zone.addrs {
+		resp, err = u.exchangeAuth(m, addr)
+		if err != nil {
+			log.Debug("dnsforward: qname minimization: nameserver %s: %s", addr, err)
+
+			continue
+		}
+
+		if len(resp.Question) != 1 ||
+			!strings.EqualFold(resp.Question[0].Name, q.Name) ||
+			resp.Question[0].Qtype != q.Qtype {
+			err = fmt.Errorf("nameserver %s: question mismatch", addr)
+
+			continue
+		}
+
+		return resp, nil
+	}
+
+	if err == nil {
+		err = errors.Error("no nameservers")
+	}
+
+	return nil, fmt.Errorf("zone %q: %w", zone.name, err)
+}
+
+// referral returns the child zone, to which the response resp from the
+// nameservers of zone for name refers.  cut is nil if resp isn't a referral.
+// err is not nil if resp refers to a zone outside of zone.
+func (u *qnameMinUpstream) referral(
+	resp *dns.Msg,
+	zone *qnameMinZone,
+	name string,
+) (cut *qnameMinZone, err error) {
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 || resp.Authoritative {
+		return nil, nil
+	}
+
+	var cutName string
+	var nsNames []string
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(ns.Hdr.Name)
+		if owner == zone.name ||
+			!dns.IsSubDomain(zone.name, owner) ||
+			!dns.IsSubDomain(owner, name) ||
+			(cutName != "" && owner != cutName) {
+			return nil, fmt.Errorf("zone %q: bad referral to %q", zone.name, owner)
+		}
+
+		cutName = owner
+		nsNames = append(nsNames, strings.ToLower(ns.Ns))
+	}
+
+	if cutName == "" {
+		return nil, nil
+	}
+
+	// Only trust the glue for the nameservers within the zone, which the
+	// nameservers of that zone are authoritative for.
+	glue := u.glue(resp.Extra, func(host string) (ok bool) {
+		return dns.IsSubDomain(zone.name, host)
+	})
+
+	addrs := u.nsAddrs(nsNames, glue)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("zone %q: no nameserver addresses", cutName)
+	}
+
+	return &qnameMinZone{
+		name:  cutName,
+		addrs: addrs,
+	}, nil
+}
+
+// zone returns the nameservers of the registrable domain name from the cache
+// or looks them up using the wrapped upstream.
+func (u *qnameMinUpstream) zone(name string) (z *qnameMinZone, err error) {
+	now := time.Now()
+
+	u.mu.Lock()
+	z = u.zones[name]
+	u.mu.Unlock()
+
+	if z != nil && now.Before(z.expire) {
+		return z, nil
+	}
+
+	z, err = u.lookupZone(name, now)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.zones) >= maxQNAMEMinZones {
+		for k, cached := range u.zones {
+			if !now.Before(cached.expire) {
+				delete(u.zones, k)
+			}
+		}
+
+		if len(u.zones) >= maxQNAMEMinZones {
+			return z, nil
+		}
+	}
+
+	u.zones[name] = z
+
+	return z, nil
+}
+
+// lookupZone asks the wrapped upstream for the nameservers of the zone name and
+// their addresses.
+func (u *qnameMinUpstream) lookupZone(name string, now time.Time) (z *qnameMinZone, err error) {
+	resp, err := u.Upstream.Exchange((&dns.Msg{}).SetQuestion(name, dns.TypeNS))
+	if err != nil {
+		return nil, err
+	} else if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	ttl := maxQNAMEMinZoneTTL
+	var nsNames []string
+	for _, rr := range resp.Answer {
+		ns, ok := rr.(*dns.NS)
+		if !ok || !strings.EqualFold(ns.Hdr.Name, name) {
+			continue
+		}
+
+		nsNames = append(nsNames, strings.ToLower(ns.Ns))
+		if nsTTL := time.Duration(ns.Hdr.Ttl) * time.Second; nsTTL < ttl {
+			ttl = nsTTL
+		}
+	}
+
+	if len(nsNames) == 0 {
+		return nil, errors.Error("no nameservers")
+	}
+
+	// The upstream is trusted, so use any addresses it has sent.
+	glue := u.glue(resp.Extra, func(_ string) (ok bool) { return true })
+
+	addrs := u.nsAddrs(nsNames, glue)
+	if len(addrs) == 0 {
+		return nil, errors.Error("no nameserver addresses")
+	}
+
+	return &qnameMinZone{
+		expire: now.Add(ttl),
+		name:   name,
+		addrs:  addrs,
+	}, nil
+}
+
+// glue returns the addresses from the address records within extra by their
+// lowercased owners, for which trusted returns true.
+func (u *qnameMinUpstream) glue(
+	extra []dns.RR,
+	trusted func(host string) (ok bool),
+) (glue map[string][]netip.Addr) {
+	glue = map[string][]netip.Addr{}
+	for _, rr := range extra {
+		host := strings.ToLower(rr.Header().Name)
+		if ip := u.rrIP(rr); ip != nil && trusted(host) {
+			if addr, ok := netip.AddrFromSlice(ip); ok {
+				glue[host] = append(glue[host], addr.Unmap())
+			}
+		}
+	}
+
+	return glue
+}
+
+// rrIP returns the IP address of rr, if it's an address record of the family
+// used by u.
+func (u *qnameMinUpstream) rrIP(rr dns.RR) (ip net.IP) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		if !u.ipv6Only {
+			return rr.A
+		}
+	case *dns.AAAA:
+		return rr.AAAA
+	}
+
+	return nil
+}
+
+// nsAddrs returns the addresses of the nameservers with nsNames.  The ones
+// missing in glue are resolved using the wrapped upstream.  The IPv4 addresses
+// go first.
+func (u *qnameMinUpstream) nsAddrs(nsNames []string, glue map[string][]netip.Addr) (addrs []netip.AddrPort) {
+	var ipv4, ipv6 []netip.AddrPort
+	for i, ns := range nsNames {
+		if i == maxQNAMEMinNameservers {
+			break
+		}
+
+		ips, ok := glue[ns]
+		if !ok {
+			ips = u.lookupAddrs(ns)
+		}
+
+		for _, ip := range ips {
+			addr := netip.AddrPortFrom(ip, 53)
+			if ip.Is4() {
+				ipv4 = append(ipv4, addr)
+			} else {
+				ipv6 = append(ipv6, addr)
+			}
+		}
+	}
+
+	return append(ipv4, ipv6...)
+}
+
+// lookupAddrs resolves the addresses of host using the wrapped upstream.
+func (u *qnameMinUpstream) lookupAddrs(host string) (ips []netip.Addr) {
+	qt := dns.TypeA
+	if u.ipv6Only {
+		qt = dns.TypeAAAA
+	}
+
+	resp, err := u.Upstream.Exchange((&dns.Msg{}).SetQuestion(host, qt))
+	if err != nil {
+		log.Debug("dnsforward: qname minimization: resolving nameserver %q: %s", host, err)
+
+		return nil
+	}
+
+	for _, rr := range resp.Answer {
+		if ip := u.rrIP(rr); ip != nil {
+			if addr, ok := netip.AddrFromSlice(ip); ok {
+				ips = append(ips, addr.Unmap())
+			}
+		}
+	}
+
+	return ips
+}
+
+// finish turns resp from the authoritative nameserver of zone into the
+// response to req, following the CNAME target, if any.  The records outside of
+// zone are removed, since the nameserver isn't authoritative for them.  cnames
+// is the number of the CNAME targets already followed.
+func (u *qnameMinUpstream) finish(req, resp *dns.Msg, zone string, cnames int) (res *dns.Msg) {
+	resp.Id = req.Id
+	resp.Question = []dns.Question{req.Question[0]}
+	resp.RecursionDesired = req.RecursionDesired
+	resp.RecursionAvailable = true
+	resp.Authoritative = false
+	resp.AuthenticatedData = false
+
+	resp.Answer = inBailiwick(resp.Answer, zone)
+	resp.Ns = inBailiwick(resp.Ns, zone)
+
+	// The additional records aren't needed by the clients, and the glue
+	// records may point anywhere.
+	resp.Extra = nil
+
+	q := req.Question[0]
+	if resp.Rcode != dns.RcodeSuccess || q.Qtype == dns.TypeCNAME || cnames >= maxQNAMEMinCNAMEs {
+		return resp
+	}
+
+	target := cnameTarget(resp.Answer, q)
+	if target == "" {
+		return resp
+	}
+
+	creq := req.Copy()
+	creq.Question[0].Name = target
+
+	cresp, err := u.exchange(creq, cnames+1)
+	if err != nil {
+		log.Debug("dnsforward: qname minimization: resolving cname target %q: %s", target, err)
+
+		return resp
+	}
+
+	resp.Rcode = cresp.Rcode
+	resp.Answer = append(resp.Answer, cresp.Answer...)
+	if len(cresp.Answer) == 0 {
+		resp.Ns = cresp.Ns
+	}
+
+	return resp
+}
+
+// inBailiwick returns the records from rrs with the owners within zone.  rrs is
+// filtered in place.
+func inBailiwick(rrs []dns.RR, zone string) (filtered []dns.RR) {
+	filtered = rrs[:0]
+	for _, rr := range rrs {
+		if dns.IsSubDomain(zone, strings.ToLower(rr.Header().Name)) {
+			filtered = append(filtered, rr)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	return filtered
+}
+
+// cnameTarget returns the last target of the CNAME chain for q within answer,
+// if there are no records of the type of q for it.  target is empty if the
+// chain loops.
+func cnameTarget(answer []dns.RR, q dns.Question) (target string) {
+	name := q.Name
+	for i := 0; i < len(answer); i++ {
+		next := ""
+		for _, rr := range answer {
+			hdr := rr.Header()
+			if !strings.EqualFold(hdr.Name, name) {
+				continue
+			}
+
+			if hdr.Rrtype == q.Qtype {
+				return ""
+			} else if cname, ok := rr.(*dns.CNAME); ok {
+				next = cname.Target
+			}
+		}
+
+		if next == "" {
+			break
+		} else if strings.EqualFold(next, q.Name) {
+			return ""
+		}
+
+		name = next
+	}
+
+	if strings.EqualFold(name, q.Name) {
+		return ""
+	}
+
+	return name
+}
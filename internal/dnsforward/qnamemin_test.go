@@ -0,0 +1,342 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newQNAMEMinTestRR returns a new resource record from its presentation format
+// s.
+func newQNAMEMinTestRR(t *testing.T, s string) (rr dns.RR) {
+	t.Helper()
+
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+
+	return rr
+}
+
+func TestQNAMEMinUpstream(t *testing.T) {
+	rr := func(s string) (rr dns.RR) { return newQNAMEMinTestRR(t, s) }
+
+	soa := rr("example.com. 60 IN SOA ns1.example.com. admin.example.com. 1 60 60 60 60")
+
+	// upsQuestions are the questions the upstream has been asked.
+	var upsQuestions []string
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		q := req.Question[0]
+		upsQuestions = append(upsQuestions, q.Name+" "+dns.Type(q.Qtype).String())
+
+		resp = (&dns.Msg{}).SetReply(req)
+		resp.RecursionAvailable = true
+		switch {
+		case q.Name == "example.com." && q.Qtype == dns.TypeNS:
+			resp.Answer = []dns.RR{rr("example.com. 60 IN NS ns1.example.com.")}
+		case q.Name == "ns1.example.com.":
+			resp.Answer = []dns.RR{rr("ns1.example.com. 60 IN A 192.0.2.1")}
+		default:
+			resp.Answer = []dns.RR{rr(q.Name + " 60 IN A 192.0.2.255")}
+		}
+
+		return resp, nil
+	})
+
+	zoneAddr := netip.MustParseAddrPort("192.0.2.1:53")
+	subAddr := netip.MustParseAddrPort("192.0.2.2:53")
+
+	// authQuestions are the questions the authoritative nameservers have been
+	// asked.
+	var authQuestions []string
+	exchangeAuth := func(req *dns.Msg, addr netip.AddrPort) (resp *dns.Msg, err error) {
+		q := req.Question[0]
+		authQuestions = append(authQuestions, q.Name)
+
+		require.False(t, req.RecursionDesired)
+
+		resp = (&dns.Msg{}).SetReply(req)
+		resp.Authoritative = true
+		switch addr {
+		case zoneAddr:
+			switch q.Name {
+			case "b.example.com.", "alias.example.com.", "target.example.com.", "a.b.example.com.":
+				resp.Answer = map[string][]dns.RR{
+					"a.b.example.com.": {
+						rr("a.b.example.com. 60 IN A 192.0.2.10"),
+						// Out of bailiwick.
+						rr("a.b.example.net. 60 IN A 192.0.2.66"),
+					},
+					"alias.example.com.":  {rr("alias.example.com. 60 IN CNAME target.example.com.")},
+					"target.example.com.": {rr("target.example.com. 60 IN A 192.0.2.11")},
+				}[q.Name]
+				if len(resp.Answer) == 0 {
+					resp.Ns = []dns.RR{soa}
+				}
+
+				resp.Extra = []dns.RR{rr("ns.example.net. 60 IN A 192.0.2.67")}
+			case "sub.example.com.":
+				resp.Authoritative = false
+				resp.Ns = []dns.RR{rr("sub.example.com. 60 IN NS ns.sub.example.com.")}
+				resp.Extra = []dns.RR{rr("ns.sub.example.com. 60 IN A 192.0.2.2")}
+			case "evil.example.com.":
+				resp.Authoritative = false
+				resp.Ns = []dns.RR{rr("example.net. 60 IN NS ns.example.net.")}
+			case "nx.example.com.", "x.nx.example.com.":
+				resp.Rcode = dns.RcodeNameError
+				resp.Ns = []dns.RR{soa}
+			default:
+				return nil, errors.Error("test error")
+			}
+		case subAddr:
+			resp.Answer = []dns.RR{rr(q.Name + " 60 IN A 192.0.2.20")}
+		default:
+			t.Fatalf("unexpected nameserver %s", addr)
+		}
+
+		return resp, nil
+	}
+
+	u := newQNAMEMinUpstream(ups, time.Second, false)
+	u.exchangeAuth = exchangeAuth
+
+	testCases := []struct {
+		name         string
+		host         string
+		wantAnswer   []string
+		wantAuth     []string
+		wantUpstream []string
+		wantRcode    int
+		do           bool
+	}{{
+		name:         "not_minimized",
+		host:         "example.com.",
+		wantAnswer:   []string{"example.com.\t60\tIN\tA\t192.0.2.255"},
+		wantAuth:     nil,
+		wantUpstream: []string{"example.com. A"},
+		wantRcode:    dns.RcodeSuccess,
+	}, {
+		name:       "empty_non_terminal",
+		host:       "a.b.example.com.",
+		wantAnswer: []string{"a.b.example.com.\t60\tIN\tA\t192.0.2.10"},
+		wantAuth:   []string{"b.example.com.", "a.b.example.com."},
+		wantUpstream: []string{
+			"example.com. NS",
+			"ns1.example.com. A",
+		},
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:         "referral",
+		host:         "host.sub.example.com.",
+		wantAnswer:   []string{"host.sub.example.com.\t60\tIN\tA\t192.0.2.20"},
+		wantAuth:     []string{"sub.example.com.", "host.sub.example.com."},
+		wantUpstream: nil,
+		wantRcode:    dns.RcodeSuccess,
+	}, {
+		name:         "nxdomain",
+		host:         "x.nx.example.com.",
+		wantAnswer:   nil,
+		wantAuth:     []string{"nx.example.com.", "x.nx.example.com."},
+		wantUpstream: nil,
+		wantRcode:    dns.RcodeNameError,
+	}, {
+		name: "cname",
+		host: "alias.example.com.",
+		wantAnswer: []string{
+			"alias.example.com.\t60\tIN\tCNAME\ttarget.example.com.",
+			"target.example.com.\t60\tIN\tA\t192.0.2.11",
+		},
+		wantAuth:     []string{"alias.example.com.", "target.example.com."},
+		wantUpstream: nil,
+		wantRcode:    dns.RcodeSuccess,
+	}, {
+		name:         "fallback",
+		host:         "x.broken.example.com.",
+		wantAnswer:   []string{"x.broken.example.com.\t60\tIN\tA\t192.0.2.255"},
+		wantAuth:     []string{"broken.example.com."},
+		wantUpstream: []string{"x.broken.example.com. A"},
+		wantRcode:    dns.RcodeSuccess,
+	}, {
+		name:         "bad_referral",
+		host:         "x.evil.example.com.",
+		wantAnswer:   []string{"x.evil.example.com.\t60\tIN\tA\t192.0.2.255"},
+		wantAuth:     []string{"evil.example.com."},
+		wantUpstream: []string{"x.evil.example.com. A"},
+		wantRcode:    dns.RcodeSuccess,
+	}, {
+		name:         "dnssec",
+		host:         "a.b.example.com.",
+		wantAnswer:   []string{"a.b.example.com.\t60\tIN\tA\t192.0.2.255"},
+		wantAuth:     nil,
+		wantUpstream: []string{"a.b.example.com. A"},
+		wantRcode:    dns.RcodeSuccess,
+		do:           true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upsQuestions, authQuestions = nil, nil
+
+			req := (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA)
+			if tc.do {
+				req.SetEdns0(qnameMinUDPSize, true)
+			}
+
+			resp, err := u.Exchange(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, req.Id, resp.Id)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			assert.True(t, resp.RecursionAvailable)
+			assert.False(t, resp.Authoritative)
+
+			var ans []string
+			for _, a := range resp.Answer {
+				ans = append(ans, a.String())
+			}
+
+			assert.Equal(t, tc.wantAnswer, ans)
+			if !tc.do {
+				assert.Empty(t, resp.Extra)
+			}
+
+			assert.Equal(t, tc.wantAuth, authQuestions)
+			assert.Equal(t, tc.wantUpstream, upsQuestions)
+		})
+	}
+}
+
+func TestWrapQNAMEMin(t *testing.T) {
+	newConf := func(addrs ...string) (conf *proxy.UpstreamConfig) {
+		conf = &proxy.UpstreamConfig{}
+		for _, addr := range addrs {
+			u := aghtest.NewUpstreamMock(nil)
+			u.OnAddress = func() (a string) { return addr }
+			conf.Upstreams = append(conf.Upstreams, u)
+		}
+
+		return conf
+	}
+
+	testCases := []struct {
+		conf       *proxy.UpstreamConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       newConf("192.0.2.1:53", "tcp://192.0.2.2:53"),
+		name:       "plain",
+		wantErrMsg: "",
+	}, {
+		conf: newConf("192.0.2.1:53", "https://dns.example/dns-query"),
+		name: "encrypted",
+		wantErrMsg: `qname_minimization requires plain dns upstreams, ` +
+			`got "https://dns.example/dns-query"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := wrapQNAMEMin(tc.conf, time.Second, false)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if err != nil {
+				return
+			}
+
+			for _, u := range tc.conf.Upstreams {
+				assert.IsType(t, (*qnameMinUpstream)(nil), u)
+			}
+		})
+	}
+}
+
+func TestQNAMEMinZoneName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		host     string
+		wantZone string
+		qtype    uint16
+		wantOK   bool
+	}{{
+		name:     "subdomain",
+		host:     "a.b.example.com.",
+		wantZone: "example.com.",
+		qtype:    dns.TypeA,
+		wantOK:   true,
+	}, {
+		name:     "registrable",
+		host:     "example.com.",
+		wantZone: "",
+		qtype:    dns.TypeA,
+		wantOK:   false,
+	}, {
+		name:     "public_suffix",
+		host:     "host.example.co.uk.",
+		wantZone: "example.co.uk.",
+		qtype:    dns.TypeAAAA,
+		wantOK:   true,
+	}, {
+		name:     "ds",
+		host:     "a.example.com.",
+		wantZone: "",
+		qtype:    dns.TypeDS,
+		wantOK:   false,
+	}, {
+		name:     "mixed_case",
+		host:     "A.Example.COM.",
+		wantZone: "example.com.",
+		qtype:    dns.TypeA,
+		wantOK:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zone, ok := qnameMinZoneName((&dns.Msg{}).SetQuestion(tc.host, tc.qtype))
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantZone, zone)
+		})
+	}
+}
+
+func TestCNAMETarget(t *testing.T) {
+	rr := func(s string) (rr dns.RR) { return newQNAMEMinTestRR(t, s) }
+
+	q := dns.Question{
+		Name:   "a.example.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+
+	testCases := []struct {
+		name   string
+		want   string
+		answer []dns.RR
+	}{{
+		name:   "empty",
+		want:   "",
+		answer: nil,
+	}, {
+		name:   "resolved",
+		want:   "",
+		answer: []dns.RR{rr("a.example. 60 IN CNAME b.example."), rr("b.example. 60 IN A 192.0.2.1")},
+	}, {
+		name:   "chain",
+		want:   "c.example.",
+		answer: []dns.RR{rr("a.example. 60 IN CNAME b.example."), rr("b.example. 60 IN CNAME c.example.")},
+	}, {
+		name:   "loop",
+		want:   "",
+		answer: []dns.RR{rr("a.example. 60 IN CNAME b.example."), rr("b.example. 60 IN CNAME a.example.")},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, cnameTarget(tc.answer, q))
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Quarantine
+
+// quarantineEntry is a single quarantined client.
+type quarantineEntry struct {
+	// Expires is the time when the quarantine ends.
+	Expires time.Time `json:"expires"`
+
+	// IP is the address all the queries of the client are resolved to.
+	IP netip.Addr `json:"ip"`
+
+	// Client is the IP address or the ClientID of the quarantined client.
+	Client string `json:"client"`
+}
+
+// quarantine is the set of the quarantined clients.  All the DNS queries of
+// such a client are resolved to a single IP address, for example the address of
+// a notice page, until the quarantine expires.  The zero value is ready to use.
+// A quarantine is safe for concurrent use.
+type quarantine struct {
+	// mu protects entries.
+	mu sync.Mutex
+
+	// entries are the quarantined clients by their IP addresses and
+	// ClientIDs.
+	entries map[string]*quarantineEntry
+}
+
+// add quarantines the client until the expiration time.  It replaces the
+// previous entry for the client, if any.
+func (q *quarantine) add(e *quarantineEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.entries == nil {
+		q.entries = map[string]*quarantineEntry{}
+	}
+
+	q.entries[e.Client] = e
+}
+
+// remove ends the quarantine of client.  ok is false if client wasn't
+// quarantined.
+func (q *quarantine) remove(client string) (ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok = q.entries[client]
+	delete(q.entries, client)
+
+	return ok
+}
+
+// find returns the IP address the queries of the client with ip and clientID
+// should be resolved to at now.  ok is false if the client isn't quarantined.
+// The expired entries are removed.
+func (q *quarantine) find(ip netip.Addr, clientID string, now time.Time) (qip netip.Addr, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return netip.Addr{}, false
+	}
+
+	var ipKey string
+	if ip.IsValid() {
+		ipKey = ip.String()
+	}
+
+	for _, key := range [...]string{clientID, ipKey} {
+		if key == "" {
+			continue
+		}
+
+		e, has := q.entries[key]
+		if !has {
+			continue
+		} else if !now.Before(e.Expires) {
+			log.Debug("dnsforward: quarantine of %q expired", key)
+			delete(q.entries, key)
+
+			continue
+		}
+
+		return e.IP, true
+	}
+
+	return netip.Addr{}, false
+}
+
+// list returns the quarantined clients at now sorted by the client.  The
+// expired entries are removed.
+func (q *quarantine) list(now time.Time) (entries []*quarantineEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	maps.DeleteFunc(q.entries, func(_ string, e *quarantineEntry) (del bool) {
+		return !now.Before(e.Expires)
+	})
+
+	entries = make([]*quarantineEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		ec := *e
+		entries = append(entries, &ec)
+	}
+
+	slices.SortFunc(entries, func(a, b *quarantineEntry) (sortsBefore bool) {
+		return a.Client < b.Client
+	})
+
+	return entries
+}
+
+// processQuarantine responds to the queries of the quarantined clients with the
+// quarantine IP address.  It replaces any response set by the previous
+// handlers.
+func (s *Server) processQuarantine(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	ip := netutil.NetAddrToAddrPort(pctx.Addr).Addr().Unmap()
+	qip, ok := s.quarantine.find(ip, dctx.clientID, time.Now())
+	if !ok {
+		return resultCodeSuccess
+	}
+
+	log.Debug("dnsforward: client %s (id %q) is quarantined", ip, dctx.clientID)
+
+	pctx.Res = s.genQuarantineResponse(pctx.Req, qip)
+
+	return resultCodeSuccess
+}
+
+// genQuarantineResponse returns a response with qip for A and AAAA requests of
+// the same address family as qip and an empty response otherwise.
+func (s *Server) genQuarantineResponse(req *dns.Msg, qip netip.Addr) (resp *dns.Msg) {
+	resp = s.makeResponse(req)
+	switch qt := req.Question[0].Qtype; {
+	case qt == dns.TypeA && qip.Is4():
+		resp.Answer = []dns.RR{s.genAnswerA(req, qip.AsSlice())}
+	case qt == dns.TypeAAAA && qip.Is6():
+		resp.Answer = []dns.RR{s.genAnswerAAAA(req, qip.AsSlice())}
+	default:
+		// Go on and return an empty response.
+	}
+
+	return resp
+}
+
+// quarantineListJSON is the response to the GET /control/quarantine/list HTTP
+// API.
+type quarantineListJSON struct {
+	Clients []*quarantineEntry `json:"clients"`
+}
+
+// handleQuarantineList is the handler for the GET /control/quarantine/list
+// HTTP API.
+func (s *Server) handleQuarantineList(w http.ResponseWriter, r *http.Request) {
+	_ = aghhttp.WriteJSONResponse(w, r, &quarantineListJSON{
+		Clients: s.quarantine.list(time.Now()),
+	})
+}
+
+// quarantineAddJSON is the request to the POST /control/quarantine/add HTTP
+// API.
+type quarantineAddJSON struct {
+	// IP is the address to resolve the queries to.  If not set,
+	// [FilteringConfig.QuarantineIP] is used.
+	IP netip.Addr `json:"ip"`
+
+	// Client is the IP address or the ClientID of the client.
+	Client string `json:"client"`
+
+	// Duration is the duration of the quarantine.
+	Duration timeutil.Duration `json:"duration"`
+}
+
+// handleQuarantineAdd is the handler for the POST /control/quarantine/add HTTP
+// API.
+func (s *Server) handleQuarantineAdd(w http.ResponseWriter, r *http.Request) {
+	req := &quarantineAddJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	client, err := normalizeQuarantineClient(req.Client)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client: %s", err)
+
+		return
+	}
+
+	if req.Duration.Duration <= 0 {
+		aghhttp.Error(r, w, http.StatusBadRequest, "duration: must be positive, got %s", req.Duration)
+
+		return
+	}
+
+	qip := req.IP
+	if qip == (netip.Addr{}) {
+		s.serverLock.RLock()
+		qip = s.conf.QuarantineIP
+		s.serverLock.RUnlock()
+
+		if qip == (netip.Addr{}) {
+			aghhttp.Error(r, w, http.StatusBadRequest, "ip: no ip and no default quarantine ip")
+
+			return
+		}
+	}
+
+	e := &quarantineEntry{
+		Expires: time.Now().Add(req.Duration.Duration),
+		IP:      qip.Unmap(),
+		Client:  client,
+	}
+	s.quarantine.add(e)
+
+	log.Info("dnsforward: quarantined client %q until %s", client, e.Expires)
+}
+
+// quarantineRemoveJSON is the request to the POST /control/quarantine/remove
+// HTTP API.
+type quarantineRemoveJSON struct {
+	Client string `json:"client"`
+}
+
+// handleQuarantineRemove is the handler for the POST
+// /control/quarantine/remove HTTP API.
+func (s *Server) handleQuarantineRemove(w http.ResponseWriter, r *http.Request) {
+	req := &quarantineRemoveJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	client, err := normalizeQuarantineClient(req.Client)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client: %s", err)
+
+		return
+	}
+
+	if !s.quarantine.remove(client) {
+		aghhttp.Error(r, w, http.StatusNotFound, "client %q is not quarantined", client)
+
+		return
+	}
+
+	log.Info("dnsforward: removed client %q from quarantine", client)
+}
+
+// normalizeQuarantineClient validates client, which must be an IP address or a
+// ClientID, and returns its canonical form.
+func normalizeQuarantineClient(client string) (norm string, err error) {
+	if ip, perr := netip.ParseAddr(client); perr == nil {
+		return ip.Unmap().String(), nil
+	}
+
+	err = ValidateClientID(client)
+	if err != nil {
+		return "", fmt.Errorf("bad ip or clientid %q", client)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,245 @@
+package dnsforward
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	now := time.Now()
+	noticeIP := netip.MustParseAddr("192.168.1.1")
+	clientIP := netip.MustParseAddr("192.168.1.10")
+
+	q := &quarantine{}
+	q.add(&quarantineEntry{
+		Expires: now.Add(time.Hour),
+		IP:      noticeIP,
+		Client:  clientIP.String(),
+	})
+	q.add(&quarantineEntry{
+		Expires: now.Add(time.Minute),
+		IP:      noticeIP,
+		Client:  "laptop",
+	})
+
+	testCases := []struct {
+		now      time.Time
+		ip       netip.Addr
+		name     string
+		clientID string
+		wantOK   bool
+	}{{
+		now:      now,
+		ip:       clientIP,
+		name:     "ip",
+		clientID: "",
+		wantOK:   true,
+	}, {
+		now:      now,
+		ip:       netip.MustParseAddr("192.168.1.11"),
+		name:     "clientid",
+		clientID: "laptop",
+		wantOK:   true,
+	}, {
+		now:      now,
+		ip:       netip.Addr{},
+		name:     "no_ip",
+		clientID: "phone",
+		wantOK:   false,
+	}, {
+		now:      now.Add(2 * time.Minute),
+		ip:       netip.Addr{},
+		name:     "expired",
+		clientID: "laptop",
+		wantOK:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			qip, ok := q.find(tc.ip, tc.clientID, tc.now)
+			require.Equal(t, tc.wantOK, ok)
+
+			if tc.wantOK {
+				assert.Equal(t, noticeIP, qip)
+			}
+		})
+	}
+
+	// The expired entry must be removed by now.
+	entries := q.list(now)
+	require.Len(t, entries, 1)
+
+	assert.Equal(t, clientIP.String(), entries[0].Client)
+
+	assert.True(t, q.remove(clientIP.String()))
+	assert.False(t, q.remove(clientIP.String()))
+	assert.Empty(t, q.list(now))
+}
+
+func TestServer_processQuarantine(t *testing.T) {
+	const host = "example.org."
+
+	noticeIP := netip.MustParseAddr("192.168.1.1")
+	clientIP := netip.MustParseAddr("192.168.1.10")
+
+	s := &Server{
+		conf: ServerConfig{
+			FilteringConfig: FilteringConfig{
+				BlockedResponseTTL: 10,
+			},
+		},
+	}
+	s.quarantine.add(&quarantineEntry{
+		Expires: time.Now().Add(time.Hour),
+		IP:      noticeIP,
+		Client:  clientIP.String(),
+	})
+
+	testCases := []struct {
+		name      string
+		clientIP  netip.Addr
+		qtype     uint16
+		wantRes   bool
+		wantAnsIP net.IP
+	}{{
+		name:      "a",
+		clientIP:  clientIP,
+		qtype:     dns.TypeA,
+		wantRes:   true,
+		wantAnsIP: noticeIP.AsSlice(),
+	}, {
+		name:      "aaaa",
+		clientIP:  clientIP,
+		qtype:     dns.TypeAAAA,
+		wantRes:   true,
+		wantAnsIP: nil,
+	}, {
+		name:      "mapped_client",
+		clientIP:  netip.AddrFrom16(clientIP.As16()),
+		qtype:     dns.TypeA,
+		wantRes:   true,
+		wantAnsIP: noticeIP.AsSlice(),
+	}, {
+		name:      "not_quarantined",
+		clientIP:  netip.MustParseAddr("192.168.1.11"),
+		qtype:     dns.TypeA,
+		wantRes:   false,
+		wantAnsIP: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  (&dns.Msg{}).SetQuestion(host, tc.qtype),
+					Addr: net.UDPAddrFromAddrPort(netip.AddrPortFrom(tc.clientIP, 53)),
+				},
+				result: &filtering.Result{},
+			}
+
+			rc := s.processQuarantine(dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			res := dctx.proxyCtx.Res
+			if !tc.wantRes {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+
+			if tc.wantAnsIP == nil {
+				assert.Empty(t, res.Answer)
+
+				return
+			}
+
+			require.Len(t, res.Answer, 1)
+
+			a, ok := res.Answer[0].(*dns.A)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.wantAnsIP, a.A)
+		})
+	}
+}
+
+func TestServer_handleQuarantineAdd(t *testing.T) {
+	defaultIP := netip.MustParseAddr("192.168.1.1")
+
+	testCases := []struct {
+		name     string
+		req      string
+		wantIP   netip.Addr
+		wantCode int
+	}{{
+		name:     "default_ip",
+		req:      `{"client":"192.168.1.10","duration":"1h"}`,
+		wantIP:   defaultIP,
+		wantCode: http.StatusOK,
+	}, {
+		name:     "custom_ip",
+		req:      `{"client":"laptop","ip":"10.0.0.1","duration":"30m"}`,
+		wantIP:   netip.MustParseAddr("10.0.0.1"),
+		wantCode: http.StatusOK,
+	}, {
+		name:     "bad_client",
+		req:      `{"client":"!!!","duration":"1h"}`,
+		wantIP:   netip.Addr{},
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "bad_duration",
+		req:      `{"client":"laptop","duration":"0s"}`,
+		wantIP:   netip.Addr{},
+		wantCode: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				conf: ServerConfig{
+					FilteringConfig: FilteringConfig{
+						QuarantineIP: defaultIP,
+					},
+				},
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/control/quarantine/add", bytes.NewBufferString(tc.req))
+			w := httptest.NewRecorder()
+
+			s.handleQuarantineAdd(w, r)
+			require.Equal(t, tc.wantCode, w.Code)
+
+			lw := httptest.NewRecorder()
+			s.handleQuarantineList(lw, httptest.NewRequest(http.MethodGet, "/control/quarantine/list", nil))
+			require.Equal(t, http.StatusOK, lw.Code)
+
+			resp := &quarantineListJSON{}
+			err := json.NewDecoder(lw.Body).Decode(resp)
+			require.NoError(t, err)
+
+			if tc.wantCode != http.StatusOK {
+				assert.Empty(t, resp.Clients)
+
+				return
+			}
+
+			require.Len(t, resp.Clients, 1)
+
+			assert.Equal(t, tc.wantIP, resp.Clients[0].IP)
+		})
+	}
+}
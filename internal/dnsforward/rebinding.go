@@ -0,0 +1,108 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// DNS Rebinding Protection
+
+// validateRebindingAllowedDomains returns an error if any of domains isn't a
+// valid domain name.
+func validateRebindingAllowedDomains(domains []string) (err error) {
+	for i, d := range domains {
+		err = netutil.ValidateDomainName(strings.TrimSuffix(d, "."))
+		if err != nil {
+			return fmt.Errorf("rebinding_allowed_domains: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// isRebindingAllowed returns true if host is allowed to resolve to the
+// addresses from the locally-served networks.  Those are the hosts within the
+// local domain, the single-label hosts, and the allowed domains along with
+// their subdomains.  host must be lowercased and have no trailing dot.
+func (s *Server) isRebindingAllowed(host string, allowed []string) (ok bool) {
+	if !strings.Contains(host, ".") || isDomainOrSubdomain(host, s.localDomainSuffix) {
+		return true
+	}
+
+	for _, d := range allowed {
+		if isDomainOrSubdomain(host, strings.ToLower(strings.TrimSuffix(d, "."))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDomainOrSubdomain returns true if host is either domain itself or its
+// subdomain.
+func isDomainOrSubdomain(host, domain string) (ok bool) {
+	return host == domain || netutil.IsSubdomain(host, domain)
+}
+
+// privateAnswerIP returns the first address from the A and AAAA records of
+// ans, which belongs to a locally-served network.  ip is nil if there is no
+// such address.
+func (s *Server) privateAnswerIP(ans []dns.RR) (ip net.IP) {
+	for _, rr := range ans {
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+
+		if s.privateNets.Contains(ip) {
+			return ip
+		}
+	}
+
+	return nil
+}
+
+// processRebindingProtection responds with REFUSED instead of the upstream
+// response, which resolves a non-local domain name to an address from a
+// locally-served network, protecting the devices in the local network from the
+// DNS rebinding attacks.
+func (s *Server) processRebindingProtection(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if !dctx.responseFromUpstream || pctx.Res == nil {
+		return resultCodeSuccess
+	}
+
+	s.serverLock.RLock()
+	enabled := s.conf.RebindingProtectionEnabled
+	allowed := s.conf.RebindingAllowedDomains
+	s.serverLock.RUnlock()
+
+	if !enabled {
+		return resultCodeSuccess
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(pctx.Req.Question[0].Name, "."))
+	if s.isRebindingAllowed(host, allowed) {
+		return resultCodeSuccess
+	}
+
+	ip := s.privateAnswerIP(pctx.Res.Answer)
+	if ip == nil {
+		return resultCodeSuccess
+	}
+
+	log.Info("dnsforward: possible dns rebinding: %q resolved to %s", host, ip)
+
+	pctx.Res = s.makeResponseREFUSED(pctx.Req)
+
+	return resultCodeSuccess
+}
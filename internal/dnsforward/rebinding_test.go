@@ -0,0 +1,134 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processRebindingProtection(t *testing.T) {
+	s := &Server{
+		conf: ServerConfig{
+			FilteringConfig: FilteringConfig{
+				RebindingProtectionEnabled: true,
+				RebindingAllowedDomains:    []string{"Allowed.example."},
+			},
+		},
+		privateNets:       netutil.SubnetSetFunc(netutil.IsLocallyServed),
+		localDomainSuffix: defaultLocalDomainSuffix,
+	}
+
+	testCases := []struct {
+		name      string
+		host      string
+		ip        net.IP
+		wantRcode int
+	}{{
+		name:      "public",
+		host:      "www.example.com.",
+		ip:        net.IP{1, 2, 3, 4},
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "private",
+		host:      "www.example.com.",
+		ip:        net.IP{192, 168, 0, 1},
+		wantRcode: dns.RcodeRefused,
+	}, {
+		name:      "loopback",
+		host:      "www.example.com.",
+		ip:        net.IP{127, 0, 0, 1},
+		wantRcode: dns.RcodeRefused,
+	}, {
+		name:      "private_v6",
+		host:      "www.example.com.",
+		ip:        net.ParseIP("fd00::1"),
+		wantRcode: dns.RcodeRefused,
+	}, {
+		name:      "allowed",
+		host:      "allowed.example.",
+		ip:        net.IP{10, 0, 0, 1},
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "allowed_subdomain",
+		host:      "nas.allowed.example.",
+		ip:        net.IP{10, 0, 0, 1},
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "not_allowed_suffix",
+		host:      "notallowed.example.",
+		ip:        net.IP{10, 0, 0, 1},
+		wantRcode: dns.RcodeRefused,
+	}, {
+		name:      "local_domain",
+		host:      "printer.lan.",
+		ip:        net.IP{192, 168, 0, 2},
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "single_label",
+		host:      "printer.",
+		ip:        net.IP{192, 168, 0, 2},
+		wantRcode: dns.RcodeSuccess,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := (&dns.Msg{}).SetQuestion(tc.host, dns.TypeA)
+			resp := (&dns.Msg{}).SetReply(req)
+
+			var rr dns.RR
+			if ip4 := tc.ip.To4(); ip4 != nil {
+				rr = &dns.A{Hdr: dns.RR_Header{Name: tc.host, Rrtype: dns.TypeA}, A: ip4}
+			} else {
+				rr = &dns.AAAA{Hdr: dns.RR_Header{Name: tc.host, Rrtype: dns.TypeAAAA}, AAAA: tc.ip}
+			}
+			resp.Answer = []dns.RR{rr}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: req,
+					Res: resp,
+				},
+				responseFromUpstream: true,
+			}
+
+			rc := s.processRebindingProtection(dctx)
+			assert.Equal(t, resultCodeSuccess, rc)
+
+			require.NotNil(t, dctx.proxyCtx.Res)
+
+			assert.Equal(t, tc.wantRcode, dctx.proxyCtx.Res.Rcode)
+		})
+	}
+}
+
+func TestValidateRebindingAllowedDomains(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		domains    []string
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		domains:    []string{"example.org", "plex.direct."},
+	}, {
+		name: "invalid",
+		wantErrMsg: `rebinding_allowed_domains: at index 1: ` +
+			`bad domain name "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
+		domains: []string{"example.org", "bad domain"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRebindingAllowedDomains(tc.domains)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package dnsforward
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// Sharded Cache
+
+// maxCacheShards is the maximum number of the DNS cache shards.
+const maxCacheShards = 256
+
+// validateCacheShards returns an error if the DNS cache sharding settings of
+// conf aren't valid.
+func validateCacheShards(conf *ServerConfig) (err error) {
+	n := conf.CacheShards
+	switch {
+	case n <= 1:
+		return nil
+	case n > maxCacheShards:
+		return fmt.Errorf("cache_shards must be less or equal than %d, got %d", maxCacheShards, n)
+	case conf.CacheOptimistic:
+		return errors.Error("cache_shards can't be used with cache_optimistic")
+	case conf.EDNSClientSubnet != nil && conf.EDNSClientSubnet.Enabled:
+		return errors.Error("cache_shards can't be used with edns_client_subnet")
+	default:
+		return nil
+	}
+}
+
+// CacheShardStats are the statistics of a single shard of the DNS cache.
+type CacheShardStats struct {
+	// Entries is the number of the cached responses.
+	Entries int `json:"entries"`
+
+	// Size is the total size of the cached responses and their keys in bytes.
+	Size int `json:"size"`
+
+	// Hits is the number of the requests answered from the shard.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of the requests not found in the shard.
+	Misses uint64 `json:"misses"`
+
+	// Evictions is the number of the responses removed from the shard to
+	// make room for the new ones.
+	Evictions uint64 `json:"evictions"`
+}
+
+// cacheShard is a single shard of a *shardedCache.
+type cacheShard struct {
+	// items are the packed cached responses by their keys.  It's an LRU cache
+	// with its own lock.
+	items cache.Cache
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// shardedCache is a cache of the upstream responses, which is split into
+// several shards by the hash of the question name.  Each shard is locked and
+// evicts its responses independently, so that the concurrent requests for
+// different names rarely wait for each other.  A nil *shardedCache caches
+// nothing.  It's safe for concurrent use.
+//
+// Unlike the cache of dnsproxy, it supports neither the optimistic caching nor
+// the EDNS Client Subnet.
+type shardedCache struct {
+	// seed is the seed of the question name hash.  It's random, so that the
+	// clients can't make the names fall into the same shard on purpose.
+	seed maphash.Seed
+
+	// shards are the shards of the cache.
+	shards []*cacheShard
+}
+
+// newShardedCache returns a new cache of size bytes split into n shards.  If
+// size is zero or n is less than two, it returns nil.
+func newShardedCache(size, n uint32) (c *shardedCache) {
+	if size == 0 || n < 2 {
+		return nil
+	}
+
+	c = &shardedCache{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*cacheShard, n),
+	}
+
+	shardSize := size / n
+	if shardSize == 0 {
+		shardSize = 1
+	}
+
+	for i := range c.shards {
+		sh := &cacheShard{}
+		sh.items = cache.New(cache.Config{
+			MaxSize:   uint(shardSize),
+			EnableLRU: true,
+			OnDelete: func(_, _ []byte) {
+				sh.evictions.Add(1)
+			},
+		})
+
+		c.shards[i] = sh
+	}
+
+	return c
+}
+
+// cacheKeyFlags are the flags of the request within a DNS cache key.
+const (
+	cacheKeyFlagDO byte = 1 << iota
+	cacheKeyFlagAD
+)
+
+// cacheKey returns the key of req in the DNS cache and the shard the key
+// belongs to.  The key includes the flags, which affect the contents of the
+// response.
+func (c *shardedCache) cacheKey(req *dns.Msg) (sh *cacheShard, key []byte) {
+	q := req.Question[0]
+	name := strings.ToLower(q.Name)
+
+	h := maphash.String(c.seed, name)
+	sh = c.shards[h%uint64(len(c.shards))]
+
+	var flags byte
+	if opt := req.IsEdns0(); opt != nil && opt.Do() {
+		flags |= cacheKeyFlagDO
+	}
+
+	if req.AuthenticatedData {
+		flags |= cacheKeyFlagAD
+	}
+
+	key = make([]byte, 0, len(name)+5)
+	key = binary.BigEndian.AppendUint16(key, q.Qtype)
+	key = binary.BigEndian.AppendUint16(key, q.Qclass)
+	key = append(key, flags)
+	key = append(key, name...)
+
+	return sh, key
+}
+
+// works returns true if the response to req may be cached.  The requests with
+// the CD bit aren't served from the cache, since only the validated responses
+// are cached.
+func (c *shardedCache) works(req *dns.Msg) (ok bool) {
+	return c != nil && len(req.Question) == 1 && !req.CheckingDisabled
+}
+
+// cacheEntryHdrLen is the length of the header of a packed cache entry, which
+// consists of the caching and the expiration times in seconds and the length
+// of the packed response.
+const cacheEntryHdrLen = 4 + 4 + 2
+
+// get returns the cached response to req at now and the address of the
+// upstream, which has resolved it.  resp is nil if there is no such response.
+// The TTLs of the records within resp are decreased by the time the response
+// has been cached for, and its OPT record is replaced with the one matching
+// req, if any.
+func (c *shardedCache) get(req *dns.Msg, now time.Time) (resp *dns.Msg, upsAddr string) {
+	sh, key := c.cacheKey(req)
+	data := sh.items.Get(key)
+	resp, upsAddr = unpackCacheEntry(data, now)
+	if resp == nil {
+		if data != nil {
+			sh.items.Del(key)
+		}
+
+		sh.misses.Add(1)
+
+		return nil, ""
+	}
+
+	sh.hits.Add(1)
+
+	resp.Id = req.Id
+	resp.Question = append(resp.Question[:0], req.Question[0])
+	if opt := req.IsEdns0(); opt != nil {
+		resp.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	return resp, upsAddr
+}
+
+// unpackCacheEntry returns the response and the upstream address from data.
+// resp is nil if data is malformed or expired at now.
+func unpackCacheEntry(data []byte, now time.Time) (resp *dns.Msg, upsAddr string) {
+	if len(data) < cacheEntryHdrLen {
+		return nil, ""
+	}
+
+	cached := int64(binary.BigEndian.Uint32(data))
+	expire := int64(binary.BigEndian.Uint32(data[4:]))
+	l := int(binary.BigEndian.Uint16(data[8:]))
+	data = data[cacheEntryHdrLen:]
+
+	unix := now.Unix()
+	if unix >= expire || l > len(data) {
+		return nil, ""
+	}
+
+	resp = &dns.Msg{}
+	err := resp.Unpack(data[:l])
+	if err != nil {
+		log.Debug("dnsforward: cache: unpacking response: %s", err)
+
+		return nil, ""
+	}
+
+	elapsed := uint32(0)
+	if unix > cached {
+		elapsed = uint32(unix - cached)
+	}
+
+	// The OPT record is specific to the request, which the response has been
+	// cached for, so remove it.
+	extra := resp.Extra[:0]
+	for _, rr := range resp.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+
+	resp.Extra = extra
+
+	for _, rrs := range [...][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+
+	return resp, string(data[l:])
+}
+
+// packBufPool is the pool of the buffers the responses are packed into before
+// they are copied into the cache entries.  It contains values of type *[]byte.
+var packBufPool = &sync.Pool{
+	New: func() (v any) {
+		buf := make([]byte, dns.MinMsgSize)
+
+		return &buf
+	},
+}
+
+// set caches resp to req resolved by the upstream with upsAddr at now.  It does
+// nothing if resp isn't cacheable.
+func (c *shardedCache) set(req, resp *dns.Msg, upsAddr string, now time.Time) {
+	ttl := cacheableTTL(resp)
+	if ttl == 0 {
+		return
+	}
+
+	bufPtr := packBufPool.Get().(*[]byte)
+	defer packBufPool.Put(bufPtr)
+
+	packed, err := resp.PackBuffer(*bufPtr)
+	if err != nil || len(packed) > math.MaxUint16 {
+		return
+	}
+
+	// Keep the buffer, if it has been grown for a larger response.
+	*bufPtr = packed[:cap(packed)]
+
+	unix := uint32(now.Unix())
+
+	data := make([]byte, 0, cacheEntryHdrLen+len(packed)+len(upsAddr))
+	data = binary.BigEndian.AppendUint32(data, unix)
+	data = binary.BigEndian.AppendUint32(data, unix+ttl)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(packed)))
+	data = append(data, packed...)
+	data = append(data, upsAddr...)
+
+	sh, key := c.cacheKey(req)
+	sh.items.Set(key, data)
+}
+
+// cacheableTTL returns the time in seconds for which resp may be cached.  It's
+// the lowest TTL among the records of resp.  It returns zero if resp must not
+// be cached, for example if it's truncated, a failure, or a NODATA response
+// without a SOA record.
+func cacheableTTL(resp *dns.Msg) (ttl uint32) {
+	if resp == nil || resp.Truncated || len(resp.Question) != 1 {
+		return 0
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+		// Go on.
+	default:
+		return 0
+	}
+
+	hasSOA := false
+	ttl = math.MaxUint32
+	for _, rrs := range [...][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			switch hdr.Rrtype {
+			case dns.TypeOPT:
+				continue
+			case dns.TypeSOA:
+				hasSOA = true
+			}
+
+			if hdr.Ttl < ttl {
+				ttl = hdr.Ttl
+			}
+		}
+	}
+
+	if ttl == math.MaxUint32 || (isNegative(resp) && !hasSOA) {
+		return 0
+	}
+
+	return ttl
+}
+
+// clear removes all the cached responses.
+func (c *shardedCache) clear() {
+	if c == nil {
+		return
+	}
+
+	for _, sh := range c.shards {
+		sh.items.Clear()
+	}
+}
+
+// stats returns the statistics of the shards of c.
+func (c *shardedCache) stats() (shards []*CacheShardStats) {
+	if c == nil {
+		return []*CacheShardStats{}
+	}
+
+	shards = make([]*CacheShardStats, 0, len(c.shards))
+	for _, sh := range c.shards {
+		st := sh.items.Stats()
+		shards = append(shards, &CacheShardStats{
+			Entries:   st.Count,
+			Size:      st.Size,
+			Hits:      sh.hits.Load(),
+			Misses:    sh.misses.Load(),
+			Evictions: sh.evictions.Load(),
+		})
+	}
+
+	return shards
+}
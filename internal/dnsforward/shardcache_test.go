@@ -0,0 +1,378 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCacheTestResp returns a response to req with a single A record with ttl.
+func newCacheTestResp(req *dns.Msg, ttl uint32) (resp *dns.Msg) {
+	resp = (&dns.Msg{}).SetReply(req)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{
+			Name:   req.Question[0].Name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		A: net.IP{1, 2, 3, 4},
+	}}
+
+	return resp
+}
+
+func TestShardedCache(t *testing.T) {
+	const upsAddr = "tls://upstream.example"
+
+	assert.Nil(t, newShardedCache(0, 4))
+	assert.Nil(t, newShardedCache(1024, 1))
+
+	var nilCache *shardedCache
+	assert.False(t, nilCache.works(&dns.Msg{}))
+	assert.Empty(t, nilCache.stats())
+	assert.NotPanics(t, nilCache.clear)
+
+	c := newShardedCache(64*1024, 4)
+	require.NotNil(t, c)
+
+	now := time.Now()
+
+	req := (&dns.Msg{}).SetQuestion("Example.ORG.", dns.TypeA)
+	req.Id = 1
+	require.True(t, c.works(req))
+
+	resp, addr := c.get(req, now)
+	assert.Nil(t, resp)
+	assert.Empty(t, addr)
+
+	c.set(req, newCacheTestResp(req, 60), upsAddr, now)
+
+	t.Run("hit", func(t *testing.T) {
+		lowerReq := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+		lowerReq.Id = 2
+		lowerReq.SetEdns0(1232, false)
+
+		resp, addr = c.get(lowerReq, now.Add(20*time.Second))
+		require.NotNil(t, resp)
+
+		assert.Equal(t, upsAddr, addr)
+		assert.Equal(t, lowerReq.Id, resp.Id)
+		assert.Equal(t, lowerReq.Question, resp.Question)
+
+		opt := resp.IsEdns0()
+		require.NotNil(t, opt)
+
+		assert.Equal(t, uint16(1232), opt.UDPSize())
+
+		require.Len(t, resp.Answer, 1)
+
+		assert.Equal(t, uint32(40), resp.Answer[0].Header().Ttl)
+	})
+
+	t.Run("other_type", func(t *testing.T) {
+		resp, _ = c.get((&dns.Msg{}).SetQuestion("example.org.", dns.TypeAAAA), now)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("do_bit", func(t *testing.T) {
+		doReq := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+		doReq.SetEdns0(1232, true)
+
+		resp, _ = c.get(doReq, now)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		resp, _ = c.get(req, now.Add(60*time.Second))
+		assert.Nil(t, resp)
+
+		resp, _ = c.get(req, now)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		c.set(req, newCacheTestResp(req, 60), upsAddr, now)
+		c.clear()
+
+		resp, _ = c.get(req, now)
+		assert.Nil(t, resp)
+	})
+}
+
+func TestShardedCache_set_notCacheable(t *testing.T) {
+	req := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+
+	truncated := newCacheTestResp(req, 60)
+	truncated.Truncated = true
+
+	servFail := (&dns.Msg{}).SetRcode(req, dns.RcodeServerFailure)
+
+	testCases := []struct {
+		resp *dns.Msg
+		name string
+	}{{
+		resp: newCacheTestResp(req, 0),
+		name: "zero_ttl",
+	}, {
+		resp: truncated,
+		name: "truncated",
+	}, {
+		resp: servFail,
+		name: "servfail",
+	}, {
+		resp: (&dns.Msg{}).SetReply(req),
+		name: "nodata_without_soa",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newShardedCache(64*1024, 2)
+			c.set(req, tc.resp, "", time.Now())
+
+			resp, _ := c.get(req, time.Now())
+			assert.Nil(t, resp)
+		})
+	}
+}
+
+func TestShardedCache_stats(t *testing.T) {
+	const shardsNum = 4
+
+	c := newShardedCache(64*1024, shardsNum)
+	require.NotNil(t, c)
+
+	now := time.Now()
+
+	const reqsNum = 100
+	for i := 0; i < reqsNum; i++ {
+		req := (&dns.Msg{}).SetQuestion(fmt.Sprintf("host-%d.example.", i), dns.TypeA)
+		c.set(req, newCacheTestResp(req, 60), "", now)
+
+		resp, _ := c.get(req, now)
+		require.NotNil(t, resp)
+
+		resp, _ = c.get((&dns.Msg{}).SetQuestion(req.Question[0].Name, dns.TypeAAAA), now)
+		require.Nil(t, resp)
+	}
+
+	stats := c.stats()
+	require.Len(t, stats, shardsNum)
+
+	var entries int
+	var hits, misses uint64
+	for _, st := range stats {
+		// The names must be spread between the shards.
+		assert.Positive(t, st.Entries)
+		assert.Positive(t, st.Size)
+		assert.Zero(t, st.Evictions)
+
+		entries += st.Entries
+		hits += st.Hits
+		misses += st.Misses
+	}
+
+	assert.Equal(t, reqsNum, entries)
+	assert.Equal(t, uint64(reqsNum), hits)
+	assert.Equal(t, uint64(reqsNum), misses)
+}
+
+func TestShardedCache_eviction(t *testing.T) {
+	// Make the shards fit only a few responses.
+	c := newShardedCache(1024, 2)
+	require.NotNil(t, c)
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		req := (&dns.Msg{}).SetQuestion(fmt.Sprintf("host-%d.example.", i), dns.TypeA)
+		c.set(req, newCacheTestResp(req, 60), "", now)
+	}
+
+	var evictions uint64
+	for _, st := range c.stats() {
+		assert.LessOrEqual(t, st.Size, 512)
+
+		evictions += st.Evictions
+	}
+
+	assert.Positive(t, evictions)
+}
+
+func TestServer_resolve_shardedCache(t *testing.T) {
+	const upsAddr = "upstream.example"
+
+	var exchanges int
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		exchanges++
+
+		return newCacheTestResp(req, 60), nil
+	})
+	ups.OnAddress = func() (addr string) { return upsAddr }
+
+	prx := &proxy.Proxy{
+		Config: proxy.Config{
+			UpstreamConfig: &proxy.UpstreamConfig{
+				Upstreams: []upstream.Upstream{ups},
+			},
+		},
+	}
+	require.NoError(t, prx.Init())
+
+	s := &Server{
+		cache: newShardedCache(64*1024, 4),
+	}
+
+	newCtx := func() (pctx *proxy.DNSContext) {
+		return &proxy.DNSContext{
+			Proto: proxy.ProtoUDP,
+			Req:   (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA),
+		}
+	}
+
+	pctx := newCtx()
+	require.NoError(t, s.resolve(prx, pctx))
+	require.NotNil(t, pctx.Res)
+
+	assert.Equal(t, 1, exchanges)
+	assert.Empty(t, pctx.CachedUpstreamAddr)
+
+	pctx = newCtx()
+	require.NoError(t, s.resolve(prx, pctx))
+	require.NotNil(t, pctx.Res)
+
+	assert.Equal(t, 1, exchanges)
+	assert.Equal(t, upsAddr, pctx.CachedUpstreamAddr)
+	assert.Nil(t, pctx.Upstream)
+
+	pctx = newCtx()
+	pctx.CustomUpstreamConfig = prx.UpstreamConfig
+	require.NoError(t, s.resolve(prx, pctx))
+
+	assert.Equal(t, 2, exchanges)
+}
+
+func TestValidateCacheShards(t *testing.T) {
+	testCases := []struct {
+		conf    *ServerConfig
+		name    string
+		wantErr string
+	}{{
+		conf:    &ServerConfig{},
+		name:    "not_sharded",
+		wantErr: "",
+	}, {
+		conf: &ServerConfig{
+			FilteringConfig: FilteringConfig{
+				CacheShards:     1,
+				CacheOptimistic: true,
+			},
+		},
+		name:    "single_optimistic",
+		wantErr: "",
+	}, {
+		conf: &ServerConfig{
+			FilteringConfig: FilteringConfig{
+				CacheShards: 16,
+			},
+		},
+		name:    "sharded",
+		wantErr: "",
+	}, {
+		conf: &ServerConfig{
+			FilteringConfig: FilteringConfig{
+				CacheShards: maxCacheShards + 1,
+			},
+		},
+		name:    "too_many",
+		wantErr: "cache_shards must be less or equal than 256, got 257",
+	}, {
+		conf: &ServerConfig{
+			FilteringConfig: FilteringConfig{
+				CacheShards:     16,
+				CacheOptimistic: true,
+			},
+		},
+		name:    "optimistic",
+		wantErr: "cache_shards can't be used with cache_optimistic",
+	}, {
+		conf: &ServerConfig{
+			FilteringConfig: FilteringConfig{
+				CacheShards: 16,
+				EDNSClientSubnet: &EDNSClientSubnet{
+					Enabled: true,
+				},
+			},
+		},
+		name:    "ecs",
+		wantErr: "cache_shards can't be used with edns_client_subnet",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErr, validateCacheShards(tc.conf))
+		})
+	}
+}
+
+func BenchmarkShardedCache_set(b *testing.B) {
+	c := newShardedCache(64*1024, 4)
+	req := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+	resp := newCacheTestResp(req, 60)
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.set(req, resp, "upstream.example", now)
+	}
+}
+
+// errSink is the sink for the benchmark results.
+var errSink error
+
+func BenchmarkServer_resolve_shardedCache(b *testing.B) {
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		return newCacheTestResp(req, 60), nil
+	})
+
+	prx := &proxy.Proxy{
+		Config: proxy.Config{
+			UpstreamConfig: &proxy.UpstreamConfig{
+				Upstreams: []upstream.Upstream{ups},
+			},
+		},
+	}
+	require.NoError(b, prx.Init())
+
+	s := &Server{
+		cache: newShardedCache(64*1024, 4),
+	}
+
+	req := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+	req.SetEdns0(1232, false)
+
+	pctx := &proxy.DNSContext{
+		Proto: proxy.ProtoUDP,
+		Req:   req,
+	}
+
+	// Warm the cache up.
+	require.NoError(b, s.resolve(prx, pctx))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		errSink = s.resolve(prx, pctx)
+	}
+
+	require.NoError(b, errSink)
+}
@@ -0,0 +1,119 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Single-Label Queries
+
+// SingleLabelPolicy is an enum of the ways to handle the queries for the
+// single-label hostnames, such as "printer" or "nas", which aren't top-level
+// domains.
+type SingleLabelPolicy string
+
+// SingleLabelPolicy values.
+const (
+	// SingleLabelPolicyForward means that the queries are forwarded to the
+	// upstream servers like any other ones.
+	SingleLabelPolicyForward SingleLabelPolicy = "forward"
+
+	// SingleLabelPolicyBlock means that the queries are answered with
+	// NXDOMAIN without contacting the upstream servers.
+	SingleLabelPolicyBlock SingleLabelPolicy = "block"
+
+	// SingleLabelPolicyLocal means that the queries are resolved within the
+	// local domain using the DHCP leases and are never forwarded.
+	SingleLabelPolicyLocal SingleLabelPolicy = "local"
+)
+
+// validateSingleLabelPolicy returns an error if p isn't a valid policy.  An
+// empty value is the same as [SingleLabelPolicyForward].
+func validateSingleLabelPolicy(p SingleLabelPolicy) (err error) {
+	switch p {
+	case "", SingleLabelPolicyForward, SingleLabelPolicyBlock, SingleLabelPolicyLocal:
+		return nil
+	default:
+		return fmt.Errorf("single_label_policy: bad value %q", p)
+	}
+}
+
+// isSingleLabelHost returns true if host is a single-label hostname, which
+// isn't a top-level domain.  host must be lowercased and have no trailing dot.
+func isSingleLabelHost(host string) (ok bool) {
+	if host == "" || strings.Contains(host, ".") {
+		return false
+	}
+
+	// Don't touch the queries for the top-level domains, such as the DS and
+	// NS queries for "com" made by the validating resolvers.
+	_, icann := publicsuffix.PublicSuffix(host)
+
+	return !icann
+}
+
+// processSingleLabel handles the queries for the single-label hostnames, which
+// haven't been answered by the filtering rules or the DHCP, according to the
+// configured policy.  It's called right before the upstream servers are
+// contacted, so that the bare hostnames don't leak there unless the policy
+// says so.
+func (s *Server) processSingleLabel(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil {
+		return resultCodeSuccess
+	}
+
+	s.serverLock.RLock()
+	policy := s.conf.SingleLabelPolicy
+	s.serverLock.RUnlock()
+
+	if policy == "" || policy == SingleLabelPolicyForward {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	q := req.Question[0]
+	host := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	if !isSingleLabelHost(host) {
+		return resultCodeSuccess
+	}
+
+	if policy == SingleLabelPolicyLocal {
+		pctx.Res = s.resolveSingleLabelLocal(req, host)
+	} else {
+		log.Debug("dnsforward: single-label host %q is blocked", host)
+
+		pctx.Res = s.genNXDomain(req)
+	}
+
+	return resultCodeSuccess
+}
+
+// resolveSingleLabelLocal returns the response to req for the single-label
+// host as if it was the hostname within the local domain.  It responds with
+// NXDOMAIN if there is no such DHCP lease.
+func (s *Server) resolveSingleLabelLocal(req *dns.Msg, host string) (resp *dns.Msg) {
+	localHost := host + "." + s.localDomainSuffix
+	ip, ok := s.dhcpHostToIP(localHost)
+	if !ok {
+		log.Debug("dnsforward: no dhcp record for single-label host %q", host)
+
+		return s.genNXDomain(req)
+	}
+
+	log.Debug("dnsforward: single-label host %q resolved locally to %s", host, ip)
+
+	resp = s.makeResponse(req)
+	if req.Question[0].Qtype == dns.TypeA {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: s.hdr(req, dns.TypeA),
+			A:   ip.AsSlice(),
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,132 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_processSingleLabel(t *testing.T) {
+	knownIP := netip.MustParseAddr("192.168.0.2")
+
+	// rcodeForwarded means that the query must be left for the upstream
+	// servers.
+	const rcodeForwarded = -1
+
+	testCases := []struct {
+		name      string
+		host      string
+		policy    SingleLabelPolicy
+		wantIP    netip.Addr
+		qtype     uint16
+		wantRcode int
+	}{{
+		name:      "forward",
+		host:      "printer.",
+		policy:    SingleLabelPolicyForward,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeA,
+		wantRcode: rcodeForwarded,
+	}, {
+		name:      "empty_policy",
+		host:      "printer.",
+		policy:    "",
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeA,
+		wantRcode: rcodeForwarded,
+	}, {
+		name:      "block",
+		host:      "printer.",
+		policy:    SingleLabelPolicyBlock,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+	}, {
+		name:      "block_multi_label",
+		host:      "printer.example.",
+		policy:    SingleLabelPolicyBlock,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeA,
+		wantRcode: rcodeForwarded,
+	}, {
+		name:      "block_tld",
+		host:      "com.",
+		policy:    SingleLabelPolicyBlock,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeDS,
+		wantRcode: rcodeForwarded,
+	}, {
+		name:      "local",
+		host:      "Printer.",
+		policy:    SingleLabelPolicyLocal,
+		wantIP:    knownIP,
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "local_aaaa",
+		host:      "printer.",
+		policy:    SingleLabelPolicyLocal,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeAAAA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "local_unknown",
+		host:      "nas.",
+		policy:    SingleLabelPolicyLocal,
+		wantIP:    netip.Addr{},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				conf: ServerConfig{
+					FilteringConfig: FilteringConfig{
+						SingleLabelPolicy: tc.policy,
+					},
+				},
+				localDomainSuffix: defaultLocalDomainSuffix,
+				tableHostToIP: hostToIPTable{
+					"printer." + defaultLocalDomainSuffix: knownIP,
+				},
+			}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: (&dns.Msg{}).SetQuestion(tc.host, tc.qtype),
+				},
+			}
+
+			rc := s.processSingleLabel(dctx)
+			assert.Equal(t, resultCodeSuccess, rc)
+
+			res := dctx.proxyCtx.Res
+			if tc.wantRcode == rcodeForwarded {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+			assert.Equal(t, tc.wantRcode, res.Rcode)
+
+			if tc.wantIP == (netip.Addr{}) {
+				assert.Empty(t, res.Answer)
+
+				return
+			}
+
+			require.Len(t, res.Answer, 1)
+
+			a, ok := res.Answer[0].(*dns.A)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.wantIP.AsSlice(), []byte(a.A))
+		})
+	}
+}
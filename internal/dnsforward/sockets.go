@@ -0,0 +1,158 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// socketReadTimeout is the read timeout of the TCP connections accepted from
+// the inherited sockets.
+const socketReadTimeout = 2 * time.Second
+
+// startSockets starts serving plain DNS on the sockets passed by the service
+// manager.  The descriptors are duplicated, so that the sockets remain open
+// after the server is stopped.  s.serverLock is expected to be locked.
+func (s *Server) startSockets() (err error) {
+	for _, f := range s.socketFiles {
+		srv := &dns.Server{
+			ReadTimeout: socketReadTimeout,
+		}
+
+		var l net.Listener
+		l, err = net.FileListener(f)
+		if err == nil {
+			srv.Listener = l
+			srv.Handler = s.socketHandler(proxy.ProtoTCP)
+		} else {
+			srv.PacketConn, err = net.FilePacketConn(f)
+			if err != nil {
+				return fmt.Errorf("socket %s: not a stream or datagram socket: %w", f.Name(), err)
+			}
+
+			srv.Handler = s.socketHandler(proxy.ProtoUDP)
+		}
+
+		s.socketServers = append(s.socketServers, srv)
+
+		go serveSocket(srv)
+	}
+
+	return nil
+}
+
+// serveSocket serves DNS on srv until it's shut down.
+func serveSocket(srv *dns.Server) {
+	defer log.OnPanic("dnsforward: serving socket")
+
+	err := srv.ActivateAndServe()
+	if err != nil {
+		log.Error("dnsforward: serving socket: %s", err)
+	}
+}
+
+// stopSockets stops serving plain DNS on the sockets passed by the service
+// manager.  s.serverLock is expected to be locked.
+func (s *Server) stopSockets() (err error) {
+	var errs []error
+	for _, srv := range s.socketServers {
+		err = srv.Shutdown()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.socketServers = nil
+
+	if len(errs) > 0 {
+		return errors.List("stopping socket servers", errs...)
+	}
+
+	return nil
+}
+
+// socketHandler returns the handler of the DNS requests received on the sockets
+// passed by the service manager.  It processes the requests the same way the
+// DNS proxy does, except for the rate limiting.
+//
+// TODO(e.burkov):  Use the DNS proxy's handler once it supports the external
+// listeners.
+func (s *Server) socketHandler(proto proxy.Proto) (h dns.HandlerFunc) {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		p := s.proxy()
+		if p == nil || req.Response {
+			return
+		}
+
+		pctx := &proxy.DNSContext{
+			Proto:     proto,
+			Req:       req,
+			Addr:      w.RemoteAddr(),
+			StartTime: time.Now(),
+		}
+
+		resp := s.socketResponse(p, pctx)
+		if resp == nil {
+			return
+		}
+
+		if proto == proxy.ProtoUDP {
+			resp.Truncate(udpSize(req))
+		}
+
+		err := w.WriteMsg(resp)
+		if err != nil {
+			log.Debug("dnsforward: socket: writing response: %s", err)
+		}
+	}
+}
+
+// socketResponse processes the request from pctx and returns the response to
+// it.  resp is nil if the request must be dropped.
+func (s *Server) socketResponse(p *proxy.Proxy, pctx *proxy.DNSContext) (resp *dns.Msg) {
+	req := pctx.Req
+
+	ok, err := s.beforeRequestHandler(p, pctx)
+	switch {
+	case err != nil:
+		log.Debug("dnsforward: socket: %s", err)
+
+		return (&dns.Msg{}).SetRcode(req, dns.RcodeServerFailure)
+	case !ok:
+		return nil
+	case pctx.Res != nil:
+		// The request is refused by the access settings.
+		return pctx.Res
+	case len(req.Question) != 1:
+		return (&dns.Msg{}).SetRcode(req, dns.RcodeServerFailure)
+	case s.conf.RefuseAny && req.Question[0].Qtype == dns.TypeANY:
+		return (&dns.Msg{}).SetRcode(req, dns.RcodeNotImplemented)
+	default:
+		// Go on.
+	}
+
+	err = s.handleDNSRequest(p, pctx)
+	if err != nil {
+		log.Debug("dnsforward: socket: handling request: %s", err)
+	}
+
+	if pctx.Res == nil {
+		return (&dns.Msg{}).SetRcode(req, dns.RcodeServerFailure)
+	}
+
+	return pctx.Res
+}
+
+// udpSize returns the maximum size of the UDP response to req.
+func udpSize(req *dns.Msg) (size int) {
+	if opt := req.IsEdns0(); opt != nil && opt.UDPSize() > dns.MinMsgSize {
+		return int(opt.UDPSize())
+	}
+
+	return dns.MinMsgSize
+}
@@ -0,0 +1,100 @@
+package dnsforward
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSocketFiles returns the files of a UDP and a TCP socket listening on
+// localhost and their addresses.
+func newSocketFiles(t *testing.T) (files []*os.File, udpAddr, tcpAddr net.Addr) {
+	t.Helper()
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, udpConn.Close)
+
+	udpFile, err := udpConn.File()
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, udpFile.Close)
+
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, tcpListener.Close)
+
+	tcpFile, err := tcpListener.File()
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, tcpFile.Close)
+
+	return []*os.File{udpFile, tcpFile}, udpConn.LocalAddr(), tcpListener.Addr()
+}
+
+func TestServer_socketFiles(t *testing.T) {
+	files, udpAddr, tcpAddr := newSocketFiles(t)
+
+	forwardConf := ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		FilteringConfig: FilteringConfig{
+			ProtectionEnabled: true,
+			BlockingMode:      BlockingModeDefault,
+			EDNSClientSubnet: &EDNSClientSubnet{
+				Enabled: false,
+			},
+		},
+	}
+	s := createTestServer(t, &filtering.Config{}, forwardConf, nil)
+
+	s.socketFiles = files
+	require.NoError(t, s.Prepare(&s.conf))
+	require.Nil(t, s.dnsProxy.UDPListenAddr)
+	require.Nil(t, s.dnsProxy.TCPListenAddr)
+
+	startDeferStop(t, s)
+
+	testCases := []struct {
+		addr net.Addr
+		name string
+		net  string
+	}{{
+		addr: udpAddr,
+		name: "udp",
+		net:  "udp",
+	}, {
+		addr: tcpAddr,
+		name: "tcp",
+		net:  "tcp",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &dns.Client{Net: tc.net}
+			req := createTestMessage("nxdomain.example.org.")
+
+			reply, _, err := client.Exchange(req, tc.addr.String())
+			require.NoError(t, err)
+
+			assert.Equal(t, dns.RcodeSuccess, reply.Rcode)
+			require.Len(t, reply.Answer, 1)
+
+			assert.True(t, reply.Answer[0].(*dns.A).A.IsUnspecified())
+		})
+	}
+
+	t.Run("reconfigure", func(t *testing.T) {
+		require.NoError(t, s.Reconfigure(nil))
+
+		req := createTestMessage("nxdomain.example.org.")
+		reply, err := dns.Exchange(req, udpAddr.String())
+		require.NoError(t, err)
+
+		assert.Equal(t, dns.RcodeSuccess, reply.Rcode)
+	})
+}
@@ -40,6 +40,8 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 
 	log.Debug("client ip: %s", ip)
 
+	s.counters.update(pctx, dctx.result.IsFiltered, elapsed)
+
 	// Synchronize access to s.queryLog and s.stats so they won't be suddenly
 	// uninitialized while in use.  This can happen after proxy server has been
 	// stopped, but its workers haven't yet exited.
@@ -60,6 +62,10 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 		s.updateStats(dctx, elapsed, *dctx.result, ip)
 	}
 
+	if s.conf.OnBlocked != nil && dctx.result.IsFiltered {
+		s.conf.OnBlocked(host, ip, dctx.clientID, dctx.result)
+	}
+
 	return resultCodeSuccess
 }
 
@@ -80,6 +86,7 @@ func (s *Server) logQuery(
 		ClientIP:          ip,
 		Elapsed:           elapsed,
 		AuthenticatedData: dctx.responseAD,
+		Fallback:          dctx.responseFromFallback,
 	}
 
 	switch pctx.Proto {
@@ -105,6 +112,39 @@ func (s *Server) logQuery(
 	s.queryLog.Add(p)
 }
 
+// updateRefusedStats writes the request refused by its query type qt into
+// statistics.
+func (s *Server) updateRefusedStats(pctx *proxy.DNSContext, clientID string, qt uint16) {
+	q := pctx.Req.Question[0]
+	e := stats.Entry{
+		Domain:           strings.ToLower(strings.TrimSuffix(q.Name, ".")),
+		Client:           clientID,
+		Result:           stats.RFiltered,
+		RefusedQueryType: dns.Type(qt).String(),
+	}
+
+	ip, _ := netutil.IPAndPortFromAddr(pctx.Addr)
+	ip = slices.Clone(ip)
+
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	if s.stats == nil || !s.stats.ShouldCount(e.Domain, q.Qtype, q.Qclass) {
+		return
+	}
+
+	if e.Client == "" {
+		if ip == nil {
+			return
+		}
+
+		s.anonymizer.Load()(ip)
+		e.Client = ip.String()
+	}
+
+	s.stats.Update(e)
+}
+
 // updatesStats writes the request into statistics.
 func (s *Server) updateStats(
 	ctx *dnsContext,
@@ -135,9 +175,33 @@ func (s *Server) updateStats(
 		e.Result = stats.RSafeSearch
 	case filtering.FilteredBlockList,
 		filtering.FilteredInvalid,
-		filtering.FilteredBlockedService:
+		filtering.FilteredBlockedService,
+		filtering.FilteredLookalike:
 		e.Result = stats.RFiltered
 	}
 
+	if t := res.Threat; t != nil {
+		e.ThreatFeed = t.Feed
+		e.ThreatCategory = t.Category
+	}
+
+	e.Protocol = string(pctx.Proto)
+	e.BytesIn = estimatedSize(pctx.Req)
+	e.BytesOut = estimatedSize(pctx.Res)
+
 	s.stats.Update(e)
 }
+
+// estimatedSize returns the estimated size of m packed, in bytes.  The actual
+// sizes of the messages on the wire aren't known here, since those are read and
+// written by the proxy, and the response is only packed after the processing.
+// The framing of the transport, such as the TCP length prefix or the HTTP
+// headers, isn't included either.  It returns zero if m is nil.  It's called
+// once per message, since the estimation walks through the whole message.
+func estimatedSize(m *dns.Msg) (n uint64) {
+	if m == nil {
+		return 0
+	}
+
+	return uint64(m.Len())
+}
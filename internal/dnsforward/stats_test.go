@@ -205,6 +205,48 @@ func TestProcessQueryLogsAndStats(t *testing.T) {
 			assert.Equal(t, tc.wantLogProto, ql.lastParams.ClientProto)
 			assert.Equal(t, tc.wantStatClient, st.lastEntry.Client)
 			assert.Equal(t, tc.wantStatResult, st.lastEntry.Result)
+
+			c := srv.Counters()
+			assert.Equal(t, uint64(1), c.Queries)
+			assert.Equal(t, uint64(1), c.UpstreamQueries)
+
+			require.Len(t, c.Upstreams, 1)
+			assert.Equal(t, ups.Address(), c.Upstreams[0].Address)
 		})
 	}
 }
+
+func TestServer_Counters(t *testing.T) {
+	srv := &Server{
+		anonymizer: aghnet.NewIPMut(nil),
+	}
+
+	for _, blocked := range []bool{true, false} {
+		dctx := &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req: &dns.Msg{
+					Question: []dns.Question{{
+						Name: "example.com.",
+					}},
+				},
+				Addr:               &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 1234},
+				CachedUpstreamAddr: "1.1.1.1:53",
+			},
+			startTime: time.Now(),
+			result: &filtering.Result{
+				IsFiltered: blocked,
+			},
+		}
+
+		code := srv.processQueryLogsAndStats(dctx)
+		require.Equal(t, resultCodeSuccess, code)
+	}
+
+	assert.Equal(t, &Counters{
+		Upstreams:       []*UpstreamCounters{},
+		Queries:         2,
+		Blocked:         1,
+		CacheHits:       2,
+		UpstreamQueries: 0,
+	}, srv.Counters())
+}
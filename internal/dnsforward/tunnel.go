@@ -0,0 +1,646 @@
+package dnsforward
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DNS Tunneling Detection
+
+// Tunneling detection constants.
+const (
+	// defaultTunnelScoreThreshold is the score, starting from which a client
+	// is considered a suspect, if it isn't configured.
+	defaultTunnelScoreThreshold = 70
+
+	// maxTunnelScore is the maximum score of a client.
+	maxTunnelScore = 100
+
+	// tunnelWindow is the duration of the window, within which the queries
+	// of a client are scored.
+	tunnelWindow = time.Minute
+
+	// tunnelSuspectTTL is the duration, for which a client stays a suspect
+	// after its score has last exceeded the threshold.
+	tunnelSuspectTTL = time.Hour
+
+	// minTunnelQueries is the number of queries a client should make within
+	// a window to be scored at all, so that a few unusual queries don't
+	// cause false positives.
+	minTunnelQueries = 20
+
+	// maxTunnelClients is the maximum number of clients tracked at the same
+	// time.
+	maxTunnelClients = 10_000
+
+	// maxTunnelClientDomains is the maximum number of the base domains
+	// counted separately for a client within a window, so that a client
+	// querying many domains can't grow the memory used without bound.  When
+	// there is no room for a new domain, the least queried one is replaced,
+	// see [tunnelClient.add].
+	maxTunnelClientDomains = 256
+
+	// minTunnelSubdomainLen is the minimum length of the subdomain part of a
+	// name, which is checked for the high entropy.
+	minTunnelSubdomainLen = 16
+
+	// tunnelHighEntropy is the Shannon entropy in bits per character,
+	// starting from which the subdomain part of a name is considered
+	// encoded data.  The hex-encoded data have about 3.8 bits per character,
+	// while the usual words have less than 3.5.
+	tunnelHighEntropy = 3.5
+
+	// tunnelDomainRate is the number of queries to a single domain within a
+	// window, which gives the full rate score.
+	tunnelDomainRate = 300
+
+	// tunnelRecordsRate is the number of TXT and NULL queries within a
+	// window, which gives the full record score.
+	tunnelRecordsRate = 100
+)
+
+// Weights of the scores of the heuristics in the total score.  Their sum is
+// [maxTunnelScore].
+const (
+	tunnelWeightEntropy = 40
+	tunnelWeightRate    = 30
+	tunnelWeightRecords = 30
+)
+
+// TunnelDetectionConfig is the configuration of the DNS tunneling detection.
+type TunnelDetectionConfig struct {
+	// Enabled defines if the queries of the clients are scored.
+	Enabled bool `yaml:"enabled"`
+
+	// ScoreThreshold is the score from 1 to 100, starting from which a client
+	// is considered a suspect.  If zero, [defaultTunnelScoreThreshold] is
+	// used.
+	ScoreThreshold uint32 `yaml:"score_threshold"`
+
+	// SuspectRatelimit is the number of requests per second allowed for a
+	// suspect.  The requests exceeding it are refused.  If zero, the suspects
+	// aren't rate-limited.
+	SuspectRatelimit uint32 `yaml:"suspect_ratelimit"`
+}
+
+// validateTunnelDetection returns an error if c is invalid.
+func validateTunnelDetection(c *TunnelDetectionConfig) (err error) {
+	if c.ScoreThreshold > maxTunnelScore {
+		return fmt.Errorf(
+			"score_threshold: must be at most %d, got %d",
+			maxTunnelScore,
+			c.ScoreThreshold,
+		)
+	}
+
+	return nil
+}
+
+// threshold returns the effective score threshold of c.
+func (c *TunnelDetectionConfig) threshold() (t uint32) {
+	if c.ScoreThreshold == 0 {
+		return defaultTunnelScoreThreshold
+	}
+
+	return c.ScoreThreshold
+}
+
+// TunnelSuspectEvent is a client newly suspected of DNS tunneling.
+type TunnelSuspectEvent struct {
+	// Client is the IP address or the ClientID of the client.
+	Client string
+
+	// Domain is the domain the client has queried the most.
+	Domain string
+
+	// Score is the score of the client.
+	Score uint32
+}
+
+// tunnelSuspect is a client suspected of DNS tunneling.
+type tunnelSuspect struct {
+	// Detected is the time when the client has become a suspect.
+	Detected time.Time `json:"detected"`
+
+	// LastDetected is the time when the score of the client has last
+	// exceeded the threshold.
+	LastDetected time.Time `json:"last_detected"`
+
+	// Client is the IP address or the ClientID of the client.
+	Client string `json:"client"`
+
+	// Domain is the domain the client has queried the most.
+	Domain string `json:"domain"`
+
+	// EntropyScore is the share of the queries with the high-entropy names,
+	// from 0 to 1.
+	EntropyScore float64 `json:"entropy_score"`
+
+	// RateScore is the score of the rate of the queries to Domain, from 0 to
+	// 1.
+	RateScore float64 `json:"rate_score"`
+
+	// RecordsScore is the score of the volume of the TXT and NULL queries,
+	// from 0 to 1.
+	RecordsScore float64 `json:"records_score"`
+
+	// Dropped is the number of requests of the client refused by the rate
+	// limiting.
+	Dropped uint64 `json:"dropped"`
+
+	// Score is the maximum total score of the client, from 0 to 100.
+	Score uint32 `json:"score"`
+}
+
+// tunnelClient are the statistics of the queries of a single client within
+// the current window.
+type tunnelClient struct {
+	// windowStart is the start of the current window.
+	windowStart time.Time
+
+	// lastSeen is the time of the last query of the client.
+	lastSeen time.Time
+
+	// second is the start of the current second of the rate limiting.
+	second time.Time
+
+	// domains are the numbers of the queries by the base domains.  It
+	// contains at most [maxTunnelClientDomains] entries.  The numbers may
+	// exceed the actual ones, see [tunnelClient.add].
+	domains map[string]uint32
+
+	// elem is the element of the client in [tunnelDetector.lru].
+	elem *list.Element
+
+	// key is the IP address or the ClientID of the client.
+	key string
+
+	// topDomain is the domain queried the most within the window.
+	topDomain string
+
+	// top is the number of the queries for topDomain.
+	top uint32
+
+	// queries is the number of the queries.
+	queries uint32
+
+	// highEntropy is the number of the queries with the high-entropy names.
+	highEntropy uint32
+
+	// records is the number of the TXT and NULL queries.
+	records uint32
+
+	// secondQueries is the number of the queries within the current second.
+	secondQueries uint32
+}
+
+// reset starts a new window at now.
+func (c *tunnelClient) reset(now time.Time) {
+	c.windowStart = now
+	if c.domains == nil {
+		c.domains = map[string]uint32{}
+	} else {
+		maps.Clear(c.domains)
+	}
+
+	c.topDomain = ""
+	c.top = 0
+	c.queries = 0
+	c.highEntropy = 0
+	c.records = 0
+}
+
+// add accounts a query for the base domain.  isHighEntropy is true if the
+// queried name has the high entropy, and isRecord is true if the query is a
+// TXT or a NULL one.
+//
+// When there is no room for a new domain, it replaces the least queried one and
+// inherits its number of queries, as in the Space-Saving algorithm.  So the
+// numbers only overestimate the queries, and a domain queried more than
+// 1/[maxTunnelClientDomains] of the times within the window is never evicted,
+// however many other domains the client queries.
+func (c *tunnelClient) add(base string, isHighEntropy, isRecord bool) {
+	c.queries++
+	if isHighEntropy {
+		c.highEntropy++
+	}
+
+	if isRecord {
+		c.records++
+	}
+
+	n, ok := c.domains[base]
+	if !ok && len(c.domains) >= maxTunnelClientDomains {
+		n = c.evictLeast()
+	}
+
+	n++
+	c.domains[base] = n
+	if n > c.top {
+		c.topDomain, c.top = base, n
+	}
+}
+
+// evictLeast removes the least queried domain from c.domains and returns its
+// number of queries.
+func (c *tunnelClient) evictLeast() (n uint32) {
+	least := ""
+	n = math.MaxUint32
+	for d, dn := range c.domains {
+		if dn < n {
+			least, n = d, dn
+		}
+	}
+
+	delete(c.domains, least)
+
+	return n
+}
+
+// score returns the scores of c and the domain it has queried the most.
+func (c *tunnelClient) score() (s *tunnelSuspect) {
+	s = &tunnelSuspect{
+		Domain: c.topDomain,
+	}
+
+	s.EntropyScore = float64(c.highEntropy) / float64(c.queries)
+	s.RateScore = math.Min(1, float64(c.top)/tunnelDomainRate)
+	s.RecordsScore = math.Min(1, float64(c.records)/tunnelRecordsRate)
+
+	total := tunnelWeightEntropy*s.EntropyScore +
+		tunnelWeightRate*s.RateScore +
+		tunnelWeightRecords*s.RecordsScore
+	s.Score = uint32(math.Round(total))
+
+	return s
+}
+
+// tunnelDetector scores the clients on their queries and keeps the suspects.
+// The zero value is ready to use.  A tunnelDetector is safe for concurrent
+// use.
+type tunnelDetector struct {
+	// mu protects lru, clients, and suspects.
+	mu sync.Mutex
+
+	// lru are the tracked clients from the most to the least recently seen.
+	lru list.List
+
+	// clients are the statistics of the clients by their IP addresses and
+	// ClientIDs.
+	clients map[string]*tunnelClient
+
+	// suspects are the suspects by their IP addresses and ClientIDs.
+	suspects map[string]*tunnelSuspect
+}
+
+// observe accounts the query for host of type qt made by client at now and
+// returns the client's suspect entry, if the client is a suspect.  isNew is
+// true if the client has become a suspect with this query.  It takes constant
+// time regardless of the number of the queries and domains of the client.
+func (d *tunnelDetector) observe(
+	client string,
+	host string,
+	qt uint16,
+	threshold uint32,
+	now time.Time,
+) (sus *tunnelSuspect, isNew bool) {
+	// Inspect the name before locking, since it's the slowest part.
+	base, sub := splitTunnelHost(host)
+	isHighEntropy := len(sub) >= minTunnelSubdomainLen && shannonEntropy(sub) >= tunnelHighEntropy
+	isRecord := qt == dns.TypeTXT || qt == dns.TypeNULL
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sus = d.suspectLocked(client, now)
+
+	c := d.clientLocked(client, now)
+	if c == nil {
+		return sus, false
+	}
+
+	c.add(base, isHighEntropy, isRecord)
+	if c.queries < minTunnelQueries {
+		return sus, false
+	}
+
+	score := c.score()
+	if score.Score < threshold {
+		return sus, false
+	}
+
+	if sus == nil {
+		score.Client = client
+		score.Detected = now
+		if d.suspects == nil {
+			d.suspects = map[string]*tunnelSuspect{}
+		}
+
+		d.suspects[client] = score
+		sus, isNew = score, true
+	} else if score.Score >= sus.Score {
+		score.Client, score.Detected, score.Dropped = client, sus.Detected, sus.Dropped
+		*sus = *score
+	}
+
+	sus.LastDetected = now
+
+	return sus, isNew
+}
+
+// suspectLocked returns the suspect entry of client at now, if any.  The
+// expired entry is removed.  d.mu is expected to be locked.
+func (d *tunnelDetector) suspectLocked(client string, now time.Time) (sus *tunnelSuspect) {
+	sus, ok := d.suspects[client]
+	if !ok {
+		return nil
+	} else if now.Sub(sus.LastDetected) >= tunnelSuspectTTL {
+		log.Debug("dnsforward: tunneling suspicion of %q expired", client)
+		delete(d.suspects, client)
+
+		return nil
+	}
+
+	return sus
+}
+
+// clientLocked returns the statistics of client with the window current at
+// now.  c is nil if there are too many clients tracked already.  In that case,
+// the least recently seen client is evicted, if its window has ended.  d.mu is
+// expected to be locked.
+func (d *tunnelDetector) clientLocked(client string, now time.Time) (c *tunnelClient) {
+	c, ok := d.clients[client]
+	if ok {
+		if now.Sub(c.windowStart) >= tunnelWindow {
+			c.reset(now)
+		}
+
+		c.lastSeen = now
+		d.lru.MoveToFront(c.elem)
+
+		return c
+	}
+
+	if d.clients == nil {
+		d.clients = map[string]*tunnelClient{}
+	} else if len(d.clients) >= maxTunnelClients {
+		oldest := d.lru.Back().Value.(*tunnelClient)
+		if now.Sub(oldest.lastSeen) < tunnelWindow {
+			return nil
+		}
+
+		d.removeClientLocked(oldest)
+	}
+
+	c = &tunnelClient{
+		lastSeen: now,
+		key:      client,
+	}
+	c.reset(now)
+	c.elem = d.lru.PushFront(c)
+	d.clients[client] = c
+
+	return c
+}
+
+// removeClientLocked stops tracking c.  d.mu is expected to be locked.
+func (d *tunnelDetector) removeClientLocked(c *tunnelClient) {
+	d.lru.Remove(c.elem)
+	delete(d.clients, c.key)
+}
+
+// allow returns false if the request of client at now exceeds limit requests
+// per second and must be refused.  Only the suspects are limited.
+func (d *tunnelDetector) allow(client string, limit uint32, now time.Time) (ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sus := d.suspectLocked(client, now)
+	c := d.clients[client]
+	if sus == nil || c == nil {
+		return true
+	}
+
+	sec := now.Truncate(time.Second)
+	if !c.second.Equal(sec) {
+		c.second, c.secondQueries = sec, 0
+	}
+
+	c.secondQueries++
+	if c.secondQueries <= limit {
+		return true
+	}
+
+	sus.Dropped++
+
+	return false
+}
+
+// remove removes the suspect entry of client.  ok is false if client isn't a
+// suspect.
+func (d *tunnelDetector) remove(client string) (ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok = d.suspects[client]
+	delete(d.suspects, client)
+	if c, has := d.clients[client]; has {
+		d.removeClientLocked(c)
+	}
+
+	return ok
+}
+
+// list returns the suspects at now sorted by the score in descending order.
+// The expired entries are removed.
+func (d *tunnelDetector) list(now time.Time) (suspects []*tunnelSuspect) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	maps.DeleteFunc(d.suspects, func(_ string, s *tunnelSuspect) (del bool) {
+		return now.Sub(s.LastDetected) >= tunnelSuspectTTL
+	})
+
+	suspects = make([]*tunnelSuspect, 0, len(d.suspects))
+	for _, s := range d.suspects {
+		sc := *s
+		suspects = append(suspects, &sc)
+	}
+
+	slices.SortFunc(suspects, func(a, b *tunnelSuspect) (sortsBefore bool) {
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+
+		return a.Client < b.Client
+	})
+
+	return suspects
+}
+
+// splitTunnelHost splits host into its base domain, that is the public suffix
+// plus one label, and the rest of the labels without the dots.  host must be
+// lowercased and have no trailing dot.
+func splitTunnelHost(host string) (base, sub string) {
+	base, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// host is a public suffix itself or a single-label name.
+		return host, ""
+	}
+
+	sub = strings.TrimSuffix(strings.TrimSuffix(host, base), ".")
+
+	return base, strings.ReplaceAll(sub, ".", "")
+}
+
+// shannonEntropy returns the Shannon entropy of the bytes of s in bits per
+// byte.
+func shannonEntropy(s string) (e float64) {
+	if s == "" {
+		return 0
+	}
+
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+
+	l := float64(len(s))
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+
+		p := float64(n) / l
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
+
+// processTunnelDetection scores the client on the request and reports the
+// clients newly suspected of DNS tunneling.  The requests of the suspects
+// exceeding [TunnelDetectionConfig.SuspectRatelimit] are refused.
+func (s *Server) processTunnelDetection(dctx *dnsContext) (rc resultCode) {
+	conf := s.conf.TunnelDetection
+	if !conf.Enabled {
+		return resultCodeSuccess
+	}
+
+	pctx := dctx.proxyCtx
+	client := dctx.clientID
+	if client == "" {
+		client = netutil.NetAddrToAddrPort(pctx.Addr).Addr().Unmap().String()
+	}
+
+	q := pctx.Req.Question[0]
+	host := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	now := time.Now()
+
+	sus, isNew := s.tunnels.observe(client, host, q.Qtype, conf.threshold(), now)
+	if isNew {
+		log.Info("dnsforward: client %q is suspected of dns tunneling via %q", client, sus.Domain)
+
+		if onSuspect := s.conf.OnTunnelSuspected; onSuspect != nil {
+			onSuspect(&TunnelSuspectEvent{
+				Client: client,
+				Domain: sus.Domain,
+				Score:  sus.Score,
+			})
+		}
+	}
+
+	if sus == nil || conf.SuspectRatelimit == 0 {
+		return resultCodeSuccess
+	}
+
+	if s.tunnels.allow(client, conf.SuspectRatelimit, now) {
+		return resultCodeSuccess
+	}
+
+	log.Debug("dnsforward: refusing request of tunneling suspect %q", client)
+
+	pctx.Res = s.makeResponseREFUSED(pctx.Req)
+
+	return resultCodeFinish
+}
+
+// tunnelsJSON is the response to the GET /control/security/tunnels HTTP API.
+type tunnelsJSON struct {
+	// Suspects are the clients suspected of DNS tunneling.
+	Suspects []*tunnelSuspect `json:"suspects"`
+
+	// ScoreThreshold is the score, starting from which a client is
+	// considered a suspect.
+	ScoreThreshold uint32 `json:"score_threshold"`
+
+	// SuspectRatelimit is the number of requests per second allowed for a
+	// suspect, zero if unlimited.
+	SuspectRatelimit uint32 `json:"suspect_ratelimit"`
+
+	// Enabled is true if the detection is enabled.
+	Enabled bool `json:"enabled"`
+}
+
+// handleTunnels is the handler for the GET /control/security/tunnels HTTP
+// API.
+func (s *Server) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	conf := s.conf.TunnelDetection
+	s.serverLock.RUnlock()
+
+	_ = aghhttp.WriteJSONResponse(w, r, &tunnelsJSON{
+		Suspects:         s.tunnels.list(time.Now()),
+		ScoreThreshold:   conf.threshold(),
+		SuspectRatelimit: conf.SuspectRatelimit,
+		Enabled:          conf.Enabled,
+	})
+}
+
+// tunnelForgetJSON is the request to the POST /control/security/tunnels/forget
+// HTTP API.
+type tunnelForgetJSON struct {
+	Client string `json:"client"`
+}
+
+// handleTunnelForget is the handler for the POST
+// /control/security/tunnels/forget HTTP API.  It removes a suspect, for
+// example a false positive, and lifts its rate limiting.
+func (s *Server) handleTunnelForget(w http.ResponseWriter, r *http.Request) {
+	req := &tunnelForgetJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	client, err := normalizeQuarantineClient(req.Client)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client: %s", err)
+
+		return
+	}
+
+	if !s.tunnels.remove(client) {
+		aghhttp.Error(r, w, http.StatusNotFound, "client %q is not a suspect", client)
+
+		return
+	}
+
+	log.Info("dnsforward: removed tunneling suspect %q", client)
+}
@@ -0,0 +1,197 @@
+package dnsforward
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want float64
+	}{{
+		name: "empty",
+		s:    "",
+		want: 0,
+	}, {
+		name: "same",
+		s:    "aaaa",
+		want: 0,
+	}, {
+		name: "two",
+		s:    "abab",
+		want: 1,
+	}, {
+		name: "four",
+		s:    "abcd",
+		want: 2,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.want, shannonEntropy(tc.s), 1e-9)
+		})
+	}
+}
+
+func TestSplitTunnelHost(t *testing.T) {
+	testCases := []struct {
+		name     string
+		host     string
+		wantBase string
+		wantSub  string
+	}{{
+		name:     "base",
+		host:     "example.com",
+		wantBase: "example.com",
+		wantSub:  "",
+	}, {
+		name:     "subdomains",
+		host:     "a1b2.c3d4.t.example.co.uk",
+		wantBase: "example.co.uk",
+		wantSub:  "a1b2c3d4t",
+	}, {
+		name:     "suffix",
+		host:     "com",
+		wantBase: "com",
+		wantSub:  "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base, sub := splitTunnelHost(tc.host)
+			assert.Equal(t, tc.wantBase, base)
+			assert.Equal(t, tc.wantSub, sub)
+		})
+	}
+}
+
+// tunnelName returns a name with the hex-encoded data in the subdomain of
+// tunnel.example, different for each i.
+func tunnelName(i int) (name string) {
+	sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+	data := hex.EncodeToString(sum[:])
+
+	return data[:32] + "." + data[32:] + ".tunnel.example"
+}
+
+func TestTunnelDetector(t *testing.T) {
+	const (
+		tunnelClient = "192.0.2.1"
+		benignClient = "192.0.2.2"
+	)
+
+	d := &tunnelDetector{}
+	now := time.Now()
+
+	var detected []*tunnelSuspect
+	for i := 0; i < tunnelRecordsRate; i++ {
+		sus, isNew := d.observe(tunnelClient, tunnelName(i), dns.TypeTXT, defaultTunnelScoreThreshold, now)
+		if isNew {
+			detected = append(detected, sus)
+		}
+
+		sus, _ = d.observe(benignClient, "www.example.com", dns.TypeA, defaultTunnelScoreThreshold, now)
+		require.Nil(t, sus)
+	}
+
+	require.Len(t, detected, 1)
+
+	sus := detected[0]
+	assert.Equal(t, tunnelClient, sus.Client)
+	assert.Equal(t, "tunnel.example", sus.Domain)
+	assert.Equal(t, 1.0, sus.EntropyScore)
+	assert.Equal(t, 1.0, sus.RecordsScore)
+	assert.GreaterOrEqual(t, sus.Score, uint32(defaultTunnelScoreThreshold))
+
+	list := d.list(now)
+	require.Len(t, list, 1)
+
+	assert.Equal(t, tunnelClient, list[0].Client)
+
+	t.Run("ratelimit", func(t *testing.T) {
+		const limit = 5
+
+		for i := 0; i < limit; i++ {
+			assert.True(t, d.allow(tunnelClient, limit, now))
+		}
+
+		assert.False(t, d.allow(tunnelClient, limit, now))
+		assert.True(t, d.allow(tunnelClient, limit, now.Add(time.Second)))
+		assert.True(t, d.allow(benignClient, 0, now))
+
+		assert.Equal(t, uint64(1), d.list(now)[0].Dropped)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		assert.Empty(t, d.list(now.Add(tunnelSuspectTTL)))
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		for i := 0; i < minTunnelQueries; i++ {
+			_, _ = d.observe(tunnelClient, tunnelName(i), dns.TypeNULL, defaultTunnelScoreThreshold, now)
+		}
+
+		assert.True(t, d.remove(tunnelClient))
+		assert.False(t, d.remove(benignClient))
+		assert.Empty(t, d.list(now))
+	})
+}
+
+func TestTunnelDetector_limits(t *testing.T) {
+	now := time.Now()
+
+	t.Run("domains", func(t *testing.T) {
+		const client = "192.0.2.1"
+
+		d := &tunnelDetector{}
+		for i := 0; i < maxTunnelClientDomains+10; i++ {
+			_, _ = d.observe(client, fmt.Sprintf("www.domain%d.example", i), dns.TypeA, maxTunnelScore, now)
+		}
+
+		const tunnelQueries = 20
+		for i := 0; i < tunnelQueries; i++ {
+			_, _ = d.observe(client, "www.tunnel.example", dns.TypeA, maxTunnelScore, now)
+		}
+
+		c := d.clients[client]
+		require.NotNil(t, c)
+
+		assert.Len(t, c.domains, maxTunnelClientDomains)
+		assert.Equal(t, uint32(maxTunnelClientDomains+10+tunnelQueries), c.queries)
+		assert.Equal(t, "tunnel.example", c.topDomain)
+
+		// The domain inherits the single query of the evicted one.
+		assert.Equal(t, uint32(tunnelQueries+1), c.top)
+	})
+
+	t.Run("clients", func(t *testing.T) {
+		d := &tunnelDetector{}
+		for i := 0; i < maxTunnelClients; i++ {
+			_, _ = d.observe(strconv.Itoa(i), "www.example.com", dns.TypeA, maxTunnelScore, now)
+		}
+
+		// Make the first client the most recently seen one.
+		later := now.Add(tunnelWindow / 2)
+		_, _ = d.observe("0", "www.example.com", dns.TypeA, maxTunnelScore, later)
+
+		_, _ = d.observe("new", "www.example.com", dns.TypeA, maxTunnelScore, later)
+		assert.NotContains(t, d.clients, "new")
+
+		_, _ = d.observe("new", "www.example.com", dns.TypeA, maxTunnelScore, now.Add(tunnelWindow))
+		assert.Contains(t, d.clients, "new")
+		assert.Contains(t, d.clients, "0")
+		assert.NotContains(t, d.clients, "1")
+		assert.Len(t, d.clients, maxTunnelClients)
+		assert.Equal(t, maxTunnelClients, d.lru.Len())
+	})
+}
@@ -0,0 +1,339 @@
+package dnsforward
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// Upstream Diagnostics
+
+// Error classes of the upstream test results.
+const (
+	upsErrClassBadFormat   = "bad_format"
+	upsErrClassBootstrap   = "bootstrap"
+	upsErrClassTimeout     = "timeout"
+	upsErrClassRefused     = "connection_refused"
+	upsErrClassTLS         = "tls"
+	upsErrClassNetwork     = "network"
+	upsErrClassBadResponse = "bad_response"
+	upsErrClassUnknown     = "unknown"
+)
+
+// errWrongResponse is returned by the health checks when the upstream responds
+// with an unexpected message.
+const errWrongResponse errors.Error = "wrong response"
+
+// upstreamCertJSON contains the details of the certificate of an encrypted
+// upstream.
+type upstreamCertJSON struct {
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names"`
+}
+
+// upstreamTestJSON is the result of testing a single upstream in the response
+// to the POST /control/test_upstream_dns HTTP API.
+type upstreamTestJSON struct {
+	// Certificate is the leaf certificate of the encrypted upstream, if the
+	// TLS handshake has succeeded.
+	Certificate *upstreamCertJSON `json:"certificate,omitempty"`
+
+	// Status is "OK" if the upstream works, and the error message otherwise.
+	// The messages of the non-critical errors start with "WARNING:".
+	Status string `json:"status"`
+
+	// ErrorClass is the class of the error, if any.
+	ErrorClass string `json:"error_class,omitempty"`
+
+	// Protocol is the protocol of the upstream, for example "udp" or "https".
+	Protocol string `json:"protocol,omitempty"`
+
+	// NegotiatedProtocol is the application protocol negotiated with the
+	// encrypted upstream using ALPN, if any, for example "h2" or "doq".
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+
+	// Addresses are the IP addresses of the upstream, if known.
+	Addresses []netip.Addr `json:"addresses,omitempty"`
+
+	// RTT is the duration of the test exchange in milliseconds.
+	RTT float64 `json:"rtt,omitempty"`
+}
+
+// testUpstream checks the upstream server defined by upstreamConfigStr using
+// healthCheck for actually exchange messages and returns the details of the
+// check.  It uses bootstrap to resolve the upstream's address.  res is never
+// nil.
+func testUpstream(
+	upstreamConfigStr string,
+	bootstrap []string,
+	timeout time.Duration,
+	healthCheck healthCheckFunc,
+) (res *upstreamTestJSON, err error) {
+	res = &upstreamTestJSON{}
+	if IsCommentOrEmpty(upstreamConfigStr) {
+		return res, nil
+	}
+
+	// Separate upstream from domains list.
+	upstreamAddr, domains, err := separateUpstream(upstreamConfigStr)
+	if err != nil {
+		res.ErrorClass = upsErrClassBadFormat
+
+		return res, fmt.Errorf("wrong upstream format: %w", err)
+	}
+
+	useDefault, err := validateUpstream(upstreamAddr, domains)
+	if err != nil {
+		res.ErrorClass = upsErrClassBadFormat
+
+		return res, fmt.Errorf("wrong upstream format: %w", err)
+	} else if useDefault {
+		return res, nil
+	}
+
+	if len(bootstrap) == 0 {
+		bootstrap = defaultBootstrap
+	}
+
+	log.Debug("dnsforward: checking if upstream %q works", upstreamAddr)
+
+	opts := &upstream.Options{
+		Bootstrap: bootstrap,
+		Timeout:   timeout,
+	}
+
+	res.Protocol, res.Addresses, err = resolveUpstream(upstreamAddr, bootstrap, timeout)
+	if err != nil {
+		res.ErrorClass = upsErrClassBootstrap
+
+		return res, fmt.Errorf("resolving upstream %q: %w", upstreamAddr, err)
+	}
+
+	for _, addr := range res.Addresses {
+		opts.ServerIPAddrs = append(opts.ServerIPAddrs, addr.AsSlice())
+	}
+
+	rec := &tlsStateRecorder{}
+	opts.VerifyConnection = rec.record
+
+	u, err := upstream.AddressToUpstream(upstreamAddr, opts)
+	if err != nil {
+		res.ErrorClass = upsErrClassBadFormat
+
+		return res, fmt.Errorf("failed to choose upstream for %q: %w", upstreamAddr, err)
+	}
+	defer func() { err = errors.WithDeferred(err, u.Close()) }()
+
+	start := time.Now()
+	err = healthCheck(u)
+	res.RTT = float64(time.Since(start)) / float64(time.Millisecond)
+	rec.fill(res)
+
+	if err != nil {
+		res.ErrorClass = upstreamErrClass(err)
+		err = fmt.Errorf("upstream %q fails to exchange: %w", upstreamAddr, err)
+		if domains != nil {
+			return res, domainSpecificTestError{error: err}
+		}
+
+		return res, err
+	}
+
+	log.Debug("dnsforward: upstream %q is ok", upstreamAddr)
+
+	return res, nil
+}
+
+// resolveUpstream returns the protocol of the upstream with the address addr
+// and its IP addresses.  The host names of encrypted upstreams are resolved
+// using bootstrap, and the ones of other upstreams aren't resolved.
+func resolveUpstream(
+	addr string,
+	bootstrap []string,
+	timeout time.Duration,
+) (proto string, addrs []netip.Addr, err error) {
+	proto, host := "udp", addr
+	if strings.Contains(addr, "://") {
+		var u *url.URL
+		u, err = url.Parse(addr)
+		if err != nil {
+			return "", nil, err
+		}
+
+		proto, host = u.Scheme, u.Hostname()
+	} else if h, _, splitErr := net.SplitHostPort(addr); splitErr == nil {
+		host = h
+	}
+
+	if proto == "sdns" {
+		// The addresses of the DNS stamps are encoded in the stamps.
+		return proto, nil, nil
+	}
+
+	if ip, parseErr := netip.ParseAddr(host); parseErr == nil {
+		return proto, []netip.Addr{ip}, nil
+	}
+
+	switch proto {
+	case "tls", "https", "h3", "quic":
+		addrs, err = lookupBootstrap(host, bootstrap, timeout)
+	default:
+		// Go on, since the plain DNS upstreams resolve their host names
+		// using the system resolver.
+	}
+
+	return proto, addrs, err
+}
+
+// lookupBootstrap resolves host using the first of the bootstrap servers that
+// responds.
+func lookupBootstrap(host string, bootstrap []string, timeout time.Duration) (addrs []netip.Addr, err error) {
+	var errs []error
+	for _, b := range bootstrap {
+		addrs, err = lookupWith(host, b, timeout)
+		if err == nil {
+			return addrs, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.List("all bootstrap servers failed", errs...)
+}
+
+// lookupWith resolves host using the bootstrap server b.
+func lookupWith(host, b string, timeout time.Duration) (addrs []netip.Addr, err error) {
+	r, err := upstream.NewResolver(b, &upstream.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("bootstrap %q: %w", b, err)
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ipAddrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("bootstrap %q: %w", b, err)
+	} else if len(ipAddrs) == 0 {
+		return nil, fmt.Errorf("bootstrap %q: no addresses for %q", b, host)
+	}
+
+	for _, ipAddr := range ipAddrs {
+		if ip, ok := netip.AddrFromSlice(ipAddr.IP); ok {
+			addrs = append(addrs, ip.Unmap())
+		}
+	}
+
+	return addrs, nil
+}
+
+// upstreamErrClass returns the class of the error returned by a health check.
+func upstreamErrClass(err error) (class string) {
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, errWrongResponse), errors.Is(err, dns.ErrId):
+		return upsErrClassBadResponse
+	case
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return upsErrClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return upsErrClassRefused
+	case isTLSErr(err):
+		return upsErrClassTLS
+	case errors.As(err, &opErr):
+		return upsErrClassNetwork
+	default:
+		return upsErrClassUnknown
+	}
+}
+
+// isTLSErr returns true if err is caused by the TLS handshake or the
+// verification of the certificate.
+func isTLSErr(err error) (ok bool) {
+	var (
+		authErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+		recHdrErr  tls.RecordHeaderError
+	)
+
+	if errors.As(err, &authErr) ||
+		errors.As(err, &hostErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &recHdrErr) {
+		return true
+	}
+
+	// TODO(a.garipov):  Use errors.As with [tls.AlertError] once the module
+	// requires Go 1.21.
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// tlsStateRecorder stores the state of the latest TLS connection to the
+// upstream.  It's safe for concurrent use.
+type tlsStateRecorder struct {
+	// mu protects state.
+	mu sync.Mutex
+
+	// state is the latest TLS connection state, if any.
+	state *tls.ConnectionState
+}
+
+// record stores state.  It's used as [tls.Config.VerifyConnection] and never
+// returns an error.
+func (r *tlsStateRecorder) record(state tls.ConnectionState) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = &state
+
+	return nil
+}
+
+// fill sets the TLS details of res from the recorded state, if any.
+func (r *tlsStateRecorder) fill(res *upstreamTestJSON) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == nil {
+		return
+	}
+
+	res.NegotiatedProtocol = r.state.NegotiatedProtocol
+	if len(r.state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert := r.state.PeerCertificates[0]
+	res.Certificate = &upstreamCertJSON{
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+	}
+}
@@ -0,0 +1,114 @@
+package dnsforward
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUpstream(t *testing.T) {
+	testCases := []struct {
+		name      string
+		addr      string
+		wantProto string
+		wantAddrs []netip.Addr
+	}{{
+		name:      "plain_ip",
+		addr:      "1.1.1.1",
+		wantProto: "udp",
+		wantAddrs: []netip.Addr{netip.MustParseAddr("1.1.1.1")},
+	}, {
+		name:      "plain_ip_port",
+		addr:      "[2606:4700:4700::1111]:53",
+		wantProto: "udp",
+		wantAddrs: []netip.Addr{netip.MustParseAddr("2606:4700:4700::1111")},
+	}, {
+		name:      "plain_hostname",
+		addr:      "tcp://dns.example:53",
+		wantProto: "tcp",
+		wantAddrs: nil,
+	}, {
+		name:      "doh_ip",
+		addr:      "https://1.1.1.1/dns-query",
+		wantProto: "https",
+		wantAddrs: []netip.Addr{netip.MustParseAddr("1.1.1.1")},
+	}, {
+		name:      "stamp",
+		addr:      "sdns://AAcAAAAAAAAABzEuMC4wLjE",
+		wantProto: "sdns",
+		wantAddrs: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proto, addrs, err := resolveUpstream(tc.addr, nil, 0)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantProto, proto)
+			assert.Equal(t, tc.wantAddrs, addrs)
+		})
+	}
+}
+
+func TestUpstreamErrClass(t *testing.T) {
+	testCases := []struct {
+		err  error
+		name string
+		want string
+	}{{
+		err:  fmt.Errorf("exchanging: %w", errWrongResponse),
+		name: "wrong_response",
+		want: upsErrClassBadResponse,
+	}, {
+		err:  fmt.Errorf("reading: %w", os.ErrDeadlineExceeded),
+		name: "deadline",
+		want: upsErrClassTimeout,
+	}, {
+		err:  context.DeadlineExceeded,
+		name: "context_deadline",
+		want: upsErrClassTimeout,
+	}, {
+		err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		},
+		name: "refused",
+		want: upsErrClassRefused,
+	}, {
+		err:  fmt.Errorf("handshake: %w", x509.UnknownAuthorityError{}),
+		name: "unknown_authority",
+		want: upsErrClassTLS,
+	}, {
+		err:  errors.Error("remote error: tls: handshake failure"),
+		name: "tls_alert",
+		want: upsErrClassTLS,
+	}, {
+		err: &net.OpError{
+			Op:  "read",
+			Net: "udp",
+			Err: errors.Error("network is unreachable"),
+		},
+		name: "network",
+		want: upsErrClassNetwork,
+	}, {
+		err:  errors.Error("something"),
+		name: "unknown",
+		want: upsErrClassUnknown,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, upstreamErrClass(tc.err))
+		})
+	}
+}
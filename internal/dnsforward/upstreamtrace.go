@@ -0,0 +1,576 @@
+package dnsforward
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Upstream Path Tracing
+
+// Names of the steps of an upstream trace.
+const (
+	traceStepBootstrap     = "bootstrap"
+	traceStepTCPConnect    = "tcp_connect"
+	traceStepTLSHandshake  = "tls_handshake"
+	traceStepQUICHandshake = "quic_handshake"
+	traceStepHTTPRequest   = "http_request"
+	traceStepDNSExchange   = "dns_exchange"
+)
+
+// traceSystemResolver is the target of the bootstrap step of a trace, in which
+// the host name of a plain DNS upstream is resolved by the system resolver.
+const traceSystemResolver = "system"
+
+// upstreamTraceStepJSON is the outcome of a single step of an upstream trace.
+type upstreamTraceStepJSON struct {
+	// Name is the name of the step.
+	Name string `json:"name"`
+
+	// Target is the address the step is performed with, for example the
+	// bootstrap server or the address of the upstream.
+	Target string `json:"target"`
+
+	// Error is the error of the step, if any.
+	Error string `json:"error,omitempty"`
+
+	// ErrorClass is the class of the error, if any.
+	ErrorClass string `json:"error_class,omitempty"`
+
+	// Addresses are the addresses resolved in the bootstrap step.
+	Addresses []netip.Addr `json:"addresses,omitempty"`
+
+	// Duration is the duration of the step in milliseconds.
+	Duration float64 `json:"duration_ms"`
+}
+
+// upstreamTraceJSON is the response of the POST /control/upstream/trace HTTP
+// API.
+type upstreamTraceJSON struct {
+	// Protocol is the protocol of the upstream, for example "udp" or "https".
+	Protocol string `json:"protocol"`
+
+	// TLSVersion is the version of the negotiated TLS protocol, if any.
+	TLSVersion string `json:"tls_version,omitempty"`
+
+	// CipherSuite is the name of the negotiated cipher suite, if any.
+	CipherSuite string `json:"cipher_suite,omitempty"`
+
+	// NegotiatedProtocol is the application protocol negotiated using ALPN,
+	// if any.
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+
+	// Certificates is the certificate chain presented by the upstream, leaf
+	// first.
+	Certificates []*upstreamCertJSON `json:"certificates,omitempty"`
+
+	// Steps are the outcomes of the steps of the trace in the order of their
+	// execution.  The trace stops at the first failed step, except for the
+	// bootstrap servers, which are tried in turn.
+	Steps []*upstreamTraceStepJSON `json:"steps"`
+
+	// HTTPStatus is the status code of the DNS-over-HTTPS response, if any.
+	HTTPStatus int `json:"http_status,omitempty"`
+
+	// OK is true if the upstream has exchanged the test message correctly.
+	OK bool `json:"ok"`
+}
+
+// runStep performs the step with name and target using f and records its
+// outcome in res.
+func (res *upstreamTraceJSON) runStep(
+	name string,
+	target string,
+	f func() (err error),
+) (st *upstreamTraceStepJSON, err error) {
+	start := time.Now()
+	err = f()
+	st = &upstreamTraceStepJSON{
+		Name:     name,
+		Target:   target,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+
+	if err != nil {
+		st.Error = err.Error()
+		st.ErrorClass = upstreamErrClass(err)
+	}
+
+	res.Steps = append(res.Steps, st)
+
+	return st, err
+}
+
+// setTLSState sets the TLS details of res from state.
+func (res *upstreamTraceJSON) setTLSState(state *tls.ConnectionState) {
+	res.TLSVersion = tlsVersionName(state.Version)
+	res.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	res.NegotiatedProtocol = state.NegotiatedProtocol
+
+	res.Certificates = make([]*upstreamCertJSON, 0, len(state.PeerCertificates))
+	for _, cert := range state.PeerCertificates {
+		res.Certificates = append(res.Certificates, &upstreamCertJSON{
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+		})
+	}
+}
+
+// tlsVersionName returns the name of the TLS version v.
+//
+// TODO(a.garipov):  Use [tls.VersionName] once the module requires Go 1.21.
+func tlsVersionName(v uint16) (name string) {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", v)
+	}
+}
+
+// upstreamTarget is the parsed address of an upstream.
+type upstreamTarget struct {
+	// proto is the protocol of the upstream, for example "udp" or "https".
+	proto string
+
+	// host is the host name or the IP address of the upstream.
+	host string
+
+	// port is the port of the upstream.
+	port string
+
+	// url is the URL of a DNS-over-HTTPS upstream.
+	url *url.URL
+}
+
+// defaultUpstreamPorts are the default ports of the upstreams by protocol.
+var defaultUpstreamPorts = map[string]string{
+	"udp":   "53",
+	"tcp":   "53",
+	"tls":   "853",
+	"quic":  "853",
+	"https": "443",
+	"h3":    "443",
+}
+
+// parseUpstreamTarget parses the upstream address addr for tracing.
+func parseUpstreamTarget(addr string) (t *upstreamTarget, err error) {
+	if !strings.Contains(addr, "://") {
+		addr = "udp://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, ok := defaultUpstreamPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol %q", u.Scheme)
+	} else if u.Hostname() == "" {
+		return nil, errors.Error("empty host")
+	}
+
+	if p := u.Port(); p != "" {
+		port = p
+	}
+
+	t = &upstreamTarget{
+		proto: u.Scheme,
+		host:  u.Hostname(),
+		port:  port,
+	}
+
+	if t.proto == "https" {
+		t.url = u
+	}
+
+	return t, nil
+}
+
+// upstreamTracer traces the path to the upstreams.
+type upstreamTracer struct {
+	// roots are the root certificates to verify the upstreams with.  If nil,
+	// the system ones are used.
+	roots *x509.CertPool
+
+	// bootstrap are the servers to resolve the host names of the encrypted
+	// upstreams.
+	bootstrap []string
+
+	// timeout is the timeout of each step.
+	timeout time.Duration
+}
+
+// trace connects to the upstream with the address upsStr step by step and
+// reports the outcome of each step.  err is only returned if upsStr isn't a
+// valid upstream.
+func (tr *upstreamTracer) trace(upsStr string) (res *upstreamTraceJSON, err error) {
+	upsAddr, _, err := separateUpstream(upsStr)
+	if err != nil {
+		return nil, err
+	} else if upsAddr == "#" {
+		return nil, errors.Error("nothing to trace for the default upstreams")
+	}
+
+	target, err := parseUpstreamTarget(upsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing upstream %q: %w", upsAddr, err)
+	}
+
+	res = &upstreamTraceJSON{
+		Protocol: target.proto,
+		Steps:    []*upstreamTraceStepJSON{},
+	}
+
+	addrs, ok := tr.resolve(res, target)
+	if !ok {
+		return res, nil
+	}
+
+	if !tr.connect(res, target, net.JoinHostPort(addrs[0].String(), target.port)) {
+		return res, nil
+	}
+
+	_, err = res.runStep(traceStepDNSExchange, upsAddr, func() (err error) {
+		return tr.exchange(upsAddr, target.host, addrs)
+	})
+	res.OK = err == nil
+
+	return res, nil
+}
+
+// resolve resolves the host of target, recording the bootstrap steps in res.
+// ok is false if the host couldn't be resolved.
+func (tr *upstreamTracer) resolve(
+	res *upstreamTraceJSON,
+	target *upstreamTarget,
+) (addrs []netip.Addr, ok bool) {
+	if ip, err := netip.ParseAddr(target.host); err == nil {
+		return []netip.Addr{ip}, true
+	}
+
+	if target.proto == "udp" || target.proto == "tcp" {
+		// The plain DNS upstreams resolve their host names using the system
+		// resolver.
+		st, err := res.runStep(traceStepBootstrap, traceSystemResolver, func() (err error) {
+			ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+			defer cancel()
+
+			addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", target.host)
+
+			return err
+		})
+		if err != nil {
+			st.ErrorClass = upsErrClassBootstrap
+
+			return nil, false
+		}
+
+		st.Addresses = addrs
+
+		return addrs, len(addrs) > 0
+	}
+
+	for _, b := range tr.bootstrap {
+		st, err := res.runStep(traceStepBootstrap, b, func() (err error) {
+			addrs, err = lookupWith(target.host, b, tr.timeout)
+
+			return err
+		})
+		if err == nil {
+			st.Addresses = addrs
+
+			return addrs, true
+		}
+
+		st.ErrorClass = upsErrClassBootstrap
+	}
+
+	return nil, false
+}
+
+// connect establishes the connection to the upstream target at addr and
+// records the steps in res.  ok is false if any of the steps has failed.
+func (tr *upstreamTracer) connect(
+	res *upstreamTraceJSON,
+	target *upstreamTarget,
+	addr string,
+) (ok bool) {
+	tlsConf := tr.tlsConfig(target.host, res)
+
+	switch target.proto {
+	case "quic", "h3":
+		tlsConf.NextProtos = []string{upstream.NextProtoDQ}
+		if target.proto == "h3" {
+			tlsConf.NextProtos = []string{http3.NextProtoH3}
+		}
+
+		_, err := res.runStep(traceStepQUICHandshake, addr, func() (err error) {
+			return tr.handshakeQUIC(addr, tlsConf)
+		})
+
+		return err == nil
+	case "udp":
+		// There is no connection to establish.
+		return true
+	default:
+		// Go on.
+	}
+
+	var conn net.Conn
+	_, err := res.runStep(traceStepTCPConnect, addr, func() (err error) {
+		conn, err = net.DialTimeout("tcp", addr, tr.timeout)
+
+		return err
+	})
+	if err != nil {
+		return false
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Debug("dnsforward: tracing upstream: closing conn: %s", closeErr)
+		}
+	}()
+
+	if target.proto == "tcp" {
+		return true
+	}
+
+	if target.proto == "https" {
+		tlsConf.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	_, err = res.runStep(traceStepTLSHandshake, addr, func() (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+		defer cancel()
+
+		return tls.Client(conn, tlsConf).HandshakeContext(ctx)
+	})
+	if err != nil {
+		return false
+	} else if target.proto != "https" {
+		return true
+	}
+
+	_, err = res.runStep(traceStepHTTPRequest, target.url.String(), func() (err error) {
+		res.HTTPStatus, err = tr.requestDoH(target.url, addr, tlsConf)
+
+		return err
+	})
+
+	return err == nil
+}
+
+// tlsConfig returns the TLS configuration for the handshakes with host, which
+// records the TLS details of the connection in res.  The certificates are
+// verified manually, so that the chain is reported even if it's invalid.
+func (tr *upstreamTracer) tlsConfig(host string, res *upstreamTraceJSON) (conf *tls.Config) {
+	return &tls.Config{
+		ServerName: host,
+		// The certificates are verified in VerifyConnection.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) (err error) {
+			res.setTLSState(&state)
+
+			return verifyPeerChain(state, host, tr.roots)
+		},
+	}
+}
+
+// verifyPeerChain verifies the certificate chain from state for host using
+// roots.  If roots is nil, the system ones are used.
+func verifyPeerChain(state tls.ConnectionState, host string, roots *x509.CertPool) (err error) {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return errors.Error("tls: no certificates")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err = certs[0].Verify(opts)
+
+	return err
+}
+
+// handshakeQUIC performs the QUIC handshake with addr and closes the
+// connection.
+func (tr *upstreamTracer) handshakeQUIC(addr string, tlsConf *tls.Config) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+
+	conn, err := quic.DialAddrContext(ctx, addr, tlsConf, &quic.Config{
+		HandshakeIdleTimeout: tr.timeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	return conn.CloseWithError(0, "")
+}
+
+// requestDoH sends the test DNS-over-HTTPS request to u using the address addr
+// and returns the status of the response.
+func (tr *upstreamTracer) requestDoH(
+	u *url.URL,
+	addr string,
+	tlsConf *tls.Config,
+) (status int, err error) {
+	req := (&dns.Msg{}).SetQuestion("test.", dns.TypeA)
+	req.Id = 0
+	data, err := req.Pack()
+	if err != nil {
+		return 0, fmt.Errorf("packing request: %w", err)
+	}
+
+	reqURL := *u
+	q := reqURL.Query()
+	q.Set("dns", base64.RawURLEncoding.EncodeToString(data))
+	reqURL.RawQuery = q.Encode()
+
+	dialer := &net.Dialer{}
+	cli := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (conn net.Conn, err error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:   tlsConf,
+			ForceAttemptHTTP2: true,
+		},
+		Timeout: tr.timeout,
+	}
+	defer cli.CloseIdleConnections()
+
+	httpReq, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+
+	httpReq.Header.Set("Accept", "application/dns-message")
+
+	resp, err := cli.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// exchange sends the test message to the upstream upsAddr with host at addrs.
+func (tr *upstreamTracer) exchange(upsAddr, host string, addrs []netip.Addr) (err error) {
+	opts := &upstream.Options{
+		Bootstrap: tr.bootstrap,
+		Timeout:   tr.timeout,
+		// The certificates are verified in VerifyConnection.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) (err error) {
+			return verifyPeerChain(state, host, tr.roots)
+		},
+	}
+
+	for _, addr := range addrs {
+		opts.ServerIPAddrs = append(opts.ServerIPAddrs, addr.AsSlice())
+	}
+
+	u, err := upstream.AddressToUpstream(upsAddr, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, u.Close()) }()
+
+	return checkDNSUpstreamExc(u)
+}
+
+// upstreamTraceReq is the request of the POST /control/upstream/trace HTTP
+// API.
+type upstreamTraceReq struct {
+	Upstream     string   `json:"upstream"`
+	BootstrapDNS []string `json:"bootstrap_dns"`
+}
+
+// handleUpstreamTrace is the handler for the POST /control/upstream/trace HTTP
+// API.
+func (s *Server) handleUpstreamTrace(w http.ResponseWriter, r *http.Request) {
+	req := &upstreamTraceReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	tr := &upstreamTracer{
+		roots:     s.conf.TLSv12Roots,
+		bootstrap: req.BootstrapDNS,
+		timeout:   s.conf.UpstreamTimeout,
+	}
+
+	if len(tr.bootstrap) == 0 {
+		tr.bootstrap = s.conf.BootstrapDNS
+	}
+
+	if len(tr.bootstrap) == 0 {
+		tr.bootstrap = defaultBootstrap
+	}
+
+	if tr.timeout <= 0 {
+		tr.timeout = DefaultTimeout
+	}
+
+	ups := strings.TrimSpace(req.Upstream)
+	log.Debug("dnsforward: tracing upstream %q", ups)
+
+	res, err := tr.trace(ups)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "upstream: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, res)
+}
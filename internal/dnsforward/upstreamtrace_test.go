@@ -0,0 +1,132 @@
+package dnsforward
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstreamTarget(t *testing.T) {
+	testCases := []struct {
+		want       *upstreamTarget
+		name       string
+		addr       string
+		wantErrMsg string
+	}{{
+		want:       &upstreamTarget{proto: "udp", host: "1.2.3.4", port: "53"},
+		name:       "plain",
+		addr:       "1.2.3.4",
+		wantErrMsg: "",
+	}, {
+		want:       &upstreamTarget{proto: "tcp", host: "dns.example", port: "5353"},
+		name:       "tcp_port",
+		addr:       "tcp://dns.example:5353",
+		wantErrMsg: "",
+	}, {
+		want:       &upstreamTarget{proto: "tls", host: "dns.example", port: "853"},
+		name:       "tls",
+		addr:       "tls://dns.example",
+		wantErrMsg: "",
+	}, {
+		want:       &upstreamTarget{proto: "quic", host: "2001:db8::1", port: "784"},
+		name:       "quic_ipv6",
+		addr:       "quic://[2001:db8::1]:784",
+		wantErrMsg: "",
+	}, {
+		want:       nil,
+		name:       "stamp",
+		addr:       "sdns://AAcAAAAAAAAAAAAHOS45LjkuOQA",
+		wantErrMsg: `unsupported protocol "sdns"`,
+	}, {
+		want:       nil,
+		name:       "empty_host",
+		addr:       "tls://",
+		wantErrMsg: "empty host",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseUpstreamTarget(tc.addr)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestUpstreamTracer_trace_https(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		require.NoError(t, err)
+
+		req := &dns.Msg{}
+		require.NoError(t, req.Unpack(data))
+
+		resp, err := (&dns.Msg{}).SetRcode(req, dns.RcodeNameError).Pack()
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	ups := "https://" + srv.Listener.Addr().String() + "/dns-query"
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	t.Run("ok", func(t *testing.T) {
+		tr := &upstreamTracer{
+			roots:   roots,
+			timeout: time.Second,
+		}
+
+		res, err := tr.trace(ups)
+		require.NoError(t, err)
+
+		names := make([]string, 0, len(res.Steps))
+		for _, st := range res.Steps {
+			assert.Empty(t, st.Error)
+			names = append(names, st.Name)
+		}
+
+		assert.Equal(t, []string{
+			traceStepTCPConnect,
+			traceStepTLSHandshake,
+			traceStepHTTPRequest,
+			traceStepDNSExchange,
+		}, names)
+
+		assert.True(t, res.OK)
+		assert.Equal(t, "https", res.Protocol)
+		assert.Equal(t, http.StatusOK, res.HTTPStatus)
+		assert.NotEmpty(t, res.Certificates)
+		assert.NotEmpty(t, res.TLSVersion)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		tr := &upstreamTracer{
+			roots:   x509.NewCertPool(),
+			timeout: time.Second,
+		}
+
+		res, err := tr.trace(ups)
+		require.NoError(t, err)
+		require.Len(t, res.Steps, 2)
+
+		st := res.Steps[1]
+		assert.Equal(t, traceStepTLSHandshake, st.Name)
+		assert.Equal(t, upsErrClassTLS, st.ErrorClass)
+
+		assert.False(t, res.OK)
+		assert.NotEmpty(t, res.Certificates)
+	})
+}
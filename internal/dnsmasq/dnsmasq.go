@@ -0,0 +1,415 @@
+// Package dnsmasq contains the parser of the dnsmasq configuration files.  It
+// only supports the directives, which have equivalents in AdGuard Home.
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// Config is the part of a dnsmasq configuration, which has equivalents in
+// AdGuard Home.
+type Config struct {
+	// Interface is the name of the first network interface from the interface
+	// directives, if any.
+	Interface string
+
+	// Upstreams are the upstream servers from the server directives in
+	// AdGuard Home's format, including the domain-specific ones.
+	Upstreams []string
+
+	// Addresses are the addresses from the address directives.
+	Addresses []*Address
+
+	// LocalDomains are the domains from the local directives and the server
+	// directives without an address.  The queries for them are only answered
+	// from the local data.
+	LocalDomains []string
+
+	// DHCPRange is the first DHCPv4 range from the dhcp-range directives.  It
+	// is nil if there are none.
+	DHCPRange *DHCPRange
+
+	// Router is the address of the router from the dhcp-option directives.
+	Router netip.Addr
+
+	// StaticLeases are the static DHCPv4 leases from the dhcp-host
+	// directives.
+	StaticLeases []*StaticLease
+
+	// Skipped are the lines, which couldn't be parsed or aren't supported,
+	// with their line numbers and the reason.
+	Skipped []string
+}
+
+// Address is the address to answer with for a set of domains and their
+// subdomains.
+type Address struct {
+	// Domains are the domains, to which the address applies.
+	Domains []string
+
+	// IP is the address.  It's invalid or unspecified if the domains are
+	// blocked.
+	IP netip.Addr
+}
+
+// Blocked returns true if the domains of a are blocked.
+func (a *Address) Blocked() (ok bool) {
+	return !a.IP.IsValid() || a.IP.IsUnspecified()
+}
+
+// DHCPRange is a DHCPv4 address range.
+type DHCPRange struct {
+	// Start is the first address of the range.
+	Start netip.Addr
+
+	// End is the last address of the range.
+	End netip.Addr
+
+	// SubnetMask is the subnet mask.  It's invalid, if not set.
+	SubnetMask netip.Addr
+
+	// LeaseDuration is the duration of the leases.  It's zero, if not set,
+	// and negative for the infinite leases.
+	LeaseDuration time.Duration
+}
+
+// StaticLease is a static DHCPv4 lease.
+type StaticLease struct {
+	// HWAddr is the hardware address of the client.
+	HWAddr net.HardwareAddr
+
+	// IP is the leased address.
+	IP netip.Addr
+
+	// Hostname is the hostname of the client, if any.
+	Hostname string
+}
+
+// Parse parses the dnsmasq configuration from r.  The unsupported and invalid
+// directives are recorded into c.Skipped.  err is only returned on reading
+// errors.
+func Parse(r io.Reader) (c *Config, err error) {
+	c = &Config{}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		err = c.parseLine(line)
+		if err != nil {
+			c.Skipped = append(c.Skipped, fmt.Sprintf("line %d: %q: %s", n, line, err))
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return c, nil
+}
+
+// parseLine parses a single directive.
+func (c *Config) parseLine(line string) (err error) {
+	name, val, _ := strings.Cut(line, "=")
+	name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+
+	switch name {
+	case "server", "local":
+		return c.parseServer(val)
+	case "address":
+		return c.parseAddress(val)
+	case "dhcp-range":
+		return c.parseDHCPRange(val)
+	case "dhcp-host":
+		return c.parseDHCPHost(val)
+	case "dhcp-option":
+		return c.parseDHCPOption(val)
+	case "interface":
+		if c.Interface == "" {
+			c.Interface = val
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported directive %q", name)
+	}
+}
+
+// splitDomains splits the value of a directive of the form
+// "/domain1/domain2/value" into the list of domains and the value.  domains
+// are nil if there are none.
+func splitDomains(val string) (domains []string, rest string, err error) {
+	if !strings.HasPrefix(val, "/") {
+		return nil, val, nil
+	}
+
+	i := strings.LastIndexByte(val, '/')
+	if i == 0 {
+		return nil, "", errors.Error("no closing slash")
+	}
+
+	domains = strings.Split(val[1:i], "/")
+	for _, d := range domains {
+		if d == "#" {
+			return nil, "", errors.Error("wildcard domains are not supported")
+		}
+
+		err = netutil.ValidateDomainName(d)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return domains, val[i+1:], nil
+}
+
+// parseServer parses the value of a server or local directive.
+func (c *Config) parseServer(val string) (err error) {
+	domains, addr, err := splitDomains(val)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case addr == "" && domains != nil:
+		c.LocalDomains = append(c.LocalDomains, domains...)
+
+		return nil
+	case addr == "":
+		return errors.Error("no address")
+	case addr == "#" && domains != nil:
+		// Use the default upstreams for the domains.
+		c.Upstreams = append(c.Upstreams, "[/"+strings.Join(domains, "/")+"/]#")
+
+		return nil
+	}
+
+	// Drop the source address and interface specifications.
+	addr, _, _ = strings.Cut(addr, "@")
+
+	host, portStr, hasPort := strings.Cut(addr, "#")
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	ups := ip.String()
+	if hasPort {
+		var port uint64
+		port, err = strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return fmt.Errorf("bad port: %w", err)
+		}
+
+		ups = netip.AddrPortFrom(ip, uint16(port)).String()
+	}
+
+	if domains != nil {
+		ups = "[/" + strings.Join(domains, "/") + "/]" + ups
+	}
+
+	c.Upstreams = append(c.Upstreams, ups)
+
+	return nil
+}
+
+// parseAddress parses the value of an address directive.
+func (c *Config) parseAddress(val string) (err error) {
+	domains, addr, err := splitDomains(val)
+	if err != nil {
+		return err
+	} else if domains == nil {
+		return errors.Error("no domains")
+	}
+
+	a := &Address{
+		Domains: domains,
+	}
+
+	// An empty address means NXDOMAIN and "#" means the unspecified address,
+	// both of which are blocking.
+	if addr != "" && addr != "#" {
+		a.IP, err = netip.ParseAddr(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Addresses = append(c.Addresses, a)
+
+	return nil
+}
+
+// isDHCPTag returns true if field is a tag or an interface specification of a
+// DHCP directive.
+func isDHCPTag(field string) (ok bool) {
+	for _, p := range []string{"tag:", "set:", "interface:", "id:", "tag!"} {
+		if strings.HasPrefix(field, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseLeaseDuration parses the lease time of a DHCP directive: a number of
+// seconds with an optional unit suffix or "infinite", in which case d is
+// negative.
+func parseLeaseDuration(s string) (d time.Duration, err error) {
+	if s == "infinite" {
+		return -1, nil
+	} else if s == "" {
+		return 0, errors.Error("empty lease time")
+	}
+
+	unit := time.Second
+	switch s[len(s)-1] {
+	case 's':
+		s = s[:len(s)-1]
+	case 'm':
+		unit, s = time.Minute, s[:len(s)-1]
+	case 'h':
+		unit, s = time.Hour, s[:len(s)-1]
+	case 'd':
+		unit, s = 24*time.Hour, s[:len(s)-1]
+	case 'w':
+		unit, s = 7*24*time.Hour, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad lease time: %w", err)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// parseDHCPRange parses the value of a dhcp-range directive.
+func (c *Config) parseDHCPRange(val string) (err error) {
+	var fields []string
+	for _, f := range strings.Split(val, ",") {
+		if f = strings.TrimSpace(f); !isDHCPTag(f) {
+			fields = append(fields, f)
+		}
+	}
+
+	if len(fields) < 2 {
+		return errors.Error("no range")
+	}
+
+	r := &DHCPRange{}
+	r.Start, err = netip.ParseAddr(fields[0])
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	} else if !r.Start.Is4() {
+		return errors.Error("only dhcpv4 ranges are supported")
+	}
+
+	r.End, err = netip.ParseAddr(fields[1])
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	} else if !r.End.Is4() {
+		return errors.Error("end: not an ipv4 address")
+	}
+
+	for _, f := range fields[2:] {
+		ip, ipErr := netip.ParseAddr(f)
+		switch {
+		case ipErr == nil && !r.SubnetMask.IsValid():
+			r.SubnetMask = ip
+		case ipErr == nil:
+			// The broadcast address is calculated by AdGuard Home.
+		default:
+			r.LeaseDuration, err = parseLeaseDuration(f)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.DHCPRange != nil {
+		return errors.Error("only one dhcp range is supported")
+	}
+
+	c.DHCPRange = r
+
+	return nil
+}
+
+// parseDHCPHost parses the value of a dhcp-host directive.
+func (c *Config) parseDHCPHost(val string) (err error) {
+	l := &StaticLease{}
+	for _, f := range strings.Split(val, ",") {
+		f = strings.TrimSpace(f)
+		if isDHCPTag(f) || f == "" {
+			continue
+		} else if f == "ignore" {
+			return errors.Error("ignored hosts are not supported")
+		}
+
+		if mac, macErr := net.ParseMAC(f); macErr == nil {
+			if l.HWAddr != nil {
+				return errors.Error("multiple hardware addresses are not supported")
+			}
+
+			l.HWAddr = mac
+		} else if ip, ipErr := netip.ParseAddr(f); ipErr == nil {
+			l.IP = ip
+		} else if _, durErr := parseLeaseDuration(f); durErr == nil {
+			// AdGuard Home's static leases don't expire.
+		} else if strings.HasPrefix(f, "[") {
+			return errors.Error("dhcpv6 hosts are not supported")
+		} else {
+			err = netutil.ValidateHostname(f)
+			if err != nil {
+				return err
+			}
+
+			l.Hostname = f
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.Is4() {
+		return errors.Error("only hosts with a hardware address and an ipv4 address are supported")
+	}
+
+	c.StaticLeases = append(c.StaticLeases, l)
+
+	return nil
+}
+
+// parseDHCPOption parses the value of a dhcp-option directive.  Only the
+// router option is supported.
+func (c *Config) parseDHCPOption(val string) (err error) {
+	var fields []string
+	for _, f := range strings.Split(val, ",") {
+		if f = strings.TrimSpace(f); !isDHCPTag(f) {
+			fields = append(fields, f)
+		}
+	}
+
+	if len(fields) != 2 || (fields[0] != "3" && fields[0] != "option:router") {
+		return errors.Error("only the router option is supported")
+	}
+
+	c.Router, err = netip.ParseAddr(fields[1])
+	if err != nil {
+		return fmt.Errorf("router: %w", err)
+	}
+
+	return nil
+}
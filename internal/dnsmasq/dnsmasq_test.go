@@ -0,0 +1,87 @@
+package dnsmasq_test
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	const conf = `# DNS.
+no-resolv
+server=1.1.1.1
+server=8.8.8.8#5353
+server=/lan/home.arpa/192.168.1.1
+server=2001:db8::1@eth0
+server=/corp.example/#
+server=/local/
+local=/home/
+address=/router.lan/192.168.1.1
+address=/ads.example/
+address=/tracker.example/#
+address=/#/127.0.0.1
+
+# DHCP.
+interface=eth0
+dhcp-range=set:lan,192.168.1.50,192.168.1.150,255.255.255.0,12h
+dhcp-range=192.168.2.50,192.168.2.150
+dhcp-range=::100,::1ff,constructor:eth0
+dhcp-option=option:router,192.168.1.1
+dhcp-option=6,192.168.1.2
+dhcp-host=aa:bb:cc:dd:ee:ff,192.168.1.10,nas,infinite
+dhcp-host=11:22:33:44:55:66,laptop
+dhcp-host=01:02:03:04:05:06,ignore
+`
+
+	c, err := dnsmasq.Parse(strings.NewReader(conf))
+	require.NoError(t, err)
+
+	assert.Equal(t, "eth0", c.Interface)
+	assert.Equal(t, []string{
+		"1.1.1.1",
+		"8.8.8.8:5353",
+		"[/lan/home.arpa/]192.168.1.1",
+		"2001:db8::1",
+		"[/corp.example/]#",
+	}, c.Upstreams)
+	assert.Equal(t, []string{"local", "home"}, c.LocalDomains)
+
+	require.Len(t, c.Addresses, 3)
+
+	assert.Equal(t, []string{"router.lan"}, c.Addresses[0].Domains)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.1"), c.Addresses[0].IP)
+	assert.False(t, c.Addresses[0].Blocked())
+	assert.True(t, c.Addresses[1].Blocked())
+	assert.True(t, c.Addresses[2].Blocked())
+
+	assert.Equal(t, &dnsmasq.DHCPRange{
+		Start:         netip.MustParseAddr("192.168.1.50"),
+		End:           netip.MustParseAddr("192.168.1.150"),
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		LeaseDuration: 12 * time.Hour,
+	}, c.DHCPRange)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.1"), c.Router)
+
+	assert.Equal(t, []*dnsmasq.StaticLease{{
+		HWAddr:   net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "nas",
+	}}, c.StaticLeases)
+
+	assert.Equal(t, []string{
+		`line 2: "no-resolv": unsupported directive "no-resolv"`,
+		`line 13: "address=/#/127.0.0.1": wildcard domains are not supported`,
+		`line 18: "dhcp-range=192.168.2.50,192.168.2.150": only one dhcp range is supported`,
+		`line 19: "dhcp-range=::100,::1ff,constructor:eth0": only dhcpv4 ranges are supported`,
+		`line 21: "dhcp-option=6,192.168.1.2": only the router option is supported`,
+		`line 23: "dhcp-host=11:22:33:44:55:66,laptop": only hosts with a hardware address ` +
+			`and an ipv4 address are supported`,
+		`line 24: "dhcp-host=01:02:03:04:05:06,ignore": ignored hosts are not supported`,
+	}, c.Skipped)
+}
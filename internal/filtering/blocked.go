@@ -105,11 +105,17 @@ func (d *DNSFilter) handleBlockedServicesSet(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	d.confLock.Lock()
-	d.Config.BlockedServices = list
-	d.confLock.Unlock()
+	d.SetBlockedServices(list)
 
 	log.Debug("Updated blocked services list: %d", len(list))
 
 	d.Config.ConfigModified()
 }
+
+// SetBlockedServices sets the IDs of the globally blocked services.
+func (d *DNSFilter) SetBlockedServices(ids []string) {
+	d.confLock.Lock()
+	defer d.confLock.Unlock()
+
+	d.Config.BlockedServices = ids
+}
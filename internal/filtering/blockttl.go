@@ -0,0 +1,115 @@
+package filtering
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Blocked Response TTL
+
+// ttlModifier is the name of the custom rule modifier, which sets the TTL of
+// the responses blocked by the rule, for example:
+//
+//	||example.org^$ttl=60
+const ttlModifier = "ttl"
+
+// blockedTTLs contains the TTLs of the blocked responses set for the filter
+// lists and the custom rules.
+type blockedTTLs struct {
+	// lists are the TTLs set for the filter lists by their IDs.
+	lists map[int64]uint32
+
+	// rules are the TTLs set for the custom rules by their texts with the
+	// modifier removed.
+	rules map[string]uint32
+}
+
+// cutTTLModifier removes the ttl modifier from the custom rule.  ok is false
+// if the rule has no valid ttl modifier, stripped is the rule itself then.
+func cutTTLModifier(rule string) (stripped string, ttl uint32, ok bool) {
+	i := strings.LastIndexByte(rule, '$')
+	if i == -1 || strings.HasPrefix(rule, "!") || strings.HasPrefix(rule, "#") {
+		return rule, 0, false
+	}
+
+	pattern, opts := rule[:i], strings.Split(rule[i+1:], ",")
+	rest := make([]string, 0, len(opts))
+	for _, opt := range opts {
+		name, val, found := strings.Cut(opt, "=")
+		if !found || strings.TrimSpace(name) != ttlModifier {
+			rest = append(rest, opt)
+
+			continue
+		}
+
+		v, err := strconv.ParseUint(strings.TrimSpace(val), 10, 32)
+		if err != nil || ok {
+			// Let the filtering engine report the invalid rule.
+			return rule, 0, false
+		}
+
+		ttl, ok = uint32(v), true
+	}
+
+	if !ok {
+		return rule, 0, false
+	}
+
+	if len(rest) == 0 {
+		return pattern, ttl, true
+	}
+
+	return pattern + "$" + strings.Join(rest, ","), ttl, true
+}
+
+// cutTTLModifiers removes the ttl modifiers from the custom rules.  ttls are
+// the TTLs by the texts of the stripped rules.
+func cutTTLModifiers(userRules []string) (stripped []string, ttls map[string]uint32) {
+	stripped = make([]string, 0, len(userRules))
+	ttls = map[string]uint32{}
+	for _, r := range userRules {
+		s, ttl, ok := cutTTLModifier(r)
+		if ok {
+			ttls[strings.TrimSpace(s)] = ttl
+		}
+
+		stripped = append(stripped, s)
+	}
+
+	return stripped, ttls
+}
+
+// BlockedResponseTTL returns the TTL of the response blocked according to res,
+// if it's set for the matched custom rule or the filter list.  ok is false if
+// the global setting should be used.
+func (d *DNSFilter) BlockedResponseTTL(res *Result) (ttl uint32, ok bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	d.engineLock.RLock()
+	defer d.engineLock.RUnlock()
+
+	for _, r := range res.Rules {
+		if r.FilterListID == CustomListID {
+			ttl, ok = d.blockedTTLs.rules[r.Text]
+		} else {
+			ttl, ok = d.blockedTTLs.lists[r.FilterListID]
+		}
+
+		if ok {
+			return ttl, true
+		}
+	}
+
+	return 0, false
+}
+
+// sameTTL returns true if a and b are both nil or point to the same value.
+func sameTTL(a, b *uint32) (ok bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,127 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCutTTLModifier(t *testing.T) {
+	testCases := []struct {
+		name      string
+		rule      string
+		wantRule  string
+		wantTTL   uint32
+		wantFound bool
+	}{{
+		name:      "only_ttl",
+		rule:      "||example.org^$ttl=60",
+		wantRule:  "||example.org^",
+		wantTTL:   60,
+		wantFound: true,
+	}, {
+		name:      "with_other",
+		rule:      "||example.org^$client=127.0.0.1,ttl=0,important",
+		wantRule:  "||example.org^$client=127.0.0.1,important",
+		wantTTL:   0,
+		wantFound: true,
+	}, {
+		name:      "no_ttl",
+		rule:      "||example.org^$important",
+		wantRule:  "||example.org^$important",
+		wantTTL:   0,
+		wantFound: false,
+	}, {
+		name:      "no_modifiers",
+		rule:      "||example.org^",
+		wantRule:  "||example.org^",
+		wantTTL:   0,
+		wantFound: false,
+	}, {
+		name:      "bad_ttl",
+		rule:      "||example.org^$ttl=-1",
+		wantRule:  "||example.org^$ttl=-1",
+		wantTTL:   0,
+		wantFound: false,
+	}, {
+		name:      "several_ttl",
+		rule:      "||example.org^$ttl=1,ttl=2",
+		wantRule:  "||example.org^$ttl=1,ttl=2",
+		wantTTL:   0,
+		wantFound: false,
+	}, {
+		name:      "comment",
+		rule:      "! ||example.org^$ttl=60",
+		wantRule:  "! ||example.org^$ttl=60",
+		wantTTL:   0,
+		wantFound: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ttl, ok := cutTTLModifier(tc.rule)
+			assert.Equal(t, tc.wantRule, rule)
+			assert.Equal(t, tc.wantTTL, ttl)
+			assert.Equal(t, tc.wantFound, ok)
+		})
+	}
+}
+
+func TestDNSFilter_BlockedResponseTTL(t *testing.T) {
+	const listID int64 = 1
+
+	listTTL := uint32(30)
+	f, setts := newForTest(t, &Config{
+		UserRules: []string{
+			"||rule-ttl.example^$ttl=5",
+			"||no-ttl.example^",
+		},
+		Filters: []FilterYAML{{
+			Enabled:            true,
+			BlockedResponseTTL: &listTTL,
+			Filter:             Filter{ID: listID},
+		}},
+	}, nil)
+	f.EnableFilters(false)
+
+	t.Run("rule", func(t *testing.T) {
+		res, err := f.CheckHost("rule-ttl.example", dns.TypeA, setts)
+		require.NoError(t, err)
+		require.True(t, res.IsFiltered)
+
+		ttl, ok := f.BlockedResponseTTL(&res)
+		require.True(t, ok)
+
+		assert.Equal(t, uint32(5), ttl)
+	})
+
+	t.Run("no_ttl", func(t *testing.T) {
+		res, err := f.CheckHost("no-ttl.example", dns.TypeA, setts)
+		require.NoError(t, err)
+		require.True(t, res.IsFiltered)
+
+		_, ok := f.BlockedResponseTTL(&res)
+		assert.False(t, ok)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		res := &Result{
+			Rules: []*ResultRule{{
+				Text:         "||list.example^",
+				FilterListID: listID,
+			}},
+		}
+
+		ttl, ok := f.BlockedResponseTTL(res)
+		require.True(t, ok)
+
+		assert.Equal(t, listTTL, ttl)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		_, ok := f.BlockedResponseTTL(nil)
+		assert.False(t, ok)
+	})
+}
@@ -3,6 +3,7 @@ package filtering
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -11,11 +12,14 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/mathutil"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"golang.org/x/exp/slices"
 )
@@ -41,6 +45,14 @@ type FilterYAML struct {
 	checksum    uint32    // checksum of the file data
 	white       bool
 
+	// BlockedResponseTTL, if not nil, is the TTL of the responses blocked by
+	// the rules of this list, which overrides the global setting.
+	BlockedResponseTTL *uint32 `yaml:"blocked_response_ttl,omitempty"`
+
+	// Format is the format of the list contents.  The threat intelligence
+	// feeds are converted into the blocking rules when downloaded.
+	Format FilterFormat `yaml:"format,omitempty"`
+
 	Filter `yaml:",inline"`
 }
 
@@ -99,18 +111,39 @@ func (d *DNSFilter) filterSetProperties(
 		filt.URL,
 	)
 
-	defer func(oldURL, oldName string, oldEnabled bool, oldUpdated time.Time, oldRulesCount int) {
+	defer func(
+		oldURL, oldName string,
+		oldEnabled bool,
+		oldUpdated time.Time,
+		oldRulesCount int,
+		oldTTL *uint32,
+		oldFormat FilterFormat,
+	) {
 		if err != nil {
 			filt.URL = oldURL
 			filt.Name = oldName
 			filt.Enabled = oldEnabled
 			filt.LastUpdated = oldUpdated
 			filt.RulesCount = oldRulesCount
+			filt.BlockedResponseTTL = oldTTL
+			filt.Format = oldFormat
 		}
-	}(filt.URL, filt.Name, filt.Enabled, filt.LastUpdated, filt.RulesCount)
+	}(
+		filt.URL,
+		filt.Name,
+		filt.Enabled,
+		filt.LastUpdated,
+		filt.RulesCount,
+		filt.BlockedResponseTTL,
+		filt.Format,
+	)
 
 	filt.Name = newList.Name
 
+	// Changing the TTL requires a restart, but not downloading the list.
+	ttlChanged := !sameTTL(filt.BlockedResponseTTL, newList.BlockedResponseTTL)
+	filt.BlockedResponseTTL = newList.BlockedResponseTTL
+
 	if filt.URL != newList.URL {
 		if d.filterExistsLocked(newList.URL) {
 			return false, errFilterExists
@@ -123,6 +156,15 @@ func (d *DNSFilter) filterSetProperties(
 		filt.unload()
 	}
 
+	if filt.Format != newList.Format {
+		// The contents must be downloaded and converted again.
+		shouldRestart = true
+
+		filt.Format = newList.Format
+		filt.LastUpdated = time.Time{}
+		filt.unload()
+	}
+
 	if filt.Enabled != newList.Enabled {
 		filt.Enabled = newList.Enabled
 		shouldRestart = true
@@ -142,7 +184,7 @@ func (d *DNSFilter) filterSetProperties(
 		filt.unload()
 	}
 
-	return shouldRestart, err
+	return shouldRestart || (ttlChanged && err == nil), err
 }
 
 // filterExists returns true if a filter with the same url exists in d.  It's
@@ -193,6 +235,65 @@ func (d *DNSFilter) filterAdd(flt FilterYAML) bool {
 	return true
 }
 
+// AddFilters adds the enabled block lists from flts with the URLs, which
+// haven't been added yet, and starts downloading them.  added is the number of
+// the lists added.
+func (d *DNSFilter) AddFilters(flts []FilterYAML) (added int) {
+	for _, flt := range flts {
+		flt.ID = assignUniqueFilterID()
+		flt.Enabled = true
+		flt.white = false
+		if d.filterAdd(flt) {
+			added++
+		}
+	}
+
+	if added == 0 {
+		return 0
+	}
+
+	d.ConfigModified()
+
+	go func() {
+		defer log.OnPanic("filtering: adding filters")
+
+		d.tryRefreshFilters(true, false, false)
+	}()
+
+	return added
+}
+
+// SetFilterLists replaces the blocking and the allowing filter lists with block
+// and allow, loads the contents of the enabled ones from the disk, and applies
+// them.  The lists are then refreshed in the background, so that the ones
+// without contents on the disk are downloaded.
+func (d *DNSFilter) SetFilterLists(block, allow []FilterYAML) {
+	block, allow = slices.Clone(block), slices.Clone(allow)
+
+	d.loadFilters(block)
+	d.loadFilters(allow)
+
+	block = deduplicateFilters(block)
+	allow = deduplicateFilters(allow)
+
+	updateUniqueFilterID(block)
+	updateUniqueFilterID(allow)
+
+	func() {
+		d.filtersMu.Lock()
+		defer d.filtersMu.Unlock()
+
+		d.Filters, d.WhitelistFilters = block, allow
+		d.enableFiltersLocked(true)
+	}()
+
+	go func() {
+		defer log.OnPanic("filtering: setting filters")
+
+		d.tryRefreshFilters(true, true, false)
+	}()
+}
+
 // Load filters from the disk
 // And if any filter has zero ID, assign a new one
 func (d *DNSFilter) loadFilters(array []FilterYAML) {
@@ -319,25 +420,13 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 }
 
 func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int, []FilterYAML, []bool, bool) {
-	var updateFlags []bool // 'true' if filter data has changed
-
 	updateFilters := d.listsToUpdate(filters, force)
 	if len(updateFilters) == 0 {
 		return 0, nil, nil, false
 	}
 
-	nfail := 0
-	for i := range updateFilters {
-		uf := &updateFilters[i]
-		updated, err := d.update(uf)
-		updateFlags = append(updateFlags, updated)
-		if err != nil {
-			nfail++
-			log.Printf("Failed to update filter %s: %s\n", uf.URL, err)
-			continue
-		}
-	}
-
+	// updateFlags are true if the data of the corresponding list has changed.
+	updateFlags, nfail := d.updateLists(updateFilters)
 	if nfail == len(updateFilters) {
 		return 0, nil, nil, true
 	}
@@ -371,6 +460,55 @@ func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int,
 	return updateCount, updateFilters, updateFlags, false
 }
 
+// updateLists downloads and parses lists concurrently using at most
+// d.FiltersUpdateWorkers workers.  updated are true for the lists, the data of
+// which has changed.  nfail is the number of lists that failed to update.
+func (d *DNSFilter) updateLists(lists []FilterYAML) (updated []bool, nfail int) {
+	updated = make([]bool, len(lists))
+	errs := make([]error, len(lists))
+
+	workersNum := mathutil.Min(mathutil.Max(int(d.FiltersUpdateWorkers), 1), len(lists))
+	idxCh := make(chan int)
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workersNum; w++ {
+		wg.Add(1)
+		go func() {
+			defer log.OnPanic("filtering: updating lists")
+			defer wg.Done()
+
+			// Each worker only accesses the elements with the received
+			// indexes, so there are no races.
+			for i := range idxCh {
+				updated[i], errs[i] = d.update(&lists[i])
+			}
+		}()
+	}
+
+	for i := range lists {
+		idxCh <- i
+	}
+
+	close(idxCh)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		nfail++
+
+		uf := &lists[i]
+		log.Printf("Failed to update filter %s: %s\n", uf.URL, err)
+		if d.OnFilterUpdateFailed != nil {
+			d.OnFilterUpdateFailed(uf.Name, uf.URL, err)
+		}
+	}
+
+	return updated, nfail
+}
+
 // refreshFiltersIntl checks filters and updates them if necessary.  If force is
 // true, it ignores the filter.LastUpdated field value.
 //
@@ -636,8 +774,25 @@ func (d *DNSFilter) updateIntl(flt *FilterYAML) (ok bool, err error) {
 
 	var rc io.ReadCloser
 	if !filepath.IsAbs(flt.URL) {
+		ctx := context.Background()
+		if timeout := d.FiltersUpdateTimeout.Duration; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, flt.URL, nil)
+		if err != nil {
+			return false, fmt.Errorf("creating request: %w", err)
+		}
+
+		if flt.Format == FilterFormatSTIX {
+			req.Header.Set(aghhttp.HdrNameAccept, taxiiAccept)
+		}
+
 		var resp *http.Response
-		resp, err = d.HTTPClient.Get(flt.URL)
+		resp, err = d.HTTPClient.Do(req)
 		if err != nil {
 			log.Printf("requesting filter from %s, skip: %s", flt.URL, err)
 
@@ -660,7 +815,15 @@ func (d *DNSFilter) updateIntl(flt *FilterYAML) (ok bool, err error) {
 		defer func() { err = errors.WithDeferred(err, rc.Close()) }()
 	}
 
-	rnum, n, cs, name, err = d.parseFilter(rc, tmpFile)
+	var src io.Reader = rc
+	if flt.Format.isThreatFeed() {
+		src, err = convertThreatFeed(flt.Format, rc)
+		if err != nil {
+			return false, fmt.Errorf("converting threat feed: %w", err)
+		}
+	}
+
+	rnum, n, cs, name, err = d.parseFilter(src, tmpFile)
 
 	return cs != flt.checksum && err == nil, err
 }
@@ -697,6 +860,15 @@ func (d *DNSFilter) load(flt *FilterYAML) (err error) {
 	return nil
 }
 
+// SetUserRules sets the user's filtering rules and applies them.
+func (d *DNSFilter) SetUserRules(rules []string) {
+	d.filtersMu.Lock()
+	defer d.filtersMu.Unlock()
+
+	d.UserRules = rules
+	d.enableFiltersLocked(true)
+}
+
 func (d *DNSFilter) EnableFilters(async bool) {
 	d.filtersMu.RLock()
 	defer d.filtersMu.RUnlock()
@@ -705,16 +877,22 @@ func (d *DNSFilter) EnableFilters(async bool) {
 }
 
 func (d *DNSFilter) enableFiltersLocked(async bool) {
+	userRules, ruleTTLs := cutTTLModifiers(d.UserRules)
 	filters := []Filter{{
 		ID:   CustomListID,
-		Data: []byte(strings.Join(d.UserRules, "\n")),
+		Data: []byte(strings.Join(userRules, "\n")),
 	}}
 
+	listTTLs := map[int64]uint32{}
 	for _, filter := range d.Filters {
 		if !filter.Enabled {
 			continue
 		}
 
+		if filter.BlockedResponseTTL != nil {
+			listTTLs[filter.ID] = *filter.BlockedResponseTTL
+		}
+
 		filters = append(filters, Filter{
 			ID:       filter.ID,
 			FilePath: filter.Path(d.DataDir),
@@ -733,6 +911,19 @@ func (d *DNSFilter) enableFiltersLocked(async bool) {
 		})
 	}
 
+	feeds := d.loadThreatFeeds(d.Filters)
+
+	func() {
+		d.engineLock.Lock()
+		defer d.engineLock.Unlock()
+
+		d.blockedTTLs = blockedTTLs{
+			lists: listTTLs,
+			rules: ruleTTLs,
+		}
+		d.threatFeeds = feeds
+	}()
+
 	if err := d.SetFilters(filters, allowFilters, async); err != nil {
 		log.Debug("enabling filters: %s", err)
 	}
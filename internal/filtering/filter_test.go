@@ -7,11 +7,13 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -120,3 +122,99 @@ func TestFilters(t *testing.T) {
 		f.unload()
 	})
 }
+
+func TestDNSFilter_updateLists(t *testing.T) {
+	const listsNum = 5
+
+	slowURL := serveHTTPLocally(t, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	lists := make([]FilterYAML, 0, listsNum+1)
+	for i := 0; i < listsNum; i++ {
+		lists = append(lists, FilterYAML{
+			URL: serveFiltersLocally(t, []byte("||example.org^\n")),
+			Filter: Filter{
+				ID: int64(i + 1),
+			},
+		})
+	}
+
+	lists = append(lists, FilterYAML{
+		URL:  slowURL,
+		Name: "slow",
+		Filter: Filter{
+			ID: listsNum + 1,
+		},
+	})
+
+	var failed []string
+	d, err := New(&Config{
+		DataDir: t.TempDir(),
+		HTTPClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		OnFilterUpdateFailed: func(name, _ string, _ error) {
+			failed = append(failed, name)
+		},
+		FiltersUpdateWorkers: 2,
+		FiltersUpdateTimeout: timeutil.Duration{Duration: 100 * time.Millisecond},
+	}, nil)
+	require.NoError(t, err)
+
+	updated, nfail := d.updateLists(lists)
+	require.Len(t, updated, len(lists))
+
+	assert.Equal(t, 1, nfail)
+	assert.Equal(t, []string{"slow"}, failed)
+
+	for i, ok := range updated[:listsNum] {
+		assert.True(t, ok)
+		assert.Equal(t, 1, lists[i].RulesCount)
+		assert.FileExists(t, lists[i].Path(d.DataDir))
+	}
+
+	assert.False(t, updated[listsNum])
+}
+
+func TestDNSFilter_listMemoryUsage(t *testing.T) {
+	const content = "||example.org^\n||example.com^\n"
+
+	d := &DNSFilter{
+		Config: Config{
+			DataDir: t.TempDir(),
+		},
+	}
+
+	err := os.MkdirAll(filepath.Join(d.DataDir, filterDir), 0o755)
+	require.NoError(t, err)
+
+	flt := &FilterYAML{
+		Enabled:    true,
+		RulesCount: 2,
+		Filter: Filter{
+			ID: 1,
+		},
+	}
+
+	size, usage := d.listMemoryUsage(flt)
+	assert.Zero(t, size)
+	assert.Zero(t, usage)
+
+	err = os.WriteFile(flt.Path(d.DataDir), []byte(content), 0o644)
+	require.NoError(t, err)
+
+	wantUsage := int64(2 * ruleIndexSize)
+	if runtime.GOOS == "windows" {
+		wantUsage += int64(len(content))
+	}
+
+	size, usage = d.listMemoryUsage(flt)
+	assert.Equal(t, int64(len(content)), size)
+	assert.Equal(t, wantUsage, usage)
+
+	flt.Enabled = false
+	size, usage = d.listMemoryUsage(flt)
+	assert.Equal(t, int64(len(content)), size)
+	assert.Zero(t, usage)
+}
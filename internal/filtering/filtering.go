@@ -19,11 +19,11 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/dnsproxy/upstream"
-	"github.com/AdguardTeam/golibs/cache"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/mathutil"
 	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -42,6 +42,7 @@ const (
 	ParentalListID
 	SafeBrowsingListID
 	SafeSearchListID
+	QueryHookListID
 )
 
 // ServiceEntry - blocked service array element
@@ -64,6 +65,10 @@ type Settings struct {
 	SafeBrowsingEnabled bool
 	ParentalEnabled     bool
 
+	// LocalDiscoveryPassthrough, if true, makes the local service discovery
+	// names, see [IsLocalDiscoveryName], bypass the blocking.
+	LocalDiscoveryPassthrough bool
+
 	// ClientSafeSearch is a client configured safe search.
 	ClientSafeSearch SafeSearch
 }
@@ -85,9 +90,27 @@ type Config struct {
 	FilteringEnabled           bool   `yaml:"filtering_enabled"`       // whether or not use filter lists
 	FiltersUpdateIntervalHours uint32 `yaml:"filters_update_interval"` // time period to update filters (in hours)
 
+	// FiltersUpdateWorkers is the number of filter lists downloaded and parsed
+	// concurrently during a refresh.  Zero is treated as one.
+	FiltersUpdateWorkers uint32 `yaml:"filters_update_workers"`
+
+	// FiltersUpdateTimeout is the timeout for downloading a single filter list.
+	// If zero, only the timeout of HTTPClient is used.
+	FiltersUpdateTimeout timeutil.Duration `yaml:"filters_update_timeout"`
+
+	// CompactRuleStorage, if true, makes the filter lists be mapped into the
+	// memory instead of being read on demand, and the rules, which several
+	// lists contain, be indexed only once.  See [compactRuleList].
+	CompactRuleStorage bool `yaml:"compact_rule_storage"`
+
 	ParentalEnabled     bool `yaml:"parental_enabled"`
 	SafeBrowsingEnabled bool `yaml:"safebrowsing_enabled"`
 
+	// LocalDiscoveryPassthrough, if true, makes the Multicast DNS and DNS-SD
+	// names bypass the blocking for all clients, unless overridden by the
+	// client's settings.
+	LocalDiscoveryPassthrough bool `yaml:"local_discovery_passthrough"`
+
 	SafeBrowsingCacheSize uint `yaml:"safebrowsing_cache_size"` // (in bytes)
 	SafeSearchCacheSize   uint `yaml:"safesearch_cache_size"`   // (in bytes)
 	ParentalCacheSize     uint `yaml:"parental_cache_size"`     // (in bytes)
@@ -97,12 +120,20 @@ type Config struct {
 	SafeSearchConf SafeSearchConfig `yaml:"safe_search"`
 	SafeSearch     SafeSearch       `yaml:"-"`
 
+	// Lookalike is the configuration of the detection of the domain names,
+	// which look like the protected ones.
+	Lookalike LookalikeConfig `yaml:"lookalike"`
+
 	Rewrites []*LegacyRewrite `yaml:"rewrites"`
 
 	// Names of services to block (globally).
 	// Per-client settings can override this configuration.
 	BlockedServices []string `yaml:"blocked_services"`
 
+	// RuleRequests are the pending requests to block or unblock domains, which
+	// wait for the approval of an admin.
+	RuleRequests []*RuleRequest `yaml:"rule_requests"`
+
 	// EtcHosts is a container of IP-hostname pairs taken from the operating
 	// system configuration files (e.g. /etc/hosts).
 	EtcHosts *aghnet.HostsContainer `yaml:"-"`
@@ -113,6 +144,14 @@ type Config struct {
 	// Register an HTTP handler
 	HTTPRegister aghhttp.RegisterFunc `yaml:"-"`
 
+	// OnFilterUpdateFailed, if not nil, is called when a filter list cannot be
+	// updated.
+	OnFilterUpdateFailed func(name, url string, err error) `yaml:"-"`
+
+	// OnRuleRequest, if not nil, is called when a new rule change request is
+	// submitted.
+	OnRuleRequest func(req *RuleRequest) `yaml:"-"`
+
 	// HTTPClient is the client to use for updating the remote filters.
 	HTTPClient *http.Client `yaml:"-"`
 
@@ -168,13 +207,21 @@ type DNSFilter struct {
 
 	engineLock sync.RWMutex
 
+	// blockedTTLs are the TTLs of the blocked responses set for the filter
+	// lists and the custom rules.  It's protected by engineLock.
+	blockedTTLs blockedTTLs
+
+	// threatFeeds are the enabled threat intelligence feeds by the IDs of
+	// their filter lists.  It's protected by engineLock.
+	threatFeeds map[int64]*threatFeed
+
 	parentalServer       string // access via methods
 	safeBrowsingServer   string // access via methods
 	parentalUpstream     upstream.Upstream
 	safeBrowsingUpstream upstream.Upstream
 
-	safebrowsingCache cache.Cache
-	parentalCache     cache.Cache
+	safebrowsingCache *hashCache
+	parentalCache     *hashCache
 
 	Config // for direct access by library users, even a = assignment
 	// confLock protects Config.
@@ -194,6 +241,10 @@ type DNSFilter struct {
 
 	safeSearch   SafeSearch
 	hostCheckers []hostChecker
+
+	// lookalikeTargets are the prepared protected domain names of
+	// Config.Lookalike.  It's protected by confLock.
+	lookalikeTargets []*lookalikeTarget
 }
 
 // Filter represents a filter list
@@ -252,6 +303,10 @@ const (
 	//
 	// See https://github.com/AdguardTeam/AdGuardHome/issues/2499.
 	RewrittenRule
+
+	// FilteredLookalike is returned when the host looks like one of the
+	// protected domains and the lookalike domains are blocked.
+	FilteredLookalike
 )
 
 // TODO(a.garipov): Resync with actual code names or replace completely
@@ -271,6 +326,8 @@ var reasonNames = []string{
 	Rewritten:          "Rewrite",
 	RewrittenAutoHosts: "RewriteEtcHosts",
 	RewrittenRule:      "RewriteRule",
+
+	FilteredLookalike: "FilteredLookalike",
 }
 
 func (r Reason) String() string {
@@ -299,6 +356,8 @@ func (d *DNSFilter) GetConfig() (s Settings) {
 		SafeSearchEnabled:   d.Config.SafeSearchConf.Enabled,
 		SafeBrowsingEnabled: d.Config.SafeBrowsingEnabled,
 		ParentalEnabled:     d.Config.ParentalEnabled,
+
+		LocalDiscoveryPassthrough: d.Config.LocalDiscoveryPassthrough,
 	}
 }
 
@@ -310,6 +369,7 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 
 		*c = d.Config
 		c.Rewrites = cloneRewrites(c.Rewrites)
+		c.RuleRequests = slices.Clone(c.RuleRequests)
 	}()
 
 	d.filtersMu.RLock()
@@ -320,6 +380,23 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 	c.UserRules = slices.Clone(d.UserRules)
 }
 
+// SetRewrites normalizes and sets the legacy rewrites.
+func (d *DNSFilter) SetRewrites(rws []*LegacyRewrite) (err error) {
+	for i, rw := range rws {
+		err = rw.normalize()
+		if err != nil {
+			return fmt.Errorf("rewrite at index %d: %w", i, err)
+		}
+	}
+
+	d.confLock.Lock()
+	defer d.confLock.Unlock()
+
+	d.Config.Rewrites = rws
+
+	return nil
+}
+
 // cloneRewrites returns a deep copy of entries.
 func cloneRewrites(entries []*LegacyRewrite) (clone []*LegacyRewrite) {
 	clone = make([]*LegacyRewrite, len(entries))
@@ -389,6 +466,14 @@ func (d *DNSFilter) Close() {
 	defer d.engineLock.Unlock()
 
 	d.reset()
+
+	if err := d.safebrowsingCache.save(); err != nil {
+		log.Error("filtering: saving safe browsing cache: %s", err)
+	}
+
+	if err := d.parentalCache.save(); err != nil {
+		log.Error("filtering: saving parental cache: %s", err)
+	}
 }
 
 func (d *DNSFilter) reset() {
@@ -442,6 +527,14 @@ type Result struct {
 	// Rules are applied rules.  If Rules are not empty, each rule is not nil.
 	Rules []*ResultRule `json:",omitempty"`
 
+	// Lookalike is the result of the detection of the lookalike domain names.
+	// It's nil unless the host looks like one of the protected domains.
+	Lookalike *LookalikeMatch `json:",omitempty"`
+
+	// Threat is the matched threat intelligence feed indicator.  It's nil
+	// unless the request is blocked by a threat intelligence feed.
+	Threat *ThreatMatch `json:",omitempty"`
+
 	// Reason is the reason for blocking or unblocking the request.
 	Reason Reason `json:",omitempty"`
 
@@ -482,6 +575,12 @@ func (d *DNSFilter) CheckHost(
 		}
 	}
 
+	if setts.LocalDiscoveryPassthrough && IsLocalDiscoveryName(host) {
+		// Never block the local service discovery names, but still resolve
+		// them using the system hosts files.
+		return d.matchSysHosts(host, qtype, setts)
+	}
+
 	for _, hc := range d.hostCheckers {
 		res, err = hc.check(host, qtype, setts)
 		if err != nil {
@@ -493,6 +592,10 @@ func (d *DNSFilter) CheckHost(
 		}
 	}
 
+	if setts.FilteringEnabled {
+		return d.checkLookalike(host), nil
+	}
+
 	return Result{}, nil
 }
 
@@ -659,7 +762,68 @@ func matchBlockedServicesRules(
 // Adding rule and matching against the rules
 //
 
-func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
+// ruleIndexSize is the estimated size of the in-memory index of a single rule in
+// bytes.  The engines of urlfilter index each rule by the hash of its hostname
+// or shortcut, which takes a map entry and the index of the rule within the
+// storage.
+const ruleIndexSize = 48
+
+// listMemoryUsage returns the size of the contents of the list flt and the
+// estimated size of the memory used by it in bytes.  Only the indexes of the
+// rules are counted, unless the contents are kept in memory too, see
+// [newRuleStorage].  The rules, which aren't indexed, since other lists contain
+// them as well, aren't counted.  The usage is zero for the disabled lists,
+// since those aren't loaded.  flt must not be nil.
+func (d *DNSFilter) listMemoryUsage(flt *FilterYAML) (size, usage int64) {
+	fi, err := os.Stat(flt.Path(d.DataDir))
+	if err != nil {
+		// The list hasn't been downloaded yet.
+		return 0, 0
+	}
+
+	size = fi.Size()
+	if !flt.Enabled {
+		return size, 0
+	}
+
+	indexed := int64(flt.RulesCount) - int64(d.duplicateRules(flt.ID))
+	usage = mathutil.Max(indexed, 0) * ruleIndexSize
+	if runtime.GOOS == "windows" {
+		usage += size
+	}
+
+	return size, usage
+}
+
+// duplicateRules returns the number of the rules of the compact rule list with
+// id, which other lists contain as well and which thus aren't indexed.
+func (d *DNSFilter) duplicateRules(id int64) (n uint32) {
+	d.engineLock.RLock()
+	defer d.engineLock.RUnlock()
+
+	for _, rs := range []*filterlist.RuleStorage{d.rulesStorage, d.rulesStorageAllow} {
+		if rs == nil {
+			continue
+		}
+
+		for _, l := range rs.Lists {
+			if cl, ok := l.(*compactRuleList); ok && int64(cl.id) == id {
+				return cl.duplicates.Load()
+			}
+		}
+	}
+
+	return 0
+}
+
+// newRuleStorage returns a new rule storage for filters.  The lists are read
+// from the files on demand everywhere except Windows, so only their indexes are
+// kept in memory.  If owners isn't nil, the lists are compact ones, see
+// [compactRuleList], the rules of which are interned with owners.
+func newRuleStorage(
+	filters []Filter,
+	owners *ruleOwners,
+) (rs *filterlist.RuleStorage, err error) {
 	lists := make([]filterlist.RuleList, 0, len(filters))
 	for _, f := range filters {
 		switch id := int(f.ID); {
@@ -671,6 +835,16 @@ func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
 			})
 		case f.FilePath == "":
 			continue
+		case owners != nil:
+			var list *compactRuleList
+			list, err = newCompactRuleList(id, f.FilePath, owners)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("creating compact rule list with %q: %w", f.FilePath, err)
+			}
+
+			lists = append(lists, list)
 		case runtime.GOOS == "windows":
 			// On Windows we don't pass a file to urlfilter because it's
 			// difficult to update this file while it's being used.
@@ -710,12 +884,19 @@ func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
 
 // Initialize urlfilter objects.
 func (d *DNSFilter) initFiltering(allowFilters, blockFilters []Filter) error {
-	rulesStorage, err := newRuleStorage(blockFilters)
+	// Intern the rules of the blocklists and the allowlists separately, since
+	// the same rule means different things in those.
+	var owners, ownersAllow *ruleOwners
+	if d.CompactRuleStorage {
+		owners, ownersAllow = newRuleOwners(), newRuleOwners()
+	}
+
+	rulesStorage, err := newRuleStorage(blockFilters, owners)
 	if err != nil {
 		return err
 	}
 
-	rulesStorageAllow, err := newRuleStorage(allowFilters)
+	rulesStorageAllow, err := newRuleStorage(allowFilters, ownersAllow)
 	if err != nil {
 		return err
 	}
@@ -723,6 +904,11 @@ func (d *DNSFilter) initFiltering(allowFilters, blockFilters []Filter) error {
 	filteringEngine := urlfilter.NewDNSEngine(rulesStorage)
 	filteringEngineAllow := urlfilter.NewDNSEngine(rulesStorageAllow)
 
+	// The engines have scanned the storages, so the interned rules aren't
+	// needed anymore.
+	owners.release()
+	ownersAllow.release()
+
 	func() {
 		d.engineLock.Lock()
 		defer d.engineLock.Unlock()
@@ -882,6 +1068,10 @@ func (d *DNSFilter) matchHost(
 	}
 
 	res = d.matchHostProcessDNSResult(rrtype, dnsres)
+	if res.Reason == FilteredBlockList {
+		res.Threat = d.threatMatch(res.Rules)
+	}
+
 	for _, r := range res.Rules {
 		log.Debug(
 			"filtering: found rule %q for host %q, filter list id: %d",
@@ -916,12 +1106,16 @@ func (d *DNSFilter) processDNSResultRewrites(
 
 // makeResult returns a properly constructed Result.
 func makeResult(matchedRules []rules.Rule, reason Reason) (res Result) {
+	// Allocate all the rules at once, since this is done for each filtered
+	// request.
+	ruleVals := make([]ResultRule, len(matchedRules))
 	resRules := make([]*ResultRule, len(matchedRules))
 	for i, mr := range matchedRules {
-		resRules[i] = &ResultRule{
+		ruleVals[i] = ResultRule{
 			FilterListID: int64(mr.GetFilterListID()),
 			Text:         mr.Text(),
 		}
+		resRules[i] = &ruleVals[i]
 	}
 
 	return Result{
@@ -944,14 +1138,10 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		filterTitleRegexp: regexp.MustCompile(`^! Title: +(.*)$`),
 	}
 
-	d.safebrowsingCache = cache.New(cache.Config{
-		EnableLRU: true,
-		MaxSize:   c.SafeBrowsingCacheSize,
-	})
-	d.parentalCache = cache.New(cache.Config{
-		EnableLRU: true,
-		MaxSize:   c.ParentalCacheSize,
-	})
+	d.safebrowsingCache = newHashCache(c.SafeBrowsingCacheSize, cacheFilePath(c.DataDir, safeBrowsingCacheFile))
+	d.parentalCache = newHashCache(c.ParentalCacheSize, cacheFilePath(c.DataDir, parentalCacheFile))
+	loadHashCache(d.safebrowsingCache, "safe browsing")
+	loadHashCache(d.parentalCache, "parental")
 
 	d.safeSearch = c.SafeSearch
 
@@ -990,6 +1180,21 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("rewrites: preparing: %s", err)
 	}
 
+	err = d.setLookalikeConfig(d.Lookalike)
+	if err != nil {
+		return nil, fmt.Errorf("lookalike: %w", err)
+	}
+
+	err = validateFilterFormats(d.Filters, d.WhitelistFilters)
+	if err != nil {
+		return nil, fmt.Errorf("filters: %w", err)
+	}
+
+	err = validateRuleRequests(d.RuleRequests)
+	if err != nil {
+		return nil, fmt.Errorf("rule_requests: %w", err)
+	}
+
 	bsvcs := []string{}
 	for _, s := range d.BlockedServices {
 		if !BlockedSvcKnown(s) {
@@ -693,3 +693,59 @@ func BenchmarkSafeBrowsingParallel(b *testing.B) {
 		}
 	})
 }
+
+var resultSink Result
+
+func BenchmarkDNSFilter_CheckHost(b *testing.B) {
+	const rulesNum = 10_000
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < rulesNum; i++ {
+		_, _ = fmt.Fprintf(buf, "||blocked-%d.example^\n", i)
+		_, _ = fmt.Fprintf(buf, "0.0.0.0 host-%d.example\n", i)
+	}
+
+	_, _ = buf.WriteString("@@||allowed.example^\n")
+
+	filters := []Filter{{ID: 0, Data: buf.Bytes()}}
+	d, setts := newForTest(b, nil, filters)
+	b.Cleanup(d.Close)
+
+	testCases := []struct {
+		name     string
+		host     string
+		wantFilt bool
+	}{{
+		name:     "network_rule",
+		host:     "blocked-5000.example",
+		wantFilt: true,
+	}, {
+		name:     "host_rule",
+		host:     "host-5000.example",
+		wantFilt: true,
+	}, {
+		name:     "allowlist",
+		host:     "allowed.example",
+		wantFilt: false,
+	}, {
+		name:     "not_found",
+		host:     "www.not-blocked.example",
+		wantFilt: false,
+	}}
+
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			var err error
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resultSink, err = d.CheckHost(tc.host, dns.TypeA, setts)
+			}
+
+			require.NoError(b, err)
+
+			assert.Equal(b, tc.wantFilt, resultSink.IsFiltered)
+		})
+	}
+}
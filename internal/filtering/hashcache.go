@@ -0,0 +1,218 @@
+package filtering
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/maybe"
+	"golang.org/x/exp/slices"
+)
+
+// Hash Cache
+
+// File names of the persisted safe browsing and parental control caches
+// within the data directory.
+const (
+	safeBrowsingCacheFile = "safebrowsing_cache.bin"
+	parentalCacheFile     = "parental_cache.bin"
+)
+
+// hashPrefixLen is the length of the hash prefixes used as keys of the cache.
+const hashPrefixLen = 2
+
+// hashCache is the cache of the hashes received from the safe browsing or the
+// parental control service.  The keys are the hash prefixes and the values are
+// the expiration time followed by the hashes, see [sbCtx.setCache].  It also
+// counts the hits, misses, and evictions.
+type hashCache struct {
+	cache.Cache
+
+	// hits is the number of the prefixes found in the cache.
+	hits atomic.Uint64
+
+	// misses is the number of the prefixes not found in the cache or expired.
+	misses atomic.Uint64
+
+	// evictions is the number of the entries removed from the cache to free
+	// space for the new ones.
+	evictions atomic.Uint64
+
+	// filePath is the path to the file the cache is persisted in.  If empty,
+	// the cache isn't persisted.
+	filePath string
+
+	// maxSize is the maximum size of the cache in bytes.  Zero means no limit.
+	maxSize uint
+}
+
+// newHashCache returns a new LRU hash cache of at most maxSize bytes persisted
+// in filePath, if it's not empty.
+func newHashCache(maxSize uint, filePath string) (c *hashCache) {
+	c = &hashCache{
+		filePath: filePath,
+		maxSize:  maxSize,
+	}
+
+	c.Cache = cache.New(cache.Config{
+		OnDelete: func(_, _ []byte) {
+			c.evictions.Add(1)
+		},
+		MaxSize:   maxSize,
+		EnableLRU: true,
+	})
+
+	return c
+}
+
+// countLookup updates the hit and miss counters according to found.
+func (c *hashCache) countLookup(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// cacheStatsJSON is the JSON representation of the hash cache statistics.
+type cacheStatsJSON struct {
+	// Size is the current size of the cache in bytes.
+	Size int `json:"size"`
+
+	// MaxSize is the maximum size of the cache in bytes, zero means no limit.
+	MaxSize uint `json:"max_size"`
+
+	// Count is the number of the entries in the cache.
+	Count int `json:"count"`
+
+	// Hits is the number of the hash prefixes found in the cache.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of the hash prefixes not found in the cache.
+	Misses uint64 `json:"misses"`
+
+	// Evictions is the number of the entries evicted from the cache.
+	Evictions uint64 `json:"evictions"`
+}
+
+// stats returns the current statistics of the cache.
+func (c *hashCache) stats() (s *cacheStatsJSON) {
+	cs := c.Stats()
+
+	return &cacheStatsJSON{
+		Size:      cs.Size,
+		MaxSize:   c.maxSize,
+		Count:     cs.Count,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// save writes the unexpired entries of the cache into the file.  The file
+// consists of the records of the key, the 4-byte big-endian length of the
+// value, and the value.
+func (c *hashCache) save() (err error) {
+	if c.filePath == "" {
+		return nil
+	}
+
+	now := uint32(time.Now().Unix())
+	buf := &bytes.Buffer{}
+	key := make([]byte, hashPrefixLen)
+	// Since the keys are two-byte prefixes, iterate over all of them instead
+	// of tracking the keys.
+	for i := 0; i <= 0xffff; i++ {
+		binary.BigEndian.PutUint16(key, uint16(i))
+		val := c.Get(key)
+		if len(val) < 4 || binary.BigEndian.Uint32(val) <= now {
+			continue
+		}
+
+		buf.Write(key)
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(val)))
+		buf.Write(val)
+	}
+
+	err = maybe.WriteFile(c.filePath, buf.Bytes(), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+
+	return nil
+}
+
+// load fills the cache with the unexpired entries from the file, if it exists.
+// n is the number of the loaded entries.
+func (c *hashCache) load() (n int, err error) {
+	if c.filePath == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("reading cache file: %w", err)
+	}
+
+	now := uint32(time.Now().Unix())
+	for len(data) > 0 {
+		const hdrLen = hashPrefixLen + 4
+		if len(data) < hdrLen {
+			return n, fmt.Errorf("record %d: bad header length %d", n, len(data))
+		}
+
+		key := data[:hashPrefixLen]
+		valLen := int(binary.BigEndian.Uint32(data[hashPrefixLen:hdrLen]))
+		data = data[hdrLen:]
+		if valLen < 4 || len(data) < valLen {
+			return n, fmt.Errorf("record %d: bad value length %d", n, valLen)
+		}
+
+		val := data[:valLen]
+		data = data[valLen:]
+		if binary.BigEndian.Uint32(val) <= now {
+			continue
+		}
+
+		// Clone the key and the value to let the file data be collected.
+		c.Set(slices.Clone(key), slices.Clone(val))
+		n++
+	}
+
+	return n, nil
+}
+
+// cacheFilePath returns the path to the cache file within dataDir.  It returns
+// an empty string if dataDir is empty, so that the cache isn't persisted.
+func cacheFilePath(dataDir, name string) (p string) {
+	if dataDir == "" {
+		return ""
+	}
+
+	return filepath.Join(dataDir, name)
+}
+
+// loadHashCache pre-warms c from its file and logs the result.  svc is used for
+// logging.
+func loadHashCache(c *hashCache, svc string) {
+	n, err := c.load()
+	if err != nil {
+		log.Error("filtering: loading %s cache: %s", svc, err)
+
+		return
+	}
+
+	log.Debug("filtering: loaded %d entries into %s cache", n, svc)
+}
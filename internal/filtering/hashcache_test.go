@@ -0,0 +1,79 @@
+package filtering
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCacheVal returns a new cache value expiring at exp with hashes.
+func newCacheVal(exp time.Time, hashes ...byte) (val []byte) {
+	val = make([]byte, 4, 4+len(hashes))
+	binary.BigEndian.PutUint32(val, uint32(exp.Unix()))
+
+	return append(val, hashes...)
+}
+
+func TestHashCache_saveLoad(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), safeBrowsingCacheFile)
+
+	now := time.Now()
+	validVal := newCacheVal(now.Add(time.Hour), 1, 2, 3)
+	emptyVal := newCacheVal(now.Add(time.Hour))
+
+	c := newHashCache(0, filePath)
+	c.Set([]byte{0, 1}, validVal)
+	c.Set([]byte{0xff, 0xff}, emptyVal)
+	c.Set([]byte{1, 0}, newCacheVal(now.Add(-time.Hour), 4, 5, 6))
+
+	err := c.save()
+	require.NoError(t, err)
+
+	loaded := newHashCache(0, filePath)
+	n, err := loaded.load()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, n)
+	assert.Equal(t, validVal, loaded.Get([]byte{0, 1}))
+	assert.Equal(t, emptyVal, loaded.Get([]byte{0xff, 0xff}))
+	assert.Nil(t, loaded.Get([]byte{1, 0}))
+
+	t.Run("no_file", func(t *testing.T) {
+		n, err = newHashCache(0, filepath.Join(t.TempDir(), "absent")).load()
+		require.NoError(t, err)
+
+		assert.Zero(t, n)
+	})
+
+	t.Run("not_persisted", func(t *testing.T) {
+		err = newHashCache(0, "").save()
+		require.NoError(t, err)
+	})
+}
+
+func TestHashCache_stats(t *testing.T) {
+	val := newCacheVal(time.Now().Add(time.Hour), 1, 2, 3)
+	entrySize := hashPrefixLen + len(val)
+
+	c := newHashCache(uint(2*entrySize), "")
+	c.Set([]byte{0, 1}, val)
+	c.Set([]byte{0, 2}, val)
+	c.Set([]byte{0, 3}, val)
+
+	c.countLookup(true)
+	c.countLookup(false)
+	c.countLookup(false)
+
+	assert.Equal(t, &cacheStatsJSON{
+		Size:      2 * entrySize,
+		MaxSize:   uint(2 * entrySize),
+		Count:     2,
+		Hits:      1,
+		Misses:    2,
+		Evictions: 1,
+	}, c.stats())
+}
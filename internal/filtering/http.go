@@ -40,9 +40,12 @@ func validateFilterURL(urlStr string) (err error) {
 }
 
 type filterAddJSON struct {
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	Whitelist bool   `json:"whitelist"`
+	BlockedResponseTTL *uint32 `json:"blocked_response_ttl,omitempty"`
+
+	Name      string       `json:"name"`
+	URL       string       `json:"url"`
+	Format    FilterFormat `json:"format,omitempty"`
+	Whitelist bool         `json:"whitelist"`
 }
 
 func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +64,13 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = validateListFormat(fj.Format, fj.Whitelist)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
 	// Check for duplicates
 	if d.filterExists(fj.URL) {
 		aghhttp.Error(r, w, http.StatusBadRequest, "Filter URL already added -- %s", fj.URL)
@@ -74,6 +84,10 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 		URL:     fj.URL,
 		Name:    fj.Name,
 		white:   fj.Whitelist,
+
+		BlockedResponseTTL: fj.BlockedResponseTTL,
+		Format:             fj.Format,
+
 		Filter: Filter{
 			ID: assignUniqueFilterID(),
 		},
@@ -179,9 +193,12 @@ func (d *DNSFilter) handleFilteringRemoveURL(w http.ResponseWriter, r *http.Requ
 }
 
 type filterURLReqData struct {
-	Name    string `json:"name"`
-	URL     string `json:"url"`
-	Enabled bool   `json:"enabled"`
+	BlockedResponseTTL *uint32 `json:"blocked_response_ttl,omitempty"`
+
+	Name    string       `json:"name"`
+	URL     string       `json:"url"`
+	Format  FilterFormat `json:"format,omitempty"`
+	Enabled bool         `json:"enabled"`
 }
 
 type filterURLReq struct {
@@ -212,10 +229,20 @@ func (d *DNSFilter) handleFilteringSetURL(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = validateListFormat(fj.Data.Format, fj.Whitelist)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
 	filt := FilterYAML{
 		Enabled: fj.Data.Enabled,
 		Name:    fj.Data.Name,
 		URL:     fj.Data.URL,
+
+		BlockedResponseTTL: fj.Data.BlockedResponseTTL,
+		Format:             fj.Data.Format,
 	}
 
 	restart, err := d.filterSetProperties(fj.URL, filt, fj.Whitelist)
@@ -289,12 +316,23 @@ func (d *DNSFilter) handleFilteringRefresh(w http.ResponseWriter, r *http.Reques
 }
 
 type filterJSON struct {
-	URL         string `json:"url"`
-	Name        string `json:"name"`
-	LastUpdated string `json:"last_updated,omitempty"`
-	ID          int64  `json:"id"`
-	RulesCount  uint32 `json:"rules_count"`
-	Enabled     bool   `json:"enabled"`
+	BlockedResponseTTL *uint32 `json:"blocked_response_ttl,omitempty"`
+
+	URL         string       `json:"url"`
+	Name        string       `json:"name"`
+	LastUpdated string       `json:"last_updated,omitempty"`
+	Format      FilterFormat `json:"format,omitempty"`
+	ID          int64        `json:"id"`
+	RulesCount  uint32       `json:"rules_count"`
+
+	// Size is the size of the list contents in bytes.
+	Size int64 `json:"size"`
+
+	// MemoryUsage is the estimated size of the memory used by the list in
+	// bytes.
+	MemoryUsage int64 `json:"memory_usage"`
+
+	Enabled bool `json:"enabled"`
 }
 
 type filteringConfig struct {
@@ -312,6 +350,9 @@ func filterToJSON(f FilterYAML) filterJSON {
 		URL:        f.URL,
 		Name:       f.Name,
 		RulesCount: uint32(f.RulesCount),
+
+		BlockedResponseTTL: f.BlockedResponseTTL,
+		Format:             f.Format,
 	}
 
 	if !f.LastUpdated.IsZero() {
@@ -327,12 +368,16 @@ func (d *DNSFilter) handleFilteringStatus(w http.ResponseWriter, r *http.Request
 	d.filtersMu.RLock()
 	resp.Enabled = d.FilteringEnabled
 	resp.Interval = d.FiltersUpdateIntervalHours
-	for _, f := range d.Filters {
-		fj := filterToJSON(f)
+	for i := range d.Filters {
+		f := &d.Filters[i]
+		fj := filterToJSON(*f)
+		fj.Size, fj.MemoryUsage = d.listMemoryUsage(f)
 		resp.Filters = append(resp.Filters, fj)
 	}
-	for _, f := range d.WhitelistFilters {
-		fj := filterToJSON(f)
+	for i := range d.WhitelistFilters {
+		f := &d.WhitelistFilters[i]
+		fj := filterToJSON(*f)
+		fj.Size, fj.MemoryUsage = d.listMemoryUsage(f)
 		resp.WhitelistFilters = append(resp.WhitelistFilters, fj)
 	}
 	resp.UserRules = d.UserRules
@@ -463,6 +508,9 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodGet, "/control/safesearch/status", d.handleSafeSearchStatus)
 	registerHTTP(http.MethodPut, "/control/safesearch/settings", d.handleSafeSearchSettings)
 
+	registerHTTP(http.MethodGet, "/control/lookalike/status", d.handleLookalikeStatus)
+	registerHTTP(http.MethodPut, "/control/lookalike/settings", d.handleLookalikeSettings)
+
 	registerHTTP(http.MethodGet, "/control/rewrite/list", d.handleRewriteList)
 	registerHTTP(http.MethodPost, "/control/rewrite/add", d.handleRewriteAdd)
 	registerHTTP(http.MethodPost, "/control/rewrite/delete", d.handleRewriteDelete)
@@ -480,6 +528,23 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/filtering/refresh", d.handleFilteringRefresh)
 	registerHTTP(http.MethodPost, "/control/filtering/set_rules", d.handleFilteringSetRules)
 	registerHTTP(http.MethodGet, "/control/filtering/check_host", d.handleCheckHost)
+
+	registerHTTP(http.MethodGet, "/control/filtering/rule_requests", d.handleRuleRequests)
+	registerHTTP(
+		http.MethodPost,
+		"/control/filtering/rule_requests/submit",
+		d.handleRuleRequestSubmit,
+	)
+	registerHTTP(
+		http.MethodPost,
+		"/control/filtering/rule_requests/approve",
+		d.handleRuleRequestApprove,
+	)
+	registerHTTP(
+		http.MethodPost,
+		"/control/filtering/rule_requests/reject",
+		d.handleRuleRequestReject,
+	)
 }
 
 // ValidateUpdateIvl returns false if i is not a valid filters update interval.
@@ -0,0 +1,48 @@
+package filtering
+
+import (
+	"strings"
+)
+
+// Local Service Discovery
+
+// mdnsDomain is the special-use domain name for the link-local names resolved
+// with Multicast DNS.  See RFC 6762 and RFC 6761.
+const mdnsDomain = "local"
+
+// IsMDNSName returns true if host is within the "local." domain reserved for
+// Multicast DNS.  host must be lowercased and without the trailing dot.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6762#section-3.
+func IsMDNSName(host string) (ok bool) {
+	return host == mdnsDomain || strings.HasSuffix(host, "."+mdnsDomain)
+}
+
+// IsLocalDiscoveryName returns true if host is a name used by the local service
+// discovery, that is either a Multicast DNS name or a DNS-Based Service
+// Discovery name, such as "_services._dns-sd._udp.example" or
+// "printer._ipp._tcp.example".  host must be lowercased and without the
+// trailing dot.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6763#section-4.1.
+func IsLocalDiscoveryName(host string) (ok bool) {
+	if IsMDNSName(host) {
+		return true
+	}
+
+	labels := strings.Split(host, ".")
+	for i, l := range labels[:len(labels)-1] {
+		// A service name consists of the underscored service label followed
+		// by the protocol label.
+		if len(l) > 1 && l[0] == '_' && isSvcProtoLabel(labels[i+1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSvcProtoLabel returns true if l is a protocol label of DNS-SD service name.
+func isSvcProtoLabel(l string) (ok bool) {
+	return l == "_tcp" || l == "_udp"
+}
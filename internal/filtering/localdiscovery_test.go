@@ -0,0 +1,121 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLocalDiscoveryName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		host     string
+		wantMDNS bool
+		want     bool
+	}{{
+		name:     "mdns_domain",
+		host:     "local",
+		wantMDNS: true,
+		want:     true,
+	}, {
+		name:     "mdns_host",
+		host:     "printer.local",
+		wantMDNS: true,
+		want:     true,
+	}, {
+		name:     "mdns_service",
+		host:     "_ipp._tcp.local",
+		wantMDNS: true,
+		want:     true,
+	}, {
+		name:     "dns_sd_enumeration",
+		host:     "_services._dns-sd._udp.example.org",
+		wantMDNS: false,
+		want:     true,
+	}, {
+		name:     "dns_sd_browsing",
+		host:     "b._dns-sd._udp.0.1.168.192.in-addr.arpa",
+		wantMDNS: false,
+		want:     true,
+	}, {
+		name:     "dns_sd_instance",
+		host:     "printer._ipp._tcp.example.org",
+		wantMDNS: false,
+		want:     true,
+	}, {
+		name:     "not_local_suffix",
+		host:     "notlocal",
+		wantMDNS: false,
+		want:     false,
+	}, {
+		name:     "not_service_proto",
+		host:     "_dmarc.example.org",
+		wantMDNS: false,
+		want:     false,
+	}, {
+		name:     "not_service_label",
+		host:     "_._tcp.example.org",
+		wantMDNS: false,
+		want:     false,
+	}, {
+		name:     "plain",
+		host:     "example.org",
+		wantMDNS: false,
+		want:     false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantMDNS, IsMDNSName(tc.host))
+			assert.Equal(t, tc.want, IsLocalDiscoveryName(tc.host))
+		})
+	}
+}
+
+func TestDNSFilter_CheckHost_localDiscovery(t *testing.T) {
+	const rules = "||local^\n||_tcp.example.org^\n"
+
+	d, setts := newForTest(t, nil, []Filter{{ID: 0, Data: []byte(rules)}})
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name        string
+		host        string
+		passthrough bool
+		want        bool
+	}{{
+		name:        "mdns_passthrough",
+		host:        "printer.local",
+		passthrough: true,
+		want:        false,
+	}, {
+		name:        "mdns_blocked",
+		host:        "printer.local",
+		passthrough: false,
+		want:        true,
+	}, {
+		name:        "dns_sd_passthrough",
+		host:        "printer._ipp._tcp.example.org",
+		passthrough: true,
+		want:        false,
+	}, {
+		name:        "dns_sd_blocked",
+		host:        "printer._ipp._tcp.example.org",
+		passthrough: false,
+		want:        true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := *setts
+			s.LocalDiscoveryPassthrough = tc.passthrough
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, &s)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, res.IsFiltered)
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package filtering
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/mathutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Lookalike Domains Detection
+
+// LookalikeConfig is the configuration of the detection of the domain names,
+// which look like the protected ones, such as IDN homographs and typos.
+type LookalikeConfig struct {
+	// ProtectedDomains are the domain names to protect, for example the ones
+	// of the user's bank or employer.  The domains under the same registrable
+	// domain as a protected one are never considered lookalikes.
+	ProtectedDomains []string `yaml:"protected_domains" json:"protected_domains"`
+
+	// MinConfidence is the minimum confidence of a match, in percent, for it
+	// to be reported.
+	MinConfidence uint8 `yaml:"min_confidence" json:"min_confidence"`
+
+	// Enabled defines if the detection is enabled.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Block defines if the lookalike domains are blocked.  Otherwise they are
+	// only annotated in the query log.
+	Block bool `yaml:"block" json:"block"`
+}
+
+// maxLookalikeConfidence is the maximum confidence of a lookalike match.
+const maxLookalikeConfidence = 100
+
+// Validate returns an error if c contains invalid values.
+func (c *LookalikeConfig) Validate() (err error) {
+	if c.MinConfidence > maxLookalikeConfidence {
+		return fmt.Errorf(
+			"min_confidence: must be at most %d, got %d",
+			maxLookalikeConfidence,
+			c.MinConfidence,
+		)
+	}
+
+	_, err = newLookalikeTargets(c.ProtectedDomains)
+
+	return err
+}
+
+// LookalikeKind is the kind of the similarity of a domain name to a protected
+// one.
+type LookalikeKind string
+
+// Valid LookalikeKind values.
+const (
+	// LookalikeHomograph means that the domain name is visually identical or
+	// almost identical to the protected one, for example because it uses
+	// letters from a different script.
+	LookalikeHomograph LookalikeKind = "homograph"
+
+	// LookalikeTypo means that the domain name differs from the protected one
+	// by a few characters or by the public suffix.
+	LookalikeTypo LookalikeKind = "typo"
+)
+
+// LookalikeMatch is the result of the detection of a lookalike domain name.
+type LookalikeMatch struct {
+	// Protected is the registrable domain of the protected domain name, which
+	// the queried one looks like.
+	Protected string `json:",omitempty"`
+
+	// Kind is the kind of the similarity.
+	Kind LookalikeKind `json:",omitempty"`
+
+	// Confidence is the confidence of the match in percent.
+	Confidence uint8 `json:",omitempty"`
+}
+
+// lookalikeTarget is a prepared protected domain name.
+type lookalikeTarget struct {
+	// domain is the registrable domain of the protected domain name.
+	domain string
+
+	// label is the leftmost label of domain.
+	label string
+
+	// skeleton is the skeleton of label, see [lookalikeSkeleton].
+	skeleton string
+
+	// suffix is the public suffix of domain.
+	suffix string
+}
+
+// newLookalikeTargets returns the prepared protected domain names.  domains
+// may be internationalized.
+func newLookalikeTargets(domains []string) (targets []*lookalikeTarget, err error) {
+	for i, d := range domains {
+		var t *lookalikeTarget
+		t, err = newLookalikeTarget(d)
+		if err != nil {
+			return nil, fmt.Errorf("protected_domains: at index %d: %w", i, err)
+		}
+
+		targets = append(targets, t)
+	}
+
+	return targets, nil
+}
+
+// newLookalikeTarget returns the prepared protected domain name.
+func newLookalikeTarget(domain string) (t *lookalikeTarget, err error) {
+	domain, err = idna.ToASCII(strings.ToLower(strings.TrimSuffix(domain, ".")))
+	if err != nil {
+		return nil, err
+	}
+
+	err = netutil.ValidateDomainName(domain)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	label, suffix, ok := splitRegistrable(domain)
+	if !ok {
+		return nil, fmt.Errorf("no registrable domain in %q", domain)
+	}
+
+	uLabel, _ := idna.ToUnicode(label)
+
+	return &lookalikeTarget{
+		domain:   label + "." + suffix,
+		label:    label,
+		skeleton: lookalikeSkeleton(uLabel),
+		suffix:   suffix,
+	}, nil
+}
+
+// splitRegistrable returns the leftmost label of the registrable domain of
+// host and its public suffix.  ok is false if host has no registrable domain.
+func splitRegistrable(host string) (label, suffix string, ok bool) {
+	etldPlusOne, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", "", false
+	}
+
+	label, suffix, ok = strings.Cut(etldPlusOne, ".")
+
+	return label, suffix, ok
+}
+
+// setLookalikeConfig validates and sets the lookalike detection configuration.
+func (d *DNSFilter) setLookalikeConfig(c LookalikeConfig) (err error) {
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+
+	targets, _ := newLookalikeTargets(c.ProtectedDomains)
+
+	d.confLock.Lock()
+	defer d.confLock.Unlock()
+
+	d.Config.Lookalike = c
+	d.lookalikeTargets = targets
+
+	return nil
+}
+
+// checkLookalike returns the result of the lookalike detection for host.  res
+// is empty if host doesn't look like any of the protected domains.  host must
+// be lowercased.
+func (d *DNSFilter) checkLookalike(host string) (res Result) {
+	d.confLock.RLock()
+	defer d.confLock.RUnlock()
+
+	c := d.Config.Lookalike
+	if !c.Enabled || len(d.lookalikeTargets) == 0 {
+		return Result{}
+	}
+
+	m := matchLookalike(d.lookalikeTargets, host)
+	if m == nil || m.Confidence < c.MinConfidence {
+		return Result{}
+	}
+
+	res.Lookalike = m
+	if c.Block {
+		res.IsFiltered = true
+		res.Reason = FilteredLookalike
+	}
+
+	return res
+}
+
+// matchLookalike returns the best match of host among targets.  m is nil if
+// host doesn't look like any of targets or belongs to one of them.
+func matchLookalike(targets []*lookalikeTarget, host string) (m *LookalikeMatch) {
+	label, suffix, ok := splitRegistrable(strings.TrimSuffix(host, "."))
+	if !ok {
+		return nil
+	}
+
+	uLabel, err := idna.ToUnicode(label)
+	if err != nil {
+		uLabel = label
+	}
+
+	isIDN := uLabel != label
+	skeleton := lookalikeSkeleton(uLabel)
+	for _, t := range targets {
+		if label == t.label && suffix == t.suffix {
+			// The host belongs to the protected domain itself.
+			return nil
+		}
+
+		kind, conf := lookalikeConfidence(t, label, suffix, skeleton, isIDN)
+		if m == nil && conf > 0 || m != nil && conf > m.Confidence {
+			m = &LookalikeMatch{
+				Protected:  t.domain,
+				Kind:       kind,
+				Confidence: conf,
+			}
+		}
+	}
+
+	return m
+}
+
+const (
+	// minTypoLabelLen is the minimum length of the protected label, typos of
+	// which are detected.  Shorter labels produce too many false positives.
+	minTypoLabelLen = 4
+
+	// longTypoLabelLen is the length of the protected label, starting from
+	// which two typos are tolerated instead of one.
+	longTypoLabelLen = 9
+
+	// otherSuffixPenalty is subtracted from the confidence of a match with a
+	// public suffix different from the protected one's.
+	otherSuffixPenalty = 20
+
+	// suffixOnlyConfidence is the confidence of a match, which only differs
+	// from the protected domain by its public suffix.
+	suffixOnlyConfidence = 60
+)
+
+// lookalikeConfidence returns the kind and the confidence of the similarity of
+// the registrable domain, described by label, suffix, and skeleton, to t.
+// conf is zero if they aren't similar.
+func lookalikeConfidence(
+	t *lookalikeTarget,
+	label string,
+	suffix string,
+	skeleton string,
+	isIDN bool,
+) (kind LookalikeKind, conf uint8) {
+	penalty := 0
+	if suffix != t.suffix {
+		penalty = otherSuffixPenalty
+	}
+
+	if skeleton == t.skeleton {
+		if label == t.label {
+			return LookalikeTypo, suffixOnlyConfidence
+		}
+
+		return LookalikeHomograph, uint8(maxLookalikeConfidence - penalty/2)
+	}
+
+	l := len([]rune(t.skeleton))
+	if l < minTypoLabelLen {
+		return "", 0
+	}
+
+	maxDist := 1
+	if l >= longTypoLabelLen {
+		maxDist = 2
+	}
+
+	dist := editDistance(skeleton, t.skeleton)
+	if dist > maxDist {
+		return "", 0
+	}
+
+	kind = LookalikeTypo
+	if isIDN {
+		kind = LookalikeHomograph
+	}
+
+	return kind, uint8(maxLookalikeConfidence - maxLookalikeConfidence*dist/l - penalty)
+}
+
+// confusables maps the characters to the ASCII letters they are commonly
+// confused with.
+var confusables = map[rune]rune{
+	// Digits.
+	'0': 'o', '1': 'l', '3': 'e', '5': 's',
+
+	// Cyrillic.
+	'а': 'a', 'е': 'e', 'ё': 'e', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k',
+	'о': 'o', 'р': 'p', 'с': 'c', 'ѕ': 's', 'у': 'y', 'х': 'x', 'һ': 'h',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+
+	// Greek.
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+
+	// Latin with diacritics.
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a',
+	'ç': 'c', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ì': 'i',
+	'í': 'i', 'î': 'i', 'ï': 'i', 'ı': 'i', 'ł': 'l', 'ñ': 'n', 'ò': 'o',
+	'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ś': 's',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ý': 'y', 'ÿ': 'y',
+	'ź': 'z', 'ż': 'z',
+}
+
+// confusableSeqs replaces the ASCII sequences, which look like a single
+// letter.
+var confusableSeqs = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// lookalikeSkeleton returns the skeleton of the domain name label, which is
+// the same for the visually similar labels.  label must be lowercased.
+func lookalikeSkeleton(label string) (skeleton string) {
+	label = strings.Map(func(r rune) (res rune) {
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+
+		return r
+	}, label)
+
+	return confusableSeqs.Replace(label)
+}
+
+// editDistance returns the optimal string alignment distance between a and b,
+// which is the Levenshtein distance, which also counts the transpositions of
+// adjacent characters as single edits.
+func editDistance(a, b string) (dist int) {
+	ra, rb := []rune(a), []rune(b)
+
+	// rows contains the last three rows of the distance matrix.
+	var rows [3][]int
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+	}
+
+	for j := range rows[1] {
+		rows[1][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		prev2, prev, cur := rows[0], rows[1], rows[2]
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = mathutil.Min(mathutil.Min(prev[j], cur[j-1])+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = mathutil.Min(cur[j], prev2[j-2]+1)
+			}
+		}
+
+		rows[0], rows[1], rows[2] = prev, cur, prev2
+	}
+
+	return rows[1][len(rb)]
+}
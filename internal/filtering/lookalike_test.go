@@ -0,0 +1,262 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchLookalike(t *testing.T) {
+	targets, err := newLookalikeTargets([]string{
+		"mybank.com",
+		"paypal.com",
+		"www.examplecorp.co.uk",
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		want *LookalikeMatch
+		name string
+		host string
+	}{{
+		want: nil,
+		name: "protected",
+		host: "mybank.com",
+	}, {
+		want: nil,
+		name: "protected_subdomain",
+		host: "login.mybank.com",
+	}, {
+		want: nil,
+		name: "unrelated",
+		host: "example.com",
+	}, {
+		want: nil,
+		name: "too_different",
+		host: "mybankers.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "paypal.com",
+			Kind:       LookalikeHomograph,
+			Confidence: 100,
+		},
+		name: "idn_homograph",
+		host: "xn--pypal-4ve.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "paypal.com",
+			Kind:       LookalikeHomograph,
+			Confidence: 100,
+		},
+		name: "digit_homograph",
+		host: "www.paypa1.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "mybank.com",
+			Kind:       LookalikeHomograph,
+			Confidence: 100,
+		},
+		name: "sequence_homograph",
+		host: "rnybank.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "examplecorp.co.uk",
+			Kind:       LookalikeHomograph,
+			Confidence: 90,
+		},
+		name: "homograph_other_suffix",
+		host: "exampl3corp.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "mybank.com",
+			Kind:       LookalikeTypo,
+			Confidence: 84,
+		},
+		name: "transposition",
+		host: "mybnak.com",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "mybank.com",
+			Kind:       LookalikeTypo,
+			Confidence: 64,
+		},
+		name: "typo_other_suffix",
+		host: "mybamk.net",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "examplecorp.co.uk",
+			Kind:       LookalikeTypo,
+			Confidence: 91,
+		},
+		name: "long_label_typo",
+		host: "exampelcorp.co.uk",
+	}, {
+		want: &LookalikeMatch{
+			Protected:  "mybank.com",
+			Kind:       LookalikeTypo,
+			Confidence: 60,
+		},
+		name: "other_suffix",
+		host: "mybank.net",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, matchLookalike(targets, tc.host))
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a    string
+		b    string
+		want int
+	}{{
+		a:    "",
+		b:    "",
+		want: 0,
+	}, {
+		a:    "abc",
+		b:    "",
+		want: 3,
+	}, {
+		a:    "mybank",
+		b:    "mybank",
+		want: 0,
+	}, {
+		a:    "mybank",
+		b:    "mybnak",
+		want: 1,
+	}, {
+		a:    "mybank",
+		b:    "my-bank",
+		want: 1,
+	}, {
+		a:    "mybank",
+		b:    "mybak",
+		want: 1,
+	}, {
+		a:    "kitten",
+		b:    "sitting",
+		want: 3,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+"_"+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.want, editDistance(tc.a, tc.b))
+			assert.Equal(t, tc.want, editDistance(tc.b, tc.a))
+		})
+	}
+}
+
+func TestLookalikeConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		conf       LookalikeConfig
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		conf: LookalikeConfig{
+			ProtectedDomains: []string{"mybank.com", "пример.рф"},
+			MinConfidence:    80,
+		},
+	}, {
+		name:       "bad_confidence",
+		wantErrMsg: "min_confidence: must be at most 100, got 101",
+		conf: LookalikeConfig{
+			MinConfidence: 101,
+		},
+	}, {
+		name:       "public_suffix",
+		wantErrMsg: `protected_domains: at index 1: no registrable domain in "co.uk"`,
+		conf: LookalikeConfig{
+			ProtectedDomains: []string{"mybank.com", "co.uk"},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+func TestDNSFilter_CheckHost_lookalike(t *testing.T) {
+	const host = "mybnak.com"
+
+	want := &LookalikeMatch{
+		Protected:  "mybank.com",
+		Kind:       LookalikeTypo,
+		Confidence: 84,
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		f, setts := newForTest(t, &Config{
+			Lookalike: LookalikeConfig{
+				ProtectedDomains: []string{"mybank.com"},
+				MinConfidence:    80,
+				Enabled:          true,
+			},
+		}, nil)
+
+		res, err := f.CheckHost(host, dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.False(t, res.IsFiltered)
+		assert.Equal(t, NotFilteredNotFound, res.Reason)
+		assert.Equal(t, want, res.Lookalike)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		f, setts := newForTest(t, &Config{
+			Lookalike: LookalikeConfig{
+				ProtectedDomains: []string{"mybank.com"},
+				MinConfidence:    80,
+				Enabled:          true,
+				Block:            true,
+			},
+		}, nil)
+
+		res, err := f.CheckHost(host, dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.True(t, res.IsFiltered)
+		assert.Equal(t, FilteredLookalike, res.Reason)
+		assert.Equal(t, want, res.Lookalike)
+	})
+
+	t.Run("low_confidence", func(t *testing.T) {
+		f, setts := newForTest(t, &Config{
+			Lookalike: LookalikeConfig{
+				ProtectedDomains: []string{"mybank.com"},
+				MinConfidence:    90,
+				Enabled:          true,
+				Block:            true,
+			},
+		}, nil)
+
+		res, err := f.CheckHost(host, dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.Equal(t, Result{}, res)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		f, setts := newForTest(t, &Config{
+			Lookalike: LookalikeConfig{
+				ProtectedDomains: []string{"mybank.com"},
+				Block:            true,
+			},
+		}, nil)
+
+		res, err := f.CheckHost(host, dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.Equal(t, Result{}, res)
+	})
+}
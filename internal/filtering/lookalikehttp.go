@@ -0,0 +1,51 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"golang.org/x/exp/slices"
+)
+
+// handleLookalikeStatus is the handler for GET /control/lookalike/status HTTP
+// API.
+func (d *DNSFilter) handleLookalikeStatus(w http.ResponseWriter, r *http.Request) {
+	var resp LookalikeConfig
+	func() {
+		d.confLock.RLock()
+		defer d.confLock.RUnlock()
+
+		resp = d.Config.Lookalike
+		resp.ProtectedDomains = slices.Clone(resp.ProtectedDomains)
+	}()
+
+	if resp.ProtectedDomains == nil {
+		resp.ProtectedDomains = []string{}
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleLookalikeSettings is the handler for PUT /control/lookalike/settings
+// HTTP API.
+func (d *DNSFilter) handleLookalikeSettings(w http.ResponseWriter, r *http.Request) {
+	req := &LookalikeConfig{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	err = d.setLookalikeConfig(*req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "lookalike: %s", err)
+
+		return
+	}
+
+	d.Config.ConfigModified()
+
+	aghhttp.OK(w)
+}
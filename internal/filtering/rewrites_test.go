@@ -1,6 +1,7 @@
 package filtering
 
 import (
+	"fmt"
 	"net"
 	"testing"
 
@@ -369,3 +370,80 @@ func TestRewritesExceptionIP(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSFilter_SetRewrites(t *testing.T) {
+	d, _ := newForTest(t, nil, nil)
+	t.Cleanup(d.Close)
+
+	err := d.SetRewrites([]*LegacyRewrite{{
+		Domain: "NAS.lan",
+		Answer: "192.168.1.10",
+	}})
+	require.NoError(t, err)
+
+	r := d.processRewrites("nas.lan", dns.TypeA)
+	assert.Equal(t, Rewritten, r.Reason)
+
+	err = d.SetRewrites([]*LegacyRewrite{nil})
+	assert.Error(t, err)
+}
+
+var rewriteResultSink Result
+
+func BenchmarkDNSFilter_processRewrites(b *testing.B) {
+	d, _ := newForTest(b, nil, nil)
+	b.Cleanup(d.Close)
+
+	const rewritesNum = 1000
+
+	for i := 0; i < rewritesNum; i++ {
+		d.Rewrites = append(d.Rewrites, &LegacyRewrite{
+			Domain: fmt.Sprintf("host-%d.example", i),
+			Answer: "1.2.3.4",
+		}, &LegacyRewrite{
+			Domain: fmt.Sprintf("*.wild-%d.example", i),
+			Answer: "1.2.3.5",
+		})
+	}
+
+	d.Rewrites = append(d.Rewrites, &LegacyRewrite{
+		Domain: "cname.example",
+		Answer: "host-1.example",
+	})
+
+	require.NoError(b, d.prepareRewrites())
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantReason Reason
+	}{{
+		name:       "exact",
+		host:       "host-500.example",
+		wantReason: Rewritten,
+	}, {
+		name:       "wildcard",
+		host:       "sub.wild-500.example",
+		wantReason: Rewritten,
+	}, {
+		name:       "cname",
+		host:       "cname.example",
+		wantReason: Rewritten,
+	}, {
+		name:       "not_found",
+		host:       "www.not-rewritten.example",
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rewriteResultSink = d.processRewrites(tc.host, dns.TypeA)
+			}
+
+			assert.Equal(b, tc.wantReason, rewriteResultSink.Reason)
+		})
+	}
+}
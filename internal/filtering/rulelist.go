@@ -0,0 +1,246 @@
+package filtering
+
+import (
+	"bytes"
+	"hash/maphash"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// Compact Rule Storage
+
+// ruleOwners interns the rules of the lists of a single rule storage, so that
+// each distinct rule is only indexed by the filtering engine once, however many
+// lists contain it.  A rule is owned by its first occurrence within the
+// storage.  A ruleOwners is safe for concurrent use.
+type ruleOwners struct {
+	// mu protects owners.
+	mu *sync.Mutex
+
+	// owners are the storage indexes of the first occurrences of the rules by
+	// the hashes of their texts.  It's nil after the release.
+	owners map[uint64]int64
+
+	// seed is the seed of the hashes.
+	seed maphash.Seed
+}
+
+// newRuleOwners returns a new properly initialized *ruleOwners.
+func newRuleOwners() (o *ruleOwners) {
+	return &ruleOwners{
+		mu:     &sync.Mutex{},
+		owners: map[uint64]int64{},
+		seed:   maphash.MakeSeed(),
+	}
+}
+
+// claim returns true if the rule with text at the storage index idx is the
+// first occurrence of it within the storage.  Once released, o lets all rules
+// through.
+func (o *ruleOwners) claim(text []byte, idx int64) (ok bool) {
+	h := maphash.Bytes(o.seed, text)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.owners == nil {
+		return true
+	}
+
+	owner, has := o.owners[h]
+	if !has {
+		o.owners[h] = idx
+
+		return true
+	}
+
+	return owner == idx
+}
+
+// release frees the memory used by o.  It must be called once the filtering
+// engine has scanned the storage.  o may be nil.
+func (o *ruleOwners) release() {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.owners = nil
+}
+
+// storageIndex returns the index of the rule at the offset within the list with
+// listID as it's used by [filterlist.RuleStorage].
+func storageIndex(listID int, offset int) (idx int64) {
+	return int64(listID)<<32 | int64(offset)
+}
+
+// compactRuleList is a [filterlist.RuleList] with the contents mapped into the
+// memory where the operating system supports that, so that those are kept in
+// the page cache instead of the heap and are shared with the file system.  The
+// rules, which other lists of the same storage contain as well, are skipped by
+// its scanners.
+type compactRuleList struct {
+	// owners are the first occurrences of the rules within the storage.
+	owners *ruleOwners
+
+	// unmap releases data.
+	unmap func() (err error)
+
+	// data are the contents of the list.  It must not be modified.
+	data []byte
+
+	// id is the identifier of the list.
+	id int
+
+	// duplicates is the number of the rules skipped during the last scan.
+	duplicates atomic.Uint32
+}
+
+// type check
+var _ filterlist.RuleList = (*compactRuleList)(nil)
+
+// newCompactRuleList returns a new compact rule list with the contents of the
+// file at path.  The file must only be replaced, not modified in place, while
+// the list is in use.
+func newCompactRuleList(id int, path string, owners *ruleOwners) (l *compactRuleList, err error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	return &compactRuleList{
+		owners: owners,
+		unmap:  unmap,
+		data:   data,
+		id:     id,
+	}, nil
+}
+
+// GetID implements the [filterlist.RuleList] interface for *compactRuleList.
+func (l *compactRuleList) GetID() (id int) {
+	return l.id
+}
+
+// NewScanner implements the [filterlist.RuleList] interface for
+// *compactRuleList.
+func (l *compactRuleList) NewScanner() (s *filterlist.RuleScanner) {
+	return filterlist.NewRuleScanner(&dedupReader{list: l}, l.id, true)
+}
+
+// RetrieveRule implements the [filterlist.RuleList] interface for
+// *compactRuleList.
+func (l *compactRuleList) RetrieveRule(ruleIdx int) (r rules.Rule, err error) {
+	if ruleIdx < 0 || ruleIdx >= len(l.data) {
+		return nil, filterlist.ErrRuleRetrieval
+	}
+
+	line := l.data[ruleIdx:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	// Copy the text, since the rule may outlive the mapping.
+	text := strings.TrimSpace(string(line))
+	if text == "" {
+		return nil, filterlist.ErrRuleRetrieval
+	}
+
+	return rules.NewRule(text, l.id)
+}
+
+// Close implements the [filterlist.RuleList] interface for *compactRuleList.
+func (l *compactRuleList) Close() (err error) {
+	return l.unmap()
+}
+
+// dedupReader reads the contents of a compact rule list replacing the rules
+// owned by other lists or by the previous lines of the same list with spaces,
+// so that the offsets of the remaining rules don't change.
+type dedupReader struct {
+	// list is the list being read.
+	list *compactRuleList
+
+	// pending is the rest of the current line.
+	pending []byte
+
+	// blank is the buffer for the replaced lines.
+	blank []byte
+
+	// pos is the offset of the next line.
+	pos int
+
+	// duplicates is the number of the replaced lines.
+	duplicates uint32
+}
+
+// type check
+var _ io.Reader = (*dedupReader)(nil)
+
+// Read implements the [io.Reader] interface for *dedupReader.
+func (r *dedupReader) Read(p []byte) (n int, err error) {
+	if len(r.pending) == 0 {
+		err = r.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// next sets r.pending to the next line.  It returns [io.EOF] at the end of the
+// list.
+func (r *dedupReader) next() (err error) {
+	data := r.list.data
+	if r.pos >= len(data) {
+		r.list.duplicates.Store(r.duplicates)
+
+		return io.EOF
+	}
+
+	start := r.pos
+	line := data[start:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i+1]
+	}
+
+	r.pos += len(line)
+
+	text := bytes.TrimSpace(line)
+	if isCommentLine(text) || r.list.owners.claim(text, storageIndex(r.list.id, start)) {
+		r.pending = line
+
+		return nil
+	}
+
+	r.duplicates++
+	r.blank = r.blank[:0]
+	for _, c := range line {
+		if c != '\n' {
+			c = ' '
+		}
+
+		r.blank = append(r.blank, c)
+	}
+
+	r.pending = r.blank
+
+	return nil
+}
+
+// isCommentLine returns true if the trimmed line text is empty or a comment,
+// which don't need to be interned.
+func isCommentLine(text []byte) (ok bool) {
+	return len(text) == 0 || text[0] == '!' || text[0] == '#'
+}
@@ -0,0 +1,18 @@
+//go:build !(darwin || freebsd || linux || openbsd)
+
+package filtering
+
+import "os"
+
+// mapFile reads the contents of the file at path into the memory.  The file
+// isn't mapped, since on Windows a mapped file can't be replaced, which the
+// updates of the filter lists do.
+func mapFile(path string) (data []byte, unmap func() (err error), err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	return data, func() (err error) { return nil }, nil
+}
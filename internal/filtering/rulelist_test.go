@@ -0,0 +1,123 @@
+package filtering
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRuleStorage_compact(t *testing.T) {
+	const (
+		firstList  = "! Title\n||first.example^\n||both.example^\n||first.example^\n"
+		secondList = "! Title\n||both.example^\n0.0.0.0 second.example"
+	)
+
+	dir := t.TempDir()
+	filters := []Filter{{
+		ID:       1,
+		FilePath: filepath.Join(dir, "1.txt"),
+	}, {
+		ID:       2,
+		FilePath: filepath.Join(dir, "2.txt"),
+	}, {
+		ID:       3,
+		FilePath: filepath.Join(dir, "nonexistent.txt"),
+	}}
+
+	err := os.WriteFile(filters[0].FilePath, []byte(firstList), 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filters[1].FilePath, []byte(secondList), 0o644)
+	require.NoError(t, err)
+
+	owners := newRuleOwners()
+	rs, err := newRuleStorage(filters, owners)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, rs.Close)
+
+	engine := urlfilter.NewDNSEngine(rs)
+	owners.release()
+
+	assert.Equal(t, 3, engine.RulesCount)
+
+	require.Len(t, rs.Lists, 2)
+
+	first, ok := rs.Lists[0].(*compactRuleList)
+	require.True(t, ok)
+
+	second, ok := rs.Lists[1].(*compactRuleList)
+	require.True(t, ok)
+
+	assert.Equal(t, uint32(1), first.duplicates.Load())
+	assert.Equal(t, uint32(1), second.duplicates.Load())
+
+	testCases := []struct {
+		name   string
+		host   string
+		wantID int
+	}{{
+		name:   "first",
+		host:   "first.example",
+		wantID: 1,
+	}, {
+		name:   "both",
+		host:   "both.example",
+		wantID: 1,
+	}, {
+		name:   "second",
+		host:   "second.example",
+		wantID: 2,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, matched := engine.MatchRequest(&urlfilter.DNSRequest{Hostname: tc.host})
+			require.True(t, matched)
+
+			var r rules.Rule
+			if res.NetworkRule != nil {
+				r = res.NetworkRule
+			} else {
+				require.NotEmpty(t, res.HostRulesV4)
+
+				r = res.HostRulesV4[0]
+			}
+
+			assert.Equal(t, tc.wantID, r.GetFilterListID())
+		})
+	}
+}
+
+func TestDedupReader(t *testing.T) {
+	const data = "||a.example^\n\n||a.example^\n# Comment\n# Comment\n||b.example^"
+
+	l := &compactRuleList{
+		owners: newRuleOwners(),
+		data:   []byte(data),
+		id:     1,
+	}
+
+	for i := 0; i < 2; i++ {
+		s := l.NewScanner()
+
+		var got []int
+		for s.Scan() {
+			_, idx := s.Rule()
+			got = append(got, idx)
+		}
+
+		assert.Equal(t, []int{0, len(data) - len("||b.example^")}, got)
+		assert.Equal(t, uint32(1), l.duplicates.Load())
+	}
+
+	r, err := l.RetrieveRule(len(data) - len("||b.example^"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "||b.example^", r.Text())
+}
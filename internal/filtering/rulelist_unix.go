@@ -0,0 +1,41 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package filtering
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the contents of the file at path into the memory read-only.
+func mapFile(path string) (data []byte, unmap func() (err error), err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting file info: %w", err)
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		// Empty files can't be mapped.
+		return nil, func() (err error) { return nil }, nil
+	} else if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("file size %d is too large", size)
+	}
+
+	data, err = unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapping file: %w", err)
+	}
+
+	return data, func() (err error) { return unix.Munmap(data) }, nil
+}
@@ -0,0 +1,216 @@
+package filtering
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/exp/slices"
+)
+
+// Rule Change Requests
+
+// RuleRequestAction is the change of the filtering requested by a user.
+type RuleRequestAction string
+
+// RuleRequestAction values.
+const (
+	// RuleRequestActionBlock means that the domain should be blocked.
+	RuleRequestActionBlock RuleRequestAction = "block"
+
+	// RuleRequestActionUnblock means that the domain should be unblocked.
+	RuleRequestActionUnblock RuleRequestAction = "unblock"
+)
+
+const (
+	// maxRuleRequests is the maximum number of the pending rule change
+	// requests.
+	maxRuleRequests = 100
+
+	// maxRuleRequestCommentLen is the maximum length of the comment of a rule
+	// change request in bytes.
+	maxRuleRequestCommentLen = 256
+)
+
+// errTooManyRuleRequests is returned when the queue of the rule change requests
+// is full.
+const errTooManyRuleRequests errors.Error = "too many pending requests"
+
+// RuleRequest is a request to block or unblock a domain, which waits for the
+// approval of an admin.  The approved requests become the user rules.
+type RuleRequest struct {
+	// Created is the time the request has been submitted.
+	Created time.Time `yaml:"created" json:"created"`
+
+	// ID is the unique identifier of the request.
+	ID string `yaml:"id" json:"id"`
+
+	// Domain is the lowercased domain name to block or unblock.
+	Domain string `yaml:"domain" json:"domain"`
+
+	// Action is the requested change.
+	Action RuleRequestAction `yaml:"action" json:"action"`
+
+	// Client is the IP address of the client, which has submitted the
+	// request.
+	Client string `yaml:"client" json:"client"`
+
+	// Comment is the optional explanation from the client.
+	Comment string `yaml:"comment,omitempty" json:"comment,omitempty"`
+}
+
+// validate returns an error if r isn't a valid request.
+func (r *RuleRequest) validate() (err error) {
+	switch r.Action {
+	case RuleRequestActionBlock, RuleRequestActionUnblock:
+		// Go on.
+	default:
+		return fmt.Errorf("action: bad value %q", r.Action)
+	}
+
+	err = netutil.ValidateDomainName(r.Domain)
+	if err != nil {
+		return fmt.Errorf("domain: %w", err)
+	}
+
+	if l := len(r.Comment); l > maxRuleRequestCommentLen {
+		return fmt.Errorf("comment: too long, got %d bytes, max %d", l, maxRuleRequestCommentLen)
+	}
+
+	return nil
+}
+
+// rule returns the user rule implementing the requested change.
+func (r *RuleRequest) rule() (rule string) {
+	if r.Action == RuleRequestActionUnblock {
+		return "@@||" + r.Domain + "^"
+	}
+
+	return "||" + r.Domain + "^"
+}
+
+// validateRuleRequests returns an error if any of reqs isn't valid.
+func validateRuleRequests(reqs []*RuleRequest) (err error) {
+	for i, r := range reqs {
+		if r == nil {
+			return fmt.Errorf("at index %d: no value", i)
+		}
+
+		err = r.validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// newRuleRequestID returns a new random identifier of a rule change request.
+func newRuleRequestID() (id string, err error) {
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// submitRuleRequest adds a new pending request to change the filtering of
+// domain.  If there is already a pending request with the same domain and
+// action, it's returned instead and isNew is false.
+func (d *DNSFilter) submitRuleRequest(
+	domain string,
+	action RuleRequestAction,
+	client string,
+	comment string,
+) (req *RuleRequest, isNew bool, err error) {
+	req = &RuleRequest{
+		Created: time.Now(),
+		Domain:  strings.ToLower(strings.TrimSuffix(domain, ".")),
+		Action:  action,
+		Client:  client,
+		Comment: comment,
+	}
+
+	err = req.validate()
+	if err != nil {
+		return nil, false, err
+	}
+
+	d.confLock.Lock()
+	defer d.confLock.Unlock()
+
+	for _, r := range d.Config.RuleRequests {
+		if r.Domain == req.Domain && r.Action == req.Action {
+			return r, false, nil
+		}
+	}
+
+	if len(d.Config.RuleRequests) >= maxRuleRequests {
+		return nil, false, errTooManyRuleRequests
+	}
+
+	req.ID, err = newRuleRequestID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	d.Config.RuleRequests = append(d.Config.RuleRequests, req)
+
+	return req, true, nil
+}
+
+// ruleRequests returns the pending rule change requests in the order of
+// submission.
+func (d *DNSFilter) ruleRequests() (reqs []*RuleRequest) {
+	d.confLock.RLock()
+	defer d.confLock.RUnlock()
+
+	return slices.Clone(d.Config.RuleRequests)
+}
+
+// removeRuleRequest removes the pending request with id and returns it.  ok is
+// false if there is no such request.
+func (d *DNSFilter) removeRuleRequest(id string) (req *RuleRequest, ok bool) {
+	d.confLock.Lock()
+	defer d.confLock.Unlock()
+
+	i := slices.IndexFunc(d.Config.RuleRequests, func(r *RuleRequest) (found bool) {
+		return r.ID == id
+	})
+	if i < 0 {
+		return nil, false
+	}
+
+	req = d.Config.RuleRequests[i]
+	d.Config.RuleRequests = slices.Delete(slices.Clone(d.Config.RuleRequests), i, i+1)
+
+	return req, true
+}
+
+// approveRuleRequest removes the pending request with id and adds the user
+// rule implementing it, unless there already is one.  ok is false if there is
+// no such request.
+func (d *DNSFilter) approveRuleRequest(id string) (req *RuleRequest, ok bool) {
+	req, ok = d.removeRuleRequest(id)
+	if !ok {
+		return nil, false
+	}
+
+	rule := req.rule()
+
+	d.filtersMu.Lock()
+	defer d.filtersMu.Unlock()
+
+	if !slices.Contains(d.UserRules, rule) {
+		d.UserRules = append(slices.Clone(d.UserRules), rule)
+		d.enableFiltersLocked(true)
+	}
+
+	return req, true
+}
@@ -0,0 +1,97 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleRequest_validate(t *testing.T) {
+	testCases := []struct {
+		req        *RuleRequest
+		name       string
+		wantErrMsg string
+	}{{
+		req: &RuleRequest{
+			Domain: "example.org",
+			Action: RuleRequestActionUnblock,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		req: &RuleRequest{
+			Domain: "example.org",
+			Action: "allow",
+		},
+		name:       "bad_action",
+		wantErrMsg: `action: bad value "allow"`,
+	}, {
+		req: &RuleRequest{
+			Domain: "",
+			Action: RuleRequestActionBlock,
+		},
+		name:       "empty_domain",
+		wantErrMsg: `domain: bad domain name "": domain name is empty`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.req.validate())
+		})
+	}
+}
+
+func TestDNSFilter_ruleRequests(t *testing.T) {
+	d, _ := newForTest(t, nil, nil)
+	t.Cleanup(d.Close)
+
+	// Don't start the initializer, since only the rules themselves are checked.
+	d.filtersInitializerChan = make(chan filtersInitializerParams, 1)
+
+	unblock, isNew, err := d.submitRuleRequest(
+		"Example.ORG.",
+		RuleRequestActionUnblock,
+		"192.0.2.1",
+		"work",
+	)
+	require.NoError(t, err)
+
+	assert.True(t, isNew)
+	assert.Equal(t, "example.org", unblock.Domain)
+	assert.NotEmpty(t, unblock.ID)
+
+	dup, isNew, err := d.submitRuleRequest(
+		"example.org",
+		RuleRequestActionUnblock,
+		"192.0.2.2",
+		"",
+	)
+	require.NoError(t, err)
+
+	assert.False(t, isNew)
+	assert.Same(t, unblock, dup)
+
+	block, isNew, err := d.submitRuleRequest("ads.example", RuleRequestActionBlock, "192.0.2.2", "")
+	require.NoError(t, err)
+	require.True(t, isNew)
+
+	assert.Equal(t, []*RuleRequest{unblock, block}, d.ruleRequests())
+
+	_, ok := d.approveRuleRequest("unknown")
+	assert.False(t, ok)
+
+	approved, ok := d.approveRuleRequest(unblock.ID)
+	require.True(t, ok)
+
+	assert.Same(t, unblock, approved)
+	assert.Equal(t, []string{"@@||example.org^"}, d.UserRules)
+
+	rejected, ok := d.removeRuleRequest(block.ID)
+	require.True(t, ok)
+
+	assert.Same(t, block, rejected)
+	assert.Empty(t, d.ruleRequests())
+	assert.Equal(t, []string{"@@||example.org^"}, d.UserRules)
+}
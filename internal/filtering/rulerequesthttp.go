@@ -0,0 +1,129 @@
+package filtering
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// ruleRequestSubmitReq is the request of the POST
+// /control/filtering/rule_requests/submit HTTP API.
+type ruleRequestSubmitReq struct {
+	Domain  string            `json:"domain"`
+	Action  RuleRequestAction `json:"action"`
+	Comment string            `json:"comment"`
+}
+
+// handleRuleRequestSubmit is the handler for the POST
+// /control/filtering/rule_requests/submit HTTP API.
+func (d *DNSFilter) handleRuleRequestSubmit(w http.ResponseWriter, r *http.Request) {
+	req := &ruleRequestSubmitReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	rr, isNew, err := d.submitRuleRequest(req.Domain, req.Action, client, req.Comment)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errTooManyRuleRequests) {
+			code = http.StatusTooManyRequests
+		}
+
+		aghhttp.Error(r, w, code, "rule request: %s", err)
+
+		return
+	}
+
+	if isNew {
+		log.Info("filtering: %s requested to %s %q", rr.Client, rr.Action, rr.Domain)
+
+		d.Config.ConfigModified()
+		if d.OnRuleRequest != nil {
+			d.OnRuleRequest(rr)
+		}
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, rr)
+}
+
+// ruleRequestsResp is the response of the GET /control/filtering/rule_requests
+// HTTP API.
+type ruleRequestsResp struct {
+	Requests []*RuleRequest `json:"requests"`
+}
+
+// handleRuleRequests is the handler for the GET
+// /control/filtering/rule_requests HTTP API.
+func (d *DNSFilter) handleRuleRequests(w http.ResponseWriter, r *http.Request) {
+	resp := &ruleRequestsResp{
+		Requests: d.ruleRequests(),
+	}
+
+	if resp.Requests == nil {
+		resp.Requests = []*RuleRequest{}
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// ruleRequestIDReq is the request of the HTTP APIs changing a single rule
+// change request.
+type ruleRequestIDReq struct {
+	ID string `json:"id"`
+}
+
+// handleRuleRequestApprove is the handler for the POST
+// /control/filtering/rule_requests/approve HTTP API.
+func (d *DNSFilter) handleRuleRequestApprove(w http.ResponseWriter, r *http.Request) {
+	d.handleRuleRequestDecision(w, r, true)
+}
+
+// handleRuleRequestReject is the handler for the POST
+// /control/filtering/rule_requests/reject HTTP API.
+func (d *DNSFilter) handleRuleRequestReject(w http.ResponseWriter, r *http.Request) {
+	d.handleRuleRequestDecision(w, r, false)
+}
+
+// handleRuleRequestDecision either approves or rejects the rule change request
+// from r.
+func (d *DNSFilter) handleRuleRequestDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	req := &ruleRequestIDReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	var rr *RuleRequest
+	var ok bool
+	if approve {
+		rr, ok = d.approveRuleRequest(req.ID)
+	} else {
+		rr, ok = d.removeRuleRequest(req.ID)
+	}
+
+	if !ok {
+		aghhttp.Error(r, w, http.StatusNotFound, "rule request %q not found", req.ID)
+
+		return
+	}
+
+	log.Info("filtering: request to %s %q approved: %t", rr.Action, rr.Domain, approve)
+
+	d.Config.ConfigModified()
+
+	aghhttp.OK(w)
+}
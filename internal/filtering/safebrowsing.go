@@ -14,7 +14,6 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/dnsproxy/upstream"
-	"github.com/AdguardTeam/golibs/cache"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/miekg/dns"
@@ -113,9 +112,13 @@ func (c *sbCtx) getCached() int {
 		// nolint:looppointer // The subsilce is used for a safe cache lookup.
 		val := c.cache.Get(k[0:2])
 		if val == nil || now >= int64(binary.BigEndian.Uint32(val)) {
+			c.cache.countLookup(false)
 			hashesToRequest[k] = v
+
 			continue
 		}
+
+		c.cache.countLookup(true)
 		if hash32, found := c.findInHash(val); found {
 			log.Debug("%s: found in cache: %s: blocked by %v", c.svc, c.host, hash32)
 			return 1
@@ -135,7 +138,7 @@ type sbCtx struct {
 	host       string
 	svc        string
 	hashToHost map[[32]byte]string
-	cache      cache.Cache
+	cache      *hashCache
 	cacheTime  uint
 }
 
@@ -404,8 +407,10 @@ func (d *DNSFilter) handleSafeBrowsingDisable(w http.ResponseWriter, r *http.Req
 
 func (d *DNSFilter) handleSafeBrowsingStatus(w http.ResponseWriter, r *http.Request) {
 	resp := &struct {
-		Enabled bool `json:"enabled"`
+		Cache   *cacheStatsJSON `json:"cache"`
+		Enabled bool            `json:"enabled"`
 	}{
+		Cache:   d.safebrowsingCache.stats(),
 		Enabled: protectedBool(&d.confLock, &d.Config.SafeBrowsingEnabled),
 	}
 
@@ -424,8 +429,10 @@ func (d *DNSFilter) handleParentalDisable(w http.ResponseWriter, r *http.Request
 
 func (d *DNSFilter) handleParentalStatus(w http.ResponseWriter, r *http.Request) {
 	resp := &struct {
-		Enabled bool `json:"enabled"`
+		Cache   *cacheStatsJSON `json:"cache"`
+		Enabled bool            `json:"enabled"`
 	}{
+		Cache:   d.parentalCache.stats(),
 		Enabled: protectedBool(&d.confLock, &d.Config.ParentalEnabled),
 	}
 
@@ -43,8 +43,7 @@ func TestSafeBrowsingCache(t *testing.T) {
 		svc:       "SafeBrowsing",
 		cacheTime: 100,
 	}
-	conf := cache.Config{}
-	c.cache = cache.New(conf)
+	c.cache = newHashCache(0, "")
 
 	// store in cache hashes for "3.sub.host.com" and "host.com"
 	//  and empty data for hash-prefix for "sub.host.com"
@@ -95,8 +94,7 @@ func TestSafeBrowsingCache(t *testing.T) {
 		svc:       "SafeBrowsing",
 		cacheTime: 100,
 	}
-	conf = cache.Config{}
-	c.cache = cache.New(conf)
+	c.cache = newHashCache(0, "")
 
 	hash = sha256.Sum256([]byte("sub.host.com"))
 	c.hashToHost = make(map[[32]byte]string)
@@ -1,6 +1,8 @@
 package filtering
 
 import (
+	"fmt"
+
 	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 )
@@ -26,11 +28,32 @@ type SafeSearchConfig struct {
 	// enabled or disabled.
 
 	Bing       bool `yaml:"bing" json:"bing"`
+	Brave      bool `yaml:"brave" json:"brave"`
 	DuckDuckGo bool `yaml:"duckduckgo" json:"duckduckgo"`
+	Ecosia     bool `yaml:"ecosia" json:"ecosia"`
 	Google     bool `yaml:"google" json:"google"`
 	Pixabay    bool `yaml:"pixabay" json:"pixabay"`
+	Qwant      bool `yaml:"qwant" json:"qwant"`
 	Yandex     bool `yaml:"yandex" json:"yandex"`
 	YouTube    bool `yaml:"youtube" json:"youtube"`
+
+	// Regions are the lowercase two-letter country codes of the regions, the
+	// country-specific domains of the regional search engines, like Google and
+	// Yandex, are protected for.  If empty, the domains of all regions are
+	// protected.  The generic domains, like google.com, are always protected.
+	Regions []string `yaml:"regions,omitempty" json:"regions,omitempty"`
+}
+
+// ValidateRegions returns an error if any of the regions isn't a lowercase
+// two-letter country code.
+func (c *SafeSearchConfig) ValidateRegions() (err error) {
+	for _, r := range c.Regions {
+		if len(r) != 2 || r[0] < 'a' || r[0] > 'z' || r[1] < 'a' || r[1] > 'z' {
+			return fmt.Errorf("bad region %q: must be a lowercase two-letter country code", r)
+		}
+	}
+
+	return nil
 }
 
 // checkSafeSearch checks host with safe search engine.  Matches
@@ -1,34 +1,132 @@
 package safesearch
 
-import _ "embed"
+import (
+	"embed"
+	"fmt"
+	"strings"
 
-//go:embed rules/bing.txt
-var bing string
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+)
 
-//go:embed rules/google.txt
-var google string
+// rulesFS contains the rules texts of the search engines in files named after
+// the services.  Source rules downloaded from:
+// https://adguardteam.github.io/HostlistsRegistry/assets/engines_safe_search.txt,
+// https://adguardteam.github.io/HostlistsRegistry/assets/youtube_safe_search.txt.
+//
+//go:embed rules/*.txt
+var rulesFS embed.FS
 
-//go:embed rules/pixabay.txt
-var pixabay string
+// engine is a search provider, the safe search of which is enforced by the DNS
+// rewrite rules from rulesFS.
+type engine struct {
+	// isProtected returns true if the safe search of the engine is enabled in
+	// conf.
+	isProtected func(conf filtering.SafeSearchConfig) (ok bool)
 
-//go:embed rules/duckduckgo.txt
-var duckduckgo string
+	// service is the name of the engine, which is also the name of its rules
+	// file.
+	service Service
 
-//go:embed rules/yandex.txt
-var yandex string
+	// regional is true if the engine has country-specific domains, which are
+	// only protected for the regions from the configuration.
+	regional bool
+}
 
-//go:embed rules/youtube.txt
-var youtube string
+// engines is the registry of the supported search providers.  To support a new
+// one, add its rules file, its flag in [filtering.SafeSearchConfig], and its
+// entry here.
+var engines = []*engine{{
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Bing },
+	service:     Bing,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Brave },
+	service:     Brave,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.DuckDuckGo },
+	service:     DuckDuckGo,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Ecosia },
+	service:     Ecosia,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Google },
+	service:     Google,
+	regional:    true,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Pixabay },
+	service:     Pixabay,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Qwant },
+	service:     Qwant,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.Yandex },
+	service:     Yandex,
+	regional:    true,
+}, {
+	isProtected: func(c filtering.SafeSearchConfig) (ok bool) { return c.YouTube },
+	service:     YouTube,
+}}
 
-// safeSearchRules is a map with rules texts grouped by search providers.
-// Source rules downloaded from:
-// https://adguardteam.github.io/HostlistsRegistry/assets/engines_safe_search.txt,
-// https://adguardteam.github.io/HostlistsRegistry/assets/youtube_safe_search.txt.
-var safeSearchRules = map[Service]string{
-	Bing:       bing,
-	DuckDuckGo: duckduckgo,
-	Google:     google,
-	Pixabay:    pixabay,
-	Yandex:     yandex,
-	YouTube:    youtube,
+// rules returns the rules of e, which are applicable to regions.  If regions
+// is empty, all rules are returned.
+func (e *engine) rules(regions []string) (rules []string, err error) {
+	data, err := rulesFS.ReadFile("rules/" + string(e.service) + ".txt")
+	if err != nil {
+		return nil, fmt.Errorf("reading rules of %q: %w", e.service, err)
+	}
+
+	for _, r := range strings.Split(string(data), "\n") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		if e.regional && !inRegions(ruleRegion(r), regions) {
+			continue
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// idnRegions are the regions of the internationalized country code top-level
+// domains.
+var idnRegions = map[string]string{
+	// .рф
+	"xn--p1ai": "ru",
+}
+
+// ruleRegion returns the region of the host of the safe search rule, which is
+// the country code top-level domain.  region is empty if the host has a
+// generic top-level domain, like com.
+func ruleRegion(rule string) (region string) {
+	host := strings.TrimPrefix(rule, "|")
+	if i := strings.IndexAny(host, "^$"); i != -1 {
+		host = host[:i]
+	}
+
+	tld := host[strings.LastIndexByte(host, '.')+1:]
+	if len(tld) == 2 {
+		return tld
+	}
+
+	return idnRegions[tld]
+}
+
+// inRegions returns true if the domains of region should be protected for the
+// regions.  Generic domains, which have an empty region, are always protected,
+// as well as all domains if regions is empty.
+func inRegions(region string, regions []string) (ok bool) {
+	if region == "" || len(regions) == 0 {
+		return true
+	}
+
+	for _, r := range regions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -26,33 +26,16 @@ type Service string
 // Service enum members.
 const (
 	Bing       Service = "bing"
+	Brave      Service = "brave"
 	DuckDuckGo Service = "duckduckgo"
+	Ecosia     Service = "ecosia"
 	Google     Service = "google"
 	Pixabay    Service = "pixabay"
+	Qwant      Service = "qwant"
 	Yandex     Service = "yandex"
 	YouTube    Service = "youtube"
 )
 
-// isServiceProtected returns true if the service safe search is active.
-func isServiceProtected(s filtering.SafeSearchConfig, service Service) (ok bool) {
-	switch service {
-	case Bing:
-		return s.Bing
-	case DuckDuckGo:
-		return s.DuckDuckGo
-	case Google:
-		return s.Google
-	case Pixabay:
-		return s.Pixabay
-	case Yandex:
-		return s.Yandex
-	case YouTube:
-		return s.YouTube
-	default:
-		panic(fmt.Errorf("safesearch: invalid sources: not found service %q", service))
-	}
-}
-
 // DefaultSafeSearch is the default safesearch struct.
 type DefaultSafeSearch struct {
 	engine          *urlfilter.DNSEngine
@@ -91,16 +74,25 @@ func NewDefaultSafeSearch(
 
 // newEngine creates new engine for provided safe search configuration.
 func newEngine(listID int, conf filtering.SafeSearchConfig) (engine *urlfilter.DNSEngine, err error) {
-	var sb strings.Builder
-	for service, serviceRules := range safeSearchRules {
-		if isServiceProtected(conf, service) {
-			sb.WriteString(serviceRules)
+	var rulesText []string
+	for _, e := range engines {
+		if !e.isProtected(conf) {
+			continue
 		}
+
+		var engineRules []string
+		engineRules, err = e.rules(conf.Regions)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return nil, err
+		}
+
+		rulesText = append(rulesText, engineRules...)
 	}
 
 	strList := &filterlist.StringRuleList{
 		ID:             listID,
-		RulesText:      sb.String(),
+		RulesText:      strings.Join(rulesText, "\n"),
 		IgnoreCosmetic: true,
 	}
 
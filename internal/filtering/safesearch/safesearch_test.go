@@ -22,9 +22,12 @@ const (
 var defaultSafeSearchConf = filtering.SafeSearchConfig{
 	Enabled:    true,
 	Bing:       true,
+	Brave:      true,
 	DuckDuckGo: true,
+	Ecosia:     true,
 	Google:     true,
 	Pixabay:    true,
+	Qwant:      true,
 	Yandex:     true,
 	YouTube:    true,
 }
@@ -100,6 +103,95 @@ func TestCheckHostSafeSearchGoogle(t *testing.T) {
 	}
 }
 
+func TestSafeSearch_engines(t *testing.T) {
+	ss := newForTest(t, defaultSafeSearchConf)
+
+	testCases := []struct {
+		host string
+		want string
+	}{{
+		host: "search.brave.com",
+		want: "safesearch.brave.com",
+	}, {
+		host: "www.ecosia.org",
+		want: "strict-safe-search.ecosia.org",
+	}, {
+		host: "api.qwant.com",
+		want: "safeapi.qwant.com",
+	}, {
+		host: "www.bing.com",
+		want: "strict.bing.com",
+	}, {
+		host: "duckduckgo.com",
+		want: "safe.duckduckgo.com",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			rewrite := ss.SearchHost(tc.host, dns.TypeA)
+			require.NotNil(t, rewrite)
+
+			assert.Equal(t, tc.want, rewrite.NewCNAME)
+		})
+	}
+}
+
+func TestSafeSearch_regions(t *testing.T) {
+	conf := defaultSafeSearchConf
+	conf.Regions = []string{"de", "ru"}
+
+	ss := newForTest(t, conf)
+
+	testCases := []struct {
+		want assert.BoolAssertionFunc
+		host string
+	}{{
+		want: assert.True,
+		host: "www.google.com",
+	}, {
+		want: assert.True,
+		host: "www.google.de",
+	}, {
+		want: assert.False,
+		host: "www.google.fr",
+	}, {
+		want: assert.False,
+		host: "www.google.co.uk",
+	}, {
+		want: assert.True,
+		host: "yandex.com",
+	}, {
+		want: assert.True,
+		host: "yandex.ru",
+	}, {
+		want: assert.True,
+		host: "xn--d1acpjx3f.xn--p1ai",
+	}, {
+		want: assert.False,
+		host: "yandex.com.tr",
+	}, {
+		want: assert.True,
+		host: "www.bing.com",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			tc.want(t, ss.SearchHost(tc.host, dns.TypeA) != nil)
+		})
+	}
+}
+
+func TestEngines(t *testing.T) {
+	for _, e := range engines {
+		t.Run(string(e.service), func(t *testing.T) {
+			engineRules, err := e.rules(nil)
+			require.NoError(t, err)
+
+			assert.NotEmpty(t, engineRules)
+		})
+	}
+}
+
 func TestSafeSearchCacheYandex(t *testing.T) {
 	const domain = "yandex.ru"
 
@@ -50,6 +50,13 @@ func (d *DNSFilter) handleSafeSearchSettings(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	err = req.ValidateRegions()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "safe search: %s", err)
+
+		return
+	}
+
 	func() {
 		d.confLock.Lock()
 		defer d.confLock.Unlock()
@@ -0,0 +1,407 @@
+package filtering
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Threat Intelligence Feeds
+
+// FilterFormat is the format of the contents of a filter list.
+type FilterFormat string
+
+// Valid FilterFormat values.
+const (
+	// FilterFormatRules is the default format of the filtering rules.
+	FilterFormatRules FilterFormat = ""
+
+	// FilterFormatCSV is the threat intelligence feed of the comma-separated
+	// indicators of compromise.  The first column is a domain name or a URL,
+	// and the optional second column is the threat category.
+	FilterFormatCSV FilterFormat = "csv"
+
+	// FilterFormatSTIX is the threat intelligence feed in the STIX 2 format,
+	// either a bundle or a TAXII 2.1 envelope.  Only the indicators with the
+	// domain-name and the url patterns are used.
+	FilterFormatSTIX FilterFormat = "stix"
+)
+
+// validate returns an error if f isn't a valid filter list format.
+func (f FilterFormat) validate() (err error) {
+	switch f {
+	case FilterFormatRules, FilterFormatCSV, FilterFormatSTIX:
+		return nil
+	default:
+		return fmt.Errorf("bad filter list format %q", f)
+	}
+}
+
+// isThreatFeed returns true if f is a threat intelligence feed format.
+func (f FilterFormat) isThreatFeed() (ok bool) {
+	return f == FilterFormatCSV || f == FilterFormatSTIX
+}
+
+// validateListFormat returns an error if f isn't a valid format of a filter
+// list.  Threat intelligence feeds can only be blocklists.
+func validateListFormat(f FilterFormat, isAllowlist bool) (err error) {
+	if isAllowlist && f != FilterFormatRules {
+		return errThreatFeedAllowlist
+	}
+
+	return f.validate()
+}
+
+// validateFilterFormats returns an error if any of the lists has an invalid
+// format.
+func validateFilterFormats(block, allow []FilterYAML) (err error) {
+	for _, f := range block {
+		err = validateListFormat(f.Format, false)
+		if err != nil {
+			return fmt.Errorf("filter list %d: %w", f.ID, err)
+		}
+	}
+
+	for _, f := range allow {
+		err = validateListFormat(f.Format, true)
+		if err != nil {
+			return fmt.Errorf("allowlist %d: %w", f.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// errThreatFeedAllowlist is returned when an allowlist has a threat
+// intelligence feed format.
+const errThreatFeedAllowlist errors.Error = "threat feeds can only be blocklists"
+
+// ThreatMatch is the result of matching a host against a threat intelligence
+// feed.
+type ThreatMatch struct {
+	// Feed is the name of the matched feed.
+	Feed string `json:",omitempty"`
+
+	// Category is the threat category of the matched indicator.
+	Category string `json:",omitempty"`
+}
+
+// threatFeed is a loaded threat intelligence feed.
+type threatFeed struct {
+	// categories are the threat categories by the texts of the rules, which
+	// the indicators have been converted to.
+	categories map[string]string
+
+	// name is the name of the feed.
+	name string
+}
+
+// threatMatch returns the threat match for the rules of a blocking result, if
+// any of them is from a threat intelligence feed.  d.engineLock is expected to
+// be locked.
+func (d *DNSFilter) threatMatch(rules []*ResultRule) (m *ThreatMatch) {
+	for _, r := range rules {
+		feed, ok := d.threatFeeds[r.FilterListID]
+		if !ok {
+			continue
+		}
+
+		cat, ok := feed.categories[r.Text]
+		if !ok {
+			cat = defaultThreatCategory
+		}
+
+		return &ThreatMatch{
+			Feed:     feed.name,
+			Category: cat,
+		}
+	}
+
+	return nil
+}
+
+const (
+	// threatCategoryPrefix is the prefix of the comment lines in the converted
+	// threat intelligence feeds, which set the category of the following
+	// rules.
+	threatCategoryPrefix = "! Threat category: "
+
+	// defaultThreatCategory is the category of the indicators, which have none.
+	defaultThreatCategory = "unknown"
+
+	// taxiiAccept is the value of the Accept header for requesting the STIX
+	// feeds, which also makes TAXII 2.1 servers respond.
+	taxiiAccept = "application/taxii+json;version=2.1, application/stix+json, application/json"
+)
+
+// convertThreatFeed parses the threat intelligence feed of format from src and
+// returns the filtering rules blocking its indicators.  The rules are sorted
+// and grouped by category to keep the checksum of unchanged feeds stable.
+func convertThreatFeed(format FilterFormat, src io.Reader) (rules *bytes.Buffer, err error) {
+	var iocs map[string]string
+	switch format {
+	case FilterFormatCSV:
+		iocs, err = parseCSVFeed(src)
+	case FilterFormatSTIX:
+		iocs, err = parseSTIXFeed(src, time.Now())
+	default:
+		return nil, fmt.Errorf("bad threat feed format %q", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	byCat := map[string][]string{}
+	for host, cat := range iocs {
+		byCat[cat] = append(byCat[cat], host)
+	}
+
+	cats := maps.Keys(byCat)
+	slices.Sort(cats)
+
+	rules = &bytes.Buffer{}
+	for _, cat := range cats {
+		hosts := byCat[cat]
+		slices.Sort(hosts)
+
+		_, _ = fmt.Fprintf(rules, "%s%s\n", threatCategoryPrefix, cat)
+		for _, h := range hosts {
+			_, _ = fmt.Fprintf(rules, "||%s^\n", h)
+		}
+	}
+
+	return rules, nil
+}
+
+// iocHost returns the normalized domain name from the indicator value, which is
+// either a domain name or a URL.  ok is false if v is neither.  Single-label
+// names, such as the ones in headers, are rejected, since blocking them would
+// block whole top-level domains.
+func iocHost(v string) (host string, ok bool) {
+	v = strings.TrimSpace(v)
+	if strings.Contains(v, "://") {
+		u, err := url.Parse(v)
+		if err != nil {
+			return "", false
+		}
+
+		v = u.Hostname()
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(v, "."))
+	if !strings.Contains(host, ".") ||
+		net.ParseIP(host) != nil ||
+		netutil.ValidateDomainName(host) != nil {
+		return "", false
+	}
+
+	return host, true
+}
+
+// normalizeThreatCategory returns the normalized category, which is safe to
+// use in the converted feed.
+func normalizeThreatCategory(cat string) (norm string) {
+	norm = strings.ToLower(strings.Join(strings.Fields(cat), " "))
+	if norm == "" {
+		return defaultThreatCategory
+	}
+
+	return norm
+}
+
+// addIOC adds the indicator to iocs, unless it's already there.
+func addIOC(iocs map[string]string, v, cat string) {
+	host, ok := iocHost(v)
+	if !ok {
+		return
+	}
+
+	if _, ok = iocs[host]; !ok {
+		iocs[host] = normalizeThreatCategory(cat)
+	}
+}
+
+// parseCSVFeed returns the categories of the indicators from the CSV feed by
+// their domain names.  The lines starting with "#" are comments, and the rows
+// without a valid domain name or URL in the first column, such as the header,
+// are skipped.
+func parseCSVFeed(src io.Reader) (iocs map[string]string, err error) {
+	r := csv.NewReader(src)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	iocs = map[string]string{}
+	for {
+		var rec []string
+		rec, err = r.Read()
+		if errors.Is(err, io.EOF) {
+			return iocs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading csv: %w", err)
+		}
+
+		var cat string
+		if len(rec) > 1 {
+			cat = rec[1]
+		}
+
+		addIOC(iocs, rec[0], cat)
+	}
+}
+
+// stixObject is the part of a STIX 2 object used to get the indicators.
+type stixObject struct {
+	Type           string   `json:"type"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidUntil     string   `json:"valid_until"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Labels         []string `json:"labels"`
+	Revoked        bool     `json:"revoked"`
+}
+
+// stixEnvelope is either a STIX 2 bundle or a TAXII 2.1 envelope.
+type stixEnvelope struct {
+	Objects []*stixObject `json:"objects"`
+}
+
+// stixPatternRe matches the comparisons of the domain-name and url values in
+// the STIX patterns.
+var stixPatternRe = regexp.MustCompile(`(?:domain-name|url):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// parseSTIXFeed returns the categories of the indicators from the STIX feed by
+// their domain names.  Revoked indicators and the ones expired before now are
+// skipped.
+func parseSTIXFeed(src io.Reader, now time.Time) (iocs map[string]string, err error) {
+	env := &stixEnvelope{}
+	err = json.NewDecoder(src).Decode(env)
+	if err != nil {
+		return nil, fmt.Errorf("decoding stix: %w", err)
+	}
+
+	iocs = map[string]string{}
+	for _, o := range env.Objects {
+		if !o.isActiveIndicator(now) {
+			continue
+		}
+
+		var cat string
+		if len(o.IndicatorTypes) > 0 {
+			cat = o.IndicatorTypes[0]
+		} else if len(o.Labels) > 0 {
+			// STIX 2.0 uses labels for the indicator types.
+			cat = o.Labels[0]
+		}
+
+		for _, m := range stixPatternRe.FindAllStringSubmatch(o.Pattern, -1) {
+			addIOC(iocs, strings.ReplaceAll(m[1], `\'`, `'`), cat)
+		}
+	}
+
+	return iocs, nil
+}
+
+// isActiveIndicator returns true if o is a STIX pattern indicator, which is
+// neither revoked nor expired before now.
+func (o *stixObject) isActiveIndicator(now time.Time) (ok bool) {
+	if o == nil || o.Type != "indicator" || o.Revoked {
+		return false
+	}
+
+	if o.PatternType != "" && o.PatternType != "stix" {
+		return false
+	}
+
+	if o.ValidUntil == "" {
+		return true
+	}
+
+	validUntil, err := time.Parse(time.RFC3339, o.ValidUntil)
+
+	return err != nil || validUntil.After(now)
+}
+
+// readThreatCategories returns the categories of the rules of the converted
+// threat intelligence feed by their texts.
+func readThreatCategories(src io.Reader) (cats map[string]string, err error) {
+	cats = map[string]string{}
+	cat := defaultThreatCategory
+
+	s := bufio.NewScanner(src)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, threatCategoryPrefix):
+			cat = strings.TrimPrefix(line, threatCategoryPrefix)
+		case line == "", line[0] == '!', line[0] == '#':
+			// Go on.
+		default:
+			cats[line] = cat
+		}
+	}
+
+	return cats, s.Err()
+}
+
+// loadThreatFeed loads the categories of the converted threat intelligence
+// feed flt from the data directory.
+func (d *DNSFilter) loadThreatFeed(flt *FilterYAML) (feed *threatFeed, err error) {
+	f, err := os.Open(flt.Path(d.DataDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return &threatFeed{name: flt.Name}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	cats, err := readThreatCategories(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading categories: %w", err)
+	}
+
+	return &threatFeed{
+		categories: cats,
+		name:       flt.Name,
+	}, nil
+}
+
+// loadThreatFeeds returns the loaded enabled threat intelligence feeds from
+// lists by their IDs.  The feeds, which failed to load, are only logged, since
+// their rules are still applied.
+func (d *DNSFilter) loadThreatFeeds(lists []FilterYAML) (feeds map[int64]*threatFeed) {
+	feeds = map[int64]*threatFeed{}
+	for i := range lists {
+		flt := &lists[i]
+		if !flt.Enabled || !flt.Format.isThreatFeed() {
+			continue
+		}
+
+		feed, err := d.loadThreatFeed(flt)
+		if err != nil {
+			log.Error("filtering: loading threat feed %d: %s", flt.ID, err)
+
+			feed = &threatFeed{name: flt.Name}
+		}
+
+		feeds[flt.ID] = feed
+	}
+
+	return feeds
+}
@@ -0,0 +1,206 @@
+package filtering
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSVFeed(t *testing.T) {
+	const feed = `# Example feed
+domain,category
+evil.example,Malware
+https://Phish.Example/login?id=1, phishing
+c2.example.
+1.2.3.4,botnet
+evil.example,phishing
+`
+
+	iocs, err := parseCSVFeed(strings.NewReader(feed))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"evil.example":  "malware",
+		"phish.example": "phishing",
+		"c2.example":    defaultThreatCategory,
+	}, iocs)
+}
+
+func TestParseSTIXFeed(t *testing.T) {
+	const feed = `{
+  "type": "bundle",
+  "id": "bundle--1",
+  "objects": [{
+    "type": "indicator",
+    "pattern": "[domain-name:value = 'evil.example']",
+    "pattern_type": "stix",
+    "indicator_types": ["malicious-activity"]
+  }, {
+    "type": "indicator",
+    "pattern": "[url:value = 'http://phish.example/a'] OR [domain-name:value = 'phish2.example']",
+    "labels": ["phishing"]
+  }, {
+    "type": "indicator",
+    "pattern": "[ipv4-addr:value = '1.2.3.4']",
+    "pattern_type": "stix"
+  }, {
+    "type": "indicator",
+    "pattern": "[domain-name:value = 'revoked.example']",
+    "revoked": true
+  }, {
+    "type": "indicator",
+    "pattern": "[domain-name:value = 'expired.example']",
+    "valid_until": "2020-01-01T00:00:00Z"
+  }, {
+    "type": "indicator",
+    "pattern": "domain-name:value = 'sigma.example'",
+    "pattern_type": "sigma"
+  }, {
+    "type": "malware",
+    "name": "Evil"
+  }]
+}`
+
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	iocs, err := parseSTIXFeed(strings.NewReader(feed), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"evil.example":   "malicious-activity",
+		"phish.example":  "phishing",
+		"phish2.example": "phishing",
+	}, iocs)
+
+	t.Run("taxii_envelope", func(t *testing.T) {
+		const envelope = `{
+  "more": false,
+  "objects": [{
+    "type": "indicator",
+    "pattern": "[domain-name:value = 'evil.example']",
+    "indicator_types": ["Anomalous Activity"]
+  }]
+}`
+
+		iocs, err = parseSTIXFeed(strings.NewReader(envelope), now)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"evil.example": "anomalous activity"}, iocs)
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		_, err = parseSTIXFeed(strings.NewReader("not json"), now)
+		testutil.AssertErrorMsg(
+			t,
+			"decoding stix: invalid character 'o' in literal null (expecting 'u')",
+			err,
+		)
+	})
+}
+
+func TestConvertThreatFeed(t *testing.T) {
+	const feed = `b.example,phishing
+a.example,malware
+c.example,phishing
+d.example
+`
+
+	rules, err := convertThreatFeed(FilterFormatCSV, strings.NewReader(feed))
+	require.NoError(t, err)
+
+	const wantRules = `! Threat category: malware
+||a.example^
+! Threat category: phishing
+||b.example^
+||c.example^
+! Threat category: unknown
+||d.example^
+`
+
+	assert.Equal(t, wantRules, rules.String())
+
+	cats, err := readThreatCategories(strings.NewReader(wantRules))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"||a.example^": "malware",
+		"||b.example^": "phishing",
+		"||c.example^": "phishing",
+		"||d.example^": "unknown",
+	}, cats)
+}
+
+func TestValidateListFormat(t *testing.T) {
+	testCases := []struct {
+		name        string
+		wantErrMsg  string
+		format      FilterFormat
+		isAllowlist bool
+	}{{
+		name:        "rules",
+		wantErrMsg:  "",
+		format:      FilterFormatRules,
+		isAllowlist: true,
+	}, {
+		name:        "csv",
+		wantErrMsg:  "",
+		format:      FilterFormatCSV,
+		isAllowlist: false,
+	}, {
+		name:        "stix_allowlist",
+		wantErrMsg:  "threat feeds can only be blocklists",
+		format:      FilterFormatSTIX,
+		isAllowlist: true,
+	}, {
+		name:        "bad",
+		wantErrMsg:  `bad filter list format "xml"`,
+		format:      "xml",
+		isAllowlist: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateListFormat(tc.format, tc.isAllowlist)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestDNSFilter_CheckHost_threat(t *testing.T) {
+	const (
+		feedID   = 1
+		listID   = 2
+		feedRule = "||evil.example^"
+	)
+
+	f, setts := newForTest(t, nil, []Filter{{
+		ID:   feedID,
+		Data: []byte("! Threat category: malware\n" + feedRule + "\n"),
+	}, {
+		ID:   listID,
+		Data: []byte("||ads.example^\n"),
+	}})
+	f.threatFeeds = map[int64]*threatFeed{
+		feedID: {
+			categories: map[string]string{feedRule: "malware"},
+			name:       "Feed",
+		},
+	}
+
+	res, err := f.CheckHost("www.evil.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Equal(t, FilteredBlockList, res.Reason)
+	assert.Equal(t, &ThreatMatch{Feed: "Feed", Category: "malware"}, res.Threat)
+
+	res, err = f.CheckHost("ads.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Nil(t, res.Threat)
+}
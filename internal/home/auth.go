@@ -15,12 +15,13 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/timeutil"
 	"go.etcd.io/bbolt"
-	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/slices"
 )
 
 // cookieTTL is the time-to-live of the session cookie.
@@ -34,6 +35,12 @@ const sessionTokenSize = 16
 
 type session struct {
 	userName string
+
+	// role is the role of a user authenticated by an external identity
+	// provider, who isn't in the list of users.  It is empty for the local
+	// users.
+	role aghuser.Role
+
 	// expire is the expiration time, in seconds.
 	expire uint32
 }
@@ -43,10 +50,13 @@ func (s *session) serialize() []byte {
 		expireLen = 4
 		nameLen   = 2
 	)
-	data := make([]byte, expireLen+nameLen+len(s.userName))
+	data := make([]byte, expireLen+nameLen+len(s.userName)+len(s.role))
 	binary.BigEndian.PutUint32(data[0:4], s.expire)
 	binary.BigEndian.PutUint16(data[4:6], uint16(len(s.userName)))
 	copy(data[6:], []byte(s.userName))
+	// The role is stored after the name, so the sessions of the local users
+	// have the same format as before.
+	copy(data[6+len(s.userName):], []byte(s.role))
 	return data
 }
 
@@ -61,7 +71,8 @@ func (s *session) deserialize(data []byte) bool {
 	if len(data) < int(nameLen) {
 		return false
 	}
-	s.userName = string(data)
+	s.userName = string(data[:nameLen])
+	s.role = aghuser.Role(data[nameLen:])
 	return true
 }
 
@@ -73,12 +84,44 @@ type Auth struct {
 	users       []webUser
 	lock        sync.Mutex
 	sessionTTL  uint32
+
+	// totpKey is the key used to encrypt the TOTP secrets of the users.
+	totpKey []byte
+
+	// totpPending are the TOTP secrets of the users that have started but
+	// not yet confirmed the enrollment.
+	totpPending map[string][]byte
+
+	// totpLastSteps are the time steps of the last TOTP codes used by the
+	// users, which prevents using the same code twice.
+	totpLastSteps map[string]int64
+
+	// oidc is the OpenID Connect login.  It is nil if the OpenID Connect
+	// login is disabled.
+	oidc *oidcAuth
 }
 
 // webUser represents a user of the Web UI.
 type webUser struct {
 	Name         string `yaml:"name"`
 	PasswordHash string `yaml:"password"`
+
+	// Role is the role of the user.  If Role is empty, the user is an admin,
+	// since the users from the older configurations didn't have roles.
+	Role aghuser.Role `yaml:"role,omitempty"`
+
+	// TOTP is the two-factor authentication configuration of the user.  If
+	// TOTP is nil, the two-factor authentication is disabled.
+	TOTP *webUserTOTP `yaml:"totp,omitempty"`
+}
+
+// role returns the effective role of u.
+func (u *webUser) role() (r aghuser.Role) {
+	if u.Role == "" {
+		return aghuser.RoleAdmin
+	}
+
+	return u.Role
 }
 
 // InitAuth - create a global object
@@ -86,10 +129,12 @@ func InitAuth(dbFilename string, users []webUser, sessionTTL uint32, rateLimiter
 	log.Info("Initializing auth module: %s", dbFilename)
 
 	a := &Auth{
-		sessionTTL:  sessionTTL,
-		raleLimiter: rateLimiter,
-		sessions:    make(map[string]*session),
-		users:       users,
+		sessionTTL:    sessionTTL,
+		raleLimiter:   rateLimiter,
+		sessions:      make(map[string]*session),
+		users:         users,
+		totpPending:   map[string][]byte{},
+		totpLastSteps: map[string]int64{},
 	}
 	var err error
 	a.db, err = bbolt.Open(dbFilename, 0o644, nil)
@@ -102,6 +147,12 @@ func InitAuth(dbFilename string, users []webUser, sessionTTL uint32, rateLimiter
 		return nil
 	}
 	a.loadSessions()
+
+	err = a.loadTOTPKey()
+	if err != nil {
+		log.Error("auth: loading totp key: %s", err)
+	}
+
 	log.Info("auth: initialized.  users:%d  sessions:%d", len(a.users), len(a.sessions))
 
 	return a
@@ -312,6 +363,14 @@ func (a *Auth) RemoveSession(sess string) {
 type loginJSON struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
+
+	// Code is the TOTP code or a recovery code of a user with the two-factor
+	// authentication enabled.
+	Code string `json:"totp_code"`
+
+	// RememberDevice, if true, makes the server skip the second factor on
+	// this device for some time.
+	RememberDevice bool `json:"remember_device"`
 }
 
 // newSessionToken returns cryptographically secure randomly generated slice of
@@ -329,8 +388,9 @@ func newSessionToken() (data []byte, err error) {
 	return randData, nil
 }
 
-// newCookie creates a new authentication cookie.
-func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error) {
+// newCookie creates a new authentication cookie.  device is the remembered
+// device token, if any.
+func (a *Auth) newCookie(req loginJSON, addr, device string) (c *http.Cookie, err error) {
 	rateLimiter := a.raleLimiter
 	u, ok := a.findUser(req.Name, req.Password)
 	if !ok {
@@ -341,10 +401,26 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 		return nil, errors.Error("invalid username or password")
 	}
 
+	err = a.checkSecondFactor(u, req.Code, device)
+	if err != nil {
+		if rateLimiter != nil && errors.Is(err, errBadTOTP) {
+			rateLimiter.inc(addr)
+		}
+
+		return nil, err
+	}
+
 	if rateLimiter != nil {
 		rateLimiter.remove(addr)
 	}
 
+	return a.newSessionCookie(u.Name, "")
+}
+
+// newSessionCookie creates a new session for the user with name and returns
+// its cookie.  role must only be set for the users authenticated by an
+// external identity provider.
+func (a *Auth) newSessionCookie(name string, role aghuser.Role) (c *http.Cookie, err error) {
 	sess, err := newSessionToken()
 	if err != nil {
 		return nil, fmt.Errorf("generating token: %w", err)
@@ -353,7 +429,8 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 	now := time.Now().UTC()
 
 	a.addSession(sess, &session{
-		userName: u.Name,
+		userName: name,
+		role:     role,
 		expire:   uint32(now.Unix()) + a.sessionTTL,
 	})
 
@@ -442,8 +519,17 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	cookie, err := Context.auth.newCookie(req, remoteAddr)
-	if err != nil {
+	var device string
+	if c, cookieErr := r.Cookie(deviceCookieName); cookieErr == nil {
+		device = c.Value
+	}
+
+	cookie, err := Context.auth.newCookie(req, remoteAddr, device)
+	if errors.Is(err, errTOTPRequired) {
+		aghhttp.Error(r, w, http.StatusUnauthorized, "%s", err)
+
+		return
+	} else if err != nil {
 		aghhttp.Error(r, w, http.StatusForbidden, "%s", err)
 
 		return
@@ -461,6 +547,11 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	log.Info("auth: user %q successfully logged in from ip %v", req.Name, ip)
 
 	http.SetCookie(w, cookie)
+	if req.RememberDevice {
+		if dc := Context.auth.newDeviceCookie(req.Name); dc != nil {
+			http.SetCookie(w, dc)
+		}
+	}
 
 	h := w.Header()
 	h.Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
@@ -501,8 +592,22 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 
 // RegisterAuthHandlers - register handlers
 func RegisterAuthHandlers() {
-	Context.mux.Handle("/control/login", postInstallHandler(ensureHandler(http.MethodPost, handleLogin)))
+	Context.mux.Handle("/control/login", rateLimitHandler(postInstallHandler(ensureHandler(http.MethodPost, handleLogin))))
 	httpRegister(http.MethodGet, "/control/logout", handleLogout)
+
+	Context.mux.Handle("/control/oidc/login", rateLimitHandler(postInstallHandler(ensureHandler(http.MethodGet, handleOIDCLogin))))
+	Context.mux.Handle("/control/oidc/callback", rateLimitHandler(postInstallHandler(ensureHandler(http.MethodGet, handleOIDCCallback))))
+
+	httpRegister(http.MethodGet, "/control/users/list", handleGetUsers)
+	httpRegister(http.MethodPost, "/control/users/add", handleAddUser)
+	httpRegister(http.MethodPost, "/control/users/update", handleUpdateUser)
+	httpRegister(http.MethodPost, "/control/users/delete", handleDeleteUser)
+
+	httpRegister(http.MethodGet, "/control/totp/status", handleTOTPStatus)
+	httpRegister(http.MethodPost, "/control/totp/enroll", handleTOTPEnroll)
+	httpRegister(http.MethodPost, "/control/totp/confirm", handleTOTPConfirm)
+	httpRegister(http.MethodPost, "/control/totp/disable", handleTOTPDisable)
+	httpRegister(http.MethodPost, "/control/totp/recovery_codes", handleTOTPRecoveryCodes)
 }
 
 // optionalAuthThird return true if user should authenticate first.
@@ -514,28 +619,18 @@ func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
 	}
 
 	// redirect to login page if not authenticated
-	isAuthenticated := false
-	cookie, err := r.Cookie(sessionCookieName)
-	if err != nil {
-		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
-		// Check Basic authentication.
-		user, pass, hasBasic := r.BasicAuth()
-		if hasBasic {
-			_, isAuthenticated = Context.auth.findUser(user, pass)
-			if !isAuthenticated {
-				log.Info("auth: invalid Basic Authorization value")
-			}
-		}
-	} else {
-		res := Context.auth.checkSession(cookie.Value)
-		isAuthenticated = res == checkSessionOK
-		if !isAuthenticated {
-			log.Debug("auth: invalid cookie value: %s", cookie)
+	u, isAuthenticated := Context.auth.authenticate(r)
+	if isAuthenticated {
+		role, required := u.role(), requiredRole(r)
+		if role.Allows(required) {
+			return false
 		}
-	}
 
-	if isAuthenticated {
-		return false
+		log.Info("auth: user %q with role %s is not allowed to %s %s", u.Name, role, r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Forbidden"))
+
+		return true
 	}
 
 	if p := r.URL.Path; p == "/" || p == "/index.html" {
@@ -625,12 +720,12 @@ func (a *Auth) UserAdd(u *webUser, password string) {
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := aghuser.HashPassword(password, 0)
 	if err != nil {
-		log.Error("bcrypt.GenerateFromPassword: %s", err)
+		log.Error("auth: %s", err)
 		return
 	}
-	u.PasswordHash = string(hash)
+	u.PasswordHash = hash
 
 	a.lock.Lock()
 	a.users = append(a.users, *u)
@@ -645,8 +740,7 @@ func (a *Auth) findUser(login, password string) (u webUser, ok bool) {
 	defer a.lock.Unlock()
 
 	for _, u = range a.users {
-		if u.Name == login &&
-			bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil {
+		if u.Name == login && aghuser.PasswordMatches(u.PasswordHash, password) {
 			return u, true
 		}
 	}
@@ -654,20 +748,36 @@ func (a *Auth) findUser(login, password string) (u webUser, ok bool) {
 	return webUser{}, false
 }
 
-// getCurrentUser returns the current user.  It returns an empty User if the
-// user is not found.
-func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
+// authenticate returns the user that has sent r, either using the session
+// cookie or the Basic authentication.  ok is false if the credentials are
+// missing or invalid or if the user of the session doesn't exist anymore.
+func (a *Auth) authenticate(r *http.Request) (u webUser, ok bool) {
 	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil {
-		// There's no Cookie, check Basic authentication.
-		user, pass, ok := r.BasicAuth()
-		if ok {
-			u, _ = Context.auth.findUser(user, pass)
+		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
+		// Check Basic authentication.
+		user, pass, hasBasic := r.BasicAuth()
+		if !hasBasic {
+			return webUser{}, false
+		}
 
-			return u
+		u, ok = a.findUser(user, pass)
+		if !ok {
+			log.Info("auth: invalid Basic Authorization value")
+		} else if u.TOTP != nil {
+			// Basic authentication cannot carry the second factor.
+			log.Info("auth: user %q has two-factor authentication enabled, rejecting basic auth", user)
+
+			return webUser{}, false
 		}
 
-		return webUser{}
+		return u, ok
+	}
+
+	if a.checkSession(cookie.Value) != checkSessionOK {
+		log.Debug("auth: invalid cookie value: %s", cookie)
+
+		return webUser{}, false
 	}
 
 	a.lock.Lock()
@@ -675,22 +785,35 @@ func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
 
 	s, ok := a.sessions[cookie.Value]
 	if !ok {
-		return webUser{}
+		// The session has just been removed.
+		return webUser{}, false
+	} else if s.role != "" {
+		return webUser{Name: s.userName, Role: s.role}, true
 	}
 
 	for _, u = range a.users {
 		if u.Name == s.userName {
-			return u
+			return u, true
 		}
 	}
 
-	return webUser{}
+	log.Debug("auth: user %q of the session not found", s.userName)
+
+	return webUser{}, false
+}
+
+// getCurrentUser returns the current user.  It returns an empty User if the
+// user is not found.
+func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
+	u, _ = a.authenticate(r)
+
+	return u
 }
 
 // GetUsers - get users
 func (a *Auth) GetUsers() []webUser {
 	a.lock.Lock()
-	users := a.users
+	users := slices.Clone(a.users)
 	a.lock.Unlock()
 	return users
 }
@@ -702,7 +825,7 @@ func (a *Auth) AuthRequired() bool {
 	}
 
 	a.lock.Lock()
-	r := (len(a.users) != 0)
+	r := (len(a.users) != 0 || a.oidc != nil)
 	a.lock.Unlock()
 	return r
 }
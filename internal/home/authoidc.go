@@ -0,0 +1,329 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghoidc"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// OpenID Connect Login
+
+// oidcConfig is the configuration of the login with an OpenID Connect
+// provider, such as Keycloak or Authentik.
+type oidcConfig struct {
+	// RoleMapping maps the groups from GroupsClaim to the roles.  If a user is
+	// in several mapped groups, the most privileged role is used.
+	RoleMapping map[string]aghuser.Role `yaml:"role_mapping"`
+
+	// Issuer is the issuer URL of the provider.
+	Issuer string `yaml:"issuer"`
+
+	// ClientID is the client identifier registered with the provider.
+	ClientID string `yaml:"client_id"`
+
+	// ClientSecret is the secret of a confidential client.  It should be
+	// empty for public clients, which are only protected by PKCE.
+	ClientSecret string `yaml:"client_secret"`
+
+	// RedirectURL is the externally visible URL of the
+	// /control/oidc/callback handler.
+	RedirectURL string `yaml:"redirect_url"`
+
+	// UsernameClaim is the claim of the ID token used as the user name.
+	UsernameClaim string `yaml:"username_claim"`
+
+	// GroupsClaim is the claim of the ID token containing the groups of the
+	// user.
+	GroupsClaim string `yaml:"groups_claim"`
+
+	// DefaultRole is the role of the users that aren't in any of the groups
+	// from RoleMapping.  If it's empty, such users aren't allowed to log in.
+	DefaultRole aghuser.Role `yaml:"default_role"`
+
+	// Scopes are the requested scopes.
+	Scopes []string `yaml:"scopes"`
+
+	// Enabled defines if the login with the OpenID Connect provider is
+	// enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if c is enabled but invalid.
+func (c *oidcConfig) validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case c.ClientID == "":
+		return errors.Error("client_id is empty")
+	case c.UsernameClaim == "":
+		return errors.Error("username_claim is empty")
+	}
+
+	for _, f := range []struct {
+		name string
+		val  string
+	}{{
+		name: "issuer",
+		val:  c.Issuer,
+	}, {
+		name: "redirect_url",
+		val:  c.RedirectURL,
+	}} {
+		u, parseErr := url.Parse(f.val)
+		if parseErr != nil {
+			return fmt.Errorf("%s: %w", f.name, parseErr)
+		} else if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return fmt.Errorf("%s: %q is not an absolute http or https url", f.name, f.val)
+		}
+	}
+
+	if c.DefaultRole != "" {
+		err = c.DefaultRole.Validate()
+		if err != nil {
+			return fmt.Errorf("default_role: %w", err)
+		}
+	}
+
+	for g, r := range c.RoleMapping {
+		err = r.Validate()
+		if err != nil {
+			return fmt.Errorf("role_mapping: group %q: %w", g, err)
+		}
+	}
+
+	return nil
+}
+
+// oidc constants.
+const (
+	// oidcLoginTTL is the time a user has to complete the authentication with
+	// the provider.
+	oidcLoginTTL = 10 * time.Minute
+
+	// maxOIDCPending is the maximum number of the pending logins, which
+	// prevents the unauthenticated clients from consuming too much memory.
+	maxOIDCPending = 1000
+)
+
+// oidcPending is a login waiting for the redirect from the provider.
+type oidcPending struct {
+	expire   time.Time
+	nonce    string
+	verifier string
+}
+
+// oidcAuth is the login with an OpenID Connect provider.
+type oidcAuth struct {
+	conf *oidcConfig
+	cli  *http.Client
+
+	// mu protects provider and pending.
+	mu *sync.Mutex
+
+	// provider is discovered on the first login, since the provider may be
+	// unreachable when AdGuard Home starts.
+	provider *aghoidc.Provider
+
+	// pending are the pending logins by their states.
+	pending map[string]*oidcPending
+}
+
+// newOIDCAuth returns a new *oidcAuth.  conf must be valid.
+func newOIDCAuth(conf *oidcConfig, cli *http.Client) (o *oidcAuth) {
+	return &oidcAuth{
+		conf:    conf,
+		cli:     cli,
+		mu:      &sync.Mutex{},
+		pending: map[string]*oidcPending{},
+	}
+}
+
+// getProvider returns the provider, discovering it if necessary.  o.mu is
+// expected to be locked.
+func (o *oidcAuth) getProvider(ctx context.Context) (p *aghoidc.Provider, err error) {
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	p, err = aghoidc.Discover(ctx, &aghoidc.Config{
+		Client:       o.cli,
+		Issuer:       o.conf.Issuer,
+		ClientID:     o.conf.ClientID,
+		ClientSecret: o.conf.ClientSecret,
+		RedirectURL:  o.conf.RedirectURL,
+		Scopes:       o.conf.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o.provider = p
+
+	return p, nil
+}
+
+// authCodeURL starts a new login and returns the URL to redirect the user
+// agent to.
+func (o *oidcAuth) authCodeURL(ctx context.Context, now time.Time) (u string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p, err := o.getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for st, pl := range o.pending {
+		if !pl.expire.After(now) {
+			delete(o.pending, st)
+		}
+	}
+
+	if len(o.pending) >= maxOIDCPending {
+		return "", errors.Error("too many pending logins")
+	}
+
+	var state, nonce, verifier string
+	for _, s := range []*string{&state, &nonce, &verifier} {
+		*s, err = aghoidc.NewRandom()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	o.pending[state] = &oidcPending{
+		expire:   now.Add(oidcLoginTTL),
+		nonce:    nonce,
+		verifier: verifier,
+	}
+
+	return p.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// exchange finishes the login with state and returns the name and the role of
+// the user.
+func (o *oidcAuth) exchange(
+	ctx context.Context,
+	state string,
+	code string,
+	now time.Time,
+) (name string, role aghuser.Role, err error) {
+	o.mu.Lock()
+	pl, ok := o.pending[state]
+	delete(o.pending, state)
+	p := o.provider
+	o.mu.Unlock()
+
+	if !ok || !pl.expire.After(now) || p == nil {
+		return "", "", errors.Error("unknown or expired login")
+	}
+
+	claims, err := p.Exchange(ctx, code, pl.verifier, pl.nonce)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = claims.String(o.conf.UsernameClaim)
+	if name == "" {
+		return "", "", fmt.Errorf("no claim %q in id token", o.conf.UsernameClaim)
+	}
+
+	role = o.role(claims.Strings(o.conf.GroupsClaim))
+	if role == "" {
+		return "", "", fmt.Errorf("user %q is not in any of the allowed groups", name)
+	}
+
+	return name, role, nil
+}
+
+// role returns the most privileged role mapped from groups, the default role,
+// if there are none, or an empty role if the user isn't allowed to log in.
+func (o *oidcAuth) role(groups []string) (role aghuser.Role) {
+	for _, g := range groups {
+		r, ok := o.conf.RoleMapping[g]
+		if ok && (role == "" || r.Allows(role)) {
+			role = r
+		}
+	}
+
+	if role == "" {
+		return o.conf.DefaultRole
+	}
+
+	return role
+}
+
+// handleOIDCLogin is the handler for the GET /control/oidc/login HTTP API.  It
+// redirects the user agent to the provider.
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	o := Context.auth.oidc
+	if o == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "oidc login is disabled")
+
+		return
+	}
+
+	u, err := o.authCodeURL(r.Context(), time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "oidc: starting login: %s", err)
+
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// handleOIDCCallback is the handler for the GET /control/oidc/callback HTTP
+// API, to which the provider redirects the user agent after the
+// authentication.
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	o := Context.auth.oidc
+	if o == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "oidc login is disabled")
+
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		aghhttp.Error(r, w, http.StatusForbidden, "oidc: %s: %s", e, q.Get("error_description"))
+
+		return
+	}
+
+	name, role, err := o.exchange(r.Context(), q.Get("state"), q.Get("code"), time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusForbidden, "oidc: %s", err)
+
+		return
+	}
+
+	cookie, err := Context.auth.newSessionCookie(name, role)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "oidc: %s", err)
+
+		return
+	}
+
+	log.Info("auth: user %q with role %s logged in using oidc", name, role)
+
+	http.SetCookie(w, cookie)
+
+	h := w.Header()
+	h.Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
+	h.Set("Pragma", "no-cache")
+	h.Set("Expires", "0")
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,108 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCConfig_validate(t *testing.T) {
+	newConf := func() (c *oidcConfig) {
+		return &oidcConfig{
+			RoleMapping: map[string]aghuser.Role{
+				"agh-admins": aghuser.RoleAdmin,
+			},
+			Issuer:        "https://sso.example/realms/home",
+			ClientID:      "agh",
+			RedirectURL:   "https://agh.example/control/oidc/callback",
+			UsernameClaim: "preferred_username",
+			Enabled:       true,
+		}
+	}
+
+	testCases := []struct {
+		modify     func(c *oidcConfig)
+		name       string
+		wantErrMsg string
+	}{{
+		modify:     func(_ *oidcConfig) {},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		modify: func(c *oidcConfig) {
+			c.Enabled = false
+			c.ClientID = ""
+		},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		modify:     func(c *oidcConfig) { c.ClientID = "" },
+		name:       "no_client_id",
+		wantErrMsg: "client_id is empty",
+	}, {
+		modify:     func(c *oidcConfig) { c.Issuer = "sso.example" },
+		name:       "relative_issuer",
+		wantErrMsg: `issuer: "sso.example" is not an absolute http or https url`,
+	}, {
+		modify:     func(c *oidcConfig) { c.DefaultRole = "root" },
+		name:       "bad_default_role",
+		wantErrMsg: `default_role: bad role "root"`,
+	}, {
+		modify:     func(c *oidcConfig) { c.RoleMapping["agh-ops"] = "ops" },
+		name:       "bad_mapped_role",
+		wantErrMsg: `role_mapping: group "agh-ops": bad role "ops"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newConf()
+			tc.modify(c)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, c.validate())
+		})
+	}
+}
+
+func TestOIDCAuth_role(t *testing.T) {
+	o := newOIDCAuth(&oidcConfig{
+		RoleMapping: map[string]aghuser.Role{
+			"admins":    aghuser.RoleAdmin,
+			"operators": aghuser.RoleOperator,
+			"viewers":   aghuser.RoleViewer,
+		},
+	}, nil)
+
+	assert.Equal(t, aghuser.RoleAdmin, o.role([]string{"viewers", "admins", "operators"}))
+	assert.Equal(t, aghuser.RoleOperator, o.role([]string{"operators", "viewers"}))
+	assert.Equal(t, aghuser.Role(""), o.role([]string{"other"}))
+
+	o.conf.DefaultRole = aghuser.RoleViewer
+	assert.Equal(t, aghuser.RoleViewer, o.role(nil))
+}
+
+func TestAuth_oidcSession(t *testing.T) {
+	s := &session{userName: "jdoe", role: aghuser.RoleOperator, expire: 1}
+
+	got := &session{}
+	require.True(t, got.deserialize(s.serialize()))
+
+	assert.Equal(t, s, got)
+
+	a := newTestAuth(t)
+	cookie, err := a.newSessionCookie("jdoe", aghuser.RoleOperator)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+	r.AddCookie(cookie)
+
+	u, ok := a.authenticate(r)
+	require.True(t, ok)
+
+	assert.Equal(t, "jdoe", u.Name)
+	assert.Equal(t, aghuser.RoleOperator, u.role())
+}
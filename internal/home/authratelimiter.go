@@ -1,6 +1,7 @@
 package home
 
 import (
+	"net/netip"
 	"sync"
 	"time"
 )
@@ -20,19 +21,44 @@ type authRateLimiter struct {
 	failedAuths map[string]failedAuth
 	// failedAuthsLock protects failedAuths.
 	failedAuthsLock sync.Mutex
-	blockDur        time.Duration
-	maxAttempts     uint
+	// allowlist are the subnets, attempts from which are never blocked.
+	allowlist   []netip.Prefix
+	blockDur    time.Duration
+	maxAttempts uint
 }
 
 // newAuthRateLimiter returns properly initialized *authRateLimiter.
-func newAuthRateLimiter(blockDur time.Duration, maxAttempts uint) (ab *authRateLimiter) {
+func newAuthRateLimiter(
+	blockDur time.Duration,
+	maxAttempts uint,
+	allowlist []netip.Prefix,
+) (ab *authRateLimiter) {
 	return &authRateLimiter{
 		failedAuths: make(map[string]failedAuth),
+		allowlist:   allowlist,
 		blockDur:    blockDur,
 		maxAttempts: maxAttempts,
 	}
 }
 
+// isAllowlisted returns true if usrID is an IP address within one of the
+// trusted subnets.
+func (ab *authRateLimiter) isAllowlisted(usrID string) (ok bool) {
+	ip, err := netip.ParseAddr(usrID)
+	if err != nil {
+		return false
+	}
+
+	ip = ip.Unmap()
+	for _, p := range ab.allowlist {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // cleanupLocked checks each blocked users removing ones with expired TTL.  For
 // internal use only.
 func (ab *authRateLimiter) cleanupLocked(now time.Time) {
@@ -60,6 +86,10 @@ func (ab *authRateLimiter) checkLocked(usrID string, now time.Time) (left time.D
 // check returns the time left until unblocking.  The nonpositive result should
 // be interpreted as not blocked attempter.
 func (ab *authRateLimiter) check(usrID string) (left time.Duration) {
+	if ab.isAllowlisted(usrID) {
+		return 0
+	}
+
 	now := time.Now()
 
 	ab.failedAuthsLock.Lock()
@@ -93,6 +123,10 @@ func (ab *authRateLimiter) incLocked(usrID string, now time.Time) {
 
 // inc updates the failed attempt in cache.
 func (ab *authRateLimiter) inc(usrID string) {
+	if ab.isAllowlisted(usrID) {
+		return
+	}
+
 	now := time.Now()
 
 	ab.failedAuthsLock.Lock()
@@ -108,3 +142,38 @@ func (ab *authRateLimiter) remove(usrID string) {
 
 	delete(ab.failedAuths, usrID)
 }
+
+// blockedAuth is an attempter blocked by authRateLimiter.
+type blockedAuth struct {
+	until time.Time
+	usrID string
+}
+
+// blocked returns the attempters that are currently blocked.
+func (ab *authRateLimiter) blocked() (blocked []blockedAuth) {
+	now := time.Now()
+
+	ab.failedAuthsLock.Lock()
+	defer ab.failedAuthsLock.Unlock()
+
+	ab.cleanupLocked(now)
+
+	for usrID, a := range ab.failedAuths {
+		if a.num >= ab.maxAttempts {
+			blocked = append(blocked, blockedAuth{
+				until: a.until,
+				usrID: usrID,
+			})
+		}
+	}
+
+	return blocked
+}
+
+// removeAll stops any tracking and any blocking of all users.
+func (ab *authRateLimiter) removeAll() {
+	ab.failedAuthsLock.Lock()
+	defer ab.failedAuthsLock.Unlock()
+
+	ab.failedAuths = make(map[string]failedAuth)
+}
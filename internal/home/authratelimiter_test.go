@@ -2,6 +2,7 @@ package home
 
 import (
 	"net"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -205,3 +206,29 @@ func TestAuthRateLimiter_Remove(t *testing.T) {
 
 	assert.Empty(t, ab.failedAuths)
 }
+
+func TestAuthRateLimiter_allowlist(t *testing.T) {
+	const (
+		trustedIP   = "192.168.1.2"
+		untrustedIP = "192.168.2.2"
+	)
+
+	ab := newAuthRateLimiter(time.Hour, 1, []netip.Prefix{
+		netip.MustParsePrefix("192.168.1.0/24"),
+	})
+
+	ab.inc(trustedIP)
+	ab.inc(untrustedIP)
+
+	assert.Zero(t, ab.check(trustedIP))
+	assert.Positive(t, ab.check(untrustedIP))
+
+	blocked := ab.blocked()
+	require.Len(t, blocked, 1)
+
+	assert.Equal(t, untrustedIP, blocked[0].usrID)
+
+	ab.removeAll()
+
+	assert.Empty(t, ab.blocked())
+}
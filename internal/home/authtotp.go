@@ -0,0 +1,596 @@
+package home
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+	"golang.org/x/exp/slices"
+)
+
+// Two-Factor Authentication
+
+// webUserTOTP is the TOTP two-factor authentication configuration of a user.
+type webUserTOTP struct {
+	// Secret is the TOTP secret encrypted with the key from the sessions
+	// database and encoded with base64.  If the database is lost, the secret
+	// cannot be decrypted, and the user has to use a recovery code.  If the
+	// secrets box is used, the value is encrypted by it once more within the
+	// configuration file, see secretPaths.
+	Secret string `yaml:"secret"`
+
+	// RecoveryCodes are the hashes of the unused recovery codes.
+	RecoveryCodes []string `yaml:"recovery_codes"`
+}
+
+// TOTP constants.
+const (
+	// totpIssuer is the issuer shown in the authenticator applications.
+	totpIssuer = "AdGuard Home"
+
+	// recoveryCodesNum is the number of recovery codes generated at once.
+	recoveryCodesNum = 10
+
+	// deviceCookieName is the name of the cookie that marks a device on which
+	// the user has chosen to skip the second factor.
+	deviceCookieName = "agh_2fa_device"
+
+	// rememberDeviceTTL is the duration for which the second factor isn't
+	// requested on a remembered device.
+	rememberDeviceTTL = 30 * 24 * time.Hour
+)
+
+// errTOTPRequired is returned when the user has two-factor authentication
+// enabled but the code is missing.
+const errTOTPRequired errors.Error = "two-factor authentication code required"
+
+// errBadTOTP is returned when the two-factor authentication code or the
+// recovery code is invalid.
+const errBadTOTP errors.Error = "invalid two-factor authentication code"
+
+// keysBucketName is the name of the bbolt bucket for the encryption keys.
+var keysBucketName = []byte("keys")
+
+// totpKeyLen is the length of the TOTP secrets encryption key.
+const totpKeyLen = 32
+
+// totpKeyName is the name of the TOTP secrets encryption key within the keys
+// bucket.
+var totpKeyName = []byte("totp")
+
+// loadTOTPKey loads the key used to encrypt the TOTP secrets from the
+// database, generating a new one if there is none.
+func (a *Auth) loadTOTPKey() (err error) {
+	return a.db.Update(func(tx *bbolt.Tx) (txErr error) {
+		bkt, txErr := tx.CreateBucketIfNotExists(keysBucketName)
+		if txErr != nil {
+			return fmt.Errorf("creating bucket: %w", txErr)
+		}
+
+		if k := bkt.Get(totpKeyName); len(k) == totpKeyLen {
+			a.totpKey = slices.Clone(k)
+
+			return nil
+		}
+
+		key := make([]byte, totpKeyLen)
+		_, txErr = rand.Read(key)
+		if txErr != nil {
+			return fmt.Errorf("generating key: %w", txErr)
+		}
+
+		a.totpKey = key
+
+		return bkt.Put(totpKeyName, key)
+	})
+}
+
+// totpKeyCopy returns a copy of the key used to encrypt the TOTP secrets.  key
+// is nil if there is none.
+func (a *Auth) totpKeyCopy() (key []byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return slices.Clone(a.totpKey)
+}
+
+// setTOTPKey saves key into the database and uses it to encrypt the TOTP
+// secrets from now on.  The secrets encrypted with the previous key can't be
+// decrypted after that.
+func (a *Auth) setTOTPKey(key []byte) (err error) {
+	if len(key) != totpKeyLen {
+		return fmt.Errorf("totp key: bad length %d, want %d", len(key), totpKeyLen)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	err = a.db.Update(func(tx *bbolt.Tx) (txErr error) {
+		bkt, txErr := tx.CreateBucketIfNotExists(keysBucketName)
+		if txErr != nil {
+			return fmt.Errorf("creating bucket: %w", txErr)
+		}
+
+		return bkt.Put(totpKeyName, key)
+	})
+	if err != nil {
+		return fmt.Errorf("saving totp key: %w", err)
+	}
+
+	a.totpKey = slices.Clone(key)
+
+	return nil
+}
+
+// sealTOTPSecret encrypts secret with the TOTP key.
+func (a *Auth) sealTOTPSecret(secret []byte) (sealed string, err error) {
+	aead, err := a.totpAEAD()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	data := aead.Seal(nonce, nonce, secret, nil)
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// openTOTPSecret decrypts the secret sealed with [Auth.sealTOTPSecret].
+func (a *Auth) openTOTPSecret(sealed string) (secret []byte, err error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("decoding totp secret: %w", err)
+	}
+
+	aead, err := a.totpAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	n := aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.Error("totp secret is too short")
+	}
+
+	secret, err = aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting totp secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// totpAEAD returns the cipher for the TOTP secrets.
+func (a *Auth) totpAEAD() (aead cipher.AEAD, err error) {
+	if len(a.totpKey) == 0 {
+		return nil, errors.Error("no totp key")
+	}
+
+	block, err := aes.NewCipher(a.totpKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// checkSecondFactor returns nil if u doesn't use two-factor authentication,
+// if device is a valid remembered device token for u, or if code is a valid
+// TOTP code or recovery code for u.  A used recovery code is removed.
+func (a *Auth) checkSecondFactor(u webUser, code, device string) (err error) {
+	if u.TOTP == nil || a.deviceValid(u, device, time.Now()) {
+		return nil
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errTOTPRequired
+	}
+
+	a.lock.Lock()
+	recovered, err := a.useSecondFactor(u.Name, code)
+	a.lock.Unlock()
+
+	if recovered {
+		// Save the removal of the used recovery code.
+		onConfigModified()
+	}
+
+	return err
+}
+
+// useSecondFactor checks code for the user with name and marks it as used.
+// recovered is true if code was a recovery code, which is removed.  a.lock is
+// expected to be locked.
+func (a *Auth) useSecondFactor(name, code string) (recovered bool, err error) {
+	i := a.userIndex(name)
+	if i < 0 || a.users[i].TOTP == nil {
+		return false, errBadTOTP
+	}
+
+	totp := a.users[i].TOTP
+	secret, err := a.openTOTPSecret(totp.Secret)
+	if err != nil {
+		// Still allow the recovery codes.
+		log.Error("auth: user %q: %s", name, err)
+	} else if step, ok := aghuser.MatchTOTP(secret, code, time.Now(), a.totpLastSteps[name]); ok {
+		a.totpLastSteps[name] = step
+
+		return false, nil
+	}
+
+	hash := aghuser.HashRecoveryCode(code)
+	j := slices.Index(totp.RecoveryCodes, hash)
+	if j < 0 {
+		return false, errBadTOTP
+	}
+
+	// Replace the configuration instead of changing it, since the copies
+	// returned by GetUsers share it.
+	a.users[i].TOTP = &webUserTOTP{
+		Secret:        totp.Secret,
+		RecoveryCodes: slices.Delete(slices.Clone(totp.RecoveryCodes), j, j+1),
+	}
+
+	log.Info("auth: user %q used a recovery code, %d left", name, len(totp.RecoveryCodes)-1)
+
+	return true, nil
+}
+
+// deviceMAC returns the MAC of the remembered device token for u expiring at
+// exp.  Since the encrypted secret is included, enrolling again forgets all
+// remembered devices.
+func (a *Auth) deviceMAC(u webUser, exp int64) (mac []byte) {
+	h := hmac.New(sha256.New, a.totpKey)
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%d", u.Name, u.TOTP.Secret, exp)
+
+	return h.Sum(nil)
+}
+
+// deviceToken returns a new remembered device token for u.
+func (a *Auth) deviceToken(u webUser, now time.Time) (tok string) {
+	exp := now.Add(rememberDeviceTTL).Unix()
+
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(a.deviceMAC(u, exp))
+}
+
+// deviceValid returns true if tok is a valid and unexpired remembered device
+// token for u.
+func (a *Auth) deviceValid(u webUser, tok string, now time.Time) (ok bool) {
+	expStr, macStr, found := strings.Cut(tok, ".")
+	if !found {
+		return false
+	}
+
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || exp <= now.Unix() {
+		return false
+	}
+
+	mac, err := hex.DecodeString(macStr)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(mac, a.deviceMAC(u, exp))
+}
+
+// newDeviceCookie returns a cookie remembering the current device for the
+// user with name or nil if the user doesn't use two-factor authentication.
+func (a *Auth) newDeviceCookie(name string) (c *http.Cookie) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.userIndex(name)
+	if i < 0 || a.users[i].TOTP == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &http.Cookie{
+		Name:    deviceCookieName,
+		Value:   a.deviceToken(a.users[i], now),
+		Path:    "/",
+		Expires: now.Add(rememberDeviceTTL),
+
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// enrollTOTP generates a new pending TOTP secret for the user with name.  It
+// only becomes active after [Auth.confirmTOTP].
+func (a *Auth) enrollTOTP(name string) (secret []byte, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.userIndex(name)
+	if i < 0 {
+		return nil, errNoUser
+	} else if a.users[i].TOTP != nil {
+		return nil, errors.Error("two-factor authentication is already enabled")
+	}
+
+	secret, err = aghuser.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	a.totpPending[name] = secret
+
+	return secret, nil
+}
+
+// confirmTOTP enables two-factor authentication for the user with name if
+// code matches the pending secret.  It returns the new recovery codes.
+func (a *Auth) confirmTOTP(name, code string) (codes []string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.userIndex(name)
+	secret, ok := a.totpPending[name]
+	if i < 0 || !ok {
+		return nil, errors.Error("no pending enrollment")
+	}
+
+	step, ok := aghuser.MatchTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, errBadTOTP
+	}
+
+	sealed, err := a.sealTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	a.users[i].TOTP = &webUserTOTP{
+		Secret:        sealed,
+		RecoveryCodes: hashes,
+	}
+	a.totpLastSteps[name] = step
+	delete(a.totpPending, name)
+
+	return codes, nil
+}
+
+// disableTOTP disables two-factor authentication for the user with name if
+// code is valid.
+func (a *Auth) disableTOTP(name, code string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	_, err = a.useSecondFactor(name, code)
+	if err != nil {
+		return err
+	}
+
+	a.users[a.userIndex(name)].TOTP = nil
+	delete(a.totpLastSteps, name)
+
+	return nil
+}
+
+// regenerateRecoveryCodes replaces the recovery codes of the user with name if
+// code is valid.
+func (a *Auth) regenerateRecoveryCodes(name, code string) (codes []string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	_, err = a.useSecondFactor(name, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &a.users[a.userIndex(name)]
+	u.TOTP = &webUserTOTP{
+		Secret:        u.TOTP.Secret,
+		RecoveryCodes: hashes,
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCodes returns new recovery codes and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = aghuser.NewRecoveryCodes(recoveryCodesNum)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes = make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, aghuser.HashRecoveryCode(c))
+	}
+
+	return codes, hashes, nil
+}
+
+// totpStatusJSON is the response to the GET /control/totp/status HTTP API.
+type totpStatusJSON struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// totpEnrollJSON is the response to the POST /control/totp/enroll HTTP API.
+type totpEnrollJSON struct {
+	// Secret is the base32-encoded secret for entering it manually.
+	Secret string `json:"secret"`
+
+	// URI is the provisioning URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+// totpCodeJSON is the request to the HTTP APIs that require a TOTP code or
+// a recovery code.
+type totpCodeJSON struct {
+	Code string `json:"code"`
+}
+
+// recoveryCodesJSON is the response containing new recovery codes.
+type recoveryCodesJSON struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// currentUserName returns the name of the user that has sent r and writes an
+// error to w if there is none.
+func currentUserName(w http.ResponseWriter, r *http.Request) (name string, ok bool) {
+	u := Context.auth.getCurrentUser(r)
+	if u.Name == "" {
+		aghhttp.Error(r, w, http.StatusUnauthorized, "no user")
+
+		return "", false
+	}
+
+	return u.Name, true
+}
+
+// handleTOTPStatus is the handler for the GET /control/totp/status HTTP API.
+func handleTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	u := Context.auth.getCurrentUser(r)
+
+	resp := &totpStatusJSON{}
+	if u.TOTP != nil {
+		resp.Enabled = true
+		resp.RecoveryCodesLeft = len(u.TOTP.RecoveryCodes)
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleTOTPEnroll is the handler for the POST /control/totp/enroll HTTP API.
+func handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	name, ok := currentUserName(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := Context.auth.enrollTOTP(name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "enrolling: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, &totpEnrollJSON{
+		Secret: aghuser.EncodeTOTPSecret(secret),
+		URI:    aghuser.TOTPURI(totpIssuer, name, secret),
+	})
+}
+
+// handleTOTPConfirm is the handler for the POST /control/totp/confirm HTTP
+// API.
+func handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	name, ok := currentUserName(w, r)
+	if !ok {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	codes, err := Context.auth.confirmTOTP(name, req.Code)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "confirming: %s", err)
+
+		return
+	}
+
+	log.Info("auth: user %q enabled two-factor authentication", name)
+
+	onConfigModified()
+	_ = aghhttp.WriteJSONResponse(w, r, &recoveryCodesJSON{RecoveryCodes: codes})
+}
+
+// handleTOTPDisable is the handler for the POST /control/totp/disable HTTP
+// API.
+func handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	name, ok := currentUserName(w, r)
+	if !ok {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = Context.auth.disableTOTP(name, req.Code)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "disabling: %s", err)
+
+		return
+	}
+
+	log.Info("auth: user %q disabled two-factor authentication", name)
+
+	onConfigModified()
+	aghhttp.OK(w)
+}
+
+// handleTOTPRecoveryCodes is the handler for the POST
+// /control/totp/recovery_codes HTTP API.
+func handleTOTPRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	name, ok := currentUserName(w, r)
+	if !ok {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	codes, err := Context.auth.regenerateRecoveryCodes(name, req.Code)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "regenerating recovery codes: %s", err)
+
+		return
+	}
+
+	log.Info("auth: user %q regenerated recovery codes", name)
+
+	onConfigModified()
+	_ = aghhttp.WriteJSONResponse(w, r, &recoveryCodesJSON{RecoveryCodes: codes})
+}
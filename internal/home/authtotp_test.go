@@ -0,0 +1,87 @@
+package home
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_totp(t *testing.T) {
+	a := newTestAuth(t)
+
+	login := loginJSON{Name: "viewer", Password: "password"}
+
+	secret, err := a.enrollTOTP("viewer")
+	require.NoError(t, err)
+
+	// Not enabled until confirmed.
+	_, err = a.newCookie(login, "", "")
+	require.NoError(t, err)
+
+	_, err = a.confirmTOTP("viewer", "000000x")
+	assert.ErrorIs(t, err, errBadTOTP)
+
+	now := time.Now()
+	codes, err := a.confirmTOTP("viewer", aghuser.TOTPCode(secret, aghuser.TOTPStep(now)))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodesNum)
+
+	u := a.GetUsers()[1]
+	require.NotNil(t, u.TOTP)
+
+	assert.NotContains(t, u.TOTP.Secret, aghuser.EncodeTOTPSecret(secret))
+
+	_, err = a.newCookie(login, "", "")
+	assert.ErrorIs(t, err, errTOTPRequired)
+
+	t.Run("reused_code", func(t *testing.T) {
+		l := login
+		l.Code = aghuser.TOTPCode(secret, aghuser.TOTPStep(now))
+
+		_, err = a.newCookie(l, "", "")
+		assert.ErrorIs(t, err, errBadTOTP)
+	})
+
+	t.Run("next_code", func(t *testing.T) {
+		l := login
+		l.Code = aghuser.TOTPCode(secret, aghuser.TOTPStep(now)+1)
+
+		_, err = a.newCookie(l, "", "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("recovery_code", func(t *testing.T) {
+		l := login
+		l.Code = codes[0]
+
+		_, err = a.newCookie(l, "", "")
+		require.NoError(t, err)
+
+		_, err = a.newCookie(l, "", "")
+		assert.ErrorIs(t, err, errBadTOTP)
+
+		assert.Len(t, a.GetUsers()[1].TOTP.RecoveryCodes, recoveryCodesNum-1)
+	})
+
+	t.Run("device", func(t *testing.T) {
+		c := a.newDeviceCookie("viewer")
+		require.NotNil(t, c)
+
+		_, err = a.newCookie(login, "", c.Value)
+		assert.NoError(t, err)
+
+		_, err = a.newCookie(login, "", c.Value+"0")
+		assert.ErrorIs(t, err, errTOTPRequired)
+
+		assert.Nil(t, a.newDeviceCookie("admin"))
+	})
+
+	err = a.disableTOTP("viewer", codes[1])
+	require.NoError(t, err)
+
+	_, err = a.newCookie(login, "", "")
+	assert.NoError(t, err)
+}
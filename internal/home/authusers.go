@@ -0,0 +1,372 @@
+package home
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"golang.org/x/exp/slices"
+)
+
+// User Management
+
+// adminPaths are the paths of the HTTP APIs that change the server settings or
+// manage the users and thus require the admin role regardless of the method.
+var adminPaths = stringutil.NewSet(
+	"/control/access/set",
+	"/control/backup",
+	"/control/config/reload",
+	"/control/dhcp/leases/import",
+	"/control/dhcp/reset",
+	"/control/dhcp/set_config",
+	"/control/diagnostics",
+	"/control/dns_config",
+	"/control/filtering/rule_requests",
+	"/control/filtering/rule_requests/approve",
+	"/control/filtering/rule_requests/reject",
+	"/control/import/dnsmasq",
+	"/control/import/pihole",
+	"/control/log/config/update",
+	"/control/lookalike/settings",
+	"/control/notifications/list",
+	"/control/notifications/set",
+	"/control/notifications/test",
+	"/control/parental/bypass/pin",
+	"/control/querylog/config/update",
+	"/control/querylog/relocate",
+	"/control/querylog_config",
+	"/control/ratelimit/unblock",
+	"/control/restore",
+	"/control/stats/config/update",
+	"/control/stats/relocate",
+	"/control/stats_config",
+	"/control/sync/run",
+	"/control/tls/configure",
+	"/control/tls/validate",
+	"/control/update",
+	"/control/update/pin",
+	"/control/update/rollback",
+	"/control/update/status",
+	"/control/users/add",
+	"/control/users/delete",
+	"/control/users/list",
+	"/control/users/update",
+)
+
+// selfPaths are the paths of the HTTP APIs that only change the settings of
+// the current user, are protected by other means, like the parental control
+// bypass PIN, or only submit changes for the review of an admin, and are thus
+// available to all users.
+var selfPaths = stringutil.NewSet(
+	"/control/filtering/rule_requests/submit",
+	"/control/parental/bypass/start",
+	"/control/totp/confirm",
+	"/control/totp/disable",
+	"/control/totp/enroll",
+	"/control/totp/recovery_codes",
+)
+
+// requiredRole returns the role that a user must have to perform r.  Viewers
+// may only read the data and change their own settings, operators may also
+// perform all other actions except the ones in adminPaths.
+func requiredRole(r *http.Request) (role aghuser.Role) {
+	if adminPaths.Has(r.URL.Path) {
+		return aghuser.RoleAdmin
+	} else if selfPaths.Has(r.URL.Path) {
+		return aghuser.RoleViewer
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return aghuser.RoleViewer
+	default:
+		return aghuser.RoleOperator
+	}
+}
+
+// validateUsers returns an error if users contain unknown roles.
+func validateUsers(users []webUser) (err error) {
+	for i, u := range users {
+		if u.Role == "" {
+			continue
+		}
+
+		err = u.Role.Validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: user %q: %w", i, u.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// errNoUser is returned when a user with the requested name doesn't exist.
+const errNoUser errors.Error = "no such user"
+
+// errLastAdmin is returned when a change would leave no admins.
+const errLastAdmin errors.Error = "cannot remove the last admin"
+
+// addUser adds u.  u.PasswordHash must be set.
+func (a *Auth) addUser(u webUser) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.userIndex(u.Name) >= 0 {
+		return fmt.Errorf("user %q already exists", u.Name)
+	}
+
+	a.users = append(a.users, u)
+
+	return nil
+}
+
+// updateUser sets the role and the password hash of the user with name.  Empty
+// role or hash are not changed.  Changing the password closes all sessions of
+// the user.
+func (a *Auth) updateUser(name string, role aghuser.Role, hash string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.userIndex(name)
+	if i < 0 {
+		return errNoUser
+	}
+
+	u := &a.users[i]
+	if role != "" && role != aghuser.RoleAdmin && a.isLastAdmin(i) {
+		return errLastAdmin
+	}
+
+	if role != "" {
+		u.Role = role
+	}
+
+	if hash != "" {
+		u.PasswordHash = hash
+		a.removeUserSessions(name)
+	}
+
+	return nil
+}
+
+// removeUser removes the user with name and closes all their sessions.
+func (a *Auth) removeUser(name string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.userIndex(name)
+	if i < 0 {
+		return errNoUser
+	} else if a.isLastAdmin(i) {
+		return errLastAdmin
+	}
+
+	a.users = slices.Delete(a.users, i, i+1)
+	a.removeUserSessions(name)
+
+	return nil
+}
+
+// userIndex returns the index of the user with name or -1 if there is no such
+// user.  a.lock is expected to be locked.
+func (a *Auth) userIndex(name string) (i int) {
+	return slices.IndexFunc(a.users, func(u webUser) (ok bool) { return u.Name == name })
+}
+
+// isLastAdmin returns true if the user at index i is the only admin.  a.lock is
+// expected to be locked.
+func (a *Auth) isLastAdmin(i int) (ok bool) {
+	if a.users[i].role() != aghuser.RoleAdmin {
+		return false
+	}
+
+	for j, u := range a.users {
+		if j != i && u.role() == aghuser.RoleAdmin {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeUserSessions removes all sessions of the user with name.  a.lock is
+// expected to be locked.
+func (a *Auth) removeUserSessions(name string) {
+	for sess, s := range a.sessions {
+		if s.userName != name {
+			continue
+		}
+
+		delete(a.sessions, sess)
+		key, _ := hex.DecodeString(sess)
+		a.removeSession(key)
+	}
+}
+
+// userJSON is a user as returned by the GET /control/users/list HTTP API.
+type userJSON struct {
+	Name string       `json:"name"`
+	Role aghuser.Role `json:"role"`
+}
+
+// usersJSON is the response to the GET /control/users/list HTTP API.
+type usersJSON struct {
+	Users []*userJSON `json:"users"`
+}
+
+// userReqJSON is the request to the POST /control/users/add and POST
+// /control/users/update HTTP APIs.
+type userReqJSON struct {
+	Name     string       `json:"name"`
+	Password string       `json:"password"`
+	Role     aghuser.Role `json:"role"`
+
+	// BcryptCost is the cost of the password hash.  Zero means the default
+	// one.
+	BcryptCost int `json:"bcrypt_cost"`
+}
+
+// userDeleteReqJSON is the request to the POST /control/users/delete HTTP API.
+type userDeleteReqJSON struct {
+	Name string `json:"name"`
+}
+
+// handleGetUsers is the handler for the GET /control/users/list HTTP API.
+func handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	users := Context.auth.GetUsers()
+
+	resp := &usersJSON{
+		Users: make([]*userJSON, 0, len(users)),
+	}
+	for _, u := range users {
+		resp.Users = append(resp.Users, &userJSON{
+			Name: u.Name,
+			Role: u.role(),
+		})
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleAddUser is the handler for the POST /control/users/add HTTP API.
+func handleAddUser(w http.ResponseWriter, r *http.Request) {
+	req := &userReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if req.Name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "name is empty")
+
+		return
+	} else if req.Password == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "password is empty")
+
+		return
+	}
+
+	err = req.Role.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	hash, err := aghuser.HashPassword(req.Password, req.BcryptCost)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = Context.auth.addUser(webUser{
+		Name:         req.Name,
+		PasswordHash: hash,
+		Role:         req.Role,
+	})
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "adding user: %s", err)
+
+		return
+	}
+
+	log.Info("auth: added user %q with role %s", req.Name, req.Role)
+
+	onConfigModified()
+	aghhttp.OK(w)
+}
+
+// handleUpdateUser is the handler for the POST /control/users/update HTTP API.
+// Empty password and role are not changed.
+func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	req := &userReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if req.Role != "" {
+		err = req.Role.Validate()
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+			return
+		}
+	}
+
+	var hash string
+	if req.Password != "" {
+		hash, err = aghuser.HashPassword(req.Password, req.BcryptCost)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+			return
+		}
+	}
+
+	err = Context.auth.updateUser(req.Name, req.Role, hash)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "updating user %q: %s", req.Name, err)
+
+		return
+	}
+
+	log.Info("auth: updated user %q", req.Name)
+
+	onConfigModified()
+	aghhttp.OK(w)
+}
+
+// handleDeleteUser is the handler for the POST /control/users/delete HTTP API.
+func handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	req := &userDeleteReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = Context.auth.removeUser(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "deleting user %q: %s", req.Name, err)
+
+		return
+	}
+
+	log.Info("auth: deleted user %q", req.Name)
+
+	onConfigModified()
+	aghhttp.OK(w)
+}
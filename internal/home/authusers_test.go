@@ -0,0 +1,177 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequiredRole(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		want   aghuser.Role
+	}{{
+		name:   "get",
+		method: http.MethodGet,
+		path:   "/control/status",
+		want:   aghuser.RoleViewer,
+	}, {
+		name:   "post",
+		method: http.MethodPost,
+		path:   "/control/protection",
+		want:   aghuser.RoleOperator,
+	}, {
+		name:   "settings",
+		method: http.MethodPost,
+		path:   "/control/dns_config",
+		want:   aghuser.RoleAdmin,
+	}, {
+		name:   "users",
+		method: http.MethodGet,
+		path:   "/control/users/list",
+		want:   aghuser.RoleAdmin,
+	}, {
+		name:   "lookalike_settings",
+		method: http.MethodPut,
+		path:   "/control/lookalike/settings",
+		want:   aghuser.RoleAdmin,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			assert.Equal(t, tc.want, requiredRole(r))
+		})
+	}
+}
+
+// newTestAuth returns a new *Auth with an admin "admin" and a viewer "viewer",
+// both with the password "password".
+func newTestAuth(t *testing.T) (a *Auth) {
+	t.Helper()
+
+	hash, err := aghuser.HashPassword("password", bcrypt.MinCost)
+	require.NoError(t, err)
+
+	users := []webUser{{
+		Name:         "admin",
+		PasswordHash: hash,
+	}, {
+		Name:         "viewer",
+		PasswordHash: hash,
+		Role:         aghuser.RoleViewer,
+	}}
+
+	a = InitAuth(filepath.Join(t.TempDir(), "sessions.db"), users, 60, nil)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	return a
+}
+
+func TestAuth_users(t *testing.T) {
+	a := newTestAuth(t)
+
+	err := a.addUser(webUser{Name: "viewer"})
+	testutil.AssertErrorMsg(t, `user "viewer" already exists`, err)
+
+	err = a.updateUser("admin", aghuser.RoleOperator, "")
+	assert.ErrorIs(t, err, errLastAdmin)
+
+	err = a.removeUser("admin")
+	assert.ErrorIs(t, err, errLastAdmin)
+
+	err = a.removeUser("nobody")
+	assert.ErrorIs(t, err, errNoUser)
+
+	cookie, err := a.newCookie(loginJSON{Name: "viewer", Password: "password"}, "", "")
+	require.NoError(t, err)
+	require.Equal(t, checkSessionOK, a.checkSession(cookie.Value))
+
+	err = a.updateUser("viewer", aghuser.RoleAdmin, "")
+	require.NoError(t, err)
+
+	// The other admin can now be demoted.
+	err = a.updateUser("admin", aghuser.RoleOperator, "")
+	require.NoError(t, err)
+
+	err = a.removeUser("viewer")
+	assert.ErrorIs(t, err, errLastAdmin)
+
+	err = a.updateUser("admin", aghuser.RoleAdmin, "")
+	require.NoError(t, err)
+
+	err = a.removeUser("viewer")
+	require.NoError(t, err)
+
+	assert.Equal(t, checkSessionNotFound, a.checkSession(cookie.Value))
+
+	users := a.GetUsers()
+	require.Len(t, users, 1)
+
+	assert.Equal(t, "admin", users[0].Name)
+}
+
+func TestOptionalAuth_roles(t *testing.T) {
+	prev := Context.auth
+	t.Cleanup(func() { Context.auth = prev })
+
+	Context.auth = newTestAuth(t)
+
+	h := optionalAuth(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		wantCode int
+	}{{
+		name:     "viewer_get",
+		user:     "viewer",
+		method:   http.MethodGet,
+		path:     "/control/status",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "viewer_post",
+		user:     "viewer",
+		method:   http.MethodPost,
+		path:     "/control/protection",
+		wantCode: http.StatusForbidden,
+	}, {
+		name:     "viewer_users",
+		user:     "viewer",
+		method:   http.MethodGet,
+		path:     "/control/users/list",
+		wantCode: http.StatusForbidden,
+	}, {
+		name:     "admin_users",
+		user:     "admin",
+		method:   http.MethodGet,
+		path:     "/control/users/list",
+		wantCode: http.StatusOK,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			r.SetBasicAuth(tc.user, "password")
+
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
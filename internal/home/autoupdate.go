@@ -0,0 +1,279 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Automatic Updates
+
+// autoUpdateCheckIvl is the interval between the checks if the maintenance
+// window has started.
+const autoUpdateCheckIvl = 5 * time.Minute
+
+// updateHealthDelay is the duration after the start of the updated AdGuard
+// Home after which its health is verified.
+const updateHealthDelay = 1 * time.Minute
+
+// autoUpdateConfig is the configuration of the automatic updates.
+type autoUpdateConfig struct {
+	// Window is the weekly maintenance window within which the updates are
+	// installed.
+	Window updater.Window `yaml:"window"`
+
+	// Channel is the release channel to update from: "release", "beta", or
+	// "edge".  If empty, the channel of the current build is used.  It's also
+	// used for the manual updates.
+	Channel string `yaml:"channel"`
+
+	// PinnedVersion is the version AdGuard Home is pinned to.  If not empty,
+	// the updates aren't installed automatically and the manual updates to
+	// the latest version are forbidden.
+	PinnedVersion string `yaml:"pinned_version"`
+
+	// Enabled defines if the updates are installed automatically.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the automatic updates configuration isn't
+// valid.
+func (c *autoUpdateConfig) validate() (err error) {
+	switch c.Channel {
+	case "", version.ChannelRelease, version.ChannelBeta, version.ChannelEdge:
+		// Go on.
+	default:
+		return fmt.Errorf("channel: bad value %q", c.Channel)
+	}
+
+	if c.PinnedVersion != "" {
+		err = updater.ValidateVersion(c.PinnedVersion)
+		if err != nil {
+			return fmt.Errorf("pinned_version: %w", err)
+		}
+	}
+
+	if !c.Enabled {
+		return nil
+	}
+
+	err = c.Window.Validate()
+	if err != nil {
+		return fmt.Errorf("window: %w", err)
+	}
+
+	return nil
+}
+
+// updateChannel returns the release channel of the updates.
+func (c *autoUpdateConfig) updateChannel() (channel string) {
+	if c.Channel != "" {
+		return c.Channel
+	}
+
+	return version.Channel()
+}
+
+// startAutoUpdates starts installing the updates within the maintenance
+// window, if enabled.
+func startAutoUpdates() {
+	if !config.AutoUpdate.Enabled || Context.disableUpdate {
+		return
+	}
+
+	conf := config.AutoUpdate
+	log.Info(
+		"updater: automatic updates from %s channel enabled, window starts at %s",
+		conf.updateChannel(),
+		conf.Window.Start,
+	)
+
+	go autoUpdateLoop(&conf.Window)
+}
+
+// autoUpdateLoop tries to install the update once within each maintenance
+// window.
+func autoUpdateLoop(w *updater.Window) {
+	defer log.OnPanic("updater")
+
+	var lastAttempt time.Time
+	ticker := time.NewTicker(autoUpdateCheckIvl)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !w.Contains(now) || now.Sub(lastAttempt) < w.Duration.Duration {
+			continue
+		}
+
+		lastAttempt = now
+		err := autoUpdate()
+		if err != nil {
+			log.Error("updater: automatic update: %s", err)
+		}
+	}
+}
+
+// autoUpdate installs the new version, if any, and restarts AdGuard Home.  It
+// takes a snapshot of the configuration before the update.
+func autoUpdate() (err error) {
+	if pinned := pinnedVersion(); pinned != "" {
+		log.Debug("updater: pinned to %s, not updating", pinned)
+
+		return nil
+	}
+
+	resp := &versionResponse{}
+	err = requestVersionInfo(resp, true)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	if resp.NewVersion == "" || resp.NewVersion == version.Version() {
+		log.Debug("updater: no updates available")
+
+		return nil
+	}
+
+	err = resp.setAllowedToAutoUpdate()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if resp.CanAutoUpdate != aghalg.NBTrue {
+		return fmt.Errorf("updating to %s is not allowed", resp.NewVersion)
+	}
+
+	// See the comment in handleUpdate.
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("getting path: %w", err)
+	}
+
+	err = takeUpdateSnapshot()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	log.Info("updater: updating to %s", resp.NewVersion)
+
+	err = Context.updater.Update(false)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	go finishUpdate(context.Background(), execPath)
+
+	return nil
+}
+
+// checkPendingUpdate checks if AdGuard Home has just been updated and restarts
+// the previous version if the updated one has failed to start too many times.
+// If pending is true, the update must be verified, see [verifyUpdate].
+func checkPendingUpdate() (pending bool) {
+	execPath, err := os.Executable()
+	if err != nil {
+		log.Error("updater: getting path: %s", err)
+
+		return false
+	}
+
+	pending, rolledBack, err := updater.CheckPending(Context.workDir)
+	if err != nil {
+		log.Error("updater: checking pending update: %s", err)
+
+		return false
+	} else if !rolledBack {
+		return pending
+	}
+
+	err = restart(execPath)
+	log.Fatalf("updater: restarting previous version: %s", err)
+
+	// Not reached.
+	return false
+}
+
+// verifyUpdate waits for the updated AdGuard Home to start and confirms the
+// update if it's healthy or rolls the update back otherwise.
+func verifyUpdate() {
+	defer log.OnPanic("updater")
+
+	time.Sleep(updateHealthDelay)
+
+	err := checkHealth()
+	if err == nil {
+		err = updater.ConfirmPending(Context.workDir)
+		if err != nil {
+			log.Error("updater: confirming update: %s", err)
+		}
+
+		return
+	}
+
+	log.Error("updater: updated version is unhealthy: %s; rolling back", err)
+
+	// Get the path before the executable is replaced.
+	execPath, err := os.Executable()
+	if err != nil {
+		log.Error("updater: getting path: %s", err)
+
+		return
+	}
+
+	err = rollBackUpdate()
+	if err != nil {
+		log.Error("updater: rolling back: %s", err)
+
+		return
+	}
+
+	finishUpdate(context.Background(), execPath)
+}
+
+// rollBackUpdate restores the version replaced by the last update.  The
+// configuration isn't written afterwards, since the restored configuration file
+// must be used after the restart.
+func rollBackUpdate() (err error) {
+	config.Lock()
+	defer config.Unlock()
+
+	err = updater.Rollback(Context.workDir)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	config.frozen = true
+
+	return nil
+}
+
+// pinnedVersion returns the version AdGuard Home is pinned to, if any.
+func pinnedVersion() (ver string) {
+	config.RLock()
+	defer config.RUnlock()
+
+	return config.AutoUpdate.PinnedVersion
+}
+
+// checkHealth returns an error if AdGuard Home isn't working properly.
+func checkHealth() (err error) {
+	if Context.firstRun {
+		return nil
+	}
+
+	if Context.dnsServer == nil || !Context.dnsServer.IsRunning() {
+		return errors.Error("dns server is not running")
+	}
+
+	return nil
+}
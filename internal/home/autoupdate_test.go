@@ -0,0 +1,81 @@
+package home
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoUpdateConfig_validate(t *testing.T) {
+	validWindow := updater.Window{
+		Days:     []string{"sun"},
+		Start:    "03:00",
+		Duration: timeutil.Duration{Duration: 2 * time.Hour},
+	}
+
+	testCases := []struct {
+		conf       *autoUpdateConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &autoUpdateConfig{
+			Window:  validWindow,
+			Channel: version.ChannelBeta,
+			Enabled: true,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &autoUpdateConfig{
+			Channel: "nightly",
+		},
+		name:       "bad_channel",
+		wantErrMsg: `channel: bad value "nightly"`,
+	}, {
+		conf: &autoUpdateConfig{
+			Enabled: false,
+		},
+		name:       "disabled_no_window",
+		wantErrMsg: "",
+	}, {
+		conf: &autoUpdateConfig{
+			Window: updater.Window{
+				Start: "03:00",
+			},
+			Enabled: true,
+		},
+		name:       "bad_window",
+		wantErrMsg: "window: duration: must be positive",
+	}, {
+		conf: &autoUpdateConfig{
+			PinnedVersion: "v0.107.26",
+		},
+		name:       "pinned",
+		wantErrMsg: "",
+	}, {
+		conf: &autoUpdateConfig{
+			PinnedVersion: "latest",
+		},
+		name:       "bad_pinned",
+		wantErrMsg: `pinned_version: bad version "latest"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+func TestAutoUpdateConfig_updateChannel(t *testing.T) {
+	c := &autoUpdateConfig{}
+	assert.Equal(t, version.Channel(), c.updateChannel())
+
+	c.Channel = version.ChannelBeta
+	assert.Equal(t, version.ChannelBeta, c.updateChannel())
+}
@@ -0,0 +1,552 @@
+package home
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/maybe"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Backup and Restore
+
+// Backup archive constants.
+const (
+	// backupManifestName is the name of the manifest file within a backup
+	// archive.
+	backupManifestName = "manifest.json"
+
+	// backupConfigName is the name of the configuration file within a backup
+	// archive.  The configuration file contains the DNS rewrites and the
+	// settings of the persistent clients as well.
+	backupConfigName = "AdGuardHome.yaml"
+
+	// backupFiltersDir is the directory of the filter list files within a
+	// backup archive.
+	backupFiltersDir = "filters"
+
+	// backupTOTPKeyName is the name of the file with the key used to encrypt
+	// the TOTP secrets of the users within a backup archive.  The key is kept
+	// in the sessions database, which isn't backed up, but without it the
+	// two-factor authentication can't be used with the restored
+	// configuration.
+	backupTOTPKeyName = "totp.key"
+
+	// backupFiltersPrevDir is the subdirectory of the data directory to keep
+	// the previous filter list files during a restore.
+	backupFiltersPrevDir = "filters.prev"
+
+	// backupsDir is the subdirectory of the data directory to store the
+	// snapshots taken before restoring a backup.
+	backupsDir = "backups"
+
+	// restoreReqBodySzLim is the maximum size of a backup archive to restore.
+	restoreReqBodySzLim = 256 * 1024 * 1024
+)
+
+// backupFilterRe matches the names of the filter list files within a backup
+// archive.  The names are the same as in the filters directory.
+var backupFilterRe = regexp.MustCompile(`^` + backupFiltersDir + `/[0-9]+\.txt$`)
+
+// backupManifest is the description of a backup archive.
+type backupManifest struct {
+	// Created is the time when the backup was created.
+	Created time.Time `json:"created"`
+
+	// Version is the version of AdGuard Home that has created the backup.
+	Version string `json:"version"`
+
+	// SchemaVersion is the schema version of the configuration file.
+	SchemaVersion int `json:"schema_version"`
+}
+
+// backupFilterPath returns the path of the directory with the filter list
+// files.
+func backupFilterPath() (dir string) {
+	return filepath.Join(Context.getDataDir(), backupFiltersDir)
+}
+
+// writeBackup writes a backup archive with the current configuration file,
+// filter list files, and the TOTP key to w.  Since the key decrypts the TOTP
+// secrets within the configuration file, the archive must be kept as safe as
+// the data directory.
+func writeBackup(w io.Writer, now time.Time) (err error) {
+	// Make sure the configuration file reflects the current state.
+	err = config.write()
+	if err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	confData, err := os.ReadFile(config.getConfigFilename())
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	defer func() { err = errors.WithDeferred(err, zw.Close()) }()
+
+	manifest, err := json.Marshal(&backupManifest{
+		Created:       now.UTC(),
+		Version:       version.Version(),
+		SchemaVersion: currentSchemaVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	files := map[string][]byte{
+		backupManifestName: manifest,
+		backupConfigName:   confData,
+	}
+
+	if Context.auth != nil {
+		if key := Context.auth.totpKeyCopy(); key != nil {
+			files[backupTOTPKeyName] = key
+		}
+	}
+
+	for name, data := range files {
+		err = writeZipFile(zw, name, data, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	dir := backupFilterPath()
+	ents, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading filters dir: %w", err)
+	}
+
+	for _, ent := range ents {
+		name := path.Join(backupFiltersDir, ent.Name())
+		if !ent.Type().IsRegular() || !backupFilterRe.MatchString(name) {
+			continue
+		}
+
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(dir, ent.Name()))
+		if err != nil {
+			return fmt.Errorf("reading filter: %w", err)
+		}
+
+		err = writeZipFile(zw, name, data, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeZipFile writes a file with name and data into zw.
+func writeZipFile(zw *zip.Writer, name string, data []byte, modified time.Time) (err error) {
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("creating %q in archive: %w", name, err)
+	}
+
+	_, err = fw.Write(data)
+	if err != nil {
+		return fmt.Errorf("writing %q to archive: %w", name, err)
+	}
+
+	return nil
+}
+
+// backupFiles are the files of a validated backup archive.
+type backupFiles struct {
+	// filters are the filter list files by their names within the filters
+	// directory.
+	filters map[string][]byte
+
+	// config is the configuration file.
+	config []byte
+
+	// totpKey is the key used to encrypt the TOTP secrets.  It's nil if the
+	// archive has been created by a version without two-factor
+	// authentication.
+	totpKey []byte
+}
+
+// readBackup reads and validates the backup archive data.
+func readBackup(data []byte) (files *backupFiles, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+
+	files = &backupFiles{
+		filters: map[string][]byte{},
+	}
+
+	var manifest *backupManifest
+	for _, f := range zr.File {
+		var fdata []byte
+		fdata, err = readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name := f.Name; {
+		case name == backupManifestName:
+			manifest = &backupManifest{}
+			err = json.Unmarshal(fdata, manifest)
+			if err != nil {
+				return nil, fmt.Errorf("decoding manifest: %w", err)
+			}
+		case name == backupConfigName:
+			files.config = fdata
+		case name == backupTOTPKeyName:
+			if len(fdata) != totpKeyLen {
+				return nil, fmt.Errorf("bad %s length %d, want %d", backupTOTPKeyName, len(fdata), totpKeyLen)
+			}
+
+			files.totpKey = fdata
+		case backupFilterRe.MatchString(name):
+			files.filters[path.Base(name)] = fdata
+		default:
+			return nil, fmt.Errorf("unexpected file %q in archive", name)
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("no %s in archive", backupManifestName)
+	} else if files.config == nil {
+		return nil, fmt.Errorf("no %s in archive", backupConfigName)
+	}
+
+	err = validateBackupConfig(files.config, manifest.SchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("validating config: %w", err)
+	}
+
+	return files, nil
+}
+
+// readZipFile reads the contents of f.
+func readZipFile(f *zip.File) (data []byte, err error) {
+	if f.UncompressedSize64 > restoreReqBodySzLim {
+		return nil, fmt.Errorf("file %q is too large", f.Name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opening %q: %w", f.Name, err)
+	}
+	defer func() { err = errors.WithDeferred(err, rc.Close()) }()
+
+	data, err = io.ReadAll(io.LimitReader(rc, restoreReqBodySzLim))
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", f.Name, err)
+	}
+
+	return data, nil
+}
+
+// validateBackupConfig returns an error if the configuration file data from a
+// backup can't be used.  The configurations with older schema versions are
+// upgraded on the next start, so only the current schema version is fully
+// validated.
+func validateBackupConfig(data []byte, manifestSchema int) (err error) {
+	if manifestSchema > currentSchemaVersion {
+		return fmt.Errorf(
+			"backup is from a newer version with schema version %d, current is %d",
+			manifestSchema,
+			currentSchemaVersion,
+		)
+	} else if manifestSchema < currentSchemaVersion {
+		obj := yobj{}
+		err = yaml.Unmarshal(data, &obj)
+		if err != nil {
+			return fmt.Errorf("decoding: %w", err)
+		}
+
+		return nil
+	}
+
+	c := &configuration{}
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	} else if c.SchemaVersion != currentSchemaVersion {
+		return fmt.Errorf("schema version %d does not match the manifest", c.SchemaVersion)
+	}
+
+	return c.validate()
+}
+
+// saveSnapshot writes a backup archive of the current state into the backups
+// directory.  The name of the archive starts with prefix.
+func saveSnapshot(prefix string, now time.Time) (snapshot string, err error) {
+	dir := filepath.Join(Context.getDataDir(), backupsDir)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("creating backups dir: %w", err)
+	}
+
+	snapshot = filepath.Join(dir, prefix+"-"+now.UTC().Format("20060102T150405Z")+".zip")
+	buf := &bytes.Buffer{}
+	err = writeBackup(buf, now)
+	if err != nil {
+		return "", fmt.Errorf("taking snapshot: %w", err)
+	}
+
+	err = maybe.WriteFile(snapshot, buf.Bytes(), 0o600)
+	if err != nil {
+		return "", fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// restoreBackup takes a snapshot of the current state into the backups
+// directory and replaces the configuration file, the filter list files, and the
+// TOTP key with the ones from files.  If any of them can't be replaced, the ones
+// already replaced are restored.  AdGuard Home must be restarted afterwards.
+func restoreBackup(files *backupFiles, now time.Time) (snapshot string, err error) {
+	snapshot, err = saveSnapshot("pre-restore", now)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("backup: saved pre-restore snapshot to %q", snapshot)
+
+	config.Lock()
+	defer config.Unlock()
+
+	// undo are the functions reverting the applied changes in the order of
+	// applying.
+	var undo []func() (err error)
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for i := len(undo) - 1; i >= 0; i-- {
+			err = errors.WithDeferred(err, undo[i]())
+		}
+	}()
+
+	undoFilters, err := restoreFilters(files.filters)
+	if err != nil {
+		return snapshot, err
+	}
+
+	undo = append(undo, undoFilters)
+
+	undoKey, err := restoreTOTPKey(files.totpKey)
+	if err != nil {
+		return snapshot, err
+	}
+
+	undo = append(undo, undoKey)
+
+	// The configuration file is written last, since it's written atomically
+	// and is the only change that can't be reverted.
+	err = maybe.WriteFile(config.getConfigFilename(), files.config, 0o644)
+	if err != nil {
+		return snapshot, fmt.Errorf("writing config: %w", err)
+	}
+
+	config.frozen = true
+
+	prevDir := filepath.Join(Context.getDataDir(), backupFiltersPrevDir)
+	rmErr := os.RemoveAll(prevDir)
+	if rmErr != nil {
+		log.Error("backup: removing previous filters: %s", rmErr)
+	}
+
+	return snapshot, nil
+}
+
+// restoreFilters writes filters into a temporary directory and then replaces
+// the filters directory with it.  The previous filters directory is kept in
+// [backupFiltersPrevDir] until it's removed by the caller, and undo moves it
+// back.
+func restoreFilters(filters map[string][]byte) (undo func() (err error), err error) {
+	dataDir := Context.getDataDir()
+	stagedDir, err := os.MkdirTemp(dataDir, backupFiltersDir+"-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("creating staging dir: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.WithDeferred(err, os.RemoveAll(stagedDir))
+		}
+	}()
+
+	// MkdirTemp creates the directories only accessible by the owner.
+	err = os.Chmod(stagedDir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("setting staging dir permissions: %w", err)
+	}
+
+	for name, data := range filters {
+		err = os.WriteFile(filepath.Join(stagedDir, name), data, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("writing filter: %w", err)
+		}
+	}
+
+	dir := backupFilterPath()
+	prevDir := filepath.Join(dataDir, backupFiltersPrevDir)
+
+	// Remove the leftovers of an interrupted restore, if any.
+	err = os.RemoveAll(prevDir)
+	if err != nil {
+		return nil, fmt.Errorf("removing previous filters: %w", err)
+	}
+
+	err = os.Rename(dir, prevDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("moving filters: %w", err)
+	}
+
+	undo = func() (err error) {
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("removing restored filters: %w", err)
+		}
+
+		err = os.Rename(prevDir, dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("moving previous filters back: %w", err)
+		}
+
+		return nil
+	}
+
+	err = os.Rename(stagedDir, dir)
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("moving restored filters: %w", err), undo())
+	}
+
+	return undo, nil
+}
+
+// restoreTOTPKey replaces the TOTP key with key, if any.  undo restores the
+// previous key.
+func restoreTOTPKey(key []byte) (undo func() (err error), err error) {
+	undo = func() (err error) { return nil }
+
+	auth := Context.auth
+	if auth == nil || key == nil {
+		return undo, nil
+	}
+
+	prev := auth.totpKeyCopy()
+	err = auth.setTOTPKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("restoring totp key: %w", err)
+	}
+
+	if prev != nil {
+		undo = func() (err error) { return auth.setTOTPKey(prev) }
+	}
+
+	return undo, nil
+}
+
+// restoreJSON is the response to the POST /control/restore HTTP API.
+type restoreJSON struct {
+	// Snapshot is the path to the snapshot taken before the restore.
+	Snapshot string `json:"snapshot"`
+}
+
+// handleBackup is the handler for the GET /control/backup HTTP API.
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	// Write into a buffer first to be able to respond with an error.
+	buf := &bytes.Buffer{}
+	err := writeBackup(buf, now)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "creating backup: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(aghhttp.HdrNameContentType, "application/zip")
+	h.Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="AdGuardHome-backup-%s.zip"`, now.UTC().Format("20060102T150405Z")),
+	)
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("backup: writing response: %s", err)
+	}
+}
+
+// handleRestore is the handler for the POST /control/restore HTTP API.  The
+// request body is a backup archive.  If it's valid, it's applied and AdGuard
+// Home restarts.
+func handleRestore(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading body: %s", err)
+
+		return
+	}
+
+	files, err := readBackup(data)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "invalid backup: %s", err)
+
+		return
+	}
+
+	// Retain the current absolute path of the executable the same way
+	// handleUpdate does.
+	execPath, err := os.Executable()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "getting path: %s", err)
+
+		return
+	}
+
+	snapshot, err := restoreBackup(files, time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "restoring backup: %s", err)
+
+		return
+	}
+
+	log.Info("backup: restored backup, restarting")
+
+	_ = aghhttp.WriteJSONResponse(w, r, &restoreJSON{Snapshot: snapshot})
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// Restart the same way as after an update, so that all modules start
+	// with the restored configuration.  See the comment in handleUpdate.
+	go finishUpdate(context.Background(), execPath)
+}
+
+// registerBackupHandlers registers the HTTP handlers for the backup and restore
+// APIs.
+func registerBackupHandlers() {
+	httpRegister(http.MethodGet, "/control/backup", handleBackup)
+	httpRegister(http.MethodPost, "/control/restore", handleRestore)
+}
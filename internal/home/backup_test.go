@@ -0,0 +1,199 @@
+package home
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupBackupTest sets up the working directory with a configuration file,
+// a filter list file, and the sessions database and restores the previous state
+// after the test.
+func setupBackupTest(t *testing.T) (dir string) {
+	t.Helper()
+
+	dir = t.TempDir()
+
+	prevWorkDir, prevConfFile, prevAuth := Context.workDir, Context.configFilename, Context.auth
+	t.Cleanup(func() {
+		Context.workDir, Context.configFilename, Context.auth = prevWorkDir, prevConfFile, prevAuth
+		config.frozen = false
+	})
+
+	Context.workDir = dir
+	Context.configFilename = "AdGuardHome.yaml"
+
+	Context.auth = InitAuth(filepath.Join(dir, "sessions.db"), nil, 60, nil)
+	require.NotNil(t, Context.auth)
+	t.Cleanup(Context.auth.Close)
+
+	filtersDir := filepath.Join(dir, dataDir, backupFiltersDir)
+	err := os.MkdirAll(filtersDir, 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(filtersDir, "1.txt"), []byte("||example.org^\n"), 0o644)
+	require.NoError(t, err)
+
+	return dir
+}
+
+func TestBackup(t *testing.T) {
+	dir := setupBackupTest(t)
+	now := time.Now()
+
+	buf := &bytes.Buffer{}
+	err := writeBackup(buf, now)
+	require.NoError(t, err)
+
+	files, err := readBackup(buf.Bytes())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"1.txt": []byte("||example.org^\n")}, files.filters)
+	assert.NotEmpty(t, files.config)
+
+	key := Context.auth.totpKeyCopy()
+	assert.Equal(t, key, files.totpKey)
+
+	// Change the state to check that the restore replaces it.
+	filtersDir := filepath.Join(dir, dataDir, backupFiltersDir)
+	err = os.WriteFile(filepath.Join(filtersDir, "2.txt"), []byte("||example.com^\n"), 0o644)
+	require.NoError(t, err)
+
+	require.NoError(t, Context.auth.setTOTPKey(make([]byte, totpKeyLen)))
+
+	snapshot, err := restoreBackup(files, now)
+	require.NoError(t, err)
+
+	assert.FileExists(t, snapshot)
+	assert.FileExists(t, filepath.Join(filtersDir, "1.txt"))
+	assert.NoFileExists(t, filepath.Join(filtersDir, "2.txt"))
+	assert.NoDirExists(t, filepath.Join(dir, dataDir, backupFiltersPrevDir))
+	assert.Equal(t, key, Context.auth.totpKeyCopy())
+
+	// The snapshot contains the state before the restore.
+	snapData, err := os.ReadFile(snapshot)
+	require.NoError(t, err)
+
+	snapFiles, err := readBackup(snapData)
+	require.NoError(t, err)
+
+	assert.Len(t, snapFiles.filters, 2)
+
+	assert.True(t, config.frozen)
+}
+
+func TestRestoreBackup_rollback(t *testing.T) {
+	dir := setupBackupTest(t)
+	now := time.Now()
+
+	buf := &bytes.Buffer{}
+	err := writeBackup(buf, now)
+	require.NoError(t, err)
+
+	files, err := readBackup(buf.Bytes())
+	require.NoError(t, err)
+
+	files.filters = map[string][]byte{"2.txt": []byte("||example.com^\n")}
+
+	// Make the restore of the key fail after the filters have been replaced.
+	files.totpKey = []byte("bad")
+
+	key := Context.auth.totpKeyCopy()
+
+	_, err = restoreBackup(files, now)
+	testutil.AssertErrorMsg(t, "restoring totp key: totp key: bad length 3, want 32", err)
+
+	filtersDir := filepath.Join(dir, dataDir, backupFiltersDir)
+	assert.FileExists(t, filepath.Join(filtersDir, "1.txt"))
+	assert.NoFileExists(t, filepath.Join(filtersDir, "2.txt"))
+	assert.Equal(t, key, Context.auth.totpKeyCopy())
+
+	assert.False(t, config.frozen)
+}
+
+func TestReadBackup_bad(t *testing.T) {
+	newArchive := func(t *testing.T, files map[string]string) (data []byte) {
+		t.Helper()
+
+		buf := &bytes.Buffer{}
+		zw := zip.NewWriter(buf)
+		for name, content := range files {
+			fw, err := zw.Create(name)
+			require.NoError(t, err)
+
+			_, err = fw.Write([]byte(content))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, zw.Close())
+
+		return buf.Bytes()
+	}
+
+	const manifest = `{"schema_version":20}`
+
+	testCases := []struct {
+		files      map[string]string
+		name       string
+		wantErrMsg string
+	}{{
+		files: map[string]string{
+			backupManifestName: manifest,
+			backupConfigName:   "schema_version: 20\n",
+			"../../etc/passwd": "",
+		},
+		name:       "traversal",
+		wantErrMsg: `unexpected file "../../etc/passwd" in archive`,
+	}, {
+		files: map[string]string{
+			backupManifestName: manifest,
+		},
+		name:       "no_config",
+		wantErrMsg: "no AdGuardHome.yaml in archive",
+	}, {
+		files: map[string]string{
+			backupManifestName: manifest,
+			backupConfigName:   "schema_version: 20\n",
+			backupTOTPKeyName:  "short",
+		},
+		name:       "bad_totp_key",
+		wantErrMsg: "bad totp.key length 5, want 32",
+	}, {
+		files: map[string]string{
+			backupManifestName: `{"schema_version":1000}`,
+			backupConfigName:   "schema_version: 1000\n",
+		},
+		name: "newer",
+		wantErrMsg: "validating config: backup is from a newer version with schema " +
+			"version 1000, current is 20",
+	}, {
+		files: map[string]string{
+			backupManifestName: manifest,
+			backupConfigName:   "schema_version: 20\nbind_port: 53\ndns:\n  port: 53\n",
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		files: map[string]string{
+			backupManifestName: manifest,
+			backupConfigName: "schema_version: 20\nusers:\n- name: a\n  password: b\n" +
+				"  role: root\n",
+		},
+		name:       "bad_role",
+		wantErrMsg: `validating config: validating users: at index 0: user "a": bad role "root"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readBackup(newArchive(t, tc.files))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package home
 import (
 	"encoding"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -19,6 +20,10 @@ type Client struct {
 	safeSearchConf filtering.SafeSearchConfig
 	SafeSearch     filtering.SafeSearch
 
+	// LocalDiscoveryPassthrough, if not nil, overrides the global setting of
+	// the local service discovery names passthrough for this client.
+	LocalDiscoveryPassthrough *bool
+
 	Name string
 
 	IDs             []string
@@ -55,6 +60,7 @@ const (
 	ClientSourceWHOIS
 	ClientSourceARP
 	ClientSourceRDNS
+	ClientSourceTailscale
 	ClientSourceDHCP
 	ClientSourceHostsFile
 	ClientSourcePersistent
@@ -72,6 +78,8 @@ func (cs clientSource) String() (s string) {
 		return "ARP"
 	case ClientSourceRDNS:
 		return "rDNS"
+	case ClientSourceTailscale:
+		return "Tailscale"
 	case ClientSourceDHCP:
 		return "DHCP"
 	case ClientSourceHostsFile:
@@ -94,7 +102,18 @@ func (cs clientSource) MarshalText() (text []byte, err error) {
 type RuntimeClient struct {
 	WHOISInfo *RuntimeClientWHOISInfo
 	Host      string
-	Source    clientSource
+
+	// SourceLabel is the label of the additional hosts file the client has
+	// been read from.  It's only set for [ClientSourceHostsFile].
+	SourceLabel string
+
+	// lastSeen is the time of the last addition of the client or the last
+	// request from it in Unix nanoseconds.  It's used by the cleanup of the
+	// runtime clients.  It's accessed atomically, so that the requests only
+	// need the read lock of the clients container to update it.
+	lastSeen atomic.Int64
+
+	Source clientSource
 }
 
 // RuntimeClientWHOISInfo is the filtered WHOIS data for a runtime client.
@@ -31,6 +31,14 @@ type clientsContainer struct {
 	list    map[string]*Client // name -> client
 	idIndex map[string]*Client // ID -> client
 
+	// subnetIndex is the index of the clients by the subnets from their IDs.
+	// It's rebuilt each time idIndex changes.
+	subnetIndex *aghnet.PrefixTree[*Client]
+
+	// wgPeers is the index of the public keys of the WireGuard peers by their
+	// allowed IPs.  It's replaced on each refresh.
+	wgPeers *aghnet.PrefixTree[string]
+
 	// ipToRC is the IP address to *RuntimeClient map.
 	ipToRC map[netip.Addr]*RuntimeClient
 
@@ -49,11 +57,26 @@ type clientsContainer struct {
 	// arpdb stores the neighbors retrieved from ARP.
 	arpdb aghnet.ARPDB
 
+	// arpLastRefresh is the time of the last successful refresh of arpdb.
+	arpLastRefresh time.Time
+
+	// macVendors is used to look up the vendors of the neighbors from arpdb.
+	// It may be nil.
+	macVendors *aghnet.MACVendors
+
+	// runtimeExpiry is the time after which the evictable runtime clients,
+	// which haven't been seen, are removed.  If zero, they are never removed.
+	runtimeExpiry time.Duration
+
+	// maxRuntime is the maximum number of the evictable runtime clients.  If
+	// zero, the number is not limited.
+	maxRuntime uint
+
 	// lock protects all fields.
 	//
 	// TODO(a.garipov): Use a pointer and describe which fields are protected in
 	// more detail.
-	lock sync.Mutex
+	lock sync.RWMutex
 
 	// testing is a flag that disables some features for internal tests.
 	//
@@ -76,6 +99,8 @@ func (clients *clientsContainer) Init(
 	}
 	clients.list = make(map[string]*Client)
 	clients.idIndex = make(map[string]*Client)
+	clients.subnetIndex = aghnet.NewPrefixTree[*Client]()
+	clients.wgPeers = aghnet.NewPrefixTree[string]()
 	clients.ipToRC = map[netip.Addr]*RuntimeClient{}
 
 	clients.allTags = stringutil.NewSet(clientTags...)
@@ -136,6 +161,10 @@ func (clients *clientsContainer) reloadARP() {
 type clientObject struct {
 	SafeSearchConf filtering.SafeSearchConfig `yaml:"safe_search"`
 
+	// LocalDiscoveryPassthrough, if not nil, overrides the global
+	// local_discovery_passthrough setting.
+	LocalDiscoveryPassthrough *bool `yaml:"local_discovery_passthrough,omitempty"`
+
 	Name string `yaml:"name"`
 
 	Tags            []string `yaml:"tags"`
@@ -154,60 +183,74 @@ type clientObject struct {
 // configuration file.
 func (clients *clientsContainer) addFromConfig(objects []*clientObject, filteringConf *filtering.Config) {
 	for _, o := range objects {
-		cli := &Client{
-			Name: o.Name,
-
-			IDs:       o.IDs,
-			Upstreams: o.Upstreams,
-
-			UseOwnSettings:        !o.UseGlobalSettings,
-			FilteringEnabled:      o.FilteringEnabled,
-			ParentalEnabled:       o.ParentalEnabled,
-			safeSearchConf:        o.SafeSearchConf,
-			SafeBrowsingEnabled:   o.SafeBrowsingEnabled,
-			UseOwnBlockedServices: !o.UseGlobalBlockedServices,
+		cli, err := clients.clientFromObject(o, filteringConf)
+		if err != nil {
+			log.Error("clients: init client %s: %s", o.Name, err)
+
+			continue
 		}
 
-		if o.SafeSearchConf.Enabled {
-			o.SafeSearchConf.CustomResolver = safeSearchResolver{}
+		_, err = clients.Add(cli)
+		if err != nil {
+			log.Error("clients: adding clients %s: %s", cli.Name, err)
+		}
+	}
+}
 
-			ss, err := safesearch.NewDefaultSafeSearch(
-				o.SafeSearchConf,
-				filteringConf.SafeSearchCacheSize,
-				time.Minute*time.Duration(filteringConf.CacheTime),
-			)
-			if err != nil {
-				log.Error("clients: init client safesearch %s: %s", cli.Name, err)
+// clientFromObject returns a new persistent client from the YAML
+// representation o.  The unknown blocked services and tags are skipped.
+func (clients *clientsContainer) clientFromObject(
+	o *clientObject,
+	filteringConf *filtering.Config,
+) (cli *Client, err error) {
+	cli = &Client{
+		Name: o.Name,
 
-				continue
-			}
+		IDs:       o.IDs,
+		Upstreams: o.Upstreams,
 
-			cli.SafeSearch = ss
-		}
+		UseOwnSettings:        !o.UseGlobalSettings,
+		FilteringEnabled:      o.FilteringEnabled,
+		ParentalEnabled:       o.ParentalEnabled,
+		safeSearchConf:        o.SafeSearchConf,
+		SafeBrowsingEnabled:   o.SafeBrowsingEnabled,
+		UseOwnBlockedServices: !o.UseGlobalBlockedServices,
 
-		for _, s := range o.BlockedServices {
-			if filtering.BlockedSvcKnown(s) {
-				cli.BlockedServices = append(cli.BlockedServices, s)
-			} else {
-				log.Info("clients: skipping unknown blocked service %q", s)
-			}
-		}
+		LocalDiscoveryPassthrough: o.LocalDiscoveryPassthrough,
+	}
 
-		for _, t := range o.Tags {
-			if clients.allTags.Has(t) {
-				cli.Tags = append(cli.Tags, t)
-			} else {
-				log.Info("clients: skipping unknown tag %q", t)
-			}
+	if o.SafeSearchConf.Enabled {
+		o.SafeSearchConf.CustomResolver = safeSearchResolver{}
+
+		cli.SafeSearch, err = safesearch.NewDefaultSafeSearch(
+			o.SafeSearchConf,
+			filteringConf.SafeSearchCacheSize,
+			time.Minute*time.Duration(filteringConf.CacheTime),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("safesearch: %w", err)
 		}
+	}
 
-		slices.Sort(cli.Tags)
+	for _, s := range o.BlockedServices {
+		if filtering.BlockedSvcKnown(s) {
+			cli.BlockedServices = append(cli.BlockedServices, s)
+		} else {
+			log.Info("clients: skipping unknown blocked service %q", s)
+		}
+	}
 
-		_, err := clients.Add(cli)
-		if err != nil {
-			log.Error("clients: adding clients %s: %s", cli.Name, err)
+	for _, t := range o.Tags {
+		if clients.allTags.Has(t) {
+			cli.Tags = append(cli.Tags, t)
+		} else {
+			log.Info("clients: skipping unknown tag %q", t)
 		}
 	}
+
+	slices.Sort(cli.Tags)
+
+	return cli, nil
 }
 
 // forConfig returns all currently known persistent clients as objects for the
@@ -232,6 +275,8 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			SafeSearchConf:           cli.safeSearchConf,
 			SafeBrowsingEnabled:      cli.SafeBrowsingEnabled,
 			UseGlobalBlockedServices: !cli.UseOwnBlockedServices,
+
+			LocalDiscoveryPassthrough: cli.LocalDiscoveryPassthrough,
 		}
 
 		objs = append(objs, o)
@@ -248,15 +293,20 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	return objs
 }
 
-// arpClientsUpdatePeriod defines how often ARP clients are updated.
-const arpClientsUpdatePeriod = 10 * time.Minute
-
 func (clients *clientsContainer) periodicUpdate() {
 	defer log.OnPanic("clients container")
 
 	for {
 		clients.reloadARP()
-		time.Sleep(arpClientsUpdatePeriod)
+		clients.reloadWireGuard()
+		clients.reloadTailscale()
+		clients.rmExpiredRuntime(time.Now())
+
+		config.RLock()
+		ivl := arpRefreshIvl(config.Clients.Sources)
+		config.RUnlock()
+
+		time.Sleep(ivl)
 	}
 }
 
@@ -264,7 +314,9 @@ func (clients *clientsContainer) onDHCPLeaseChanged(flags int) {
 	switch flags {
 	case dhcpd.LeaseChangedAdded,
 		dhcpd.LeaseChangedAddedStatic,
-		dhcpd.LeaseChangedRemovedStatic:
+		dhcpd.LeaseChangedRemovedStatic,
+		dhcpd.LeaseChangedRemovedDynamic,
+		dhcpd.LeaseChangedDeclined:
 		clients.updateFromDHCP(true)
 	case dhcpd.LeaseChangedRemovedAll:
 		clients.updateFromDHCP(false)
@@ -432,20 +484,20 @@ func (clients *clientsContainer) findLocked(id string) (c *Client, ok bool) {
 		return nil, false
 	}
 
-	for _, c = range clients.list {
-		for _, id := range c.IDs {
-			var subnet netip.Prefix
-			subnet, err = netip.ParsePrefix(id)
-			if err != nil {
-				continue
-			}
-
-			if subnet.Contains(ip) {
-				return c, true
-			}
+	// Look up the WireGuard peers before the subnets, since a public key
+	// identifies a client more precisely than a subnet does.
+	if _, key, wgOK := clients.wgPeers.Lookup(ip); wgOK {
+		c, ok = clients.idIndex[key]
+		if ok {
+			return c, true
 		}
 	}
 
+	_, c, ok = clients.subnetIndex.Lookup(ip)
+	if ok {
+		return c, true
+	}
+
 	if clients.dhcpServer == nil {
 		return nil, false
 	}
@@ -527,6 +579,11 @@ func (clients *clientsContainer) check(c *Client) (err error) {
 		return fmt.Errorf("invalid upstream servers: %w", err)
 	}
 
+	err = c.safeSearchConf.ValidateRegions()
+	if err != nil {
+		return fmt.Errorf("invalid safe search: %w", err)
+	}
+
 	return nil
 }
 
@@ -552,6 +609,12 @@ func normalizeClientIdentifier(idStr string) (norm string, err error) {
 		return mac.String(), nil
 	}
 
+	// Check the WireGuard public keys before the ClientIDs, since the keys
+	// are case-sensitive.
+	if err = aghnet.ValidateWireGuardKey(idStr); err == nil {
+		return idStr, nil
+	}
+
 	if err = dnsforward.ValidateClientID(idStr); err == nil {
 		return strings.ToLower(idStr), nil
 	}
@@ -593,6 +656,8 @@ func (clients *clientsContainer) Add(c *Client) (ok bool, err error) {
 		clients.idIndex[id] = c
 	}
 
+	clients.rebuildSubnetIndex()
+
 	log.Debug("clients: added %q: ID:%q [%d]", c.Name, c.IDs, len(clients.list))
 
 	return true, nil
@@ -621,6 +686,8 @@ func (clients *clientsContainer) Del(name string) (ok bool) {
 		delete(clients.idIndex, id)
 	}
 
+	clients.rebuildSubnetIndex()
+
 	return true
 }
 
@@ -694,9 +761,25 @@ func (clients *clientsContainer) updateIDIndex(cli *Client, newIDs []string) (er
 		clients.idIndex[id] = cli
 	}
 
+	clients.rebuildSubnetIndex()
+
 	return nil
 }
 
+// rebuildSubnetIndex rebuilds the index of the clients by the subnets from
+// their IDs.  clients.lock is expected to be locked.
+func (clients *clientsContainer) rebuildSubnetIndex() {
+	idx := aghnet.NewPrefixTree[*Client]()
+	for id, c := range clients.idIndex {
+		subnet, err := netip.ParsePrefix(id)
+		if err == nil {
+			idx.Insert(subnet, c)
+		}
+	}
+
+	clients.subnetIndex = idx
+}
+
 // setWHOISInfo sets the WHOIS information for a client.
 func (clients *clientsContainer) setWHOISInfo(ip netip.Addr, wi *RuntimeClientWHOISInfo) {
 	clients.lock.Lock()
@@ -723,8 +806,10 @@ func (clients *clientsContainer) setWHOISInfo(ip netip.Addr, wi *RuntimeClientWH
 	}
 
 	rc.WHOISInfo = wi
+	rc.setLastSeen(time.Now())
 
 	clients.ipToRC[ip] = rc
+	clients.evictRuntimeLocked()
 
 	log.Debug("clients: set whois info for runtime client with ip %s: %+v", ip, wi)
 }
@@ -757,14 +842,18 @@ func (clients *clientsContainer) addHostLocked(
 
 		rc.Host = host
 		rc.Source = src
+		rc.SourceLabel = ""
+		rc.setLastSeen(time.Now())
 	} else {
 		rc = &RuntimeClient{
 			Host:      host,
 			Source:    src,
 			WHOISInfo: &RuntimeClientWHOISInfo{},
 		}
+		rc.setLastSeen(time.Now())
 
 		clients.ipToRC[ip] = rc
+		clients.evictRuntimeLocked()
 	}
 
 	log.Debug("clients: added %s -> %q [%d]", ip, host, len(clients.ipToRC))
@@ -786,7 +875,7 @@ func (clients *clientsContainer) rmHostsBySrc(src clientSource) {
 }
 
 // addFromHostsFile fills the client-hostname pairing index from the system's
-// hosts files.
+// and the additional hosts files.
 func (clients *clientsContainer) addFromHostsFile(hosts aghnet.HostsRecords) {
 	clients.lock.Lock()
 	defer clients.lock.Unlock()
@@ -795,11 +884,14 @@ func (clients *clientsContainer) addFromHostsFile(hosts aghnet.HostsRecords) {
 
 	n := 0
 	for ip, rec := range hosts {
-		clients.addHostLocked(ip, rec.Canonical, ClientSourceHostsFile)
+		if clients.addHostLocked(ip, rec.Canonical, ClientSourceHostsFile) {
+			clients.ipToRC[ip].SourceLabel = rec.Source
+		}
+
 		n++
 	}
 
-	log.Debug("clients: added %d client aliases from system hosts file", n)
+	log.Debug("clients: added %d client aliases from hosts files", n)
 }
 
 // addFromSystemARP adds the IP-hostname pairings from the output of the arp -a
@@ -808,21 +900,30 @@ func (clients *clientsContainer) addFromSystemARP() {
 	if err := clients.arpdb.Refresh(); err != nil {
 		log.Error("refreshing arp container: %s", err)
 
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
+
 		clients.arpdb = aghnet.EmptyARPDB{}
 
 		return
 	}
 
-	ns := clients.arpdb.Neighbors()
+	config.RLock()
+	ifaces := config.Clients.Sources.ARPInterfaces
+	config.RUnlock()
+
+	ns := filterNeighbors(clients.arpdb.Neighbors(), ifaces, ifaceSubnets)
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	clients.arpLastRefresh = time.Now()
 	if len(ns) == 0 {
 		log.Debug("refreshing arp container: the update is empty")
 
 		return
 	}
 
-	clients.lock.Lock()
-	defer clients.lock.Unlock()
-
 	clients.rmHostsBySrc(ClientSourceARP)
 
 	added := 0
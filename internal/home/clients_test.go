@@ -324,6 +324,54 @@ func TestClientsAddExisting(t *testing.T) {
 	})
 }
 
+func TestClientsFind_subnet(t *testing.T) {
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	ok, err := clients.Add(&Client{
+		IDs:  []string{"10.0.0.0/8"},
+		Name: "wide",
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = clients.Add(&Client{
+		IDs:  []string{"10.1.0.0/16"},
+		Name: "narrow",
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	c, ok := clients.Find("10.1.2.3")
+	require.True(t, ok)
+	assert.Equal(t, "narrow", c.Name)
+
+	c, ok = clients.Find("10.2.0.1")
+	require.True(t, ok)
+	assert.Equal(t, "wide", c.Name)
+
+	require.True(t, clients.Del("narrow"))
+
+	c, ok = clients.Find("10.1.2.3")
+	require.True(t, ok)
+	assert.Equal(t, "wide", c.Name)
+
+	err = clients.Update("wide", &Client{
+		IDs:  []string{"192.168.0.0/24"},
+		Name: "wide",
+	})
+	require.NoError(t, err)
+
+	_, ok = clients.Find("10.1.2.3")
+	assert.False(t, ok)
+
+	c, ok = clients.Find("192.168.0.1")
+	require.True(t, ok)
+	assert.Equal(t, "wide", c.Name)
+}
+
 func TestClientsCustomUpstream(t *testing.T) {
 	clients := clientsContainer{
 		testing: true,
@@ -0,0 +1,214 @@
+package home
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// ARP Runtime Clients
+
+// defaultARPRefreshIvl is the default interval between the refreshes of the ARP
+// runtime clients.
+const defaultARPRefreshIvl = 10 * time.Minute
+
+// macVendorsPaths are the paths to the OUI databases shipped by the common
+// packages, which are used when the path isn't configured.
+var macVendorsPaths = []string{
+	"/usr/share/ieee-data/oui.txt",
+	"/usr/share/hwdata/oui.txt",
+	"/usr/share/misc/oui.txt",
+	"/usr/share/wireshark/manuf",
+	"/usr/share/nmap/nmap-mac-prefixes",
+}
+
+// validateARPSources returns an error if the ARP settings of the runtime
+// client sources aren't valid.
+func validateARPSources(srcs *clientSourcesConfig) (err error) {
+	if ivl := srcs.ARPRefreshInterval; ivl.Duration < 0 {
+		return fmt.Errorf("arp_refresh_interval: must not be negative, got %s", ivl)
+	}
+
+	for i, name := range srcs.ARPInterfaces {
+		if name == "" {
+			return fmt.Errorf("arp_interfaces: at index %d: %w", i, errors.Error("no value"))
+		}
+	}
+
+	return nil
+}
+
+// arpRefreshIvl returns the interval between the refreshes of the ARP runtime
+// clients.
+func arpRefreshIvl(srcs *clientSourcesConfig) (ivl time.Duration) {
+	if ivl = srcs.ARPRefreshInterval.Duration; ivl == 0 {
+		return defaultARPRefreshIvl
+	}
+
+	return ivl
+}
+
+// loadMACVendors reads the OUI database from the file at path.  If path is
+// empty, the first existing one of [macVendorsPaths] is used, if any.  The
+// errors are logged, since the database is optional.
+func loadMACVendors(path string) (v *aghnet.MACVendors) {
+	paths := []string{path}
+	if path == "" {
+		paths = macVendorsPaths
+	}
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if errors.Is(err, os.ErrNotExist) && path == "" {
+			continue
+		} else if err != nil {
+			log.Error("clients: opening mac vendors: %s", err)
+
+			return nil
+		}
+
+		v, err = aghnet.ParseMACVendors(f)
+		err = errors.WithDeferred(err, f.Close())
+		if err != nil {
+			log.Error("clients: reading mac vendors from %q: %s", p, err)
+
+			return nil
+		}
+
+		log.Debug("clients: loaded %d mac vendors from %q", v.Len(), p)
+
+		return v
+	}
+
+	return nil
+}
+
+// ifaceSubnets returns the subnets of the network interfaces with the given
+// names.  The errors are logged, since an interface may appear later.
+func ifaceSubnets(names []string) (subnets []netip.Prefix) {
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			log.Debug("clients: arp interface %q: %s", name, err)
+
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Debug("clients: arp interface %q: getting addresses: %s", name, err)
+
+			continue
+		}
+
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			ip, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+
+			ones, _ := ipNet.Mask.Size()
+			subnets = append(subnets, netip.PrefixFrom(ip.Unmap(), ones).Masked())
+		}
+	}
+
+	return subnets
+}
+
+// filterNeighbors returns the neighbors from ns within subnets.  If names is
+// empty, ns are returned as is.  subnets must not be nil if names isn't empty.
+func filterNeighbors(
+	ns []aghnet.Neighbor,
+	names []string,
+	subnets func(names []string) (subnets []netip.Prefix),
+) (filtered []aghnet.Neighbor) {
+	if len(names) == 0 {
+		return ns
+	}
+
+	prefixes := subnets(names)
+	for _, n := range ns {
+		for _, p := range prefixes {
+			if p.Contains(n.IP) {
+				filtered = append(filtered, n)
+
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// neighborJSON is a single entry of the network neighborhood table.
+type neighborJSON struct {
+	IP     netip.Addr `json:"ip"`
+	MAC    string     `json:"mac"`
+	Name   string     `json:"name"`
+	Vendor string     `json:"vendor"`
+}
+
+// neighborsJSON is the response of the GET /control/clients/neighbors HTTP
+// API.
+type neighborsJSON struct {
+	// LastRefresh is the time of the last successful refresh of the table, if
+	// any.
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+
+	// RefreshInterval is the interval between the refreshes of the table.
+	RefreshInterval timeutil.Duration `json:"refresh_interval"`
+
+	Neighbors []*neighborJSON `json:"neighbors"`
+
+	// Enabled is false if the ARP runtime client source is disabled.
+	Enabled bool `json:"enabled"`
+}
+
+// handleGetNeighbors is the handler for the GET /control/clients/neighbors
+// HTTP API.
+func (clients *clientsContainer) handleGetNeighbors(w http.ResponseWriter, r *http.Request) {
+	clients.lock.Lock()
+	arpdb, lastRefresh, vendors := clients.arpdb, clients.arpLastRefresh, clients.macVendors
+	clients.lock.Unlock()
+
+	config.RLock()
+	srcs := *config.Clients.Sources
+	config.RUnlock()
+
+	resp := &neighborsJSON{
+		RefreshInterval: timeutil.Duration{Duration: arpRefreshIvl(&srcs)},
+		Neighbors:       []*neighborJSON{},
+		Enabled:         srcs.ARP,
+	}
+
+	if !lastRefresh.IsZero() {
+		resp.LastRefresh = &lastRefresh
+	}
+
+	if arpdb != nil {
+		for _, n := range filterNeighbors(arpdb.Neighbors(), srcs.ARPInterfaces, ifaceSubnets) {
+			resp.Neighbors = append(resp.Neighbors, &neighborJSON{
+				IP:     n.IP,
+				MAC:    n.MAC.String(),
+				Name:   n.Name,
+				Vendor: vendors.Lookup(n.MAC),
+			})
+		}
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
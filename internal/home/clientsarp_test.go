@@ -0,0 +1,69 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateARPSources(t *testing.T) {
+	testCases := []struct {
+		srcs       *clientSourcesConfig
+		name       string
+		wantErrMsg string
+	}{{
+		srcs: &clientSourcesConfig{
+			ARPInterfaces:      []string{"eth0"},
+			ARPRefreshInterval: timeutil.Duration{Duration: time.Minute},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		srcs: &clientSourcesConfig{
+			ARPRefreshInterval: timeutil.Duration{Duration: -time.Minute},
+		},
+		name:       "negative_interval",
+		wantErrMsg: "arp_refresh_interval: must not be negative, got -1m",
+	}, {
+		srcs: &clientSourcesConfig{
+			ARPInterfaces: []string{"eth0", ""},
+		},
+		name:       "empty_interface",
+		wantErrMsg: "arp_interfaces: at index 1: no value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateARPSources(tc.srcs))
+		})
+	}
+}
+
+func TestFilterNeighbors(t *testing.T) {
+	lan := aghnet.Neighbor{
+		Name: "lan",
+		IP:   netip.MustParseAddr("192.168.1.2"),
+		MAC:  net.HardwareAddr{0x00, 0x00, 0x0C, 0x01, 0x02, 0x03},
+	}
+	wan := aghnet.Neighbor{
+		Name: "wan",
+		IP:   netip.MustParseAddr("203.0.113.1"),
+		MAC:  net.HardwareAddr{0x00, 0x00, 0x0C, 0x01, 0x02, 0x04},
+	}
+	ns := []aghnet.Neighbor{lan, wan}
+
+	subnets := func(names []string) (subnets []netip.Prefix) {
+		assert.Equal(t, []string{"br-lan"}, names)
+
+		return []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}
+	}
+
+	assert.Equal(t, ns, filterNeighbors(ns, nil, subnets))
+	assert.Equal(t, []aghnet.Neighbor{lan}, filterNeighbors(ns, []string{"br-lan"}, subnets))
+}
@@ -0,0 +1,178 @@
+package home
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"golang.org/x/exp/slices"
+)
+
+// Client Encryption Profiles
+
+// clientEncryptionJSON contains the encrypted DNS addresses of a single
+// ClientID and the links to the configuration profiles using them.
+type clientEncryptionJSON struct {
+	// ClientID is the ClientID used within the addresses.
+	ClientID string `json:"client_id"`
+
+	// DoHURL is the DNS-over-HTTPS URL, if DoH is enabled.
+	DoHURL string `json:"doh_url,omitempty"`
+
+	// DoTURL is the DNS-over-TLS address, if DoT is enabled.
+	DoTURL string `json:"dot_url,omitempty"`
+
+	// DoQURL is the DNS-over-QUIC address, if DoQ is enabled.
+	DoQURL string `json:"doq_url,omitempty"`
+
+	// AndroidPrivateDNS is the hostname for the Private DNS setting of
+	// Android, if DoT is enabled on the default port, since Android doesn't
+	// support other ports.
+	AndroidPrivateDNS string `json:"android_private_dns,omitempty"`
+
+	// AppleDoHProfile is the path to the Apple DoH configuration profile, if
+	// DoH is enabled.
+	AppleDoHProfile string `json:"apple_doh_profile,omitempty"`
+
+	// AppleDoTProfile is the path to the Apple DoT configuration profile, if
+	// DoT is enabled.
+	AppleDoTProfile string `json:"apple_dot_profile,omitempty"`
+}
+
+// clientEncryptionResp is the response to the GET /control/clients/encryption
+// HTTP API.
+type clientEncryptionResp struct {
+	// Name is the name of the persistent client.
+	Name string `json:"name"`
+
+	// ServerName is the server name from the encryption settings.
+	ServerName string `json:"server_name"`
+
+	// Profiles are the encrypted DNS addresses for each ClientID of the
+	// client.
+	Profiles []*clientEncryptionJSON `json:"profiles"`
+}
+
+// isClientID returns true if id is a ClientID and not an IP address, a subnet,
+// or a MAC address.
+func isClientID(id string) (ok bool) {
+	if _, err := netip.ParseAddr(id); err == nil {
+		return false
+	} else if _, err = netip.ParsePrefix(id); err == nil {
+		return false
+	} else if _, err = net.ParseMAC(id); err == nil {
+		return false
+	}
+
+	return dnsforward.ValidateClientID(id) == nil
+}
+
+// newClientEncryption returns the encrypted DNS addresses of the ClientID id
+// using the encryption settings conf.  conf must have a server name.
+func newClientEncryption(conf *tlsConfigSettings, id string) (ce *clientEncryptionJSON) {
+	ce = &clientEncryptionJSON{
+		ClientID: id,
+	}
+
+	profileQuery := url.Values{
+		"host":      []string{conf.ServerName},
+		"client_id": []string{id},
+	}.Encode()
+
+	if conf.PortHTTPS != 0 {
+		ce.DoHURL = (&url.URL{
+			Scheme: aghhttp.SchemeHTTPS,
+			Host:   hostWithPort(conf.ServerName, conf.PortHTTPS, defaultPortHTTPS),
+			Path:   path.Join("/dns-query", id),
+		}).String()
+		ce.AppleDoHProfile = "/apple/doh.mobileconfig?" + profileQuery
+	}
+
+	host := id + "." + conf.ServerName
+	if conf.PortDNSOverTLS != 0 {
+		ce.DoTURL = "tls://" + hostWithPort(host, conf.PortDNSOverTLS, defaultPortTLS)
+		ce.AppleDoTProfile = "/apple/dot.mobileconfig?" + profileQuery
+		if conf.PortDNSOverTLS == defaultPortTLS {
+			ce.AndroidPrivateDNS = host
+		}
+	}
+
+	if conf.PortDNSOverQUIC != 0 {
+		ce.DoQURL = "quic://" + hostWithPort(host, conf.PortDNSOverQUIC, defaultPortQUIC)
+	}
+
+	return ce
+}
+
+// hostWithPort returns host with port joined, unless port is defPort.
+func hostWithPort(host string, port, defPort int) (hostport string) {
+	if port == defPort {
+		return host
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// handleClientEncryption is the handler for the GET /control/clients/encryption
+// HTTP API.  It responds with the encrypted DNS addresses and the configuration
+// profiles for each ClientID of the persistent client with the name from the
+// query.
+func (clients *clientsContainer) handleClientEncryption(w http.ResponseWriter, r *http.Request) {
+	conf := &tlsConfigSettings{}
+	if Context.tls != nil {
+		Context.tls.WriteDiskConfig(conf)
+	}
+
+	if !conf.Enabled || conf.ServerName == "" {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "encryption is not configured")
+
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	ids, ok := clients.clientIDs(name)
+	if !ok {
+		aghhttp.Error(r, w, http.StatusNotFound, "client %q not found", name)
+
+		return
+	}
+
+	resp := &clientEncryptionResp{
+		Name:       name,
+		ServerName: conf.ServerName,
+		Profiles:   make([]*clientEncryptionJSON, 0, len(ids)),
+	}
+
+	for _, id := range ids {
+		resp.Profiles = append(resp.Profiles, newClientEncryption(conf, id))
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// clientIDs returns the sorted ClientIDs of the persistent client with name.
+// ok is false if there is no such client.
+func (clients *clientsContainer) clientIDs(name string) (ids []string, ok bool) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	c, ok := clients.list[name]
+	if !ok {
+		return nil, false
+	}
+
+	for _, id := range c.IDs {
+		if isClientID(id) {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	return ids, true
+}
@@ -0,0 +1,93 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientEncryption(t *testing.T) {
+	const (
+		serverName = "dns.example"
+		clientID   = "laptop"
+	)
+
+	testCases := []struct {
+		conf *tlsConfigSettings
+		want *clientEncryptionJSON
+		name string
+	}{{
+		conf: &tlsConfigSettings{
+			ServerName:      serverName,
+			PortHTTPS:       defaultPortHTTPS,
+			PortDNSOverTLS:  defaultPortTLS,
+			PortDNSOverQUIC: defaultPortQUIC,
+		},
+		want: &clientEncryptionJSON{
+			ClientID:          clientID,
+			DoHURL:            "https://dns.example/dns-query/laptop",
+			DoTURL:            "tls://laptop.dns.example",
+			DoQURL:            "quic://laptop.dns.example",
+			AndroidPrivateDNS: "laptop.dns.example",
+			AppleDoHProfile:   "/apple/doh.mobileconfig?client_id=laptop&host=dns.example",
+			AppleDoTProfile:   "/apple/dot.mobileconfig?client_id=laptop&host=dns.example",
+		},
+		name: "default_ports",
+	}, {
+		conf: &tlsConfigSettings{
+			ServerName:     serverName,
+			PortHTTPS:      8443,
+			PortDNSOverTLS: 8853,
+		},
+		want: &clientEncryptionJSON{
+			ClientID:        clientID,
+			DoHURL:          "https://dns.example:8443/dns-query/laptop",
+			DoTURL:          "tls://laptop.dns.example:8853",
+			AppleDoHProfile: "/apple/doh.mobileconfig?client_id=laptop&host=dns.example",
+			AppleDoTProfile: "/apple/dot.mobileconfig?client_id=laptop&host=dns.example",
+		},
+		name: "custom_ports",
+	}, {
+		conf: &tlsConfigSettings{
+			ServerName: serverName,
+		},
+		want: &clientEncryptionJSON{
+			ClientID: clientID,
+		},
+		name: "disabled",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, newClientEncryption(tc.conf, clientID))
+		})
+	}
+}
+
+func TestIsClientID(t *testing.T) {
+	testCases := []struct {
+		id   string
+		want bool
+	}{{
+		id:   "laptop",
+		want: true,
+	}, {
+		id:   "1.2.3.4",
+		want: false,
+	}, {
+		id:   "1.2.3.0/24",
+		want: false,
+	}, {
+		id:   "aa:bb:cc:dd:ee:ff",
+		want: false,
+	}, {
+		id:   "Bad_ID",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			assert.Equal(t, tc.want, isClientID(tc.id))
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
 )
 
 // clientJSON is a common structure used by several handlers to deal with
@@ -27,6 +28,10 @@ type clientJSON struct {
 	// the allowlist.
 	DisallowedRule *string `json:"disallowed_rule,omitempty"`
 
+	// LocalDiscoveryPassthrough, if not nil, overrides the global setting of
+	// the local service discovery names passthrough for the client.
+	LocalDiscoveryPassthrough *bool `json:"local_discovery_passthrough,omitempty"`
+
 	WHOISInfo      *RuntimeClientWHOISInfo     `json:"whois_info,omitempty"`
 	SafeSearchConf *filtering.SafeSearchConfig `json:"safe_search"`
 
@@ -49,9 +54,10 @@ type clientJSON struct {
 type runtimeClientJSON struct {
 	WHOISInfo *RuntimeClientWHOISInfo `json:"whois_info"`
 
-	Name   string       `json:"name"`
-	IP     netip.Addr   `json:"ip"`
-	Source clientSource `json:"source"`
+	Name        string       `json:"name"`
+	IP          netip.Addr   `json:"ip"`
+	Source      clientSource `json:"source"`
+	SourceLabel string       `json:"source_label,omitempty"`
 }
 
 type clientListJSON struct {
@@ -61,32 +67,60 @@ type clientListJSON struct {
 }
 
 // handleGetClients is the handler for GET /control/clients HTTP API.
-func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http.Request) {
-	data := clientListJSON{}
+//
+// The response has the format of clientListJSON, but the clients are encoded
+// and written one by one, so that the whole encoded response is never kept in
+// memory.  The clients are copied beforehand, so that the lock isn't held while
+// the response is written to a possibly slow HTTP client.
+func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, _ *http.Request) {
+	persistent, runtime := clients.listJSON()
+
+	s := aghhttp.NewJSONStream(w)
+
+	s.BeginArray("clients")
+	for _, cj := range persistent {
+		s.Elem(cj)
+	}
+	s.EndArray()
+
+	s.BeginArray("auto_clients")
+	for _, rcj := range runtime {
+		s.Elem(rcj)
+	}
+	s.EndArray()
 
-	clients.lock.Lock()
-	defer clients.lock.Unlock()
+	s.Field("supported_tags", clientTags)
+
+	err := s.Close()
+	if err != nil {
+		log.Debug("clients: writing response: %s", err)
+	}
+}
 
+// listJSON returns the copies of the persistent and the runtime clients
+// converted to JSON objects.
+func (clients *clientsContainer) listJSON() (persistent []*clientJSON, runtime []runtimeClientJSON) {
+	clients.lock.RLock()
+	defer clients.lock.RUnlock()
+
+	persistent = make([]*clientJSON, 0, len(clients.list))
 	for _, c := range clients.list {
-		cj := clientToJSON(c)
-		data.Clients = append(data.Clients, cj)
+		persistent = append(persistent, clientToJSON(c))
 	}
 
+	runtime = make([]runtimeClientJSON, 0, len(clients.ipToRC))
 	for ip, rc := range clients.ipToRC {
-		cj := runtimeClientJSON{
+		runtime = append(runtime, runtimeClientJSON{
 			WHOISInfo: rc.WHOISInfo,
 
-			Name:   rc.Host,
-			Source: rc.Source,
-			IP:     ip,
-		}
-
-		data.RuntimeClients = append(data.RuntimeClients, cj)
+			Name:        rc.Host,
+			Source:      rc.Source,
+			SourceLabel: rc.SourceLabel,
+			IP:          ip,
+		})
 	}
 
-	data.Tags = clientTags
-
-	_ = aghhttp.WriteJSONResponse(w, r, data)
+	return persistent, runtime
 }
 
 // jsonToClient converts JSON object to Client object.
@@ -102,9 +136,12 @@ func jsonToClient(cj clientJSON) (c *Client) {
 		// Set default service flags for enabled safesearch.
 		if safeSearchConf.Enabled {
 			safeSearchConf.Bing = true
+			safeSearchConf.Brave = true
 			safeSearchConf.DuckDuckGo = true
+			safeSearchConf.Ecosia = true
 			safeSearchConf.Google = true
 			safeSearchConf.Pixabay = true
+			safeSearchConf.Qwant = true
 			safeSearchConf.Yandex = true
 			safeSearchConf.YouTube = true
 		}
@@ -122,6 +159,8 @@ func jsonToClient(cj clientJSON) (c *Client) {
 		UseOwnBlockedServices: !cj.UseGlobalBlockedServices,
 		BlockedServices:       cj.BlockedServices,
 
+		LocalDiscoveryPassthrough: cj.LocalDiscoveryPassthrough,
+
 		Upstreams: cj.Upstreams,
 	}
 }
@@ -147,6 +186,8 @@ func clientToJSON(c *Client) (cj *clientJSON) {
 		UseGlobalBlockedServices: !c.UseOwnBlockedServices,
 		BlockedServices:          c.BlockedServices,
 
+		LocalDiscoveryPassthrough: c.LocalDiscoveryPassthrough,
+
 		Upstreams: c.Upstreams,
 	}
 }
@@ -305,4 +346,7 @@ func (clients *clientsContainer) registerWebHandlers() {
 	httpRegister(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	httpRegister(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	httpRegister(http.MethodGet, "/control/clients/find", clients.handleFindClient)
+	httpRegister(http.MethodGet, "/control/clients/neighbors", clients.handleGetNeighbors)
+	httpRegister(http.MethodGet, "/control/clients/encryption", clients.handleClientEncryption)
+	httpRegister(http.MethodPost, "/control/clients/runtime/purge", clients.handlePurgeRuntime)
 }
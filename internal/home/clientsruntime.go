@@ -0,0 +1,159 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Runtime Clients Cleanup
+
+// defaultRuntimeExpiry is the default time after which the runtime clients,
+// which haven't been seen, are removed.
+const defaultRuntimeExpiry = 30 * 24 * time.Hour
+
+// validateRuntimeCleanup returns an error if the cleanup settings of the
+// runtime clients aren't valid.
+func validateRuntimeCleanup(srcs *clientSourcesConfig) (err error) {
+	if exp := srcs.RuntimeExpiry; exp.Duration < 0 {
+		return fmt.Errorf("expiry: must not be negative, got %s", exp)
+	}
+
+	return nil
+}
+
+// isEvictable returns true if rc may be removed by the cleanup.  Those are the
+// clients from the sources, which only add the entries and never remove them
+// by themselves.  The ARP neighbors are included, since the refresh with an
+// empty neighbor table keeps the previous ones.
+func (rc *RuntimeClient) isEvictable() (ok bool) {
+	switch rc.Source {
+	case ClientSourceWHOIS, ClientSourceARP, ClientSourceRDNS:
+		return true
+	default:
+		return false
+	}
+}
+
+// seen returns the time rc has last been seen.
+func (rc *RuntimeClient) seen() (t time.Time) {
+	return time.Unix(0, rc.lastSeen.Load())
+}
+
+// setLastSeen sets the time rc has last been seen to t.
+func (rc *RuntimeClient) setLastSeen(t time.Time) {
+	rc.lastSeen.Store(t.UnixNano())
+}
+
+// markRuntimeSeen sets the time the runtime client with ip has last been seen
+// to now, if there is such client.  It's called for every request, so it does
+// nothing if neither the cleanup nor the limit of the runtime clients is
+// configured, and only takes the read lock otherwise.
+func (clients *clientsContainer) markRuntimeSeen(ip netip.Addr, now time.Time) {
+	if clients.runtimeExpiry == 0 && clients.maxRuntime == 0 {
+		return
+	}
+
+	clients.lock.RLock()
+	defer clients.lock.RUnlock()
+
+	if rc, ok := clients.ipToRC[ip]; ok {
+		rc.setLastSeen(now)
+	}
+}
+
+// rmExpiredRuntime removes the evictable runtime clients, which haven't been
+// seen for longer than the configured expiry, if any.
+func (clients *clientsContainer) rmExpiredRuntime(now time.Time) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if clients.runtimeExpiry == 0 {
+		return
+	}
+
+	deadline := now.Add(-clients.runtimeExpiry)
+
+	n := 0
+	for ip, rc := range clients.ipToRC {
+		if rc.isEvictable() && rc.seen().Before(deadline) {
+			delete(clients.ipToRC, ip)
+			n++
+		}
+	}
+
+	if n > 0 {
+		log.Debug("clients: removed %d expired runtime clients", n)
+	}
+}
+
+// evictRuntimeLocked removes the least recently seen evictable runtime client
+// if there are more of those than the configured maximum.  It's called after
+// each addition, so that removing a single client is enough.  clients.lock is
+// expected to be locked.
+func (clients *clientsContainer) evictRuntimeLocked() {
+	if clients.maxRuntime == 0 {
+		return
+	}
+
+	var n uint
+	var oldestIP netip.Addr
+	var oldest time.Time
+	for ip, rc := range clients.ipToRC {
+		if !rc.isEvictable() {
+			continue
+		}
+
+		n++
+		if seen := rc.seen(); n == 1 || seen.Before(oldest) {
+			oldest, oldestIP = seen, ip
+		}
+	}
+
+	if n <= clients.maxRuntime {
+		return
+	}
+
+	delete(clients.ipToRC, oldestIP)
+
+	log.Debug("clients: evicted runtime client %s, limit of %d reached", oldestIP, clients.maxRuntime)
+}
+
+// purgeRuntime removes all evictable runtime clients and returns the number of
+// removed ones.
+func (clients *clientsContainer) purgeRuntime() (n int) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	for ip, rc := range clients.ipToRC {
+		if rc.isEvictable() {
+			delete(clients.ipToRC, ip)
+			n++
+		}
+	}
+
+	return n
+}
+
+// runtimePurgeJSON is the response of the POST /control/clients/runtime/purge
+// HTTP API.
+type runtimePurgeJSON struct {
+	// Removed is the number of removed runtime clients.
+	Removed int `json:"removed"`
+}
+
+// handlePurgeRuntime is the handler for the POST
+// /control/clients/runtime/purge HTTP API.
+func (clients *clientsContainer) handlePurgeRuntime(w http.ResponseWriter, r *http.Request) {
+	n := clients.purgeRuntime()
+
+	log.Info("clients: purged %d runtime clients", n)
+
+	_ = aghhttp.WriteJSONResponse(w, r, &runtimePurgeJSON{
+		Removed: n,
+	})
+}
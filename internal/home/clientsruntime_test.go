@@ -0,0 +1,93 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+)
+
+func TestClientsContainer_rmExpiredRuntime(t *testing.T) {
+	clients := clientsContainer{
+		testing:       true,
+		runtimeExpiry: time.Hour,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	var (
+		staleIP = netip.MustParseAddr("192.168.0.2")
+		freshIP = netip.MustParseAddr("192.168.0.3")
+		hostsIP = netip.MustParseAddr("192.168.0.4")
+	)
+
+	require.True(t, clients.AddHost(staleIP, "stale", ClientSourceRDNS))
+	require.True(t, clients.AddHost(freshIP, "fresh", ClientSourceARP))
+	require.True(t, clients.AddHost(hostsIP, "hosts", ClientSourceHostsFile))
+
+	now := time.Now()
+	clients.ipToRC[staleIP].setLastSeen(now.Add(-2 * time.Hour))
+	clients.ipToRC[hostsIP].setLastSeen(now.Add(-2 * time.Hour))
+
+	clients.rmExpiredRuntime(now)
+
+	assert.ElementsMatch(t, []netip.Addr{freshIP, hostsIP}, maps.Keys(clients.ipToRC))
+
+	clients.markRuntimeSeen(freshIP, now.Add(2*time.Hour))
+	clients.rmExpiredRuntime(now.Add(2 * time.Hour))
+
+	assert.ElementsMatch(t, []netip.Addr{freshIP, hostsIP}, maps.Keys(clients.ipToRC))
+}
+
+func TestClientsContainer_evictRuntimeLocked(t *testing.T) {
+	clients := clientsContainer{
+		testing:    true,
+		maxRuntime: 2,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	var (
+		firstIP  = netip.MustParseAddr("192.168.0.2")
+		secondIP = netip.MustParseAddr("192.168.0.3")
+		thirdIP  = netip.MustParseAddr("192.168.0.4")
+		dhcpIP   = netip.MustParseAddr("192.168.0.5")
+	)
+
+	require.True(t, clients.AddHost(firstIP, "first", ClientSourceRDNS))
+	require.True(t, clients.AddHost(secondIP, "second", ClientSourceRDNS))
+	require.True(t, clients.AddHost(dhcpIP, "dhcp", ClientSourceDHCP))
+
+	now := time.Now()
+	clients.markRuntimeSeen(firstIP, now.Add(time.Hour))
+	clients.markRuntimeSeen(secondIP, now.Add(-time.Hour))
+
+	require.True(t, clients.AddHost(thirdIP, "third", ClientSourceRDNS))
+
+	assert.ElementsMatch(t, []netip.Addr{firstIP, thirdIP, dhcpIP}, maps.Keys(clients.ipToRC))
+
+	assert.Equal(t, 2, clients.purgeRuntime())
+	assert.ElementsMatch(t, []netip.Addr{dhcpIP}, maps.Keys(clients.ipToRC))
+}
+
+func TestClientsContainer_markRuntimeSeen(t *testing.T) {
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	ip := netip.MustParseAddr("192.168.0.2")
+	require.True(t, clients.AddHost(ip, "host", ClientSourceRDNS))
+
+	rc := clients.ipToRC[ip]
+	seen := rc.seen()
+	later := seen.Add(time.Hour)
+
+	clients.markRuntimeSeen(ip, later)
+	assert.Equal(t, seen, rc.seen())
+
+	clients.runtimeExpiry = time.Hour
+	clients.markRuntimeSeen(ip, later)
+	assert.True(t, later.Equal(rc.seen()))
+}
@@ -0,0 +1,59 @@
+package home
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/tailscale"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Tailscale Runtime Clients
+
+// tailscaleTimeout is the timeout of the requests to the Tailscale local API
+// or the Headscale API.
+const tailscaleTimeout = 10 * time.Second
+
+// reloadTailscale reloads the runtime clients from the tailnet devices, if
+// configured.  The errors are logged and the previous clients are kept, since
+// the API may become available later.
+func (clients *clientsContainer) reloadTailscale() {
+	config.RLock()
+	conf := config.Clients.Sources.Tailscale
+	config.RUnlock()
+
+	if !conf.Enabled {
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
+
+		clients.rmHostsBySrc(ClientSourceTailscale)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tailscaleTimeout)
+	defer cancel()
+
+	devs, err := tailscale.New(&conf).Devices(ctx)
+	if err != nil {
+		log.Error("clients: %s", err)
+
+		return
+	}
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	clients.rmHostsBySrc(ClientSourceTailscale)
+
+	added := 0
+	for _, d := range devs {
+		for _, ip := range d.IPs {
+			if clients.addHostLocked(ip, d.Name, ClientSourceTailscale) {
+				added++
+			}
+		}
+	}
+
+	log.Debug("clients: added %d client aliases from tailscale", added)
+}
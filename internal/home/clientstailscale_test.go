@@ -0,0 +1,56 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/tailscale"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientsContainer_reloadTailscale(t *testing.T) {
+	const nodesResp = `{"nodes":[{"givenName":"laptop","ipAddresses":["100.64.0.3"]}]}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(nodesResp))
+	}))
+	t.Cleanup(srv.Close)
+
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+
+	config = &configuration{
+		Clients: &clientsConfig{
+			Sources: &clientSourcesConfig{
+				Tailscale: tailscale.Config{
+					HeadscaleURL:    srv.URL,
+					HeadscaleAPIKey: "test-key",
+					Enabled:         true,
+				},
+			},
+		},
+	}
+
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	ip := netip.MustParseAddr("100.64.0.3")
+	clients.reloadTailscale()
+
+	rc, ok := clients.findRuntimeClient(ip)
+	require.True(t, ok)
+
+	assert.Equal(t, "laptop", rc.Host)
+	assert.Equal(t, ClientSourceTailscale, rc.Source)
+
+	config.Clients.Sources.Tailscale.Enabled = false
+	clients.reloadTailscale()
+
+	_, ok = clients.findRuntimeClient(ip)
+	assert.False(t, ok)
+}
@@ -0,0 +1,67 @@
+package home
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// WireGuard Peers
+
+// validateWireGuardSources returns an error if the WireGuard settings of the
+// runtime client sources aren't valid.
+func validateWireGuardSources(srcs *clientSourcesConfig) (err error) {
+	for i, name := range srcs.WireGuardInterfaces {
+		if name == "" {
+			return fmt.Errorf("wireguard_interfaces: at index %d: %w", i, errors.Error("no value"))
+		}
+	}
+
+	return nil
+}
+
+// newWireGuardIndex returns the index of the public keys of peers by their
+// allowed IPs.
+func newWireGuardIndex(peers []aghnet.WireGuardPeer) (idx *aghnet.PrefixTree[string]) {
+	idx = aghnet.NewPrefixTree[string]()
+	for _, p := range peers {
+		for _, subnet := range p.AllowedIPs {
+			idx.Insert(subnet, p.PublicKey)
+		}
+	}
+
+	return idx
+}
+
+// reloadWireGuard reloads the peers of the configured WireGuard interfaces, so
+// that the persistent clients with the public keys of the peers among their
+// IDs are found by the tunnel IP addresses.  The errors are logged, since an
+// interface may appear later.
+func (clients *clientsContainer) reloadWireGuard() {
+	config.RLock()
+	ifaces := config.Clients.Sources.WireGuardInterfaces
+	config.RUnlock()
+
+	var peers []aghnet.WireGuardPeer
+	for _, iface := range ifaces {
+		ifacePeers, err := aghnet.WireGuardPeers(iface)
+		if err != nil {
+			log.Error("clients: %s", err)
+
+			continue
+		}
+
+		peers = append(peers, ifacePeers...)
+	}
+
+	idx := newWireGuardIndex(peers)
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	clients.wgPeers = idx
+
+	log.Debug("clients: loaded %d wireguard peers", len(peers))
+}
@@ -0,0 +1,92 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientsFind_wireGuard(t *testing.T) {
+	const (
+		laptopKey = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+		phoneKey  = "HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw="
+	)
+
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	ok, err := clients.Add(&Client{
+		IDs:  []string{laptopKey},
+		Name: "laptop",
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = clients.Add(&Client{
+		IDs:  []string{"10.0.0.0/24"},
+		Name: "tunnel",
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	clients.wgPeers = newWireGuardIndex([]aghnet.WireGuardPeer{{
+		PublicKey:  laptopKey,
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")},
+	}, {
+		PublicKey:  phoneKey,
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.3/32")},
+	}})
+
+	testCases := []struct {
+		name     string
+		ip       string
+		wantName string
+	}{{
+		name:     "peer",
+		ip:       "10.0.0.2",
+		wantName: "laptop",
+	}, {
+		name:     "unknown_peer",
+		ip:       "10.0.0.3",
+		wantName: "tunnel",
+	}, {
+		name:     "not_peer",
+		ip:       "10.0.0.4",
+		wantName: "tunnel",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, found := clients.Find(tc.ip)
+			require.True(t, found)
+
+			assert.Equal(t, tc.wantName, c.Name)
+		})
+	}
+
+	t.Run("roaming", func(t *testing.T) {
+		clients.wgPeers = newWireGuardIndex([]aghnet.WireGuardPeer{{
+			PublicKey:  laptopKey,
+			AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.1.5/32")},
+		}})
+
+		c, found := clients.Find("10.0.1.5")
+		require.True(t, found)
+
+		assert.Equal(t, "laptop", c.Name)
+	})
+}
+
+func TestNormalizeClientIdentifier_wireGuard(t *testing.T) {
+	const key = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+
+	norm, err := normalizeClientIdentifier(key)
+	require.NoError(t, err)
+
+	assert.Equal(t, key, norm)
+}
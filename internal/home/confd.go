@@ -0,0 +1,266 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Configuration Drop-Ins
+
+// dropInDirName is the name of the directory with the drop-in configuration
+// files.  It's located next to the configuration file.
+const dropInDirName = "conf.d"
+
+// dropInValue is a configuration value set by a drop-in file.
+type dropInValue struct {
+	// value is the value from the drop-in file.
+	value *yaml.Node
+
+	// file is the name of the drop-in file which has set the value.
+	file string
+
+	// path is the path of the value within the configuration.
+	path []string
+}
+
+// dropIns contains the information about the drop-in configuration files
+// required to keep their values out of the main configuration file.
+type dropIns struct {
+	// main is the document of the main configuration file without the values
+	// from the drop-ins.
+	main *yaml.Node
+
+	// values are the values set by the drop-ins.  Only non-mapping values are
+	// stored, since mappings are merged.
+	values []*dropInValue
+}
+
+// dropInDir returns the path to the directory with the drop-in configuration
+// files.
+func (c *configuration) dropInDir() (dir string) {
+	return filepath.Join(filepath.Dir(c.getConfigFilename()), dropInDirName)
+}
+
+// loadDropIns merges the drop-in files with the .yaml extension from dir into
+// the document of the main configuration file doc.  The files are merged in the
+// lexical order, and the values from a later file take precedence over the
+// values from the earlier ones and from the main file.  Mappings are merged
+// recursively while all other values, including sequences, are replaced.  d is
+// nil if there are no drop-in files.
+func loadDropIns(dir string, doc *yaml.Node) (d *dropIns, err error) {
+	// The error is only returned for a malformed pattern.
+	files, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	d = &dropIns{
+		main: cloneNode(doc),
+	}
+
+	for _, f := range files {
+		err = d.merge(f, doc)
+		if err != nil {
+			return nil, fmt.Errorf("drop-in %q: %w", filepath.Base(f), err)
+		}
+
+		log.Info("config: merged drop-in %q", f)
+	}
+
+	return d, nil
+}
+
+// merge merges the drop-in file into the document doc.
+func (d *dropIns) merge(file string, doc *yaml.Node) (err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	n := &yaml.Node{}
+	err = yaml.Unmarshal(data, n)
+	if err != nil {
+		return err
+	} else if n.Kind == 0 {
+		// Empty document.
+		return nil
+	}
+
+	src := n.Content[0]
+	if src.Kind != yaml.MappingNode {
+		return fmt.Errorf("document must be a mapping, got %s", src.ShortTag())
+	} else if mappingValue(src, "schema_version") != nil {
+		return errors.Error("schema_version cannot be set in drop-ins")
+	}
+
+	err = decryptSecrets(n, nil)
+	if err != nil {
+		return fmt.Errorf("decrypting secrets: %w", err)
+	}
+
+	d.mergeMapping(doc.Content[0], src, filepath.Base(file), nil)
+
+	return nil
+}
+
+// mergeMapping merges the mapping node src into the mapping node dst.  path is
+// the path of dst within the configuration.
+func (d *dropIns) mergeMapping(dst, src *yaml.Node, file string, path []string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		k, v := src.Content[i], src.Content[i+1]
+		p := append(slices.Clone(path), k.Value)
+
+		cur := mappingValue(dst, k.Value)
+		if v.Kind == yaml.MappingNode {
+			if cur == nil || cur.Kind != yaml.MappingNode {
+				cur = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				setMappingValue(dst, k.Value, cur)
+			}
+
+			d.mergeMapping(cur, v, file, p)
+
+			continue
+		}
+
+		setMappingValue(dst, k.Value, cloneNode(v))
+		d.values = append(d.values, &dropInValue{
+			value: v,
+			file:  file,
+			path:  p,
+		})
+	}
+}
+
+// restore replaces the values set by the drop-ins within the document doc,
+// which is going to be written into the main configuration file, with the
+// values from the main configuration file.  Values changed since they've been
+// loaded are kept, since those are the changes made by user.  d may be nil.
+func (d *dropIns) restore(doc *yaml.Node) {
+	if d == nil {
+		return
+	}
+
+	for _, v := range d.values {
+		parent := lookupNode(doc, v.path[:len(v.path)-1])
+		key := v.path[len(v.path)-1]
+		cur := mappingValue(parent, key)
+		if cur == nil {
+			continue
+		}
+
+		if !sameValues(cur, v.value) {
+			log.Info(
+				"config: warning: %s is changed, but %q overrides it after restart",
+				strings.Join(v.path, "."),
+				v.file,
+			)
+
+			continue
+		}
+
+		mainParent := lookupNode(d.main, v.path[:len(v.path)-1])
+		if orig := mappingValue(mainParent, key); orig != nil {
+			setMappingValue(parent, key, cloneNode(orig))
+		} else {
+			deleteMappingValue(parent, key)
+		}
+	}
+}
+
+// lookupNode returns the mapping node at path within the document or mapping
+// node n or nil if there is none.
+func lookupNode(n *yaml.Node, path []string) (mapping *yaml.Node) {
+	if n == nil {
+		return nil
+	} else if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil
+		}
+
+		n = n.Content[0]
+	}
+
+	for _, key := range path {
+		n = mappingValue(n, key)
+		if n == nil {
+			return nil
+		}
+	}
+
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	return n
+}
+
+// sameValues returns true if a and b represent the same values regardless of
+// their styles.
+func sameValues(a, b *yaml.Node) (ok bool) {
+	var av, bv any
+	if a.Decode(&av) != nil || b.Decode(&bv) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(av, bv)
+}
+
+// setMappingValue sets the value of key within the mapping node n to v.  n may
+// be nil.
+func setMappingValue(n *yaml.Node, key string, v *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = v
+
+			return
+		}
+	}
+
+	n.Content = append(n.Content, &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: key,
+	}, v)
+}
+
+// deleteMappingValue removes key and its value from the mapping node n.
+func deleteMappingValue(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+
+			return
+		}
+	}
+}
+
+// cloneNode returns a deep clone of n.
+func cloneNode(n *yaml.Node) (clone *yaml.Node) {
+	if n == nil {
+		return nil
+	}
+
+	clone = &yaml.Node{}
+	*clone = *n
+	if n.Content != nil {
+		clone.Content = make([]*yaml.Node, len(n.Content))
+		for i, c := range n.Content {
+			clone.Content[i] = cloneNode(c)
+		}
+	}
+
+	return clone
+}
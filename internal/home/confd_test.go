@@ -0,0 +1,114 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDropInConf is the configuration used in the drop-in tests.
+type testDropInConf struct {
+	DNS struct {
+		Upstreams []string `yaml:"upstream_dns"`
+		Port      int      `yaml:"port"`
+		Cache     bool     `yaml:"cache_enabled"`
+	} `yaml:"dns"`
+	Clients struct {
+		Persistent []string `yaml:"persistent"`
+	} `yaml:"clients"`
+}
+
+func TestDropIns(t *testing.T) {
+	const mainConf = `dns:
+  upstream_dns:
+  - 1.1.1.1
+  port: 53
+`
+
+	dir := t.TempDir()
+	writeFile := func(t *testing.T, name, data string) {
+		t.Helper()
+
+		err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644)
+		require.NoError(t, err)
+	}
+
+	writeFile(t, "10-upstreams.yaml", "dns:\n  upstream_dns:\n  - 8.8.8.8\n  cache_enabled: true\n")
+	writeFile(t, "20-clients.yaml", "clients:\n  persistent:\n  - laptop\n")
+	writeFile(t, "30-upstreams.yaml", "dns:\n  upstream_dns:\n  - 9.9.9.9\n")
+	writeFile(t, "ignored.yml", "dns:\n  port: 5353\n")
+
+	conf := &testDropInConf{}
+	d, err := unmarshalConfig([]byte(mainConf), dir, conf)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+
+	assert.Equal(t, []string{"9.9.9.9"}, conf.DNS.Upstreams)
+	assert.Equal(t, 53, conf.DNS.Port)
+	assert.True(t, conf.DNS.Cache)
+	assert.Equal(t, []string{"laptop"}, conf.Clients.Persistent)
+
+	t.Run("restore", func(t *testing.T) {
+		data, rerr := marshalConfig(conf, d, nil)
+		require.NoError(t, rerr)
+
+		got := &testDropInConf{}
+		_, rerr = unmarshalConfig(data, t.TempDir(), got)
+		require.NoError(t, rerr)
+
+		assert.Equal(t, []string{"1.1.1.1"}, got.DNS.Upstreams)
+		assert.False(t, got.DNS.Cache)
+		assert.Empty(t, got.Clients.Persistent)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		changed := *conf
+		changed.DNS.Upstreams = []string{"8.8.4.4"}
+
+		data, rerr := marshalConfig(&changed, d, nil)
+		require.NoError(t, rerr)
+
+		got := &testDropInConf{}
+		_, rerr = unmarshalConfig(data, t.TempDir(), got)
+		require.NoError(t, rerr)
+
+		assert.Equal(t, []string{"8.8.4.4"}, got.DNS.Upstreams)
+	})
+}
+
+func TestDropIns_bad(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		wantErrMsg string
+	}{{
+		name: "sequence",
+		data: "- a\n",
+		wantErrMsg: `loading drop-ins: drop-in "bad.yaml": document must be a ` +
+			`mapping, got !!seq`,
+	}, {
+		name: "schema_version",
+		data: "schema_version: 1\n",
+		wantErrMsg: `loading drop-ins: drop-in "bad.yaml": schema_version ` +
+			`cannot be set in drop-ins`,
+	}, {
+		name:       "empty",
+		data:       "",
+		wantErrMsg: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte(tc.data), 0o644)
+			require.NoError(t, err)
+
+			_, err = unmarshalConfig([]byte("dns:\n  port: 53\n"), dir, &testDropInConf{})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
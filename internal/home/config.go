@@ -7,14 +7,23 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/notify"
+	"github.com/AdguardTeam/AdGuardHome/internal/plugin"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/AdGuardHome/internal/tailscale"
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/verdictexport"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
 	"github.com/AdguardTeam/dnsproxy/fastip"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
@@ -56,10 +65,38 @@ type logSettings struct {
 	// is the computer's local time.
 	LocalTime bool `yaml:"log_localtime"`
 
+	// Format is the format of the log output, either "text" or "json".  The
+	// empty format means "text".
+	Format aghlog.Format `yaml:"log_format"`
+
+	// Levels are the log levels of the modules, for example "dnsforward", that
+	// differ from the default one, which is debug if Verbose is true and info
+	// otherwise.
+	Levels map[string]aghlog.Level `yaml:"log_levels"`
+
 	// Verbose determines, if verbose (aka debug) logging is enabled.
 	Verbose bool `yaml:"verbose"`
 }
 
+// validate returns an error if the log settings aren't valid.
+func (ls *logSettings) validate() (err error) {
+	err = ls.Format.Validate()
+	if err != nil {
+		return err
+	}
+
+	return aghlog.ValidateLevels(ls.Levels)
+}
+
+// defaultLevel returns the log level of the modules not within ls.Levels.
+func (ls *logSettings) defaultLevel() (l aghlog.Level) {
+	if ls.Verbose {
+		return aghlog.LevelDebug
+	}
+
+	return aghlog.LevelInfo
+}
+
 // osConfig contains OS-related configuration.
 type osConfig struct {
 	// Group is the name of the group which AdGuard Home must switch to on
@@ -88,6 +125,50 @@ type clientSourcesConfig struct {
 	RDNS      bool `yaml:"rdns"`
 	DHCP      bool `yaml:"dhcp"`
 	HostsFile bool `yaml:"hosts"`
+
+	// WHOISViaProxy defines if the WHOIS lookups are made through the proxy
+	// from the http_proxy property, if it's set.  Otherwise, the lookups are
+	// disabled when the proxy is set.
+	WHOISViaProxy bool `yaml:"whois_via_proxy"`
+
+	// HostsPaths are the additional hosts-format files and directories to
+	// watch along with the system hosts database if HostsFile is true.
+	HostsPaths []*hostsPathConfig `yaml:"hosts_paths"`
+
+	// ARPInterfaces are the names of the network interfaces, the neighbors
+	// within the subnets of which are added as runtime clients if ARP is true.
+	// If it's empty, all neighbors are added.
+	ARPInterfaces []string `yaml:"arp_interfaces"`
+
+	// ARPRefreshInterval is the interval between the refreshes of the
+	// neighbor table.  If it's zero, [defaultARPRefreshIvl] is used.
+	ARPRefreshInterval timeutil.Duration `yaml:"arp_refresh_interval"`
+
+	// WireGuardInterfaces are the names of the WireGuard interfaces, the
+	// peers of which are matched with the persistent clients that have their
+	// public keys among the IDs.  The peers are refreshed with the same
+	// interval as the ARP neighbors.
+	WireGuardInterfaces []string `yaml:"wireguard_interfaces"`
+
+	// Tailscale is the configuration of the runtime clients from the devices
+	// of the tailnet, which are refreshed with the same interval as the ARP
+	// neighbors.
+	Tailscale tailscale.Config `yaml:"tailscale"`
+
+	// MACVendorsFile is the path to the OUI database used to look up the
+	// vendors of the neighbors.  If it's empty, the database is searched for
+	// in the common locations.
+	MACVendorsFile string `yaml:"mac_vendors_file"`
+
+	// RuntimeExpiry is the time after which the runtime clients from WHOIS,
+	// ARP, and rDNS, which haven't been seen, are removed.  If it's zero, they
+	// are never removed.
+	RuntimeExpiry timeutil.Duration `yaml:"expiry"`
+
+	// MaxRuntimeClients is the maximum number of the runtime clients from
+	// WHOIS, ARP, and rDNS.  The least recently seen ones are removed when
+	// it's exceeded.  If it's zero, the number is not limited.
+	MaxRuntimeClients uint `yaml:"max_clients"`
 }
 
 // configuration is loaded from YAML
@@ -97,6 +178,20 @@ type configuration struct {
 	// It's reset after config is parsed
 	fileData []byte
 
+	// dropIns are the drop-in configuration files merged into this one.  It's
+	// nil if there are none.
+	dropIns *dropIns
+
+	// frozen is true after a backup has been restored or an update has been
+	// rolled back and until AdGuard Home restarts, so that the restored
+	// configuration file isn't overwritten.
+	frozen bool
+
+	// pending are the values, which have been changed in the configuration
+	// file and re-read, but require a restart to be applied.  It's nil if the
+	// file hasn't been re-read.
+	pending *pendingValues
+
 	// BindHost is the address for the web interface server to listen on.
 	BindHost netip.Addr `yaml:"bind_host"`
 	// BindPort is the port for the web interface server to listen on.
@@ -110,6 +205,34 @@ type configuration struct {
 	// AuthBlockMin is the duration, in minutes, of the block of new login
 	// attempts after AuthAttempts unsuccessful login attempts.
 	AuthBlockMin uint `yaml:"block_auth_min"`
+	// HTTPRateLimit is the configuration of the per-IP rate limiting of the
+	// HTTP API.
+	HTTPRateLimit httpRateLimitConfig `yaml:"http_rate_limit"`
+	// OIDC is the configuration of the login with an OpenID Connect
+	// provider.
+	OIDC oidcConfig `yaml:"oidc"`
+	// Sync is the configuration of the synchronization of the settings from
+	// the primary instance.
+	Sync syncConfig `yaml:"sync"`
+	// AutoUpdate is the configuration of the automatic updates.
+	AutoUpdate autoUpdateConfig `yaml:"auto_update"`
+	// DiskWatchdog is the configuration of the watchdog of the free space in
+	// the data directories.
+	DiskWatchdog diskWatchdogConfig `yaml:"disk_watchdog"`
+	// SNMP is the configuration of the SNMP agent exposing the counters of
+	// the DNS server.
+	SNMP snmpConfig `yaml:"snmp"`
+	// Webhooks are the HTTP endpoints to which the events are sent.
+	Webhooks []*webhook.Config `yaml:"webhooks"`
+	// Notifications are the channels through which the user is notified
+	// about the events.
+	Notifications []*notify.ChannelConfig `yaml:"notifications"`
+	// Plugins are the external programs inspecting the queries and receiving
+	// the query log entries.
+	Plugins []*plugin.Config `yaml:"plugins"`
+	// VerdictExport are the external endpoints to which the metadata of the
+	// DNS queries and the filtering verdicts are mirrored.
+	VerdictExport []*verdictexport.Config `yaml:"verdict_export"`
 	// ProxyURL is the address of proxy server for the internal HTTP client.
 	ProxyURL string `yaml:"http_proxy"`
 	// Language is a two-letter ISO 639-1 language code.
@@ -201,6 +324,10 @@ type dnsConfig struct {
 	// TODO(a.garipov): Add to the UI when HTTP/3 support is no longer
 	// experimental.
 	UseHTTP3Upstreams bool `yaml:"use_http3_upstreams"`
+
+	// QueryHook is the configuration of the external program overriding the
+	// filtering decisions.
+	QueryHook queryhook.Config `yaml:"query_hook"`
 }
 
 type tlsConfigSettings struct {
@@ -224,6 +351,10 @@ type tlsConfigSettings struct {
 	// Allow DoH queries via unencrypted HTTP (e.g. for reverse proxying)
 	AllowUnencryptedDoH bool `yaml:"allow_unencrypted_doh" json:"allow_unencrypted_doh"`
 
+	// ACME is the configuration of the automatic issuance and renewal of the
+	// certificate.
+	ACME acmeConfig `yaml:"acme" json:"-"`
+
 	dnsforward.TLSConfig `yaml:",inline" json:",inline"`
 }
 
@@ -238,11 +369,19 @@ type queryLogConfig struct {
 	// to disk.
 	MemSize uint32 `yaml:"size_memory"`
 
+	// SampleRate is N in logging only one of N queries, which are neither
+	// blocked nor rewritten.  Zero and one mean that all queries are logged.
+	SampleRate uint32 `yaml:"sample_rate"`
+
 	// Enabled defines if the query log is enabled.
 	Enabled bool `yaml:"enabled"`
 
 	// FileEnabled defines, if the query log is written to the file.
 	FileEnabled bool `yaml:"file_enabled"`
+
+	// DirPath is the directory for the query log files.  If empty, the data
+	// directory is used.
+	DirPath string `yaml:"dir_path"`
 }
 
 type statsConfig struct {
@@ -252,8 +391,38 @@ type statsConfig struct {
 	// Interval is the retention interval for statistics.
 	Interval timeutil.Duration `yaml:"interval"`
 
+	// CompactInterval is the interval between the compactions of the
+	// statistics database.  If zero, the database is only compacted on
+	// request.
+	CompactInterval timeutil.Duration `yaml:"compact_interval"`
+
+	// FlushBatch is the number of hourly units written to the statistics
+	// database at once.
+	FlushBatch uint `yaml:"flush_batch"`
+
 	// Enabled defines if the statistics are enabled.
 	Enabled bool `yaml:"enabled"`
+
+	// DirPath is the directory for the statistics database.  If empty, the
+	// data directory is used.
+	DirPath string `yaml:"dir_path"`
+}
+
+// httpRateLimitConfig is the configuration of the per-IP rate limiting of the
+// HTTP API.
+type httpRateLimitConfig struct {
+	// Allowlist are the subnets requests from which are never rate limited.
+	// The clients from these subnets are also never blocked after failed login
+	// attempts.
+	Allowlist []netip.Prefix `yaml:"allowlist"`
+
+	// BlockDuration is the duration for which a client is blocked after
+	// exceeding the limit.
+	BlockDuration timeutil.Duration `yaml:"block_duration"`
+
+	// RPS is the maximum number of API requests per second from a single IP
+	// address.  Zero means no limit.
+	RPS uint `yaml:"rps"`
 }
 
 // config is the global configuration structure.
@@ -265,6 +434,39 @@ var config = &configuration{
 	AuthAttempts:       5,
 	AuthBlockMin:       15,
 	WebSessionTTLHours: 30 * 24,
+	HTTPRateLimit: httpRateLimitConfig{
+		BlockDuration: timeutil.Duration{Duration: 1 * time.Minute},
+	},
+	OIDC: oidcConfig{
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		Scopes:        []string{"openid", "profile", "email"},
+	},
+	Sync: syncConfig{
+		ConflictPolicy: syncPolicyReplace,
+		Items: []syncItem{
+			syncItemUserRules,
+			syncItemRewrites,
+			syncItemClients,
+			syncItemBlockedServices,
+		},
+		Interval: timeutil.Duration{Duration: 1 * time.Hour},
+	},
+	AutoUpdate: autoUpdateConfig{
+		Window: updater.Window{
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: 2 * time.Hour},
+		},
+	},
+	DiskWatchdog: diskWatchdogConfig{
+		Interval:  timeutil.Duration{Duration: 5 * time.Minute},
+		MinFreeMB: 100,
+		Enabled:   true,
+	},
+	SNMP: snmpConfig{
+		Address: netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), 161),
+		BaseOID: defaultSNMPBaseOID,
+	},
 	DNS: dnsConfig{
 		BindHosts: []netip.Addr{netip.IPv4Unspecified()},
 		Port:      defaultPortDNS,
@@ -280,6 +482,10 @@ var config = &configuration{
 				Duration: fastip.DefaultPingWaitTimeout,
 			},
 
+			ParentalBypassDuration: timeutil.Duration{
+				Duration: 30 * time.Minute,
+			},
+
 			TrustedProxies: []string{"127.0.0.0/8", "::1/128"},
 			CacheSize:      4 * 1024 * 1024,
 
@@ -302,9 +508,19 @@ var config = &configuration{
 			CacheTime:                  30,
 			FilteringEnabled:           true,
 			FiltersUpdateIntervalHours: 24,
+			FiltersUpdateWorkers:       4,
+			LocalDiscoveryPassthrough:  true,
+			FiltersUpdateTimeout:       timeutil.Duration{Duration: 2 * time.Minute},
+			Lookalike: filtering.LookalikeConfig{
+				MinConfidence: 80,
+			},
 		},
 		UpstreamTimeout: timeutil.Duration{Duration: dnsforward.DefaultTimeout},
 		UsePrivateRDNS:  true,
+		QueryHook: queryhook.Config{
+			OnFailure: queryhook.ActionBlock,
+			Timeout:   timeutil.Duration{Duration: queryhook.DefaultTimeout},
+		},
 	},
 	TLS: tlsConfigSettings{
 		PortHTTPS:       defaultPortHTTPS,
@@ -319,9 +535,11 @@ var config = &configuration{
 		Ignored:     []string{},
 	},
 	Stats: statsConfig{
-		Enabled:  true,
-		Interval: timeutil.Duration{Duration: 1 * timeutil.Day},
-		Ignored:  []string{},
+		Enabled:         true,
+		Interval:        timeutil.Duration{Duration: 1 * timeutil.Day},
+		CompactInterval: timeutil.Duration{Duration: 7 * timeutil.Day},
+		FlushBatch:      1,
+		Ignored:         []string{},
 	},
 	// NOTE: Keep these parameters in sync with the one put into
 	// client/src/helpers/filters/filters.js by scripts/vetted-filters.
@@ -351,11 +569,14 @@ var config = &configuration{
 	},
 	Clients: &clientsConfig{
 		Sources: &clientSourcesConfig{
-			WHOIS:     true,
-			ARP:       true,
-			RDNS:      true,
-			DHCP:      true,
-			HostsFile: true,
+			WHOIS:              true,
+			WHOISViaProxy:      true,
+			ARP:                true,
+			RDNS:               true,
+			DHCP:               true,
+			HostsFile:          true,
+			ARPRefreshInterval: timeutil.Duration{Duration: defaultARPRefreshIvl},
+			RuntimeExpiry:      timeutil.Duration{Duration: defaultRuntimeExpiry},
 		},
 	},
 	logSettings: logSettings{
@@ -409,28 +630,52 @@ func parseConfig() (err error) {
 	}
 
 	config.fileData = nil
-	err = yaml.Unmarshal(fileData, &config)
+	config.dropIns, err = unmarshalConfig(fileData, config.dropInDir(), config)
 	if err != nil {
 		return err
 	}
 
+	err = config.validate()
+	if err != nil {
+		return err
+	}
+
+	if !filtering.ValidateUpdateIvl(config.DNS.DnsfilterConf.FiltersUpdateIntervalHours) {
+		config.DNS.DnsfilterConf.FiltersUpdateIntervalHours = 24
+	}
+
+	if config.DNS.UpstreamTimeout.Duration == 0 {
+		config.DNS.UpstreamTimeout = timeutil.Duration{Duration: dnsforward.DefaultTimeout}
+	}
+
+	err = setContextTLSCipherIDs()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validate returns an error if c contains invalid values, which the defaults
+// can't replace.
+func (c *configuration) validate() (err error) {
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
-	addPorts(tcpPorts, tcpPort(config.BindPort))
+	addPorts(tcpPorts, tcpPort(c.BindPort))
 
 	udpPorts := aghalg.UniqChecker[udpPort]{}
-	addPorts(udpPorts, udpPort(config.DNS.Port))
+	addPorts(udpPorts, udpPort(c.DNS.Port))
 
-	if config.TLS.Enabled {
+	if c.TLS.Enabled {
 		addPorts(
 			tcpPorts,
-			tcpPort(config.TLS.PortHTTPS),
-			tcpPort(config.TLS.PortDNSOverTLS),
-			tcpPort(config.TLS.PortDNSCrypt),
+			tcpPort(c.TLS.PortHTTPS),
+			tcpPort(c.TLS.PortDNSOverTLS),
+			tcpPort(c.TLS.PortDNSCrypt),
 		)
 
 		// TODO(e.burkov):  Consider adding a udpPort with the same value when
 		// we add support for HTTP/3 for web admin interface.
-		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
+		addPorts(udpPorts, udpPort(c.TLS.PortDNSOverQUIC))
 	}
 
 	if err = tcpPorts.Validate(); err != nil {
@@ -439,17 +684,106 @@ func parseConfig() (err error) {
 		return fmt.Errorf("validating udp ports: %w", err)
 	}
 
-	if !filtering.ValidateUpdateIvl(config.DNS.DnsfilterConf.FiltersUpdateIntervalHours) {
-		config.DNS.DnsfilterConf.FiltersUpdateIntervalHours = 24
+	err = c.logSettings.validate()
+	if err != nil {
+		return fmt.Errorf("validating log settings: %w", err)
 	}
 
-	if config.DNS.UpstreamTimeout.Duration == 0 {
-		config.DNS.UpstreamTimeout = timeutil.Duration{Duration: dnsforward.DefaultTimeout}
+	err = validateUsers(c.Users)
+	if err != nil {
+		return fmt.Errorf("validating users: %w", err)
 	}
 
-	err = setContextTLSCipherIDs()
+	err = c.OIDC.validate()
 	if err != nil {
-		return err
+		return fmt.Errorf("validating oidc: %w", err)
+	}
+
+	err = c.AutoUpdate.validate()
+	if err != nil {
+		return fmt.Errorf("validating auto_update: %w", err)
+	}
+
+	err = c.DiskWatchdog.validate()
+	if err != nil {
+		return fmt.Errorf("validating disk_watchdog: %w", err)
+	}
+
+	err = c.SNMP.validate()
+	if err != nil {
+		return fmt.Errorf("validating snmp: %w", err)
+	}
+
+	err = c.DNS.QueryHook.Validate()
+	if err != nil {
+		return fmt.Errorf("validating dns query hook: %w", err)
+	}
+
+	err = c.Sync.validate()
+	if err != nil {
+		return fmt.Errorf("validating sync: %w", err)
+	}
+
+	if c.Clients != nil && c.Clients.Sources != nil {
+		err = validateHostsPaths(c.Clients.Sources.HostsPaths)
+		if err != nil {
+			return fmt.Errorf("validating clients hosts_paths: %w", err)
+		}
+
+		err = validateARPSources(c.Clients.Sources)
+		if err != nil {
+			return fmt.Errorf("validating clients runtime sources: %w", err)
+		}
+
+		err = validateWireGuardSources(c.Clients.Sources)
+		if err != nil {
+			return fmt.Errorf("validating clients runtime sources: %w", err)
+		}
+
+		err = validateRuntimeCleanup(c.Clients.Sources)
+		if err != nil {
+			return fmt.Errorf("validating clients runtime sources: %w", err)
+		}
+
+		err = c.Clients.Sources.Tailscale.Validate()
+		if err != nil {
+			return fmt.Errorf("validating clients runtime sources: tailscale: %w", err)
+		}
+	}
+
+	err = c.TLS.ACME.validate(c.TLS.ServerName)
+	if err != nil {
+		return fmt.Errorf("validating tls acme: %w", err)
+	}
+
+	for i, wh := range c.Webhooks {
+		if !wh.Enabled {
+			continue
+		}
+
+		err = wh.Validate()
+		if err != nil {
+			return fmt.Errorf("validating webhooks: at index %d: %w", i, err)
+		}
+	}
+
+	err = notify.ValidateChannels(c.Notifications)
+	if err != nil {
+		return fmt.Errorf("validating notifications: %w", err)
+	}
+
+	err = plugin.ValidateConfigs(c.Plugins)
+	if err != nil {
+		return fmt.Errorf("validating plugins: %w", err)
+	}
+
+	err = verdictexport.ValidateConfigs(c.VerdictExport)
+	if err == nil {
+		err = validateVerdictExportTags(c.VerdictExport)
+	}
+
+	if err != nil {
+		return fmt.Errorf("validating verdict export: %w", err)
 	}
 
 	return nil
@@ -483,11 +817,72 @@ func readConfigFile() (fileData []byte, err error) {
 	return os.ReadFile(name)
 }
 
+// unmarshalConfig decodes the configuration file data into v decrypting the
+// encrypted values and merging the drop-in files from dropInDir.
+func unmarshalConfig(data []byte, dropInDir string, v any) (d *dropIns, err error) {
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		return nil, err
+	} else if doc.Kind == 0 {
+		// Empty document.
+		return nil, nil
+	}
+
+	err = decryptSecrets(doc, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secrets: %w", err)
+	}
+
+	d, err = loadDropIns(dropInDir, doc)
+	if err != nil {
+		return nil, fmt.Errorf("loading drop-ins: %w", err)
+	}
+
+	return d, doc.Decode(v)
+}
+
+// marshalConfig encodes v into the configuration file data.  The values set by
+// the drop-in files d are replaced with the original ones, the values pending
+// a restart p are kept, and the secrets are encrypted.  d and p may be nil.
+func marshalConfig(v any, d *dropIns, p *pendingValues) (data []byte, err error) {
+	doc := &yaml.Node{}
+	err = doc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	p.restore(doc)
+	d.restore(doc)
+
+	err = encryptSecrets(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 // Saves configuration to the YAML file and also saves the user filter contents to a file
 func (c *configuration) write() (err error) {
 	c.Lock()
 	defer c.Unlock()
 
+	if c.frozen {
+		log.Debug("config is frozen until restart, not writing")
+
+		return nil
+	}
+
 	if Context.auth != nil {
 		config.Users = Context.auth.GetUsers()
 	}
@@ -503,6 +898,7 @@ func (c *configuration) write() (err error) {
 		Context.stats.WriteDiskConfig(&statsConf)
 		config.Stats.Interval = timeutil.Duration{Duration: statsConf.Limit}
 		config.Stats.Enabled = statsConf.Enabled
+		config.Stats.DirPath = Context.relocatedDir(filepath.Dir(statsConf.Filename))
 		config.Stats.Ignored = statsConf.Ignored.Values()
 		slices.Sort(config.Stats.Ignored)
 	}
@@ -515,6 +911,8 @@ func (c *configuration) write() (err error) {
 		config.QueryLog.FileEnabled = dc.FileEnabled
 		config.QueryLog.Interval = timeutil.Duration{Duration: dc.RotationIvl}
 		config.QueryLog.MemSize = dc.MemSize
+		config.QueryLog.SampleRate = dc.SampleRate
+		config.QueryLog.DirPath = Context.relocatedDir(dc.BaseDir)
 		config.QueryLog.Ignored = dc.Ignored.Values()
 		slices.Sort(config.Stats.Ignored)
 	}
@@ -543,16 +941,12 @@ func (c *configuration) write() (err error) {
 	configFile := config.getConfigFilename()
 	log.Debug("writing config file %q", configFile)
 
-	buf := &bytes.Buffer{}
-	enc := yaml.NewEncoder(buf)
-	enc.SetIndent(2)
-
-	err = enc.Encode(config)
+	data, err := marshalConfig(config, c.dropIns, c.pending)
 	if err != nil {
 		return fmt.Errorf("generating config file: %w", err)
 	}
 
-	err = maybe.WriteFile(configFile, buf.Bytes(), 0o644)
+	err = maybe.WriteFile(configFile, data, 0o644)
 	if err != nil {
 		return fmt.Errorf("writing config file: %w", err)
 	}
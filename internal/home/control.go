@@ -70,13 +70,9 @@ func appendDNSAddrsWithIfaces(dst []string, src []netip.Addr) (res []string, err
 // collectDNSAddresses returns the list of DNS addresses the server is listening
 // on, including the addresses on all interfaces in cases of unspecified IPs.
 func collectDNSAddresses() (addrs []string, err error) {
-	if hosts := config.DNS.BindHosts; len(hosts) == 0 {
-		addrs = appendDNSAddrs(addrs, netutil.IPv4Localhost())
-	} else {
-		addrs, err = appendDNSAddrsWithIfaces(addrs, hosts)
-		if err != nil {
-			return nil, fmt.Errorf("collecting dns addresses: %w", err)
-		}
+	addrs, err = appendDNSAddrsWithIfaces(addrs, dnsBindHosts(&config.DNS))
+	if err != nil {
+		return nil, fmt.Errorf("collecting dns addresses: %w", err)
 	}
 
 	de := getDNSEncryption()
@@ -168,13 +164,26 @@ func registerControlHandlers() {
 	httpRegister(http.MethodGet, "/control/i18n/current_language", handleI18nCurrentLanguage)
 	Context.mux.HandleFunc("/control/version.json", postInstall(optionalAuth(handleGetVersionJSON)))
 	httpRegister(http.MethodPost, "/control/update", handleUpdate)
+	httpRegister(http.MethodGet, "/control/update/status", handleUpdateStatus)
+	httpRegister(http.MethodPost, "/control/update/rollback", handleUpdateRollback)
+	httpRegister(http.MethodPost, "/control/update/pin", handleUpdatePin)
 	httpRegister(http.MethodGet, "/control/profile", handleGetProfile)
 	httpRegister(http.MethodPut, "/control/profile/update", handlePutProfile)
+	httpRegister(http.MethodGet, "/control/diagnostics", handleDiagnostics)
+	httpRegister(http.MethodGet, "/control/diagnostics/errors", handleDiagnosticsErrors)
+	httpRegister(http.MethodGet, "/control/log/config", handleGetLogConfig)
+	httpRegister(http.MethodPut, "/control/log/config/update", handlePutLogConfig)
+	httpRegister(http.MethodPost, "/control/config/reload", handleConfigReload)
 
 	// No auth is necessary for DoH/DoT configurations
 	Context.mux.HandleFunc("/apple/doh.mobileconfig", postInstall(handleMobileConfigDoH))
 	Context.mux.HandleFunc("/apple/dot.mobileconfig", postInstall(handleMobileConfigDoT))
 	RegisterAuthHandlers()
+	registerRateLimitHandlers()
+	registerBackupHandlers()
+	registerImportHandlers()
+	registerSyncHandlers()
+	registerNotificationsHandlers()
 }
 
 func httpRegister(method, url string, handler http.HandlerFunc) {
@@ -184,7 +193,16 @@ func httpRegister(method, url string, handler http.HandlerFunc) {
 		return
 	}
 
-	Context.mux.Handle(url, postInstallHandler(optionalAuthHandler(gziphandler.GzipHandler(ensureHandler(method, handler)))))
+	Context.mux.Handle(url, rateLimitHandler(postInstallHandler(optionalAuthHandler(gziphandler.GzipHandler(ensureHandler(method, handler))))))
+}
+
+// rateLimitHandler wraps h with the HTTP API rate limiter, if it's enabled.
+func rateLimitHandler(h http.Handler) (wrapped http.Handler) {
+	if Context.webRateLimiter == nil {
+		return h
+	}
+
+	return Context.webRateLimiter.Wrap(h)
 }
 
 // ensure returns a wrapped handler that makes sure that the request has the
@@ -17,6 +17,9 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
@@ -313,6 +316,25 @@ type applyConfigReq struct {
 
 	Web applyConfigReqEnt `json:"web"`
 	DNS applyConfigReqEnt `json:"dns"`
+
+	// DHCP is the optional configuration of the DHCPv4 server.  If set, the
+	// server is enabled.
+	DHCP *installDHCPReq `json:"dhcp"`
+
+	// Import is the optional configuration of other DNS servers to migrate
+	// from.
+	Import *installImportReq `json:"import"`
+
+	// Upstreams are the optional upstream servers.  If set, they replace the
+	// default and the imported ones.
+	Upstreams []string `json:"upstream_dns"`
+}
+
+// installDHCPReq is the configuration of the DHCPv4 server set during the
+// initial configuration.
+type installDHCPReq struct {
+	V4            *dhcpd.V4ServerConf `json:"v4"`
+	InterfaceName string              `json:"interface_name"`
 }
 
 // copyInstallSettings copies the installation parameters between two
@@ -322,6 +344,7 @@ func copyInstallSettings(dst, src *configuration) {
 	dst.BindPort = src.BindPort
 	dst.DNS.BindHosts = src.DNS.BindHosts
 	dst.DNS.Port = src.DNS.Port
+	dst.DNS.UpstreamDNS = src.DNS.UpstreamDNS
 }
 
 // shutdownTimeout is the timeout for shutting HTTP server down operation.
@@ -418,6 +441,13 @@ func (web *Web) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 	config.DNS.BindHosts = []netip.Addr{req.DNS.IP}
 	config.DNS.Port = req.DNS.Port
 
+	fconf := config.DNS.DnsfilterConf
+	prevRewrites, prevRules := fconf.Rewrites, fconf.UserRules
+	req.Import.importConfig().apply(config)
+	if len(req.Upstreams) > 0 {
+		config.DNS.UpstreamDNS = req.Upstreams
+	}
+
 	// TODO(e.burkov): StartMods() should be put in a separate goroutine at the
 	// moment we'll allow setting up TLS in the initial configuration or the
 	// configuration itself will use HTTPS protocol, because the underlying
@@ -426,6 +456,7 @@ func (web *Web) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		Context.firstRun = true
 		copyInstallSettings(config, curConfig)
+		fconf.Rewrites, fconf.UserRules = prevRewrites, prevRules
 		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
@@ -433,6 +464,7 @@ func (web *Web) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 
 	u := &webUser{
 		Name: req.Username,
+		Role: aghuser.RoleAdmin,
 	}
 	Context.auth.UserAdd(u, req.Password)
 
@@ -440,6 +472,7 @@ func (web *Web) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		Context.firstRun = true
 		copyInstallSettings(config, curConfig)
+		fconf.Rewrites, fconf.UserRules = prevRewrites, prevRules
 		aghhttp.Error(r, w, http.StatusInternalServerError, "Couldn't write config: %s", err)
 
 		return
@@ -451,7 +484,16 @@ func (web *Web) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 
 	registerControlHandlers()
 
-	aghhttp.OK(w)
+	// Configure DHCP after the configuration is written, since the DHCP
+	// server writes it as well.  The failure doesn't undo the rest of the
+	// settings, which are already applied.
+	err = configureInstallDHCP(req.DHCP)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "configuring dhcp: %s", err)
+	} else {
+		aghhttp.OK(w)
+	}
+
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -500,11 +542,35 @@ func decodeApplyConfigReq(r io.Reader) (req *applyConfigReq, restartHTTP bool, e
 		}
 	}
 
+	if len(req.Upstreams) > 0 {
+		err = dnsforward.ValidateUpstreams(req.Upstreams)
+		if err != nil {
+			return nil, false, fmt.Errorf("validating upstreams: %w", err)
+		}
+	}
+
+	if req.DHCP != nil && req.DHCP.V4 == nil {
+		return nil, false, errors.Error("dhcp: v4 is required")
+	}
+
 	return req, restartHTTP, err
 }
 
+// configureInstallDHCP enables the DHCPv4 server if req is not nil.
+func configureInstallDHCP(req *installDHCPReq) (err error) {
+	if req == nil {
+		return nil
+	} else if Context.dhcpServer == nil {
+		return errors.Error("dhcp server is not initialized")
+	}
+
+	return Context.dhcpServer.ConfigureV4(req.InterfaceName, req.V4)
+}
+
 func (web *Web) registerInstallHandlers() {
 	Context.mux.HandleFunc("/control/install/get_addresses", preInstall(ensureGET(web.handleInstallGetAddresses)))
 	Context.mux.HandleFunc("/control/install/check_config", preInstall(ensurePOST(web.handleInstallCheckConfig)))
 	Context.mux.HandleFunc("/control/install/configure", preInstall(ensurePOST(web.handleInstallConfigure)))
+	Context.mux.HandleFunc("/control/install/check_import", preInstall(ensurePOST(web.handleInstallCheckImport)))
+	Context.mux.HandleFunc("/control/install/test_upstreams", preInstall(ensurePOST(web.handleInstallTestUpstreams)))
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
@@ -101,6 +102,8 @@ func requestVersionInfo(resp *versionResponse, recheck bool) (err error) {
 		return fmt.Errorf("getting version info from %s: %w", vcu, err)
 	}
 
+	onVersionInfo(resp.VersionInfo)
+
 	return nil
 }
 
@@ -109,6 +112,10 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 	if Context.updater.NewVersion() == "" {
 		aghhttp.Error(r, w, http.StatusBadRequest, "/update request isn't allowed now")
 
+		return
+	} else if pinned := pinnedVersion(); pinned != "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "pinned to %s, unpin first", pinned)
+
 		return
 	}
 
@@ -123,6 +130,13 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = takeUpdateSnapshot()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
 	err = Context.updater.Update(false)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
@@ -130,6 +144,25 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	restartAfterResponse(w, execPath)
+}
+
+// takeUpdateSnapshot saves a snapshot of the configuration and the filters
+// before an update into the backups directory.
+func takeUpdateSnapshot() (err error) {
+	snapshot, err := saveSnapshot("pre-update", time.Now())
+	if err != nil {
+		return fmt.Errorf("saving pre-update snapshot: %w", err)
+	}
+
+	log.Info("updater: saved pre-update snapshot to %q", snapshot)
+
+	return nil
+}
+
+// restartAfterResponse responds with OK and restarts AdGuard Home using the
+// executable at execPath.
+func restartAfterResponse(w http.ResponseWriter, execPath string) {
 	aghhttp.OK(w)
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
@@ -141,6 +174,168 @@ func handleUpdate(w http.ResponseWriter, r *http.Request) {
 	go finishUpdate(context.Background(), execPath)
 }
 
+// updateStatus is the response for the GET /control/update/status HTTP API.
+type updateStatus struct {
+	// CurrentVersion is the running version.
+	CurrentVersion string `json:"current_version"`
+
+	// PreviousVersion is the version the last update can be rolled back to.
+	// It's empty if there is none.
+	PreviousVersion string `json:"previous_version"`
+
+	// PinnedVersion is the version AdGuard Home is pinned to, if any.
+	PinnedVersion string `json:"pinned_version"`
+
+	// Channel is the release channel of the updates.
+	Channel string `json:"channel"`
+
+	// Confirmed is false if the last update hasn't been verified yet.
+	Confirmed bool `json:"confirmed"`
+}
+
+// handleUpdateStatus is the handler for the GET /control/update/status HTTP
+// API.
+func handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	rec, err := updater.ReadRecord(Context.workDir)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	config.RLock()
+	resp := &updateStatus{
+		CurrentVersion: version.Version(),
+		PinnedVersion:  config.AutoUpdate.PinnedVersion,
+		Channel:        config.AutoUpdate.updateChannel(),
+		Confirmed:      true,
+	}
+	config.RUnlock()
+
+	if rec != nil {
+		resp.PreviousVersion = rec.PrevVersion
+		resp.Confirmed = rec.Confirmed
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleUpdateRollback is the handler for the POST /control/update/rollback
+// HTTP API.  It restores the version replaced by the last update and restarts
+// AdGuard Home.
+func handleUpdateRollback(w http.ResponseWriter, r *http.Request) {
+	if Context.disableUpdate {
+		aghhttp.Error(r, w, http.StatusBadRequest, "updates are disabled")
+
+		return
+	}
+
+	rec, err := updater.ReadRecord(Context.workDir)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	} else if rec == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "no previous version")
+
+		return
+	}
+
+	// See the comment in handleUpdate.
+	execPath, err := os.Executable()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "getting path: %s", err)
+
+		return
+	}
+
+	err = rollBackUpdate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "rolling back: %s", err)
+
+		return
+	}
+
+	log.Info("updater: rolled back to %s, restarting", rec.PrevVersion)
+
+	restartAfterResponse(w, execPath)
+}
+
+// updatePinReq is the request for the POST /control/update/pin HTTP API.
+type updatePinReq struct {
+	// Version is the version to pin AdGuard Home to.  If empty, AdGuard Home
+	// is unpinned.
+	Version string `json:"version"`
+}
+
+// handleUpdatePin is the handler for the POST /control/update/pin HTTP API.
+// It pins AdGuard Home to a specific version, installing it if needed, or
+// unpins it.
+func handleUpdatePin(w http.ResponseWriter, r *http.Request) {
+	if Context.disableUpdate {
+		aghhttp.Error(r, w, http.StatusBadRequest, "updates are disabled")
+
+		return
+	}
+
+	req := &updatePinReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing request: %s", err)
+
+		return
+	}
+
+	if req.Version != "" {
+		err = updater.ValidateVersion(req.Version)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+			return
+		}
+	}
+
+	func() {
+		config.Lock()
+		defer config.Unlock()
+
+		config.AutoUpdate.PinnedVersion = req.Version
+	}()
+
+	onConfigModified()
+
+	if req.Version == "" || req.Version == version.Version() {
+		log.Info("updater: pinned version set to %q", req.Version)
+		aghhttp.OK(w)
+
+		return
+	}
+
+	// See the comment in handleUpdate.
+	execPath, err := os.Executable()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "getting path: %s", err)
+
+		return
+	}
+
+	err = takeUpdateSnapshot()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	err = Context.updater.UpdateTo(req.Version, false)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	restartAfterResponse(w, execPath)
+}
+
 // versionResponse is the response for /control/version.json endpoint.
 type versionResponse struct {
 	updater.VersionInfo
@@ -176,15 +371,29 @@ func tlsConfUsesPrivilegedPorts(c *tlsConfigSettings) (ok bool) {
 	return c.Enabled && (c.PortHTTPS < 1024 || c.PortDNSOverTLS < 1024 || c.PortDNSOverQUIC < 1024)
 }
 
-// finishUpdate completes an update procedure.
+// finishUpdate completes an update procedure.  If the new executable fails to
+// start, the update is rolled back.
 func finishUpdate(ctx context.Context, execPath string) {
-	var err error
-
 	log.Info("stopping all tasks")
 
 	cleanup(ctx)
 	cleanupAlways()
 
+	err := restart(execPath)
+	log.Error("restarting: %s; rolling back", err)
+
+	err = updater.Rollback(Context.workDir)
+	if err != nil {
+		log.Fatalf("rolling back: %s", err)
+	}
+
+	err = restart(execPath)
+	log.Fatalf("restarting: %s", err)
+}
+
+// restart replaces the current process with the executable at execPath.  It
+// only returns if it fails.
+func restart(execPath string) (err error) {
 	if runtime.GOOS == "windows" {
 		if Context.runningAsService {
 			// NOTE: We can't restart the service via "kardianos/service"
@@ -195,7 +404,7 @@ func finishUpdate(ctx context.Context, execPath string) {
 			cmd := exec.Command("cmd", "/c", "net stop AdGuardHome & net start AdGuardHome")
 			err = cmd.Start()
 			if err != nil {
-				log.Fatalf("restarting: stopping: %s", err)
+				return fmt.Errorf("stopping: %w", err)
 			}
 
 			os.Exit(0)
@@ -208,15 +417,13 @@ func finishUpdate(ctx context.Context, execPath string) {
 		cmd.Stderr = os.Stderr
 		err = cmd.Start()
 		if err != nil {
-			log.Fatalf("restarting:: %s", err)
+			return err
 		}
 
 		os.Exit(0)
 	}
 
 	log.Info("restarting: %q %q", execPath, os.Args[1:])
-	err = syscall.Exec(execPath, os.Args, os.Environ())
-	if err != nil {
-		log.Fatalf("restarting: %s", err)
-	}
+
+	return syscall.Exec(execPath, os.Args, os.Environ())
 }
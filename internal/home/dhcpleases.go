@@ -0,0 +1,82 @@
+package home
+
+import (
+	"os"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// DHCP Lease Import And Export
+
+// leasesImportReqBodySzLim is the maximum size of a lease database to import.
+const leasesImportReqBodySzLim = 16 * 1024 * 1024
+
+// cmdlineLeases exports the DHCP leases into a file or imports them from one
+// and exits, if requested.
+func cmdlineLeases(opts options) {
+	if opts.leasesExportFile == "" && opts.leasesImportFile == "" {
+		return
+	} else if Context.firstRun {
+		log.Fatal("dhcp: finish the initial configuration before exporting or importing leases")
+	}
+
+	f := opts.leasesFormat
+	if f == "" {
+		f = dhcpd.LeasesFormatJSON
+	}
+
+	if opts.leasesExportFile != "" {
+		exportLeases(opts.leasesExportFile, f)
+	}
+
+	if opts.leasesImportFile != "" {
+		importLeases(opts.leasesImportFile, f)
+	}
+
+	os.Exit(0)
+}
+
+// exportLeases writes the DHCP leases into the file at path in format f.
+func exportLeases(path string, f dhcpd.LeasesFormat) {
+	leases := Context.dhcpServer.Leases(dhcpd.LeasesAll)
+	err := func() (err error) {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+		return dhcpd.WriteLeases(file, leases, f)
+	}()
+	if err != nil {
+		log.Fatalf("dhcp: exporting leases: %s", err)
+	}
+
+	log.Info("dhcp: exported %d leases to %q", len(leases), path)
+}
+
+// importLeases adds the leases from the lease database at path in format f to
+// the DHCP server.
+func importLeases(path string, f dhcpd.LeasesFormat) {
+	leases, err := func() (leases []*dhcpd.Lease, err error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+		return dhcpd.ReadLeases(file, f)
+	}()
+	if err != nil {
+		log.Fatalf("dhcp: importing leases: %s", err)
+	}
+
+	added, skipped := dhcpd.ImportLeases(Context.dhcpServer, leases)
+	for _, s := range skipped {
+		log.Info("dhcp: skipped %s", s)
+	}
+
+	log.Info("dhcp: imported %d leases from %q", added, path)
+}
@@ -0,0 +1,234 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/diag"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Diagnostic Bundles
+
+// diagErrorLogSize is the number of the latest distinct warning and error
+// messages kept for each subsystem.
+const diagErrorLogSize = 20
+
+// diagClientDataPaths are the paths of the configuration properties that
+// contain client data or identify the installation.  Those are redacted in the
+// diagnostic bundles along with secretPaths.
+var diagClientDataPaths = [][]string{
+	{"clients", "persistent"},
+	{"dns", "allowed_clients"},
+	{"dns", "disallowed_clients"},
+	{"dns", "disallowed_clients_schedule", "*", "client"},
+	{"dns", "fallback_dns"},
+	{"dns", "local_ptr_upstreams"},
+	{"dns", "parental_bypass_pin"},
+	{"dns", "private_bootstrap_dns"},
+	{"dns", "query_hook", "expressions"},
+	{"dns", "refused_query_types_clients"},
+	{"dns", "rewrites"},
+	{"dns", "rule_requests"},
+	{"dns", "upstream_dns"},
+	{"oidc", "client_id"},
+	{"sync", "primary_url"},
+	{"sync", "username"},
+	{"tls", "certificate_chain"},
+	{"tls", "server_name"},
+	{"user_rules"},
+	{"users"},
+}
+
+// initDiagErrorLog starts keeping the latest warning and error messages from
+// the log output for the diagnostic bundles and the HTTP API.  It must be called after the logger is
+// configured.
+func initDiagErrorLog() {
+	Context.errorLog = diag.NewErrorLog(log.Writer(), diagErrorLogSize)
+	log.SetOutput(Context.errorLog)
+}
+
+// writeDiagBundle writes a diagnostic bundle with the redacted configuration
+// file, the version information, the recent errors, and the counters to buf.
+func writeDiagBundle(buf *bytes.Buffer, now time.Time) (err error) {
+	// Make sure the configuration file reflects the current state.
+	err = config.write()
+	if err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	confData, err := os.ReadFile(config.getConfigFilename())
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	confData, err = redactConfig(confData)
+	if err != nil {
+		return fmt.Errorf("redacting config: %w", err)
+	}
+
+	b := &diag.Bundle{
+		Report: diag.NewReport(now),
+		Config: confData,
+	}
+
+	if Context.errorLog != nil {
+		b.Errors = Context.errorLog.Records("")
+	}
+
+	if srv := Context.dnsServer; srv != nil {
+		b.Report.Counters = diagCounters(srv.Counters())
+	}
+
+	return b.Write(buf)
+}
+
+// redactConfig returns the configuration file data with the secrets and the
+// client data redacted.
+func redactConfig(data []byte) (redacted []byte, err error) {
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding: %w", err)
+	} else if doc.Kind == 0 {
+		// Empty document.
+		return nil, nil
+	}
+
+	diag.Redact(doc, secretPaths)
+	diag.Redact(doc, diagClientDataPaths)
+	redactFilterURLs(doc)
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encoding: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// redactFilterURLs removes the credentials, the query, and the fragment, which
+// may contain access tokens, from the URLs of the filter lists within the
+// configuration document doc.
+func redactFilterURLs(doc *yaml.Node) {
+	root := lookupNode(doc, nil)
+	for _, key := range []string{"filters", "whitelist_filters"} {
+		lists := mappingValue(root, key)
+		if lists == nil || lists.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for _, l := range lists.Content {
+			if n := mappingValue(l, "url"); n != nil && n.Kind == yaml.ScalarNode {
+				n.Value = redactURL(n.Value)
+			}
+		}
+	}
+}
+
+// redactURL returns rawURL without the credentials, the query, and the
+// fragment.  The local file paths are returned as is.
+func redactURL(rawURL string) (redacted string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return diag.Redacted
+	} else if u.Scheme == "" || (u.User == nil && u.RawQuery == "" && u.Fragment == "") {
+		return rawURL
+	}
+
+	u.User, u.RawQuery, u.ForceQuery, u.Fragment = nil, "", false, ""
+
+	return u.String() + "?" + diag.Redacted
+}
+
+// diagCounters converts the counters of the DNS server into the ones of the
+// diagnostic report.
+func diagCounters(c *dnsforward.Counters) (dc *diag.Counters) {
+	dc = &diag.Counters{
+		Upstreams:       make([]*diag.UpstreamCounters, 0, len(c.Upstreams)),
+		Queries:         c.Queries,
+		Blocked:         c.Blocked,
+		CacheHits:       c.CacheHits,
+		UpstreamQueries: c.UpstreamQueries,
+	}
+
+	for _, uc := range c.Upstreams {
+		duc := &diag.UpstreamCounters{
+			Address: uc.Address,
+			Queries: uc.Queries,
+		}
+
+		if uc.Queries > 0 {
+			duc.AvgTime = float64(uc.TotalTime) / float64(uc.Queries) / float64(time.Millisecond)
+		}
+
+		dc.Upstreams = append(dc.Upstreams, duc)
+	}
+
+	return dc
+}
+
+// handleDiagnostics is the handler for the GET /control/diagnostics HTTP API.
+// It responds with a diagnostic bundle, which contains no client data and can
+// be attached to bug reports.
+func handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	// Write into a buffer first to be able to respond with an error.
+	buf := &bytes.Buffer{}
+	err := writeDiagBundle(buf, now)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "creating diagnostic bundle: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(aghhttp.HdrNameContentType, "application/zip")
+	h.Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="AdGuardHome-diagnostics-%s.zip"`, now.UTC().Format("20060102T150405Z")),
+	)
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("diag: writing response: %s", err)
+	}
+}
+
+// diagErrorsResp is the response to the GET /control/diagnostics/errors HTTP
+// API.
+type diagErrorsResp struct {
+	// Errors are the recent warning and error records, the most recently seen
+	// first.
+	Errors []*diag.Record `json:"errors"`
+}
+
+// handleDiagnosticsErrors is the handler for the GET
+// /control/diagnostics/errors HTTP API.  The optional query parameter
+// subsystem limits the records to the ones of that subsystem.
+func handleDiagnosticsErrors(w http.ResponseWriter, r *http.Request) {
+	resp := &diagErrorsResp{
+		Errors: []*diag.Record{},
+	}
+
+	if Context.errorLog != nil {
+		recs := Context.errorLog.Records(r.URL.Query().Get("subsystem"))
+		if recs != nil {
+			resp.Errors = recs
+		}
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
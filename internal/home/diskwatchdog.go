@@ -0,0 +1,248 @@
+package home
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Disk Space Watchdog
+
+// diskWatchdogConfig is the configuration of the watchdog of the free space in
+// the data directories.
+type diskWatchdogConfig struct {
+	// Interval is the interval between the checks of the free space.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// MinFreeMB is the minimum free space in megabytes.  When the free space
+	// falls below it, the user is notified, the query log file writes are
+	// paused, and the oldest query log and statistics data are removed.  The
+	// writes are resumed once the free space is twice the minimum.
+	MinFreeMB uint64 `yaml:"min_free_mb"`
+
+	// Enabled defines if the free space is watched.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the disk watchdog configuration isn't valid.
+func (c *diskWatchdogConfig) validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Interval.Duration < time.Minute {
+		return errors.Error("interval: must be at least one minute")
+	} else if c.MinFreeMB == 0 {
+		return errors.Error("min_free_mb: must be positive")
+	}
+
+	return nil
+}
+
+// watchedDir is a directory watched by the disk watchdog along with the
+// functions degrading and restoring the modules writing into it.
+type watchedDir struct {
+	// path is the path to the directory.
+	path string
+
+	// names are the human-readable names of the data stored in the directory.
+	names []string
+
+	// onLow are called when the free space falls below the minimum.
+	onLow []func()
+
+	// onRestored are called when the free space is restored.
+	onRestored []func()
+
+	// low is true if the free space is below the minimum.
+	low bool
+}
+
+// diskWatchdog watches the free space in the data directories.
+type diskWatchdog struct {
+	// freeSpace returns the space of the file system containing the path.
+	// It's here for testing purposes.
+	freeSpace func(path string) (ds *aghos.DiskSpace, err error)
+
+	// publish publishes the events.  It's here for testing purposes.
+	publish func(t aghevent.Type, data map[string]string)
+
+	// dirs are the watched directories.
+	dirs []*watchedDir
+
+	// minFree is the minimum free space in bytes.
+	minFree uint64
+}
+
+// newDiskWatchdog returns a new properly initialized *diskWatchdog.
+func newDiskWatchdog(conf *diskWatchdogConfig) (w *diskWatchdog) {
+	return &diskWatchdog{
+		freeSpace: aghos.FreeSpace,
+		publish:   publishEvent,
+		minFree:   conf.MinFreeMB * 1024 * 1024,
+	}
+}
+
+// add adds the directory with the data named name to the watched ones.  The
+// data stored in the same directory are watched together.  onLow and
+// onRestored may be nil.
+func (w *diskWatchdog) add(name, path string, onLow, onRestored func()) {
+	path = filepath.Clean(path)
+
+	var d *watchedDir
+	for _, wd := range w.dirs {
+		if wd.path == path {
+			d = wd
+
+			break
+		}
+	}
+
+	if d == nil {
+		d = &watchedDir{
+			path: path,
+		}
+		w.dirs = append(w.dirs, d)
+	}
+
+	d.names = append(d.names, name)
+	if onLow != nil {
+		d.onLow = append(d.onLow, onLow)
+	}
+
+	if onRestored != nil {
+		d.onRestored = append(d.onRestored, onRestored)
+	}
+}
+
+// check checks the free space in all the watched directories.
+func (w *diskWatchdog) check() {
+	for _, d := range w.dirs {
+		ds, err := w.freeSpace(d.path)
+		if err != nil {
+			log.Error("disk watchdog: checking %s: %s", d.path, err)
+
+			continue
+		}
+
+		w.checkDir(d, ds.Free)
+	}
+}
+
+// checkDir degrades or restores the modules writing into d depending on the
+// free space.
+func (w *diskWatchdog) checkDir(d *watchedDir, free uint64) {
+	name := strings.Join(d.names, " and ")
+	switch {
+	case !d.low && free < w.minFree:
+		d.low = true
+		log.Info(
+			"disk watchdog: warning: %d bytes free in %s directory %s, degrading",
+			free,
+			name,
+			d.path,
+		)
+
+		w.publish(aghevent.TypeDiskSpaceLow, map[string]string{
+			"name":     name,
+			"path":     d.path,
+			"free":     strconv.FormatUint(free, 10),
+			"min_free": strconv.FormatUint(w.minFree, 10),
+		})
+
+		for _, f := range d.onLow {
+			f()
+		}
+	case d.low && free >= 2*w.minFree:
+		d.low = false
+		log.Info("disk watchdog: %d bytes free in %s directory %s, restoring", free, name, d.path)
+
+		for _, f := range d.onRestored {
+			f()
+		}
+	default:
+		// Go on.
+	}
+}
+
+// loop checks the free space every ivl.
+func (w *diskWatchdog) loop(ivl time.Duration) {
+	defer log.OnPanic("disk watchdog")
+
+	w.check()
+
+	ticker := time.NewTicker(ivl)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		w.check()
+	}
+}
+
+// startDiskWatchdog starts watching the free space in the directories of the
+// query log, the statistics, and the filters, if enabled.  It must be called
+// after the DNS modules are initialized.
+func startDiskWatchdog() {
+	conf := config.DiskWatchdog
+	if !conf.Enabled {
+		return
+	}
+
+	dataDir := Context.getDataDir()
+
+	w := newDiskWatchdog(&conf)
+	w.add("query log", dataDir, degradeQueryLog, restoreQueryLog)
+	w.add("statistics", dataDir, pruneStats, nil)
+	w.add("filters", filepath.Join(dataDir, "filters"), nil, nil)
+
+	log.Info(
+		"disk watchdog: watching %d directories, minimum free space is %d MB",
+		len(w.dirs),
+		conf.MinFreeMB,
+	)
+
+	go w.loop(conf.Interval.Duration)
+}
+
+// degradeQueryLog pauses the query log file writes and removes the oldest query
+// log file.
+func degradeQueryLog() {
+	ql := Context.queryLog
+	if ql == nil {
+		return
+	}
+
+	ql.SetFilePaused(true)
+
+	err := ql.PruneOldest()
+	if err != nil {
+		log.Error("disk watchdog: pruning query log: %s", err)
+	}
+}
+
+// restoreQueryLog resumes the query log file writes.
+func restoreQueryLog() {
+	if ql := Context.queryLog; ql != nil {
+		ql.SetFilePaused(false)
+	}
+}
+
+// pruneStats removes the oldest statistics.
+func pruneStats() {
+	s := Context.stats
+	if s == nil {
+		return
+	}
+
+	err := s.PruneOldest()
+	if err != nil {
+		log.Error("disk watchdog: pruning statistics: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskWatchdog_check(t *testing.T) {
+	const minFree = 1024 * 1024
+
+	var free uint64
+	var events []map[string]string
+	w := &diskWatchdog{
+		freeSpace: func(_ string) (ds *aghos.DiskSpace, err error) {
+			return &aghos.DiskSpace{Free: free, Total: 100 * minFree}, nil
+		},
+		publish: func(typ aghevent.Type, data map[string]string) {
+			assert.Equal(t, aghevent.TypeDiskSpaceLow, typ)
+			events = append(events, data)
+		},
+		minFree: minFree,
+	}
+
+	var lows, restores int
+	onLow := func() { lows++ }
+	onRestored := func() { restores++ }
+
+	w.add("query log", "/data", onLow, onRestored)
+	w.add("statistics", "/data/", onLow, nil)
+	require.Len(t, w.dirs, 1)
+
+	testCases := []struct {
+		name         string
+		free         uint64
+		wantEvents   int
+		wantLows     int
+		wantRestores int
+	}{{
+		name:         "enough",
+		free:         10 * minFree,
+		wantEvents:   0,
+		wantLows:     0,
+		wantRestores: 0,
+	}, {
+		name:         "low",
+		free:         minFree - 1,
+		wantEvents:   1,
+		wantLows:     2,
+		wantRestores: 0,
+	}, {
+		name:         "still_low",
+		free:         minFree / 2,
+		wantEvents:   1,
+		wantLows:     2,
+		wantRestores: 0,
+	}, {
+		name:         "not_restored_yet",
+		free:         minFree,
+		wantEvents:   1,
+		wantLows:     2,
+		wantRestores: 0,
+	}, {
+		name:         "restored",
+		free:         2 * minFree,
+		wantEvents:   1,
+		wantLows:     2,
+		wantRestores: 1,
+	}, {
+		name:         "low_again",
+		free:         0,
+		wantEvents:   2,
+		wantLows:     4,
+		wantRestores: 1,
+	}}
+
+	for _, tc := range testCases {
+		free = tc.free
+		w.check()
+
+		assert.Lenf(t, events, tc.wantEvents, "%s: events", tc.name)
+		assert.Equalf(t, tc.wantLows, lows, "%s: degradations", tc.name)
+		assert.Equalf(t, tc.wantRestores, restores, "%s: restorations", tc.name)
+	}
+
+	require.NotEmpty(t, events)
+
+	assert.Equal(t, map[string]string{
+		"name":     "query log and statistics",
+		"path":     "/data",
+		"free":     "1048575",
+		"min_free": "1048576",
+	}, events[0])
+}
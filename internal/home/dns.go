@@ -8,13 +8,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -46,13 +47,15 @@ func onConfigModified() {
 // server and initializes it at last.  It also must not be called unless
 // [config] and [Context] are initialized.
 func initDNS() (err error) {
-	baseDir := Context.getDataDir()
+	warnAddrFamilies(&config.DNS)
 
 	anonymizer := config.anonymizer()
 
 	statsConf := stats.Config{
-		Filename:       filepath.Join(baseDir, "stats.db"),
+		Filename:       filepath.Join(Context.dataDirOr(config.Stats.DirPath), "stats.db"),
 		Limit:          config.Stats.Interval.Duration,
+		CompactIvl:     config.Stats.CompactInterval.Duration,
+		FlushBatch:     config.Stats.FlushBatch,
 		ConfigModified: onConfigModified,
 		HTTPRegister:   httpRegister,
 		Enabled:        config.Stats.Enabled,
@@ -74,10 +77,11 @@ func initDNS() (err error) {
 		ConfigModified:    onConfigModified,
 		HTTPRegister:      httpRegister,
 		FindClient:        Context.clients.findMultiple,
-		BaseDir:           baseDir,
+		BaseDir:           Context.dataDirOr(config.QueryLog.DirPath),
 		AnonymizeClientIP: config.DNS.AnonymizeClientIP,
 		RotationIvl:       config.QueryLog.Interval.Duration,
 		MemSize:           config.QueryLog.MemSize,
+		SampleRate:        config.QueryLog.SampleRate,
 		Enabled:           config.QueryLog.Enabled,
 		FileEnabled:       config.QueryLog.FileEnabled,
 	}
@@ -99,13 +103,38 @@ func initDNS() (err error) {
 		return err
 	}
 
+	if config.DNS.QueryHook.Enabled {
+		Context.queryHook, err = queryhook.New(&config.DNS.QueryHook)
+		if err != nil {
+			return fmt.Errorf("init query hook: %w", err)
+		}
+	}
+
+	initPlugins()
+	initVerdictExport()
+
+	var qlog querylog.QueryLog = Context.queryLog
+	if Context.plugins != nil {
+		qlog = &pluginQueryLog{
+			QueryLog: qlog,
+			plugins:  Context.plugins,
+		}
+	}
+
+	if Context.verdictExport != nil {
+		qlog = &exportQueryLog{
+			QueryLog: qlog,
+			export:   Context.verdictExport,
+		}
+	}
+
 	tlsConf := &tlsConfigSettings{}
 	Context.tls.WriteDiskConfig(tlsConf)
 
 	return initDNSServer(
 		Context.filters,
 		Context.stats,
-		Context.queryLog,
+		qlog,
 		Context.dhcpServer,
 		anonymizer,
 		httpRegister,
@@ -139,6 +168,7 @@ func initDNSServer(
 		Anonymizer:  anonymizer,
 		LocalDomain: config.DHCP.LocalDomainName,
 		DHCPServer:  dhcpSrv,
+		SocketFiles: Context.dnsSocketFiles,
 	}
 
 	Context.dnsServer, err = dnsforward.NewServer(p)
@@ -168,8 +198,13 @@ func initDNSServer(
 		Context.rdns = NewRDNS(Context.dnsServer, &Context.clients, config.DNS.UsePrivateRDNS)
 	}
 
-	if config.Clients.Sources.WHOIS {
-		Context.whois = initWHOIS(&Context.clients)
+	Context.whois = nil
+	if srcs := config.Clients.Sources; srcs.WHOIS {
+		dial, ok := whoisDialer(config.ProxyURL, srcs.WHOISViaProxy)
+		if ok {
+			cachePath := filepath.Join(Context.getDataDir(), whoisCacheFile)
+			Context.whois = initWHOIS(&Context.clients, dial, cachePath)
+		}
 	}
 
 	return nil
@@ -212,12 +247,14 @@ func onDNSRequest(pctx *proxy.DNSContext) {
 		return
 	}
 
+	Context.clients.markRuntimeSeen(ip, time.Now())
+
 	srcs := config.Clients.Sources
 	if srcs.RDNS && !ip.IsLoopback() {
 		Context.rdns.Begin(ip)
 	}
 
-	if srcs.WHOIS && !netutil.IsSpecialPurposeAddr(ip) {
+	if Context.whois != nil && !netutil.IsSpecialPurposeAddr(ip) {
 		Context.whois.Begin(ip)
 	}
 }
@@ -253,16 +290,19 @@ func generateServerConfig(
 	httpReg aghhttp.RegisterFunc,
 ) (newConf dnsforward.ServerConfig, err error) {
 	dnsConf := config.DNS
-	hosts := aghalg.CoalesceSlice(dnsConf.BindHosts, []netip.Addr{netutil.IPv4Localhost()})
+	hosts := dnsBindHosts(&dnsConf)
 	newConf = dnsforward.ServerConfig{
-		UDPListenAddrs:  ipsToUDPAddrs(hosts, dnsConf.Port),
-		TCPListenAddrs:  ipsToTCPAddrs(hosts, dnsConf.Port),
-		FilteringConfig: dnsConf.FilteringConfig,
-		ConfigModified:  onConfigModified,
-		HTTPRegister:    httpReg,
-		OnDNSRequest:    onDNSRequest,
-		UseDNS64:        config.DNS.UseDNS64,
-		DNS64Prefixes:   config.DNS.DNS64Prefixes,
+		UDPListenAddrs:    ipsToUDPAddrs(hosts, dnsConf.Port),
+		TCPListenAddrs:    ipsToTCPAddrs(hosts, dnsConf.Port),
+		FilteringConfig:   dnsConf.FilteringConfig,
+		ConfigModified:    onConfigModified,
+		HTTPRegister:      httpReg,
+		OnDNSRequest:      onDNSRequest,
+		OnBlocked:         onDNSBlocked,
+		OnParentalBypass:  onParentalBypass,
+		OnTunnelSuspected: onTunnelSuspected,
+		UseDNS64:          config.DNS.UseDNS64,
+		DNS64Prefixes:     config.DNS.DNS64Prefixes,
 	}
 
 	if tlsConf.Enabled {
@@ -295,6 +335,9 @@ func generateServerConfig(
 	newConf.TLSAllowUnencryptedDoH = tlsConf.AllowUnencryptedDoH
 
 	newConf.FilterHandler = applyAdditionalFiltering
+	if hook := newQueryHook(); hook != nil {
+		newConf.QueryHook = hook
+	}
 	newConf.GetCustomUpstreamByClient = Context.clients.findUpstreams
 
 	newConf.LocalPTRResolvers = dnsConf.LocalPTRResolvers
@@ -423,6 +466,10 @@ func applyAdditionalFiltering(clientIP net.IP, clientID string, setts *filtering
 
 	setts.ClientName = c.Name
 	setts.ClientTags = c.Tags
+	if c.LocalDiscoveryPassthrough != nil {
+		setts.LocalDiscoveryPassthrough = *c.LocalDiscoveryPassthrough
+	}
+
 	if !c.UseOwnSettings {
 		return
 	}
@@ -443,6 +490,7 @@ func startDNSServer() error {
 	}
 
 	Context.filters.EnableFilters(false)
+	Context.filtersLoaded.Store(true)
 
 	Context.clients.Start()
 
@@ -462,7 +510,7 @@ func startDNSServer() error {
 			Context.rdns.Begin(ip)
 		}
 
-		if srcs.WHOIS && !netutil.IsSpecialPurposeAddr(ip) {
+		if Context.whois != nil && !netutil.IsSpecialPurposeAddr(ip) {
 			Context.whois.Begin(ip)
 		}
 	}
@@ -533,6 +581,33 @@ func closeDNSServer() {
 		Context.queryLog = nil
 	}
 
+	if Context.queryHook != nil {
+		err := Context.queryHook.Close()
+		if err != nil {
+			log.Debug("closing query hook: %s", err)
+		}
+
+		Context.queryHook = nil
+	}
+
+	if Context.plugins != nil {
+		err := Context.plugins.Close()
+		if err != nil {
+			log.Debug("closing plugins: %s", err)
+		}
+
+		Context.plugins = nil
+	}
+
+	if Context.verdictExport != nil {
+		err := Context.verdictExport.Close()
+		if err != nil {
+			log.Debug("closing verdict export: %s", err)
+		}
+
+		Context.verdictExport = nil
+	}
+
 	log.Debug("all dns modules are closed")
 }
 
@@ -0,0 +1,189 @@
+package home
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Events
+
+// initEvents initializes the event bus and subscribes the webhooks and the
+// notifier to it.  It must be called after the DHCP server is created.
+func initEvents() (err error) {
+	Context.events = aghevent.NewBus()
+
+	d, err := webhook.NewDispatcher(&webhook.DispatcherConfig{
+		Client:     Context.client,
+		Webhooks:   config.Webhooks,
+		RetryDelay: webhook.DefaultRetryDelay,
+		MaxRetries: webhook.DefaultMaxRetries,
+	})
+	if err != nil {
+		return fmt.Errorf("creating webhooks: %w", err)
+	}
+
+	if d.Len() > 0 {
+		Context.webhooks = d
+		Context.events.Subscribe(d)
+		d.Start()
+
+		log.Info("events: %d webhooks enabled", d.Len())
+	}
+
+	err = initNotifier()
+	if err != nil {
+		return fmt.Errorf("initializing notifications: %w", err)
+	}
+
+	if Context.dhcpServer != nil {
+		w := dhcpd.NewLeaseWatcher(Context.dhcpServer, onLeaseEvent)
+		Context.dhcpServer.SetOnLeaseChanged(w.OnLeaseChanged)
+	}
+
+	return nil
+}
+
+// publishEvent publishes an event of type t with data, if there are any
+// subscribers.
+func publishEvent(t aghevent.Type, data map[string]string) {
+	if b := Context.events; b != nil && b.HasHandlers() {
+		b.Publish(t, data)
+	}
+}
+
+// onDNSBlocked publishes the event about a DNS request blocked by the
+// filtering.
+func onDNSBlocked(host string, ip net.IP, clientID string, res *filtering.Result) {
+	b := Context.events
+	if b == nil || !b.HasHandlers() {
+		return
+	}
+
+	data := map[string]string{
+		"domain":    host,
+		"client_ip": ip.String(),
+		"client_id": clientID,
+		"reason":    res.Reason.String(),
+	}
+
+	if len(res.Rules) > 0 {
+		data["rule"] = res.Rules[0].Text
+	}
+
+	b.Publish(aghevent.TypeQueryBlocked, data)
+}
+
+// onParentalBypass publishes the event about an attempt to start the parental
+// control bypass.
+func onParentalBypass(e *dnsforward.ParentalBypassEvent) {
+	if e.Expires.IsZero() {
+		publishEvent(aghevent.TypeParentalBypassFailed, map[string]string{
+			"client": e.Client,
+			"method": e.Method,
+		})
+
+		return
+	}
+
+	publishEvent(aghevent.TypeParentalBypassStarted, map[string]string{
+		"client":  e.Client,
+		"method":  e.Method,
+		"expires": e.Expires.Format(time.RFC3339),
+	})
+}
+
+// onFilterUpdateFailed publishes the event about a failed filter list update.
+func onFilterUpdateFailed(name, url string, err error) {
+	publishEvent(aghevent.TypeFilterUpdateFailed, map[string]string{
+		"name":  name,
+		"url":   url,
+		"error": err.Error(),
+	})
+}
+
+// onRuleRequest publishes the event about a new rule change request.
+func onRuleRequest(req *filtering.RuleRequest) {
+	publishEvent(aghevent.TypeRuleRequestCreated, map[string]string{
+		"id":      req.ID,
+		"domain":  req.Domain,
+		"action":  string(req.Action),
+		"client":  req.Client,
+		"comment": req.Comment,
+	})
+}
+
+// onTunnelSuspected publishes the event about a client suspected of DNS
+// tunneling.
+func onTunnelSuspected(e *dnsforward.TunnelSuspectEvent) {
+	publishEvent(aghevent.TypeDNSTunnelSuspected, map[string]string{
+		"client": e.Client,
+		"domain": e.Domain,
+		"score":  strconv.FormatUint(uint64(e.Score), 10),
+	})
+}
+
+// updateAnnouncer publishes the event about a new AdGuard Home version once per
+// version.
+var updateAnnouncer = &struct {
+	mu      *sync.Mutex
+	version string
+}{
+	mu: &sync.Mutex{},
+}
+
+// onVersionInfo publishes the event about a new AdGuard Home version, if vi
+// contains one that hasn't been announced yet.
+func onVersionInfo(vi updater.VersionInfo) {
+	if vi.NewVersion == "" || vi.NewVersion == version.Version() {
+		return
+	}
+
+	updateAnnouncer.mu.Lock()
+	defer updateAnnouncer.mu.Unlock()
+
+	if updateAnnouncer.version == vi.NewVersion {
+		return
+	}
+
+	updateAnnouncer.version = vi.NewVersion
+	publishEvent(aghevent.TypeUpdateAvailable, map[string]string{
+		"version":          vi.NewVersion,
+		"announcement_url": vi.AnnouncementURL,
+	})
+}
+
+// leaseEventTypes are the types of the events of the dynamic DHCP leases.
+var leaseEventTypes = map[dhcpd.LeaseEvent]aghevent.Type{
+	dhcpd.LeaseEventGranted:  aghevent.TypeDHCPLeaseAdded,
+	dhcpd.LeaseEventRenewed:  aghevent.TypeDHCPLeaseRenewed,
+	dhcpd.LeaseEventReleased: aghevent.TypeDHCPLeaseReleased,
+	dhcpd.LeaseEventDeclined: aghevent.TypeDHCPLeaseDeclined,
+	dhcpd.LeaseEventExpired:  aghevent.TypeDHCPLeaseExpired,
+}
+
+// onLeaseEvent implements the [dhcpd.OnLeaseEventT] for the lease events
+// published to the event bus.
+func onLeaseEvent(e dhcpd.LeaseEvent, l *dhcpd.Lease) {
+	t, ok := leaseEventTypes[e]
+	if !ok {
+		return
+	}
+
+	publishEvent(t, map[string]string{
+		"hostname": l.Hostname,
+		"ip":       l.IP.String(),
+		"mac":      l.HWAddr.String(),
+	})
+}
@@ -0,0 +1,95 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventRecorder is an [aghevent.Handler] that records the events.
+type eventRecorder struct {
+	events []*aghevent.Event
+}
+
+// Handle implements the [aghevent.Handler] interface for *eventRecorder.
+func (r *eventRecorder) Handle(e *aghevent.Event) {
+	r.events = append(r.events, e)
+}
+
+// setEventRecorder sets the event bus with a recorder for the duration of the
+// test.
+func setEventRecorder(t *testing.T) (r *eventRecorder) {
+	t.Helper()
+
+	prev := Context.events
+	t.Cleanup(func() { Context.events = prev })
+
+	r = &eventRecorder{}
+	Context.events = aghevent.NewBus()
+	Context.events.Subscribe(r)
+
+	return r
+}
+
+func TestOnLeaseEvent(t *testing.T) {
+	rec := setEventRecorder(t)
+
+	known := &dhcpd.Lease{
+		Hostname: "known",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		IP:       netip.MustParseAddr("192.168.1.2"),
+	}
+	added := &dhcpd.Lease{
+		Hostname: "phone",
+		HWAddr:   net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		IP:       netip.MustParseAddr("192.168.1.3"),
+	}
+
+	leases := []*dhcpd.Lease{known}
+	srv := &dhcpd.MockInterface{
+		OnLeases: func(_ dhcpd.GetLeasesFlags) (ls []*dhcpd.Lease) { return leases },
+	}
+
+	w := dhcpd.NewLeaseWatcher(srv, onLeaseEvent)
+
+	leases = append(leases, added)
+	w.OnLeaseChanged(dhcpd.LeaseChangedAddedStatic)
+	require.Empty(t, rec.events)
+
+	w.OnLeaseChanged(dhcpd.LeaseChangedAdded)
+	require.Len(t, rec.events, 1)
+
+	assert.Equal(t, aghevent.TypeDHCPLeaseAdded, rec.events[0].Type)
+	assert.Equal(t, map[string]string{
+		"hostname": "phone",
+		"ip":       "192.168.1.3",
+		"mac":      "bb:bb:bb:bb:bb:bb",
+	}, rec.events[0].Data)
+
+	w.OnLeaseChanged(dhcpd.LeaseChangedAdded)
+	assert.Len(t, rec.events, 1)
+}
+
+func TestOnVersionInfo(t *testing.T) {
+	rec := setEventRecorder(t)
+
+	vi := updater.VersionInfo{
+		NewVersion:      "v100.0.0",
+		AnnouncementURL: "https://github.com/AdguardTeam/AdGuardHome/releases",
+	}
+
+	onVersionInfo(vi)
+	onVersionInfo(vi)
+	onVersionInfo(updater.VersionInfo{})
+
+	require.Len(t, rec.events, 1)
+
+	assert.Equal(t, aghevent.TypeUpdateAvailable, rec.events[0].Type)
+	assert.Equal(t, "v100.0.0", rec.events[0].Data["version"])
+}
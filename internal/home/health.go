@@ -0,0 +1,100 @@
+package home
+
+import (
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+)
+
+// Liveness and Readiness Probes
+
+// Statuses of the health checks.
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+// healthResp is the response of the health endpoints.
+type healthResp struct {
+	// Checks are the results of the individual checks of the dependencies.
+	// It's nil for the liveness probe.
+	Checks map[string]string `json:"checks,omitempty"`
+
+	// Status is [healthStatusOK] if all checks passed and [healthStatusFail]
+	// otherwise.
+	Status string `json:"status"`
+}
+
+// registerHealthHandlers registers the liveness and readiness probes.  These
+// don't require authentication and are available during the first run as
+// well, so that the container orchestrators can use them.
+func registerHealthHandlers() {
+	Context.mux.HandleFunc("/livez", ensureHealthMethod(handleLivez))
+	Context.mux.HandleFunc("/readyz", ensureHealthMethod(handleReadyz))
+}
+
+// ensureHealthMethod wraps h to only accept the GET and HEAD requests.
+func ensureHealthMethod(h http.HandlerFunc) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			aghhttp.Error(r, w, http.StatusMethodNotAllowed, "only GET and HEAD are allowed")
+
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// handleLivez is the handler for the GET /livez HTTP API.  It always responds
+// with 200 OK, since responding at all means that the process is alive.
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	_ = aghhttp.WriteJSONResponse(w, r, &healthResp{
+		Status: healthStatusOK,
+	})
+}
+
+// handleReadyz is the handler for the GET /readyz HTTP API.  It responds with
+// 200 OK once the DNS server listens and the filters have been loaded, and with
+// 503 Service Unavailable otherwise.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := &healthResp{
+		Checks: readinessChecks(),
+		Status: healthStatusOK,
+	}
+
+	code := http.StatusOK
+	for _, res := range resp.Checks {
+		if res != healthStatusOK {
+			resp.Status = healthStatusFail
+			code = http.StatusServiceUnavailable
+
+			break
+		}
+	}
+
+	_ = aghhttp.WriteJSONResponseCode(w, r, code, resp)
+}
+
+// readinessChecks returns the results of the readiness checks of the
+// dependencies by their names.
+func readinessChecks() (checks map[string]string) {
+	checks = map[string]string{
+		"dns":     healthStatusOK,
+		"filters": healthStatusOK,
+	}
+
+	if Context.firstRun {
+		checks["setup"] = "initial setup is not completed"
+	}
+
+	if !isRunning() {
+		checks["dns"] = "dns server is not listening"
+	}
+
+	if !Context.filtersLoaded.Load() {
+		checks["filters"] = "filters are not loaded yet"
+	}
+
+	return checks
+}
@@ -0,0 +1,82 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLivez(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/livez", nil)
+	w := httptest.NewRecorder()
+
+	ensureHealthMethod(handleLivez)(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp := &healthResp{}
+	err := json.NewDecoder(w.Body).Decode(resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, &healthResp{Status: healthStatusOK}, resp)
+
+	t.Run("bad_method", func(t *testing.T) {
+		r = httptest.NewRequest(http.MethodPost, "/livez", nil)
+		w = httptest.NewRecorder()
+
+		ensureHealthMethod(handleLivez)(w, r)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestHandleReadyz(t *testing.T) {
+	prevDNSServer, prevLoaded := Context.dnsServer, Context.filtersLoaded.Load()
+	t.Cleanup(func() {
+		Context.dnsServer = prevDNSServer
+		Context.filtersLoaded.Store(prevLoaded)
+	})
+
+	Context.dnsServer = nil
+
+	testCases := []struct {
+		wantChecks map[string]string
+		name       string
+		loaded     bool
+	}{{
+		wantChecks: map[string]string{
+			"dns":     "dns server is not listening",
+			"filters": "filters are not loaded yet",
+		},
+		name:   "starting",
+		loaded: false,
+	}, {
+		wantChecks: map[string]string{
+			"dns":     "dns server is not listening",
+			"filters": healthStatusOK,
+		},
+		name:   "filters_loaded",
+		loaded: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			Context.filtersLoaded.Store(tc.loaded)
+
+			r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			w := httptest.NewRecorder()
+
+			ensureHealthMethod(handleReadyz)(w, r)
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+			resp := &healthResp{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			assert.Equal(t, healthStatusFail, resp.Status)
+			assert.Equal(t, tc.wantChecks, resp.Checks)
+		})
+	}
+}
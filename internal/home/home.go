@@ -17,22 +17,34 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghsecret"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/diag"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/notify"
+	"github.com/AdguardTeam/AdGuardHome/internal/plugin"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/snmp"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/AdGuardHome/internal/systemd"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/verdictexport"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -62,6 +74,50 @@ type homeContext struct {
 	web        *Web                 // Web (HTTP, HTTPS) module
 	tls        *tlsManager          // TLS module
 
+	// queryHook overrides the filtering decisions.  It is nil if the query
+	// hook is disabled.
+	queryHook *queryhook.Hook
+
+	// plugins are the running plugins.  It is nil if there are no enabled
+	// plugins.
+	plugins *plugin.Manager
+
+	// verdictExport mirrors the query metadata to the external endpoints.  It
+	// is nil if there are no enabled endpoints.
+	verdictExport *verdictexport.Manager
+
+	// webRateLimiter limits the number of HTTP API requests from a single IP
+	// address.  It is nil if the rate limiting is disabled.
+	webRateLimiter *aghhttp.RateLimiter
+
+	// events sends the events to the webhooks and other subscribers.  It's
+	// nil before the configuration is set up.
+	events *aghevent.Bus
+
+	// webhooks sends the events to the webhooks.  It's nil if there are no
+	// enabled webhooks.
+	webhooks *webhook.Dispatcher
+
+	// notifier sends the notifications about the events.
+	notifier *notify.Notifier
+
+	// snmp is the SNMP agent.  It's nil if the agent is disabled.
+	snmp *snmp.Agent
+
+	// sync synchronizes the settings from the primary instance.
+	sync *syncer
+
+	// logWriter filters the log output using the per-module levels and
+	// formats it.
+	logWriter *aghlog.Writer
+
+	// errorLog keeps the latest error messages for the diagnostic bundles.
+	errorLog *diag.ErrorLog
+
+	// secrets encrypts and decrypts the sensitive values in the configuration
+	// file.  It is nil if no key is provided.
+	secrets *aghsecret.Box
+
 	// etcHosts contains IP-hostname mappings taken from the OS-specific hosts
 	// configuration files, for example /etc/hosts.
 	etcHosts *aghnet.HostsContainer
@@ -71,6 +127,13 @@ type homeContext struct {
 	// mux is our custom http.ServeMux.
 	mux *http.ServeMux
 
+	// dnsSocketFiles are the plain DNS sockets passed by systemd.
+	dnsSocketFiles []*os.File
+
+	// webSocketFile is the HTTP socket passed by systemd.  It is nil if there
+	// is none.
+	webSocketFile *os.File
+
 	// Runtime properties
 	// --
 
@@ -94,6 +157,10 @@ type homeContext struct {
 
 	// runningAsService flag is set to true when options are passed from the service runner
 	runningAsService bool
+
+	// filtersLoaded is true once the filtering rules have been loaded for the
+	// first time.
+	filtersLoaded atomic.Bool
 }
 
 // getDataDir returns path to the directory where we store databases and filters
@@ -101,6 +168,28 @@ func (c *homeContext) getDataDir() string {
 	return filepath.Join(c.workDir, dataDir)
 }
 
+// dataDirOr returns dir resolved against the working directory if it's
+// relative, or the data directory if dir is empty.
+func (c *homeContext) dataDirOr(dir string) (resolved string) {
+	if dir == "" {
+		return c.getDataDir()
+	} else if filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return filepath.Join(c.workDir, dir)
+}
+
+// relocatedDir returns dir, if it differs from the data directory, and an
+// empty string otherwise.  It's the opposite of [homeContext.dataDirOr].
+func (c *homeContext) relocatedDir(dir string) (configured string) {
+	if dir == c.getDataDir() {
+		return ""
+	}
+
+	return dir
+}
+
 // Context - a global context object
 var Context homeContext
 
@@ -124,8 +213,7 @@ func Main(clientBuildFS fs.FS) {
 			log.Info("Received signal %q", sig)
 			switch sig {
 			case syscall.SIGHUP:
-				Context.clients.reloadARP()
-				Context.tls.reload()
+				reloadOnSignal()
 			default:
 				cleanup(context.Background())
 				cleanupAlways()
@@ -147,6 +235,9 @@ func Main(clientBuildFS fs.FS) {
 func setupContext(opts options) {
 	setupContextFlags(opts)
 
+	err := initSecrets(opts)
+	fatalOnError(err)
+
 	Context.tlsRoots = aghtls.SystemRootCAs()
 	Context.client = &http.Client{
 		Timeout: time.Minute * 5,
@@ -163,7 +254,7 @@ func setupContext(opts options) {
 
 	if !Context.firstRun {
 		// Do the upgrade if necessary.
-		err := upgradeConfig()
+		err = upgradeConfig()
 		fatalOnError(err)
 
 		if err = parseConfig(); err != nil {
@@ -266,11 +357,11 @@ func setupHostsContainer() (err error) {
 		return fmt.Errorf("initing hosts watcher: %w", err)
 	}
 
-	Context.etcHosts, err = aghnet.NewHostsContainer(
+	Context.etcHosts, err = aghnet.NewLabeledHostsContainer(
 		filtering.SysHostsListID,
 		aghos.RootDirFS(),
 		hostsWatcher,
-		aghnet.DefaultHostsPaths()...,
+		hostsSources(config.Clients.Sources.HostsPaths)...,
 	)
 	if err != nil {
 		closeErr := hostsWatcher.Close()
@@ -295,6 +386,8 @@ func setupConfig(opts options) (err error) {
 	config.DNS.DnsfilterConf.WhitelistFilters = slices.Clone(config.WhitelistFilters)
 	config.DNS.DnsfilterConf.UserRules = slices.Clone(config.UserRules)
 	config.DNS.DnsfilterConf.HTTPClient = Context.client
+	config.DNS.DnsfilterConf.OnFilterUpdateFailed = onFilterUpdateFailed
+	config.DNS.DnsfilterConf.OnRuleRequest = onRuleRequest
 
 	config.DNS.DnsfilterConf.SafeSearchConf.CustomResolver = safeSearchResolver{}
 	config.DNS.DnsfilterConf.SafeSearch, err = safesearch.NewDefaultSafeSearch(
@@ -319,10 +412,15 @@ func setupConfig(opts options) (err error) {
 		return fmt.Errorf("initing dhcp: %w", err)
 	}
 
+	err = initEvents()
+	if err != nil {
+		return fmt.Errorf("initializing events: %w", err)
+	}
+
 	Context.updater = updater.NewUpdater(&updater.Config{
 		Client:   Context.client,
 		Version:  version.Version(),
-		Channel:  version.Channel(),
+		Channel:  config.AutoUpdate.updateChannel(),
 		GOARCH:   runtime.GOARCH,
 		GOOS:     runtime.GOOS,
 		GOARM:    version.GOARM(),
@@ -334,8 +432,11 @@ func setupConfig(opts options) (err error) {
 	var arpdb aghnet.ARPDB
 	if config.Clients.Sources.ARP {
 		arpdb = aghnet.NewARPDB()
+		Context.clients.macVendors = loadMACVendors(config.Clients.Sources.MACVendorsFile)
 	}
 
+	Context.clients.runtimeExpiry = config.Clients.Sources.RuntimeExpiry.Duration
+	Context.clients.maxRuntime = config.Clients.Sources.MaxRuntimeClients
 	Context.clients.Init(config.Clients.Persistent, Context.dhcpServer, Context.etcHosts, arpdb, config.DNS.DnsfilterConf)
 
 	if opts.bindPort != 0 {
@@ -411,6 +512,8 @@ func initWeb(opts options, clientBuildFS fs.FS) (web *Web, err error) {
 
 		clientFS: clientFS,
 
+		socketFile: Context.webSocketFile,
+
 		serveHTTP3: config.DNS.ServeHTTP3,
 	}
 
@@ -438,6 +541,7 @@ func run(opts options, clientBuildFS fs.FS) {
 
 	// configure log level and output
 	configureLogger(opts)
+	initDiagErrorLog()
 
 	// Print the first message after logger is configured.
 	log.Info(version.Full())
@@ -446,9 +550,16 @@ func run(opts options, clientBuildFS fs.FS) {
 		log.Info("AdGuard Home is running as a service")
 	}
 
+	updatePending := checkPendingUpdate()
+
+	err := initSystemdSockets()
+	if err != nil {
+		log.Error("%s", err)
+	}
+
 	setupContext(opts)
 
-	err := configureOS(config)
+	err = configureOS(config)
 	fatalOnError(err)
 
 	// clients package uses filtering package's static data (filtering.BlockedSvcKnown()),
@@ -462,6 +573,8 @@ func run(opts options, clientBuildFS fs.FS) {
 	// TODO(e.burkov):  This could be made earlier, probably as the option's
 	// effect.
 	cmdlineUpdate(opts)
+	cmdlineImportPihole(opts)
+	cmdlineLeases(opts)
 
 	if !Context.firstRun {
 		// Save the updated config
@@ -504,11 +617,22 @@ func run(opts options, clientBuildFS fs.FS) {
 		rateLimiter = newAuthRateLimiter(
 			time.Duration(config.AuthBlockMin)*time.Minute,
 			config.AuthAttempts,
+			config.HTTPRateLimit.Allowlist,
 		)
 	} else {
 		log.Info("authratelimiter is disabled")
 	}
 
+	if rlConf := config.HTTPRateLimit; rlConf.RPS > 0 {
+		Context.webRateLimiter = aghhttp.NewRateLimiter(&aghhttp.RateLimiterConfig{
+			Allowlist:     rlConf.Allowlist,
+			BlockDuration: rlConf.BlockDuration.Duration,
+			RPS:           rlConf.RPS,
+		})
+	} else {
+		log.Info("http api rate limiting is disabled")
+	}
+
 	Context.auth = InitAuth(
 		sessFilename,
 		config.Users,
@@ -520,6 +644,12 @@ func run(opts options, clientBuildFS fs.FS) {
 	}
 	config.Users = nil
 
+	if config.OIDC.Enabled {
+		Context.auth.oidc = newOIDCAuth(&config.OIDC, Context.client)
+	}
+
+	Context.sync = newSyncer(&config.Sync, Context.client)
+
 	Context.tls, err = newTLSManager(config.TLS)
 	if err != nil {
 		log.Error("initializing tls: %s", err)
@@ -543,6 +673,14 @@ func run(opts options, clientBuildFS fs.FS) {
 			}
 		}()
 
+		if config.Sync.Enabled {
+			Context.sync.start()
+		}
+
+		startAutoUpdates()
+		startDiskWatchdog()
+		startSNMP()
+
 		if Context.dhcpServer != nil {
 			err = Context.dhcpServer.Start()
 			if err != nil {
@@ -551,6 +689,13 @@ func run(opts options, clientBuildFS fs.FS) {
 		}
 	}
 
+	if updatePending {
+		go verifyUpdate()
+	}
+
+	startSystemdWatchdog()
+	notifySystemd(systemd.StateReady)
+
 	Context.web.Start()
 
 	// wait indefinitely for other go-routines to complete their job
@@ -662,7 +807,7 @@ func initWorkingDir(opts options) {
 	Context.workDir = workDir
 }
 
-// configureLogger configures logger level and output
+// configureLogger configures logger level, format, and output
 func configureLogger(opts options) {
 	ls := getLogSettings()
 
@@ -683,14 +828,19 @@ func configureLogger(opts options) {
 	ls.MaxSize = config.MaxSize
 	ls.MaxAge = config.MaxAge
 
-	// log.SetLevel(log.INFO) - default
-	if ls.Verbose {
-		log.SetLevel(log.DEBUG)
+	err := ls.validate()
+	if err != nil {
+		log.Fatalf("invalid log settings: %s", err)
 	}
 
-	// Make sure that we see the microseconds in logs, as networking stuff can
-	// happen pretty quickly.
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	if ls.Format == aghlog.FormatJSON {
+		// The time is added by the structured writer.
+		log.SetFlags(0)
+	} else {
+		// Make sure that we see the microseconds in logs, as networking stuff
+		// can happen pretty quickly.
+		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	}
 
 	if opts.runningAsService && ls.File == "" && runtime.GOOS == "windows" {
 		// When running as a Windows service, use eventlog by default if nothing
@@ -698,7 +848,15 @@ func configureLogger(opts options) {
 		ls.File = configSyslog
 	}
 
-	// logs are written to stdout (default)
+	setLogOutput(ls)
+
+	Context.logWriter = aghlog.NewWriter(log.Writer(), ls.Format, ls.defaultLevel(), ls.Levels)
+	log.SetOutput(Context.logWriter)
+}
+
+// setLogOutput sets the output of the log to the file or syslog from ls.  The
+// logs are written to stdout by default.
+func setLogOutput(ls logSettings) {
 	if ls.File == "" {
 		return
 	}
@@ -730,6 +888,8 @@ func configureLogger(opts options) {
 func cleanup(ctx context.Context) {
 	log.Info("stopping AdGuard Home")
 
+	notifySystemd(systemd.StateStopping)
+
 	if Context.web != nil {
 		Context.web.Close(ctx)
 		Context.web = nil
@@ -739,6 +899,10 @@ func cleanup(ctx context.Context) {
 		Context.auth = nil
 	}
 
+	if Context.sync != nil {
+		Context.sync.stop()
+	}
+
 	err := stopDNSServer()
 	if err != nil {
 		log.Error("stopping dns server: %s", err)
@@ -757,6 +921,27 @@ func cleanup(ctx context.Context) {
 		}
 	}
 
+	if Context.webhooks != nil {
+		err = Context.webhooks.Close()
+		if err != nil {
+			log.Error("closing webhooks: %s", err)
+		}
+	}
+
+	if Context.notifier != nil {
+		err = Context.notifier.Close()
+		if err != nil {
+			log.Error("closing notifier: %s", err)
+		}
+	}
+
+	if Context.snmp != nil {
+		err = Context.snmp.Close()
+		if err != nil {
+			log.Error("closing snmp agent: %s", err)
+		}
+	}
+
 	if Context.tls != nil {
 		Context.tls = nil
 	}
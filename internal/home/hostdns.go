@@ -0,0 +1,88 @@
+package home
+
+import (
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// Host DNS Configuration
+
+// hostDNSMarker marks the resolver settings of the host OS made by AdGuard
+// Home, so that only those are reverted.
+const hostDNSMarker = "Added by AdGuard Home"
+
+// hostDNS configures the resolver of the host OS to use AdGuard Home.  See the
+// OS-specific files for the implementations of its configure and revert
+// methods.
+type hostDNS struct {
+	// runCmd runs the external commands.  It's here for testing purposes.
+	runCmd func(cmd string, args ...string) (code int, out []byte, err error)
+
+	// root is the path to the root directory, which is prepended to the paths
+	// of the system files.  It's here for testing purposes.
+	root string
+}
+
+// newHostDNS returns a new *hostDNS for the host OS.
+func newHostDNS() (h *hostDNS) {
+	return &hostDNS{
+		runCmd: aghos.RunCommand,
+		root:   "/",
+	}
+}
+
+// hostDNSAddr returns the address of the DNS server the host OS should use,
+// which is the first address the DNS server listens on or localhost if it's
+// an unspecified one.
+func hostDNSAddr(bindHosts []netip.Addr, port int) (addr netip.AddrPort) {
+	ip := netutil.IPv4Localhost()
+	if len(bindHosts) > 0 {
+		switch h := bindHosts[0]; {
+		case h == netip.IPv6Unspecified():
+			ip = netutil.IPv6Localhost()
+		case !h.IsUnspecified():
+			ip = h
+		default:
+			// Go on.
+		}
+	}
+
+	return netip.AddrPortFrom(ip, uint16(port))
+}
+
+// configureHostDNS configures the host OS to use the DNS server of AdGuard
+// Home according to the configuration file, if there is one.  The errors are
+// logged, since the service is already installed.
+func configureHostDNS() {
+	if !detectFirstRun() {
+		err := parseConfig()
+		if err != nil {
+			log.Error("host dns: parsing configuration file: %s", err)
+
+			return
+		}
+	}
+
+	addr := hostDNSAddr(config.DNS.BindHosts, config.DNS.Port)
+	err := newHostDNS().configure(addr)
+	if err != nil {
+		log.Error("host dns: configuring: %s", err)
+
+		return
+	}
+
+	log.Printf("host dns: the os is configured to use %s", addr)
+}
+
+// revertHostDNS reverts the changes made to the resolver settings of the host
+// OS by configureHostDNS, if any.  The errors are logged, since the service is
+// already uninstalled.
+func revertHostDNS() {
+	err := newHostDNS().revert()
+	if err != nil {
+		log.Error("host dns: reverting: %s", err)
+	}
+}
@@ -0,0 +1,195 @@
+//go:build linux
+
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Paths to the resolver settings relative to the root directory.
+const (
+	hostResolvedDropInDir   = "etc/systemd/resolved.conf.d"
+	hostResolvedDropInName  = "adguardhome.conf"
+	hostResolvedResolvConf  = "run/systemd/resolve/resolv.conf"
+	hostResolvConfPath      = "etc/resolv.conf"
+	hostResolvConfBackupExt = ".adguardhome-backup"
+)
+
+// path returns the absolute path of the system file at the path relative to
+// the root directory.
+func (h *hostDNS) path(rel string) (p string) {
+	return filepath.Join(h.root, filepath.FromSlash(rel))
+}
+
+// configure makes the host use the DNS server at addr.  If systemd-resolved is
+// active, configure adds a drop-in file with addr as the DNS server, disables
+// its stub listener, which occupies the port 53, and points /etc/resolv.conf to
+// the non-stub configuration file.  Otherwise, it replaces /etc/resolv.conf.
+// The original /etc/resolv.conf is kept as a backup.
+func (h *hostDNS) configure(addr netip.AddrPort) (err error) {
+	if h.isResolvedActive() {
+		return h.configureResolved(addr)
+	}
+
+	if addr.Port() != 53 {
+		return fmt.Errorf("resolv.conf: port %d is not supported", addr.Port())
+	}
+
+	err = h.backupResolvConf()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	data := fmt.Sprintf("# %s.\nnameserver %s\n", hostDNSMarker, addr.Addr())
+	err = os.WriteFile(h.path(hostResolvConfPath), []byte(data), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing resolv.conf: %w", err)
+	}
+
+	return nil
+}
+
+// configureResolved configures systemd-resolved to use the DNS server at addr.
+func (h *hostDNS) configureResolved(addr netip.AddrPort) (err error) {
+	dnsAddr := addr.String()
+	if addr.Port() == 53 {
+		dnsAddr = addr.Addr().String()
+	}
+
+	dir := h.path(hostResolvedDropInDir)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating resolved drop-in dir: %w", err)
+	}
+
+	data := fmt.Sprintf("# %s.\n[Resolve]\nDNS=%s\nDNSStubListener=no\n", hostDNSMarker, dnsAddr)
+	err = os.WriteFile(filepath.Join(dir, hostResolvedDropInName), []byte(data), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing resolved drop-in: %w", err)
+	}
+
+	err = h.backupResolvConf()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	err = os.Symlink(filepath.Join("/", hostResolvedResolvConf), h.path(hostResolvConfPath))
+	if err != nil {
+		return fmt.Errorf("linking resolv.conf: %w", err)
+	}
+
+	return h.restartResolved()
+}
+
+// backupResolvConf moves /etc/resolv.conf to the backup file unless there is
+// one already, which means that the current file has been written by AdGuard
+// Home.
+func (h *hostDNS) backupResolvConf() (err error) {
+	p := h.path(hostResolvConfPath)
+	backup := p + hostResolvConfBackupExt
+
+	_, err = os.Lstat(backup)
+	if err == nil {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing resolv.conf: %w", err)
+		}
+
+		return nil
+	}
+
+	err = os.Rename(p, backup)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("backing up resolv.conf: %w", err)
+	}
+
+	return nil
+}
+
+// revert removes the systemd-resolved drop-in file and restores the original
+// /etc/resolv.conf, if they have been changed by configure.
+func (h *hostDNS) revert() (err error) {
+	dropIn := filepath.Join(h.path(hostResolvedDropInDir), hostResolvedDropInName)
+	hadDropIn, err := h.removeDropIn(dropIn)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	p := h.path(hostResolvConfPath)
+	backup := p + hostResolvConfBackupExt
+	_, err = os.Lstat(backup)
+	if err == nil {
+		err = os.Rename(backup, p)
+		if err != nil {
+			return fmt.Errorf("restoring resolv.conf: %w", err)
+		}
+
+		log.Printf("host dns: restored %s", p)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking resolv.conf backup: %w", err)
+	}
+
+	if hadDropIn {
+		return h.restartResolved()
+	}
+
+	return nil
+}
+
+// removeDropIn removes the systemd-resolved drop-in file at p if it's been
+// written by AdGuard Home.  ok is true if the file has been removed.
+func (h *hostDNS) removeDropIn(p string) (ok bool, err error) {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("reading resolved drop-in: %w", err)
+	}
+
+	if !bytes.Contains(data, []byte(hostDNSMarker)) {
+		log.Info("host dns: %s hasn't been written by adguard home, leaving it as is", p)
+
+		return false, nil
+	}
+
+	err = os.Remove(p)
+	if err != nil {
+		return false, fmt.Errorf("removing resolved drop-in: %w", err)
+	}
+
+	return true, nil
+}
+
+// isResolvedActive returns true if systemd-resolved is running.
+func (h *hostDNS) isResolvedActive() (ok bool) {
+	code, _, err := h.runCmd("systemctl", "is-active", "--quiet", "systemd-resolved")
+
+	return err == nil && code == 0
+}
+
+// restartResolved restarts systemd-resolved to apply the changes.
+func (h *hostDNS) restartResolved() (err error) {
+	code, out, err := h.runCmd("systemctl", "restart", "systemd-resolved")
+	if err != nil {
+		return fmt.Errorf("restarting systemd-resolved: %w", err)
+	} else if code != 0 {
+		return fmt.Errorf(
+			"restarting systemd-resolved: code %d: %s",
+			code,
+			strings.TrimSpace(string(out)),
+		)
+	}
+
+	return nil
+}
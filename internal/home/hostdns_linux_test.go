@@ -0,0 +1,125 @@
+//go:build linux
+
+package home
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHostDNS returns a *hostDNS with a temporary root directory containing
+// /etc/resolv.conf with origData.  resolved defines if systemd-resolved is
+// active.  The commands run are appended to cmds.
+func newTestHostDNS(
+	t *testing.T,
+	origData string,
+	resolved bool,
+	cmds *[]string,
+) (h *hostDNS) {
+	t.Helper()
+
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "etc"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, "etc", "resolv.conf"), []byte(origData), 0o644)
+	require.NoError(t, err)
+
+	return &hostDNS{
+		runCmd: func(cmd string, args ...string) (code int, out []byte, err error) {
+			*cmds = append(*cmds, cmd+" "+strings.Join(args, " "))
+			if args[0] == "is-active" && !resolved {
+				return 3, nil, nil
+			}
+
+			return 0, nil, nil
+		},
+		root: root,
+	}
+}
+
+func TestHostDNS_resolvConf(t *testing.T) {
+	const origData = "nameserver 192.168.1.1\n"
+
+	var cmds []string
+	h := newTestHostDNS(t, origData, false, &cmds)
+	resolvConf := filepath.Join(h.root, "etc", "resolv.conf")
+
+	err := h.configure(netip.MustParseAddrPort("127.0.0.1:53"))
+	require.NoError(t, err)
+
+	// Configure twice to make sure that the backup isn't overwritten.
+	err = h.configure(netip.MustParseAddrPort("127.0.0.1:53"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(resolvConf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "# Added by AdGuard Home.\nnameserver 127.0.0.1\n", string(data))
+
+	err = h.revert()
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(resolvConf)
+	require.NoError(t, err)
+
+	assert.Equal(t, origData, string(data))
+	assert.NoFileExists(t, resolvConf+hostResolvConfBackupExt)
+
+	err = h.configure(netip.MustParseAddrPort("127.0.0.1:5353"))
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{
+		"systemctl is-active --quiet systemd-resolved",
+		"systemctl is-active --quiet systemd-resolved",
+		"systemctl is-active --quiet systemd-resolved",
+	}, cmds)
+}
+
+func TestHostDNS_resolved(t *testing.T) {
+	const origData = "nameserver 127.0.0.53\n"
+
+	var cmds []string
+	h := newTestHostDNS(t, origData, true, &cmds)
+	resolvConf := filepath.Join(h.root, "etc", "resolv.conf")
+	dropIn := filepath.Join(h.root, "etc", "systemd", "resolved.conf.d", "adguardhome.conf")
+
+	err := h.configure(netip.MustParseAddrPort("127.0.0.1:5353"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(dropIn)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		"# Added by AdGuard Home.\n[Resolve]\nDNS=127.0.0.1:5353\nDNSStubListener=no\n",
+		string(data),
+	)
+
+	target, err := os.Readlink(resolvConf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/run/systemd/resolve/resolv.conf", target)
+
+	err = h.revert()
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, dropIn)
+
+	data, err = os.ReadFile(resolvConf)
+	require.NoError(t, err)
+
+	assert.Equal(t, origData, string(data))
+
+	assert.Equal(t, []string{
+		"systemctl is-active --quiet systemd-resolved",
+		"systemctl restart systemd-resolved",
+		"systemctl restart systemd-resolved",
+	}, cmds)
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || windows)
+
+package home
+
+import (
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+)
+
+// configure returns an error, since the configuration of the resolver isn't
+// supported on this OS yet.
+func (h *hostDNS) configure(_ netip.AddrPort) (err error) {
+	return aghos.Unsupported("host dns configuration")
+}
+
+// revert does nothing, since configure never changes anything on this OS.
+func (h *hostDNS) revert() (err error) {
+	return nil
+}
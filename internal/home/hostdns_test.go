@@ -0,0 +1,43 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostDNSAddr(t *testing.T) {
+	testCases := []struct {
+		want      netip.AddrPort
+		name      string
+		bindHosts []netip.Addr
+		port      int
+	}{{
+		want:      netip.MustParseAddrPort("127.0.0.1:53"),
+		name:      "empty",
+		bindHosts: nil,
+		port:      53,
+	}, {
+		want:      netip.MustParseAddrPort("127.0.0.1:5353"),
+		name:      "unspecified_v4",
+		bindHosts: []netip.Addr{netip.IPv4Unspecified()},
+		port:      5353,
+	}, {
+		want:      netip.MustParseAddrPort("[::1]:53"),
+		name:      "unspecified_v6",
+		bindHosts: []netip.Addr{netip.IPv6Unspecified()},
+		port:      53,
+	}, {
+		want:      netip.MustParseAddrPort("192.168.1.1:53"),
+		name:      "specified",
+		bindHosts: []netip.Addr{netip.MustParseAddr("192.168.1.1"), netip.IPv4Unspecified()},
+		port:      53,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, hostDNSAddr(tc.bindHosts, tc.port))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+//go:build windows
+
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// nrptRemoveScript is the PowerShell script removing the NRPT rules added by
+// AdGuard Home.
+var nrptRemoveScript = fmt.Sprintf(
+	"Get-DnsClientNrptRule | Where-Object { $_.Comment -eq '%s' } | Remove-DnsClientNrptRule -Force",
+	hostDNSMarker,
+)
+
+// configure makes the host use the DNS server at addr for all domains by adding
+// a Name Resolution Policy Table rule for the root namespace.
+func (h *hostDNS) configure(addr netip.AddrPort) (err error) {
+	if addr.Port() != 53 {
+		return fmt.Errorf("nrpt: port %d is not supported", addr.Port())
+	}
+
+	// Remove the previous rules, if any, so that they aren't duplicated.
+	err = h.revert()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	return h.powerShell(fmt.Sprintf(
+		"Add-DnsClientNrptRule -Namespace '.' -NameServers '%s' -Comment '%s'",
+		addr.Addr(),
+		hostDNSMarker,
+	))
+}
+
+// revert removes the Name Resolution Policy Table rules added by configure.
+func (h *hostDNS) revert() (err error) {
+	return h.powerShell(nrptRemoveScript)
+}
+
+// powerShell runs the PowerShell command cmd.
+func (h *hostDNS) powerShell(cmd string) (err error) {
+	code, out, err := h.runCmd("powershell", "-NoProfile", "-NonInteractive", "-Command", cmd)
+	if err != nil {
+		return fmt.Errorf("running powershell: %w", err)
+	} else if code != 0 {
+		return fmt.Errorf("running powershell: code %d: %s", code, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package home
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Additional Hosts Files
+
+// hostsPathConfig is the configuration of an additional hosts-format file or
+// directory to watch, for example the one managed by a container runtime.
+type hostsPathConfig struct {
+	// Path is the absolute path to the file or directory.
+	Path string `yaml:"path"`
+
+	// Label is the label of the runtime clients and the hosts read from Path.
+	// If it's empty, Path is used.
+	Label string `yaml:"label"`
+}
+
+// validateHostsPaths returns an error if the additional hosts paths aren't
+// valid.
+func validateHostsPaths(confs []*hostsPathConfig) (err error) {
+	uc := aghalg.UniqChecker[string]{}
+	for i, c := range confs {
+		if c == nil {
+			return fmt.Errorf("at index %d: %w", i, errors.Error("no value"))
+		} else if !filepath.IsAbs(c.Path) {
+			return fmt.Errorf("at index %d: path %q is not absolute", i, c.Path)
+		}
+
+		uc.Add(filepath.Clean(c.Path))
+	}
+
+	err = uc.Validate()
+	if err != nil {
+		return fmt.Errorf("paths: %w", err)
+	}
+
+	return nil
+}
+
+// hostsSources returns the sources of the hosts database: the system one
+// followed by the additional ones from confs with the same labels merged.
+func hostsSources(confs []*hostsPathConfig) (srcs []*aghnet.HostsSource) {
+	srcs = []*aghnet.HostsSource{{
+		Paths: aghnet.DefaultHostsPaths(),
+	}}
+
+	byLabel := map[string]*aghnet.HostsSource{}
+	for _, c := range confs {
+		label := c.Label
+		if label == "" {
+			label = c.Path
+		}
+
+		src, ok := byLabel[label]
+		if !ok {
+			src = &aghnet.HostsSource{Label: label}
+			byLabel[label] = src
+			srcs = append(srcs, src)
+		}
+
+		src.Paths = append(src.Paths, hostsFSPath(c.Path))
+	}
+
+	return srcs
+}
+
+// hostsFSPath converts the absolute path p into the path within the file
+// system returned by [aghos.RootDirFS].
+func hostsFSPath(p string) (fsPath string) {
+	p = strings.TrimPrefix(filepath.Clean(p), filepath.VolumeName(p))
+
+	return strings.TrimPrefix(filepath.ToSlash(p), "/")
+}
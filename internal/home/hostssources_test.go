@@ -0,0 +1,101 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostsSources(t *testing.T) {
+	srcs := hostsSources([]*hostsPathConfig{{
+		Path:  "/var/lib/containers/web/hosts",
+		Label: "containers",
+	}, {
+		Path:  "/etc/hosts.d",
+		Label: "",
+	}, {
+		Path:  "/var/lib/containers/db/hosts",
+		Label: "containers",
+	}})
+
+	require.Len(t, srcs, 3)
+
+	assert.Equal(t, &aghnet.HostsSource{Paths: aghnet.DefaultHostsPaths()}, srcs[0])
+	assert.Equal(t, &aghnet.HostsSource{
+		Label: "containers",
+		Paths: []string{"var/lib/containers/web/hosts", "var/lib/containers/db/hosts"},
+	}, srcs[1])
+	assert.Equal(t, &aghnet.HostsSource{
+		Label: "/etc/hosts.d",
+		Paths: []string{"etc/hosts.d"},
+	}, srcs[2])
+}
+
+func TestValidateHostsPaths(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*hostsPathConfig
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		confs:      nil,
+	}, {
+		name:       "relative",
+		wantErrMsg: `at index 0: path "hosts" is not absolute`,
+		confs:      []*hostsPathConfig{{Path: "hosts"}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "at index 0: no value",
+		confs:      []*hostsPathConfig{nil},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateHostsPaths(tc.confs))
+		})
+	}
+}
+
+func TestClients_addFromHostsFile(t *testing.T) {
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	sysIP, labeledIP := netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("1.1.1.2")
+
+	ok := clients.AddHost(labeledIP, "rdns-host", ClientSourceRDNS)
+	require.True(t, ok)
+
+	clients.addFromHostsFile(aghnet.HostsRecords{
+		sysIP: {
+			Aliases:   stringutil.NewSet(),
+			Canonical: "router",
+		},
+		labeledIP: {
+			Aliases:   stringutil.NewSet(),
+			Canonical: "web",
+			Source:    "containers",
+		},
+	})
+
+	rc := clients.ipToRC[sysIP]
+	require.NotNil(t, rc)
+
+	assert.Equal(t, "router", rc.Host)
+	assert.Equal(t, ClientSourceHostsFile, rc.Source)
+	assert.Empty(t, rc.SourceLabel)
+
+	rc = clients.ipToRC[labeledIP]
+	require.NotNil(t, rc)
+
+	assert.Equal(t, "web", rc.Host)
+	assert.Equal(t, ClientSourceHostsFile, rc.Source)
+	assert.Equal(t, "containers", rc.SourceLabel)
+}
@@ -0,0 +1,312 @@
+package home
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+)
+
+// dnsmasq Import
+
+// dnsmasqImportReqBodySzLim is the maximum size of a dnsmasq configuration to
+// import.
+const dnsmasqImportReqBodySzLim = 16 * 1024 * 1024
+
+// defaultDNSMasqSubnetMask is the subnet mask used when the DHCP range of the
+// imported configuration doesn't specify one.
+var defaultDNSMasqSubnetMask = netip.AddrFrom4([4]byte{255, 255, 255, 0})
+
+// dnsmasqImport is the AdGuard Home configuration converted from a dnsmasq
+// configuration.
+type dnsmasqImport struct {
+	// DHCP is the configuration of the DHCPv4 server.  It's nil if the
+	// configuration has no DHCP range.
+	DHCP *dhcpd.V4ServerConf
+
+	// Interface is the network interface for the DHCP server.
+	Interface string
+
+	// Upstreams are the upstream servers in AdGuard Home's format.
+	Upstreams []string
+
+	// Rewrites are the DNS rewrites converted from the addresses.
+	Rewrites []*filtering.LegacyRewrite
+
+	// Rules are the blocking rules converted from the blocked addresses and
+	// the local domains.
+	Rules []string
+
+	// Leases are the static DHCP leases.
+	Leases []*dhcpd.Lease
+
+	// Skipped are the descriptions of the entries, which couldn't be
+	// converted.
+	Skipped []string
+}
+
+// dnsmasqImportResp is the response to the POST /control/import/dnsmasq HTTP
+// API.
+type dnsmasqImportResp struct {
+	Skipped   []string `json:"skipped"`
+	Upstreams int      `json:"upstreams"`
+	Rewrites  int      `json:"rewrites"`
+	Rules     int      `json:"rules"`
+	Leases    int      `json:"leases"`
+	DHCP      bool     `json:"dhcp"`
+}
+
+// newDNSMasqImport converts c into the AdGuard Home configuration.
+func newDNSMasqImport(c *dnsmasq.Config) (imp *dnsmasqImport) {
+	imp = &dnsmasqImport{
+		Interface: c.Interface,
+		Upstreams: slices.Clone(c.Upstreams),
+		Skipped:   slices.Clone(c.Skipped),
+	}
+
+	if imp.Skipped == nil {
+		imp.Skipped = []string{}
+	}
+
+	for _, a := range c.Addresses {
+		for _, d := range a.Domains {
+			if a.Blocked() {
+				imp.Rules = append(imp.Rules, "||"+d+"^")
+
+				continue
+			}
+
+			imp.addRewrite(d, a.IP.String())
+			imp.addRewrite("*."+d, a.IP.String())
+		}
+	}
+
+	// The queries for the local domains are never forwarded, so answer with
+	// NXDOMAIN unless there is a rewrite, a hosts file record, or a DHCP
+	// lease for the name, since those take precedence over the rules.
+	for _, d := range c.LocalDomains {
+		imp.Rules = append(imp.Rules, "||"+d+"^$dnsrewrite=NXDOMAIN")
+	}
+
+	imp.setDHCP(c)
+
+	for _, l := range c.StaticLeases {
+		imp.Leases = append(imp.Leases, &dhcpd.Lease{
+			Hostname: l.Hostname,
+			HWAddr:   l.HWAddr,
+			IP:       l.IP,
+		})
+	}
+
+	return imp
+}
+
+// addRewrite adds a DNS rewrite unless there is the same one already.
+func (imp *dnsmasqImport) addRewrite(domain, answer string) {
+	domain = strings.ToLower(domain)
+	for _, rw := range imp.Rewrites {
+		if rw.Domain == domain && rw.Answer == answer {
+			return
+		}
+	}
+
+	imp.Rewrites = append(imp.Rewrites, &filtering.LegacyRewrite{
+		Domain: domain,
+		Answer: answer,
+	})
+}
+
+// setDHCP converts the DHCP range and the router of c into the DHCPv4 server
+// configuration.
+func (imp *dnsmasqImport) setDHCP(c *dnsmasq.Config) {
+	r := c.DHCPRange
+	if r == nil {
+		return
+	} else if !c.Router.IsValid() {
+		imp.skip("dhcp-range: no router set with dhcp-option")
+
+		return
+	}
+
+	imp.DHCP = &dhcpd.V4ServerConf{
+		GatewayIP:  c.Router,
+		SubnetMask: r.SubnetMask,
+		RangeStart: r.Start,
+		RangeEnd:   r.End,
+	}
+
+	if !r.SubnetMask.IsValid() {
+		imp.DHCP.SubnetMask = defaultDNSMasqSubnetMask
+	}
+
+	switch {
+	case r.LeaseDuration < 0:
+		imp.DHCP.LeaseDuration = math.MaxUint32
+	case r.LeaseDuration > 0:
+		imp.DHCP.LeaseDuration = uint32(r.LeaseDuration.Seconds())
+	default:
+		// Use the default lease duration.
+	}
+}
+
+// skip records the entry, which couldn't be converted.
+func (imp *dnsmasqImport) skip(format string, args ...any) {
+	imp.Skipped = append(imp.Skipped, fmt.Sprintf(format, args...))
+}
+
+// apply adds the imported configuration to the running AdGuard Home.  The
+// upstreams are added to the existing ones.  The existing rules, rewrites for
+// the same domains, and static leases are kept.  The DHCP server is only
+// configured if it's disabled.
+func (imp *dnsmasqImport) apply() (resp *dnsmasqImportResp, err error) {
+	resp = &dnsmasqImportResp{}
+
+	resp.Upstreams, err = imp.addUpstreams()
+	if err != nil {
+		return nil, fmt.Errorf("adding upstreams: %w", err)
+	}
+
+	fconf := &filtering.Config{}
+	Context.filters.WriteDiskConfig(fconf)
+
+	rules := mergeSyncStrings(fconf.UserRules, imp.Rules, syncPolicyMerge)
+	if resp.Rules = len(rules) - len(fconf.UserRules); resp.Rules > 0 {
+		Context.filters.SetUserRules(rules)
+	}
+
+	rws, changed := mergeSyncRewrites(fconf.Rewrites, imp.Rewrites, syncPolicyMerge)
+	if changed {
+		resp.Rewrites = len(rws) - len(fconf.Rewrites)
+		err = Context.filters.SetRewrites(rws)
+		if err != nil {
+			return nil, fmt.Errorf("setting rewrites: %w", err)
+		}
+	}
+
+	resp.DHCP = imp.configureDHCP()
+	resp.Leases = imp.addLeases()
+	resp.Skipped = imp.Skipped
+
+	onConfigModified()
+
+	return resp, nil
+}
+
+// addUpstreams adds the imported upstreams, which aren't used yet, and
+// reconfigures the DNS server.
+func (imp *dnsmasqImport) addUpstreams() (added int, err error) {
+	if len(imp.Upstreams) == 0 {
+		return 0, nil
+	}
+
+	err = dnsforward.ValidateUpstreams(imp.Upstreams)
+	if err != nil {
+		return 0, err
+	}
+
+	// Make sure the configuration reflects the current state of the DNS
+	// server.
+	err = config.write()
+	if err != nil {
+		return 0, err
+	}
+
+	func() {
+		config.Lock()
+		defer config.Unlock()
+
+		prev := config.DNS.UpstreamDNS
+		config.DNS.UpstreamDNS = mergeSyncStrings(prev, imp.Upstreams, syncPolicyMerge)
+		added = len(config.DNS.UpstreamDNS) - len(prev)
+	}()
+
+	if added == 0 {
+		return 0, nil
+	}
+
+	return added, reconfigureDNSServer()
+}
+
+// configureDHCP enables the DHCP server with the imported configuration, if
+// any, unless it's already enabled.
+func (imp *dnsmasqImport) configureDHCP() (ok bool) {
+	if imp.DHCP == nil {
+		return false
+	}
+
+	switch {
+	case Context.dhcpServer == nil:
+		imp.skip("dhcp-range: dhcp server is not initialized")
+	case Context.dhcpServer.Enabled():
+		imp.skip("dhcp-range: dhcp server is already enabled")
+	case imp.Interface == "":
+		imp.skip("dhcp-range: no interface set with interface")
+	default:
+		err := Context.dhcpServer.ConfigureV4(imp.Interface, imp.DHCP)
+		if err == nil {
+			return true
+		}
+
+		imp.skip("dhcp-range: %s", err)
+	}
+
+	return false
+}
+
+// addLeases adds the imported static leases and returns their number.
+func (imp *dnsmasqImport) addLeases() (added int) {
+	if Context.dhcpServer == nil {
+		return 0
+	}
+
+	for _, l := range imp.Leases {
+		err := Context.dhcpServer.AddStaticLease(l)
+		if err != nil {
+			imp.skip("dhcp-host %s: %s", l.HWAddr, err)
+
+			continue
+		}
+
+		added++
+	}
+
+	return added
+}
+
+// handleImportDNSMasq is the handler for the POST /control/import/dnsmasq HTTP
+// API.  The request body is a dnsmasq configuration file.
+func handleImportDNSMasq(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, dnsmasqImportReqBodySzLim)
+	c, err := dnsmasq.Parse(body)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	resp, err := newDNSMasqImport(c).apply()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "importing: %s", err)
+
+		return
+	}
+
+	log.Info(
+		"dnsmasq: imported %d upstreams, %d rewrites, %d rules, and %d static leases",
+		resp.Upstreams,
+		resp.Rewrites,
+		resp.Rules,
+		resp.Leases,
+	)
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
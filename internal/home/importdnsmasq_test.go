@@ -0,0 +1,62 @@
+package home
+
+import (
+	"math"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDNSMasqImport(t *testing.T) {
+	const conf = `interface=eth0
+server=/lan/192.168.1.1
+local=/home/
+address=/router.lan/192.168.1.1
+address=/ads.example/
+dhcp-range=192.168.1.50,192.168.1.150,infinite
+dhcp-option=3,192.168.1.1
+dhcp-host=aa:bb:cc:dd:ee:ff,192.168.1.10,nas
+`
+
+	c, err := dnsmasq.Parse(strings.NewReader(conf))
+	require.NoError(t, err)
+
+	imp := newDNSMasqImport(c)
+
+	assert.Equal(t, "eth0", imp.Interface)
+	assert.Equal(t, []string{"[/lan/]192.168.1.1"}, imp.Upstreams)
+	assert.Equal(t, []*filtering.LegacyRewrite{{
+		Domain: "router.lan",
+		Answer: "192.168.1.1",
+	}, {
+		Domain: "*.router.lan",
+		Answer: "192.168.1.1",
+	}}, imp.Rewrites)
+	assert.Equal(t, []string{
+		"||ads.example^",
+		"||home^$dnsrewrite=NXDOMAIN",
+	}, imp.Rules)
+
+	assert.Equal(t, &dhcpd.V4ServerConf{
+		GatewayIP:     netip.MustParseAddr("192.168.1.1"),
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		RangeStart:    netip.MustParseAddr("192.168.1.50"),
+		RangeEnd:      netip.MustParseAddr("192.168.1.150"),
+		LeaseDuration: math.MaxUint32,
+	}, imp.DHCP)
+
+	assert.Equal(t, []*dhcpd.Lease{{
+		Hostname: "nas",
+		HWAddr:   net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		IP:       netip.MustParseAddr("192.168.1.10"),
+	}}, imp.Leases)
+
+	assert.Empty(t, imp.Skipped)
+}
@@ -0,0 +1,386 @@
+package home
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"golang.org/x/exp/slices"
+)
+
+// Pi-hole Import
+
+// piholeImportReqBodySzLim is the maximum size of a Teleporter archive to
+// import.
+const piholeImportReqBodySzLim = 64 * 1024 * 1024
+
+// piholeImport is the AdGuard Home configuration converted from a Pi-hole
+// Teleporter backup.
+type piholeImport struct {
+	// Filters are the block lists converted from the enabled adlists.
+	Filters []filtering.FilterYAML
+
+	// Rules are the user's filtering rules converted from the enabled
+	// allowlist and denylist entries.
+	Rules []string
+
+	// Rewrites are the DNS rewrites converted from the custom DNS and CNAME
+	// records.
+	Rewrites []*filtering.LegacyRewrite
+
+	// Clients are the persistent clients converted from the configured
+	// clients.
+	Clients []*Client
+
+	// Skipped are the descriptions of the entries, which couldn't be
+	// converted.
+	Skipped []string
+}
+
+// piholeImportResp is the response to the POST /control/import/pihole HTTP
+// API.
+type piholeImportResp struct {
+	Skipped  []string `json:"skipped"`
+	Filters  int      `json:"filters"`
+	Rules    int      `json:"rules"`
+	Rewrites int      `json:"rewrites"`
+	Clients  int      `json:"clients"`
+}
+
+// newPiholeImport converts b into the AdGuard Home configuration.
+func newPiholeImport(b *pihole.Backup) (imp *piholeImport) {
+	imp = &piholeImport{
+		Skipped: []string{},
+	}
+
+	// Only the enabled groups are applied by Pi-hole.  Its default group has
+	// the ID 0 and is always present.
+	enabledGroups := map[int]bool{0: true}
+	groupNames := map[int]string{0: "Default"}
+	for _, g := range b.Groups {
+		enabledGroups[g.ID] = bool(g.Enabled)
+		groupNames[g.ID] = g.Name
+	}
+
+	// filteredGroups are the enabled groups with enabled adlists.
+	filteredGroups := map[int]bool{}
+	for _, a := range b.Adlists {
+		if !a.Enabled {
+			continue
+		}
+
+		for _, id := range a.GroupIDs {
+			filteredGroups[id] = filteredGroups[id] || enabledGroups[id]
+		}
+
+		imp.addFilter(a)
+	}
+
+	for _, d := range b.Domains {
+		if d.Enabled {
+			imp.addRule(d)
+		}
+	}
+
+	imp.addRewrites(b)
+
+	names := stringutil.NewSet()
+	for _, c := range b.Clients {
+		imp.addClient(c, names, filteredGroups, groupNames)
+	}
+
+	return imp
+}
+
+// addFilter converts a into a block list.
+func (imp *piholeImport) addFilter(a *pihole.Adlist) {
+	if !strings.HasPrefix(a.Address, "http://") && !strings.HasPrefix(a.Address, "https://") {
+		imp.skip("adlist %q: only http and https urls are supported", a.Address)
+
+		return
+	}
+
+	name := a.Comment
+	if name == "" {
+		name = a.Address
+	}
+
+	imp.Filters = append(imp.Filters, filtering.FilterYAML{
+		Enabled: true,
+		URL:     a.Address,
+		Name:    name,
+	})
+}
+
+// addRule converts d into a filtering rule.
+func (imp *piholeImport) addRule(d *pihole.Domain) {
+	var rule string
+	switch d.Kind {
+	case pihole.DomainAllowExact:
+		rule = "@@|" + d.Domain + "^"
+	case pihole.DomainDenyExact:
+		rule = "|" + d.Domain + "^"
+	case pihole.DomainAllowRegex:
+		rule = "@@/" + d.Domain + "/"
+	case pihole.DomainDenyRegex:
+		rule = "/" + d.Domain + "/"
+	default:
+		imp.skip("domain %q: unknown type %d", d.Domain, d.Kind)
+
+		return
+	}
+
+	imp.Rules = append(imp.Rules, rule)
+}
+
+// addRewrites converts the custom DNS and CNAME records of b into DNS
+// rewrites.
+func (imp *piholeImport) addRewrites(b *pihole.Backup) {
+	for _, h := range b.Hosts {
+		err := netutil.ValidateDomainName(h.Domain)
+		if err != nil {
+			imp.skip("custom dns record %q: %s", h.Domain, err)
+
+			continue
+		}
+
+		imp.Rewrites = append(imp.Rewrites, &filtering.LegacyRewrite{
+			Domain: h.Domain,
+			Answer: h.IP,
+		})
+	}
+
+	for _, c := range b.CNAMEs {
+		err := netutil.ValidateDomainName(c.Domain)
+		if err != nil {
+			imp.skip("cname record %q: %s", c.Domain, err)
+
+			continue
+		}
+
+		imp.Rewrites = append(imp.Rewrites, &filtering.LegacyRewrite{
+			Domain: c.Domain,
+			Answer: c.Target,
+		})
+	}
+}
+
+// addClient converts c into a persistent client.  names are the names of the
+// clients already added.  The client uses the global settings, unless none of
+// its groups have block lists, in which case its filtering is disabled.
+func (imp *piholeImport) addClient(
+	c *pihole.Client,
+	names *stringutil.Set,
+	filteredGroups map[int]bool,
+	groupNames map[int]string,
+) {
+	id, err := normalizeClientIdentifier(c.IP)
+	if err != nil {
+		imp.skip("client %q: %s", c.IP, err)
+
+		return
+	}
+
+	name := c.Comment
+	if name == "" || names.Has(name) {
+		name = id
+	}
+
+	names.Add(name)
+
+	filtered := false
+	var groups []string
+	for _, gid := range c.GroupIDs {
+		filtered = filtered || filteredGroups[gid]
+		if gid != 0 {
+			groups = append(groups, groupNames[gid])
+		}
+	}
+
+	if len(groups) > 0 {
+		imp.skip("client %q: groups %q aren't supported, global block lists are used", name, groups)
+	}
+
+	imp.Clients = append(imp.Clients, &Client{
+		Name:             name,
+		IDs:              []string{id},
+		UseOwnSettings:   !filtered,
+		FilteringEnabled: filtered,
+	})
+}
+
+// skip records the entry, which couldn't be converted.
+func (imp *piholeImport) skip(format string, args ...any) {
+	imp.Skipped = append(imp.Skipped, fmt.Sprintf(format, args...))
+}
+
+// apply adds the imported configuration to the running AdGuard Home.  The
+// existing block lists, rules, rewrites for the same domains, and clients with
+// the same names are kept.
+func (imp *piholeImport) apply() (resp *piholeImportResp, err error) {
+	fconf := &filtering.Config{}
+	Context.filters.WriteDiskConfig(fconf)
+
+	resp = &piholeImportResp{
+		Filters: Context.filters.AddFilters(imp.Filters),
+	}
+
+	rules := mergeSyncStrings(fconf.UserRules, imp.Rules, syncPolicyMerge)
+	if resp.Rules = len(rules) - len(fconf.UserRules); resp.Rules > 0 {
+		Context.filters.SetUserRules(rules)
+	}
+
+	rws, changed := mergeSyncRewrites(fconf.Rewrites, imp.Rewrites, syncPolicyMerge)
+	if changed {
+		resp.Rewrites = len(rws) - len(fconf.Rewrites)
+		err = Context.filters.SetRewrites(rws)
+		if err != nil {
+			return nil, fmt.Errorf("setting rewrites: %w", err)
+		}
+	}
+
+	resp.Clients = imp.addClients()
+	resp.Skipped = imp.Skipped
+
+	onConfigModified()
+
+	return resp, nil
+}
+
+// applyToConfig adds the imported configuration to the configuration, which
+// hasn't been applied yet.  It's used when importing from the command line.
+func (imp *piholeImport) applyToConfig() (resp *piholeImportResp) {
+	resp = &piholeImportResp{}
+	for _, f := range imp.Filters {
+		if !slices.ContainsFunc(config.Filters, func(c filtering.FilterYAML) bool { return c.URL == f.URL }) {
+			config.Filters = append(config.Filters, f)
+			resp.Filters++
+		}
+	}
+
+	rules := mergeSyncStrings(config.UserRules, imp.Rules, syncPolicyMerge)
+	resp.Rules = len(rules) - len(config.UserRules)
+	config.UserRules = rules
+
+	fconf := config.DNS.DnsfilterConf
+	rws, _ := mergeSyncRewrites(fconf.Rewrites, imp.Rewrites, syncPolicyMerge)
+	resp.Rewrites = len(rws) - len(fconf.Rewrites)
+	fconf.Rewrites = rws
+
+	resp.Clients = imp.addClients()
+	resp.Skipped = imp.Skipped
+
+	return resp
+}
+
+// addClients adds the imported clients, which don't conflict with the existing
+// ones, and returns their number.
+func (imp *piholeImport) addClients() (added int) {
+	for _, c := range imp.Clients {
+		ok, err := Context.clients.Add(c)
+		if err != nil {
+			imp.skip("client %q: %s", c.Name, err)
+		} else if !ok {
+			imp.skip("client %q: already exists", c.Name)
+		} else {
+			added++
+		}
+	}
+
+	return added
+}
+
+// readPiholeImport reads and converts the Teleporter backup from r.
+func readPiholeImport(r io.Reader) (imp *piholeImport, err error) {
+	b, err := pihole.ReadTeleporter(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading teleporter backup: %w", err)
+	}
+
+	return newPiholeImport(b), nil
+}
+
+// handleImportPihole is the handler for the POST /control/import/pihole HTTP
+// API.  The request body is a Pi-hole Teleporter archive.
+func handleImportPihole(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, piholeImportReqBodySzLim)
+	imp, err := readPiholeImport(body)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	resp, err := imp.apply()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "importing: %s", err)
+
+		return
+	}
+
+	log.Info(
+		"pihole: imported %d filters, %d rules, %d rewrites, and %d clients",
+		resp.Filters,
+		resp.Rules,
+		resp.Rewrites,
+		resp.Clients,
+	)
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// registerImportHandlers registers the HTTP handlers for the import APIs.
+func registerImportHandlers() {
+	httpRegister(http.MethodPost, "/control/import/dnsmasq", handleImportDNSMasq)
+	httpRegister(http.MethodPost, "/control/import/pihole", handleImportPihole)
+}
+
+// cmdlineImportPihole imports the Pi-hole Teleporter backup into the
+// configuration file and exits, if requested.
+func cmdlineImportPihole(opts options) {
+	if opts.piholeImportFile == "" {
+		return
+	} else if Context.firstRun {
+		log.Fatal("pihole: finish the initial configuration before importing")
+	}
+
+	imp, err := func() (imp *piholeImport, err error) {
+		f, err := os.Open(opts.piholeImportFile)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+		return readPiholeImport(f)
+	}()
+	if err != nil {
+		log.Fatalf("pihole: %s", err)
+	}
+
+	resp := imp.applyToConfig()
+	for _, s := range resp.Skipped {
+		log.Info("pihole: skipped %s", s)
+	}
+
+	err = config.write()
+	fatalOnError(err)
+
+	log.Info(
+		"pihole: imported %d filters, %d rules, %d rewrites, and %d clients",
+		resp.Filters,
+		resp.Rules,
+		resp.Rewrites,
+		resp.Clients,
+	)
+
+	os.Exit(0)
+}
@@ -0,0 +1,128 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPiholeImport(t *testing.T) {
+	b := &pihole.Backup{
+		Adlists: []*pihole.Adlist{{
+			Address:  "https://example.com/hosts",
+			Comment:  "Example",
+			GroupIDs: []int{0},
+			ID:       1,
+			Enabled:  true,
+		}, {
+			Address:  "https://example.net/kids",
+			GroupIDs: []int{1},
+			ID:       2,
+			Enabled:  true,
+		}, {
+			Address:  "file:///etc/pihole/list.txt",
+			GroupIDs: []int{0},
+			ID:       3,
+			Enabled:  true,
+		}, {
+			Address: "https://example.org/disabled",
+			ID:      4,
+			Enabled: false,
+		}},
+		Domains: []*pihole.Domain{{
+			Domain:  "allowed.example",
+			Kind:    pihole.DomainAllowExact,
+			Enabled: true,
+		}, {
+			Domain:  "blocked.example",
+			Kind:    pihole.DomainDenyExact,
+			Enabled: true,
+		}, {
+			Domain:  `^ads\.`,
+			Kind:    pihole.DomainDenyRegex,
+			Enabled: true,
+		}, {
+			Domain:  "disabled.example",
+			Kind:    pihole.DomainDenyExact,
+			Enabled: false,
+		}},
+		Groups: []*pihole.Group{{
+			Name:    "Kids",
+			ID:      1,
+			Enabled: true,
+		}, {
+			Name:    "Unfiltered",
+			ID:      2,
+			Enabled: true,
+		}},
+		Clients: []*pihole.Client{{
+			IP:       "192.168.1.5",
+			Comment:  "Laptop",
+			GroupIDs: []int{0},
+		}, {
+			IP:       "AA:BB:CC:DD:EE:FF",
+			Comment:  "Tablet",
+			GroupIDs: []int{1},
+		}, {
+			IP:       "192.168.1.0/24",
+			GroupIDs: []int{2},
+		}, {
+			IP: ":eth0",
+		}},
+		Hosts: []*pihole.HostRecord{{
+			IP:     "192.168.1.2",
+			Domain: "nas.lan",
+		}, {
+			IP:     "192.168.1.3",
+			Domain: "bad_domain!",
+		}},
+		CNAMEs: []*pihole.CNAMERecord{{
+			Domain: "files.lan",
+			Target: "nas.lan",
+		}},
+	}
+
+	imp := newPiholeImport(b)
+
+	assert.Equal(t, []filtering.FilterYAML{{
+		Enabled: true,
+		URL:     "https://example.com/hosts",
+		Name:    "Example",
+	}, {
+		Enabled: true,
+		URL:     "https://example.net/kids",
+		Name:    "https://example.net/kids",
+	}}, imp.Filters)
+
+	assert.Equal(t, []string{
+		"@@|allowed.example^",
+		"|blocked.example^",
+		`/^ads\./`,
+	}, imp.Rules)
+
+	assert.Equal(t, []*filtering.LegacyRewrite{{
+		Domain: "nas.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "files.lan",
+		Answer: "nas.lan",
+	}}, imp.Rewrites)
+
+	assert.Equal(t, []*Client{{
+		Name:             "Laptop",
+		IDs:              []string{"192.168.1.5"},
+		FilteringEnabled: true,
+	}, {
+		Name:             "Tablet",
+		IDs:              []string{"aa:bb:cc:dd:ee:ff"},
+		FilteringEnabled: true,
+	}, {
+		Name:           "192.168.1.0/24",
+		IDs:            []string{"192.168.1.0/24"},
+		UseOwnSettings: true,
+	}}, imp.Clients)
+
+	assert.Len(t, imp.Skipped, 5)
+}
@@ -0,0 +1,248 @@
+package home
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// Initial Configuration Import
+
+// installImportReq is the configuration of other DNS servers imported during
+// the initial configuration.
+type installImportReq struct {
+	// Hosts is the contents of a hosts file, for example /etc/hosts or
+	// Pi-hole's custom.list.  Its records are imported as DNS rewrites.
+	Hosts string `json:"hosts"`
+
+	// Dnsmasq is the contents of a dnsmasq configuration file.  Its server
+	// directives are imported as upstreams and its address and local
+	// directives are imported as DNS rewrites and blocking rules.
+	Dnsmasq string `json:"dnsmasq"`
+}
+
+// installImportRewrite is a DNS rewrite produced by the import.
+type installImportRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// installImportResult is the configuration produced by the import.
+type installImportResult struct {
+	// Upstreams are the upstream servers in AdGuard Home's format.
+	Upstreams []string `json:"upstreams"`
+
+	// Rewrites are the DNS rewrites.
+	Rewrites []*installImportRewrite `json:"rewrites"`
+
+	// Rules are the user's filtering rules.
+	Rules []string `json:"rules"`
+
+	// Skipped are the lines, which couldn't be imported, prefixed with their
+	// source and line number.
+	Skipped []string `json:"skipped"`
+}
+
+// importConfig converts the configuration of other DNS servers into AdGuard
+// Home's one.  The result is never nil.
+func (req *installImportReq) importConfig() (res *installImportResult) {
+	res = &installImportResult{
+		Upstreams: []string{},
+		Rewrites:  []*installImportRewrite{},
+		Rules:     []string{},
+		Skipped:   []string{},
+	}
+
+	if req == nil {
+		return res
+	}
+
+	res.importHosts(req.Hosts)
+	res.importDNSMasq(req.Dnsmasq)
+
+	return res
+}
+
+// importHosts imports the records of the hosts file data as DNS rewrites.
+func (res *installImportResult) importHosts(data string) {
+	s := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		err := res.importHostsLine(line)
+		if err != nil {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("hosts: line %d: %s", n, err))
+		}
+	}
+}
+
+// importHostsLine imports a single hosts file record as DNS rewrites.
+func (res *installImportResult) importHostsLine(line string) (err error) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("%q: no hostnames", line)
+	}
+
+	ip, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return fmt.Errorf("%q: %w", line, err)
+	}
+
+	for _, host := range fields[1:] {
+		err = netutil.ValidateDomainName(host)
+		if err != nil {
+			return fmt.Errorf("%q: %w", line, err)
+		}
+	}
+
+	for _, host := range fields[1:] {
+		res.addRewrite(host, ip.String())
+	}
+
+	return nil
+}
+
+// importDNSMasq imports the DNS settings from the dnsmasq configuration data.
+// The DHCP settings are configured separately during the initial
+// configuration.
+func (res *installImportResult) importDNSMasq(data string) {
+	c, err := dnsmasq.Parse(strings.NewReader(data))
+	if err != nil {
+		// Shouldn't happen, since reading from a string doesn't fail.
+		res.Skipped = append(res.Skipped, fmt.Sprintf("dnsmasq: %s", err))
+
+		return
+	}
+
+	imp := newDNSMasqImport(c)
+	if imp.DHCP != nil || len(imp.Leases) > 0 {
+		imp.skip("dhcp settings aren't imported during the initial configuration")
+	}
+
+	res.Upstreams = append(res.Upstreams, imp.Upstreams...)
+	res.Rules = append(res.Rules, imp.Rules...)
+	for _, rw := range imp.Rewrites {
+		res.addRewrite(rw.Domain, rw.Answer)
+	}
+
+	for _, sk := range imp.Skipped {
+		res.Skipped = append(res.Skipped, "dnsmasq: "+sk)
+	}
+}
+
+// addRewrite adds a DNS rewrite unless there is the same one already.
+func (res *installImportResult) addRewrite(domain, answer string) {
+	domain = strings.ToLower(domain)
+	for _, rw := range res.Rewrites {
+		if rw.Domain == domain && rw.Answer == answer {
+			return
+		}
+	}
+
+	res.Rewrites = append(res.Rewrites, &installImportRewrite{
+		Domain: domain,
+		Answer: answer,
+	})
+}
+
+// apply adds the imported configuration to conf.  The upstreams replace the
+// existing ones, if any have been imported.
+func (res *installImportResult) apply(conf *configuration) {
+	if len(res.Upstreams) > 0 {
+		conf.DNS.UpstreamDNS = res.Upstreams
+	}
+
+	fconf := conf.DNS.DnsfilterConf
+	for _, rw := range res.Rewrites {
+		fconf.Rewrites = append(fconf.Rewrites, &filtering.LegacyRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	rules := stringutil.NewSet(fconf.UserRules...)
+	for _, r := range res.Rules {
+		if !rules.Has(r) {
+			rules.Add(r)
+			fconf.UserRules = append(fconf.UserRules, r)
+		}
+	}
+}
+
+// handleInstallCheckImport is the handler for the POST
+// /control/install/check_import HTTP API.  It shows how the configuration of
+// other DNS servers will be imported.
+func (web *Web) handleInstallCheckImport(w http.ResponseWriter, r *http.Request) {
+	req := &installImportReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing request: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, req.importConfig())
+}
+
+// installTestUpstreamsReq is the request for the POST
+// /control/install/test_upstreams HTTP API.
+type installTestUpstreamsReq struct {
+	Upstreams    []string `json:"upstream_dns"`
+	BootstrapDNS []string `json:"bootstrap_dns"`
+}
+
+// handleInstallTestUpstreams is the handler for the POST
+// /control/install/test_upstreams HTTP API.  It responds with the map of
+// upstreams to "OK" or the error message.
+func (web *Web) handleInstallTestUpstreams(w http.ResponseWriter, r *http.Request) {
+	req := &installTestUpstreamsReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing request: %s", err)
+
+		return
+	}
+
+	type checkResult struct {
+		ups string
+		res string
+	}
+
+	resCh := make(chan checkResult, len(req.Upstreams))
+	for _, ups := range req.Upstreams {
+		go func(ups string) {
+			res := "OK"
+			checkErr := dnsforward.CheckUpstream(ups, req.BootstrapDNS, dnsforward.DefaultTimeout)
+			if checkErr != nil {
+				res = checkErr.Error()
+			}
+
+			resCh <- checkResult{ups: ups, res: res}
+		}(ups)
+	}
+
+	results := make(map[string]string, len(req.Upstreams))
+	for range req.Upstreams {
+		cr := <-resCh
+		results[cr.ups] = cr.res
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, results)
+}
@@ -0,0 +1,121 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallImportReq_importConfig(t *testing.T) {
+	testCases := []struct {
+		req  *installImportReq
+		want *installImportResult
+		name string
+	}{{
+		req:  nil,
+		want: &installImportResult{},
+		name: "nil",
+	}, {
+		req: &installImportReq{
+			Hosts: "# Comment.\n" +
+				"127.0.0.1 localhost\n" +
+				"192.168.1.2 nas nas.lan # The NAS.\n" +
+				"::1 localhost\n" +
+				"192.168.1.3\n" +
+				"bad.ip host\n",
+		},
+		want: &installImportResult{
+			Rewrites: []*installImportRewrite{
+				{Domain: "localhost", Answer: "127.0.0.1"},
+				{Domain: "nas", Answer: "192.168.1.2"},
+				{Domain: "nas.lan", Answer: "192.168.1.2"},
+				{Domain: "localhost", Answer: "::1"},
+			},
+			Skipped: []string{
+				`hosts: line 5: "192.168.1.3": no hostnames`,
+				`hosts: line 6: "bad.ip host": ParseAddr("bad.ip"): unexpected character (at "bad.ip")`,
+			},
+		},
+		name: "hosts",
+	}, {
+		req: &installImportReq{
+			Dnsmasq: "no-resolv\n" +
+				"server=1.1.1.1\n" +
+				"server=8.8.8.8#5353\n" +
+				"server=/lan/home.arpa/192.168.1.1\n" +
+				"server=2001:db8::1@eth0\n" +
+				"server=/local/\n" +
+				"dhcp-range=192.168.1.50,192.168.1.150\n" +
+				"address=/router.lan/192.168.1.1\n" +
+				"address=/ads.example/\n" +
+				"address=/tracker.example/0.0.0.0\n" +
+				"address=/#/127.0.0.1\n",
+		},
+		want: &installImportResult{
+			Upstreams: []string{
+				"1.1.1.1",
+				"8.8.8.8:5353",
+				"[/lan/home.arpa/]192.168.1.1",
+				"2001:db8::1",
+			},
+			Rewrites: []*installImportRewrite{
+				{Domain: "router.lan", Answer: "192.168.1.1"},
+				{Domain: "*.router.lan", Answer: "192.168.1.1"},
+			},
+			Rules: []string{
+				"||ads.example^",
+				"||tracker.example^",
+				"||local^$dnsrewrite=NXDOMAIN",
+			},
+			Skipped: []string{
+				`dnsmasq: line 1: "no-resolv": unsupported directive "no-resolv"`,
+				`dnsmasq: line 11: "address=/#/127.0.0.1": wildcard domains are not supported`,
+				"dnsmasq: dhcp-range: no router set with dhcp-option",
+			},
+		},
+		name: "dnsmasq",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := tc.req.importConfig()
+			require.NotNil(t, res)
+
+			assert.ElementsMatch(t, tc.want.Upstreams, res.Upstreams)
+			assert.ElementsMatch(t, tc.want.Rewrites, res.Rewrites)
+			assert.ElementsMatch(t, tc.want.Rules, res.Rules)
+			assert.ElementsMatch(t, tc.want.Skipped, res.Skipped)
+		})
+	}
+}
+
+func TestInstallImportResult_apply(t *testing.T) {
+	conf := &configuration{
+		DNS: dnsConfig{
+			DnsfilterConf: &filtering.Config{
+				UserRules: []string{"||ads.example^"},
+			},
+		},
+	}
+	conf.DNS.UpstreamDNS = []string{"9.9.9.9"}
+
+	res := &installImportResult{
+		Rewrites: []*installImportRewrite{{Domain: "nas", Answer: "192.168.1.2"}},
+		Rules:    []string{"||ads.example^", "||tracker.example^"},
+	}
+
+	res.apply(conf)
+	assert.Equal(t, []string{"9.9.9.9"}, conf.DNS.UpstreamDNS)
+	assert.Equal(t, []string{"||ads.example^", "||tracker.example^"}, conf.DNS.DnsfilterConf.UserRules)
+
+	require.Len(t, conf.DNS.DnsfilterConf.Rewrites, 1)
+
+	assert.Equal(t, "nas", conf.DNS.DnsfilterConf.Rewrites[0].Domain)
+	assert.Equal(t, "192.168.1.2", conf.DNS.DnsfilterConf.Rewrites[0].Answer)
+
+	res.Upstreams = []string{"1.1.1.1"}
+	res.apply(conf)
+	assert.Equal(t, []string{"1.1.1.1"}, conf.DNS.UpstreamDNS)
+}
@@ -0,0 +1,142 @@
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// IP Address Families
+
+// dnsBindHosts returns the addresses the DNS server listens on according to
+// dnsConf.  In the IPv6-only mode, the default is the IPv6 loopback address and
+// the unspecified IPv4 address is replaced with the unspecified IPv6 one.
+func dnsBindHosts(dnsConf *dnsConfig) (hosts []netip.Addr) {
+	if !dnsConf.IPv6Only {
+		if len(dnsConf.BindHosts) == 0 {
+			return []netip.Addr{netutil.IPv4Localhost()}
+		}
+
+		return dnsConf.BindHosts
+	}
+
+	if len(dnsConf.BindHosts) == 0 {
+		return []netip.Addr{netutil.IPv6Localhost()}
+	}
+
+	hosts = make([]netip.Addr, 0, len(dnsConf.BindHosts))
+	for _, h := range dnsConf.BindHosts {
+		if h == netip.IPv4Unspecified() {
+			h = netip.IPv6Unspecified()
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts
+}
+
+// warnAddrFamilies logs the warnings about the address families configured
+// for the DNS server, but unavailable on the machine.
+func warnAddrFamilies(dnsConf *dnsConfig) {
+	ifaceAddrs, err := aghnet.CollectAllIfacesAddrs()
+	if err != nil {
+		log.Debug("dns: checking address families: %s", err)
+
+		return
+	}
+
+	addrs := make([]netip.Addr, 0, len(ifaceAddrs))
+	for _, a := range ifaceAddrs {
+		var addr netip.Addr
+		addr, err = netip.ParseAddr(a)
+		if err == nil {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+
+	for _, w := range addrFamilyWarnings(dnsConf, addrs) {
+		log.Info("warning: dns: %s", w)
+	}
+}
+
+// addrFamilyWarnings returns the warnings about the address families
+// configured in dnsConf, which are unavailable among the interface addresses
+// ifaceAddrs or contradict the IPv6-only mode.
+func addrFamilyWarnings(dnsConf *dnsConfig, ifaceAddrs []netip.Addr) (warns []string) {
+	var has4, has6, hasGlobal4, hasGlobal6 bool
+	for _, a := range ifaceAddrs {
+		if a.Is4() {
+			has4, hasGlobal4 = true, hasGlobal4 || a.IsGlobalUnicast()
+		} else {
+			has6, hasGlobal6 = true, hasGlobal6 || a.IsGlobalUnicast()
+		}
+	}
+
+	for _, h := range dnsBindHosts(dnsConf) {
+		switch {
+		case h.Is4() && dnsConf.IPv6Only:
+			warns = append(warns, fmt.Sprintf("bind_hosts: %s is ipv4, but ipv6_only is set", h))
+		case h.Is4() && !has4:
+			warns = append(warns, fmt.Sprintf("bind_hosts: %s is ipv4, but ipv4 is unavailable", h))
+		case h.Is6() && !has6:
+			warns = append(warns, fmt.Sprintf("bind_hosts: %s is ipv6, but ipv6 is unavailable", h))
+		}
+	}
+
+	prefer := dnsConf.UpstreamPreferFamily
+	if (prefer == dnsforward.AddrFamilyIPv6 || dnsConf.IPv6Only) && !hasGlobal6 {
+		warns = append(warns, "ipv6 upstream addresses are preferred, but no global ipv6 address")
+	} else if prefer == dnsforward.AddrFamilyIPv4 && !hasGlobal4 {
+		warns = append(warns, "ipv4 upstream addresses are preferred, but no global ipv4 address")
+	}
+
+	if !dnsConf.IPv6Only {
+		return warns
+	}
+
+	for _, u := range dnsConf.UpstreamDNS {
+		if isIPv4Upstream(u) {
+			warns = append(warns, fmt.Sprintf("upstream_dns: %q is ipv4, but ipv6_only is set", u))
+		}
+	}
+
+	for _, b := range dnsConf.BootstrapDNS {
+		if isIPv4Upstream(b) {
+			warns = append(warns, fmt.Sprintf("bootstrap_dns: %q is ipv4, but ipv6_only is set", b))
+		}
+	}
+
+	return warns
+}
+
+// isIPv4Upstream returns true if the upstream line has an IPv4 address as its
+// host.
+func isIPv4Upstream(line string) (ok bool) {
+	addr := line
+	if strings.HasPrefix(line, "[/") {
+		_, addr, _ = strings.Cut(line, "/]")
+	}
+
+	host := addr
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return false
+		}
+
+		host = u.Hostname()
+	} else if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap.Addr().Unmap().Is4()
+	}
+
+	ip, err := netip.ParseAddr(host)
+
+	return err == nil && ip.Unmap().Is4()
+}
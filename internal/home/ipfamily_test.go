@@ -0,0 +1,119 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSBindHosts(t *testing.T) {
+	ip4 := netip.MustParseAddr("192.168.1.1")
+
+	testCases := []struct {
+		name string
+		conf *dnsConfig
+		want []netip.Addr
+	}{{
+		name: "default",
+		conf: &dnsConfig{},
+		want: []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+	}, {
+		name: "default_ipv6_only",
+		conf: &dnsConfig{
+			FilteringConfig: dnsforward.FilteringConfig{IPv6Only: true},
+		},
+		want: []netip.Addr{netip.IPv6Loopback()},
+	}, {
+		name: "unspecified_ipv6_only",
+		conf: &dnsConfig{
+			BindHosts:       []netip.Addr{netip.IPv4Unspecified(), ip4},
+			FilteringConfig: dnsforward.FilteringConfig{IPv6Only: true},
+		},
+		want: []netip.Addr{netip.IPv6Unspecified(), ip4},
+	}, {
+		name: "unspecified",
+		conf: &dnsConfig{
+			BindHosts: []netip.Addr{netip.IPv4Unspecified()},
+		},
+		want: []netip.Addr{netip.IPv4Unspecified()},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, dnsBindHosts(tc.conf))
+		})
+	}
+}
+
+func TestAddrFamilyWarnings(t *testing.T) {
+	dualStack := []netip.Addr{
+		netip.MustParseAddr("127.0.0.1"),
+		netip.MustParseAddr("192.0.2.1"),
+		netip.IPv6Loopback(),
+		netip.MustParseAddr("2001:db8::1"),
+	}
+
+	ipv6Only := []netip.Addr{
+		netip.IPv6Loopback(),
+		netip.MustParseAddr("2001:db8::1"),
+	}
+
+	testCases := []struct {
+		name  string
+		conf  *dnsConfig
+		addrs []netip.Addr
+		want  []string
+	}{{
+		name: "dual_stack",
+		conf: &dnsConfig{
+			BindHosts: []netip.Addr{netip.IPv4Unspecified()},
+			FilteringConfig: dnsforward.FilteringConfig{
+				UpstreamPreferFamily: dnsforward.AddrFamilyIPv6,
+			},
+		},
+		addrs: dualStack,
+		want:  nil,
+	}, {
+		name: "no_ipv4",
+		conf: &dnsConfig{
+			BindHosts: []netip.Addr{netip.IPv4Unspecified()},
+			FilteringConfig: dnsforward.FilteringConfig{
+				UpstreamPreferFamily: dnsforward.AddrFamilyIPv4,
+			},
+		},
+		addrs: ipv6Only,
+		want: []string{
+			"bind_hosts: 0.0.0.0 is ipv4, but ipv4 is unavailable",
+			"ipv4 upstream addresses are preferred, but no global ipv4 address",
+		},
+	}, {
+		name: "ipv6_only",
+		conf: &dnsConfig{
+			BindHosts: []netip.Addr{netip.IPv4Unspecified(), netip.MustParseAddr("192.0.2.1")},
+			FilteringConfig: dnsforward.FilteringConfig{
+				UpstreamDNS: []string{
+					"[/example.org/]192.0.2.53",
+					"tls://[2001:db8::53]",
+					"https://192.0.2.53:443/dns-query",
+				},
+				BootstrapDNS: []string{"192.0.2.53:53", "2001:db8::53"},
+				IPv6Only:     true,
+			},
+		},
+		addrs: ipv6Only,
+		want: []string{
+			"bind_hosts: 192.0.2.1 is ipv4, but ipv6_only is set",
+			`upstream_dns: "[/example.org/]192.0.2.53" is ipv4, but ipv6_only is set`,
+			`upstream_dns: "https://192.0.2.53:443/dns-query" is ipv4, but ipv6_only is set`,
+			`bootstrap_dns: "192.0.2.53:53" is ipv4, but ipv6_only is set`,
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, addrFamilyWarnings(tc.conf, tc.addrs))
+		})
+	}
+}
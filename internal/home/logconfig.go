@@ -0,0 +1,97 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Log Settings
+
+// logConfigJSON is the object for the log settings HTTP APIs.
+type logConfigJSON struct {
+	// Levels are the log levels of the modules that differ from the default
+	// one.
+	Levels map[string]aghlog.Level `json:"levels"`
+
+	// Format is the format of the log output.  It's ignored in the requests,
+	// since changing it requires a restart.
+	Format aghlog.Format `json:"format"`
+
+	// Verbose is true if the default log level is debug.
+	Verbose bool `json:"verbose"`
+}
+
+// handleGetLogConfig is the handler for the GET /control/log/config HTTP API.
+func handleGetLogConfig(w http.ResponseWriter, r *http.Request) {
+	resp := &logConfigJSON{
+		Levels: map[string]aghlog.Level{},
+		Format: aghlog.FormatText,
+	}
+
+	if lw := Context.logWriter; lw != nil {
+		var def aghlog.Level
+		def, resp.Levels = lw.Levels()
+		resp.Verbose = def == aghlog.LevelDebug
+		if resp.Levels == nil {
+			resp.Levels = map[string]aghlog.Level{}
+		}
+	}
+
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		if config.Format != "" {
+			resp.Format = config.Format
+		}
+	}()
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handlePutLogConfig is the handler for the PUT /control/log/config/update
+// HTTP API.  The new levels are applied immediately.
+func handlePutLogConfig(w http.ResponseWriter, r *http.Request) {
+	req := &logConfigJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = aghlog.ValidateLevels(req.Levels)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "%s", err)
+
+		return
+	}
+
+	lw := Context.logWriter
+	if lw == nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "log is not configured")
+
+		return
+	}
+
+	func() {
+		config.Lock()
+		defer config.Unlock()
+
+		config.Verbose = req.Verbose
+		config.Levels = req.Levels
+		if len(config.Levels) == 0 {
+			config.Levels = nil
+		}
+
+		lw.SetLevels(config.logSettings.defaultLevel(), config.Levels)
+	}()
+
+	log.Info("log: levels updated")
+
+	onConfigModified()
+}
@@ -55,7 +55,15 @@ func limitRequestBody(h http.Handler) (limited http.Handler) {
 		var err error
 
 		var szLim int64 = defaultReqBodySzLim
-		if expectsLargerRequests(r) {
+		if r.Method == http.MethodPost && r.URL.Path == "/control/restore" {
+			szLim = restoreReqBodySzLim
+		} else if r.Method == http.MethodPost && r.URL.Path == "/control/import/pihole" {
+			szLim = piholeImportReqBodySzLim
+		} else if r.Method == http.MethodPost && r.URL.Path == "/control/import/dnsmasq" {
+			szLim = dnsmasqImportReqBodySzLim
+		} else if r.Method == http.MethodPost && r.URL.Path == "/control/dhcp/leases/import" {
+			szLim = leasesImportReqBodySzLim
+		} else if expectsLargerRequests(r) {
 			szLim = largerReqBodySzLim
 		}
 
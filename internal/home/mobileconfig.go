@@ -1,17 +1,22 @@
 package home
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/google/uuid"
 	"howett.net/plist"
 )
@@ -46,6 +51,10 @@ type dnsSettings struct {
 type payloadContent struct {
 	DNSSettings *dnsSettings
 
+	// OnDemandRules are the rules defining when the settings are applied.
+	// If empty, the settings are always applied.
+	OnDemandRules []*onDemandRule `plist:",omitempty"`
+
 	PayloadType        string
 	PayloadIdentifier  string
 	PayloadDisplayName string
@@ -54,6 +63,85 @@ type payloadContent struct {
 	PayloadVersion     int
 }
 
+// onDemandRule is a rule of the DNSSettings.OnDemandRules profile.  The first
+// matching rule is applied.
+//
+// See https://developer.apple.com/documentation/devicemanagement/dnssettings/ondemandruleselement.
+type onDemandRule struct {
+	// Action is the action to take if the rule matches.
+	Action string
+
+	// ActionParameters are the domain-based exceptions for the
+	// onDemandActionEvaluate action.
+	ActionParameters []*onDemandActionParams `plist:",omitempty"`
+
+	// SSIDMatch are the SSIDs of the Wi-Fi networks the rule matches.  If
+	// empty, the rule matches any network.
+	SSIDMatch []string `plist:",omitempty"`
+}
+
+// onDemandActionParams are the domain-based parameters of an
+// onDemandActionEvaluate rule.
+type onDemandActionParams struct {
+	// DomainAction is the action for the Domains.
+	DomainAction string
+
+	// Domains are the domains for which the DomainAction is taken.
+	Domains []string
+}
+
+// Actions of the on-demand rules.
+const (
+	onDemandActionConnect    = "Connect"
+	onDemandActionDisconnect = "Disconnect"
+	onDemandActionEvaluate   = "EvaluateConnection"
+
+	onDemandDomainActionNever = "NeverConnect"
+)
+
+// newOnDemandRules returns the on-demand rules that don't apply the settings
+// within the Wi-Fi networks with SSIDs and for the queries for domains.  It
+// returns nil if both are empty.
+func newOnDemandRules(ssids, domains []string) (rules []*onDemandRule) {
+	if len(ssids) == 0 && len(domains) == 0 {
+		return nil
+	}
+
+	if len(ssids) > 0 {
+		rules = append(rules, &onDemandRule{
+			Action:    onDemandActionDisconnect,
+			SSIDMatch: ssids,
+		})
+	}
+
+	if len(domains) == 0 {
+		return append(rules, &onDemandRule{
+			Action: onDemandActionConnect,
+		})
+	}
+
+	return append(rules, &onDemandRule{
+		Action: onDemandActionEvaluate,
+		ActionParameters: []*onDemandActionParams{{
+			DomainAction: onDemandDomainActionNever,
+			Domains:      domains,
+		}},
+	})
+}
+
+// validateExcludedDomains returns an error if any of domains is not a valid
+// domain name optionally prefixed with a "*." wildcard.
+func validateExcludedDomains(domains []string) (err error) {
+	for i, d := range domains {
+		err = netutil.ValidateDomainName(strings.TrimPrefix(d, "*."))
+		if err != nil {
+			return fmt.Errorf("excluded domain at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
 // dnsSettingsPayloadType is the payload type for a DNSSettings profile.
 const dnsSettingsPayloadType = "com.apple.dnsSettings.managed"
 
@@ -77,7 +165,11 @@ const (
 	dnsProtoTLS   = "TLS"
 )
 
-func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
+func encodeMobileConfig(
+	d *dnsSettings,
+	clientID string,
+	rules []*onDemandRule,
+) (b []byte, err error) {
 	var dspName string
 	switch proto := d.DNSProtocol; proto {
 	case dnsProtoHTTPS:
@@ -107,7 +199,8 @@ func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
 		PayloadDisplayName: dspName,
 		PayloadType:        "Configuration",
 		PayloadContent: []*payloadContent{{
-			DNSSettings: d,
+			DNSSettings:   d,
+			OnDemandRules: rules,
 
 			PayloadType:        dnsSettingsPayloadType,
 			PayloadIdentifier:  payloadID,
@@ -125,6 +218,38 @@ func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
 	return plist.MarshalIndent(data, plist.XMLFormat, "\t")
 }
 
+// signMobileConfig signs the profile b with the certificate and the key from
+// the encryption settings, so that the devices don't show it as unsigned.  ok
+// is false if the encryption isn't configured or signing failed, in which case
+// b is returned as is.
+func signMobileConfig(b []byte) (signed []byte, ok bool) {
+	if Context.tls == nil {
+		return b, false
+	}
+
+	conf := &tlsConfigSettings{}
+	Context.tls.WriteDiskConfig(conf)
+	if !conf.Enabled || len(conf.CertificateChainData) == 0 || len(conf.PrivateKeyData) == 0 {
+		return b, false
+	}
+
+	cert, err := tls.X509KeyPair(conf.CertificateChainData, conf.PrivateKeyData)
+	if err != nil {
+		log.Debug("mobileconfig: loading certificate: %s", err)
+
+		return b, false
+	}
+
+	signed, err = aghtls.SignPKCS7(b, &cert, time.Now())
+	if err != nil {
+		log.Error("mobileconfig: %s", err)
+
+		return b, false
+	}
+
+	return signed, true
+}
+
 func respondJSONError(w http.ResponseWriter, status int, msg string) {
 	w.WriteHeader(http.StatusInternalServerError)
 	err := json.NewEncoder(w).Encode(&jsonError{
@@ -158,19 +283,33 @@ func handleMobileConfig(w http.ResponseWriter, r *http.Request, dnsp string) {
 		}
 	}
 
+	domains := q["exclude_domain"]
+	err = validateExcludedDomains(domains)
+	if err != nil {
+		respondJSONError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
 	d := &dnsSettings{
 		DNSProtocol: dnsp,
 		ServerName:  host,
 	}
 
-	mobileconfig, err := encodeMobileConfig(d, clientID)
+	rules := newOnDemandRules(q["exclude_ssid"], domains)
+	mobileconfig, err := encodeMobileConfig(d, clientID, rules)
 	if err != nil {
 		respondJSONError(w, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/xml")
+	mobileconfig, signed := signMobileConfig(mobileconfig)
+	if signed {
+		w.Header().Set("Content-Type", "application/x-apple-aspen-config")
+	} else {
+		w.Header().Set("Content-Type", "application/xml")
+	}
 
 	const (
 		dohContDisp = `attachment; filename=doh.mobileconfig`
@@ -8,6 +8,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"howett.net/plist"
@@ -178,3 +179,97 @@ func TestHandleMobileConfigDoT(t *testing.T) {
 		assert.Empty(t, s.ServerURL)
 	})
 }
+
+func TestHandleMobileConfig_onDemand(t *testing.T) {
+	setupDNSIPs(t)
+
+	testCases := []struct {
+		want     []*onDemandRule
+		name     string
+		query    string
+		wantCode int
+	}{{
+		want:     nil,
+		name:     "none",
+		query:    "",
+		wantCode: http.StatusOK,
+	}, {
+		want: []*onDemandRule{{
+			Action:    onDemandActionDisconnect,
+			SSIDMatch: []string{"Home", "Home 5G"},
+		}, {
+			Action: onDemandActionConnect,
+		}},
+		name:     "ssids",
+		query:    "&exclude_ssid=Home&exclude_ssid=Home+5G",
+		wantCode: http.StatusOK,
+	}, {
+		want: []*onDemandRule{{
+			Action:    onDemandActionDisconnect,
+			SSIDMatch: []string{"Home"},
+		}, {
+			Action: onDemandActionEvaluate,
+			ActionParameters: []*onDemandActionParams{{
+				DomainAction: onDemandDomainActionNever,
+				Domains:      []string{"*.lan", "router.example"},
+			}},
+		}},
+		name:     "ssids_and_domains",
+		query:    "&exclude_ssid=Home&exclude_domain=*.lan&exclude_domain=router.example",
+		wantCode: http.StatusOK,
+	}, {
+		want:     nil,
+		name:     "bad_domain",
+		query:    "&exclude_domain=bad..domain",
+		wantCode: http.StatusInternalServerError,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := "https://example.com/apple/doh.mobileconfig?host=example.org" + tc.query
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			w := httptest.NewRecorder()
+
+			handleMobileConfigDoH(w, r)
+			require.Equal(t, tc.wantCode, w.Code)
+
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			var mc mobileConfig
+			_, err := plist.Unmarshal(w.Body.Bytes(), &mc)
+			require.NoError(t, err)
+			require.Len(t, mc.PayloadContent, 1)
+
+			assert.Equal(t, tc.want, mc.PayloadContent[0].OnDemandRules)
+		})
+	}
+}
+
+func TestHandleMobileConfig_signed(t *testing.T) {
+	setupDNSIPs(t)
+
+	Context.tls = &tlsManager{conf: tlsConfigSettings{
+		Enabled: true,
+		TLSConfig: dnsforward.TLSConfig{
+			CertificateChainData: testCertChainData,
+			PrivateKeyData:       testPrivateKeyData,
+		},
+	}}
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/apple/dot.mobileconfig?host=example.org", nil)
+	w := httptest.NewRecorder()
+
+	handleMobileConfigDoT(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, "application/x-apple-aspen-config", w.Header().Get("Content-Type"))
+
+	// The signed profile is a DER-encoded SEQUENCE containing the plist.
+	body := w.Body.Bytes()
+	require.NotEmpty(t, body)
+
+	assert.Equal(t, byte(0x30), body[0])
+	assert.True(t, bytes.Contains(body, []byte("<plist")))
+}
@@ -0,0 +1,165 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/notify"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Notifications
+
+// testNotificationTimeout is the timeout of sending the test notification.
+const testNotificationTimeout = 30 * time.Second
+
+// testNotification is the message sent by the POST /control/notifications/test
+// HTTP API.
+var testNotification = &notify.Message{
+	Title: "Test notification",
+	Text:  "This is a test notification from AdGuard Home.",
+}
+
+// initNotifier initializes the notifier with the channels from the
+// configuration and subscribes it to the event bus.
+func initNotifier() (err error) {
+	n := notify.NewNotifier(Context.client)
+	err = n.SetChannels(config.Notifications)
+	if err != nil {
+		return fmt.Errorf("setting channels: %w", err)
+	}
+
+	Context.notifier = n
+	Context.events.Subscribe(n)
+	n.Start()
+
+	log.Info("events: %d notification channels enabled", n.Len())
+
+	return nil
+}
+
+// notificationChannels is the object for the notification channels HTTP API.
+type notificationChannels struct {
+	Channels []*notify.ChannelConfig `json:"channels"`
+}
+
+// prevChannel returns the configuration of the channel named name or nil if
+// there is none.  config must be locked.
+func prevChannel(name string) (c *notify.ChannelConfig) {
+	for _, c = range config.Notifications {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// handleNotificationsList is the handler for the GET /control/notifications/list
+// HTTP API.  The passwords and tokens are omitted.
+func handleNotificationsList(w http.ResponseWriter, r *http.Request) {
+	resp := &notificationChannels{
+		Channels: []*notify.ChannelConfig{},
+	}
+
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		for _, c := range config.Notifications {
+			resp.Channels = append(resp.Channels, c.WithoutSecrets())
+		}
+	}()
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleNotificationsSet is the handler for the POST /control/notifications/set
+// HTTP API.  It replaces all the notification channels.  The empty passwords
+// and tokens of the existing channels are kept.
+func handleNotificationsSet(w http.ResponseWriter, r *http.Request) {
+	req := &notificationChannels{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		for _, c := range req.Channels {
+			c.KeepSecrets(prevChannel(c.Name))
+		}
+	}()
+
+	err = Context.notifier.SetChannels(req.Channels)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	func() {
+		config.Lock()
+		defer config.Unlock()
+
+		config.Notifications = req.Channels
+	}()
+
+	onConfigModified()
+	aghhttp.OK(w)
+}
+
+// handleNotificationsTest is the handler for the POST
+// /control/notifications/test HTTP API.  It sends the test message to the
+// channel from the request, which doesn't have to be saved or enabled.
+func handleNotificationsTest(w http.ResponseWriter, r *http.Request) {
+	c := &notify.ChannelConfig{}
+	err := json.NewDecoder(r.Body).Decode(c)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		c.KeepSecrets(prevChannel(c.Name))
+	}()
+
+	err = c.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), testNotificationTimeout)
+	defer cancel()
+
+	err = notify.NewChannel(c, Context.client).Send(ctx, testNotification)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadGateway, "sending test notification: %s", err)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
+
+// registerNotificationsHandlers registers the HTTP handlers of the
+// notifications.
+func registerNotificationsHandlers() {
+	httpRegister(http.MethodGet, "/control/notifications/list", handleNotificationsList)
+	httpRegister(http.MethodPost, "/control/notifications/set", handleNotificationsSet)
+	httpRegister(http.MethodPost, "/control/notifications/test", handleNotificationsTest)
+}
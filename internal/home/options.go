@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -30,6 +31,24 @@ type options struct {
 	// pidFile is the file name for the file to which the PID is saved.
 	pidFile string
 
+	// secretsKeyFile is the path to the file with the key used to encrypt the
+	// sensitive values in the configuration file.
+	secretsKeyFile string
+
+	// piholeImportFile is the path to the Pi-hole Teleporter backup to import
+	// into the configuration file.
+	piholeImportFile string
+
+	// leasesExportFile is the path to the file to export the DHCP leases to.
+	leasesExportFile string
+
+	// leasesImportFile is the path to the lease database to import into the
+	// DHCP server.
+	leasesImportFile string
+
+	// leasesFormat is the format of leasesExportFile and leasesImportFile.
+	leasesFormat dhcpd.LeasesFormat
+
 	// serviceControlAction is the service action to perform.  See
 	// [service.ControlAction] and [handleServiceControlAction].
 	serviceControlAction string
@@ -70,6 +89,10 @@ type options struct {
 	// localFrontend forces AdGuard Home to use the frontend files from disk
 	// rather than the ones that have been compiled into the binary.
 	localFrontend bool
+
+	// configureHostDNS, if set, makes the service installation configure the
+	// host OS to use AdGuard Home as its DNS resolver.
+	configureHostDNS bool
 }
 
 // initCmdLineOpts completes initialization of the global command-line option
@@ -208,6 +231,54 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Path to a file where PID is stored.",
 	longName:        "pidfile",
 	shortName:       "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.secretsKeyFile = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize: func(o options) (val string, ok bool) {
+		return o.secretsKeyFile, o.secretsKeyFile != ""
+	},
+	description: "Path to a file with the key used to encrypt secrets in the configuration " +
+		"file.  If empty, " + secretsPassphraseEnv + " is used.",
+	longName:  "secrets-key-file",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.piholeImportFile = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", false },
+	description:     "Import a Pi-hole Teleporter backup into the configuration file and exit.",
+	longName:        "import-pihole",
+	shortName:       "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.leasesExportFile = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", false },
+	description:     "Export the DHCP leases into a file and exit.",
+	longName:        "export-leases",
+	shortName:       "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.leasesImportFile = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", false },
+	description:     "Import a DHCP lease database into the DHCP server and exit.",
+	longName:        "import-leases",
+	shortName:       "",
+}, {
+	updateWithValue: func(o options, v string) (oo options, err error) {
+		o.leasesFormat, err = dhcpd.ParseLeasesFormat(v)
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize:     func(o options) (val string, ok bool) { return "", false },
+	description: "Format of the exported or imported DHCP leases: json (default) " +
+		"or csv, and also dnsmasq or isc for importing.",
+	longName:  "leases-format",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   func(o options) (options, error) { o.checkConfig = true; return o, nil },
@@ -282,6 +353,15 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Run in GL-Inet compatibility mode.",
 	longName:        "glinet",
 	shortName:       "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.configureHostDNS = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", false },
+	description: "Configure the OS to use AdGuard Home as its DNS resolver on service " +
+		"installation.",
+	longName:  "configure-host-dns",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   nil,
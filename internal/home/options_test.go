@@ -93,6 +93,26 @@ func TestParsePidfile(t *testing.T) {
 	assert.Equal(t, "path", testParseOK(t, "--pidfile", "path").pidFile, "--pidfile is pid file")
 }
 
+func TestParseSecretsKeyFile(t *testing.T) {
+	assert.Equal(t, "", testParseOK(t).secretsKeyFile, "empty is no key file")
+	assert.Equal(
+		t,
+		"path",
+		testParseOK(t, "--secrets-key-file", "path").secretsKeyFile,
+		"--secrets-key-file is key file",
+	)
+}
+
+func TestParseImportPihole(t *testing.T) {
+	assert.Equal(t, "", testParseOK(t).piholeImportFile, "empty is no import")
+	assert.Equal(
+		t,
+		"backup.tar.gz",
+		testParseOK(t, "--import-pihole", "backup.tar.gz").piholeImportFile,
+		"--import-pihole is import file",
+	)
+}
+
 func TestParseCheckConfig(t *testing.T) {
 	assert.False(t, testParseOK(t).checkConfig, "empty is not check config")
 	assert.True(t, testParseOK(t, "--check-config").checkConfig, "--check-config is check config")
@@ -128,6 +148,15 @@ func TestParseGLInet(t *testing.T) {
 	assert.True(t, testParseOK(t, "--glinet").glinetMode, "--glinet is GL-Inet mode")
 }
 
+func TestParseConfigureHostDNS(t *testing.T) {
+	assert.False(t, testParseOK(t).configureHostDNS, "empty is not configure host dns")
+	assert.True(
+		t,
+		testParseOK(t, "--configure-host-dns").configureHostDNS,
+		"--configure-host-dns is configure host dns",
+	)
+}
+
 func TestParseUnknown(t *testing.T) {
 	testParseErr(t, "unknown word", "x")
 	testParseErr(t, "unknown short", "-x")
@@ -170,6 +199,10 @@ func TestOptsToArgs(t *testing.T) {
 		name: "pid_file",
 		args: []string{"--pidfile", "path"},
 		opts: options{pidFile: "path"},
+	}, {
+		name: "secrets_key_file",
+		args: []string{"--secrets-key-file", "path"},
+		opts: options{secretsKeyFile: "path"},
 	}, {
 		name: "disable_update",
 		args: []string{"--no-check-update"},
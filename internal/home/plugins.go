@@ -0,0 +1,128 @@
+package home
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/plugin"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// Plugins
+
+// initPlugins launches the enabled plugins from the configuration.
+// Context.plugins is left nil if there are none.
+func initPlugins() {
+	m := plugin.NewManager(&plugin.ManagerConfig{
+		Version: version.Version(),
+		Plugins: config.Plugins,
+	})
+	if m.Len() == 0 {
+		return
+	}
+
+	m.Start()
+	Context.plugins = m
+
+	log.Info("plugins: %d plugins enabled", m.Len())
+}
+
+// queryHooks is a [dnsforward.QueryHook] which asks the hooks in order and
+// returns the first verdict overriding the decision.
+type queryHooks []dnsforward.QueryHook
+
+// type check
+var _ dnsforward.QueryHook = queryHooks(nil)
+
+// Decide implements the [dnsforward.QueryHook] interface for queryHooks.  The
+// errors of the hooks are logged and the hooks returning them are skipped.
+func (hooks queryHooks) Decide(q *queryhook.Query) (v *queryhook.Verdict, err error) {
+	for _, h := range hooks {
+		v, err = h.Decide(q)
+		if err != nil {
+			log.Debug("plugins: query hook: %s", err)
+
+			continue
+		}
+
+		if v.Action != queryhook.ActionPass {
+			return v, nil
+		}
+	}
+
+	return &queryhook.Verdict{Action: queryhook.ActionPass}, nil
+}
+
+// newQueryHook returns the query hook for the DNS server combining the query
+// hook program and the plugins.  hook is nil if there are none.
+func newQueryHook() (hook dnsforward.QueryHook) {
+	var hooks queryHooks
+	if Context.queryHook != nil {
+		hooks = append(hooks, Context.queryHook)
+	}
+
+	if Context.plugins != nil {
+		hooks = append(hooks, Context.plugins)
+	}
+
+	switch len(hooks) {
+	case 0:
+		return nil
+	case 1:
+		return hooks[0]
+	default:
+		return hooks
+	}
+}
+
+// pluginQueryLog is a [querylog.QueryLog] which also sends the entries to the
+// plugins.
+type pluginQueryLog struct {
+	querylog.QueryLog
+
+	plugins *plugin.Manager
+}
+
+// type check
+var _ querylog.QueryLog = (*pluginQueryLog)(nil)
+
+// Add implements the [querylog.QueryLog] interface for *pluginQueryLog.
+func (l *pluginQueryLog) Add(params *querylog.AddParams) {
+	l.QueryLog.Add(params)
+
+	if !l.plugins.WantsLogs() || params.Question == nil || len(params.Question.Question) == 0 {
+		return
+	}
+
+	q := params.Question.Question[0]
+	e := &plugin.LogEntry{
+		ClientIp:     params.ClientIP.String(),
+		ClientId:     params.ClientID,
+		Domain:       strings.TrimSuffix(q.Name, "."),
+		Qtype:        dns.Type(q.Qtype).String(),
+		Upstream:     params.Upstream,
+		Protocol:     string(params.ClientProto),
+		TimeUnixNano: time.Now().UnixNano(),
+		ElapsedNs:    params.Elapsed.Nanoseconds(),
+		Cached:       params.Cached,
+	}
+
+	if e.Protocol == string(querylog.ClientProtoPlain) {
+		e.Protocol = "dns"
+	}
+
+	if res := params.Result; res != nil {
+		e.Reason = res.Reason.String()
+		e.Filtered = res.IsFiltered
+		if len(res.Rules) > 0 {
+			e.Rule = res.Rules[0].Text
+		}
+	}
+
+	l.plugins.Log(e)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/log"
 )
 
@@ -40,9 +41,10 @@ func (t *Theme) UnmarshalText(b []byte) (err error) {
 // profileJSON is an object for /control/profile and /control/profile/update
 // endpoints.
 type profileJSON struct {
-	Name     string `json:"name"`
-	Language string `json:"language"`
-	Theme    Theme  `json:"theme"`
+	Name     string       `json:"name"`
+	Language string       `json:"language"`
+	Role     aghuser.Role `json:"role,omitempty"`
+	Theme    Theme        `json:"theme"`
 }
 
 // handleGetProfile is the handler for GET /control/profile endpoint.
@@ -57,6 +59,7 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		resp = profileJSON{
 			Name:     u.Name,
 			Language: config.Language,
+			Role:     u.role(),
 			Theme:    config.Theme,
 		}
 	}()
@@ -0,0 +1,121 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"golang.org/x/exp/slices"
+)
+
+// Block reasons for blockedClientJSON.
+const (
+	blockReasonLogin     = "login"
+	blockReasonRateLimit = "rate_limit"
+)
+
+// blockedClientJSON is a single client blocked either by the HTTP API rate
+// limiter or after failed login attempts.
+type blockedClientJSON struct {
+	// Until is the time when the block expires in the RFC 3339 format.
+	Until string `json:"until"`
+
+	// IP is the blocked address.
+	IP string `json:"ip"`
+
+	// Reason is either blockReasonLogin or blockReasonRateLimit.
+	Reason string `json:"reason"`
+}
+
+// blockedClientsJSON is the object for the GET /control/ratelimit/blocked HTTP
+// API.
+type blockedClientsJSON struct {
+	Blocked []*blockedClientJSON `json:"blocked"`
+}
+
+// handleGetRateLimitBlocked is the handler for the GET
+// /control/ratelimit/blocked HTTP API.
+func handleGetRateLimitBlocked(w http.ResponseWriter, r *http.Request) {
+	resp := &blockedClientsJSON{
+		Blocked: []*blockedClientJSON{},
+	}
+
+	if l := Context.auth.raleLimiter; l != nil {
+		for _, b := range l.blocked() {
+			resp.Blocked = append(resp.Blocked, &blockedClientJSON{
+				Until:  b.until.UTC().Format(time.RFC3339),
+				IP:     b.usrID,
+				Reason: blockReasonLogin,
+			})
+		}
+	}
+
+	if l := Context.webRateLimiter; l != nil {
+		for _, b := range l.Blocked() {
+			resp.Blocked = append(resp.Blocked, &blockedClientJSON{
+				Until:  b.Until.UTC().Format(time.RFC3339),
+				IP:     b.Addr.String(),
+				Reason: blockReasonRateLimit,
+			})
+		}
+	}
+
+	slices.SortStableFunc(resp.Blocked, func(a, b *blockedClientJSON) (less bool) {
+		return a.IP < b.IP
+	})
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// unblockReqJSON is the request for the POST /control/ratelimit/unblock HTTP
+// API.
+type unblockReqJSON struct {
+	// IP is the address to unblock.  If it's empty, all clients are
+	// unblocked.
+	IP string `json:"ip"`
+}
+
+// handlePostRateLimitUnblock is the handler for the POST
+// /control/ratelimit/unblock HTTP API.
+func handlePostRateLimitUnblock(w http.ResponseWriter, r *http.Request) {
+	req := &unblockReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	var ip netip.Addr
+	if req.IP != "" {
+		ip, err = netip.ParseAddr(req.IP)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "ip: %s", err)
+
+			return
+		}
+	}
+
+	if l := Context.auth.raleLimiter; l != nil {
+		if ip.IsValid() {
+			l.remove(ip.String())
+		} else {
+			l.removeAll()
+		}
+	}
+
+	if l := Context.webRateLimiter; l != nil {
+		l.Unblock(ip)
+	}
+
+	aghhttp.OK(w)
+}
+
+// registerRateLimitHandlers registers the HTTP handlers for the rate limiting
+// and login blocking management.
+func registerRateLimitHandlers() {
+	httpRegister(http.MethodGet, "/control/ratelimit/blocked", handleGetRateLimitBlocked)
+	httpRegister(http.MethodPost, "/control/ratelimit/unblock", handlePostRateLimitUnblock)
+}
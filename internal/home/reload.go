@@ -0,0 +1,455 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"golang.org/x/exp/slices"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Configuration Reload
+
+// The subsystems, which are reloaded without a restart.
+const (
+	reloadedDNS     = "dns"
+	reloadedClients = "clients"
+	reloadedFilters = "filters"
+)
+
+// reloadResult is the result of reloading the configuration file.  It's also
+// the response to the POST /control/config/reload HTTP API.
+type reloadResult struct {
+	// Reloaded are the subsystems, the settings of which have been re-read and
+	// applied.
+	Reloaded []string `json:"reloaded"`
+
+	// RestartRequired are the keys of the configuration sections, which have
+	// been changed in the file, but are only applied after a restart.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// reloadConfig re-reads the configuration file and applies the changed
+// settings of the DNS server, the persistent clients, and the filtering lists
+// and rules.  The changed settings, which require a restart, are kept in the
+// configuration file when it's written until the restart, unless they are
+// changed again via the HTTP API.
+func reloadConfig() (res *reloadResult, err error) {
+	res = &reloadResult{
+		Reloaded:        []string{},
+		RestartRequired: []string{},
+	}
+
+	if Context.dnsServer == nil {
+		// The DNS server isn't initialized yet, for example during the first
+		// run.
+		return res, nil
+	}
+
+	conf, err := readReloadConfig()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	var pending []*pendingValue
+	res.RestartRequired, pending = restartRequired(conf)
+
+	err = applyDNSConfig(&conf.DNS)
+	if err != nil {
+		return nil, fmt.Errorf("applying dns config: %w", err)
+	}
+
+	res.Reloaded = append(res.Reloaded, reloadedDNS)
+
+	if Context.clients.replaceFromConfig(conf.Clients.Persistent, conf.DNS.DnsfilterConf) {
+		res.Reloaded = append(res.Reloaded, reloadedClients)
+	}
+
+	if applyFilteringLists(conf) {
+		res.Reloaded = append(res.Reloaded, reloadedFilters)
+	}
+
+	config.Lock()
+	defer config.Unlock()
+
+	config.pending = &pendingValues{values: pending}
+
+	return res, nil
+}
+
+// readReloadConfig reads and validates the configuration file.
+func readReloadConfig() (conf *configuration, err error) {
+	data, err := os.ReadFile(config.getConfigFilename())
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conf = &configuration{
+		DNS: dnsConfig{
+			DnsfilterConf: &filtering.Config{},
+		},
+		Clients: &clientsConfig{
+			Sources: &clientSourcesConfig{},
+		},
+	}
+
+	_, err = unmarshalConfig(data, config.dropInDir(), conf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+
+	err = conf.validate()
+	if err != nil {
+		return nil, fmt.Errorf("validating config: %w", err)
+	}
+
+	return conf, nil
+}
+
+// hotDNSKeys are the keys of the dns section of the configuration file, which
+// are applied by [applyDNSConfig] without a restart.
+var hotDNSKeys = func() (keys *stringutil.Set) {
+	keys = stringutil.NewSet(
+		"upstream_timeout",
+		"private_networks",
+		"use_private_ptr_resolvers",
+		"local_ptr_upstreams",
+		"use_dns64",
+		"dns64_prefixes",
+		"use_http3_upstreams",
+	)
+	addYAMLKeys(keys, reflect.TypeOf(dnsforward.FilteringConfig{}))
+
+	return keys
+}()
+
+// hotClientsKeys are the keys of the clients section of the configuration
+// file, which are applied without a restart.
+var hotClientsKeys = stringutil.NewSet("persistent")
+
+// addYAMLKeys adds the YAML keys of the fields of the struct type t, including
+// the ones of the inlined structs, to keys.
+func addYAMLKeys(keys *stringutil.Set, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch {
+		case opts == "inline":
+			addYAMLKeys(keys, f.Type)
+		case name != "" && name != "-":
+			keys.Add(name)
+		}
+	}
+}
+
+// restartRequired returns the sorted keys of the configuration values, which
+// differ between conf and the current configuration and can't be applied
+// without a restart, and the values themselves.  Every section of the
+// configuration file is compared, except for the filtering lists and rules,
+// the persistent clients, and the DNS settings, which are reloaded.
+func restartRequired(conf *configuration) (keys []string, pending []*pendingValue) {
+	cur := &yaml.Node{}
+	err := func() (err error) {
+		config.RLock()
+		defer config.RUnlock()
+
+		return cur.Encode(config)
+	}()
+	if err != nil {
+		log.Error("config: encoding current config: %s", err)
+
+		return []string{}, nil
+	}
+
+	next := &yaml.Node{}
+	err = next.Encode(conf)
+	if err != nil {
+		log.Error("config: encoding reloaded config: %s", err)
+
+		return []string{}, nil
+	}
+
+	pending = changedValues(cur, next, nil, func(path []string) (hot bool) {
+		if len(path) == 1 {
+			switch path[0] {
+			case "filters", "whitelist_filters", "user_rules":
+				return true
+			default:
+				return false
+			}
+		}
+
+		switch path[0] {
+		case "dns":
+			return hotDNSKeys.Has(path[1])
+		case "clients":
+			return hotClientsKeys.Has(path[1])
+		default:
+			return false
+		}
+	})
+
+	keys = make([]string, 0, len(pending))
+	for _, v := range pending {
+		keys = append(keys, strings.Join(v.path, "."))
+	}
+
+	slices.Sort(keys)
+
+	return keys, pending
+}
+
+// changedValues returns the values of the mapping nodes cur and next at path,
+// which differ and for which isHot returns false.  The dns and clients
+// sections are compared key by key.
+func changedValues(
+	cur *yaml.Node,
+	next *yaml.Node,
+	path []string,
+	isHot func(path []string) (hot bool),
+) (changed []*pendingValue) {
+	keys := mappingKeys(cur)
+	for _, k := range mappingKeys(next) {
+		if !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		p := append(slices.Clone(path), k)
+		if isHot(p) {
+			continue
+		}
+
+		curVal, nextVal := mappingValue(cur, k), mappingValue(next, k)
+		if len(p) == 1 && (k == "dns" || k == "clients") {
+			changed = append(changed, changedValues(curVal, nextVal, p, isHot)...)
+		} else if !sameValueNodes(curVal, nextVal) {
+			changed = append(changed, &pendingValue{
+				running: cloneNode(curVal),
+				value:   cloneNode(nextVal),
+				path:    p,
+			})
+		}
+	}
+
+	return changed
+}
+
+// mappingKeys returns the keys of the mapping node n.  n may be nil.
+func mappingKeys(n *yaml.Node) (keys []string) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keys = append(keys, n.Content[i].Value)
+	}
+
+	return keys
+}
+
+// sameValueNodes is like [sameValues] but also accepts nil nodes.
+func sameValueNodes(a, b *yaml.Node) (ok bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return sameValues(a, b)
+}
+
+// pendingValue is a value of the configuration file, which has been changed in
+// the file and re-read, but is only applied after a restart.
+type pendingValue struct {
+	// running is the value, which is in use until the restart.
+	running *yaml.Node
+
+	// value is the value from the configuration file.  It's nil if the value
+	// has been removed from the file.
+	value *yaml.Node
+
+	// path is the path to the value within the configuration document.
+	path []string
+}
+
+// pendingValues are the values of the configuration file, which require a
+// restart to be applied.
+type pendingValues struct {
+	values []*pendingValue
+}
+
+// restore replaces the running values within the configuration document doc
+// with the ones from the configuration file, so that writing the file doesn't
+// overwrite them.  The values changed since the file has been re-read, for
+// example via the HTTP API, are written as is and aren't restored anymore.
+func (p *pendingValues) restore(doc *yaml.Node) {
+	if p == nil {
+		return
+	}
+
+	left := p.values[:0]
+	for _, v := range p.values {
+		parent := lookupNode(doc, v.path[:len(v.path)-1])
+		key := v.path[len(v.path)-1]
+		if parent == nil || !sameValueNodes(mappingValue(parent, key), v.running) {
+			log.Info(
+				"config: warning: %s is changed, the value from the file is overwritten",
+				strings.Join(v.path, "."),
+			)
+
+			continue
+		}
+
+		if v.value != nil {
+			setMappingValue(parent, key, cloneNode(v.value))
+		} else {
+			deleteMappingValue(parent, key)
+		}
+
+		left = append(left, v)
+	}
+
+	p.values = left
+}
+
+// sameYAML returns true if a and b have the same YAML encodings, which means
+// that they are equal as stored in the configuration file.
+func sameYAML(a, b any) (ok bool) {
+	aData, err := yaml.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	bData, err := yaml.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(aData, bData)
+}
+
+// applyFilteringLists applies the filtering lists and the user rules from conf
+// if they differ from the current ones.  changed is true if anything has been
+// applied.
+func applyFilteringLists(conf *configuration) (changed bool) {
+	cur := &filtering.Config{}
+	Context.filters.WriteDiskConfig(cur)
+
+	if !slices.Equal(cur.UserRules, conf.UserRules) {
+		Context.filters.SetUserRules(conf.UserRules)
+		changed = true
+	}
+
+	if !sameFilterLists(cur.Filters, conf.Filters) ||
+		!sameFilterLists(cur.WhitelistFilters, conf.WhitelistFilters) {
+		Context.filters.SetFilterLists(conf.Filters, conf.WhitelistFilters)
+		changed = true
+	}
+
+	if changed {
+		log.Info("reloaded filtering lists")
+	}
+
+	return changed
+}
+
+// sameFilterLists returns true if a and b contain the same lists with the same
+// settings in the same order.
+func sameFilterLists(a, b []filtering.FilterYAML) (ok bool) {
+	return slices.EqualFunc(a, b, func(fa, fb filtering.FilterYAML) (eq bool) {
+		return fa.ID == fb.ID &&
+			fa.URL == fb.URL &&
+			fa.Name == fb.Name &&
+			fa.Enabled == fb.Enabled &&
+			fa.Format == fb.Format &&
+			sameYAML(fa.BlockedResponseTTL, fb.BlockedResponseTTL)
+	})
+}
+
+// replaceFromConfig replaces the persistent clients with the ones from objects,
+// which are the YAML representations from the re-read configuration file.
+// changed is true if any client has been added, updated, or removed.
+func (clients *clientsContainer) replaceFromConfig(
+	objects []*clientObject,
+	filteringConf *filtering.Config,
+) (changed bool) {
+	local := map[string]*Client{}
+	func() {
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
+
+		for name, c := range clients.list {
+			cloned := *c
+			local[name] = &cloned
+		}
+	}()
+
+	names := stringutil.NewSet()
+	for _, o := range objects {
+		names.Add(o.Name)
+	}
+
+	for name := range local {
+		if !names.Has(name) && clients.Del(name) {
+			changed = true
+		}
+	}
+
+	for _, o := range objects {
+		c, err := clients.clientFromObject(o, filteringConf)
+		if err != nil {
+			log.Error("clients: reloading client %s: %s", o.Name, err)
+
+			continue
+		}
+
+		prev, ok := local[c.Name]
+		switch {
+		case !ok:
+			_, err = clients.Add(c)
+		case sameClientSettings(prev, c):
+			continue
+		default:
+			err = clients.Update(c.Name, c)
+		}
+
+		if err != nil {
+			log.Error("clients: reloading client %s: %s", c.Name, err)
+
+			continue
+		}
+
+		changed = true
+	}
+
+	if changed {
+		log.Info("reloaded persistent clients")
+	}
+
+	return changed
+}
+
+// handleConfigReload is the handler for the POST /control/config/reload HTTP
+// API.  It re-reads the configuration file and responds with the reloaded
+// subsystems and the sections, which require a restart.
+func handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	res, err := reloadConfig()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "reloading config: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, res)
+}
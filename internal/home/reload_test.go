@@ -0,0 +1,179 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestClientsContainer_replaceFromConfig(t *testing.T) {
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	for _, c := range []*Client{{
+		Name: "removed",
+		IDs:  []string{"192.168.1.2"},
+	}, {
+		Name:           "updated",
+		IDs:            []string{"192.168.1.3"},
+		UseOwnSettings: true,
+	}} {
+		_, err := clients.Add(c)
+		require.NoError(t, err)
+	}
+
+	objects := []*clientObject{{
+		Name:              "updated",
+		IDs:               []string{"192.168.1.3"},
+		UseGlobalSettings: true,
+	}, {
+		Name: "added",
+		IDs:  []string{"192.168.1.4"},
+	}}
+
+	fconf := &filtering.Config{}
+	changed := clients.replaceFromConfig(objects, fconf)
+	assert.True(t, changed)
+
+	assert.Len(t, clients.list, 2)
+	assert.NotContains(t, clients.list, "removed")
+	assert.Contains(t, clients.list, "added")
+	assert.False(t, clients.list["updated"].UseOwnSettings)
+
+	changed = clients.replaceFromConfig(objects, fconf)
+	assert.False(t, changed)
+}
+
+func TestRestartRequired(t *testing.T) {
+	data, err := yaml.Marshal(config)
+	require.NoError(t, err)
+
+	conf := &configuration{
+		DNS: dnsConfig{
+			DnsfilterConf: &filtering.Config{},
+		},
+		Clients: &clientsConfig{
+			Sources: &clientSourcesConfig{},
+		},
+	}
+	err = yaml.Unmarshal(data, conf)
+	require.NoError(t, err)
+
+	keys, pending := restartRequired(conf)
+	assert.Empty(t, keys)
+	assert.Empty(t, pending)
+
+	conf.BindPort++
+	conf.DNS.BindHosts = []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	conf.DNS.QueryHook.Command = "/usr/local/bin/hook"
+	conf.Stats.Enabled = !conf.Stats.Enabled
+	conf.Users = append(conf.Users, webUser{Name: "admin"})
+
+	// The reloaded settings.
+	conf.DNS.UpstreamDNS = []string{"9.9.9.9"}
+	conf.Clients.Persistent = []*clientObject{{Name: "client"}}
+	conf.UserRules = []string{"||example.org^"}
+
+	keys, pending = restartRequired(conf)
+	assert.Equal(t, []string{
+		"bind_port",
+		"dns.bind_hosts",
+		"dns.query_hook",
+		"statistics",
+		"users",
+	}, keys)
+	assert.Len(t, pending, len(keys))
+}
+
+func TestPendingValues_restore(t *testing.T) {
+	type testConf struct {
+		DNS struct {
+			Port int `yaml:"port"`
+		} `yaml:"dns"`
+		BindPort int `yaml:"bind_port"`
+	}
+
+	running := &testConf{BindPort: 80}
+	running.DNS.Port = 53
+
+	next := *running
+	next.BindPort = 8080
+	next.DNS.Port = 5353
+
+	cur, reloaded := &yaml.Node{}, &yaml.Node{}
+	require.NoError(t, cur.Encode(running))
+	require.NoError(t, reloaded.Encode(next))
+
+	p := &pendingValues{
+		values: changedValues(cur, reloaded, nil, func(_ []string) (hot bool) {
+			return false
+		}),
+	}
+	require.Len(t, p.values, 2)
+
+	// Change the web port via the HTTP API.
+	changed := *running
+	changed.BindPort = 3000
+
+	data, err := marshalConfig(&changed, nil, p)
+	require.NoError(t, err)
+
+	got := &testConf{}
+	err = yaml.Unmarshal(data, got)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3000, got.BindPort)
+	assert.Equal(t, 5353, got.DNS.Port)
+
+	require.Len(t, p.values, 1)
+	assert.Equal(t, []string{"dns", "port"}, p.values[0].path)
+}
+
+func TestSameFilterLists(t *testing.T) {
+	list := []filtering.FilterYAML{{
+		Enabled: true,
+		URL:     "https://example.com/list.txt",
+		Name:    "List",
+		Filter:  filtering.Filter{ID: 1},
+	}}
+
+	testCases := []struct {
+		name string
+		b    []filtering.FilterYAML
+		want assert.BoolAssertionFunc
+	}{{
+		name: "same",
+		b: []filtering.FilterYAML{{
+			Enabled:    true,
+			URL:        "https://example.com/list.txt",
+			Name:       "List",
+			RulesCount: 10,
+			Filter:     filtering.Filter{ID: 1},
+		}},
+		want: assert.True,
+	}, {
+		name: "disabled",
+		b: []filtering.FilterYAML{{
+			URL:    "https://example.com/list.txt",
+			Name:   "List",
+			Filter: filtering.Filter{ID: 1},
+		}},
+		want: assert.False,
+	}, {
+		name: "empty",
+		b:    nil,
+		want: assert.False,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, sameFilterLists(list, tc.b))
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghsecret"
+	"github.com/AdguardTeam/golibs/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Encrypted Secrets
+
+// secretsPassphraseEnv is the name of the environment variable with the
+// passphrase for the encrypted secrets.  It is used when no key file is set.
+const secretsPassphraseEnv = "ADGUARDHOME_SECRETS_PASSPHRASE"
+
+// secretPaths are the paths of the configuration properties that are encrypted
+// when the configuration file is written, if a key is provided.  Encrypted
+// values of other properties are decrypted as well.
+//
+// The TOTP secrets of the users are always encrypted with the key from the
+// sessions database, see [webUserTOTP], since unlike the key of the secrets box
+// that key is always available.  The box encrypts them once more, so that
+// reading both the configuration file and the database isn't enough to get
+// them when a key is provided.
+var secretPaths = [][]string{
+	{"clients", "runtime_sources", "tailscale", "headscale_api_key"},
+	{"dns", "fallback_dns", "*"},
+	{"dns", "local_ptr_upstreams", "*"},
+	{"dns", "parental_bypass_pin"},
+	{"dns", "upstream_dns", "*"},
+	{"http_proxy"},
+	{"notifications", "*", "gotify", "token"},
+	{"notifications", "*", "ntfy", "token"},
+	{"notifications", "*", "smtp", "password"},
+	{"notifications", "*", "telegram", "bot_token"},
+	{"oidc", "client_secret"},
+	{"snmp", "community"},
+	{"snmp", "users", "*", "auth_password"},
+	{"snmp", "users", "*", "priv_password"},
+	{"sync", "password"},
+	{"tls", "private_key"},
+	{"users", "*", "totp", "secret"},
+	{"webhooks", "*", "secret"},
+	{"webhooks", "*", "url"},
+}
+
+// initSecrets initializes the secrets box using the key file from opts or the
+// passphrase from the environment.  If there are none, the box is nil.
+func initSecrets(opts options) (err error) {
+	var material []byte
+	if opts.secretsKeyFile != "" {
+		material, err = os.ReadFile(opts.secretsKeyFile)
+		if err != nil {
+			return fmt.Errorf("reading secrets key file: %w", err)
+		}
+
+		material = bytes.TrimSpace(material)
+	} else if p := os.Getenv(secretsPassphraseEnv); p != "" {
+		material = []byte(p)
+	} else {
+		return nil
+	}
+
+	Context.secrets, err = aghsecret.New(material)
+	if err != nil {
+		return fmt.Errorf("initializing secrets: %w", err)
+	}
+
+	log.Info("secrets: sensitive configuration values will be encrypted")
+
+	return nil
+}
+
+// decryptSecrets replaces all encrypted scalar values within n with the
+// decrypted ones.  path is the path of n used in the error messages.
+func decryptSecrets(n *yaml.Node, path []string) (err error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !aghsecret.IsEncrypted(n.Value) {
+			return nil
+		}
+
+		if Context.secrets == nil {
+			return fmt.Errorf(
+				"%s: value is encrypted, but no key file or %s is set",
+				strings.Join(path, "."),
+				secretsPassphraseEnv,
+			)
+		}
+
+		n.Value, err = Context.secrets.Open(n.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+		}
+
+		n.Tag, n.Style = "!!str", 0
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			err = decryptSecrets(n.Content[i+1], append(path, n.Content[i].Value))
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for i, c := range n.Content {
+			p := path
+			if n.Kind == yaml.SequenceNode {
+				p = append(path, fmt.Sprintf("[%d]", i))
+			}
+
+			err = decryptSecrets(c, p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// encryptSecrets encrypts the values at secretPaths within the document doc,
+// if the key is provided.
+func encryptSecrets(doc *yaml.Node) (err error) {
+	if Context.secrets == nil {
+		return nil
+	}
+
+	for _, p := range secretPaths {
+		err = encryptSecret(doc, p)
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", strings.Join(p, "."), err)
+		}
+	}
+
+	return nil
+}
+
+// encryptSecret encrypts the non-empty scalar value at path within the mapping
+// node n, if there is one.  The "*" key means every item of a sequence.
+func encryptSecret(n *yaml.Node, path []string) (err error) {
+	if n.Kind == yaml.DocumentNode && len(n.Content) == 1 {
+		n = n.Content[0]
+	}
+
+	for i, key := range path {
+		if key == "*" {
+			if n.Kind != yaml.SequenceNode {
+				return nil
+			}
+
+			for _, item := range n.Content {
+				err = encryptSecret(item, path[i+1:])
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		n = mappingValue(n, key)
+		if n == nil {
+			return nil
+		}
+	}
+
+	if n.Kind != yaml.ScalarNode || n.Value == "" || aghsecret.IsEncrypted(n.Value) {
+		return nil
+	}
+
+	n.Value, err = Context.secrets.Seal(n.Value)
+	if err != nil {
+		return err
+	}
+
+	n.Tag, n.Style = "!!str", 0
+
+	return nil
+}
+
+// mappingValue returns the value of key within the mapping node n or nil if
+// there is none.  n may be nil.
+func mappingValue(n *yaml.Node, key string) (v *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
@@ -252,7 +252,7 @@ func handleServiceControlAction(opts options, clientBuildFS fs.FS) {
 	case "install":
 		initConfigFilename(opts)
 		initWorkingDir(opts)
-		handleServiceInstallCommand(s)
+		handleServiceInstallCommand(s, opts.configureHostDNS)
 	case "uninstall":
 		handleServiceUninstallCommand(s)
 	default:
@@ -281,8 +281,10 @@ func handleServiceStatusCommand(s service.Service) {
 	}
 }
 
-// handleServiceStatusCommand handles service "install" command
-func handleServiceInstallCommand(s service.Service) {
+// handleServiceStatusCommand handles service "install" command.  If
+// configureDNS is true, the host OS is configured to use AdGuard Home as its
+// DNS resolver.
+func handleServiceInstallCommand(s service.Service, configureDNS bool) {
 	err := svcAction(s, "install")
 	if err != nil {
 		log.Fatalf("service: executing action %q: %s", "install", err)
@@ -305,6 +307,10 @@ func handleServiceInstallCommand(s service.Service) {
 	}
 	log.Printf("service: started")
 
+	if configureDNS {
+		configureHostDNS()
+	}
+
 	if detectFirstRun() {
 		log.Printf(`Almost ready!
 AdGuard Home is successfully installed and will automatically start on boot.
@@ -334,6 +340,8 @@ func handleServiceUninstallCommand(s service.Service) {
 		log.Fatalf("service: executing action %q: %s", "uninstall", err)
 	}
 
+	revertHostDNS()
+
 	if runtime.GOOS == "darwin" {
 		// Remove log files on cleanup and log errors.
 		err := os.Remove(launchdStdoutPath)
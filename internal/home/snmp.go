@@ -0,0 +1,164 @@
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/snmp"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// SNMP Agent
+
+// defaultSNMPBaseOID is the default base OID of the objects exposed by the
+// SNMP agent.  It's within the subtree of the Net-SNMP enterprise reserved for
+// experiments, since AdGuard Home has no private enterprise number.
+const defaultSNMPBaseOID = "1.3.6.1.4.1.8072.9999.9999.53"
+
+// snmpConfig is the configuration of the SNMP agent.
+type snmpConfig struct {
+	// Address is the UDP address the agent listens on.
+	Address netip.AddrPort `yaml:"address"`
+
+	// Community is the SNMPv2c community.  If empty, SNMPv2c is disabled.
+	Community string `yaml:"community"`
+
+	// BaseOID is the base OID of the exposed objects.
+	BaseOID string `yaml:"base_oid"`
+
+	// Users are the SNMPv3 users.  If empty, SNMPv3 is disabled.
+	Users []*snmp.UserConfig `yaml:"users"`
+
+	// Enabled defines if the agent is running.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the SNMP configuration isn't valid.
+func (c *snmpConfig) validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	if !c.Address.IsValid() {
+		return errors.Error("address: not set")
+	} else if c.Community == "" && len(c.Users) == 0 {
+		return errors.Error("community or users must be set")
+	}
+
+	_, err = snmp.ParseOID(c.BaseOID)
+	if err != nil {
+		return fmt.Errorf("base_oid: %w", err)
+	}
+
+	for i, u := range c.Users {
+		err = u.Validate()
+		if err != nil {
+			return fmt.Errorf("users: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// startSNMP starts the SNMP agent, if enabled.  The objects are exposed under
+// the base OID as follows:
+//
+//	base.1.1.0  queries, Counter64
+//	base.1.2.0  blocked queries, Counter64
+//	base.1.3.0  queries answered from cache, Counter64
+//	base.1.4.0  queries resolved by upstreams, Counter64
+//	base.1.5.0  protection enabled, TruthValue
+//	base.2.1.1.N  upstream address, OCTET STRING
+//	base.2.1.2.N  upstream queries, Counter64
+//	base.2.1.3.N  upstream total processing time in ms, Counter64
+//
+// The upstreams are indexed from one in the order of their addresses.  The
+// counters are reset on restart.
+func startSNMP() {
+	conf := config.SNMP
+	if !conf.Enabled {
+		return
+	}
+
+	// The OID is validated in snmpConfig.validate.
+	base, _ := snmp.ParseOID(conf.BaseOID)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debug("snmp: getting hostname: %s", err)
+	}
+
+	Context.snmp, err = snmp.New(&snmp.Config{
+		Objects: func() (vars []*snmp.Var) {
+			return snmpObjects(base)
+		},
+		Description: version.Full(),
+		Name:        hostname,
+		ObjectID:    base,
+		Community:   conf.Community,
+		Users:       conf.Users,
+		Addr:        conf.Address,
+	})
+	if err != nil {
+		log.Error("snmp: initializing: %s", err)
+
+		return
+	}
+
+	err = Context.snmp.Start()
+	if err != nil {
+		log.Error("snmp: starting: %s", err)
+	}
+}
+
+// snmpObjects returns the current values of the objects exposed by the SNMP
+// agent under base.
+func snmpObjects(base snmp.OID) (vars []*snmp.Var) {
+	srv := Context.dnsServer
+	if srv == nil {
+		return nil
+	}
+
+	c := srv.Counters()
+
+	protection := snmp.Integer(2)
+	if srv.UpdatedProtectionStatus() {
+		protection = 1
+	}
+
+	vars = []*snmp.Var{{
+		OID:   base.Append(1, 1, 0),
+		Value: snmp.Counter64(c.Queries),
+	}, {
+		OID:   base.Append(1, 2, 0),
+		Value: snmp.Counter64(c.Blocked),
+	}, {
+		OID:   base.Append(1, 3, 0),
+		Value: snmp.Counter64(c.CacheHits),
+	}, {
+		OID:   base.Append(1, 4, 0),
+		Value: snmp.Counter64(c.UpstreamQueries),
+	}, {
+		OID:   base.Append(1, 5, 0),
+		Value: protection,
+	}}
+
+	for i, u := range c.Upstreams {
+		idx := uint32(i + 1)
+		vars = append(vars, &snmp.Var{
+			OID:   base.Append(2, 1, 1, idx),
+			Value: snmp.OctetString(u.Address),
+		}, &snmp.Var{
+			OID:   base.Append(2, 1, 2, idx),
+			Value: snmp.Counter64(u.Queries),
+		}, &snmp.Var{
+			OID:   base.Append(2, 1, 3, idx),
+			Value: snmp.Counter64(u.TotalTime.Milliseconds()),
+		})
+	}
+
+	return vars
+}
@@ -0,0 +1,68 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/snmp"
+	"github.com/AdguardTeam/golibs/testutil"
+)
+
+func TestSNMPConfig_validate(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:161")
+
+	testCases := []struct {
+		conf       *snmpConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &snmpConfig{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &snmpConfig{
+			Address:   addr,
+			Community: "public",
+			BaseOID:   defaultSNMPBaseOID,
+			Enabled:   true,
+		},
+		name:       "community",
+		wantErrMsg: "",
+	}, {
+		conf: &snmpConfig{
+			Address: addr,
+			BaseOID: defaultSNMPBaseOID,
+			Enabled: true,
+		},
+		name:       "no_access",
+		wantErrMsg: "community or users must be set",
+	}, {
+		conf: &snmpConfig{
+			Address:   addr,
+			Community: "public",
+			BaseOID:   "1",
+			Enabled:   true,
+		},
+		name:       "bad_oid",
+		wantErrMsg: `base_oid: bad oid "1": too short`,
+	}, {
+		conf: &snmpConfig{
+			Address: addr,
+			BaseOID: defaultSNMPBaseOID,
+			Users: []*snmp.UserConfig{{
+				Name:         "monitor",
+				AuthProtocol: snmp.AuthSHA,
+				AuthPassword: "short",
+			}},
+			Enabled: true,
+		},
+		name:       "short_password",
+		wantErrMsg: "users: at index 0: auth_password: must be at least 8 characters",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
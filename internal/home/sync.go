@@ -0,0 +1,698 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"golang.org/x/exp/slices"
+)
+
+// Remote Configuration Synchronization
+
+// syncItem is the kind of settings synchronized from the primary instance.
+type syncItem string
+
+// Supported synchronized items.
+const (
+	syncItemBlockedServices syncItem = "blocked_services"
+	syncItemClients         syncItem = "clients"
+	syncItemFilters         syncItem = "filters"
+	syncItemRewrites        syncItem = "rewrites"
+	syncItemUserRules       syncItem = "user_rules"
+)
+
+// syncPolicy is the policy of resolving the conflicts between the local
+// settings and the ones from the primary instance.
+type syncPolicy string
+
+// Supported conflict policies.
+const (
+	// syncPolicyReplace means that the local settings are replaced with the
+	// ones from the primary instance.
+	syncPolicyReplace syncPolicy = "replace"
+
+	// syncPolicyMerge means that the settings from the primary instance are
+	// added to the local ones, and the local ones win on conflicts, that is
+	// when the user rule, rewrite domain, client name, filter list URL, or
+	// blocked service ID is the same.
+	syncPolicyMerge syncPolicy = "merge"
+)
+
+// syncMinInterval is the minimum interval between the synchronizations.
+const syncMinInterval = 1 * time.Minute
+
+// syncTimeout is the timeout of a single synchronization.
+const syncTimeout = 1 * time.Minute
+
+// syncMaxRespSize is the maximum size of a response from the primary instance.
+// It's large, since the user rules may be large.
+const syncMaxRespSize = 64 * 1024 * 1024
+
+// syncConfig is the configuration of the synchronization of the settings from
+// the primary AdGuard Home instance.
+type syncConfig struct {
+	// PrimaryURL is the base URL of the web interface of the primary instance,
+	// for example "http://192.168.1.2:3000".
+	PrimaryURL string `yaml:"primary_url"`
+
+	// Username is the name of the user on the primary instance.  The user
+	// should have at least the viewer role.
+	Username string `yaml:"username"`
+
+	// Password is the password of the user on the primary instance.
+	Password string `yaml:"password"`
+
+	// ConflictPolicy defines how the conflicts are resolved.
+	ConflictPolicy syncPolicy `yaml:"conflict_policy"`
+
+	// Items are the kinds of settings to synchronize.
+	Items []syncItem `yaml:"items"`
+
+	// Interval is the interval between the synchronizations.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// Enabled defines if the synchronization is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the synchronization configuration isn't valid.
+func (c *syncConfig) validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(c.PrimaryURL)
+	if err != nil {
+		return fmt.Errorf("primary_url: %w", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("primary_url: %q is not an absolute http or https url", c.PrimaryURL)
+	}
+
+	switch c.ConflictPolicy {
+	case syncPolicyReplace, syncPolicyMerge:
+		// Go on.
+	default:
+		return fmt.Errorf("conflict_policy: bad value %q", c.ConflictPolicy)
+	}
+
+	for i, it := range c.Items {
+		switch it {
+		case
+			syncItemBlockedServices,
+			syncItemClients,
+			syncItemFilters,
+			syncItemRewrites,
+			syncItemUserRules:
+			// Go on.
+		default:
+			return fmt.Errorf("items: at index %d: bad item %q", i, it)
+		}
+	}
+
+	if c.Interval.Duration < syncMinInterval {
+		return fmt.Errorf("interval: must be at least %s, got %s", syncMinInterval, c.Interval)
+	}
+
+	return nil
+}
+
+// has returns true if it should be synchronized.
+func (c *syncConfig) has(it syncItem) (ok bool) {
+	return slices.Contains(c.Items, it)
+}
+
+// syncRewrite is a legacy DNS rewrite as returned by the primary instance.
+type syncRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// syncFilter is a filter list as returned by the primary instance.
+type syncFilter struct {
+	BlockedResponseTTL *uint32                `json:"blocked_response_ttl"`
+	URL                string                 `json:"url"`
+	Name               string                 `json:"name"`
+	Format             filtering.FilterFormat `json:"format"`
+	Enabled            bool                   `json:"enabled"`
+}
+
+// syncState is the settings received from the primary instance.
+type syncState struct {
+	BlockedServices  []string
+	Clients          []*clientJSON
+	Filters          []*syncFilter
+	WhitelistFilters []*syncFilter
+	Rewrites         []*filtering.LegacyRewrite
+	UserRules        []string
+}
+
+// syncer periodically synchronizes the settings from the primary instance.
+type syncer struct {
+	// conf is the synchronization configuration.
+	conf *syncConfig
+
+	// client is used to send the requests to the primary instance.
+	client *http.Client
+
+	// mu protects the fields below and prevents the simultaneous
+	// synchronizations.
+	mu *sync.Mutex
+
+	// lastSync is the time of the last synchronization attempt.
+	lastSync time.Time
+
+	// lastErr is the error of the last synchronization attempt, if any.
+	lastErr error
+
+	// ctx is canceled when the periodic synchronization is stopped.
+	ctx context.Context
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// done is closed when the goroutine of the periodic synchronization
+	// exits.
+	done chan struct{}
+
+	// started is true if the periodic synchronization has been started.
+	started atomic.Bool
+}
+
+// newSyncer returns a new properly initialized *syncer.
+func newSyncer(conf *syncConfig, client *http.Client) (s *syncer) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &syncer{
+		conf:   conf,
+		client: client,
+		mu:     &sync.Mutex{},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// start starts the periodic synchronization in a separate goroutine.  It must
+// be called at most once.
+func (s *syncer) start() {
+	s.started.Store(true)
+
+	go func() {
+		defer log.OnPanic("sync")
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.conf.Interval.Duration)
+		defer ticker.Stop()
+
+		for {
+			_ = s.sync(s.ctx)
+
+			select {
+			case <-ticker.C:
+				// Go on.
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the periodic synchronization, cancelling the current one, if any,
+// and waits for it to finish.
+func (s *syncer) stop() {
+	s.cancel()
+
+	if s.started.Load() {
+		<-s.done
+	}
+}
+
+// sync synchronizes the settings from the primary instance once and saves the
+// result.
+func (s *syncer) sync(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+
+	st, err := s.fetch(ctx)
+	if err == nil {
+		err = applySync(st, s.conf)
+	}
+
+	s.lastSync, s.lastErr = time.Now(), err
+	if err != nil {
+		log.Error("sync: from %s: %s", s.conf.PrimaryURL, err)
+	} else {
+		log.Debug("sync: synchronized from %s", s.conf.PrimaryURL)
+	}
+
+	return err
+}
+
+// fetch receives the settings configured to be synchronized from the primary
+// instance.
+func (s *syncer) fetch(ctx context.Context) (st *syncState, err error) {
+	st = &syncState{}
+
+	if s.conf.has(syncItemUserRules) || s.conf.has(syncItemFilters) {
+		resp := &struct {
+			Filters          []*syncFilter `json:"filters"`
+			WhitelistFilters []*syncFilter `json:"whitelist_filters"`
+			UserRules        []string      `json:"user_rules"`
+		}{}
+		err = s.get(ctx, "/control/filtering/status", resp)
+		if err != nil {
+			return nil, fmt.Errorf("getting filtering status: %w", err)
+		}
+
+		st.Filters = resp.Filters
+		st.WhitelistFilters = resp.WhitelistFilters
+		st.UserRules = resp.UserRules
+	}
+
+	if s.conf.has(syncItemRewrites) {
+		var rws []*syncRewrite
+		err = s.get(ctx, "/control/rewrite/list", &rws)
+		if err != nil {
+			return nil, fmt.Errorf("getting rewrites: %w", err)
+		}
+
+		for _, rw := range rws {
+			st.Rewrites = append(st.Rewrites, &filtering.LegacyRewrite{
+				Domain: rw.Domain,
+				Answer: rw.Answer,
+			})
+		}
+	}
+
+	if s.conf.has(syncItemClients) {
+		resp := &clientListJSON{}
+		err = s.get(ctx, "/control/clients", resp)
+		if err != nil {
+			return nil, fmt.Errorf("getting clients: %w", err)
+		}
+
+		st.Clients = resp.Clients
+	}
+
+	if s.conf.has(syncItemBlockedServices) {
+		err = s.get(ctx, "/control/blocked_services/list", &st.BlockedServices)
+		if err != nil {
+			return nil, fmt.Errorf("getting blocked services: %w", err)
+		}
+	}
+
+	return st, nil
+}
+
+// get sends a GET request to the API of the primary instance at path and
+// decodes the JSON response into v.
+func (s *syncer) get(ctx context.Context, path string, v any) (err error) {
+	u := strings.TrimSuffix(s.conf.PrimaryURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	if s.conf.Username != "" {
+		req.SetBasicAuth(s.conf.Username, s.conf.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, syncMaxRespSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// applySync applies the settings received from the primary instance according
+// to conf and saves the configuration if anything has changed.
+func applySync(st *syncState, conf *syncConfig) (err error) {
+	fconf := &filtering.Config{}
+	Context.filters.WriteDiskConfig(fconf)
+
+	changed := false
+	policy := conf.ConflictPolicy
+
+	if conf.has(syncItemUserRules) {
+		rules := mergeSyncStrings(fconf.UserRules, st.UserRules, policy)
+		if !slices.Equal(rules, fconf.UserRules) {
+			Context.filters.SetUserRules(rules)
+			changed = true
+		}
+	}
+
+	if conf.has(syncItemFilters) {
+		block, blockChanged := mergeSyncFilters(fconf.Filters, st.Filters, policy)
+		allow, allowChanged := mergeSyncFilters(fconf.WhitelistFilters, st.WhitelistFilters, policy)
+		if blockChanged || allowChanged {
+			Context.filters.SetFilterLists(block, allow)
+			changed = true
+		}
+	}
+
+	if conf.has(syncItemRewrites) {
+		rws, rwsChanged := mergeSyncRewrites(fconf.Rewrites, st.Rewrites, policy)
+		if rwsChanged {
+			err = Context.filters.SetRewrites(rws)
+			if err != nil {
+				return fmt.Errorf("setting rewrites: %w", err)
+			}
+
+			changed = true
+		}
+	}
+
+	if conf.has(syncItemBlockedServices) {
+		ids := mergeSyncStrings(fconf.BlockedServices, st.BlockedServices, policy)
+		if !slices.Equal(ids, fconf.BlockedServices) {
+			Context.filters.SetBlockedServices(ids)
+			changed = true
+		}
+	}
+
+	if conf.has(syncItemClients) && Context.clients.syncFrom(st.Clients, policy) {
+		changed = true
+	}
+
+	if changed {
+		onConfigModified()
+	}
+
+	return nil
+}
+
+// mergeSyncStrings returns the result of merging the local and the remote
+// values according to policy.
+func mergeSyncStrings(local, remote []string, policy syncPolicy) (res []string) {
+	if policy == syncPolicyReplace {
+		return slices.Clone(remote)
+	}
+
+	res = slices.Clone(local)
+	set := stringutil.NewSet(local...)
+	for _, v := range remote {
+		if !set.Has(v) {
+			set.Add(v)
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// mergeSyncRewrites returns the result of merging the local and the remote
+// rewrites according to policy.  changed is true if res differs from local.
+func mergeSyncRewrites(
+	local []*filtering.LegacyRewrite,
+	remote []*filtering.LegacyRewrite,
+	policy syncPolicy,
+) (res []*filtering.LegacyRewrite, changed bool) {
+	if policy == syncPolicyReplace {
+		changed = len(local) != len(remote)
+		for i := 0; !changed && i < len(local); i++ {
+			l, r := local[i], remote[i]
+			changed = !strings.EqualFold(l.Domain, r.Domain) || l.Answer != r.Answer
+		}
+
+		return remote, changed
+	}
+
+	res = slices.Clone(local)
+	domains := stringutil.NewSet()
+	for _, rw := range local {
+		domains.Add(strings.ToLower(rw.Domain))
+	}
+
+	for _, rw := range remote {
+		if !domains.Has(strings.ToLower(rw.Domain)) {
+			res = append(res, rw)
+			changed = true
+		}
+	}
+
+	return res, changed
+}
+
+// mergeSyncFilters returns the result of merging the local and the remote filter
+// lists according to policy.  Only the lists with HTTP(S) URLs are synchronized,
+// since the files of the primary instance aren't available locally, so the
+// local lists with file paths are always kept.  changed is true if res differs
+// from local.
+func mergeSyncFilters(
+	local []filtering.FilterYAML,
+	remote []*syncFilter,
+	policy syncPolicy,
+) (res []filtering.FilterYAML, changed bool) {
+	localIdx := make(map[string]int, len(local))
+	for i, flt := range local {
+		localIdx[flt.URL] = i
+	}
+
+	if policy == syncPolicyMerge {
+		res = slices.Clone(local)
+	} else {
+		for _, flt := range local {
+			if !isSyncFilterURL(flt.URL) {
+				res = append(res, flt)
+			}
+		}
+	}
+
+	added := stringutil.NewSet()
+	for _, r := range remote {
+		if !isSyncFilterURL(r.URL) || added.Has(r.URL) {
+			continue
+		}
+
+		added.Add(r.URL)
+
+		flt := filtering.FilterYAML{
+			Enabled:            r.Enabled,
+			URL:                r.URL,
+			Name:               r.Name,
+			BlockedResponseTTL: r.BlockedResponseTTL,
+			Format:             r.Format,
+		}
+
+		if i, ok := localIdx[r.URL]; ok {
+			if policy == syncPolicyMerge {
+				continue
+			}
+
+			// Keep the identifier and the downloaded contents of the list.
+			flt.Filter = local[i].Filter
+			flt.RulesCount, flt.LastUpdated = local[i].RulesCount, local[i].LastUpdated
+		}
+
+		res = append(res, flt)
+	}
+
+	return res, !sameSyncFilters(local, res)
+}
+
+// isSyncFilterURL returns true if the filter list with u may be synchronized.
+func isSyncFilterURL(u string) (ok bool) {
+	parsed, err := url.Parse(u)
+
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
+
+// sameSyncFilters returns true if a and b have the same synchronized
+// properties in the same order.
+func sameSyncFilters(a, b []filtering.FilterYAML) (ok bool) {
+	return slices.EqualFunc(a, b, func(fa, fb filtering.FilterYAML) (eq bool) {
+		return fa.URL == fb.URL &&
+			fa.Name == fb.Name &&
+			fa.Enabled == fb.Enabled &&
+			fa.Format == fb.Format &&
+			sameUint32Ptr(fa.BlockedResponseTTL, fb.BlockedResponseTTL)
+	})
+}
+
+// sameUint32Ptr returns true if a and b are both nil or point to equal values.
+func sameUint32Ptr(a, b *uint32) (ok bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// syncFrom updates the persistent clients using the clients received from the
+// primary instance according to policy.  changed is true if any client has been
+// added, updated, or removed.
+func (clients *clientsContainer) syncFrom(
+	remote []*clientJSON,
+	policy syncPolicy,
+) (changed bool) {
+	local := map[string]*Client{}
+	func() {
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
+
+		for name, c := range clients.list {
+			cloned := *c
+			local[name] = &cloned
+		}
+	}()
+
+	remoteNames := stringutil.NewSet()
+	for _, cj := range remote {
+		remoteNames.Add(cj.Name)
+	}
+
+	if policy == syncPolicyReplace {
+		for name := range local {
+			if !remoteNames.Has(name) && clients.Del(name) {
+				changed = true
+			}
+		}
+	}
+
+	for _, cj := range remote {
+		c := jsonToClient(*cj)
+		prev, ok := local[c.Name]
+		switch {
+		case !ok:
+			_, err := clients.Add(c)
+			if err != nil {
+				log.Info("sync: adding client %q: %s", c.Name, err)
+
+				continue
+			}
+		case policy == syncPolicyMerge || sameClientSettings(prev, c):
+			continue
+		default:
+			err := clients.Update(c.Name, c)
+			if err != nil {
+				log.Info("sync: updating client %q: %s", c.Name, err)
+
+				continue
+			}
+		}
+
+		changed = true
+	}
+
+	return changed
+}
+
+// sameClientSettings returns true if a and b have the same persistent
+// settings.
+func sameClientSettings(a, b *Client) (ok bool) {
+	return a.Name == b.Name &&
+		slices.Equal(a.IDs, b.IDs) &&
+		slices.Equal(a.Tags, b.Tags) &&
+		slices.Equal(a.BlockedServices, b.BlockedServices) &&
+		slices.Equal(a.Upstreams, b.Upstreams) &&
+		a.UseOwnSettings == b.UseOwnSettings &&
+		a.FilteringEnabled == b.FilteringEnabled &&
+		a.SafeBrowsingEnabled == b.SafeBrowsingEnabled &&
+		a.ParentalEnabled == b.ParentalEnabled &&
+		a.UseOwnBlockedServices == b.UseOwnBlockedServices &&
+		sameBoolPtr(a.LocalDiscoveryPassthrough, b.LocalDiscoveryPassthrough) &&
+		sameYAML(a.safeSearchConf, b.safeSearchConf)
+}
+
+// sameBoolPtr returns true if a and b are both nil or point to equal values.
+func sameBoolPtr(a, b *bool) (ok bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// syncStatusJSON is the response to the GET /control/sync/status HTTP API.
+type syncStatusJSON struct {
+	LastSync       *time.Time `json:"last_sync,omitempty"`
+	PrimaryURL     string     `json:"primary_url"`
+	ConflictPolicy syncPolicy `json:"conflict_policy"`
+	LastError      string     `json:"last_error,omitempty"`
+	Items          []syncItem `json:"items"`
+	Enabled        bool       `json:"enabled"`
+}
+
+// status returns the current synchronization status.
+func (s *syncer) status() (resp *syncStatusJSON) {
+	resp = &syncStatusJSON{
+		PrimaryURL:     s.conf.PrimaryURL,
+		ConflictPolicy: s.conf.ConflictPolicy,
+		Items:          s.conf.Items,
+		Enabled:        s.conf.Enabled,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastSync.IsZero() {
+		t := s.lastSync
+		resp.LastSync = &t
+	}
+
+	if s.lastErr != nil {
+		resp.LastError = s.lastErr.Error()
+	}
+
+	return resp
+}
+
+// handleSyncStatus is the handler for the GET /control/sync/status HTTP API.
+func (s *syncer) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	_ = aghhttp.WriteJSONResponse(w, r, s.status())
+}
+
+// handleSyncRun is the handler for the POST /control/sync/run HTTP API.  It
+// synchronizes the settings immediately.
+func (s *syncer) handleSyncRun(w http.ResponseWriter, r *http.Request) {
+	if !s.conf.Enabled {
+		aghhttp.Error(r, w, http.StatusBadRequest, "sync is disabled")
+
+		return
+	}
+
+	err := s.sync(r.Context())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadGateway, "syncing: %s", err)
+
+		return
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, s.status())
+}
+
+// registerSyncHandlers registers the HTTP handlers of the synchronization.
+func registerSyncHandlers() {
+	s := Context.sync
+	httpRegister(http.MethodGet, "/control/sync/status", s.handleSyncStatus)
+	httpRegister(http.MethodPost, "/control/sync/run", s.handleSyncRun)
+}
@@ -0,0 +1,370 @@
+package home
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncConfig_validate(t *testing.T) {
+	newConf := func() (c *syncConfig) {
+		return &syncConfig{
+			PrimaryURL:     "http://192.168.1.2:3000",
+			ConflictPolicy: syncPolicyReplace,
+			Items:          []syncItem{syncItemClients, syncItemUserRules},
+			Interval:       timeutil.Duration{Duration: time.Hour},
+			Enabled:        true,
+		}
+	}
+
+	testCases := []struct {
+		modify     func(c *syncConfig)
+		name       string
+		wantErrMsg string
+	}{{
+		modify:     func(_ *syncConfig) {},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		modify: func(c *syncConfig) {
+			c.Enabled = false
+			c.PrimaryURL = ""
+		},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		modify:     func(c *syncConfig) { c.PrimaryURL = "192.168.1.2:3000" },
+		name:       "bad_url",
+		wantErrMsg: `primary_url: parse "192.168.1.2:3000": first path segment in URL cannot contain colon`,
+	}, {
+		modify:     func(c *syncConfig) { c.PrimaryURL = "ftp://primary" },
+		name:       "bad_scheme",
+		wantErrMsg: `primary_url: "ftp://primary" is not an absolute http or https url`,
+	}, {
+		modify:     func(c *syncConfig) { c.ConflictPolicy = "newest" },
+		name:       "bad_policy",
+		wantErrMsg: `conflict_policy: bad value "newest"`,
+	}, {
+		modify:     func(c *syncConfig) { c.Items = append(c.Items, "dhcp") },
+		name:       "bad_item",
+		wantErrMsg: `items: at index 2: bad item "dhcp"`,
+	}, {
+		modify:     func(c *syncConfig) { c.Interval.Duration = time.Second },
+		name:       "short_interval",
+		wantErrMsg: "interval: must be at least 1m0s, got 1s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newConf()
+			tc.modify(c)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, c.validate())
+		})
+	}
+}
+
+func TestMergeSyncStrings(t *testing.T) {
+	local := []string{"||local.example^", "||both.example^"}
+	remote := []string{"||both.example^", "||remote.example^"}
+
+	assert.Equal(t, remote, mergeSyncStrings(local, remote, syncPolicyReplace))
+	assert.Equal(
+		t,
+		[]string{"||local.example^", "||both.example^", "||remote.example^"},
+		mergeSyncStrings(local, remote, syncPolicyMerge),
+	)
+}
+
+func TestMergeSyncRewrites(t *testing.T) {
+	local := []*filtering.LegacyRewrite{
+		{Domain: "nas.lan", Answer: "192.168.1.10"},
+		{Domain: "printer.lan", Answer: "192.168.1.20"},
+	}
+
+	t.Run("replace_same", func(t *testing.T) {
+		remote := []*filtering.LegacyRewrite{
+			{Domain: "NAS.lan", Answer: "192.168.1.10"},
+			{Domain: "printer.lan", Answer: "192.168.1.20"},
+		}
+
+		_, changed := mergeSyncRewrites(local, remote, syncPolicyReplace)
+		assert.False(t, changed)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		remote := []*filtering.LegacyRewrite{{Domain: "nas.lan", Answer: "192.168.1.11"}}
+
+		res, changed := mergeSyncRewrites(local, remote, syncPolicyReplace)
+		assert.True(t, changed)
+		assert.Equal(t, remote, res)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		remote := []*filtering.LegacyRewrite{
+			{Domain: "nas.lan", Answer: "192.168.1.11"},
+			{Domain: "tv.lan", Answer: "192.168.1.30"},
+		}
+
+		res, changed := mergeSyncRewrites(local, remote, syncPolicyMerge)
+		assert.True(t, changed)
+		assert.Equal(t, append(local, remote[1]), res)
+	})
+}
+
+func TestMergeSyncFilters(t *testing.T) {
+	const (
+		localURL  = "https://lists.example/local.txt"
+		sharedURL = "https://lists.example/shared.txt"
+		remoteURL = "https://lists.example/remote.txt"
+		filePath  = "/opt/lists/file.txt"
+	)
+
+	local := []filtering.FilterYAML{{
+		Enabled: true,
+		URL:     localURL,
+		Name:    "Local",
+		Filter:  filtering.Filter{ID: 1},
+	}, {
+		Enabled: true,
+		URL:     sharedURL,
+		Name:    "Shared",
+		Filter:  filtering.Filter{ID: 2},
+	}, {
+		Enabled: true,
+		URL:     filePath,
+		Name:    "File",
+		Filter:  filtering.Filter{ID: 3},
+	}}
+
+	t.Run("replace_same", func(t *testing.T) {
+		remote := []*syncFilter{
+			{URL: localURL, Name: "Local", Enabled: true},
+			{URL: sharedURL, Name: "Shared", Enabled: true},
+			{URL: "/primary/file.txt", Name: "Primary file", Enabled: true},
+		}
+
+		_, changed := mergeSyncFilters(local[:2], remote, syncPolicyReplace)
+		assert.False(t, changed)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		remote := []*syncFilter{
+			{URL: sharedURL, Name: "Shared renamed", Enabled: false},
+			{URL: remoteURL, Name: "Remote", Enabled: true},
+		}
+
+		res, changed := mergeSyncFilters(local, remote, syncPolicyReplace)
+		assert.True(t, changed)
+		assert.Equal(t, []filtering.FilterYAML{local[2], {
+			URL:    sharedURL,
+			Name:   "Shared renamed",
+			Filter: filtering.Filter{ID: 2},
+		}, {
+			Enabled: true,
+			URL:     remoteURL,
+			Name:    "Remote",
+		}}, res)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		remote := []*syncFilter{
+			{URL: sharedURL, Name: "Shared renamed", Enabled: false},
+			{URL: remoteURL, Name: "Remote", Enabled: true},
+			{URL: remoteURL, Name: "Duplicate", Enabled: true},
+		}
+
+		res, changed := mergeSyncFilters(local, remote, syncPolicyMerge)
+		assert.True(t, changed)
+		assert.Equal(t, append(local, filtering.FilterYAML{
+			Enabled: true,
+			URL:     remoteURL,
+			Name:    "Remote",
+		}), res)
+	})
+}
+
+func TestSyncer_stop(t *testing.T) {
+	reqCh := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCh <- struct{}{}
+
+		// Don't respond until the synchronization is cancelled.
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	conf := &syncConfig{
+		PrimaryURL: srv.URL,
+		Items:      []syncItem{syncItemUserRules},
+		Interval:   timeutil.Duration{Duration: time.Hour},
+		Enabled:    true,
+	}
+
+	s := newSyncer(conf, srv.Client())
+	s.start()
+
+	<-reqCh
+
+	stopped := make(chan struct{})
+	go func() {
+		s.stop()
+		close(stopped)
+	}()
+
+	require.Eventually(t, func() (ok bool) {
+		select {
+		case <-stopped:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	st := s.status()
+	require.NotNil(t, st.LastSync)
+
+	assert.Contains(t, st.LastError, "context canceled")
+
+	// Stopping a syncer, which has never been started, doesn't block.
+	newSyncer(conf, srv.Client()).stop()
+}
+
+func TestSyncer_fetch(t *testing.T) {
+	const user, pass = "sync", "secret"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control/filtering/status", func(w http.ResponseWriter, r *http.Request) {
+		_ = aghhttp.WriteJSONResponse(w, r, map[string]any{
+			"enabled": true,
+			"filters": []map[string]any{{
+				"id":          1,
+				"url":         "https://lists.example/list.txt",
+				"name":        "List",
+				"rules_count": 10,
+				"enabled":     true,
+			}},
+			"whitelist_filters": []map[string]any{},
+			"user_rules":        []string{"||example.org^"},
+		})
+	})
+	mux.HandleFunc("/control/rewrite/list", func(w http.ResponseWriter, r *http.Request) {
+		_ = aghhttp.WriteJSONResponse(w, r, []map[string]string{{
+			"domain": "nas.lan",
+			"answer": "192.168.1.10",
+		}})
+	})
+	mux.HandleFunc("/control/clients", func(w http.ResponseWriter, r *http.Request) {
+		_ = aghhttp.WriteJSONResponse(w, r, clientListJSON{
+			Clients: []*clientJSON{{Name: "laptop", IDs: []string{"192.168.1.5"}}},
+		})
+	})
+	mux.HandleFunc("/control/blocked_services/list", func(w http.ResponseWriter, r *http.Request) {
+		_ = aghhttp.WriteJSONResponse(w, r, []string{"tiktok"})
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != user || p != pass {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	conf := &syncConfig{
+		PrimaryURL: srv.URL + "/",
+		Username:   user,
+		Password:   pass,
+		Items: []syncItem{
+			syncItemBlockedServices,
+			syncItemClients,
+			syncItemFilters,
+			syncItemRewrites,
+			syncItemUserRules,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	s := newSyncer(conf, srv.Client())
+	st, err := s.fetch(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"||example.org^"}, st.UserRules)
+	assert.Equal(t, []string{"tiktok"}, st.BlockedServices)
+	assert.Equal(t, []*syncFilter{{
+		URL:     "https://lists.example/list.txt",
+		Name:    "List",
+		Enabled: true,
+	}}, st.Filters)
+	assert.Empty(t, st.WhitelistFilters)
+	assert.Equal(t, []*filtering.LegacyRewrite{{
+		Domain: "nas.lan",
+		Answer: "192.168.1.10",
+	}}, st.Rewrites)
+
+	require.Len(t, st.Clients, 1)
+	assert.Equal(t, "laptop", st.Clients[0].Name)
+
+	conf.Password = "wrong"
+	_, err = s.fetch(ctx)
+	testutil.AssertErrorMsg(t, "getting filtering status: unexpected status code 401", err)
+}
+
+func TestClientsContainer_syncFrom(t *testing.T) {
+	clients := clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	for _, c := range []*Client{{
+		Name: "local",
+		IDs:  []string{"192.168.1.2"},
+	}, {
+		Name:           "shared",
+		IDs:            []string{"192.168.1.3"},
+		UseOwnSettings: true,
+	}} {
+		_, err := clients.Add(c)
+		require.NoError(t, err)
+	}
+
+	remote := []*clientJSON{{
+		Name:              "shared",
+		IDs:               []string{"192.168.1.3"},
+		UseGlobalSettings: true,
+	}, {
+		Name: "remote",
+		IDs:  []string{"192.168.1.4"},
+	}}
+
+	changed := clients.syncFrom(remote, syncPolicyMerge)
+	assert.True(t, changed)
+
+	assert.Len(t, clients.list, 3)
+	assert.True(t, clients.list["shared"].UseOwnSettings)
+
+	changed = clients.syncFrom(remote, syncPolicyReplace)
+	assert.True(t, changed)
+
+	assert.Len(t, clients.list, 2)
+	assert.NotContains(t, clients.list, "local")
+	assert.False(t, clients.list["shared"].UseOwnSettings)
+
+	changed = clients.syncFrom(remote, syncPolicyReplace)
+	assert.False(t, changed)
+}
@@ -0,0 +1,146 @@
+package home
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/systemd"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Systemd Integration
+
+// The names of the sockets passed by systemd, set with the FileDescriptorName
+// option of the socket unit.
+const (
+	socketNameDNS = "dns"
+	socketNameWeb = "web"
+)
+
+// initSystemdSockets receives the sockets passed by systemd, if any, and stores
+// them in Context.
+func initSystemdSockets() (err error) {
+	socks, err := systemd.Sockets()
+	if err != nil {
+		return fmt.Errorf("receiving systemd sockets: %w", err)
+	}
+
+	for _, sock := range socks {
+		switch sock.Name {
+		case socketNameDNS:
+			Context.dnsSocketFiles = append(Context.dnsSocketFiles, sock.File)
+		case socketNameWeb:
+			if Context.webSocketFile != nil {
+				log.Info("systemd: ignoring extra %q socket", sock.Name)
+				_ = sock.File.Close()
+
+				continue
+			}
+
+			Context.webSocketFile = sock.File
+		default:
+			log.Info("systemd: ignoring socket with unknown name %q", sock.Name)
+			_ = sock.File.Close()
+		}
+	}
+
+	if len(socks) > 0 {
+		log.Info(
+			"systemd: received %d dns sockets, web socket received: %t",
+			len(Context.dnsSocketFiles),
+			Context.webSocketFile != nil,
+		)
+	}
+
+	return nil
+}
+
+// notifySystemd sends the states to systemd, if it expects the notifications.
+func notifySystemd(states ...string) {
+	_, err := systemd.Notify(states...)
+	if err != nil {
+		log.Error("systemd: notifying: %s", err)
+	}
+}
+
+// startSystemdWatchdog starts sending the watchdog notifications to systemd, if
+// the watchdog is enabled for the service.
+func startSystemdWatchdog() {
+	ivl, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Error("systemd: watchdog: %s", err)
+
+		return
+	} else if ivl == 0 {
+		return
+	}
+
+	log.Info("systemd: watchdog interval is %s", ivl)
+
+	go func() {
+		defer log.OnPanic("systemd: watchdog")
+
+		// Notify twice per interval as recommended by sd_watchdog_enabled(3).
+		ticker := time.NewTicker(ivl / 2)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			notifySystemd(systemd.StateWatchdog)
+		}
+	}()
+}
+
+// reloadOnSignal reloads the ARP table, the TLS certificates, and the
+// configuration file.
+func reloadOnSignal() {
+	notifySystemd(systemd.StateReloading)
+	defer notifySystemd(systemd.StateReady)
+
+	Context.clients.reloadARP()
+	Context.tls.reload()
+
+	res, err := reloadConfig()
+	if err != nil {
+		log.Error("reloading config: %s", err)
+
+		return
+	}
+
+	log.Info("reloaded %q; restart required for %q", res.Reloaded, res.RestartRequired)
+}
+
+// applyDNSConfig applies the DNS server settings from dnsConf, which is the dns
+// section of the re-read configuration file.  The addresses to listen on, the
+// filtering settings, and the query hook aren't reloaded, since those require
+// a restart.
+func applyDNSConfig(dnsConf *dnsConfig) (err error) {
+	err = dnsforward.ValidateUpstreams(dnsConf.UpstreamDNS)
+	if err != nil {
+		return fmt.Errorf("validating upstreams: %w", err)
+	}
+
+	if dnsConf.UpstreamTimeout.Duration == 0 {
+		dnsConf.UpstreamTimeout = timeutil.Duration{Duration: dnsforward.DefaultTimeout}
+	}
+
+	func() {
+		config.Lock()
+		defer config.Unlock()
+
+		cur := &config.DNS
+		cur.FilteringConfig = dnsConf.FilteringConfig
+		cur.UpstreamTimeout = dnsConf.UpstreamTimeout
+		cur.PrivateNets = dnsConf.PrivateNets
+		cur.UsePrivateRDNS = dnsConf.UsePrivateRDNS
+		cur.LocalPTRResolvers = dnsConf.LocalPTRResolvers
+		cur.UseDNS64 = dnsConf.UseDNS64
+		cur.DNS64Prefixes = dnsConf.DNS64Prefixes
+		cur.UseHTTP3Upstreams = dnsConf.UseHTTP3Upstreams
+	}()
+
+	log.Info("reloaded dns config")
+
+	return reconfigureDNSServer()
+}
@@ -18,6 +18,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
@@ -36,8 +37,18 @@ type tlsManager struct {
 	// certLastMod is the last modification time of the certificate file.
 	certLastMod time.Time
 
+	// http01 serves the HTTP-01 challenges of ACME.  It is never nil.
+	http01 *aghacme.HTTP01Solver
+
+	// acme issues and renews the certificate.  It is nil if ACME is disabled.
+	acme *acmeManager
+
 	confLock sync.Mutex
 	conf     tlsConfigSettings
+
+	// enableOnCert is true if the encryption is enabled once ACME issues the
+	// first certificate.
+	enableOnCert bool
 }
 
 // newTLSManager initializes the manager of TLS configuration.  m is always
@@ -46,9 +57,17 @@ type tlsManager struct {
 func newTLSManager(conf tlsConfigSettings) (m *tlsManager, err error) {
 	m = &tlsManager{
 		status: &tlsConfigStatus{},
+		http01: aghacme.NewHTTP01Solver(),
 		conf:   conf,
 	}
 
+	if m.conf.ACME.Enabled {
+		err = m.initACME()
+		if err != nil {
+			log.Error("tls: initializing acme: %s", err)
+		}
+	}
+
 	if m.conf.Enabled {
 		err = m.load()
 		if err != nil {
@@ -63,6 +82,68 @@ func newTLSManager(conf tlsConfigSettings) (m *tlsManager, err error) {
 	return m, nil
 }
 
+// initACME initializes the automatic issuance of the certificate.  If the
+// certificate hasn't been issued yet and there is no other one, the encryption
+// is disabled until it is.
+func (m *tlsManager) initACME() (err error) {
+	m.acme, err = newACMEManager(
+		&m.conf.ACME,
+		m.conf.ServerName,
+		Context.getDataDir(),
+		m.http01,
+		m.onACMECert,
+	)
+	if err != nil {
+		return err
+	}
+
+	if m.acme.hasCert() {
+		m.conf.CertificatePath, m.conf.PrivateKeyPath = m.acme.certPath(), m.acme.keyPath()
+		m.conf.CertificateChain, m.conf.PrivateKey = "", ""
+	} else if m.conf.Enabled && m.conf.CertificatePath == "" && m.conf.CertificateChain == "" {
+		log.Info("tls: encryption will be enabled once acme issues the certificate")
+
+		m.conf.Enabled = false
+		m.enableOnCert = true
+	}
+
+	return nil
+}
+
+// onACMECert applies the certificate issued by ACME and restarts the servers
+// using it.
+func (m *tlsManager) onACMECert(certPath, keyPath string) (err error) {
+	m.confLock.Lock()
+	m.conf.CertificatePath, m.conf.PrivateKeyPath = certPath, keyPath
+	m.conf.CertificateChain, m.conf.PrivateKey = "", ""
+	if m.enableOnCert {
+		m.conf.Enabled, m.enableOnCert = true, false
+	}
+
+	status := &tlsConfigStatus{}
+	err = loadTLSConf(&m.conf, status)
+	m.status = status
+	tlsConf := m.conf
+	m.confLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	m.setCertFileTime()
+	onConfigModified()
+
+	err = reconfigureDNSServer()
+	if err != nil {
+		log.Error("tls: reconfiguring dns server: %s", err)
+	}
+
+	// The background context is used because the TLSConfigChanged wraps context
+	// with timeout on its own.
+	Context.web.TLSConfigChanged(context.Background(), tlsConf)
+
+	return nil
+}
+
 // load reloads the TLS configuration from files or data from the config file.
 func (m *tlsManager) load() (err error) {
 	err = loadTLSConf(&m.conf, m.status)
@@ -105,6 +186,10 @@ func (m *tlsManager) start() {
 	tlsConf := m.conf
 	m.confLock.Unlock()
 
+	if m.acme != nil {
+		m.acme.start()
+	}
+
 	// The background context is used because the TLSConfigChanged wraps context
 	// with timeout on its own and shuts down the server, which handles current
 	// request.
@@ -261,6 +346,10 @@ type tlsConfigStatus struct {
 type tlsConfig struct {
 	*tlsConfigStatus     `json:",inline"`
 	tlsConfigSettingsExt `json:",inline"`
+
+	// ACME is the status of the automatic issuance of the certificate.  It is
+	// nil if ACME is disabled.
+	ACME *acmeStatus `json:"acme,omitempty"`
 }
 
 // tlsConfigSettingsExt is used to (un)marshal the PrivateKeySaved field to
@@ -283,6 +372,10 @@ func (m *tlsManager) handleTLSStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	m.confLock.Unlock()
 
+	if m.acme != nil {
+		data.ACME = m.acme.getStatus()
+	}
+
 	marshalTLS(w, r, data)
 }
 
@@ -348,6 +441,7 @@ func (m *tlsManager) setConfig(newConf tlsConfigSettings, status *tlsConfigStatu
 	// TODO(a.garipov): Define a custom comparer for dnsforward.TLSConfig.
 	newConf.DNSCryptConfigFile = m.conf.DNSCryptConfigFile
 	newConf.PortDNSCrypt = m.conf.PortDNSCrypt
+	newConf.ACME = m.conf.ACME
 	if !cmp.Equal(m.conf, newConf, cmp.AllowUnexported(dnsforward.TLSConfig{})) {
 		log.Info("tls config has changed, restarting https server")
 		restartHTTPS = true
@@ -758,4 +852,8 @@ func (m *tlsManager) registerWebHandlers() {
 	httpRegister(http.MethodGet, "/control/tls/status", m.handleTLSStatus)
 	httpRegister(http.MethodPost, "/control/tls/configure", m.handleTLSConfigure)
 	httpRegister(http.MethodPost, "/control/tls/validate", m.handleTLSValidate)
+
+	// The HTTP-01 challenges are requested by the CA, so they are served
+	// without authentication and redirection to HTTPS.
+	Context.mux.Handle(aghacme.HTTP01PathPrefix, m.http01)
 }
@@ -0,0 +1,391 @@
+package home
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"golang.org/x/exp/slices"
+)
+
+// Automatic TLS Certificates
+
+// File names of the ACME data within the data directory.
+const (
+	acmeDirName        = "acme"
+	acmeAccountKeyName = "account.pem"
+	acmeCertName       = "cert.pem"
+	acmeKeyName        = "key.pem"
+)
+
+// acmeTimeout is the timeout of a single certificate issuance.
+const acmeTimeout = 10 * time.Minute
+
+// acmeRetryInterval is the interval between the failed certificate issuance
+// attempts.
+const acmeRetryInterval = 1 * time.Hour
+
+// acmeDefaultRenewBefore is the default time before the expiration of the
+// certificate when it's renewed.
+const acmeDefaultRenewBefore = 30 * timeutil.Day
+
+// acmeConfig is the configuration of the automatic issuance and renewal of the
+// TLS certificate using the ACME protocol.
+type acmeConfig struct {
+	// DNSProviderConfig is the configuration of the DNS provider.  Its keys
+	// depend on the provider.
+	DNSProviderConfig map[string]string `yaml:"dns_provider_config"`
+
+	// Email is the contact email of the ACME account.
+	Email string `yaml:"email"`
+
+	// DirectoryURL is the directory URL of the CA.  If it's empty, Let's
+	// Encrypt is used.
+	DirectoryURL string `yaml:"directory_url"`
+
+	// Challenge is the type of the challenge used to prove the control over
+	// the domains.
+	Challenge aghacme.Challenge `yaml:"challenge"`
+
+	// DNSProvider is the name of the DNS provider for the DNS-01 challenges.
+	DNSProvider string `yaml:"dns_provider"`
+
+	// Domains are the additional domain names of the certificate, for example
+	// a wildcard one for the ClientIDs.  The server name is always the first
+	// one.
+	Domains []string `yaml:"domains"`
+
+	// RenewBefore is the time before the expiration of the certificate when
+	// it's renewed.  If it's zero, [acmeDefaultRenewBefore] is used.
+	RenewBefore timeutil.Duration `yaml:"renew_before"`
+
+	// DNSPropagationWait is the time to wait for the DNS-01 challenge records
+	// to propagate.
+	DNSPropagationWait timeutil.Duration `yaml:"dns_propagation_wait"`
+
+	// Enabled defines if the certificate is issued automatically.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the ACME configuration isn't valid.  serverName
+// is the configured server name.
+func (c *acmeConfig) validate(serverName string) (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	if serverName == "" {
+		return errors.Error("server_name: must be set")
+	}
+
+	switch c.Challenge {
+	case aghacme.ChallengeHTTP01:
+		// Go on.
+	case aghacme.ChallengeDNS01:
+		_, err = aghacme.NewDNSProvider(c.DNSProvider, c.DNSProviderConfig, http.DefaultClient)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("challenge: bad value %q", c.Challenge)
+	}
+
+	if c.RenewBefore.Duration < 0 {
+		return fmt.Errorf("renew_before: must not be negative, got %s", c.RenewBefore)
+	}
+
+	return nil
+}
+
+// acmeStatus is the status of the automatic certificate issuance.
+type acmeStatus struct {
+	// LastAttempt is the time of the last issuance attempt.
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+
+	// NextRenewal is the time of the next issuance attempt.
+	NextRenewal time.Time `json:"next_renewal,omitempty"`
+
+	// LastError is the error of the last issuance attempt, if any.
+	LastError string `json:"last_error,omitempty"`
+
+	// Challenge is the type of the challenge used.
+	Challenge aghacme.Challenge `json:"challenge"`
+
+	// Domains are the domain names of the certificate.
+	Domains []string `json:"domains"`
+}
+
+// acmeManager issues and renews the TLS certificate.
+type acmeManager struct {
+	// client obtains the certificates.
+	client *aghacme.Client
+
+	// onCert is called after a new certificate is saved.
+	onCert func(certPath, keyPath string) (err error)
+
+	// mu protects status.
+	mu *sync.Mutex
+
+	// status is the current status.
+	status *acmeStatus
+
+	// dir is the directory with the ACME data.
+	dir string
+
+	// domains are the domain names of the certificate.
+	domains []string
+
+	// renewBefore is the time before the expiration of the certificate when
+	// it's renewed.
+	renewBefore time.Duration
+}
+
+// newACMEManager returns a new *acmeManager which keeps its data within
+// dataDir.  http01 serves the HTTP-01 challenges.
+func newACMEManager(
+	conf *acmeConfig,
+	serverName string,
+	dataDir string,
+	http01 *aghacme.HTTP01Solver,
+	onCert func(certPath, keyPath string) (err error),
+) (m *acmeManager, err error) {
+	dir := filepath.Join(dataDir, acmeDirName)
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("creating acme dir: %w", err)
+	}
+
+	key, err := loadACMEAccountKey(filepath.Join(dir, acmeAccountKeyName))
+	if err != nil {
+		return nil, err
+	}
+
+	clientConf := &aghacme.Config{
+		HTTPClient:         Context.client,
+		AccountKey:         key,
+		HTTP01:             http01,
+		DirectoryURL:       conf.DirectoryURL,
+		Email:              conf.Email,
+		DNSPropagationWait: conf.DNSPropagationWait.Duration,
+	}
+
+	if conf.Challenge == aghacme.ChallengeDNS01 {
+		clientConf.DNSProvider, err = aghacme.NewDNSProvider(
+			conf.DNSProvider,
+			conf.DNSProviderConfig,
+			Context.client,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	renewBefore := conf.RenewBefore.Duration
+	if renewBefore == 0 {
+		renewBefore = acmeDefaultRenewBefore
+	}
+
+	domains := append([]string{serverName}, conf.Domains...)
+
+	return &acmeManager{
+		client: aghacme.New(clientConf),
+		onCert: onCert,
+		mu:     &sync.Mutex{},
+		status: &acmeStatus{
+			Challenge: conf.Challenge,
+			Domains:   domains,
+		},
+		dir:         dir,
+		domains:     domains,
+		renewBefore: renewBefore,
+	}, nil
+}
+
+// loadACMEAccountKey reads the account key from the file at path or generates
+// and writes a new one, if there is no such file.
+func loadACMEAccountKey(path string) (key crypto.Signer, err error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err = aghacme.ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing acme account key: %w", err)
+		}
+
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading acme account key: %w", err)
+	}
+
+	key, err = aghacme.NewKey()
+	if err != nil {
+		return nil, fmt.Errorf("generating acme account key: %w", err)
+	}
+
+	data, err = aghacme.MarshalKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("writing acme account key: %w", err)
+	}
+
+	return key, nil
+}
+
+// certPath returns the path to the certificate chain file.
+func (m *acmeManager) certPath() (p string) {
+	return filepath.Join(m.dir, acmeCertName)
+}
+
+// keyPath returns the path to the private key file.
+func (m *acmeManager) keyPath() (p string) {
+	return filepath.Join(m.dir, acmeKeyName)
+}
+
+// hasCert returns true if the certificate has already been issued.
+func (m *acmeManager) hasCert() (ok bool) {
+	_, err := os.Stat(m.certPath())
+
+	return err == nil
+}
+
+// start starts the issuance and renewal of the certificate in a separate
+// goroutine.
+func (m *acmeManager) start() {
+	go func() {
+		defer log.OnPanic("acme")
+
+		for {
+			next := m.renew()
+			time.Sleep(time.Until(next))
+		}
+	}()
+}
+
+// getStatus returns a copy of the current status.
+func (m *acmeManager) getStatus() (st *acmeStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := *m.status
+	cp.Domains = slices.Clone(cp.Domains)
+
+	return &cp
+}
+
+// renew issues a new certificate if there is no valid one for the configured
+// domains or if it's going to expire soon.  next is the time of the next
+// check.
+func (m *acmeManager) renew() (next time.Time) {
+	cert, err := readFirstCert(m.certPath())
+	if err == nil {
+		next = cert.NotAfter.Add(-m.renewBefore)
+		if time.Now().Before(next) && m.hasDomains(cert) {
+			m.setNext(next)
+
+			return next
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Error("acme: %s", err)
+	}
+
+	log.Info("acme: obtaining certificate for %q", m.domains)
+
+	err = m.obtain()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status.LastAttempt = time.Now()
+	if err != nil {
+		log.Error("acme: %s", err)
+
+		m.status.LastError = err.Error()
+		m.status.NextRenewal = time.Now().Add(acmeRetryInterval)
+
+		return m.status.NextRenewal
+	}
+
+	log.Info("acme: obtained certificate for %q", m.domains)
+
+	m.status.LastError = ""
+	m.status.NextRenewal = time.Now().Add(acmeRetryInterval)
+	if cert, err = readFirstCert(m.certPath()); err == nil {
+		m.status.NextRenewal = cert.NotAfter.Add(-m.renewBefore)
+	}
+
+	return m.status.NextRenewal
+}
+
+// hasDomains returns true if cert is issued for the configured domains in any
+// order.
+func (m *acmeManager) hasDomains(cert *x509.Certificate) (ok bool) {
+	got, want := slices.Clone(cert.DNSNames), slices.Clone(m.domains)
+	slices.Sort(got)
+	slices.Sort(want)
+
+	return slices.Equal(got, want)
+}
+
+// setNext sets the time of the next renewal in the status.
+func (m *acmeManager) setNext(next time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status.NextRenewal = next
+}
+
+// obtain obtains a new certificate, saves it, and calls m.onCert.
+func (m *acmeManager) obtain() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeTimeout)
+	defer cancel()
+
+	chain, key, err := m.client.Obtain(ctx, m.domains)
+	if err != nil {
+		return err
+	}
+
+	// Write the key first, since the certificate file is used to detect the
+	// changes.
+	err = os.WriteFile(m.keyPath(), key, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+
+	err = os.WriteFile(m.certPath(), chain, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+
+	return m.onCert(m.certPath(), m.keyPath())
+}
+
+// readFirstCert reads and parses the first certificate from the PEM file at
+// path.
+func readFirstCert(path string) (cert *x509.Certificate, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("%s: no pem block", path)
+	}
+
+	return x509.ParseCertificate(b.Bytes)
+}
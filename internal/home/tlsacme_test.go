@@ -0,0 +1,173 @@
+package home
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACMEConfig_validate(t *testing.T) {
+	testCases := []struct {
+		conf       *acmeConfig
+		name       string
+		serverName string
+		wantErrMsg string
+	}{{
+		conf:       &acmeConfig{},
+		name:       "disabled",
+		serverName: "",
+		wantErrMsg: "",
+	}, {
+		conf: &acmeConfig{
+			Challenge: aghacme.ChallengeHTTP01,
+			Enabled:   true,
+		},
+		name:       "http01",
+		serverName: "dns.example.org",
+		wantErrMsg: "",
+	}, {
+		conf: &acmeConfig{
+			DNSProviderConfig: map[string]string{"endpoint": "https://dns-api.example.org"},
+			Challenge:         aghacme.ChallengeDNS01,
+			DNSProvider:       "httpreq",
+			Enabled:           true,
+		},
+		name:       "dns01",
+		serverName: "dns.example.org",
+		wantErrMsg: "",
+	}, {
+		conf: &acmeConfig{
+			Challenge: aghacme.ChallengeHTTP01,
+			Enabled:   true,
+		},
+		name:       "no_server_name",
+		serverName: "",
+		wantErrMsg: "server_name: must be set",
+	}, {
+		conf: &acmeConfig{
+			Challenge: "tls-alpn-01",
+			Enabled:   true,
+		},
+		name:       "bad_challenge",
+		serverName: "dns.example.org",
+		wantErrMsg: `challenge: bad value "tls-alpn-01"`,
+	}, {
+		conf: &acmeConfig{
+			Challenge:   aghacme.ChallengeDNS01,
+			DNSProvider: "httpreq",
+			Enabled:     true,
+		},
+		name:       "dns01_no_endpoint",
+		serverName: "dns.example.org",
+		wantErrMsg: `dns provider "httpreq": no endpoint`,
+	}, {
+		conf: &acmeConfig{
+			Challenge:   aghacme.ChallengeHTTP01,
+			RenewBefore: timeutil.Duration{Duration: -time.Hour},
+			Enabled:     true,
+		},
+		name:       "negative_renew_before",
+		serverName: "dns.example.org",
+		wantErrMsg: "renew_before: must not be negative, got -1h",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate(tc.serverName))
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate for domains expiring at
+// notAfter to path.
+func writeTestCert(t *testing.T, path string, domains []string, notAfter time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = os.WriteFile(path, data, 0o600)
+	require.NoError(t, err)
+}
+
+func TestACMEManager_renew(t *testing.T) {
+	domains := []string{"dns.example.org", "*.dns.example.org"}
+	notAfter := time.Now().Add(60 * timeutil.Day).Truncate(time.Second)
+
+	key, err := aghacme.NewKey()
+	require.NoError(t, err)
+
+	const errTest errors.Error = "test error"
+
+	m := &acmeManager{
+		client: aghacme.New(&aghacme.Config{
+			HTTPClient: &http.Client{
+				Transport: testRoundTripper(func(_ *http.Request) (*http.Response, error) {
+					return nil, errTest
+				}),
+			},
+			AccountKey: key,
+		}),
+		onCert:      func(_, _ string) (err error) { panic("not implemented") },
+		mu:          &sync.Mutex{},
+		status:      &acmeStatus{},
+		dir:         t.TempDir(),
+		domains:     domains,
+		renewBefore: acmeDefaultRenewBefore,
+	}
+
+	writeTestCert(t, filepath.Join(m.dir, acmeCertName), []string{domains[1], domains[0]}, notAfter)
+	require.True(t, m.hasCert())
+
+	want := notAfter.Add(-acmeDefaultRenewBefore)
+	next := m.renew()
+	assert.True(t, want.Equal(next), "got %s, want %s", next, want)
+	assert.True(t, want.Equal(m.getStatus().NextRenewal))
+
+	writeTestCert(t, filepath.Join(m.dir, acmeCertName), domains[:1], notAfter)
+	before := time.Now()
+	next = m.renew()
+	assert.False(t, next.Before(before.Add(acmeRetryInterval)))
+
+	st := m.getStatus()
+	assert.False(t, st.LastAttempt.Before(before))
+	assert.Contains(t, st.LastError, errTest.Error())
+}
+
+// testRoundTripper is an [http.RoundTripper] for tests.
+type testRoundTripper func(req *http.Request) (resp *http.Response, err error)
+
+// RoundTrip implements the [http.RoundTripper] interface for
+// testRoundTripper.
+func (rt testRoundTripper) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	return rt(req)
+}
@@ -0,0 +1,122 @@
+package home
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/verdictexport"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+	"golang.org/x/exp/slices"
+)
+
+// Verdict Export
+
+// initVerdictExport starts mirroring the query metadata to the enabled
+// endpoints from the configuration.  Context.verdictExport is left nil if there
+// are none.
+func initVerdictExport() {
+	m := verdictexport.NewManager(config.VerdictExport)
+	if m.Len() == 0 {
+		return
+	}
+
+	m.Start()
+	Context.verdictExport = m
+
+	log.Info("verdict export: %d endpoints enabled", m.Len())
+}
+
+// validateVerdictExportTags returns an error if any of the endpoints has an
+// unknown client tag.
+func validateVerdictExportTags(confs []*verdictexport.Config) (err error) {
+	for i, c := range confs {
+		for _, t := range c.Tags {
+			if !slices.Contains(clientTags, t) {
+				return fmt.Errorf("verdict export at index %d: tags: unknown tag %q", i, t)
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportQueryLog is a [querylog.QueryLog] which also mirrors the entries to the
+// verdict export endpoints.
+type exportQueryLog struct {
+	querylog.QueryLog
+
+	export *verdictexport.Manager
+}
+
+// type check
+var _ querylog.QueryLog = (*exportQueryLog)(nil)
+
+// Add implements the [querylog.QueryLog] interface for *exportQueryLog.
+func (l *exportQueryLog) Add(params *querylog.AddParams) {
+	l.QueryLog.Add(params)
+
+	if params.Question == nil || len(params.Question.Question) == 0 {
+		return
+	}
+
+	q := params.Question.Question[0]
+	r := &verdictexport.Record{
+		Time:     time.Now(),
+		ClientID: params.ClientID,
+		Domain:   strings.TrimSuffix(q.Name, "."),
+		QType:    dns.Type(q.Qtype).String(),
+		Verdict:  verdictexport.VerdictAllowed,
+		Reason:   filtering.NotFilteredNotFound.String(),
+	}
+
+	if params.ClientIP != nil {
+		r.ClientIP = params.ClientIP.String()
+	}
+
+	if res := params.Result; res != nil {
+		r.Verdict = resultVerdict(res)
+		r.Reason = res.Reason.String()
+		if len(res.Rules) > 0 {
+			r.Rule = res.Rules[0].Text
+		}
+	}
+
+	r.Tags = persistentClientTags(r.ClientID, r.ClientIP)
+
+	l.export.Export(r)
+}
+
+// resultVerdict returns the verdict of the filtering result.
+func resultVerdict(res *filtering.Result) (v verdictexport.Verdict) {
+	switch {
+	case res.IsFiltered:
+		return verdictexport.VerdictBlocked
+	case
+		res.Reason == filtering.Rewritten,
+		res.Reason == filtering.RewrittenAutoHosts,
+		res.Reason == filtering.RewrittenRule:
+		return verdictexport.VerdictRewritten
+	default:
+		return verdictexport.VerdictAllowed
+	}
+}
+
+// persistentClientTags returns the tags of the persistent client identified by
+// either its ClientID or its IP address, if any.
+func persistentClientTags(clientID, ip string) (tags []string) {
+	for _, id := range []string{clientID, ip} {
+		if id == "" {
+			continue
+		}
+
+		if c, ok := Context.clients.Find(id); ok {
+			return c.Tags
+		}
+	}
+
+	return nil
+}
@@ -3,9 +3,12 @@ package home
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"io/fs"
+	"net"
 	"net/http"
 	"net/netip"
+	"os"
 	"sync"
 	"time"
 
@@ -35,6 +38,11 @@ const (
 type webConfig struct {
 	clientFS fs.FS
 
+	// socketFile is the HTTP socket passed by systemd.  If it isn't nil, the
+	// plain HTTP server serves on it instead of listening on BindHost and
+	// BindPort.
+	socketFile *os.File
+
 	BindHost  netip.Addr
 	BindPort  int
 	PortHTTPS int
@@ -98,6 +106,7 @@ func newWeb(conf *webConfig) (w *Web) {
 
 	// if not configured, redirect / to /install.html, otherwise redirect /install.html to /
 	Context.mux.Handle("/", withMiddlewares(clientFS, gziphandler.GzipHandler, optionalAuthHandler, postInstallHandler))
+	registerHealthHandlers()
 
 	// add handlers for /install paths, we only need them when we're not configured yet
 	if conf.firstRun {
@@ -189,7 +198,7 @@ func (web *Web) Start() {
 		go func() {
 			defer log.OnPanic("web: plain")
 
-			errs <- web.httpServer.ListenAndServe()
+			errs <- web.serve()
 		}()
 
 		err := <-errs
@@ -203,6 +212,25 @@ func (web *Web) Start() {
 	}
 }
 
+// serve serves plain HTTP on the socket passed by systemd, if any, or on the
+// configured address.
+func (web *Web) serve() (err error) {
+	if web.conf.socketFile == nil {
+		return web.httpServer.ListenAndServe()
+	}
+
+	// Create the listener each time, since the server closes it on shutdown.
+	// The descriptor is duplicated, so the socket itself stays open.
+	l, err := net.FileListener(web.conf.socketFile)
+	if err != nil {
+		return fmt.Errorf("using systemd socket: %w", err)
+	}
+
+	log.Info("web: serving plain http on systemd socket %s", l.Addr())
+
+	return web.httpServer.Serve(l)
+}
+
 // Close gracefully shuts down the HTTP servers.
 func (web *Web) Close(ctx context.Context) {
 	log.Info("stopping http server...")
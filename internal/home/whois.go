@@ -24,6 +24,13 @@ const (
 	whoisTTL       = 1 * 60 * 60 // 1 hour
 )
 
+// whoisBatchSize is the maximum number of the queued IP addresses processed at
+// once.
+const whoisBatchSize = 64
+
+// dialContextFunc is the function dialing the network connections.
+type dialContextFunc = func(ctx context.Context, network, addr string) (conn net.Conn, err error)
+
 // WHOIS - module context
 type WHOIS struct {
 	clients *clientsContainer
@@ -31,7 +38,11 @@ type WHOIS struct {
 
 	// dialContext specifies the dial function for creating unencrypted TCP
 	// connections.
-	dialContext func(ctx context.Context, network, addr string) (conn net.Conn, err error)
+	dialContext dialContextFunc
+
+	// cache is the persistent cache of the WHOIS information of the
+	// netblocks.  It's only used by the worker goroutine.
+	cache *whoisCache
 
 	// Contains IP addresses of clients
 	// An active IP address is resolved once again after it expires.
@@ -42,8 +53,10 @@ type WHOIS struct {
 	timeoutMsec uint
 }
 
-// initWHOIS creates the WHOIS module context.
-func initWHOIS(clients *clientsContainer) *WHOIS {
+// initWHOIS creates the WHOIS module context.  dial is used to connect to the
+// WHOIS servers.  The information of the netblocks is persisted in the file at
+// cachePath, if it's not empty.
+func initWHOIS(clients *clientsContainer, dial dialContextFunc, cachePath string) *WHOIS {
 	w := WHOIS{
 		timeoutMsec: 5000,
 		clients:     clients,
@@ -51,8 +64,16 @@ func initWHOIS(clients *clientsContainer) *WHOIS {
 			EnableLRU: true,
 			MaxCount:  10000,
 		}),
-		dialContext: customDialContext,
-		ipChan:      make(chan netip.Addr, 255),
+		dialContext: dial,
+		cache: &whoisCache{
+			filePath: cachePath,
+		},
+		ipChan: make(chan netip.Addr, 255),
+	}
+
+	err := w.cache.load()
+	if err != nil {
+		log.Error("whois: loading cache: %s", err)
 	}
 
 	go w.workerLoop()
@@ -115,6 +136,8 @@ func whoisParse(data string) (m strmap) {
 		case "referralserver":
 			k = "whois"
 			v = strings.TrimPrefix(v, "whois://")
+		case "netrange", "inetnum", "inet6num":
+			k = "netblock"
 		default:
 			continue
 		}
@@ -192,13 +215,17 @@ func (w *WHOIS) queryAll(ctx context.Context, target string) (string, error) {
 	return "", fmt.Errorf("whois: redirect loop")
 }
 
-// Request WHOIS information
-func (w *WHOIS) process(ctx context.Context, ip netip.Addr) (wi *RuntimeClientWHOISInfo) {
+// process requests the WHOIS information of ip.  block is the netblock
+// containing ip with the same information, if the response has it.
+func (w *WHOIS) process(
+	ctx context.Context,
+	ip netip.Addr,
+) (wi *RuntimeClientWHOISInfo, block *whoisNetblock) {
 	resp, err := w.queryAll(ctx, ip.String())
 	if err != nil {
 		log.Debug("whois: error: %s  IP:%s", err, ip)
 
-		return nil
+		return nil, nil
 	}
 
 	log.Debug("whois: IP:%s  response: %d bytes", ip, len(resp))
@@ -214,10 +241,26 @@ func (w *WHOIS) process(ctx context.Context, ip netip.Addr) (wi *RuntimeClientWH
 	// Don't return an empty struct so that the frontend doesn't get
 	// confused.
 	if *wi == (RuntimeClientWHOISInfo{}) {
-		return nil
+		return nil, nil
 	}
 
-	return wi
+	nb, ok := m["netblock"]
+	if !ok {
+		return wi, nil
+	}
+
+	first, last, err := parseWHOISNetblock(nb)
+	if err != nil || !(&whoisNetblock{First: first, Last: last}).contains(ip) {
+		log.Debug("whois: bad netblock %q for %s: %v", nb, ip, err)
+
+		return wi, nil
+	}
+
+	return wi, &whoisNetblock{
+		Info:  wi,
+		First: first,
+		Last:  last,
+	}
 }
 
 // Begin - begin requesting WHOIS info
@@ -245,15 +288,57 @@ func (w *WHOIS) Begin(ip netip.Addr) {
 	}
 }
 
-// workerLoop processes the IP addresses it got from the channel and associates
-// the retrieving WHOIS info with a client.
+// workerLoop processes the IP addresses it got from the channel in batches and
+// associates the retrieving WHOIS info with a client.
 func (w *WHOIS) workerLoop() {
+	batch := make([]netip.Addr, 0, whoisBatchSize)
 	for ip := range w.ipChan {
-		info := w.process(context.Background(), ip)
-		if info == nil {
-			continue
+		batch = append(batch[:0], ip)
+	fill:
+		for len(batch) < whoisBatchSize {
+			select {
+			case ip = <-w.ipChan:
+				batch = append(batch, ip)
+			default:
+				break fill
+			}
 		}
 
-		w.clients.setWHOISInfo(ip, info)
+		w.processBatch(context.Background(), batch)
+	}
+}
+
+// processBatch associates the WHOIS info with the clients with the IP
+// addresses from batch.  The addresses from the already known netblocks,
+// including the ones looked up within the same batch, aren't looked up again.
+func (w *WHOIS) processBatch(ctx context.Context, batch []netip.Addr) {
+	changed := false
+	for _, ip := range batch {
+		now := time.Now()
+		info, ok := w.cache.find(ip, now)
+		if ok {
+			log.Debug("whois: found cached netblock for %s", ip)
+		} else {
+			var block *whoisNetblock
+			info, block = w.process(ctx, ip)
+			if block != nil {
+				block.Expires = now.Add(whoisCacheTTL)
+				w.cache.add(block, now)
+				changed = true
+			}
+		}
+
+		if info != nil {
+			w.clients.setWHOISInfo(ip, info)
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	err := w.cache.save()
+	if err != nil {
+		log.Error("whois: saving cache: %s", err)
 	}
 }
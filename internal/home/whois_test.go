@@ -137,6 +137,14 @@ func TestWHOISParse(t *testing.T) {
 		want: strmap{"whois": whois},
 		name: "referralserver",
 		in:   `referralserver: whois://` + whois,
+	}, {
+		want: strmap{"netblock": "192.0.2.0 - 192.0.2.255"},
+		name: "netrange",
+		in:   `NetRange: 192.0.2.0 - 192.0.2.255`,
+	}, {
+		want: strmap{"netblock": "2001:db8::/32"},
+		name: "inet6num",
+		in:   `inet6num: 2001:db8::/32`,
 	}, {
 		want: strmap{},
 		name: "other",
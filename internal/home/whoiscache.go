@@ -0,0 +1,185 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/google/renameio/maybe"
+	"golang.org/x/exp/slices"
+)
+
+// WHOIS Netblocks Cache
+
+// whoisCacheFile is the name of the file within the data directory, in which
+// the WHOIS information of the netblocks is persisted.
+const whoisCacheFile = "whois_cache.json"
+
+const (
+	// whoisCacheTTL is the time for which the WHOIS information of a netblock
+	// is reused.
+	whoisCacheTTL = 7 * 24 * time.Hour
+
+	// maxWHOISCacheLen is the maximum number of the cached netblocks.
+	maxWHOISCacheLen = 10_000
+)
+
+// whoisNetblock is the WHOIS information of a range of IP addresses.
+type whoisNetblock struct {
+	// Info is the WHOIS information of the addresses within the netblock.
+	Info *RuntimeClientWHOISInfo `json:"info"`
+
+	// Expires is the time after which the information isn't reused.
+	Expires time.Time `json:"expires"`
+
+	// First is the first address of the netblock.
+	First netip.Addr `json:"first"`
+
+	// Last is the last address of the netblock.
+	Last netip.Addr `json:"last"`
+}
+
+// contains returns true if ip is within b.
+func (b *whoisNetblock) contains(ip netip.Addr) (ok bool) {
+	return b.First.BitLen() == ip.BitLen() && b.First.Compare(ip) <= 0 && ip.Compare(b.Last) <= 0
+}
+
+// parseWHOISNetblock parses the netblock either in the range format, for
+// example "192.0.2.0 - 192.0.2.255", or in the CIDR format, for example
+// "2001:db8::/32".
+func parseWHOISNetblock(s string) (first, last netip.Addr, err error) {
+	if strings.Contains(s, "/") {
+		var p netip.Prefix
+		p, err = netip.ParsePrefix(strings.TrimSpace(s))
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, err
+		}
+
+		p = p.Masked()
+
+		return p.Addr(), lastPrefixAddr(p), nil
+	}
+
+	firstStr, lastStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("bad netblock %q", s)
+	}
+
+	first, err = netip.ParseAddr(strings.TrimSpace(firstStr))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+
+	last, err = netip.ParseAddr(strings.TrimSpace(lastStr))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+
+	if first.BitLen() != last.BitLen() || last.Less(first) {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("bad netblock %q", s)
+	}
+
+	return first, last, nil
+}
+
+// lastPrefixAddr returns the last address within the masked prefix p.
+func lastPrefixAddr(p netip.Prefix) (last netip.Addr) {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+
+	last, _ = netip.AddrFromSlice(b)
+
+	return last
+}
+
+// whoisCache is the persistent cache of the WHOIS information of the
+// netblocks, so that the lookups aren't repeated for the addresses from the
+// same netblock, including the ones made before a restart.  It's not safe for
+// concurrent use.
+type whoisCache struct {
+	// filePath is the path to the file the cache is persisted in.  If empty,
+	// the cache isn't persisted.
+	filePath string
+
+	// blocks are the cached netblocks ordered by the time of addition.
+	blocks []*whoisNetblock
+}
+
+// find returns the unexpired WHOIS information of the netblock containing ip.
+func (c *whoisCache) find(ip netip.Addr, now time.Time) (wi *RuntimeClientWHOISInfo, ok bool) {
+	for _, b := range c.blocks {
+		if b.contains(ip) && now.Before(b.Expires) {
+			return b.Info, true
+		}
+	}
+
+	return nil, false
+}
+
+// add caches b removing the expired netblocks and, if the cache is full, the
+// oldest ones.
+func (c *whoisCache) add(b *whoisNetblock, now time.Time) {
+	unexpired := c.blocks[:0]
+	for _, cb := range c.blocks {
+		if now.Before(cb.Expires) {
+			unexpired = append(unexpired, cb)
+		}
+	}
+
+	c.blocks = unexpired
+
+	if l := len(c.blocks); l >= maxWHOISCacheLen {
+		c.blocks = slices.Delete(c.blocks, 0, l-maxWHOISCacheLen+1)
+	}
+
+	c.blocks = append(c.blocks, b)
+}
+
+// load fills the cache with the netblocks from the file, if it exists.
+func (c *whoisCache) load() (err error) {
+	if c.filePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("reading cache file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &c.blocks)
+	if err != nil {
+		return fmt.Errorf("decoding cache file: %w", err)
+	}
+
+	return nil
+}
+
+// save writes the cached netblocks into the file.
+func (c *whoisCache) save() (err error) {
+	if c.filePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.blocks)
+	if err != nil {
+		return fmt.Errorf("encoding cache: %w", err)
+	}
+
+	err = maybe.WriteFile(c.filePath, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+
+	return nil
+}
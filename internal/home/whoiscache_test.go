@@ -0,0 +1,120 @@
+package home
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWHOISNetblock(t *testing.T) {
+	testCases := []struct {
+		wantFirst  netip.Addr
+		wantLast   netip.Addr
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		wantFirst:  netip.MustParseAddr("192.0.2.0"),
+		wantLast:   netip.MustParseAddr("192.0.2.255"),
+		name:       "range",
+		in:         "192.0.2.0 - 192.0.2.255",
+		wantErrMsg: "",
+	}, {
+		wantFirst:  netip.MustParseAddr("2001:db8::"),
+		wantLast:   netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"),
+		name:       "cidr",
+		in:         "2001:db8::1/32",
+		wantErrMsg: "",
+	}, {
+		wantFirst:  netip.Addr{},
+		wantLast:   netip.Addr{},
+		name:       "reversed",
+		in:         "192.0.2.255 - 192.0.2.0",
+		wantErrMsg: `bad netblock "192.0.2.255 - 192.0.2.0"`,
+	}, {
+		wantFirst:  netip.Addr{},
+		wantLast:   netip.Addr{},
+		name:       "no_range",
+		in:         "192.0.2.0",
+		wantErrMsg: `bad netblock "192.0.2.0"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, last, err := parseWHOISNetblock(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantFirst, first)
+			assert.Equal(t, tc.wantLast, last)
+		})
+	}
+}
+
+func TestWHOIS_processBatch(t *testing.T) {
+	const data = "OrgName:        FakeOrg LLC\n" +
+		"Country:        Imagiland\n" +
+		"NetRange:       192.0.2.0 - 192.0.2.255\n"
+
+	clients := &clientsContainer{
+		testing: true,
+	}
+	clients.Init(nil, nil, nil, nil, nil)
+
+	dials := 0
+	fc := &fakeConn{
+		data: []byte(data),
+	}
+	dial := func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		dials++
+
+		return fc.fakeDial(ctx, network, addr)
+	}
+
+	cachePath := filepath.Join(t.TempDir(), whoisCacheFile)
+	w := &WHOIS{
+		clients:     clients,
+		dialContext: dial,
+		cache: &whoisCache{
+			filePath: cachePath,
+		},
+		timeoutMsec: 5000,
+	}
+
+	first := netip.MustParseAddr("192.0.2.1")
+	second := netip.MustParseAddr("192.0.2.2")
+	w.processBatch(context.Background(), []netip.Addr{first, second})
+
+	assert.Equal(t, 1, dials)
+
+	want := &RuntimeClientWHOISInfo{
+		Country: "Imagiland",
+		Orgname: "FakeOrg LLC",
+	}
+	for _, ip := range []netip.Addr{first, second} {
+		rc, ok := clients.findRuntimeClient(ip)
+		require.True(t, ok)
+
+		assert.Equal(t, want, rc.WHOISInfo)
+	}
+
+	// Imitate a restart.
+	c := &whoisCache{
+		filePath: cachePath,
+	}
+	require.NoError(t, c.load())
+
+	wi, ok := c.find(netip.MustParseAddr("192.0.2.3"), time.Now())
+	require.True(t, ok)
+
+	assert.Equal(t, want, wi)
+
+	_, ok = c.find(netip.MustParseAddr("198.51.100.1"), time.Now())
+	assert.False(t, ok)
+}
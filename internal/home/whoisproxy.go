@@ -0,0 +1,185 @@
+package home
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/net/proxy"
+)
+
+// WHOIS Proxy
+
+// whoisDialer returns the function dialing the WHOIS servers.  If proxyURL is
+// empty, the servers are dialed directly.  Otherwise, the connections are made
+// through the proxy, if viaProxy is true, or the lookups are disabled, so that
+// the addresses of the clients don't leak past the proxy.  ok is false if the
+// lookups must be disabled.
+func whoisDialer(proxyURL string, viaProxy bool) (dial dialContextFunc, ok bool) {
+	if proxyURL == "" {
+		return customDialContext, true
+	} else if !viaProxy {
+		log.Info("whois: disabled, since http_proxy is set and whois_via_proxy is false")
+
+		return nil, false
+	}
+
+	dial, err := newProxyDialer(proxyURL, customDialContext)
+	if err != nil {
+		log.Error("whois: disabled: %s", err)
+
+		return nil, false
+	}
+
+	return dial, true
+}
+
+// newProxyDialer returns the function dialing the addresses through the proxy
+// at proxyURL.  The SOCKS5 and HTTP proxies are supported.  forward is used to
+// connect to the proxy itself.
+func newProxyDialer(proxyURL string, forward dialContextFunc) (dial dialContextFunc, err error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var d proxy.Dialer
+		d, err = proxy.FromURL(u, contextDialer(forward))
+		if err != nil {
+			return nil, fmt.Errorf("creating socks5 dialer: %w", err)
+		}
+
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("socks5 dialer %T doesn't support contexts", d)
+		}
+
+		return cd.DialContext, nil
+	case "http":
+		d := &connectDialer{
+			forward: forward,
+			proxy:   u,
+			timeout: defaultConnectTimeout,
+		}
+
+		return d.DialContext, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// contextDialer is a [proxy.ContextDialer] using the function to dial.
+type contextDialer dialContextFunc
+
+// type check
+var _ proxy.ContextDialer = contextDialer(nil)
+
+// Dial implements the [proxy.Dialer] interface for contextDialer.
+func (f contextDialer) Dial(network, addr string) (conn net.Conn, err error) {
+	return f(context.Background(), network, addr)
+}
+
+// DialContext implements the [proxy.ContextDialer] interface for
+// contextDialer.
+func (f contextDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	return f(ctx, network, addr)
+}
+
+// defaultConnectTimeout is the default timeout of establishing the tunnel
+// through an HTTP proxy.
+const defaultConnectTimeout = 10 * time.Second
+
+// connectDialer dials the addresses through an HTTP proxy using the CONNECT
+// method.
+type connectDialer struct {
+	// forward is used to connect to the proxy.
+	forward dialContextFunc
+
+	// proxy is the URL of the proxy, which may contain the credentials.
+	proxy *url.URL
+
+	// timeout is the timeout of establishing the tunnel.
+	timeout time.Duration
+}
+
+// DialContext dials addr through the proxy.  Only TCP is supported.
+func (d *connectDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (conn net.Conn, err error) {
+	proxyAddr := d.proxy.Host
+	if d.proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(d.proxy.Hostname(), "80")
+	}
+
+	conn, err = d.forward(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.WithDeferred(err, conn.Close())
+		}
+	}()
+
+	err = conn.SetDeadline(time.Now().Add(d.timeout))
+	if err != nil {
+		return nil, fmt.Errorf("setting deadline: %w", err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if user := d.proxy.User; user != nil {
+		pass, _ := user.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		return nil, fmt.Errorf("writing connect request: %w", err)
+	}
+
+	// The buffered reader doesn't consume any data past the response, since
+	// the tunneled protocols, such as WHOIS, wait for the client to write
+	// first.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, fmt.Errorf("reading connect response: %w", err)
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("closing connect response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("connect response: unexpected status %d", resp.StatusCode)
+	}
+
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("resetting deadline: %w", err)
+	}
+
+	return conn, nil
+}
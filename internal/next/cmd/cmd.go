@@ -16,8 +16,13 @@ import (
 	"github.com/AdguardTeam/golibs/log"
 )
 
-// Main is the entry point of application.
-func Main(clientBuildFS fs.FS) {
+// Main is the entry point of application.  openAPIFS must contain the OpenAPI
+// specifications of the HTTP APIs within the openapi directory.
+func Main(clientBuildFS, openAPIFS fs.FS) {
+	if len(os.Args) > 1 && os.Args[1] == cmdMigrateConfig {
+		os.Exit(migrateConfig(os.Args[2:]))
+	}
+
 	// Initial Configuration
 
 	start := time.Now()
@@ -29,13 +34,20 @@ func Main(clientBuildFS fs.FS) {
 
 	// Web Service
 
-	// TODO(a.garipov): Use in the Web service.
-	_ = clientBuildFS
+	frontend, err := fs.Sub(clientBuildFS, "build/static")
+	fatalOnError(err)
+
+	openAPI, err := fs.Sub(openAPIFS, "openapi")
+	fatalOnError(err)
 
-	// TODO(a.garipov): Set up configuration file name.
-	const confFile = "AdGuardHome.1.yaml"
+	confMgrConf := &configmgr.Config{
+		Frontend: frontend,
+		OpenAPI:  openAPI,
+		Start:    start,
+		FileName: confFile,
+	}
 
-	confMgr, err := configmgr.New(confFile, start)
+	confMgr, err := configmgr.New(confMgrConf)
 	fatalOnError(err)
 
 	web := confMgr.Web()
@@ -46,11 +58,20 @@ func Main(clientBuildFS fs.FS) {
 	err = dns.Start()
 	fatalOnError(err)
 
+	dhcp := confMgr.DHCP()
+	err = dhcp.Start()
+	fatalOnError(err)
+
+	ifaces := confMgr.IfaceWatcher()
+	err = ifaces.Start()
+	fatalOnError(err)
+
 	sigHdlr := newSignalHandler(
-		confFile,
-		start,
+		confMgrConf,
+		ifaces,
 		web,
 		dns,
+		dhcp,
 	)
 
 	go sigHdlr.handle()
@@ -58,6 +79,11 @@ func Main(clientBuildFS fs.FS) {
 	select {}
 }
 
+// confFile is the name of the configuration file.
+//
+// TODO(a.garipov): Set up configuration file name.
+const confFile = "AdGuardHome.1.yaml"
+
 // defaultTimeout is the timeout used for some operations where another timeout
 // hasn't been defined yet.
 const defaultTimeout = 15 * time.Second
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/next/configmgr"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Legacy Configuration Migration
+
+// cmdMigrateConfig is the name of the subcommand that converts the legacy
+// configuration file into the current one.
+const cmdMigrateConfig = "migrate-config"
+
+// legacyConfFile is the default name of the legacy configuration file.
+const legacyConfFile = "AdGuardHome.yaml"
+
+// migrateConfig runs the migrate-config subcommand with args and returns the
+// exit code.
+func migrateConfig(args []string) (code int) {
+	flags := flag.NewFlagSet(cmdMigrateConfig, flag.ContinueOnError)
+	in := flags.String("in", legacyConfFile, "path to the legacy configuration `file`")
+	out := flags.String("out", confFile, "path to the converted configuration `file`")
+	force := flags.Bool("force", false, "overwrite the converted configuration file if it exists")
+
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+
+		// Don't print the error, since the flag set has already done that.
+		return 2
+	}
+
+	unconvertible, err := migrateConfigFile(*in, *out, *force)
+	for _, u := range unconvertible {
+		fmt.Fprintf(os.Stderr, "not converted: %s\n", u)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cmdMigrateConfig, err)
+
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: converted %q into %q\n", cmdMigrateConfig, *in, *out)
+
+	return 0
+}
+
+// migrateConfigFile converts the legacy configuration file in and writes the
+// result into out.  If force is false, out must not exist.  unconvertible are
+// the descriptions of the legacy options that could not be converted.
+func migrateConfigFile(in, out string, force bool) (unconvertible []string, err error) {
+	legacy, err := os.ReadFile(in)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	conf, unconvertible, err := configmgr.MigrateLegacy(legacy)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return unconvertible, err
+	}
+
+	fileFlag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		fileFlag |= os.O_EXCL
+	}
+
+	f, err := os.OpenFile(out, fileFlag, 0o600)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return unconvertible, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	_, err = f.Write(conf)
+	if err != nil {
+		return unconvertible, fmt.Errorf("writing converted config: %w", err)
+	}
+
+	return unconvertible, nil
+}
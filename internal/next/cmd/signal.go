@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"os"
-	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
@@ -15,11 +14,9 @@ type signalHandler struct {
 	// signal is the channel to which OS signals are sent.
 	signal chan os.Signal
 
-	// confFile is the path to the configuration file.
-	confFile string
-
-	// start is the time at which AdGuard Home has been started.
-	start time.Time
+	// confMgrConf is the configuration of the configuration manager, which is
+	// used to recreate it on reconfiguration.
+	confMgrConf *configmgr.Config
 
 	// services are the services that are shut down before application exiting.
 	services []agh.Service
@@ -58,7 +55,7 @@ func (h *signalHandler) reconfigure() {
 	// reconfigured without the full shutdown, and the error handling is
 	// currently not the best.
 
-	confMgr, err := configmgr.New(h.confFile, h.start)
+	confMgr, err := configmgr.New(h.confMgrConf)
 	fatalOnError(err)
 
 	web := confMgr.Web()
@@ -69,7 +66,17 @@ func (h *signalHandler) reconfigure() {
 	err = dns.Start()
 	fatalOnError(err)
 
+	dhcp := confMgr.DHCP()
+	err = dhcp.Start()
+	fatalOnError(err)
+
+	ifaces := confMgr.IfaceWatcher()
+	err = ifaces.Start()
+	fatalOnError(err)
+
 	h.services = []agh.Service{
+		ifaces,
+		dhcp,
 		dns,
 		web,
 	}
@@ -103,12 +110,14 @@ func (h *signalHandler) shutdown() (status int) {
 }
 
 // newSignalHandler returns a new signalHandler that shuts down svcs.
-func newSignalHandler(confFile string, start time.Time, svcs ...agh.Service) (h *signalHandler) {
+func newSignalHandler(
+	confMgrConf *configmgr.Config,
+	svcs ...agh.Service,
+) (h *signalHandler) {
 	h = &signalHandler{
-		signal:   make(chan os.Signal, 1),
-		confFile: confFile,
-		start:    start,
-		services: svcs,
+		signal:      make(chan os.Signal, 1),
+		confMgrConf: confMgrConf,
+		services:    svcs,
 	}
 
 	aghos.NotifyShutdownSignal(h.signal)
@@ -1,8 +1,10 @@
 package configmgr
 
 import (
+	"io/fs"
 	"net/netip"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/timeutil"
 )
 
@@ -10,8 +12,10 @@ import (
 
 // config is the top-level on-disk configuration structure.
 type config struct {
-	DNS  *dnsConfig  `yaml:"dns"`
-	HTTP *httpConfig `yaml:"http"`
+	DHCP  *dhcpConfig   `yaml:"dhcp"`
+	DNS   *dnsConfig    `yaml:"dns"`
+	HTTP  *httpConfig   `yaml:"http"`
+	Users []*userConfig `yaml:"users"`
 	// TODO(a.garipov): Use.
 	SchemaVersion int `yaml:"schema_version"`
 	// TODO(a.garipov): Use.
@@ -19,11 +23,45 @@ type config struct {
 	Verbose    bool `yaml:"verbose"`
 }
 
+// dhcpConfig is the on-disk DHCP configuration.
+//
+// TODO(a.garipov): Validate.
+type dhcpConfig struct {
+	IPv4            *dhcpIPv4Config `yaml:"ipv4"`
+	IPv6            *dhcpIPv6Config `yaml:"ipv6"`
+	InterfaceName   string          `yaml:"interface_name"`
+	LocalDomainName string          `yaml:"local_domain_name"`
+	Enabled         bool            `yaml:"enabled"`
+}
+
+// dhcpIPv4Config is the on-disk DHCPv4 configuration.
+//
+// TODO(a.garipov): Validate.
+type dhcpIPv4Config struct {
+	GatewayIP     netip.Addr        `yaml:"gateway_ip"`
+	SubnetMask    netip.Addr        `yaml:"subnet_mask"`
+	RangeStart    netip.Addr        `yaml:"range_start"`
+	RangeEnd      netip.Addr        `yaml:"range_end"`
+	LeaseDuration timeutil.Duration `yaml:"lease_duration"`
+}
+
+// dhcpIPv6Config is the on-disk DHCPv6 configuration.
+//
+// TODO(a.garipov): Validate.
+type dhcpIPv6Config struct {
+	RangeStart    netip.Addr        `yaml:"range_start"`
+	LeaseDuration timeutil.Duration `yaml:"lease_duration"`
+}
+
 // dnsConfig is the on-disk DNS configuration.
 //
 // TODO(a.garipov): Validate.
 type dnsConfig struct {
 	Addresses       []netip.AddrPort  `yaml:"addresses"`
+	Interfaces      []*ifaceConfig    `yaml:"interfaces,omitempty"`
+	AllowedClients  []netip.Prefix    `yaml:"allowed_clients"`
+	BlockedClients  []netip.Prefix    `yaml:"blocked_clients"`
+	BlockedHosts    []string          `yaml:"blocked_hosts"`
 	BootstrapDNS    []string          `yaml:"bootstrap_dns"`
 	UpstreamDNS     []string          `yaml:"upstream_dns"`
 	UpstreamTimeout timeutil.Duration `yaml:"upstream_timeout"`
@@ -33,8 +71,79 @@ type dnsConfig struct {
 //
 // TODO(a.garipov): Validate.
 type httpConfig struct {
-	Addresses       []netip.AddrPort  `yaml:"addresses"`
-	SecureAddresses []netip.AddrPort  `yaml:"secure_addresses"`
-	Timeout         timeutil.Duration `yaml:"timeout"`
-	ForceHTTPS      bool              `yaml:"force_https"`
+	Addresses        []netip.AddrPort    `yaml:"addresses"`
+	SecureAddresses  []netip.AddrPort    `yaml:"secure_addresses"`
+	Interfaces       []*ifaceConfig      `yaml:"interfaces,omitempty"`
+	UnixSockets      []*unixSocketConfig `yaml:"unix_sockets"`
+	RateLimit        *rateLimitConfig    `yaml:"rate_limit"`
+	CORS             *corsConfig         `yaml:"cors"`
+	CSRF             *csrfConfig         `yaml:"csrf"`
+	Compression      *compressionConfig  `yaml:"compression"`
+	RequestLogFormat string              `yaml:"request_log_format"`
+	Timeout          timeutil.Duration   `yaml:"timeout"`
+	GracePeriod      timeutil.Duration   `yaml:"grace_period"`
+	ServeHTTP3       bool                `yaml:"serve_http3"`
+	ForceHTTPS       bool                `yaml:"force_https"`
+}
+
+// ifaceConfig is the on-disk configuration of a network interface, on all
+// addresses of which a service listens.  The service is rebound when the
+// addresses change.
+type ifaceConfig struct {
+	Name string `yaml:"name"`
+	Port uint16 `yaml:"port"`
+}
+
+// userConfig is the on-disk configuration of a user of the web API.
+type userConfig struct {
+	Name         string       `yaml:"name"`
+	PasswordHash string       `yaml:"password"`
+	Role         aghuser.Role `yaml:"role"`
+}
+
+// rateLimitConfig is the on-disk configuration of the per-IP rate limiting of
+// the web API.  Zero RPS means no limit.
+//
+// TODO(a.garipov): Validate.
+type rateLimitConfig struct {
+	Allowlist     []netip.Prefix    `yaml:"allowlist"`
+	BlockDuration timeutil.Duration `yaml:"block_duration"`
+	RPS           uint              `yaml:"rps"`
+}
+
+// unixSocketConfig is the on-disk configuration of a Unix domain socket for the
+// web API.
+//
+// TODO(a.garipov): Validate.
+type unixSocketConfig struct {
+	Path string      `yaml:"path"`
+	Mode fs.FileMode `yaml:"mode"`
+}
+
+// corsConfig is the on-disk CORS policy of the web API.
+//
+// TODO(a.garipov): Validate.
+type corsConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+}
+
+// csrfConfig is the on-disk configuration of the CSRF protection of the web
+// API.
+//
+// TODO(a.garipov): Validate.
+type csrfConfig struct {
+	TokenTTL timeutil.Duration `yaml:"token_ttl"`
+	Enabled  bool              `yaml:"enabled"`
+}
+
+// compressionConfig is the on-disk configuration of the response compression
+// of the web API.  Zero Level means the default compression level.
+//
+// TODO(a.garipov): Validate.
+type compressionConfig struct {
+	MIMETypes []string `yaml:"mime_types"`
+	MinSize   int      `yaml:"min_size"`
+	Level     int      `yaml:"level"`
+	Enabled   bool     `yaml:"enabled"`
 }
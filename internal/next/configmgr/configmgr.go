@@ -3,17 +3,26 @@
 package configmgr
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
 )
 
@@ -22,10 +31,33 @@ import (
 // Manager handles full and partial changes in the configuration, persisting
 // them to disk if necessary.
 type Manager struct {
+	// users are the users of the web service.  It is shared between all
+	// instances of the web service.
+	users *websvc.UserDB
+
+	// events are sent to the clients of the web service.  It is shared
+	// between all instances of the web service.
+	events *websvc.Events
+
+	// ifaces watches the addresses of the network interfaces the services
+	// listen on.  It is nil if there are no such interfaces.
+	ifaces *aghnet.IfaceWatcher
+
+	// dnsIfaces are the network interfaces the DNS service listens on.  It is
+	// only used by the goroutine of ifaces after the assembly.
+	dnsIfaces *ifaceListeners
+
+	// webIfaces are the network interfaces the web service listens on.  It is
+	// only used by the goroutine of ifaces after the assembly.
+	webIfaces *ifaceListeners
+
 	// updMu makes sure that at most one reconfiguration is performed at a time.
 	// updMu protects all fields below.
 	updMu *sync.RWMutex
 
+	// dhcp is the DHCP service.
+	dhcp *dhcpsvc.Service
+
 	// dns is the DNS service.
 	dns *dnssvc.Service
 
@@ -39,14 +71,31 @@ type Manager struct {
 	fileName string
 }
 
+// Config is the configuration of the configuration manager.
+type Config struct {
+	// Frontend is the filesystem containing the frontend assets.  It is passed
+	// to the web service.
+	Frontend fs.FS
+
+	// OpenAPI is the filesystem containing the OpenAPI specifications of the
+	// HTTP APIs.  It is passed to the web service.
+	OpenAPI fs.FS
+
+	// Start is the startup time of AdGuard Home.
+	Start time.Time
+
+	// FileName is the path to the configuration file.
+	FileName string
+}
+
 // New creates a new *Manager that persists changes to the file pointed to by
-// fileName.  It reads the configuration file and populates the service fields.
-// start is the startup time of AdGuard Home.
-func New(fileName string, start time.Time) (m *Manager, err error) {
+// c.FileName.  It reads the configuration file and populates the service
+// fields.  c must not be nil.
+func New(c *Config) (m *Manager, err error) {
 	defer func() { err = errors.Annotate(err, "reading config") }()
 
 	conf := &config{}
-	f, err := os.Open(fileName)
+	f, err := os.Open(c.FileName)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
 		return nil, err
@@ -68,18 +117,20 @@ func New(fileName string, start time.Time) (m *Manager, err error) {
 	// TODO(a.garipov): Validate the configuration structure.  Return an error
 	// if it's incorrect.
 
+	users, err := newUsers(conf.Users)
+	if err != nil {
+		return nil, fmt.Errorf("validating users: %w", err)
+	}
+
 	m = &Manager{
+		users:    websvc.NewUserDB(users),
+		events:   websvc.NewEvents(),
 		updMu:    &sync.RWMutex{},
 		current:  conf,
-		fileName: fileName,
+		fileName: c.FileName,
 	}
 
-	// TODO(a.garipov): Get the context with the timeout from the arguments?
-	const assemblyTimeout = 5 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), assemblyTimeout)
-	defer cancel()
-
-	err = m.assemble(ctx, conf, start)
+	err = m.assemble(conf, c)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
 		return nil, err
@@ -88,39 +139,322 @@ func New(fileName string, start time.Time) (m *Manager, err error) {
 	return m, nil
 }
 
-// assemble creates all services and puts them into the corresponding fields.
-// The fields of conf must not be modified after calling assemble.
-func (m *Manager) assemble(ctx context.Context, conf *config, start time.Time) (err error) {
-	dnsConf := &dnssvc.Config{
-		Addresses:        conf.DNS.Addresses,
-		BootstrapServers: conf.DNS.BootstrapDNS,
-		UpstreamServers:  conf.DNS.UpstreamDNS,
-		UpstreamTimeout:  conf.DNS.UpstreamTimeout.Duration,
+// assemble validates the configuration, creates all services, and puts them
+// into the corresponding fields.  The services are not started.  The fields of
+// conf must not be modified after calling assemble.
+func (m *Manager) assemble(conf *config, c *Config) (err error) {
+	dnsIfaceAddrs, webIfaceAddrs, err := m.assembleIfaces(conf)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
 	}
-	err = m.updateDNS(ctx, dnsConf)
+
+	dhcpConf := newDHCPConfig(conf.DHCP, filepath.Dir(c.FileName))
+	dhcpConf.OnLeaseAdded = m.onLeaseAdded
+	dhcpConf.OnLeaseEvent = m.onLeaseEvent
+	err = validateDHCPConfig(dhcpConf)
+	if err != nil {
+		return fmt.Errorf("validating dhcp config: %w", err)
+	}
+
+	m.dhcp, err = dhcpsvc.New(dhcpConf)
+	if err != nil {
+		return fmt.Errorf("assembling dhcpsvc: %w", err)
+	}
+
+	dnsConf := newDNSConfig(conf.DNS)
+	if dnsConf != nil {
+		dnsConf.Addresses = append(slices.Clone(dnsConf.Addresses), dnsIfaceAddrs...)
+	}
+
+	err = validateDNSConfig(dnsConf)
+	if err != nil {
+		return fmt.Errorf("validating dns config: %w", err)
+	}
+
+	m.dns, err = dnssvc.New(dnsConf)
 	if err != nil {
 		return fmt.Errorf("assembling dnssvc: %w", err)
 	}
 
+	csrf, err := newCSRFConfig(conf.HTTP.CSRF)
+	if err != nil {
+		return fmt.Errorf("assembling websvc: %w", err)
+	}
+
 	webSvcConf := &websvc.Config{
 		ConfigManager: m,
 		// TODO(a.garipov): Fill from config file.
-		TLS:             nil,
-		Start:           start,
-		Addresses:       conf.HTTP.Addresses,
-		SecureAddresses: conf.HTTP.SecureAddresses,
-		Timeout:         conf.HTTP.Timeout.Duration,
-		ForceHTTPS:      conf.HTTP.ForceHTTPS,
+		TLS:              nil,
+		RateLimiter:      newRateLimiter(conf.HTTP.RateLimit),
+		CORS:             newCORSConfig(conf.HTTP.CORS),
+		CSRF:             csrf,
+		Compression:      newCompressionConfig(conf.HTTP.Compression),
+		Users:            m.users,
+		Events:           m.events,
+		Frontend:         c.Frontend,
+		OpenAPI:          c.OpenAPI,
+		Start:            c.Start,
+		Addresses:        append(slices.Clone(conf.HTTP.Addresses), webIfaceAddrs...),
+		SecureAddresses:  conf.HTTP.SecureAddresses,
+		UnixSockets:      unixSockets(conf.HTTP.UnixSockets),
+		RequestLogFormat: websvc.RequestLogFormat(conf.HTTP.RequestLogFormat),
+		Timeout:          conf.HTTP.Timeout.Duration,
+		GracePeriod:      conf.HTTP.GracePeriod.Duration,
+		ServeHTTP3:       conf.HTTP.ServeHTTP3,
+		ForceHTTPS:       conf.HTTP.ForceHTTPS,
 	}
 
-	err = m.updateWeb(ctx, webSvcConf)
+	err = validateWebConfig(webSvcConf)
 	if err != nil {
-		return fmt.Errorf("assembling websvc: %w", err)
+		return fmt.Errorf("validating web config: %w", err)
 	}
 
+	m.web = websvc.New(webSvcConf)
+
 	return nil
 }
 
+// onLeaseAdded notifies the clients of the web service about a new DHCP lease.
+func (m *Manager) onLeaseAdded() {
+	m.events.Publish(&websvc.Event{
+		Type: websvc.EventTypeDHCPLeaseAdded,
+	})
+}
+
+// leaseEventTypes are the types of the events of the web service for the events
+// of the dynamic DHCP leases.  The granted leases are published by
+// [Manager.onLeaseAdded].
+var leaseEventTypes = map[dhcpd.LeaseEvent]websvc.EventType{
+	dhcpd.LeaseEventRenewed:  websvc.EventTypeDHCPLeaseRenewed,
+	dhcpd.LeaseEventReleased: websvc.EventTypeDHCPLeaseReleased,
+	dhcpd.LeaseEventDeclined: websvc.EventTypeDHCPLeaseDeclined,
+	dhcpd.LeaseEventExpired:  websvc.EventTypeDHCPLeaseExpired,
+}
+
+// onLeaseEvent notifies the clients of the web service about an event of a
+// dynamic DHCP lease.
+func (m *Manager) onLeaseEvent(e dhcpd.LeaseEvent, l *dhcpd.Lease) {
+	t, ok := leaseEventTypes[e]
+	if !ok {
+		return
+	}
+
+	m.events.Publish(&websvc.Event{
+		Data: &websvc.EventDHCPLease{
+			HWAddr:   l.HWAddr.String(),
+			Hostname: l.Hostname,
+			IP:       l.IP,
+		},
+		Type: t,
+	})
+}
+
+// publishConfigUpdated notifies the clients of the web service about the
+// update of the configuration of the service with the given name.
+func (m *Manager) publishConfigUpdated(svcName string) {
+	m.events.Publish(&websvc.Event{
+		Data: &websvc.EventConfigUpdated{
+			Service: svcName,
+		},
+		Type: websvc.EventTypeConfigUpdated,
+	})
+}
+
+// newDNSConfig returns the configuration of the DNS service.  If c is nil,
+// dnsConf is nil as well.
+func newDNSConfig(c *dnsConfig) (dnsConf *dnssvc.Config) {
+	if c == nil {
+		return nil
+	}
+
+	return &dnssvc.Config{
+		Addresses:        c.Addresses,
+		BootstrapServers: c.BootstrapDNS,
+		UpstreamServers:  c.UpstreamDNS,
+		AllowedClients:   c.AllowedClients,
+		BlockedClients:   c.BlockedClients,
+		BlockedHosts:     c.BlockedHosts,
+		UpstreamTimeout:  c.UpstreamTimeout.Duration,
+	}
+}
+
+// newDHCPConfig returns the configuration of the DHCP service, which stores its
+// data in workDir.  If c is nil, the DHCP service is disabled.
+func newDHCPConfig(c *dhcpConfig, workDir string) (dhcpConf *dhcpsvc.Config) {
+	if c == nil {
+		return &dhcpsvc.Config{
+			WorkDir: workDir,
+		}
+	}
+
+	dhcpConf = &dhcpsvc.Config{
+		InterfaceName:   c.InterfaceName,
+		LocalDomainName: c.LocalDomainName,
+		WorkDir:         workDir,
+		Enabled:         c.Enabled,
+	}
+
+	if c4 := c.IPv4; c4 != nil {
+		dhcpConf.IPv4 = &dhcpsvc.IPv4Config{
+			GatewayIP:     c4.GatewayIP,
+			SubnetMask:    c4.SubnetMask,
+			RangeStart:    c4.RangeStart,
+			RangeEnd:      c4.RangeEnd,
+			LeaseDuration: c4.LeaseDuration.Duration,
+		}
+	}
+
+	if c6 := c.IPv6; c6 != nil {
+		dhcpConf.IPv6 = &dhcpsvc.IPv6Config{
+			RangeStart:    c6.RangeStart,
+			LeaseDuration: c6.LeaseDuration.Duration,
+		}
+	}
+
+	return dhcpConf
+}
+
+// newUsers returns the users of the web service.  err is not nil if confs are
+// invalid.
+func newUsers(confs []*userConfig) (users []*websvc.User, err error) {
+	err = validateUsers(confs)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	for _, c := range confs {
+		users = append(users, &websvc.User{
+			Name:         c.Name,
+			PasswordHash: c.PasswordHash,
+			Role:         c.Role,
+		})
+	}
+
+	return users, nil
+}
+
+// newRateLimiter returns a new rate limiter for the web service or nil if the
+// rate limiting is disabled.
+func newRateLimiter(c *rateLimitConfig) (l *aghhttp.RateLimiter) {
+	if c == nil || c.RPS == 0 {
+		return nil
+	}
+
+	return aghhttp.NewRateLimiter(&aghhttp.RateLimiterConfig{
+		Allowlist:     c.Allowlist,
+		BlockDuration: c.BlockDuration.Duration,
+		RPS:           c.RPS,
+	})
+}
+
+// newCORSConfig returns the CORS policy for the web service or nil if c is nil.
+func newCORSConfig(c *corsConfig) (cors *websvc.CORSConfig) {
+	if c == nil {
+		return nil
+	}
+
+	return &websvc.CORSConfig{
+		AllowedOrigins: c.AllowedOrigins,
+		AllowedMethods: c.AllowedMethods,
+	}
+}
+
+// newCompressionConfig returns the response compression configuration for the
+// web service or nil if the compression is disabled.
+func newCompressionConfig(c *compressionConfig) (comp *websvc.CompressionConfig) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	return &websvc.CompressionConfig{
+		MIMETypes: c.MIMETypes,
+		MinSize:   c.MinSize,
+		Level:     level,
+	}
+}
+
+// csrfKeyLen is the length of the randomly generated CSRF token signing key.
+const csrfKeyLen = 32
+
+// newCSRFConfig returns the CSRF protection configuration for the web service
+// with a new random key or nil if the protection is disabled.
+func newCSRFConfig(c *csrfConfig) (csrf *websvc.CSRFConfig, err error) {
+	if c == nil || !c.Enabled {
+		return nil, nil
+	}
+
+	key := make([]byte, csrfKeyLen)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("generating csrf key: %w", err)
+	}
+
+	return &websvc.CSRFConfig{
+		Key:      key,
+		TokenTTL: c.TokenTTL.Duration,
+	}, nil
+}
+
+// unixSockets converts the on-disk Unix domain socket configurations into the
+// ones used by the web service.
+func unixSockets(confs []*unixSocketConfig) (socks []*websvc.UnixSocket) {
+	for _, c := range confs {
+		socks = append(socks, &websvc.UnixSocket{
+			Path: c.Path,
+			Mode: c.Mode,
+		})
+	}
+
+	return socks
+}
+
+// DHCP returns the current DHCP service.  It is safe for concurrent use.
+func (m *Manager) DHCP() (dhcp websvc.DHCPService) {
+	m.updMu.RLock()
+	defer m.updMu.RUnlock()
+
+	return m.dhcp
+}
+
+// UpdateDHCP implements the [websvc.ConfigManager] interface for *Manager.  The
+// fields of c must not be modified after calling UpdateDHCP.
+func (m *Manager) UpdateDHCP(
+	ctx context.Context,
+	c *dhcpsvc.Config,
+) (newSvc websvc.DHCPService, err error) {
+	m.updMu.Lock()
+	defer m.updMu.Unlock()
+
+	// TODO(a.garipov): Update and write the configuration file.  Return an
+	// error if something went wrong.
+
+	err = validateDHCPConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("validating dhcp config: %w", err)
+	}
+
+	svc, err := dhcpsvc.New(c)
+	if err != nil {
+		return nil, fmt.Errorf("creating dhcp svc: %w", err)
+	}
+
+	m.dhcp, err = swapService[*dhcpsvc.Config](ctx, m.dhcp, svc, dhcpsvc.New)
+	if err != nil {
+		return nil, fmt.Errorf("reassembling dhcpsvc: %w", err)
+	}
+
+	m.publishConfigUpdated("dhcp")
+
+	return m.dhcp, nil
+}
+
 // DNS returns the current DNS service.  It is safe for concurrent use.
 func (m *Manager) DNS() (dns agh.ServiceWithConfig[*dnssvc.Config]) {
 	m.updMu.RLock()
@@ -131,38 +465,34 @@ func (m *Manager) DNS() (dns agh.ServiceWithConfig[*dnssvc.Config]) {
 
 // UpdateDNS implements the [websvc.ConfigManager] interface for *Manager.  The
 // fields of c must not be modified after calling UpdateDNS.
-func (m *Manager) UpdateDNS(ctx context.Context, c *dnssvc.Config) (err error) {
+func (m *Manager) UpdateDNS(
+	ctx context.Context,
+	c *dnssvc.Config,
+) (newSvc agh.ServiceWithConfig[*dnssvc.Config], err error) {
 	m.updMu.Lock()
 	defer m.updMu.Unlock()
 
 	// TODO(a.garipov): Update and write the configuration file.  Return an
 	// error if something went wrong.
 
-	err = m.updateDNS(ctx, c)
+	err = validateDNSConfig(c)
 	if err != nil {
-		return fmt.Errorf("reassembling dnssvc: %w", err)
+		return nil, fmt.Errorf("validating dns config: %w", err)
 	}
 
-	return nil
-}
-
-// updateDNS recreates the DNS service.  m.updMu is expected to be locked.
-func (m *Manager) updateDNS(ctx context.Context, c *dnssvc.Config) (err error) {
-	if prev := m.dns; prev != nil {
-		err = prev.Shutdown(ctx)
-		if err != nil {
-			return fmt.Errorf("shutting down dns svc: %w", err)
-		}
+	svc, err := dnssvc.New(c)
+	if err != nil {
+		return nil, fmt.Errorf("creating dns svc: %w", err)
 	}
 
-	svc, err := dnssvc.New(c)
+	m.dns, err = swapService[*dnssvc.Config](ctx, m.dns, svc, dnssvc.New)
 	if err != nil {
-		return fmt.Errorf("creating dns svc: %w", err)
+		return nil, fmt.Errorf("reassembling dnssvc: %w", err)
 	}
 
-	m.dns = svc
+	m.publishConfigUpdated("dns")
 
-	return nil
+	return m.dns, nil
 }
 
 // Web returns the current web service.  It is safe for concurrent use.
@@ -175,31 +505,112 @@ func (m *Manager) Web() (web agh.ServiceWithConfig[*websvc.Config]) {
 
 // UpdateWeb implements the [websvc.ConfigManager] interface for *Manager.  The
 // fields of c must not be modified after calling UpdateWeb.
-func (m *Manager) UpdateWeb(ctx context.Context, c *websvc.Config) (err error) {
+func (m *Manager) UpdateWeb(
+	ctx context.Context,
+	c *websvc.Config,
+) (newSvc agh.ServiceWithConfig[*websvc.Config], err error) {
 	m.updMu.Lock()
 	defer m.updMu.Unlock()
 
 	// TODO(a.garipov): Update and write the configuration file.  Return an
 	// error if something went wrong.
 
-	err = m.updateWeb(ctx, c)
+	err = validateWebConfig(c)
 	if err != nil {
-		return fmt.Errorf("reassembling websvc: %w", err)
+		return nil, fmt.Errorf("validating web config: %w", err)
 	}
 
-	return nil
+	newWeb := func(c *websvc.Config) (svc *websvc.Service, err error) {
+		return websvc.New(c), nil
+	}
+
+	m.web, err = swapService[*websvc.Config](ctx, m.web, websvc.New(c), newWeb)
+	if err != nil {
+		return nil, fmt.Errorf("reassembling websvc: %w", err)
+	}
+
+	m.publishConfigUpdated("http")
+
+	return m.web, nil
 }
 
-// updateWeb recreates the web service.  m.upd is expected to be locked.
-func (m *Manager) updateWeb(ctx context.Context, c *websvc.Config) (err error) {
-	if prev := m.web; prev != nil {
-		err = prev.Shutdown(ctx)
-		if err != nil {
-			return fmt.Errorf("shutting down web svc: %w", err)
-		}
+// MigrateLegacy implements the [websvc.ConfigManager] interface for *Manager.
+// See [MigrateLegacy].
+func (m *Manager) MigrateLegacy(
+	legacy []byte,
+) (conf []byte, unconvertible []string, err error) {
+	return MigrateLegacy(legacy)
+}
+
+// svcStartTimeout is the maximum duration of the start of a new service during
+// a reconfiguration.
+const svcStartTimeout = 10 * time.Second
+
+// swapService shuts down prev and starts next instead.  If next fails to start
+// within svcStartTimeout, swapService shuts it down and restores the previous
+// service by creating it with newSvc from the configuration of prev.  cur is
+// the service that is running after the swap, which is either next or the
+// restored one.  err is not nil if next has failed to start, even if the
+// rollback has succeeded.
+func swapService[C any, S agh.ServiceWithConfig[C]](
+	ctx context.Context,
+	prev S,
+	next S,
+	newSvc func(c C) (svc S, err error),
+) (cur S, err error) {
+	prevConf := prev.Config()
+	err = prev.Shutdown(ctx)
+	if err != nil {
+		return prev, fmt.Errorf("shutting down previous svc: %w", err)
 	}
 
-	m.web = websvc.New(c)
+	startErr := startWithTimeout(ctx, next)
+	if startErr == nil {
+		return next, nil
+	}
 
-	return nil
+	log.Error("configmgr: starting new svc: %s; rolling back", startErr)
+
+	errs := []error{startErr}
+	err = next.Shutdown(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("shutting down new svc: %w", err))
+	}
+
+	cur, err = newSvc(prevConf)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("recreating previous svc: %w", err))
+
+		return prev, errors.List("starting new svc", errs...)
+	}
+
+	err = startWithTimeout(ctx, cur)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("restarting previous svc: %w", err))
+	} else {
+		log.Info("configmgr: restored previous svc")
+	}
+
+	return cur, errors.List("starting new svc", errs...)
+}
+
+// startWithTimeout starts svc and waits for it to start for at most
+// svcStartTimeout.
+func startWithTimeout(ctx context.Context, svc agh.Service) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, svcStartTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer log.OnPanic("configmgr: starting svc")
+
+		errCh <- svc.Start()
+	}()
+
+	select {
+	case err = <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for svc to start: %w", ctx.Err())
+	}
 }
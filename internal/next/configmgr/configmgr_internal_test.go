@@ -0,0 +1,97 @@
+package configmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	testutil.DiscardLogOutput(m)
+}
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testConfig is the service configuration type for tests.
+type testConfig struct {
+	name string
+}
+
+// testService is the service type for tests.
+type testService = *aghtest.ServiceWithConfig[*testConfig]
+
+// newTestService returns a new test service with configuration c, which
+// returns startErr from Start and records its starts and shutdowns into log.
+func newTestService(c *testConfig, startErr error, log *[]string) (svc testService) {
+	return &aghtest.ServiceWithConfig[*testConfig]{
+		OnStart: func() (err error) {
+			*log = append(*log, "start "+c.name)
+
+			return startErr
+		},
+		OnShutdown: func(_ context.Context) (err error) {
+			*log = append(*log, "shutdown "+c.name)
+
+			return nil
+		},
+		OnConfig: func() (conf *testConfig) { return c },
+	}
+}
+
+func TestSwapService(t *testing.T) {
+	const errStart errors.Error = "start error"
+
+	testCases := []struct {
+		nextErr error
+		name    string
+		wantCur string
+		wantErr string
+		wantLog []string
+	}{{
+		nextErr: nil,
+		name:    "success",
+		wantCur: "next",
+		wantErr: "",
+		wantLog: []string{"shutdown prev", "start next"},
+	}, {
+		nextErr: errStart,
+		name:    "rollback",
+		wantCur: "prev",
+		wantErr: "starting new svc: start error",
+		wantLog: []string{
+			"shutdown prev",
+			"start next",
+			"shutdown next",
+			"start prev",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var log []string
+			prev := newTestService(&testConfig{name: "prev"}, nil, &log)
+			next := newTestService(&testConfig{name: "next"}, tc.nextErr, &log)
+			newSvc := func(c *testConfig) (svc testService, err error) {
+				return newTestService(c, nil, &log), nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			t.Cleanup(cancel)
+
+			cur, err := swapService[*testConfig](ctx, prev, next, newSvc)
+			testutil.AssertErrorMsg(t, tc.wantErr, err)
+
+			require.NotNil(t, cur)
+
+			assert.Equal(t, tc.wantCur, cur.Config().name)
+			assert.Equal(t, tc.wantLog, log)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package configmgr
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+)
+
+// Network Interface Rebinding
+
+// ifaceRebindTimeout is the timeout of a rebinding of a service after a change
+// of the addresses of a network interface.
+const ifaceRebindTimeout = 30 * time.Second
+
+// ifaceListeners are the network interfaces on which a service listens, and the
+// addresses with ports it currently listens on because of them.
+type ifaceListeners struct {
+	// confs are the configurations of the interfaces.
+	confs []*ifaceConfig
+
+	// addrs are the addresses with ports of the interfaces the service has
+	// been bound to.
+	addrs []netip.AddrPort
+}
+
+// has returns true if l contains an interface with the given name.  l may be
+// nil.
+func (l *ifaceListeners) has(name string) (ok bool) {
+	if l == nil {
+		return false
+	}
+
+	return slices.IndexFunc(l.confs, func(c *ifaceConfig) (ok bool) {
+		return c.Name == name
+	}) >= 0
+}
+
+// replace returns cur with the addresses of l replaced with newAddrs.
+func (l *ifaceListeners) replace(cur, newAddrs []netip.AddrPort) (addrs []netip.AddrPort) {
+	for _, a := range cur {
+		if !slices.Contains(l.addrs, a) {
+			addrs = append(addrs, a)
+		}
+	}
+
+	return append(addrs, newAddrs...)
+}
+
+// ifaceAddrPorts returns the addresses with the ports of the interfaces of confs
+// using ifaceAddrs to get their addresses.
+func ifaceAddrPorts(
+	confs []*ifaceConfig,
+	ifaceAddrs func(name string) (addrs []netip.Addr),
+) (addrPorts []netip.AddrPort) {
+	for _, c := range confs {
+		for _, a := range ifaceAddrs(c.Name) {
+			addrPorts = append(addrPorts, netip.AddrPortFrom(a, c.Port))
+		}
+	}
+
+	return addrPorts
+}
+
+// validateIfaces returns an error if confs contain invalid or duplicated
+// interfaces.
+func validateIfaces(confs []*ifaceConfig) (err error) {
+	names := make(map[string]struct{}, len(confs))
+	for i, c := range confs {
+		if c == nil {
+			return fmt.Errorf("at index %d: %w", i, errNoValue)
+		} else if c.Name == "" {
+			return fmt.Errorf("at index %d: name: %w", i, errNoValue)
+		} else if c.Port == 0 {
+			return fmt.Errorf("at index %d: port: %w", i, errNoValue)
+		} else if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("at index %d: duplicated name %q", i, c.Name)
+		}
+
+		names[c.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// assembleIfaces validates the configurations of the interfaces in conf and
+// creates the watcher of their addresses, if there are any.  dnsIfaceAddrs and
+// webIfaceAddrs are the current addresses with ports of the interfaces of the
+// services.
+func (m *Manager) assembleIfaces(
+	conf *config,
+) (dnsIfaceAddrs, webIfaceAddrs []netip.AddrPort, err error) {
+	var dnsIfaces, webIfaces []*ifaceConfig
+	if conf.DNS != nil {
+		dnsIfaces = conf.DNS.Interfaces
+	}
+
+	if conf.HTTP != nil {
+		webIfaces = conf.HTTP.Interfaces
+	}
+
+	err = validateIfaces(dnsIfaces)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validating dns config: interfaces: %w", err)
+	}
+
+	err = validateIfaces(webIfaces)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validating web config: interfaces: %w", err)
+	}
+
+	if len(dnsIfaces)+len(webIfaces) == 0 {
+		return nil, nil, nil
+	}
+
+	names := make([]string, 0, len(dnsIfaces)+len(webIfaces))
+	for _, c := range append(slices.Clone(dnsIfaces), webIfaces...) {
+		if !slices.Contains(names, c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+
+	m.ifaces = aghnet.NewIfaceWatcher(&aghnet.IfaceWatcherConfig{
+		OnChange: m.onIfaceChange,
+		Names:    names,
+	})
+
+	m.dnsIfaces = &ifaceListeners{
+		confs: dnsIfaces,
+		addrs: ifaceAddrPorts(dnsIfaces, m.ifaces.Addrs),
+	}
+
+	m.webIfaces = &ifaceListeners{
+		confs: webIfaces,
+		addrs: ifaceAddrPorts(webIfaces, m.ifaces.Addrs),
+	}
+
+	return m.dnsIfaces.addrs, m.webIfaces.addrs, nil
+}
+
+// IfaceWatcher returns the service watching the addresses of the network
+// interfaces the services listen on.  It must be started after the other
+// services.
+func (m *Manager) IfaceWatcher() (w agh.Service) {
+	if m.ifaces == nil {
+		return agh.EmptyService{}
+	}
+
+	return m.ifaces
+}
+
+// onIfaceChange notifies the clients of the web service about the change of the
+// addresses of the interface with the given name and rebinds the services
+// listening on it.
+func (m *Manager) onIfaceChange(name string, addrs []netip.Addr) {
+	m.events.Publish(&websvc.Event{
+		Data: &websvc.EventInterfaceChanged{
+			Name:      name,
+			Addresses: addrs,
+		},
+		Type: websvc.EventTypeInterfaceChanged,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), ifaceRebindTimeout)
+	defer cancel()
+
+	if m.dnsIfaces.has(name) {
+		m.rebindDNS(ctx)
+	}
+
+	if m.webIfaces.has(name) {
+		m.rebindWeb(ctx)
+	}
+}
+
+// rebindDNS restarts the DNS service with the current addresses of its
+// interfaces.
+func (m *Manager) rebindDNS(ctx context.Context) {
+	addrs := ifaceAddrPorts(m.dnsIfaces.confs, m.ifaces.Addrs)
+	log.Info("configmgr: rebinding dns to interface addresses %s", addrs)
+
+	c := m.DNS().Config()
+	c.Addresses = m.dnsIfaces.replace(c.Addresses, addrs)
+
+	_, err := m.UpdateDNS(ctx, c)
+	if err != nil {
+		log.Error("configmgr: rebinding dns: %s", err)
+
+		return
+	}
+
+	m.dnsIfaces.addrs = addrs
+}
+
+// rebindWeb restarts the web service with the current addresses of its
+// interfaces.
+func (m *Manager) rebindWeb(ctx context.Context) {
+	addrs := ifaceAddrPorts(m.webIfaces.confs, m.ifaces.Addrs)
+	log.Info("configmgr: rebinding web to interface addresses %s", addrs)
+
+	c := m.Web().Config()
+	c.Addresses = m.webIfaces.replace(c.Addresses, addrs)
+
+	_, err := m.UpdateWeb(ctx, c)
+	if err != nil {
+		log.Error("configmgr: rebinding web: %s", err)
+
+		return
+	}
+
+	m.webIfaces.addrs = addrs
+}
@@ -0,0 +1,74 @@
+package configmgr
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateIfaces(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*ifaceConfig
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		confs:      []*ifaceConfig{{Name: "eth0", Port: 53}, {Name: "eth0.10", Port: 53}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "at index 0: no value",
+		confs:      []*ifaceConfig{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "at index 0: name: no value",
+		confs:      []*ifaceConfig{{Port: 53}},
+	}, {
+		name:       "no_port",
+		wantErrMsg: "at index 0: port: no value",
+		confs:      []*ifaceConfig{{Name: "eth0"}},
+	}, {
+		name:       "duplicated",
+		wantErrMsg: `at index 1: duplicated name "eth0"`,
+		confs:      []*ifaceConfig{{Name: "eth0", Port: 53}, {Name: "eth0", Port: 5353}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateIfaces(tc.confs))
+		})
+	}
+}
+
+func TestIfaceListeners(t *testing.T) {
+	ifaceAddrs := map[string][]netip.Addr{
+		"eth0": {netip.MustParseAddr("192.0.2.1")},
+		"wan0": {netip.MustParseAddr("198.51.100.1"), netip.MustParseAddr("2001:db8::1")},
+	}
+
+	l := &ifaceListeners{
+		confs: []*ifaceConfig{{Name: "eth0", Port: 53}, {Name: "wan0", Port: 5353}},
+	}
+
+	assert.True(t, l.has("wan0"))
+	assert.False(t, l.has("eth1"))
+
+	l.addrs = ifaceAddrPorts(l.confs, func(name string) (addrs []netip.Addr) {
+		return ifaceAddrs[name]
+	})
+	assert.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.1:53"),
+		netip.MustParseAddrPort("198.51.100.1:5353"),
+		netip.MustParseAddrPort("[2001:db8::1]:5353"),
+	}, l.addrs)
+
+	static := netip.MustParseAddrPort("127.0.0.1:53")
+	newAddr := netip.MustParseAddrPort("198.51.100.2:5353")
+	got := l.replace(append([]netip.AddrPort{static}, l.addrs...), []netip.AddrPort{newAddr})
+	assert.Equal(t, []netip.AddrPort{static, newAddr}, got)
+
+	var nilListeners *ifaceListeners
+	assert.False(t, nilListeners.has("eth0"))
+}
@@ -0,0 +1,375 @@
+package configmgr
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// Legacy Configuration Migration
+
+// legacyConfig is the part of the legacy on-disk configuration that can be
+// converted into the current one.
+type legacyConfig struct {
+	HTTPRateLimit *legacyRateLimitConfig `yaml:"http_rate_limit"`
+	DNS           *legacyDNSConfig       `yaml:"dns"`
+	DHCP          *legacyDHCPConfig      `yaml:"dhcp"`
+	Users         []*legacyUser          `yaml:"users"`
+	BindHost      netip.Addr             `yaml:"bind_host"`
+	BindPort      uint16                 `yaml:"bind_port"`
+	DebugPProf    bool                   `yaml:"debug_pprof"`
+	Verbose       bool                   `yaml:"verbose"`
+}
+
+// legacyUser is a legacy user of the web interface.  Empty Role means the admin
+// role.
+type legacyUser struct {
+	Name         string       `yaml:"name"`
+	PasswordHash string       `yaml:"password"`
+	Role         aghuser.Role `yaml:"role"`
+
+	// TOTP is only checked for presence, since the two-factor authentication
+	// isn't supported yet.
+	TOTP any `yaml:"totp"`
+}
+
+// legacyRateLimitConfig is the legacy configuration of the per-IP rate
+// limiting of the HTTP API.
+type legacyRateLimitConfig struct {
+	Allowlist     []netip.Prefix    `yaml:"allowlist"`
+	BlockDuration timeutil.Duration `yaml:"block_duration"`
+	RPS           uint              `yaml:"rps"`
+}
+
+// legacyDNSConfig is the legacy DNS configuration.
+type legacyDNSConfig struct {
+	BindHosts         []netip.Addr      `yaml:"bind_hosts"`
+	UpstreamDNS       []string          `yaml:"upstream_dns"`
+	BootstrapDNS      []string          `yaml:"bootstrap_dns"`
+	AllowedClients    []string          `yaml:"allowed_clients"`
+	DisallowedClients []string          `yaml:"disallowed_clients"`
+	BlockedHosts      []string          `yaml:"blocked_hosts"`
+	UpstreamTimeout   timeutil.Duration `yaml:"upstream_timeout"`
+	Port              uint16            `yaml:"port"`
+}
+
+// legacyDHCPConfig is the legacy DHCP configuration.
+type legacyDHCPConfig struct {
+	DHCPv4          *legacyDHCPv4Config `yaml:"dhcpv4"`
+	DHCPv6          *legacyDHCPv6Config `yaml:"dhcpv6"`
+	InterfaceName   string              `yaml:"interface_name"`
+	LocalDomainName string              `yaml:"local_domain_name"`
+	Enabled         bool                `yaml:"enabled"`
+}
+
+// legacyDHCPv4Config is the legacy DHCPv4 configuration.  LeaseDuration is in
+// seconds.
+type legacyDHCPv4Config struct {
+	GatewayIP     netip.Addr `yaml:"gateway_ip"`
+	SubnetMask    netip.Addr `yaml:"subnet_mask"`
+	RangeStart    netip.Addr `yaml:"range_start"`
+	RangeEnd      netip.Addr `yaml:"range_end"`
+	LeaseDuration uint32     `yaml:"lease_duration"`
+}
+
+// legacyDHCPv6Config is the legacy DHCPv6 configuration.  LeaseDuration is in
+// seconds.
+type legacyDHCPv6Config struct {
+	RangeStart    netip.Addr `yaml:"range_start"`
+	LeaseDuration uint32     `yaml:"lease_duration"`
+}
+
+// legacyConvertedKeys are the paths of the legacy configuration properties
+// that are converted.  The paths of the objects, which are converted only
+// partially, have the value of false.
+var legacyConvertedKeys = map[string]bool{
+	"bind_host":   true,
+	"bind_port":   true,
+	"debug_pprof": true,
+	"verbose":     true,
+
+	// The schema version of the legacy configuration doesn't make sense for
+	// the current one.
+	"schema_version": true,
+	"users":          true,
+
+	"http_rate_limit":                true,
+	"http_rate_limit.allowlist":      true,
+	"http_rate_limit.block_duration": true,
+	"http_rate_limit.rps":            true,
+
+	"dns":                    false,
+	"dns.bind_hosts":         true,
+	"dns.port":               true,
+	"dns.upstream_dns":       true,
+	"dns.bootstrap_dns":      true,
+	"dns.allowed_clients":    true,
+	"dns.disallowed_clients": true,
+	"dns.blocked_hosts":      true,
+	"dns.upstream_timeout":   true,
+
+	"dhcp":                       false,
+	"dhcp.enabled":               true,
+	"dhcp.interface_name":        true,
+	"dhcp.local_domain_name":     true,
+	"dhcp.dhcpv4":                false,
+	"dhcp.dhcpv4.gateway_ip":     true,
+	"dhcp.dhcpv4.subnet_mask":    true,
+	"dhcp.dhcpv4.range_start":    true,
+	"dhcp.dhcpv4.range_end":      true,
+	"dhcp.dhcpv4.lease_duration": true,
+	"dhcp.dhcpv6":                false,
+	"dhcp.dhcpv6.range_start":    true,
+	"dhcp.dhcpv6.lease_duration": true,
+}
+
+// Default values of the properties absent from the legacy configuration.
+const (
+	// legacyHTTPTimeout is the timeout of the web service, which is the same
+	// as the one of the legacy HTTP server.
+	legacyHTTPTimeout = 60 * time.Second
+
+	// legacyUpstreamTimeout is the default timeout of the legacy DNS
+	// upstreams.
+	legacyUpstreamTimeout = 10 * time.Second
+)
+
+// MigrateLegacy converts the legacy configuration file data into the current
+// configuration file data.  unconvertible are the descriptions of the legacy
+// options that could not be converted, sorted by path.  The converted
+// configuration is validated, so a non-nil err means that conf can't be used.
+func MigrateLegacy(legacy []byte) (conf []byte, unconvertible []string, err error) {
+	lc := &legacyConfig{}
+	err = yaml.Unmarshal(legacy, lc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding legacy config: %w", err)
+	}
+
+	raw := map[string]any{}
+	err = yaml.Unmarshal(legacy, &raw)
+	if err != nil {
+		// Technically shouldn't happen, since the data has already been
+		// decoded once.
+		return nil, nil, fmt.Errorf("decoding legacy config properties: %w", err)
+	}
+
+	unconvertible = unconvertedKeys(raw, "")
+
+	c, notes := convertLegacy(lc)
+	unconvertible = append(unconvertible, notes...)
+	slices.Sort(unconvertible)
+
+	err = validateMigrated(c)
+	if err != nil {
+		return nil, unconvertible, fmt.Errorf("validating converted config: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(c)
+	if err != nil {
+		return nil, unconvertible, fmt.Errorf("encoding converted config: %w", err)
+	}
+
+	return buf.Bytes(), unconvertible, nil
+}
+
+// unconvertedKeys returns the paths of the properties of obj, located at
+// prefix, that are not converted.
+func unconvertedKeys(obj map[string]any, prefix string) (keys []string) {
+	for _, k := range maps.Keys(obj) {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		full, ok := legacyConvertedKeys[path]
+		if !ok {
+			keys = append(keys, path+": not supported")
+
+			continue
+		} else if full {
+			continue
+		}
+
+		if sub, isObj := obj[k].(map[string]any); isObj {
+			keys = append(keys, unconvertedKeys(sub, path)...)
+		} else if obj[k] != nil {
+			keys = append(keys, path+": not supported")
+		}
+	}
+
+	return keys
+}
+
+// convertLegacy converts the legacy configuration lc into the current one.
+// notes are the descriptions of the values that could not be converted.
+func convertLegacy(lc *legacyConfig) (c *config, notes []string) {
+	c = &config{
+		DNS: &dnsConfig{
+			UpstreamTimeout: timeutil.Duration{Duration: legacyUpstreamTimeout},
+		},
+		HTTP: &httpConfig{
+			Timeout: timeutil.Duration{Duration: legacyHTTPTimeout},
+		},
+		DebugPprof: lc.DebugPProf,
+		Verbose:    lc.Verbose,
+	}
+
+	if lc.BindHost.IsValid() {
+		c.HTTP.Addresses = []netip.AddrPort{netip.AddrPortFrom(lc.BindHost, lc.BindPort)}
+	}
+
+	if rl := lc.HTTPRateLimit; rl != nil {
+		c.HTTP.RateLimit = &rateLimitConfig{
+			Allowlist:     rl.Allowlist,
+			BlockDuration: rl.BlockDuration,
+			RPS:           rl.RPS,
+		}
+	}
+
+	for i, u := range lc.Users {
+		if u.TOTP != nil {
+			notes = append(notes, fmt.Sprintf(
+				"users: at index %d: two-factor authentication is not supported",
+				i,
+			))
+		}
+
+		role := u.Role
+		if role == "" {
+			role = aghuser.RoleAdmin
+		}
+
+		c.Users = append(c.Users, &userConfig{
+			Name:         u.Name,
+			PasswordHash: u.PasswordHash,
+			Role:         role,
+		})
+	}
+
+	if ld := lc.DNS; ld != nil {
+		notes = append(notes, convertLegacyDNS(ld, c.DNS)...)
+	}
+
+	if ld := lc.DHCP; ld != nil {
+		c.DHCP = convertLegacyDHCP(ld)
+	}
+
+	return c, notes
+}
+
+// convertLegacyDNS converts the legacy DNS configuration ld into dc.  notes are
+// the descriptions of the values that could not be converted.
+func convertLegacyDNS(ld *legacyDNSConfig, dc *dnsConfig) (notes []string) {
+	for _, ip := range ld.BindHosts {
+		dc.Addresses = append(dc.Addresses, netip.AddrPortFrom(ip, ld.Port))
+	}
+
+	dc.UpstreamDNS = ld.UpstreamDNS
+	dc.BootstrapDNS = ld.BootstrapDNS
+	dc.BlockedHosts = ld.BlockedHosts
+	if ld.UpstreamTimeout.Duration > 0 {
+		dc.UpstreamTimeout = ld.UpstreamTimeout
+	}
+
+	var allowedNotes, blockedNotes []string
+	dc.AllowedClients, allowedNotes = convertLegacyClients(ld.AllowedClients, "dns.allowed_clients")
+	dc.BlockedClients, blockedNotes = convertLegacyClients(
+		ld.DisallowedClients,
+		"dns.disallowed_clients",
+	)
+
+	return append(allowedNotes, blockedNotes...)
+}
+
+// convertLegacyClients converts the IP addresses and CIDRs from the legacy
+// access list with the given path into subnets.  The ClientIDs are not
+// supported by the DNS service yet, so they are reported in notes.
+func convertLegacyClients(clients []string, path string) (subnets []netip.Prefix, notes []string) {
+	for i, s := range clients {
+		p, err := aghnet.ParseSubnet(s)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("%s: at index %d: clientid %q is not supported", path, i, s))
+
+			continue
+		}
+
+		subnets = append(subnets, p)
+	}
+
+	return subnets, notes
+}
+
+// convertLegacyDHCP converts the legacy DHCP configuration ld into the current
+// one.
+func convertLegacyDHCP(ld *legacyDHCPConfig) (dc *dhcpConfig) {
+	dc = &dhcpConfig{
+		InterfaceName:   ld.InterfaceName,
+		LocalDomainName: ld.LocalDomainName,
+		Enabled:         ld.Enabled,
+	}
+
+	if c4 := ld.DHCPv4; c4 != nil && c4.RangeStart.IsValid() {
+		dc.IPv4 = &dhcpIPv4Config{
+			GatewayIP:     c4.GatewayIP,
+			SubnetMask:    c4.SubnetMask,
+			RangeStart:    c4.RangeStart,
+			RangeEnd:      c4.RangeEnd,
+			LeaseDuration: timeutil.Duration{Duration: time.Duration(c4.LeaseDuration) * time.Second},
+		}
+	}
+
+	if c6 := ld.DHCPv6; c6 != nil && c6.RangeStart.IsValid() {
+		dc.IPv6 = &dhcpIPv6Config{
+			RangeStart:    c6.RangeStart,
+			LeaseDuration: timeutil.Duration{Duration: time.Duration(c6.LeaseDuration) * time.Second},
+		}
+	}
+
+	return dc
+}
+
+// validateMigrated returns an error if the converted configuration c is not
+// valid.  The properties of the web service that can't be converted from the
+// legacy configuration aren't validated.
+func validateMigrated(c *config) (err error) {
+	var errs []error
+
+	err = validateDHCPConfig(newDHCPConfig(c.DHCP, ""))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("dhcp: %w", err))
+	}
+
+	err = validateDNSConfig(newDNSConfig(c.DNS))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("dns: %w", err))
+	}
+
+	err = validateAddrPorts(c.HTTP.Addresses)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("http: addresses: %w", err))
+	}
+
+	err = validateUsers(c.Users)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("users: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return errors.List("invalid config", errs...)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package configmgr
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// testLegacyConfig is a part of a typical legacy configuration file.
+const testLegacyConfig = `
+bind_host: 127.0.0.1
+bind_port: 3000
+users:
+- name: admin
+  password: $2y$10$hash
+- name: viewer
+  password: $2y$10$hash
+  role: viewer
+  totp:
+    secret: c2VjcmV0
+    recovery_codes: []
+http_rate_limit:
+  rps: 10
+dns:
+  bind_hosts:
+  - 127.0.0.1
+  port: 53
+  upstream_dns:
+  - 8.8.8.8
+  bootstrap_dns:
+  - 1.1.1.1
+  upstream_timeout: 5s
+  allowed_clients:
+  - 192.168.1.0/24
+  - my-client
+  disallowed_clients:
+  - 10.0.0.1
+  blocked_hosts:
+  - version.bind
+  ratelimit: 20
+dhcp:
+  enabled: false
+  interface_name: eth0
+  local_domain_name: lan
+  dhcpv4:
+    gateway_ip: 192.168.1.1
+    subnet_mask: 255.255.255.0
+    range_start: 192.168.1.100
+    range_end: 192.168.1.200
+    lease_duration: 86400
+    icmp_timeout_msec: 1000
+  dhcpv6:
+    range_start: ""
+tls:
+  enabled: false
+verbose: true
+schema_version: 20
+`
+
+func TestMigrateLegacy(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		b, unconvertible, err := MigrateLegacy([]byte(testLegacyConfig))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			`dhcp.dhcpv4.icmp_timeout_msec: not supported`,
+			`dns.allowed_clients: at index 1: clientid "my-client" is not supported`,
+			`dns.ratelimit: not supported`,
+			`tls: not supported`,
+			`users: at index 1: two-factor authentication is not supported`,
+		}, unconvertible)
+
+		c := &config{}
+		err = yaml.Unmarshal(b, c)
+		require.NoError(t, err)
+
+		localhost := netip.MustParseAddr("127.0.0.1")
+		assert.Equal(t, []netip.AddrPort{netip.AddrPortFrom(localhost, 3000)}, c.HTTP.Addresses)
+		assert.Equal(t, 60*time.Second, c.HTTP.Timeout.Duration)
+		require.NotNil(t, c.HTTP.RateLimit)
+		assert.Equal(t, uint(10), c.HTTP.RateLimit.RPS)
+
+		assert.Equal(t, &dnsConfig{
+			Addresses:       []netip.AddrPort{netip.AddrPortFrom(localhost, 53)},
+			AllowedClients:  []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+			BlockedClients:  []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")},
+			BlockedHosts:    []string{"version.bind"},
+			BootstrapDNS:    []string{"1.1.1.1"},
+			UpstreamDNS:     []string{"8.8.8.8"},
+			UpstreamTimeout: timeutil.Duration{Duration: 5 * time.Second},
+		}, c.DNS)
+
+		require.NotNil(t, c.DHCP)
+		require.NotNil(t, c.DHCP.IPv4)
+
+		assert.Nil(t, c.DHCP.IPv6)
+		assert.Equal(t, "eth0", c.DHCP.InterfaceName)
+		assert.Equal(t, 24*time.Hour, c.DHCP.IPv4.LeaseDuration.Duration)
+		assert.True(t, c.Verbose)
+		assert.Equal(t, []*userConfig{{
+			Name:         "admin",
+			PasswordHash: "$2y$10$hash",
+			Role:         aghuser.RoleAdmin,
+		}, {
+			Name:         "viewer",
+			PasswordHash: "$2y$10$hash",
+			Role:         aghuser.RoleViewer,
+		}}, c.Users)
+	})
+
+	testCases := []struct {
+		name       string
+		legacy     string
+		wantErrMsg string
+	}{{
+		name:       "bad_yaml",
+		legacy:     "bind_port: [",
+		wantErrMsg: "decoding legacy config: yaml: line 1: did not find expected node content",
+	}, {
+		name:   "invalid",
+		legacy: "bind_host: 127.0.0.1\nbind_port: 3000\ndns:\n  bind_hosts:\n  - 127.0.0.1\n  port: 53\n",
+		wantErrMsg: "validating converted config: invalid config: dns: upstream_servers: " +
+			"no value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := MigrateLegacy([]byte(tc.legacy))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package configmgr
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Configuration Validation
+
+// errNoValue is returned by the validation functions when a required value is
+// missing.
+const errNoValue errors.Error = "no value"
+
+// validateDHCPConfig returns an error if c is not a valid configuration of the
+// DHCP service.  The details of the address ranges are validated by the
+// service itself.
+func validateDHCPConfig(c *dhcpsvc.Config) (err error) {
+	if c == nil {
+		return errNoValue
+	} else if !c.Enabled {
+		return nil
+	}
+
+	if c.InterfaceName == "" {
+		return fmt.Errorf("interface_name: %w", errNoValue)
+	}
+
+	if c.IPv4 == nil && c.IPv6 == nil {
+		return errors.Error("neither ipv4 nor ipv6 is configured")
+	}
+
+	if c4 := c.IPv4; c4 != nil {
+		if !c4.RangeStart.Is4() || !c4.RangeEnd.Is4() {
+			return fmt.Errorf("ipv4: bad range %s-%s", c4.RangeStart, c4.RangeEnd)
+		} else if c4.LeaseDuration <= 0 {
+			return fmt.Errorf("ipv4: lease_duration: must be positive, got %s", c4.LeaseDuration)
+		}
+	}
+
+	if c6 := c.IPv6; c6 != nil {
+		if !c6.RangeStart.Is6() {
+			return fmt.Errorf("ipv6: range_start: bad value %s", c6.RangeStart)
+		} else if c6.LeaseDuration <= 0 {
+			return fmt.Errorf("ipv6: lease_duration: must be positive, got %s", c6.LeaseDuration)
+		}
+	}
+
+	return nil
+}
+
+// validateDNSConfig returns an error if c is not a valid configuration of the
+// DNS service.
+func validateDNSConfig(c *dnssvc.Config) (err error) {
+	if c == nil {
+		return errNoValue
+	}
+
+	err = validateAddrPorts(c.Addresses)
+	if err != nil {
+		return fmt.Errorf("addresses: %w", err)
+	}
+
+	if len(c.UpstreamServers) == 0 && len(c.Upstreams) == 0 {
+		return fmt.Errorf("upstream_servers: %w", errNoValue)
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		return fmt.Errorf("upstream_timeout: must be positive, got %s", c.UpstreamTimeout)
+	}
+
+	return validateDNSAccess(c)
+}
+
+// validateDNSAccess returns an error if the access settings of c are invalid
+// or if a client is both allowed and blocked.
+func validateDNSAccess(c *dnssvc.Config) (err error) {
+	err = validatePrefixes(c.AllowedClients)
+	if err != nil {
+		return fmt.Errorf("allowed_clients: %w", err)
+	}
+
+	err = validatePrefixes(c.BlockedClients)
+	if err != nil {
+		return fmt.Errorf("blocked_clients: %w", err)
+	}
+
+	for _, a := range c.AllowedClients {
+		for _, b := range c.BlockedClients {
+			if a.Overlaps(b) {
+				return fmt.Errorf("allowed client %s conflicts with blocked client %s", a, b)
+			}
+		}
+	}
+
+	set := make(map[string]struct{}, len(c.BlockedHosts))
+	for i, h := range c.BlockedHosts {
+		if h == "" {
+			return fmt.Errorf("blocked_hosts: at index %d: %w", i, errNoValue)
+		} else if _, ok := set[h]; ok {
+			return fmt.Errorf("blocked_hosts: at index %d: duplicated value %q", i, h)
+		}
+
+		set[h] = struct{}{}
+	}
+
+	return nil
+}
+
+// validatePrefixes returns an error if prefixes contain invalid, non-masked, or
+// duplicated subnets.
+func validatePrefixes(prefixes []netip.Prefix) (err error) {
+	set := make(map[netip.Prefix]struct{}, len(prefixes))
+	for i, p := range prefixes {
+		if !p.IsValid() {
+			return fmt.Errorf("at index %d: bad subnet %q", i, p)
+		} else if p != p.Masked() {
+			return fmt.Errorf("at index %d: subnet %s is not masked", i, p)
+		} else if _, ok := set[p]; ok {
+			return fmt.Errorf("at index %d: duplicated subnet %s", i, p)
+		}
+
+		set[p] = struct{}{}
+	}
+
+	return nil
+}
+
+// validateWebConfig returns an error if c is not a valid configuration of the
+// web service.
+func validateWebConfig(c *websvc.Config) (err error) {
+	if c == nil {
+		return errNoValue
+	}
+
+	err = validateAddrPorts(c.Addresses)
+	if err != nil {
+		return fmt.Errorf("addresses: %w", err)
+	}
+
+	err = validateAddrPorts(c.SecureAddresses)
+	if err != nil {
+		return fmt.Errorf("secure_addresses: %w", err)
+	}
+
+	if len(c.SecureAddresses) > 0 && c.TLS == nil {
+		return errors.Error("secure_addresses: tls is not configured")
+	}
+
+	if c.ServeHTTP3 && len(c.SecureAddresses) == 0 {
+		return fmt.Errorf("serve_http3: secure_addresses: %w", errNoValue)
+	}
+
+	for i, sock := range c.UnixSockets {
+		if sock.Path == "" {
+			return fmt.Errorf("unix_sockets: at index %d: path: %w", i, errNoValue)
+		}
+	}
+
+	if len(c.Addresses)+len(c.SecureAddresses)+len(c.UnixSockets) == 0 {
+		return fmt.Errorf("addresses: %w", errNoValue)
+	}
+
+	switch f := c.RequestLogFormat; f {
+	case websvc.RequestLogFormatNone, websvc.RequestLogFormatLogfmt, websvc.RequestLogFormatJSON:
+		// Go on.
+	default:
+		return fmt.Errorf("request_log_format: bad value %q", f)
+	}
+
+	if c.CSRF != nil {
+		if len(c.CSRF.Key) == 0 {
+			return fmt.Errorf("csrf: key: %w", errNoValue)
+		} else if c.CSRF.TokenTTL <= 0 {
+			return fmt.Errorf("csrf: token_ttl: must be positive, got %s", c.CSRF.TokenTTL)
+		}
+	}
+
+	if comp := c.Compression; comp != nil {
+		if comp.MinSize < 0 {
+			return fmt.Errorf("compression: min_size: must not be negative, got %d", comp.MinSize)
+		} else if comp.Level != gzip.DefaultCompression &&
+			(comp.Level < gzip.HuffmanOnly || comp.Level > gzip.BestCompression) {
+			return fmt.Errorf("compression: level: bad value %d", comp.Level)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout: must be positive, got %s", c.Timeout)
+	}
+
+	if c.GracePeriod < 0 {
+		return fmt.Errorf("grace_period: must not be negative, got %s", c.GracePeriod)
+	}
+
+	return nil
+}
+
+// validateUsers returns an error if confs contain invalid or duplicated users
+// or if there are users but no admins.
+func validateUsers(confs []*userConfig) (err error) {
+	names := make(map[string]struct{}, len(confs))
+	hasAdmin := false
+	for i, c := range confs {
+		if c == nil {
+			return fmt.Errorf("at index %d: %w", i, errNoValue)
+		} else if c.Name == "" {
+			return fmt.Errorf("at index %d: name: %w", i, errNoValue)
+		} else if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("at index %d: duplicated name %q", i, c.Name)
+		} else if c.PasswordHash == "" {
+			return fmt.Errorf("at index %d: password: %w", i, errNoValue)
+		}
+
+		err = c.Role.Validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: role: %w", i, err)
+		}
+
+		names[c.Name] = struct{}{}
+		hasAdmin = hasAdmin || c.Role == aghuser.RoleAdmin
+	}
+
+	if len(confs) > 0 && !hasAdmin {
+		return errors.Error("no admins")
+	}
+
+	return nil
+}
+
+// validateAddrPorts returns an error if addrs contains invalid or duplicated
+// addresses.
+func validateAddrPorts(addrs []netip.AddrPort) (err error) {
+	set := make(map[netip.AddrPort]struct{}, len(addrs))
+	for i, a := range addrs {
+		if !a.IsValid() {
+			return fmt.Errorf("at index %d: bad address %q", i, a)
+		}
+
+		if a.Port() == 0 {
+			// Addresses with the port zero get a random available port, so
+			// they can't conflict.
+			continue
+		} else if _, ok := set[a]; ok {
+			return fmt.Errorf("at index %d: duplicated address %s", i, a)
+		}
+
+		set[a] = struct{}{}
+	}
+
+	return nil
+}
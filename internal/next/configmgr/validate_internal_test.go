@@ -0,0 +1,143 @@
+package configmgr
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
+	"github.com/AdguardTeam/golibs/testutil"
+)
+
+func TestValidateDNSAccess(t *testing.T) {
+	testCases := []struct {
+		conf       *dnssvc.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &dnssvc.Config{},
+		name:       "empty",
+		wantErrMsg: "",
+	}, {
+		conf: &dnssvc.Config{
+			AllowedClients: []netip.Prefix{netip.MustParsePrefix("1.2.3.0/24")},
+			BlockedClients: []netip.Prefix{netip.MustParsePrefix("4.5.6.7/32")},
+			BlockedHosts:   []string{"||example.com^"},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &dnssvc.Config{
+			AllowedClients: []netip.Prefix{{}},
+		},
+		name:       "bad_prefix",
+		wantErrMsg: `allowed_clients: at index 0: bad subnet "invalid Prefix"`,
+	}, {
+		conf: &dnssvc.Config{
+			BlockedClients: []netip.Prefix{netip.MustParsePrefix("1.2.3.4/24")},
+		},
+		name:       "not_masked",
+		wantErrMsg: `blocked_clients: at index 0: subnet 1.2.3.4/24 is not masked`,
+	}, {
+		conf: &dnssvc.Config{
+			BlockedClients: []netip.Prefix{
+				netip.MustParsePrefix("1.2.3.4/32"),
+				netip.MustParsePrefix("1.2.3.4/32"),
+			},
+		},
+		name:       "duplicate",
+		wantErrMsg: `blocked_clients: at index 1: duplicated subnet 1.2.3.4/32`,
+	}, {
+		conf: &dnssvc.Config{
+			AllowedClients: []netip.Prefix{netip.MustParsePrefix("1.2.3.0/24")},
+			BlockedClients: []netip.Prefix{netip.MustParsePrefix("1.2.3.4/32")},
+		},
+		name:       "conflict",
+		wantErrMsg: `allowed client 1.2.3.0/24 conflicts with blocked client 1.2.3.4/32`,
+	}, {
+		conf: &dnssvc.Config{
+			BlockedHosts: []string{"host", "host"},
+		},
+		name:       "duplicate_host",
+		wantErrMsg: `blocked_hosts: at index 1: duplicated value "host"`,
+	}, {
+		conf: &dnssvc.Config{
+			BlockedHosts: []string{""},
+		},
+		name:       "empty_host",
+		wantErrMsg: `blocked_hosts: at index 0: no value`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDNSAccess(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestValidateUsers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*userConfig
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		confs:      nil,
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		confs: []*userConfig{{
+			Name:         "admin",
+			PasswordHash: "hash",
+			Role:         aghuser.RoleAdmin,
+		}, {
+			Name:         "viewer",
+			PasswordHash: "hash",
+			Role:         aghuser.RoleViewer,
+		}},
+	}, {
+		name:       "no_admins",
+		wantErrMsg: "no admins",
+		confs: []*userConfig{{
+			Name:         "viewer",
+			PasswordHash: "hash",
+			Role:         aghuser.RoleViewer,
+		}},
+	}, {
+		name:       "bad_role",
+		wantErrMsg: `at index 0: role: bad role "root"`,
+		confs: []*userConfig{{
+			Name:         "root",
+			PasswordHash: "hash",
+			Role:         "root",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: duplicated name "admin"`,
+		confs: []*userConfig{{
+			Name:         "admin",
+			PasswordHash: "hash",
+			Role:         aghuser.RoleAdmin,
+		}, {
+			Name:         "admin",
+			PasswordHash: "hash",
+			Role:         aghuser.RoleViewer,
+		}},
+	}, {
+		name:       "no_password",
+		wantErrMsg: "at index 0: password: no value",
+		confs: []*userConfig{{
+			Name: "admin",
+			Role: aghuser.RoleAdmin,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateUsers(tc.confs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package dhcpsvc contains the AdGuard Home DHCP service.
+//
+// TODO(a.garipov): Rewrite the DHCP server instead of wrapping the legacy one.
+package dhcpsvc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"golang.org/x/exp/slices"
+)
+
+// Config is the AdGuard Home DHCP service configuration structure.
+type Config struct {
+	// IPv4 is the configuration of the DHCPv4 server.  If IPv4 is nil, the
+	// DHCPv4 server is disabled.
+	IPv4 *IPv4Config
+
+	// IPv6 is the configuration of the DHCPv6 server.  If IPv6 is nil, the
+	// DHCPv6 server is disabled.
+	IPv6 *IPv6Config
+
+	// InterfaceName is the name of the network interface to serve on.
+	InterfaceName string
+
+	// LocalDomainName is the domain name used for the DHCP hosts.
+	LocalDomainName string
+
+	// OnLeaseAdded is the optional function called when a dynamic or a static
+	// lease is added.
+	OnLeaseAdded func()
+
+	// OnLeaseEvent is the optional function called for the events of the
+	// dynamic leases, such as a renewed or an expired lease.
+	OnLeaseEvent dhcpd.OnLeaseEventT
+
+	// WorkDir is the directory in which the lease database is stored.
+	WorkDir string
+
+	// Enabled tells if the DHCP server should be started.
+	Enabled bool
+}
+
+// IPv4Config is the configuration of the DHCPv4 server.
+type IPv4Config struct {
+	// GatewayIP is the IP address of the gateway.
+	GatewayIP netip.Addr
+
+	// SubnetMask is the subnet mask of the served network.
+	SubnetMask netip.Addr
+
+	// RangeStart is the first address of the range of the dynamic leases.
+	RangeStart netip.Addr
+
+	// RangeEnd is the last address of the range of the dynamic leases.
+	RangeEnd netip.Addr
+
+	// LeaseDuration is the lifetime of the dynamic leases.
+	LeaseDuration time.Duration
+}
+
+// IPv6Config is the configuration of the DHCPv6 server.
+type IPv6Config struct {
+	// RangeStart is the first address of the range of the dynamic leases.
+	RangeStart netip.Addr
+
+	// LeaseDuration is the lifetime of the dynamic leases.
+	LeaseDuration time.Duration
+}
+
+// Service is the AdGuard Home DHCP service.  A nil *Service is a valid
+// [agh.Service] that does nothing.
+type Service struct {
+	srv     dhcpd.Interface
+	watcher *dhcpd.LeaseWatcher
+	conf    *Config
+}
+
+// New returns a new properly initialized *Service.  If c is nil, svc is a nil
+// *Service that does nothing.  The fields of c must not be modified after
+// calling New.
+func New(c *Config) (svc *Service, err error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	srvConf := &dhcpd.ServerConfig{
+		Enabled:         c.Enabled,
+		InterfaceName:   c.InterfaceName,
+		LocalDomainName: c.LocalDomainName,
+		Conf4: dhcpd.V4ServerConf{
+			LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
+			ICMPTimeout:   dhcpd.DefaultDHCPTimeoutICMP,
+		},
+		Conf6: dhcpd.V6ServerConf{
+			LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
+		},
+		WorkDir: c.WorkDir,
+	}
+
+	if c4 := c.IPv4; c4 != nil {
+		srvConf.Conf4.GatewayIP = c4.GatewayIP
+		srvConf.Conf4.SubnetMask = c4.SubnetMask
+		srvConf.Conf4.RangeStart = c4.RangeStart
+		srvConf.Conf4.RangeEnd = c4.RangeEnd
+		srvConf.Conf4.LeaseDuration = uint32(c4.LeaseDuration.Seconds())
+	}
+
+	if c6 := c.IPv6; c6 != nil {
+		srvConf.Conf6.RangeStart = net.IP(c6.RangeStart.AsSlice())
+		srvConf.Conf6.LeaseDuration = uint32(c6.LeaseDuration.Seconds())
+	}
+
+	srv, err := dhcpd.Create(srvConf)
+	if err != nil {
+		return nil, fmt.Errorf("creating dhcp server: %w", err)
+	}
+
+	if onAdded := c.OnLeaseAdded; onAdded != nil {
+		srv.SetOnLeaseChanged(func(flags int) {
+			if flags == dhcpd.LeaseChangedAdded || flags == dhcpd.LeaseChangedAddedStatic {
+				onAdded()
+			}
+		})
+	}
+
+	svc = &Service{
+		srv:  srv,
+		conf: c,
+	}
+
+	if onEvent := c.OnLeaseEvent; onEvent != nil {
+		svc.watcher = dhcpd.NewLeaseWatcher(srv, onEvent)
+		srv.SetOnLeaseChanged(svc.watcher.OnLeaseChanged)
+	}
+
+	return svc, nil
+}
+
+// type check
+var _ agh.ServiceWithConfig[*Config] = (*Service)(nil)
+
+// Start implements the [agh.Service] interface for *Service.  svc may be nil.
+func (svc *Service) Start() (err error) {
+	if svc == nil || !svc.conf.Enabled {
+		return nil
+	}
+
+	return svc.srv.Start()
+}
+
+// Shutdown implements the [agh.Service] interface for *Service.  svc may be
+// nil.
+func (svc *Service) Shutdown(_ context.Context) (err error) {
+	if svc == nil {
+		return nil
+	}
+
+	if svc.watcher != nil {
+		svc.watcher.Close()
+	}
+
+	if !svc.conf.Enabled {
+		return nil
+	}
+
+	return svc.srv.Stop()
+}
+
+// Config implements the [agh.ServiceWithConfig] interface for *Service.
+func (svc *Service) Config() (c *Config) {
+	c = &Config{}
+	*c = *svc.conf
+
+	return c
+}
+
+// Leases returns the clones of all dynamic and static leases sorted by IP
+// address.
+func (svc *Service) Leases() (leases []*dhcpd.Lease) {
+	leases = svc.srv.Leases(dhcpd.LeasesAll)
+	slices.SortFunc(leases, func(a, b *dhcpd.Lease) (less bool) {
+		return a.IP.Less(b.IP)
+	})
+
+	return leases
+}
+
+// AddStaticLease adds a static lease.
+func (svc *Service) AddStaticLease(l *dhcpd.Lease) (err error) {
+	return svc.srv.AddStaticLease(l)
+}
+
+// RemoveStaticLease removes a static lease.
+func (svc *Service) RemoveStaticLease(l *dhcpd.Lease) (err error) {
+	return svc.srv.RemoveStaticLease(l)
+}
+
+// ResetLeases removes all leases.
+func (svc *Service) ResetLeases() (err error) {
+	return svc.srv.ResetLeases()
+}
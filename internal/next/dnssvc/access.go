@@ -0,0 +1,140 @@
+package dnssvc
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/miekg/dns"
+)
+
+// Access Control
+
+// accessManager controls the client and host blocking that takes place before
+// all other processing.  An accessManager is safe for concurrent use, since it
+// is never modified after creation.
+type accessManager struct {
+	// blockedHostsEng matches the hostnames of the requests against the
+	// blocked domain rules.  It is nil if there are no such rules.
+	blockedHostsEng *urlfilter.DNSEngine
+
+	// allowedNets and blockedNets contain the subnets from the access
+	// settings.
+	allowedNets *aghnet.PrefixTree[struct{}]
+	blockedNets *aghnet.PrefixTree[struct{}]
+}
+
+// newAccessManager returns a new properly initialized *accessManager.  The
+// subnets must be masked.
+func newAccessManager(
+	allowed []netip.Prefix,
+	blocked []netip.Prefix,
+	blockedHosts []string,
+) (a *accessManager, err error) {
+	a = &accessManager{
+		allowedNets: newPrefixSet(allowed),
+		blockedNets: newPrefixSet(blocked),
+	}
+
+	if len(blockedHosts) == 0 {
+		return a, nil
+	}
+
+	b := &strings.Builder{}
+	for _, h := range blockedHosts {
+		stringutil.WriteToBuilder(b, strings.ToLower(h), "\n")
+	}
+
+	lists := []filterlist.RuleList{
+		&filterlist.StringRuleList{
+			ID:             0,
+			RulesText:      b.String(),
+			IgnoreCosmetic: true,
+		},
+	}
+
+	rulesStrg, err := filterlist.NewRuleStorage(lists)
+	if err != nil {
+		return nil, fmt.Errorf("adding blocked hosts: %w", err)
+	}
+
+	a.blockedHostsEng = urlfilter.NewDNSEngine(rulesStrg)
+
+	return a, nil
+}
+
+// isBlockedIP returns true if the requests from ip should be dropped.  If there
+// are allowed subnets, the blocked ones are ignored and all addresses outside
+// of the allowed subnets are blocked.
+func (a *accessManager) isBlockedIP(ip netip.Addr) (ok bool) {
+	ip = ip.Unmap()
+	if a.allowedNets.Len() > 0 {
+		_, _, ok = a.allowedNets.Lookup(ip)
+
+		return !ok
+	}
+
+	_, _, ok = a.blockedNets.Lookup(ip)
+
+	return ok
+}
+
+// newPrefixSet returns a tree of prefixes for looking up the addresses.
+func newPrefixSet(prefixes []netip.Prefix) (set *aghnet.PrefixTree[struct{}]) {
+	set = aghnet.NewPrefixTree[struct{}]()
+	for _, p := range prefixes {
+		set.Insert(p, struct{}{})
+	}
+
+	return set
+}
+
+// isBlockedHost returns true if the requests for host with type qt should be
+// dropped.
+func (a *accessManager) isBlockedHost(host string, qt rules.RRType) (ok bool) {
+	if a.blockedHostsEng == nil {
+		return false
+	}
+
+	_, ok = a.blockedHostsEng.MatchRequest(&urlfilter.DNSRequest{
+		Hostname: host,
+		ClientIP: "0.0.0.0",
+		DNSType:  qt,
+	})
+
+	return ok
+}
+
+// beforeRequestHandler is the [proxy.BeforeRequestHandler] that drops the
+// requests blocked by a.
+func (a *accessManager) beforeRequestHandler(
+	_ *proxy.Proxy,
+	pctx *proxy.DNSContext,
+) (ok bool, err error) {
+	addrPort := netutil.NetAddrToAddrPort(pctx.Addr)
+	if ip := addrPort.Addr(); ip.IsValid() && a.isBlockedIP(ip) {
+		log.Debug("dnssvc: client %s is blocked by access settings", ip)
+
+		return false, nil
+	}
+
+	if len(pctx.Req.Question) == 1 {
+		q := pctx.Req.Question[0]
+		host := strings.TrimSuffix(q.Name, ".")
+		if a.isBlockedHost(host, q.Qtype) {
+			log.Debug("dnssvc: request %s %s is blocked by access settings", dns.Type(q.Qtype), host)
+
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
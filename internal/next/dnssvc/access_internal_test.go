@@ -0,0 +1,132 @@
+package dnssvc
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessManager_isBlockedIP(t *testing.T) {
+	allowed := []netip.Prefix{netip.MustParsePrefix("1.2.3.0/24")}
+	blocked := []netip.Prefix{
+		netip.MustParsePrefix("4.5.6.7/32"),
+		netip.MustParsePrefix("1234::/16"),
+	}
+
+	testCases := []struct {
+		allowed []netip.Prefix
+		ip      netip.Addr
+		name    string
+		want    bool
+	}{{
+		allowed: nil,
+		ip:      netip.MustParseAddr("4.5.6.7"),
+		name:    "blocklist_blocked",
+		want:    true,
+	}, {
+		allowed: nil,
+		ip:      netip.MustParseAddr("::ffff:4.5.6.7"),
+		name:    "blocklist_blocked_mapped",
+		want:    true,
+	}, {
+		allowed: nil,
+		ip:      netip.MustParseAddr("1234::1"),
+		name:    "blocklist_blocked_ipv6",
+		want:    true,
+	}, {
+		allowed: nil,
+		ip:      netip.MustParseAddr("4.5.6.8"),
+		name:    "blocklist_allowed",
+		want:    false,
+	}, {
+		allowed: allowed,
+		ip:      netip.MustParseAddr("1.2.3.4"),
+		name:    "allowlist_allowed",
+		want:    false,
+	}, {
+		allowed: allowed,
+		ip:      netip.MustParseAddr("1.2.4.4"),
+		name:    "allowlist_blocked",
+		want:    true,
+	}, {
+		allowed: allowed,
+		ip:      netip.MustParseAddr("4.5.6.8"),
+		name:    "allowlist_ignores_blocklist",
+		want:    true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := newAccessManager(tc.allowed, blocked, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, a.isBlockedIP(tc.ip))
+		})
+	}
+}
+
+func TestAccessManager_isBlockedHost(t *testing.T) {
+	a, err := newAccessManager(nil, nil, []string{
+		"host1",
+		"*.host.com",
+		"||host3.com^",
+		"||host4.com^$dnstype=AAAA",
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		host string
+		qt   uint16
+		want bool
+	}{{
+		name: "exact",
+		host: "host1",
+		qt:   dns.TypeA,
+		want: true,
+	}, {
+		name: "exact_other",
+		host: "host2",
+		qt:   dns.TypeA,
+		want: false,
+	}, {
+		name: "wildcard",
+		host: "asdf.host.com",
+		qt:   dns.TypeA,
+		want: true,
+	}, {
+		name: "wildcard_parent",
+		host: "host.com",
+		qt:   dns.TypeA,
+		want: false,
+	}, {
+		name: "adblock_subdomain",
+		host: "sub.host3.com",
+		qt:   dns.TypeA,
+		want: true,
+	}, {
+		name: "dnstype_match",
+		host: "host4.com",
+		qt:   dns.TypeAAAA,
+		want: true,
+	}, {
+		name: "dnstype_mismatch",
+		host: "host4.com",
+		qt:   dns.TypeA,
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, a.isBlockedHost(tc.host, tc.qt))
+		})
+	}
+
+	empty, err := newAccessManager(nil, nil, nil)
+	require.NoError(t, err)
+
+	assert.False(t, empty.isBlockedHost("host1", dns.TypeA))
+}
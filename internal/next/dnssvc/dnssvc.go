@@ -41,6 +41,19 @@ type Config struct {
 	// UpstreamServers are the upstream DNS server addresses to use.
 	UpstreamServers []string
 
+	// AllowedClients are the subnets of the clients the requests from which
+	// are served.  If it is not empty, the requests from all other clients
+	// are dropped and BlockedClients are ignored.  The subnets must be masked.
+	AllowedClients []netip.Prefix
+
+	// BlockedClients are the subnets of the clients the requests from which
+	// are dropped.  The subnets must be masked.
+	BlockedClients []netip.Prefix
+
+	// BlockedHosts are the domain names, wildcards, and urlfilter rules
+	// matching the hostnames the requests for which are dropped.
+	BlockedHosts []string
+
 	// UpstreamTimeout is the timeout for upstream requests.
 	UpstreamTimeout time.Duration
 }
@@ -48,11 +61,14 @@ type Config struct {
 // Service is the AdGuard Home DNS service.  A nil *Service is a valid
 // [agh.Service] that does nothing.
 type Service struct {
-	proxy      *proxy.Proxy
-	bootstraps []string
-	upstreams  []string
-	upsTimeout time.Duration
-	running    atomic.Bool
+	proxy          *proxy.Proxy
+	bootstraps     []string
+	upstreams      []string
+	allowedClients []netip.Prefix
+	blockedClients []netip.Prefix
+	blockedHosts   []string
+	upsTimeout     time.Duration
+	running        atomic.Bool
 }
 
 // New returns a new properly initialized *Service.  If c is nil, svc is a nil
@@ -64,9 +80,17 @@ func New(c *Config) (svc *Service, err error) {
 	}
 
 	svc = &Service{
-		bootstraps: c.BootstrapServers,
-		upstreams:  c.UpstreamServers,
-		upsTimeout: c.UpstreamTimeout,
+		bootstraps:     c.BootstrapServers,
+		upstreams:      c.UpstreamServers,
+		allowedClients: c.AllowedClients,
+		blockedClients: c.BlockedClients,
+		blockedHosts:   c.BlockedHosts,
+		upsTimeout:     c.UpstreamTimeout,
+	}
+
+	access, err := newAccessManager(c.AllowedClients, c.BlockedClients, c.BlockedHosts)
+	if err != nil {
+		return nil, fmt.Errorf("access: %w", err)
 	}
 
 	var upstreams []upstream.Upstream
@@ -90,6 +114,7 @@ func New(c *Config) (svc *Service, err error) {
 			UpstreamConfig: &proxy.UpstreamConfig{
 				Upstreams: upstreams,
 			},
+			BeforeRequestHandler: access.beforeRequestHandler,
 		},
 	}
 
@@ -209,6 +234,9 @@ func (svc *Service) Config() (c *Config) {
 		Addresses:        addrs,
 		BootstrapServers: svc.bootstraps,
 		UpstreamServers:  svc.upstreams,
+		AllowedClients:   svc.allowedClients,
+		BlockedClients:   svc.blockedClients,
+		BlockedHosts:     svc.blockedHosts,
 		UpstreamTimeout:  svc.upsTimeout,
 	}
 
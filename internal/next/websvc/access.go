@@ -0,0 +1,109 @@
+package websvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+)
+
+// Access Settings Handlers
+
+// HTTPAPIAccessSettings are the DNS access settings as used by the HTTP API.
+// See the DnsAccessSettings object in the OpenAPI specification.
+type HTTPAPIAccessSettings struct {
+	// AllowedClients are the IP addresses and CIDRs of the allowed clients.
+	AllowedClients []string `json:"allowed_clients"`
+
+	// BlockedClients are the IP addresses and CIDRs of the blocked clients.
+	BlockedClients []string `json:"blocked_clients"`
+
+	// BlockedDomainRules are the rules matching the blocked hostnames.
+	BlockedDomainRules []string `json:"blocked_domain_rules"`
+}
+
+// handleGetV1SettingsAccess is the handler for the GET /api/v1/settings/access
+// HTTP API.
+func (svc *Service) handleGetV1SettingsAccess(w http.ResponseWriter, r *http.Request) {
+	conf := svc.confMgr.DNS().Config()
+
+	blockedHosts := conf.BlockedHosts
+	if blockedHosts == nil {
+		blockedHosts = []string{}
+	}
+
+	writeJSONOKResponse(w, r, &HTTPAPIAccessSettings{
+		AllowedClients:     subnetStrings(conf.AllowedClients),
+		BlockedClients:     subnetStrings(conf.BlockedClients),
+		BlockedDomainRules: blockedHosts,
+	})
+}
+
+// handlePutV1SettingsAccess is the handler for the PUT /api/v1/settings/access
+// HTTP API.
+func (svc *Service) handlePutV1SettingsAccess(w http.ResponseWriter, r *http.Request) {
+	req := &HTTPAPIAccessSettings{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	allowed, err := parseSubnets(req.AllowedClients)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("allowed_clients: %w", err))
+
+		return
+	}
+
+	blocked, err := parseSubnets(req.BlockedClients)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("blocked_clients: %w", err))
+
+		return
+	}
+
+	newConf := *svc.confMgr.DNS().Config()
+	newConf.AllowedClients = allowed
+	newConf.BlockedClients = blocked
+	newConf.BlockedHosts = req.BlockedDomainRules
+
+	_, err = svc.confMgr.UpdateDNS(r.Context(), &newConf)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("updating: %w", err))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseSubnets parses the IP addresses and CIDRs in strs.
+func parseSubnets(strs []string) (subnets []netip.Prefix, err error) {
+	subnets = make([]netip.Prefix, 0, len(strs))
+	for i, s := range strs {
+		var p netip.Prefix
+		p, err = aghnet.ParseSubnet(s)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		subnets = append(subnets, p)
+	}
+
+	return subnets, nil
+}
+
+// subnetStrings returns the string representations of subnets as accepted by
+// [parseSubnets].
+func subnetStrings(subnets []netip.Prefix) (strs []string) {
+	strs = make([]string, 0, len(subnets))
+	for _, p := range subnets {
+		strs = append(strs, aghnet.SubnetString(p))
+	}
+
+	return strs
+}
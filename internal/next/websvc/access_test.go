@@ -0,0 +1,145 @@
+package websvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDNSService returns a DNS service mock with the configuration c.
+func newTestDNSService(c *dnssvc.Config) (svc agh.ServiceWithConfig[*dnssvc.Config]) {
+	return &aghtest.ServiceWithConfig[*dnssvc.Config]{
+		OnStart:    func() (err error) { panic("not implemented") },
+		OnShutdown: func(_ context.Context) (err error) { panic("not implemented") },
+		OnConfig:   func() (conf *dnssvc.Config) { return c },
+	}
+}
+
+func TestService_HandleGetSettingsAccess(t *testing.T) {
+	confMgr := newConfigManager()
+	confMgr.onDNS = func() (s agh.ServiceWithConfig[*dnssvc.Config]) {
+		return newTestDNSService(&dnssvc.Config{
+			AllowedClients: []netip.Prefix{
+				netip.MustParsePrefix("1.2.3.4/32"),
+				netip.MustParsePrefix("1.2.4.0/24"),
+			},
+			BlockedHosts: []string{"||example.com^"},
+		})
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1SettingsAccess,
+	}
+
+	body := httpGet(t, u, http.StatusOK)
+	resp := &websvc.HTTPAPIAccessSettings{}
+	err := json.Unmarshal(body, resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, &websvc.HTTPAPIAccessSettings{
+		AllowedClients:     []string{"1.2.3.4", "1.2.4.0/24"},
+		BlockedClients:     []string{},
+		BlockedDomainRules: []string{"||example.com^"},
+	}, resp)
+}
+
+func TestService_HandlePutSettingsAccess(t *testing.T) {
+	const errConflict errors.Error = "conflict"
+
+	curConf := &dnssvc.Config{
+		Addresses:       []netip.AddrPort{netip.MustParseAddrPort("127.0.0.1:53")},
+		UpstreamServers: []string{"1.1.1.1"},
+		UpstreamTimeout: 1 * time.Second,
+	}
+
+	var gotConf *dnssvc.Config
+	confMgr := newConfigManager()
+	confMgr.onDNS = func() (s agh.ServiceWithConfig[*dnssvc.Config]) {
+		return newTestDNSService(curConf)
+	}
+	confMgr.onUpdateDNS = func(
+		_ context.Context,
+		c *dnssvc.Config,
+	) (s agh.ServiceWithConfig[*dnssvc.Config], err error) {
+		if len(c.AllowedClients) > 0 && len(c.BlockedClients) > 0 {
+			return nil, errConflict
+		}
+
+		gotConf = c
+
+		return newTestDNSService(c), nil
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1SettingsAccess,
+	}
+
+	testCases := []struct {
+		req      *websvc.HTTPAPIAccessSettings
+		wantConf *dnssvc.Config
+		name     string
+		wantCode int
+	}{{
+		req: &websvc.HTTPAPIAccessSettings{
+			BlockedClients:     []string{"1.2.3.4", "::ffff:4.5.6.7", "1234::/16"},
+			BlockedDomainRules: []string{"||example.com^"},
+		},
+		wantConf: &dnssvc.Config{
+			Addresses:       curConf.Addresses,
+			UpstreamServers: curConf.UpstreamServers,
+			AllowedClients:  []netip.Prefix{},
+			BlockedClients: []netip.Prefix{
+				netip.MustParsePrefix("1.2.3.4/32"),
+				netip.MustParsePrefix("4.5.6.7/32"),
+				netip.MustParsePrefix("1234::/16"),
+			},
+			BlockedHosts:    []string{"||example.com^"},
+			UpstreamTimeout: curConf.UpstreamTimeout,
+		},
+		name:     "success",
+		wantCode: http.StatusNoContent,
+	}, {
+		req: &websvc.HTTPAPIAccessSettings{
+			AllowedClients: []string{"1.2.3.256"},
+		},
+		wantConf: nil,
+		name:     "bad_ip",
+		wantCode: http.StatusUnprocessableEntity,
+	}, {
+		req: &websvc.HTTPAPIAccessSettings{
+			AllowedClients: []string{"1.2.3.0/24"},
+			BlockedClients: []string{"1.2.3.4"},
+		},
+		wantConf: nil,
+		name:     "conflict",
+		wantCode: http.StatusUnprocessableEntity,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotConf = nil
+
+			_ = httpDo(t, http.MethodPut, u, tc.req, tc.wantCode)
+
+			assert.Equal(t, tc.wantConf, gotConf)
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package websvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/dimfeld/httptreemux/v5"
+	"golang.org/x/exp/slices"
+)
+
+// Accounts
+
+// User is a user of the HTTP API.
+type User struct {
+	// Name is the unique name of the user.  It must not be empty.
+	Name string
+
+	// PasswordHash is the bcrypt hash of the password of the user.  It must
+	// not be empty.
+	PasswordHash string
+
+	// Role is the role of the user.  It must be valid.
+	Role aghuser.Role
+}
+
+// UserDB is the database of the users of the HTTP API.  It is shared between
+// the instances of the web service created after reconfigurations.  A *UserDB
+// is safe for concurrent use.
+//
+// TODO(a.garipov): Write the changes into the configuration file.
+type UserDB struct {
+	// mu protects users.
+	mu *sync.RWMutex
+
+	// users are the users of the HTTP API.
+	users []*User
+}
+
+// NewUserDB returns a new properly initialized *UserDB containing users.  The
+// users must not be modified after calling NewUserDB.
+func NewUserDB(users []*User) (db *UserDB) {
+	return &UserDB{
+		mu:    &sync.RWMutex{},
+		users: slices.Clone(users),
+	}
+}
+
+// Errors returned by the methods of *UserDB.
+const (
+	ErrLastAdmin errors.Error = "cannot remove the last admin"
+	ErrNoUser    errors.Error = "no such user"
+)
+
+// Users returns the copies of all users in db.  db may be nil.
+func (db *UserDB) Users() (users []*User) {
+	if db == nil {
+		return nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users = make([]*User, 0, len(db.users))
+	for _, u := range db.users {
+		uc := *u
+		users = append(users, &uc)
+	}
+
+	return users
+}
+
+// isEnabled returns true if db is not nil and has users, which means that the
+// HTTP API requires authentication.
+func (db *UserDB) isEnabled() (ok bool) {
+	if db == nil {
+		return false
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.users) > 0
+}
+
+// authenticate returns the role of the user with the given credentials.  ok is
+// false if there is no such user or the password doesn't match.
+func (db *UserDB) authenticate(name, password string) (role aghuser.Role, ok bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	i := db.index(name)
+	if i < 0 {
+		return "", false
+	}
+
+	u := db.users[i]
+	if !aghuser.PasswordMatches(u.PasswordHash, password) {
+		return "", false
+	}
+
+	return u.Role, true
+}
+
+// Add adds u to db.  u must be valid and must not be modified after calling
+// Add.
+func (db *UserDB) Add(u *User) (err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.index(u.Name) >= 0 {
+		return fmt.Errorf("user %q already exists", u.Name)
+	} else if len(db.users) == 0 && u.Role != aghuser.RoleAdmin {
+		// Don't lock everyone out of the user management.
+		return errors.Error("the first user must be an admin")
+	}
+
+	db.users = append(db.users, u)
+
+	return nil
+}
+
+// Update sets the role and the password hash of the user with name.  Empty
+// role or hash are not changed.
+func (db *UserDB) Update(name string, role aghuser.Role, hash string) (err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.index(name)
+	if i < 0 {
+		return ErrNoUser
+	} else if role != "" && role != aghuser.RoleAdmin && db.isLastAdmin(i) {
+		return ErrLastAdmin
+	}
+
+	// Don't modify the users returned by Users earlier.
+	uc := *db.users[i]
+	if role != "" {
+		uc.Role = role
+	}
+
+	if hash != "" {
+		uc.PasswordHash = hash
+	}
+
+	db.users[i] = &uc
+
+	return nil
+}
+
+// Remove removes the user with name from db.
+func (db *UserDB) Remove(name string) (err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.index(name)
+	if i < 0 {
+		return ErrNoUser
+	} else if db.isLastAdmin(i) {
+		return ErrLastAdmin
+	}
+
+	db.users = slices.Delete(db.users, i, i+1)
+
+	return nil
+}
+
+// index returns the index of the user with name or -1 if there is no such
+// user.  db.mu is expected to be locked.
+func (db *UserDB) index(name string) (i int) {
+	return slices.IndexFunc(db.users, func(u *User) (ok bool) { return u.Name == name })
+}
+
+// isLastAdmin returns true if the user at index i is the only admin.  db.mu is
+// expected to be locked.
+func (db *UserDB) isLastAdmin(i int) (ok bool) {
+	if db.users[i].Role != aghuser.RoleAdmin {
+		return false
+	}
+
+	for j, u := range db.users {
+		if j != i && u.Role == aghuser.RoleAdmin {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authMw returns h wrapped with a handler, which requires the HTTP Basic
+// authentication of a user with the role required.  If the database is empty,
+// all requests are allowed.
+func authMw(h http.Handler, db *UserDB, required aghuser.Role) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !db.isEnabled() {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		name, password, ok := r.BasicAuth()
+		var role aghuser.Role
+		if ok {
+			role, ok = db.authenticate(name, password)
+		}
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="AdGuard Home", charset="UTF-8"`)
+			writeJSONResponse(w, r, &HTTPAPIErrorResp{
+				Code: ErrorCodeTMP000,
+				Msg:  "authentication required",
+			}, http.StatusUnauthorized)
+
+			return
+		}
+
+		if !role.Allows(required) {
+			log.Debug("websvc: user %q with role %s: %s %s denied", name, role, r.Method, r.URL.Path)
+
+			writeJSONResponse(w, r, &HTTPAPIErrorResp{
+				Code: ErrorCodeTMP000,
+				Msg:  fmt.Sprintf("role %s is required", required),
+			}, http.StatusForbidden)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+// HTTPAPIUser is a user as used by the HTTP API.  See the User object in the
+// OpenAPI specification.
+type HTTPAPIUser struct {
+	Name string       `json:"name"`
+	Role aghuser.Role `json:"role"`
+}
+
+// RespGetV1AccountsUsers describes the response of the GET
+// /api/v1/accounts/users HTTP API.
+type RespGetV1AccountsUsers struct {
+	Users []*HTTPAPIUser `json:"users"`
+}
+
+// ReqPostV1AccountsUsers describes the request to the POST
+// /api/v1/accounts/users HTTP API.
+type ReqPostV1AccountsUsers struct {
+	Name     string       `json:"name"`
+	Password string       `json:"password"`
+	Role     aghuser.Role `json:"role"`
+
+	// BcryptCost is the cost of the password hash.  Zero means the default
+	// one.
+	BcryptCost int `json:"bcrypt_cost"`
+}
+
+// ReqPatchV1AccountsUser describes the request to the PATCH
+// /api/v1/accounts/users/{name} HTTP API.  Empty fields are left unchanged.
+type ReqPatchV1AccountsUser struct {
+	Password string       `json:"password"`
+	Role     aghuser.Role `json:"role"`
+
+	// BcryptCost is the cost of the password hash.  Zero means the default
+	// one.
+	BcryptCost int `json:"bcrypt_cost"`
+}
+
+// handleGetV1AccountsUsers is the handler for the GET /api/v1/accounts/users
+// HTTP API.
+func (svc *Service) handleGetV1AccountsUsers(w http.ResponseWriter, r *http.Request) {
+	users := svc.users.Users()
+	resp := &RespGetV1AccountsUsers{
+		Users: make([]*HTTPAPIUser, 0, len(users)),
+	}
+
+	for _, u := range users {
+		resp.Users = append(resp.Users, &HTTPAPIUser{
+			Name: u.Name,
+			Role: u.Role,
+		})
+	}
+
+	writeJSONOKResponse(w, r, resp)
+}
+
+// handlePostV1AccountsUsers is the handler for the POST /api/v1/accounts/users
+// HTTP API.
+func (svc *Service) handlePostV1AccountsUsers(w http.ResponseWriter, r *http.Request) {
+	if svc.users == nil {
+		writeUsersDisabled(w, r)
+
+		return
+	}
+
+	req := &ReqPostV1AccountsUsers{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	if req.Name == "" {
+		writeJSONErrorResponse(w, r, errors.Error("name: no value"))
+
+		return
+	} else if req.Password == "" {
+		writeJSONErrorResponse(w, r, errors.Error("password: no value"))
+
+		return
+	}
+
+	err = req.Role.Validate()
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("role: %w", err))
+
+		return
+	}
+
+	hash, err := aghuser.HashPassword(req.Password, req.BcryptCost)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("bcrypt_cost: %w", err))
+
+		return
+	}
+
+	err = svc.users.Add(&User{
+		Name:         req.Name,
+		PasswordHash: hash,
+		Role:         req.Role,
+	})
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("adding user: %w", err))
+
+		return
+	}
+
+	writeJSONOKResponse(w, r, &HTTPAPIUser{
+		Name: req.Name,
+		Role: req.Role,
+	})
+}
+
+// handlePatchV1AccountsUser is the handler for the PATCH
+// /api/v1/accounts/users/{name} HTTP API.
+func (svc *Service) handlePatchV1AccountsUser(w http.ResponseWriter, r *http.Request) {
+	if svc.users == nil {
+		writeUsersDisabled(w, r)
+
+		return
+	}
+
+	req := &ReqPatchV1AccountsUser{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	if req.Role != "" {
+		err = req.Role.Validate()
+		if err != nil {
+			writeJSONErrorResponse(w, r, fmt.Errorf("role: %w", err))
+
+			return
+		}
+	}
+
+	var hash string
+	if req.Password != "" {
+		hash, err = aghuser.HashPassword(req.Password, req.BcryptCost)
+		if err != nil {
+			writeJSONErrorResponse(w, r, fmt.Errorf("bcrypt_cost: %w", err))
+
+			return
+		}
+	}
+
+	name := httptreemux.ContextParams(r.Context())["name"]
+	err = svc.users.Update(name, req.Role, hash)
+	if errors.Is(err, ErrNoUser) {
+		writeUserNotFound(w, r)
+
+		return
+	} else if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("updating user: %w", err))
+
+		return
+	}
+
+	for _, u := range svc.users.Users() {
+		if u.Name == name {
+			writeJSONOKResponse(w, r, &HTTPAPIUser{
+				Name: u.Name,
+				Role: u.Role,
+			})
+
+			return
+		}
+	}
+
+	// The user has been removed concurrently.
+	writeUserNotFound(w, r)
+}
+
+// handleDeleteV1AccountsUser is the handler for the DELETE
+// /api/v1/accounts/users/{name} HTTP API.
+func (svc *Service) handleDeleteV1AccountsUser(w http.ResponseWriter, r *http.Request) {
+	if svc.users == nil {
+		writeUsersDisabled(w, r)
+
+		return
+	}
+
+	name := httptreemux.ContextParams(r.Context())["name"]
+	err := svc.users.Remove(name)
+	if errors.Is(err, ErrNoUser) {
+		writeUserNotFound(w, r)
+
+		return
+	} else if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("removing user: %w", err))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUserNotFound writes the JSON response about an absent user to w.
+func writeUserNotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, r, &HTTPAPIErrorResp{
+		Code: ErrorCodeTMP000,
+		Msg:  "user not found",
+	}, http.StatusNotFound)
+}
+
+// writeUsersDisabled writes the JSON response about the disabled user
+// management to w.
+func writeUsersDisabled(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, r, &HTTPAPIErrorResp{
+		Code: ErrorCodeTMP000,
+		Msg:  "user management is disabled",
+	}, http.StatusNotFound)
+}
@@ -0,0 +1,180 @@
+package websvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPassword is the password of all test users.
+const testPassword = "password"
+
+// newTestUserDB returns a new *UserDB with an admin "admin" and a viewer
+// "viewer".
+func newTestUserDB(t *testing.T) (db *UserDB) {
+	t.Helper()
+
+	hash, err := aghuser.HashPassword(testPassword, bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return NewUserDB([]*User{{
+		Name:         "admin",
+		PasswordHash: hash,
+		Role:         aghuser.RoleAdmin,
+	}, {
+		Name:         "viewer",
+		PasswordHash: hash,
+		Role:         aghuser.RoleViewer,
+	}})
+}
+
+func TestUserDB(t *testing.T) {
+	db := newTestUserDB(t)
+
+	err := db.Update("admin", aghuser.RoleOperator, "")
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	err = db.Remove("admin")
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	err = db.Remove("nobody")
+	assert.ErrorIs(t, err, ErrNoUser)
+
+	err = db.Add(&User{Name: "viewer"})
+	assert.Error(t, err)
+
+	err = db.Update("viewer", aghuser.RoleAdmin, "")
+	require.NoError(t, err)
+
+	err = db.Remove("admin")
+	require.NoError(t, err)
+
+	users := db.Users()
+	require.Len(t, users, 1)
+
+	assert.Equal(t, "viewer", users[0].Name)
+	assert.Equal(t, aghuser.RoleAdmin, users[0].Role)
+
+	empty := NewUserDB(nil)
+	err = empty.Add(&User{Name: "viewer", Role: aghuser.RoleViewer})
+	assert.Error(t, err)
+}
+
+func TestService_roles(t *testing.T) {
+	svc := New(&Config{
+		Users:   newTestUserDB(t),
+		Timeout: testTimeout,
+	})
+	mux := newMux(svc)
+
+	testCases := []struct {
+		body     any
+		name     string
+		user     string
+		method   string
+		path     string
+		wantCode int
+	}{{
+		body:     nil,
+		name:     "no_auth",
+		user:     "",
+		method:   http.MethodGet,
+		path:     PathV1AccountsUsers,
+		wantCode: http.StatusUnauthorized,
+	}, {
+		body:     nil,
+		name:     "public",
+		user:     "",
+		method:   http.MethodGet,
+		path:     PathHealthCheck,
+		wantCode: http.StatusOK,
+	}, {
+		body:     nil,
+		name:     "viewer_forbidden",
+		user:     "viewer",
+		method:   http.MethodGet,
+		path:     PathV1AccountsUsers,
+		wantCode: http.StatusForbidden,
+	}, {
+		body:     nil,
+		name:     "admin_list",
+		user:     "admin",
+		method:   http.MethodGet,
+		path:     PathV1AccountsUsers,
+		wantCode: http.StatusOK,
+	}, {
+		body: &ReqPostV1AccountsUsers{
+			Name:       "operator",
+			Password:   testPassword,
+			Role:       aghuser.RoleOperator,
+			BcryptCost: bcrypt.MinCost,
+		},
+		name:     "admin_add",
+		user:     "admin",
+		method:   http.MethodPost,
+		path:     PathV1AccountsUsers,
+		wantCode: http.StatusOK,
+	}, {
+		body: &ReqPostV1AccountsUsers{
+			Name:     "bad",
+			Password: testPassword,
+			Role:     "root",
+		},
+		name:     "admin_add_bad_role",
+		user:     "admin",
+		method:   http.MethodPost,
+		path:     PathV1AccountsUsers,
+		wantCode: http.StatusUnprocessableEntity,
+	}, {
+		body: &ReqPatchV1AccountsUser{
+			Role: aghuser.RoleAdmin,
+		},
+		name:     "admin_patch_missing",
+		user:     "admin",
+		method:   http.MethodPatch,
+		path:     "/api/v1/accounts/users/nobody",
+		wantCode: http.StatusNotFound,
+	}, {
+		body:     nil,
+		name:     "admin_delete",
+		user:     "admin",
+		method:   http.MethodDelete,
+		path:     "/api/v1/accounts/users/viewer",
+		wantCode: http.StatusNoContent,
+	}, {
+		body:     nil,
+		name:     "deleted_user",
+		user:     "viewer",
+		method:   http.MethodGet,
+		path:     PathV1SystemInfo,
+		wantCode: http.StatusUnauthorized,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body []byte
+			if tc.body != nil {
+				var err error
+				body, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+
+			r := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(body))
+			if tc.user != "" {
+				r.SetBasicAuth(tc.user, testPassword)
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
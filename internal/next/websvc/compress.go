@@ -0,0 +1,65 @@
+package websvc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/NYTimes/gziphandler"
+)
+
+// Response Compression
+
+// CompressionConfig is the configuration of the compression of the HTTP API
+// responses and frontend assets.
+type CompressionConfig struct {
+	// MIMETypes are the media types of the responses that are compressed, for
+	// example "application/json".  If it is empty,
+	// [DefaultCompressionMIMETypes] are used.
+	MIMETypes []string
+
+	// MinSize is the minimum size of a response body in bytes, starting with
+	// which the response is compressed.  It must not be negative.
+	MinSize int
+
+	// Level is the gzip compression level.  It must be either -1, meaning the
+	// default level, or between -2, meaning Huffman-only compression, and 9.
+	Level int
+}
+
+// DefaultCompressionMIMETypes are the media types of the responses that are
+// compressed if [CompressionConfig.MIMETypes] is empty.
+var DefaultCompressionMIMETypes = []string{
+	aghhttp.HdrValApplicationJSON,
+	"application/javascript",
+	"image/svg+xml",
+	"text/css",
+	"text/html",
+	"text/javascript",
+	aghhttp.HdrValTextPlain,
+}
+
+// compressMw returns h wrapped with a handler, which compresses the responses
+// as configured by c if the client accepts it.  If c is nil, h is returned
+// unchanged.
+func compressMw(h http.Handler, c *CompressionConfig) (wrapped http.Handler, err error) {
+	if c == nil {
+		return h, nil
+	}
+
+	mimeTypes := c.MIMETypes
+	if len(mimeTypes) == 0 {
+		mimeTypes = DefaultCompressionMIMETypes
+	}
+
+	mw, err := gziphandler.GzipHandlerWithOpts(
+		gziphandler.ContentTypes(mimeTypes),
+		gziphandler.MinSize(c.MinSize),
+		gziphandler.CompressionLevel(c.Level),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating gzip handler: %w", err)
+	}
+
+	return mw(h), nil
+}
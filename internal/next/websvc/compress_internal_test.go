@@ -0,0 +1,143 @@
+package websvc
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressMw(t *testing.T) {
+	const minSize = 64
+
+	longBody := strings.Repeat("a", minSize*2)
+	shortBody := "a"
+
+	conf := &CompressionConfig{
+		MIMETypes: nil,
+		MinSize:   minSize,
+		Level:     gzip.DefaultCompression,
+	}
+
+	testCases := []struct {
+		conf        *CompressionConfig
+		name        string
+		contentType string
+		body        string
+		acceptEnc   string
+		wantEnc     string
+	}{{
+		conf:        conf,
+		name:        "json",
+		contentType: aghhttp.HdrValApplicationJSON,
+		body:        longBody,
+		acceptEnc:   "gzip, deflate",
+		wantEnc:     "gzip",
+	}, {
+		conf:        conf,
+		name:        "short",
+		contentType: aghhttp.HdrValApplicationJSON,
+		body:        shortBody,
+		acceptEnc:   "gzip",
+		wantEnc:     "",
+	}, {
+		conf:        conf,
+		name:        "not_accepted",
+		contentType: aghhttp.HdrValApplicationJSON,
+		body:        longBody,
+		acceptEnc:   "",
+		wantEnc:     "",
+	}, {
+		conf:        conf,
+		name:        "other_type",
+		contentType: "image/png",
+		body:        longBody,
+		acceptEnc:   "gzip",
+		wantEnc:     "",
+	}, {
+		conf:        nil,
+		name:        "disabled",
+		contentType: aghhttp.HdrValApplicationJSON,
+		body:        longBody,
+		acceptEnc:   "gzip",
+		wantEnc:     "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set(aghhttp.HdrNameContentType, tc.contentType)
+				_, _ = io.WriteString(w, tc.body)
+			})
+
+			wrapped, err := compressMw(h, tc.conf)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, PathV1SystemInfo, nil)
+			if tc.acceptEnc != "" {
+				r.Header.Set(aghhttp.HdrNameAcceptEncoding, tc.acceptEnc)
+			}
+
+			w := httptest.NewRecorder()
+			wrapped.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tc.wantEnc, w.Header().Get(aghhttp.HdrNameContentEncoding))
+
+			assert.Equal(t, tc.body, readBody(t, w))
+		})
+	}
+}
+
+func TestService_frontend(t *testing.T) {
+	const indexHTML = "<html>" + "<body>Hello, world!</body>" + "</html>"
+
+	svc := &Service{
+		frontend: fstest.MapFS{
+			"index.html": &fstest.MapFile{Data: []byte(indexHTML)},
+		},
+		compression: &CompressionConfig{
+			Level: gzip.DefaultCompression,
+		},
+	}
+
+	h, err := compressMw(newMux(svc), svc.compression)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(aghhttp.HdrNameAcceptEncoding, "gzip")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, "gzip", w.Header().Get(aghhttp.HdrNameContentEncoding))
+	assert.Equal(t, indexHTML, readBody(t, w))
+}
+
+// readBody is a helper that returns the body of the recorded response,
+// decompressing it if necessary.
+func readBody(t testing.TB, w *httptest.ResponseRecorder) (body string) {
+	t.Helper()
+
+	var r io.Reader = w.Body
+	if w.Header().Get(aghhttp.HdrNameContentEncoding) == "gzip" {
+		gzr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+
+		r = gzr
+	}
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(b)
+}
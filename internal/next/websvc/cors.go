@@ -0,0 +1,104 @@
+package websvc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"golang.org/x/exp/slices"
+)
+
+// Cross-Origin Resource Sharing
+
+// CORSConfig is the CORS policy of the HTTP API.
+type CORSConfig struct {
+	// AllowedOrigins are the origins, for example "https://example.com", that
+	// are allowed to make cross-origin requests.  The special value "*" allows
+	// any origin, but disables credentialed requests.
+	AllowedOrigins []string
+
+	// AllowedMethods are the HTTP methods allowed in cross-origin requests.  If
+	// it is empty, only GET and HEAD are allowed.
+	AllowedMethods []string
+}
+
+// corsOriginAny is the special origin value that allows any origin.
+const corsOriginAny = "*"
+
+// corsMaxAge is the duration for which the results of a preflight request can
+// be cached by the browsers.
+const corsMaxAge = 1 * time.Hour
+
+// corsAllowedHeaders are the request headers allowed in cross-origin requests.
+var corsAllowedHeaders = strings.Join([]string{
+	aghhttp.HdrNameContentType,
+	aghhttp.HdrNameXCSRFToken,
+}, ", ")
+
+// corsMw returns h wrapped with a handler, which sets the CORS headers for the
+// cross-origin requests allowed by c and responds to the preflight requests.
+// If c is nil, h is returned unchanged.
+func corsMw(h http.Handler, c *CORSConfig) (wrapped http.Handler) {
+	if c == nil {
+		return h
+	}
+
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	allowedMethods := strings.Join(methods, ", ")
+	allowAny := slices.Contains(c.AllowedOrigins, corsOriginAny)
+	maxAge := strconv.Itoa(int(corsMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(aghhttp.HdrNameOrigin)
+		if origin == "" {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		respHdr := w.Header()
+		respHdr.Add(aghhttp.HdrNameVary, aghhttp.HdrNameOrigin)
+
+		allowed := allowAny || slices.Contains(c.AllowedOrigins, origin)
+		reqMethod := r.Header.Get(aghhttp.HdrNameAccessControlRequestMethod)
+		if r.Method == http.MethodOptions && reqMethod != "" {
+			// This is a preflight request.  Don't pass it to the handler.
+			if allowed && slices.Contains(methods, reqMethod) {
+				setCORSOrigin(respHdr, origin, allowAny)
+				respHdr.Set(aghhttp.HdrNameAccessControlAllowMethods, allowedMethods)
+				respHdr.Set(aghhttp.HdrNameAccessControlAllowHeaders, corsAllowedHeaders)
+				respHdr.Set(aghhttp.HdrNameAccessControlMaxAge, maxAge)
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		if allowed && slices.Contains(methods, r.Method) {
+			setCORSOrigin(respHdr, origin, allowAny)
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// setCORSOrigin sets the headers allowing the cross-origin access from origin.
+// If allowAny is true, the access is allowed from any origin but without
+// credentials.
+func setCORSOrigin(respHdr http.Header, origin string, allowAny bool) {
+	if allowAny {
+		respHdr.Set(aghhttp.HdrNameAccessControlAllowOrigin, corsOriginAny)
+
+		return
+	}
+
+	respHdr.Set(aghhttp.HdrNameAccessControlAllowOrigin, origin)
+	respHdr.Set(aghhttp.HdrNameAccessControlAllowCredentials, "true")
+}
@@ -0,0 +1,87 @@
+package websvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMw(t *testing.T) {
+	const (
+		allowedOrigin = "https://dashboard.example"
+		otherOrigin   = "https://evil.example"
+	)
+
+	h := corsMw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), &CORSConfig{
+		AllowedOrigins: []string{allowedOrigin},
+		AllowedMethods: []string{http.MethodGet, http.MethodPatch},
+	})
+
+	testCases := []struct {
+		name       string
+		method     string
+		origin     string
+		reqMethod  string
+		wantOrigin string
+		wantCode   int
+	}{{
+		name:       "same_origin",
+		method:     http.MethodGet,
+		origin:     "",
+		reqMethod:  "",
+		wantOrigin: "",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "allowed",
+		method:     http.MethodGet,
+		origin:     allowedOrigin,
+		reqMethod:  "",
+		wantOrigin: allowedOrigin,
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "not_allowed_origin",
+		method:     http.MethodGet,
+		origin:     otherOrigin,
+		reqMethod:  "",
+		wantOrigin: "",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "preflight_allowed",
+		method:     http.MethodOptions,
+		origin:     allowedOrigin,
+		reqMethod:  http.MethodPatch,
+		wantOrigin: allowedOrigin,
+		wantCode:   http.StatusNoContent,
+	}, {
+		name:       "preflight_not_allowed_method",
+		method:     http.MethodOptions,
+		origin:     allowedOrigin,
+		reqMethod:  http.MethodDelete,
+		wantOrigin: "",
+		wantCode:   http.StatusNoContent,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, PathV1SettingsHTTP, nil)
+			if tc.origin != "" {
+				r.Header.Set(aghhttp.HdrNameOrigin, tc.origin)
+			}
+
+			if tc.reqMethod != "" {
+				r.Header.Set(aghhttp.HdrNameAccessControlRequestMethod, tc.reqMethod)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			assert.Equal(t, tc.wantCode, rw.Code)
+			assert.Equal(t, tc.wantOrigin, rw.Header().Get(aghhttp.HdrNameAccessControlAllowOrigin))
+		})
+	}
+}
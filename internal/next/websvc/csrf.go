@@ -0,0 +1,150 @@
+package websvc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Cross-Site Request Forgery Protection
+
+// CSRFConfig is the configuration of the CSRF protection of the state-changing
+// HTTP API endpoints.  When it is enabled, requests with methods other than
+// GET, HEAD, and OPTIONS must contain a valid token issued by the GET
+// /api/v1/accounts/csrf_token HTTP API in the X-CSRF-Token header.
+type CSRFConfig struct {
+	// Key is the secret key used to sign the tokens.  It must not be empty.
+	Key []byte
+
+	// TokenTTL is the lifetime of the issued tokens.  It must be positive.
+	TokenTTL time.Duration
+}
+
+// CSRF token layout constants.  A token is the unpadded URL-safe base64
+// encoding of the big-endian expiration Unix time, a random nonce, and the
+// HMAC-SHA256 of both.
+const (
+	csrfExpLen   = 8
+	csrfNonceLen = 16
+	csrfDataLen  = csrfExpLen + csrfNonceLen
+	csrfTokenLen = csrfDataLen + sha256.Size
+)
+
+// newCSRFToken returns a new CSRF token signed with c.Key, which expires at
+// exp.
+func newCSRFToken(c *CSRFConfig, now time.Time) (tok string, exp time.Time, err error) {
+	b := make([]byte, csrfDataLen, csrfTokenLen)
+
+	exp = now.Add(c.TokenTTL)
+	binary.BigEndian.PutUint64(b[:csrfExpLen], uint64(exp.Unix()))
+
+	_, err = rand.Read(b[csrfExpLen:])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, c.Key)
+	_, _ = mac.Write(b)
+	b = mac.Sum(b)
+
+	return base64.RawURLEncoding.EncodeToString(b), exp, nil
+}
+
+// errCSRFTokenInvalid is returned by validateCSRFToken for tokens that are
+// malformed or have an invalid signature.
+const errCSRFTokenInvalid errors.Error = "invalid csrf token"
+
+// validateCSRFToken returns an error if tok is not a valid token signed with
+// c.Key or is expired.
+func validateCSRFToken(c *CSRFConfig, tok string, now time.Time) (err error) {
+	if tok == "" {
+		return errors.Error("no csrf token")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(tok)
+	if err != nil || len(b) != csrfTokenLen {
+		return errCSRFTokenInvalid
+	}
+
+	mac := hmac.New(sha256.New, c.Key)
+	_, _ = mac.Write(b[:csrfDataLen])
+	if !hmac.Equal(mac.Sum(nil), b[csrfDataLen:]) {
+		return errCSRFTokenInvalid
+	}
+
+	exp := time.Unix(int64(binary.BigEndian.Uint64(b[:csrfExpLen])), 0)
+	if !now.Before(exp) {
+		return errors.Error("csrf token expired")
+	}
+
+	return nil
+}
+
+// csrfMw returns h wrapped with a handler, which rejects the requests without
+// a valid CSRF token.
+func csrfMw(h http.Handler, c *CSRFConfig) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := validateCSRFToken(c, r.Header.Get(aghhttp.HdrNameXCSRFToken), time.Now())
+		if err != nil {
+			writeJSONResponse(w, r, &HTTPAPIErrorResp{
+				Code: ErrorCodeTMP000,
+				Msg:  err.Error(),
+			}, http.StatusForbidden)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+// isStateChanging returns true if requests with method m are supposed to
+// change the state of the server and must thus be protected from CSRF.
+func isStateChanging(m string) (ok bool) {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// RespGetV1AccountsCSRFToken describes the response of the GET
+// /api/v1/accounts/csrf_token HTTP API.
+type RespGetV1AccountsCSRFToken struct {
+	Token   string   `json:"token"`
+	Expires JSONTime `json:"expires"`
+}
+
+// handleGetV1AccountsCSRFToken is the handler for the GET
+// /api/v1/accounts/csrf_token HTTP API.
+func (svc *Service) handleGetV1AccountsCSRFToken(w http.ResponseWriter, r *http.Request) {
+	if svc.csrf == nil {
+		writeJSONResponse(w, r, &HTTPAPIErrorResp{
+			Code: ErrorCodeTMP000,
+			Msg:  "csrf protection is disabled",
+		}, http.StatusNotFound)
+
+		return
+	}
+
+	tok, exp, err := newCSRFToken(svc.csrf, time.Now())
+	if err != nil {
+		writeJSONErrorResponse(w, r, err)
+
+		return
+	}
+
+	writeJSONOKResponse(w, r, &RespGetV1AccountsCSRFToken{
+		Token:   tok,
+		Expires: JSONTime(exp),
+	})
+}
@@ -0,0 +1,73 @@
+package websvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCSRFToken(t *testing.T) {
+	c := &CSRFConfig{
+		Key:      []byte("0123456789abcdef0123456789abcdef"),
+		TokenTTL: 1 * time.Hour,
+	}
+
+	now := time.Now()
+	tok, exp, err := newCSRFToken(c, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, now.Add(c.TokenTTL), exp)
+
+	otherKeyConf := &CSRFConfig{
+		Key:      []byte("fedcba9876543210fedcba9876543210"),
+		TokenTTL: c.TokenTTL,
+	}
+
+	testCases := []struct {
+		conf       *CSRFConfig
+		now        time.Time
+		name       string
+		tok        string
+		wantErrMsg string
+	}{{
+		conf:       c,
+		now:        now,
+		name:       "valid",
+		tok:        tok,
+		wantErrMsg: "",
+	}, {
+		conf:       c,
+		now:        now,
+		name:       "empty",
+		tok:        "",
+		wantErrMsg: "no csrf token",
+	}, {
+		conf:       c,
+		now:        now,
+		name:       "bad_base64",
+		tok:        "!!!",
+		wantErrMsg: "invalid csrf token",
+	}, {
+		conf:       otherKeyConf,
+		now:        now,
+		name:       "other_key",
+		tok:        tok,
+		wantErrMsg: "invalid csrf token",
+	}, {
+		conf:       c,
+		now:        now.Add(2 * c.TokenTTL),
+		name:       "expired",
+		tok:        tok,
+		wantErrMsg: "csrf token expired",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err = validateCSRFToken(tc.conf, tc.tok, tc.now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
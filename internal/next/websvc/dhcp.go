@@ -0,0 +1,336 @@
+package websvc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
+	httptreemux "github.com/dimfeld/httptreemux/v5"
+)
+
+// DHCP Handlers
+
+// DHCPService is the DHCP service as used by the web service.
+type DHCPService interface {
+	agh.ServiceWithConfig[*dhcpsvc.Config]
+
+	// Leases returns all dynamic and static leases.
+	Leases() (leases []*dhcpd.Lease)
+
+	// AddStaticLease adds a static lease.  It also sets the expiration
+	// time of l to mark it as static.
+	AddStaticLease(l *dhcpd.Lease) (err error)
+
+	// RemoveStaticLease removes a static lease.
+	RemoveStaticLease(l *dhcpd.Lease) (err error)
+}
+
+// HTTPAPIDHCPSettings are the DHCP settings as used by the HTTP API.  See the
+// DhcpSettings object in the OpenAPI specification.
+type HTTPAPIDHCPSettings struct {
+	InterfaceName     string       `json:"interface_name"`
+	IPv4GatewayIP     netip.Addr   `json:"ipv4_gateway_ip"`
+	IPv4SubnetMask    netip.Addr   `json:"ipv4_subnet_mask"`
+	IPv4RangeStart    netip.Addr   `json:"ipv4_range_start"`
+	IPv4RangeEnd      netip.Addr   `json:"ipv4_range_end"`
+	IPv4LeaseDuration JSONDuration `json:"ipv4_lease_duration"`
+	IPv6RangeStart    netip.Addr   `json:"ipv6_range_start"`
+	IPv6LeaseDuration JSONDuration `json:"ipv6_lease_duration"`
+	Enabled           bool         `json:"enabled"`
+}
+
+// newHTTPAPIDHCPSettings returns the HTTP API representation of c.
+func newHTTPAPIDHCPSettings(c *dhcpsvc.Config) (s *HTTPAPIDHCPSettings) {
+	s = &HTTPAPIDHCPSettings{
+		InterfaceName: c.InterfaceName,
+		Enabled:       c.Enabled,
+	}
+
+	if c4 := c.IPv4; c4 != nil {
+		s.IPv4GatewayIP = c4.GatewayIP
+		s.IPv4SubnetMask = c4.SubnetMask
+		s.IPv4RangeStart = c4.RangeStart
+		s.IPv4RangeEnd = c4.RangeEnd
+		s.IPv4LeaseDuration = JSONDuration(c4.LeaseDuration)
+	}
+
+	if c6 := c.IPv6; c6 != nil {
+		s.IPv6RangeStart = c6.RangeStart
+		s.IPv6LeaseDuration = JSONDuration(c6.LeaseDuration)
+	}
+
+	return s
+}
+
+// toConfig returns the DHCP service configuration created from s and the
+// parameters of the current configuration cur, which aren't exposed via the
+// HTTP API.  The server of an address family is disabled if its range start
+// is not set.
+func (s *HTTPAPIDHCPSettings) toConfig(cur *dhcpsvc.Config) (c *dhcpsvc.Config) {
+	c = &dhcpsvc.Config{
+		InterfaceName:   s.InterfaceName,
+		LocalDomainName: cur.LocalDomainName,
+		OnLeaseAdded:    cur.OnLeaseAdded,
+		OnLeaseEvent:    cur.OnLeaseEvent,
+		WorkDir:         cur.WorkDir,
+		Enabled:         s.Enabled,
+	}
+
+	if s.IPv4RangeStart.IsValid() {
+		c.IPv4 = &dhcpsvc.IPv4Config{
+			GatewayIP:     s.IPv4GatewayIP,
+			SubnetMask:    s.IPv4SubnetMask,
+			RangeStart:    s.IPv4RangeStart,
+			RangeEnd:      s.IPv4RangeEnd,
+			LeaseDuration: time.Duration(s.IPv4LeaseDuration),
+		}
+	}
+
+	if s.IPv6RangeStart.IsValid() {
+		c.IPv6 = &dhcpsvc.IPv6Config{
+			RangeStart:    s.IPv6RangeStart,
+			LeaseDuration: time.Duration(s.IPv6LeaseDuration),
+		}
+	}
+
+	return c
+}
+
+// handleGetV1SettingsDHCP is the handler for the GET /api/v1/settings/dhcp HTTP
+// API.
+func (svc *Service) handleGetV1SettingsDHCP(w http.ResponseWriter, r *http.Request) {
+	conf := svc.confMgr.DHCP().Config()
+
+	writeJSONOKResponse(w, r, newHTTPAPIDHCPSettings(conf))
+}
+
+// handlePatchV1SettingsDHCP is the handler for the PATCH /api/v1/settings/dhcp
+// HTTP API.  The fields absent from the request are left unchanged.
+func (svc *Service) handlePatchV1SettingsDHCP(w http.ResponseWriter, r *http.Request) {
+	cur := svc.confMgr.DHCP().Config()
+	req := newHTTPAPIDHCPSettings(cur)
+
+	// TODO(a.garipov): Validate nulls.
+
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	newConf := req.toConfig(cur)
+	_, err = svc.confMgr.UpdateDHCP(r.Context(), newConf)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("updating: %w", err))
+
+		return
+	}
+
+	writeJSONOKResponse(w, r, newHTTPAPIDHCPSettings(newConf))
+}
+
+// HTTPAPIDHCPLease is a dynamic or a static DHCP lease as used by the HTTP API.
+// See the DhcpLease object in the OpenAPI specification.
+type HTTPAPIDHCPLease struct {
+	// Expires is the expiration time of a dynamic lease.  It is nil for the
+	// static ones.
+	Expires *JSONTime `json:"expires,omitempty"`
+
+	// UID is the ID of a static lease.  It is empty for the dynamic ones.
+	UID string `json:"uid,omitempty"`
+
+	Hostname string     `json:"hostname"`
+	MAC      string     `json:"mac"`
+	IP       netip.Addr `json:"ip"`
+}
+
+// newHTTPAPIDHCPLease returns the HTTP API representation of l.
+func newHTTPAPIDHCPLease(l *dhcpd.Lease) (hl *HTTPAPIDHCPLease) {
+	hl = &HTTPAPIDHCPLease{
+		Hostname: l.Hostname,
+		MAC:      l.HWAddr.String(),
+		IP:       l.IP,
+	}
+
+	if l.IsStatic() {
+		hl.UID = leaseUID(l)
+	} else {
+		exp := JSONTime(l.Expiry)
+		hl.Expires = &exp
+	}
+
+	return hl
+}
+
+// leaseUID returns the ID of the static lease l, which is its hexadecimal
+// hardware address, since there can only be one static lease per address.
+func leaseUID(l *dhcpd.Lease) (uid string) {
+	return hex.EncodeToString(l.HWAddr)
+}
+
+// toLease returns a static lease created from hl.
+func (hl *HTTPAPIDHCPLease) toLease() (l *dhcpd.Lease, err error) {
+	mac, err := net.ParseMAC(hl.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("mac: %w", err)
+	}
+
+	if !hl.IP.IsValid() {
+		return nil, fmt.Errorf("ip: bad value %q", hl.IP)
+	}
+
+	return &dhcpd.Lease{
+		Hostname: hl.Hostname,
+		HWAddr:   mac,
+		IP:       hl.IP.Unmap(),
+	}, nil
+}
+
+// RespGetV1DHCPLeases describes the response of the GET /api/v1/dhcp/leases
+// HTTP API.
+type RespGetV1DHCPLeases struct {
+	Leases []*HTTPAPIDHCPLease `json:"leases"`
+}
+
+// handleGetV1DHCPLeases is the handler for the GET /api/v1/dhcp/leases HTTP
+// API.
+func (svc *Service) handleGetV1DHCPLeases(w http.ResponseWriter, r *http.Request) {
+	leases := svc.confMgr.DHCP().Leases()
+	resp := &RespGetV1DHCPLeases{
+		Leases: make([]*HTTPAPIDHCPLease, 0, len(leases)),
+	}
+
+	for _, l := range leases {
+		resp.Leases = append(resp.Leases, newHTTPAPIDHCPLease(l))
+	}
+
+	writeJSONOKResponse(w, r, resp)
+}
+
+// handlePostV1DHCPLeases is the handler for the POST /api/v1/dhcp/leases HTTP
+// API.
+func (svc *Service) handlePostV1DHCPLeases(w http.ResponseWriter, r *http.Request) {
+	req := &HTTPAPIDHCPLease{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	l, err := req.toLease()
+	if err != nil {
+		writeJSONErrorResponse(w, r, err)
+
+		return
+	}
+
+	err = svc.confMgr.DHCP().AddStaticLease(l)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("adding lease: %w", err))
+
+		return
+	}
+
+	writeJSONOKResponse(w, r, newHTTPAPIDHCPLease(l))
+}
+
+// handleDeleteV1DHCPLease is the handler for the DELETE
+// /api/v1/dhcp/leases/{lease_uid} HTTP API.
+func (svc *Service) handleDeleteV1DHCPLease(w http.ResponseWriter, r *http.Request) {
+	dhcpSvc := svc.confMgr.DHCP()
+	l, ok := findStaticLease(dhcpSvc, r)
+	if !ok {
+		writeLeaseNotFound(w, r)
+
+		return
+	}
+
+	err := dhcpSvc.RemoveStaticLease(l)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("removing lease: %w", err))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePatchV1DHCPLease is the handler for the PATCH
+// /api/v1/dhcp/leases/{lease_uid} HTTP API.  The fields absent from the request
+// are left unchanged.
+func (svc *Service) handlePatchV1DHCPLease(w http.ResponseWriter, r *http.Request) {
+	dhcpSvc := svc.confMgr.DHCP()
+	prev, ok := findStaticLease(dhcpSvc, r)
+	if !ok {
+		writeLeaseNotFound(w, r)
+
+		return
+	}
+
+	req := newHTTPAPIDHCPLease(prev)
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	l, err := req.toLease()
+	if err != nil {
+		writeJSONErrorResponse(w, r, err)
+
+		return
+	}
+
+	err = dhcpSvc.RemoveStaticLease(prev)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("removing previous lease: %w", err))
+
+		return
+	}
+
+	err = dhcpSvc.AddStaticLease(l)
+	if err != nil {
+		// Try to restore the previous lease so that the update is atomic for
+		// the user.
+		if rerr := dhcpSvc.AddStaticLease(prev); rerr != nil {
+			err = fmt.Errorf("%w; restoring previous lease: %s", err, rerr)
+		}
+
+		writeJSONErrorResponse(w, r, fmt.Errorf("adding lease: %w", err))
+
+		return
+	}
+
+	writeJSONOKResponse(w, r, newHTTPAPIDHCPLease(l))
+}
+
+// findStaticLease returns the static lease with the ID from the path of r.
+func findStaticLease(dhcpSvc DHCPService, r *http.Request) (l *dhcpd.Lease, ok bool) {
+	uid := httptreemux.ContextParams(r.Context())["lease_uid"]
+	for _, l = range dhcpSvc.Leases() {
+		if l.IsStatic() && leaseUID(l) == uid {
+			return l, true
+		}
+	}
+
+	return nil, false
+}
+
+// writeLeaseNotFound writes the JSON response about an absent static lease to
+// w.
+func writeLeaseNotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, r, &HTTPAPIErrorResp{
+		Code: ErrorCodeTMP000,
+		Msg:  "static lease not found",
+	}, http.StatusNotFound)
+}
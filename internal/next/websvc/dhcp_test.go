@@ -0,0 +1,288 @@
+package websvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStaticExpiry is the expiration time of static leases.
+var testStaticExpiry = time.Unix(1, 0)
+
+// newTestLeases returns a dynamic and a static lease for tests.
+func newTestLeases() (dynamic, static *dhcpd.Lease) {
+	dynamic = &dhcpd.Lease{
+		Expiry:   testStart.Add(1 * time.Hour),
+		Hostname: "dynamic",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		IP:       netip.MustParseAddr("192.168.0.100"),
+	}
+
+	static = &dhcpd.Lease{
+		Expiry:   testStaticExpiry,
+		Hostname: "static",
+		HWAddr:   net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		IP:       netip.MustParseAddr("192.168.0.2"),
+	}
+
+	return dynamic, static
+}
+
+func TestService_HandlePatchSettingsDHCP(t *testing.T) {
+	curConf := &dhcpsvc.Config{
+		InterfaceName:   "eth0",
+		LocalDomainName: "lan",
+		WorkDir:         "/tmp",
+		Enabled:         false,
+	}
+
+	wantDHCP := &websvc.HTTPAPIDHCPSettings{
+		InterfaceName:     "eth0",
+		IPv4GatewayIP:     netip.MustParseAddr("192.168.0.1"),
+		IPv4SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		IPv4RangeStart:    netip.MustParseAddr("192.168.0.100"),
+		IPv4RangeEnd:      netip.MustParseAddr("192.168.0.200"),
+		IPv4LeaseDuration: websvc.JSONDuration(24 * time.Hour),
+		Enabled:           true,
+	}
+
+	var gotConf *dhcpsvc.Config
+	confMgr := newConfigManager()
+	confMgr.onDHCP = func() (s websvc.DHCPService) {
+		dhcpSvc := newDHCPService()
+		dhcpSvc.onConfig = func() (c *dhcpsvc.Config) { return curConf }
+
+		return dhcpSvc
+	}
+	confMgr.onUpdateDHCP = func(
+		_ context.Context,
+		c *dhcpsvc.Config,
+	) (s websvc.DHCPService, err error) {
+		gotConf = c
+
+		// The configuration manager starts the new service itself.
+		return newDHCPService(), nil
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1SettingsDHCP,
+	}
+
+	req := jobj{
+		"ipv4_gateway_ip":     wantDHCP.IPv4GatewayIP,
+		"ipv4_subnet_mask":    wantDHCP.IPv4SubnetMask,
+		"ipv4_range_start":    wantDHCP.IPv4RangeStart,
+		"ipv4_range_end":      wantDHCP.IPv4RangeEnd,
+		"ipv4_lease_duration": wantDHCP.IPv4LeaseDuration,
+		"enabled":             true,
+	}
+
+	respBody := httpPatch(t, u, req, http.StatusOK)
+	resp := &websvc.HTTPAPIDHCPSettings{}
+	err := json.Unmarshal(respBody, resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, wantDHCP, resp)
+
+	require.NotNil(t, gotConf)
+
+	assert.Equal(t, curConf.LocalDomainName, gotConf.LocalDomainName)
+	assert.Equal(t, curConf.WorkDir, gotConf.WorkDir)
+	assert.Nil(t, gotConf.IPv6)
+
+	require.NotNil(t, gotConf.IPv4)
+
+	assert.Equal(t, wantDHCP.IPv4RangeStart, gotConf.IPv4.RangeStart)
+}
+
+func TestService_HandleGetDHCPLeases(t *testing.T) {
+	dynamic, static := newTestLeases()
+
+	confMgr := newConfigManager()
+	confMgr.onDHCP = func() (s websvc.DHCPService) {
+		dhcpSvc := newDHCPService()
+		dhcpSvc.onLeases = func() (leases []*dhcpd.Lease) {
+			return []*dhcpd.Lease{static, dynamic}
+		}
+
+		return dhcpSvc
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1DHCPLeases,
+	}
+
+	body := httpGet(t, u, http.StatusOK)
+	resp := &websvc.RespGetV1DHCPLeases{}
+	err := json.Unmarshal(body, resp)
+	require.NoError(t, err)
+	require.Len(t, resp.Leases, 2)
+
+	gotStatic, gotDynamic := resp.Leases[0], resp.Leases[1]
+
+	assert.Equal(t, "bbbbbbbbbbbb", gotStatic.UID)
+	assert.Nil(t, gotStatic.Expires)
+	assert.Equal(t, static.IP, gotStatic.IP)
+
+	assert.Empty(t, gotDynamic.UID)
+	require.NotNil(t, gotDynamic.Expires)
+
+	assert.True(t, dynamic.Expiry.Equal(time.Time(*gotDynamic.Expires)))
+	assert.Equal(t, dynamic.HWAddr.String(), gotDynamic.MAC)
+}
+
+func TestService_HandlePostDHCPLeases(t *testing.T) {
+	var added atomic.Pointer[dhcpd.Lease]
+	confMgr := newConfigManager()
+	confMgr.onDHCP = func() (s websvc.DHCPService) {
+		dhcpSvc := newDHCPService()
+		dhcpSvc.onAddStaticLease = func(l *dhcpd.Lease) (err error) {
+			l.Expiry = testStaticExpiry
+			added.Store(l)
+
+			return nil
+		}
+
+		return dhcpSvc
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1DHCPLeases,
+	}
+
+	testCases := []struct {
+		req      jobj
+		name     string
+		wantCode int
+	}{{
+		req: jobj{
+			"hostname": "printer",
+			"mac":      "cc:cc:cc:cc:cc:cc",
+			"ip":       "192.168.0.3",
+		},
+		name:     "success",
+		wantCode: http.StatusOK,
+	}, {
+		req: jobj{
+			"hostname": "printer",
+			"mac":      "bad",
+			"ip":       "192.168.0.3",
+		},
+		name:     "bad_mac",
+		wantCode: http.StatusUnprocessableEntity,
+	}, {
+		req: jobj{
+			"hostname": "printer",
+			"mac":      "cc:cc:cc:cc:cc:cc",
+		},
+		name:     "no_ip",
+		wantCode: http.StatusUnprocessableEntity,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			added.Store(nil)
+
+			body := httpDo(t, http.MethodPost, u, tc.req, tc.wantCode)
+			if tc.wantCode != http.StatusOK {
+				assert.Nil(t, added.Load())
+
+				return
+			}
+
+			resp := &websvc.HTTPAPIDHCPLease{}
+			err := json.Unmarshal(body, resp)
+			require.NoError(t, err)
+
+			assert.Equal(t, "cccccccccccc", resp.UID)
+			assert.Nil(t, resp.Expires)
+
+			l := added.Load()
+			require.NotNil(t, l)
+
+			assert.Equal(t, netip.MustParseAddr("192.168.0.3"), l.IP)
+		})
+	}
+}
+
+func TestService_HandleDeleteDHCPLease(t *testing.T) {
+	dynamic, static := newTestLeases()
+
+	var removed atomic.Pointer[dhcpd.Lease]
+	confMgr := newConfigManager()
+	confMgr.onDHCP = func() (s websvc.DHCPService) {
+		dhcpSvc := newDHCPService()
+		dhcpSvc.onLeases = func() (leases []*dhcpd.Lease) {
+			return []*dhcpd.Lease{static, dynamic}
+		}
+		dhcpSvc.onRemoveStaticLease = func(l *dhcpd.Lease) (err error) {
+			removed.Store(l)
+
+			return nil
+		}
+
+		return dhcpSvc
+	}
+
+	_, addr := newTestServer(t, confMgr)
+
+	testCases := []struct {
+		wantRemoved *dhcpd.Lease
+		name        string
+		uid         string
+		wantCode    int
+	}{{
+		wantRemoved: static,
+		name:        "success",
+		uid:         "bbbbbbbbbbbb",
+		wantCode:    http.StatusNoContent,
+	}, {
+		wantRemoved: nil,
+		name:        "dynamic",
+		uid:         "aaaaaaaaaaaa",
+		wantCode:    http.StatusNotFound,
+	}, {
+		wantRemoved: nil,
+		name:        "not_found",
+		uid:         "cccccccccccc",
+		wantCode:    http.StatusNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			removed.Store(nil)
+
+			u := &url.URL{
+				Scheme: "http",
+				Host:   addr.String(),
+				Path:   path.Join(websvc.PathV1DHCPLeases, tc.uid),
+			}
+
+			_ = httpDo(t, http.MethodDelete, u, nil, tc.wantCode)
+
+			assert.Equal(t, tc.wantRemoved, removed.Load())
+		})
+	}
+}
@@ -52,29 +52,26 @@ func (svc *Service) handlePatchSettingsDNS(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Keep the access settings, since they are changed by a separate API.
+	curConf := svc.confMgr.DNS().Config()
 	newConf := &dnssvc.Config{
 		Addresses:        req.Addresses,
 		BootstrapServers: req.BootstrapServers,
 		UpstreamServers:  req.UpstreamServers,
+		AllowedClients:   curConf.AllowedClients,
+		BlockedClients:   curConf.BlockedClients,
+		BlockedHosts:     curConf.BlockedHosts,
 		UpstreamTimeout:  time.Duration(req.UpstreamTimeout),
 	}
 
 	ctx := r.Context()
-	err = svc.confMgr.UpdateDNS(ctx, newConf)
+	_, err = svc.confMgr.UpdateDNS(ctx, newConf)
 	if err != nil {
 		writeJSONErrorResponse(w, r, fmt.Errorf("updating: %w", err))
 
 		return
 	}
 
-	newSvc := svc.confMgr.DNS()
-	err = newSvc.Start()
-	if err != nil {
-		writeJSONErrorResponse(w, r, fmt.Errorf("starting new service: %w", err))
-
-		return
-	}
-
 	writeJSONOKResponse(w, r, &HTTPAPIDNSSettings{
 		Addresses:        newConf.Addresses,
 		BootstrapServers: newConf.BootstrapServers,
@@ -26,21 +26,23 @@ func TestService_HandlePatchSettingsDNS(t *testing.T) {
 		UpstreamTimeout:  websvc.JSONDuration(2 * time.Second),
 	}
 
-	var started atomic.Bool
+	var updated atomic.Bool
 	confMgr := newConfigManager()
 	confMgr.onDNS = func() (s agh.ServiceWithConfig[*dnssvc.Config]) {
-		return &aghtest.ServiceWithConfig[*dnssvc.Config]{
-			OnStart: func() (err error) {
-				started.Store(true)
+		return newTestDNSService(&dnssvc.Config{})
+	}
+	confMgr.onUpdateDNS = func(
+		_ context.Context,
+		_ *dnssvc.Config,
+	) (s agh.ServiceWithConfig[*dnssvc.Config], err error) {
+		updated.Store(true)
 
-				return nil
-			},
+		// The configuration manager starts the new service itself.
+		return &aghtest.ServiceWithConfig[*dnssvc.Config]{
+			OnStart:    func() (err error) { panic("not implemented") },
 			OnShutdown: func(_ context.Context) (err error) { panic("not implemented") },
 			OnConfig:   func() (c *dnssvc.Config) { panic("not implemented") },
-		}
-	}
-	confMgr.onUpdateDNS = func(ctx context.Context, c *dnssvc.Config) (err error) {
-		return nil
+		}, nil
 	}
 
 	_, addr := newTestServer(t, confMgr)
@@ -62,7 +64,7 @@ func TestService_HandlePatchSettingsDNS(t *testing.T) {
 	err := json.Unmarshal(respBody, resp)
 	require.NoError(t, err)
 
-	assert.True(t, started.Load())
+	assert.True(t, updated.Load())
 	assert.Equal(t, wantDNS, resp)
 	assert.Equal(t, wantDNS, resp)
 }
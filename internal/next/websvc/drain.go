@@ -0,0 +1,68 @@
+package websvc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Connection Draining
+
+// drainRetryAfter is the time after which the clients, which have sent their
+// requests to a draining service, are asked to retry.  It should be enough for
+// the new service to start.
+const drainRetryAfter = 1 * time.Second
+
+// drainMw returns a handler that responds with 503 Service Unavailable and the
+// Retry-After header to the requests that arrive after svc has started
+// draining and passes all other requests to h.  The connection is closed after
+// the response, so that the client reconnects to the new service.
+func (svc *Service) drainMw(h http.Handler) (wrapped http.Handler) {
+	retryAfter := strconv.FormatInt(int64(drainRetryAfter/time.Second), 10)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !svc.draining.Load() {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		hdr := w.Header()
+		hdr.Set(aghhttp.HdrNameRetryAfter, retryAfter)
+		hdr.Set(aghhttp.HdrNameConnection, aghhttp.HdrValClose)
+
+		writeJSONResponse(w, r, &HTTPAPIErrorResp{
+			Code: ErrorCodeTMP000,
+			Msg:  "service is being reconfigured",
+		}, http.StatusServiceUnavailable)
+	})
+}
+
+// shutdownTimeout returns the maximum duration of waiting for the in-flight
+// requests during the shutdown of svc.
+func (svc *Service) shutdownTimeout() (d time.Duration) {
+	if svc.gracePeriod > 0 {
+		return svc.gracePeriod
+	}
+
+	return svc.timeout
+}
+
+// shutdownServer gracefully shuts srv down.  If the in-flight requests don't
+// finish until ctx is done, their connections are closed forcibly, which isn't
+// considered an error.
+func shutdownServer(ctx context.Context, srv *http.Server) (err error) {
+	err = srv.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	log.Info("websvc: srv %s: grace period is over, closing active connections", srv.Addr)
+
+	return srv.Close()
+}
@@ -0,0 +1,118 @@
+package websvc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_drainMw(t *testing.T) {
+	svc := New(&Config{
+		Timeout: testTimeout,
+	})
+
+	h := svc.drainMw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "OK")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, PathHealthCheck, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", w.Body.String())
+
+	svc.draining.Store(true)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get(aghhttp.HdrNameRetryAfter))
+	assert.Equal(t, aghhttp.HdrValClose, w.Header().Get(aghhttp.HdrNameConnection))
+}
+
+func TestShutdownServer(t *testing.T) {
+	// newServer returns a started server, the requests to which are handled
+	// after the returned channel is closed.
+	newServer := func(t *testing.T) (srv *http.Server, release chan struct{}, url string) {
+		t.Helper()
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		release = make(chan struct{})
+		srv = &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				<-release
+				_, _ = io.WriteString(w, "OK")
+			}),
+			ReadHeaderTimeout: testTimeout,
+		}
+
+		go func() { _ = srv.Serve(l) }()
+
+		return srv, release, "http://" + l.Addr().String()
+	}
+
+	// get starts a request to url and returns the channel that receives its
+	// result.
+	get := func(url string) (errCh chan error) {
+		errCh = make(chan error, 1)
+		go func() {
+			resp, err := http.Get(url)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+			}
+
+			errCh <- err
+		}()
+
+		return errCh
+	}
+
+	t.Run("drained", func(t *testing.T) {
+		srv, release, url := newServer(t)
+		errCh := get(url)
+
+		// Let the request reach the handler.
+		time.Sleep(testTimeout / 10)
+		time.AfterFunc(testTimeout/10, func() { close(release) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		err := shutdownServer(ctx, srv)
+		require.NoError(t, err)
+
+		assert.NoError(t, <-errCh)
+	})
+
+	t.Run("grace_period_over", func(t *testing.T) {
+		srv, release, url := newServer(t)
+		defer close(release)
+
+		errCh := get(url)
+
+		// Let the request reach the handler.
+		time.Sleep(testTimeout / 10)
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout/10)
+		defer cancel()
+
+		err := shutdownServer(ctx, srv)
+		require.NoError(t, err)
+
+		assert.Error(t, <-errCh)
+	})
+}
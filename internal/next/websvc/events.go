@@ -0,0 +1,291 @@
+package websvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Server-Sent Events
+
+// EventType is the type of a server-sent event.
+type EventType string
+
+// EventType constants.
+const (
+	EventTypeConfigUpdated     EventType = "config_updated"
+	EventTypeDHCPLeaseAdded    EventType = "dhcp_lease_added"
+	EventTypeDHCPLeaseDeclined EventType = "dhcp_lease_declined"
+	EventTypeDHCPLeaseExpired  EventType = "dhcp_lease_expired"
+	EventTypeDHCPLeaseReleased EventType = "dhcp_lease_released"
+	EventTypeDHCPLeaseRenewed  EventType = "dhcp_lease_renewed"
+	EventTypeFiltersRefreshed  EventType = "filters_refreshed"
+	EventTypeInterfaceChanged  EventType = "interface_changed"
+	EventTypeUpdateAvailable   EventType = "update_available"
+)
+
+// Event is a single event sent to the clients of the GET /api/v1/events HTTP
+// API.
+type Event struct {
+	// Data is the optional payload of the event.  It must be encodable to
+	// JSON.
+	Data any
+
+	// Type is the type of the event.
+	Type EventType
+}
+
+// EventConfigUpdated is the payload of an [EventTypeConfigUpdated] event.
+type EventConfigUpdated struct {
+	// Service is the name of the updated service, for example "dns".
+	Service string `json:"service"`
+}
+
+// EventDHCPLease is the payload of the events of the dynamic DHCP leases, such
+// as [EventTypeDHCPLeaseRenewed].
+type EventDHCPLease struct {
+	// HWAddr is the hardware address of the client.
+	HWAddr string `json:"mac"`
+
+	// Hostname is the hostname of the client.
+	Hostname string `json:"hostname"`
+
+	// IP is the leased IP address.
+	IP netip.Addr `json:"ip"`
+}
+
+// EventInterfaceChanged is the payload of an [EventTypeInterfaceChanged] event.
+type EventInterfaceChanged struct {
+	// Name is the name of the network interface.
+	Name string `json:"name"`
+
+	// Addresses are the new IP addresses of the interface.
+	Addresses []netip.Addr `json:"addresses"`
+}
+
+// Event stream constants.
+const (
+	// eventsHistorySize is the number of the last events that are resent to
+	// the reconnecting clients.
+	eventsHistorySize = 100
+
+	// eventsSubBufSize is the number of events buffered for a single client.
+	// The clients that fall behind further are disconnected and get the
+	// missed events after reconnecting.
+	eventsSubBufSize = 16
+
+	// eventsHeartbeatIvl is the interval between the comments sent to the
+	// clients to keep the idle connections open.
+	eventsHeartbeatIvl = 15 * time.Second
+
+	// eventsRetry is the reconnection delay sent to the clients.
+	eventsRetry = 1 * time.Second
+)
+
+// sentEvent is an event with its JSON-encoded data and sequence number.
+type sentEvent struct {
+	typ  EventType
+	data []byte
+	id   uint64
+}
+
+// Events distributes events to the clients of the GET /api/v1/events HTTP API.
+// It is shared between the instances of the web service created after
+// reconfigurations, so that the reconnecting clients don't miss any events.
+// An *Events is safe for concurrent use.
+type Events struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// subs are the channels of the connected clients.
+	subs map[chan *sentEvent]struct{}
+
+	// history are the last sent events, oldest first.
+	history []*sentEvent
+
+	// lastID is the sequence number of the last sent event.
+	lastID uint64
+}
+
+// NewEvents returns a new properly initialized *Events.
+func NewEvents() (e *Events) {
+	return &Events{
+		mu:   &sync.Mutex{},
+		subs: map[chan *sentEvent]struct{}{},
+	}
+}
+
+// Publish sends ev to all connected clients.  e may be nil.
+func (e *Events) Publish(ev *Event) {
+	if e == nil {
+		return
+	}
+
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		log.Error("websvc: events: encoding %s: %s", ev.Type, err)
+
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastID++
+	se := &sentEvent{
+		typ:  ev.Type,
+		data: data,
+		id:   e.lastID,
+	}
+
+	e.history = append(e.history, se)
+	if len(e.history) > eventsHistorySize {
+		e.history = e.history[len(e.history)-eventsHistorySize:]
+	}
+
+	for ch := range e.subs {
+		select {
+		case ch <- se:
+			// Go on.
+		default:
+			log.Debug("websvc: events: client is too slow, disconnecting")
+
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a new client, which has received all events up to and
+// including the one with lastID.  missed are the events from the history that
+// the client hasn't received yet.
+func (e *Events) subscribe(lastID uint64) (ch chan *sentEvent, missed []*sentEvent) {
+	ch = make(chan *sentEvent, eventsSubBufSize)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, se := range e.history {
+		if se.id > lastID {
+			missed = append(missed, se)
+		}
+	}
+
+	e.subs[ch] = struct{}{}
+
+	return ch, missed
+}
+
+// unsubscribe removes the client with ch, unless it has already been removed.
+func (e *Events) unsubscribe(ch chan *sentEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.subs[ch]; ok {
+		delete(e.subs, ch)
+		close(ch)
+	}
+}
+
+// writeEvent writes se to w in the event stream format.
+func writeEvent(w io.Writer, se *sentEvent) (err error) {
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", se.id, se.typ, se.data)
+
+	return err
+}
+
+// handleGetV1Events is the handler for the GET /api/v1/events HTTP API.  The
+// stream is closed shortly before the write timeout of the server, and the
+// clients are expected to reconnect and send the Last-Event-ID header.
+//
+// TODO(a.garipov): Use [http.ResponseController] to extend the write deadline
+// instead once Go 1.20 is required.
+func (svc *Service) handleGetV1Events(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONResponse(w, r, &HTTPAPIErrorResp{
+			Code: ErrorCodeTMP000,
+			Msg:  "streaming is not supported",
+		}, http.StatusInternalServerError)
+
+		return
+	}
+
+	// Ignore the invalid IDs and send the whole history in that case.
+	lastID, _ := strconv.ParseUint(r.Header.Get(aghhttp.HdrNameLastEventID), 10, 64)
+	ch, missed := svc.events.subscribe(lastID)
+	defer svc.events.unsubscribe(ch)
+
+	h := w.Header()
+	h.Set(aghhttp.HdrNameContentType, aghhttp.HdrValTextEventStream)
+	h.Set(aghhttp.HdrNameCacheControl, aghhttp.HdrValNoCache)
+	w.WriteHeader(http.StatusOK)
+
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	for i := 0; err == nil && i < len(missed); i++ {
+		err = writeEvent(w, missed[i])
+	}
+
+	if err != nil {
+		log.Debug("websvc: events: writing: %s", err)
+
+		return
+	}
+
+	f.Flush()
+
+	svc.streamEvents(w, f, r, ch)
+}
+
+// streamEvents writes the events from ch to w until the client disconnects, ch
+// is closed, the service is shut down, or the stream is about to exceed the
+// write timeout.
+func (svc *Service) streamEvents(
+	w http.ResponseWriter,
+	f http.Flusher,
+	r *http.Request,
+	ch <-chan *sentEvent,
+) {
+	// Leave some time to finish the response before the write timeout.
+	streamTimer := time.NewTimer(svc.timeout * 9 / 10)
+	defer streamTimer.Stop()
+
+	heartbeat := time.NewTicker(eventsHeartbeatIvl)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-svc.done:
+			return
+		case <-streamTimer.C:
+			return
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case se, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			err = writeEvent(w, se)
+		}
+
+		if err != nil {
+			log.Debug("websvc: events: writing: %s", err)
+
+			return
+		}
+
+		f.Flush()
+	}
+}
@@ -0,0 +1,112 @@
+package websvc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	e := NewEvents()
+	for i := 0; i < 3; i++ {
+		e.Publish(&Event{
+			Type: EventTypeFiltersRefreshed,
+		})
+	}
+
+	t.Run("history", func(t *testing.T) {
+		ch, missed := e.subscribe(1)
+		t.Cleanup(func() { e.unsubscribe(ch) })
+
+		require.Len(t, missed, 2)
+
+		assert.Equal(t, uint64(2), missed[0].id)
+		assert.Equal(t, uint64(3), missed[1].id)
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		ch, missed := e.subscribe(3)
+		t.Cleanup(func() { e.unsubscribe(ch) })
+
+		assert.Empty(t, missed)
+
+		e.Publish(&Event{
+			Data: &EventConfigUpdated{Service: "dns"},
+			Type: EventTypeConfigUpdated,
+		})
+
+		se := <-ch
+		require.NotNil(t, se)
+
+		assert.Equal(t, uint64(4), se.id)
+		assert.Equal(t, EventTypeConfigUpdated, se.typ)
+		assert.Equal(t, `{"service":"dns"}`, string(se.data))
+	})
+
+	t.Run("slow_client", func(t *testing.T) {
+		ch, _ := e.subscribe(0)
+		t.Cleanup(func() { e.unsubscribe(ch) })
+
+		for i := 0; i < eventsSubBufSize+1; i++ {
+			e.Publish(&Event{
+				Type: EventTypeUpdateAvailable,
+			})
+		}
+
+		n := 0
+		for range ch {
+			n++
+		}
+
+		assert.Equal(t, eventsSubBufSize, n)
+	})
+
+	t.Run("history_size", func(t *testing.T) {
+		for i := 0; i < eventsHistorySize; i++ {
+			e.Publish(&Event{
+				Type: EventTypeDHCPLeaseAdded,
+			})
+		}
+
+		ch, missed := e.subscribe(0)
+		t.Cleanup(func() { e.unsubscribe(ch) })
+
+		assert.Len(t, missed, eventsHistorySize)
+	})
+}
+
+func TestService_handleGetV1Events(t *testing.T) {
+	e := NewEvents()
+	e.Publish(&Event{
+		Data: &EventConfigUpdated{Service: "dns"},
+		Type: EventTypeConfigUpdated,
+	})
+	e.Publish(&Event{
+		Type: EventTypeDHCPLeaseAdded,
+	})
+
+	svc := New(&Config{
+		Events:  e,
+		Timeout: 100 * time.Millisecond,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, PathV1Events, nil)
+	r.Header.Set(aghhttp.HdrNameLastEventID, "1")
+	w := httptest.NewRecorder()
+
+	// The handler returns before the write timeout.
+	svc.handleGetV1Events(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, aghhttp.HdrValTextEventStream, w.Header().Get(aghhttp.HdrNameContentType))
+	assert.True(t, w.Flushed)
+
+	wantBody := "retry: 1000\n\n" +
+		"id: 2\nevent: dhcp_lease_added\ndata: null\n\n"
+	assert.Equal(t, wantBody, w.Body.String())
+}
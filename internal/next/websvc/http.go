@@ -8,7 +8,6 @@ import (
 	"net/netip"
 	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
 	"github.com/AdguardTeam/golibs/log"
 )
 
@@ -52,12 +51,25 @@ func (svc *Service) handlePatchSettingsHTTP(w http.ResponseWriter, r *http.Reque
 	}
 
 	newConf := &Config{
-		ConfigManager:   svc.confMgr,
-		TLS:             svc.tls,
-		Addresses:       req.Addresses,
-		SecureAddresses: req.SecureAddresses,
-		Timeout:         time.Duration(req.Timeout),
-		ForceHTTPS:      svc.forceHTTPS,
+		ConfigManager:    svc.confMgr,
+		TLS:              svc.tls,
+		RateLimiter:      svc.rateLimiter,
+		CORS:             svc.cors,
+		CSRF:             svc.csrf,
+		Compression:      svc.compression,
+		Users:            svc.users,
+		Events:           svc.events,
+		Frontend:         svc.frontend,
+		OpenAPI:          svc.openAPI,
+		Start:            svc.start,
+		Addresses:        req.Addresses,
+		SecureAddresses:  req.SecureAddresses,
+		UnixSockets:      svc.unixSockets(),
+		RequestLogFormat: svc.reqLogFmt,
+		Timeout:          time.Duration(req.Timeout),
+		GracePeriod:      svc.gracePeriod,
+		ServeHTTP3:       svc.serveHTTP3,
+		ForceHTTPS:       svc.forceHTTPS,
 	}
 
 	writeJSONOKResponse(w, r, &HTTPAPIHTTPSettings{
@@ -67,44 +79,26 @@ func (svc *Service) handlePatchSettingsHTTP(w http.ResponseWriter, r *http.Reque
 		ForceHTTPS:      newConf.ForceHTTPS,
 	})
 
-	cancelUpd := func() {}
-	updCtx := context.Background()
-
-	ctx := r.Context()
-	if deadline, ok := ctx.Deadline(); ok {
-		updCtx, cancelUpd = context.WithDeadline(updCtx, deadline)
-	}
-
 	// Launch the new HTTP service in a separate goroutine to let this handler
 	// finish and thus, this server to shutdown.
-	go func() {
-		defer cancelUpd()
-
-		updErr := svc.confMgr.UpdateWeb(updCtx, newConf)
-		if updErr != nil {
-			writeJSONErrorResponse(w, r, fmt.Errorf("updating: %w", updErr))
-
-			return
-		}
-
-		// TODO(a.garipov): Consider better ways to do this.
-		const maxUpdDur = 10 * time.Second
-		updStart := time.Now()
-		var newSvc agh.ServiceWithConfig[*Config]
-		for newSvc = svc.confMgr.Web(); newSvc == svc; {
-			if time.Since(updStart) >= maxUpdDur {
-				log.Error("websvc: failed to update svc after %s", maxUpdDur)
-
-				return
-			}
-
-			log.Debug("websvc: waiting for new websvc to be configured")
-			time.Sleep(1 * time.Second)
-		}
-
-		updErr = newSvc.Start()
-		if updErr != nil {
-			log.Error("websvc: new svc failed to start with error: %s", updErr)
-		}
-	}()
+	go svc.relaunch(newConf)
+}
+
+// relaunch updates the web service using newConf.
+// It must be called in a separate goroutine, since the shutdown of svc waits for
+// all its handlers, including the calling one, to return.  All errors are only
+// logged, since the response has already been written by then.
+func (svc *Service) relaunch(newConf *Config) {
+	defer log.OnPanic("websvc: relaunching")
+
+	// The shutdown of the current service waits for the in-flight requests for
+	// at most the grace period, and the new service needs some time to start
+	// as well.
+	ctx, cancel := context.WithTimeout(context.Background(), svc.shutdownTimeout()+svc.timeout)
+	defer cancel()
+
+	_, err := svc.confMgr.UpdateWeb(ctx, newConf)
+	if err != nil {
+		log.Error("websvc: updating: %s", err)
+	}
 }
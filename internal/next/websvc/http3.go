@@ -0,0 +1,99 @@
+package websvc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP/3
+
+// http3Server is an HTTP/3 server serving the HTTP API on the same address as
+// a secure HTTP server.
+type http3Server struct {
+	// srv is the HTTP/3 server.  Its address is set when the TCP server is
+	// started, so that the addresses with the port zero work as well.
+	srv *http3.Server
+
+	// tcp is the secure HTTP server on the address of which srv serves.
+	tcp *http.Server
+}
+
+// newHTTP3Server returns a new HTTP/3 server paired with the secure server tcp.
+func newHTTP3Server(tcp *http.Server, h http.Handler) (s *http3Server) {
+	return &http3Server{
+		srv: &http3.Server{
+			// TODO(a.garipov): See if there is a way to use the error log as
+			// well as timeouts here.
+			Handler:   h,
+			TLSConfig: tcp.TLSConfig,
+		},
+		tcp: tcp,
+	}
+}
+
+// start binds s to the UDP address of its TCP server and serves the HTTP API
+// in a separate goroutine.  It must only be called after the TCP server has
+// been started.
+func (s *http3Server) start() (err error) {
+	addr := s.tcp.Addr
+	s.srv.Addr = addr
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("srv h3://%s: binding: %w", addr, err)
+	}
+
+	log.Info("websvc: starting srv h3://%s", addr)
+
+	go func() {
+		defer log.OnPanic(addr)
+
+		serr := s.srv.Serve(conn)
+		if serr != nil && !errors.Is(serr, quic.ErrServerClosed) {
+			log.Error("websvc: h3: %s: %s", addr, serr)
+		}
+	}()
+
+	return nil
+}
+
+// altSvcMw returns h wrapped with a handler, which advertises the HTTP/3
+// server on the same port to the clients of the secure HTTP servers using the
+// Alt-Svc header.
+//
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Alt-Svc.
+//
+// TODO(a.garipov): Consider adding a configurable max-age.  Currently, the
+// default is 24 hours.
+func altSvcMw(h http.Handler) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.ProtoMajor < 3 {
+			setAltSvc(w.Header(), r)
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+// setAltSvc sets the Alt-Svc header advertising the HTTP/3 server on the local
+// port of the connection of r.
+func setAltSvc(respHdr http.Header, r *http.Request) {
+	localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return
+	}
+
+	_, port, err := net.SplitHostPort(localAddr.String())
+	if err != nil {
+		return
+	}
+
+	respHdr.Set(aghhttp.HdrNameAltSvc, `h3=":`+port+`"`)
+}
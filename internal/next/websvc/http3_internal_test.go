@@ -0,0 +1,57 @@
+package websvc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAltSvcMw(t *testing.T) {
+	h := altSvcMw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	localAddr := &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: 8443}
+
+	testCases := []struct {
+		tls        *tls.ConnectionState
+		name       string
+		want       string
+		protoMajor int
+	}{{
+		tls:        &tls.ConnectionState{},
+		name:       "https",
+		want:       `h3=":8443"`,
+		protoMajor: 2,
+	}, {
+		tls:        nil,
+		name:       "plain",
+		want:       "",
+		protoMajor: 1,
+	}, {
+		tls:        &tls.ConnectionState{},
+		name:       "http3",
+		want:       "",
+		protoMajor: 3,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), http.LocalAddrContextKey, localAddr)
+			r := httptest.NewRequest(http.MethodGet, PathHealthCheck, nil).WithContext(ctx)
+			r.TLS = tc.tls
+			r.ProtoMajor = tc.protoMajor
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.want, w.Header().Get(aghhttp.HdrNameAltSvc))
+		})
+	}
+}
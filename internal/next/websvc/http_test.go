@@ -2,7 +2,6 @@ package websvc_test
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"net/http"
 	"net/netip"
@@ -10,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
 	"github.com/stretchr/testify/assert"
@@ -24,20 +24,20 @@ func TestService_HandlePatchSettingsHTTP(t *testing.T) {
 		ForceHTTPS:      false,
 	}
 
+	updated := make(chan struct{})
 	confMgr := newConfigManager()
-	confMgr.onWeb = func() (s agh.ServiceWithConfig[*websvc.Config]) {
-		return websvc.New(&websvc.Config{
-			TLS: &tls.Config{
-				Certificates: []tls.Certificate{{}},
-			},
-			Addresses:       []netip.AddrPort{netip.MustParseAddrPort("127.0.0.1:80")},
-			SecureAddresses: []netip.AddrPort{netip.MustParseAddrPort("127.0.0.1:443")},
-			Timeout:         5 * time.Second,
-			ForceHTTPS:      true,
-		})
-	}
-	confMgr.onUpdateWeb = func(ctx context.Context, c *websvc.Config) (err error) {
-		return nil
+	confMgr.onUpdateWeb = func(
+		_ context.Context,
+		c *websvc.Config,
+	) (s agh.ServiceWithConfig[*websvc.Config], err error) {
+		close(updated)
+
+		// The configuration manager starts the new service itself.
+		return &aghtest.ServiceWithConfig[*websvc.Config]{
+			OnStart:    func() (err error) { panic("not implemented") },
+			OnShutdown: func(_ context.Context) (err error) { panic("not implemented") },
+			OnConfig:   func() (conf *websvc.Config) { return c },
+		}, nil
 	}
 
 	_, addr := newTestServer(t, confMgr)
@@ -60,4 +60,11 @@ func TestService_HandlePatchSettingsHTTP(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, wantWeb, resp)
+
+	select {
+	case <-updated:
+		// Go on.
+	case <-time.After(testTimeout):
+		t.Fatal("web service has not been updated")
+	}
 }
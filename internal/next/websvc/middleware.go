@@ -1,6 +1,14 @@
 package websvc
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
 
 // Middlewares
 
@@ -14,3 +22,128 @@ func jsonMw(h http.Handler) (wrapped http.HandlerFunc) {
 
 	return http.HandlerFunc(f)
 }
+
+// RequestLogFormat is the format of the HTTP request log entries.
+type RequestLogFormat string
+
+// RequestLogFormat constants.
+const (
+	// RequestLogFormatNone means that requests are not logged.
+	RequestLogFormatNone RequestLogFormat = ""
+
+	// RequestLogFormatLogfmt means that requests are logged in the logfmt
+	// format.
+	RequestLogFormatLogfmt RequestLogFormat = "logfmt"
+
+	// RequestLogFormatJSON means that requests are logged as JSON objects.
+	RequestLogFormatJSON RequestLogFormat = "json"
+)
+
+// logMw logs the method, path, status code, latency, and client address of
+// every request in the format f.
+func logMw(h http.Handler, f RequestLogFormat) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &codeRecorderWriter{
+			ResponseWriter: w,
+			code:           http.StatusOK,
+		}
+
+		h.ServeHTTP(rw, r)
+
+		e := &requestLogEntry{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Client:  r.RemoteAddr,
+			Status:  rw.code,
+			Latency: JSONDuration(time.Since(start)),
+		}
+
+		log.Info("websvc: %s", e.format(f))
+	}
+}
+
+// requestLogEntry is a single entry of the HTTP request log.
+type requestLogEntry struct {
+	Method  string       `json:"method"`
+	Path    string       `json:"path"`
+	Client  string       `json:"client"`
+	Status  int          `json:"status"`
+	Latency JSONDuration `json:"latency"`
+}
+
+// format returns the string representation of e in the format f.  Unknown
+// formats are treated as [RequestLogFormatLogfmt].
+func (e *requestLogEntry) format(f RequestLogFormat) (s string) {
+	if f == RequestLogFormatJSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			// Technically shouldn't happen, since all fields are marshalable.
+			return err.Error()
+		}
+
+		return string(b)
+	}
+
+	b := &strings.Builder{}
+	writeLogfmtPair(b, "method", e.Method)
+	writeLogfmtPair(b, "path", e.Path)
+	writeLogfmtPair(b, "client", e.Client)
+	writeLogfmtPair(b, "status", strconv.Itoa(e.Status))
+	writeLogfmtPair(b, "latency", time.Duration(e.Latency).String())
+
+	return b.String()
+}
+
+// writeLogfmtPair writes the key-value pair to b in the logfmt format, quoting
+// val if necessary.
+func writeLogfmtPair(b *strings.Builder, key, val string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(key)
+	b.WriteByte('=')
+
+	if val == "" || strings.ContainsAny(val, " =\"\\") || !strconv.CanBackquote(val) {
+		b.WriteString(strconv.Quote(val))
+	} else {
+		b.WriteString(val)
+	}
+}
+
+// codeRecorderWriter is an [http.ResponseWriter] that remembers the status code
+// of the response.
+type codeRecorderWriter struct {
+	http.ResponseWriter
+
+	code int
+}
+
+// type check
+var _ http.ResponseWriter = (*codeRecorderWriter)(nil)
+
+// WriteHeader implements the [http.ResponseWriter] interface for
+// *codeRecorderWriter.
+func (w *codeRecorderWriter) WriteHeader(code int) {
+	w.code = code
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// type check
+var _ http.Flusher = (*codeRecorderWriter)(nil)
+
+// Flush implements the [http.Flusher] interface for *codeRecorderWriter.  It is
+// a no-op if the underlying writer doesn't support flushing.
+func (w *codeRecorderWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer.  It is used by
+// [http.ResponseController].
+func (w *codeRecorderWriter) Unwrap() (rw http.ResponseWriter) {
+	return w.ResponseWriter
+}
@@ -0,0 +1,59 @@
+package websvc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogEntry_format(t *testing.T) {
+	testCases := []struct {
+		e    *requestLogEntry
+		name string
+		f    RequestLogFormat
+		want string
+	}{{
+		e: &requestLogEntry{
+			Method:  http.MethodGet,
+			Path:    PathV1SystemInfo,
+			Client:  "127.0.0.1:12345",
+			Status:  http.StatusOK,
+			Latency: JSONDuration(1500 * time.Microsecond),
+		},
+		name: "logfmt",
+		f:    RequestLogFormatLogfmt,
+		want: `method=GET path=/api/v1/system/info client=127.0.0.1:12345 ` +
+			`status=200 latency=1.5ms`,
+	}, {
+		e: &requestLogEntry{
+			Method:  http.MethodGet,
+			Path:    "/a b",
+			Client:  "",
+			Status:  http.StatusNotFound,
+			Latency: JSONDuration(time.Millisecond),
+		},
+		name: "logfmt_quoted",
+		f:    RequestLogFormatLogfmt,
+		want: `method=GET path="/a b" client="" status=404 latency=1ms`,
+	}, {
+		e: &requestLogEntry{
+			Method:  http.MethodPatch,
+			Path:    PathV1SettingsDNS,
+			Client:  "127.0.0.1:12345",
+			Status:  http.StatusUnprocessableEntity,
+			Latency: JSONDuration(1500 * time.Microsecond),
+		},
+		name: "json",
+		f:    RequestLogFormatJSON,
+		want: `{"method":"PATCH","path":"/api/v1/settings/dns",` +
+			`"client":"127.0.0.1:12345","status":422,"latency":1.5}`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.e.format(tc.f))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package websvc
+
+import (
+	"io/fs"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/slices"
+)
+
+// API Discovery
+
+// Names of the OpenAPI specification files within [Config.OpenAPI].
+const (
+	openAPIFileLegacy = "openapi.yaml"
+	openAPIFileV1     = "v1.yaml"
+)
+
+// APIVersion describes a single generation of the HTTP API.
+type APIVersion struct {
+	// Name is the name of the version, for example "v1".
+	Name string `json:"name"`
+
+	// Prefix is the common path prefix of the endpoints of this version.
+	Prefix string `json:"prefix"`
+
+	// OpenAPI is the path of the OpenAPI specification of this version.  It
+	// is empty if the specifications are not served.
+	OpenAPI string `json:"openapi,omitempty"`
+}
+
+// APIEndpoint describes a single endpoint of the HTTP API.
+type APIEndpoint struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// RespGetAPIIndex describes the response of the GET /api HTTP API.
+type RespGetAPIIndex struct {
+	Versions  []*APIVersion  `json:"versions"`
+	Endpoints []*APIEndpoint `json:"endpoints"`
+}
+
+// handleGetAPIIndex is the handler for the GET /api HTTP API.
+func (svc *Service) handleGetAPIIndex(w http.ResponseWriter, r *http.Request) {
+	legacy := &APIVersion{
+		Name:   "legacy",
+		Prefix: "/control",
+	}
+	v1 := &APIVersion{
+		Name:   "v1",
+		Prefix: "/api/v1",
+	}
+
+	if svc.openAPI != nil {
+		legacy.OpenAPI = PathLegacyOpenAPI
+		v1.OpenAPI = PathV1OpenAPI
+	}
+
+	routes := svc.routes()
+	endpoints := make([]*APIEndpoint, 0, len(routes))
+	for _, rt := range routes {
+		endpoints = append(endpoints, &APIEndpoint{
+			Method: rt.method,
+			Path:   rt.path,
+		})
+	}
+
+	slices.SortStableFunc(endpoints, func(a, b *APIEndpoint) (less bool) {
+		return a.Path < b.Path
+	})
+
+	writeJSONOKResponse(w, r, &RespGetAPIIndex{
+		Versions:  []*APIVersion{legacy, v1},
+		Endpoints: endpoints,
+	})
+}
+
+// handleGetV1OpenAPI is the handler for the GET /api/v1/openapi.yaml HTTP API.
+func (svc *Service) handleGetV1OpenAPI(w http.ResponseWriter, r *http.Request) {
+	svc.serveOpenAPI(w, r, openAPIFileV1)
+}
+
+// handleGetLegacyOpenAPI is the handler for the GET /api/legacy/openapi.yaml
+// HTTP API.
+func (svc *Service) handleGetLegacyOpenAPI(w http.ResponseWriter, r *http.Request) {
+	svc.serveOpenAPI(w, r, openAPIFileLegacy)
+}
+
+// serveOpenAPI writes the OpenAPI specification file with the given name from
+// svc.openAPI to w.
+func (svc *Service) serveOpenAPI(w http.ResponseWriter, r *http.Request, name string) {
+	spec, err := fs.ReadFile(svc.openAPI, name)
+	if err != nil {
+		log.Error("websvc: %s %s: reading openapi spec: %s", r.Method, r.URL.Path, err)
+		http.Error(w, "openapi specification is not available", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set(aghhttp.HdrNameContentType, aghhttp.HdrValApplicationYAML)
+	_, err = w.Write(spec)
+	if err != nil {
+		log.Debug("websvc: %s %s: writing openapi spec: %s", r.Method, r.URL.Path, err)
+	}
+}
@@ -0,0 +1,115 @@
+package websvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_handleGetOpenAPI(t *testing.T) {
+	svc := &Service{
+		openAPI: fstest.MapFS{
+			openAPIFileLegacy: &fstest.MapFile{Data: []byte("openapi: legacy\n")},
+			openAPIFileV1:     &fstest.MapFile{Data: []byte("openapi: v1\n")},
+		},
+	}
+	mux := newMux(svc)
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{{
+		name:     "legacy",
+		path:     PathLegacyOpenAPI,
+		wantBody: "openapi: legacy\n",
+	}, {
+		name:     "v1",
+		path:     PathV1OpenAPI,
+		wantBody: "openapi: v1\n",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+
+			assert.Equal(t, aghhttp.HdrValApplicationYAML, w.Header().Get(aghhttp.HdrNameContentType))
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, PathV1OpenAPI, nil)
+		w := httptest.NewRecorder()
+		newMux(&Service{}).ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_handleGetAPIIndex(t *testing.T) {
+	testCases := []struct {
+		openAPI     fstest.MapFS
+		name        string
+		wantOpenAPI string
+	}{{
+		openAPI:     fstest.MapFS{},
+		name:        "with_openapi",
+		wantOpenAPI: PathV1OpenAPI,
+	}, {
+		openAPI:     nil,
+		name:        "without_openapi",
+		wantOpenAPI: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &Service{}
+			if tc.openAPI != nil {
+				svc.openAPI = tc.openAPI
+			}
+
+			r := httptest.NewRequest(http.MethodGet, PathAPIIndex, nil)
+			w := httptest.NewRecorder()
+			newMux(svc).ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+
+			resp := &RespGetAPIIndex{}
+			err := json.Unmarshal(w.Body.Bytes(), resp)
+			require.NoError(t, err)
+
+			require.Len(t, resp.Versions, 2)
+
+			v1 := resp.Versions[1]
+			assert.Equal(t, "v1", v1.Name)
+			assert.Equal(t, tc.wantOpenAPI, v1.OpenAPI)
+
+			wantEp := &APIEndpoint{
+				Method: http.MethodGet,
+				Path:   PathV1SystemInfo,
+			}
+			assert.Contains(t, resp.Endpoints, wantEp)
+
+			specEp := &APIEndpoint{
+				Method: http.MethodGet,
+				Path:   PathV1OpenAPI,
+			}
+			if tc.wantOpenAPI == "" {
+				assert.NotContains(t, resp.Endpoints, specEp)
+			} else {
+				assert.Contains(t, resp.Endpoints, specEp)
+			}
+		})
+	}
+}
@@ -4,8 +4,29 @@ package websvc
 const (
 	PathHealthCheck = "/health-check"
 
-	PathV1SettingsAll  = "/api/v1/settings/all"
-	PathV1SettingsDNS  = "/api/v1/settings/dns"
-	PathV1SettingsHTTP = "/api/v1/settings/http"
-	PathV1SystemInfo   = "/api/v1/system/info"
+	PathAPIIndex      = "/api"
+	PathLegacyOpenAPI = "/api/legacy/openapi.yaml"
+	PathV1OpenAPI     = "/api/v1/openapi.yaml"
+
+	PathV1AccountsCSRFToken = "/api/v1/accounts/csrf_token"
+	PathV1AccountsUsers     = "/api/v1/accounts/users"
+	PathV1AccountsUser      = "/api/v1/accounts/users/:name"
+
+	PathV1Events = "/api/v1/events"
+
+	PathV1DHCPLeases = "/api/v1/dhcp/leases"
+	PathV1DHCPLease  = "/api/v1/dhcp/leases/:lease_uid"
+
+	PathV1SettingsAccess      = "/api/v1/settings/access"
+	PathV1SettingsAll         = "/api/v1/settings/all"
+	PathV1SettingsDHCP        = "/api/v1/settings/dhcp"
+	PathV1SettingsDNS         = "/api/v1/settings/dns"
+	PathV1SettingsHTTP        = "/api/v1/settings/http"
+	PathV1SettingsHTTPBlocked = "/api/v1/settings/http/blocked"
+
+	PathV1SystemInfo                = "/api/v1/system/info"
+	PathV1SystemMigrateLegacyConfig = "/api/v1/system/migrate_legacy_config"
 )
+
+// pathFrontend is the catch-all path pattern of the frontend assets.
+const pathFrontend = "/*filepath"
@@ -0,0 +1,63 @@
+package websvc
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// Rate Limiting Handlers
+
+// HTTPAPIBlockedClient is a client blocked by the HTTP API rate limiter.  See
+// the HttpBlockedClient object in the OpenAPI specification.
+type HTTPAPIBlockedClient struct {
+	IP    netip.Addr `json:"ip"`
+	Until JSONTime   `json:"until"`
+}
+
+// RespGetV1SettingsHTTPBlocked describes the response of the GET
+// /api/v1/settings/http/blocked HTTP API.
+type RespGetV1SettingsHTTPBlocked struct {
+	Blocked []*HTTPAPIBlockedClient `json:"blocked"`
+}
+
+// handleGetSettingsHTTPBlocked is the handler for the GET
+// /api/v1/settings/http/blocked HTTP API.
+func (svc *Service) handleGetSettingsHTTPBlocked(w http.ResponseWriter, r *http.Request) {
+	resp := &RespGetV1SettingsHTTPBlocked{
+		Blocked: []*HTTPAPIBlockedClient{},
+	}
+
+	if svc.rateLimiter != nil {
+		for _, b := range svc.rateLimiter.Blocked() {
+			resp.Blocked = append(resp.Blocked, &HTTPAPIBlockedClient{
+				IP:    b.Addr,
+				Until: JSONTime(b.Until),
+			})
+		}
+	}
+
+	writeJSONOKResponse(w, r, resp)
+}
+
+// handleDeleteSettingsHTTPBlocked is the handler for the DELETE
+// /api/v1/settings/http/blocked HTTP API.  If the query parameter "ip" is
+// absent, all clients are unblocked.
+func (svc *Service) handleDeleteSettingsHTTPBlocked(w http.ResponseWriter, r *http.Request) {
+	var ip netip.Addr
+	if ipStr := r.URL.Query().Get("ip"); ipStr != "" {
+		var err error
+		ip, err = netip.ParseAddr(ipStr)
+		if err != nil {
+			writeJSONErrorResponse(w, r, fmt.Errorf("ip: %w", err))
+
+			return
+		}
+	}
+
+	if svc.rateLimiter != nil {
+		svc.rateLimiter.Unblock(ip)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
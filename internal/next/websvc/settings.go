@@ -11,6 +11,7 @@ import (
 type RespGetV1SettingsAll struct {
 	// TODO(a.garipov): Add more as we go.
 
+	DHCP *HTTPAPIDHCPSettings `json:"dhcp"`
 	DNS  *HTTPAPIDNSSettings  `json:"dns"`
 	HTTP *HTTPAPIHTTPSettings `json:"http"`
 }
@@ -18,6 +19,9 @@ type RespGetV1SettingsAll struct {
 // handleGetSettingsAll is the handler for the GET /api/v1/settings/all HTTP
 // API.
 func (svc *Service) handleGetSettingsAll(w http.ResponseWriter, r *http.Request) {
+	dhcpSvc := svc.confMgr.DHCP()
+	dhcpConf := dhcpSvc.Config()
+
 	dnsSvc := svc.confMgr.DNS()
 	dnsConf := dnsSvc.Config()
 
@@ -26,6 +30,7 @@ func (svc *Service) handleGetSettingsAll(w http.ResponseWriter, r *http.Request)
 
 	// TODO(a.garipov): Add all currently supported parameters.
 	writeJSONOKResponse(w, r, &RespGetV1SettingsAll{
+		DHCP: newHTTPAPIDHCPSettings(dhcpConf),
 		DNS: &HTTPAPIDNSSettings{
 			Addresses:        dnsConf.Addresses,
 			BootstrapServers: dnsConf.BootstrapServers,
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
 	"github.com/stretchr/testify/assert"
@@ -33,7 +34,36 @@ func TestService_HandleGetSettingsAll(t *testing.T) {
 		ForceHTTPS:      true,
 	}
 
+	wantDHCP := &websvc.HTTPAPIDHCPSettings{
+		InterfaceName:     "eth0",
+		IPv4GatewayIP:     netip.MustParseAddr("192.168.0.1"),
+		IPv4SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		IPv4RangeStart:    netip.MustParseAddr("192.168.0.100"),
+		IPv4RangeEnd:      netip.MustParseAddr("192.168.0.200"),
+		IPv4LeaseDuration: websvc.JSONDuration(24 * time.Hour),
+		Enabled:           true,
+	}
+
 	confMgr := newConfigManager()
+	confMgr.onDHCP = func() (s websvc.DHCPService) {
+		dhcpSvc := newDHCPService()
+		dhcpSvc.onConfig = func() (c *dhcpsvc.Config) {
+			return &dhcpsvc.Config{
+				IPv4: &dhcpsvc.IPv4Config{
+					GatewayIP:     wantDHCP.IPv4GatewayIP,
+					SubnetMask:    wantDHCP.IPv4SubnetMask,
+					RangeStart:    wantDHCP.IPv4RangeStart,
+					RangeEnd:      wantDHCP.IPv4RangeEnd,
+					LeaseDuration: time.Duration(wantDHCP.IPv4LeaseDuration),
+				},
+				InterfaceName: wantDHCP.InterfaceName,
+				Enabled:       wantDHCP.Enabled,
+			}
+		}
+
+		return dhcpSvc
+	}
+
 	confMgr.onDNS = func() (s agh.ServiceWithConfig[*dnssvc.Config]) {
 		c, err := dnssvc.New(&dnssvc.Config{
 			Addresses:        wantDNS.Addresses,
@@ -70,6 +100,7 @@ func TestService_HandleGetSettingsAll(t *testing.T) {
 	err := json.Unmarshal(body, resp)
 	require.NoError(t, err)
 
+	assert.Equal(t, wantDHCP, resp.DHCP)
 	assert.Equal(t, wantDNS, resp.DNS)
 	assert.Equal(t, wantWeb, resp.HTTP)
 }
@@ -1,6 +1,8 @@
 package websvc
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
 
@@ -33,3 +35,53 @@ func (svc *Service) handleGetV1SystemInfo(w http.ResponseWriter, r *http.Request
 		Version:    version.Version(),
 	})
 }
+
+// ReqPostV1SystemMigrateLegacyConfig describes the request to the POST
+// /api/v1/system/migrate_legacy_config HTTP API.
+type ReqPostV1SystemMigrateLegacyConfig struct {
+	// Config is the contents of the legacy configuration file.
+	Config string `json:"config"`
+}
+
+// RespPostV1SystemMigrateLegacyConfig describes the response of the POST
+// /api/v1/system/migrate_legacy_config HTTP API.
+type RespPostV1SystemMigrateLegacyConfig struct {
+	// Config is the contents of the converted configuration file.
+	Config string `json:"config"`
+
+	// Unconvertible are the descriptions of the legacy options that could not
+	// be converted.
+	Unconvertible []string `json:"unconvertible"`
+}
+
+// handlePostV1SystemMigrateLegacyConfig is the handler for the POST
+// /api/v1/system/migrate_legacy_config HTTP API.  It only converts the
+// configuration and doesn't write any files.
+func (svc *Service) handlePostV1SystemMigrateLegacyConfig(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	req := &ReqPostV1SystemMigrateLegacyConfig{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("decoding: %w", err))
+
+		return
+	}
+
+	conf, unconvertible, err := svc.confMgr.MigrateLegacy([]byte(req.Config))
+	if err != nil {
+		writeJSONErrorResponse(w, r, fmt.Errorf("migrating: %w", err))
+
+		return
+	}
+
+	if unconvertible == nil {
+		unconvertible = []string{}
+	}
+
+	writeJSONOKResponse(w, r, &RespPostV1SystemMigrateLegacyConfig{
+		Config:        string(conf),
+		Unconvertible: unconvertible,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +36,48 @@ func TestService_handleGetV1SystemInfo(t *testing.T) {
 	assert.Equal(t, resp.OS, runtime.GOOS)
 	assert.Equal(t, testStart, time.Time(resp.Start))
 }
+
+func TestService_handlePostV1SystemMigrateLegacyConfig(t *testing.T) {
+	const (
+		legacy = "bind_port: 3000\n"
+		conf   = "http:\n  addresses: []\n"
+	)
+
+	confMgr := newConfigManager()
+	confMgr.onMigrateLegacy = func(l []byte) (c []byte, unconvertible []string, err error) {
+		if string(l) != legacy {
+			return nil, nil, errors.New("bad config")
+		}
+
+		return []byte(conf), []string{"tls: not supported"}, nil
+	}
+
+	_, addr := newTestServer(t, confMgr)
+	u := &url.URL{
+		Scheme: "http",
+		Host:   addr.String(),
+		Path:   websvc.PathV1SystemMigrateLegacyConfig,
+	}
+
+	t.Run("success", func(t *testing.T) {
+		req := &websvc.ReqPostV1SystemMigrateLegacyConfig{
+			Config: legacy,
+		}
+
+		body := httpDo(t, http.MethodPost, u, req, http.StatusOK)
+		resp := &websvc.RespPostV1SystemMigrateLegacyConfig{}
+		err := json.Unmarshal(body, resp)
+		require.NoError(t, err)
+
+		assert.Equal(t, conf, resp.Config)
+		assert.Equal(t, []string{"tls: not supported"}, resp.Unconvertible)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		req := &websvc.ReqPostV1SystemMigrateLegacyConfig{
+			Config: "bad",
+		}
+
+		_ = httpDo(t, http.MethodPost, u, req, http.StatusUnprocessableEntity)
+	})
+}
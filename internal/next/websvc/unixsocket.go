@@ -0,0 +1,105 @@
+package websvc
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Unix Domain Sockets
+
+// UnixSocket is the configuration of a Unix domain socket on which the plain
+// HTTP API is served.
+type UnixSocket struct {
+	// Path is the path to the socket file.  If a socket file already exists at
+	// Path, for example after an unclean shutdown, it is removed before
+	// binding.  Any other kind of file is never removed.
+	Path string
+
+	// Mode is the permissions of the socket file.  If Mode is zero, the
+	// permissions are left as set by the OS according to the umask.
+	Mode fs.FileMode
+}
+
+// unixServer is an HTTP server serving on a Unix domain socket.
+type unixServer struct {
+	srv  *http.Server
+	sock *UnixSocket
+}
+
+// serveUnix starts and runs us and writes all errors into its log.  If us
+// fails to bind, the error is also sent to errCh.
+func serveUnix(us *unixServer, wg *sync.WaitGroup, errCh chan<- error) {
+	srv := us.srv
+	defer log.OnPanic(srv.Addr)
+
+	l, err := listenUnix(us.sock)
+	if err != nil {
+		srv.ErrorLog.Printf("starting srv %s: binding: %s", srv.Addr, err)
+		errCh <- fmt.Errorf("srv %s: binding: %w", srv.Addr, err)
+
+		// Don't make Start wait for the server that will never accept any
+		// connections.
+		wg.Done()
+
+		return
+	}
+
+	log.Info("websvc: starting srv unix://%s", srv.Addr)
+
+	serveListener(srv, l, wg)
+}
+
+// listenUnix removes the stale socket file, if any, binds to the socket, and
+// sets the permissions of the socket file.
+func listenUnix(sock *UnixSocket) (l net.Listener, err error) {
+	err = removeStaleSocket(sock.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err = net.Listen("unix", sock.Path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	if sock.Mode == 0 {
+		return l, nil
+	}
+
+	err = os.Chmod(sock.Path, sock.Mode)
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("setting mode: %w", err), l.Close())
+	}
+
+	return l, nil
+}
+
+// removeStaleSocket removes the socket file at path, if there is one.  It
+// returns an error if the file at path is not a socket.
+func removeStaleSocket(path string) (err error) {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking stale socket: %w", err)
+	}
+
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("file %q exists and is not a socket", path)
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return fmt.Errorf("removing stale socket: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package websvc_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Start_unixSocket(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agh.sock")
+
+	// Create a regular file to make sure that it's not removed.
+	badPath := filepath.Join(t.TempDir(), "not.sock")
+	err := os.WriteFile(badPath, nil, 0o600)
+	require.NoError(t, err)
+
+	const wantMode fs.FileMode = 0o600
+	svc := websvc.New(&websvc.Config{
+		ConfigManager: newConfigManager(),
+		UnixSockets: []*websvc.UnixSocket{{
+			Path: sockPath,
+			Mode: wantMode,
+		}, {
+			Path: badPath,
+			Mode: wantMode,
+		}},
+		Timeout: testTimeout,
+		Start:   testStart,
+	})
+
+	// The server with the bad path fails to bind, but the other one keeps
+	// running.
+	err = svc.Start()
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, badPath)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		t.Cleanup(cancel)
+
+		err = svc.Shutdown(ctx)
+		require.NoError(t, err)
+	})
+
+	c := svc.Config()
+	require.NotNil(t, c)
+	require.Len(t, c.UnixSockets, 2)
+
+	fi, err := os.Stat(sockPath)
+	require.NoError(t, err)
+
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, wantMode, fi.Mode().Perm())
+	}
+
+	fi, err = os.Stat(badPath)
+	require.NoError(t, err)
+
+	assert.True(t, fi.Mode().IsRegular())
+
+	httpCli := &http.Client{
+		Timeout: testTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (conn net.Conn, err error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sockPath)
+			},
+		},
+	}
+
+	resp, err := httpCli.Get("http://unix" + websvc.PathHealthCheck)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, resp.Body.Close)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte("OK"), body)
+}
@@ -11,13 +11,18 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
@@ -26,11 +31,40 @@ import (
 
 // ConfigManager is the configuration manager interface.
 type ConfigManager interface {
+	DHCP() (svc DHCPService)
 	DNS() (svc agh.ServiceWithConfig[*dnssvc.Config])
 	Web() (svc agh.ServiceWithConfig[*Config])
 
-	UpdateDNS(ctx context.Context, c *dnssvc.Config) (err error)
-	UpdateWeb(ctx context.Context, c *Config) (err error)
+	// UpdateDHCP validates c, shuts down the current DHCP service, and
+	// replaces it with a new one created from c and started.  If the new
+	// service fails to start, the previous one is restored and an error is
+	// returned.  newSvc is the new running service.
+	UpdateDHCP(ctx context.Context, c *dhcpsvc.Config) (newSvc DHCPService, err error)
+
+	// UpdateDNS validates c, shuts down the current DNS service, and replaces
+	// it with a new one created from c and started.  If the new service fails
+	// to start, the previous one is restored and an error is returned.  newSvc
+	// is the new running service.
+	UpdateDNS(
+		ctx context.Context,
+		c *dnssvc.Config,
+	) (newSvc agh.ServiceWithConfig[*dnssvc.Config], err error)
+
+	// UpdateWeb validates c, shuts down the current web service, and replaces
+	// it with a new one created from c and started.  If the new service fails
+	// to start, the previous one is restored and an error is returned.  newSvc
+	// is the new running service.  UpdateWeb must not be called from within a
+	// handler of the current web service, since the shutdown waits for all
+	// handlers to return.
+	UpdateWeb(
+		ctx context.Context,
+		c *Config,
+	) (newSvc agh.ServiceWithConfig[*Config], err error)
+
+	// MigrateLegacy converts the legacy configuration file data into the
+	// current configuration file data without writing it.  unconvertible are
+	// the descriptions of the legacy options that could not be converted.
+	MigrateLegacy(legacy []byte) (conf []byte, unconvertible []string, err error)
 }
 
 // Config is the AdGuard Home web service configuration structure.
@@ -43,6 +77,42 @@ type Config struct {
 	// SecureAddresses must not be empty.
 	TLS *tls.Config
 
+	// RateLimiter is the optional per-IP rate limiter of the HTTP API.  It is
+	// shared between the instances of the service created after
+	// reconfigurations, so that the blocked clients stay blocked.
+	RateLimiter *aghhttp.RateLimiter
+
+	// CORS is the optional CORS policy.  If CORS is nil, cross-origin requests
+	// are not allowed.
+	CORS *CORSConfig
+
+	// CSRF is the optional configuration of the CSRF protection.  If CSRF is
+	// nil, the protection is disabled.
+	CSRF *CSRFConfig
+
+	// Compression is the optional configuration of the response compression.
+	// If Compression is nil, the responses are not compressed.
+	Compression *CompressionConfig
+
+	// Users is the optional database of the users of the HTTP API.  If Users
+	// is nil, the user management is disabled.  If Users is nil or empty, the
+	// HTTP API doesn't require authentication.
+	Users *UserDB
+
+	// Events is the optional source of the events sent to the clients of the
+	// GET /api/v1/events HTTP API.  If Events is nil, the API is disabled.
+	Events *Events
+
+	// Frontend is the optional filesystem containing the frontend assets,
+	// which are served on all paths not used by the HTTP API.  If Frontend is
+	// nil, the frontend is not served.
+	Frontend fs.FS
+
+	// OpenAPI is the optional filesystem containing the OpenAPI specifications
+	// of the HTTP APIs, openapi.yaml for the legacy one and v1.yaml for the
+	// current one.  If OpenAPI is nil, the specifications are not served.
+	OpenAPI fs.FS
+
 	// Start is the time of start of AdGuard Home.
 	Start time.Time
 
@@ -53,9 +123,30 @@ type Config struct {
 	// SecureAddresses is not empty, TLS must not be nil.
 	SecureAddresses []netip.AddrPort
 
+	// UnixSockets are the Unix domain sockets on which to serve the plain HTTP
+	// API.
+	UnixSockets []*UnixSocket
+
+	// RequestLogFormat is the format of the HTTP request log.  If it is
+	// [RequestLogFormatNone], requests are not logged.
+	RequestLogFormat RequestLogFormat
+
 	// Timeout is the timeout for all server operations.
 	Timeout time.Duration
 
+	// GracePeriod is the maximum duration of waiting for the in-flight
+	// requests to finish when the service is shut down, for example during a
+	// reconfiguration.  The requests that arrive during that period are
+	// answered with 503 Service Unavailable and the Retry-After header.  After
+	// the period is over, the remaining connections are closed.  If
+	// GracePeriod is zero, Timeout is used.
+	GracePeriod time.Duration
+
+	// ServeHTTP3 tells if the HTTP API should also be served over HTTP/3 on
+	// SecureAddresses.  The secure servers then advertise HTTP/3 using the
+	// Alt-Svc header.
+	ServeHTTP3 bool
+
 	// ForceHTTPS tells if all requests to Addresses should be redirected to a
 	// secure address instead.
 	//
@@ -66,12 +157,36 @@ type Config struct {
 // Service is the AdGuard Home web service.  A nil *Service is a valid
 // [agh.Service] that does nothing.
 type Service struct {
-	confMgr    ConfigManager
-	tls        *tls.Config
-	start      time.Time
-	servers    []*http.Server
-	timeout    time.Duration
-	forceHTTPS bool
+	// done is closed when the service is shut down to finish the event
+	// streams, since the shutdown of the servers waits for them.
+	done <-chan struct{}
+
+	// finishStreams closes done.
+	finishStreams context.CancelFunc
+
+	// draining is true when the service is being shut down and doesn't accept
+	// new requests.
+	draining atomic.Bool
+
+	confMgr     ConfigManager
+	tls         *tls.Config
+	rateLimiter *aghhttp.RateLimiter
+	cors        *CORSConfig
+	csrf        *CSRFConfig
+	compression *CompressionConfig
+	users       *UserDB
+	events      *Events
+	frontend    fs.FS
+	openAPI     fs.FS
+	start       time.Time
+	servers     []*http.Server
+	unixServers []*unixServer
+	servers3    []*http3Server
+	reqLogFmt   RequestLogFormat
+	timeout     time.Duration
+	gracePeriod time.Duration
+	serveHTTP3  bool
+	forceHTTPS  bool
 }
 
 // New returns a new properly initialized *Service.  If c is nil, svc is a nil
@@ -83,14 +198,40 @@ func New(c *Config) (svc *Service) {
 	}
 
 	svc = &Service{
-		confMgr:    c.ConfigManager,
-		tls:        c.TLS,
-		start:      c.Start,
-		timeout:    c.Timeout,
-		forceHTTPS: c.ForceHTTPS,
+		confMgr:     c.ConfigManager,
+		tls:         c.TLS,
+		rateLimiter: c.RateLimiter,
+		cors:        c.CORS,
+		csrf:        c.CSRF,
+		compression: c.Compression,
+		users:       c.Users,
+		events:      c.Events,
+		frontend:    c.Frontend,
+		openAPI:     c.OpenAPI,
+		start:       c.Start,
+		reqLogFmt:   c.RequestLogFormat,
+		timeout:     c.Timeout,
+		gracePeriod: c.GracePeriod,
+		serveHTTP3:  c.ServeHTTP3,
+		forceHTTPS:  c.ForceHTTPS,
+	}
+
+	streamsCtx, finishStreams := context.WithCancel(context.Background())
+	svc.done, svc.finishStreams = streamsCtx.Done(), finishStreams
+
+	mux, err := compressMw(newMux(svc), svc.compression)
+	if err != nil {
+		// Technically shouldn't happen, since the configuration must be
+		// validated before.
+		panic(fmt.Errorf("websvc: compression: %w", err))
+	}
+
+	mux = corsMw(mux, svc.cors)
+	if svc.rateLimiter != nil {
+		mux = svc.rateLimiter.Wrap(mux)
 	}
 
-	mux := newMux(svc)
+	mux = svc.drainMw(mux)
 
 	for _, a := range c.Addresses {
 		addr := a.String()
@@ -106,70 +247,271 @@ func New(c *Config) (svc *Service) {
 		})
 	}
 
+	secureMux := mux
+	if svc.serveHTTP3 {
+		secureMux = altSvcMw(mux)
+	}
+
 	for _, a := range c.SecureAddresses {
 		addr := a.String()
 		errLog := log.StdLog("websvc: https: "+addr, log.ERROR)
-		svc.servers = append(svc.servers, &http.Server{
+		srv := &http.Server{
 			Addr:              addr,
-			Handler:           mux,
+			Handler:           secureMux,
 			TLSConfig:         c.TLS,
 			ErrorLog:          errLog,
 			ReadTimeout:       c.Timeout,
 			WriteTimeout:      c.Timeout,
 			IdleTimeout:       c.Timeout,
 			ReadHeaderTimeout: c.Timeout,
+		}
+
+		svc.servers = append(svc.servers, srv)
+		if svc.serveHTTP3 {
+			svc.servers3 = append(svc.servers3, newHTTP3Server(srv, mux))
+		}
+	}
+
+	for _, sock := range c.UnixSockets {
+		errLog := log.StdLog("websvc: unix: "+sock.Path, log.ERROR)
+		svc.unixServers = append(svc.unixServers, &unixServer{
+			srv: &http.Server{
+				Addr:              sock.Path,
+				Handler:           mux,
+				ErrorLog:          errLog,
+				ReadTimeout:       c.Timeout,
+				WriteTimeout:      c.Timeout,
+				IdleTimeout:       c.Timeout,
+				ReadHeaderTimeout: c.Timeout,
+			},
+			sock: sock,
 		})
 	}
 
 	return svc
 }
 
+// route is a single HTTP API route of the web service.
+type route struct {
+	handler http.HandlerFunc
+	method  string
+	path    string
+
+	// role is the role required to access the route.  If role is empty, the
+	// route is accessible without authentication.
+	role aghuser.Role
+
+	isJSON bool
+	noLog  bool
+}
+
 // newMux returns a new HTTP request multiplexor for the AdGuard Home web
 // service.
 func newMux(svc *Service) (mux *httptreemux.ContextMux) {
 	mux = httptreemux.NewContextMux()
 
-	routes := []struct {
-		handler http.HandlerFunc
-		method  string
-		path    string
-		isJSON  bool
-	}{{
+	for _, r := range svc.routes() {
+		h := r.handler
+		if r.isJSON {
+			h = jsonMw(h)
+		}
+
+		if svc.csrf != nil && isStateChanging(r.method) {
+			h = csrfMw(h, svc.csrf)
+		}
+
+		if r.role != "" {
+			h = authMw(h, svc.users, r.role)
+		}
+
+		if svc.reqLogFmt != RequestLogFormatNone && !r.noLog {
+			h = logMw(h, svc.reqLogFmt)
+		}
+
+		mux.Handle(r.method, r.path, h)
+	}
+
+	if svc.frontend != nil {
+		// Don't add the frontend to the routes, since it's not a part of the
+		// HTTP API.
+		var h http.Handler = http.FileServer(http.FS(svc.frontend))
+		if svc.reqLogFmt != RequestLogFormatNone {
+			h = logMw(h, svc.reqLogFmt)
+		}
+
+		// The catch-all pattern doesn't match the root path, so add it
+		// separately.
+		for _, p := range []string{"/", pathFrontend} {
+			mux.Handle(http.MethodGet, p, h.ServeHTTP)
+			mux.Handle(http.MethodHead, p, h.ServeHTTP)
+		}
+	}
+
+	return mux
+}
+
+// routes returns all HTTP API routes of the web service.
+func (svc *Service) routes() (routes []*route) {
+	routes = []*route{{
 		handler: svc.handleGetHealthCheck,
 		method:  http.MethodGet,
 		path:    PathHealthCheck,
 		isJSON:  false,
+		noLog:   true,
+	}, {
+		handler: svc.handleGetV1AccountsCSRFToken,
+		method:  http.MethodGet,
+		path:    PathV1AccountsCSRFToken,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handleGetV1AccountsUsers,
+		method:  http.MethodGet,
+		path:    PathV1AccountsUsers,
+		role:    aghuser.RoleAdmin,
+		isJSON:  true,
+	}, {
+		handler: svc.handlePostV1AccountsUsers,
+		method:  http.MethodPost,
+		path:    PathV1AccountsUsers,
+		role:    aghuser.RoleAdmin,
+		isJSON:  true,
+	}, {
+		handler: svc.handlePatchV1AccountsUser,
+		method:  http.MethodPatch,
+		path:    PathV1AccountsUser,
+		role:    aghuser.RoleAdmin,
+		isJSON:  true,
+	}, {
+		handler: svc.handleDeleteV1AccountsUser,
+		method:  http.MethodDelete,
+		path:    PathV1AccountsUser,
+		role:    aghuser.RoleAdmin,
+		isJSON:  false,
 	}, {
 		handler: svc.handleGetSettingsAll,
 		method:  http.MethodGet,
 		path:    PathV1SettingsAll,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handleGetV1SettingsAccess,
+		method:  http.MethodGet,
+		path:    PathV1SettingsAccess,
+		role:    aghuser.RoleViewer,
 		isJSON:  true,
+	}, {
+		handler: svc.handlePutV1SettingsAccess,
+		method:  http.MethodPut,
+		path:    PathV1SettingsAccess,
+		role:    aghuser.RoleAdmin,
+		isJSON:  false,
 	}, {
 		handler: svc.handlePatchSettingsDNS,
 		method:  http.MethodPatch,
 		path:    PathV1SettingsDNS,
+		role:    aghuser.RoleAdmin,
 		isJSON:  true,
 	}, {
 		handler: svc.handlePatchSettingsHTTP,
 		method:  http.MethodPatch,
 		path:    PathV1SettingsHTTP,
+		role:    aghuser.RoleAdmin,
 		isJSON:  true,
 	}, {
 		handler: svc.handleGetV1SystemInfo,
 		method:  http.MethodGet,
 		path:    PathV1SystemInfo,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handlePostV1SystemMigrateLegacyConfig,
+		method:  http.MethodPost,
+		path:    PathV1SystemMigrateLegacyConfig,
+		role:    aghuser.RoleAdmin,
+		isJSON:  true,
+	}, {
+		handler: svc.handleGetSettingsHTTPBlocked,
+		method:  http.MethodGet,
+		path:    PathV1SettingsHTTPBlocked,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handleDeleteSettingsHTTPBlocked,
+		method:  http.MethodDelete,
+		path:    PathV1SettingsHTTPBlocked,
+		role:    aghuser.RoleAdmin,
+		isJSON:  false,
+	}, {
+		handler: svc.handleGetV1SettingsDHCP,
+		method:  http.MethodGet,
+		path:    PathV1SettingsDHCP,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handlePatchV1SettingsDHCP,
+		method:  http.MethodPatch,
+		path:    PathV1SettingsDHCP,
+		role:    aghuser.RoleAdmin,
+		isJSON:  true,
+	}, {
+		handler: svc.handleGetV1DHCPLeases,
+		method:  http.MethodGet,
+		path:    PathV1DHCPLeases,
+		role:    aghuser.RoleViewer,
+		isJSON:  true,
+	}, {
+		handler: svc.handlePostV1DHCPLeases,
+		method:  http.MethodPost,
+		path:    PathV1DHCPLeases,
+		role:    aghuser.RoleOperator,
+		isJSON:  true,
+	}, {
+		handler: svc.handleDeleteV1DHCPLease,
+		method:  http.MethodDelete,
+		path:    PathV1DHCPLease,
+		role:    aghuser.RoleOperator,
+		isJSON:  false,
+	}, {
+		handler: svc.handlePatchV1DHCPLease,
+		method:  http.MethodPatch,
+		path:    PathV1DHCPLease,
+		role:    aghuser.RoleOperator,
+		isJSON:  true,
+	}, {
+		handler: svc.handleGetAPIIndex,
+		method:  http.MethodGet,
+		path:    PathAPIIndex,
+		role:    aghuser.RoleViewer,
 		isJSON:  true,
 	}}
 
-	for _, r := range routes {
-		if r.isJSON {
-			mux.Handle(r.method, r.path, jsonMw(r.handler))
-		} else {
-			mux.Handle(r.method, r.path, r.handler)
-		}
+	if svc.events != nil {
+		routes = append(routes, &route{
+			handler: svc.handleGetV1Events,
+			method:  http.MethodGet,
+			path:    PathV1Events,
+			role:    aghuser.RoleViewer,
+			isJSON:  false,
+			noLog:   false,
+		})
 	}
 
-	return mux
+	if svc.openAPI == nil {
+		return routes
+	}
+
+	return append(routes, &route{
+		handler: svc.handleGetV1OpenAPI,
+		method:  http.MethodGet,
+		path:    PathV1OpenAPI,
+		isJSON:  false,
+	}, &route{
+		handler: svc.handleGetLegacyOpenAPI,
+		method:  http.MethodGet,
+		path:    PathLegacyOpenAPI,
+		isJSON:  false,
+	})
 }
 
 // addrs returns all addresses on which this server serves the HTTP API.  addrs
@@ -199,6 +541,16 @@ func (svc *Service) addrs() (addrs, secureAddrs []netip.AddrPort) {
 	return addrs, secureAddrs
 }
 
+// unixSockets returns the configurations of all Unix domain sockets on which
+// this server serves the HTTP API.
+func (svc *Service) unixSockets() (socks []*UnixSocket) {
+	for _, us := range svc.unixServers {
+		socks = append(socks, us.sock)
+	}
+
+	return socks
+}
+
 // handleGetHealthCheck is the handler for the GET /health-check HTTP API.
 func (svc *Service) handleGetHealthCheck(w http.ResponseWriter, _ *http.Request) {
 	_, _ = io.WriteString(w, "OK")
@@ -208,26 +560,55 @@ func (svc *Service) handleGetHealthCheck(w http.ResponseWriter, _ *http.Request)
 var _ agh.Service = (*Service)(nil)
 
 // Start implements the [agh.Service] interface for *Service.  svc may be nil.
-// After Start exits, all HTTP servers have tried to start, possibly failing and
-// writing error messages to the log.
+// After Start exits, all HTTP servers have tried to start.  err contains the
+// errors of the servers that have failed to bind, while the other servers
+// continue running.
 func (svc *Service) Start() (err error) {
 	if svc == nil {
 		return nil
 	}
 
+	srvNum := len(svc.servers) + len(svc.unixServers)
+	errCh := make(chan error, srvNum)
+
 	wg := &sync.WaitGroup{}
-	wg.Add(len(svc.servers))
+	wg.Add(srvNum)
 	for _, srv := range svc.servers {
-		go serve(srv, wg)
+		go serve(srv, wg, errCh)
+	}
+
+	for _, us := range svc.unixServers {
+		go serveUnix(us, wg, errCh)
 	}
 
 	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err = range errCh {
+		errs = append(errs, err)
+	}
+
+	// Start the HTTP/3 servers only after the TCP ones to get the actual
+	// addresses.
+	for _, s := range svc.servers3 {
+		err = s.start()
+		if err != nil {
+			log.Error("websvc: %s", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.List("starting servers", errs...)
+	}
 
 	return nil
 }
 
-// serve starts and runs srv and writes all errors into its log.
-func serve(srv *http.Server, wg *sync.WaitGroup) {
+// serve starts and runs srv and writes all errors into its log.  If srv fails
+// to bind, the error is also sent to errCh.
+func serve(srv *http.Server, wg *sync.WaitGroup, errCh chan<- error) {
 	addr := srv.Addr
 	defer log.OnPanic(addr)
 
@@ -243,6 +624,13 @@ func serve(srv *http.Server, wg *sync.WaitGroup) {
 	}
 	if err != nil {
 		srv.ErrorLog.Printf("starting srv %s: binding: %s", addr, err)
+		errCh <- fmt.Errorf("srv %s: binding: %w", addr, err)
+
+		// Don't make Start wait for the server that will never accept any
+		// connections.
+		wg.Done()
+
+		return
 	}
 
 	// Update the server's address in case the address had the port zero, which
@@ -251,32 +639,61 @@ func serve(srv *http.Server, wg *sync.WaitGroup) {
 
 	log.Info("websvc: starting srv %s://%s", proto, srv.Addr)
 
+	serveListener(srv, l, wg)
+}
+
+// serveListener runs srv on l and writes all errors into its log.  wg is
+// notified on the first call to Accept.
+func serveListener(srv *http.Server, l net.Listener, wg *sync.WaitGroup) {
 	l = &waitListener{
 		Listener:      l,
 		firstAcceptWG: wg,
 	}
 
-	err = srv.Serve(l)
+	err := srv.Serve(l)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		srv.ErrorLog.Printf("starting srv %s: %s", addr, err)
+		srv.ErrorLog.Printf("starting srv %s: %s", srv.Addr, err)
 	}
 }
 
 // Shutdown implements the [agh.Service] interface for *Service.  svc may be
-// nil.
+// nil.  Shutdown waits for the in-flight requests to finish for at most the
+// grace period of the service.
 func (svc *Service) Shutdown(ctx context.Context) (err error) {
 	if svc == nil {
 		return nil
 	}
 
+	svc.draining.Store(true)
+	svc.finishStreams()
+
+	ctx, cancel := context.WithTimeout(ctx, svc.shutdownTimeout())
+	defer cancel()
+
 	var errs []error
 	for _, srv := range svc.servers {
-		serr := srv.Shutdown(ctx)
+		serr := shutdownServer(ctx, srv)
 		if serr != nil {
 			errs = append(errs, fmt.Errorf("shutting down srv %s: %w", srv.Addr, serr))
 		}
 	}
 
+	for _, us := range svc.unixServers {
+		serr := shutdownServer(ctx, us.srv)
+		if serr != nil {
+			errs = append(errs, fmt.Errorf("shutting down unix srv %s: %w", us.sock.Path, serr))
+		}
+	}
+
+	for _, s := range svc.servers3 {
+		// TODO(a.garipov): Use CloseGracefully when it's implemented in
+		// quic-go.
+		serr := s.srv.Close()
+		if serr != nil {
+			errs = append(errs, fmt.Errorf("shutting down h3 srv %s: %w", s.srv.Addr, serr))
+		}
+	}
+
 	if len(errs) > 0 {
 		return errors.List("shutting down", errs...)
 	}
@@ -292,14 +709,26 @@ func (svc *Service) Config() (c *Config) {
 	c = &Config{
 		ConfigManager: svc.confMgr,
 		TLS:           svc.tls,
+		RateLimiter:   svc.rateLimiter,
+		CORS:          svc.cors,
+		CSRF:          svc.csrf,
+		Compression:   svc.compression,
+		Users:         svc.users,
+		Events:        svc.events,
+		Frontend:      svc.frontend,
+		OpenAPI:       svc.openAPI,
 		// Leave Addresses and SecureAddresses empty and get the actual
 		// addresses that include the :0 ones later.
-		Start:      svc.start,
-		Timeout:    svc.timeout,
-		ForceHTTPS: svc.forceHTTPS,
+		Start:            svc.start,
+		RequestLogFormat: svc.reqLogFmt,
+		Timeout:          svc.timeout,
+		GracePeriod:      svc.gracePeriod,
+		ServeHTTP3:       svc.serveHTTP3,
+		ForceHTTPS:       svc.forceHTTPS,
 	}
 
 	c.Addresses, c.SecureAddresses = svc.addrs()
+	c.UnixSockets = svc.unixSockets()
 
 	return c
 }
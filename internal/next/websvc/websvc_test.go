@@ -5,13 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/netip"
 	"net/url"
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/next/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/dnssvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/next/websvc"
 	"github.com/AdguardTeam/golibs/testutil"
@@ -34,11 +37,29 @@ var _ websvc.ConfigManager = (*configManager)(nil)
 
 // configManager is a [websvc.ConfigManager] for tests.
 type configManager struct {
-	onDNS func() (svc agh.ServiceWithConfig[*dnssvc.Config])
-	onWeb func() (svc agh.ServiceWithConfig[*websvc.Config])
+	onDHCP func() (svc websvc.DHCPService)
+	onDNS  func() (svc agh.ServiceWithConfig[*dnssvc.Config])
+	onWeb  func() (svc agh.ServiceWithConfig[*websvc.Config])
+
+	onUpdateDHCP func(
+		ctx context.Context,
+		c *dhcpsvc.Config,
+	) (svc websvc.DHCPService, err error)
+	onUpdateDNS func(
+		ctx context.Context,
+		c *dnssvc.Config,
+	) (svc agh.ServiceWithConfig[*dnssvc.Config], err error)
+	onUpdateWeb func(
+		ctx context.Context,
+		c *websvc.Config,
+	) (svc agh.ServiceWithConfig[*websvc.Config], err error)
+
+	onMigrateLegacy func(legacy []byte) (conf []byte, unconvertible []string, err error)
+}
 
-	onUpdateDNS func(ctx context.Context, c *dnssvc.Config) (err error)
-	onUpdateWeb func(ctx context.Context, c *websvc.Config) (err error)
+// DHCP implements the [websvc.ConfigManager] interface for *configManager.
+func (m *configManager) DHCP() (svc websvc.DHCPService) {
+	return m.onDHCP()
 }
 
 // DNS implements the [websvc.ConfigManager] interface for *configManager.
@@ -51,27 +72,123 @@ func (m *configManager) Web() (svc agh.ServiceWithConfig[*websvc.Config]) {
 	return m.onWeb()
 }
 
+// UpdateDHCP implements the [websvc.ConfigManager] interface for
+// *configManager.
+func (m *configManager) UpdateDHCP(
+	ctx context.Context,
+	c *dhcpsvc.Config,
+) (svc websvc.DHCPService, err error) {
+	return m.onUpdateDHCP(ctx, c)
+}
+
 // UpdateDNS implements the [websvc.ConfigManager] interface for *configManager.
-func (m *configManager) UpdateDNS(ctx context.Context, c *dnssvc.Config) (err error) {
+func (m *configManager) UpdateDNS(
+	ctx context.Context,
+	c *dnssvc.Config,
+) (svc agh.ServiceWithConfig[*dnssvc.Config], err error) {
 	return m.onUpdateDNS(ctx, c)
 }
 
 // UpdateWeb implements the [websvc.ConfigManager] interface for *configManager.
-func (m *configManager) UpdateWeb(ctx context.Context, c *websvc.Config) (err error) {
+func (m *configManager) UpdateWeb(
+	ctx context.Context,
+	c *websvc.Config,
+) (svc agh.ServiceWithConfig[*websvc.Config], err error) {
 	return m.onUpdateWeb(ctx, c)
 }
 
+// MigrateLegacy implements the [websvc.ConfigManager] interface for
+// *configManager.
+func (m *configManager) MigrateLegacy(
+	legacy []byte,
+) (conf []byte, unconvertible []string, err error) {
+	return m.onMigrateLegacy(legacy)
+}
+
 // newConfigManager returns a *configManager all methods of which panic.
 func newConfigManager() (m *configManager) {
 	return &configManager{
-		onDNS: func() (svc agh.ServiceWithConfig[*dnssvc.Config]) { panic("not implemented") },
-		onWeb: func() (svc agh.ServiceWithConfig[*websvc.Config]) { panic("not implemented") },
-		onUpdateDNS: func(_ context.Context, _ *dnssvc.Config) (err error) {
+		onDHCP: func() (svc websvc.DHCPService) { panic("not implemented") },
+		onDNS:  func() (svc agh.ServiceWithConfig[*dnssvc.Config]) { panic("not implemented") },
+		onWeb:  func() (svc agh.ServiceWithConfig[*websvc.Config]) { panic("not implemented") },
+		onUpdateDHCP: func(
+			_ context.Context,
+			_ *dhcpsvc.Config,
+		) (svc websvc.DHCPService, err error) {
+			panic("not implemented")
+		},
+		onUpdateDNS: func(
+			_ context.Context,
+			_ *dnssvc.Config,
+		) (svc agh.ServiceWithConfig[*dnssvc.Config], err error) {
 			panic("not implemented")
 		},
-		onUpdateWeb: func(_ context.Context, _ *websvc.Config) (err error) {
+		onUpdateWeb: func(
+			_ context.Context,
+			_ *websvc.Config,
+		) (svc agh.ServiceWithConfig[*websvc.Config], err error) {
 			panic("not implemented")
 		},
+		onMigrateLegacy: func(_ []byte) (conf []byte, unconvertible []string, err error) {
+			panic("not implemented")
+		},
+	}
+}
+
+// type check
+var _ websvc.DHCPService = (*dhcpService)(nil)
+
+// dhcpService is a [websvc.DHCPService] for tests.
+type dhcpService struct {
+	onStart             func() (err error)
+	onShutdown          func(ctx context.Context) (err error)
+	onConfig            func() (c *dhcpsvc.Config)
+	onLeases            func() (leases []*dhcpd.Lease)
+	onAddStaticLease    func(l *dhcpd.Lease) (err error)
+	onRemoveStaticLease func(l *dhcpd.Lease) (err error)
+}
+
+// Start implements the [websvc.DHCPService] interface for *dhcpService.
+func (s *dhcpService) Start() (err error) {
+	return s.onStart()
+}
+
+// Shutdown implements the [websvc.DHCPService] interface for *dhcpService.
+func (s *dhcpService) Shutdown(ctx context.Context) (err error) {
+	return s.onShutdown(ctx)
+}
+
+// Config implements the [websvc.DHCPService] interface for *dhcpService.
+func (s *dhcpService) Config() (c *dhcpsvc.Config) {
+	return s.onConfig()
+}
+
+// Leases implements the [websvc.DHCPService] interface for *dhcpService.
+func (s *dhcpService) Leases() (leases []*dhcpd.Lease) {
+	return s.onLeases()
+}
+
+// AddStaticLease implements the [websvc.DHCPService] interface for
+// *dhcpService.
+func (s *dhcpService) AddStaticLease(l *dhcpd.Lease) (err error) {
+	return s.onAddStaticLease(l)
+}
+
+// RemoveStaticLease implements the [websvc.DHCPService] interface for
+// *dhcpService.
+func (s *dhcpService) RemoveStaticLease(l *dhcpd.Lease) (err error) {
+	return s.onRemoveStaticLease(l)
+}
+
+// newDHCPService returns a *dhcpService all methods of which panic.
+func newDHCPService() (s *dhcpService) {
+	return &dhcpService{
+		onStart:             func() (err error) { panic("not implemented") },
+		onShutdown:          func(_ context.Context) (err error) { panic("not implemented") },
+		onConfig:            func() (c *dhcpsvc.Config) { panic("not implemented") },
+		onLeases:            func() (leases []*dhcpd.Lease) { panic("not implemented") },
+		onAddStaticLease:    func(_ *dhcpd.Lease) (err error) { panic("not implemented") },
+		onRemoveStaticLease: func(_ *dhcpd.Lease) (err error) { panic("not implemented") },
 	}
 }
 
@@ -172,6 +289,44 @@ func httpPatch(t testing.TB, u *url.URL, reqBody any, wantCode int) (body []byte
 	return body
 }
 
+// httpDo is a helper that performs an HTTP request with the given method and
+// JSON-encoded reqBody, if it's not nil, as the request body and returns the
+// body of the response as well as checks that the status code is correct.
+func httpDo(
+	t testing.TB,
+	method string,
+	u *url.URL,
+	reqBody any,
+	wantCode int,
+) (body []byte) {
+	t.Helper()
+
+	var r io.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		require.NoErrorf(t, err, "marshaling reqBody")
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	require.NoErrorf(t, err, "creating req")
+
+	httpCli := &http.Client{
+		Timeout: testTimeout,
+	}
+	resp, err := httpCli.Do(req)
+	require.NoErrorf(t, err, "performing req")
+	require.Equal(t, wantCode, resp.StatusCode)
+
+	testutil.CleanupAndRequireSuccess(t, resp.Body.Close)
+
+	body, err = io.ReadAll(resp.Body)
+	require.NoErrorf(t, err, "reading body")
+
+	return body
+}
+
 func TestService_Start_getHealthCheck(t *testing.T) {
 	confMgr := newConfigManager()
 	_, addr := newTestServer(t, confMgr)
@@ -185,3 +340,24 @@ func TestService_Start_getHealthCheck(t *testing.T) {
 
 	assert.Equal(t, []byte("OK"), body)
 }
+
+func TestService_Start_bindError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	addr, err := netip.ParseAddrPort(l.Addr().String())
+	require.NoError(t, err)
+
+	svc := websvc.New(&websvc.Config{
+		ConfigManager: newConfigManager(),
+		Addresses:     []netip.AddrPort{addr},
+		Timeout:       testTimeout,
+		Start:         testStart,
+	})
+
+	err = svc.Start()
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, addr.String())
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// GotifyConfig is the configuration of the channel pushing the messages to a
+// Gotify server.
+type GotifyConfig struct {
+	// ServerURL is the URL of the Gotify server.
+	ServerURL string `yaml:"server_url" json:"server_url"`
+
+	// Token is the token of the application the messages are pushed as.
+	Token string `yaml:"token" json:"token"`
+
+	// Priority is the priority of the messages.
+	Priority int `yaml:"priority" json:"priority"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *GotifyConfig) validate() (err error) {
+	err = validateURL(c.ServerURL)
+	if err != nil {
+		return fmt.Errorf("server_url: %w", err)
+	} else if c.Token == "" {
+		return errors.Error("token: empty")
+	}
+
+	return nil
+}
+
+// gotify is the [Channel] pushing the messages to a Gotify server.
+type gotify struct {
+	conf   *GotifyConfig
+	client *http.Client
+}
+
+// type check
+var _ Channel = (*gotify)(nil)
+
+// Send implements the [Channel] interface for *gotify.
+func (g *gotify) Send(ctx context.Context, msg *Message) (err error) {
+	body, err := json.Marshal(&struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}{
+		Title:    msg.Title,
+		Message:  msg.Text,
+		Priority: g.conf.Priority,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	u := strings.TrimSuffix(g.conf.ServerURL, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.conf.Token)
+
+	err = do(g.client, req)
+	if err != nil {
+		return fmt.Errorf("pushing message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// maxErrBodyLen is the maximum length of the response body included into the
+// error message.
+const maxErrBodyLen = 512
+
+// do sends req using client and returns an error if the response status isn't
+// successful.
+func do(client *http.Client, req *http.Request) (err error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrBodyLen))
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d: %q", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// validateURL returns an error if s isn't an absolute HTTP or HTTPS URL.
+func validateURL(s string) (err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http or https url", s)
+	}
+
+	return nil
+}
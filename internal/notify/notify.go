@@ -0,0 +1,477 @@
+// Package notify contains the notification channels used to deliver the human
+// readable messages about the AdGuard Home events to the user.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// queueSize is the maximum number of the messages waiting to be sent.  The
+// messages are dropped when the queue is full.
+const queueSize = 256
+
+// sendTimeout is the timeout of sending a single message.
+const sendTimeout = 30 * time.Second
+
+// Message is a notification message.
+type Message struct {
+	// Title is the short summary of the message.
+	Title string
+
+	// Text is the body of the message.
+	Text string
+}
+
+// Channel is a way of delivering the messages to the user.
+type Channel interface {
+	// Send sends msg.  It must be safe for concurrent use.
+	Send(ctx context.Context, msg *Message) (err error)
+}
+
+// ChannelType is the type of a notification channel.
+type ChannelType string
+
+// Valid channel types.
+const (
+	ChannelTypeGotify   ChannelType = "gotify"
+	ChannelTypeNtfy     ChannelType = "ntfy"
+	ChannelTypeSMTP     ChannelType = "smtp"
+	ChannelTypeTelegram ChannelType = "telegram"
+)
+
+// ChannelConfig is the configuration of a single notification channel.
+type ChannelConfig struct {
+	// Gotify is the configuration of the channel of type [ChannelTypeGotify].
+	Gotify *GotifyConfig `yaml:"gotify,omitempty" json:"gotify,omitempty"`
+
+	// Ntfy is the configuration of the channel of type [ChannelTypeNtfy].
+	Ntfy *NtfyConfig `yaml:"ntfy,omitempty" json:"ntfy,omitempty"`
+
+	// SMTP is the configuration of the channel of type [ChannelTypeSMTP].
+	SMTP *SMTPConfig `yaml:"smtp,omitempty" json:"smtp,omitempty"`
+
+	// Telegram is the configuration of the channel of type
+	// [ChannelTypeTelegram].
+	Telegram *TelegramConfig `yaml:"telegram,omitempty" json:"telegram,omitempty"`
+
+	// Name is the unique name of the channel.
+	Name string `yaml:"name" json:"name"`
+
+	// Type is the type of the channel.
+	Type ChannelType `yaml:"type" json:"type"`
+
+	// Events are the types of the events the channel is notified about.
+	Events []aghevent.Type `yaml:"events" json:"events"`
+
+	// Domains are the watched domains.  The events of the type
+	// [aghevent.TypeQueryBlocked] are only sent if the queried domain is one of
+	// these or their subdomain.  If empty, all such events are sent.
+	Domains []string `yaml:"domains" json:"domains"`
+
+	// Enabled defines if the messages are sent to the channel.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// Validate returns an error if the channel configuration isn't valid.
+func (c *ChannelConfig) Validate() (err error) {
+	if c.Name == "" {
+		return errors.Error("name: empty")
+	}
+
+	for i, t := range c.Events {
+		err = t.Validate()
+		if err != nil {
+			return fmt.Errorf("events: at index %d: %w", i, err)
+		}
+	}
+
+	switch c.Type {
+	case ChannelTypeGotify:
+		if c.Gotify == nil {
+			return errors.Error("gotify: no configuration")
+		}
+
+		err = c.Gotify.validate()
+	case ChannelTypeNtfy:
+		if c.Ntfy == nil {
+			return errors.Error("ntfy: no configuration")
+		}
+
+		err = c.Ntfy.validate()
+	case ChannelTypeSMTP:
+		if c.SMTP == nil {
+			return errors.Error("smtp: no configuration")
+		}
+
+		err = c.SMTP.validate()
+	case ChannelTypeTelegram:
+		if c.Telegram == nil {
+			return errors.Error("telegram: no configuration")
+		}
+
+		err = c.Telegram.validate()
+	default:
+		return fmt.Errorf("type: bad value %q", c.Type)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Type, err)
+	}
+
+	return nil
+}
+
+// NewChannel returns a new channel configured by c.  c must be valid, see
+// [ChannelConfig.Validate].  client is used by the channels sending HTTP
+// requests.
+func NewChannel(c *ChannelConfig, client *http.Client) (ch Channel) {
+	switch c.Type {
+	case ChannelTypeGotify:
+		return &gotify{conf: c.Gotify, client: client}
+	case ChannelTypeNtfy:
+		return &ntfy{conf: c.Ntfy, client: client}
+	case ChannelTypeSMTP:
+		return &smtpChannel{conf: c.SMTP}
+	case ChannelTypeTelegram:
+		return &telegram{conf: c.Telegram, client: client}
+	default:
+		panic(fmt.Errorf("notify: bad channel type %q", c.Type))
+	}
+}
+
+// WithoutSecrets returns a copy of c with the passwords and tokens removed.
+func (c *ChannelConfig) WithoutSecrets() (clone *ChannelConfig) {
+	clone = &ChannelConfig{}
+	*clone = *c
+
+	if c.Gotify != nil {
+		gc := *c.Gotify
+		gc.Token = ""
+		clone.Gotify = &gc
+	}
+
+	if c.Ntfy != nil {
+		nc := *c.Ntfy
+		nc.Token = ""
+		clone.Ntfy = &nc
+	}
+
+	if c.SMTP != nil {
+		sc := *c.SMTP
+		sc.Password = ""
+		clone.SMTP = &sc
+	}
+
+	if c.Telegram != nil {
+		tc := *c.Telegram
+		tc.BotToken = ""
+		clone.Telegram = &tc
+	}
+
+	return clone
+}
+
+// KeepSecrets sets the empty passwords and tokens of c to the ones of prev,
+// which is the previous configuration of the same channel.  This allows
+// updating the channel configurations received without secrets, see
+// [ChannelConfig.WithoutSecrets].  prev may be nil.
+func (c *ChannelConfig) KeepSecrets(prev *ChannelConfig) {
+	if prev == nil || prev.Type != c.Type {
+		return
+	}
+
+	switch c.Type {
+	case ChannelTypeGotify:
+		if c.Gotify != nil && prev.Gotify != nil && c.Gotify.Token == "" {
+			c.Gotify.Token = prev.Gotify.Token
+		}
+	case ChannelTypeNtfy:
+		if c.Ntfy != nil && prev.Ntfy != nil && c.Ntfy.Token == "" {
+			c.Ntfy.Token = prev.Ntfy.Token
+		}
+	case ChannelTypeSMTP:
+		if c.SMTP != nil && prev.SMTP != nil && c.SMTP.Password == "" {
+			c.SMTP.Password = prev.SMTP.Password
+		}
+	case ChannelTypeTelegram:
+		if c.Telegram != nil && prev.Telegram != nil && c.Telegram.BotToken == "" {
+			c.Telegram.BotToken = prev.Telegram.BotToken
+		}
+	default:
+		// Go on.
+	}
+}
+
+// ValidateChannels returns an error if any of confs isn't valid or if their
+// names aren't unique.
+func ValidateChannels(confs []*ChannelConfig) (err error) {
+	names := stringutil.NewSet()
+	for i, c := range confs {
+		err = c.Validate()
+		if err != nil {
+			return fmt.Errorf("channel at index %d: %w", i, err)
+		} else if names.Has(c.Name) {
+			return fmt.Errorf("channel at index %d: duplicate name %q", i, c.Name)
+		}
+
+		names.Add(c.Name)
+	}
+
+	return nil
+}
+
+// configuredChannel is a channel along with its configuration.
+type configuredChannel struct {
+	ch     Channel
+	filter *aghevent.Filter
+	name   string
+}
+
+// delivery is a single message to send to a channel.
+type delivery struct {
+	ch  *configuredChannel
+	msg *Message
+}
+
+// Notifier sends the messages to the configured channels.  The messages are
+// sent in background, one at a time.
+type Notifier struct {
+	client *http.Client
+
+	// mu protects channels.
+	mu       *sync.RWMutex
+	channels []*configuredChannel
+
+	queue chan *delivery
+	done  chan struct{}
+}
+
+// type check
+var _ aghevent.Handler = (*Notifier)(nil)
+
+// NewNotifier returns a new properly initialized *Notifier.  client is used by
+// the channels sending HTTP requests.
+func NewNotifier(client *http.Client) (n *Notifier) {
+	return &Notifier{
+		client: client,
+		mu:     &sync.RWMutex{},
+		queue:  make(chan *delivery, queueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// SetChannels replaces the channels of n with the ones configured by confs.
+// The disabled ones are ignored.
+func (n *Notifier) SetChannels(confs []*ChannelConfig) (err error) {
+	err = ValidateChannels(confs)
+	if err != nil {
+		return err
+	}
+
+	var channels []*configuredChannel
+	for _, c := range confs {
+		if !c.Enabled {
+			continue
+		}
+
+		channels = append(channels, &configuredChannel{
+			ch:     NewChannel(c, n.client),
+			filter: aghevent.NewFilter(c.Events, c.Domains),
+			name:   c.Name,
+		})
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.channels = channels
+
+	return nil
+}
+
+// Len returns the number of enabled channels.
+func (n *Notifier) Len() (l int) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return len(n.channels)
+}
+
+// Handle implements the [aghevent.Handler] interface for *Notifier.  It queues
+// the message about e for the matching channels.
+func (n *Notifier) Handle(e *aghevent.Event) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var msg *Message
+	for _, c := range n.channels {
+		if !c.filter.Match(e) {
+			continue
+		}
+
+		if msg == nil {
+			msg = EventMessage(e)
+		}
+
+		n.enqueue(&delivery{ch: c, msg: msg})
+	}
+}
+
+// Notify queues msg for all enabled channels regardless of their events.
+func (n *Notifier) Notify(msg *Message) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, c := range n.channels {
+		n.enqueue(&delivery{ch: c, msg: msg})
+	}
+}
+
+// enqueue queues d unless the queue is full.
+func (n *Notifier) enqueue(d *delivery) {
+	select {
+	case n.queue <- d:
+		// Go on.
+	default:
+		log.Info("notify: channel %q: queue is full, dropping %q", d.ch.name, d.msg.Title)
+	}
+}
+
+// Start starts sending the queued messages in a separate goroutine.
+func (n *Notifier) Start() {
+	go n.loop()
+}
+
+// Close stops sending the messages.  The queued ones are dropped.
+func (n *Notifier) Close() (err error) {
+	close(n.done)
+
+	return nil
+}
+
+// loop sends the queued messages until n is closed.
+func (n *Notifier) loop() {
+	defer log.OnPanic("notify")
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case d := <-n.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			err := d.ch.ch.Send(ctx, d.msg)
+			cancel()
+			if err != nil {
+				log.Error("notify: channel %q: sending %q: %s", d.ch.name, d.msg.Title, err)
+			}
+		}
+	}
+}
+
+// EventMessage returns the human readable message about e.
+func EventMessage(e *aghevent.Event) (msg *Message) {
+	d := e.Data
+	switch e.Type {
+	case aghevent.TypeQueryBlocked:
+		return &Message{
+			Title: "Query blocked",
+			Text:  fmt.Sprintf("Request for %s from %s was blocked (%s).", d["domain"], d["client_ip"], d["reason"]),
+		}
+	case aghevent.TypeFilterUpdateFailed:
+		return &Message{
+			Title: "Filter update failed",
+			Text:  fmt.Sprintf("Filter list %q (%s) could not be updated: %s.", d["name"], d["url"], d["error"]),
+		}
+	case aghevent.TypeDHCPLeaseAdded:
+		return &Message{
+			Title: "New DHCP lease",
+			Text:  fmt.Sprintf("Device %s (%s) has got the address %s.", d["hostname"], d["mac"], d["ip"]),
+		}
+	case aghevent.TypeDHCPLeaseRenewed:
+		return &Message{
+			Title: "DHCP lease renewed",
+			Text:  fmt.Sprintf("Device %s (%s) has renewed the address %s.", d["hostname"], d["mac"], d["ip"]),
+		}
+	case aghevent.TypeDHCPLeaseReleased:
+		return &Message{
+			Title: "DHCP lease released",
+			Text:  fmt.Sprintf("Device %s (%s) has released the address %s.", d["hostname"], d["mac"], d["ip"]),
+		}
+	case aghevent.TypeDHCPLeaseDeclined:
+		return &Message{
+			Title: "DHCP lease declined",
+			Text:  fmt.Sprintf("Device %s (%s) has declined the address %s.", d["hostname"], d["mac"], d["ip"]),
+		}
+	case aghevent.TypeDHCPLeaseExpired:
+		return &Message{
+			Title: "DHCP lease expired",
+			Text:  fmt.Sprintf("The address %s of device %s (%s) has expired.", d["ip"], d["hostname"], d["mac"]),
+		}
+	case aghevent.TypeUpdateAvailable:
+		return &Message{
+			Title: "Update available",
+			Text:  fmt.Sprintf("AdGuard Home %s is available: %s", d["version"], d["announcement_url"]),
+		}
+	case aghevent.TypeDiskSpaceLow:
+		return &Message{
+			Title: "Low disk space",
+			Text: fmt.Sprintf(
+				"Only %s bytes are free in the %s directory %s, the minimum is %s bytes.",
+				d["free"],
+				d["name"],
+				d["path"],
+				d["min_free"],
+			),
+		}
+	case aghevent.TypeParentalBypassStarted:
+		return &Message{
+			Title: "Parental control bypassed",
+			Text: fmt.Sprintf(
+				"Parental control is disabled for %s until %s (%s).",
+				d["client"],
+				d["expires"],
+				d["method"],
+			),
+		}
+	case aghevent.TypeParentalBypassFailed:
+		return &Message{
+			Title: "Parental control bypass failed",
+			Text:  fmt.Sprintf("A bypass attempt from %s has failed (%s).", d["client"], d["method"]),
+		}
+	case aghevent.TypeRuleRequestCreated:
+		return &Message{
+			Title: "New rule change request",
+			Text: fmt.Sprintf(
+				"%s requests to %s %s: %q.  Review it in the web interface.",
+				d["client"],
+				d["action"],
+				d["domain"],
+				d["comment"],
+			),
+		}
+	case aghevent.TypeDNSTunnelSuspected:
+		return &Message{
+			Title: "DNS tunneling suspected",
+			Text: fmt.Sprintf(
+				"Client %s is suspected of DNS tunneling via %s, the score is %s.",
+				d["client"],
+				d["domain"],
+				d["score"],
+			),
+		}
+	default:
+		return &Message{
+			Title: string(e.Type),
+			Text:  fmt.Sprintf("%s: %v", e.Type, d),
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/notify"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testMsg is the common message for tests.
+var testMsg = &notify.Message{
+	Title: "Test",
+	Text:  "Hello from AdGuard Home.",
+}
+
+func TestChannelConfig_Validate(t *testing.T) {
+	newConf := func() (c *notify.ChannelConfig) {
+		return &notify.ChannelConfig{
+			Ntfy: &notify.NtfyConfig{
+				Topic: "agh",
+			},
+			Name:   "phone",
+			Type:   notify.ChannelTypeNtfy,
+			Events: []aghevent.Type{aghevent.TypeUpdateAvailable},
+		}
+	}
+
+	testCases := []struct {
+		modify     func(c *notify.ChannelConfig)
+		name       string
+		wantErrMsg string
+	}{{
+		modify:     func(_ *notify.ChannelConfig) {},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		modify:     func(c *notify.ChannelConfig) { c.Name = "" },
+		name:       "no_name",
+		wantErrMsg: "name: empty",
+	}, {
+		modify:     func(c *notify.ChannelConfig) { c.Type = "pigeon" },
+		name:       "bad_type",
+		wantErrMsg: `type: bad value "pigeon"`,
+	}, {
+		modify:     func(c *notify.ChannelConfig) { c.Events = append(c.Events, "boot") },
+		name:       "bad_event",
+		wantErrMsg: `events: at index 1: bad event type "boot"`,
+	}, {
+		modify:     func(c *notify.ChannelConfig) { c.Type = notify.ChannelTypeTelegram },
+		name:       "no_type_config",
+		wantErrMsg: "telegram: no configuration",
+	}, {
+		modify:     func(c *notify.ChannelConfig) { c.Ntfy.Priority = 6 },
+		name:       "bad_priority",
+		wantErrMsg: "ntfy: priority: 6 is out of range",
+	}, {
+		modify: func(c *notify.ChannelConfig) {
+			c.Type = notify.ChannelTypeSMTP
+			c.SMTP = &notify.SMTPConfig{
+				Host: "smtp.example",
+				From: "AdGuard Home <agh@example.org>",
+				To:   []string{"admin@example.org", "bad address"},
+				Port: 587,
+			}
+		},
+		name:       "bad_recipient",
+		wantErrMsg: "smtp: to: at index 1: mail: no angle-addr",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newConf()
+			tc.modify(c)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, c.Validate())
+		})
+	}
+}
+
+func TestValidateChannels(t *testing.T) {
+	c := &notify.ChannelConfig{
+		Gotify: &notify.GotifyConfig{
+			ServerURL: "https://gotify.example",
+			Token:     "token",
+		},
+		Name: "gotify",
+		Type: notify.ChannelTypeGotify,
+	}
+
+	err := notify.ValidateChannels([]*notify.ChannelConfig{c, c})
+	testutil.AssertErrorMsg(t, `channel at index 1: duplicate name "gotify"`, err)
+}
+
+// request is a request received by the test server.
+type request struct {
+	header http.Header
+	path   string
+	body   []byte
+}
+
+// newTestServer returns a server that sends the received requests into the
+// returned channel and responds with code.
+func newTestServer(t *testing.T, code int) (srv *httptest.Server, reqs chan *request) {
+	t.Helper()
+
+	reqs = make(chan *request, 10)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		reqs <- &request{
+			header: r.Header.Clone(),
+			path:   r.URL.Path,
+			body:   body,
+		}
+
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, reqs
+}
+
+// send sends testMsg to the channel configured by c.
+func send(t *testing.T, c *notify.ChannelConfig) (err error) {
+	t.Helper()
+
+	require.NoError(t, c.Validate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+
+	return notify.NewChannel(c, http.DefaultClient).Send(ctx, testMsg)
+}
+
+func TestChannel_Send_http(t *testing.T) {
+	srv, reqs := newTestServer(t, http.StatusOK)
+
+	t.Run("telegram", func(t *testing.T) {
+		err := send(t, &notify.ChannelConfig{
+			Telegram: &notify.TelegramConfig{
+				APIURL:   srv.URL,
+				BotToken: "123:abc",
+				ChatID:   "@agh",
+			},
+			Name: "telegram",
+			Type: notify.ChannelTypeTelegram,
+		})
+		require.NoError(t, err)
+
+		req := <-reqs
+		assert.Equal(t, "/bot123:abc/sendMessage", req.path)
+
+		var got map[string]string
+		require.NoError(t, json.Unmarshal(req.body, &got))
+
+		assert.Equal(t, map[string]string{
+			"chat_id": "@agh",
+			"text":    "Test\n\nHello from AdGuard Home.",
+		}, got)
+	})
+
+	t.Run("ntfy", func(t *testing.T) {
+		err := send(t, &notify.ChannelConfig{
+			Ntfy: &notify.NtfyConfig{
+				ServerURL: srv.URL,
+				Topic:     "agh",
+				Token:     "tk_secret",
+				Priority:  4,
+			},
+			Name: "ntfy",
+			Type: notify.ChannelTypeNtfy,
+		})
+		require.NoError(t, err)
+
+		req := <-reqs
+		assert.Equal(t, "/agh", req.path)
+		assert.Equal(t, testMsg.Text, string(req.body))
+		assert.Equal(t, testMsg.Title, req.header.Get("Title"))
+		assert.Equal(t, "4", req.header.Get("Priority"))
+		assert.Equal(t, "Bearer tk_secret", req.header.Get("Authorization"))
+	})
+
+	t.Run("gotify", func(t *testing.T) {
+		err := send(t, &notify.ChannelConfig{
+			Gotify: &notify.GotifyConfig{
+				ServerURL: srv.URL + "/",
+				Token:     "app_token",
+				Priority:  8,
+			},
+			Name: "gotify",
+			Type: notify.ChannelTypeGotify,
+		})
+		require.NoError(t, err)
+
+		req := <-reqs
+		assert.Equal(t, "/message", req.path)
+		assert.Equal(t, "app_token", req.header.Get("X-Gotify-Key"))
+		assert.JSONEq(t, `{
+			"title": "Test",
+			"message": "Hello from AdGuard Home.",
+			"priority": 8
+		}`, string(req.body))
+	})
+}
+
+func TestChannel_Send_error(t *testing.T) {
+	srv, reqs := newTestServer(t, http.StatusUnauthorized)
+
+	err := send(t, &notify.ChannelConfig{
+		Telegram: &notify.TelegramConfig{
+			APIURL:   srv.URL + "/nonexistent",
+			BotToken: "123:abc",
+			ChatID:   "1",
+		},
+		Name: "telegram",
+		Type: notify.ChannelTypeTelegram,
+	})
+	<-reqs
+
+	testutil.AssertErrorMsg(t, `sending message: unexpected status code 401: ""`, err)
+}
+
+func TestNotifier(t *testing.T) {
+	srv, reqs := newTestServer(t, http.StatusOK)
+
+	n := notify.NewNotifier(http.DefaultClient)
+	err := n.SetChannels([]*notify.ChannelConfig{{
+		Ntfy: &notify.NtfyConfig{
+			ServerURL: srv.URL,
+			Topic:     "blocked",
+		},
+		Name:    "blocked",
+		Type:    notify.ChannelTypeNtfy,
+		Events:  []aghevent.Type{aghevent.TypeQueryBlocked},
+		Domains: []string{"example.org"},
+		Enabled: true,
+	}, {
+		Ntfy: &notify.NtfyConfig{
+			ServerURL: srv.URL,
+			Topic:     "disabled",
+		},
+		Name:    "disabled",
+		Type:    notify.ChannelTypeNtfy,
+		Events:  []aghevent.Type{aghevent.TypeQueryBlocked},
+		Enabled: false,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, 1, n.Len())
+
+	n.Start()
+	testutil.CleanupAndRequireSuccess(t, n.Close)
+
+	n.Handle(&aghevent.Event{
+		Type: aghevent.TypeQueryBlocked,
+		Data: map[string]string{"domain": "other.example"},
+	})
+	n.Handle(&aghevent.Event{
+		Type: aghevent.TypeQueryBlocked,
+		Data: map[string]string{
+			"domain":    "ads.example.org",
+			"client_ip": "192.0.2.1",
+			"reason":    "FilteredBlackList",
+		},
+	})
+
+	var req *request
+	require.Eventually(t, func() (ok bool) {
+		select {
+		case req = <-reqs:
+			return true
+		default:
+			return false
+		}
+	}, testTimeout, testTimeout/10)
+
+	assert.Equal(t, "/blocked", req.path)
+	assert.Equal(t, "Query blocked", req.header.Get("Title"))
+	assert.Equal(
+		t,
+		"Request for ads.example.org from 192.0.2.1 was blocked (FilteredBlackList).",
+		string(req.body),
+	)
+
+	n.Notify(testMsg)
+
+	require.Eventually(t, func() (ok bool) {
+		select {
+		case req = <-reqs:
+			return true
+		default:
+			return false
+		}
+	}, testTimeout, testTimeout/10)
+
+	assert.Equal(t, testMsg.Title, req.header.Get("Title"))
+	assert.Empty(t, reqs)
+}
+
+func TestChannelConfig_WithoutSecrets(t *testing.T) {
+	c := &notify.ChannelConfig{
+		SMTP: &notify.SMTPConfig{
+			Host:     "smtp.example",
+			Username: "agh",
+			Password: "secret",
+			From:     "agh@example.org",
+			To:       []string{"admin@example.org"},
+			Port:     465,
+		},
+		Name: "email",
+		Type: notify.ChannelTypeSMTP,
+	}
+
+	hidden := c.WithoutSecrets()
+	require.NotNil(t, hidden.SMTP)
+
+	assert.Empty(t, hidden.SMTP.Password)
+	assert.Equal(t, "agh", hidden.SMTP.Username)
+	assert.Equal(t, "secret", c.SMTP.Password)
+
+	hidden.KeepSecrets(c)
+	assert.Equal(t, c, hidden)
+
+	hidden.SMTP.Password = "new"
+	hidden.KeepSecrets(c)
+	assert.Equal(t, "new", hidden.SMTP.Password)
+}
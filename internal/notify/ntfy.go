@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DefaultNtfyServerURL is the URL of the ntfy server used by default.
+const DefaultNtfyServerURL = "https://ntfy.sh"
+
+// NtfyConfig is the configuration of the channel publishing the messages to an
+// ntfy topic.
+type NtfyConfig struct {
+	// ServerURL is the URL of the ntfy server.  If empty,
+	// [DefaultNtfyServerURL] is used.
+	ServerURL string `yaml:"server_url" json:"server_url"`
+
+	// Topic is the name of the topic.
+	Topic string `yaml:"topic" json:"topic"`
+
+	// Token, if not empty, is the access token used for authentication.
+	Token string `yaml:"token" json:"token"`
+
+	// Priority is the priority of the messages from 1 to 5.  If zero, the
+	// server's default is used.
+	Priority int `yaml:"priority" json:"priority"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *NtfyConfig) validate() (err error) {
+	if c.Topic == "" {
+		return errors.Error("topic: empty")
+	} else if strings.Contains(c.Topic, "/") {
+		return fmt.Errorf("topic: bad value %q", c.Topic)
+	} else if c.Priority < 0 || c.Priority > 5 {
+		return fmt.Errorf("priority: %d is out of range", c.Priority)
+	}
+
+	if c.ServerURL != "" {
+		err = validateURL(c.ServerURL)
+		if err != nil {
+			return fmt.Errorf("server_url: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ntfy is the [Channel] publishing the messages to an ntfy topic.
+type ntfy struct {
+	conf   *NtfyConfig
+	client *http.Client
+}
+
+// type check
+var _ Channel = (*ntfy)(nil)
+
+// Send implements the [Channel] interface for *ntfy.
+func (n *ntfy) Send(ctx context.Context, msg *Message) (err error) {
+	serverURL := n.conf.ServerURL
+	if serverURL == "" {
+		serverURL = DefaultNtfyServerURL
+	}
+
+	u := strings.TrimSuffix(serverURL, "/") + "/" + url.PathEscape(n.conf.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(msg.Text))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Title", msg.Title)
+	if n.conf.Priority != 0 {
+		req.Header.Set("Priority", fmt.Sprint(n.conf.Priority))
+	}
+
+	if n.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.conf.Token)
+	}
+
+	err = do(n.client, req)
+	if err != nil {
+		return fmt.Errorf("publishing message: %w", err)
+	}
+
+	return nil
+}
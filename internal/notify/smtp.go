@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// SMTPConfig is the configuration of the channel sending the messages by
+// email.
+type SMTPConfig struct {
+	// Host is the hostname of the SMTP server.
+	Host string `yaml:"host" json:"host"`
+
+	// Username, if not empty, is the username used for the PLAIN
+	// authentication.
+	Username string `yaml:"username" json:"username"`
+
+	// Password is the password used for the authentication.
+	Password string `yaml:"password" json:"password"`
+
+	// From is the address of the sender.
+	From string `yaml:"from" json:"from"`
+
+	// To are the addresses of the recipients.
+	To []string `yaml:"to" json:"to"`
+
+	// Port is the port of the SMTP server.
+	Port uint16 `yaml:"port" json:"port"`
+
+	// ImplicitTLS defines if the connection is established over TLS from the
+	// start, as opposed to the STARTTLS command used when the server supports
+	// it.
+	ImplicitTLS bool `yaml:"implicit_tls" json:"implicit_tls"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *SMTPConfig) validate() (err error) {
+	if c.Host == "" {
+		return errors.Error("host: empty")
+	} else if c.Port == 0 {
+		return errors.Error("port: zero")
+	}
+
+	_, err = mail.ParseAddress(c.From)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+
+	if len(c.To) == 0 {
+		return errors.Error("to: no recipients")
+	}
+
+	for i, addr := range c.To {
+		_, err = mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("to: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// smtpChannel is the [Channel] sending the messages by email.
+type smtpChannel struct {
+	conf *SMTPConfig
+}
+
+// type check
+var _ Channel = (*smtpChannel)(nil)
+
+// Send implements the [Channel] interface for *smtpChannel.
+func (s *smtpChannel) Send(ctx context.Context, msg *Message) (err error) {
+	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(int(s.conf.Port)))
+	tlsConf := &tls.Config{
+		ServerName: s.conf.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	var conn net.Conn
+	if s.conf.ImplicitTLS {
+		d := &tls.Dialer{Config: tlsConf}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		d := &net.Dialer{}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return errors.WithDeferred(fmt.Errorf("setting deadline: %w", err), conn.Close())
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.conf.Host)
+	if err != nil {
+		return errors.WithDeferred(fmt.Errorf("starting session: %w", err), conn.Close())
+	}
+
+	err = s.send(c, tlsConf, msg)
+	if err != nil {
+		return errors.WithDeferred(err, c.Close())
+	}
+
+	// Quit also closes the connection.
+	return c.Quit()
+}
+
+// send authenticates using c, if needed, and sends msg.
+func (s *smtpChannel) send(c *smtp.Client, tlsConf *tls.Config, msg *Message) (err error) {
+	if ok, _ := c.Extension("STARTTLS"); ok && !s.conf.ImplicitTLS {
+		err = c.StartTLS(tlsConf)
+		if err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if s.conf.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host))
+		if err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	// The addresses are validated in [SMTPConfig.validate].
+	from, _ := mail.ParseAddress(s.conf.From)
+	err = c.Mail(from.Address)
+	if err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+
+	for _, rcpt := range s.conf.To {
+		to, _ := mail.ParseAddress(rcpt)
+		err = c.Rcpt(to.Address)
+		if err != nil {
+			return fmt.Errorf("adding recipient %q: %w", to.Address, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+
+	_, err = w.Write(s.email(msg, time.Now()))
+	if err != nil {
+		return errors.WithDeferred(fmt.Errorf("writing data: %w", err), w.Close())
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("finishing data: %w", err)
+	}
+
+	return nil
+}
+
+// email returns the email message with msg sent at now.
+func (s *smtpChannel) email(msg *Message, now time.Time) (data []byte) {
+	buf := &bytes.Buffer{}
+	header := func(key, value string) {
+		_, _ = fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", s.conf.From)
+	header("To", strings.Join(s.conf.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Title))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	_, _ = buf.WriteString("\r\n")
+
+	text := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	_, _ = buf.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	_, _ = buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
@@ -0,0 +1,113 @@
+package notify_test
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/notify"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mail is an email received by the test SMTP server.
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// newTestSMTPServer starts a minimal SMTP server accepting a single email
+// without authentication and returns its port and the channel receiving the
+// email.
+func newTestSMTPServer(t *testing.T) (port uint16, mails chan *mail) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	mails = make(chan *mail, 1)
+	go func() {
+		conn, aerr := l.Accept()
+		if aerr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		tc := textproto.NewConn(conn)
+		m := &mail{}
+		_ = tc.PrintfLine("220 localhost ESMTP")
+		for {
+			line, rerr := tc.ReadLine()
+			if rerr != nil {
+				return
+			}
+
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO", "HELO":
+				_ = tc.PrintfLine("250 localhost")
+			case "MAIL":
+				m.from = arg
+				_ = tc.PrintfLine("250 OK")
+			case "RCPT":
+				m.to = append(m.to, arg)
+				_ = tc.PrintfLine("250 OK")
+			case "DATA":
+				_ = tc.PrintfLine("354 Go ahead")
+				data, derr := tc.ReadDotBytes()
+				if derr != nil {
+					return
+				}
+
+				m.data = string(data)
+				_ = tc.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tc.PrintfLine("221 Bye")
+				mails <- m
+
+				return
+			default:
+				_ = tc.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	return uint16(l.Addr().(*net.TCPAddr).Port), mails
+}
+
+func TestChannel_Send_smtp(t *testing.T) {
+	port, mails := newTestSMTPServer(t)
+
+	err := send(t, &notify.ChannelConfig{
+		SMTP: &notify.SMTPConfig{
+			Host: "127.0.0.1",
+			From: "AdGuard Home <agh@example.org>",
+			To:   []string{"admin@example.org", "Other <other@example.org>"},
+			Port: port,
+		},
+		Name: "email",
+		Type: notify.ChannelTypeSMTP,
+	})
+	require.NoError(t, err)
+
+	m := <-mails
+	assert.Equal(t, "FROM:<agh@example.org>", m.from)
+	assert.Equal(t, []string{"TO:<admin@example.org>", "TO:<other@example.org>"}, m.to)
+
+	header, body, ok := strings.Cut(m.data, "\n\n")
+	require.True(t, ok)
+
+	tr := textproto.NewReader(bufio.NewReader(strings.NewReader(header + "\n\n")))
+	h, err := tr.ReadMIMEHeader()
+	require.NoError(t, err)
+
+	assert.Equal(t, "AdGuard Home <agh@example.org>", h.Get("From"))
+	assert.Equal(t, "admin@example.org, Other <other@example.org>", h.Get("To"))
+	assert.Equal(t, "Test", h.Get("Subject"))
+	assert.Equal(t, "Hello from AdGuard Home.\n", body)
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DefaultTelegramAPIURL is the URL of the Telegram Bot API used by default.
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramConfig is the configuration of the channel sending the messages with
+// a Telegram bot.
+type TelegramConfig struct {
+	// APIURL is the URL of the Bot API server.  If empty,
+	// [DefaultTelegramAPIURL] is used.
+	APIURL string `yaml:"api_url" json:"api_url"`
+
+	// BotToken is the token of the bot.
+	BotToken string `yaml:"bot_token" json:"bot_token"`
+
+	// ChatID is the identifier of the chat or the username of the channel the
+	// messages are sent to.
+	ChatID string `yaml:"chat_id" json:"chat_id"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *TelegramConfig) validate() (err error) {
+	if c.BotToken == "" {
+		return errors.Error("bot_token: empty")
+	} else if c.ChatID == "" {
+		return errors.Error("chat_id: empty")
+	}
+
+	if c.APIURL != "" {
+		err = validateURL(c.APIURL)
+		if err != nil {
+			return fmt.Errorf("api_url: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// telegram is the [Channel] sending the messages with a Telegram bot.
+type telegram struct {
+	conf   *TelegramConfig
+	client *http.Client
+}
+
+// type check
+var _ Channel = (*telegram)(nil)
+
+// Send implements the [Channel] interface for *telegram.
+func (t *telegram) Send(ctx context.Context, msg *Message) (err error) {
+	apiURL := t.conf.APIURL
+	if apiURL == "" {
+		apiURL = DefaultTelegramAPIURL
+	}
+
+	body, err := json.Marshal(&struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}{
+		ChatID: t.conf.ChatID,
+		Text:   msg.Title + "\n\n" + msg.Text,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	u := strings.TrimSuffix(apiURL, "/") + "/bot" + t.conf.BotToken + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		// Don't include the URL into the error, since it contains the token.
+		return errors.Error("creating request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	err = do(t.client, req)
+	if err != nil {
+		return fmt.Errorf("sending message: %s", strings.ReplaceAll(err.Error(), t.conf.BotToken, "***"))
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+// Package pihole contains the reader of the Pi-hole Teleporter backups.
+package pihole
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// MaxFileSize is the maximum size of a single file within a Teleporter
+// archive.
+const MaxFileSize = 64 * 1024 * 1024
+
+// DomainKind is the kind of a domain list entry.  The values are the same as
+// the ones of the type column of the Pi-hole's domainlist table.
+type DomainKind int
+
+// Domain list entry kinds.
+const (
+	DomainAllowExact DomainKind = 0
+	DomainDenyExact  DomainKind = 1
+	DomainAllowRegex DomainKind = 2
+	DomainDenyRegex  DomainKind = 3
+)
+
+// Backup is the contents of a Pi-hole Teleporter backup.
+type Backup struct {
+	// Adlists are the block lists.
+	Adlists []*Adlist
+
+	// Domains are the entries of the allowlist and the denylist.
+	Domains []*Domain
+
+	// Groups are the groups of the clients.
+	Groups []*Group
+
+	// Clients are the configured clients.
+	Clients []*Client
+
+	// Hosts are the custom DNS records.
+	Hosts []*HostRecord
+
+	// CNAMEs are the custom CNAME records.
+	CNAMEs []*CNAMERecord
+}
+
+// Adlist is a block list.
+type Adlist struct {
+	// Address is the URL of the list.
+	Address string `json:"address"`
+
+	// Comment is the user's comment.
+	Comment string `json:"comment"`
+
+	// GroupIDs are the IDs of the groups the list is assigned to.
+	GroupIDs []int `json:"-"`
+
+	// ID is the identifier of the list.
+	ID int `json:"id"`
+
+	// Enabled is true if the list is enabled.
+	Enabled Bool `json:"enabled"`
+}
+
+// Domain is an entry of the allowlist or the denylist.
+type Domain struct {
+	// Domain is the domain name or, for the regex kinds, the regular
+	// expression.
+	Domain string `json:"domain"`
+
+	// Comment is the user's comment.
+	Comment string `json:"comment"`
+
+	// Kind is the kind of the entry.
+	Kind DomainKind `json:"type"`
+
+	// Enabled is true if the entry is enabled.
+	Enabled Bool `json:"enabled"`
+}
+
+// Group is a group of clients.
+type Group struct {
+	// Name is the name of the group.
+	Name string `json:"name"`
+
+	// ID is the identifier of the group.  The group with ID 0 is the default
+	// one.
+	ID int `json:"id"`
+
+	// Enabled is true if the group is enabled.
+	Enabled Bool `json:"enabled"`
+}
+
+// Client is a configured client.
+type Client struct {
+	// IP is the identifier of the client: an IP address, a CIDR, a MAC
+	// address, a hostname, or an interface name prefixed with a colon.
+	IP string `json:"ip"`
+
+	// Comment is the user's comment.
+	Comment string `json:"comment"`
+
+	// GroupIDs are the IDs of the groups the client is assigned to.
+	GroupIDs []int `json:"-"`
+
+	// ID is the identifier of the client.
+	ID int `json:"id"`
+}
+
+// HostRecord is a custom DNS record.
+type HostRecord struct {
+	// IP is the IP address.
+	IP string
+
+	// Domain is the domain name.
+	Domain string
+}
+
+// CNAMERecord is a custom CNAME record.
+type CNAMERecord struct {
+	// Domain is the domain name.
+	Domain string
+
+	// Target is the canonical name.
+	Target string
+}
+
+// Bool is a boolean, which is encoded as an SQLite integer in the backups.
+type Bool bool
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface for *Bool.  It
+// accepts booleans, numbers, and strings with numbers.
+func (b *Bool) UnmarshalJSON(data []byte) (err error) {
+	s := strings.Trim(string(data), `"`)
+	switch s {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		var n int
+		n, err = strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("bad boolean %s", data)
+		}
+
+		*b = n != 0
+	}
+
+	return nil
+}
+
+// groupLink is an entry of the tables assigning the lists and the clients to
+// groups.
+type groupLink struct {
+	AdlistID int `json:"adlist_id"`
+	ClientID int `json:"client_id"`
+	GroupID  int `json:"group_id"`
+}
+
+// Names of the files within a Teleporter archive.
+const (
+	fileAdlist        = "adlist.json"
+	fileAdlistByGroup = "adlist_by_group.json"
+	fileAllowExact    = "whitelist.exact.json"
+	fileAllowRegex    = "whitelist.regex.json"
+	fileClient        = "client.json"
+	fileClientByGroup = "client_by_group.json"
+	fileCustomCNAME   = "05-pihole-custom-cname.conf"
+	fileCustomList    = "custom.list"
+	fileDenyExact     = "blacklist.exact.json"
+	fileDenyRegex     = "blacklist.regex.json"
+	fileGroup         = "group.json"
+)
+
+// ReadTeleporter reads a Pi-hole Teleporter backup, a gzipped tar archive,
+// from r.  The files the reader doesn't know are ignored.
+func ReadTeleporter(r io.Reader) (b *Backup, err error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, gzr.Close()) }()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gzr)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		} else if hdr.Size > MaxFileSize {
+			return nil, fmt.Errorf("file %q: too large: %d bytes", hdr.Name, hdr.Size)
+		}
+
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(tr, MaxFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("reading file %q: %w", hdr.Name, err)
+		}
+
+		files[path.Base(hdr.Name)] = data
+	}
+
+	return parseFiles(files)
+}
+
+// parseFiles parses the files of a Teleporter archive, mapped by their base
+// names.
+func parseFiles(files map[string][]byte) (b *Backup, err error) {
+	b = &Backup{}
+
+	for _, f := range []struct {
+		v    any
+		name string
+	}{{
+		v:    &b.Adlists,
+		name: fileAdlist,
+	}, {
+		v:    &b.Groups,
+		name: fileGroup,
+	}, {
+		v:    &b.Clients,
+		name: fileClient,
+	}} {
+		err = decodeFile(files, f.name, f.v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range []string{fileAllowExact, fileDenyExact, fileAllowRegex, fileDenyRegex} {
+		var domains []*Domain
+		err = decodeFile(files, name, &domains)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Domains = append(b.Domains, domains...)
+	}
+
+	err = b.parseGroupLinks(files)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Hosts, err = parseCustomList(files[fileCustomList])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileCustomList, err)
+	}
+
+	b.CNAMEs, err = parseCustomCNAME(files[fileCustomCNAME])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileCustomCNAME, err)
+	}
+
+	return b, nil
+}
+
+// decodeFile decodes the JSON file with the base name name into v, if there
+// is one.
+func decodeFile(files map[string][]byte, name string, v any) (err error) {
+	data, ok := files[name]
+	if !ok {
+		return nil
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// parseGroupLinks sets the group IDs of the adlists and the clients.
+func (b *Backup) parseGroupLinks(files map[string][]byte) (err error) {
+	var adlistLinks, clientLinks []*groupLink
+	err = decodeFile(files, fileAdlistByGroup, &adlistLinks)
+	if err != nil {
+		return err
+	}
+
+	err = decodeFile(files, fileClientByGroup, &clientLinks)
+	if err != nil {
+		return err
+	}
+
+	adlists := make(map[int]*Adlist, len(b.Adlists))
+	for _, a := range b.Adlists {
+		adlists[a.ID] = a
+	}
+
+	for _, l := range adlistLinks {
+		if a, ok := adlists[l.AdlistID]; ok {
+			a.GroupIDs = append(a.GroupIDs, l.GroupID)
+		}
+	}
+
+	clients := make(map[int]*Client, len(b.Clients))
+	for _, c := range b.Clients {
+		clients[c.ID] = c
+	}
+
+	for _, l := range clientLinks {
+		if c, ok := clients[l.ClientID]; ok {
+			c.GroupIDs = append(c.GroupIDs, l.GroupID)
+		}
+	}
+
+	return nil
+}
+
+// parseCustomList parses the custom DNS records file, which has the hosts file
+// format.
+func parseCustomList(data []byte) (recs []*HostRecord, err error) {
+	err = eachLine(data, func(line string) (lineErr error) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("bad record %q", line)
+		}
+
+		for _, d := range fields[1:] {
+			recs = append(recs, &HostRecord{IP: fields[0], Domain: d})
+		}
+
+		return nil
+	})
+
+	return recs, err
+}
+
+// parseCustomCNAME parses the dnsmasq configuration file with the custom CNAME
+// records of the form "cname=domain[,domain...],target".
+func parseCustomCNAME(data []byte) (recs []*CNAMERecord, err error) {
+	err = eachLine(data, func(line string) (lineErr error) {
+		const prefix = "cname="
+		if !strings.HasPrefix(line, prefix) {
+			return fmt.Errorf("bad directive %q", line)
+		}
+
+		names := strings.Split(line[len(prefix):], ",")
+		if len(names) < 2 {
+			return fmt.Errorf("bad record %q", line)
+		}
+
+		target := names[len(names)-1]
+		for _, d := range names[:len(names)-1] {
+			recs = append(recs, &CNAMERecord{Domain: d, Target: target})
+		}
+
+		return nil
+	})
+
+	return recs, err
+}
+
+// eachLine calls f for each line of data, which isn't empty or a comment.
+func eachLine(data []byte, f func(line string) (err error)) (err error) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		err = f(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	return s.Err()
+}
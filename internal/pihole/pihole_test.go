@@ -0,0 +1,140 @@
+package pihole_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTeleporter returns a Teleporter archive with files.
+func newTeleporter(t *testing.T, files map[string]string) (data []byte) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	return buf.Bytes()
+}
+
+func TestReadTeleporter(t *testing.T) {
+	data := newTeleporter(t, map[string]string{
+		"adlist.json": `[{"id":1,"address":"https://example.com/hosts",` +
+			`"enabled":1,"comment":"Example"},{"id":2,"address":"https://example.net/",` +
+			`"enabled":"0","comment":""}]`,
+		"adlist_by_group.json":                  `[{"adlist_id":1,"group_id":0},{"adlist_id":2,"group_id":1}]`,
+		"group.json":                            `[{"id":0,"enabled":1,"name":"Default"},{"id":1,"enabled":0,"name":"Kids"}]`,
+		"client.json":                           `[{"id":3,"ip":"192.168.1.5","comment":"Laptop"}]`,
+		"client_by_group.json":                  `[{"client_id":3,"group_id":1}]`,
+		"whitelist.exact.json":                  `[{"id":1,"type":0,"domain":"allowed.example","enabled":1}]`,
+		"blacklist.regex.json":                  `[{"id":2,"type":3,"domain":"^ads\\.","enabled":true}]`,
+		"custom.list":                           "# Comment.\n192.168.1.2 nas.lan\n",
+		"dnsmasq.d/05-pihole-custom-cname.conf": "cname=files.lan,www.lan,nas.lan\n",
+		"pihole-FTL.conf":                       "PRIVACYLEVEL=0\n",
+	})
+
+	b, err := pihole.ReadTeleporter(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*pihole.Adlist{{
+		Address:  "https://example.com/hosts",
+		Comment:  "Example",
+		GroupIDs: []int{0},
+		ID:       1,
+		Enabled:  true,
+	}, {
+		Address:  "https://example.net/",
+		GroupIDs: []int{1},
+		ID:       2,
+		Enabled:  false,
+	}}, b.Adlists)
+
+	assert.Equal(t, []*pihole.Group{{
+		Name:    "Default",
+		ID:      0,
+		Enabled: true,
+	}, {
+		Name:    "Kids",
+		ID:      1,
+		Enabled: false,
+	}}, b.Groups)
+
+	assert.Equal(t, []*pihole.Client{{
+		IP:       "192.168.1.5",
+		Comment:  "Laptop",
+		GroupIDs: []int{1},
+		ID:       3,
+	}}, b.Clients)
+
+	assert.Equal(t, []*pihole.Domain{{
+		Domain:  "allowed.example",
+		Kind:    pihole.DomainAllowExact,
+		Enabled: true,
+	}, {
+		Domain:  `^ads\.`,
+		Kind:    pihole.DomainDenyRegex,
+		Enabled: true,
+	}}, b.Domains)
+
+	assert.Equal(t, []*pihole.HostRecord{{IP: "192.168.1.2", Domain: "nas.lan"}}, b.Hosts)
+	assert.Equal(t, []*pihole.CNAMERecord{
+		{Domain: "files.lan", Target: "nas.lan"},
+		{Domain: "www.lan", Target: "nas.lan"},
+	}, b.CNAMEs)
+}
+
+func TestReadTeleporter_errors(t *testing.T) {
+	testCases := []struct {
+		files      map[string]string
+		name       string
+		wantErrMsg string
+	}{{
+		files:      map[string]string{"adlist.json": `{}`},
+		name:       "bad_json",
+		wantErrMsg: "adlist.json: json: cannot unmarshal object into Go value of type []*pihole.Adlist",
+	}, {
+		files:      map[string]string{"group.json": `[{"enabled":"yes"}]`},
+		name:       "bad_bool",
+		wantErrMsg: `group.json: bad boolean "yes"`,
+	}, {
+		files:      map[string]string{"custom.list": "192.168.1.2\n"},
+		name:       "bad_custom_list",
+		wantErrMsg: `custom.list: line 1: bad record "192.168.1.2"`,
+	}, {
+		files:      map[string]string{"05-pihole-custom-cname.conf": "address=/a/1.2.3.4\n"},
+		name:       "bad_cname",
+		wantErrMsg: `05-pihole-custom-cname.conf: line 1: bad directive "address=/a/1.2.3.4"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pihole.ReadTeleporter(bytes.NewReader(newTeleporter(t, tc.files)))
+			assert.EqualError(t, err, tc.wantErrMsg)
+		})
+	}
+
+	t.Run("not_gzip", func(t *testing.T) {
+		_, err := pihole.ReadTeleporter(bytes.NewReader([]byte("not an archive")))
+		assert.EqualError(t, err, "reading gzip: gzip: invalid header")
+	})
+}
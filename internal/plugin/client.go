@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// client is the host side of the protocol.
+type client struct {
+	conn   *grpc.ClientConn
+	plugin PluginClient
+}
+
+// newClient returns a new client connected to the plugin which has sent the
+// handshake line.
+func newClient(handshake string) (c *client, err error) {
+	network, addr, err := parseHandshake(handshake)
+	if err != nil {
+		return nil, fmt.Errorf("bad handshake %q: %w", handshake, err)
+	}
+
+	conn, err := grpc.Dial(
+		"passthrough:///"+addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (conn net.Conn, err error) {
+			d := &net.Dialer{}
+
+			return d.DialContext(ctx, network, addr)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %w", err)
+	}
+
+	return &client{
+		conn:   conn,
+		plugin: NewPluginClient(conn),
+	}, nil
+}
+
+// parseHandshake parses the handshake line of the plugin.  See plugin.proto.
+func parseHandshake(line string) (network, addr string, err error) {
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 4)
+	if len(parts) != 4 || parts[0] != handshakePrefix {
+		return "", "", fmt.Errorf("want %s|<version>|<network>|<address>", handshakePrefix)
+	}
+
+	ver, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("version: %w", err)
+	} else if ver != ProtocolVersion {
+		return "", "", fmt.Errorf("unsupported version %d", ver)
+	}
+
+	network, addr = parts[2], parts[3]
+	if network != "tcp" && network != "unix" {
+		return "", "", fmt.Errorf("unsupported network %q", network)
+	}
+
+	return network, addr, nil
+}
+
+// info calls the Info method.
+func (c *client) info(ctx context.Context, req *InfoRequest) (resp *InfoResponse, err error) {
+	return c.plugin.Info(ctx, req)
+}
+
+// inspect calls the Inspect method.
+func (c *client) inspect(ctx context.Context, req *InspectRequest) (resp *InspectResponse, err error) {
+	return c.plugin.Inspect(ctx, req)
+}
+
+// log calls the Log method.
+func (c *client) log(ctx context.Context, req *LogRequest) (err error) {
+	_, err = c.plugin.Log(ctx, req)
+
+	return err
+}
+
+// close closes the connection to the plugin.
+func (c *client) close() (err error) {
+	return c.conn.Close()
+}
@@ -0,0 +1,500 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// DefaultTimeout is the default timeout of a single Inspect call.
+const DefaultTimeout = 100 * time.Millisecond
+
+// Timeouts and delays of the plugin lifecycle.
+const (
+	handshakeTimeout = 10 * time.Second
+	infoTimeout      = 5 * time.Second
+	logTimeout       = 5 * time.Second
+	stopTimeout      = 5 * time.Second
+	minRestartDelay  = 1 * time.Second
+	maxRestartDelay  = 1 * time.Minute
+)
+
+// Parameters of the query log sink.
+const (
+	logQueueSize = 4096
+	logBatchSize = 100
+	logFlushIvl  = 1 * time.Second
+)
+
+// maxHandshakeLen is the maximum length of the handshake line.
+const maxHandshakeLen = 1024
+
+// Config is the configuration of a single plugin.
+type Config struct {
+	// Name is the unique name of the plugin used in the logs.
+	Name string `yaml:"name"`
+
+	// Command is the path to the program of the plugin.
+	Command string `yaml:"command"`
+
+	// Args are the arguments of the program.
+	Args []string `yaml:"args"`
+
+	// Timeout is the maximum duration of a single query inspection.  If the
+	// plugin doesn't respond in time, the decision is kept.  If zero,
+	// [DefaultTimeout] is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// Enabled defines if the plugin is started.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if the plugin configuration isn't valid.
+func (c *Config) Validate() (err error) {
+	if c.Name == "" {
+		return errors.Error("name: empty")
+	} else if c.Command == "" {
+		return errors.Error("command: empty")
+	} else if c.Timeout.Duration < 0 {
+		return fmt.Errorf("timeout: negative value %s", c.Timeout)
+	}
+
+	return nil
+}
+
+// ValidateConfigs returns an error if any of confs isn't valid or if their
+// names aren't unique.
+func ValidateConfigs(confs []*Config) (err error) {
+	names := stringutil.NewSet()
+	for i, c := range confs {
+		err = c.Validate()
+		if err != nil {
+			return fmt.Errorf("plugin at index %d: %w", i, err)
+		} else if names.Has(c.Name) {
+			return fmt.Errorf("plugin at index %d: duplicate name %q", i, c.Name)
+		}
+
+		names.Add(c.Name)
+	}
+
+	return nil
+}
+
+// ManagerConfig is the configuration of a [Manager].
+type ManagerConfig struct {
+	// Version is the version of AdGuard Home sent to the plugins.
+	Version string
+
+	// Plugins are the configured plugins.  The disabled ones are ignored.
+	Plugins []*Config
+}
+
+// Manager launches the plugins, restarts them when they exit, and sends the
+// queries and the query log entries to them.
+type Manager struct {
+	logs    chan *LogEntry
+	done    chan struct{}
+	wg      *sync.WaitGroup
+	plugins []*instance
+}
+
+// NewManager returns a new *Manager.  c must be valid, see [ValidateConfigs].
+// The plugins are launched by [Manager.Start].
+func NewManager(c *ManagerConfig) (m *Manager) {
+	m = &Manager{
+		logs: make(chan *LogEntry, logQueueSize),
+		done: make(chan struct{}),
+		wg:   &sync.WaitGroup{},
+	}
+
+	for _, conf := range c.Plugins {
+		if !conf.Enabled {
+			continue
+		}
+
+		timeout := conf.Timeout.Duration
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+
+		m.plugins = append(m.plugins, &instance{
+			conf:    conf,
+			mu:      &sync.RWMutex{},
+			version: c.Version,
+			timeout: timeout,
+		})
+	}
+
+	return m
+}
+
+// Len returns the number of enabled plugins.
+func (m *Manager) Len() (n int) {
+	return len(m.plugins)
+}
+
+// Start launches the plugins.
+func (m *Manager) Start() {
+	for _, p := range m.plugins {
+		m.wg.Add(1)
+		go func(p *instance) {
+			defer m.wg.Done()
+
+			p.supervise(m.done)
+		}(p)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		m.logLoop()
+	}()
+}
+
+// Close stops the plugins and waits for them to exit.
+func (m *Manager) Close() (err error) {
+	close(m.done)
+	m.wg.Wait()
+
+	return nil
+}
+
+// Decide sends q to the running plugins able to inspect the queries, in order,
+// and returns the first verdict overriding the decision.  It implements the
+// query hook interface of the DNS server.
+func (m *Manager) Decide(q *queryhook.Query) (v *queryhook.Verdict, err error) {
+	req := &InspectRequest{
+		ClientIp: q.ClientIP,
+		ClientId: q.ClientID,
+		Domain:   q.Domain,
+		Qtype:    q.QType,
+		Reason:   q.Reason,
+		Rule:     q.Rule,
+		Filtered: q.Filtered,
+	}
+
+	for _, p := range m.plugins {
+		c, info := p.state()
+		if c == nil || !info.Inspect {
+			continue
+		}
+
+		resp, ierr := p.inspect(c, req)
+		if ierr != nil {
+			log.Debug("plugin %q: inspecting %q: %s", p.conf.Name, q.Domain, ierr)
+
+			continue
+		}
+
+		switch resp.Action {
+		case Action_ACTION_BLOCK:
+			return &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: resp.Rule}, nil
+		case Action_ACTION_ALLOW:
+			return &queryhook.Verdict{Action: queryhook.ActionAllow, Rule: resp.Rule}, nil
+		default:
+			// Go on.
+		}
+	}
+
+	return &queryhook.Verdict{Action: queryhook.ActionPass}, nil
+}
+
+// WantsLogs returns true if any of the running plugins receives the query log
+// entries.
+func (m *Manager) WantsLogs() (ok bool) {
+	for _, p := range m.plugins {
+		if c, info := p.state(); c != nil && info.Log {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Log queues e for sending to the plugins receiving the query log entries.  e
+// is dropped if the queue is full.
+func (m *Manager) Log(e *LogEntry) {
+	select {
+	case m.logs <- e:
+		// Go on.
+	default:
+		log.Debug("plugin: log queue is full, dropping entry")
+	}
+}
+
+// logLoop sends the queued query log entries in batches until m is closed.
+func (m *Manager) logLoop() {
+	defer log.OnPanic("plugin")
+
+	ticker := time.NewTicker(logFlushIvl)
+	defer ticker.Stop()
+
+	batch := make([]*LogEntry, 0, logBatchSize)
+	for {
+		select {
+		case <-m.done:
+			return
+		case e := <-m.logs:
+			batch = append(batch, e)
+			if len(batch) < logBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		m.sendLogs(batch)
+		batch = make([]*LogEntry, 0, logBatchSize)
+	}
+}
+
+// sendLogs sends entries to the running plugins receiving the query log
+// entries.
+func (m *Manager) sendLogs(entries []*LogEntry) {
+	req := &LogRequest{Entries: entries}
+	for _, p := range m.plugins {
+		c, info := p.state()
+		if c == nil || !info.Log {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+		err := c.log(ctx, req)
+		cancel()
+		if err != nil {
+			log.Debug("plugin %q: sending %d log entries: %s", p.conf.Name, len(entries), err)
+		}
+	}
+}
+
+// instance is a configured plugin.
+type instance struct {
+	conf *Config
+
+	// mu protects client and info.
+	mu *sync.RWMutex
+
+	// client is the client of the running plugin.  It's nil if the plugin
+	// isn't running.
+	client *client
+
+	// info is the information about the running plugin.
+	info *InfoResponse
+
+	version string
+	timeout time.Duration
+}
+
+// state returns the client and the information of the running plugin.  c is
+// nil if the plugin isn't running.
+func (p *instance) state() (c *client, info *InfoResponse) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.client, p.info
+}
+
+// setState sets the client and the information of the plugin.
+func (p *instance) setState(c *client, info *InfoResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.client, p.info = c, info
+}
+
+// inspect calls the Inspect method of the plugin using c.
+func (p *instance) inspect(c *client, req *InspectRequest) (resp *InspectResponse, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	return c.inspect(ctx, req)
+}
+
+// supervise runs the plugin and restarts it after a delay when it exits until
+// done is closed.
+func (p *instance) supervise(done <-chan struct{}) {
+	defer log.OnPanic("plugin")
+
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := p.run(done)
+
+		select {
+		case <-done:
+			return
+		default:
+			// Go on.
+		}
+
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		log.Error("plugin %q: %s; restarting in %s", p.conf.Name, err, delay)
+
+		select {
+		case <-done:
+			return
+		case <-time.After(delay):
+			delay *= 2
+			if delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+		}
+	}
+}
+
+// run launches the plugin and waits until it exits or done is closed.
+func (p *instance) run(done <-chan struct{}) (err error) {
+	cmd := exec.Command(p.conf.Command, p.conf.Args...)
+	cmd.Env = append(os.Environ(), EnvPlugin+"=1")
+	cmd.Stderr = os.Stderr
+
+	out := &stdoutWriter{
+		name:       p.conf.Name,
+		handshakes: make(chan string, 1),
+	}
+	cmd.Stdout = out
+
+	// Keep the standard input open until the plugin is stopped, since the
+	// plugin exits when it's closed.
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("getting stdin: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("starting: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		defer log.OnPanic("plugin")
+
+		exited <- cmd.Wait()
+	}()
+
+	kill := func() {
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+
+	var handshake string
+	select {
+	case <-done:
+		kill()
+
+		return nil
+	case err = <-exited:
+		return fmt.Errorf("exited before handshake: %v", err)
+	case <-time.After(handshakeTimeout):
+		kill()
+
+		return fmt.Errorf("no handshake in %s", handshakeTimeout)
+	case handshake = <-out.handshakes:
+		// Go on.
+	}
+
+	c, err := p.connect(handshake)
+	if err != nil {
+		kill()
+
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, c.close()) }()
+	defer p.setState(nil, nil)
+
+	select {
+	case <-done:
+		_ = stdin.Close()
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			kill()
+		}
+
+		return nil
+	case err = <-exited:
+		return fmt.Errorf("exited: %v", err)
+	}
+}
+
+// connect connects to the plugin which has sent the handshake line and gets
+// the information about it.
+func (p *instance) connect(handshake string) (c *client, err error) {
+	c, err = newClient(handshake)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
+
+	info, err := c.info(ctx, &InfoRequest{Version: p.version})
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("getting info: %w", err), c.close())
+	}
+
+	p.setState(c, info)
+
+	log.Info(
+		"plugin %q: connected to %q, inspect: %t, log: %t",
+		p.conf.Name,
+		info.Name,
+		info.Inspect,
+		info.Log,
+	)
+
+	return c, nil
+}
+
+// stdoutWriter is the standard output of the plugin.  It sends the first line
+// into handshakes and logs the rest.
+type stdoutWriter struct {
+	handshakes chan string
+	name       string
+	buf        []byte
+	sent       bool
+}
+
+// Write implements the [io.Writer] interface for *stdoutWriter.
+func (w *stdoutWriter) Write(b []byte) (n int, err error) {
+	n = len(b)
+	if w.sent {
+		log.Debug("plugin %q: %s", w.name, bytes.TrimSpace(b))
+
+		return n, nil
+	}
+
+	w.buf = append(w.buf, b...)
+	i := bytes.IndexByte(w.buf, '\n')
+	if i < 0 {
+		if len(w.buf) > maxHandshakeLen {
+			// Send the malformed line to report it.
+			i = maxHandshakeLen
+		} else {
+			return n, nil
+		}
+	}
+
+	w.sent = true
+	w.handshakes <- string(w.buf[:i])
+	w.buf = nil
+
+	return n, nil
+}
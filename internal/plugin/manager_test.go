@@ -0,0 +1,203 @@
+package plugin_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/plugin"
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperEnv is the environment variable making the test binary act as the
+// plugin.
+const helperEnv = "AGH_PLUGIN_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) == "1" && os.Getenv(plugin.EnvPlugin) == "1" {
+		err := plugin.Serve(&testServer{})
+		if err != nil {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// testServer is the plugin used in tests.  It blocks the domain
+// "block.example", allows the domain "allow.example", and fails for
+// "bad.example".
+type testServer struct {
+	plugin.UnimplementedPluginServer
+}
+
+// Info implements the [plugin.PluginServer] interface for *testServer.
+func (s *testServer) Info(
+	_ context.Context,
+	req *plugin.InfoRequest,
+) (resp *plugin.InfoResponse, err error) {
+	return &plugin.InfoResponse{
+		Name:    "test " + req.Version,
+		Inspect: true,
+	}, nil
+}
+
+// Inspect implements the [plugin.PluginServer] interface for *testServer.
+func (s *testServer) Inspect(
+	_ context.Context,
+	req *plugin.InspectRequest,
+) (resp *plugin.InspectResponse, err error) {
+	switch req.Domain {
+	case "block.example":
+		return &plugin.InspectResponse{
+			Action: plugin.Action_ACTION_BLOCK,
+			Rule:   "blocked by " + req.ClientIp,
+		}, nil
+	case "allow.example":
+		return &plugin.InspectResponse{Action: plugin.Action_ACTION_ALLOW}, nil
+	case "bad.example":
+		return nil, assert.AnError
+	default:
+		return &plugin.InspectResponse{Action: plugin.Action_ACTION_PASS}, nil
+	}
+}
+
+func TestManager_Decide(t *testing.T) {
+	t.Setenv(helperEnv, "1")
+
+	confs := []*plugin.Config{{
+		Name:    "test",
+		Command: os.Args[0],
+		Timeout: timeutil.Duration{Duration: 1 * time.Second},
+		Enabled: true,
+	}, {
+		Name:    "disabled",
+		Command: "/nonexisting",
+		Enabled: false,
+	}}
+	require.NoError(t, plugin.ValidateConfigs(confs))
+
+	m := plugin.NewManager(&plugin.ManagerConfig{
+		Version: "v0.0.0",
+		Plugins: confs,
+	})
+	require.Equal(t, 1, m.Len())
+
+	m.Start()
+	testutil.CleanupAndRequireSuccess(t, m.Close)
+
+	// Wait for the plugin to start.
+	require.Eventually(t, func() (ok bool) {
+		v, err := m.Decide(&queryhook.Query{Domain: "allow.example"})
+
+		return err == nil && v.Action == queryhook.ActionAllow
+	}, 10*time.Second, 50*time.Millisecond)
+
+	testCases := []struct {
+		want   *queryhook.Verdict
+		name   string
+		domain string
+	}{{
+		want:   &queryhook.Verdict{Action: queryhook.ActionPass},
+		name:   "pass",
+		domain: "pass.example",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: "blocked by 1.2.3.4"},
+		name:   "block",
+		domain: "block.example",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionAllow},
+		name:   "allow",
+		domain: "allow.example",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionPass},
+		name:   "error",
+		domain: "bad.example",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := m.Decide(&queryhook.Query{
+				ClientIP: "1.2.3.4",
+				Domain:   tc.domain,
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, v)
+		})
+	}
+
+	// The plugin doesn't receive the query log entries.
+	assert.False(t, m.WantsLogs())
+}
+
+func TestManager_Decide_notRunning(t *testing.T) {
+	m := plugin.NewManager(&plugin.ManagerConfig{
+		Plugins: []*plugin.Config{{
+			Name:    "test",
+			Command: "/nonexisting",
+			Enabled: true,
+		}},
+	})
+
+	m.Start()
+	testutil.CleanupAndRequireSuccess(t, m.Close)
+
+	v, err := m.Decide(&queryhook.Query{Domain: "block.example"})
+	require.NoError(t, err)
+
+	assert.Equal(t, queryhook.ActionPass, v.Action)
+}
+
+func TestValidateConfigs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*plugin.Config
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		confs: []*plugin.Config{{
+			Name:    "a",
+			Command: "/a",
+		}, {
+			Name:    "b",
+			Command: "/b",
+		}},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "plugin at index 0: name: empty",
+		confs: []*plugin.Config{{
+			Command: "/a",
+		}},
+	}, {
+		name:       "no_command",
+		wantErrMsg: "plugin at index 0: command: empty",
+		confs: []*plugin.Config{{
+			Name: "a",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `plugin at index 1: duplicate name "a"`,
+		confs: []*plugin.Config{{
+			Name:    "a",
+			Command: "/a",
+		}, {
+			Name:    "a",
+			Command: "/b",
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, plugin.ValidateConfigs(tc.confs))
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package plugin contains the protocol of the external plugins and the manager
+// running them.  The plugins are separate programs communicating with AdGuard
+// Home over gRPC, which lets the integrations inspect the queries, override
+// the filtering decisions, and receive the query log entries without forking
+// AdGuard Home.  See plugin.proto for the description of the protocol.
+//
+// The messages and the service code are generated from plugin.proto with
+// protoc-gen-go v1.30.0 and protoc-gen-go-grpc v1.3.0, which must match the
+// versions of google.golang.org/protobuf and google.golang.org/grpc in go.mod.
+package plugin
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative plugin.proto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+)
+
+// Handshake parameters.  See plugin.proto.
+const (
+	// EnvPlugin is the environment variable set to "1" for the plugins
+	// started by AdGuard Home.
+	EnvPlugin = "ADGUARDHOME_PLUGIN"
+
+	// handshakePrefix is the prefix of the handshake line.
+	handshakePrefix = "adguardhome-plugin"
+
+	// ProtocolVersion is the version of the plugin protocol.
+	ProtocolVersion = 1
+)
+
+// Serve is the helper for the plugins written in Go.  It starts serving srv on
+// a random local TCP port, prints the handshake line to the standard output,
+// and returns when the standard input is closed.  srv should embed
+// [UnimplementedPluginServer] to only implement some of the methods.
+func Serve(srv PluginServer) (err error) {
+	return serve(srv, os.Stdin, os.Stdout)
+}
+
+// serve serves srv until stdin is closed.  The handshake line is written into
+// stdout.
+func serve(srv PluginServer, stdin io.Reader, stdout io.Writer) (err error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	s := grpc.NewServer()
+	RegisterPluginServer(s, srv)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Serve(l) }()
+
+	_, err = fmt.Fprintf(stdout, "%s|%d|tcp|%s\n", handshakePrefix, ProtocolVersion, l.Addr())
+	if err != nil {
+		s.Stop()
+
+		return fmt.Errorf("writing handshake: %w", err)
+	}
+
+	go func() {
+		// Wait for the host to close the standard input.
+		_, _ = io.Copy(io.Discard, bufio.NewReader(stdin))
+		s.GracefulStop()
+	}()
+
+	return <-errCh
+}
@@ -0,0 +1,493 @@
+package queryhook
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Expressions
+//
+// The grammar of the expressions in EBNF:
+//
+//	expr    = and { "||" and } .
+//	and     = not { "&&" not } .
+//	not     = "!" not | primary .
+//	primary = "(" expr ")" | "filtered" | field op operand .
+//	field   = "client_id" | "client_ip" | "domain" | "qtype" | "reason" | "rule" .
+//	op      = "==" | "!=" | "=~" | "in" .
+//	operand = string | "[" [ string { "," string } ] "]" .
+//
+// The strings are Go string literals, either interpreted or raw.  The
+// comparisons are case-insensitive.  The operand of "=~" is a regular
+// expression and the operand of "in" is a list.  For "client_ip", the items of
+// the list are IP addresses or CIDR prefixes, and for "domain", the list
+// matches the domain names and their subdomains.
+
+// exprFields are the getters of the query fields available to the expressions
+// by their names.
+var exprFields = map[string]func(q *Query) (s string){
+	"client_id": func(q *Query) (s string) { return q.ClientID },
+	"client_ip": func(q *Query) (s string) { return q.ClientIP },
+	"domain":    func(q *Query) (s string) { return q.Domain },
+	"qtype":     func(q *Query) (s string) { return q.QType },
+	"reason":    func(q *Query) (s string) { return q.Reason },
+	"rule":      func(q *Query) (s string) { return q.Rule },
+}
+
+// exprNode is a node of a compiled expression.
+type exprNode interface {
+	// eval returns true if q matches the node.
+	eval(q *Query) (ok bool)
+}
+
+// orExpr matches the queries matching any of the nodes.
+type orExpr []exprNode
+
+// eval implements the exprNode interface for orExpr.
+func (e orExpr) eval(q *Query) (ok bool) {
+	for _, n := range e {
+		if n.eval(q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// andExpr matches the queries matching all of the nodes.
+type andExpr []exprNode
+
+// eval implements the exprNode interface for andExpr.
+func (e andExpr) eval(q *Query) (ok bool) {
+	for _, n := range e {
+		if !n.eval(q) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notExpr matches the queries not matching the node.
+type notExpr struct {
+	node exprNode
+}
+
+// eval implements the exprNode interface for notExpr.
+func (e notExpr) eval(q *Query) (ok bool) {
+	return !e.node.eval(q)
+}
+
+// filteredExpr matches the queries AdGuard Home is going to block.
+type filteredExpr struct{}
+
+// eval implements the exprNode interface for filteredExpr.
+func (filteredExpr) eval(q *Query) (ok bool) {
+	return q.Filtered
+}
+
+// cmpExpr compares a field of the query with the operand.
+type cmpExpr struct {
+	// value returns the value of the field.
+	value func(q *Query) (s string)
+
+	// re is the operand of "=~".
+	re *regexp.Regexp
+
+	// op is the operator.
+	op string
+
+	// str is the operand of "==" and "!=".
+	str string
+
+	// list is the lowercased operand of "in" for all fields except
+	// "client_ip".
+	list []string
+
+	// nets is the operand of "in" for "client_ip".
+	nets []netip.Prefix
+
+	// isDomain is true if the field is "domain".
+	isDomain bool
+}
+
+// eval implements the exprNode interface for *cmpExpr.
+func (e *cmpExpr) eval(q *Query) (ok bool) {
+	v := e.value(q)
+	switch e.op {
+	case "==":
+		return strings.EqualFold(v, e.str)
+	case "!=":
+		return !strings.EqualFold(v, e.str)
+	case "=~":
+		return e.re.MatchString(v)
+	default:
+		return e.in(v)
+	}
+}
+
+// in returns true if v is in the list operand.
+func (e *cmpExpr) in(v string) (ok bool) {
+	if e.nets != nil {
+		ip, err := netip.ParseAddr(v)
+		if err != nil {
+			return false
+		}
+
+		ip = ip.Unmap()
+		for _, n := range e.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	v = strings.ToLower(v)
+	for _, item := range e.list {
+		if v == item || (e.isDomain && strings.HasSuffix(v, "."+item)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exprToken is a token of an expression.
+type exprToken struct {
+	// text is the text of the token.  It's empty at the end of the
+	// expression.
+	text string
+
+	// kind is the kind of the token as returned by [scanner.Scanner.Scan].
+	kind rune
+
+	// offset is the offset of the token within the expression.
+	offset int
+}
+
+// exprParser is a recursive descent parser of the expressions.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// compileExpr compiles the expression s.
+func compileExpr(s string) (n exprNode, err error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	n, err = p.or()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != scanner.EOF {
+		return nil, p.unexpected(t)
+	}
+
+	return n, nil
+}
+
+// tokenizeExpr splits s into tokens.  The returned slice always ends with an
+// EOF token.
+func tokenizeExpr(s string) (tokens []exprToken, err error) {
+	sc := &scanner.Scanner{}
+	sc.Init(strings.NewReader(s))
+	sc.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings
+	sc.Error = func(s *scanner.Scanner, msg string) {
+		if err == nil {
+			err = fmt.Errorf("at offset %d: %s", s.Position.Offset, msg)
+		}
+	}
+
+	for {
+		kind := sc.Scan()
+		t := exprToken{
+			text:   sc.TokenText(),
+			kind:   kind,
+			offset: sc.Position.Offset,
+		}
+
+		switch kind {
+		case scanner.EOF:
+			t.text = ""
+
+			return append(tokens, t), err
+		case '=', '!', '&', '|':
+			if next := sc.Peek(); isOperatorPair(kind, next) {
+				t.text += string(sc.Next())
+			}
+		}
+
+		tokens = append(tokens, t)
+	}
+}
+
+// isOperatorPair returns true if first and second form a two-character
+// operator.
+func isOperatorPair(first, second rune) (ok bool) {
+	switch first {
+	case '=':
+		return second == '=' || second == '~'
+	case '!':
+		return second == '='
+	case '&', '|':
+		return second == first
+	default:
+		return false
+	}
+}
+
+// peek returns the current token.
+func (p *exprParser) peek() (t exprToken) {
+	return p.tokens[p.pos]
+}
+
+// next returns the current token and advances to the next one.
+func (p *exprParser) next() (t exprToken) {
+	t = p.tokens[p.pos]
+	if t.kind != scanner.EOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// unexpected returns an error about the unexpected token t.
+func (p *exprParser) unexpected(t exprToken) (err error) {
+	if t.kind == scanner.EOF {
+		return errors.Error("unexpected end of expression")
+	}
+
+	return fmt.Errorf("at offset %d: unexpected %q", t.offset, t.text)
+}
+
+// or parses the expr production.
+func (p *exprParser) or() (n exprNode, err error) {
+	n, err = p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := orExpr{n}
+	for p.peek().text == "||" {
+		p.next()
+
+		n, err = p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+// and parses the and production.
+func (p *exprParser) and() (n exprNode, err error) {
+	n, err = p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := andExpr{n}
+	for p.peek().text == "&&" {
+		p.next()
+
+		n, err = p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+// not parses the not production.
+func (p *exprParser) not() (n exprNode, err error) {
+	if p.peek().text != "!" {
+		return p.primary()
+	}
+
+	p.next()
+
+	n, err = p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	return notExpr{node: n}, nil
+}
+
+// primary parses the primary production.
+func (p *exprParser) primary() (n exprNode, err error) {
+	t := p.next()
+	switch {
+	case t.text == "(":
+		n, err = p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if t = p.next(); t.text != ")" {
+			return nil, p.unexpected(t)
+		}
+
+		return n, nil
+	case t.text == "filtered":
+		return filteredExpr{}, nil
+	case t.kind == scanner.Ident:
+		return p.comparison(t)
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// comparison parses the rest of the comparison of the field.
+func (p *exprParser) comparison(field exprToken) (n exprNode, err error) {
+	value, ok := exprFields[field.text]
+	if !ok {
+		return nil, fmt.Errorf("at offset %d: unknown field %q", field.offset, field.text)
+	}
+
+	e := &cmpExpr{
+		value:    value,
+		isDomain: field.text == "domain",
+	}
+
+	op := p.next()
+	e.op = op.text
+	switch e.op {
+	case "==", "!=":
+		e.str, err = p.str()
+	case "=~":
+		var re string
+		re, err = p.str()
+		if err != nil {
+			break
+		}
+
+		e.re, err = regexp.Compile("(?i)" + re)
+		if err != nil {
+			err = fmt.Errorf("at offset %d: %w", op.offset, err)
+		}
+	case "in":
+		err = p.list(e, field.text == "client_ip")
+	default:
+		return nil, p.unexpected(op)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// str parses a string.
+func (p *exprParser) str() (s string, err error) {
+	t := p.next()
+	if t.kind != scanner.String && t.kind != scanner.RawString {
+		return "", p.unexpected(t)
+	}
+
+	s, err = strconv.Unquote(t.text)
+	if err != nil {
+		return "", fmt.Errorf("at offset %d: %w", t.offset, err)
+	}
+
+	return s, nil
+}
+
+// list parses the list operand of e.  If isIP is true, the items are parsed as
+// IP addresses or CIDR prefixes.
+func (p *exprParser) list(e *cmpExpr, isIP bool) (err error) {
+	if t := p.next(); t.text != "[" {
+		return p.unexpected(t)
+	}
+
+	if isIP {
+		e.nets = []netip.Prefix{}
+	}
+
+	for p.peek().text != "]" {
+		if len(e.list)+len(e.nets) > 0 {
+			if t := p.next(); t.text != "," {
+				return p.unexpected(t)
+			}
+		}
+
+		offset := p.peek().offset
+
+		var item string
+		item, err = p.str()
+		if err != nil {
+			return err
+		}
+
+		if !isIP {
+			e.list = append(e.list, strings.ToLower(strings.TrimSuffix(item, ".")))
+
+			continue
+		}
+
+		var n netip.Prefix
+		n, err = parseNet(item)
+		if err != nil {
+			return fmt.Errorf("at offset %d: %w", offset, err)
+		}
+
+		e.nets = append(e.nets, n)
+	}
+
+	p.next()
+
+	return nil
+}
+
+// parseNet parses s as either a CIDR prefix or a single IP address.
+func parseNet(s string) (n netip.Prefix, err error) {
+	if strings.Contains(s, "/") {
+		n, err = netip.ParsePrefix(s)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return netip.Prefix{}, err
+		}
+
+		return n.Masked(), nil
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return netip.Prefix{}, err
+	}
+
+	ip = ip.Unmap()
+
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
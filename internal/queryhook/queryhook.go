@@ -0,0 +1,521 @@
+// Package queryhook contains the hook evaluating expressions and running an
+// external program to override the filtering decisions for advanced policies
+// the filtering rule syntax can't express.
+//
+// The expressions are evaluated in order for each query, and the first one
+// matching it decides.  See the grammar in expr.go.  The policies the
+// expressions can't express should be implemented within the program, which may
+// be written in any language.  Embedded Lua isn't supported.
+//
+// Several instances of the program are kept running, and each of them handles
+// one query at a time.  For each query no expression has matched, an instance
+// receives a single line with a JSON-encoded [Query] on its standard input and
+// must respond with a single line with a JSON-encoded [Verdict] on its standard
+// output within the timeout.  An instance is restarted if it fails to do so.
+// If all the instances are busy, the query waits for one of them for at most
+// the timeout.  If the program can't be queried, the failure action is taken,
+// which blocks the query by default, so that flooding the program doesn't
+// bypass its policy.
+package queryhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// DefaultTimeout is the default timeout of a single query to the program.
+const DefaultTimeout = 100 * time.Millisecond
+
+// DefaultProcesses is the default number of the running instances of the
+// program.
+const DefaultProcesses = 4
+
+// maxProcesses is the maximum number of the running instances of the program.
+const maxProcesses = 64
+
+// restartDelay is the minimum duration between the failure of the program and
+// its restart.  Until then, queries aren't sent to the program.
+const restartDelay = 5 * time.Second
+
+// maxLineLen is the maximum length of a response line.
+const maxLineLen = 4096
+
+// Query is the information about a DNS query sent to the program.
+type Query struct {
+	// ClientIP is the IP address of the client.
+	ClientIP string `json:"client_ip"`
+
+	// ClientID is the ClientID of the client, if any.
+	ClientID string `json:"client_id"`
+
+	// Domain is the queried domain name without the trailing dot.
+	Domain string `json:"domain"`
+
+	// QType is the type of the question, for example "A".
+	QType string `json:"qtype"`
+
+	// Reason is the reason of the filtering decision made by AdGuard Home.
+	Reason string `json:"reason"`
+
+	// Rule is the text of the rule which has matched the query, if any.
+	Rule string `json:"rule"`
+
+	// Filtered is true if the query is going to be blocked.
+	Filtered bool `json:"filtered"`
+}
+
+// Action is the action the program requests to be taken on a query.
+type Action string
+
+// Valid actions.
+const (
+	// ActionPass keeps the decision made by AdGuard Home.
+	ActionPass Action = "pass"
+
+	// ActionBlock blocks the query.
+	ActionBlock Action = "block"
+
+	// ActionAllow lets the query through regardless of the filtering rules.
+	ActionAllow Action = "allow"
+)
+
+// Verdict is the response of the program.
+type Verdict struct {
+	// Action is the action to take on the query.
+	Action Action `json:"action"`
+
+	// Rule is the optional description of the decision shown in the query
+	// log.
+	Rule string `json:"rule"`
+}
+
+// validate returns an error if v isn't valid.
+func (v *Verdict) validate() (err error) {
+	switch v.Action {
+	case ActionPass, ActionBlock, ActionAllow:
+		return nil
+	default:
+		return fmt.Errorf("bad action %q", v.Action)
+	}
+}
+
+// Expression is an expression deciding on the queries it matches.
+type Expression struct {
+	// Match is the expression, for example:
+	//
+	//	domain in ["example.com"] && qtype == "AAAA"
+	//
+	Match string `yaml:"match"`
+
+	// Action is the action to take on the matching queries.
+	Action Action `yaml:"action"`
+
+	// Rule is the optional description of the decision shown in the query
+	// log.  If empty, Match is used.
+	Rule string `yaml:"rule"`
+}
+
+// validate returns an error if e isn't valid.
+func (e *Expression) validate() (err error) {
+	_, err = compileExpr(e.Match)
+	if err != nil {
+		return fmt.Errorf("match: %w", err)
+	}
+
+	err = (&Verdict{Action: e.Action}).validate()
+	if err != nil {
+		return fmt.Errorf("action: %w", err)
+	}
+
+	return nil
+}
+
+// Config is the configuration of the query hook.
+type Config struct {
+	// Expressions are evaluated in order before the program is queried.
+	Expressions []*Expression `yaml:"expressions"`
+
+	// Command is the path to the program.  If empty, only Expressions are
+	// used.
+	Command string `yaml:"command"`
+
+	// OnFailure is the action taken when the program can't be queried, for
+	// example when all its instances stay busy for the timeout.  It's either
+	// [ActionBlock] or [ActionPass].  If empty, [ActionBlock] is used.
+	OnFailure Action `yaml:"on_failure"`
+
+	// Args are the arguments of the program.
+	Args []string `yaml:"args"`
+
+	// Timeout is the maximum duration of a single query to the program as
+	// well as of the wait for an idle instance.  If the program doesn't
+	// respond in time, the failure action is taken and the program is
+	// restarted.  If zero, [DefaultTimeout] is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// Processes is the number of the instances of the program handling the
+	// queries concurrently.  If zero, [DefaultProcesses] is used.
+	Processes int `yaml:"processes"`
+
+	// Enabled defines if the hook is used.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if the enabled hook configuration isn't valid.
+func (c *Config) Validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Command == "" && len(c.Expressions) == 0 {
+		return errors.Error("command: empty with no expressions")
+	} else if c.Timeout.Duration < 0 {
+		return fmt.Errorf("timeout: negative value %s", c.Timeout)
+	} else if c.Processes < 0 || c.Processes > maxProcesses {
+		return fmt.Errorf("processes: must be from 0 to %d, got %d", maxProcesses, c.Processes)
+	}
+
+	switch c.OnFailure {
+	case "", ActionBlock, ActionPass:
+		// Go on.
+	default:
+		return fmt.Errorf("on_failure: bad action %q", c.OnFailure)
+	}
+
+	for i, e := range c.Expressions {
+		if e == nil {
+			return fmt.Errorf("expressions: at index %d: no expression", i)
+		}
+
+		err = e.validate()
+		if err != nil {
+			return fmt.Errorf("expressions: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// expression is a compiled [Expression].
+type expression struct {
+	node   exprNode
+	action Action
+	rule   string
+}
+
+// Hook evaluates the expressions and sends the queries to the instances of the
+// program and receives their verdicts.
+type Hook struct {
+	// idle are the instances not handling a query at the moment.
+	idle chan *instance
+
+	// exprs are the compiled expressions.
+	exprs []*expression
+
+	// instances are all the instances of the program.  It's empty if there
+	// is no program.
+	instances []*instance
+
+	command   string
+	onFailure Action
+	args      []string
+	timeout   time.Duration
+}
+
+// instance is a single instance of the program.
+type instance struct {
+	// mu protects all the fields below it.  It's only contended by
+	// [Hook.Close], since an instance handles a single query at a time.
+	mu *sync.Mutex
+
+	// proc is the running program.  It's nil if the program isn't running.
+	proc *process
+
+	// failedAt is the time of the last failure of the program.
+	failedAt time.Time
+
+	// closed is true if the hook has been closed.
+	closed bool
+}
+
+// New returns a new *Hook.  c must be valid, see [Config.Validate].  The
+// instances of the program are started on the first queries they handle.
+func New(c *Config) (h *Hook, err error) {
+	timeout := c.Timeout.Duration
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	n := c.Processes
+	if c.Command == "" {
+		n = 0
+	} else if n == 0 {
+		n = DefaultProcesses
+	}
+
+	onFailure := c.OnFailure
+	if onFailure == "" {
+		onFailure = ActionBlock
+	}
+
+	h = &Hook{
+		idle:      make(chan *instance, n),
+		exprs:     make([]*expression, 0, len(c.Expressions)),
+		instances: make([]*instance, n),
+		command:   c.Command,
+		onFailure: onFailure,
+		args:      c.Args,
+		timeout:   timeout,
+	}
+
+	for i, e := range c.Expressions {
+		var node exprNode
+		node, err = compileExpr(e.Match)
+		if err != nil {
+			return nil, fmt.Errorf("expressions: at index %d: %w", i, err)
+		}
+
+		rule := e.Rule
+		if rule == "" {
+			rule = e.Match
+		}
+
+		h.exprs = append(h.exprs, &expression{
+			node:   node,
+			action: e.Action,
+			rule:   rule,
+		})
+	}
+
+	for i := range h.instances {
+		inst := &instance{
+			mu: &sync.Mutex{},
+		}
+
+		h.instances[i] = inst
+		h.idle <- inst
+	}
+
+	return h, nil
+}
+
+// Decide returns the verdict of the first expression matching q or, if there
+// is none, sends q to an idle instance of the program and returns its verdict.
+// If the program couldn't be queried and the failure action is [ActionPass],
+// err is not nil and the decision made by AdGuard Home should be kept.
+// Otherwise, the failure is described in the rule of the blocking verdict.  It
+// is safe for concurrent use.
+func (h *Hook) Decide(q *Query) (v *Verdict, err error) {
+	for _, e := range h.exprs {
+		if e.node.eval(q) {
+			return &Verdict{Action: e.action, Rule: e.rule}, nil
+		}
+	}
+
+	if len(h.instances) == 0 {
+		return &Verdict{Action: ActionPass}, nil
+	}
+
+	v, err = h.ask(q)
+	if err == nil || h.onFailure == ActionPass {
+		return v, err
+	}
+
+	log.Debug("queryhook: blocking %q: %s", q.Domain, err)
+
+	return &Verdict{
+		Action: ActionBlock,
+		Rule:   fmt.Sprintf("query hook failed: %s", err),
+	}, nil
+}
+
+// ask sends q to an idle instance of the program and returns its verdict.  If
+// all the instances are busy, it waits for one of them for at most the
+// timeout.
+func (h *Hook) ask(q *Query) (v *Verdict, err error) {
+	waitTimer := time.NewTimer(h.timeout)
+	defer waitTimer.Stop()
+
+	var inst *instance
+	select {
+	case inst = <-h.idle:
+		defer func() { h.idle <- inst }()
+	case <-waitTimer.C:
+		return nil, errors.Error("all programs are busy")
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if inst.closed {
+		return nil, errors.Error("hook is closed")
+	}
+
+	if inst.proc == nil {
+		if time.Since(inst.failedAt) < restartDelay {
+			return nil, errors.Error("program is not running")
+		}
+
+		inst.proc, err = start(h.command, h.args)
+		if err != nil {
+			inst.failedAt = time.Now()
+
+			return nil, fmt.Errorf("starting program: %w", err)
+		}
+	}
+
+	type result struct {
+		v   *Verdict
+		err error
+	}
+
+	resCh := make(chan result, 1)
+	proc := inst.proc
+	go func() {
+		defer log.OnPanic("queryhook")
+
+		rv, rerr := proc.exchange(q)
+		resCh <- result{v: rv, err: rerr}
+	}()
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-resCh:
+		if res.err != nil {
+			inst.stop()
+		}
+
+		return res.v, res.err
+	case <-timer.C:
+		inst.stop()
+
+		return nil, fmt.Errorf("no response in %s", h.timeout)
+	}
+}
+
+// stop stops the program after a failure.  inst.mu must be locked.
+func (inst *instance) stop() {
+	inst.failedAt = time.Now()
+	inst.proc.kill()
+	inst.proc = nil
+}
+
+// Close stops all the instances of the program.  It waits for the queries
+// being handled to finish.
+func (h *Hook) Close() (err error) {
+	for _, inst := range h.instances {
+		inst.mu.Lock()
+		inst.closed = true
+		if inst.proc != nil {
+			inst.proc.kill()
+			inst.proc = nil
+		}
+		inst.mu.Unlock()
+	}
+
+	return nil
+}
+
+// process is the running program.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+}
+
+// start starts the program.
+func start(command string, args []string) (p *process, err error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("getting stdin: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("getting stdout: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	log.Info("queryhook: started %q with pid %d", command, cmd.Process.Pid)
+
+	s := bufio.NewScanner(stdout)
+	s.Buffer(make([]byte, 0, maxLineLen), maxLineLen)
+
+	return &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: s,
+	}, nil
+}
+
+// exchange writes q into the program's input and reads the verdict from its
+// output.
+func (p *process) exchange(q *Query) (v *Verdict, err error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, fmt.Errorf("encoding query: %w", err)
+	}
+
+	_, err = p.stdin.Write(append(data, '\n'))
+	if err != nil {
+		return nil, fmt.Errorf("writing query: %w", err)
+	}
+
+	if !p.stdout.Scan() {
+		err = p.stdout.Err()
+		if err == nil {
+			err = io.EOF
+		}
+
+		return nil, fmt.Errorf("reading verdict: %w", err)
+	}
+
+	v = &Verdict{}
+	err = json.Unmarshal(p.stdout.Bytes(), v)
+	if err != nil {
+		return nil, fmt.Errorf("decoding verdict: %w", err)
+	}
+
+	err = v.validate()
+	if err != nil {
+		return nil, fmt.Errorf("verdict: %w", err)
+	}
+
+	return v, nil
+}
+
+// kill kills the program and waits for it to exit in a separate goroutine.
+func (p *process) kill() {
+	err := p.cmd.Process.Kill()
+	if err != nil {
+		log.Debug("queryhook: killing program: %s", err)
+	}
+
+	go func() {
+		defer log.OnPanic("queryhook")
+
+		// Wait also closes the pipes.  Ignore the error since the program has
+		// been killed.
+		_ = p.cmd.Wait()
+	}()
+}
@@ -0,0 +1,429 @@
+package queryhook_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/queryhook"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperEnv is the environment variable making the test binary act as the
+// hook program.
+const helperEnv = "AGH_QUERYHOOK_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) == "1" {
+		runHelper()
+
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// runHelper is the hook program used in tests.  It blocks the domain
+// "block.example", allows the domain "allow.example", responds in 100ms for
+// "delay.example", doesn't respond in time for "slow.example", and responds with
+// garbage for "bad.example".
+func runHelper() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		q := &queryhook.Query{}
+		err := json.Unmarshal(s.Bytes(), q)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		v := &queryhook.Verdict{Action: queryhook.ActionPass}
+		switch q.Domain {
+		case "block.example":
+			v = &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: "blocked by " + q.ClientIP}
+		case "allow.example":
+			v = &queryhook.Verdict{Action: queryhook.ActionAllow}
+		case "delay.example":
+			time.Sleep(100 * time.Millisecond)
+		case "slow.example":
+			time.Sleep(1 * time.Second)
+		case "bad.example":
+			_, _ = fmt.Println("not json")
+
+			continue
+		}
+
+		data, _ := json.Marshal(v)
+		_, _ = fmt.Println(string(data))
+	}
+}
+
+// newHook returns a new hook running procs instances of the test binary as the
+// program and taking the onFailure action when it can't be queried.
+func newHook(t *testing.T, procs int, onFailure queryhook.Action) (h *queryhook.Hook) {
+	t.Helper()
+
+	t.Setenv(helperEnv, "1")
+
+	c := &queryhook.Config{
+		Command:   os.Args[0],
+		OnFailure: onFailure,
+		Timeout:   timeutil.Duration{Duration: 500 * time.Millisecond},
+		Processes: procs,
+		Enabled:   true,
+	}
+	require.NoError(t, c.Validate())
+
+	h, err := queryhook.New(c)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, h.Close)
+
+	return h
+}
+
+func TestHook_Decide(t *testing.T) {
+	h := newHook(t, 0, "")
+
+	testCases := []struct {
+		want   *queryhook.Verdict
+		domain string
+		name   string
+	}{{
+		want:   &queryhook.Verdict{Action: queryhook.ActionPass},
+		domain: "pass.example",
+		name:   "pass",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: "blocked by 192.0.2.1"},
+		domain: "block.example",
+		name:   "block",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionAllow},
+		domain: "allow.example",
+		name:   "allow",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := h.Decide(&queryhook.Query{
+				ClientIP: "192.0.2.1",
+				Domain:   tc.domain,
+				QType:    "A",
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, v)
+		})
+	}
+}
+
+func TestHook_Decide_failure(t *testing.T) {
+	testCases := []struct {
+		name       string
+		domain     string
+		wantErrMsg string
+	}{{
+		name:       "timeout",
+		domain:     "slow.example",
+		wantErrMsg: "no response in 500ms",
+	}, {
+		name:       "bad_response",
+		domain:     "bad.example",
+		wantErrMsg: "decoding verdict: invalid character 'o' in literal null (expecting 'u')",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newHook(t, 1, queryhook.ActionPass)
+
+			_, err := h.Decide(&queryhook.Query{Domain: tc.domain})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			// The program isn't restarted immediately.
+			_, err = h.Decide(&queryhook.Query{Domain: "pass.example"})
+			testutil.AssertErrorMsg(t, "program is not running", err)
+		})
+	}
+}
+
+func TestHook_Decide_failClosed(t *testing.T) {
+	h := newHook(t, 1, "")
+
+	v, err := h.Decide(&queryhook.Query{Domain: "bad.example"})
+	require.NoError(t, err)
+
+	assert.Equal(t, &queryhook.Verdict{
+		Action: queryhook.ActionBlock,
+		Rule:   "query hook failed: decoding verdict: invalid character 'o' in literal null (expecting 'u')",
+	}, v)
+
+	v, err = h.Decide(&queryhook.Query{Domain: "pass.example"})
+	require.NoError(t, err)
+
+	assert.Equal(t, &queryhook.Verdict{
+		Action: queryhook.ActionBlock,
+		Rule:   "query hook failed: program is not running",
+	}, v)
+}
+
+func TestHook_Decide_concurrent(t *testing.T) {
+	const procs = 4
+
+	h := newHook(t, procs, "")
+
+	// Make sure all the instances are started.
+	for i := 0; i < procs; i++ {
+		_, err := h.Decide(&queryhook.Query{Domain: "pass.example"})
+		require.NoError(t, err)
+	}
+
+	wg := &sync.WaitGroup{}
+	errs := make([]error, procs)
+	for i := 0; i < procs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, errs[i] = h.Decide(&queryhook.Query{Domain: "allow.example"})
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestHook_Decide_busy(t *testing.T) {
+	testCases := []struct {
+		want   *queryhook.Verdict
+		name   string
+		domain string
+	}{{
+		want:   &queryhook.Verdict{Action: queryhook.ActionAllow},
+		name:   "wait",
+		domain: "delay.example",
+	}, {
+		want:   &queryhook.Verdict{Action: queryhook.ActionBlock},
+		name:   "fail_closed",
+		domain: "slow.example",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newHook(t, 1, "")
+
+			// Start the program.
+			_, err := h.Decide(&queryhook.Query{Domain: "pass.example"})
+			require.NoError(t, err)
+
+			busyCh := make(chan struct{})
+			go func() {
+				defer close(busyCh)
+
+				_, _ = h.Decide(&queryhook.Query{Domain: tc.domain})
+			}()
+
+			// Let the first query occupy the only instance.
+			time.Sleep(20 * time.Millisecond)
+
+			v, err := h.Decide(&queryhook.Query{Domain: "allow.example"})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want.Action, v.Action)
+
+			<-busyCh
+		})
+	}
+}
+
+func TestHook_Decide_expressions(t *testing.T) {
+	c := &queryhook.Config{
+		Expressions: []*queryhook.Expression{{
+			Match:  `client_ip in ["192.0.2.0/24", "2001:db8::1"] && domain in ["example.com"]`,
+			Action: queryhook.ActionAllow,
+			Rule:   "vip",
+		}, {
+			Match:  `qtype == "aaaa" && !(domain =~ "^ipv6\\.")`,
+			Action: queryhook.ActionBlock,
+		}, {
+			Match:  `filtered && (reason == "FilteredBlockList" || client_id != "")`,
+			Action: queryhook.ActionPass,
+			Rule:   "keep",
+		}},
+		Enabled: true,
+	}
+	require.NoError(t, c.Validate())
+
+	h, err := queryhook.New(c)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, h.Close)
+
+	testCases := []struct {
+		want *queryhook.Verdict
+		q    *queryhook.Query
+		name string
+	}{{
+		want: &queryhook.Verdict{Action: queryhook.ActionAllow, Rule: "vip"},
+		q: &queryhook.Query{
+			ClientIP: "192.0.2.1",
+			Domain:   "www.EXAMPLE.com",
+			QType:    "A",
+		},
+		name: "subdomain_in_net",
+	}, {
+		want: &queryhook.Verdict{Action: queryhook.ActionAllow, Rule: "vip"},
+		q: &queryhook.Query{
+			ClientIP: "2001:db8::1",
+			Domain:   "example.com",
+			QType:    "A",
+		},
+		name: "single_ip",
+	}, {
+		want: &queryhook.Verdict{Action: queryhook.ActionPass},
+		q: &queryhook.Query{
+			ClientIP: "198.51.100.1",
+			Domain:   "notexample.com",
+			QType:    "A",
+		},
+		name: "no_match",
+	}, {
+		want: &queryhook.Verdict{Action: queryhook.ActionBlock, Rule: c.Expressions[1].Match},
+		q: &queryhook.Query{
+			Domain: "www.example.org",
+			QType:  "AAAA",
+		},
+		name: "default_rule",
+	}, {
+		want: &queryhook.Verdict{Action: queryhook.ActionPass},
+		q: &queryhook.Query{
+			Domain: "ipv6.example.org",
+			QType:  "AAAA",
+		},
+		name: "not_regexp",
+	}, {
+		want: &queryhook.Verdict{Action: queryhook.ActionPass, Rule: "keep"},
+		q: &queryhook.Query{
+			ClientID: "kid",
+			Domain:   "example.org",
+			QType:    "A",
+			Reason:   "FilteredParental",
+			Filtered: true,
+		},
+		name: "filtered",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, dErr := h.Decide(tc.q)
+			require.NoError(t, dErr)
+
+			assert.Equal(t, tc.want, v)
+		})
+	}
+}
+
+func TestHook_Close(t *testing.T) {
+	h := newHook(t, 1, queryhook.ActionPass)
+
+	_, err := h.Decide(&queryhook.Query{Domain: "pass.example"})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Close())
+
+	_, err = h.Decide(&queryhook.Query{Domain: "pass.example"})
+	testutil.AssertErrorMsg(t, "hook is closed", err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *queryhook.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &queryhook.Config{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf:       &queryhook.Config{Enabled: true},
+		name:       "no_command",
+		wantErrMsg: "command: empty with no expressions",
+	}, {
+		conf: &queryhook.Config{
+			Command: "/usr/local/bin/policy",
+			Timeout: timeutil.Duration{Duration: -1},
+			Enabled: true,
+		},
+		name:       "negative_timeout",
+		wantErrMsg: "timeout: negative value -1ns",
+	}, {
+		conf: &queryhook.Config{
+			Command:   "/usr/local/bin/policy",
+			Processes: 65,
+			Enabled:   true,
+		},
+		name:       "too_many_processes",
+		wantErrMsg: "processes: must be from 0 to 64, got 65",
+	}, {
+		conf: &queryhook.Config{
+			Command:   "/usr/local/bin/policy",
+			OnFailure: queryhook.ActionAllow,
+			Enabled:   true,
+		},
+		name:       "bad_on_failure",
+		wantErrMsg: `on_failure: bad action "allow"`,
+	}, {
+		conf: &queryhook.Config{
+			Expressions: []*queryhook.Expression{{
+				Match:  `domain == "example.com" &&`,
+				Action: queryhook.ActionBlock,
+			}},
+			Enabled: true,
+		},
+		name:       "incomplete_expression",
+		wantErrMsg: "expressions: at index 0: match: unexpected end of expression",
+	}, {
+		conf: &queryhook.Config{
+			Expressions: []*queryhook.Expression{{
+				Match:  `time == "night"`,
+				Action: queryhook.ActionBlock,
+			}},
+			Enabled: true,
+		},
+		name:       "unknown_field",
+		wantErrMsg: `expressions: at index 0: match: at offset 0: unknown field "time"`,
+	}, {
+		conf: &queryhook.Config{
+			Expressions: []*queryhook.Expression{{
+				Match:  `client_ip in ["192.0.2.0/33"]`,
+				Action: queryhook.ActionBlock,
+			}},
+			Enabled: true,
+		},
+		name: "bad_net",
+		wantErrMsg: `expressions: at index 0: match: at offset 14: ` +
+			`netip.ParsePrefix("192.0.2.0/33"): prefix length out of range`,
+	}, {
+		conf: &queryhook.Config{
+			Expressions: []*queryhook.Expression{{
+				Match:  `domain == "example.com"`,
+				Action: "drop",
+			}},
+			Enabled: true,
+		},
+		name:       "bad_action",
+		wantErrMsg: `expressions: at index 0: action: bad action "drop"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
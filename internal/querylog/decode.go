@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -129,6 +130,16 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"Fallback": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(bool)
+		if !ok {
+			return nil
+		}
+
+		ent.Fallback = v
+
+		return nil
+	},
 	"AD": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(bool)
 		if !ok {
@@ -162,6 +173,21 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		ent.Elapsed = time.Duration(i)
 
+		return nil
+	},
+	"SR": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := strconv.ParseUint(v.String(), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		ent.SampleRate = uint32(i)
+
 		return nil
 	},
 }
@@ -523,6 +549,32 @@ func decodeResultDNSRewriteResult(dec *json.Decoder, ent *logEntry) {
 	}
 }
 
+// decodeResultLookalike decodes the lookalike domain match of the result.
+func decodeResultLookalike(dec *json.Decoder, ent *logEntry) {
+	m := &filtering.LookalikeMatch{}
+	err := dec.Decode(m)
+	if err != nil {
+		log.Debug("decodeResultLookalike err: %s", err)
+
+		return
+	}
+
+	ent.Result.Lookalike = m
+}
+
+// decodeResultThreat decodes the threat intelligence feed match of the result.
+func decodeResultThreat(dec *json.Decoder, ent *logEntry) {
+	m := &filtering.ThreatMatch{}
+	err := dec.Decode(m)
+	if err != nil {
+		log.Debug("decodeResultThreat err: %s", err)
+
+		return
+	}
+
+	ent.Result.Threat = m
+}
+
 // translateResult converts some fields of the ent.Result to the format
 // consistent with current implementation.
 func translateResult(ent *logEntry) {
@@ -598,6 +650,14 @@ func decodeResult(dec *json.Decoder, ent *logEntry) {
 		case "DNSRewriteResult":
 			decodeResultDNSRewriteResult(dec, ent)
 
+			continue
+		case "Lookalike":
+			decodeResultLookalike(dec, ent)
+
+			continue
+		case "Threat":
+			decodeResultThreat(dec, ent)
+
 			continue
 		default:
 			// Go on.
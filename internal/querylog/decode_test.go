@@ -35,6 +35,8 @@ func TestDecodeLogEntry(t *testing.T) {
 			`"ECS":"1.2.3.0/24",` +
 			`"Answer":"` + ansStr + `",` +
 			`"Cached":true,` +
+			`"Fallback":true,` +
+			`"SR":10,` +
 			`"AD":true,` +
 			`"Result":{` +
 			`"IsFiltered":true,` +
@@ -62,6 +64,7 @@ func TestDecodeLogEntry(t *testing.T) {
 			ReqECS:      "1.2.3.0/24",
 			Answer:      ans,
 			Cached:      true,
+			Fallback:    true,
 			Result: filtering.Result{
 				DNSRewriteResult: &filtering.DNSRewriteResult{
 					RCode: dns.RcodeSuccess,
@@ -86,6 +89,7 @@ func TestDecodeLogEntry(t *testing.T) {
 			},
 			Upstream:          "https://some.upstream",
 			Elapsed:           837429,
+			SampleRate:        10,
 			AuthenticatedData: true,
 		}
 
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +16,8 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/AdguardTeam/golibs/timeutil"
@@ -55,6 +59,17 @@ type getConfigResp struct {
 	//
 	// TODO(a.garipov): Consider using separate setting for statistics.
 	AnonymizeClientIP aghalg.NullBool `json:"anonymize_client_ip"`
+
+	// SampleRate is N in logging only one of N queries, which are neither
+	// blocked nor rewritten.  If nil, the current value is kept.
+	SampleRate *uint32 `json:"sample_rate,omitempty"`
+}
+
+// relocateReq is the request to the POST /control/querylog/relocate HTTP API.
+type relocateReq struct {
+	// DirPath is the absolute path to the existing directory the log files
+	// are moved into.
+	DirPath string `json:"dir_path"`
 }
 
 // Register web handlers
@@ -70,6 +85,7 @@ func (l *queryLog) initWeb() {
 		"/control/querylog/config/update",
 		l.handlePutQueryLogConfig,
 	)
+	l.conf.HTTPRegister(http.MethodPost, "/control/querylog/relocate", l.handleQueryLogRelocate)
 }
 
 func (l *queryLog) handleQueryLog(w http.ResponseWriter, r *http.Request) {
@@ -84,9 +100,47 @@ func (l *queryLog) handleQueryLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	entries, oldest := l.search(params)
-	data := l.entriesToJSON(entries, oldest)
 
-	_ = aghhttp.WriteJSONResponse(w, r, data)
+	s := aghhttp.NewJSONStream(w)
+	l.writeEntriesJSON(s, entries, oldest)
+
+	err = s.Close()
+	if err != nil {
+		log.Debug("querylog: writing response: %s", err)
+	}
+}
+
+// handleQueryLogRelocate handles requests to the POST
+// /control/querylog/relocate endpoint.
+func (l *queryLog) handleQueryLogRelocate(w http.ResponseWriter, r *http.Request) {
+	req := &relocateReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	dir := filepath.Clean(req.DirPath)
+	err = aghos.CheckDir(dir)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "dir_path: %s", err)
+
+		return
+	}
+
+	err = l.relocate(dir)
+	if errors.Is(err, os.ErrExist) {
+		aghhttp.Error(r, w, http.StatusConflict, "querylog: relocating: %s", err)
+
+		return
+	} else if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "querylog: relocating: %s", err)
+
+		return
+	}
+
+	l.conf.ConfigModified()
 }
 
 func (l *queryLog) handleQueryLogClear(_ http.ResponseWriter, _ *http.Request) {
@@ -124,11 +178,13 @@ func (l *queryLog) handleGetQueryLogConfig(w http.ResponseWriter, r *http.Reques
 
 	ignored := l.conf.Ignored.Values()
 	slices.Sort(ignored)
+	sampleRate := aghalg.Coalesce(l.conf.SampleRate, 1)
 	_ = aghhttp.WriteJSONResponse(w, r, getConfigResp{
 		Ignored:           ignored,
 		Interval:          float64(l.conf.RotationIvl.Milliseconds()),
 		Enabled:           aghalg.BoolToNullBool(l.conf.Enabled),
 		AnonymizeClientIP: aghalg.BoolToNullBool(l.conf.AnonymizeClientIP),
+		SampleRate:        &sampleRate,
 	})
 }
 
@@ -254,6 +310,10 @@ func (l *queryLog) handlePutQueryLogConfig(w http.ResponseWriter, r *http.Reques
 		l.anonymizer.Store(nil)
 	}
 
+	if newConf.SampleRate != nil {
+		conf.SampleRate = *newConf.SampleRate
+	}
+
 	l.conf = &conf
 }
 
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/golibs/log"
@@ -18,25 +20,29 @@ import (
 // jobject is a JSON object alias.
 type jobject = map[string]any
 
-// entriesToJSON converts query log entries to JSON.
-func (l *queryLog) entriesToJSON(entries []*logEntry, oldest time.Time) (res jobject) {
-	data := make([]jobject, 0, len(entries))
+// writeEntriesJSON writes the query log entries and the time of the oldest one
+// into s.  Each entry is converted right before writing, so that the whole
+// response is never kept in memory.
+func (l *queryLog) writeEntriesJSON(
+	s *aghhttp.JSONStream,
+	entries []*logEntry,
+	oldest time.Time,
+) {
+	anonFunc := l.anonymizer.Load()
 
 	// The elements order is already reversed to be from newer to older.
+	s.BeginArray("data")
 	for _, entry := range entries {
-		jsonEntry := l.entryToJSON(entry, l.anonymizer.Load())
-		data = append(data, jsonEntry)
+		s.Elem(l.entryToJSON(entry, anonFunc))
 	}
+	s.EndArray()
 
-	res = jobject{
-		"data":   data,
-		"oldest": "",
-	}
+	oldestStr := ""
 	if !oldest.IsZero() {
-		res["oldest"] = oldest.Format(time.RFC3339Nano)
+		oldestStr = oldest.Format(time.RFC3339Nano)
 	}
 
-	return res
+	s.Field("oldest", oldestStr)
 }
 
 // entryToJSON converts a log entry's data into an entry for the JSON API.
@@ -64,6 +70,8 @@ func (l *queryLog) entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (json
 		"client":       entIP,
 		"client_proto": entry.ClientProto,
 		"cached":       entry.Cached,
+		"fallback":     entry.Fallback,
+		"sample_rate":  aghalg.Coalesce(entry.SampleRate, 1),
 		"upstream":     entry.Upstream,
 		"question":     question,
 		"rules":        resultRulesToJSONRules(entry.Result.Rules),
@@ -92,6 +100,21 @@ func (l *queryLog) entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (json
 		jsonEntry["service_name"] = entry.Result.ServiceName
 	}
 
+	if m := entry.Result.Lookalike; m != nil {
+		jsonEntry["lookalike"] = jobject{
+			"protected":  m.Protected,
+			"kind":       m.Kind,
+			"confidence": m.Confidence,
+		}
+	}
+
+	if m := entry.Result.Threat; m != nil {
+		jsonEntry["threat"] = jobject{
+			"feed":     m.Feed,
+			"category": m.Category,
+		}
+	}
+
 	l.setMsgData(entry, jsonEntry)
 	l.setOrigAns(entry, jsonEntry)
 
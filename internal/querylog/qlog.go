@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -19,6 +20,10 @@ import (
 
 const (
 	queryLogFileName = "querylog.json" // .gz added during compression
+
+	// entriesQueueSize is the maximum number of entries waiting to be added to
+	// the memory buffer.  The entries added when the queue is full are dropped.
+	entriesQueueSize = 4096
 )
 
 // queryLog is a structure that writes and reads the DNS query log
@@ -35,10 +40,37 @@ type queryLog struct {
 	// be modified.
 	buffer []*logEntry
 
+	// entries is the bounded queue of the entries waiting to be added to
+	// buffer by [queryLog.writeEntries], so that Add never blocks on locks.
+	entries chan *logEntry
+
+	// syncReqs receives the requests to add all queued entries to buffer.  The
+	// channel from a request is closed once it's done.
+	syncReqs chan chan struct{}
+
+	// stop is closed to stop [queryLog.writeEntries].
+	stop chan struct{}
+
+	// stopped is closed when [queryLog.writeEntries] has returned.
+	stopped chan struct{}
+
+	// stopOnce makes sure stop is closed only once.
+	stopOnce sync.Once
+
+	// dropped is the number of entries dropped, because entries was full.
+	dropped atomic.Uint64
+
+	// sampled is the number of queries considered for sampling.
+	sampled atomic.Uint64
+
 	fileFlushLock sync.Mutex // synchronize a file-flushing goroutine and main thread
 	flushPending  bool       // don't start another goroutine while the previous one is still running
 	fileWriteLock sync.Mutex
 
+	// filePaused is true if writing to the file is paused, for example
+	// because the disk is full.
+	filePaused atomic.Bool
+
 	anonymizer *aghnet.IPMut
 }
 
@@ -97,7 +129,12 @@ type logEntry struct {
 
 	Elapsed time.Duration
 
+	// SampleRate is N if the entry is one of N sampled queries.  It's zero if
+	// the query isn't sampled.
+	SampleRate uint32 `json:"SR,omitempty"`
+
 	Cached            bool `json:",omitempty"`
+	Fallback          bool `json:",omitempty"`
 	AuthenticatedData bool `json:"AD,omitempty"`
 }
 
@@ -116,6 +153,15 @@ func (l *queryLog) Start() {
 }
 
 func (l *queryLog) Close() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.stopped
+
+	if n := l.dropped.Load(); n > 0 {
+		log.Info("querylog: %d entries dropped due to the full queue", n)
+	}
+
 	_ = l.flushLogBuffer(true)
 }
 
@@ -152,6 +198,8 @@ func (l *queryLog) WriteDiskConfig(c *Config) {
 
 // Clear memory buffer and remove log files
 func (l *queryLog) clear() {
+	l.syncEntries()
+
 	l.fileFlushLock.Lock()
 	defer l.fileFlushLock.Unlock()
 
@@ -174,6 +222,9 @@ func (l *queryLog) clear() {
 	log.Debug("querylog: cleared")
 }
 
+// Add implements the [QueryLog] interface for *queryLog.  It doesn't block on
+// the memory buffer, but only queues the entry, so the entry is dropped if the
+// queue is full.
 func (l *queryLog) Add(params *AddParams) {
 	if !l.conf.Enabled {
 		return
@@ -190,6 +241,11 @@ func (l *queryLog) Add(params *AddParams) {
 		params.Result = &filtering.Result{}
 	}
 
+	sampleRate, ok := l.sample(params.Result)
+	if !ok {
+		return
+	}
+
 	now := time.Now()
 	q := params.Question.Question[0]
 	entry := logEntry{
@@ -209,7 +265,10 @@ func (l *queryLog) Add(params *AddParams) {
 
 		Elapsed: params.Elapsed,
 
+		SampleRate: sampleRate,
+
 		Cached:            params.Cached,
+		Fallback:          params.Fallback,
 		AuthenticatedData: params.AuthenticatedData,
 	}
 
@@ -241,11 +300,46 @@ func (l *queryLog) Add(params *AddParams) {
 		entry.OrigAnswer = a
 	}
 
+	select {
+	case l.entries <- &entry:
+		// Go on.
+	default:
+		// Only log the powers of two to not flood the log under load.
+		if n := l.dropped.Add(1); n&(n-1) == 0 {
+			log.Info("querylog: queue is full, %d entries dropped so far", n)
+		}
+	}
+}
+
+// sample returns true if the query with the filtering result res should be
+// logged.  rate is the sample rate of the entry, or zero if the query isn't
+// sampled, since the blocked and rewritten queries are always logged.
+func (l *queryLog) sample(res *filtering.Result) (rate uint32, ok bool) {
+	rate = l.conf.SampleRate
+	if rate <= 1 {
+		return 0, true
+	}
+
+	if res.IsFiltered || res.Reason.In(
+		filtering.Rewritten,
+		filtering.RewrittenAutoHosts,
+		filtering.RewrittenRule,
+	) {
+		return 0, true
+	}
+
+	return rate, l.sampled.Add(1)%uint64(rate) == 0
+}
+
+// addToBuffer adds entry to the memory buffer and starts flushing it to the
+// file, if needed.  It must only be called by the single consumer of
+// l.entries.
+func (l *queryLog) addToBuffer(entry *logEntry) {
 	l.bufferLock.Lock()
-	l.buffer = append(l.buffer, &entry)
+	l.buffer = append(l.buffer, entry)
 	needFlush := false
 
-	if !l.conf.FileEnabled {
+	if !l.conf.FileEnabled || l.filePaused.Load() {
 		if len(l.buffer) > int(l.conf.MemSize) {
 			// writing to file is disabled - just remove the oldest entry from array
 			//
@@ -270,6 +364,73 @@ func (l *queryLog) Add(params *AddParams) {
 	}
 }
 
+// writeEntries adds the queued entries to the memory buffer until l.stop is
+// closed.  It's intended to be used as a goroutine.
+func (l *queryLog) writeEntries() {
+	defer close(l.stopped)
+	defer log.OnPanic("querylog: writing entries")
+
+	for {
+		select {
+		case e := <-l.entries:
+			l.addToBuffer(e)
+		case done := <-l.syncReqs:
+			l.drainEntries()
+			close(done)
+		case <-l.stop:
+			l.drainEntries()
+
+			return
+		}
+	}
+}
+
+// drainEntries adds all currently queued entries to the memory buffer.
+func (l *queryLog) drainEntries() {
+	for {
+		select {
+		case e := <-l.entries:
+			l.addToBuffer(e)
+		default:
+			return
+		}
+	}
+}
+
+// syncEntries returns once all entries queued before the call are added to
+// the memory buffer.
+func (l *queryLog) syncEntries() {
+	done := make(chan struct{})
+	select {
+	case l.syncReqs <- done:
+		<-done
+	case <-l.stopped:
+		// The writer has stopped, so there is no other consumer.
+		l.drainEntries()
+	}
+}
+
+// SetFilePaused implements the [QueryLog] interface for *queryLog.
+func (l *queryLog) SetFilePaused(paused bool) {
+	if l.filePaused.Swap(paused) != paused {
+		log.Info("querylog: file writes paused: %t", paused)
+	}
+}
+
+// PruneOldest implements the [QueryLog] interface for *queryLog.  It removes
+// the rotated log file.
+func (l *queryLog) PruneOldest() (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	err = os.Remove(l.logFile + ".1")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
 // ShouldLog returns true if request for the host should be logged.
 func (l *queryLog) ShouldLog(host string, _, _ uint16) bool {
 	l.lock.Lock()
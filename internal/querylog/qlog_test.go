@@ -3,6 +3,7 @@ package querylog
 import (
 	"fmt"
 	"net"
+	"path/filepath"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -251,6 +252,173 @@ func TestQueryLogFileDisabled(t *testing.T) {
 	assert.Equal(t, "example2.org", ll[1].QHost)
 }
 
+func TestQueryLog_SetFilePaused(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     1,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	addEntry(l, "example1.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer(true))
+	require.NoError(t, l.rotate())
+	require.FileExists(t, l.logFile+".1")
+
+	l.SetFilePaused(true)
+	require.NoError(t, l.PruneOldest())
+	assert.NoFileExists(t, l.logFile+".1")
+
+	addEntry(l, "example2.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	// The oldest entry is going to be removed from memory buffer.
+	addEntry(l, "example3.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer(true))
+	assert.NoFileExists(t, l.logFile)
+
+	l.SetFilePaused(false)
+	require.NoError(t, l.flushLogBuffer(true))
+
+	ll, _ := l.search(newSearchParams())
+	require.Len(t, ll, 1)
+	assert.Equal(t, "example3.org", ll[0].QHost)
+}
+
+func TestQueryLog_Add_queueFull(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: false,
+		RotationIvl: timeutil.Day,
+		MemSize:     entriesQueueSize,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	// Stop the writer so that the queue isn't consumed.
+	l.Close()
+
+	for i := 0; i < entriesQueueSize+1; i++ {
+		host := fmt.Sprintf("example%d.org", i)
+		addEntry(l, host, net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	}
+
+	assert.Equal(t, uint64(1), l.dropped.Load())
+
+	l.syncEntries()
+	require.Len(t, l.buffer, entriesQueueSize)
+
+	last := l.buffer[len(l.buffer)-1]
+	assert.Equal(t, fmt.Sprintf("example%d.org", entriesQueueSize-1), last.QHost)
+}
+
+func TestQueryLog_sample(t *testing.T) {
+	const rate = 3
+
+	testCases := []struct {
+		res        *filtering.Result
+		name       string
+		wantLogged int
+		wantRate   uint32
+		rate       uint32
+	}{{
+		res:        &filtering.Result{},
+		name:       "disabled",
+		wantLogged: 6,
+		wantRate:   0,
+		rate:       0,
+	}, {
+		res:        &filtering.Result{},
+		name:       "one",
+		wantLogged: 6,
+		wantRate:   0,
+		rate:       1,
+	}, {
+		res:        &filtering.Result{},
+		name:       "sampled",
+		wantLogged: 2,
+		wantRate:   rate,
+		rate:       rate,
+	}, {
+		res: &filtering.Result{
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+		name:       "blocked",
+		wantLogged: 6,
+		wantRate:   0,
+		rate:       rate,
+	}, {
+		res: &filtering.Result{
+			Reason: filtering.RewrittenRule,
+		},
+		name:       "rewritten",
+		wantLogged: 6,
+		wantRate:   0,
+		rate:       rate,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &queryLog{
+				conf: &Config{
+					SampleRate: tc.rate,
+				},
+			}
+
+			logged := 0
+			for i := 0; i < 2*rate; i++ {
+				gotRate, ok := l.sample(tc.res)
+				assert.Equal(t, tc.wantRate, gotRate)
+
+				if ok {
+					logged++
+				}
+			}
+
+			assert.Equal(t, tc.wantLogged, logged)
+		})
+	}
+}
+
+func TestQueryLog_relocate(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     oldDir,
+	})
+	require.NoError(t, err)
+
+	addEntry(l, "example1.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer(true))
+	require.NoError(t, l.rotate())
+
+	// Keep the entry in memory to check it's flushed before moving.
+	addEntry(l, "example2.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+
+	err = l.relocate(newDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, newDir, l.conf.BaseDir)
+	assert.NoFileExists(t, filepath.Join(oldDir, queryLogFileName))
+	assert.NoFileExists(t, filepath.Join(oldDir, queryLogFileName+".1"))
+	assert.FileExists(t, filepath.Join(newDir, queryLogFileName))
+	assert.FileExists(t, filepath.Join(newDir, queryLogFileName+".1"))
+
+	addEntry(l, "example3.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer(true))
+
+	ll, _ := l.search(newSearchParams())
+	require.Len(t, ll, 3)
+
+	assert.Equal(t, "example3.org", ll[0].QHost)
+	assert.Equal(t, "example1.org", ll[2].QHost)
+}
+
 func TestQueryLogShouldLog(t *testing.T) {
 	const (
 		ignored1 = "ignor.ed"
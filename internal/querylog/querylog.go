@@ -29,6 +29,13 @@ type QueryLog interface {
 
 	// ShouldLog returns true if request for the host should be logged.
 	ShouldLog(host string, qType, qClass uint16) bool
+
+	// SetFilePaused pauses or resumes writing the log to the file.  While
+	// paused, only the latest entries are kept in memory.
+	SetFilePaused(paused bool)
+
+	// PruneOldest removes the oldest log file, if any.
+	PruneOldest() (err error)
 }
 
 // Config is the query log configuration structure.
@@ -65,6 +72,11 @@ type Config struct {
 	// are flushed to disk.
 	MemSize uint32
 
+	// SampleRate is N in logging only one of N queries.  The blocked and
+	// rewritten queries are always logged.  Zero and one mean that all
+	// queries are logged.
+	SampleRate uint32
+
 	// Enabled tells if the query log is enabled.
 	Enabled bool
 
@@ -113,6 +125,10 @@ type AddParams struct {
 	// Cached indicates if the response is served from cache.
 	Cached bool
 
+	// Fallback indicates if the response is received from a fallback
+	// upstream, because the primary ones have failed.
+	Fallback bool
+
 	// AuthenticatedData shows if the response had the AD bit set.
 	AuthenticatedData bool
 }
@@ -152,6 +168,11 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 
 		logFile:    filepath.Join(conf.BaseDir, queryLogFileName),
 		anonymizer: conf.Anonymizer,
+
+		entries:  make(chan *logEntry, entriesQueueSize),
+		syncReqs: make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
 	}
 
 	l.conf = &Config{}
@@ -162,5 +183,7 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		return nil, fmt.Errorf("unsupported interval: %w", err)
 	}
 
+	go l.writeEntries()
+
 	return l, nil
 }
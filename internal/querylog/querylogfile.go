@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
 
 // flushLogBuffer flushes the current buffer to file and resets the current buffer
 func (l *queryLog) flushLogBuffer(fullFlush bool) error {
-	if !l.conf.FileEnabled {
+	// Add the queued entries first, so that they're handled according to the
+	// current state of file writing.
+	l.syncEntries()
+
+	if !l.conf.FileEnabled || l.filePaused.Load() {
 		return nil
 	}
 
@@ -62,11 +68,12 @@ func (l *queryLog) flushToFile(buffer []*logEntry) (err error) {
 	log.Debug("%d elements serialized via json in %v: %d kB, %v/entry, %v/entry", len(buffer), elapsed, b.Len()/1024, float64(b.Len())/float64(len(buffer)), elapsed/time.Duration(len(buffer)))
 
 	var zb bytes.Buffer
-	filename := l.logFile
 	zb = b
 
 	l.fileWriteLock.Lock()
 	defer l.fileWriteLock.Unlock()
+
+	filename := l.logFile
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
 	if err != nil {
 		log.Error("failed to create file \"%s\": %s", filename, err)
@@ -105,6 +112,74 @@ func (l *queryLog) rotate() error {
 	return nil
 }
 
+// relocate moves the log files into dir and continues writing the log there.
+// The buffered entries are flushed into the current file beforehand.  If moving
+// any of the files fails, the files already moved are moved back.
+func (l *queryLog) relocate(dir string) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	err = l.flushLogBuffer(true)
+	if err != nil {
+		return fmt.Errorf("flushing buffer: %w", err)
+	}
+
+	l.fileFlushLock.Lock()
+	defer l.fileFlushLock.Unlock()
+
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	newLogFile := filepath.Join(dir, queryLogFileName)
+	if newLogFile == l.logFile {
+		return nil
+	}
+
+	// Move the rotated file first, since it's the larger one usually.
+	var moved []string
+	for _, suffix := range []string{".1", ""} {
+		from, to := l.logFile+suffix, newLogFile+suffix
+		err = aghos.MoveFile(from, to)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			err = fmt.Errorf("moving %q: %w", from, err)
+
+			return errors.WithDeferred(err, l.moveBack(moved, newLogFile))
+		}
+
+		moved = append(moved, suffix)
+	}
+
+	log.Info("querylog: moved log files from %q to %q", filepath.Dir(l.logFile), dir)
+
+	l.logFile = newLogFile
+
+	conf := *l.conf
+	conf.BaseDir = dir
+	l.conf = &conf
+
+	return nil
+}
+
+// moveBack moves the files with the given suffixes from the newLogFile back to
+// the current location.
+func (l *queryLog) moveBack(suffixes []string, newLogFile string) (err error) {
+	var errs []error
+	for _, suffix := range suffixes {
+		mvErr := aghos.MoveFile(newLogFile+suffix, l.logFile+suffix)
+		if mvErr != nil {
+			errs = append(errs, fmt.Errorf("moving back %q: %w", newLogFile+suffix, mvErr))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.List("restoring log files", errs...)
+	}
+
+	return nil
+}
+
 func (l *queryLog) readFileFirstTimeValue() (first time.Time, err error) {
 	var f *os.File
 	f, err = os.Open(l.logFile)
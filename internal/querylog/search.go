@@ -46,6 +46,8 @@ func (l *queryLog) client(clientID, ip string, cache clientCache) (c *Client, er
 // buffer.  It optionally uses the client cache, if provided.  It also returns
 // the total amount of records in the buffer at the moment of searching.
 func (l *queryLog) searchMemory(params *searchParams, cache clientCache) (entries []*logEntry, total int) {
+	l.syncEntries()
+
 	l.bufferLock.Lock()
 	defer l.bufferLock.Unlock()
 
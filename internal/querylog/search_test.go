@@ -1,6 +1,7 @@
 package querylog
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -93,3 +94,61 @@ func TestQueryLog_Search_findClient(t *testing.T) {
 
 	assert.Equal(t, knownClientName, gotClient.Name)
 }
+
+var entriesSink []*logEntry
+
+func BenchmarkQueryLog_search(b *testing.B) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     1000,
+		BaseDir:     b.TempDir(),
+	})
+	require.NoError(b, err)
+	b.Cleanup(l.Close)
+
+	const entNum = 1000
+
+	// Write the half of the entries into the file and keep the other half in
+	// memory.
+	for i := 0; i < entNum/2; i++ {
+		addEntry(l, fmt.Sprintf("file-%d.example.org", i), net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	}
+
+	err = l.flushLogBuffer(true)
+	require.NoError(b, err)
+
+	for i := 0; i < entNum/2; i++ {
+		addEntry(l, fmt.Sprintf("mem-%d.example.org", i), net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	}
+
+	testCases := []struct {
+		name string
+		sCr  []searchCriterion
+	}{{
+		name: "all",
+		sCr:  nil,
+	}, {
+		name: "domain",
+		sCr: []searchCriterion{{
+			criterionType: ctTerm,
+			value:         "file-1",
+		}},
+	}}
+
+	for _, tc := range testCases {
+		params := newSearchParams()
+		params.searchCriteria = tc.sCr
+
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				entriesSink, _ = l.search(params)
+			}
+
+			assert.NotEmpty(b, entriesSink)
+		})
+	}
+}
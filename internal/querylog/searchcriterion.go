@@ -176,6 +176,7 @@ func (c *searchCriterion) ctFilteringStatusCase(
 		return !reason.In(
 			filtering.FilteredBlockList,
 			filtering.FilteredBlockedService,
+			filtering.FilteredLookalike,
 			filtering.NotFilteredAllowList,
 		)
 	default:
@@ -194,7 +195,11 @@ func (c *searchCriterion) ctFilteringStatusCase(
 func (c *searchCriterion) isFilteredWithReason(reason filtering.Reason) (matched bool) {
 	switch c.value {
 	case filteringStatusBlocked:
-		return reason.In(filtering.FilteredBlockList, filtering.FilteredBlockedService)
+		return reason.In(
+			filtering.FilteredBlockList,
+			filtering.FilteredBlockedService,
+			filtering.FilteredLookalike,
+		)
 	case filteringStatusBlockedParental:
 		return reason == filtering.FilteredParental
 	case filteringStatusBlockedSafebrowsing:
@@ -0,0 +1,173 @@
+package snmp
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// BER tags of the types used by SNMP.
+const (
+	tagInteger     byte = 0x02
+	tagOctetString byte = 0x04
+	tagNull        byte = 0x05
+	tagOID         byte = 0x06
+	tagSequence    byte = 0x30
+
+	tagCounter32 byte = 0x41
+	tagGauge32   byte = 0x42
+	tagTimeTicks byte = 0x43
+	tagCounter64 byte = 0x46
+
+	tagNoSuchObject   byte = 0x80
+	tagNoSuchInstance byte = 0x81
+	tagEndOfMIBView   byte = 0x82
+)
+
+// errTruncated is returned when the BER data ends prematurely.
+const errTruncated errors.Error = "truncated data"
+
+// appendTLV appends the BER encoding of the value with tag and content to b.
+func appendTLV(b []byte, tag byte, content []byte) (res []byte) {
+	b = append(b, tag)
+
+	l := len(content)
+	switch {
+	case l < 0x80:
+		b = append(b, byte(l))
+	case l <= 0xff:
+		b = append(b, 0x81, byte(l))
+	case l <= 0xffff:
+		b = append(b, 0x82, byte(l>>8), byte(l))
+	default:
+		b = append(b, 0x83, byte(l>>16), byte(l>>8), byte(l))
+	}
+
+	return append(b, content...)
+}
+
+// encodeInt returns the minimal two's complement encoding of n.
+func encodeInt(n int64) (b []byte) {
+	size := 1
+	for v := n; v > 127 || v < -128; v >>= 8 {
+		size++
+	}
+
+	b = make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+
+	return b
+}
+
+// encodeUint returns the minimal encoding of the unsigned n, which has a
+// leading zero byte if the most significant bit is set.
+func encodeUint(n uint64) (b []byte) {
+	size := 1
+	for v := n; v > 127; v >>= 8 {
+		size++
+	}
+
+	b = make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+
+	return b
+}
+
+// berReader reads the BER-encoded values one after another.
+type berReader struct {
+	data []byte
+}
+
+// empty returns true if there is no more data to read.
+func (r *berReader) empty() (ok bool) {
+	return len(r.data) == 0
+}
+
+// next reads the next value.  raw is the whole encoding of the value including
+// its tag and length.
+func (r *berReader) next() (tag byte, content, raw []byte, err error) {
+	data := r.data
+	if len(data) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+
+	tag = data[0]
+	l, hdrLen := int(data[1]), 2
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 3 {
+			return 0, nil, nil, fmt.Errorf("unsupported length of %d bytes", n)
+		} else if len(data) < 2+n {
+			return 0, nil, nil, errTruncated
+		}
+
+		l = 0
+		for _, c := range data[2 : 2+n] {
+			l = l<<8 | int(c)
+		}
+
+		hdrLen += n
+	}
+
+	end := hdrLen + l
+	if len(data) < end {
+		return 0, nil, nil, errTruncated
+	}
+
+	r.data = data[end:]
+
+	return tag, data[hdrLen:end], data[:end], nil
+}
+
+// expect reads the next value and returns its content, if the tag is want.
+func (r *berReader) expect(want byte) (content []byte, err error) {
+	tag, content, _, err := r.next()
+	if err != nil {
+		return nil, err
+	} else if tag != want {
+		return nil, fmt.Errorf("unexpected tag 0x%02x, want 0x%02x", tag, want)
+	}
+
+	return content, nil
+}
+
+// readInt reads the next INTEGER value.
+func (r *berReader) readInt() (n int64, err error) {
+	content, err := r.expect(tagInteger)
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeInt(content)
+}
+
+// readSeq reads the next SEQUENCE value and returns the reader of its content.
+func (r *berReader) readSeq() (seq *berReader, err error) {
+	content, err := r.expect(tagSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &berReader{data: content}, nil
+}
+
+// decodeInt decodes the two's complement integer.
+func decodeInt(b []byte) (n int64, err error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, fmt.Errorf("bad integer length %d", len(b))
+	}
+
+	// Sign-extend the first byte.
+	n = int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,258 @@
+package snmp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PDU types.
+const (
+	pduGet      byte = 0xa0
+	pduGetNext  byte = 0xa1
+	pduResponse byte = 0xa2
+	pduSet      byte = 0xa3
+	pduGetBulk  byte = 0xa5
+	pduReport   byte = 0xa8
+)
+
+// Error statuses of the responses.
+const (
+	errStatusNoError  = 0
+	errStatusTooBig   = 1
+	errStatusNoAccess = 6
+)
+
+// maxBulkVars is the maximum number of variable bindings in a response to a
+// GetBulkRequest.
+const maxBulkVars = 256
+
+// request is a decoded request PDU.
+type request struct {
+	// oids are the identifiers from the variable bindings.
+	oids []OID
+
+	// reqID is the identifier of the request.
+	reqID int64
+
+	// nonRepeaters is the number of the non-repeating variables of
+	// a GetBulkRequest.
+	nonRepeaters int64
+
+	// maxRepetitions is the maximum number of the repetitions of
+	// a GetBulkRequest.
+	maxRepetitions int64
+
+	// typ is the type of the PDU.
+	typ byte
+}
+
+// decodeRequest decodes the request PDU with the tag and the content.
+func decodeRequest(tag byte, content []byte) (req *request, err error) {
+	switch tag {
+	case pduGet, pduGetNext, pduSet, pduGetBulk:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("unsupported pdu type 0x%02x", tag)
+	}
+
+	r := &berReader{data: content}
+	req = &request{
+		typ: tag,
+	}
+
+	req.reqID, err = r.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("request id: %w", err)
+	}
+
+	// For GetBulkRequest these are the non-repeaters and the max-repetitions,
+	// and the error status and the error index for others.
+	req.nonRepeaters, err = r.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("error status: %w", err)
+	}
+
+	req.maxRepetitions, err = r.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("error index: %w", err)
+	}
+
+	req.oids, err = decodeVarOIDs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// appendPDU appends the BER encoding of the PDU to b.
+func appendPDU(b []byte, typ byte, reqID int64, errStatus, errIndex int, vars []*Var) (res []byte) {
+	var content []byte
+	content = appendTLV(content, tagInteger, encodeInt(reqID))
+	content = appendTLV(content, tagInteger, encodeInt(int64(errStatus)))
+	content = appendTLV(content, tagInteger, encodeInt(int64(errIndex)))
+	content = appendVars(content, vars)
+
+	return appendTLV(b, typ, content)
+}
+
+// mib is a sorted snapshot of the exposed objects.
+type mib []*Var
+
+// newMIB returns the sorted snapshot of vars.  Objects with duplicate
+// identifiers are removed.
+func newMIB(vars []*Var) (m mib) {
+	sort.SliceStable(vars, func(i, j int) bool {
+		return vars[i].OID.compare(vars[j].OID) < 0
+	})
+
+	m = make(mib, 0, len(vars))
+	for _, v := range vars {
+		if len(m) > 0 && m[len(m)-1].OID.compare(v.OID) == 0 {
+			continue
+		}
+
+		m = append(m, v)
+	}
+
+	return m
+}
+
+// get returns the variable binding for the object with oid.
+func (m mib) get(oid OID) (v *Var) {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].OID.compare(oid) >= 0
+	})
+	if i < len(m) && m[i].OID.compare(oid) == 0 {
+		return m[i]
+	}
+
+	// Report noSuchInstance for the objects within the scalar or the column,
+	// which is the prefix of a neighboring object, and noSuchObject otherwise.
+	val := Value(noSuchObject)
+	for _, j := range []int{i - 1, i} {
+		if j >= 0 && j < len(m) && sameParent(m[j].OID, oid) {
+			val = noSuchInstance
+
+			break
+		}
+	}
+
+	return &Var{
+		OID:   oid,
+		Value: val,
+	}
+}
+
+// sameParent returns true if oid is within the scalar or the column containing
+// the object with obj.
+func sameParent(obj, oid OID) (ok bool) {
+	parent := obj[:len(obj)-1]
+
+	return len(parent) > 0 && len(oid) > len(parent) && parent.compare(oid[:len(parent)]) == 0
+}
+
+// next returns the variable binding for the first object following oid.
+func (m mib) next(oid OID) (v *Var) {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].OID.compare(oid) > 0
+	})
+	if i < len(m) {
+		return m[i]
+	}
+
+	return &Var{
+		OID:   oid,
+		Value: endOfMIBView,
+	}
+}
+
+// response is the data of a response PDU.
+type response struct {
+	vars      []*Var
+	errStatus int
+	errIndex  int
+}
+
+// respond processes req against m.  maxSize is the maximum size of the
+// encoded variable bindings.
+func (m mib) respond(req *request, maxSize int) (resp *response) {
+	resp = &response{}
+	switch req.typ {
+	case pduGet:
+		for _, oid := range req.oids {
+			resp.vars = append(resp.vars, m.get(oid))
+		}
+	case pduGetNext:
+		for _, oid := range req.oids {
+			resp.vars = append(resp.vars, m.next(oid))
+		}
+	case pduGetBulk:
+		resp.vars = m.bulk(req, maxSize)
+	default:
+		// All the objects are read-only.
+		resp.vars = make([]*Var, 0, len(req.oids))
+		for _, oid := range req.oids {
+			resp.vars = append(resp.vars, &Var{OID: oid, Value: null{}})
+		}
+
+		resp.errStatus, resp.errIndex = errStatusNoAccess, 1
+	}
+
+	if len(appendVars(nil, resp.vars)) > maxSize {
+		return &response{
+			errStatus: errStatusTooBig,
+		}
+	}
+
+	return resp
+}
+
+// bulk returns the variable bindings for the GetBulkRequest.  The repetitions
+// are stopped when the response doesn't fit into maxSize.
+func (m mib) bulk(req *request, maxSize int) (vars []*Var) {
+	n := int(req.nonRepeaters)
+	if n < 0 {
+		n = 0
+	} else if n > len(req.oids) {
+		n = len(req.oids)
+	}
+
+	for _, oid := range req.oids[:n] {
+		vars = append(vars, m.next(oid))
+	}
+
+	reps := req.oids[n:]
+	if len(reps) == 0 {
+		return vars
+	}
+
+	last := make([]OID, len(reps))
+	copy(last, reps)
+
+	size := len(appendVars(nil, vars))
+	for rep := int64(0); rep < req.maxRepetitions; rep++ {
+		allEnd := true
+		for i, oid := range last {
+			v := m.next(oid)
+			if v.Value != endOfMIBView {
+				allEnd = false
+			}
+
+			vb := appendVars(nil, []*Var{v})
+			if size+len(vb) > maxSize || len(vars) >= maxBulkVars {
+				return vars
+			}
+
+			size += len(vb)
+			vars = append(vars, v)
+			last[i] = v.OID
+		}
+
+		if allEnd {
+			break
+		}
+	}
+
+	return vars
+}
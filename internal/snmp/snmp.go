@@ -0,0 +1,527 @@
+// Package snmp contains a minimal read-only SNMP agent supporting SNMPv2c and
+// SNMPv3 with the user-based security model.
+//
+// See RFC 3416 and RFC 3414.
+package snmp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Versions of the protocol as encoded in the messages.
+const (
+	versionV2c = 1
+	versionV3  = 3
+)
+
+// maxMsgSize is the maximum size of the messages received and sent by the
+// agent.
+const maxMsgSize = 65507
+
+// msgOverhead is the space reserved for the message headers when limiting the
+// size of the variable bindings in the responses.
+const msgOverhead = 256
+
+// timeWindow is the maximum difference between the engine time in the
+// authenticated requests and the actual one, see RFC 3414.
+const timeWindow = 150
+
+// systemOID is the identifier of the system group of SNMPv2-MIB.
+var systemOID = OID{1, 3, 6, 1, 2, 1, 1}
+
+// usmStatsOID is the identifier of the usmStats group of SNMP-USER-BASED-SM-MIB.
+var usmStatsOID = OID{1, 3, 6, 1, 6, 3, 15, 1, 1}
+
+// Indexes of the objects in the usmStats group.
+const (
+	usmStatsUnsupportedSecLevels = 1
+	usmStatsNotInTimeWindows     = 2
+	usmStatsUnknownUserNames     = 3
+	usmStatsUnknownEngineIDs     = 4
+	usmStatsWrongDigests         = 5
+	usmStatsDecryptionErrors     = 6
+)
+
+// Config is the configuration of the agent.
+type Config struct {
+	// Objects returns the current values of the exposed objects.  It's called
+	// for each request and must be safe for concurrent use.
+	Objects func() (vars []*Var)
+
+	// Description is the value of sysDescr.
+	Description string
+
+	// Name is the value of sysName.
+	Name string
+
+	// ObjectID is the value of sysObjectID, the base of the objects.
+	ObjectID OID
+
+	// Community is the SNMPv2c community.  If empty, SNMPv2c is disabled.
+	Community string
+
+	// Users are the SNMPv3 users.  If empty, SNMPv3 is disabled.
+	Users []*UserConfig
+
+	// Addr is the UDP address to listen on.
+	Addr netip.AddrPort
+}
+
+// Agent is a read-only SNMP agent.
+type Agent struct {
+	conf *Config
+
+	// connMu protects conn.
+	connMu *sync.Mutex
+
+	// conn is the connection the agent listens on.  It's nil if the agent
+	// isn't started.
+	conn net.PacketConn
+
+	// users are the SNMPv3 users by their names.
+	users map[string]*user
+
+	// start is the time the agent has been created.  It's used as the engine
+	// start time and for sysUpTime.
+	start time.Time
+
+	// engineID is the identifier of the SNMP engine.
+	engineID []byte
+
+	// usmStats are the counters of the usmStats group.
+	usmStats [usmStatsDecryptionErrors + 1]atomic.Uint32
+
+	// salt is the salt of the encrypted responses.
+	salt atomic.Uint64
+}
+
+// New returns a new properly initialized agent.  conf must not be modified
+// after calling New.
+func New(conf *Config) (a *Agent, err error) {
+	if conf.Community == "" && len(conf.Users) == 0 {
+		return nil, errors.Error("no community and no users")
+	}
+
+	a = &Agent{
+		conf:   conf,
+		connMu: &sync.Mutex{},
+		users:  make(map[string]*user, len(conf.Users)),
+		start:  time.Now(),
+	}
+
+	// AdGuard Home has no private enterprise number, so the reserved zero one
+	// is used along with the random octets format, see RFC 3411.
+	a.engineID = make([]byte, 5+8)
+	a.engineID[0] = 0x80
+	a.engineID[4] = 0x05
+
+	var salt [8]byte
+	for _, b := range [][]byte{a.engineID[5:], salt[:]} {
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("generating random data: %w", err)
+		}
+	}
+
+	a.salt.Store(binary.BigEndian.Uint64(salt[:]))
+
+	for i, u := range conf.Users {
+		err = u.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("user at index %d: %w", i, err)
+		} else if _, ok := a.users[u.Name]; ok {
+			return nil, fmt.Errorf("user at index %d: duplicate name %q", i, u.Name)
+		}
+
+		a.users[u.Name] = newUser(u, a.engineID)
+	}
+
+	return a, nil
+}
+
+// Start starts listening for the requests.
+func (a *Agent) Start() (err error) {
+	a.connMu.Lock()
+	defer a.connMu.Unlock()
+
+	if a.conn != nil {
+		return errors.Error("already started")
+	}
+
+	a.conn, err = net.ListenUDP("udp", net.UDPAddrFromAddrPort(a.conf.Addr))
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	log.Info("snmp: listening on %s", a.conn.LocalAddr())
+
+	go a.serve(a.conn)
+
+	return nil
+}
+
+// Close stops the agent.
+func (a *Agent) Close() (err error) {
+	a.connMu.Lock()
+	defer a.connMu.Unlock()
+
+	if a.conn == nil {
+		return nil
+	}
+
+	err = a.conn.Close()
+	a.conn = nil
+
+	return err
+}
+
+// serve reads and answers the requests from conn until it's closed.
+func (a *Agent) serve(conn net.PacketConn) {
+	defer log.OnPanic("snmp: serving")
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Error("snmp: reading: %s", err)
+
+			continue
+		}
+
+		resp, err := a.handle(buf[:n])
+		if err != nil {
+			log.Debug("snmp: request from %s: %s", addr, err)
+
+			continue
+		} else if resp == nil {
+			continue
+		}
+
+		_, err = conn.WriteTo(resp, addr)
+		if err != nil {
+			log.Debug("snmp: writing response to %s: %s", addr, err)
+		}
+	}
+}
+
+// handle returns the response to the message in data.  resp is nil if the
+// message must be dropped silently.
+func (a *Agent) handle(data []byte) (resp []byte, err error) {
+	r := &berReader{data: data}
+	msg, err := r.readSeq()
+	if err != nil {
+		return nil, fmt.Errorf("message: %w", err)
+	}
+
+	version, err := msg.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("version: %w", err)
+	}
+
+	switch version {
+	case versionV2c:
+		return a.handleV2c(msg)
+	case versionV3:
+		return a.handleV3(data, msg)
+	default:
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+}
+
+// handleV2c returns the response to the SNMPv2c message read from r.
+func (a *Agent) handleV2c(r *berReader) (resp []byte, err error) {
+	if a.conf.Community == "" {
+		return nil, errors.Error("snmpv2c is disabled")
+	}
+
+	community, err := r.expect(tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("community: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare(community, []byte(a.conf.Community)) != 1 {
+		return nil, errors.Error("bad community")
+	}
+
+	tag, content, _, err := r.next()
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	req, err := decodeRequest(tag, content)
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	pdu := a.respond(req, maxMsgSize-msgOverhead)
+
+	var msg []byte
+	msg = appendTLV(msg, tagInteger, encodeInt(versionV2c))
+	msg = appendTLV(msg, tagOctetString, community)
+	msg = append(msg, pdu...)
+
+	return appendTLV(nil, tagSequence, msg), nil
+}
+
+// respond returns the encoded response PDU to req.
+func (a *Agent) respond(req *request, maxSize int) (pdu []byte) {
+	vars := append(a.conf.Objects(), a.systemVars()...)
+	resp := newMIB(vars).respond(req, maxSize)
+
+	return appendPDU(nil, pduResponse, req.reqID, resp.errStatus, resp.errIndex, resp.vars)
+}
+
+// systemVars returns the objects of the system group.
+func (a *Agent) systemVars() (vars []*Var) {
+	return []*Var{{
+		OID:   systemOID.Append(1, 0),
+		Value: OctetString(a.conf.Description),
+	}, {
+		OID:   systemOID.Append(2, 0),
+		Value: oidValue(a.conf.ObjectID),
+	}, {
+		OID:   systemOID.Append(3, 0),
+		Value: TimeTicks(time.Since(a.start) / (10 * time.Millisecond)),
+	}, {
+		OID:   systemOID.Append(5, 0),
+		Value: OctetString(a.conf.Name),
+	}}
+}
+
+// oidValue is the OBJECT IDENTIFIER value.
+type oidValue OID
+
+// type check
+var _ Value = oidValue(nil)
+
+// appendTo implements the [Value] interface for oidValue.
+func (v oidValue) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagOID, OID(v).encode())
+}
+
+// engineTime returns the current engine boots and time.  The engine identifier
+// changes on each start, so the boots are always 1.
+func (a *Agent) engineTime() (boots, engineTime uint32) {
+	return 1, uint32(time.Since(a.start) / time.Second)
+}
+
+// handleV3 returns the response to the SNMPv3 message read from r.  data is
+// the whole message.
+func (a *Agent) handleV3(data []byte, r *berReader) (resp []byte, err error) {
+	if len(a.users) == 0 {
+		return nil, errors.Error("snmpv3 is disabled")
+	}
+
+	msg, err := decodeV3(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.flags&flagPriv != 0 && msg.flags&flagAuth == 0 {
+		return nil, errors.Error("privacy without authentication")
+	}
+
+	u, report := a.checkV3(data, msg)
+	if report != 0 {
+		return a.report(msg, u, report)
+	}
+
+	boots, engineTime := a.engineTime()
+	scoped := msg.data
+	if msg.flags&flagPriv != 0 {
+		scoped, err = expectOctetString(scoped)
+		if err != nil || len(msg.privParams) != 8 {
+			return a.report(msg, nil, usmStatsDecryptionErrors)
+		}
+
+		scoped = append([]byte(nil), scoped...)
+		u.crypt(scoped, uint32(msg.boots), uint32(msg.engineTime), msg.privParams, true)
+	}
+
+	s, err := decodeScopedPDU(scoped)
+	if err != nil {
+		if msg.flags&flagPriv != 0 {
+			return a.report(msg, nil, usmStatsDecryptionErrors)
+		}
+
+		return nil, err
+	}
+
+	req, err := decodeRequest(s.pduTag, s.pdu)
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	maxSize := maxMsgSize
+	if msg.maxSize < maxMsgSize {
+		maxSize = int(msg.maxSize)
+	}
+
+	pdu := a.respond(req, maxSize-msgOverhead)
+	scoped = appendScopedPDU(nil, a.engineID, s.contextName, pdu)
+
+	return a.appendV3(msg, u, msg.flags&(flagAuth|flagPriv), scoped, boots, engineTime), nil
+}
+
+// expectOctetString returns the content of the OCTET STRING encoded in data.
+func expectOctetString(data []byte) (content []byte, err error) {
+	return (&berReader{data: data}).expect(tagOctetString)
+}
+
+// checkV3 checks the security parameters of msg decoded from data.  u is the
+// user of the message.  report is the index of the usmStats object to report,
+// if the check failed, and zero otherwise.
+func (a *Agent) checkV3(data []byte, msg *v3Message) (u *user, report int) {
+	if subtle.ConstantTimeCompare(msg.engineID, a.engineID) != 1 {
+		// Also the engine identifier discovery.
+		return nil, usmStatsUnknownEngineIDs
+	}
+
+	u, ok := a.users[string(msg.userName)]
+	if !ok {
+		return nil, usmStatsUnknownUserNames
+	}
+
+	// Require the security level configured for the user.
+	wantFlags := flagAuth
+	if u.privKey != nil {
+		wantFlags |= flagPriv
+	}
+
+	if msg.flags&(flagAuth|flagPriv) != wantFlags {
+		return nil, usmStatsUnsupportedSecLevels
+	}
+
+	if len(msg.authParams) != u.macLen {
+		return nil, usmStatsWrongDigests
+	}
+
+	signed := append([]byte(nil), data...)
+	off := msg.authParamsOffset(data)
+	for i := off; i < off+u.macLen; i++ {
+		signed[i] = 0
+	}
+
+	if !hmac.Equal(u.mac(signed), msg.authParams) {
+		return nil, usmStatsWrongDigests
+	}
+
+	boots, engineTime := a.engineTime()
+	diff := msg.engineTime - int64(engineTime)
+	if msg.boots != int64(boots) || diff > timeWindow || diff < -timeWindow {
+		return u, usmStatsNotInTimeWindows
+	}
+
+	return u, 0
+}
+
+// report returns the report for msg with the usmStats object with the index.
+// The report is authenticated with u, if it's not nil.
+func (a *Agent) report(msg *v3Message, u *user, index int) (resp []byte, err error) {
+	n := a.usmStats[index].Add(1)
+	if msg.flags&flagReportable == 0 {
+		return nil, fmt.Errorf("not reportable, usm stats index %d", index)
+	}
+
+	// Use the request identifier of the plain scoped PDU, if any.
+	var reqID int64
+	if msg.flags&flagPriv == 0 {
+		if s, sErr := decodeScopedPDU(msg.data); sErr == nil {
+			if req, rErr := decodeRequest(s.pduTag, s.pdu); rErr == nil {
+				reqID = req.reqID
+			}
+		}
+	}
+
+	vars := []*Var{{
+		OID:   usmStatsOID.Append(uint32(index), 0),
+		Value: Counter32(n),
+	}}
+
+	pdu := appendPDU(nil, pduReport, reqID, errStatusNoError, 0, vars)
+	scoped := appendScopedPDU(nil, a.engineID, nil, pdu)
+
+	var flags byte
+	if u != nil {
+		flags = flagAuth
+	}
+
+	boots, engineTime := a.engineTime()
+
+	return a.appendV3(msg, u, flags, scoped, boots, engineTime), nil
+}
+
+// appendV3 returns the encoded SNMPv3 response to msg with the scoped PDU.  u
+// must not be nil if flags require authentication.
+func (a *Agent) appendV3(
+	msg *v3Message,
+	u *user,
+	flags byte,
+	scoped []byte,
+	boots uint32,
+	engineTime uint32,
+) (resp []byte) {
+	var privParams []byte
+	data := scoped
+	if flags&flagPriv != 0 {
+		privParams = make([]byte, 8)
+		binary.BigEndian.PutUint64(privParams, a.salt.Add(1))
+
+		enc := append([]byte(nil), scoped...)
+		u.crypt(enc, boots, engineTime, privParams, false)
+		data = appendTLV(nil, tagOctetString, enc)
+	}
+
+	var authParams []byte
+	if flags&flagAuth != 0 {
+		authParams = make([]byte, u.macLen)
+	}
+
+	var sec []byte
+	sec = appendTLV(sec, tagOctetString, a.engineID)
+	sec = appendTLV(sec, tagInteger, encodeInt(int64(boots)))
+	sec = appendTLV(sec, tagInteger, encodeInt(int64(engineTime)))
+	sec = appendTLV(sec, tagOctetString, msg.userName)
+	sec = appendTLV(sec, tagOctetString, authParams)
+	sec = appendTLV(sec, tagOctetString, privParams)
+
+	var global []byte
+	global = appendTLV(global, tagInteger, encodeInt(msg.msgID))
+	global = appendTLV(global, tagInteger, encodeInt(maxMsgSize))
+	global = appendTLV(global, tagOctetString, []byte{flags})
+	global = appendTLV(global, tagInteger, encodeInt(securityModelUSM))
+
+	var content []byte
+	content = appendTLV(content, tagInteger, encodeInt(versionV3))
+	content = appendTLV(content, tagSequence, global)
+	content = appendTLV(content, tagOctetString, appendTLV(nil, tagSequence, sec))
+	content = append(content, data...)
+
+	resp = appendTLV(nil, tagSequence, content)
+	if flags&flagAuth == 0 {
+		return resp
+	}
+
+	// The digest is placed right before the privacy parameters at the end of
+	// the security parameters, which are followed by the data.
+	off := len(resp) - len(data) - len(appendTLV(nil, tagOctetString, privParams)) - u.macLen
+	copy(resp[off:], u.mac(resp))
+
+	return resp
+}
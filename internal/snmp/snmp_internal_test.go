@@ -0,0 +1,280 @@
+package snmp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBaseOID is the base OID of the objects used in tests.
+var testBaseOID = OID{1, 3, 6, 1, 4, 1, 99999}
+
+// newTestAgent returns a new agent exposing two objects under testBaseOID.
+func newTestAgent(t *testing.T, users ...*UserConfig) (a *Agent) {
+	t.Helper()
+
+	a, err := New(&Config{
+		Objects: func() (vars []*Var) {
+			return []*Var{{
+				OID:   testBaseOID.Append(1, 2, 0),
+				Value: Counter64(20),
+			}, {
+				OID:   testBaseOID.Append(1, 1, 0),
+				Value: Counter64(10),
+			}}
+		},
+		Description: "test",
+		Name:        "host",
+		ObjectID:    testBaseOID,
+		Community:   "public",
+		Users:       users,
+		Addr:        netip.AddrPortFrom(netip.IPv4Unspecified(), 0),
+	})
+	require.NoError(t, err)
+
+	return a
+}
+
+// newV2cRequest returns the encoded SNMPv2c request.
+func newV2cRequest(community string, typ byte, a, b int64, oids ...OID) (msg []byte) {
+	vars := make([]*Var, 0, len(oids))
+	for _, oid := range oids {
+		vars = append(vars, &Var{OID: oid, Value: null{}})
+	}
+
+	var content []byte
+	content = appendTLV(content, tagInteger, encodeInt(versionV2c))
+	content = appendTLV(content, tagOctetString, []byte(community))
+	content = append(content, appendPDU(nil, typ, 42, int(a), int(b), vars)...)
+
+	return appendTLV(nil, tagSequence, content)
+}
+
+// newV2cResponse returns the encoded SNMPv2c response.
+func newV2cResponse(vars ...*Var) (msg []byte) {
+	var content []byte
+	content = appendTLV(content, tagInteger, encodeInt(versionV2c))
+	content = appendTLV(content, tagOctetString, []byte("public"))
+	content = append(content, appendPDU(nil, pduResponse, 42, 0, 0, vars)...)
+
+	return appendTLV(nil, tagSequence, content)
+}
+
+func TestLocalizedKey(t *testing.T) {
+	// See RFC 3414, Appendix A.3.2.
+	engineID, err := hex.DecodeString("000000000000000000000002")
+	require.NoError(t, err)
+
+	key := localizedKey(sha1.New, "maplesyrup", engineID)
+
+	assert.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f", hex.EncodeToString(key))
+}
+
+func TestOID(t *testing.T) {
+	oid, err := ParseOID("1.3.6.1.4.1.99999.200")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.3.6.1.4.1.99999.200", oid.String())
+
+	decoded, err := decodeOID(oid.encode())
+	require.NoError(t, err)
+
+	assert.Equal(t, oid, decoded)
+
+	_, err = ParseOID("1")
+	assert.Error(t, err)
+
+	_, err = ParseOID("1.3.x")
+	assert.Error(t, err)
+}
+
+func TestAgent_handle_v2c(t *testing.T) {
+	a := newTestAgent(t)
+
+	first := &Var{OID: testBaseOID.Append(1, 1, 0), Value: Counter64(10)}
+	second := &Var{OID: testBaseOID.Append(1, 2, 0), Value: Counter64(20)}
+	sysDescr := &Var{OID: systemOID.Append(1, 0), Value: OctetString("test")}
+
+	testCases := []struct {
+		name string
+		req  []byte
+		want []byte
+	}{{
+		name: "get",
+		req:  newV2cRequest("public", pduGet, 0, 0, first.OID),
+		want: newV2cResponse(first),
+	}, {
+		name: "get_no_instance",
+		req:  newV2cRequest("public", pduGet, 0, 0, testBaseOID.Append(1, 1, 1)),
+		want: newV2cResponse(&Var{OID: testBaseOID.Append(1, 1, 1), Value: noSuchInstance}),
+	}, {
+		name: "get_no_object",
+		req:  newV2cRequest("public", pduGet, 0, 0, testBaseOID.Append(2)),
+		want: newV2cResponse(&Var{OID: testBaseOID.Append(2), Value: noSuchObject}),
+	}, {
+		name: "get_next",
+		req:  newV2cRequest("public", pduGetNext, 0, 0, testBaseOID),
+		want: newV2cResponse(first),
+	}, {
+		name: "get_next_system",
+		req:  newV2cRequest("public", pduGetNext, 0, 0, systemOID),
+		want: newV2cResponse(sysDescr),
+	}, {
+		name: "get_bulk",
+		req:  newV2cRequest("public", pduGetBulk, 0, 5, first.OID),
+		want: newV2cResponse(
+			second,
+			&Var{OID: second.OID, Value: endOfMIBView},
+		),
+	}, {
+		name: "bad_community",
+		req:  newV2cRequest("private", pduGet, 0, 0, first.OID),
+		want: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, _ := a.handle(tc.req)
+			assert.Equal(t, tc.want, resp)
+		})
+	}
+
+	t.Run("set", func(t *testing.T) {
+		resp, err := a.handle(newV2cRequest("public", pduSet, 0, 0, first.OID))
+		require.NoError(t, err)
+
+		var content []byte
+		content = appendTLV(content, tagInteger, encodeInt(versionV2c))
+		content = appendTLV(content, tagOctetString, []byte("public"))
+		content = append(content, appendPDU(nil, pduResponse, 42, errStatusNoAccess, 1, []*Var{{
+			OID:   first.OID,
+			Value: null{},
+		}})...)
+
+		assert.Equal(t, appendTLV(nil, tagSequence, content), resp)
+	})
+}
+
+// decodeV3Response decodes the SNMPv3 response of a.
+func decodeV3Response(t *testing.T, resp []byte) (msg *v3Message) {
+	t.Helper()
+
+	r := &berReader{data: resp}
+	seq, err := r.readSeq()
+	require.NoError(t, err)
+
+	version, err := seq.readInt()
+	require.NoError(t, err)
+	require.Equal(t, int64(versionV3), version)
+
+	msg, err = decodeV3(seq)
+	require.NoError(t, err)
+
+	return msg
+}
+
+func TestAgent_handle_v3(t *testing.T) {
+	conf := &UserConfig{
+		Name:         "monitor",
+		AuthProtocol: AuthSHA256,
+		AuthPassword: "authpassword",
+		PrivPassword: "privpassword",
+	}
+	a := newTestAgent(t, conf)
+	u := a.users[conf.Name]
+
+	oid := testBaseOID.Append(1, 1, 0)
+	pdu := appendPDU(nil, pduGet, 42, 0, 0, []*Var{{OID: oid, Value: null{}}})
+
+	t.Run("discovery", func(t *testing.T) {
+		// A discovery request has no engine identifier and no user.
+		var sec []byte
+		for i := 0; i < 6; i++ {
+			if i == 1 || i == 2 {
+				sec = appendTLV(sec, tagInteger, encodeInt(0))
+			} else {
+				sec = appendTLV(sec, tagOctetString, nil)
+			}
+		}
+
+		var global []byte
+		global = appendTLV(global, tagInteger, encodeInt(1))
+		global = appendTLV(global, tagInteger, encodeInt(maxMsgSize))
+		global = appendTLV(global, tagOctetString, []byte{flagReportable})
+		global = appendTLV(global, tagInteger, encodeInt(securityModelUSM))
+
+		var content []byte
+		content = appendTLV(content, tagInteger, encodeInt(versionV3))
+		content = appendTLV(content, tagSequence, global)
+		content = appendTLV(content, tagOctetString, appendTLV(nil, tagSequence, sec))
+		content = appendScopedPDU(content, nil, nil, pdu)
+
+		resp, err := a.handle(appendTLV(nil, tagSequence, content))
+		require.NoError(t, err)
+
+		msg := decodeV3Response(t, resp)
+		assert.Equal(t, a.engineID, msg.engineID)
+		assert.Zero(t, msg.flags)
+
+		s, err := decodeScopedPDU(msg.data)
+		require.NoError(t, err)
+
+		assert.Equal(t, pduReport, s.pduTag)
+	})
+
+	t.Run("auth_priv", func(t *testing.T) {
+		req := &v3Message{
+			userName: []byte(conf.Name),
+			msgID:    1,
+		}
+
+		boots, engineTime := a.engineTime()
+		scoped := appendScopedPDU(nil, a.engineID, nil, pdu)
+		flags := flagAuth | flagPriv | flagReportable
+
+		resp, err := a.handle(a.appendV3(req, u, flags, scoped, boots, engineTime))
+		require.NoError(t, err)
+
+		msg := decodeV3Response(t, resp)
+		assert.Equal(t, flagAuth|flagPriv, msg.flags)
+
+		_, report := a.checkV3(resp, msg)
+		require.Zero(t, report)
+
+		data, err := expectOctetString(msg.data)
+		require.NoError(t, err)
+
+		u.crypt(data, uint32(msg.boots), uint32(msg.engineTime), msg.privParams, true)
+
+		s, err := decodeScopedPDU(data)
+		require.NoError(t, err)
+
+		want := appendPDU(nil, pduResponse, 42, 0, 0, []*Var{{OID: oid, Value: Counter64(10)}})
+		assert.Equal(t, want, appendTLV(nil, s.pduTag, s.pdu))
+	})
+
+	t.Run("wrong_digest", func(t *testing.T) {
+		req := &v3Message{
+			userName: []byte(conf.Name),
+			msgID:    2,
+		}
+
+		boots, engineTime := a.engineTime()
+		scoped := appendScopedPDU(nil, a.engineID, nil, pdu)
+		flags := flagAuth | flagPriv | flagReportable
+
+		msg := a.appendV3(req, u, flags, scoped, boots, engineTime)
+		msg[len(msg)-1] ^= 0xff
+
+		resp, err := a.handle(msg)
+		require.NoError(t, err)
+
+		got := decodeV3Response(t, resp)
+		assert.Zero(t, got.flags)
+		assert.EqualValues(t, 1, a.usmStats[usmStatsWrongDigests].Load())
+	})
+}
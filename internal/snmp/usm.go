@@ -0,0 +1,364 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// AuthProtocol is the authentication protocol of an SNMPv3 user.
+type AuthProtocol string
+
+// Supported authentication protocols.
+const (
+	// AuthSHA is the HMAC-SHA-96 authentication protocol, see RFC 3414.
+	AuthSHA AuthProtocol = "SHA"
+
+	// AuthSHA256 is the HMAC-SHA-256-192 authentication protocol, see RFC
+	// 7860.
+	AuthSHA256 AuthProtocol = "SHA-256"
+)
+
+// params returns the hash function and the length of the truncated digest of
+// the protocol.
+func (p AuthProtocol) params() (newHash func() hash.Hash, macLen int, err error) {
+	switch p {
+	case AuthSHA:
+		return sha1.New, 12, nil
+	case AuthSHA256:
+		return sha256.New, 24, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported auth protocol %q", p)
+	}
+}
+
+// minPasswordLen is the minimum length of the passwords of the SNMPv3 users,
+// see RFC 3414.
+const minPasswordLen = 8
+
+// UserConfig is the configuration of an SNMPv3 user.
+type UserConfig struct {
+	// Name is the name of the user.
+	Name string `yaml:"name"`
+
+	// AuthProtocol is the authentication protocol.
+	AuthProtocol AuthProtocol `yaml:"auth_protocol"`
+
+	// AuthPassword is the authentication password.
+	AuthPassword string `yaml:"auth_password"`
+
+	// PrivPassword, if not empty, is the privacy password.  The requests and
+	// the responses are encrypted with AES-128 using it.
+	PrivPassword string `yaml:"priv_password"`
+}
+
+// Validate returns an error if the user configuration isn't valid.
+func (c *UserConfig) Validate() (err error) {
+	if c == nil {
+		return errors.Error("no value")
+	} else if c.Name == "" {
+		return errors.Error("name: empty value")
+	}
+
+	_, _, err = c.AuthProtocol.params()
+	if err != nil {
+		return fmt.Errorf("auth_protocol: %w", err)
+	}
+
+	if len(c.AuthPassword) < minPasswordLen {
+		return fmt.Errorf("auth_password: must be at least %d characters", minPasswordLen)
+	} else if c.PrivPassword != "" && len(c.PrivPassword) < minPasswordLen {
+		return fmt.Errorf("priv_password: must be at least %d characters", minPasswordLen)
+	}
+
+	return nil
+}
+
+// user is an SNMPv3 user with the keys localized to the engine.
+type user struct {
+	newHash func() hash.Hash
+
+	// authKey is the localized authentication key.
+	authKey []byte
+
+	// privKey is the localized privacy key.  It's nil if the privacy is
+	// disabled for the user.
+	privKey []byte
+
+	// macLen is the length of the truncated digest.
+	macLen int
+}
+
+// newUser returns a new user with the keys localized to engineID.  conf must
+// be valid.
+func newUser(conf *UserConfig, engineID []byte) (u *user) {
+	newHash, macLen, _ := conf.AuthProtocol.params()
+
+	u = &user{
+		newHash: newHash,
+		authKey: localizedKey(newHash, conf.AuthPassword, engineID),
+		macLen:  macLen,
+	}
+
+	if conf.PrivPassword != "" {
+		// AES-128 uses the first 16 bytes of the localized key, see RFC 3826.
+		u.privKey = localizedKey(newHash, conf.PrivPassword, engineID)[:16]
+	}
+
+	return u
+}
+
+// localizedKey returns the key derived from the password and localized to
+// engineID as described in RFC 3414, Appendix A.2.
+func localizedKey(newHash func() hash.Hash, password string, engineID []byte) (key []byte) {
+	const passwordBufLen = 1024 * 1024
+
+	h := newHash()
+	pw := []byte(password)
+
+	var buf [64]byte
+	for n, i := 0, 0; n < passwordBufLen; n += len(buf) {
+		for j := range buf {
+			buf[j] = pw[i%len(pw)]
+			i++
+		}
+
+		_, _ = h.Write(buf[:])
+	}
+
+	ku := h.Sum(nil)
+
+	h.Reset()
+	_, _ = h.Write(ku)
+	_, _ = h.Write(engineID)
+	_, _ = h.Write(ku)
+
+	return h.Sum(nil)
+}
+
+// mac returns the truncated HMAC of msg.
+func (u *user) mac(msg []byte) (sum []byte) {
+	h := hmac.New(u.newHash, u.authKey)
+	_, _ = h.Write(msg)
+
+	return h.Sum(nil)[:u.macLen]
+}
+
+// crypt encrypts or decrypts data in place with AES-128 in CFB mode as
+// described in RFC 3826.
+func (u *user) crypt(data []byte, boots, engineTime uint32, salt []byte, decrypt bool) {
+	// The key length is checked in newUser.
+	block, _ := aes.NewCipher(u.privKey)
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[0:4], boots)
+	binary.BigEndian.PutUint32(iv[4:8], engineTime)
+	copy(iv[8:], salt)
+
+	var s cipher.Stream
+	if decrypt {
+		s = cipher.NewCFBDecrypter(block, iv)
+	} else {
+		s = cipher.NewCFBEncrypter(block, iv)
+	}
+
+	s.XORKeyStream(data, data)
+}
+
+// Flags of SNMPv3 messages.
+const (
+	flagAuth       byte = 0x01
+	flagPriv       byte = 0x02
+	flagReportable byte = 0x04
+)
+
+// securityModelUSM is the identifier of the user-based security model.
+const securityModelUSM = 3
+
+// v3Message is a decoded SNMPv3 message.
+type v3Message struct {
+	// engineID is the authoritative engine identifier.
+	engineID []byte
+
+	// userName is the name of the user.
+	userName []byte
+
+	// authParams is the digest of the message.  It points into the original
+	// message data.
+	authParams []byte
+
+	// privParams is the salt of the encrypted data.
+	privParams []byte
+
+	// data is either the encoded scoped PDU, or the encrypted one, if the
+	// privacy flag is set.
+	data []byte
+
+	// msgID is the identifier of the message.
+	msgID int64
+
+	// maxSize is the maximum size of the response supported by the sender.
+	maxSize int64
+
+	// boots is the authoritative engine boots.
+	boots int64
+
+	// engineTime is the authoritative engine time.
+	engineTime int64
+
+	// flags are the message flags.
+	flags byte
+}
+
+// decodeV3 decodes the SNMPv3 message from r, which must be positioned right
+// after the version.
+func decodeV3(r *berReader) (msg *v3Message, err error) {
+	msg = &v3Message{}
+
+	global, err := r.readSeq()
+	if err != nil {
+		return nil, fmt.Errorf("global data: %w", err)
+	}
+
+	msg.msgID, err = global.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("msg id: %w", err)
+	}
+
+	msg.maxSize, err = global.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("max size: %w", err)
+	}
+
+	flags, err := global.expect(tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	} else if len(flags) != 1 {
+		return nil, fmt.Errorf("flags: bad length %d", len(flags))
+	}
+
+	msg.flags = flags[0]
+
+	model, err := global.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("security model: %w", err)
+	} else if model != securityModelUSM {
+		return nil, fmt.Errorf("unsupported security model %d", model)
+	}
+
+	secParams, err := r.expect(tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("security params: %w", err)
+	}
+
+	err = msg.decodeSecParams(&berReader{data: secParams})
+	if err != nil {
+		return nil, fmt.Errorf("security params: %w", err)
+	}
+
+	_, _, msg.data, err = r.next()
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+
+	return msg, nil
+}
+
+// decodeSecParams decodes the USM security parameters.
+func (msg *v3Message) decodeSecParams(r *berReader) (err error) {
+	seq, err := r.readSeq()
+	if err != nil {
+		return err
+	}
+
+	msg.engineID, err = seq.expect(tagOctetString)
+	if err != nil {
+		return fmt.Errorf("engine id: %w", err)
+	}
+
+	msg.boots, err = seq.readInt()
+	if err != nil {
+		return fmt.Errorf("engine boots: %w", err)
+	}
+
+	msg.engineTime, err = seq.readInt()
+	if err != nil {
+		return fmt.Errorf("engine time: %w", err)
+	}
+
+	msg.userName, err = seq.expect(tagOctetString)
+	if err != nil {
+		return fmt.Errorf("user name: %w", err)
+	}
+
+	msg.authParams, err = seq.expect(tagOctetString)
+	if err != nil {
+		return fmt.Errorf("auth params: %w", err)
+	}
+
+	msg.privParams, err = seq.expect(tagOctetString)
+	if err != nil {
+		return fmt.Errorf("priv params: %w", err)
+	}
+
+	return nil
+}
+
+// authParamsOffset returns the offset of the authentication parameters of msg
+// within data, from which msg has been decoded.  The decoded values keep the
+// capacity of the original data, so the offset is derived from it.
+func (msg *v3Message) authParamsOffset(data []byte) (off int) {
+	return cap(data) - cap(msg.authParams)
+}
+
+// scopedPDU is a decoded scoped PDU.
+type scopedPDU struct {
+	contextName []byte
+	pdu         []byte
+	pduTag      byte
+}
+
+// decodeScopedPDU decodes the plain scoped PDU.
+func decodeScopedPDU(data []byte) (s *scopedPDU, err error) {
+	r := &berReader{data: data}
+	seq, err := r.readSeq()
+	if err != nil {
+		return nil, fmt.Errorf("scoped pdu: %w", err)
+	}
+
+	// Ignore the context engine identifier, since there is the only context.
+	_, err = seq.expect(tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("context engine id: %w", err)
+	}
+
+	s = &scopedPDU{}
+	s.contextName, err = seq.expect(tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("context name: %w", err)
+	}
+
+	s.pduTag, s.pdu, _, err = seq.next()
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	return s, nil
+}
+
+// appendScopedPDU appends the BER encoding of the scoped PDU to b.
+func appendScopedPDU(b, engineID, contextName, pdu []byte) (res []byte) {
+	var content []byte
+	content = appendTLV(content, tagOctetString, engineID)
+	content = appendTLV(content, tagOctetString, contextName)
+	content = append(content, pdu...)
+
+	return appendTLV(b, tagSequence, content)
+}
@@ -0,0 +1,303 @@
+package snmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// OID is an object identifier.
+type OID []uint32
+
+// ParseOID parses the dotted representation of an OID, for example
+// "1.3.6.1.4.1".
+func ParseOID(s string) (oid OID, err error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("bad oid %q: too short", s)
+	}
+
+	oid = make(OID, 0, len(parts))
+	for _, p := range parts {
+		var n uint64
+		n, err = strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad oid %q: %w", s, err)
+		}
+
+		oid = append(oid, uint32(n))
+	}
+
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] > 39) {
+		return nil, fmt.Errorf("bad oid %q: bad first arcs", s)
+	}
+
+	return oid, nil
+}
+
+// String implements the [fmt.Stringer] interface for OID.
+func (oid OID) String() (s string) {
+	parts := make([]string, len(oid))
+	for i, n := range oid {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Append returns a new OID consisting of oid followed by arcs.
+func (oid OID) Append(arcs ...uint32) (res OID) {
+	res = make(OID, 0, len(oid)+len(arcs))
+	res = append(res, oid...)
+
+	return append(res, arcs...)
+}
+
+// compare returns -1, 0, or 1 if oid is lexicographically less than, equal
+// to, or greater than other.
+func (oid OID) compare(other OID) (res int) {
+	for i := 0; i < len(oid) && i < len(other); i++ {
+		switch {
+		case oid[i] < other[i]:
+			return -1
+		case oid[i] > other[i]:
+			return 1
+		default:
+			// Go on.
+		}
+	}
+
+	switch {
+	case len(oid) < len(other):
+		return -1
+	case len(oid) > len(other):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// encode returns the BER content of oid.
+func (oid OID) encode() (b []byte) {
+	if len(oid) < 2 {
+		// Encode the invalid identifiers as "0.0".
+		return []byte{0}
+	}
+
+	b = appendBase128(b, oid[0]*40+oid[1])
+	for _, n := range oid[2:] {
+		b = appendBase128(b, n)
+	}
+
+	return b
+}
+
+// appendBase128 appends the base-128 encoding of n to b.
+func appendBase128(b []byte, n uint32) (res []byte) {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		tmp[i] = byte(n&0x7f) | 0x80
+	}
+
+	return append(b, tmp[i:]...)
+}
+
+// decodeOID decodes the BER content of an OID.
+func decodeOID(b []byte) (oid OID, err error) {
+	if len(b) == 0 {
+		return nil, errors.Error("empty oid")
+	}
+
+	var n uint64
+	for i, c := range b {
+		n = n<<7 | uint64(c&0x7f)
+		if n > 0xffff_ffff {
+			return nil, errors.Error("oid arc overflow")
+		}
+
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, errTruncated
+			}
+
+			continue
+		}
+
+		if len(oid) == 0 {
+			first := n / 40
+			if first > 2 {
+				first = 2
+			}
+
+			oid = append(oid, uint32(first), uint32(n-first*40))
+		} else {
+			oid = append(oid, uint32(n))
+		}
+
+		n = 0
+	}
+
+	return oid, nil
+}
+
+// Value is a value of an SNMP object.
+type Value interface {
+	// appendTo appends the BER encoding of the value to b.
+	appendTo(b []byte) (res []byte)
+}
+
+// Integer is the INTEGER value.
+type Integer int32
+
+// type check
+var _ Value = Integer(0)
+
+// appendTo implements the [Value] interface for Integer.
+func (v Integer) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagInteger, encodeInt(int64(v)))
+}
+
+// OctetString is the OCTET STRING value.
+type OctetString string
+
+// type check
+var _ Value = OctetString("")
+
+// appendTo implements the [Value] interface for OctetString.
+func (v OctetString) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagOctetString, []byte(v))
+}
+
+// Counter32 is the Counter32 value.
+type Counter32 uint32
+
+// type check
+var _ Value = Counter32(0)
+
+// appendTo implements the [Value] interface for Counter32.
+func (v Counter32) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagCounter32, encodeUint(uint64(v)))
+}
+
+// Gauge32 is the Gauge32 value.
+type Gauge32 uint32
+
+// type check
+var _ Value = Gauge32(0)
+
+// appendTo implements the [Value] interface for Gauge32.
+func (v Gauge32) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagGauge32, encodeUint(uint64(v)))
+}
+
+// TimeTicks is the TimeTicks value, in hundredths of a second.
+type TimeTicks uint32
+
+// type check
+var _ Value = TimeTicks(0)
+
+// appendTo implements the [Value] interface for TimeTicks.
+func (v TimeTicks) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagTimeTicks, encodeUint(uint64(v)))
+}
+
+// Counter64 is the Counter64 value.
+type Counter64 uint64
+
+// type check
+var _ Value = Counter64(0)
+
+// appendTo implements the [Value] interface for Counter64.
+func (v Counter64) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagCounter64, encodeUint(uint64(v)))
+}
+
+// exception is one of the exception values of the variable bindings in the
+// responses.
+type exception byte
+
+// Exception values.
+const (
+	noSuchObject   = exception(tagNoSuchObject)
+	noSuchInstance = exception(tagNoSuchInstance)
+	endOfMIBView   = exception(tagEndOfMIBView)
+)
+
+// type check
+var _ Value = noSuchObject
+
+// appendTo implements the [Value] interface for exception.
+func (v exception) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, byte(v), nil)
+}
+
+// null is the NULL value used in the variable bindings of the requests.
+type null struct{}
+
+// type check
+var _ Value = null{}
+
+// appendTo implements the [Value] interface for null.
+func (null) appendTo(b []byte) (res []byte) {
+	return appendTLV(b, tagNull, nil)
+}
+
+// Var is a variable binding, an object identifier with its value.
+type Var struct {
+	// Value is the value of the object.
+	Value Value
+
+	// OID is the identifier of the object.
+	OID OID
+}
+
+// appendVars appends the BER encoding of the variable bindings list to b.
+func appendVars(b []byte, vars []*Var) (res []byte) {
+	var list []byte
+	for _, v := range vars {
+		var vb []byte
+		vb = appendTLV(vb, tagOID, v.OID.encode())
+		vb = v.Value.appendTo(vb)
+		list = appendTLV(list, tagSequence, vb)
+	}
+
+	return appendTLV(b, tagSequence, list)
+}
+
+// decodeVarOIDs decodes the variable bindings list and returns their
+// identifiers, since the values of the requests are ignored.
+func decodeVarOIDs(r *berReader) (oids []OID, err error) {
+	list, err := r.readSeq()
+	if err != nil {
+		return nil, fmt.Errorf("variable bindings: %w", err)
+	}
+
+	for !list.empty() {
+		var vb *berReader
+		vb, err = list.readSeq()
+		if err != nil {
+			return nil, fmt.Errorf("variable binding: %w", err)
+		}
+
+		var content []byte
+		content, err = vb.expect(tagOID)
+		if err != nil {
+			return nil, fmt.Errorf("variable binding: %w", err)
+		}
+
+		var oid OID
+		oid, err = decodeOID(content)
+		if err != nil {
+			return nil, fmt.Errorf("variable binding: %w", err)
+		}
+
+		oids = append(oids, oid)
+	}
+
+	return oids, nil
+}
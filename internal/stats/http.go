@@ -5,11 +5,15 @@ package stats
 import (
 	"encoding/json"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/timeutil"
 	"golang.org/x/exp/slices"
@@ -27,6 +31,16 @@ type StatsResp struct {
 	TopClients []topAddrs `json:"top_clients"`
 	TopBlocked []topAddrs `json:"top_blocked_domains"`
 
+	TopThreatFeeds      []topAddrs `json:"top_threat_feeds"`
+	TopThreatCategories []topAddrs `json:"top_threat_categories"`
+
+	TopRefusedQueryTypes []topAddrs `json:"top_refused_query_types"`
+
+	TopClientsBytesIn    []topAddrs `json:"top_clients_bytes_in"`
+	TopClientsBytesOut   []topAddrs `json:"top_clients_bytes_out"`
+	TopProtocolsBytesIn  []topAddrs `json:"top_protocols_bytes_in"`
+	TopProtocolsBytesOut []topAddrs `json:"top_protocols_bytes_out"`
+
 	DNSQueries []uint64 `json:"dns_queries"`
 
 	BlockedFiltering     []uint64 `json:"blocked_filtering"`
@@ -38,6 +52,8 @@ type StatsResp struct {
 	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
 	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
 	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumBytesIn              uint64 `json:"num_bytes_in"`
+	NumBytesOut             uint64 `json:"num_bytes_out"`
 
 	AvgProcessingTime float64 `json:"avg_processing_time"`
 }
@@ -189,8 +205,113 @@ func (s *StatsCtx) handlePutStatsConfig(w http.ResponseWriter, r *http.Request)
 	s.enabled = reqData.Enabled == aghalg.NBTrue
 }
 
+// statusResp is the response to the GET /control/stats/status.
+type statusResp struct {
+	// LastCompaction is the time of the last compaction of the database, if
+	// any.
+	LastCompaction *time.Time `json:"last_compaction,omitempty"`
+
+	// Size is the size of the database in bytes.
+	Size int64 `json:"db_size"`
+
+	// FreeSize is the total size of the free pages of the database in bytes.
+	FreeSize int64 `json:"free_size"`
+
+	// Fragmentation is the share of the free pages in the database in
+	// percents.
+	Fragmentation float64 `json:"fragmentation"`
+
+	// PendingUnits is the number of finished hourly units, which aren't written
+	// to the database yet.
+	PendingUnits int `json:"pending_units"`
+}
+
+// handleGetStatsStatus handles requests to the GET /control/stats/status
+// endpoint.
+func (s *StatsCtx) handleGetStatsStatus(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.status()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "stats: %s", err)
+
+		return
+	}
+
+	resp := &statusResp{
+		Size:         st.size,
+		FreeSize:     st.freeSize,
+		PendingUnits: st.pendingUnits,
+	}
+
+	if st.size > 0 {
+		resp.Fragmentation = float64(st.freeSize) * 100 / float64(st.size)
+	}
+
+	if !st.lastCompact.IsZero() {
+		resp.LastCompaction = &st.lastCompact
+	}
+
+	_ = aghhttp.WriteJSONResponse(w, r, resp)
+}
+
+// handleStatsCompact handles requests to the POST /control/stats/compact
+// endpoint.
+func (s *StatsCtx) handleStatsCompact(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.compact()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "stats: %s", err)
+	}
+}
+
+// relocateReq is the request to the POST /control/stats/relocate HTTP API.
+type relocateReq struct {
+	// DirPath is the absolute path to the existing directory the database is
+	// moved into.
+	DirPath string `json:"dir_path"`
+}
+
+// handleStatsRelocate handles requests to the POST /control/stats/relocate
+// endpoint.
+func (s *StatsCtx) handleStatsRelocate(w http.ResponseWriter, r *http.Request) {
+	req := &relocateReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	dir := filepath.Clean(req.DirPath)
+	err = aghos.CheckDir(dir)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "dir_path: %s", err)
+
+		return
+	}
+
+	defer s.configModified()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err = s.relocate(dir)
+	if errors.Is(err, os.ErrExist) {
+		aghhttp.Error(r, w, http.StatusConflict, "stats: %s", err)
+	} else if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "stats: %s", err)
+	}
+}
+
 // handleStatsReset handles requests to the POST /control/stats_reset endpoint.
 func (s *StatsCtx) handleStatsReset(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	err := s.clear()
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusInternalServerError, "stats: %s", err)
@@ -210,4 +331,7 @@ func (s *StatsCtx) initWeb() {
 
 	s.httpRegister(http.MethodGet, "/control/stats/config", s.handleGetStatsConfig)
 	s.httpRegister(http.MethodPut, "/control/stats/config/update", s.handlePutStatsConfig)
+	s.httpRegister(http.MethodGet, "/control/stats/status", s.handleGetStatsStatus)
+	s.httpRegister(http.MethodPost, "/control/stats/compact", s.handleStatsCompact)
+	s.httpRegister(http.MethodPost, "/control/stats/relocate", s.handleStatsRelocate)
 }
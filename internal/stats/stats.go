@@ -8,11 +8,13 @@ import (
 	"net"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -40,6 +42,10 @@ func validateIvl(ivl time.Duration) (err error) {
 	return nil
 }
 
+// compactTxMaxSize is the maximum size of a single transaction used to copy the
+// data into the compacted database.
+const compactTxMaxSize = 64 * 1024
+
 // Config is the configuration structure for the statistics collecting.
 type Config struct {
 	// UnitID is the function to generate the identifier for current unit.  If
@@ -60,6 +66,16 @@ type Config struct {
 	// Limit is an upper limit for collecting statistics.
 	Limit time.Duration
 
+	// CompactIvl is the interval between the compactions of the database.  If
+	// zero, the database is only compacted on request.  Otherwise, it must not
+	// be less than an hour.
+	CompactIvl time.Duration
+
+	// FlushBatch is the number of finished units to write into the database in
+	// a single transaction.  Greater values reduce the number of writes at the
+	// cost of losing more data on a crash.  Zero is treated as one.
+	FlushBatch uint
+
 	// Enabled tells if the statistics are enabled.
 	Enabled bool
 
@@ -86,15 +102,21 @@ type Interface interface {
 
 	// ShouldCount returns true if request for the host should be counted.
 	ShouldCount(host string, qType, qClass uint16) bool
+
+	// PruneOldest deletes the older half of the stored statistics.
+	PruneOldest() (err error)
 }
 
 // StatsCtx collects the statistics and flushes it to the database.  Its default
 // flushing interval is one hour.
 type StatsCtx struct {
-	// currMu protects curr.
+	// currMu protects curr and pending.
 	currMu *sync.RWMutex
 	// curr is the actual statistics collection result.
 	curr *unit
+	// pending are the finished units, which aren't written to the database
+	// yet.
+	pending []*unit
 
 	// db is the opened statistics database, if any.
 	db atomic.Pointer[bbolt.DB]
@@ -113,9 +135,25 @@ type StatsCtx struct {
 	// filename is the name of database file.
 	filename string
 
+	// flushBatch is the number of finished units to write into the database
+	// in a single transaction.
+	flushBatch int
+
+	// compactIvl is the interval between the compactions of the database.  If
+	// zero, the database is only compacted on request.
+	compactIvl time.Duration
+
 	// lock protects all the fields below.
 	lock sync.Mutex
 
+	// lastCompact is the time of the last compaction of the database.  It's
+	// zero if there were none.
+	lastCompact time.Time
+
+	// nextCompact is the time of the next periodic compaction of the
+	// database.  It's zero if the periodic compaction is disabled.
+	nextCompact time.Time
+
 	// enabled tells if the statistics are enabled.
 	enabled bool
 
@@ -138,6 +176,8 @@ func New(conf Config) (s *StatsCtx, err error) {
 		configModified: conf.ConfigModified,
 		httpRegister:   conf.HTTPRegister,
 		ignored:        conf.Ignored,
+		flushBatch:     int(conf.FlushBatch),
+		compactIvl:     conf.CompactIvl,
 	}
 
 	err = validateIvl(conf.Limit)
@@ -147,6 +187,18 @@ func New(conf Config) (s *StatsCtx, err error) {
 
 	s.limit = conf.Limit
 
+	if s.compactIvl != 0 {
+		if s.compactIvl < time.Hour {
+			return nil, fmt.Errorf("compact interval: %s is less than an hour", s.compactIvl)
+		}
+
+		s.nextCompact = time.Now().Add(s.compactIvl)
+	}
+
+	if s.flushBatch == 0 {
+		s.flushBatch = 1
+	}
+
 	if s.unitIDGen = newUnitID; conf.UnitID != nil {
 		s.unitIDGen = conf.UnitID
 	}
@@ -215,6 +267,9 @@ func (s *StatsCtx) Start() {
 func (s *StatsCtx) Close() (err error) {
 	defer func() { err = errors.Annotate(err, "stats: closing: %w") }()
 
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	db := s.db.Swap(nil)
 	if db == nil {
 		return nil
@@ -234,8 +289,17 @@ func (s *StatsCtx) Close() (err error) {
 	}
 	defer func() { err = errors.WithDeferred(err, finishTxn(tx, err == nil)) }()
 
-	s.currMu.RLock()
-	defer s.currMu.RUnlock()
+	s.currMu.Lock()
+	defer s.currMu.Unlock()
+
+	for _, u := range s.pending {
+		err = u.serialize().flushUnitToDB(tx, u.id)
+		if err != nil {
+			return fmt.Errorf("flushing pending unit: %w", err)
+		}
+	}
+
+	s.pending = nil
 
 	udb := s.curr.serialize()
 
@@ -272,6 +336,17 @@ func (s *StatsCtx) Update(e Entry) {
 	}
 
 	s.curr.add(e.Result, e.Domain, clientID, uint64(e.Time))
+	if e.ThreatFeed != "" {
+		s.curr.addThreat(e.ThreatFeed, e.ThreatCategory)
+	}
+
+	if e.RefusedQueryType != "" {
+		s.curr.addRefusedQueryType(e.RefusedQueryType)
+	}
+
+	if e.BytesIn != 0 || e.BytesOut != 0 {
+		s.curr.addTraffic(clientID, e.Protocol, e.BytesIn, e.BytesOut)
+	}
 }
 
 // WriteDiskConfig implements the Interface interface for *StatsCtx.
@@ -279,6 +354,7 @@ func (s *StatsCtx) WriteDiskConfig(dc *Config) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
+	dc.Filename = s.filename
 	dc.Limit = s.limit
 	dc.Enabled = s.enabled
 	dc.Ignored = s.ignored
@@ -319,6 +395,210 @@ func (s *StatsCtx) TopClientsIP(maxCount uint) (ips []netip.Addr) {
 	return ips
 }
 
+// PruneOldest implements the [Interface] interface for *StatsCtx.  The size of
+// the database file doesn't decrease, but the freed pages are reused for the
+// new units.
+func (s *StatsCtx) PruneOldest() (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	db := s.db.Load()
+	if db == nil {
+		return nil
+	}
+
+	id := s.unitIDGen()
+	limit := uint32(s.limit.Hours())
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("stats: opening transaction: %w", err)
+	}
+
+	deleted := deleteOldUnits(tx, id-limit/2)
+	log.Debug("stats: pruned %d units", deleted)
+
+	return finishTxn(tx, deleted > 0)
+}
+
+// dbStatus is the status of the statistics database.
+type dbStatus struct {
+	// lastCompact is the time of the last compaction of the database.  It's
+	// zero if there were none.
+	lastCompact time.Time
+
+	// size is the size of the database in bytes.
+	size int64
+
+	// freeSize is the total size of the free pages of the database in bytes.
+	freeSize int64
+
+	// pendingUnits is the number of finished units, which aren't written to
+	// the database yet.
+	pendingUnits int
+}
+
+// status returns the current status of the database.  s.lock is expected to be
+// locked.
+func (s *StatsCtx) status() (st *dbStatus, err error) {
+	db := s.db.Load()
+	if db == nil {
+		return nil, errors.Error("database is closed")
+	}
+
+	st = &dbStatus{
+		lastCompact: s.lastCompact,
+	}
+
+	err = db.View(func(tx *bbolt.Tx) (_ error) {
+		st.size = tx.Size()
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading database size: %w", err)
+	}
+
+	dbStats := db.Stats()
+	st.freeSize = int64(dbStats.FreePageN+dbStats.PendingPageN) * int64(db.Info().PageSize)
+
+	s.currMu.RLock()
+	defer s.currMu.RUnlock()
+
+	st.pendingUnits = len(s.pending)
+
+	return st, nil
+}
+
+// maybeCompact compacts the database if the time of the next periodic
+// compaction has come.
+func (s *StatsCtx) maybeCompact() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.nextCompact.IsZero() || time.Now().Before(s.nextCompact) {
+		return
+	}
+
+	err := s.compact()
+	if err != nil {
+		log.Error("stats: %s", err)
+	}
+}
+
+// compact copies the data into a new database file without the free pages and
+// replaces the current database file with it.  Unlike [StatsCtx.PruneOldest],
+// it actually decreases the size of the file.  s.lock is expected to be
+// locked.
+func (s *StatsCtx) compact() (err error) {
+	defer func() { err = errors.Annotate(err, "compacting: %w") }()
+
+	// Schedule the next compaction beforehand so that a failed one isn't
+	// retried on each flush.
+	if s.compactIvl != 0 {
+		s.nextCompact = time.Now().Add(s.compactIvl)
+	}
+
+	db := s.db.Load()
+	if db == nil {
+		return nil
+	}
+
+	tmpName := s.filename + ".compact"
+	err = compactInto(db, tmpName)
+	if err != nil {
+		rmErr := os.Remove(tmpName)
+		if errors.Is(rmErr, os.ErrNotExist) {
+			rmErr = nil
+		}
+
+		return errors.WithDeferred(err, rmErr)
+	}
+
+	// Active transactions will continue using database, but new ones won't be
+	// created.
+	db = s.db.Swap(nil)
+	err = db.Close()
+	if err != nil {
+		return fmt.Errorf("closing database: %w", err)
+	}
+
+	err = os.Rename(tmpName, s.filename)
+	if err != nil {
+		err = fmt.Errorf("replacing database: %w", err)
+
+		return errors.WithDeferred(err, s.openDB())
+	}
+
+	err = s.openDB()
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+
+	s.lastCompact = time.Now()
+	log.Debug("stats: database compacted")
+
+	return nil
+}
+
+// relocate moves the database file into dir and reopens it there.  Like
+// [StatsCtx.compact], it closes the database for the time of moving, so the
+// finished units are kept in memory until the next flush.  s.lock is expected
+// to be locked.
+func (s *StatsCtx) relocate(dir string) (err error) {
+	defer func() { err = errors.Annotate(err, "relocating: %w") }()
+
+	filename := filepath.Join(dir, filepath.Base(s.filename))
+	if filename == s.filename {
+		return nil
+	}
+
+	db := s.db.Swap(nil)
+	if db == nil {
+		return errors.Error("database is closed")
+	}
+
+	err = db.Close()
+	if err != nil {
+		return fmt.Errorf("closing database: %w", err)
+	}
+
+	err = aghos.MoveFile(s.filename, filename)
+	if err != nil {
+		err = fmt.Errorf("moving database: %w", err)
+
+		return errors.WithDeferred(err, s.openDB())
+	}
+
+	log.Info("stats: moved database from %q to %q", s.filename, filename)
+
+	s.filename = filename
+
+	err = s.openDB()
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+
+	return nil
+}
+
+// compactInto copies the data from src into a new database file with the given
+// name, removing the file left from a previous attempt, if any.
+func compactInto(src *bbolt.DB, name string) (err error) {
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing stale file: %w", err)
+	}
+
+	dst, err := bbolt.Open(name, 0o644, nil)
+	if err != nil {
+		return fmt.Errorf("opening destination: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, dst.Close()) }()
+
+	return bbolt.Compact(dst, src, compactTxMaxSize)
+}
+
 // deleteOldUnits walks the buckets available to tx and deletes old units.  It
 // returns the number of deletions performed.
 func deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
@@ -379,6 +659,9 @@ func (s *StatsCtx) openDB() (err error) {
 	return nil
 }
 
+// flush swaps the current unit with the new empty one if the freshly generated
+// unit ID differs from the current's ID and writes the finished units into the
+// database once there are enough of them.
 func (s *StatsCtx) flush() (cont bool, sleepFor time.Duration) {
 	id := s.unitIDGen()
 
@@ -403,50 +686,79 @@ func (s *StatsCtx) flush() (cont bool, sleepFor time.Duration) {
 		return true, 0
 	}
 
-	isCommitable := true
-	tx, err := db.Begin(true)
-	if err != nil {
-		log.Error("stats: opening transaction: %s", err)
+	s.curr = newUnit(id)
+	s.pending = append(s.pending, ptr)
+	if len(s.pending) < s.flushBatch {
+		log.Debug("stats: unit %d is pending, %d in total", ptr.id, len(s.pending))
 
 		return true, 0
 	}
-	defer func() {
-		if err = finishTxn(tx, isCommitable); err != nil {
-			log.Error("stats: %s", err)
+
+	// Avoid the overflow of the identifier, which is only possible in tests.
+	var firstID uint32
+	if id >= limit {
+		firstID = id - limit + 1
+	}
+
+	err := s.writePending(db, firstID)
+	if err != nil {
+		log.Error("stats: %s", err)
+	}
+
+	return true, 0
+}
+
+// writePending writes all the pending units starting from firstID into the
+// database in a single transaction and deletes the older units from it.  The
+// pending units are only dropped if the transaction is committed, so that they
+// are retried on the next flush.  s.currMu is expected to be locked.
+func (s *StatsCtx) writePending(db *bbolt.DB, firstID uint32) (err error) {
+	defer func() { err = errors.Annotate(err, "writing pending units: %w") }()
+
+	// Drop the units, which are already out of the limit.
+	actual := s.pending[:0]
+	for _, u := range s.pending {
+		if u.id >= firstID {
+			actual = append(actual, u)
 		}
-	}()
+	}
 
-	s.curr = newUnit(id)
+	s.pending = actual
 
-	flushErr := ptr.serialize().flushUnitToDB(tx, ptr.id)
-	if flushErr != nil {
-		log.Error("stats: flushing unit: %s", flushErr)
-		isCommitable = false
+	tx, err := db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("opening transaction: %w", err)
 	}
+	defer func() {
+		err = errors.WithDeferred(err, finishTxn(tx, err == nil))
+		if err == nil {
+			s.pending = nil
+		}
+	}()
 
-	delErr := tx.DeleteBucket(idToUnitName(id - limit))
-	if delErr != nil {
-		// TODO(e.burkov):  Improve the algorithm of deleting the oldest bucket
-		// to avoid the error.
-		if errors.Is(delErr, bbolt.ErrBucketNotFound) {
-			log.Debug("stats: warning: deleting unit: %s", delErr)
-		} else {
-			isCommitable = false
-			log.Error("stats: deleting unit: %s", delErr)
+	for _, u := range s.pending {
+		err = u.serialize().flushUnitToDB(tx, u.id)
+		if err != nil {
+			return fmt.Errorf("flushing unit %d: %w", u.id, err)
 		}
 	}
 
-	return true, 0
+	deleteOldUnits(tx, firstID)
+
+	return nil
 }
 
 // periodicFlush checks and flushes the unit to the database if the freshly
 // generated unit ID differs from the current's ID.  Flushing process includes:
 //   - swapping the current unit with the new empty one;
-//   - writing the current unit to the database;
-//   - removing the stale unit from the database.
+//   - writing the batch of finished units to the database;
+//   - removing the stale units from the database.
+//
+// It also compacts the database periodically, if configured.
 func (s *StatsCtx) periodicFlush() {
 	for cont, sleepFor := true, time.Duration(0); cont; time.Sleep(sleepFor) {
 		cont, sleepFor = s.flush()
+		s.maybeCompact()
 	}
 
 	log.Debug("periodic flushing finished")
@@ -515,6 +827,7 @@ func (s *StatsCtx) clear() (err error) {
 	defer s.currMu.Unlock()
 
 	s.curr = newUnit(s.unitIDGen())
+	s.pending = nil
 
 	return nil
 }
@@ -539,6 +852,11 @@ func (s *StatsCtx) loadUnits(limit uint32) (units []*unitDB, firstID uint32) {
 
 	cur := s.curr
 
+	pending := make(map[uint32]*unit, len(s.pending))
+	for _, u := range s.pending {
+		pending[u.id] = u
+	}
+
 	var curID uint32
 	if cur != nil {
 		curID = cur.id
@@ -550,7 +868,13 @@ func (s *StatsCtx) loadUnits(limit uint32) (units []*unitDB, firstID uint32) {
 	units = make([]*unitDB, 0, limit)
 	firstID = curID - limit + 1
 	for i := firstID; i != curID; i++ {
-		u := loadUnitFromDB(tx, i)
+		var u *unitDB
+		if p, ok := pending[i]; ok {
+			u = p.serialize()
+		} else {
+			u = loadUnitFromDB(tx, i)
+		}
+
 		if u == nil {
 			u = &unitDB{NResult: make([]uint64, resultLast)}
 		}
@@ -12,6 +12,7 @@ import (
 	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
 )
 
 // TODO(e.burkov):  Use more realistic data.
@@ -102,3 +103,161 @@ func TestStats_races(t *testing.T) {
 		finWG.Wait()
 	}
 }
+
+// newTestStats returns a new *StatsCtx with the unit identifiers generated from
+// the value of curID and the given flush batch.
+func newTestStats(t *testing.T, curID *uint32, batch uint) (s *StatsCtx) {
+	t.Helper()
+
+	s, err := New(Config{
+		UnitID:     func() (id uint32) { return atomic.LoadUint32(curID) },
+		Filename:   filepath.Join(t.TempDir(), "stats.db"),
+		Limit:      timeutil.Day,
+		FlushBatch: batch,
+		Enabled:    true,
+	})
+	require.NoError(t, err)
+
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	return s
+}
+
+// testEntry is the entry for the tests.
+var testEntry = Entry{
+	Domain: "example.org",
+	Client: "127.0.0.1",
+	Result: RNotFiltered,
+	Time:   123,
+}
+
+// storedUnitIDs returns the identifiers of the units stored in the database of
+// s.
+func storedUnitIDs(t *testing.T, s *StatsCtx) (ids []uint32) {
+	t.Helper()
+
+	err := s.db.Load().View(func(tx *bbolt.Tx) (err error) {
+		return tx.ForEach(func(name []byte, _ *bbolt.Bucket) (_ error) {
+			id, ok := unitNameToID(name)
+			require.True(t, ok)
+
+			ids = append(ids, id)
+
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	return ids
+}
+
+// totalQueries returns the total number of queries in units.
+func totalQueries(units []*unitDB) (n uint64) {
+	for _, u := range units {
+		n += u.NTotal
+	}
+
+	return n
+}
+
+func TestStatsCtx_flush_batch(t *testing.T) {
+	const batch = 3
+
+	var curID uint32 = 100
+	s := newTestStats(t, &curID, batch)
+
+	for i := 1; i < batch; i++ {
+		s.Update(testEntry)
+		atomic.AddUint32(&curID, 1)
+
+		cont, _ := s.flush()
+		require.True(t, cont)
+
+		assert.Empty(t, storedUnitIDs(t, s))
+		assert.Len(t, s.pending, i)
+
+		// The pending units must still be reported.
+		units, _ := s.loadUnits(24)
+		assert.Equal(t, uint64(i), totalQueries(units))
+	}
+
+	s.Update(testEntry)
+	atomic.AddUint32(&curID, 1)
+
+	cont, _ := s.flush()
+	require.True(t, cont)
+
+	assert.Equal(t, []uint32{100, 101, 102}, storedUnitIDs(t, s))
+	assert.Empty(t, s.pending)
+
+	units, _ := s.loadUnits(24)
+	assert.Equal(t, uint64(batch), totalQueries(units))
+}
+
+func TestStatsCtx_compact(t *testing.T) {
+	var curID uint32 = 100
+	s := newTestStats(t, &curID, 1)
+
+	// Make enough units for PruneOldest to delete the half of them.
+	const unitsNum = 24
+	for i := 0; i < unitsNum; i++ {
+		s.Update(testEntry)
+		atomic.AddUint32(&curID, 1)
+
+		_, _ = s.flush()
+	}
+
+	// Free some pages.
+	err := s.PruneOldest()
+	require.NoError(t, err)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	before, err := s.status()
+	require.NoError(t, err)
+
+	assert.True(t, before.lastCompact.IsZero())
+	assert.Positive(t, before.freeSize)
+
+	err = s.compact()
+	require.NoError(t, err)
+
+	after, err := s.status()
+	require.NoError(t, err)
+
+	assert.False(t, after.lastCompact.IsZero())
+	assert.Less(t, after.freeSize, before.freeSize)
+
+	units, _ := s.loadUnits(24)
+	assert.Equal(t, uint64(unitsNum/2), totalQueries(units))
+}
+
+func TestStatsCtx_relocate(t *testing.T) {
+	var curID uint32 = 100
+	s := newTestStats(t, &curID, 1)
+
+	const unitsNum = 3
+	for i := 0; i < unitsNum; i++ {
+		s.Update(testEntry)
+		atomic.AddUint32(&curID, 1)
+
+		_, _ = s.flush()
+	}
+
+	oldName := s.filename
+	newDir := t.TempDir()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.relocate(newDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(newDir, filepath.Base(oldName)), s.filename)
+	assert.NoFileExists(t, oldName)
+	assert.FileExists(t, s.filename)
+
+	units, _ := s.loadUnits(24)
+	assert.Equal(t, uint64(unitsNum), totalQueries(units))
+}
@@ -71,15 +71,21 @@ func TestStats(t *testing.T) {
 		const reqDomain = "domain"
 
 		entries := []stats.Entry{{
-			Domain: reqDomain,
-			Client: cliIPStr,
-			Result: stats.RFiltered,
-			Time:   123456,
+			Domain:           reqDomain,
+			Client:           cliIPStr,
+			Result:           stats.RFiltered,
+			ThreatFeed:       "Threat Feed",
+			ThreatCategory:   "malware",
+			RefusedQueryType: "ANY",
+			Time:             123456,
 		}, {
-			Domain: reqDomain,
-			Client: cliIPStr,
-			Result: stats.RNotFiltered,
-			Time:   123456,
+			Domain:   reqDomain,
+			Client:   cliIPStr,
+			Result:   stats.RNotFiltered,
+			Protocol: "udp",
+			BytesIn:  40,
+			BytesOut: 200,
+			Time:     123456,
 		}}
 
 		wantData := &stats.StatsResp{
@@ -87,6 +93,19 @@ func TestStats(t *testing.T) {
 			TopQueried: []map[string]uint64{0: {reqDomain: 1}},
 			TopClients: []map[string]uint64{0: {cliIPStr: 2}},
 			TopBlocked: []map[string]uint64{0: {reqDomain: 1}},
+			TopThreatFeeds: []map[string]uint64{
+				0: {"Threat Feed": 1},
+			},
+			TopThreatCategories: []map[string]uint64{
+				0: {"malware": 1},
+			},
+			TopRefusedQueryTypes: []map[string]uint64{
+				0: {"ANY": 1},
+			},
+			TopClientsBytesIn:    []map[string]uint64{0: {cliIPStr: 40}},
+			TopClientsBytesOut:   []map[string]uint64{0: {cliIPStr: 200}},
+			TopProtocolsBytesIn:  []map[string]uint64{0: {"udp": 40}},
+			TopProtocolsBytesOut: []map[string]uint64{0: {"udp": 200}},
 			DNSQueries: []uint64{
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
@@ -108,6 +127,8 @@ func TestStats(t *testing.T) {
 			NumReplacedSafebrowsing: 0,
 			NumReplacedSafesearch:   0,
 			NumReplacedParental:     0,
+			NumBytesIn:              40,
+			NumBytesOut:             200,
 			AvgProcessingTime:       0.123456,
 		}
 
@@ -139,6 +160,13 @@ func TestStats(t *testing.T) {
 			TopQueried:           []map[string]uint64{},
 			TopClients:           []map[string]uint64{},
 			TopBlocked:           []map[string]uint64{},
+			TopThreatFeeds:       []map[string]uint64{},
+			TopThreatCategories:  []map[string]uint64{},
+			TopRefusedQueryTypes: []map[string]uint64{},
+			TopClientsBytesIn:    []map[string]uint64{},
+			TopClientsBytesOut:   []map[string]uint64{},
+			TopProtocolsBytesIn:  []map[string]uint64{},
+			TopProtocolsBytesOut: []map[string]uint64{},
 			DNSQueries:           _24zeroes[:],
 			BlockedFiltering:     _24zeroes[:],
 			ReplacedSafebrowsing: _24zeroes[:],
@@ -22,6 +22,13 @@ const (
 	maxDomains = 100
 	// maxClients is the max number of top clients to return.
 	maxClients = 100
+	// maxThreats is the max number of top threat feeds and categories to
+	// return.
+	maxThreats = 100
+	// maxQueryTypes is the max number of top refused query types to return.
+	maxQueryTypes = 100
+	// maxProtocols is the max number of top protocols to return.
+	maxProtocols = 10
 )
 
 // UnitIDGenFunc is the signature of a function that generates a unique ID for
@@ -66,6 +73,31 @@ type Entry struct {
 	// Result is the result of processing the request.
 	Result Result
 
+	// ThreatFeed is the name of the threat intelligence feed, which blocked
+	// the request.  It's empty unless the request is blocked by a feed.
+	ThreatFeed string
+
+	// ThreatCategory is the threat category of the indicator, which blocked
+	// the request.  It's empty unless ThreatFeed is set.
+	ThreatCategory string
+
+	// RefusedQueryType is the type of the request, which has been refused by
+	// the access settings because of its type, for example "ANY".  It's empty
+	// unless the request is refused so.
+	RefusedQueryType string
+
+	// Protocol is the protocol of the request, for example "udp" or "https".
+	Protocol string
+
+	// BytesIn is the estimated size of the packed DNS request in bytes.  It
+	// doesn't include the framing of the transport, such as the TCP length
+	// prefix or the HTTP headers.
+	BytesIn uint64
+
+	// BytesOut is the estimated size of the packed DNS response in bytes.  It
+	// doesn't include the framing of the transport either.
+	BytesOut uint64
+
 	// Time is the duration of the request processing in milliseconds.
 	Time uint32
 }
@@ -86,6 +118,10 @@ type unit struct {
 	// timeSum stores the sum of processing time in milliseconds of each request
 	// written by the unit.
 	timeSum uint64
+	// bytesIn stores the total size of the DNS requests in bytes.
+	bytesIn uint64
+	// bytesOut stores the total size of the DNS responses in bytes.
+	bytesOut uint64
 
 	// domains stores the number of requests for each domain.
 	domains map[string]uint64
@@ -94,16 +130,44 @@ type unit struct {
 	blockedDomains map[string]uint64
 	// clients stores the number of requests from each client.
 	clients map[string]uint64
+	// threatFeeds stores the number of requests blocked by each threat
+	// intelligence feed.
+	threatFeeds map[string]uint64
+	// threatCategories stores the number of requests blocked for each threat
+	// category.
+	threatCategories map[string]uint64
+	// refusedQueryTypes stores the number of requests refused for each query
+	// type.
+	refusedQueryTypes map[string]uint64
+	// clientsBytesIn stores the size of the DNS requests from each client in
+	// bytes.
+	clientsBytesIn map[string]uint64
+	// clientsBytesOut stores the size of the DNS responses to each client in
+	// bytes.
+	clientsBytesOut map[string]uint64
+	// protosBytesIn stores the size of the DNS requests over each protocol in
+	// bytes.
+	protosBytesIn map[string]uint64
+	// protosBytesOut stores the size of the DNS responses over each protocol
+	// in bytes.
+	protosBytesOut map[string]uint64
 }
 
 // newUnit allocates the new *unit.
 func newUnit(id uint32) (u *unit) {
 	return &unit{
-		id:             id,
-		nResult:        make([]uint64, resultLast),
-		domains:        make(map[string]uint64),
-		blockedDomains: make(map[string]uint64),
-		clients:        make(map[string]uint64),
+		id:                id,
+		nResult:           make([]uint64, resultLast),
+		domains:           make(map[string]uint64),
+		blockedDomains:    make(map[string]uint64),
+		clients:           make(map[string]uint64),
+		threatFeeds:       make(map[string]uint64),
+		threatCategories:  make(map[string]uint64),
+		refusedQueryTypes: make(map[string]uint64),
+		clientsBytesIn:    make(map[string]uint64),
+		clientsBytesOut:   make(map[string]uint64),
+		protosBytesIn:     make(map[string]uint64),
+		protosBytesOut:    make(map[string]uint64),
 	}
 }
 
@@ -127,6 +191,32 @@ type unitDB struct {
 	BlockedDomains []countPair
 	// Clients is the number of requests from each client.
 	Clients []countPair
+	// ThreatFeeds is the number of requests blocked by each threat
+	// intelligence feed.
+	ThreatFeeds []countPair
+	// ThreatCategories is the number of requests blocked for each threat
+	// category.
+	ThreatCategories []countPair
+	// RefusedQueryTypes is the number of requests refused for each query
+	// type.
+	RefusedQueryTypes []countPair
+	// ClientsBytesIn is the size of the DNS requests from each client in
+	// bytes.
+	ClientsBytesIn []countPair
+	// ClientsBytesOut is the size of the DNS responses to each client in
+	// bytes.
+	ClientsBytesOut []countPair
+	// ProtocolsBytesIn is the size of the DNS requests over each protocol in
+	// bytes.
+	ProtocolsBytesIn []countPair
+	// ProtocolsBytesOut is the size of the DNS responses over each protocol
+	// in bytes.
+	ProtocolsBytesOut []countPair
+
+	// NBytesIn is the total size of the DNS requests in bytes.
+	NBytesIn uint64
+	// NBytesOut is the total size of the DNS responses in bytes.
+	NBytesOut uint64
 
 	// TimeAvg is the average of processing times in milliseconds of all the
 	// requests in the unit.
@@ -208,12 +298,21 @@ func (u *unit) serialize() (udb *unitDB) {
 	}
 
 	return &unitDB{
-		NTotal:         u.nTotal,
-		NResult:        append([]uint64{}, u.nResult...),
-		Domains:        convertMapToSlice(u.domains, maxDomains),
-		BlockedDomains: convertMapToSlice(u.blockedDomains, maxDomains),
-		Clients:        convertMapToSlice(u.clients, maxClients),
-		TimeAvg:        timeAvg,
+		NTotal:            u.nTotal,
+		NResult:           append([]uint64{}, u.nResult...),
+		Domains:           convertMapToSlice(u.domains, maxDomains),
+		BlockedDomains:    convertMapToSlice(u.blockedDomains, maxDomains),
+		Clients:           convertMapToSlice(u.clients, maxClients),
+		ThreatFeeds:       convertMapToSlice(u.threatFeeds, maxThreats),
+		ThreatCategories:  convertMapToSlice(u.threatCategories, maxThreats),
+		RefusedQueryTypes: convertMapToSlice(u.refusedQueryTypes, maxQueryTypes),
+		ClientsBytesIn:    convertMapToSlice(u.clientsBytesIn, maxClients),
+		ClientsBytesOut:   convertMapToSlice(u.clientsBytesOut, maxClients),
+		ProtocolsBytesIn:  convertMapToSlice(u.protosBytesIn, maxProtocols),
+		ProtocolsBytesOut: convertMapToSlice(u.protosBytesOut, maxProtocols),
+		NBytesIn:          u.bytesIn,
+		NBytesOut:         u.bytesOut,
+		TimeAvg:           timeAvg,
 	}
 }
 
@@ -252,6 +351,15 @@ func (u *unit) deserialize(udb *unitDB) {
 	u.domains = convertSliceToMap(udb.Domains)
 	u.blockedDomains = convertSliceToMap(udb.BlockedDomains)
 	u.clients = convertSliceToMap(udb.Clients)
+	u.threatFeeds = convertSliceToMap(udb.ThreatFeeds)
+	u.threatCategories = convertSliceToMap(udb.ThreatCategories)
+	u.refusedQueryTypes = convertSliceToMap(udb.RefusedQueryTypes)
+	u.clientsBytesIn = convertSliceToMap(udb.ClientsBytesIn)
+	u.clientsBytesOut = convertSliceToMap(udb.ClientsBytesOut)
+	u.protosBytesIn = convertSliceToMap(udb.ProtocolsBytesIn)
+	u.protosBytesOut = convertSliceToMap(udb.ProtocolsBytesOut)
+	u.bytesIn = udb.NBytesIn
+	u.bytesOut = udb.NBytesOut
 	u.timeSum = uint64(udb.TimeAvg) * udb.NTotal
 }
 
@@ -269,6 +377,33 @@ func (u *unit) add(res Result, domain, cli string, dur uint64) {
 	u.nTotal++
 }
 
+// addThreat adds the threat intelligence feed match to u.  feed must not be
+// empty.  It's safe for concurrent use.
+func (u *unit) addThreat(feed, category string) {
+	u.threatFeeds[feed]++
+	u.threatCategories[category]++
+}
+
+// addRefusedQueryType adds the request refused because of its query type qt to
+// u.  It's safe for concurrent use.
+func (u *unit) addRefusedQueryType(qt string) {
+	u.refusedQueryTypes[qt]++
+}
+
+// addTraffic adds the size of the DNS request and response of cli over proto
+// to u.  It's safe for concurrent use.
+func (u *unit) addTraffic(cli, proto string, in, out uint64) {
+	u.bytesIn += in
+	u.bytesOut += out
+	u.clientsBytesIn[cli] += in
+	u.clientsBytesOut[cli] += out
+
+	if proto != "" {
+		u.protosBytesIn[proto] += in
+		u.protosBytesOut[proto] += out
+	}
+}
+
 // flushUnitToDB puts udb to the database at id.
 func (udb *unitDB) flushUnitToDB(tx *bbolt.Tx, id uint32) (err error) {
 	log.Debug("stats: flushing unit with id %d and total of %d", id, udb.NTotal)
@@ -384,6 +519,16 @@ func (s *StatsCtx) getData(limit uint32) (StatsResp, bool) {
 			TopClients: []topAddrs{},
 			TopQueried: []topAddrs{},
 
+			TopThreatFeeds:      []topAddrs{},
+			TopThreatCategories: []topAddrs{},
+
+			TopRefusedQueryTypes: []topAddrs{},
+
+			TopClientsBytesIn:    []topAddrs{},
+			TopClientsBytesOut:   []topAddrs{},
+			TopProtocolsBytesIn:  []topAddrs{},
+			TopProtocolsBytesOut: []topAddrs{},
+
 			BlockedFiltering:     []uint64{},
 			DNSQueries:           []uint64{},
 			ReplacedParental:     []uint64{},
@@ -414,6 +559,13 @@ func (s *StatsCtx) getData(limit uint32) (StatsResp, bool) {
 		TopQueried:           topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) { return u.Domains }),
 		TopBlocked:           topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) { return u.BlockedDomains }),
 		TopClients:           topsCollector(units, maxClients, nil, func(u *unitDB) (pairs []countPair) { return u.Clients }),
+		TopThreatFeeds:       topsCollector(units, maxThreats, nil, func(u *unitDB) (pairs []countPair) { return u.ThreatFeeds }),
+		TopThreatCategories:  topsCollector(units, maxThreats, nil, func(u *unitDB) (pairs []countPair) { return u.ThreatCategories }),
+		TopRefusedQueryTypes: topsCollector(units, maxQueryTypes, nil, func(u *unitDB) (pairs []countPair) { return u.RefusedQueryTypes }),
+		TopClientsBytesIn:    topsCollector(units, maxClients, nil, func(u *unitDB) (pairs []countPair) { return u.ClientsBytesIn }),
+		TopClientsBytesOut:   topsCollector(units, maxClients, nil, func(u *unitDB) (pairs []countPair) { return u.ClientsBytesOut }),
+		TopProtocolsBytesIn:  topsCollector(units, maxProtocols, nil, func(u *unitDB) (pairs []countPair) { return u.ProtocolsBytesIn }),
+		TopProtocolsBytesOut: topsCollector(units, maxProtocols, nil, func(u *unitDB) (pairs []countPair) { return u.ProtocolsBytesOut }),
 	}
 
 	// Total counters:
@@ -431,6 +583,8 @@ func (s *StatsCtx) getData(limit uint32) (StatsResp, bool) {
 		sum.NResult[RSafeBrowsing] += u.NResult[RSafeBrowsing]
 		sum.NResult[RSafeSearch] += u.NResult[RSafeSearch]
 		sum.NResult[RParental] += u.NResult[RParental]
+		sum.NBytesIn += u.NBytesIn
+		sum.NBytesOut += u.NBytesOut
 	}
 
 	data.NumDNSQueries = sum.NTotal
@@ -438,6 +592,8 @@ func (s *StatsCtx) getData(limit uint32) (StatsResp, bool) {
 	data.NumReplacedSafebrowsing = sum.NResult[RSafeBrowsing]
 	data.NumReplacedSafesearch = sum.NResult[RSafeSearch]
 	data.NumReplacedParental = sum.NResult[RParental]
+	data.NumBytesIn = sum.NBytesIn
+	data.NumBytesOut = sum.NBytesOut
 
 	if timeN != 0 {
 		data.AvgProcessingTime = float64(sum.TimeAvg/uint32(timeN)) / 1000000
@@ -0,0 +1,165 @@
+// Package systemd contains the utilities for the integration with the systemd
+// service manager: the socket activation and the readiness notifications.
+//
+// See https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html and
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// The states sent to the service manager.
+const (
+	// StateReady tells the service manager that the service has finished
+	// starting up or reloading its configuration.
+	StateReady = "READY=1"
+
+	// StateReloading tells the service manager that the service is reloading
+	// its configuration.  [StateReady] must be sent once it's finished.
+	StateReloading = "RELOADING=1"
+
+	// StateStopping tells the service manager that the service is shutting
+	// down.
+	StateStopping = "STOPPING=1"
+
+	// StateWatchdog updates the watchdog timestamp.
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// The environment variables set by the service manager.
+const (
+	envListenFDNames = "LISTEN_FDNAMES"
+	envListenFDs     = "LISTEN_FDS"
+	envListenPID     = "LISTEN_PID"
+	envNotifySocket  = "NOTIFY_SOCKET"
+	envWatchdogPID   = "WATCHDOG_PID"
+	envWatchdogUSec  = "WATCHDOG_USEC"
+)
+
+// listenFDsStart is the first file descriptor passed by the service manager.
+const listenFDsStart = 3
+
+// Socket is a socket passed by the service manager.
+type Socket struct {
+	// File is the file of the socket.  Use [net.FileListener] or
+	// [net.FilePacketConn] to use it, which duplicate the descriptor, so that
+	// File remains open after the listener is closed.
+	File *os.File
+
+	// Name is the name of the socket set with the FileDescriptorName option
+	// of the socket unit.
+	Name string
+}
+
+// Sockets returns the sockets passed to the current process by the service
+// manager, if any.  It unsets the corresponding environment variables, so that
+// the child processes don't inherit them.
+func Sockets() (socks []*Socket, err error) {
+	defer func() {
+		_ = os.Unsetenv(envListenPID)
+		_ = os.Unsetenv(envListenFDs)
+		_ = os.Unsetenv(envListenFDNames)
+	}()
+
+	pidStr := os.Getenv(envListenPID)
+	if pidStr == "" {
+		return nil, nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %w", envListenPID, err)
+	} else if pid != os.Getpid() {
+		// The sockets are passed to another process.
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %w", envListenFDs, err)
+	} else if n < 0 {
+		return nil, fmt.Errorf("bad %s: negative value %d", envListenFDs, n)
+	}
+
+	var names []string
+	if namesStr := os.Getenv(envListenFDNames); namesStr != "" {
+		names = strings.Split(namesStr, ":")
+	}
+
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+
+		fd := uintptr(listenFDsStart + i)
+		socks = append(socks, &Socket{
+			File: os.NewFile(fd, name),
+			Name: name,
+		})
+	}
+
+	return socks, nil
+}
+
+// Notify sends the states to the service manager.  sent is false if the
+// service manager doesn't expect the notifications.
+func Notify(states ...string) (sent bool, err error) {
+	addr := os.Getenv(envNotifySocket)
+	if addr == "" {
+		return false, nil
+	}
+
+	// Abstract sockets are prefixed with "@".
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns the interval, within which the [StateWatchdog]
+// notifications must be sent.  ivl is zero if the watchdog is disabled.
+func WatchdogInterval() (ivl time.Duration, err error) {
+	usecStr := os.Getenv(envWatchdogUSec)
+	if usecStr == "" {
+		return 0, nil
+	}
+
+	if pidStr := os.Getenv(envWatchdogPID); pidStr != "" {
+		var pid int
+		pid, err = strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("bad %s: %w", envWatchdogPID, err)
+		} else if pid != os.Getpid() {
+			// The watchdog is set for another process.
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseUint(usecStr, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %w", envWatchdogUSec, err)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
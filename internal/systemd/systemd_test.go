@@ -0,0 +1,129 @@
+//go:build linux
+
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/systemd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+
+		sent, err := systemd.Notify(systemd.StateReady)
+		require.NoError(t, err)
+
+		assert.False(t, sent)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		addr := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, conn.Close()) })
+
+		t.Setenv("NOTIFY_SOCKET", addr)
+
+		sent, err := systemd.Notify(systemd.StateReloading, systemd.StateReady)
+		require.NoError(t, err)
+		require.True(t, sent)
+
+		buf := make([]byte, 64)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+
+		assert.Equal(t, "RELOADING=1\nREADY=1", string(buf[:n]))
+	})
+}
+
+func TestSockets(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", "")
+
+		socks, err := systemd.Sockets()
+		require.NoError(t, err)
+
+		assert.Empty(t, socks)
+	})
+
+	t.Run("other_process", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+		t.Setenv("LISTEN_FDS", "1")
+
+		socks, err := systemd.Sockets()
+		require.NoError(t, err)
+
+		assert.Empty(t, socks)
+		assert.Empty(t, os.Getenv("LISTEN_FDS"))
+	})
+
+	t.Run("bad_fds", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "x")
+
+		_, err := systemd.Sockets()
+		assert.Error(t, err)
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	testCases := []struct {
+		name       string
+		usec       string
+		pid        string
+		wantErrMsg string
+		want       time.Duration
+	}{{
+		name:       "disabled",
+		usec:       "",
+		pid:        "",
+		wantErrMsg: "",
+		want:       0,
+	}, {
+		name:       "enabled",
+		usec:       "30000000",
+		pid:        strconv.Itoa(os.Getpid()),
+		wantErrMsg: "",
+		want:       30 * time.Second,
+	}, {
+		name:       "other_process",
+		usec:       "30000000",
+		pid:        strconv.Itoa(os.Getpid() + 1),
+		wantErrMsg: "",
+		want:       0,
+	}, {
+		name: "bad_usec",
+		usec: "soon",
+		pid:  "",
+		wantErrMsg: `bad WATCHDOG_USEC: strconv.ParseUint: parsing "soon": ` +
+			`invalid syntax`,
+		want: 0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tc.usec)
+			t.Setenv("WATCHDOG_PID", tc.pid)
+
+			ivl, err := systemd.WatchdogInterval()
+			if tc.wantErrMsg != "" {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.want, ivl)
+		})
+	}
+}
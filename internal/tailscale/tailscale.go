@@ -0,0 +1,257 @@
+// Package tailscale contains the client of the Tailscale local API and the
+// Headscale API, which is used to resolve the addresses of the tailnet devices
+// into their names.
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghio"
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/exp/slices"
+)
+
+// DefaultSocket is the default path to the socket of the Tailscale local API.
+const DefaultSocket = "/var/run/tailscale/tailscaled.sock"
+
+// maxRespSize is the maximum size of the API responses.
+const maxRespSize = 8 * 1024 * 1024
+
+// localAPIHost is the host the Tailscale local API expects in the requests.
+const localAPIHost = "local-tailscaled.sock"
+
+// Config is the configuration of the Tailscale runtime client source.
+type Config struct {
+	// Socket is the path to the socket of the Tailscale local API.  If
+	// empty, [DefaultSocket] is used.  It's ignored if HeadscaleURL is set.
+	Socket string `yaml:"socket"`
+
+	// HeadscaleURL, if not empty, is the URL of the Headscale server, the API
+	// of which is used instead of the Tailscale local API.
+	HeadscaleURL string `yaml:"headscale_url"`
+
+	// HeadscaleAPIKey is the API key of the Headscale server.  It must be set
+	// if HeadscaleURL is.
+	HeadscaleAPIKey string `yaml:"headscale_api_key"`
+
+	// Enabled defines if the names of the tailnet devices are resolved.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if the configuration isn't valid.
+func (c *Config) Validate() (err error) {
+	if !c.Enabled || c.HeadscaleURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(c.HeadscaleURL)
+	if err != nil {
+		return fmt.Errorf("headscale_url: %w", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("headscale_url: %q is not an absolute http or https url", c.HeadscaleURL)
+	}
+
+	if c.HeadscaleAPIKey == "" {
+		return errors.Error("headscale_api_key: no value")
+	}
+
+	return nil
+}
+
+// Device is a device within the tailnet.
+type Device struct {
+	// Name is the name of the device.
+	Name string
+
+	// IPs are the tailnet addresses of the device.
+	IPs []netip.Addr
+}
+
+// Client requests the devices from the Tailscale local API or the Headscale
+// API.
+type Client struct {
+	http   *http.Client
+	url    *url.URL
+	apiKey string
+}
+
+// New returns a new client for the API from c.  c must be valid.
+func New(c *Config) (cl *Client) {
+	if c.HeadscaleURL != "" {
+		// Don't check the error, since the URL has been validated.
+		u, _ := url.Parse(c.HeadscaleURL)
+
+		return &Client{
+			http:   &http.Client{},
+			url:    u.JoinPath("/api/v1/node"),
+			apiKey: c.HeadscaleAPIKey,
+		}
+	}
+
+	sock := c.Socket
+	if sock == "" {
+		sock = DefaultSocket
+	}
+
+	dialer := &net.Dialer{}
+
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (conn net.Conn, err error) {
+					return dialer.DialContext(ctx, "unix", sock)
+				},
+			},
+		},
+		url: &url.URL{
+			Scheme: "http",
+			Host:   localAPIHost,
+			Path:   "/localapi/v0/status",
+		},
+	}
+}
+
+// Devices returns the devices of the tailnet sorted by name.
+func (cl *Client) Devices(ctx context.Context) (devs []Device, err error) {
+	defer func() { err = errors.Annotate(err, "tailscale: %w") }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cl.url.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	if cl.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cl.apiKey)
+	}
+
+	resp, err := cl.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	body, err := aghio.LimitReader(resp.Body, maxRespSize)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	if cl.apiKey != "" {
+		devs, err = decodeHeadscaleNodes(body)
+	} else {
+		devs, err = decodeStatus(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	slices.SortFunc(devs, func(a, b Device) (less bool) { return a.Name < b.Name })
+
+	return devs, nil
+}
+
+// peerStatus is a device within the response of the Tailscale local API.
+type peerStatus struct {
+	HostName     string       `json:"HostName"`
+	DNSName      string       `json:"DNSName"`
+	TailscaleIPs []netip.Addr `json:"TailscaleIPs"`
+}
+
+// status is the response of the Tailscale local API.
+type status struct {
+	Self *peerStatus            `json:"Self"`
+	Peer map[string]*peerStatus `json:"Peer"`
+}
+
+// decodeStatus decodes the devices from the response of the Tailscale local
+// API.
+func decodeStatus(body io.Reader) (devs []Device, err error) {
+	st := &status{}
+	err = json.NewDecoder(body).Decode(st)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	peers := make([]*peerStatus, 0, len(st.Peer)+1)
+	if st.Self != nil {
+		peers = append(peers, st.Self)
+	}
+
+	for _, p := range st.Peer {
+		peers = append(peers, p)
+	}
+
+	for _, p := range peers {
+		// The MagicDNS name is the one set in the admin console, while the
+		// hostname is the one of the OS of the device.
+		name, _, _ := strings.Cut(p.DNSName, ".")
+		if name == "" {
+			name = p.HostName
+		}
+
+		if name == "" || len(p.TailscaleIPs) == 0 {
+			continue
+		}
+
+		devs = append(devs, Device{
+			Name: name,
+			IPs:  p.TailscaleIPs,
+		})
+	}
+
+	return devs, nil
+}
+
+// headscaleNode is a device within the response of the Headscale API.
+type headscaleNode struct {
+	Name        string       `json:"name"`
+	GivenName   string       `json:"givenName"`
+	IPAddresses []netip.Addr `json:"ipAddresses"`
+}
+
+// headscaleNodes is the response of the Headscale API.
+type headscaleNodes struct {
+	Nodes []*headscaleNode `json:"nodes"`
+}
+
+// decodeHeadscaleNodes decodes the devices from the response of the Headscale
+// API.
+func decodeHeadscaleNodes(body io.Reader) (devs []Device, err error) {
+	resp := &headscaleNodes{}
+	err = json.NewDecoder(body).Decode(resp)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	for _, n := range resp.Nodes {
+		name := n.GivenName
+		if name == "" {
+			name = n.Name
+		}
+
+		if name == "" || len(n.IPAddresses) == 0 {
+			continue
+		}
+
+		devs = append(devs, Device{
+			Name: name,
+			IPs:  n.IPAddresses,
+		})
+	}
+
+	return devs, nil
+}
@@ -0,0 +1,175 @@
+package tailscale_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/tailscale"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+func TestClient_Devices_localAPI(t *testing.T) {
+	const statusResp = `{
+  "Self": {
+    "HostName": "server",
+    "DNSName": "gateway.tail1234.ts.net.",
+    "TailscaleIPs": ["100.64.0.1", "fd7a:115c:a1e0::1"]
+  },
+  "Peer": {
+    "nodekey:1": {
+      "HostName": "Johns-iPhone",
+      "DNSName": "",
+      "TailscaleIPs": ["100.64.0.2"]
+    },
+    "nodekey:2": {
+      "HostName": "offline",
+      "DNSName": "offline.tail1234.ts.net.",
+      "TailscaleIPs": null
+    }
+  }
+}`
+
+	sock := filepath.Join(t.TempDir(), "tailscaled.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+
+	srv := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/localapi/v0/status", r.URL.Path)
+
+				_, _ = w.Write([]byte(statusResp))
+			}),
+		},
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	cl := tailscale.New(&tailscale.Config{
+		Socket:  sock,
+		Enabled: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+
+	devs, err := cl.Devices(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []tailscale.Device{{
+		Name: "Johns-iPhone",
+		IPs:  []netip.Addr{netip.MustParseAddr("100.64.0.2")},
+	}, {
+		Name: "gateway",
+		IPs: []netip.Addr{
+			netip.MustParseAddr("100.64.0.1"),
+			netip.MustParseAddr("fd7a:115c:a1e0::1"),
+		},
+	}}, devs)
+}
+
+func TestClient_Devices_headscale(t *testing.T) {
+	const (
+		apiKey    = "test-key"
+		nodesResp = `{"nodes":[` +
+			`{"name":"node-1","givenName":"laptop","ipAddresses":["100.64.0.3"]},` +
+			`{"name":"phone","givenName":"","ipAddresses":["100.64.0.4"]}` +
+			`]}`
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+apiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		assert.Equal(t, "/api/v1/node", r.URL.Path)
+
+		_, _ = w.Write([]byte(nodesResp))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+
+	conf := &tailscale.Config{
+		HeadscaleURL:    srv.URL,
+		HeadscaleAPIKey: apiKey,
+		Enabled:         true,
+	}
+	require.NoError(t, conf.Validate())
+
+	devs, err := tailscale.New(conf).Devices(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []tailscale.Device{{
+		Name: "laptop",
+		IPs:  []netip.Addr{netip.MustParseAddr("100.64.0.3")},
+	}, {
+		Name: "phone",
+		IPs:  []netip.Addr{netip.MustParseAddr("100.64.0.4")},
+	}}, devs)
+
+	t.Run("bad_key", func(t *testing.T) {
+		conf.HeadscaleAPIKey = "bad-key"
+
+		_, err = tailscale.New(conf).Devices(ctx)
+		assert.EqualError(t, err, "tailscale: unexpected status code 401")
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *tailscale.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &tailscale.Config{Enabled: true},
+		name:       "local_api",
+		wantErrMsg: "",
+	}, {
+		conf: &tailscale.Config{
+			HeadscaleURL: "ftp://headscale.example",
+			Enabled:      true,
+		},
+		name:       "bad_url",
+		wantErrMsg: `headscale_url: "ftp://headscale.example" is not an absolute http or https url`,
+	}, {
+		conf: &tailscale.Config{
+			HeadscaleURL: "https://headscale.example",
+			Enabled:      true,
+		},
+		name:       "no_key",
+		wantErrMsg: "headscale_api_key: no value",
+	}, {
+		conf: &tailscale.Config{
+			HeadscaleURL: "ftp://headscale.example",
+			Enabled:      false,
+		},
+		name:       "disabled",
+		wantErrMsg: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.Validate()
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
@@ -111,14 +111,7 @@ func (u *Updater) parseVersionResponse(data []byte) (VersionInfo, error) {
 // versionObj.  If the key is not found, it additionally prints an informative
 // log message.
 func (u *Updater) downloadURL(versionObj map[string]string) (dlURL, key string, ok bool) {
-	if u.goarch == "arm" && u.goarm != "" {
-		key = fmt.Sprintf("download_%s_%sv%s", u.goos, u.goarch, u.goarm)
-	} else if isMIPS(u.goarch) && u.gomips != "" {
-		key = fmt.Sprintf("download_%s_%s_%s", u.goos, u.goarch, u.gomips)
-	} else {
-		key = fmt.Sprintf("download_%s_%s", u.goos, u.goarch)
-	}
-
+	key = "download_" + u.platform()
 	dlURL, ok = versionObj[key]
 	if ok {
 		return dlURL, key, true
@@ -131,6 +124,29 @@ func (u *Updater) downloadURL(versionObj map[string]string) (dlURL, key string,
 	return "", key, false
 }
 
+// platform returns the name of the current platform as used in the names of
+// the packages, for example "linux_armv7".
+func (u *Updater) platform() (p string) {
+	if u.goarch == "arm" && u.goarm != "" {
+		return fmt.Sprintf("%s_%sv%s", u.goos, u.goarch, u.goarm)
+	} else if isMIPS(u.goarch) && u.gomips != "" {
+		return fmt.Sprintf("%s_%s_%s", u.goos, u.goarch, u.gomips)
+	}
+
+	return fmt.Sprintf("%s_%s", u.goos, u.goarch)
+}
+
+// packageFileName returns the name of the package file for the current
+// platform, for example "AdGuardHome_linux_amd64.tar.gz".
+func (u *Updater) packageFileName() (name string) {
+	name = "AdGuardHome_" + u.platform()
+	if u.goos == "windows" || u.goos == "darwin" {
+		return name + ".zip"
+	}
+
+	return name + ".tar.gz"
+}
+
 // isMIPS returns true if arch is any MIPS architecture.
 func isMIPS(arch string) (ok bool) {
 	switch arch {
@@ -0,0 +1,216 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/maybe"
+)
+
+// backupDirName is the name of the directory within the working directory
+// with the backup of the previous version.
+const backupDirName = "agh-backup"
+
+// recordFileName is the name of the file within the backup directory
+// describing the last update.
+const recordFileName = "update.json"
+
+// maxStartAttempts is the number of starts after which the update is rolled
+// back if the new version still hasn't confirmed it.
+const maxStartAttempts = 2
+
+// Record describes the last update.  It's kept until the update is rolled back
+// or the next update, so that the previous version could be restored.
+type Record struct {
+	// PrevVersion is the version before the update.
+	PrevVersion string `json:"prev_version"`
+
+	// NewVersion is the installed version.
+	NewVersion string `json:"new_version"`
+
+	// ExePath is the path of the executable.
+	ExePath string `json:"exe_path"`
+
+	// BackupExePath is the path of the previous executable.
+	BackupExePath string `json:"backup_exe_path"`
+
+	// ConfPath is the path of the configuration file.
+	ConfPath string `json:"conf_path"`
+
+	// BackupConfPath is the path of the previous configuration file.  It's
+	// empty if there was no configuration file before the update.
+	BackupConfPath string `json:"backup_conf_path"`
+
+	// Attempts is the number of starts of the new version before it has
+	// confirmed the update.
+	Attempts int `json:"attempts"`
+
+	// Confirmed is true if the new version has confirmed the update.
+	Confirmed bool `json:"confirmed"`
+}
+
+// recordPath returns the path of the update record file.
+func recordPath(workDir string) (p string) {
+	return filepath.Join(workDir, backupDirName, recordFileName)
+}
+
+// ReadRecord returns the record of the last update.  p is nil if there is
+// none.
+func ReadRecord(workDir string) (p *Record, err error) {
+	data, err := os.ReadFile(recordPath(workDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading update record: %w", err)
+	}
+
+	p = &Record{}
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("decoding update record: %w", err)
+	}
+
+	return p, nil
+}
+
+// writeRecord writes p into the update record file.
+func writeRecord(workDir string, p *Record) (err error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding update record: %w", err)
+	}
+
+	err = maybe.WriteFile(recordPath(workDir), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing update record: %w", err)
+	}
+
+	return nil
+}
+
+// saveRecord records the just installed update as pending.  u.mu must be
+// locked.
+func (u *Updater) saveRecord(firstRun bool) (err error) {
+	p := &Record{
+		PrevVersion:   u.version,
+		NewVersion:    u.newVersion,
+		ExePath:       u.currentExeName,
+		BackupExePath: u.backupExeName,
+		ConfPath:      u.confName,
+	}
+
+	if !firstRun {
+		p.BackupConfPath = filepath.Join(u.backupDir, "AdGuardHome.yaml")
+	}
+
+	return writeRecord(u.workDir, p)
+}
+
+// CheckPending must be called on each start.  It counts the starts of the
+// version installed by the pending update, if any, and rolls the update back
+// if the version hasn't confirmed it within a few starts.  If pending is true,
+// the running version must confirm the update once it's working, see
+// [ConfirmPending].  If rolledBack is true, the previous version has been
+// restored and AdGuard Home must be restarted.
+func CheckPending(workDir string) (pending, rolledBack bool, err error) {
+	p, err := ReadRecord(workDir)
+	if err != nil || p == nil {
+		return false, false, err
+	}
+
+	if p.NewVersion != version.Version() {
+		// The executable has been replaced by something else since.
+		log.Info("updater: running %s instead of %s, forgetting update", version.Version(), p.NewVersion)
+
+		return false, false, removeRecord(workDir)
+	} else if p.Confirmed {
+		return false, false, nil
+	}
+
+	p.Attempts++
+	if p.Attempts <= maxStartAttempts {
+		log.Info("updater: update to %s is pending, start attempt %d", p.NewVersion, p.Attempts)
+
+		return true, false, writeRecord(workDir, p)
+	}
+
+	log.Error("updater: %s failed to start %d times", p.NewVersion, maxStartAttempts)
+
+	err = rollback(workDir, p)
+	if err != nil {
+		return false, false, err
+	}
+
+	return false, true, nil
+}
+
+// ConfirmPending confirms the pending update, if any, so that it's not rolled
+// back anymore.  It must be called once the new version is working.
+func ConfirmPending(workDir string) (err error) {
+	p, err := ReadRecord(workDir)
+	if err != nil || p == nil || p.Confirmed {
+		return err
+	}
+
+	log.Info("updater: update from %s to %s confirmed", p.PrevVersion, p.NewVersion)
+
+	p.Confirmed = true
+
+	return writeRecord(workDir, p)
+}
+
+// Rollback restores the previous version replaced by the last update, whether
+// it has been confirmed or not.  AdGuard Home must be restarted afterwards.
+func Rollback(workDir string) (err error) {
+	p, err := ReadRecord(workDir)
+	if err != nil {
+		return err
+	} else if p == nil {
+		return errors.Error("no previous version")
+	}
+
+	return rollback(workDir, p)
+}
+
+// rollback restores the previous version replaced by p.
+func rollback(workDir string, p *Record) (err error) {
+	log.Info("updater: rolling back from %s to %s", p.NewVersion, p.PrevVersion)
+
+	if p.BackupConfPath != "" {
+		err = copyFile(p.BackupConfPath, p.ConfPath)
+		if err != nil {
+			return fmt.Errorf("restoring config: %w", err)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		// The running executable can't be overwritten, but it can be renamed.
+		err = os.Rename(p.ExePath, p.ExePath+".failed")
+		if err != nil {
+			return fmt.Errorf("moving failed executable: %w", err)
+		}
+	}
+
+	err = os.Rename(p.BackupExePath, p.ExePath)
+	if err != nil {
+		return fmt.Errorf("restoring executable: %w", err)
+	}
+
+	return removeRecord(workDir)
+}
+
+// removeRecord removes the update record file.
+func removeRecord(workDir string) (err error) {
+	err = os.Remove(recordPath(workDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing update record: %w", err)
+	}
+
+	return nil
+}
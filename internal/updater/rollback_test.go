@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRecord writes the files of an installed update into a temporary
+// working directory and returns it.
+func newRecord(t *testing.T) (wd string, p *Record) {
+	t.Helper()
+
+	wd = t.TempDir()
+	backupDir := filepath.Join(wd, backupDirName)
+	require.NoError(t, os.Mkdir(backupDir, 0o755))
+
+	p = &Record{
+		PrevVersion:    "v0.103.0",
+		NewVersion:     version.Version(),
+		ExePath:        filepath.Join(wd, "AdGuardHome"),
+		BackupExePath:  filepath.Join(backupDir, "AdGuardHome"),
+		ConfPath:       filepath.Join(wd, "AdGuardHome.yaml"),
+		BackupConfPath: filepath.Join(backupDir, "AdGuardHome.yaml"),
+	}
+
+	for path, data := range map[string]string{
+		p.ExePath:        "new",
+		p.BackupExePath:  "old",
+		p.ConfPath:       "new config",
+		p.BackupConfPath: "old config",
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+
+	require.NoError(t, writeRecord(wd, p))
+
+	return wd, p
+}
+
+// assertFile checks that the file at path contains want.
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, string(data))
+}
+
+func TestCheckPending(t *testing.T) {
+	t.Run("no_pending", func(t *testing.T) {
+		pending, rolledBack, err := CheckPending(t.TempDir())
+		require.NoError(t, err)
+
+		assert.False(t, pending)
+		assert.False(t, rolledBack)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		wd, p := newRecord(t)
+
+		for i := 0; i < maxStartAttempts; i++ {
+			pending, rolledBack, err := CheckPending(wd)
+			require.NoError(t, err)
+			require.True(t, pending)
+			require.False(t, rolledBack)
+		}
+
+		pending, rolledBack, err := CheckPending(wd)
+		require.NoError(t, err)
+		require.False(t, pending)
+		require.True(t, rolledBack)
+
+		assertFile(t, p.ExePath, "old")
+		assertFile(t, p.ConfPath, "old config")
+
+		assert.NoFileExists(t, recordPath(wd))
+	})
+
+	t.Run("confirmed", func(t *testing.T) {
+		wd, p := newRecord(t)
+
+		pending, rolledBack, err := CheckPending(wd)
+		require.NoError(t, err)
+		require.True(t, pending)
+		require.False(t, rolledBack)
+
+		require.NoError(t, ConfirmPending(wd))
+
+		pending, rolledBack, err = CheckPending(wd)
+		require.NoError(t, err)
+		require.False(t, pending)
+		require.False(t, rolledBack)
+
+		assertFile(t, p.ExePath, "new")
+		assertFile(t, p.ConfPath, "new config")
+
+		rec, err := ReadRecord(wd)
+		require.NoError(t, err)
+		require.NotNil(t, rec)
+
+		assert.True(t, rec.Confirmed)
+	})
+
+	t.Run("other_version", func(t *testing.T) {
+		wd, p := newRecord(t)
+
+		p.NewVersion = "v0.103.1"
+		require.NoError(t, writeRecord(wd, p))
+
+		pending, rolledBack, err := CheckPending(wd)
+		require.NoError(t, err)
+		require.False(t, pending)
+		require.False(t, rolledBack)
+
+		assertFile(t, p.ExePath, "new")
+
+		assert.NoFileExists(t, recordPath(wd))
+	})
+}
+
+func TestRollback(t *testing.T) {
+	wd, p := newRecord(t)
+
+	require.NoError(t, Rollback(wd))
+
+	assertFile(t, p.ExePath, "old")
+	assertFile(t, p.ConfPath, "old config")
+
+	assert.EqualError(t, Rollback(wd), "no previous version")
+}
@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -105,11 +106,52 @@ func NewUpdater(conf *Config) *Updater {
 }
 
 // Update performs the auto-update.  It returns an error if the update failed.
-// If firstRun is true, it assumes the configuration file doesn't exist.
+// If firstRun is true, it assumes the configuration file doesn't exist.  The
+// update stays pending until the new version confirms it, see [CheckPending]
+// and [ConfirmPending].
 func (u *Updater) Update(firstRun bool) (err error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
+	return u.update(firstRun)
+}
+
+// releasesURL is the base URL of the packages of the specific versions.
+//
+// TODO(a.garipov): Make configurable.
+const releasesURL = "https://github.com/AdguardTeam/AdGuardHome/releases/download"
+
+// versionRe matches the valid versions to update to.
+var versionRe = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.]+)?$`)
+
+// ValidateVersion returns an error if ver isn't a valid version to update to,
+// for example "v0.107.26".
+func ValidateVersion(ver string) (err error) {
+	if !versionRe.MatchString(ver) {
+		return fmt.Errorf("bad version %q", ver)
+	}
+
+	return nil
+}
+
+// UpdateTo performs the update to the specific version ver, which may also be
+// older than the current one.  ver must be valid, see [ValidateVersion].  See
+// also [Updater.Update].
+func (u *Updater) UpdateTo(ver string, firstRun bool) (err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.newVersion = ver
+	u.packageURL, err = url.JoinPath(releasesURL, ver, u.packageFileName())
+	if err != nil {
+		return fmt.Errorf("building package url: %w", err)
+	}
+
+	return u.update(firstRun)
+}
+
+// update performs the update to u.newVersion.  u.mu must be locked.
+func (u *Updater) update(firstRun bool) (err error) {
 	log.Info("updater: updating")
 	defer func() {
 		if err != nil {
@@ -158,6 +200,11 @@ func (u *Updater) Update(firstRun bool) (err error) {
 		return fmt.Errorf("replacing: %w", err)
 	}
 
+	err = u.saveRecord(firstRun)
+	if err != nil {
+		return fmt.Errorf("saving update record: %w", err)
+	}
+
 	return nil
 }
 
@@ -187,7 +234,7 @@ func (u *Updater) prepare(exePath string) (err error) {
 	}
 
 	u.packageName = filepath.Join(u.updateDir, pkgNameOnly)
-	u.backupDir = filepath.Join(u.workDir, "agh-backup")
+	u.backupDir = filepath.Join(u.workDir, backupDirName)
 
 	updateExeName := "AdGuardHome"
 	if u.goos == "windows" {
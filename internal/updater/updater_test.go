@@ -329,3 +329,64 @@ func TestUpdater_VersionInto_MIPS(t *testing.T) {
 	assert.Equal(t, "https://github.com/AdguardTeam/AdGuardHome/internal/releases", info.AnnouncementURL)
 	assert.Equal(t, aghalg.NBTrue, info.CanAutoUpdate)
 }
+
+func TestValidateVersion(t *testing.T) {
+	testCases := []struct {
+		ver     string
+		wantErr bool
+	}{{
+		ver:     "v0.107.26",
+		wantErr: false,
+	}, {
+		ver:     "v0.108.0-b.1",
+		wantErr: false,
+	}, {
+		ver:     "0.107.26",
+		wantErr: true,
+	}, {
+		ver:     "v0.107",
+		wantErr: true,
+	}, {
+		ver:     "v0.107.26/../../evil",
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.ver, func(t *testing.T) {
+			err := ValidateVersion(tc.ver)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUpdater_packageFileName(t *testing.T) {
+	testCases := []struct {
+		conf *Config
+		want string
+	}{{
+		conf: &Config{GOOS: "linux", GOARCH: "amd64"},
+		want: "AdGuardHome_linux_amd64.tar.gz",
+	}, {
+		conf: &Config{GOOS: "linux", GOARCH: "arm", GOARM: "7"},
+		want: "AdGuardHome_linux_armv7.tar.gz",
+	}, {
+		conf: &Config{GOOS: "linux", GOARCH: "mipsle", GOMIPS: "softfloat"},
+		want: "AdGuardHome_linux_mipsle_softfloat.tar.gz",
+	}, {
+		conf: &Config{GOOS: "windows", GOARCH: "amd64"},
+		want: "AdGuardHome_windows_amd64.zip",
+	}, {
+		conf: &Config{GOOS: "darwin", GOARCH: "arm64"},
+		want: "AdGuardHome_darwin_arm64.zip",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, NewUpdater(tc.conf).packageFileName())
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// windowStartLayout is the layout of the start of a maintenance window.
+const windowStartLayout = "15:04"
+
+// weekdays are the names of the days of the week in a maintenance window.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a weekly maintenance window.
+type Window struct {
+	// Days are the days of the week on which the window starts, for example
+	// "mon".  If empty, the window starts every day.
+	Days []string `yaml:"days"`
+
+	// Start is the local time at which the window starts in the "15:04"
+	// format.
+	Start string `yaml:"start"`
+
+	// Duration is the length of the window.  It must be positive and not
+	// longer than a day.
+	Duration timeutil.Duration `yaml:"duration"`
+}
+
+// Validate returns an error if the window isn't valid.
+func (w *Window) Validate() (err error) {
+	seen := map[string]bool{}
+	for _, d := range w.Days {
+		d = strings.ToLower(d)
+		if _, ok := weekdays[d]; !ok {
+			return fmt.Errorf("days: bad day %q", d)
+		} else if seen[d] {
+			return fmt.Errorf("days: duplicate day %q", d)
+		}
+
+		seen[d] = true
+	}
+
+	_, err = time.Parse(windowStartLayout, w.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+
+	if w.Duration.Duration <= 0 {
+		return errors.Error("duration: must be positive")
+	} else if w.Duration.Duration > timeutil.Day {
+		return fmt.Errorf("duration: must not be longer than %s", timeutil.Day)
+	}
+
+	return nil
+}
+
+// Contains returns true if t is within the window.  w must be valid.
+func (w *Window) Contains(t time.Time) (ok bool) {
+	start, _ := time.Parse(windowStartLayout, w.Start)
+
+	// The window may start on the previous day and end after midnight.
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		from := time.Date(
+			day.Year(),
+			day.Month(),
+			day.Day(),
+			start.Hour(),
+			start.Minute(),
+			0,
+			0,
+			t.Location(),
+		)
+
+		if w.startsOn(from.Weekday()) && !t.Before(from) && t.Before(from.Add(w.Duration.Duration)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startsOn returns true if the window starts on d.
+func (w *Window) startsOn(d time.Weekday) (ok bool) {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, name := range w.Days {
+		if weekdays[strings.ToLower(name)] == d {
+			return true
+		}
+	}
+
+	return false
+}
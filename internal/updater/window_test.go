@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		w          *Window
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		w: &Window{
+			Days:     []string{"mon", "Sat"},
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: 2 * time.Hour},
+		},
+	}, {
+		name:       "bad_day",
+		wantErrMsg: `days: bad day "monday"`,
+		w: &Window{
+			Days:     []string{"monday"},
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: 2 * time.Hour},
+		},
+	}, {
+		name:       "duplicate_day",
+		wantErrMsg: `days: duplicate day "mon"`,
+		w: &Window{
+			Days:     []string{"mon", "MON"},
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: 2 * time.Hour},
+		},
+	}, {
+		name:       "bad_start",
+		wantErrMsg: `start: parsing time "3am" as "15:04": cannot parse "am" as ":"`,
+		w: &Window{
+			Start:    "3am",
+			Duration: timeutil.Duration{Duration: 2 * time.Hour},
+		},
+	}, {
+		name:       "zero_duration",
+		wantErrMsg: "duration: must be positive",
+		w: &Window{
+			Start: "03:00",
+		},
+	}, {
+		name:       "long_duration",
+		wantErrMsg: "duration: must not be longer than 24h0m0s",
+		w: &Window{
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: 25 * time.Hour},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.w.Validate())
+		})
+	}
+}
+
+func TestWindow_Contains(t *testing.T) {
+	// Saturday from 23:00 until 01:00 on Sunday.
+	w := &Window{
+		Days:     []string{"sat"},
+		Start:    "23:00",
+		Duration: timeutil.Duration{Duration: 2 * time.Hour},
+	}
+
+	testCases := []struct {
+		t    time.Time
+		name string
+		want bool
+	}{{
+		t:    time.Date(2023, time.April, 1, 23, 30, 0, 0, time.UTC),
+		name: "saturday_inside",
+		want: true,
+	}, {
+		t:    time.Date(2023, time.April, 2, 0, 30, 0, 0, time.UTC),
+		name: "sunday_after_midnight",
+		want: true,
+	}, {
+		t:    time.Date(2023, time.April, 2, 1, 0, 0, 0, time.UTC),
+		name: "sunday_end",
+		want: false,
+	}, {
+		t:    time.Date(2023, time.April, 1, 22, 59, 0, 0, time.UTC),
+		name: "saturday_before",
+		want: false,
+	}, {
+		t:    time.Date(2023, time.April, 3, 23, 30, 0, 0, time.UTC),
+		name: "monday",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, w.Contains(tc.t))
+		})
+	}
+
+	t.Run("every_day", func(t *testing.T) {
+		daily := &Window{
+			Start:    "03:00",
+			Duration: timeutil.Duration{Duration: time.Hour},
+		}
+
+		assert.True(t, daily.Contains(time.Date(2023, time.April, 5, 3, 10, 0, 0, time.UTC)))
+	})
+}
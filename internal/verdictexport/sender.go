@@ -0,0 +1,205 @@
+package verdictexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// sender sends the records to an endpoint.
+type sender interface {
+	// send sends the batch of records.
+	send(records []*Record) (err error)
+
+	// batchSize returns the maximum number of records sent at once.
+	batchSize() (n int)
+
+	// close closes the connection to the endpoint.
+	close() (err error)
+}
+
+// newSender returns a new sender for the endpoint described by c.
+func newSender(c *Config) (s sender, err error) {
+	switch c.Protocol {
+	case ProtocolUDP:
+		var conn net.Conn
+		conn, err = net.Dial("udp", c.Address)
+		if err != nil {
+			return nil, fmt.Errorf("dialing: %w", err)
+		}
+
+		return &udpSender{conn: conn}, nil
+	case ProtocolGRPC:
+		var conn *grpc.ClientConn
+		conn, err = grpc.Dial(
+			c.Address,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("dialing: %w", err)
+		}
+
+		return &grpcSender{conn: conn}, nil
+	default:
+		return nil, fmt.Errorf("bad protocol %q", c.Protocol)
+	}
+}
+
+// udpSender sends each record as a JSON object in a single datagram.
+type udpSender struct {
+	conn net.Conn
+}
+
+// type check
+var _ sender = (*udpSender)(nil)
+
+// send implements the [sender] interface for *udpSender.
+func (s *udpSender) send(records []*Record) (err error) {
+	for _, r := range records {
+		var b []byte
+		b, err = json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("encoding: %w", err)
+		}
+
+		_, err = s.conn.Write(b)
+		if err != nil {
+			return fmt.Errorf("writing: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// batchSize implements the [sender] interface for *udpSender.  The records
+// are sent as soon as they are queued.
+func (s *udpSender) batchSize() (n int) {
+	return 1
+}
+
+// close implements the [sender] interface for *udpSender.
+func (s *udpSender) close() (err error) {
+	return s.conn.Close()
+}
+
+// methodExport is the full name of the gRPC method receiving the records.  See
+// verdictexport.proto.
+const methodExport = "/adguardhome.verdictexport.v1.VerdictExport/Export"
+
+// grpcSender sends the batches of records using the Export gRPC method.
+type grpcSender struct {
+	conn *grpc.ClientConn
+}
+
+// type check
+var _ sender = (*grpcSender)(nil)
+
+// send implements the [sender] interface for *grpcSender.
+func (s *grpcSender) send(records []*Record) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	return s.conn.Invoke(ctx, methodExport, &exportRequest{records: records}, &exportResponse{})
+}
+
+// batchSize implements the [sender] interface for *grpcSender.
+func (s *grpcSender) batchSize() (n int) {
+	return grpcBatchSize
+}
+
+// close implements the [sender] interface for *grpcSender.
+func (s *grpcSender) close() (err error) {
+	return s.conn.Close()
+}
+
+// exportRequest is the request of the Export method.
+type exportRequest struct {
+	records []*Record
+}
+
+// marshalProto appends the protobuf encoding of m to b.
+func (m *exportRequest) marshalProto(b []byte) (res []byte) {
+	for _, r := range m.records {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalRecord(nil, r))
+	}
+
+	return b
+}
+
+// exportResponse is the response of the Export method.  It has no fields.
+type exportResponse struct{}
+
+// marshalRecord appends the protobuf encoding of the Verdict message for r to
+// b.
+func marshalRecord(b []byte, r *Record) (res []byte) {
+	if !r.Time.IsZero() {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Time.UnixNano()))
+	}
+
+	b = appendString(b, 2, r.ClientIP)
+	b = appendString(b, 3, r.ClientID)
+	b = appendString(b, 4, r.Domain)
+	b = appendString(b, 5, r.QType)
+	b = appendString(b, 6, string(r.Verdict))
+	b = appendString(b, 7, r.Reason)
+	b = appendString(b, 8, r.Rule)
+	for _, t := range r.Tags {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendString(b, t)
+	}
+
+	return b
+}
+
+// appendString appends the string field to b unless s is empty.
+func appendString(b []byte, num protowire.Number, s string) (res []byte) {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendString(b, s)
+}
+
+// codec is the gRPC codec for the messages of the export protocol.  It's named
+// "proto", since the messages are encoded as protobuf according to
+// verdictexport.proto.
+type codec struct{}
+
+// type check
+var _ encoding.Codec = codec{}
+
+// Marshal implements the [encoding.Codec] interface for codec.
+func (codec) Marshal(v any) (data []byte, err error) {
+	m, ok := v.(*exportRequest)
+	if !ok {
+		return nil, fmt.Errorf("verdictexport: unsupported message type %T", v)
+	}
+
+	return m.marshalProto(nil), nil
+}
+
+// Unmarshal implements the [encoding.Codec] interface for codec.  The contents
+// of the responses are ignored.
+func (codec) Unmarshal(_ []byte, v any) (err error) {
+	if _, ok := v.(*exportResponse); !ok {
+		return fmt.Errorf("verdictexport: unsupported message type %T", v)
+	}
+
+	return nil
+}
+
+// Name implements the [encoding.Codec] interface for codec.
+func (codec) Name() (name string) {
+	return "proto"
+}
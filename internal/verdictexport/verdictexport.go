@@ -0,0 +1,300 @@
+// Package verdictexport mirrors the metadata of the DNS queries and the
+// filtering verdicts to the external endpoints, such as the policy engines of
+// the organizations correlating DNS with other telemetry.  The export is
+// fire-and-forget: the records are sampled and queued, and they are dropped
+// when the queue is full or the endpoint is unavailable.
+package verdictexport
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// Protocol is the protocol of an export endpoint.
+type Protocol string
+
+// Valid Protocol values.
+const (
+	// ProtocolUDP sends each record as a JSON object in a single UDP datagram.
+	ProtocolUDP Protocol = "udp"
+
+	// ProtocolGRPC sends the batches of records using the Export method of the
+	// gRPC service described in verdictexport.proto.
+	ProtocolGRPC Protocol = "grpc"
+)
+
+// Verdict is the outcome of the processing of a DNS query.
+type Verdict string
+
+// Valid Verdict values.
+const (
+	VerdictAllowed   Verdict = "allowed"
+	VerdictBlocked   Verdict = "blocked"
+	VerdictRewritten Verdict = "rewritten"
+)
+
+// Record is the exported metadata of a single DNS query.
+type Record struct {
+	// Time is the time of the query.
+	Time time.Time `json:"time"`
+
+	// ClientIP is the IP address of the client.
+	ClientIP string `json:"client_ip"`
+
+	// ClientID is the ClientID of the client, if any.
+	ClientID string `json:"client_id,omitempty"`
+
+	// Domain is the queried domain name without the trailing dot.
+	Domain string `json:"domain"`
+
+	// QType is the type of the question, for example "A".
+	QType string `json:"qtype"`
+
+	// Verdict is the outcome of the processing of the query.
+	Verdict Verdict `json:"verdict"`
+
+	// Reason is the reason of the filtering decision.
+	Reason string `json:"reason"`
+
+	// Rule is the text of the rule which has matched the query, if any.
+	Rule string `json:"rule,omitempty"`
+
+	// Tags are the tags of the persistent client, if any.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Parameters of the export queues.
+const (
+	queueSize     = 4096
+	grpcBatchSize = 100
+	flushIvl      = 1 * time.Second
+	sendTimeout   = 5 * time.Second
+)
+
+// Config is the configuration of a single export endpoint.
+type Config struct {
+	// Name is the unique name of the endpoint used in the logs.
+	Name string `yaml:"name"`
+
+	// Address is the host and port of the endpoint.
+	Address string `yaml:"address"`
+
+	// Protocol is the protocol of the endpoint.
+	Protocol Protocol `yaml:"protocol"`
+
+	// Tags are the client tags, the queries of which are exported.  If empty,
+	// the queries of all clients are exported.
+	Tags []string `yaml:"tags"`
+
+	// SampleRate is the share of the queries to export, from 0 to 1.  If zero,
+	// all queries are exported.
+	SampleRate float64 `yaml:"sample_rate"`
+
+	// Enabled defines if the queries are exported to the endpoint.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if the endpoint configuration isn't valid.
+func (c *Config) Validate() (err error) {
+	if c.Name == "" {
+		return errors.Error("name: empty")
+	}
+
+	_, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return fmt.Errorf("address: %w", err)
+	} else if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("address: bad port %q", port)
+	}
+
+	switch c.Protocol {
+	case ProtocolUDP, ProtocolGRPC:
+		// Go on.
+	default:
+		return fmt.Errorf("protocol: bad value %q", c.Protocol)
+	}
+
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample_rate: must be from 0 to 1, got %v", c.SampleRate)
+	}
+
+	return nil
+}
+
+// ValidateConfigs returns an error if any of confs isn't valid or if their
+// names aren't unique.
+func ValidateConfigs(confs []*Config) (err error) {
+	names := stringutil.NewSet()
+	for i, c := range confs {
+		err = c.Validate()
+		if err != nil {
+			return fmt.Errorf("verdict export at index %d: %w", i, err)
+		} else if names.Has(c.Name) {
+			return fmt.Errorf("verdict export at index %d: duplicate name %q", i, c.Name)
+		}
+
+		names.Add(c.Name)
+	}
+
+	return nil
+}
+
+// Manager sends the records to the enabled endpoints.
+type Manager struct {
+	done      chan struct{}
+	wg        *sync.WaitGroup
+	exporters []*exporter
+}
+
+// NewManager returns a new *Manager.  confs must be valid, see
+// [ValidateConfigs].  The records are only sent after [Manager.Start].
+func NewManager(confs []*Config) (m *Manager) {
+	m = &Manager{
+		done: make(chan struct{}),
+		wg:   &sync.WaitGroup{},
+	}
+
+	for _, c := range confs {
+		if !c.Enabled {
+			continue
+		}
+
+		m.exporters = append(m.exporters, &exporter{
+			conf:    c,
+			tags:    stringutil.NewSet(c.Tags...),
+			records: make(chan *Record, queueSize),
+		})
+	}
+
+	return m
+}
+
+// Len returns the number of enabled endpoints.
+func (m *Manager) Len() (n int) {
+	return len(m.exporters)
+}
+
+// Start connects to the endpoints and starts sending the records.  The
+// endpoints, which failed to connect, are logged and skipped.
+func (m *Manager) Start() {
+	for _, e := range m.exporters {
+		s, err := newSender(e.conf)
+		if err != nil {
+			log.Error("verdictexport: %q: %s", e.conf.Name, err)
+
+			continue
+		}
+
+		m.wg.Add(1)
+		go func(e *exporter) {
+			defer m.wg.Done()
+
+			e.loop(s, m.done)
+		}(e)
+	}
+}
+
+// Close stops sending the records.
+func (m *Manager) Close() (err error) {
+	close(m.done)
+	m.wg.Wait()
+
+	return nil
+}
+
+// Export queues r for sending to the endpoints, the tags of which match the
+// ones of r, after sampling.  r must not be modified after calling Export.
+func (m *Manager) Export(r *Record) {
+	for _, e := range m.exporters {
+		if e.matches(r) && e.sampled() {
+			e.queue(r)
+		}
+	}
+}
+
+// exporter is a configured endpoint.
+type exporter struct {
+	conf    *Config
+	tags    *stringutil.Set
+	records chan *Record
+}
+
+// matches returns true if r must be exported to e according to its tags.
+func (e *exporter) matches(r *Record) (ok bool) {
+	if e.tags.Len() == 0 {
+		return true
+	}
+
+	for _, t := range r.Tags {
+		if e.tags.Has(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sampled returns true if the record is picked for the export according to the
+// sample rate.
+func (e *exporter) sampled() (ok bool) {
+	rate := e.conf.SampleRate
+
+	return rate == 0 || rate == 1 || rand.Float64() < rate
+}
+
+// queue queues r.  r is dropped if the queue is full.
+func (e *exporter) queue(r *Record) {
+	select {
+	case e.records <- r:
+		// Go on.
+	default:
+		log.Debug("verdictexport: %q: queue is full, dropping record", e.conf.Name)
+	}
+}
+
+// loop sends the queued records using s in batches until done is closed.
+func (e *exporter) loop(s sender, done <-chan struct{}) {
+	defer log.OnPanic("verdictexport")
+	defer func() {
+		err := s.close()
+		if err != nil {
+			log.Debug("verdictexport: %q: closing: %s", e.conf.Name, err)
+		}
+	}()
+
+	batchSize := s.batchSize()
+	ticker := time.NewTicker(flushIvl)
+	defer ticker.Stop()
+
+	batch := make([]*Record, 0, batchSize)
+	for {
+		select {
+		case <-done:
+			return
+		case r := <-e.records:
+			batch = append(batch, r)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		err := s.send(batch)
+		if err != nil {
+			log.Debug("verdictexport: %q: sending %d records: %s", e.conf.Name, len(batch), err)
+		}
+
+		batch = make([]*Record, 0, batchSize)
+	}
+}
@@ -0,0 +1,137 @@
+package verdictexport_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/verdictexport"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	testutil.DiscardLogOutput(m)
+}
+
+func TestManager_Export_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	m := verdictexport.NewManager([]*verdictexport.Config{{
+		Name:     "disabled",
+		Address:  "127.0.0.1:1",
+		Protocol: verdictexport.ProtocolUDP,
+		Enabled:  false,
+	}, {
+		Name:     "kids",
+		Address:  conn.LocalAddr().String(),
+		Protocol: verdictexport.ProtocolUDP,
+		Tags:     []string{"user_child"},
+		Enabled:  true,
+	}})
+	require.Equal(t, 1, m.Len())
+
+	m.Start()
+	testutil.CleanupAndRequireSuccess(t, m.Close)
+
+	want := &verdictexport.Record{
+		Time:     time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ClientIP: "192.168.0.2",
+		Domain:   "blocked.example",
+		QType:    "A",
+		Verdict:  verdictexport.VerdictBlocked,
+		Reason:   "FilteredBlackList",
+		Rule:     "||blocked.example^",
+		Tags:     []string{"device_phone", "user_child"},
+	}
+
+	m.Export(&verdictexport.Record{
+		ClientIP: "192.168.0.3",
+		Domain:   "other.example",
+		Verdict:  verdictexport.VerdictAllowed,
+		Tags:     []string{"user_admin"},
+	})
+	m.Export(want)
+
+	err = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	got := &verdictexport.Record{}
+	err = json.Unmarshal(buf[:n], got)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, got)
+}
+
+func TestValidateConfigs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*verdictexport.Config
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		confs: []*verdictexport.Config{{
+			Name:       "siem",
+			Address:    "siem.example:5514",
+			Protocol:   verdictexport.ProtocolUDP,
+			SampleRate: 0.5,
+		}, {
+			Name:     "policy",
+			Address:  "127.0.0.1:9000",
+			Protocol: verdictexport.ProtocolGRPC,
+		}},
+	}, {
+		name:       "bad_address",
+		wantErrMsg: "verdict export at index 0: address: address siem.example: missing port in address",
+		confs: []*verdictexport.Config{{
+			Name:     "siem",
+			Address:  "siem.example",
+			Protocol: verdictexport.ProtocolUDP,
+		}},
+	}, {
+		name:       "bad_protocol",
+		wantErrMsg: `verdict export at index 0: protocol: bad value "tcp"`,
+		confs: []*verdictexport.Config{{
+			Name:     "siem",
+			Address:  "siem.example:5514",
+			Protocol: "tcp",
+		}},
+	}, {
+		name:       "bad_sample_rate",
+		wantErrMsg: "verdict export at index 0: sample_rate: must be from 0 to 1, got 1.5",
+		confs: []*verdictexport.Config{{
+			Name:       "siem",
+			Address:    "siem.example:5514",
+			Protocol:   verdictexport.ProtocolUDP,
+			SampleRate: 1.5,
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `verdict export at index 1: duplicate name "siem"`,
+		confs: []*verdictexport.Config{{
+			Name:     "siem",
+			Address:  "siem.example:5514",
+			Protocol: verdictexport.ProtocolUDP,
+		}, {
+			Name:     "siem",
+			Address:  "siem.example:5515",
+			Protocol: verdictexport.ProtocolUDP,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verdictexport.ValidateConfigs(tc.confs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
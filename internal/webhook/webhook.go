@@ -0,0 +1,378 @@
+// Package webhook contains the dispatcher of the AdGuard Home events to the
+// HTTP endpoints configured by user.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// HTTP headers of the webhook requests.
+const (
+	// HeaderEvent is the header with the type of the event.
+	HeaderEvent = "X-AdGuardHome-Event"
+
+	// HeaderTimestamp is the header with the Unix time of the request in
+	// seconds.
+	HeaderTimestamp = "X-AdGuardHome-Timestamp"
+
+	// HeaderSignature is the header with the signature of the request, which
+	// is "sha256=" followed by the hex-encoded HMAC-SHA256 of the timestamp,
+	// a dot, and the body, with the secret as the key.
+	HeaderSignature = "X-AdGuardHome-Signature"
+)
+
+// Default values of the dispatcher parameters.
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = 1 * time.Second
+)
+
+// queueSize is the maximum number of the deliveries waiting to be sent.  The
+// events are dropped when the queue is full.
+const queueSize = 1024
+
+// requestTimeout is the timeout of a single request to a webhook.
+const requestTimeout = 10 * time.Second
+
+// Config is the configuration of a single webhook.
+type Config struct {
+	// Name is the name of the webhook used in the logs.
+	Name string `yaml:"name"`
+
+	// URL is the URL to which the events are sent with POST requests.
+	URL string `yaml:"url"`
+
+	// Secret, if not empty, is the key used to sign the requests.  See
+	// [HeaderSignature].
+	Secret string `yaml:"secret"`
+
+	// Template is the text/template of the JSON request body.  It's executed
+	// with the *aghevent.Event, and the "json" function encodes a value as
+	// JSON.  If empty, the event itself is encoded as JSON.
+	Template string `yaml:"template"`
+
+	// Events are the types of the events sent to the webhook.
+	Events []aghevent.Type `yaml:"events"`
+
+	// Domains are the watched domains.  The events of the type
+	// [aghevent.TypeQueryBlocked] are only sent if the queried domain is one
+	// of these or their subdomain.  If empty, all such events are sent.
+	Domains []string `yaml:"domains"`
+
+	// Enabled defines if the events are sent to the webhook.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if the webhook configuration isn't valid.
+func (c *Config) Validate() (err error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url: %q is not an absolute http or https url", c.URL)
+	}
+
+	if len(c.Events) == 0 {
+		return errors.Error("events: no events")
+	}
+
+	for i, t := range c.Events {
+		err = t.Validate()
+		if err != nil {
+			return fmt.Errorf("events: at index %d: %w", i, err)
+		}
+	}
+
+	_, err = newTemplate(c.Template)
+	if err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+
+	return nil
+}
+
+// newTemplate parses the payload template text.  tmpl is nil if text is empty.
+func newTemplate(text string) (tmpl *template.Template, err error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New("payload").Funcs(template.FuncMap{
+		"json": func(v any) (s string, err error) {
+			b, err := json.Marshal(v)
+
+			return string(b), err
+		},
+	}).Option("missingkey=zero").Parse(text)
+}
+
+// webhook is a configured webhook ready to send the events.
+type webhook struct {
+	// conf is the configuration of the webhook.
+	conf *Config
+
+	// tmpl is the template of the request body.  It's nil if the event is
+	// sent as is.
+	tmpl *template.Template
+
+	// filter selects the events sent to the webhook.
+	filter *aghevent.Filter
+}
+
+// payload returns the request body for e.
+func (w *webhook) payload(e *aghevent.Event) (body []byte, err error) {
+	if w.tmpl == nil {
+		return json.Marshal(e)
+	}
+
+	buf := &bytes.Buffer{}
+	err = w.tmpl.Execute(buf, e)
+	if err != nil {
+		return nil, fmt.Errorf("executing template: %w", err)
+	}
+
+	body = buf.Bytes()
+	if !json.Valid(body) {
+		return nil, errors.Error("template result is not valid json")
+	}
+
+	return body, nil
+}
+
+// delivery is a single request to send.
+type delivery struct {
+	hook  *webhook
+	event aghevent.Type
+	body  []byte
+}
+
+// DispatcherConfig is the configuration of a [Dispatcher].
+type DispatcherConfig struct {
+	// Client is used to send the requests.  It must not be nil.
+	Client *http.Client
+
+	// Webhooks are the configured webhooks.  The disabled ones are ignored.
+	Webhooks []*Config
+
+	// RetryDelay is the delay before the first retry of a failed request.
+	// Each next delay is twice as long.
+	RetryDelay time.Duration
+
+	// MaxRetries is the maximum number of retries of a failed request.
+	MaxRetries int
+}
+
+// Dispatcher sends the events to the matching webhooks.  It retries the
+// failed requests in background.
+type Dispatcher struct {
+	client     *http.Client
+	queue      chan *delivery
+	done       chan struct{}
+	hooks      []*webhook
+	retryDelay time.Duration
+	maxRetries int
+}
+
+// type check
+var _ aghevent.Handler = (*Dispatcher)(nil)
+
+// NewDispatcher returns a new properly initialized *Dispatcher.  c must be
+// valid, see [Config.Validate].
+func NewDispatcher(c *DispatcherConfig) (d *Dispatcher, err error) {
+	d = &Dispatcher{
+		client:     c.Client,
+		queue:      make(chan *delivery, queueSize),
+		done:       make(chan struct{}),
+		retryDelay: c.RetryDelay,
+		maxRetries: c.MaxRetries,
+	}
+
+	for i, conf := range c.Webhooks {
+		if !conf.Enabled {
+			continue
+		}
+
+		w := &webhook{
+			conf:   conf,
+			filter: aghevent.NewFilter(conf.Events, conf.Domains),
+		}
+
+		w.tmpl, err = newTemplate(conf.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook at index %d: template: %w", i, err)
+		}
+
+		d.hooks = append(d.hooks, w)
+	}
+
+	return d, nil
+}
+
+// Len returns the number of enabled webhooks.
+func (d *Dispatcher) Len() (n int) {
+	return len(d.hooks)
+}
+
+// Handle implements the [aghevent.Handler] interface for *Dispatcher.  It
+// queues the requests for the matching webhooks.
+func (d *Dispatcher) Handle(e *aghevent.Event) {
+	for _, w := range d.hooks {
+		if !w.filter.Match(e) {
+			continue
+		}
+
+		body, err := w.payload(e)
+		if err != nil {
+			log.Error("webhook %q: %s event: %s", w.conf.Name, e.Type, err)
+
+			continue
+		}
+
+		select {
+		case d.queue <- &delivery{hook: w, event: e.Type, body: body}:
+			// Go on.
+		default:
+			log.Info("webhook %q: queue is full, dropping %s event", w.conf.Name, e.Type)
+		}
+	}
+}
+
+// Start starts sending the queued requests in a separate goroutine.
+func (d *Dispatcher) Start() {
+	go d.loop()
+}
+
+// Close stops sending the requests.  The queued ones are dropped.
+func (d *Dispatcher) Close() (err error) {
+	close(d.done)
+
+	return nil
+}
+
+// loop sends the queued requests until d is closed.
+func (d *Dispatcher) loop() {
+	defer log.OnPanic("webhook")
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case dl := <-d.queue:
+			d.deliver(dl)
+		}
+	}
+}
+
+// deliver sends dl retrying on the temporary failures.
+func (d *Dispatcher) deliver(dl *delivery) {
+	delay := d.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := d.send(dl)
+		if err == nil {
+			return
+		}
+
+		var serr *statusError
+		temporary := !errors.As(err, &serr) || serr.temporary()
+		if !temporary || attempt >= d.maxRetries {
+			log.Error("webhook %q: sending %s event: %s", dl.hook.conf.Name, dl.event, err)
+
+			return
+		}
+
+		log.Debug("webhook %q: retrying in %s after error: %s", dl.hook.conf.Name, delay, err)
+
+		select {
+		case <-d.done:
+			return
+		case <-time.After(delay):
+			delay *= 2
+		}
+	}
+}
+
+// statusError is returned when a webhook responds with an unexpected status
+// code.
+type statusError struct {
+	code int
+}
+
+// type check
+var _ error = (*statusError)(nil)
+
+// Error implements the error interface for *statusError.
+func (err *statusError) Error() (msg string) {
+	return fmt.Sprintf("unexpected status code %d", err.code)
+}
+
+// temporary returns true if the request may succeed when retried.
+func (err *statusError) temporary() (ok bool) {
+	return err.code >= http.StatusInternalServerError || err.code == http.StatusTooManyRequests
+}
+
+// send sends a single request for dl.
+func (d *Dispatcher) send(dl *delivery) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		dl.hook.conf.URL,
+		bytes.NewReader(dl.body),
+	)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(dl.event))
+	req.Header.Set(HeaderTimestamp, ts)
+	if secret := dl.hook.conf.Secret; secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, ts, dl.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	// Drain the body to reuse the connection.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Sign returns the value of the [HeaderSignature] header for the request with
+// the timestamp ts and body.
+func Sign(secret, ts string, body []byte) (sig string) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(ts))
+	_, _ = mac.Write([]byte{'.'})
+	_, _ = mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,205 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghevent"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	newConf := func() (c *webhook.Config) {
+		return &webhook.Config{
+			URL:    "https://hooks.example/agh",
+			Events: []aghevent.Type{aghevent.TypeQueryBlocked},
+		}
+	}
+
+	testCases := []struct {
+		modify     func(c *webhook.Config)
+		name       string
+		wantErrMsg string
+	}{{
+		modify:     func(_ *webhook.Config) {},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		modify:     func(c *webhook.Config) { c.URL = "hooks.example" },
+		name:       "relative_url",
+		wantErrMsg: `url: "hooks.example" is not an absolute http or https url`,
+	}, {
+		modify:     func(c *webhook.Config) { c.Events = nil },
+		name:       "no_events",
+		wantErrMsg: "events: no events",
+	}, {
+		modify:     func(c *webhook.Config) { c.Events = append(c.Events, "boot") },
+		name:       "bad_event",
+		wantErrMsg: `events: at index 1: bad event type "boot"`,
+	}, {
+		modify:     func(c *webhook.Config) { c.Template = "{{ .Data.domain " },
+		name:       "bad_template",
+		wantErrMsg: `template: template: payload:1: unclosed action`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newConf()
+			tc.modify(c)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, c.Validate())
+		})
+	}
+}
+
+// request is a request received by the test server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// newTestServer returns a server that sends the received requests into the
+// returned channel and responds with the codes from codes in order and with
+// 200 OK after that.
+func newTestServer(t *testing.T, codes ...int) (srv *httptest.Server, reqs chan *request) {
+	t.Helper()
+
+	reqs = make(chan *request, 10)
+	var n atomic.Int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		reqs <- &request{header: r.Header, body: body}
+
+		if i := int(n.Add(1)) - 1; i < len(codes) {
+			w.WriteHeader(codes[i])
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, reqs
+}
+
+// receive returns the next request from reqs or fails the test after a
+// timeout.
+func receive(t *testing.T, reqs chan *request) (r *request) {
+	t.Helper()
+
+	select {
+	case r = <-reqs:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no request")
+	}
+
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	const secret = "secret"
+
+	srv, reqs := newTestServer(t, http.StatusServiceUnavailable)
+
+	d, err := webhook.NewDispatcher(&webhook.DispatcherConfig{
+		Client: srv.Client(),
+		Webhooks: []*webhook.Config{{
+			Name:     "watched",
+			URL:      srv.URL,
+			Secret:   secret,
+			Template: `{"text": {{ printf "%s blocked" .Data.domain | json }}}`,
+			Events:   []aghevent.Type{aghevent.TypeQueryBlocked},
+			Domains:  []string{"example.org"},
+			Enabled:  true,
+		}, {
+			Name:    "disabled",
+			URL:     srv.URL,
+			Events:  []aghevent.Type{aghevent.TypeQueryBlocked},
+			Enabled: false,
+		}},
+		RetryDelay: time.Millisecond,
+		MaxRetries: 1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, d.Len())
+
+	d.Start()
+	t.Cleanup(func() { require.NoError(t, d.Close()) })
+
+	bus := aghevent.NewBus()
+	bus.Subscribe(d)
+
+	// Not watched.
+	bus.Publish(aghevent.TypeQueryBlocked, map[string]string{"domain": "example.com"})
+	// Not subscribed.
+	bus.Publish(aghevent.TypeUpdateAvailable, map[string]string{"version": "v1"})
+	// Watched subdomain.
+	bus.Publish(aghevent.TypeQueryBlocked, map[string]string{"domain": "ads.example.org"})
+
+	// The first attempt fails with a temporary error and is retried.
+	for i := 0; i < 2; i++ {
+		r := receive(t, reqs)
+
+		assert.JSONEq(t, `{"text": "ads.example.org blocked"}`, string(r.body))
+		assert.Equal(t, string(aghevent.TypeQueryBlocked), r.header.Get(webhook.HeaderEvent))
+
+		ts := r.header.Get(webhook.HeaderTimestamp)
+		assert.Equal(t, webhook.Sign(secret, ts, r.body), r.header.Get(webhook.HeaderSignature))
+	}
+
+	select {
+	case r := <-reqs:
+		t.Errorf("unexpected request: %s", r.body)
+	case <-time.After(50 * time.Millisecond):
+		// Go on.
+	}
+}
+
+func TestDispatcher_defaultPayload(t *testing.T) {
+	srv, reqs := newTestServer(t, http.StatusBadRequest)
+
+	d, err := webhook.NewDispatcher(&webhook.DispatcherConfig{
+		Client: srv.Client(),
+		Webhooks: []*webhook.Config{{
+			URL:     srv.URL,
+			Events:  []aghevent.Type{aghevent.TypeFilterUpdateFailed},
+			Enabled: true,
+		}},
+		RetryDelay: time.Millisecond,
+		MaxRetries: 3,
+	})
+	require.NoError(t, err)
+
+	d.Start()
+	t.Cleanup(func() { require.NoError(t, d.Close()) })
+
+	data := map[string]string{"name": "List", "url": "https://lists.example", "error": "timeout"}
+	d.Handle(&aghevent.Event{Type: aghevent.TypeFilterUpdateFailed, Data: data})
+
+	r := receive(t, reqs)
+
+	got := &aghevent.Event{}
+	err = json.Unmarshal(r.body, got)
+	require.NoError(t, err)
+
+	assert.Equal(t, aghevent.TypeFilterUpdateFailed, got.Type)
+	assert.Equal(t, data, got.Data)
+	assert.Empty(t, r.header.Get(webhook.HeaderSignature))
+
+	// Client errors aren't retried.
+	select {
+	case <-reqs:
+		t.Error("unexpected retry")
+	case <-time.After(50 * time.Millisecond):
+		// Go on.
+	}
+}
@@ -15,6 +15,9 @@ import (
 //go:embed build
 var clientBuildFS embed.FS
 
+//go:embed openapi/openapi.yaml openapi/v1.yaml
+var openAPIFS embed.FS
+
 func main() {
-	cmd.Main(clientBuildFS)
+	cmd.Main(clientBuildFS, openAPIFS)
 }
@@ -0,0 +1,146 @@
+#!/bin/sh
+
+# This comment is used to simplify checking local copies of the script.  Bump
+# this number every time a significant change is made to this script.
+#
+# AdGuard-Project-Version: 1
+
+verbose="${VERBOSE:-0}"
+readonly verbose
+
+# Verbosity levels:
+#   0 = Don't print anything except for errors.
+#   1 = Print commands, but not nested commands.
+#   2 = Print everything.
+if [ "$verbose" -gt '1' ]
+then
+	set -x
+	v_flags='-v=1'
+	x_flags='-x=1'
+elif [ "$verbose" -gt '0' ]
+then
+	set -x
+	v_flags='-v=1'
+	x_flags='-x=0'
+else
+	set +x
+	v_flags='-v=0'
+	x_flags='-x=0'
+fi
+readonly v_flags x_flags
+
+set -e -f -u
+
+go="${GO:-go}"
+readonly go
+
+bench="${BENCH:-.}"
+baseline="${BENCH_BASELINE:-./benchmark-baseline.txt}"
+count="${BENCH_COUNT:-5}"
+threshold="${BENCH_THRESHOLD:-20}"
+update="${BENCH_UPDATE:-0}"
+readonly bench baseline count threshold update
+
+output="$( mktemp )"
+readonly output
+
+trap 'rm -f "$output"' EXIT
+
+# Don't pipe the output into tee, since that would hide the failures.
+if ! "$go" test\
+	--bench="$bench"\
+	--benchmem\
+	--count="$count"\
+	--run='^$'\
+	"$x_flags"\
+	"$v_flags"\
+	./internal/...\
+	> "$output"
+then
+	cat "$output"
+
+	exit 1
+fi
+
+if [ "$update" -ne '0' ] || ! [ -f "$baseline" ]
+then
+	cp "$output" "$baseline"
+	echo "baseline written to $baseline"
+
+	exit 0
+fi
+
+# Compare the mean time and the mean number of allocations of each benchmark
+# against the baseline.  A benchmark regresses if it becomes slower by more than
+# threshold percent or makes at least one more allocation on average.  The
+# latter tolerates the occasional allocations in the concurrent code.
+awk\
+	-v base="$baseline"\
+	-v threshold="$threshold"\
+	'
+	/^pkg: / {
+		pkg = $2
+
+		next
+	}
+
+	!/^Benchmark/ || $4 != "ns/op" {
+		next
+	}
+
+	{
+		name = pkg "." $1
+		allocs = 0
+		for (i = 5; i < NF; i++) {
+			if ($(i + 1) == "allocs/op") {
+				allocs = $i
+			}
+		}
+
+		if (FILENAME == base) {
+			base_ns[name] += $3
+			base_allocs[name] += allocs
+			base_n[name]++
+
+			next
+		}
+
+		if (!(name in cur_n)) {
+			names[++num] = name
+		}
+
+		cur_ns[name] += $3
+		cur_allocs[name] += allocs
+		cur_n[name]++
+	}
+
+	END {
+		failed = 0
+		for (k = 1; k <= num; k++) {
+			name = names[k]
+			cur = cur_ns[name] / cur_n[name]
+			cur_all = cur_allocs[name] / cur_n[name]
+			if (!(name in base_n)) {
+				printf "%s\t%.0f ns/op\tnew\n", name, cur
+
+				continue
+			}
+
+			prev = base_ns[name] / base_n[name]
+			prev_all = base_allocs[name] / base_n[name]
+			delta = (cur - prev) * 100 / prev
+
+			status = "ok"
+			if (delta > threshold || cur_all - prev_all >= 1) {
+				status = "REGRESSION"
+				failed = 1
+			}
+
+			printf "%s\t%.0f -> %.0f ns/op (%+.1f%%)\t%.1f -> %.1f allocs/op\t%s\n",\
+				name, prev, cur, delta, prev_all, cur_all, status
+		}
+
+		exit failed
+	}
+	'\
+	"$baseline" "$output"
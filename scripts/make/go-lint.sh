@@ -120,6 +120,7 @@ underscores() {
 			-e '_bsd.go'\
 			-e '_darwin.go'\
 			-e '_freebsd.go'\
+			-e '_grpc.pb.go'\
 			-e '_linux.go'\
 			-e '_little.go'\
 			-e '_next.go'\
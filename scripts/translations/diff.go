@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/slices"
+)
+
+// diff prints the text labels missing from the locale of the language, the
+// ones present only in it, and the ones with the same value as in the base
+// locale, which are likely untranslated.  The language code is taken from the
+// command-line arguments.
+func diff(langs languages, baseLang langCode) (err error) {
+	if len(os.Args) < 3 {
+		usage("need a language code")
+	}
+
+	lang := langCode(os.Args[2])
+	if _, ok := langs[lang]; !ok {
+		return fmt.Errorf("diff: unknown language %q", lang)
+	} else if lang == baseLang {
+		return fmt.Errorf("diff: %q is the base language", lang)
+	}
+
+	baseLoc, err := readLocales(filepath.Join(localesDir, defaultBaseFile))
+	if err != nil {
+		return fmt.Errorf("diff: %w", err)
+	}
+
+	loc, err := readLocales(filepath.Join(localesDir, string(lang)+".json"))
+	if err != nil {
+		return fmt.Errorf("diff: reading locales: %w", err)
+	}
+
+	var missing, extra, same []textLabel
+	for label, val := range baseLoc {
+		tr, ok := loc[label]
+		if !ok {
+			missing = append(missing, label)
+		} else if tr == val {
+			same = append(same, label)
+		}
+	}
+
+	for label := range loc {
+		if _, ok := baseLoc[label]; !ok {
+			extra = append(extra, label)
+		}
+	}
+
+	printLabels("missing", missing, nil)
+	printLabels("extra", extra, nil)
+	printLabels("same as base", same, baseLoc)
+
+	return nil
+}
+
+// printLabels prints the sorted text labels under the header.  If loc is not
+// nil, the values of the text labels from it are printed as well.
+func printLabels(header string, labels []textLabel, loc locales) {
+	slices.Sort(labels)
+
+	fmt.Printf("%s (%d):\n", header, len(labels))
+	for _, label := range labels {
+		if loc == nil {
+			fmt.Printf("  %s\n", label)
+
+			continue
+		}
+
+		fmt.Printf("  %s: %q\n", label, loc[label])
+	}
+}
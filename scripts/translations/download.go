@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghio"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// downloadJob is a single locale to download.
+type downloadJob struct {
+	// uri is the URL of the download with the query parameters.
+	uri *url.URL
+
+	// lang is the language code of the locale.
+	lang langCode
+}
+
+// download and save all translations.  uri is the base URL.  projectID is the
+// name of the project.  If there are languages in the command-line arguments,
+// only those are downloaded, which allows to resume a partially failed
+// download.
+func download(uri *url.URL, projectID string, langs languages) (err error) {
+	var numWorker, retries int
+	var rps float64
+
+	flagSet := flag.NewFlagSet("download", flag.ExitOnError)
+	flagSet.Usage = func() {
+		usage("download command error")
+	}
+	flagSet.IntVar(&numWorker, "n", 1, "number of concurrent downloads")
+	flagSet.IntVar(&retries, "r", 3, "number of retries of failed downloads")
+	flagSet.Float64Var(&rps, "rps", 0, "maximum number of requests per second")
+
+	err = flagSet.Parse(os.Args[2:])
+	if err != nil {
+		// Don't wrap the error since there is exit on error.
+		return err
+	}
+
+	if numWorker < 1 {
+		usage("count must be positive")
+	} else if retries < 0 {
+		usage("retries must not be negative")
+	} else if rps < 0 {
+		usage("rate must not be negative")
+	}
+
+	codes, err := downloadLangs(langs, flagSet.Args())
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+
+	var limit <-chan time.Time
+	if rps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+		defer ticker.Stop()
+
+		limit = ticker.C
+	}
+
+	downloadURI := uri.JoinPath("download")
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	var wg sync.WaitGroup
+	jobCh := make(chan downloadJob, len(codes))
+	failedCh := make(chan langCode, len(codes))
+
+	for i := 0; i < numWorker; i++ {
+		wg.Add(1)
+		go downloadWorker(&wg, client, retries+1, limit, jobCh, failedCh)
+	}
+
+	for _, lang := range codes {
+		jobCh <- downloadJob{
+			uri:  translationURL(downloadURI, defaultBaseFile, projectID, lang),
+			lang: lang,
+		}
+	}
+
+	close(jobCh)
+	wg.Wait()
+	close(failedCh)
+
+	var failed []string
+	for lang := range failedCh {
+		failed = append(failed, string(lang))
+	}
+
+	if len(failed) > 0 {
+		slices.Sort(failed)
+
+		return fmt.Errorf(
+			"download: %d of %d locales failed, resume with: download %s",
+			len(failed),
+			len(codes),
+			strings.Join(failed, " "),
+		)
+	}
+
+	return nil
+}
+
+// downloadLangs returns the sorted codes of the languages to download.  args
+// are the language codes from the command-line arguments, if any, which must
+// be in langs.
+func downloadLangs(langs languages, args []string) (codes []langCode, err error) {
+	if len(args) == 0 {
+		codes = maps.Keys(langs)
+		slices.Sort(codes)
+
+		return codes, nil
+	}
+
+	for _, arg := range args {
+		lang := langCode(arg)
+		if _, ok := langs[lang]; !ok {
+			return nil, fmt.Errorf("unknown language %q", lang)
+		}
+
+		codes = append(codes, lang)
+	}
+
+	return codes, nil
+}
+
+// downloadWorker downloads translations by received jobs and saves them
+// normalized, so that the diffs contain only the changes of the translations.
+// The languages, which failed to download after maxAttempts attempts, are sent
+// to failedCh.
+func downloadWorker(
+	wg *sync.WaitGroup,
+	client *http.Client,
+	maxAttempts int,
+	limit <-chan time.Time,
+	jobCh <-chan downloadJob,
+	failedCh chan<- langCode,
+) {
+	defer wg.Done()
+
+	for job := range jobCh {
+		var data []byte
+		err := retry(job.lang, maxAttempts, limit, func() (err error) {
+			data, err = getTranslation(client, job.uri.String())
+
+			return err
+		})
+		if err != nil {
+			log.Error("download worker: getting translation: %s", err)
+			failedCh <- job.lang
+
+			continue
+		}
+
+		loc := locales{}
+		err = json.Unmarshal(data, &loc)
+		if err != nil {
+			log.Error("download worker: unmarshalling %s: %s", job.lang, err)
+			failedCh <- job.lang
+
+			continue
+		}
+
+		name := filepath.Join(localesDir, string(job.lang)+".json")
+		err = writeLocales(name, loc)
+		if err != nil {
+			log.Error("download worker: %s", err)
+			failedCh <- job.lang
+
+			continue
+		}
+
+		fmt.Println(name)
+	}
+}
+
+// getTranslation returns received translation data or error.
+func getTranslation(client *http.Client, url string) (data []byte, err error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+
+	defer log.OnCloserError(resp.Body, log.ERROR)
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("url: %q: %w", url, &statusError{code: resp.StatusCode})
+
+		return nil, err
+	}
+
+	limitReader, err := aghio.LimitReader(resp.Body, readLimit)
+	if err != nil {
+		err = fmt.Errorf("limit reading: %w", err)
+
+		return nil, err
+	}
+
+	data, err = io.ReadAll(limitReader)
+	if err != nil {
+		err = fmt.Errorf("reading all: %w", err)
+
+		return nil, err
+	}
+
+	return data, nil
+}
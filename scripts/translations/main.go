@@ -1,5 +1,6 @@
 // translations downloads translations, uploads translations, prints summary
-// for translations, prints unused strings.
+// for translations, prints and removes unused strings, validates translations,
+// and compares locales with the base one.
 package main
 
 import (
@@ -7,18 +8,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/aghio"
 	"github.com/AdguardTeam/golibs/errors"
-	"github.com/AdguardTeam/golibs/log"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
@@ -81,8 +76,20 @@ func main() {
 	case "unused":
 		err = unused()
 		check(err)
+	case "normalize":
+		err = normalize(conf.Languages)
+		check(err)
+	case "prune":
+		err = prune(conf.Languages)
+		check(err)
 	case "upload":
-		err = upload(uri, projectID, conf.BaseLangcode)
+		err = upload(uri, projectID, conf.BaseLangcode, conf.Languages)
+		check(err)
+	case "diff":
+		err = diff(conf.Languages, conf.BaseLangcode)
+		check(err)
+	case "validate":
+		err = validate(conf.Languages, conf.BaseLangcode)
 		check(err)
 	default:
 		usage("unknown command")
@@ -103,14 +110,31 @@ func usage(addStr string) {
 Commands:
   help
         Print usage.
-  summary
-        Print summary.
-  download [-n <count>]
+  summary [-json] [-threshold <percent>]
+        Print summary. If -json is set, print it as JSON. If percent is set,
+        exit with a non-zero code if any of the release-blocker locales is
+        translated less than that.
+  download [-n <count>] [-r <retries>] [-rps <rate>] [<lang> ...]
         Download translations. count is a number of concurrent downloads.
-  unused
-        Print unused strings.
-  upload
-        Upload translations.`
+        retries is a number of retries of the failed downloads. rate is a
+        maximum number of requests per second. If langs are set, only those
+        are downloaded.
+  unused [-prefix <prefix> ...]
+        Print unused strings. prefix is a prefix of the strings built
+        dynamically, which are considered used.
+  normalize
+        Sort the strings in all locales and fix their formatting.
+  prune [-prefix <prefix> ...]
+        Remove unused strings from all locales and sort them.
+  upload [-a] [-n <count>]
+        Upload translations. By default, only the base locale is uploaded. If
+        -a is set, all locales are uploaded. count is a number of concurrent
+        uploads.
+  diff <lang>
+        Print strings missing from the locale, present only in it, and the
+        same as in the base one.
+  validate
+        Check the placeholders and tags of all locales against the base one.`
 
 	if addStr != "" {
 		fmt.Printf("%s\n%s\n", addStr, usageStr)
@@ -184,49 +208,92 @@ func readLocales(fn string) (loc locales, err error) {
 	return loc, nil
 }
 
-// summary prints summary for translations.
-func summary(langs languages) (err error) {
-	basePath := filepath.Join(localesDir, defaultBaseFile)
-	baseLoc, err := readLocales(basePath)
+// writeLocales writes loc into the file with name fn as a JSON object with the
+// sorted text labels.
+func writeLocales(fn string, loc locales) (err error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+
+	// Encoder sorts the keys of maps.
+	err = enc.Encode(loc)
 	if err != nil {
-		return fmt.Errorf("summary: %w", err)
+		return fmt.Errorf("encoding %q: %w", fn, err)
 	}
 
-	size := float64(len(baseLoc))
+	err = os.WriteFile(fn, buf.Bytes(), 0o664)
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", fn, err)
+	}
 
-	keys := maps.Keys(langs)
-	slices.Sort(keys)
+	return nil
+}
 
-	for _, lang := range keys {
+// normalize rewrites the locale files of all languages from langs with the
+// sorted text labels and consistent indentation.
+func normalize(langs languages) (err error) {
+	codes := maps.Keys(langs)
+	slices.Sort(codes)
+
+	for _, lang := range codes {
 		name := filepath.Join(localesDir, string(lang)+".json")
-		if name == basePath {
-			continue
-		}
 
 		var loc locales
 		loc, err = readLocales(name)
 		if err != nil {
-			return fmt.Errorf("summary: reading locales: %w", err)
+			return fmt.Errorf("normalize: reading locales: %w", err)
 		}
 
-		f := float64(len(loc)) * 100 / size
-
-		fmt.Printf("%s\t %6.2f %%\n", lang, f)
+		err = writeLocales(name, loc)
+		if err != nil {
+			return fmt.Errorf("normalize: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// download and save all translations.  uri is the base URL.  projectID is the
-// name of the project.
-func download(uri *url.URL, projectID string, langs languages) (err error) {
-	var numWorker int
+// blockerLangCodes are the codes of the languages, which should be fully
+// translated before a release.
+var blockerLangCodes = []langCode{
+	"de",
+	"en",
+	"es",
+	"fr",
+	"it",
+	"ja",
+	"ko",
+	"pt-br",
+	"pt-pt",
+	"ru",
+	"zh-cn",
+	"zh-tw",
+}
+
+// langSummary is the translation summary of a single language.
+type langSummary struct {
+	Lang       langCode `json:"lang"`
+	Name       string   `json:"name"`
+	Translated int      `json:"translated"`
+	Total      int      `json:"total"`
+	Percent    float64  `json:"percent"`
+	IsBlocker  bool     `json:"is_blocker"`
+}
 
-	flagSet := flag.NewFlagSet("download", flag.ExitOnError)
+// summary prints summary for translations.  If the -threshold flag is set, err
+// is not nil if any of the release-blocker languages has a lower completion
+// percentage.
+func summary(langs languages) (err error) {
+	var isJSON bool
+	var threshold float64
+
+	flagSet := flag.NewFlagSet("summary", flag.ExitOnError)
 	flagSet.Usage = func() {
-		usage("download command error")
+		usage("summary command error")
 	}
-	flagSet.IntVar(&numWorker, "n", 1, "number of concurrent downloads")
+	flagSet.BoolVar(&isJSON, "json", false, "print summary as json")
+	flagSet.Float64Var(&threshold, "threshold", 0, "minimum percentage for release blockers")
 
 	err = flagSet.Parse(os.Args[2:])
 	if err != nil {
@@ -234,93 +301,83 @@ func download(uri *url.URL, projectID string, langs languages) (err error) {
 		return err
 	}
 
-	if numWorker < 1 {
-		usage("count must be positive")
+	if threshold < 0 || threshold > 100 {
+		usage("threshold must be between 0 and 100")
 	}
 
-	downloadURI := uri.JoinPath("download")
-
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	sums, err := summarize(langs)
+	if err != nil {
+		return fmt.Errorf("summary: %w", err)
 	}
 
-	var wg sync.WaitGroup
-	uriCh := make(chan *url.URL, len(langs))
-
-	for i := 0; i < numWorker; i++ {
-		wg.Add(1)
-		go downloadWorker(&wg, client, uriCh)
+	if isJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(sums)
+		if err != nil {
+			return fmt.Errorf("summary: encoding: %w", err)
+		}
+	} else {
+		for _, s := range sums {
+			fmt.Printf("%s\t %6.2f %%\n", s.Lang, s.Percent)
+		}
 	}
 
-	for lang := range langs {
-		uri = translationURL(downloadURI, defaultBaseFile, projectID, lang)
-
-		uriCh <- uri
+	var below []string
+	for _, s := range sums {
+		if s.IsBlocker && s.Percent < threshold {
+			below = append(below, string(s.Lang))
+		}
 	}
 
-	close(uriCh)
-	wg.Wait()
+	if len(below) > 0 {
+		return fmt.Errorf(
+			"summary: release blockers below %.2f %%: %s",
+			threshold,
+			strings.Join(below, ", "),
+		)
+	}
 
 	return nil
 }
 
-// downloadWorker downloads translations by received urls and saves them.
-func downloadWorker(wg *sync.WaitGroup, client *http.Client, uriCh <-chan *url.URL) {
-	defer wg.Done()
+// summarize returns the sorted summaries of all languages except the base one.
+func summarize(langs languages) (sums []*langSummary, err error) {
+	basePath := filepath.Join(localesDir, defaultBaseFile)
+	baseLoc, err := readLocales(basePath)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
 
-	for uri := range uriCh {
-		data, err := getTranslation(client, uri.String())
-		if err != nil {
-			log.Error("download worker: getting translation: %s", err)
+	size := float64(len(baseLoc))
+
+	keys := maps.Keys(langs)
+	slices.Sort(keys)
 
+	for _, lang := range keys {
+		name := filepath.Join(localesDir, string(lang)+".json")
+		if name == basePath {
 			continue
 		}
 
-		q := uri.Query()
-		code := q.Get("language")
-
-		name := filepath.Join(localesDir, code+".json")
-		err = os.WriteFile(name, data, 0o664)
+		var loc locales
+		loc, err = readLocales(name)
 		if err != nil {
-			log.Error("download worker: writing file: %s", err)
-
-			continue
+			return nil, fmt.Errorf("reading locales: %w", err)
 		}
 
-		fmt.Println(name)
-	}
-}
-
-// getTranslation returns received translation data or error.
-func getTranslation(client *http.Client, url string) (data []byte, err error) {
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("requesting: %w", err)
-	}
-
-	defer log.OnCloserError(resp.Body, log.ERROR)
-
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("url: %q; status code: %s", url, http.StatusText(resp.StatusCode))
-
-		return nil, err
-	}
-
-	limitReader, err := aghio.LimitReader(resp.Body, readLimit)
-	if err != nil {
-		err = fmt.Errorf("limit reading: %w", err)
-
-		return nil, err
+		sums = append(sums, &langSummary{
+			Lang:       lang,
+			Name:       langs[lang],
+			Translated: len(loc),
+			Total:      len(baseLoc),
+			Percent:    float64(len(loc)) * 100 / size,
+			IsBlocker:  slices.Contains(blockerLangCodes, lang),
+		})
 	}
 
-	data, err = io.ReadAll(limitReader)
-	if err != nil {
-		err = fmt.Errorf("reading all: %w", err)
-
-		return nil, err
-	}
-
-	return data, nil
+	return sums, nil
 }
 
 // translationURL returns a new url.URL with provided query parameters.
@@ -338,127 +395,3 @@ func translationURL(oldURL *url.URL, baseFile, projectID string, lang langCode)
 
 	return uri
 }
-
-// unused prints unused text labels.
-func unused() (err error) {
-	fileNames := []string{}
-	basePath := filepath.Join(localesDir, defaultBaseFile)
-	baseLoc, err := readLocales(basePath)
-	if err != nil {
-		return fmt.Errorf("unused: %w", err)
-	}
-
-	locDir := filepath.Clean(localesDir)
-
-	err = filepath.Walk(srcDir, func(name string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Info("accessing a path %q: %s", name, err)
-
-			return nil
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		if strings.HasPrefix(name, locDir) {
-			return nil
-		}
-
-		ext := filepath.Ext(name)
-		if ext == ".js" || ext == ".json" {
-			fileNames = append(fileNames, name)
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("filepath walking %q: %w", srcDir, err)
-	}
-
-	err = removeUnused(fileNames, baseLoc)
-
-	return errors.Annotate(err, "removing unused: %w")
-}
-
-func removeUnused(fileNames []string, loc locales) (err error) {
-	knownUsed := []textLabel{
-		"blocking_mode_refused",
-		"blocking_mode_nxdomain",
-		"blocking_mode_custom_ip",
-	}
-
-	for _, v := range knownUsed {
-		delete(loc, v)
-	}
-
-	for _, fn := range fileNames {
-		var buf []byte
-		buf, err = os.ReadFile(fn)
-		if err != nil {
-			// Don't wrap the error since it's informative enough as is.
-			return err
-		}
-
-		for k := range loc {
-			if bytes.Contains(buf, []byte(k)) {
-				delete(loc, k)
-			}
-		}
-	}
-
-	printUnused(loc)
-
-	return nil
-}
-
-// printUnused text labels to stdout.
-func printUnused(loc locales) {
-	keys := maps.Keys(loc)
-	slices.Sort(keys)
-
-	for _, v := range keys {
-		fmt.Println(v)
-	}
-}
-
-// upload base translation.  uri is the base URL.  projectID is the name of the
-// project.  baseLang is the base language code.
-func upload(uri *url.URL, projectID string, baseLang langCode) (err error) {
-	uploadURI := uri.JoinPath("upload")
-
-	lang := baseLang
-
-	langStr := os.Getenv("UPLOAD_LANGUAGE")
-	if langStr != "" {
-		lang = langCode(langStr)
-	}
-
-	basePath := filepath.Join(localesDir, defaultBaseFile)
-	b, err := os.ReadFile(basePath)
-	if err != nil {
-		return fmt.Errorf("upload: %w", err)
-	}
-
-	var buf bytes.Buffer
-	buf.Write(b)
-
-	uri = translationURL(uploadURI, defaultBaseFile, projectID, lang)
-
-	var client http.Client
-	resp, err := client.Post(uri.String(), "application/json", &buf)
-	if err != nil {
-		return fmt.Errorf("upload: client post: %w", err)
-	}
-
-	defer func() {
-		err = errors.WithDeferred(err, resp.Body.Close())
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status code is not ok: %q", http.StatusText(resp.StatusCode))
-	}
-
-	return nil
-}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// prune removes the unused text labels from the base locale and all locales
+// from langs, writes the locale files with the sorted text labels, and prints
+// the removed text labels along with the number of those removed from each
+// file.
+func prune(langs languages) (err error) {
+	prefixes, err := parseUnusedFlags("prune")
+	if err != nil {
+		// Don't wrap the error since there is exit on error.
+		return err
+	}
+
+	unusedLoc, err := findUnused(prefixes)
+	if err != nil {
+		return fmt.Errorf("prune: %w", err)
+	}
+
+	labels := maps.Keys(unusedLoc)
+	slices.Sort(labels)
+
+	for _, label := range labels {
+		fmt.Printf("- %s: %q\n", label, unusedLoc[label])
+	}
+
+	codes := maps.Keys(langs)
+	slices.Sort(codes)
+
+	for _, lang := range codes {
+		name := filepath.Join(localesDir, string(lang)+".json")
+
+		var loc locales
+		loc, err = readLocales(name)
+		if err != nil {
+			return fmt.Errorf("prune: reading locales: %w", err)
+		}
+
+		removed := 0
+		for _, label := range labels {
+			if _, ok := loc[label]; ok {
+				delete(loc, label)
+				removed++
+			}
+		}
+
+		err = writeLocales(name, loc)
+		if err != nil {
+			return fmt.Errorf("prune: %w", err)
+		}
+
+		fmt.Printf("%s\t-%d\n", name, removed)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// initialBackoff is the delay before the first retry of a request.  It is
+// doubled for each next retry.
+const initialBackoff = 1 * time.Second
+
+// statusError is returned when the server responds with a non-OK status code.
+type statusError struct {
+	code int
+}
+
+// Error implements the error interface for *statusError.
+func (err *statusError) Error() (msg string) {
+	return fmt.Sprintf("status code is not ok: %q", http.StatusText(err.code))
+}
+
+// isTransient returns true if the request failed with err may succeed when
+// retried, that is if it's a network error, a rate limit, or a server error.
+func isTransient(err error) (ok bool) {
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+
+	return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+}
+
+// retry calls f up to maxAttempts times with an exponential backoff until it
+// succeeds or fails with an error, which isn't transient.  If limit is not nil,
+// each attempt waits for a value from it first.  lang is used for logging.
+func retry(
+	lang langCode,
+	maxAttempts int,
+	limit <-chan time.Time,
+	f func() (err error),
+) (err error) {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		if limit != nil {
+			<-limit
+		}
+
+		err = f()
+		if err == nil || attempt >= maxAttempts || !isTransient(err) {
+			return err
+		}
+
+		log.Info("%s: attempt %d: %s; retrying in %s", lang, attempt, err, backoff)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
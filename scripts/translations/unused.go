@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// srcExts are the extensions of the source files, which are searched for the
+// text labels.
+var srcExts = []string{".js", ".jsx", ".json", ".ts", ".tsx"}
+
+// tokenRe matches the identifier-like tokens of the source code, which may be
+// text labels.
+var tokenRe = regexp.MustCompile(`[A-Za-z0-9_]+`)
+
+// dynamicPrefixRes match the prefixes of the text labels built dynamically,
+// such as `blocking_mode_${mode}` or 'blocking_mode_' + mode.  Only the
+// prefixes ending with an underscore are matched to avoid the false matches of
+// the unrelated strings.
+var dynamicPrefixRes = []*regexp.Regexp{
+	regexp.MustCompile("`([A-Za-z0-9_]+_)\\$\\{"),
+	regexp.MustCompile(`['"]([A-Za-z0-9_]+_)['"]\s*\+`),
+}
+
+// prefixesFlag is a flag.Value, which collects the values of a repeated flag.
+type prefixesFlag []string
+
+// type check
+var _ flag.Value = (*prefixesFlag)(nil)
+
+// String implements the flag.Value interface for *prefixesFlag.
+func (f *prefixesFlag) String() (s string) {
+	return strings.Join(*f, ",")
+}
+
+// Set implements the flag.Value interface for *prefixesFlag.
+func (f *prefixesFlag) Set(s string) (err error) {
+	*f = append(*f, s)
+
+	return nil
+}
+
+// parseUnusedFlags parses the flags of the command cmd searching for the unused
+// text labels and returns the prefixes of the text labels to consider used.
+func parseUnusedFlags(cmd string) (prefixes []string, err error) {
+	var f prefixesFlag
+
+	flagSet := flag.NewFlagSet(cmd, flag.ExitOnError)
+	flagSet.Usage = func() {
+		usage(cmd + " command error")
+	}
+	flagSet.Var(&f, "prefix", "prefix of dynamically built strings, may be repeated")
+
+	err = flagSet.Parse(os.Args[2:])
+	if err != nil {
+		// Don't wrap the error since there is exit on error.
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// unused prints unused text labels.
+func unused() (err error) {
+	prefixes, err := parseUnusedFlags("unused")
+	if err != nil {
+		// Don't wrap the error since there is exit on error.
+		return err
+	}
+
+	loc, err := findUnused(prefixes)
+	if err != nil {
+		return fmt.Errorf("unused: %w", err)
+	}
+
+	printUnused(loc)
+
+	return nil
+}
+
+// findUnused returns the text labels of the base locale, which aren't used in
+// the source code, along with their translations.  The text labels starting
+// with any of prefixes are considered used.
+func findUnused(prefixes []string) (loc locales, err error) {
+	fileNames := []string{}
+	basePath := filepath.Join(localesDir, defaultBaseFile)
+	baseLoc, err := readLocales(basePath)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	locDir := filepath.Clean(localesDir)
+
+	err = filepath.Walk(srcDir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Info("accessing a path %q: %s", name, err)
+
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(name, locDir) {
+			return nil
+		}
+
+		if slices.Contains(srcExts, filepath.Ext(name)) {
+			fileNames = append(fileNames, name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("filepath walking %q: %w", srcDir, err)
+	}
+
+	err = removeUsed(fileNames, baseLoc, prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("removing used: %w", err)
+	}
+
+	return baseLoc, nil
+}
+
+// removeUsed removes the text labels found in the files with names fileNames
+// from loc.  The text labels starting with any of prefixes or any of the
+// prefixes of the text labels built dynamically in those files are removed as
+// well.
+func removeUsed(fileNames []string, loc locales, prefixes []string) (err error) {
+	prefixes = slices.Clone(prefixes)
+
+	for _, fn := range fileNames {
+		var buf []byte
+		buf, err = os.ReadFile(fn)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		tokens := map[string]struct{}{}
+		for _, t := range tokenRe.FindAll(buf, -1) {
+			tokens[string(t)] = struct{}{}
+		}
+
+		for _, re := range dynamicPrefixRes {
+			for _, m := range re.FindAllSubmatch(buf, -1) {
+				prefixes = append(prefixes, string(m[1]))
+			}
+		}
+
+		for k := range loc {
+			// The plural forms are chosen by i18next, so only the singular
+			// ones appear in the source code.
+			label := strings.TrimSuffix(string(k), "_plural")
+			if _, ok := tokens[label]; ok {
+				delete(loc, k)
+			}
+		}
+	}
+
+	for k := range loc {
+		if hasAnyPrefix(string(k), prefixes) {
+			delete(loc, k)
+		}
+	}
+
+	return nil
+}
+
+// hasAnyPrefix returns true if s starts with any of prefixes.
+func hasAnyPrefix(s string, prefixes []string) (ok bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printUnused text labels to stdout.
+func printUnused(loc locales) {
+	keys := maps.Keys(loc)
+	slices.Sort(keys)
+
+	for _, v := range keys {
+		fmt.Println(v)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// uploadTimeout is the timeout for a single upload request.
+	uploadTimeout = 30 * time.Second
+
+	// uploadMaxAttempts is the maximum number of attempts to upload a single
+	// locale.
+	uploadMaxAttempts = 5
+)
+
+// uploadJob is a single locale to upload.
+type uploadJob struct {
+	// uri is the URL of the upload with the query parameters.
+	uri *url.URL
+
+	// lang is the language code of the locale.
+	lang langCode
+
+	// path is the path to the locale file.
+	path string
+}
+
+// uploadResult is the result of a single uploadJob.
+type uploadResult struct {
+	// err is the error of the last attempt, if any.
+	err error
+
+	// lang is the language code of the locale.
+	lang langCode
+}
+
+// upload translations.  uri is the base URL.  projectID is the name of the
+// project.  baseLang is the base language code.  Only the base locale is
+// uploaded, unless the -a flag is set, in which case all locales from langs
+// are uploaded concurrently.
+func upload(uri *url.URL, projectID string, baseLang langCode, langs languages) (err error) {
+	var numWorker int
+	var all bool
+
+	flagSet := flag.NewFlagSet("upload", flag.ExitOnError)
+	flagSet.Usage = func() {
+		usage("upload command error")
+	}
+	flagSet.IntVar(&numWorker, "n", 1, "number of concurrent uploads")
+	flagSet.BoolVar(&all, "a", false, "upload all locales")
+
+	err = flagSet.Parse(os.Args[2:])
+	if err != nil {
+		// Don't wrap the error since there is exit on error.
+		return err
+	}
+
+	if numWorker < 1 {
+		usage("count must be positive")
+	}
+
+	uploadURI := uri.JoinPath("upload")
+	client := &http.Client{
+		Timeout: uploadTimeout,
+	}
+
+	if !all {
+		lang := baseLang
+
+		langStr := os.Getenv("UPLOAD_LANGUAGE")
+		if langStr != "" {
+			lang = langCode(langStr)
+		}
+
+		err = uploadWithRetry(client, uploadJob{
+			uri:  translationURL(uploadURI, defaultBaseFile, projectID, lang),
+			lang: lang,
+			path: filepath.Join(localesDir, defaultBaseFile),
+		})
+
+		return errors.Annotate(err, "upload: %w")
+	}
+
+	return uploadAll(client, uploadURI, projectID, langs, numWorker)
+}
+
+// uploadAll uploads all locales from langs using numWorker workers and prints
+// the result for each of them.
+func uploadAll(
+	client *http.Client,
+	uploadURI *url.URL,
+	projectID string,
+	langs languages,
+	numWorker int,
+) (err error) {
+	var wg sync.WaitGroup
+	jobCh := make(chan uploadJob, len(langs))
+	resCh := make(chan uploadResult, len(langs))
+
+	for i := 0; i < numWorker; i++ {
+		wg.Add(1)
+		go uploadWorker(&wg, client, jobCh, resCh)
+	}
+
+	for lang := range langs {
+		jobCh <- uploadJob{
+			uri:  translationURL(uploadURI, defaultBaseFile, projectID, lang),
+			lang: lang,
+			path: filepath.Join(localesDir, string(lang)+".json"),
+		}
+	}
+
+	close(jobCh)
+	wg.Wait()
+	close(resCh)
+
+	results := make([]uploadResult, 0, len(langs))
+	for res := range resCh {
+		results = append(results, res)
+	}
+
+	slices.SortFunc(results, func(a, b uploadResult) (less bool) {
+		return a.lang < b.lang
+	})
+
+	failed := 0
+	for _, res := range results {
+		if res.err != nil {
+			fmt.Printf("%s\terror: %s\n", res.lang, res.err)
+			failed++
+
+			continue
+		}
+
+		fmt.Printf("%s\tok\n", res.lang)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("upload: %d of %d locales failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// uploadWorker uploads the received locales and sends the results to resCh.
+func uploadWorker(
+	wg *sync.WaitGroup,
+	client *http.Client,
+	jobCh <-chan uploadJob,
+	resCh chan<- uploadResult,
+) {
+	defer wg.Done()
+
+	for job := range jobCh {
+		resCh <- uploadResult{
+			err:  uploadWithRetry(client, job),
+			lang: job.lang,
+		}
+	}
+}
+
+// uploadWithRetry uploads the locale described by job, retrying with an
+// exponential backoff on transient errors.
+func uploadWithRetry(client *http.Client, job uploadJob) (err error) {
+	b, err := os.ReadFile(job.path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return retry(job.lang, uploadMaxAttempts, nil, func() (err error) {
+		return uploadData(client, job.uri, b)
+	})
+}
+
+// uploadData sends b to uri.
+func uploadData(client *http.Client, uri *url.URL, b []byte) (err error) {
+	resp, err := client.Post(uri.String(), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("client post: %w", err)
+	}
+
+	defer func() {
+		err = errors.WithDeferred(err, resp.Body.Close())
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// placeholderRe matches the interpolation placeholders, such as "{{count}}".
+var placeholderRe = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// tagRe matches the tags, such as "<0>", "</a>", or "<br/>".
+var tagRe = regexp.MustCompile(`<(/?)([a-zA-Z0-9]+)[^<>]*?(/?)>`)
+
+// validate checks every locale against the base one for mismatched
+// placeholders, unbalanced tags, and stray HTML, and prints a report for each
+// locale with problems.  err is not nil if there are any problems.
+func validate(langs languages, baseLang langCode) (err error) {
+	basePath := filepath.Join(localesDir, defaultBaseFile)
+	baseLoc, err := readLocales(basePath)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	codes := maps.Keys(langs)
+	slices.Sort(codes)
+
+	total, badLocales := 0, 0
+	for _, lang := range codes {
+		if lang == baseLang {
+			continue
+		}
+
+		var loc locales
+		loc, err = readLocales(filepath.Join(localesDir, string(lang)+".json"))
+		if err != nil {
+			return fmt.Errorf("validate: reading locales: %w", err)
+		}
+
+		problems := validateLocale(baseLoc, loc)
+		if len(problems) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s: %d problem(s)\n", lang, len(problems))
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+
+		total += len(problems)
+		badLocales++
+	}
+
+	if total > 0 {
+		return fmt.Errorf("validate: %d problem(s) in %d locale(s)", total, badLocales)
+	}
+
+	fmt.Println("validate: no problems found")
+
+	return nil
+}
+
+// validateLocale returns the problems of the translations in loc compared to
+// the ones in baseLoc.  The labels missing in baseLoc are skipped.
+func validateLocale(baseLoc, loc locales) (problems []string) {
+	labels := maps.Keys(loc)
+	slices.Sort(labels)
+
+	for _, label := range labels {
+		base, ok := baseLoc[label]
+		if !ok {
+			continue
+		}
+
+		for _, p := range validateTranslation(base, loc[label]) {
+			problems = append(problems, fmt.Sprintf("%s: %s", label, p))
+		}
+	}
+
+	return problems
+}
+
+// validateTranslation returns the problems of the translation tr of the base
+// string base.
+func validateTranslation(base, tr string) (problems []string) {
+	basePhs, trPhs := placeholders(base), placeholders(tr)
+	for _, ph := range setDiff(basePhs, trPhs) {
+		problems = append(problems, fmt.Sprintf("missing placeholder {{%s}}", ph))
+	}
+
+	for _, ph := range setDiff(trPhs, basePhs) {
+		problems = append(problems, fmt.Sprintf("unknown placeholder {{%s}}", ph))
+	}
+
+	baseTags, _ := tags(base)
+	trTags, unbalanced := tags(tr)
+	problems = append(problems, unbalanced...)
+
+	for _, t := range setDiff(baseTags, trTags) {
+		problems = append(problems, fmt.Sprintf("missing tag <%s>", t))
+	}
+
+	for _, t := range setDiff(trTags, baseTags) {
+		problems = append(problems, fmt.Sprintf("stray tag <%s>", t))
+	}
+
+	return problems
+}
+
+// placeholders returns the names of the interpolation placeholders in s.
+func placeholders(s string) (names map[string]int) {
+	names = map[string]int{}
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		names[m[1]]++
+	}
+
+	return names
+}
+
+// tags returns the names of the tags in s and the descriptions of the closing
+// tags without the opening ones and the other way around.
+func tags(s string) (names map[string]int, unbalanced []string) {
+	names = map[string]int{}
+
+	var stack []string
+	for _, m := range tagRe.FindAllStringSubmatch(s, -1) {
+		isClosing, name, isSelfClosing := m[1] != "", m[2], m[3] != ""
+		switch {
+		case isSelfClosing:
+			names[name]++
+		case isClosing:
+			if len(stack) == 0 || stack[len(stack)-1] != name {
+				unbalanced = append(unbalanced, fmt.Sprintf("unbalanced tag </%s>", name))
+
+				continue
+			}
+
+			stack = stack[:len(stack)-1]
+		default:
+			names[name]++
+			stack = append(stack, name)
+		}
+	}
+
+	for _, name := range stack {
+		unbalanced = append(unbalanced, fmt.Sprintf("unclosed tag <%s>", name))
+	}
+
+	return names, unbalanced
+}
+
+// setDiff returns the sorted keys of a which have a greater count than in b.
+func setDiff(a, b map[string]int) (diff []string) {
+	for k, n := range a {
+		if n > b[k] {
+			diff = append(diff, k)
+		}
+	}
+
+	slices.Sort(diff)
+
+	return diff
+}